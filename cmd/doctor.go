@@ -0,0 +1,118 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/config"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/doctor"
+	"github.com/urfave/cli"
+)
+
+const (
+	doctorFormatText = "text"
+	doctorFormatJSON = "json"
+)
+
+var errDoctorChecksFailed = errors.New("one or more checks failed")
+
+func newDoctorCommand() cli.Command {
+	return cli.Command{
+		Name:  "doctor",
+		Usage: "Check the environment for common problems that prevent mounting",
+		UsageText: "gcsfuse [global options] doctor [--bucket bucket] [--format text|json]\n\n" +
+			"   Global options such as --key-file, --custom-endpoint and --o are honoured.",
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "bucket",
+				Usage: "If set, also check that this bucket can be listed.",
+			},
+			cli.StringFlag{
+				Name:  "format",
+				Value: doctorFormatText,
+				Usage: "Output format: 'text' or 'json'.",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			return runDoctor(c, os.Stdout)
+		},
+	}
+}
+
+func runDoctor(c *cli.Context, w io.Writer) (err error) {
+	format := c.String("format")
+	if format != doctorFormatText && format != doctorFormatJSON {
+		return fmt.Errorf("unsupported format %q: must be %q or %q", format, doctorFormatText, doctorFormatJSON)
+	}
+
+	// The global flags live on the app-level context.
+	appCtx := c.Parent()
+	if err = resolvePathForTheFlagsInContext(appCtx); err != nil {
+		return fmt.Errorf("Resolving path: %w", err)
+	}
+
+	flags, err := populateFlags(appCtx)
+	if err != nil {
+		return fmt.Errorf("parsing flags failed: %w", err)
+	}
+
+	mountConfig, err := config.ParseConfigFileWithProfile(flags.ConfigFile, flags.Profile)
+	if err != nil {
+		return fmt.Errorf("parsing config file failed: %w", err)
+	}
+	config.OverrideWithAnonymousAccessFlag(appCtx, mountConfig, flags.AnonymousAccess)
+	if err = config.OverrideWithGCSConnectionFlags(appCtx, mountConfig, string(flags.ClientProtocol),
+		flags.MaxConnsPerHost, flags.MaxIdleConnsPerHost); err != nil {
+		return fmt.Errorf("invalid gcs-connection settings: %w", err)
+	}
+
+	opts := doctor.Options{
+		Bucket:          c.String("bucket"),
+		AnonymousAccess: mountConfig.AuthConfig.AnonymousAccess,
+	}
+	if _, ok := flags.MountOptions["allow_other"]; ok {
+		opts.AllowOther = true
+	}
+	if flags.CustomEndpoint != nil {
+		opts.Host = flags.CustomEndpoint.Hostname()
+		opts.Port = flags.CustomEndpoint.Port()
+		if opts.Port == "" && flags.CustomEndpoint.Scheme == "http" {
+			opts.Port = "80"
+		}
+	}
+
+	userAgent := getUserAgent(flags.AppName, getConfigForUserAgent(mountConfig))
+	prober := doctor.NewProber(getStorageClientConfig(flags, mountConfig, userAgent), flags.BillingProject)
+	results := doctor.Run(context.Background(), prober, opts)
+
+	if format == doctorFormatJSON {
+		err = doctor.WriteJSON(w, results)
+	} else {
+		err = doctor.WriteText(w, results)
+	}
+	if err != nil {
+		return fmt.Errorf("writing results: %w", err)
+	}
+
+	if doctor.Failed(results) {
+		return errDoctorChecksFailed
+	}
+	return nil
+}
@@ -23,9 +23,13 @@ import (
 	"time"
 
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/config"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/fs/inode"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/gcsx"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/monitor"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/mount"
 	mountpkg "github.com/googlecloudplatform/gcsfuse/v2/internal/mount"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/util"
 	"github.com/urfave/cli"
 )
@@ -33,11 +37,16 @@ import (
 // Defines the max value supported by sequential-read-size-mb flag.
 const (
 	// maxSequentialReadSizeMb is the max value supported by sequential-read-size-mb flag.
-	maxSequentialReadSizeMb = 1024
+	maxSequentialReadSizeMb = config.MaxSequentialReadSizeMb
 
 	// ExperimentalMetadataPrefetchOnMountFlag is the name of the commandline flag for enabling
 	// metadata-prefetch mode aka 'ls -R' during mount.
 	ExperimentalMetadataPrefetchOnMountFlag = "experimental-metadata-prefetch-on-mount"
+
+	// fuseParallelismPerCPU is the value of fuse-parallelism per CPU of the
+	// cgroup quota with cgroup-cpu-quota. Most operations wait on GCS rather
+	// than use the CPU.
+	fuseParallelismPerCPU = 16
 )
 
 // Set up custom help text for gcsfuse; in particular the usage section.
@@ -47,6 +56,7 @@ func init() {
 
 USAGE:
    {{.Name}} {{if .Flags}}[global options]{{end}} [bucket] mountpoint
+   {{.Name}} {{if .Flags}}[global options]{{end}} doctor [--bucket bucket] [--format text|json]
    {{if .Version}}
 VERSION:
    {{.Version}}
@@ -75,6 +85,9 @@ func newApp() (app *cli.App) {
 		Version: getVersion(),
 		Usage:   "Mount a specified GCS bucket or all accessible buckets locally",
 		Writer:  os.Stderr,
+		Commands: []cli.Command{
+			newDoctorCommand(),
+		},
 		Flags: []cli.Flag{
 
 			cli.StringFlag{
@@ -95,6 +108,15 @@ func newApp() (app *cli.App) {
 					"Refer to 'https://cloud.google.com/storage/docs/gcsfuse-cli#config-file' for possible configurations.",
 			},
 
+			cli.StringFlag{
+				Name:  config.ProfileFlagName,
+				Value: "",
+				Usage: "The name of a profile to apply: settings for a kind of workload that override the defaults, " +
+					"and are overridden by the flags. One of " + strings.Join(config.BuiltinProfileNames(), ", ") +
+					", or a profile defined under profiles in the config file, which overrides the rest of the file " +
+					"and the built-in profile of the same name.",
+			},
+
 			/////////////////////////
 			// File system
 			/////////////////////////
@@ -104,6 +126,31 @@ func newApp() (app *cli.App) {
 				Usage: "Additional system-specific mount options. Multiple options can be passed as comma separated. For readonly, use --o ro",
 			},
 
+			cli.BoolFlag{
+				Name:  "nonempty",
+				Usage: "Allow mounting over a non-empty directory, hiding its contents. Also set by -o nonempty.",
+			},
+
+			cli.BoolFlag{
+				Name: "allow-remount",
+				Usage: "If the mount point already has a FUSE file system mounted on it, e.g. a stale gcsfuse " +
+					"mount, lazily unmount it and mount in its place, instead of failing.",
+			},
+
+			cli.IntFlag{
+				Name:  "fuse-fd",
+				Value: 0,
+				Usage: "If positive, serve the file system on this already open file descriptor of /dev/fuse, " +
+					"which the caller has mounted on the mount point, rather than mounting it. gcsfuse then " +
+					"needs no privileges to mount, and leaves unmounting to the caller. Requires --foreground.",
+			},
+
+			cli.StringFlag{
+				Name: "fuse-socket",
+				Usage: "Like --fuse-fd, but receive the file descriptor of /dev/fuse over the unix socket at this " +
+					"path.",
+			},
+
 			cli.GenericFlag{
 				Name:  "dir-mode",
 				Value: dirModeValue,
@@ -162,6 +209,18 @@ func newApp() (app *cli.App) {
 					"GCSFuse uses the global GCS JSON API endpoint, https://storage.googleapis.com/storage/v1.",
 			},
 
+			cli.StringFlag{
+				Name: "universe-domain",
+				Usage: "The universe domain the GCS, IAM credentials and STS APIs are reached in, e.g. for a " +
+					"Trusted Partner Cloud. Credentials must be for it. (default: googleapis.com)",
+			},
+
+			cli.StringFlag{
+				Name: "psc-endpoint",
+				Usage: "The Private Service Connect endpoint the Google APIs are reached through, e.g. restricted " +
+					"for storage-restricted.p.googleapis.com. (default: none)",
+			},
+
 			cli.BoolFlag{
 				Name:  config.AnonymousAccess,
 				Usage: "Authentication is enabled by default. This flag will disable authentication",
@@ -202,10 +261,34 @@ func newApp() (app *cli.App) {
 				Usage: "Operations per second limit, measured over a 30-second window (use -1 for no limit)",
 			},
 
+			cli.Float64Flag{
+				Name:  "max-metadata-ops-per-sec",
+				Value: 0,
+				Usage: "Send at most this many GCS metadata requests billed per operation (listings, stats and " +
+					"updates of objects) per second on average, e.g. to cap the bill of a misbehaving workload. " +
+					"Requests over the limit wait for their turn for up to 10s, and fail with EAGAIN if it's further " +
+					"off. Requests flushing written data are exempt. The default value 0 means no limit.",
+			},
+
+			cli.IntFlag{
+				Name:  "metadata-ops-burst",
+				Value: 0,
+				Usage: "With --max-metadata-ops-per-sec, the number of metadata requests that can be sent at once " +
+					"after a quiet spell. The default value 0 allows one second's worth.",
+			},
+
 			cli.IntFlag{
 				Name:  "sequential-read-size-mb",
 				Value: 200,
-				Usage: "File chunk size to read from GCS in one call. Need to specify the value in MB. ChunkSize less than 1MB is not supported",
+				Usage: "How far past the offset read, in MB, to ask GCS for in one request when a file is read sequentially, so that one request serves many reads. Random reads ask for exactly the range read. Values less than 1MB are not supported",
+			},
+
+			cli.IntFlag{
+				Name:  "mmap-read-retries",
+				Value: 3,
+				Usage: "How many times to retry, backing off from 100ms, reads that look like page-ins (page-aligned " +
+					"reads of whole pages) when they fail with a transient GCS error. A failed page-in kills " +
+					"applications that mmap the file with SIGBUS.",
 			},
 
 			/////////////////////////
@@ -222,7 +305,7 @@ func newApp() (app *cli.App) {
 			cli.IntFlag{
 				Name:  "stat-cache-capacity",
 				Value: mount.DefaultStatCacheCapacity,
-				Usage: "How many entries can the stat-cache hold (impacts memory consumption). This flag has been deprecated (starting v2.0) and in its place only metadata-cache:stat-cache-max-size-mb in the gcsfuse config-file will be supported. For now, the value of stat-cache-capacity will be translated to the next higher corresponding value of metadata-cache:stat-cache-max-size-mb (assuming stat-cache entry-size ~= 1640 bytes, including 1400 for positive entry and 240 for corresponding negative entry), when metadata-cache:stat-cache-max-size-mb is not set.",
+				Usage: "How many entries can the stat-cache hold (impacts memory consumption). This flag has been deprecated (starting v2.0) and in its place only metadata-cache:stat-cache-max-size-mb in the gcsfuse config-file will be supported. For now, the value of stat-cache-capacity will be translated to the next higher corresponding value of metadata-cache:stat-cache-max-size-mb (assuming stat-cache entry-size ~= 1720 bytes, including 1480 for positive entry and 240 for corresponding negative entry), when metadata-cache:stat-cache-max-size-mb is not set.",
 			},
 
 			cli.DurationFlag{
@@ -237,6 +320,31 @@ func newApp() (app *cli.App) {
 				Usage: "How long to cache name -> file/dir mappings in directory inodes. This flag has been deprecated (starting v2.0) and in its place only metadata-cache:ttl-secs in the gcsfuse config-file will be supported. For now, the minimum of stat-cache-ttl and type-cache-ttl values, rounded up to the next higher multiple of a second, is used as ttl for both stat-cache and type-cache, when metadata-cache:ttl-secs is not set.",
 			},
 
+			cli.DurationFlag{
+				Name:  "file-entry-ttl",
+				Value: -1 * time.Second,
+				Usage: "How long the kernel caches lookups of files and their attributes, and the metadata " +
+					"cache keeps their records. Negative, the default, means the metadata cache ttl, with " +
+					"lookups not cached by the kernel.",
+			},
+
+			cli.DurationFlag{
+				Name:  "dir-entry-ttl",
+				Value: -1 * time.Second,
+				Usage: "How long the kernel caches lookups of directories and their attributes, and the metadata " +
+					"cache keeps their records. Negative, the default, means the metadata cache ttl, with " +
+					"lookups not cached by the kernel.",
+			},
+
+			cli.DurationFlag{
+				Name:  "attr-cache-ttl",
+				Value: -1 * time.Second,
+				Usage: "How long at most the kernel caches the attributes of files and directories, without " +
+					"shortening how long it caches their lookups, e.g. to see the growing size of a file " +
+					"appended to elsewhere. Attributes of files with unflushed writes are never cached. " +
+					"Negative, the default, means as long as their records are cached.",
+			},
+
 			cli.Int64Flag{
 				Name:  config.KernelListCacheTtlFlagName,
 				Value: config.DefaultKernelListCacheTtlSeconds,
@@ -251,6 +359,14 @@ func newApp() (app *cli.App) {
 				Usage: "The time duration that http client will wait to get response from the server. The default value 0 indicates no timeout. ",
 			},
 
+			cli.DurationFlag{
+				Name: "keepalive-interval",
+				Usage: "Send a cheap metadata request to GCS whenever no request has been made for this long, keeping " +
+					"connections and access tokens warm so that the first operation after an idle period isn't slowed " +
+					"down. Access tokens are refreshed twice this long before they expire, up to 30 minutes. The " +
+					"default value 0 disables keepalives.",
+			},
+
 			cli.DurationFlag{
 				Name:  "max-retry-duration",
 				Value: -1 * time.Second,
@@ -271,14 +387,14 @@ func newApp() (app *cli.App) {
 			},
 
 			cli.StringFlag{
-				Name:  "client-protocol",
+				Name:  config.ClientProtocolFlagName,
 				Value: string(mountpkg.HTTP1),
 				Usage: "The protocol used for communicating with the GCS backend. " +
 					"Value can be 'http1' (HTTP/1.1) or 'http2' (HTTP/2) or grpc.",
 			},
 
 			cli.IntFlag{
-				Name:  "max-conns-per-host",
+				Name:  config.MaxConnsPerHostFlagName,
 				Value: 0,
 				Usage: "The max number of TCP connections allowed per server. This is " +
 					"effective when --client-protocol is set to 'http1'. The default value" +
@@ -286,11 +402,247 @@ func newApp() (app *cli.App) {
 			},
 
 			cli.IntFlag{
-				Name:  "max-idle-conns-per-host",
+				Name:  config.MaxIdleConnsPerHostFlagName,
 				Value: 100,
 				Usage: "The number of maximum idle connections allowed per server.",
 			},
 
+			cli.IntFlag{
+				Name:  "mount-retry-attempts",
+				Value: mount.DefaultMountRetryAttempts,
+				Usage: "How many times to retry creating the storage client and probing the bucket at mount time " +
+					"after a transient failure (DNS errors, refused connections, timeouts, 5xx responses). " +
+					"Errors such as a missing bucket or denied permission are never retried. The default value 0 disables retries.",
+			},
+
+			cli.DurationFlag{
+				Name:  "mount-retry-backoff",
+				Value: mount.DefaultMountRetryBackoff,
+				Usage: "How long to wait before the first mount-time retry. The wait doubles after every retry, " +
+					"up to --max-retry-sleep.",
+			},
+
+			cli.BoolFlag{
+				Name: "lazy-init",
+				Usage: "Mount without creating the storage client or probing the bucket, which the first " +
+					"file system operation does instead. Errors found then fail the operations rather than the mount.",
+			},
+
+			cli.StringFlag{
+				Name:  "kernel-page-cache",
+				Value: config.DefaultKernelPageCache,
+				Usage: "When to keep the kernel page cache of a file from one open to the next. " +
+					"'auto' keeps it as long as the object generation hasn't changed since the last open, " +
+					"'always' keeps it unconditionally and 'never' drops it on every open.",
+			},
+
+			cli.StringFlag{
+				Name:  "dir-times",
+				Value: config.DefaultDirTimes,
+				Usage: "Which mtime and ctime to report for directories. 'mount' uses the time the " +
+					"directory was first looked up, 'placeholder' the update time of the directory's " +
+					"placeholder object if it has one, and 'newest-child' the latest update time of the " +
+					"children seen by the last listing of the directory, for as long as --type-cache-ttl.",
+			},
+
+			cli.IntFlag{
+				Name:  "dir-size-xattr-max-objects",
+				Value: mount.DefaultDirSizeXattrMaxObjects,
+				Usage: "The most objects the user.gcsfuse.recursive_size and user.gcsfuse.object_count " +
+					"extended attributes of a directory count, listing everything under it, before " +
+					"failing with E2BIG. 0 disables the attributes.",
+			},
+
+			cli.IntFlag{
+				Name:  "dir-size-xattr-parallelism",
+				Value: mount.DefaultDirSizeXattrParallelism,
+				Usage: "The most listing calls the user.gcsfuse.recursive_size and " +
+					"user.gcsfuse.object_count extended attributes of a directory keep in " +
+					"flight at once, one per subdirectory being walked.",
+			},
+
+			cli.IntFlag{
+				Name:  "metadata-query-max-objects",
+				Value: mount.DefaultMetadataQueryMaxObjects,
+				Usage: "The most objects the user.gcsfuse.metadata.<key>=<value> extended attributes of a " +
+					"directory and the .gcsfuse/query control file scan for custom metadata matching the " +
+					"query before returning the matches so far, marked as truncated. 0 disables both.",
+			},
+
+			cli.DurationFlag{
+				Name:  "metadata-query-timeout",
+				Value: mount.DefaultMetadataQueryTimeout,
+				Usage: "How long the user.gcsfuse.metadata.<key>=<value> extended attributes of a directory " +
+					"and the .gcsfuse/query control file scan before returning the matches so far, marked " +
+					"as truncated. 0 means no limit.",
+			},
+
+			cli.BoolFlag{
+				Name: "compat-dir-markers",
+				Usage: "Treat empty objects with one of the --compat-dir-marker-content-types, which " +
+					"S3-compatible tools create to mark directories, as the directory of the same name " +
+					"rather than as files. Removing the directory deletes its marker.",
+			},
+
+			cli.StringFlag{
+				Name:  "compat-dir-marker-content-types",
+				Value: inode.DefaultCompatDirMarkerType,
+				Usage: "Comma-separated content types of the objects marking directories with --compat-dir-markers.",
+			},
+
+			cli.BoolFlag{
+				Name: "enable-lock-files",
+				Usage: "Take an advisory lock on a file before writing to it by exclusively creating the object " +
+					"<name>" + inode.LockObjectSuffix + ", and release it when the file is flushed. Opening a file " +
+					"for writing fails with EAGAIN while another writer holds its lock.",
+			},
+
+			cli.DurationFlag{
+				Name:  "lock-file-ttl",
+				Value: mount.DefaultLockFileTTL,
+				Usage: "How long a lock taken with --enable-lock-files is valid for. Older locks, e.g. left behind " +
+					"by a crashed writer, are broken by the next writer.",
+			},
+
+			cli.IntFlag{
+				Name:  "max-parallel-uploads",
+				Value: 0,
+				Usage: "If positive, closing a written file queues its upload to GCS instead of waiting for it, " +
+					"and up to this many uploads run in parallel in the background. Errors from a background " +
+					"upload are returned by the next operation on the file. Files opened with O_SYNC and fsync(2) " +
+					"still wait for the upload. The default value 0 uploads on close.",
+			},
+
+			cli.IntFlag{
+				Name:  "delete-parallelism",
+				Value: 16,
+				Usage: "Up to this many file objects are deleted from GCS at a time, by unlinks and by renaming " +
+					"a directory, which deletes the objects under its old name in parallel. Each unlink still " +
+					"returns the error of its own deletion, unless --async-unlink is set. The value 0 or 1 " +
+					"deletes one object at a time.",
+			},
+
+			cli.BoolFlag{
+				Name: "strict-unlink",
+				Usage: "Always ask GCS to delete the object of an unlinked file. By default, unlinking a name " +
+					"that the stat or type cache remembers not to exist fails with ENOENT right away, for as " +
+					"long as the cache entry lives.",
+			},
+
+			cli.BoolFlag{
+				Name: "async-unlink",
+				Usage: "Return from unlinking a name known to be a file before its object is deleted, so that " +
+					"rm -r deletes the files of a directory in parallel, up to --delete-parallelism. A failed " +
+					"deletion is only logged, and the file shows up again.",
+			},
+
+			cli.BoolFlag{
+				Name: "mutation-dry-run",
+				Usage: "Log the object-level operations planned for multi-object mutations, such as renaming a " +
+					"directory, removing a directory with its compat marker, an asynchronous unlink or a " +
+					"composite upload, and fail them with EROFS without executing them. Meant for tests; " +
+					"other single-object operations are executed as usual.",
+			},
+
+			cli.BoolFlag{
+				Name: "recover-staged-writes",
+				Usage: "Writes are journaled in temp-dir until they are uploaded. At mount time, upload writes left " +
+					"behind by a previous gcsfuse process, e.g. one that crashed, to files that had been closed, " +
+					"unless the object changed since. Without this flag, a warning explaining how to recover them " +
+					"is logged instead.",
+			},
+
+			cli.DurationFlag{
+				Name:  "flush-timeout",
+				Value: 0,
+				Usage: "If non-zero, give up on an upload that close(2) or fsync(2) waits for after this long, and " +
+					"fail with EIO. The file's staged contents and journal entry are kept in temp-dir, and opening " +
+					"the file logs a warning until it is flushed. The default value 0 waits for as long as the " +
+					"upload takes.",
+			},
+
+			cli.DurationFlag{
+				Name:  "flush-retry-interval",
+				Value: 0,
+				Usage: "With --flush-timeout, retry the uploads of flushes that timed out in the background this " +
+					"long apart, each retry being given --flush-timeout too, until one succeeds. The default value " +
+					"0 leaves them to be flushed again by the application or recovered by the next mount.",
+			},
+
+			cli.IntFlag{
+				Name:  "min-free-staging-mb",
+				Value: 0,
+				Usage: "Fail creating and writing files with ENOSPC while the file system holding temp-dir has less " +
+					"than this many MiB free, e.g. because other programs filled a shared disk, rather than when " +
+					"staging runs out of space midway. The free space is checked at most once a second. The " +
+					"default value 0 disables the check.",
+			},
+
+			cli.BoolFlag{
+				Name: "assume-read-only",
+				Usage: "Serve the bucket read-only without checking it: ops that would change it fail with EROFS, " +
+					"and nothing is set up to stage or upload writes. Buckets whose retention policy is locked are " +
+					"served read-only anyway, if the policy can be read.",
+			},
+
+			cli.DurationFlag{
+				Name:  "per-object-write-delay-max",
+				Value: 0,
+				Usage: "If non-zero, space out uploads of the same object to one a second, the rate GCS sustains " +
+					"before failing writes with 429s, by delaying each by up to this long. Background uploads of a " +
+					"file queued meanwhile are coalesced into one of its latest contents. The default value 0 " +
+					"uploads right away.",
+			},
+
+			cli.IntFlag{
+				Name:  "composite-upload-threshold",
+				Value: 0,
+				Usage: "If positive, upload files of at least this many MiB as parts in parallel, which are then " +
+					"composed into the object, as gsutil's parallel composite uploads do. Parts are written under " +
+					"the .gcsfuse_tmp/ prefix and deleted once composed, or garbage collected after a day. Buckets " +
+					"that refuse to compose objects get single-stream uploads instead. The default value 0 always " +
+					"uploads in a single stream.",
+			},
+
+			cli.BoolFlag{
+				Name: "enable-zero-extent-hints",
+				Usage: "Serve the ranges of an object that its " + gcsx.ZeroExtentsMetadataKey + " metadata " +
+					"describes as holding only zeros without reading them from GCS. Hints for another object " +
+					"generation or malformed hints are ignored.",
+			},
+
+			cli.BoolFlag{
+				Name: "preserve-atime",
+				Usage: "Persist access times set with utimes(2) and friends to the " + inode.FileAtimeMetadataKey +
+					" metadata of the object, and report them for the file. By default they are accepted and " +
+					"ignored, as if mounted with noatime, and a file's atime is its mtime.",
+			},
+
+			cli.DurationFlag{
+				Name:  "times-update-delay",
+				Value: 0,
+				Usage: "How long times set on a file whose contents are already in GCS are held back, so that those " +
+					"set meanwhile, e.g. by cp -p or tar, are written to the object's metadata in one request. " +
+					"They are written sooner when the file is synced, renamed or forgotten, and at unmount. " +
+					"The default value 0 writes each of them right away.",
+			},
+
+			cli.IntFlag{
+				Name:  "fuse-parallelism",
+				Value: 0,
+				Usage: "If positive, how many file system operations are processed at a time. It also raises the " +
+					"number of background requests, e.g. readahead, that the kernel lets be outstanding from " +
+					"its default of 12, which requires root. The default value 0 processes as many operations " +
+					"as the kernel sends.",
+			},
+
+			cli.BoolFlag{
+				Name: "cgroup-cpu-quota",
+				Usage: "Size gcsfuse to the CPU quota of its cgroup, e.g. the CPU limit of its container, rather " +
+					"than to the CPUs of the machine: set GOMAXPROCS to it unless set in the environment, and " +
+					"--fuse-parallelism, if not set, to " + strconv.Itoa(fuseParallelismPerCPU) + " per CPU.",
+			},
+
 			cli.BoolFlag{
 				Name: "enable-nonexistent-type-cache",
 				Usage: "Once set, if an inode is not found in GCS, a type cache entry with type NonexistentType" +
@@ -315,6 +667,28 @@ func newApp() (app *cli.App) {
 				Usage: "Experimental: Export metrics to the OpenTelemetry collector at this address.",
 			},
 
+			cli.StringFlag{
+				Name:  "telemetry-resource-attributes",
+				Value: "",
+				Usage: "Comma-separated key=value attributes of the resource that exported metrics describe, e.g. " +
+					"'service.name=ingest,team=data'. They override the detected ones: service.name, " +
+					"service.version, the bucket name, and the GCE, GKE and Kubernetes pod attributes.",
+			},
+
+			cli.StringFlag{
+				Name:  "session-summary-file",
+				Value: "",
+				Usage: "At unmount, write the summary of the session that is logged then, with the ops, errors, " +
+					"bytes read and written, file cache hit ratio, GCS requests, peak memory and duration, to " +
+					"this file as JSON.",
+			},
+
+			cli.BoolFlag{
+				Name: config.MetricsDetailedErrorsFlagName,
+				Usage: "Also break the op error count down by errno name, e.g. ENOENT, as the fs_errno tag. " +
+					"Only the 30 most common errnos get their own value; the rest are counted as OTHER.",
+			},
+
 			cli.StringFlag{
 				Name:  "log-file",
 				Value: "",
@@ -328,6 +702,14 @@ func newApp() (app *cli.App) {
 				Usage: "The format of the log file: 'text' or 'json'.",
 			},
 
+			cli.StringFlag{
+				Name:  "lifecycle-events",
+				Value: "",
+				Usage: "Append the stages of the mount (config-parsed, client-created, bucket-probed, mounted, " +
+					"ready, draining, unmounted) to this file as JSON lines, e.g. /dev/fd/3 for a descriptor " +
+					"inherited from the caller.",
+			},
+
 			cli.BoolFlag{
 				Name: "experimental-enable-json-read",
 				Usage: "By default, GCSFuse uses the GCS XML API to get and read objects. " +
@@ -393,9 +775,14 @@ type flagStorage struct {
 	AppName    string
 	Foreground bool
 	ConfigFile string
+	Profile    string
 
 	// File system
 	MountOptions     map[string]string
+	NonEmpty         bool
+	AllowRemount     bool
+	FuseFd           int
+	FuseSocket       string
 	DirMode          os.FileMode
 	FileMode         os.FileMode
 	Uid              int64
@@ -407,13 +794,18 @@ type flagStorage struct {
 
 	// GCS
 	CustomEndpoint                     *url.URL
+	UniverseDomain                     string
+	PSCEndpoint                        string
 	BillingProject                     string
 	KeyFile                            string
-	TokenUrl                           string
+	TokenUrl                           string `redact:"true"`
 	ReuseTokenFromUrl                  bool
 	EgressBandwidthLimitBytesPerSecond float64
 	OpRateLimitHz                      float64
+	MaxMetadataOpsPerSec               float64
+	MetadataOpsBurst                   int
 	SequentialReadSizeMb               int32
+	MmapReadRetries                    int
 	AnonymousAccess                    bool
 
 	// Tuning
@@ -421,8 +813,12 @@ type flagStorage struct {
 	StatCacheCapacity          int
 	StatCacheTTL               time.Duration
 	TypeCacheTTL               time.Duration
+	FileEntryTTL               time.Duration
+	DirEntryTTL                time.Duration
+	AttrCacheTTL               time.Duration
 	KernelListCacheTtlSeconds  int64
 	HttpClientTimeout          time.Duration
+	KeepaliveInterval          time.Duration
 	MaxRetryDuration           time.Duration
 	RetryMultiplier            float64
 	LocalFileCache             bool
@@ -431,14 +827,48 @@ type flagStorage struct {
 	MaxConnsPerHost            int
 	MaxIdleConnsPerHost        int
 	EnableNonexistentTypeCache bool
+	MountRetryAttempts         int
+	MountRetryBackoff          time.Duration
+	LazyInit                   bool
+	KernelPageCache            string
+	DirTimes                   string
+	DirSizeXattrMaxObjects     int
+	DirSizeXattrParallelism    int
+	MetadataQueryMaxObjects    int
+	MetadataQueryTimeout       time.Duration
+	CompatDirMarkers           bool
+	CompatDirMarkerTypes       []string
+	EnableLockFiles            bool
+	LockFileTTL                time.Duration
+	MaxParallelUploads         int
+	DeleteParallelism          int
+	StrictUnlink               bool
+	AsyncUnlink                bool
+	MutationDryRun             bool
+	RecoverStagedWrites        bool
+	FlushTimeout               time.Duration
+	FlushRetryInterval         time.Duration
+	MinFreeStagingMB           int
+	AssumeReadOnly             bool
+	PerObjectWriteDelayMax     time.Duration
+	CompositeUploadThreshold   int
+	EnableZeroExtentHints      bool
+	PreserveAtime              bool
+	TimesUpdateDelay           time.Duration
+	FuseParallelism            int
+	CgroupCPUQuota             bool
 
 	// Monitoring & Logging
-	StackdriverExportInterval  time.Duration
-	OtelCollectorAddress       string
-	LogFile                    string
-	LogFormat                  string
-	ExperimentalEnableJsonRead bool
-	DebugFuseErrors            bool
+	StackdriverExportInterval   time.Duration
+	OtelCollectorAddress        string
+	TelemetryResourceAttributes map[string]string
+	SessionSummaryFile          string
+	MetricsDetailedErrors       bool
+	LogFile                     string
+	LogFormat                   string
+	LifecycleEvents             string
+	ExperimentalEnableJsonRead  bool
+	DebugFuseErrors             bool
 
 	// Debugging
 	DebugFuse       bool
@@ -500,6 +930,21 @@ func resolvePathForTheFlagsInContext(c *cli.Context) (err error) {
 		return fmt.Errorf("resolving for config-file: %w", err)
 	}
 
+	err = resolvePathForTheFlagInContext("fuse-socket", c)
+	if err != nil {
+		return fmt.Errorf("resolving for fuse-socket: %w", err)
+	}
+
+	err = resolvePathForTheFlagInContext("lifecycle-events", c)
+	if err != nil {
+		return fmt.Errorf("resolving for lifecycle-events: %w", err)
+	}
+
+	err = resolvePathForTheFlagInContext("session-summary-file", c)
+	if err != nil {
+		return fmt.Errorf("resolving for session-summary-file: %w", err)
+	}
+
 	return
 }
 
@@ -517,6 +962,14 @@ func resolveConfigFilePaths(mountConfig *config.MountConfig) (err error) {
 		return
 	}
 
+	for i := range mountConfig.CacheDirs {
+		resolvedPath, err = resolveFilePath(string(mountConfig.CacheDirs[i].Path), "cache-dir")
+		mountConfig.CacheDirs[i].Path = config.CacheDir(resolvedPath)
+		if err != nil {
+			return
+		}
+	}
+
 	return
 }
 
@@ -536,15 +989,20 @@ func populateFlags(c *cli.Context) (flags *flagStorage, err error) {
 		}
 	}
 
-	clientProtocolString := strings.ToLower(c.String("client-protocol"))
+	clientProtocolString := strings.ToLower(c.String(config.ClientProtocolFlagName))
 	clientProtocol := mountpkg.ClientProtocol(clientProtocolString)
 	flags = &flagStorage{
 		AppName:    c.String("app-name"),
 		Foreground: c.Bool("foreground"),
 		ConfigFile: c.String("config-file"),
+		Profile:    c.String(config.ProfileFlagName),
 
 		// File system
 		MountOptions:     make(map[string]string),
+		NonEmpty:         c.Bool("nonempty"),
+		AllowRemount:     c.Bool("allow-remount"),
+		FuseFd:           c.Int("fuse-fd"),
+		FuseSocket:       c.String("fuse-socket"),
 		DirMode:          os.FileMode(*c.Generic("dir-mode").(*OctalInt)),
 		FileMode:         os.FileMode(*c.Generic("file-mode").(*OctalInt)),
 		Uid:              int64(c.Int("uid")),
@@ -556,6 +1014,8 @@ func populateFlags(c *cli.Context) (flags *flagStorage, err error) {
 
 		// GCS,
 		CustomEndpoint:                     customEndpoint,
+		UniverseDomain:                     c.String("universe-domain"),
+		PSCEndpoint:                        c.String("psc-endpoint"),
 		AnonymousAccess:                    c.Bool("anonymous-access"),
 		BillingProject:                     c.String("billing-project"),
 		KeyFile:                            c.String("key-file"),
@@ -563,30 +1023,70 @@ func populateFlags(c *cli.Context) (flags *flagStorage, err error) {
 		ReuseTokenFromUrl:                  c.BoolT("reuse-token-from-url"),
 		EgressBandwidthLimitBytesPerSecond: c.Float64("limit-bytes-per-sec"),
 		OpRateLimitHz:                      c.Float64("limit-ops-per-sec"),
+		MaxMetadataOpsPerSec:               c.Float64("max-metadata-ops-per-sec"),
+		MetadataOpsBurst:                   c.Int("metadata-ops-burst"),
 		SequentialReadSizeMb:               int32(c.Int("sequential-read-size-mb")),
+		MmapReadRetries:                    c.Int("mmap-read-retries"),
 
 		// Tuning,
 		MaxRetrySleep:             c.Duration("max-retry-sleep"),
 		StatCacheCapacity:         c.Int("stat-cache-capacity"),
 		StatCacheTTL:              c.Duration("stat-cache-ttl"),
 		TypeCacheTTL:              c.Duration("type-cache-ttl"),
+		FileEntryTTL:              c.Duration("file-entry-ttl"),
+		DirEntryTTL:               c.Duration("dir-entry-ttl"),
+		AttrCacheTTL:              c.Duration("attr-cache-ttl"),
 		KernelListCacheTtlSeconds: c.Int64(config.KernelListCacheTtlFlagName),
 		HttpClientTimeout:         c.Duration("http-client-timeout"),
+		KeepaliveInterval:         c.Duration("keepalive-interval"),
 		MaxRetryDuration:          c.Duration("max-retry-duration"),
 		RetryMultiplier:           c.Float64("retry-multiplier"),
 		// This flag is deprecated and we have plans to remove the implementation related to this flag in next release.
 		LocalFileCache:             false,
 		TempDir:                    c.String("temp-dir"),
 		ClientProtocol:             clientProtocol,
-		MaxConnsPerHost:            c.Int("max-conns-per-host"),
-		MaxIdleConnsPerHost:        c.Int("max-idle-conns-per-host"),
+		MaxConnsPerHost:            c.Int(config.MaxConnsPerHostFlagName),
+		MaxIdleConnsPerHost:        c.Int(config.MaxIdleConnsPerHostFlagName),
 		EnableNonexistentTypeCache: c.Bool("enable-nonexistent-type-cache"),
+		MountRetryAttempts:         c.Int("mount-retry-attempts"),
+		MountRetryBackoff:          c.Duration("mount-retry-backoff"),
+		LazyInit:                   c.Bool("lazy-init"),
+		KernelPageCache:            c.String("kernel-page-cache"),
+		DirTimes:                   c.String("dir-times"),
+		DirSizeXattrMaxObjects:     c.Int("dir-size-xattr-max-objects"),
+		DirSizeXattrParallelism:    c.Int("dir-size-xattr-parallelism"),
+		MetadataQueryMaxObjects:    c.Int("metadata-query-max-objects"),
+		MetadataQueryTimeout:       c.Duration("metadata-query-timeout"),
+		CompatDirMarkers:           c.Bool("compat-dir-markers"),
+		CompatDirMarkerTypes:       splitList(c.String("compat-dir-marker-content-types")),
+		EnableLockFiles:            c.Bool("enable-lock-files"),
+		LockFileTTL:                c.Duration("lock-file-ttl"),
+		MaxParallelUploads:         c.Int("max-parallel-uploads"),
+		DeleteParallelism:          c.Int("delete-parallelism"),
+		StrictUnlink:               c.Bool("strict-unlink"),
+		AsyncUnlink:                c.Bool("async-unlink"),
+		MutationDryRun:             c.Bool("mutation-dry-run"),
+		RecoverStagedWrites:        c.Bool("recover-staged-writes"),
+		FlushTimeout:               c.Duration("flush-timeout"),
+		FlushRetryInterval:         c.Duration("flush-retry-interval"),
+		MinFreeStagingMB:           c.Int("min-free-staging-mb"),
+		AssumeReadOnly:             c.Bool("assume-read-only"),
+		PerObjectWriteDelayMax:     c.Duration("per-object-write-delay-max"),
+		CompositeUploadThreshold:   c.Int("composite-upload-threshold"),
+		EnableZeroExtentHints:      c.Bool("enable-zero-extent-hints"),
+		PreserveAtime:              c.Bool("preserve-atime"),
+		TimesUpdateDelay:           c.Duration("times-update-delay"),
+		FuseParallelism:            c.Int("fuse-parallelism"),
+		CgroupCPUQuota:             c.Bool("cgroup-cpu-quota"),
 
 		// Monitoring & Logging
 		StackdriverExportInterval:  c.Duration("stackdriver-export-interval"),
 		OtelCollectorAddress:       c.String("experimental-opentelemetry-collector-address"),
+		SessionSummaryFile:         c.String("session-summary-file"),
+		MetricsDetailedErrors:      c.Bool(config.MetricsDetailedErrorsFlagName),
 		LogFile:                    c.String("log-file"),
 		LogFormat:                  c.String("log-format"),
+		LifecycleEvents:            c.String("lifecycle-events"),
 		ExperimentalEnableJsonRead: c.Bool("experimental-enable-json-read"),
 
 		// Debugging,
@@ -602,10 +1102,29 @@ func populateFlags(c *cli.Context) (flags *flagStorage, err error) {
 		ExperimentalMetadataPrefetchOnMount: c.String(ExperimentalMetadataPrefetchOnMountFlag),
 	}
 
+	flags.TelemetryResourceAttributes, err = monitor.ParseResourceAttributes(c.String("telemetry-resource-attributes"))
+	if err != nil {
+		err = fmt.Errorf("telemetry-resource-attributes: %w", err)
+		return
+	}
+
+	onlyDir, err := gcsx.NormalizeOnlyDir(flags.OnlyDir)
+	if err != nil {
+		err = fmt.Errorf("only-dir: %w", err)
+		return
+	}
+	if onlyDir != flags.OnlyDir {
+		logger.Infof("Value of [only-dir] normalized from [%s] to [%s]\n", flags.OnlyDir, onlyDir)
+		flags.OnlyDir = onlyDir
+	}
+
 	// Handle the repeated "-o" flag.
 	for _, o := range c.StringSlice("o") {
 		mountpkg.ParseOptions(flags.MountOptions, o)
 	}
+	if _, ok := flags.MountOptions["nonempty"]; ok {
+		flags.NonEmpty = true
+	}
 
 	err = validateFlags(flags)
 
@@ -630,6 +1149,10 @@ func validateFlags(flags *flagStorage) (err error) {
 		return fmt.Errorf("SequentialReadSizeMb should be less than %d", maxSequentialReadSizeMb)
 	}
 
+	if _, err = storageutil.ResolveEndpoints(flags.UniverseDomain, flags.PSCEndpoint, storageutil.UseClientCertificate()); err != nil {
+		return fmt.Errorf("universe-domain: %w", err)
+	}
+
 	if !flags.ClientProtocol.IsValid() {
 		return fmt.Errorf("client protocol: %s is not valid", flags.ClientProtocol)
 	}
@@ -642,6 +1165,135 @@ func validateFlags(flags *flagStorage) (err error) {
 		return fmt.Errorf("kernelListCacheTtlSeconds: %w", err)
 	}
 
+	if flags.FuseFd < 0 {
+		return fmt.Errorf("fuse-fd can't be negative: %d", flags.FuseFd)
+	}
+
+	if flags.FuseFd > 0 && flags.FuseSocket != "" {
+		return fmt.Errorf("fuse-fd and fuse-socket can't both be set")
+	}
+
+	// The daemon doesn't inherit the descriptor.
+	if flags.FuseFd > 0 && !flags.Foreground {
+		return fmt.Errorf("fuse-fd requires foreground")
+	}
+
+	if flags.MountRetryAttempts < 0 {
+		return fmt.Errorf("mount-retry-attempts can't be negative: %d", flags.MountRetryAttempts)
+	}
+
+	if flags.MountRetryBackoff < 0 {
+		return fmt.Errorf("mount-retry-backoff can't be negative: %v", flags.MountRetryBackoff)
+	}
+
+	if flags.MaxParallelUploads < 0 {
+		return fmt.Errorf("max-parallel-uploads can't be negative: %d", flags.MaxParallelUploads)
+	}
+
+	if flags.MmapReadRetries < 0 {
+		return fmt.Errorf("mmap-read-retries can't be negative: %d", flags.MmapReadRetries)
+	}
+
+	if flags.KeepaliveInterval < 0 {
+		return fmt.Errorf("keepalive-interval can't be negative: %v", flags.KeepaliveInterval)
+	}
+
+	if flags.DeleteParallelism < 0 {
+		return fmt.Errorf("delete-parallelism can't be negative: %d", flags.DeleteParallelism)
+	}
+
+	if flags.AsyncUnlink && flags.StrictUnlink {
+		return fmt.Errorf("async-unlink can't be combined with strict-unlink")
+	}
+
+	if flags.FlushTimeout < 0 {
+		return fmt.Errorf("flush-timeout can't be negative: %v", flags.FlushTimeout)
+	}
+
+	if flags.TimesUpdateDelay < 0 {
+		return fmt.Errorf("times-update-delay can't be negative: %v", flags.TimesUpdateDelay)
+	}
+
+	if flags.FlushRetryInterval < 0 {
+		return fmt.Errorf("flush-retry-interval can't be negative: %v", flags.FlushRetryInterval)
+	}
+
+	if flags.FlushRetryInterval > 0 && flags.FlushTimeout == 0 {
+		return fmt.Errorf("flush-retry-interval requires flush-timeout")
+	}
+
+	if flags.MaxMetadataOpsPerSec < 0 {
+		return fmt.Errorf("max-metadata-ops-per-sec can't be negative: %v", flags.MaxMetadataOpsPerSec)
+	}
+
+	if flags.MetadataOpsBurst < 0 {
+		return fmt.Errorf("metadata-ops-burst can't be negative: %d", flags.MetadataOpsBurst)
+	}
+
+	if flags.MinFreeStagingMB < 0 {
+		return fmt.Errorf("min-free-staging-mb can't be negative: %d", flags.MinFreeStagingMB)
+	}
+
+	if flags.DirSizeXattrMaxObjects < 0 {
+		return fmt.Errorf("dir-size-xattr-max-objects can't be negative: %d", flags.DirSizeXattrMaxObjects)
+	}
+
+	if flags.DirSizeXattrParallelism < 0 {
+		return fmt.Errorf("dir-size-xattr-parallelism can't be negative: %d", flags.DirSizeXattrParallelism)
+	}
+
+	if flags.MetadataQueryMaxObjects < 0 {
+		return fmt.Errorf("metadata-query-max-objects can't be negative: %d", flags.MetadataQueryMaxObjects)
+	}
+
+	if flags.MetadataQueryTimeout < 0 {
+		return fmt.Errorf("metadata-query-timeout can't be negative: %v", flags.MetadataQueryTimeout)
+	}
+
+	if flags.CompatDirMarkers && len(flags.CompatDirMarkerTypes) == 0 {
+		return fmt.Errorf("compat-dir-markers requires compat-dir-marker-content-types")
+	}
+
+	if flags.PerObjectWriteDelayMax < 0 {
+		return fmt.Errorf("per-object-write-delay-max can't be negative: %v", flags.PerObjectWriteDelayMax)
+	}
+
+	if flags.CompositeUploadThreshold < 0 {
+		return fmt.Errorf("composite-upload-threshold can't be negative: %d", flags.CompositeUploadThreshold)
+	}
+
+	if flags.FuseParallelism < 0 {
+		return fmt.Errorf("fuse-parallelism can't be negative: %d", flags.FuseParallelism)
+	}
+
+	if flags.EnableLockFiles && flags.LockFileTTL <= 0 {
+		return fmt.Errorf("lock-file-ttl must be positive with enable-lock-files: %v", flags.LockFileTTL)
+	}
+
+	switch flags.KernelPageCache {
+	case config.KernelPageCacheAuto, config.KernelPageCacheAlways, config.KernelPageCacheNever:
+	default:
+		return fmt.Errorf("kernel-page-cache: %q is not valid; must be %q, %q or %q", flags.KernelPageCache,
+			config.KernelPageCacheAuto, config.KernelPageCacheAlways, config.KernelPageCacheNever)
+	}
+
+	switch flags.DirTimes {
+	case config.DirTimesMount, config.DirTimesPlaceholder, config.DirTimesNewestChild:
+	default:
+		return fmt.Errorf("dir-times: %q is not valid; must be %q, %q or %q", flags.DirTimes,
+			config.DirTimesMount, config.DirTimesPlaceholder, config.DirTimesNewestChild)
+	}
+
+	return
+}
+
+// Split a comma-separated list, trimming the items and dropping empty ones.
+func splitList(s string) (items []string) {
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
 	return
 }
 
@@ -23,6 +23,7 @@ import (
 	"time"
 
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/config"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/fs/inode"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/mount"
 	mountpkg "github.com/googlecloudplatform/gcsfuse/v2/internal/mount"
 	"github.com/stretchr/testify/assert"
@@ -68,6 +69,11 @@ func (t *FlagsTest) Defaults() {
 	// File system
 	assert.NotEqual(t.T(), nil, f.MountOptions)
 	assert.Equal(t.T(), 0, len(f.MountOptions), "Options: %v", f.MountOptions)
+	assert.False(t.T(), f.NonEmpty)
+	assert.False(t.T(), f.AllowRemount)
+	assert.Equal(t.T(), 0, f.FuseFd)
+	assert.Equal(t.T(), "", f.FuseSocket)
+	assert.Equal(t.T(), "", f.LifecycleEvents)
 
 	assert.Equal(t.T(), os.FileMode(0755), f.DirMode)
 	assert.Equal(t.T(), os.FileMode(0644), f.FileMode)
@@ -81,19 +87,60 @@ func (t *FlagsTest) Defaults() {
 	assert.Equal(t.T(), "", f.KeyFile)
 	assert.Equal(t.T(), -1, f.EgressBandwidthLimitBytesPerSecond)
 	assert.Equal(t.T(), -1, f.OpRateLimitHz)
+	assert.Equal(t.T(), 0, f.MaxMetadataOpsPerSec)
+	assert.Equal(t.T(), 0, f.MetadataOpsBurst)
 	assert.True(t.T(), f.ReuseTokenFromUrl)
 	assert.Equal(t.T(), nil, f.CustomEndpoint)
+	assert.Equal(t.T(), "", f.UniverseDomain)
+	assert.Equal(t.T(), "", f.PSCEndpoint)
 	assert.False(t.T(), f.AnonymousAccess)
 
 	// Tuning
 	assert.Equal(t.T(), mount.DefaultStatCacheCapacity, f.StatCacheCapacity)
 	assert.Equal(t.T(), mount.DefaultStatOrTypeCacheTTL, f.StatCacheTTL)
 	assert.Equal(t.T(), mount.DefaultStatOrTypeCacheTTL, f.TypeCacheTTL)
+	assert.Equal(t.T(), -1*time.Second, f.FileEntryTTL)
+	assert.Equal(t.T(), -1*time.Second, f.DirEntryTTL)
+	assert.Equal(t.T(), -1*time.Second, f.AttrCacheTTL)
 	assert.Equal(t.T(), 0, f.HttpClientTimeout)
+	assert.Equal(t.T(), time.Duration(0), f.KeepaliveInterval)
 	assert.Equal(t.T(), "", f.TempDir)
+	assert.Equal(t.T(), "", f.Profile)
 	assert.Equal(t.T(), 2, f.RetryMultiplier)
 	assert.False(t.T(), f.EnableNonexistentTypeCache)
 	assert.Equal(t.T(), 0, f.MaxConnsPerHost)
+	assert.Equal(t.T(), mount.DefaultMountRetryAttempts, f.MountRetryAttempts)
+	assert.Equal(t.T(), mount.DefaultMountRetryBackoff, f.MountRetryBackoff)
+	assert.False(t.T(), f.LazyInit)
+	assert.Equal(t.T(), config.KernelPageCacheAuto, f.KernelPageCache)
+	assert.Equal(t.T(), config.DirTimesMount, f.DirTimes)
+	assert.Equal(t.T(), mount.DefaultDirSizeXattrMaxObjects, f.DirSizeXattrMaxObjects)
+	assert.Equal(t.T(), mount.DefaultDirSizeXattrParallelism, f.DirSizeXattrParallelism)
+	assert.Equal(t.T(), mount.DefaultMetadataQueryMaxObjects, f.MetadataQueryMaxObjects)
+	assert.Equal(t.T(), mount.DefaultMetadataQueryTimeout, f.MetadataQueryTimeout)
+	assert.False(t.T(), f.CompatDirMarkers)
+	assert.False(t.T(), f.AssumeReadOnly)
+	assert.False(t.T(), f.MetricsDetailedErrors)
+	assert.Equal(t.T(), []string{inode.DefaultCompatDirMarkerType}, f.CompatDirMarkerTypes)
+	assert.False(t.T(), f.EnableLockFiles)
+	assert.Equal(t.T(), mount.DefaultLockFileTTL, f.LockFileTTL)
+	assert.Equal(t.T(), 0, f.MaxParallelUploads)
+	assert.Equal(t.T(), 16, f.DeleteParallelism)
+	assert.Equal(t.T(), 3, f.MmapReadRetries)
+	assert.False(t.T(), f.MutationDryRun)
+	assert.False(t.T(), f.StrictUnlink)
+	assert.False(t.T(), f.AsyncUnlink)
+	assert.False(t.T(), f.RecoverStagedWrites)
+	assert.Equal(t.T(), time.Duration(0), f.FlushTimeout)
+	assert.Equal(t.T(), time.Duration(0), f.FlushRetryInterval)
+	assert.Equal(t.T(), 0, f.MinFreeStagingMB)
+	assert.Equal(t.T(), time.Duration(0), f.PerObjectWriteDelayMax)
+	assert.Equal(t.T(), 0, f.CompositeUploadThreshold)
+	assert.False(t.T(), f.EnableZeroExtentHints)
+	assert.False(t.T(), f.PreserveAtime)
+	assert.Equal(t.T(), time.Duration(0), f.TimesUpdateDelay)
+	assert.Equal(t.T(), 0, f.FuseParallelism)
+	assert.False(t.T(), f.CgroupCPUQuota)
 
 	// Logging
 	assert.True(t.T(), f.DebugFuseErrors)
@@ -121,6 +168,20 @@ func (t *FlagsTest) Bools() {
 		"experimental-enable-json-read",
 		"ignore-interrupts",
 		"anonymous-access",
+		"enable-lock-files",
+		"recover-staged-writes",
+		"mutation-dry-run",
+		"strict-unlink",
+		"async-unlink",
+		"enable-zero-extent-hints",
+		"preserve-atime",
+		"nonempty",
+		"allow-remount",
+		"cgroup-cpu-quota",
+		"lazy-init",
+		"compat-dir-markers",
+		"assume-read-only",
+		"metrics-detailed-errors",
 	}
 
 	var args []string
@@ -144,6 +205,20 @@ func (t *FlagsTest) Bools() {
 	assert.True(t.T(), f.ExperimentalEnableJsonRead)
 	assert.True(t.T(), f.IgnoreInterrupts)
 	assert.True(t.T(), f.AnonymousAccess)
+	assert.True(t.T(), f.EnableLockFiles)
+	assert.True(t.T(), f.RecoverStagedWrites)
+	assert.True(t.T(), f.MutationDryRun)
+	assert.True(t.T(), f.StrictUnlink)
+	assert.True(t.T(), f.AsyncUnlink)
+	assert.True(t.T(), f.EnableZeroExtentHints)
+	assert.True(t.T(), f.PreserveAtime)
+	assert.True(t.T(), f.NonEmpty)
+	assert.True(t.T(), f.AllowRemount)
+	assert.True(t.T(), f.CgroupCPUQuota)
+	assert.True(t.T(), f.LazyInit)
+	assert.True(t.T(), f.CompatDirMarkers)
+	assert.True(t.T(), f.AssumeReadOnly)
+	assert.True(t.T(), f.MetricsDetailedErrors)
 
 	// --foo=false form
 	args = nil
@@ -160,6 +235,20 @@ func (t *FlagsTest) Bools() {
 	assert.False(t.T(), f.DebugHTTP)
 	assert.False(t.T(), f.DebugInvariants)
 	assert.False(t.T(), f.EnableNonexistentTypeCache)
+	assert.False(t.T(), f.EnableLockFiles)
+	assert.False(t.T(), f.RecoverStagedWrites)
+	assert.False(t.T(), f.MutationDryRun)
+	assert.False(t.T(), f.StrictUnlink)
+	assert.False(t.T(), f.AsyncUnlink)
+	assert.False(t.T(), f.EnableZeroExtentHints)
+	assert.False(t.T(), f.PreserveAtime)
+	assert.False(t.T(), f.NonEmpty)
+	assert.False(t.T(), f.AllowRemount)
+	assert.False(t.T(), f.CgroupCPUQuota)
+	assert.False(t.T(), f.LazyInit)
+	assert.False(t.T(), f.CompatDirMarkers)
+	assert.False(t.T(), f.AssumeReadOnly)
+	assert.False(t.T(), f.MetricsDetailedErrors)
 
 	// --foo=true form
 	args = nil
@@ -184,10 +273,23 @@ func (t *FlagsTest) DecimalNumbers() {
 		"--gid=19",
 		"--limit-bytes-per-sec=123.4",
 		"--limit-ops-per-sec=56.78",
+		"--max-metadata-ops-per-sec=12.5",
+		"--metadata-ops-burst=40",
 		"--stat-cache-capacity=8192",
 		"--max-idle-conns-per-host=100",
 		"--max-conns-per-host=100",
 		"--kernel-list-cache-ttl-secs=234",
+		"--mount-retry-attempts=5",
+		"--max-parallel-uploads=16",
+		"--delete-parallelism=64",
+		"--mmap-read-retries=5",
+		"--composite-upload-threshold=150",
+		"--min-free-staging-mb=512",
+		"--dir-size-xattr-max-objects=2000",
+		"--dir-size-xattr-parallelism=4",
+		"--metadata-query-max-objects=3000",
+		"--fuse-parallelism=96",
+		"--fuse-fd=3",
 	}
 
 	f := parseArgs(t, args)
@@ -195,10 +297,23 @@ func (t *FlagsTest) DecimalNumbers() {
 	assert.Equal(t.T(), 19, f.Gid)
 	assert.Equal(t.T(), 123.4, f.EgressBandwidthLimitBytesPerSecond)
 	assert.Equal(t.T(), 56.78, f.OpRateLimitHz)
+	assert.Equal(t.T(), 12.5, f.MaxMetadataOpsPerSec)
+	assert.Equal(t.T(), 40, f.MetadataOpsBurst)
 	assert.Equal(t.T(), 8192, f.StatCacheCapacity)
 	assert.Equal(t.T(), 100, f.MaxIdleConnsPerHost)
 	assert.Equal(t.T(), 100, f.MaxConnsPerHost)
 	assert.Equal(t.T(), 234, f.KernelListCacheTtlSeconds)
+	assert.Equal(t.T(), 5, f.MountRetryAttempts)
+	assert.Equal(t.T(), 16, f.MaxParallelUploads)
+	assert.Equal(t.T(), 64, f.DeleteParallelism)
+	assert.Equal(t.T(), 5, f.MmapReadRetries)
+	assert.Equal(t.T(), 150, f.CompositeUploadThreshold)
+	assert.Equal(t.T(), 512, f.MinFreeStagingMB)
+	assert.Equal(t.T(), 2000, f.DirSizeXattrMaxObjects)
+	assert.Equal(t.T(), 4, f.DirSizeXattrParallelism)
+	assert.Equal(t.T(), 3000, f.MetadataQueryMaxObjects)
+	assert.Equal(t.T(), 96, f.FuseParallelism)
+	assert.Equal(t.T(), 3, f.FuseFd)
 }
 
 func (t *FlagsTest) OctalNumbers() {
@@ -219,6 +334,13 @@ func (t *FlagsTest) Strings() {
 		"--only-dir=baz",
 		"--client-protocol=HTTP2",
 		"--experimental-metadata-prefetch-on-mount=async",
+		"--kernel-page-cache=never",
+		"--dir-times=newest-child",
+		"--fuse-socket=/run/fuse.sock",
+		"--lifecycle-events=/dev/fd/3",
+		"--session-summary-file=/var/log/summary.json",
+		"--profile=many-small-files",
+		"--compat-dir-marker-content-types= application/x-directory,,text/directory ",
 	}
 
 	f := parseArgs(t, args)
@@ -227,23 +349,52 @@ func (t *FlagsTest) Strings() {
 	assert.Equal(t.T(), "baz", f.OnlyDir)
 	assert.Equal(t.T(), mountpkg.HTTP2, f.ClientProtocol)
 	assert.Equal(t.T(), config.ExperimentalMetadataPrefetchOnMountAsynchronous, f.ExperimentalMetadataPrefetchOnMount)
+	assert.Equal(t.T(), config.KernelPageCacheNever, f.KernelPageCache)
+	assert.Equal(t.T(), config.DirTimesNewestChild, f.DirTimes)
+	assert.Equal(t.T(), "/run/fuse.sock", f.FuseSocket)
+	assert.Equal(t.T(), "/dev/fd/3", f.LifecycleEvents)
+	assert.Equal(t.T(), "/var/log/summary.json", f.SessionSummaryFile)
+	assert.Equal(t.T(), config.ManySmallFilesProfile, f.Profile)
+	assert.Equal(t.T(), []string{"application/x-directory", "text/directory"}, f.CompatDirMarkerTypes)
 }
 
 func (t *FlagsTest) Durations() {
 	args := []string{
 		"--stat-cache-ttl", "1m17s100ms",
 		"--type-cache-ttl", "50s900ms",
+		"--file-entry-ttl", "5s",
+		"--dir-entry-ttl", "10m",
+		"--attr-cache-ttl", "1s",
 		"--http-client-timeout", "800ms",
+		"--keepalive-interval", "2m",
 		"--max-retry-duration", "-1s",
 		"--max-retry-sleep", "30s",
+		"--mount-retry-backoff", "2s",
+		"--lock-file-ttl", "90s",
+		"--flush-timeout", "5m",
+		"--flush-retry-interval", "30s",
+		"--per-object-write-delay-max", "2s",
+		"--metadata-query-timeout", "10s",
+		"--times-update-delay", "500ms",
 	}
 
 	f := parseArgs(t, args)
 	assert.Equal(t.T(), time.Minute+17*time.Second+100*time.Millisecond, f.StatCacheTTL)
 	assert.Equal(t.T(), 50*time.Second+900*time.Millisecond, f.TypeCacheTTL)
+	assert.Equal(t.T(), 5*time.Second, f.FileEntryTTL)
+	assert.Equal(t.T(), 10*time.Minute, f.DirEntryTTL)
+	assert.Equal(t.T(), time.Second, f.AttrCacheTTL)
 	assert.Equal(t.T(), 800*time.Millisecond, f.HttpClientTimeout)
+	assert.Equal(t.T(), 2*time.Minute, f.KeepaliveInterval)
 	assert.Equal(t.T(), -1*time.Second, f.MaxRetryDuration)
 	assert.Equal(t.T(), 30*time.Second, f.MaxRetrySleep)
+	assert.Equal(t.T(), 2*time.Second, f.MountRetryBackoff)
+	assert.Equal(t.T(), 90*time.Second, f.LockFileTTL)
+	assert.Equal(t.T(), 5*time.Minute, f.FlushTimeout)
+	assert.Equal(t.T(), 30*time.Second, f.FlushRetryInterval)
+	assert.Equal(t.T(), 2*time.Second, f.PerObjectWriteDelayMax)
+	assert.Equal(t.T(), 10*time.Second, f.MetadataQueryTimeout)
+	assert.Equal(t.T(), 500*time.Millisecond, f.TimesUpdateDelay)
 }
 
 func (t *FlagsTest) Maps() {
@@ -269,6 +420,13 @@ func (t *FlagsTest) Maps() {
 	assert.Equal(t.T(), "jacobsa", f.MountOptions["user"])
 }
 
+func (t *FlagsTest) TestNonemptyMountOption() {
+	f := parseArgs(t, []string{"-o", "rw,nonempty"})
+
+	assert.True(t.T(), f.NonEmpty)
+	assert.Contains(t.T(), f.MountOptions, "nonempty")
+}
+
 func (t *FlagsTest) TestResolvePathForTheFlagInContext() {
 	app := newApp()
 	currentWorkingDir, err := os.Getwd()
@@ -310,10 +468,17 @@ func (t *FlagsTest) TestResolvePathForTheFlagsInContext() {
 			appCtx.String("key-file"))
 		assert.Equal(t.T(), filepath.Join(currentWorkingDir, "config.yaml"),
 			appCtx.String("config-file"))
+		assert.Equal(t.T(), filepath.Join(currentWorkingDir, "fuse.sock"),
+			appCtx.String("fuse-socket"))
+		assert.Equal(t.T(), filepath.Join(currentWorkingDir, "events.jsonl"),
+			appCtx.String("lifecycle-events"))
+		assert.Equal(t.T(), filepath.Join(currentWorkingDir, "summary.json"),
+			appCtx.String("session-summary-file"))
 	}
 	// Simulate argv.
 	fullArgs := []string{"some_app", "--log-file=test.txt",
-		"--key-file=test.txt", "--config-file=config.yaml"}
+		"--key-file=test.txt", "--config-file=config.yaml", "--fuse-socket=fuse.sock",
+		"--lifecycle-events=events.jsonl", "--session-summary-file=summary.json"}
 
 	err = app.Run(fullArgs)
 
@@ -325,6 +490,8 @@ func (t *FlagsTest) TestValidateFlagsForValidSequentialReadSizeAndHTTP1ClientPro
 		SequentialReadSizeMb:                10,
 		ClientProtocol:                      mountpkg.ClientProtocol("http1"),
 		ExperimentalMetadataPrefetchOnMount: config.DefaultExperimentalMetadataPrefetchOnMount,
+		KernelPageCache:                     config.DefaultKernelPageCache,
+		DirTimes:                            config.DefaultDirTimes,
 	}
 
 	err := validateFlags(flags)
@@ -375,6 +542,8 @@ func (t *FlagsTest) TestValidateFlagsForValidSequentialReadSizeAndHTTP2ClientPro
 		SequentialReadSizeMb:                10,
 		ClientProtocol:                      mountpkg.ClientProtocol("http2"),
 		ExperimentalMetadataPrefetchOnMount: config.DefaultExperimentalMetadataPrefetchOnMount,
+		KernelPageCache:                     config.DefaultKernelPageCache,
+		DirTimes:                            config.DefaultDirTimes,
 	}
 
 	err := validateFlags(flags)
@@ -390,6 +559,8 @@ func (t *FlagsTest) TestValidateFlagsForSupportedExperimentalMetadataPrefetchOnM
 			// Unrelated fields, not being tested here, so set to sane values.
 			SequentialReadSizeMb: 200,
 			ClientProtocol:       mountpkg.ClientProtocol("http2"),
+			KernelPageCache:      config.DefaultKernelPageCache,
+			DirTimes:             config.DefaultDirTimes,
 			// The flag being tested.
 			ExperimentalMetadataPrefetchOnMount: input,
 		}
@@ -419,6 +590,434 @@ func (t *FlagsTest) TestValidateFlagsForUnsupportedExperimentalMetadataPrefetchO
 	}
 }
 
+func (t *FlagsTest) TestValidateFlagsForNegativeMountRetryAttempts() {
+	flags := &flagStorage{
+		SequentialReadSizeMb:                10,
+		ClientProtocol:                      mountpkg.ClientProtocol("http1"),
+		ExperimentalMetadataPrefetchOnMount: config.DefaultExperimentalMetadataPrefetchOnMount,
+		MountRetryAttempts:                  -1,
+	}
+
+	err := validateFlags(flags)
+
+	assert.ErrorContains(t.T(), err, "mount-retry-attempts")
+}
+
+func (t *FlagsTest) TestValidateFlagsForNegativeMountRetryBackoff() {
+	flags := &flagStorage{
+		SequentialReadSizeMb:                10,
+		ClientProtocol:                      mountpkg.ClientProtocol("http1"),
+		ExperimentalMetadataPrefetchOnMount: config.DefaultExperimentalMetadataPrefetchOnMount,
+		MountRetryBackoff:                   -time.Second,
+	}
+
+	err := validateFlags(flags)
+
+	assert.ErrorContains(t.T(), err, "mount-retry-backoff")
+}
+
+func (t *FlagsTest) TestValidateFlagsForSupportedKernelPageCache() {
+	for _, input := range []string{"auto", "always", "never"} {
+		flags := &flagStorage{
+			SequentialReadSizeMb:                10,
+			ClientProtocol:                      mountpkg.ClientProtocol("http1"),
+			ExperimentalMetadataPrefetchOnMount: config.DefaultExperimentalMetadataPrefetchOnMount,
+			KernelPageCache:                     input,
+			DirTimes:                            config.DefaultDirTimes,
+		}
+
+		err := validateFlags(flags)
+
+		assert.Equal(t.T(), nil, err)
+	}
+}
+
+func (t *FlagsTest) TestValidateFlagsForUnsupportedKernelPageCache() {
+	flags := &flagStorage{
+		SequentialReadSizeMb:                10,
+		ClientProtocol:                      mountpkg.ClientProtocol("http1"),
+		ExperimentalMetadataPrefetchOnMount: config.DefaultExperimentalMetadataPrefetchOnMount,
+		KernelPageCache:                     "sometimes",
+	}
+
+	err := validateFlags(flags)
+
+	assert.ErrorContains(t.T(), err, "kernel-page-cache")
+}
+
+func (t *FlagsTest) TestValidateFlagsForSupportedDirTimes() {
+	for _, input := range []string{"mount", "placeholder", "newest-child"} {
+		flags := &flagStorage{
+			SequentialReadSizeMb:                10,
+			ClientProtocol:                      mountpkg.ClientProtocol("http1"),
+			ExperimentalMetadataPrefetchOnMount: config.DefaultExperimentalMetadataPrefetchOnMount,
+			KernelPageCache:                     config.DefaultKernelPageCache,
+			DirTimes:                            input,
+		}
+
+		err := validateFlags(flags)
+
+		assert.Equal(t.T(), nil, err)
+	}
+}
+
+func (t *FlagsTest) TestValidateFlagsForUnsupportedDirTimes() {
+	flags := &flagStorage{
+		SequentialReadSizeMb:                10,
+		ClientProtocol:                      mountpkg.ClientProtocol("http1"),
+		ExperimentalMetadataPrefetchOnMount: config.DefaultExperimentalMetadataPrefetchOnMount,
+		KernelPageCache:                     config.DefaultKernelPageCache,
+		DirTimes:                            "oldest-child",
+	}
+
+	err := validateFlags(flags)
+
+	assert.ErrorContains(t.T(), err, "dir-times")
+}
+
+func (t *FlagsTest) TestValidateFlagsForNegativeMaxParallelUploads() {
+	flags := &flagStorage{
+		SequentialReadSizeMb:                10,
+		ClientProtocol:                      mountpkg.ClientProtocol("http1"),
+		ExperimentalMetadataPrefetchOnMount: config.DefaultExperimentalMetadataPrefetchOnMount,
+		KernelPageCache:                     config.DefaultKernelPageCache,
+		DirTimes:                            config.DefaultDirTimes,
+		MaxParallelUploads:                  -1,
+	}
+
+	err := validateFlags(flags)
+
+	assert.ErrorContains(t.T(), err, "max-parallel-uploads")
+}
+
+func (t *FlagsTest) TestValidateFlagsForNegativeMmapReadRetries() {
+	flags := &flagStorage{
+		SequentialReadSizeMb:                10,
+		ClientProtocol:                      mountpkg.ClientProtocol("http1"),
+		ExperimentalMetadataPrefetchOnMount: config.DefaultExperimentalMetadataPrefetchOnMount,
+		KernelPageCache:                     config.DefaultKernelPageCache,
+		DirTimes:                            config.DefaultDirTimes,
+		MmapReadRetries:                     -1,
+	}
+
+	err := validateFlags(flags)
+
+	assert.ErrorContains(t.T(), err, "mmap-read-retries")
+}
+
+func (t *FlagsTest) TestValidateFlagsForNegativeKeepaliveInterval() {
+	flags := &flagStorage{
+		SequentialReadSizeMb:                10,
+		ClientProtocol:                      mountpkg.ClientProtocol("http1"),
+		ExperimentalMetadataPrefetchOnMount: config.DefaultExperimentalMetadataPrefetchOnMount,
+		KernelPageCache:                     config.DefaultKernelPageCache,
+		DirTimes:                            config.DefaultDirTimes,
+		KeepaliveInterval:                   -time.Second,
+	}
+
+	err := validateFlags(flags)
+
+	assert.ErrorContains(t.T(), err, "keepalive-interval")
+}
+
+func (t *FlagsTest) TestValidateFlagsForPSCEndpointInCustomUniverse() {
+	flags := &flagStorage{
+		SequentialReadSizeMb:                10,
+		ClientProtocol:                      mountpkg.ClientProtocol("http1"),
+		ExperimentalMetadataPrefetchOnMount: config.DefaultExperimentalMetadataPrefetchOnMount,
+		KernelPageCache:                     config.DefaultKernelPageCache,
+		DirTimes:                            config.DefaultDirTimes,
+		UniverseDomain:                      "example.goog",
+		PSCEndpoint:                         "restricted",
+	}
+
+	err := validateFlags(flags)
+
+	assert.ErrorContains(t.T(), err, "universe-domain")
+}
+
+func (t *FlagsTest) TestValidateFlagsForNegativeDeleteParallelism() {
+	flags := &flagStorage{
+		SequentialReadSizeMb:                10,
+		ClientProtocol:                      mountpkg.ClientProtocol("http1"),
+		ExperimentalMetadataPrefetchOnMount: config.DefaultExperimentalMetadataPrefetchOnMount,
+		KernelPageCache:                     config.DefaultKernelPageCache,
+		DirTimes:                            config.DefaultDirTimes,
+		DeleteParallelism:                   -1,
+	}
+
+	err := validateFlags(flags)
+
+	assert.ErrorContains(t.T(), err, "delete-parallelism")
+}
+
+func (t *FlagsTest) TestValidateFlagsForNegativeFlushTimeout() {
+	flags := &flagStorage{
+		SequentialReadSizeMb:                10,
+		ClientProtocol:                      mountpkg.ClientProtocol("http1"),
+		ExperimentalMetadataPrefetchOnMount: config.DefaultExperimentalMetadataPrefetchOnMount,
+		KernelPageCache:                     config.DefaultKernelPageCache,
+		DirTimes:                            config.DefaultDirTimes,
+		FlushTimeout:                        -time.Second,
+	}
+
+	err := validateFlags(flags)
+
+	assert.ErrorContains(t.T(), err, "flush-timeout")
+}
+
+func (t *FlagsTest) TestValidateFlagsForNegativeTimesUpdateDelay() {
+	flags := &flagStorage{
+		SequentialReadSizeMb:                10,
+		ClientProtocol:                      mountpkg.ClientProtocol("http1"),
+		ExperimentalMetadataPrefetchOnMount: config.DefaultExperimentalMetadataPrefetchOnMount,
+		KernelPageCache:                     config.DefaultKernelPageCache,
+		DirTimes:                            config.DefaultDirTimes,
+		TimesUpdateDelay:                    -time.Second,
+	}
+
+	err := validateFlags(flags)
+
+	assert.ErrorContains(t.T(), err, "times-update-delay")
+}
+
+func (t *FlagsTest) TestValidateFlagsForFlushRetryIntervalWithoutFlushTimeout() {
+	flags := &flagStorage{
+		SequentialReadSizeMb:                10,
+		ClientProtocol:                      mountpkg.ClientProtocol("http1"),
+		ExperimentalMetadataPrefetchOnMount: config.DefaultExperimentalMetadataPrefetchOnMount,
+		KernelPageCache:                     config.DefaultKernelPageCache,
+		DirTimes:                            config.DefaultDirTimes,
+		FlushRetryInterval:                  time.Minute,
+	}
+
+	err := validateFlags(flags)
+
+	assert.ErrorContains(t.T(), err, "flush-retry-interval requires flush-timeout")
+}
+
+func (t *FlagsTest) TestValidateFlagsForAsyncAndStrictUnlink() {
+	flags := &flagStorage{
+		SequentialReadSizeMb:                10,
+		ClientProtocol:                      mountpkg.ClientProtocol("http1"),
+		ExperimentalMetadataPrefetchOnMount: config.DefaultExperimentalMetadataPrefetchOnMount,
+		KernelPageCache:                     config.DefaultKernelPageCache,
+		DirTimes:                            config.DefaultDirTimes,
+		AsyncUnlink:                         true,
+		StrictUnlink:                        true,
+	}
+
+	err := validateFlags(flags)
+
+	assert.ErrorContains(t.T(), err, "async-unlink can't be combined with strict-unlink")
+}
+
+func (t *FlagsTest) TestValidateFlagsForNegativeMinFreeStagingMB() {
+	flags := &flagStorage{
+		SequentialReadSizeMb:                10,
+		ClientProtocol:                      mountpkg.ClientProtocol("http1"),
+		ExperimentalMetadataPrefetchOnMount: config.DefaultExperimentalMetadataPrefetchOnMount,
+		KernelPageCache:                     config.DefaultKernelPageCache,
+		DirTimes:                            config.DefaultDirTimes,
+		MinFreeStagingMB:                    -1,
+	}
+
+	err := validateFlags(flags)
+
+	assert.ErrorContains(t.T(), err, "min-free-staging-mb")
+}
+
+func (t *FlagsTest) TestValidateFlagsForNegativeMaxMetadataOpsPerSec() {
+	flags := &flagStorage{
+		SequentialReadSizeMb:                10,
+		ClientProtocol:                      mountpkg.ClientProtocol("http1"),
+		ExperimentalMetadataPrefetchOnMount: config.DefaultExperimentalMetadataPrefetchOnMount,
+		KernelPageCache:                     config.DefaultKernelPageCache,
+		DirTimes:                            config.DefaultDirTimes,
+		MaxMetadataOpsPerSec:                -1,
+	}
+
+	err := validateFlags(flags)
+
+	assert.ErrorContains(t.T(), err, "max-metadata-ops-per-sec")
+}
+
+func (t *FlagsTest) TestValidateFlagsForNegativeMetadataOpsBurst() {
+	flags := &flagStorage{
+		SequentialReadSizeMb:                10,
+		ClientProtocol:                      mountpkg.ClientProtocol("http1"),
+		ExperimentalMetadataPrefetchOnMount: config.DefaultExperimentalMetadataPrefetchOnMount,
+		KernelPageCache:                     config.DefaultKernelPageCache,
+		DirTimes:                            config.DefaultDirTimes,
+		MetadataOpsBurst:                    -1,
+	}
+
+	err := validateFlags(flags)
+
+	assert.ErrorContains(t.T(), err, "metadata-ops-burst")
+}
+
+func (t *FlagsTest) TestValidateFlagsForNegativeDirSizeXattrMaxObjects() {
+	flags := &flagStorage{
+		SequentialReadSizeMb:                10,
+		ClientProtocol:                      mountpkg.ClientProtocol("http1"),
+		ExperimentalMetadataPrefetchOnMount: config.DefaultExperimentalMetadataPrefetchOnMount,
+		KernelPageCache:                     config.DefaultKernelPageCache,
+		DirTimes:                            config.DefaultDirTimes,
+		DirSizeXattrMaxObjects:              -1,
+	}
+
+	err := validateFlags(flags)
+
+	assert.ErrorContains(t.T(), err, "dir-size-xattr-max-objects")
+}
+
+func (t *FlagsTest) TestValidateFlagsForNegativeDirSizeXattrParallelism() {
+	flags := &flagStorage{
+		SequentialReadSizeMb:                10,
+		ClientProtocol:                      mountpkg.ClientProtocol("http1"),
+		ExperimentalMetadataPrefetchOnMount: config.DefaultExperimentalMetadataPrefetchOnMount,
+		KernelPageCache:                     config.DefaultKernelPageCache,
+		DirTimes:                            config.DefaultDirTimes,
+		DirSizeXattrParallelism:             -1,
+	}
+
+	err := validateFlags(flags)
+
+	assert.ErrorContains(t.T(), err, "dir-size-xattr-parallelism")
+}
+
+func (t *FlagsTest) TestValidateFlagsForNegativeMetadataQueryLimits() {
+	flags := &flagStorage{
+		SequentialReadSizeMb:                10,
+		ClientProtocol:                      mountpkg.ClientProtocol("http1"),
+		ExperimentalMetadataPrefetchOnMount: config.DefaultExperimentalMetadataPrefetchOnMount,
+		KernelPageCache:                     config.DefaultKernelPageCache,
+		DirTimes:                            config.DefaultDirTimes,
+		MetadataQueryMaxObjects:             -1,
+	}
+
+	err := validateFlags(flags)
+
+	assert.ErrorContains(t.T(), err, "metadata-query-max-objects")
+
+	flags.MetadataQueryMaxObjects = 0
+	flags.MetadataQueryTimeout = -time.Second
+
+	err = validateFlags(flags)
+
+	assert.ErrorContains(t.T(), err, "metadata-query-timeout")
+}
+
+func (t *FlagsTest) TestValidateFlagsForCompatDirMarkersWithoutContentTypes() {
+	flags := &flagStorage{
+		SequentialReadSizeMb:                10,
+		ClientProtocol:                      mountpkg.ClientProtocol("http1"),
+		ExperimentalMetadataPrefetchOnMount: config.DefaultExperimentalMetadataPrefetchOnMount,
+		KernelPageCache:                     config.DefaultKernelPageCache,
+		DirTimes:                            config.DefaultDirTimes,
+		CompatDirMarkers:                    true,
+	}
+
+	err := validateFlags(flags)
+
+	assert.ErrorContains(t.T(), err, "compat-dir-markers requires compat-dir-marker-content-types")
+}
+
+func (t *FlagsTest) TestValidateFlagsForNegativePerObjectWriteDelayMax() {
+	flags := &flagStorage{
+		SequentialReadSizeMb:                10,
+		ClientProtocol:                      mountpkg.ClientProtocol("http1"),
+		ExperimentalMetadataPrefetchOnMount: config.DefaultExperimentalMetadataPrefetchOnMount,
+		KernelPageCache:                     config.DefaultKernelPageCache,
+		DirTimes:                            config.DefaultDirTimes,
+		PerObjectWriteDelayMax:              -time.Second,
+	}
+
+	err := validateFlags(flags)
+
+	assert.ErrorContains(t.T(), err, "per-object-write-delay-max")
+}
+
+func (t *FlagsTest) TestValidateFlagsForNegativeCompositeUploadThreshold() {
+	flags := &flagStorage{
+		SequentialReadSizeMb:                10,
+		ClientProtocol:                      mountpkg.ClientProtocol("http1"),
+		ExperimentalMetadataPrefetchOnMount: config.DefaultExperimentalMetadataPrefetchOnMount,
+		KernelPageCache:                     config.DefaultKernelPageCache,
+		DirTimes:                            config.DefaultDirTimes,
+		CompositeUploadThreshold:            -1,
+	}
+
+	err := validateFlags(flags)
+
+	assert.ErrorContains(t.T(), err, "composite-upload-threshold")
+}
+
+func (t *FlagsTest) TestValidateFlagsForNegativeFuseParallelism() {
+	flags := &flagStorage{
+		SequentialReadSizeMb:                10,
+		ClientProtocol:                      mountpkg.ClientProtocol("http1"),
+		ExperimentalMetadataPrefetchOnMount: config.DefaultExperimentalMetadataPrefetchOnMount,
+		KernelPageCache:                     config.DefaultKernelPageCache,
+		DirTimes:                            config.DefaultDirTimes,
+		FuseParallelism:                     -1,
+	}
+
+	err := validateFlags(flags)
+
+	assert.ErrorContains(t.T(), err, "fuse-parallelism")
+}
+
+func (t *FlagsTest) TestValidateFlagsForFuseFd() {
+	for _, tc := range []struct {
+		fuseFd     int
+		fuseSocket string
+		foreground bool
+		err        string
+	}{
+		{fuseFd: 3, foreground: true},
+		{fuseSocket: "/run/fuse.sock"},
+		{fuseFd: -1, foreground: true, err: "fuse-fd can't be negative"},
+		{fuseFd: 3, fuseSocket: "/run/fuse.sock", foreground: true, err: "can't both be set"},
+		{fuseFd: 3, err: "fuse-fd requires foreground"},
+	} {
+		flags := &flagStorage{
+			SequentialReadSizeMb:                10,
+			ClientProtocol:                      mountpkg.ClientProtocol("http1"),
+			ExperimentalMetadataPrefetchOnMount: config.DefaultExperimentalMetadataPrefetchOnMount,
+			KernelPageCache:                     config.DefaultKernelPageCache,
+			DirTimes:                            config.DefaultDirTimes,
+			Foreground:                          tc.foreground,
+			FuseFd:                              tc.fuseFd,
+			FuseSocket:                          tc.fuseSocket,
+		}
+
+		err := validateFlags(flags)
+
+		if tc.err == "" {
+			assert.NoError(t.T(), err, "%+v", tc)
+		} else {
+			assert.ErrorContains(t.T(), err, tc.err, "%+v", tc)
+		}
+	}
+}
+
+func (t *FlagsTest) TestValidateFlagsForLockFilesWithoutTTL() {
+	flags := &flagStorage{
+		SequentialReadSizeMb:                10,
+		ClientProtocol:                      mountpkg.ClientProtocol("http1"),
+		ExperimentalMetadataPrefetchOnMount: config.DefaultExperimentalMetadataPrefetchOnMount,
+		KernelPageCache:                     config.DefaultKernelPageCache,
+		DirTimes:                            config.DefaultDirTimes,
+		EnableLockFiles:                     true,
+	}
+
+	err := validateFlags(flags)
+
+	assert.ErrorContains(t.T(), err, "lock-file-ttl")
+}
+
 func (t *FlagsTest) Test_resolveConfigFilePaths() {
 	mountConfig := &config.MountConfig{}
 	mountConfig.LogConfig = config.LogConfig{
@@ -435,6 +1034,25 @@ func (t *FlagsTest) Test_resolveConfigFilePaths() {
 	assert.EqualValues(t.T(), filepath.Join(homeDir, "cache-dir"), mountConfig.CacheDir)
 }
 
+func (t *FlagsTest) Test_resolveConfigFilePaths_CacheDirs() {
+	mountConfig := &config.MountConfig{}
+	mountConfig.CacheDir = "~/nvme0"
+	mountConfig.CacheDirs = []config.CacheDirSpec{
+		{Path: "~/nvme0", Weight: 2},
+		{Path: "~/nvme1", Weight: 1},
+	}
+
+	err := resolveConfigFilePaths(mountConfig)
+
+	assert.Equal(t.T(), nil, err)
+	homeDir, err := os.UserHomeDir()
+	assert.Equal(t.T(), nil, err)
+	assert.EqualValues(t.T(), filepath.Join(homeDir, "nvme0"), mountConfig.CacheDir)
+	assert.EqualValues(t.T(), filepath.Join(homeDir, "nvme0"), mountConfig.CacheDirs[0].Path)
+	assert.EqualValues(t.T(), filepath.Join(homeDir, "nvme1"), mountConfig.CacheDirs[1].Path)
+	assert.Equal(t.T(), int64(1), mountConfig.CacheDirs[1].Weight)
+}
+
 func (t *FlagsTest) Test_resolveConfigFilePaths_WithoutSettingPaths() {
 	mountConfig := &config.MountConfig{}
 
@@ -464,3 +1082,82 @@ func (t *FlagsTest) Test_KernelListCacheTtlSecs_MaxValid() {
 
 	assert.Equal(t.T(), int64(9223372036), f.KernelListCacheTtlSeconds)
 }
+
+func (t *FlagsTest) TestNewFlagContext() {
+	c, err := newFlagContext(map[string]string{
+		"implicit-dirs":           "true",
+		"uid":                     "1000",
+		"file-mode":               "600",
+		"o":                       "ro",
+		"sequential-read-size-mb": "10",
+	})
+	assert.NoError(t.T(), err)
+
+	f, err := populateFlags(c)
+	assert.NoError(t.T(), err)
+	assert.True(t.T(), f.ImplicitDirs)
+	assert.Equal(t.T(), int64(1000), f.Uid)
+	assert.Equal(t.T(), os.FileMode(0600), f.FileMode)
+	assert.Contains(t.T(), f.MountOptions, "ro")
+	assert.Equal(t.T(), int32(10), f.SequentialReadSizeMb)
+	assert.True(t.T(), c.IsSet("implicit-dirs"))
+	assert.False(t.T(), c.IsSet("anonymous-access"))
+
+	// The others have their defaults.
+	assert.Equal(t.T(), int64(-1), f.Gid)
+	assert.Equal(t.T(), os.FileMode(0755), f.DirMode)
+}
+
+func (t *FlagsTest) TestNewFlagContext_UnknownFlag() {
+	_, err := newFlagContext(map[string]string{"no-such-flag": "true"})
+
+	assert.ErrorContains(t.T(), err, "no-such-flag")
+}
+
+func (t *FlagsTest) TestNewFlagContext_CommandLineOnlyFlag() {
+	for _, name := range []string{"foreground", "config-file", "profile", "lifecycle-events"} {
+		_, err := newFlagContext(map[string]string{name: "x"})
+
+		assert.ErrorContains(t.T(), err, "can't be set for a mount in process", name)
+	}
+}
+
+func (t *FlagsTest) TestTelemetryResourceAttributes() {
+	args := []string{
+		"--telemetry-resource-attributes=service.name=ingest, team = data,,",
+	}
+
+	f := parseArgs(t, args)
+
+	assert.Equal(t.T(), map[string]string{"service.name": "ingest", "team": "data"}, f.TelemetryResourceAttributes)
+}
+
+func (t *FlagsTest) TestTelemetryResourceAttributes_Invalid() {
+	c, err := newFlagContext(map[string]string{"telemetry-resource-attributes": "team"})
+	assert.NoError(t.T(), err)
+
+	_, err = populateFlags(c)
+
+	assert.ErrorContains(t.T(), err, "telemetry-resource-attributes")
+}
+
+func (t *FlagsTest) TestOnlyDir_Normalized() {
+	args := []string{
+		"--only-dir=/data//raw/",
+	}
+
+	f := parseArgs(t, args)
+
+	assert.Equal(t.T(), "data/raw", f.OnlyDir)
+}
+
+func (t *FlagsTest) TestOnlyDir_Invalid() {
+	for _, dir := range []string{"./data", "data/../raw", "data "} {
+		c, err := newFlagContext(map[string]string{"only-dir": dir})
+		assert.NoError(t.T(), err)
+
+		_, err = populateFlags(c)
+
+		assert.ErrorContains(t.T(), err, "only-dir", dir)
+	}
+}
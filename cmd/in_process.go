@@ -0,0 +1,151 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/config"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/fs/wrappers"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/lifecycle"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/mount"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/util"
+	"github.com/jacobsa/fuse"
+	"github.com/urfave/cli"
+	"golang.org/x/net/context"
+)
+
+// The flags that only make sense on the command line: a mount in process has
+// its config passed in, stays in the process, and reports its stages to
+// lifecycle subscribers.
+var commandLineOnlyFlags = []string{
+	"foreground",
+	"config-file",
+	config.ProfileFlagName,
+	"lifecycle-events",
+}
+
+// newFlagContext returns a context for the flags of gcsfuse with the supplied
+// values by flag name, the others having their defaults, as if they had been
+// given on the command line.
+func newFlagContext(values map[string]string) (c *cli.Context, err error) {
+	app := newApp()
+	set := flag.NewFlagSet(app.Name, flag.ContinueOnError)
+	set.SetOutput(io.Discard)
+	for _, f := range app.Flags {
+		f.Apply(set)
+	}
+
+	for name, value := range values {
+		for _, n := range commandLineOnlyFlags {
+			if name == n {
+				return nil, fmt.Errorf("flag %q can't be set for a mount in process", name)
+			}
+		}
+
+		if err = set.Set(name, value); err != nil {
+			return nil, fmt.Errorf("flag %q: %w", name, err)
+		}
+	}
+
+	return cli.NewContext(app, set, nil), nil
+}
+
+// MountInProcess mounts bucketName on mountPoint, as gcsfuse --foreground
+// does but without parsing the command line, setting up logging or exporting
+// metrics, which are up to the process. The options of the config file are
+// given by mountConfig, whose paths are resolved in place, and the other
+// options by flags, by flag name without the leading dashes. Retries of
+// transient failures to mount stop once ctx is done.
+//
+// The file system is served until it's unmounted, which the caller does with
+// fuse.Unmount, and can wait for by joining the returned file system.
+func MountInProcess(
+	ctx context.Context,
+	bucketName string,
+	mountPoint string,
+	mountConfig *config.MountConfig,
+	flagValues map[string]string) (mfs *fuse.MountedFileSystem, err error) {
+	c, err := newFlagContext(flagValues)
+	if err != nil {
+		return
+	}
+
+	err = resolvePathForTheFlagsInContext(c)
+	if err != nil {
+		return nil, fmt.Errorf("Resolving path: %w", err)
+	}
+
+	flags, err := populateFlags(c)
+	if err != nil {
+		return nil, fmt.Errorf("parsing flags failed: %w", err)
+	}
+
+	err = applyFlagsToMountConfig(c, flags, mountConfig)
+	lifecycle.Publish(lifecycle.ConfigParsed, err)
+	if err != nil {
+		return
+	}
+
+	mountPoint, err = util.GetResolvedPath(mountPoint)
+	if err != nil {
+		return nil, fmt.Errorf("canonicalizing mount point: %w", err)
+	}
+
+	logger.Infof("Start gcsfuse/%s in process for app %q using mount point: %s\n", getVersion(), flags.AppName, mountPoint)
+
+	// As on the command line, refuse to stack on top of another mount or to
+	// hide files, unless asked to.
+	if flags.FuseFd == 0 && flags.FuseSocket == "" {
+		mounts, err := mount.ReadMountInfo()
+		if err != nil {
+			logger.Warnf("Not checking for existing mounts on the mount point: %v", err)
+		}
+		if err = checkMountPoint(mountPoint, flags.NonEmpty, flags.AllowRemount, mounts, mount.LazyUnmount); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := wrappers.EnableMonitoringViews(wrappers.MonitoringOptions{
+		DetailedErrors: mountConfig.MetricsConfig.DetailedErrors,
+	}); err != nil {
+		logger.Errorf("%v", err)
+	}
+
+	mfs, err = mountWithArgs(ctx, bucketName, mountPoint, flags, mountConfig)
+	if err == nil {
+		err = prefetchMetadataOnMount(bucketName, mountPoint, flags)
+		if err != nil {
+			if unmountErr := fuse.Unmount(mfs.Dir()); unmountErr != nil {
+				logger.Errorf("Failed to unmount after a failed metadata-prefetch: %v", unmountErr)
+			} else {
+				_ = mfs.Join(context.Background())
+			}
+			mfs = nil
+		}
+	}
+
+	lifecycle.Publish(lifecycle.Ready, err)
+	if err != nil {
+		logger.Errorf("%s: %v\n", UnsuccessfulMountMessagePrefix, err)
+		return nil, fmt.Errorf("%s: %w", UnsuccessfulMountMessagePrefix, err)
+	}
+
+	logger.Info(successfulMountMessage(flags))
+	return
+}
@@ -22,14 +22,22 @@ package cmd
 import (
 	"fmt"
 	"io/fs"
+	"math"
 	"os"
 	"os/signal"
 	"path"
 	"path/filepath"
+	"runtime"
 	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
 
+	cacheutil "github.com/googlecloudplatform/gcsfuse/v2/internal/cache/util"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/canned"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/config"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/fs/wrappers"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/lifecycle"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/locker"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/monitor"
@@ -47,6 +55,7 @@ import (
 
 const (
 	SuccessfulMountMessage         = "File system has been successfully mounted."
+	SuccessfulLazyMountMessage     = "File system has been successfully mounted (lazy)."
 	UnsuccessfulMountMessagePrefix = "Error while mounting gcsfuse"
 )
 
@@ -54,28 +63,50 @@ const (
 // Helpers
 ////////////////////////////////////////////////////////////////////////
 
+// unmountRequested is set while gcsfuse is unmounting the file system itself,
+// so that an unmount by another process can be told apart once the file
+// system has been unmounted.
+var unmountRequested atomic.Bool
+
 func registerSIGINTHandler(mountPoint string) {
-	// Register for SIGINT.
+	// Register for SIGINT and SIGTERM.
 	signalChan := make(chan os.Signal, 1)
-	signal.Notify(signalChan, os.Interrupt)
+	signal.Notify(signalChan, os.Interrupt, syscall.SIGTERM)
 
-	// Start a goroutine that will unmount when the signal is received.
+	// Start a goroutine that will unmount when a signal is received.
 	go func() {
 		for {
-			<-signalChan
-			logger.Info("Received SIGINT, attempting to unmount...")
+			sig := <-signalChan
+			logger.Infof("Received %v, attempting to unmount...", sig)
+			lifecycle.Publish(lifecycle.Draining, nil)
 
+			unmountRequested.Store(true)
 			err := fuse.Unmount(mountPoint)
 			if err != nil {
-				logger.Errorf("Failed to unmount in response to SIGINT: %v", err)
+				unmountRequested.Store(false)
+				logger.Errorf("Failed to unmount in response to %v: %v", sig, err)
 			} else {
-				logger.Infof("Successfully unmounted in response to SIGINT.")
+				logger.Infof("Successfully unmounted in response to %v.", sig)
 				return
 			}
 		}
 	}()
 }
 
+// writeEffectiveConfig writes the marshalled effective config of the mount to
+// config.EffectiveConfigFileName in the cache dir, creating the dir if needed.
+func writeEffectiveConfig(cacheDir string, effectiveConfig []byte) (err error) {
+	if err = cacheutil.CreateCacheDirectoryIfNotPresentAt(cacheDir, cacheutil.DefaultDirPerm); err != nil {
+		return
+	}
+
+	p := path.Join(cacheDir, config.EffectiveConfigFileName)
+	if err = os.WriteFile(p, effectiveConfig, cacheutil.DefaultFilePerm); err != nil {
+		err = fmt.Errorf("WriteFile: %w", err)
+	}
+	return
+}
+
 func getUserAgent(appName string, config string) string {
 	gcsfuseMetadataImageType := os.Getenv("GCSFUSE_METADATA_IMAGE_TYPE")
 	if len(gcsfuseMetadataImageType) > 0 {
@@ -100,25 +131,61 @@ func getConfigForUserAgent(mountConfig *config.MountConfig) string {
 	}
 	return fmt.Sprintf("%s:%s", isFileCacheEnabled, isFileCacheForRangeReadEnabled)
 }
-func createStorageHandle(flags *flagStorage, mountConfig *config.MountConfig, userAgent string) (storageHandle storage.StorageHandle, err error) {
-	storageClientConfig := storageutil.StorageClientConfig{
-		ClientProtocol:             flags.ClientProtocol,
-		MaxConnsPerHost:            flags.MaxConnsPerHost,
-		MaxIdleConnsPerHost:        flags.MaxIdleConnsPerHost,
+
+// getFeaturesForUserAgent returns the features of the mount that the
+// User-Agent of its requests tells about, after the config above.
+func getFeaturesForUserAgent(flags *flagStorage, mountConfig *config.MountConfig) storageutil.Features {
+	_, readOnly := flags.MountOptions["ro"]
+	return storageutil.Features{
+		FileCache:             config.IsFileCacheEnabled(mountConfig),
+		FileCacheForRangeRead: mountConfig.FileCacheConfig.CacheFileForRangeRead,
+		SharedFileCache:       mountConfig.FileCacheConfig.Shared,
+		BackgroundUploads:     flags.MaxParallelUploads > 0,
+		ReadOnly:              readOnly,
+	}
+}
+
+func getStorageClientConfig(flags *flagStorage, mountConfig *config.MountConfig, userAgent string) storageutil.StorageClientConfig {
+	return storageutil.StorageClientConfig{
+		ClientProtocol:             mount.ClientProtocol(mountConfig.GCSConnectionConfig.ClientProtocol),
+		MaxConnsPerHost:            mountConfig.GCSConnectionConfig.MaxConnsPerHost,
+		MaxIdleConnsPerHost:        mountConfig.GCSConnectionConfig.MaxIdleConnsPerHost,
+		IdleConnTimeout:            mountConfig.GCSConnectionConfig.IdleConnTimeout,
+		TLSHandshakeTimeout:        mountConfig.GCSConnectionConfig.TLSHandshakeTimeout,
+		ResponseHeaderTimeout:      mountConfig.GCSConnectionConfig.ResponseHeaderTimeout,
+		OpMetadataHeader:           mountConfig.GCSConnectionConfig.OpMetadataHeader,
+		OpMetadataUid:              mountConfig.GCSConnectionConfig.OpMetadataUid,
+		DrainTimeout:               mountConfig.GCSConnectionConfig.DrainTimeout,
 		HttpClientTimeout:          flags.HttpClientTimeout,
 		MaxRetrySleep:              flags.MaxRetrySleep,
 		RetryMultiplier:            flags.RetryMultiplier,
 		UserAgent:                  userAgent,
+		Features:                   getFeaturesForUserAgent(flags, mountConfig),
 		CustomEndpoint:             flags.CustomEndpoint,
+		UniverseDomain:             flags.UniverseDomain,
+		PSCEndpoint:                flags.PSCEndpoint,
 		KeyFile:                    flags.KeyFile,
 		AnonymousAccess:            mountConfig.AuthConfig.AnonymousAccess,
 		TokenUrl:                   flags.TokenUrl,
 		ReuseTokenFromUrl:          flags.ReuseTokenFromUrl,
+		TokenEarlyExpiry:           tokenEarlyExpiry(flags.KeepaliveInterval),
 		ExperimentalEnableJsonRead: flags.ExperimentalEnableJsonRead,
 		GrpcConnPoolSize:           mountConfig.GrpcClientConfig.ConnPoolSize,
 		EnableHNS:                  mountConfig.EnableHNS,
 	}
-	logger.Infof("UserAgent = %s\n", storageClientConfig.UserAgent)
+}
+
+// tokenEarlyExpiry returns how long before they expire access tokens are
+// refreshed for the given keepalive interval. Keepalives come at most 1.25
+// intervals apart while idle, so one of them refreshes the token before it
+// expires, and tokens live an hour, so that's at most half of it.
+func tokenEarlyExpiry(keepaliveInterval time.Duration) time.Duration {
+	return min(2*keepaliveInterval, 30*time.Minute)
+}
+
+func createStorageHandle(flags *flagStorage, mountConfig *config.MountConfig, userAgent string) (storageHandle storage.StorageHandle, err error) {
+	storageClientConfig := getStorageClientConfig(flags, mountConfig, userAgent)
+	logger.Infof("UserAgent = %s\n", storageutil.UserAgent(&storageClientConfig))
 	storageHandle, err = storage.NewStorageHandle(context.Background(), storageClientConfig)
 	return
 }
@@ -127,8 +194,10 @@ func createStorageHandle(flags *flagStorage, mountConfig *config.MountConfig, us
 // main logic
 ////////////////////////////////////////////////////////////////////////
 
-// Mount the file system according to arguments in the supplied context.
+// Mount the file system according to arguments. Retries of transient
+// failures stop once ctx is done.
 func mountWithArgs(
+	ctx context.Context,
 	bucketName string,
 	mountPoint string,
 	flags *flagStorage,
@@ -143,37 +212,112 @@ func mountWithArgs(
 
 	// Grab the connection.
 	//
-	// Special case: if we're mounting the fake bucket, we don't need an actual
-	// connection.
-	var storageHandle storage.StorageHandle
-	if bucketName != canned.FakeBucketName {
-		userAgent := getUserAgent(flags.AppName, getConfigForUserAgent(mountConfig))
-		logger.Info("Creating Storage handle...")
-		storageHandle, err = createStorageHandle(flags, mountConfig, userAgent)
+	// Creating the client and probing the bucket are retried on transient
+	// errors, since the network may not be up yet when we're started.
+	retryConfig := mount.MountRetryConfig{
+		Attempts:   flags.MountRetryAttempts,
+		Backoff:    flags.MountRetryBackoff,
+		MaxBackoff: flags.MaxRetrySleep,
+	}
+
+	// Receive the descriptor to serve on once, rather than on every attempt.
+	if flags.FuseSocket != "" {
+		logger.Infof("Receiving the file descriptor of /dev/fuse from %q", flags.FuseSocket)
+		flags.FuseFd, err = mount.ReceiveFuseFd(flags.FuseSocket)
 		if err != nil {
-			err = fmt.Errorf("Failed to create storage handle using createStorageHandle: %w", err)
+			err = fmt.Errorf("fuse-socket: %w", err)
 			return
 		}
 	}
 
-	// Mount the file system.
-	logger.Infof("Creating a mount at %q\n", mountPoint)
-	mfs, err = mountWithStorageHandle(
-		context.Background(),
-		bucketName,
-		mountPoint,
-		flags,
-		mountConfig,
-		storageHandle)
+	// With --lazy-init, mount at once and leave the rest to the first
+	// operation. Its failures are retried by the next one rather than here.
+	if flags.LazyInit {
+		logger.Infof("Creating a lazy mount at %q\n", mountPoint)
+		mfs, err = mountWithStorageHandle(
+			ctx,
+			bucketName,
+			mountPoint,
+			flags,
+			mountConfig,
+			func() (storage.StorageHandle, error) {
+				return newStorageHandle(bucketName, flags, mountConfig)
+			})
 
-	if err != nil {
-		err = fmt.Errorf("mountWithStorageHandle: %w", err)
+		if err != nil {
+			err = fmt.Errorf("mountWithStorageHandle: %w", err)
+		}
 		return
 	}
 
+	err = retryConfig.RetryTransient(ctx, func() (err error) {
+		storageHandle, err := newStorageHandle(bucketName, flags, mountConfig)
+		if err != nil {
+			return
+		}
+
+		// Mount the file system.
+		logger.Infof("Creating a mount at %q\n", mountPoint)
+		mfs, err = mountWithStorageHandle(
+			ctx,
+			bucketName,
+			mountPoint,
+			flags,
+			mountConfig,
+			func() (storage.StorageHandle, error) { return storageHandle, nil })
+
+		if err != nil {
+			err = fmt.Errorf("mountWithStorageHandle: %w", err)
+			return
+		}
+
+		return
+	}, logMountRetry)
+
+	return
+}
+
+// newStorageHandle creates the storage handle to mount bucketName with, or
+// none when mounting the fake bucket, which doesn't need an actual
+// connection.
+func newStorageHandle(
+	bucketName string,
+	flags *flagStorage,
+	mountConfig *config.MountConfig) (storageHandle storage.StorageHandle, err error) {
+	if bucketName == canned.FakeBucketName {
+		lifecycle.Publish(lifecycle.ClientCreated, nil)
+		return
+	}
+
+	userAgent := getUserAgent(flags.AppName, getConfigForUserAgent(mountConfig))
+	logger.Info("Creating Storage handle...")
+	storageHandle, err = createStorageHandle(flags, mountConfig, userAgent)
+	lifecycle.Publish(lifecycle.ClientCreated, err)
+	if err != nil {
+		err = fmt.Errorf("Failed to create storage handle using createStorageHandle: %w", err)
+	}
 	return
 }
 
+// successfulMountMessage tells a mount that has accessed its bucket apart
+// from a lazy one, which hasn't yet.
+func successfulMountMessage(flags *flagStorage) string {
+	if flags.LazyInit {
+		return SuccessfulLazyMountMessage
+	}
+	return SuccessfulMountMessage
+}
+
+// logMountRetry reports a transient mount failure. The message also goes to
+// the status writer so that, when daemonized, the waiting parent shows it.
+func logMountRetry(retry int, err error, wait time.Duration) {
+	msg := fmt.Sprintf("Mount attempt failed with a transient error, retry %d in %v: %v", retry, wait, err)
+	logger.Warnf("%s", msg)
+	if _, ok := os.LookupEnv(logger.GCSFuseInBackgroundMode); ok {
+		fmt.Fprintln(daemonize.StatusWriter, msg)
+	}
+}
+
 func populateArgs(c *cli.Context) (
 	bucketName string,
 	mountPoint string,
@@ -231,36 +375,97 @@ func callListRecursive(mountPoint string) (err error) {
 	return nil
 }
 
-func isDynamicMount(bucketName string) bool {
-	return bucketName == "" || bucketName == "_"
+// prefetchMetadataOnMount lists the mount recursively as asked for by
+// --experimental-metadata-prefetch-on-mount, returning the error of a
+// synchronous listing.
+func prefetchMetadataOnMount(bucketName string, mountPoint string, flags *flagStorage) error {
+	// Prefetching would set up a lazy mount at once.
+	prefetch := flags.ExperimentalMetadataPrefetchOnMount
+	if flags.LazyInit && prefetch != config.ExperimentalMetadataPrefetchOnMountDisabled {
+		logger.Warnf("Not prefetching metadata on mount with --lazy-init.")
+		prefetch = config.ExperimentalMetadataPrefetchOnMountDisabled
+	}
+	if isDynamicMount(bucketName) {
+		return nil
+	}
+
+	switch prefetch {
+	case config.ExperimentalMetadataPrefetchOnMountSynchronous:
+		return callListRecursive(mountPoint)
+	case config.ExperimentalMetadataPrefetchOnMountAsynchronous:
+		go func() {
+			if err := callListRecursive(mountPoint); err != nil {
+				logger.Errorf("Metadata-prefetch failed: %v", err)
+			}
+		}()
+	}
+
+	return nil
 }
 
-func runCLIApp(c *cli.Context) (err error) {
-	err = resolvePathForTheFlagsInContext(c)
+// applyCgroupCPUQuota sets GOMAXPROCS, unless set in the environment, and
+// fuse-parallelism, unless set, to the CPU quota of our cgroup, as Go sizes
+// itself to the CPUs of the machine.
+func applyCgroupCPUQuota(flags *flagStorage) {
+	cpus, ok, err := util.CgroupCPUQuota()
 	if err != nil {
-		return fmt.Errorf("Resolving path: %w", err)
+		logger.Warnf("Not sizing to the cgroup CPU quota: %v", err)
+		return
+	}
+	if !ok {
+		logger.Infof("No cgroup CPU quota, keeping GOMAXPROCS=%d", runtime.GOMAXPROCS(0))
+		return
 	}
 
-	flags, err := populateFlags(c)
-	if err != nil {
-		return fmt.Errorf("parsing flags failed: %w", err)
+	procs := min(max(1, int(math.Ceil(cpus))), runtime.NumCPU())
+	if _, ok := os.LookupEnv("GOMAXPROCS"); !ok {
+		runtime.GOMAXPROCS(procs)
+	}
+	if flags.FuseParallelism == 0 {
+		flags.FuseParallelism = procs * fuseParallelismPerCPU
 	}
 
-	mountConfig, err := config.ParseConfigFile(flags.ConfigFile)
+	logger.Infof("Sized to a cgroup CPU quota of %g CPUs: GOMAXPROCS=%d, fuse-parallelism=%d",
+		cpus, runtime.GOMAXPROCS(0), flags.FuseParallelism)
+}
+
+func isDynamicMount(bucketName string) bool {
+	return bucketName == "" || bucketName == "_"
+}
+
+// parseMountConfig parses the config file and applies the flags that override
+// it.
+func parseMountConfig(c *cli.Context, flags *flagStorage) (mountConfig *config.MountConfig, err error) {
+	mountConfig, err = config.ParseConfigFileWithProfile(flags.ConfigFile, flags.Profile)
 	if err != nil {
-		return fmt.Errorf("parsing config file failed: %w", err)
+		return nil, fmt.Errorf("parsing config file failed: %w", err)
 	}
 
+	if err = applyFlagsToMountConfig(c, flags, mountConfig); err != nil {
+		return nil, err
+	}
+
+	return
+}
+
+// applyFlagsToMountConfig applies the flags that override the config file to
+// mountConfig, and resolves its paths.
+func applyFlagsToMountConfig(c *cli.Context, flags *flagStorage, mountConfig *config.MountConfig) (err error) {
 	config.OverrideWithLoggingFlags(mountConfig, flags.LogFile, flags.LogFormat,
 		flags.DebugFuse, flags.DebugGCS, flags.DebugMutex)
 	config.OverrideWithIgnoreInterruptsFlag(c, mountConfig, flags.IgnoreInterrupts)
 	config.OverrideWithAnonymousAccessFlag(c, mountConfig, flags.AnonymousAccess)
 	config.OverrideWithKernelListCacheTtlFlag(c, mountConfig, flags.KernelListCacheTtlSeconds)
+	config.OverrideWithMetricsDetailedErrorsFlag(c, mountConfig, flags.MetricsDetailedErrors)
+	if err = config.OverrideWithGCSConnectionFlags(c, mountConfig, string(flags.ClientProtocol),
+		flags.MaxConnsPerHost, flags.MaxIdleConnsPerHost); err != nil {
+		return fmt.Errorf("invalid gcs-connection settings: %w", err)
+	}
 
 	// Ideally this call to SetLogFormat (which internally creates a new defaultLogger)
-	// should be set as an else to the 'if flags.Foreground' check below, but currently
-	// that means the logs generated by resolveConfigFilePaths below don't honour
-	// the user-provided log-format.
+	// should be set as an else to the 'if flags.Foreground' check in runCLIApp,
+	// but currently that means the logs generated by resolveConfigFilePaths below
+	// don't honour the user-provided log-format.
 	logger.SetLogFormat(mountConfig.LogConfig.Format)
 
 	err = resolveConfigFilePaths(mountConfig)
@@ -268,6 +473,38 @@ func runCLIApp(c *cli.Context) (err error) {
 		return fmt.Errorf("Resolving path: %w", err)
 	}
 
+	return
+}
+
+func runCLIApp(c *cli.Context) (err error) {
+	err = resolvePathForTheFlagsInContext(c)
+	if err != nil {
+		return fmt.Errorf("Resolving path: %w", err)
+	}
+
+	flags, err := populateFlags(c)
+	if err != nil {
+		return fmt.Errorf("parsing flags failed: %w", err)
+	}
+
+	// Only the process that mounts reports on the mount, so that a daemonized
+	// mount doesn't report its stages twice.
+	if flags.Foreground && flags.LifecycleEvents != "" {
+		var f *os.File
+		f, err = os.OpenFile(flags.LifecycleEvents, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			return fmt.Errorf("opening lifecycle-events: %w", err)
+		}
+		defer f.Close()
+		defer lifecycle.Subscribe(lifecycle.JSONLines(f))()
+	}
+
+	mountConfig, err := parseMountConfig(c, flags)
+	lifecycle.Publish(lifecycle.ConfigParsed, err)
+	if err != nil {
+		return err
+	}
+
 	if flags.Foreground {
 		err = logger.InitLogFile(mountConfig.LogConfig)
 		if err != nil {
@@ -284,24 +521,41 @@ func runCLIApp(c *cli.Context) (err error) {
 
 	logger.Infof("Start gcsfuse/%s for app %q using mount point: %s\n", getVersion(), flags.AppName, mountPoint)
 
+	// Refuse to stack on top of another mount or to hide files, unless asked
+	// to. When given the descriptor of /dev/fuse, the caller has already
+	// mounted it there.
+	if flags.FuseFd == 0 && flags.FuseSocket == "" {
+		mounts, err := mount.ReadMountInfo()
+		if err != nil {
+			logger.Warnf("Not checking for existing mounts on the mount point: %v", err)
+		}
+		if err = checkMountPoint(mountPoint, flags.NonEmpty, flags.AllowRemount, mounts, mount.LazyUnmount); err != nil {
+			return err
+		}
+	}
+
 	// Log mount-config and the CLI flags in the log-file.
 	// If there is no log-file, then log these to stdout.
 	// Do not log these in stdout in case of daemonized run
 	// if these are already being logged into a log-file, otherwise
 	// there will be duplicate logs for these in both places (stdout and log-file).
-	if flags.Foreground || mountConfig.LogConfig.FilePath == "" {
-		flagsStringified, err := util.Stringify(*flags)
-		if err != nil {
-			logger.Warnf("failed to stringify cli flags: %v", err)
-		} else {
-			logger.Infof("GCSFuse mount command flags: %s", flagsStringified)
+	effectiveConfig, err := (&config.EffectiveConfig{
+		Flags:            flags,
+		Config:           mountConfig,
+		FuseCapabilities: fuseCapabilities(newFuseMountConfig("", flags, mountConfig)),
+	}).Marshal()
+	if err != nil {
+		logger.Warnf("failed to marshal effective config: %v", err)
+	} else {
+		if flags.Foreground || mountConfig.LogConfig.FilePath == "" {
+			logger.Infof("GCSFuse effective config:\n%s", effectiveConfig)
 		}
 
-		mountConfigStringified, err := util.Stringify(*mountConfig)
-		if err != nil {
-			logger.Warnf("failed to stringify config-file: %v", err)
-		} else {
-			logger.Infof("GCSFuse mount config flags: %s", mountConfigStringified)
+		// Leave the config next to the cache for whoever debugs the mount later.
+		if flags.Foreground && mountConfig.CacheDir != "" {
+			if err := writeEffectiveConfig(string(mountConfig.CacheDir), effectiveConfig); err != nil {
+				logger.Warnf("failed to write effective config: %v", err)
+			}
 		}
 	}
 
@@ -392,19 +646,32 @@ func runCLIApp(c *cli.Context) (err error) {
 		if err != nil {
 			return fmt.Errorf("daemonize.Run: %w", err)
 		}
-		logger.Infof(SuccessfulMountMessage)
+		logger.Infof(successfulMountMessage(flags))
 		return err
 	}
 
+	if flags.CgroupCPUQuota {
+		applyCgroupCPUQuota(flags)
+	}
+
+	if err := wrappers.EnableMonitoringViews(wrappers.MonitoringOptions{
+		DetailedErrors: mountConfig.MetricsConfig.DetailedErrors,
+	}); err != nil {
+		logger.Errorf("%v", err)
+	}
+
 	// The returned error is ignored as we do not enforce monitoring exporters
-	_ = monitor.EnableStackdriverExporter(flags.StackdriverExportInterval)
-	_ = monitor.EnableOpenTelemetryCollectorExporter(flags.OtelCollectorAddress)
+	if flags.StackdriverExportInterval > 0 || flags.OtelCollectorAddress != "" {
+		res := monitor.DetectResource(context.Background(), getVersion(), bucketName, flags.TelemetryResourceAttributes)
+		_ = monitor.EnableStackdriverExporter(flags.StackdriverExportInterval, res)
+		_ = monitor.EnableOpenTelemetryCollectorExporter(flags.OtelCollectorAddress, res)
+	}
 
 	// Mount, writing information about our progress to the writer that package
 	// daemonize gives us and telling it about the outcome.
 	var mfs *fuse.MountedFileSystem
 	{
-		mfs, err = mountWithArgs(bucketName, mountPoint, flags, mountConfig)
+		mfs, err = mountWithArgs(context.Background(), bucketName, mountPoint, flags, mountConfig)
 
 		// This utility is to absorb the error
 		// returned by daemonize.SignalOutcome calls by simply
@@ -417,7 +684,8 @@ func runCLIApp(c *cli.Context) (err error) {
 
 		markSuccessfulMount := func() {
 			// Print the success message in the log-file/stdout depending on what the logger is set to.
-			logger.Info(SuccessfulMountMessage)
+			logger.Info(successfulMountMessage(flags))
+			lifecycle.Publish(lifecycle.Ready, nil)
 			callDaemonizeSignalOutcome(nil)
 		}
 
@@ -426,6 +694,7 @@ func runCLIApp(c *cli.Context) (err error) {
 			// mounting gcsfuse in foreground mode. But this is important to avoid
 			// losing error logs when run in the background mode.
 			logger.Errorf("%s: %v\n", UnsuccessfulMountMessagePrefix, err)
+			lifecycle.Publish(lifecycle.Ready, err)
 			err = fmt.Errorf("%s: mountWithArgs: %w", UnsuccessfulMountMessagePrefix, err)
 			callDaemonizeSignalOutcome(err)
 		}
@@ -434,29 +703,25 @@ func runCLIApp(c *cli.Context) (err error) {
 			markMountFailure(err)
 			return err
 		}
-		if !isDynamicMount(bucketName) {
-			switch flags.ExperimentalMetadataPrefetchOnMount {
-			case config.ExperimentalMetadataPrefetchOnMountSynchronous:
-				if err = callListRecursive(mountPoint); err != nil {
-					markMountFailure(err)
-					return err
-				}
-			case config.ExperimentalMetadataPrefetchOnMountAsynchronous:
-				go func() {
-					if err := callListRecursive(mountPoint); err != nil {
-						logger.Errorf("Metadata-prefetch failed: %v", err)
-					}
-				}()
-			}
+		if err = prefetchMetadataOnMount(bucketName, mountPoint, flags); err != nil {
+			markMountFailure(err)
+			return err
 		}
 		markSuccessfulMount()
 	}
 
-	// Let the user unmount with Ctrl-C (SIGINT).
-	registerSIGINTHandler(mfs.Dir())
+	// Let the user unmount with Ctrl-C (SIGINT) or SIGTERM. A mount on a
+	// descriptor of /dev/fuse that was passed in is the caller's to unmount,
+	// and gcsfuse just exits.
+	if flags.FuseFd == 0 {
+		registerSIGINTHandler(mfs.Dir())
+	}
 
-	// Wait for the file system to be unmounted.
+	// Wait for the file system to be unmounted. Whoever unmounts it, the file
+	// system has drained its uploads, journaled its staged writes and closed
+	// the storage client by the time Join returns.
 	err = mfs.Join(context.Background())
+	lifecycle.Publish(lifecycle.Unmounted, err)
 
 	monitor.CloseStackdriverExporter()
 	monitor.CloseOpenTelemetryCollectorExporter()
@@ -466,6 +731,11 @@ func runCLIApp(c *cli.Context) (err error) {
 		return
 	}
 
+	if flags.FuseFd == 0 && !unmountRequested.Load() {
+		logger.Infof("%s was unmounted by another process; shut down cleanly.", mfs.Dir())
+		err = externalUnmountError(mfs.Dir())
+	}
+
 	return
 }
 
@@ -497,6 +767,6 @@ func ExecuteLegacyMain() {
 	err := run()
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		os.Exit(exitCode(err))
 	}
 }
@@ -17,13 +17,17 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"time"
 
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/metadata"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/config"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/lifecycle"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/mount"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage"
 	"golang.org/x/net/context"
 
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/fs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/fs/wrappers"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/gcsx"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/perms"
@@ -33,18 +37,24 @@ import (
 )
 
 // Mount the file system based on the supplied arguments, returning a
-// fuse.MountedFileSystem that can be joined to wait for unmounting.
+// fuse.MountedFileSystem that can be joined to wait for unmounting. The
+// storage handle is got from getStorageHandle when mounting, or by the first
+// file system operation with --lazy-init.
 func mountWithStorageHandle(
 	ctx context.Context,
 	bucketName string,
 	mountPoint string,
 	flags *flagStorage,
 	mountConfig *config.MountConfig,
-	storageHandle storage.StorageHandle) (mfs *fuse.MountedFileSystem, err error) {
+	getStorageHandle func() (storage.StorageHandle, error)) (mfs *fuse.MountedFileSystem, err error) {
+	// Mounts with -o ro are read-only too, so nothing need be set up to write.
+	_, ro := flags.MountOptions["ro"]
+	assumeReadOnly := flags.AssumeReadOnly || ro
+
 	// Sanity check: make sure the temporary directory exists and is writable
 	// currently. This gives a better user experience than harder to debug EIO
 	// errors when reading files in the future.
-	if flags.TempDir != "" {
+	if flags.TempDir != "" && !assumeReadOnly {
 		logger.Infof("Creating a temporary directory at %q\n", flags.TempDir)
 		var f *os.File
 		f, err = fsutil.AnonymousFile(flags.TempDir)
@@ -85,51 +95,142 @@ be interacting with the file system.`)
 	}
 
 	metadataCacheTTL := mount.ResolveMetadataCacheTTL(flags.StatCacheTTL, flags.TypeCacheTTL, mountConfig.MetadataCacheConfig.TtlInSeconds)
+	metadataCacheTTLs, entryCacheTTLs := mount.ResolveEntryTTLs(flags.FileEntryTTL, flags.DirEntryTTL, metadataCacheTTL)
 	statCacheMaxSizeMB, err := mount.ResolveStatCacheMaxSizeMB(mountConfig.StatCacheMaxSizeMB, flags.StatCacheCapacity)
 	if err != nil {
 		return nil, fmt.Errorf("failed to calculate StatCacheMaxSizeMB from stat-cache-ttl=%v, metadata-cache:stat-cache-max-size-mb=%v: %w", flags.StatCacheCapacity, mountConfig.StatCacheMaxSizeMB, err)
 	}
 
+	// Configs read from the buckets, shared by the stat cache and the file
+	// system.
+	var dirConfigs *config.DirConfigs
+	if mountConfig.FileSystemConfig.DirConfigFiles {
+		dirConfigs = config.NewDirConfigs()
+	}
+
+	// Nil unless plans are logged or mutations are dry runs.
+	mutationPlanner := gcsx.NewMutationPlanner(mountConfig.WriteConfig.LogMutationPlan, flags.MutationDryRun)
+
 	bucketCfg := gcsx.BucketConfig{
 		BillingProject:                     flags.BillingProject,
 		OnlyDir:                            flags.OnlyDir,
 		EgressBandwidthLimitBytesPerSecond: flags.EgressBandwidthLimitBytesPerSecond,
 		OpRateLimitHz:                      flags.OpRateLimitHz,
+		MaxMetadataOpsPerSec:               flags.MaxMetadataOpsPerSec,
+		MetadataOpsBurst:                   flags.MetadataOpsBurst,
 		StatCacheMaxSizeMB:                 statCacheMaxSizeMB,
-		StatCacheTTL:                       metadataCacheTTL,
+		StatCacheTTLs:                      metadataCacheTTLs,
+		CacheControlTTL:                    metadata.NewCacheControlTTL(mountConfig.MetadataCacheConfig),
+		DirConfigs:                         dirConfigs,
+		LookupBatchWindow:                  mountConfig.MetadataCacheConfig.LookupBatchWindow,
 		EnableMonitoring:                   flags.StackdriverExportInterval > 0,
 		AppendThreshold:                    1 << 21, // 2 MiB, a total guess.
 		TmpObjectPrefix:                    ".gcsfuse_tmp/",
+		UploadProgressInterval:             mountConfig.LogConfig.UploadProgress.IntervalMB << 20,
+		PerObjectWriteDelayMax:             flags.PerObjectWriteDelayMax,
+		CompositeUploadThreshold:           int64(flags.CompositeUploadThreshold) << 20,
 		DebugGCS:                           flags.DebugGCS,
+		ContentTypeOverrides:               mountConfig.WriteConfig.ContentTypeOverrides,
+		DisableContentTypeInference:        mountConfig.WriteConfig.DisableContentTypeInference,
+		MutationPlanner:                    mutationPlanner,
+		KeepaliveInterval:                  flags.KeepaliveInterval,
+		AssumeReadOnly:                     assumeReadOnly,
+	}
+	newBucketManager := func() (gcsx.BucketManager, error) {
+		storageHandle, err := getStorageHandle()
+		if err != nil {
+			return nil, err
+		}
+		return gcsx.NewBucketManager(bucketCfg, storageHandle), nil
+	}
+
+	// Zero disables advisory locking via lock objects.
+	var lockFileTTL time.Duration
+	if flags.EnableLockFiles {
+		lockFileTTL = flags.LockFileTTL
+	}
+
+	// Nil caches attributes as long as their records.
+	var attrCacheTTL *time.Duration
+	if flags.AttrCacheTTL >= 0 {
+		attrCacheTTL = &flags.AttrCacheTTL
+	}
+
+	// Empty disables compat directory markers.
+	var compatDirMarkerTypes []string
+	if flags.CompatDirMarkers {
+		compatDirMarkerTypes = flags.CompatDirMarkerTypes
 	}
-	bm := gcsx.NewBucketManager(bucketCfg, storageHandle)
 
 	// Create a file system server.
 	serverCfg := &fs.ServerConfig{
 		CacheClock:                 timeutil.RealClock(),
-		BucketManager:              bm,
 		BucketName:                 bucketName,
+		OnlyDir:                    flags.OnlyDir,
 		LocalFileCache:             flags.LocalFileCache,
 		DebugFS:                    flags.DebugFS,
 		TempDir:                    flags.TempDir,
+		ReadOnly:                   assumeReadOnly,
 		ImplicitDirectories:        flags.ImplicitDirs,
-		InodeAttributeCacheTTL:     metadataCacheTTL,
-		DirTypeCacheTTL:            metadataCacheTTL,
+		InodeAttributeCacheTTLs:    metadataCacheTTLs,
+		AttrCacheTTL:               attrCacheTTL,
+		EntryCacheTTLs:             entryCacheTTLs,
+		DirTypeCacheTTLs:           metadataCacheTTLs,
 		Uid:                        uid,
 		Gid:                        gid,
 		FilePerms:                  os.FileMode(flags.FileMode),
 		DirPerms:                   os.FileMode(flags.DirMode),
 		RenameDirLimit:             flags.RenameDirLimit,
 		SequentialReadSizeMb:       flags.SequentialReadSizeMb,
+		MmapReadRetries:            flags.MmapReadRetries,
 		EnableNonexistentTypeCache: flags.EnableNonexistentTypeCache,
+		KernelPageCache:            flags.KernelPageCache,
+		DirTimes:                   flags.DirTimes,
+		DirSizeXattrMaxObjects:     flags.DirSizeXattrMaxObjects,
+		DirSizeXattrParallelism:    flags.DirSizeXattrParallelism,
+		MetadataQueryMaxObjects:    flags.MetadataQueryMaxObjects,
+		MetadataQueryTimeout:       flags.MetadataQueryTimeout,
+		CompatDirMarkerTypes:       compatDirMarkerTypes,
+		LockFileTTL:                lockFileTTL,
+		MaxParallelUploads:         flags.MaxParallelUploads,
+		DeleteParallelism:          flags.DeleteParallelism,
+		StrictUnlink:               flags.StrictUnlink,
+		AsyncUnlink:                flags.AsyncUnlink,
+		MutationPlanner:            mutationPlanner,
+		MountPoint:                 mountPoint,
+		RecoverStagedWrites:        flags.RecoverStagedWrites,
+		FlushTimeout:               flags.FlushTimeout,
+		MinFreeStagingMB:           flags.MinFreeStagingMB,
+		FlushRetryInterval:         flags.FlushRetryInterval,
+		EnableZeroExtentHints:      flags.EnableZeroExtentHints,
+		PreserveAtime:              flags.PreserveAtime,
+		TimesUpdateDelay:           flags.TimesUpdateDelay,
+		FuseParallelism:            flags.FuseParallelism,
+		DirConfigs:                 dirConfigs,
 		MountConfig:                mountConfig,
+		MonitoringOptions: wrappers.MonitoringOptions{
+			SessionSummaryFile: flags.SessionSummaryFile,
+			LogGCSRequests:     flags.DebugFuse,
+			DetailedErrors:     mountConfig.MetricsConfig.DetailedErrors,
+		},
 	}
 
-	logger.Infof("Creating a new server...\n")
-	server, err := fs.NewServer(ctx, serverCfg)
-	if err != nil {
-		err = fmt.Errorf("fs.NewServer: %w", err)
-		return
+	var server fuse.Server
+	if flags.LazyInit {
+		logger.Infof("Creating a new server, to be set up by the first operation...\n")
+		server = fs.NewLazyServer(serverCfg, newBucketManager)
+	} else {
+		logger.Infof("Creating a new server...\n")
+		serverCfg.BucketManager, err = newBucketManager()
+		if err != nil {
+			return
+		}
+
+		server, err = fs.NewServer(ctx, serverCfg)
+		if err != nil {
+			err = fmt.Errorf("fs.NewServer: %w", err)
+			return
+		}
 	}
 
 	fsName := bucketName
@@ -140,10 +241,53 @@ be interacting with the file system.`)
 
 	// Mount the file system.
 	logger.Infof("Mounting file system %q...", fsName)
-	mountCfg := &fuse.MountConfig{
+	mount.SetPlatformMountOptions(flags.MountOptions)
+	mountCfg := newFuseMountConfig(fsName, flags, mountConfig)
+
+	// Don't ask the kernel for what it won't grant, and tell what that costs.
+	if fuseCaps := fuseCapabilities(mountCfg); fuseCaps != nil {
+		fuseCaps.Log(fuseCaps.Degrade(mountCfg))
+	}
+
+	mountCfg.ErrorLogger = logger.NewLegacyLogger(logger.LevelError, "fuse: ")
+	mountCfg.DebugLogger = logger.NewLegacyLogger(logger.LevelTrace, "fuse_debug: ")
+
+	// Serve on the caller's /dev/fuse, already mounted on the mount point, if
+	// given one. The library does that for mount points of the form /dev/fd/N.
+	fuseMountPoint := mountPoint
+	if flags.FuseFd > 0 {
+		fuseMountPoint, err = mount.FuseFdPath(flags.FuseFd)
+		if err != nil {
+			err = fmt.Errorf("fuse-fd: %w", err)
+			return
+		}
+		logger.Infof("Serving the file system mounted on %q on file descriptor %d", mountPoint, flags.FuseFd)
+	}
+
+	mfs, err = fuse.Mount(fuseMountPoint, server, mountCfg)
+	lifecycle.Publish(lifecycle.Mounted, err)
+	if err != nil {
+		err = fmt.Errorf("Mount: %w", err)
+		return
+	}
+
+	// Let the kernel send as many asynchronous requests as we process.
+	if flags.FuseParallelism > 0 {
+		if err := mount.SetMaxBackground(mountPoint, flags.FuseParallelism); err != nil {
+			logger.Warnf("Keeping the kernel's limit on background fuse requests: %v", err)
+		}
+	}
+
+	return
+}
+
+// newFuseMountConfig returns the config of the fuse library for mounting the
+// file system of the given name.
+func newFuseMountConfig(fsName string, flags *flagStorage, mountConfig *config.MountConfig) *fuse.MountConfig {
+	return &fuse.MountConfig{
 		FSName:     fsName,
 		Subtype:    "gcsfuse",
-		VolumeName: "gcsfuse",
+		VolumeName: fsName,
 		Options:    flags.MountOptions,
 		// Allows parallel LookUpInode & ReadDir calls from Kernel's FUSE driver.
 		// GCSFuse takes exclusive lock on directory inodes during ReadDir call,
@@ -155,15 +299,21 @@ be interacting with the file system.`)
 		// happen parallely.
 		EnableParallelDirOps: !(mountConfig.FileSystemConfig.DisableParallelDirops),
 	}
+}
 
-	mountCfg.ErrorLogger = logger.NewLegacyLogger(logger.LevelError, "fuse: ")
-	mountCfg.DebugLogger = logger.NewLegacyLogger(logger.LevelTrace, "fuse_debug: ")
-
-	mfs, err = fuse.Mount(mountPoint, server, mountCfg)
+// fuseCapabilities returns the capabilities that mounting with cfg asks the
+// kernel for and which of them it grants, or nil if that can't be told.
+func fuseCapabilities(cfg *fuse.MountConfig) *mount.FuseCapabilities {
+	release, err := mount.KernelRelease()
 	if err != nil {
-		err = fmt.Errorf("Mount: %w", err)
-		return
+		logger.Debugf("Not checking the fuse capabilities: %v", err)
+		return nil
 	}
 
-	return
+	caps, err := mount.NegotiateFuseCapabilities(release, mount.RequestedFuseCapabilities(cfg))
+	if err != nil {
+		logger.Warnf("Not checking the fuse capabilities: %v", err)
+		return nil
+	}
+	return caps
 }
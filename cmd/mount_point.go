@@ -0,0 +1,123 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
+	mountpkg "github.com/googlecloudplatform/gcsfuse/v2/internal/mount"
+)
+
+const (
+	// ExitCodeMountPointIsMounted is the exit status when the mount point
+	// already has a FUSE file system mounted on it and --allow-remount isn't
+	// set.
+	ExitCodeMountPointIsMounted = 3
+
+	// ExitCodeMountPointNotEmpty is the exit status when the mount point has
+	// entries and --nonempty isn't set.
+	ExitCodeMountPointNotEmpty = 4
+
+	// ExitCodeUnmountedExternally is the exit status when the file system was
+	// unmounted by another process, e.g. with fusermount -u, rather than in
+	// response to SIGINT or SIGTERM. gcsfuse still shuts down cleanly.
+	ExitCodeUnmountedExternally = 5
+)
+
+// exitError is an error that makes gcsfuse exit with a specific status
+// instead of 1.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string {
+	return e.err.Error()
+}
+
+func (e *exitError) Unwrap() error {
+	return e.err
+}
+
+// exitCode returns the status gcsfuse should exit with for err.
+func exitCode(err error) int {
+	var exitErr *exitError
+	if errors.As(err, &exitErr) {
+		return exitErr.code
+	}
+	return 1
+}
+
+// externalUnmountError is the error gcsfuse exits with once the file system
+// on mountPoint has been unmounted by another process.
+func externalUnmountError(mountPoint string) error {
+	return &exitError{
+		code: ExitCodeUnmountedExternally,
+		err:  fmt.Errorf("%s was unmounted by another process", mountPoint),
+	}
+}
+
+// checkMountPoint fails if mounting on mountPoint would stack on top of a
+// FUSE mount, e.g. a live or stale gcsfuse mount, unless allowRemount is set,
+// in which case that mount is lazily unmounted with unmount. It then fails if
+// the mount point has entries that the mount would hide, unless nonEmpty is
+// set.
+//
+// mounts are the mounts seen by this process. Problems with the mount point
+// itself, e.g. it not existing, are left to the mount to report.
+func checkMountPoint(
+	mountPoint string,
+	nonEmpty bool,
+	allowRemount bool,
+	mounts []mountpkg.MountInfo,
+	unmount func(string) error) error {
+	if m := mountpkg.FindMount(mounts, mountPoint); m != nil && m.IsFuse() {
+		if !allowRemount {
+			return &exitError{
+				code: ExitCodeMountPointIsMounted,
+				err: fmt.Errorf("mount point %s is already a %s mount of %q; unmount it first, or pass --allow-remount to replace it",
+					mountPoint, m.FSType, m.Source),
+			}
+		}
+
+		logger.Infof("Lazily unmounting the %s mount of %q on %s, as --allow-remount is set", m.FSType, m.Source, mountPoint)
+		if err := unmount(mountPoint); err != nil {
+			return fmt.Errorf("replacing the existing mount: %w", err)
+		}
+	}
+
+	if nonEmpty {
+		return nil
+	}
+
+	f, err := os.Open(mountPoint)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	// io.EOF means that it's empty.
+	if _, err = f.Readdirnames(1); err != nil {
+		return nil
+	}
+
+	return &exitError{
+		code: ExitCodeMountPointNotEmpty,
+		err:  fmt.Errorf("mount point %s is not empty; pass --nonempty to mount over its contents", mountPoint),
+	}
+}
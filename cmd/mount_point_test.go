@@ -0,0 +1,144 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"testing"
+
+	mountpkg "github.com/googlecloudplatform/gcsfuse/v2/internal/mount"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+func TestMountPoint(t *testing.T) { suite.Run(t, new(MountPointTest)) }
+
+////////////////////////////////////////////////////////////////////////
+// Boilerplate
+////////////////////////////////////////////////////////////////////////
+
+type MountPointTest struct {
+	suite.Suite
+	dir        string
+	unmounted  []string
+	unmountErr error
+}
+
+func (t *MountPointTest) SetupTest() {
+	t.dir = t.T().TempDir()
+	t.unmounted = nil
+	t.unmountErr = nil
+}
+
+func (t *MountPointTest) unmount(dir string) error {
+	t.unmounted = append(t.unmounted, dir)
+	return t.unmountErr
+}
+
+func (t *MountPointTest) mountsOnDir(fsType string) []mountpkg.MountInfo {
+	return []mountpkg.MountInfo{
+		{ID: 1, MountPoint: "/", FSType: "ext4", Source: "/dev/sda1"},
+		{ID: 2, ParentID: 1, MountPoint: t.dir, FSType: fsType, Source: "some-bucket"},
+	}
+}
+
+func (t *MountPointTest) check(nonEmpty, allowRemount bool, mounts []mountpkg.MountInfo) error {
+	return checkMountPoint(t.dir, nonEmpty, allowRemount, mounts, t.unmount)
+}
+
+////////////////////////////////////////////////////////////////////////
+// Tests
+////////////////////////////////////////////////////////////////////////
+
+func (t *MountPointTest) TestEmptyDirectory() {
+	assert.NoError(t.T(), t.check(false, false, nil))
+}
+
+func (t *MountPointTest) TestNonExistentDirectoryIsLeftToTheMount() {
+	err := checkMountPoint(path.Join(t.dir, "foo"), false, false, nil, t.unmount)
+
+	assert.NoError(t.T(), err)
+}
+
+func (t *MountPointTest) TestNonEmptyDirectory() {
+	assert.NoError(t.T(), os.WriteFile(path.Join(t.dir, "foo"), nil, 0600))
+
+	err := t.check(false, false, nil)
+
+	assert.ErrorContains(t.T(), err, "is not empty; pass --nonempty")
+	assert.Equal(t.T(), ExitCodeMountPointNotEmpty, exitCode(err))
+}
+
+func (t *MountPointTest) TestNonEmptyDirectoryWithNonEmpty() {
+	assert.NoError(t.T(), os.WriteFile(path.Join(t.dir, "foo"), nil, 0600))
+
+	assert.NoError(t.T(), t.check(true, false, nil))
+}
+
+func (t *MountPointTest) TestFuseMount() {
+	err := t.check(true, false, t.mountsOnDir("fuse.gcsfuse"))
+
+	assert.ErrorContains(t.T(), err, fmt.Sprintf(`mount point %s is already a fuse.gcsfuse mount of "some-bucket"`, t.dir))
+	assert.Equal(t.T(), ExitCodeMountPointIsMounted, exitCode(err))
+	assert.Empty(t.T(), t.unmounted)
+}
+
+func (t *MountPointTest) TestFuseMountWithAllowRemount() {
+	err := t.check(false, true, t.mountsOnDir("fuse"))
+
+	assert.NoError(t.T(), err)
+	assert.Equal(t.T(), []string{t.dir}, t.unmounted)
+}
+
+func (t *MountPointTest) TestFuseMountWithAllowRemountOverNonEmptyDirectory() {
+	// What the stale mount was hiding.
+	assert.NoError(t.T(), os.WriteFile(path.Join(t.dir, "foo"), nil, 0600))
+
+	err := t.check(false, true, t.mountsOnDir("fuse.gcsfuse"))
+
+	assert.Equal(t.T(), []string{t.dir}, t.unmounted)
+	assert.Equal(t.T(), ExitCodeMountPointNotEmpty, exitCode(err))
+}
+
+func (t *MountPointTest) TestUnmountFails() {
+	t.unmountErr = errors.New("taco")
+
+	err := t.check(false, true, t.mountsOnDir("fuse.gcsfuse"))
+
+	assert.ErrorContains(t.T(), err, "replacing the existing mount: taco")
+	assert.Equal(t.T(), 1, exitCode(err))
+}
+
+func (t *MountPointTest) TestOtherMountIsIgnored() {
+	assert.NoError(t.T(), t.check(false, false, t.mountsOnDir("tmpfs")))
+	assert.Empty(t.T(), t.unmounted)
+}
+
+func (t *MountPointTest) TestExitCodeOfWrappedError() {
+	err := fmt.Errorf("mounting: %w", &exitError{code: 42, err: errors.New("taco")})
+
+	assert.Equal(t.T(), 42, exitCode(err))
+	assert.Equal(t.T(), 1, exitCode(errors.New("taco")))
+}
+
+func (t *MountPointTest) TestExternalUnmountError() {
+	err := externalUnmountError("/mnt/taco")
+
+	assert.ErrorContains(t.T(), err, "/mnt/taco was unmounted by another process")
+	assert.Equal(t.T(), ExitCodeUnmountedExternally, exitCode(err))
+}
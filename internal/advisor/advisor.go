@@ -0,0 +1,231 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package advisor spots access patterns that gcsfuse serves poorly, from what
+// file handles were used for, and advises once per pattern on the setting that
+// would help.
+package advisor
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/monitor"
+	"golang.org/x/net/context"
+)
+
+// Pattern names an access pattern the Detector advises on.
+type Pattern string
+
+const (
+	// RandomReads are reads of a file mostly at other offsets than where the
+	// previous read ended, each of which GCS serves with a new request.
+	RandomReads Pattern = "random-reads"
+
+	// SmallWrites are writes of a file mostly shorter than SmallWriteSize.
+	SmallWrites Pattern = "small-writes"
+
+	// ReDownloads are reads of a file that fetch its object from GCS more
+	// than ReDownloadRatio times over.
+	ReDownloads Pattern = "re-downloads"
+)
+
+// Patterns are all the patterns the Detector advises on.
+var Patterns = []Pattern{RandomReads, SmallWrites, ReDownloads}
+
+const (
+	// MinOps is the number of reads, or writes, below which a handle isn't
+	// looked at for a pattern of them.
+	MinOps = 100
+
+	// RandomReadRatio is the share of random reads above which a handle reads
+	// randomly.
+	RandomReadRatio = 0.5
+
+	// SmallWriteSize and SmallWriteRatio: a handle writes small if more than
+	// SmallWriteRatio of its writes are shorter than SmallWriteSize.
+	SmallWriteSize  = 4 << 10
+	SmallWriteRatio = 0.5
+
+	// ReDownloadRatio is the number of times over an object fetched from GCS
+	// for a handle at which it is re-downloaded.
+	ReDownloadRatio = 2
+
+	// Component is the component name carried by the advisories.
+	Component = "advisor"
+)
+
+// Stats counts what a file handle has been used for.
+type Stats struct {
+	// The size of the object read, if any.
+	ObjectSize uint64
+
+	Reads       uint64
+	RandomReads uint64
+
+	// The number of bytes read that were fetched from GCS rather than served
+	// by the file cache.
+	BytesFromGCS uint64
+
+	Writes      uint64
+	SmallWrites uint64
+
+	// The offset at which the last read ended.
+	lastReadEnd int64
+}
+
+// RecordRead counts a read of n bytes at offset, fetched from GCS if fromGCS
+// is set, of an object of the given size, or of local contents if it's zero.
+func (s *Stats) RecordRead(offset int64, n int, fromGCS bool, objectSize uint64) {
+	if s.Reads > 0 && offset != s.lastReadEnd {
+		s.RandomReads++
+	}
+	s.Reads++
+	s.lastReadEnd = offset + int64(n)
+
+	if objectSize != 0 {
+		s.ObjectSize = objectSize
+	}
+	if fromGCS {
+		s.BytesFromGCS += uint64(n)
+	}
+}
+
+// RecordWrite counts a write of n bytes.
+func (s *Stats) RecordWrite(n int) {
+	s.Writes++
+	if n < SmallWriteSize {
+		s.SmallWrites++
+	}
+}
+
+// Config describes the mount the Detector advises on.
+type Config struct {
+	FileCacheEnabled      bool
+	CacheFileForRangeRead bool
+
+	// The patterns not to advise on.
+	Disabled []Pattern
+}
+
+// Advisory is advice on a pattern seen for an object.
+type Advisory struct {
+	Pattern Pattern
+	Object  string
+
+	// What was seen, and the setting that would help.
+	Detail string
+	Knob   string
+}
+
+// Detector advises on the patterns in the Stats of handles, once per pattern.
+// It is safe for concurrent access.
+type Detector struct {
+	config   Config
+	disabled map[Pattern]bool
+	logger   *slog.Logger
+
+	mu sync.Mutex
+
+	// The patterns already advised on.
+	//
+	// GUARDED_BY(mu)
+	advised map[Pattern]bool
+}
+
+// NewDetector returns a Detector for a mount described by config, which logs
+// its advisories under the advisor component.
+func NewDetector(config Config) *Detector {
+	d := &Detector{
+		config:   config,
+		disabled: make(map[Pattern]bool),
+		logger:   logger.NewComponentLogger(Component),
+		advised:  make(map[Pattern]bool),
+	}
+	for _, p := range config.Disabled {
+		d.disabled[p] = true
+	}
+
+	return d
+}
+
+// Observe looks for patterns in the stats of a handle on the named object, and
+// logs and counts an advisory for each not advised on before. It returns the
+// advisories.
+func (d *Detector) Observe(ctx context.Context, object string, s Stats) (advisories []Advisory) {
+	for _, a := range d.detect(object, s) {
+		if d.disabled[a.Pattern] || !d.markAdvised(a.Pattern) {
+			continue
+		}
+
+		d.logger.Warn(
+			"Access pattern served poorly",
+			"pattern", string(a.Pattern),
+			"object", a.Object,
+			"detail", a.Detail,
+			"knob", a.Knob)
+		monitor.CaptureAdvisoryMetrics(ctx, string(a.Pattern))
+		advisories = append(advisories, a)
+	}
+
+	return
+}
+
+// markAdvised records that p has been advised on, returning false if it
+// already had been.
+//
+// LOCKS_EXCLUDED(d.mu)
+func (d *Detector) markAdvised(p Pattern) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.advised[p] {
+		return false
+	}
+	d.advised[p] = true
+	return true
+}
+
+func (d *Detector) detect(object string, s Stats) (advisories []Advisory) {
+	if s.Reads >= MinOps && float64(s.RandomReads) > RandomReadRatio*float64(s.Reads) {
+		detail := fmt.Sprintf("%d of %d reads were random", s.RandomReads, s.Reads)
+		switch {
+		case !d.config.FileCacheEnabled:
+			advisories = append(advisories, Advisory{RandomReads, object, detail,
+				"cache-dir and file-cache:cache-file-for-range-read, to serve them from the file cache"})
+		case !d.config.CacheFileForRangeRead:
+			advisories = append(advisories, Advisory{RandomReads, object, detail,
+				"file-cache:cache-file-for-range-read, to download the file into the file cache on a random read"})
+		}
+	}
+
+	if s.Writes >= MinOps && float64(s.SmallWrites) > SmallWriteRatio*float64(s.Writes) {
+		advisories = append(advisories, Advisory{SmallWrites, object,
+			fmt.Sprintf("%d of %d writes were shorter than %d bytes", s.SmallWrites, s.Writes, SmallWriteSize),
+			"buffering writes in the application, and --max-parallel-uploads to upload closed files in the background"})
+	}
+
+	if s.ObjectSize > 0 && s.BytesFromGCS >= ReDownloadRatio*s.ObjectSize {
+		detail := fmt.Sprintf("%d bytes of a %d byte object were fetched from GCS", s.BytesFromGCS, s.ObjectSize)
+		knob := "cache-dir, to serve reads from the file cache"
+		if d.config.FileCacheEnabled {
+			knob = "file-cache:max-size-mb, to keep the file in the file cache"
+		}
+		advisories = append(advisories, Advisory{ReDownloads, object, detail, knob})
+	}
+
+	return
+}
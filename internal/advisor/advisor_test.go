@@ -0,0 +1,230 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package advisor
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const objectSize = 1 << 30
+
+// Synthetic op streams.
+
+func sequentialReads(s *Stats, fromGCS bool) {
+	for i := 0; i < 2*MinOps; i++ {
+		s.RecordRead(int64(i)<<17, 1<<17, fromGCS, objectSize)
+	}
+}
+
+func randomReads(s *Stats, fromGCS bool) {
+	for i := 0; i < 2*MinOps; i++ {
+		// 4 KiB reads striding through the object.
+		s.RecordRead(int64(i*7919%1024)<<20, 4<<10, fromGCS, objectSize)
+	}
+}
+
+func smallAppends(s *Stats, n int) {
+	for i := 0; i < n; i++ {
+		s.RecordWrite(100)
+	}
+}
+
+func largeWrites(s *Stats) {
+	for i := 0; i < 2*MinOps; i++ {
+		s.RecordWrite(1 << 17)
+	}
+}
+
+func rereads(s *Stats, fromGCS bool) {
+	// Read the whole object in 64 MiB chunks three times over.
+	for pass := 0; pass < 3; pass++ {
+		for off := int64(0); off < objectSize; off += 64 << 20 {
+			s.RecordRead(off, 64<<20, fromGCS, objectSize)
+		}
+	}
+}
+
+func patterns(advisories []Advisory) (ps []Pattern) {
+	for _, a := range advisories {
+		ps = append(ps, a.Pattern)
+	}
+	return
+}
+
+func TestObserve(t *testing.T) {
+	testCases := []struct {
+		name     string
+		config   Config
+		ops      func(*Stats)
+		expected []Pattern
+		knob     string
+	}{
+		{
+			name:   "sequential reads",
+			config: Config{},
+			ops:    func(s *Stats) { sequentialReads(s, true) },
+		},
+		{
+			name:     "random reads without the file cache",
+			config:   Config{},
+			ops:      func(s *Stats) { randomReads(s, true) },
+			expected: []Pattern{RandomReads},
+			knob:     "cache-dir and file-cache:cache-file-for-range-read",
+		},
+		{
+			name:     "random reads without caching range reads",
+			config:   Config{FileCacheEnabled: true},
+			ops:      func(s *Stats) { randomReads(s, true) },
+			expected: []Pattern{RandomReads},
+			knob:     "file-cache:cache-file-for-range-read",
+		},
+		{
+			name:   "random reads from the file cache",
+			config: Config{FileCacheEnabled: true, CacheFileForRangeRead: true},
+			ops:    func(s *Stats) { randomReads(s, false) },
+		},
+		{
+			name:   "few random reads",
+			config: Config{},
+			ops: func(s *Stats) {
+				for i := 0; i < MinOps-1; i++ {
+					s.RecordRead(int64(i*7919%1024)<<20, 4<<10, true, objectSize)
+				}
+			},
+		},
+		{
+			name:     "small appends",
+			config:   Config{},
+			ops:      func(s *Stats) { smallAppends(s, 2*MinOps) },
+			expected: []Pattern{SmallWrites},
+			knob:     "--max-parallel-uploads",
+		},
+		{
+			name:   "few small appends",
+			config: Config{},
+			ops:    func(s *Stats) { smallAppends(s, MinOps-1) },
+		},
+		{
+			name:   "large writes",
+			config: Config{},
+			ops:    func(s *Stats) { largeWrites(s) },
+		},
+		{
+			name:     "re-downloads without the file cache",
+			config:   Config{},
+			ops:      func(s *Stats) { rereads(s, true) },
+			expected: []Pattern{ReDownloads},
+			knob:     "cache-dir",
+		},
+		{
+			name:     "re-downloads with the file cache",
+			config:   Config{FileCacheEnabled: true},
+			ops:      func(s *Stats) { rereads(s, true) },
+			expected: []Pattern{ReDownloads},
+			knob:     "file-cache:max-size-mb",
+		},
+		{
+			name:   "rereads from the file cache",
+			config: Config{FileCacheEnabled: true},
+			ops:    func(s *Stats) { rereads(s, false) },
+		},
+		{
+			name:   "reads of local contents",
+			config: Config{},
+			ops: func(s *Stats) {
+				for i := 0; i < 2*MinOps; i++ {
+					s.RecordRead(int64(i*7919%1024)<<20, 4<<10, false, 0)
+				}
+			},
+			// Random, but without the file cache to help.
+			expected: []Pattern{RandomReads},
+		},
+		{
+			name:   "random reads and small writes",
+			config: Config{},
+			ops: func(s *Stats) {
+				randomReads(s, true)
+				smallAppends(s, 2*MinOps)
+			},
+			expected: []Pattern{RandomReads, SmallWrites},
+		},
+		{
+			name:   "disabled",
+			config: Config{Disabled: []Pattern{RandomReads}},
+			ops: func(s *Stats) {
+				randomReads(s, true)
+				smallAppends(s, 2*MinOps)
+			},
+			expected: []Pattern{SmallWrites},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var s Stats
+			tc.ops(&s)
+			d := NewDetector(tc.config)
+
+			advisories := d.Observe(context.Background(), "foo", s)
+
+			assert.Equal(t, tc.expected, patterns(advisories))
+			for _, a := range advisories {
+				assert.Equal(t, "foo", a.Object)
+				assert.NotEmpty(t, a.Detail)
+				assert.Contains(t, a.Knob, tc.knob)
+			}
+		})
+	}
+}
+
+func TestObserve_AdvisesOncePerPattern(t *testing.T) {
+	d := NewDetector(Config{})
+	var random, small Stats
+	randomReads(&random, true)
+	smallAppends(&small, 2*MinOps)
+
+	assert.Equal(t, []Pattern{RandomReads}, patterns(d.Observe(context.Background(), "foo", random)))
+	assert.Empty(t, d.Observe(context.Background(), "bar", random))
+	// Other patterns are still advised on.
+	assert.Equal(t, []Pattern{SmallWrites}, patterns(d.Observe(context.Background(), "bar", small)))
+	assert.Empty(t, d.Observe(context.Background(), "foo", small))
+}
+
+func TestStats_RecordRead(t *testing.T) {
+	var s Stats
+
+	s.RecordRead(100, 10, true, 1000)
+	s.RecordRead(110, 10, false, 1000)
+	s.RecordRead(0, 10, true, 1000)
+	s.RecordRead(10, 10, false, 0)
+
+	assert.Equal(t, uint64(4), s.Reads)
+	assert.Equal(t, uint64(1), s.RandomReads)
+	assert.Equal(t, uint64(20), s.BytesFromGCS)
+	assert.Equal(t, uint64(1000), s.ObjectSize)
+}
+
+func TestStats_RecordWrite(t *testing.T) {
+	var s Stats
+
+	s.RecordWrite(SmallWriteSize - 1)
+	s.RecordWrite(SmallWriteSize)
+
+	assert.Equal(t, uint64(2), s.Writes)
+	assert.Equal(t, uint64(1), s.SmallWrites)
+}
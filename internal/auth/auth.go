@@ -16,8 +16,10 @@ package auth
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
+	"strings"
 
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
@@ -26,6 +28,62 @@ import (
 
 const universeDomainDefault = "googleapis.com"
 
+// The endpoints of the default universe credentials files name.
+const (
+	stsEndpointDefault            = "https://sts.googleapis.com/v1/token"
+	iamCredentialsEndpointDefault = "https://iamcredentials.googleapis.com/v1/"
+)
+
+// Universe is the universe domain tokens are fetched for, and the endpoints
+// they're fetched from in it. The zero value is whatever universe the
+// credentials are for, with the endpoints they name.
+type Universe struct {
+	// Domain, if set, is the universe domain credentials must be for.
+	Domain string
+
+	// OAuth2Token, if set, is the url service account keys and user
+	// credentials are exchanged for access tokens at.
+	OAuth2Token string
+
+	// STS, if set, replaces the default security token service endpoint of
+	// external account credentials.
+	STS string
+
+	// IAMCredentials, if set, replaces the default IAM credentials endpoint
+	// external account credentials impersonate service accounts through.
+	IAMCredentials string
+}
+
+// checkDomain returns an error if credentials for the given universe domain
+// can't be used in u.
+func (u Universe) checkDomain(domain string) error {
+	if u.Domain != "" && domain != u.Domain {
+		return fmt.Errorf("credentials are for universe domain %q, not %q", domain, u.Domain)
+	}
+	return nil
+}
+
+// rewriteExternalAccount points the external account credentials in contents
+// at the endpoints of u in place of the default ones. Other credentials are
+// returned as they are.
+func (u Universe) rewriteExternalAccount(contents []byte) ([]byte, error) {
+	var f map[string]any
+	if err := json.Unmarshal(contents, &f); err != nil {
+		return nil, fmt.Errorf("Unmarshal: %w", err)
+	}
+	if f["type"] != "external_account" {
+		return contents, nil
+	}
+
+	if tokenURL, _ := f["token_url"].(string); u.STS != "" && tokenURL == stsEndpointDefault {
+		f["token_url"] = u.STS
+	}
+	if url, _ := f["service_account_impersonation_url"].(string); u.IAMCredentials != "" && strings.HasPrefix(url, iamCredentialsEndpointDefault) {
+		f["service_account_impersonation_url"] = u.IAMCredentials + strings.TrimPrefix(url, iamCredentialsEndpointDefault)
+	}
+	return json.Marshal(f)
+}
+
 func getUniverseDomain(ctx context.Context, contents []byte, scope string) (string, error) {
 	creds, err := google.CredentialsFromJSON(ctx, contents, scope)
 	if err != nil {
@@ -47,6 +105,7 @@ func newTokenSourceFromPath(
 	ctx context.Context,
 	path string,
 	scope string,
+	universe Universe,
 ) (ts oauth2.TokenSource, err error) {
 	// Read the file.
 	contents, err := os.ReadFile(path)
@@ -60,14 +119,22 @@ func newTokenSourceFromPath(
 	jwtConfig, err := google.JWTConfigFromJSON(contents, scope)
 	if err != nil {
 		err = fmt.Errorf("JWTConfigFromJSON: %w", err)
+		return
 	}
-	// Create the token source.
-	ts = jwtConfig.TokenSource(ctx)
 
 	domain, err := getUniverseDomain(ctx, contents, scope)
 	if err != nil {
 		return
 	}
+	if err = universe.checkDomain(domain); err != nil {
+		return
+	}
+
+	// Create the token source.
+	if universe.OAuth2Token != "" {
+		jwtConfig.TokenURL = universe.OAuth2Token
+	}
+	ts = jwtConfig.TokenSource(ctx)
 
 	// For non-GDU universe domains, token exchange is impossible and services
 	// must support self-signed JWTs with scopes.
@@ -83,29 +150,75 @@ func newTokenSourceFromPath(
 	return
 }
 
+// newDefaultTokenSource creates a token source from the application default
+// credentials, fetching tokens from the endpoints of the given universe.
+func newDefaultTokenSource(
+	ctx context.Context,
+	scope string,
+	universe Universe,
+) (ts oauth2.TokenSource, err error) {
+	params := google.CredentialsParams{
+		Scopes:   []string{scope},
+		TokenURL: universe.OAuth2Token,
+	}
+	creds, err := google.FindDefaultCredentialsWithParams(ctx, params)
+	if err != nil {
+		err = fmt.Errorf("FindDefaultCredentialsWithParams: %w", err)
+		return
+	}
+
+	if creds.JSON != nil && (universe.STS != "" || universe.IAMCredentials != "") {
+		var contents []byte
+		contents, err = universe.rewriteExternalAccount(creds.JSON)
+		if err != nil {
+			return
+		}
+		creds, err = google.CredentialsFromJSONWithParams(ctx, contents, params)
+		if err != nil {
+			err = fmt.Errorf("CredentialsFromJSONWithParams: %w", err)
+			return
+		}
+	}
+
+	domain, err := creds.GetUniverseDomain()
+	if err != nil {
+		err = fmt.Errorf("GetUniverseDomain(): %w", err)
+		return
+	}
+	if err = universe.checkDomain(domain); err != nil {
+		return
+	}
+
+	ts = creds.TokenSource
+	return
+}
+
 // GetTokenSource generates the token-source for GCS endpoint by following oauth2.0 authentication
 // for key-file and default-credential flow.
 // It also supports generating the self-signed JWT tokenSource for key-file authentication which can be
 // used by custom-endpoint(e.g. TPC).
+// Tokens are fetched from the endpoints of the given universe, and key-file and
+// default credentials for another universe domain are refused.
 func GetTokenSource(
 	ctx context.Context,
 	keyFile string,
 	tokenUrl string,
 	reuseTokenFromUrl bool,
+	universe Universe,
 ) (tokenSrc oauth2.TokenSource, err error) {
 	// Create the oauth2 token source.
 	const scope = storagev1.DevstorageFullControlScope
 	var method string
 
 	if keyFile != "" {
-		tokenSrc, err = newTokenSourceFromPath(ctx, keyFile, scope)
+		tokenSrc, err = newTokenSourceFromPath(ctx, keyFile, scope, universe)
 		method = "newTokenSourceFromPath"
 	} else if tokenUrl != "" {
 		tokenSrc, err = newProxyTokenSource(ctx, tokenUrl, reuseTokenFromUrl)
 		method = "newProxyTokenSource"
 	} else {
-		tokenSrc, err = google.DefaultTokenSource(ctx, scope)
-		method = "DefaultTokenSource"
+		tokenSrc, err = newDefaultTokenSource(ctx, scope, universe)
+		method = "newDefaultTokenSource"
 	}
 
 	if err != nil {
@@ -71,3 +71,38 @@ func (t *AuthTest) TestGetUniverseDomainForEmptyCreds() {
 	assert.Error(t.T(), err)
 	assert.Equal(t.T(), "CredentialsFromJSON(): unexpected end of JSON input", err.Error())
 }
+
+func (t *AuthTest) TestNewTokenSourceFromPathInUniverse() {
+	_, err := newTokenSourceFromPath(context.Background(), "testdata/google_creds.json", storagev1.DevstorageFullControlScope, Universe{Domain: universeDomainDefault, OAuth2Token: "https://oauth2-restricted.p.googleapis.com/token"})
+
+	assert.NoError(t.T(), err)
+}
+
+func (t *AuthTest) TestNewTokenSourceFromPathInOtherUniverse() {
+	_, err := newTokenSourceFromPath(context.Background(), "testdata/google_creds.json", storagev1.DevstorageFullControlScope, Universe{Domain: tpcUniverseDomain})
+
+	assert.ErrorContains(t.T(), err, "credentials are for universe domain \"googleapis.com\", not \"apis-tpclp.goog\"")
+}
+
+func (t *AuthTest) TestRewriteExternalAccount() {
+	universe := Universe{
+		STS:            "https://sts-restricted.p.googleapis.com/v1/token",
+		IAMCredentials: "https://iamcredentials-restricted.p.googleapis.com/v1/",
+	}
+	contents := []byte(`{"type": "external_account", "token_url": "https://sts.googleapis.com/v1/token", "service_account_impersonation_url": "https://iamcredentials.googleapis.com/v1/projects/-/serviceAccounts/sa:generateAccessToken"}`)
+
+	rewritten, err := universe.rewriteExternalAccount(contents)
+
+	assert.NoError(t.T(), err)
+	assert.JSONEq(t.T(), `{"type": "external_account", "token_url": "https://sts-restricted.p.googleapis.com/v1/token", "service_account_impersonation_url": "https://iamcredentials-restricted.p.googleapis.com/v1/projects/-/serviceAccounts/sa:generateAccessToken"}`, string(rewritten))
+}
+
+func (t *AuthTest) TestRewriteExternalAccountLeavesOtherCredentials() {
+	universe := Universe{STS: "https://sts-restricted.p.googleapis.com/v1/token"}
+	contents := []byte(`{"type": "service_account", "token_url": "https://sts.googleapis.com/v1/token"}`)
+
+	rewritten, err := universe.rewriteExternalAccount(contents)
+
+	assert.NoError(t.T(), err)
+	assert.Equal(t.T(), contents, rewritten)
+}
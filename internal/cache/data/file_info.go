@@ -18,6 +18,7 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"sync/atomic"
 	"time"
 )
 
@@ -48,12 +49,58 @@ type FileInfo struct {
 	ObjectGeneration int64
 	Offset           uint64
 	FileSize         uint64
+
+	// CRC32C of the object, if known. Used to check the file in cache once it
+	// is completely downloaded.
+	CRC32C *uint32
+
+	// CacheDir is the cache directory holding the file, when the cache is
+	// spread across several.
+	CacheDir string
+
+	// Usage tracks the reads of the file, for the entries of files downloaded
+	// by this process. Nil otherwise.
+	Usage *EntryUsage
 }
 
 func (fi FileInfo) Size() uint64 {
 	return fi.FileSize
 }
 
+// EntryUsage tracks how far a file in cache has been read, so that the bytes
+// downloaded into it but never read can be told once it's evicted.
+//
+// Safe for concurrent access.
+type EntryUsage struct {
+	// The end of the furthest range read from the file.
+	readUpTo atomic.Uint64
+}
+
+// NoteRead notes that the file was read up to the offset end.
+func (u *EntryUsage) NoteRead(end uint64) {
+	for {
+		prev := u.readUpTo.Load()
+		if end <= prev || u.readUpTo.CompareAndSwap(prev, end) {
+			return
+		}
+	}
+}
+
+// ReadUpTo returns the end of the furthest range read from the file, which is
+// zero if it was never read.
+func (u *EntryUsage) ReadUpTo() uint64 {
+	return u.readUpTo.Load()
+}
+
+// SharedEntry describes a completely downloaded file in a cache shared by
+// several gcsfuse processes, for the processes other than the one owning it.
+type SharedEntry struct {
+	Key              FileInfoKey
+	ObjectGeneration int64
+	FileSize         uint64
+	CRC32C           *uint32
+}
+
 type FileSpec struct {
 	Path     string
 	FilePerm os.FileMode
@@ -0,0 +1,180 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+import (
+	"errors"
+	"os"
+	"syscall"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/data"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/util"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
+)
+
+// CacheDir is one of the directories that the files in the cache are spread
+// across.
+type CacheDir struct {
+	Path string
+
+	// Weight is the share of new files placed in the directory, relative to
+	// the weights of the others. If no directory has a weight, new files go to
+	// the directory with the most free space.
+	Weight int64
+}
+
+// cacheDirState tracks the use of a CacheDir.
+type cacheDirState struct {
+	CacheDir
+
+	// usage is the sum of the sizes of the entries in the file info cache whose
+	// files are in the directory.
+	usage uint64
+
+	// failed is set once the directory is found to be unusable, e.g. because
+	// its device failed. No files are placed in it after that.
+	failed bool
+
+	// flat is set while the directory may hold files in util.FlatLayout, left by
+	// earlier versions of gcsfuse, until they have been migrated.
+	flat bool
+}
+
+// isUsableDir returns true if the given path is a directory, creating it with
+// the given permissions if it was removed.
+func isUsableDir(dirPath string, dirPerm os.FileMode) bool {
+	return os.MkdirAll(dirPath, dirPerm) == nil
+}
+
+// freeSpace returns the number of bytes available to unprivileged users in
+// the file system holding the given directory.
+func freeSpace(dirPath string) (uint64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dirPath, &st); err != nil {
+		return 0, err
+	}
+	return st.Bavail * uint64(st.Bsize), nil
+}
+
+// cacheDirOf returns the directory holding the file for the given entry.
+// Entries that don't record one are in the first directory.
+func (chr *CacheHandler) cacheDirOf(fileInfo *data.FileInfo) string {
+	if fileInfo.CacheDir == "" {
+		return chr.cacheDir
+	}
+	return fileInfo.CacheDir
+}
+
+// cacheDirState returns the state of the cache directory with the given path,
+// or nil if there is none.
+func (chr *CacheHandler) cacheDirState(dirPath string) *cacheDirState {
+	for _, d := range chr.cacheDirs {
+		if d.Path == dirPath {
+			return d
+		}
+	}
+	return nil
+}
+
+// placeFile picks the directory for the file of a new entry of the given size
+// and adds the entry to its usage. Directories found to be unusable on the
+// way are failed.
+//
+// Requires Lock(chr.mu)
+func (chr *CacheHandler) placeFile(size uint64) (string, error) {
+	for {
+		var picked *cacheDirState
+		var best float64
+		for _, d := range chr.cacheDirs {
+			if d.failed {
+				continue
+			}
+
+			// Lower is better.
+			var score float64
+			if chr.placeByFreeSpace {
+				if !isUsableDir(d.Path, chr.dirPerm) {
+					chr.failCacheDir(d)
+					continue
+				}
+				free, err := freeSpace(d.Path)
+				if err != nil {
+					chr.failCacheDir(d)
+					continue
+				}
+				score = -float64(free)
+			} else {
+				score = float64(d.usage+size) / float64(d.Weight)
+			}
+			if picked == nil || score < best {
+				picked, best = d, score
+			}
+		}
+
+		if picked == nil {
+			return "", errors.New(util.NoUsableCacheDirErrMsg)
+		}
+		if !isUsableDir(picked.Path, chr.dirPerm) {
+			chr.failCacheDir(picked)
+			continue
+		}
+
+		picked.usage += size
+		return picked.Path, nil
+	}
+}
+
+// releaseFile removes the entry for the given file info from the usage of
+// its directory.
+//
+// Requires Lock(chr.mu)
+func (chr *CacheHandler) releaseFile(fileInfo *data.FileInfo) {
+	d := chr.cacheDirState(chr.cacheDirOf(fileInfo))
+	if d == nil {
+		return
+	}
+	if d.usage < fileInfo.FileSize {
+		d.usage = 0
+		return
+	}
+	d.usage -= fileInfo.FileSize
+}
+
+// failCacheDir stops placing files in the given directory, and removes the
+// entries for the files in it from the file info cache. The files themselves
+// are left alone, as the directory is unusable.
+//
+// Requires Lock(chr.mu)
+func (chr *CacheHandler) failCacheDir(d *cacheDirState) {
+	logger.Errorf("File cache directory %s is unusable, evicting its files from the cache and continuing without it", d.Path)
+	d.failed = true
+	d.usage = 0
+
+	for _, key := range chr.fileInfoCache.Keys() {
+		val := chr.fileInfoCache.LookUpWithoutChangingOrder(key)
+		if val == nil {
+			continue
+		}
+		fileInfo := val.(data.FileInfo)
+		if chr.cacheDirOf(&fileInfo) != d.Path {
+			continue
+		}
+
+		chr.fileInfoCache.Erase(key)
+		chr.dropPin(&fileInfo)
+		chr.jobManager.InvalidateAndRemoveJob(fileInfo.Key.ObjectName, fileInfo.Key.BucketName)
+		captureWastedBytes(&fileInfo)
+	}
+}
@@ -0,0 +1,240 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/data"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/file/downloader"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/lru"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/util"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/locker"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	. "github.com/jacobsa/oglematchers"
+	. "github.com/jacobsa/ogletest"
+)
+
+const (
+	cacheDirsTestObjectCount = 6
+	cacheDirsTestObjectSize  = 1024
+)
+
+func TestCacheDirs(t *testing.T) { RunTests(t) }
+
+type cacheDirsTest struct {
+	fakeStorage  storage.FakeStorage
+	bucket       gcs.Bucket
+	objects      []*gcs.MinObject
+	cache        *lru.Cache
+	cacheHandler *CacheHandler
+	dirs         []string
+}
+
+func init() { RegisterTestSuite(&cacheDirsTest{}) }
+
+func (t *cacheDirsTest) SetUp(*TestInfo) {
+	locker.EnableInvariantsCheck()
+	t.dirs = nil
+	for i := 0; i < 2; i++ {
+		dir, err := os.MkdirTemp("", "cache_dirs_test")
+		AssertEq(nil, err)
+		t.dirs = append(t.dirs, dir)
+	}
+
+	t.fakeStorage = storage.NewFakeStorage()
+	t.bucket = t.fakeStorage.CreateStorageHandle().BucketHandle(storage.TestBucketName, "")
+	ctx := context.Background()
+	objects := make(map[string][]byte)
+	for i := 0; i < cacheDirsTestObjectCount; i++ {
+		objects[fmt.Sprintf("object%d", i)] = make([]byte, cacheDirsTestObjectSize)
+	}
+	err := storageutil.CreateObjects(ctx, t.bucket, objects)
+	AssertEq(nil, err)
+	t.objects = nil
+	for i := 0; i < cacheDirsTestObjectCount; i++ {
+		object, _, err := t.bucket.StatObject(ctx, &gcs.StatObjectRequest{Name: fmt.Sprintf("object%d", i), ForceFetchFromGcs: true})
+		AssertEq(nil, err)
+		t.objects = append(t.objects, object)
+	}
+
+	t.cache = lru.NewCache(cacheDirsTestObjectCount * cacheDirsTestObjectSize)
+	t.createCacheHandler(2, 1)
+}
+
+func (t *cacheDirsTest) TearDown() {
+	_ = t.cacheHandler.Destroy()
+	t.fakeStorage.ShutDown()
+	for _, dir := range t.dirs {
+		_ = os.RemoveAll(dir)
+	}
+}
+
+// createCacheHandler replaces the cache handler with one spreading the cache
+// across the test directories with the given weights.
+func (t *cacheDirsTest) createCacheHandler(weights ...int64) {
+	if t.cacheHandler != nil {
+		AssertEq(nil, t.cacheHandler.Destroy())
+	}
+
+	var cacheDirs []CacheDir
+	for i, dir := range t.dirs {
+		cacheDirs = append(cacheDirs, CacheDir{Path: dir, Weight: weights[i]})
+	}
+	jobManager := downloader.NewJobManager(t.cache, util.DefaultFilePerm, util.DefaultDirPerm, t.dirs[0], DefaultSequentialReadSizeMb)
+	t.cacheHandler = NewCacheHandlerWithDirs(t.cache, jobManager, cacheDirs, util.DefaultFilePerm, util.DefaultDirPerm)
+}
+
+// failDir makes the given test directory unusable, by replacing it with a
+// file.
+func (t *cacheDirsTest) failDir(dir string) {
+	AssertEq(nil, os.RemoveAll(dir))
+	AssertEq(nil, os.WriteFile(dir, nil, util.DefaultFilePerm))
+}
+
+// add adds an entry for the given object to the cache, without reading it.
+func (t *cacheDirsTest) add(object *gcs.MinObject) error {
+	cacheHandle, err := t.cacheHandler.GetCacheHandle(object, t.bucket, false, 0)
+	if err != nil {
+		return err
+	}
+	return cacheHandle.Close()
+}
+
+func (t *cacheDirsTest) fileInfo(object *gcs.MinObject) *data.FileInfo {
+	key, err := data.FileInfoKey{BucketName: t.bucket.Name(), ObjectName: object.Name}.Key()
+	AssertEq(nil, err)
+	val := t.cache.LookUpWithoutChangingOrder(key)
+	if val == nil {
+		return nil
+	}
+	fileInfo := val.(data.FileInfo)
+	return &fileInfo
+}
+
+////////////////////////////////////////////////////////////////////////
+// Tests
+////////////////////////////////////////////////////////////////////////
+
+func (t *cacheDirsTest) Test_Place_ByWeight() {
+	for _, object := range t.objects {
+		AssertEq(nil, t.add(object))
+	}
+
+	counts := make(map[string]int)
+	for _, object := range t.objects {
+		fileInfo := t.fileInfo(object)
+		AssertNe(nil, fileInfo)
+		counts[fileInfo.CacheDir]++
+	}
+	ExpectEq(4, counts[t.dirs[0]])
+	ExpectEq(2, counts[t.dirs[1]])
+	ExpectEq(4*cacheDirsTestObjectSize, t.cacheHandler.cacheDirState(t.dirs[0]).usage)
+	ExpectEq(2*cacheDirsTestObjectSize, t.cacheHandler.cacheDirState(t.dirs[1]).usage)
+}
+
+func (t *cacheDirsTest) Test_Place_ByFreeSpace() {
+	t.createCacheHandler(0, 0)
+	AssertTrue(t.cacheHandler.placeByFreeSpace)
+
+	AssertEq(nil, t.add(t.objects[0]))
+
+	fileInfo := t.fileInfo(t.objects[0])
+	AssertNe(nil, fileInfo)
+	ExpectThat(t.dirs, Contains(fileInfo.CacheDir))
+}
+
+func (t *cacheDirsTest) Test_Evict_ReleasesUsage() {
+	t.cache = lru.NewCache(cacheDirsTestObjectSize)
+	t.createCacheHandler(1, 1)
+
+	AssertEq(nil, t.add(t.objects[0]))
+	AssertEq(nil, t.add(t.objects[1]))
+
+	ExpectEq(nil, t.fileInfo(t.objects[0]))
+	ExpectEq(0, t.cacheHandler.cacheDirState(t.dirs[0]).usage)
+	ExpectEq(cacheDirsTestObjectSize, t.cacheHandler.cacheDirState(t.dirs[1]).usage)
+}
+
+func (t *cacheDirsTest) Test_FailedDir_EvictsItsFilesAndPlacesElsewhere() {
+	t.createCacheHandler(1, 1)
+	for _, object := range t.objects[:3] {
+		AssertEq(nil, t.add(object))
+	}
+	AssertEq(t.dirs[0], t.fileInfo(t.objects[0]).CacheDir)
+	AssertEq(t.dirs[1], t.fileInfo(t.objects[1]).CacheDir)
+	AssertEq(t.dirs[0], t.fileInfo(t.objects[2]).CacheDir)
+	t.failDir(t.dirs[0])
+
+	AssertEq(nil, t.add(t.objects[0]))
+
+	ExpectEq(t.dirs[1], t.fileInfo(t.objects[0]).CacheDir)
+	ExpectEq(t.dirs[1], t.fileInfo(t.objects[1]).CacheDir)
+	ExpectEq(nil, t.fileInfo(t.objects[2]))
+	ExpectTrue(t.cacheHandler.cacheDirState(t.dirs[0]).failed)
+	// New files only go to the directory left.
+	AssertEq(nil, t.add(t.objects[3]))
+	ExpectEq(t.dirs[1], t.fileInfo(t.objects[3]).CacheDir)
+}
+
+func (t *cacheDirsTest) Test_RemovedDir_IsCreatedAgain() {
+	t.createCacheHandler(1, 1)
+	AssertEq(nil, os.RemoveAll(t.dirs[0]))
+
+	AssertEq(nil, t.add(t.objects[0]))
+
+	ExpectEq(t.dirs[0], t.fileInfo(t.objects[0]).CacheDir)
+	ExpectFalse(t.cacheHandler.cacheDirState(t.dirs[0]).failed)
+}
+
+func (t *cacheDirsTest) Test_AllDirsFailed() {
+	for _, dir := range t.dirs {
+		t.failDir(dir)
+	}
+
+	err := t.add(t.objects[0])
+
+	AssertNe(nil, err)
+	ExpectTrue(strings.Contains(err.Error(), util.NoUsableCacheDirErrMsg))
+	ExpectEq(nil, t.fileInfo(t.objects[0]))
+}
+
+func (t *cacheDirsTest) Test_Download_KeepsCacheDir() {
+	t.createCacheHandler(1, 3)
+	object := t.objects[0]
+	cacheHandle, err := t.cacheHandler.GetCacheHandle(object, t.bucket, false, 0)
+	AssertEq(nil, err)
+	defer cacheHandle.Close()
+
+	dst := make([]byte, object.Size)
+	_, _, err = cacheHandle.Read(context.Background(), t.bucket, object, 0, dst)
+	AssertEq(nil, err)
+	for t.fileInfo(object).Offset < object.Size {
+		time.Sleep(time.Millisecond)
+	}
+
+	ExpectEq(t.dirs[1], t.fileInfo(object).CacheDir)
+	_, err = os.Stat(util.GetDownloadPath(t.dirs[1], util.GetObjectPath(t.bucket.Name(), object.Name)))
+	ExpectEq(nil, err)
+	_, err = os.Stat(util.GetDownloadPath(t.dirs[0], util.GetObjectPath(t.bucket.Name(), object.Name)))
+	ExpectTrue(os.IsNotExist(err))
+}
@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"sync/atomic"
 
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/data"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/file/downloader"
@@ -50,6 +51,25 @@ type CacheHandle struct {
 	// prevOffset stores the offset of previous cache handle read call. This is used
 	// to decide the type of read.
 	prevOffset int64
+
+	// hits, if non-nil, is incremented for every read served from the cache.
+	hits *atomic.Uint64
+
+	// reportDiskError, if non-nil, is called when a read fails because the
+	// disk holding the cache failed or filled up, e.g. while the download job
+	// was writing the file.
+	reportDiskError func(err error)
+
+	// shared is set if the file is in a cache owned by another gcsfuse process,
+	// and so has no entry in fileInfoCache. Reads check the file in cache
+	// against the object instead.
+	shared bool
+
+	// pin, if non-nil, pins the generation of the object read through the
+	// handle, and unpin releases it on Close. Once the entry is superseded,
+	// reads no longer look it up in fileInfoCache.
+	pin   *entryPin
+	unpin func()
 }
 
 func NewCacheHandle(localFileHandle *os.File, fileDownloadJob *downloader.Job,
@@ -97,13 +117,20 @@ func (fch *CacheHandle) shouldReadFromCache(jobStatus *downloader.JobStatus, req
 // Whether to change the order in cache while lookup is controlled via
 // changeCacheOrder.
 func (fch *CacheHandle) validateEntryInFileInfoCache(bucket gcs.Bucket, object *gcs.MinObject, requiredOffset uint64, changeCacheOrder bool) error {
+	_, err := fch.lookUpValidEntry(bucket, object, requiredOffset, changeCacheOrder)
+	return err
+}
+
+// lookUpValidEntry is like validateEntryInFileInfoCache, but also returns the
+// entry.
+func (fch *CacheHandle) lookUpValidEntry(bucket gcs.Bucket, object *gcs.MinObject, requiredOffset uint64, changeCacheOrder bool) (data.FileInfo, error) {
 	fileInfoKey := data.FileInfoKey{
 		BucketName: bucket.Name(),
 		ObjectName: object.Name,
 	}
 	fileInfoKeyName, err := fileInfoKey.Key()
 	if err != nil {
-		return fmt.Errorf("error while creating key for bucket %s and object %s: %w", bucket.Name(), object.Name, err)
+		return data.FileInfo{}, fmt.Errorf("error while creating key for bucket %s and object %s: %w", bucket.Name(), object.Name, err)
 	}
 
 	var fileInfo lru.ValueType
@@ -114,7 +141,7 @@ func (fch *CacheHandle) validateEntryInFileInfoCache(bucket gcs.Bucket, object *
 	}
 	if fileInfo == nil {
 		err = fmt.Errorf("%v: no entry found in file info cache for key %v", util.InvalidFileInfoCacheErrMsg, fileInfoKeyName)
-		return err
+		return data.FileInfo{}, err
 	}
 
 	// The generation check below is required because it may happen that file
@@ -123,14 +150,14 @@ func (fch *CacheHandle) validateEntryInFileInfoCache(bucket gcs.Bucket, object *
 	fileInfoData := fileInfo.(data.FileInfo)
 	if fileInfoData.ObjectGeneration != object.Generation {
 		err = fmt.Errorf("%v: generation of cached object: %v is different from required generation: %v", util.InvalidFileInfoCacheErrMsg, fileInfoData.ObjectGeneration, object.Generation)
-		return err
+		return data.FileInfo{}, err
 	}
 	if fileInfoData.Offset < requiredOffset {
 		err = fmt.Errorf("%v offset of cached object: %v is less than required offset %v", util.InvalidFileInfoCacheErrMsg, fileInfoData.Offset, requiredOffset)
-		return err
+		return data.FileInfo{}, err
 	}
 
-	return nil
+	return fileInfoData, nil
 }
 
 // Read attempts to read the data from the cached location.
@@ -139,6 +166,12 @@ func (fch *CacheHandle) validateEntryInFileInfoCache(bucket gcs.Bucket, object *
 // download. Additionally, for random reads, the download will not be
 // initiated if fch.cacheFileForRangeRead is false.
 func (fch *CacheHandle) Read(ctx context.Context, bucket gcs.Bucket, object *gcs.MinObject, offset int64, dst []byte) (n int, cacheHit bool, err error) {
+	defer func() {
+		if err != nil && fch.reportDiskError != nil && isDiskError(err) {
+			fch.reportDiskError(err)
+		}
+	}()
+
 	err = fch.validateCacheHandle()
 	if err != nil {
 		return
@@ -200,9 +233,11 @@ func (fch *CacheHandle) Read(ctx context.Context, bucket gcs.Bucket, object *gcs
 		// If fileDownloadJob is nil then it means either the job is successfully
 		// completed or failed. The offset must be equal to size of object for job
 		// to be completed.
-		err = fch.validateEntryInFileInfoCache(bucket, object, object.Size, false)
-		if err != nil {
-			return 0, false, err
+		if !fch.shared && !fch.superseded() {
+			err = fch.validateEntryInFileInfoCache(bucket, object, object.Size, false)
+			if err != nil {
+				return 0, false, err
+			}
 		}
 		cacheHit = true
 	}
@@ -230,15 +265,35 @@ func (fch *CacheHandle) Read(ctx context.Context, bucket gcs.Bucket, object *gcs
 
 	// Look up of file being read in file info cache is required to update the LRU
 	// order on every read request from kernel i.e. with every read request from
-	// kernel, the file being read becomes most recently used.
-	err = fch.validateEntryInFileInfoCache(bucket, object, uint64(requiredOffset), true)
-	if err != nil {
-		return 0, false, err
+	// kernel, the file being read becomes most recently used. Files in a cache
+	// owned by another process are in that process's LRU instead.
+	if fch.superseded() {
+		if fch.pin.usage != nil {
+			fch.pin.usage.NoteRead(uint64(offset) + uint64(n))
+		}
+	} else if !fch.shared {
+		var fileInfo data.FileInfo
+		fileInfo, err = fch.lookUpValidEntry(bucket, object, uint64(requiredOffset), true)
+		if err != nil {
+			return 0, false, err
+		}
+		if fileInfo.Usage != nil {
+			fileInfo.Usage.NoteRead(uint64(offset) + uint64(n))
+		}
 	}
 
+	if cacheHit && fch.hits != nil {
+		fch.hits.Add(1)
+	}
 	return
 }
 
+// superseded returns true if the entry read through the handle has been
+// superseded by an entry for another generation of the object.
+func (fch *CacheHandle) superseded() bool {
+	return fch.pin != nil && fch.pin.superseded.Load()
+}
+
 // IsSequential returns true if the sequential read is being performed, false for
 // random read.
 func (fch *CacheHandle) IsSequential(currentOffset int64) bool {
@@ -266,6 +321,10 @@ func (fch *CacheHandle) Close() (err error) {
 		}
 		fch.fileHandle = nil
 	}
+	if fch.unpin != nil {
+		fch.unpin()
+		fch.unpin = nil
+	}
 
 	return
 }
@@ -15,8 +15,10 @@
 package file
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"sync/atomic"
 
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/data"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/file/downloader"
@@ -24,7 +26,9 @@ import (
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/util"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/locker"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/monitor"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/jacobsa/timeutil"
 )
 
 // CacheHandler is responsible for creating CacheHandle and invalidating file cache
@@ -41,8 +45,23 @@ type CacheHandler struct {
 	jobManager *downloader.JobManager
 
 	// cacheDir is the local path which contains the cache data i.e. objects stored as file.
+	// If the cache is spread across several directories, it's the first one.
 	cacheDir string
 
+	// cacheDirs are the directories the cache is spread across, and how much of
+	// each is used.
+	//
+	// GUARDED_BY(mu)
+	cacheDirs []*cacheDirState
+
+	// placeByFreeSpace is set if no cache directory has a weight, in which case
+	// new files go to the one with the most free space.
+	placeByFreeSpace bool
+
+	// paths is the layout of the files in the cache directories, and of their
+	// data.SharedEntry.
+	paths util.PathResolver
+
 	// filePerm parameter specifies the permission of file in cache.
 	filePerm os.FileMode
 
@@ -51,22 +70,109 @@ type CacheHandler struct {
 
 	// mu guards the handling of insertion into and eviction from file cache.
 	mu locker.Locker
+
+	// hits counts the reads served from the cache, so that the scrubber can
+	// pause while the cache is busy.
+	hits atomic.Uint64
+
+	// stopScrubber stops the scrubber started by StartScrubber, if any.
+	stopScrubber func()
+
+	// migrateLayout is set by MigrateLayout.
+	//
+	// GUARDED_BY(mu)
+	migrateLayout bool
+
+	// stopLayoutMigration stops the migration of the files in util.FlatLayout,
+	// once started.
+	//
+	// GUARDED_BY(mu)
+	stopLayoutMigration func()
+
+	// health tracks the disk errors of the cache.
+	health cacheHealth
+
+	// lockFile is the lock file of the cache, if EnableSharing was called.
+	//
+	// GUARDED_BY(mu)
+	lockFile *os.File
+
+	// owner is set once this process holds the lock on lockFile.
+	//
+	// GUARDED_BY(mu)
+	owner bool
+
+	// readOnly is set by EnableReadOnly.
+	//
+	// GUARDED_BY(mu)
+	readOnly bool
+
+	// pins are the pins of the generations of objects read by CacheHandles,
+	// by the key of their entry in fileInfoCache.
+	//
+	// GUARDED_BY(mu)
+	pins map[string]*entryPin
+
+	// superseded are the pins of the entries replaced in fileInfoCache by
+	// entries for other generations while CacheHandles were reading them.
+	//
+	// GUARDED_BY(mu)
+	superseded map[*entryPin]bool
+
+	// supersededSize is the sum of the sizes of the files of the superseded
+	// entries, which fileInfoCache no longer accounts for.
+	//
+	// INVARIANT: supersededSize <= maxSupersededSize
+	//
+	// GUARDED_BY(mu)
+	supersededSize uint64
+
+	// maxSupersededSize is set by SetMaxSupersededSize.
+	//
+	// GUARDED_BY(mu)
+	maxSupersededSize uint64
+
+	// pinnedPrefixes and maxPinnedSize are set by SetPinnedPrefixes.
+	//
+	// GUARDED_BY(mu)
+	pinnedPrefixes []string
+	maxPinnedSize  uint64
 }
 
 func NewCacheHandler(fileInfoCache *lru.Cache, jobManager *downloader.JobManager, cacheDir string, filePerm os.FileMode, dirPerm os.FileMode) *CacheHandler {
-	return &CacheHandler{
-		fileInfoCache: fileInfoCache,
-		jobManager:    jobManager,
-		cacheDir:      cacheDir,
-		filePerm:      filePerm,
-		dirPerm:       dirPerm,
-		mu:            locker.New("FileCacheHandler", func() {}),
+	return NewCacheHandlerWithDirs(fileInfoCache, jobManager, []CacheDir{{Path: cacheDir, Weight: 1}}, filePerm, dirPerm)
+}
+
+// NewCacheHandlerWithDirs returns a CacheHandler that spreads the files in the
+// cache across the given directories, which must exist.
+//
+// REQUIRES: len(cacheDirs) > 0
+func NewCacheHandlerWithDirs(fileInfoCache *lru.Cache, jobManager *downloader.JobManager, cacheDirs []CacheDir, filePerm os.FileMode, dirPerm os.FileMode) *CacheHandler {
+	chr := &CacheHandler{
+		fileInfoCache:    fileInfoCache,
+		jobManager:       jobManager,
+		cacheDir:         cacheDirs[0].Path,
+		placeByFreeSpace: true,
+		paths:            util.ShardedLayout,
+		filePerm:         filePerm,
+		dirPerm:          dirPerm,
+		mu:               locker.New("FileCacheHandler", func() {}),
+		health:           cacheHealth{clock: timeutil.RealClock()},
+		pins:             make(map[string]*entryPin),
+		superseded:       make(map[*entryPin]bool),
+	}
+	for _, d := range cacheDirs {
+		chr.cacheDirs = append(chr.cacheDirs, &cacheDirState{CacheDir: d, flat: util.HasFlatLayout(d.Path)})
+		if d.Weight > 0 {
+			chr.placeByFreeSpace = false
+		}
 	}
+	return chr
 }
 
-func (chr *CacheHandler) createLocalFileReadHandle(objectName string, bucketName string) (*os.File, error) {
+func (chr *CacheHandler) createLocalFileReadHandle(cacheDir string, objectName string, bucketName string) (*os.File, error) {
 	fileSpec := data.FileSpec{
-		Path:     util.GetDownloadPath(chr.cacheDir, util.GetObjectPath(bucketName, objectName)),
+		Path:     chr.paths.DownloadPath(cacheDir, util.GetObjectPath(bucketName, objectName)),
 		FilePerm: chr.filePerm,
 		DirPerm:  chr.dirPerm,
 	}
@@ -77,6 +183,8 @@ func (chr *CacheHandler) createLocalFileReadHandle(objectName string, bucketName
 // cleanUpEvictedFile is a utility method called for the evicted/deleted fileInfo.
 // As part of execution, it (a) stops and removes the download job (b) truncates
 // and deletes the file in cache.
+//
+// Requires Lock(chr.mu)
 func (chr *CacheHandler) cleanUpEvictedFile(fileInfo *data.FileInfo) error {
 	key := fileInfo.Key
 	_, err := key.Key()
@@ -84,49 +192,86 @@ func (chr *CacheHandler) cleanUpEvictedFile(fileInfo *data.FileInfo) error {
 		return fmt.Errorf("cleanUpEvictedFile: while creating key: %w", err)
 	}
 
+	chr.releaseFile(fileInfo)
+	chr.dropPin(fileInfo)
 	chr.jobManager.InvalidateAndRemoveJob(key.ObjectName, key.BucketName)
+	captureWastedBytes(fileInfo)
+	chr.recordPinnedSize()
 
-	localFilePath := util.GetDownloadPath(chr.cacheDir, util.GetObjectPath(key.BucketName, key.ObjectName))
+	chr.removeSharedEntry(chr.cacheDirOf(fileInfo), util.GetObjectPath(key.BucketName, key.ObjectName))
+
+	localFilePath := chr.paths.DownloadPath(chr.cacheDirOf(fileInfo), util.GetObjectPath(key.BucketName, key.ObjectName))
+	err = removeFileInCache(localFilePath)
+	if err != nil {
+		return fmt.Errorf("cleanUpEvictedFile: %w", err)
+	}
+	return nil
+}
+
+// removeFileInCache truncates and deletes the file in cache at the given path.
+// A file that is already gone is only logged.
+func removeFileInCache(localFilePath string) error {
 	// Truncate the file to 0 size, so that even if there are open file handles
 	// and linux doesn't delete the file, the file will not take space.
-	err = os.Truncate(localFilePath, 0)
+	err := os.Truncate(localFilePath, 0)
 	if err != nil {
 		if os.IsNotExist(err) {
-			logger.Warnf("cleanUpEvictedFile: file was not present at the time of truncating: %v", err)
+			logger.Warnf("removeFileInCache: file was not present at the time of truncating: %v", err)
 			return nil
 		} else {
-			return fmt.Errorf("cleanUpEvictedFile: while truncating file: %s, error: %w", localFilePath, err)
+			return fmt.Errorf("while truncating file: %s, error: %w", localFilePath, err)
 		}
 	}
 	err = os.Remove(localFilePath)
 	if err != nil {
 		if os.IsNotExist(err) {
-			logger.Warnf("cleanUpEvictedFile: file was not present at the time of deleting: %v", err)
+			logger.Warnf("removeFileInCache: file was not present at the time of deleting: %v", err)
 		} else {
-			return fmt.Errorf("cleanUpEvictedFile: while deleting file: %s, error: %w", localFilePath, err)
+			return fmt.Errorf("while deleting file: %s, error: %w", localFilePath, err)
 		}
 	}
 
 	return nil
 }
 
+// captureWastedBytes records the bytes downloaded into the file of an evicted
+// entry that were never read from it: past the furthest read, or all of them
+// if the file was never hit. A file that was still being downloaded counts as
+// a cancelled prefetch.
+func captureWastedBytes(fileInfo *data.FileInfo) {
+	if fileInfo.Usage == nil {
+		return
+	}
+
+	wasted := fileInfo.Offset - min(fileInfo.Offset, fileInfo.Usage.ReadUpTo())
+	cause := monitor.WasteEvictedUnreadCache
+	if fileInfo.Offset < fileInfo.FileSize {
+		cause = monitor.WasteCanceledPrefetch
+	}
+	monitor.CaptureWastedBytesMetrics(context.Background(), cause, int64(wasted))
+}
+
 // addFileInfoEntryAndCreateDownloadJob adds data.FileInfo entry for the given
 // object and bucket in the file info cache and creates download job if they do
 // not already exist. It also cleans up for entries that are evicted at the time
 // of adding new entry. In case the cache contains the data.FileInfo entry with
 // different generation or if the job is failed/invalidated, it cleans up
 // (job and local cache file) the old entry and adds the new entry and download
-// job with the given generation to the cache.
+// job with the given generation to the cache. An entry for a different
+// generation that CacheHandles are reading is superseded instead, if there is
+// room for it. New entries for objects under the pinned prefixes are pinned, if
+// there is room for them. It returns the cache directory holding the file for
+// the entry.
 //
 // Requires Lock(chr.mu)
-func (chr *CacheHandler) addFileInfoEntryAndCreateDownloadJob(object *gcs.MinObject, bucket gcs.Bucket) error {
+func (chr *CacheHandler) addFileInfoEntryAndCreateDownloadJob(object *gcs.MinObject, bucket gcs.Bucket) (string, error) {
 	fileInfoKey := data.FileInfoKey{
 		BucketName: bucket.Name(),
 		ObjectName: object.Name,
 	}
 	fileInfoKeyName, err := fileInfoKey.Key()
 	if err != nil {
-		return fmt.Errorf("addFileInfoEntryAndCreateDownloadJob: while creating key: %v", fileInfoKeyName)
+		return "", fmt.Errorf("addFileInfoEntryAndCreateDownloadJob: while creating key: %v", fileInfoKeyName)
 	}
 
 	addEntryToCache := false
@@ -134,12 +279,20 @@ func (chr *CacheHandler) addFileInfoEntryAndCreateDownloadJob(object *gcs.MinObj
 	if fileInfo == nil {
 		addEntryToCache = true
 	} else {
+		fileInfoData := fileInfo.(data.FileInfo)
+		cacheDir := chr.cacheDirOf(&fileInfoData)
+		filePath := chr.paths.DownloadPath(cacheDir, util.GetObjectPath(bucket.Name(), object.Name))
+		_, err := os.Stat(filePath)
+		if d := chr.cacheDirState(cacheDir); err != nil && d != nil && !isUsableDir(cacheDir, chr.dirPerm) {
+			// The cache directory became unusable, e.g. because its device
+			// failed. Evict the entries in it, and place the file elsewhere.
+			chr.failCacheDir(d)
+			return chr.addFileInfoEntryAndCreateDownloadJob(object, bucket)
+		}
 		// Throw an error, if there is an entry in the file-info cache and cache file doesn't
 		// exist locally.
-		filePath := util.GetDownloadPath(chr.cacheDir, util.GetObjectPath(bucket.Name(), object.Name))
-		_, err := os.Stat(filePath)
 		if err != nil && os.IsNotExist(err) {
-			return fmt.Errorf("addFileInfoEntryAndCreateDownloadJob: %s: %s", util.FileNotPresentInCacheErrMsg, filePath)
+			return "", fmt.Errorf("addFileInfoEntryAndCreateDownloadJob: %s: %s", util.FileNotPresentInCacheErrMsg, filePath)
 		}
 
 		// Evict object in cache if the generation of object in cache is different
@@ -147,7 +300,6 @@ func (chr *CacheHandler) addFileInfoEntryAndCreateDownloadJob(object *gcs.MinObj
 		// decide to evict or not because generations are not always increasing:
 		// https://cloud.google.com/storage/docs/metadata#generation-number)
 		// Also, invalidate the cache if download job has failed or not invalid.
-		fileInfoData := fileInfo.(data.FileInfo)
 		// If offset in file info cache is less than object size and there is no
 		// reference to download job then it means the job has failed.
 		existingJob := chr.jobManager.GetJob(object.Name, bucket.Name())
@@ -157,45 +309,67 @@ func (chr *CacheHandler) addFileInfoEntryAndCreateDownloadJob(object *gcs.MinObj
 			shouldInvalidate = (existingJobStatus == downloader.Failed) || (existingJobStatus == downloader.Invalid)
 		}
 		if (fileInfoData.ObjectGeneration != object.Generation) || shouldInvalidate {
+			// Superseding before erasing the entry keeps its readers from finding
+			// it gone in between.
+			superseded := fileInfoData.ObjectGeneration != object.Generation && chr.supersede(fileInfoKeyName, &fileInfoData)
 			erasedVal := chr.fileInfoCache.Erase(fileInfoKeyName)
-			if erasedVal != nil {
+			if erasedVal != nil && !superseded {
 				erasedFileInfo := erasedVal.(data.FileInfo)
 				err := chr.cleanUpEvictedFile(&erasedFileInfo)
 				if err != nil {
-					return fmt.Errorf("addFileInfoEntryAndCreateDownloadJob: while performing post eviction of %s object error: %w", erasedFileInfo.Key.ObjectName, err)
+					return "", fmt.Errorf("addFileInfoEntryAndCreateDownloadJob: while performing post eviction of %s object error: %w", erasedFileInfo.Key.ObjectName, err)
 				}
 			}
 			addEntryToCache = true
 		}
 	}
 
-	if addEntryToCache {
-		fileInfo = data.FileInfo{
-			Key:              fileInfoKey,
-			ObjectGeneration: object.Generation,
-			Offset:           0,
-			FileSize:         object.Size,
-		}
+	if !addEntryToCache {
+		// Move this entry on top of LRU.
+		fileInfo = chr.fileInfoCache.LookUp(fileInfoKeyName)
+		fileInfoData := fileInfo.(data.FileInfo)
+		return chr.cacheDirOf(&fileInfoData), nil
+	}
 
-		evictedValues, err := chr.fileInfoCache.Insert(fileInfoKeyName, fileInfo)
+	// No files are added while the cache recovers from a disk error.
+	if !chr.health.admitting() {
+		return "", fmt.Errorf("addFileInfoEntryAndCreateDownloadJob: %s", util.CacheUnavailableErrMsg)
+	}
+
+	cacheDir, err := chr.placeFile(object.Size)
+	if err != nil {
+		return "", fmt.Errorf("addFileInfoEntryAndCreateDownloadJob: while placing the file: %w", err)
+	}
+	newFileInfo := data.FileInfo{
+		Key:              fileInfoKey,
+		ObjectGeneration: object.Generation,
+		Offset:           0,
+		FileSize:         object.Size,
+		CRC32C:           object.CRC32C,
+		CacheDir:         cacheDir,
+		Usage:            &data.EntryUsage{},
+	}
+
+	evictedValues, err := chr.insertFileInfo(fileInfoKeyName, newFileInfo)
+	if err != nil {
+		chr.releaseFile(&newFileInfo)
+		return "", fmt.Errorf("addFileInfoEntryAndCreateDownloadJob: while inserting into the cache: %w", err)
+	}
+	chr.recordPinnedSize()
+	// A file left behind by an earlier owner of a shared cache is about to be
+	// downloaded again, so other processes must stop opening it.
+	chr.removeSharedEntry(cacheDir, util.GetObjectPath(bucket.Name(), object.Name))
+	// Create download job for new entry added to cache.
+	_ = chr.jobManager.CreateJobInDirIfNotExists(object, bucket, cacheDir)
+	for _, val := range evictedValues {
+		fileInfo := val.(data.FileInfo)
+		err := chr.cleanUpEvictedFile(&fileInfo)
 		if err != nil {
-			return fmt.Errorf("addFileInfoEntryAndCreateDownloadJob: while inserting into the cache: %w", err)
+			return "", fmt.Errorf("addFileInfoEntryAndCreateDownloadJob: while performing post eviction of %s object error: %w", fileInfo.Key.ObjectName, err)
 		}
-		// Create download job for new entry added to cache.
-		_ = chr.jobManager.CreateJobIfNotExists(object, bucket)
-		for _, val := range evictedValues {
-			fileInfo := val.(data.FileInfo)
-			err := chr.cleanUpEvictedFile(&fileInfo)
-			if err != nil {
-				return fmt.Errorf("addFileInfoEntryAndCreateDownloadJob: while performing post eviction of %s object error: %w", fileInfo.Key.ObjectName, err)
-			}
-		}
-	} else {
-		// Move this entry on top of LRU.
-		_ = chr.fileInfoCache.LookUp(fileInfoKeyName)
 	}
 
-	return nil
+	return cacheDir, nil
 }
 
 // GetCacheHandle creates an entry in fileInfoCache if it does not already exist. It
@@ -207,12 +381,23 @@ func (chr *CacheHandler) addFileInfoEntryAndCreateDownloadJob(object *gcs.MinObj
 // Note: It returns nil if cacheForRangeRead is set to False, initialOffset is
 // non-zero (i.e. random read) and entry for file doesn't already exist in
 // fileInfoCache then no need to create file in cache.
+// If the cache is read-only, or shared and owned by another gcsfuse process,
+// it only returns a CacheHandle for a file that a process owning the cache has
+// completely downloaded.
+// Disk errors of the cache are returned as errors with
+// util.CacheUnavailableErrMsg, for the read to go to GCS instead.
 //
 // Acquires and releases LOCK(CacheHandler.mu)
 func (chr *CacheHandler) GetCacheHandle(object *gcs.MinObject, bucket gcs.Bucket, cacheForRangeRead bool, initialOffset int64) (*CacheHandle, error) {
 	chr.mu.Lock()
 	defer chr.mu.Unlock()
 
+	// Only the owner of a shared cache adds to it, the others read the files
+	// it has completely downloaded, as do processes with a read-only cache.
+	if chr.readOnly || !chr.ownsCache() {
+		return chr.getSharedCacheHandle(object, bucket, cacheForRangeRead, initialOffset)
+	}
+
 	// If cacheForRangeRead is set to False, initialOffset is non-zero (i.e. random read)
 	// and entry for file doesn't already exist in fileInfoCache then no need to
 	// create file in cache.
@@ -232,17 +417,43 @@ func (chr *CacheHandler) GetCacheHandle(object *gcs.MinObject, bucket gcs.Bucket
 		}
 	}
 
-	err := chr.addFileInfoEntryAndCreateDownloadJob(object, bucket)
+	if !chr.health.usable(chr.probeCacheDirs) {
+		return nil, fmt.Errorf("GetCacheHandle: %s", util.CacheUnavailableErrMsg)
+	}
+
+	fileInfoKey := data.FileInfoKey{
+		BucketName: bucket.Name(),
+		ObjectName: object.Name,
+	}
+	cacheDir, err := chr.addFileInfoEntryAndCreateDownloadJob(object, bucket)
 	if err != nil {
+		if isDiskError(err) {
+			chr.evictAfterDiskError(fileInfoKey, err)
+			return nil, fmt.Errorf("GetCacheHandle: %s: %w", util.CacheUnavailableErrMsg, err)
+		}
 		return nil, fmt.Errorf("GetCacheHandle: while adding the entry in the cache: %w", err)
 	}
 
-	localFileReadHandle, err := chr.createLocalFileReadHandle(object.Name, bucket.Name())
+	localFileReadHandle, err := chr.createLocalFileReadHandle(cacheDir, object.Name, bucket.Name())
 	if err != nil {
+		if isDiskError(err) {
+			chr.evictAfterDiskError(fileInfoKey, err)
+			return nil, fmt.Errorf("GetCacheHandle: %s: %w", util.CacheUnavailableErrMsg, err)
+		}
 		return nil, fmt.Errorf("GetCacheHandle: while creating local-file read handle: %w", err)
 	}
 
-	return NewCacheHandle(localFileReadHandle, chr.jobManager.GetJob(object.Name, bucket.Name()), chr.fileInfoCache, cacheForRangeRead, initialOffset), nil
+	cacheHandle := NewCacheHandle(localFileReadHandle, chr.jobManager.GetJob(object.Name, bucket.Name()), chr.fileInfoCache, cacheForRangeRead, initialOffset)
+	cacheHandle.hits = &chr.hits
+	cacheHandle.reportDiskError = func(err error) {
+		chr.reportDiskError(fileInfoKey.ObjectName, fileInfoKey.BucketName, err)
+	}
+	if fileInfoKeyName, err := fileInfoKey.Key(); err == nil {
+		pin := chr.pin(fileInfoKeyName, object.Generation)
+		cacheHandle.pin = pin
+		cacheHandle.unpin = func() { chr.unpin(pin) }
+	}
+	return cacheHandle, nil
 }
 
 // InvalidateCache removes the file entry from the fileInfoCache and performs clean
@@ -273,15 +484,71 @@ func (chr *CacheHandler) InvalidateCache(objectName string, bucketName string) e
 	return nil
 }
 
-// Destroy destroys the job manager (i.e. invalidate all the jobs).
+// evictIfUnchanged removes the entry with the given key from the fileInfoCache
+// and performs clean up for it, unless it has been replaced by an entry for a
+// different generation of the object or an incomplete download since
+// fileInfo was looked up.
+//
+// Acquires and releases LOCK(CacheHandler.mu)
+func (chr *CacheHandler) evictIfUnchanged(key string, fileInfo data.FileInfo) error {
+	chr.mu.Lock()
+	defer chr.mu.Unlock()
+
+	val := chr.fileInfoCache.LookUpWithoutChangingOrder(key)
+	if val == nil {
+		return nil
+	}
+	current := val.(data.FileInfo)
+	if current.ObjectGeneration != fileInfo.ObjectGeneration || current.Offset < current.FileSize {
+		return nil
+	}
+
+	erasedVal := chr.fileInfoCache.Erase(key)
+	if erasedVal != nil {
+		erasedFileInfo := erasedVal.(data.FileInfo)
+		err := chr.cleanUpEvictedFile(&erasedFileInfo)
+		if err != nil {
+			return fmt.Errorf("evictIfUnchanged: while performing clean-up for evicted %s object, error: %w", erasedFileInfo.Key.ObjectName, err)
+		}
+	}
+	return nil
+}
+
+// Destroy stops the scrubber and the migration of the layout, if any,
+// destroys the job manager (i.e. invalidate all the jobs), stops the downloads
+// of superseded entries and gives up the ownership of a shared cache.
 // Note: This method is expected to be called at the time of unmounting and
 // because file info cache is in-memory, it is not required to destroy it.
 //
 // Acquires and releases Lock(chr.mu)
 func (chr *CacheHandler) Destroy() (err error) {
+	if chr.stopScrubber != nil {
+		chr.stopScrubber()
+	}
+
+	// The migration takes the lock once done.
+	chr.mu.Lock()
+	stopLayoutMigration := chr.stopLayoutMigration
+	chr.mu.Unlock()
+	if stopLayoutMigration != nil {
+		stopLayoutMigration()
+	}
+
 	chr.mu.Lock()
 	defer chr.mu.Unlock()
 
 	chr.jobManager.Destroy()
+	for p := range chr.superseded {
+		if p.job != nil {
+			p.job.Invalidate()
+		}
+	}
+
+	// Closing the lock file releases the lock, letting another process take
+	// over a shared cache.
+	if chr.lockFile != nil {
+		err = chr.lockFile.Close()
+		chr.lockFile = nil
+	}
 	return
 }
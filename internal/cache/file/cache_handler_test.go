@@ -32,11 +32,14 @@ import (
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/lru"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/util"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/locker"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/monitor"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/monitor/tags"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
 	"github.com/googlecloudplatform/gcsfuse/v2/tools/integration_tests/util/operations"
 	. "github.com/jacobsa/ogletest"
+	"go.opencensus.io/stats/view"
 )
 
 const HandlerCacheMaxSize = TestObjectSize + ObjectSizeToCauseEviction
@@ -167,7 +170,7 @@ func doesFileExist(filePath string) bool {
 }
 
 func (chrT *cacheHandlerTest) Test_createLocalFileReadHandle_OnlyForRead() {
-	readFileHandle, err := chrT.cacheHandler.createLocalFileReadHandle(chrT.object.Name, chrT.bucket.Name())
+	readFileHandle, err := chrT.cacheHandler.createLocalFileReadHandle(chrT.cacheDir, chrT.object.Name, chrT.bucket.Name())
 
 	ExpectEq(nil, err)
 	_, err = readFileHandle.Write([]byte("test"))
@@ -220,7 +223,7 @@ func (chrT *cacheHandlerTest) Test_cleanUpEvictedFile_WhenLocalFileNotExist() {
 func (chrT *cacheHandlerTest) Test_addFileInfoEntryAndCreateDownloadJob_IfAlready() {
 	existingJob := chrT.getDownloadJobForTestObject()
 
-	err := chrT.cacheHandler.addFileInfoEntryAndCreateDownloadJob(chrT.object, chrT.bucket)
+	_, err := chrT.cacheHandler.addFileInfoEntryAndCreateDownloadJob(chrT.object, chrT.bucket)
 
 	ExpectEq(nil, err)
 	ExpectTrue(chrT.isEntryInFileInfoCache(chrT.object.Name, chrT.bucket.Name()))
@@ -233,7 +236,7 @@ func (chrT *cacheHandlerTest) Test_addFileInfoEntryAndCreateDownloadJob_Generati
 	existingJob := chrT.getDownloadJobForTestObject()
 	chrT.object.Generation = chrT.object.Generation + 1
 
-	err := chrT.cacheHandler.addFileInfoEntryAndCreateDownloadJob(chrT.object, chrT.bucket)
+	_, err := chrT.cacheHandler.addFileInfoEntryAndCreateDownloadJob(chrT.object, chrT.bucket)
 
 	ExpectEq(nil, err)
 	ExpectTrue(chrT.isEntryInFileInfoCache(chrT.object.Name, chrT.bucket.Name()))
@@ -253,7 +256,7 @@ func (chrT *cacheHandlerTest) Test_addFileInfoEntryAndCreateDownloadJob_IfNotAlr
 	AssertEq(nil, existingJob)
 
 	// Insertion will happen and that leads to eviction.
-	err := chrT.cacheHandler.addFileInfoEntryAndCreateDownloadJob(minObject, chrT.bucket)
+	_, err := chrT.cacheHandler.addFileInfoEntryAndCreateDownloadJob(minObject, chrT.bucket)
 
 	ExpectEq(nil, err)
 	ExpectTrue(chrT.isEntryInFileInfoCache(minObject.Name, chrT.bucket.Name()))
@@ -273,7 +276,7 @@ func (chrT *cacheHandlerTest) Test_addFileInfoEntryAndCreateDownloadJob_IfLocalF
 
 	// There is a fileInfoEntry in the fileInfoCache but the corresponding local file doesn't exist.
 	// Hence, this will return error containing util.FileNotPresentInCacheErrMsg.
-	err = chrT.cacheHandler.addFileInfoEntryAndCreateDownloadJob(chrT.object, chrT.bucket)
+	_, err = chrT.cacheHandler.addFileInfoEntryAndCreateDownloadJob(chrT.object, chrT.bucket)
 
 	AssertNe(nil, err)
 	ExpectTrue(strings.Contains(err.Error(), util.FileNotPresentInCacheErrMsg))
@@ -290,7 +293,7 @@ func (chrT *cacheHandlerTest) Test_addFileInfoEntryAndCreateDownloadJob_WhenJobH
 	actualJob := chrT.jobManager.GetJob(chrT.object.Name, chrT.bucket.Name())
 	ExpectEq(nil, actualJob)
 
-	err = chrT.cacheHandler.addFileInfoEntryAndCreateDownloadJob(chrT.object, chrT.bucket)
+	_, err = chrT.cacheHandler.addFileInfoEntryAndCreateDownloadJob(chrT.object, chrT.bucket)
 
 	ExpectEq(nil, err)
 	ExpectTrue(chrT.isEntryInFileInfoCache(chrT.object.Name, chrT.bucket.Name()))
@@ -306,7 +309,7 @@ func (chrT *cacheHandlerTest) Test_addFileInfoEntryAndCreateDownloadJob_WhenJobI
 
 	// Because the job has been removed and file info entry is still present, new
 	// file info entry and job should be created.
-	err := chrT.cacheHandler.addFileInfoEntryAndCreateDownloadJob(chrT.object, chrT.bucket)
+	_, err := chrT.cacheHandler.addFileInfoEntryAndCreateDownloadJob(chrT.object, chrT.bucket)
 
 	ExpectEq(nil, err)
 	ExpectTrue(chrT.isEntryInFileInfoCache(chrT.object.Name, chrT.bucket.Name()))
@@ -329,7 +332,7 @@ func (chrT *cacheHandlerTest) Test_addFileInfoEntryAndCreateDownloadJob_WhenJobH
 	// Because the job has been failed and file info entry is still present with
 	// size less than the object's size (because the async job failed), new job
 	// should be created
-	err = chrT.cacheHandler.addFileInfoEntryAndCreateDownloadJob(chrT.object, chrT.bucket)
+	_, err = chrT.cacheHandler.addFileInfoEntryAndCreateDownloadJob(chrT.object, chrT.bucket)
 
 	ExpectEq(nil, err)
 	ExpectTrue(chrT.isEntryInFileInfoCache(chrT.object.Name, chrT.bucket.Name()))
@@ -707,3 +710,52 @@ func (chrT *cacheHandlerTest) Test_Destroy() {
 	AssertEq(nil, chrT.jobManager.GetJob(minObject1.Name, chrT.bucket.Name()))
 	AssertEq(nil, chrT.jobManager.GetJob(minObject2.Name, chrT.bucket.Name()))
 }
+
+// Return the bytes counted by the gcs/wasted_bytes view so far for cause.
+func wastedBytes(cause string) int64 {
+	rows, err := view.RetrieveData("gcs/wasted_bytes")
+	AssertEq(nil, err)
+
+	var n int64
+	for _, row := range rows {
+		for _, t := range row.Tags {
+			if t.Key == tags.WasteCause && t.Value == cause {
+				n += int64(row.Data.(*view.SumData).Value)
+			}
+		}
+	}
+	return n
+}
+
+func (chrT *cacheHandlerTest) Test_InvalidateCache_CountsUnreadBytesOfPartialDownload() {
+	// Half of the object is downloaded, of which the first 10 bytes are read.
+	usage := &data.EntryUsage{}
+	usage.NoteRead(10)
+	_, err := chrT.cache.Insert(chrT.fileInfoKeyName, data.FileInfo{
+		Key:              data.FileInfoKey{BucketName: chrT.bucket.Name(), ObjectName: chrT.object.Name},
+		ObjectGeneration: chrT.object.Generation,
+		FileSize:         chrT.object.Size,
+		Offset:           chrT.object.Size / 2,
+		Usage:            usage,
+	})
+	AssertEq(nil, err)
+	canceledBefore := wastedBytes(monitor.WasteCanceledPrefetch)
+	evictedBefore := wastedBytes(monitor.WasteEvictedUnreadCache)
+
+	err = chrT.cacheHandler.InvalidateCache(chrT.object.Name, chrT.bucket.Name())
+
+	AssertEq(nil, err)
+	ExpectEq(int64(chrT.object.Size/2-10), wastedBytes(monitor.WasteCanceledPrefetch)-canceledBefore)
+	ExpectEq(evictedBefore, wastedBytes(monitor.WasteEvictedUnreadCache))
+}
+
+func (chrT *cacheHandlerTest) Test_InvalidateCache_DoesNotCountEntriesWithoutUsage() {
+	canceledBefore := wastedBytes(monitor.WasteCanceledPrefetch)
+
+	// The entry added by SetUp has no usage, like one adopted from another
+	// process sharing the cache.
+	err := chrT.cacheHandler.InvalidateCache(chrT.object.Name, chrT.bucket.Name())
+
+	AssertEq(nil, err)
+	ExpectEq(canceledBefore, wastedBytes(monitor.WasteCanceledPrefetch))
+}
@@ -21,7 +21,10 @@ import (
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/lru"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/util"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/locker"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/monitor"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/jacobsa/timeutil"
 )
 
 // JobManager is responsible for maintaining, getting and removing file download
@@ -54,53 +57,113 @@ type JobManager struct {
 	// object named "a/b/foo.txt" in bucket named "test_bucket" would be
 	// "test_bucket/a/b/foo.txt"
 	jobs map[string]*Job
-	mu   locker.Locker
+
+	// shareDownloads is set if the cache is shared with other gcsfuse
+	// processes, in which case jobs write a data.SharedEntry for the files they
+	// completely download.
+	shareDownloads bool
+
+	// paths is the layout of the files the jobs download into.
+	paths util.PathResolver
+
+	// fillMeter measures the rate at which the jobs fill the cache.
+	fillMeter *monitor.FileCacheFillMeter
+
+	mu locker.Locker
 }
 
 func NewJobManager(fileInfoCache *lru.Cache, filePerm os.FileMode, dirPerm os.FileMode, cacheDir string, sequentialReadSizeMb int32) (jm *JobManager) {
 	jm = &JobManager{fileInfoCache: fileInfoCache, filePerm: filePerm,
-		dirPerm: dirPerm, cacheDir: cacheDir, sequentialReadSizeMb: sequentialReadSizeMb}
+		dirPerm: dirPerm, cacheDir: cacheDir, sequentialReadSizeMb: sequentialReadSizeMb,
+		paths:     util.ShardedLayout,
+		fillMeter: monitor.NewFileCacheFillMeter(timeutil.RealClock())}
 	jm.mu = locker.New("JobManager", func() {})
 	jm.jobs = make(map[string]*Job)
 	return
 }
 
-// removeJob is a helper function to remove downloader.Job for given object and
-// bucket from jm.jobs if present. It is passed as callback function to job so
-// that job can remove itself after completion/failure/invalidation.
+// removeJob is a helper function to remove given downloader.Job for given
+// object and bucket from jm.jobs if it is still the job stored there. It is
+// passed as callback function to job so that job can remove itself after
+// completion/failure/invalidation, without removing a newer job that has
+// replaced it in the meantime.
 //
 // Acquires and releases Lock(jm.mu)
-func (jm *JobManager) removeJob(objectName string, bucketName string) {
+func (jm *JobManager) removeJob(job *Job, objectName string, bucketName string) {
 	jm.mu.Lock()
 	defer jm.mu.Unlock()
 	objectPath := util.GetObjectPath(bucketName, objectName)
-	delete(jm.jobs, objectPath)
+	if jm.jobs[objectPath] == job {
+		delete(jm.jobs, objectPath)
+	}
 }
 
 // CreateJobIfNotExists creates and returns downloader.Job for given object and bucket.
-// If there is already an existing job then this method returns that.
+// If there is already an existing job for the same generation of the object
+// then this method returns that, so that all the readers of an object share a
+// single download. If the existing job is for a different generation, it is
+// invalidated first and then replaced by a new job for the given generation.
 //
 // Acquires and releases Lock(jm.mu)
 func (jm *JobManager) CreateJobIfNotExists(object *gcs.MinObject, bucket gcs.Bucket) (job *Job) {
+	return jm.CreateJobInDirIfNotExists(object, bucket, jm.cacheDir)
+}
+
+// CreateJobInDirIfNotExists is CreateJobIfNotExists for a new job downloading
+// into the given cache directory rather than that of the job manager.
+//
+// Acquires and releases Lock(jm.mu)
+func (jm *JobManager) CreateJobInDirIfNotExists(object *gcs.MinObject, bucket gcs.Bucket, cacheDir string) (job *Job) {
 	objectPath := util.GetObjectPath(bucket.Name(), object.Name)
 	jm.mu.Lock()
 	defer jm.mu.Unlock()
-	job, ok := jm.jobs[objectPath]
-	if ok {
-		return job
+	for {
+		existingJob, ok := jm.jobs[objectPath]
+		if !ok {
+			break
+		}
+		if existingJob.object.Generation == object.Generation {
+			return existingJob
+		}
+
+		// Release the lock while invalidating the stale job to avoid deadlock as
+		// the job calls removeJobCallback in the end which requires Lock(jm.mu).
+		// Invalidation also waits for the stale download to stop writing to the
+		// file in cache, which the new job is going to reuse.
+		delete(jm.jobs, objectPath)
+		jm.mu.Unlock()
+		logger.Tracef("Job:%p (%s:/%s) is stale, object generation changed to %d.", existingJob, bucket.Name(), object.Name, object.Generation)
+		existingJob.Invalidate()
+		jm.mu.Lock()
 	}
-	downloadPath := util.GetDownloadPath(jm.cacheDir, objectPath)
+
+	downloadPath := jm.paths.DownloadPath(cacheDir, objectPath)
 	fileSpec := data.FileSpec{Path: downloadPath, FilePerm: jm.filePerm, DirPerm: jm.dirPerm}
 	// Pass call back function to Job. When this callback function is called, it
 	// removes the job reference from jobs map.
 	removeJobCallback := func() {
-		jm.removeJob(object.Name, bucket.Name())
+		jm.removeJob(job, object.Name, bucket.Name())
 	}
 	job = NewJob(object, bucket, jm.fileInfoCache, jm.sequentialReadSizeMb, fileSpec, removeJobCallback)
+	job.fillMeter = jm.fillMeter
+	if jm.shareDownloads {
+		job.sharedEntrySpec = &data.FileSpec{Path: jm.paths.SharedEntryPath(cacheDir, objectPath), FilePerm: jm.filePerm, DirPerm: jm.dirPerm}
+	}
 	jm.jobs[objectPath] = job
 	return job
 }
 
+// ShareDownloads makes the jobs created from now on write a data.SharedEntry
+// for the files they completely download, so that other gcsfuse processes
+// sharing the cache can read them.
+//
+// Acquires and releases Lock(jm.mu)
+func (jm *JobManager) ShareDownloads() {
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+	jm.shareDownloads = true
+}
+
 // GetJob returns downloader.Job for given object and bucket if present. If the
 // job is not present, it returns nil.
 //
@@ -130,6 +193,28 @@ func (jm *JobManager) InvalidateAndRemoveJob(objectName string, bucketName strin
 	}
 }
 
+// DetachJob removes the job for the given generation of the object and bucket
+// from jm.jobs, if there is one, and detaches it to go on downloading into the
+// given path (see Job.Detach), returning it. If detaching fails, the job is
+// removed nonetheless, and returned with the error.
+//
+// Acquires and releases Lock(jm.mu)
+func (jm *JobManager) DetachJob(objectName string, bucketName string, generation int64, path string) (*Job, error) {
+	objectPath := util.GetObjectPath(bucketName, objectName)
+	jm.mu.Lock()
+	job, ok := jm.jobs[objectPath]
+	if !ok || job.object.Generation != generation {
+		jm.mu.Unlock()
+		return nil, nil
+	}
+	delete(jm.jobs, objectPath)
+	// Release the lock before detaching, as the job calls removeJobCallback
+	// with its own lock held.
+	jm.mu.Unlock()
+
+	return job, job.Detach(path)
+}
+
 // Destroy invalidates and deletes all the jobs that job manager is managing.
 //
 // Acquires and releases Lock(jm.mu)
@@ -15,10 +15,14 @@
 package downloader
 
 import (
+	"bytes"
+	"io"
 	"os"
 	"path"
 	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/locker"
 
@@ -131,6 +135,61 @@ func (dt *downloaderTest) Test_CreateJobIfNotExists_NotExisting_WithDefaultFileA
 	ExpectEq(0600, job.fileSpec.FilePerm.Perm())
 }
 
+func (dt *downloaderTest) Test_CreateJobIfNotExists_DifferentGeneration() {
+	staleJob := dt.jm.CreateJobIfNotExists(&dt.object, dt.bucket)
+	_, err := staleJob.Download(context.Background(), 0, false)
+	AssertEq(nil, err)
+	newObject := dt.object
+	newObject.Generation++
+
+	job := dt.jm.CreateJobIfNotExists(&newObject, dt.bucket)
+
+	AssertNe(staleJob, job)
+	AssertEq(Invalid, staleJob.GetStatus().Name)
+	dt.verifyJob(job, &newObject, dt.bucket, dt.jm.sequentialReadSizeMb)
+	// Invalidating the stale job doesn't remove the job replacing it.
+	AssertEq(job, dt.jm.GetJob(dt.object.Name, dt.bucket.Name()))
+	// The same generation keeps getting the new job.
+	AssertEq(job, dt.jm.CreateJobIfNotExists(&newObject, dt.bucket))
+}
+
+func (dt *downloaderTest) Test_CreateJobIfNotExists_NotShared() {
+	job := dt.jm.CreateJobIfNotExists(&dt.object, dt.bucket)
+
+	ExpectEq(nil, job.sharedEntrySpec)
+}
+
+func (dt *downloaderTest) Test_ShareDownloads_WritesSharedEntryOnCompletion() {
+	dt.jm.ShareDownloads()
+	job := dt.jm.CreateJobIfNotExists(&dt.object, dt.bucket)
+	sharedEntryPath := util.GetSharedEntryPath(cacheDir, util.GetObjectPath(dt.bucket.Name(), dt.object.Name))
+	AssertNe(nil, job.sharedEntrySpec)
+	AssertEq(sharedEntryPath, job.sharedEntrySpec.Path)
+
+	_, err := job.Download(context.Background(), int64(dt.object.Size), true)
+
+	AssertEq(nil, err)
+	for job.GetStatus().Name != Completed {
+		time.Sleep(time.Millisecond)
+	}
+	entry, err := util.ReadSharedEntry(sharedEntryPath)
+	AssertEq(nil, err)
+	ExpectEq(dt.bucket.Name(), entry.Key.BucketName)
+	ExpectEq(dt.object.Name, entry.Key.ObjectName)
+	ExpectEq(dt.object.Generation, entry.ObjectGeneration)
+	ExpectEq(dt.object.Size, entry.FileSize)
+}
+
+func (dt *downloaderTest) Test_ShareDownloads_NoSharedEntryBeforeCompletion() {
+	dt.jm.ShareDownloads()
+	job := dt.jm.CreateJobIfNotExists(&dt.object, dt.bucket)
+
+	job.Invalidate()
+
+	_, err := os.Stat(util.GetSharedEntryPath(cacheDir, util.GetObjectPath(dt.bucket.Name(), dt.object.Name)))
+	ExpectTrue(os.IsNotExist(err))
+}
+
 func (dt *downloaderTest) Test_GetJob_NotExisting() {
 	dt.jm.mu.Lock()
 	objectPath := util.GetObjectPath(dt.bucket.Name(), dt.object.Name)
@@ -248,6 +307,49 @@ func (dt *downloaderTest) Test_InvalidateAndRemoveJob_Concurrent() {
 	AssertEq(nil, expectedJob)
 }
 
+func (dt *downloaderTest) Test_DetachJob_DifferentGeneration() {
+	job := dt.jm.CreateJobIfNotExists(&dt.object, dt.bucket)
+
+	detached, err := dt.jm.DetachJob(dt.object.Name, dt.bucket.Name(), dt.object.Generation+1, path.Join(cacheDir, "detached"))
+
+	AssertEq(nil, err)
+	ExpectEq(nil, detached)
+	ExpectEq(job, dt.jm.GetJob(dt.object.Name, dt.bucket.Name()))
+}
+
+func (dt *downloaderTest) Test_DetachJob_GoesOnDownloadingIntoNewPath() {
+	dt.jm.ShareDownloads()
+	job := dt.jm.CreateJobIfNotExists(&dt.object, dt.bucket)
+	detachedPath := path.Join(cacheDir, "detached", "object")
+
+	detached, err := dt.jm.DetachJob(dt.object.Name, dt.bucket.Name(), dt.object.Generation, detachedPath)
+
+	AssertEq(nil, err)
+	AssertEq(job, detached)
+	ExpectEq(nil, dt.jm.GetJob(dt.object.Name, dt.bucket.Name()))
+	// A job for a newer generation can be created meanwhile.
+	newObject := dt.object
+	newObject.Generation++
+	ExpectNe(job, dt.jm.CreateJobIfNotExists(&newObject, dt.bucket))
+	jobStatus, err := job.Download(context.Background(), int64(dt.object.Size), true)
+	AssertEq(nil, err)
+	ExpectEq(int64(dt.object.Size), jobStatus.Offset)
+	content, err := os.ReadFile(detachedPath)
+	AssertEq(nil, err)
+	ExpectEq("taco", string(content))
+	// The detached job neither shares the file nor touches the entry in the
+	// file info cache.
+	for job.GetStatus().Name != Completed {
+		time.Sleep(time.Millisecond)
+	}
+	_, err = os.Stat(util.GetSharedEntryPath(cacheDir, util.GetObjectPath(dt.bucket.Name(), dt.object.Name)))
+	ExpectTrue(os.IsNotExist(err))
+	fileInfoKey := data.FileInfoKey{BucketName: dt.bucket.Name(), ObjectName: dt.object.Name}
+	fileInfoKeyName, err := fileInfoKey.Key()
+	AssertEq(nil, err)
+	ExpectEq(0, dt.cache.LookUpWithoutChangingOrder(fileInfoKeyName).(data.FileInfo).Offset)
+}
+
 func (dt *downloaderTest) Test_Destroy() {
 	objectSize := 50
 	objectContent := testutil.GenerateRandomBytes(objectSize)
@@ -302,3 +404,57 @@ func (dt *downloaderTest) Test_CreateJobIfNotExists_InvalidateAndRemoveJob_Concu
 	}
 	wg.Wait()
 }
+
+// countingBucket counts the readers created for downloading objects.
+type countingBucket struct {
+	gcs.Bucket
+	newReaderCount atomic.Int32
+}
+
+func (b *countingBucket) NewReader(ctx context.Context, req *gcs.ReadObjectRequest) (io.ReadCloser, error) {
+	b.newReaderCount.Add(1)
+	return b.Bucket.NewReader(ctx, req)
+}
+
+func (dt *downloaderTest) Test_CreateJobIfNotExists_Download_ConcurrentReadersShareOneDownload() {
+	objectName := "path/in/gcs/foo.txt"
+	objectSize := 16 * util.MiB
+	objectContent := testutil.GenerateRandomBytes(objectSize)
+	dt.initJobTest(objectName, objectContent, DefaultSequentialReadSizeMb, uint64(objectSize*2), func() {})
+	dt.jm = NewJobManager(dt.cache, util.DefaultFilePerm, util.DefaultDirPerm, cacheDir, DefaultSequentialReadSizeMb)
+	bucket := &countingBucket{Bucket: dt.bucket}
+	const numReaders = 50
+	jobs := [numReaders]*Job{}
+	wg := sync.WaitGroup{}
+	// A job removes itself from the job manager once completed, so all the
+	// readers get hold of the job before any of them starts reading.
+	for i := 0; i < numReaders; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			jobs[i] = dt.jm.CreateJobIfNotExists(&dt.object, bucket)
+		}(i)
+	}
+	wg.Wait()
+	readFunc := func(job *Job) {
+		defer wg.Done()
+		jobStatus, err := job.Download(context.Background(), int64(objectSize), true)
+		AssertEq(nil, err)
+		AssertEq(objectSize, jobStatus.Offset)
+		content, err := os.ReadFile(dt.fileSpec.Path)
+		AssertEq(nil, err)
+		AssertTrue(bytes.Equal(objectContent, content))
+	}
+
+	for i := 0; i < numReaders; i++ {
+		wg.Add(1)
+		go readFunc(jobs[i])
+	}
+	wg.Wait()
+
+	// All readers attached to the same job, which downloaded the object once.
+	for i := 0; i < numReaders; i++ {
+		AssertEq(jobs[0], jobs[i])
+	}
+	AssertEq(1, bucket.newReaderCount.Load())
+}
@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 
@@ -57,12 +58,22 @@ type Job struct {
 	bucket               gcs.Bucket
 	fileInfoCache        *lru.Cache
 	sequentialReadSizeMb int32
-	fileSpec             data.FileSpec
+	// fillMeter, if set, is told about the bytes written to the file in cache.
+	fillMeter *monitor.FileCacheFillMeter
 
 	/////////////////////////
 	// Mutable state
 	/////////////////////////
 
+	// fileSpec is the file spec of the file in cache, which Detach moves.
+	fileSpec data.FileSpec
+	// sharedEntrySpec, if set, is the file spec of the data.SharedEntry written
+	// once the object is completely downloaded.
+	sharedEntrySpec *data.FileSpec
+	// detached is set by Detach, after which the job no longer updates the
+	// entry for the object in fileInfoCache.
+	detached bool
+
 	// status represents the current status of Job.
 	// status.Offset means data in cache is present in range [0, status.offset)
 	status JobStatus
@@ -97,7 +108,7 @@ type JobStatus struct {
 // jobSubscriber represents a subscriber waiting on async download of job to
 // complete downloading at least till the subscribed offset.
 type jobSubscriber struct {
-	notificationC    chan<- JobStatus
+	notificationC    chan JobStatus
 	subscribedOffset int64
 }
 
@@ -187,6 +198,32 @@ func (job *Job) Invalidate() {
 	job.notifySubscribers()
 }
 
+// Detach moves the file in cache to the given path, where the job goes on
+// downloading the object without updating its entry in fileInfoCache or
+// sharing the file. This lets the readers of the job keep reading this
+// generation of the object while a job for another generation downloads into
+// the old path.
+//
+// Acquires and releases LOCK(job.mu)
+func (job *Job) Detach(path string) error {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+
+	err := os.MkdirAll(filepath.Dir(path), job.fileSpec.DirPerm)
+	if err != nil {
+		return fmt.Errorf("Detach: while creating the directory for %s: %w", path, err)
+	}
+	err = os.Rename(job.fileSpec.Path, path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("Detach: while moving the file in cache to %s: %w", path, err)
+	}
+
+	job.fileSpec.Path = path
+	job.sharedEntrySpec = nil
+	job.detached = true
+	return nil
+}
+
 // subscribe adds subscriber for download job and returns channel which is
 // notified when the download is completed at least till the subscribed offset
 // or in case of failure and invalidation.
@@ -198,6 +235,21 @@ func (job *Job) subscribe(subscribedOffset int64) (notificationC <-chan JobStatu
 	return subscriberC
 }
 
+// unsubscribe removes the subscriber owning the given notification channel,
+// if it hasn't been notified yet. Every reader waiting on the job holds its
+// own subscription, so a reader giving up only drops its own subscription and
+// the download carries on for the others.
+//
+// Not concurrency safe and requires LOCK(job.mu)
+func (job *Job) unsubscribe(notificationC <-chan JobStatus) {
+	for subItr := job.subscribers.Front(); subItr != nil; subItr = subItr.Next() {
+		if (<-chan JobStatus)(subItr.Value.(jobSubscriber).notificationC) == notificationC {
+			job.subscribers.Remove(subItr)
+			return
+		}
+	}
+}
+
 // notifySubscribers notifies all the subscribers of download job in case of
 // failure or invalidation or completion till the subscribed offset.
 //
@@ -233,6 +285,11 @@ func (job *Job) failWhileDownloading(downloadErr error) {
 //
 // Not concurrency safe and requires LOCK(job.mu)
 func (job *Job) updateFileInfoCache() (err error) {
+	// The entry is for another generation of the object.
+	if job.detached {
+		return
+	}
+
 	fileInfoKey := data.FileInfoKey{
 		BucketName: job.bucket.Name(),
 		ObjectName: job.object.Name,
@@ -247,6 +304,12 @@ func (job *Job) updateFileInfoCache() (err error) {
 	updatedFileInfo := data.FileInfo{
 		Key: fileInfoKey, ObjectGeneration: job.object.Generation,
 		FileSize: job.object.Size, Offset: uint64(job.status.Offset),
+		CRC32C: job.object.CRC32C,
+	}
+	// Keep the cache directory and usage that the entry records.
+	if existing := job.fileInfoCache.LookUpWithoutChangingOrder(fileInfoKeyName); existing != nil {
+		updatedFileInfo.CacheDir = existing.(data.FileInfo).CacheDir
+		updatedFileInfo.Usage = existing.(data.FileInfo).Usage
 	}
 
 	logger.Tracef("Job:%p (%s:/%s) downloaded till %v offset.", job, job.bucket.Name(), job.object.Name, job.status.Offset)
@@ -258,6 +321,29 @@ func (job *Job) updateFileInfoCache() (err error) {
 	return
 }
 
+// writeSharedEntry writes the data.SharedEntry for the completely downloaded
+// object, if the cache is shared. Failing to do so only keeps other gcsfuse
+// processes from reading the file, so it's logged rather than failing the job.
+func (job *Job) writeSharedEntry() {
+	job.mu.Lock()
+	sharedEntrySpec := job.sharedEntrySpec
+	job.mu.Unlock()
+	if sharedEntrySpec == nil {
+		return
+	}
+
+	entry := data.SharedEntry{
+		Key:              data.FileInfoKey{BucketName: job.bucket.Name(), ObjectName: job.object.Name},
+		ObjectGeneration: job.object.Generation,
+		FileSize:         job.object.Size,
+		CRC32C:           job.object.CRC32C,
+	}
+	err := cacheutil.WriteSharedEntry(*sharedEntrySpec, entry)
+	if err != nil {
+		logger.Warnf("Job:%p (%s:/%s) failed to share the downloaded file: %v", job, job.bucket.Name(), job.object.Name, err)
+	}
+}
+
 // downloadObjectAsync downloads the backing GCS object into a file as part of
 // file cache using NewReader method of gcs.Bucket.
 //
@@ -279,8 +365,17 @@ func (job *Job) downloadObjectAsync() {
 		job.mu.Unlock()
 	}()
 
-	// Create, open and truncate cache file for writing object into it.
+	if job.fillMeter != nil {
+		job.fillMeter.DownloadStarted()
+		defer job.fillMeter.DownloadStopped(job.cancelCtx)
+	}
+
+	// Create, open and truncate cache file for writing object into it. This is
+	// done under the lock so that Detach moves the file either before it is
+	// created or after it is opened.
+	job.mu.Lock()
 	cacheFile, err := cacheutil.CreateFile(job.fileSpec, os.O_TRUNC|os.O_WRONLY)
+	job.mu.Unlock()
 	if err != nil {
 		err = fmt.Errorf("downloadObjectAsync: error in creating cache file: %w", err)
 		job.failWhileDownloading(err)
@@ -348,7 +443,10 @@ func (job *Job) downloadObjectAsync() {
 				}
 
 				// Copy the contents from NewReader to cache file.
-				_, readErr := io.CopyN(cacheFile, newReader, maxRead)
+				copied, readErr := io.CopyN(cacheFile, newReader, maxRead)
+				if job.fillMeter != nil {
+					job.fillMeter.Downloaded(job.cancelCtx, copied)
+				}
 				if readErr != nil {
 					// Context is canceled when job.cancel is called at the time of
 					// invalidation and hence caller should be notified as invalid.
@@ -393,6 +491,7 @@ func (job *Job) downloadObjectAsync() {
 					return
 				}
 			} else {
+				job.writeSharedEntry()
 				job.mu.Lock()
 				job.status.Name = Completed
 				job.notifySubscribers()
@@ -423,7 +522,8 @@ func (job *Job) Download(ctx context.Context, offset int64, waitForDownload bool
 	} else if job.status.Name == NotStarted {
 		// Start the async download
 		job.status.Name = Downloading
-		job.cancelCtx, job.cancelFunc = context.WithCancel(context.Background())
+		// The requests of the download count for the op starting it.
+		job.cancelCtx, job.cancelFunc = context.WithCancel(gcs.WithRequestCounterOf(context.Background(), ctx))
 		go job.downloadObjectAsync()
 	} else if job.status.Name == Failed || job.status.Name == Invalid || job.status.Offset >= offset {
 		defer job.mu.Unlock()
@@ -444,6 +544,11 @@ func (job *Job) Download(ctx context.Context, offset int64, waitForDownload bool
 	// Wait till subscriber is notified or the context is cancelled.
 	select {
 	case <-ctx.Done():
+		// Stop waiting without affecting the async download, which other readers
+		// of the object may still be waiting on.
+		job.mu.Lock()
+		job.unsubscribe(notificationC)
+		job.mu.Unlock()
 		err = fmt.Errorf("Download: %w", ctx.Err())
 	case jobStatus = <-notificationC:
 	}
@@ -20,7 +20,6 @@ import (
 	"errors"
 	"fmt"
 	"os"
-	"path"
 	"reflect"
 	"strings"
 	"sync"
@@ -111,7 +110,7 @@ func (dt *downloaderTest) verifyFileInfoEntry(offset uint64) {
 }
 
 func (dt *downloaderTest) fileCachePath(bucketName string, objectName string) string {
-	return path.Join(cacheDir, bucketName, objectName)
+	return util.GetDownloadPath(cacheDir, util.GetObjectPath(bucketName, objectName))
 }
 
 func (dt *downloaderTest) Test_init() {
@@ -148,6 +147,19 @@ func (dt *downloaderTest) Test_subscribe() {
 	AssertEq(1, dt.job.subscribers.Back().Value.(jobSubscriber).subscribedOffset)
 }
 
+func (dt *downloaderTest) Test_unsubscribe() {
+	notificationC1 := dt.job.subscribe(0)
+	_ = dt.job.subscribe(1)
+
+	dt.job.unsubscribe(notificationC1)
+
+	AssertEq(1, dt.job.subscribers.Len())
+	AssertEq(1, dt.job.subscribers.Front().Value.(jobSubscriber).subscribedOffset)
+	// Unsubscribing again is a no-op.
+	dt.job.unsubscribe(notificationC1)
+	AssertEq(1, dt.job.subscribers.Len())
+}
+
 func (dt *downloaderTest) Test_notifySubscriber_Failed() {
 	subscriberOffset := int64(1)
 	notificationC := dt.job.subscribe(subscriberOffset)
@@ -780,3 +792,41 @@ func (dt *downloaderTest) Test_Invalidate_Download_Concurrent() {
 	defer dt.job.mu.Unlock()
 	AssertEq(nil, dt.job.removeJobCallback)
 }
+
+func (dt *downloaderTest) Test_Download_CancelledWaitersDoNotAffectOthers() {
+	objectName := "path/in/gcs/foo.txt"
+	objectSize := 16 * util.MiB
+	objectContent := testutil.GenerateRandomBytes(objectSize)
+	dt.initJobTest(objectName, objectContent, DefaultSequentialReadSizeMb, uint64(objectSize*2), func() {})
+	cancelledCtx, cancelFunc := context.WithCancel(context.Background())
+	cancelFunc()
+	wg := sync.WaitGroup{}
+	downloadFunc := func(ctx context.Context) {
+		defer wg.Done()
+		jobStatus, err := dt.job.Download(ctx, int64(objectSize), true)
+		if ctx.Err() != nil {
+			// Either the waiter gave up or the download was already complete.
+			AssertTrue(errors.Is(err, context.Canceled) || jobStatus.Offset == int64(objectSize))
+			return
+		}
+		AssertEq(nil, err)
+		AssertEq(objectSize, jobStatus.Offset)
+	}
+
+	// Half of the waiters give up straight away.
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		if i%2 == 0 {
+			go downloadFunc(cancelledCtx)
+		} else {
+			go downloadFunc(context.Background())
+		}
+	}
+	wg.Wait()
+
+	dt.job.mu.Lock()
+	defer dt.job.mu.Unlock()
+	AssertEq(Completed, dt.job.status.Name)
+	AssertEq(0, dt.job.subscribers.Len())
+	dt.verifyFile(objectContent)
+}
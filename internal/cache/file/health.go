@@ -0,0 +1,216 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/data"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/util"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/monitor"
+	"github.com/jacobsa/timeutil"
+)
+
+const (
+	// diskErrorCooldown is how long no files are added to the cache after a
+	// disk error.
+	diskErrorCooldown = time.Minute
+
+	// bypassDiskErrors is the number of disk errors, each within
+	// diskErrorWindow of the one before, after which the cache is bypassed
+	// altogether until a health probe succeeds.
+	bypassDiskErrors = 3
+	diskErrorWindow  = 10 * time.Minute
+
+	// healthProbeInterval is how often a bypassed cache is probed.
+	healthProbeInterval = 30 * time.Second
+
+	// healthProbeFileName is the name of the file written to each cache
+	// directory to probe it.
+	healthProbeFileName = ".gcsfuse-health-probe"
+)
+
+// isDiskError returns true if err was caused by the disk holding the cache
+// failing or filling up, as opposed to GCS or the bookkeeping of the cache.
+func isDiskError(err error) bool {
+	return errors.Is(err, syscall.ENOSPC) ||
+		errors.Is(err, syscall.EDQUOT) ||
+		errors.Is(err, syscall.EIO) ||
+		errors.Is(err, syscall.EROFS)
+}
+
+// cacheHealth tracks the disk errors of the cache, so that reads go to GCS
+// rather than fail while the disk is full or failing. After a disk error no
+// files are added to the cache for diskErrorCooldown, and after
+// bypassDiskErrors of them in a row the cache isn't used at all until a
+// health probe succeeds.
+//
+// Safe for concurrent access.
+type cacheHealth struct {
+	clock timeutil.Clock
+	mu    sync.Mutex
+
+	// No files are added to the cache before admitAfter.
+	//
+	// GUARDED_BY(mu)
+	admitAfter time.Time
+
+	// The number of disk errors in a row, each within diskErrorWindow of the
+	// one before, and the time of the last one.
+	//
+	// GUARDED_BY(mu)
+	diskErrors    int
+	lastDiskError time.Time
+
+	// bypassed is set while the cache isn't used at all, in which case it's
+	// probed again at nextProbe.
+	//
+	// GUARDED_BY(mu)
+	bypassed  bool
+	nextProbe time.Time
+}
+
+// recordDiskError records that the cache failed with the given disk error.
+func (h *cacheHealth) recordDiskError(err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := h.clock.Now()
+	if now.Sub(h.lastDiskError) > diskErrorWindow {
+		h.diskErrors = 0
+	}
+	h.diskErrors++
+	h.lastDiskError = now
+	h.admitAfter = now.Add(diskErrorCooldown)
+
+	bypass := !h.bypassed && h.diskErrors >= bypassDiskErrors
+	if bypass {
+		h.bypassed = true
+		h.nextProbe = now.Add(healthProbeInterval)
+		logger.Errorf("File cache: bypassing the cache after %d disk errors in a row, the last one: %v", h.diskErrors, err)
+	} else {
+		logger.Warnf("File cache: not adding files to the cache for %v after a disk error: %v", diskErrorCooldown, err)
+	}
+	monitor.CaptureFileCacheDiskErrorMetrics(context.Background(), bypass)
+}
+
+// admitting returns true if files may be added to the cache.
+func (h *cacheHealth) admitting() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return !h.bypassed && !h.clock.Now().Before(h.admitAfter)
+}
+
+// usable returns true unless the cache is bypassed. A bypassed cache is
+// checked with probe every healthProbeInterval, and used again once probe
+// succeeds.
+func (h *cacheHealth) usable(probe func() error) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if !h.bypassed {
+		return true
+	}
+	now := h.clock.Now()
+	if now.Before(h.nextProbe) {
+		return false
+	}
+
+	h.nextProbe = now.Add(healthProbeInterval)
+	if err := probe(); err != nil {
+		logger.Warnf("File cache: health probe failed, still bypassing the cache: %v", err)
+		return false
+	}
+
+	logger.Infof("File cache: health probe succeeded, using the cache again")
+	h.bypassed = false
+	h.diskErrors = 0
+	h.admitAfter = time.Time{}
+	return true
+}
+
+// probeCacheDirs writes a file to each cache directory that isn't known to be
+// unusable, and removes it again.
+//
+// Requires Lock(chr.mu)
+func (chr *CacheHandler) probeCacheDirs() error {
+	buf := make([]byte, 4*util.KiB)
+	for _, d := range chr.cacheDirs {
+		if d.failed {
+			continue
+		}
+
+		probePath := path.Join(d.Path, healthProbeFileName)
+		f, err := os.OpenFile(probePath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, chr.filePerm)
+		if err != nil {
+			return err
+		}
+		_, err = f.Write(buf)
+		if err == nil {
+			err = f.Sync()
+		}
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if removeErr := os.Remove(probePath); err == nil {
+			err = removeErr
+		}
+		if err != nil {
+			return fmt.Errorf("probing %s: %w", d.Path, err)
+		}
+	}
+	return nil
+}
+
+// evictAfterDiskError records the given disk error, and evicts the entry for
+// the file with the given key, which can't be trusted after it.
+//
+// Requires Lock(chr.mu)
+func (chr *CacheHandler) evictAfterDiskError(fileInfoKey data.FileInfoKey, diskErr error) {
+	chr.health.recordDiskError(diskErr)
+
+	fileInfoKeyName, err := fileInfoKey.Key()
+	if err != nil {
+		return
+	}
+	erasedVal := chr.fileInfoCache.Erase(fileInfoKeyName)
+	if erasedVal == nil {
+		return
+	}
+	fileInfo := erasedVal.(data.FileInfo)
+	if err = chr.cleanUpEvictedFile(&fileInfo); err != nil {
+		logger.Warnf("File cache: while evicting %s:/%s after a disk error: %v", fileInfoKey.BucketName, fileInfoKey.ObjectName, err)
+	}
+}
+
+// reportDiskError is called by a CacheHandle when reading the file for the
+// given object failed with a disk error.
+//
+// Acquires and releases Lock(chr.mu)
+func (chr *CacheHandler) reportDiskError(objectName string, bucketName string, diskErr error) {
+	chr.mu.Lock()
+	defer chr.mu.Unlock()
+
+	chr.evictAfterDiskError(data.FileInfoKey{BucketName: bucketName, ObjectName: objectName}, diskErr)
+}
@@ -0,0 +1,62 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/util"
+	. "github.com/jacobsa/ogletest"
+)
+
+// failWrites makes writes to the file at the given path fail with ENOSPC, as
+// on a full disk. Evicting the file can't truncate /dev/full, so the file
+// stays in place.
+func failWrites(filePath string) {
+	AssertEq(nil, os.MkdirAll(filepath.Dir(filePath), util.DefaultDirPerm))
+	AssertEq(nil, os.Symlink("/dev/full", filePath))
+}
+
+func (t *healthTest) Test_Read_WriteFailureEvictsEntry() {
+	failWrites(t.downloadPath)
+
+	_, _, err := t.read()
+
+	AssertNe(nil, err)
+	ExpectTrue(util.IsCacheHandleInvalid(err))
+	ExpectTrue(isDiskError(err))
+	ExpectEq(nil, t.fileInfo())
+	ExpectFalse(t.cacheHandler.health.admitting())
+}
+
+func (t *healthTest) Test_Read_RepeatedWriteFailuresBypassCache() {
+	failWrites(t.downloadPath)
+
+	for i := 0; i < bypassDiskErrors; i++ {
+		if i > 0 {
+			t.clock.AdvanceTime(diskErrorCooldown)
+		}
+		_, _, err := t.read()
+		AssertNe(nil, err)
+		AssertTrue(isDiskError(err))
+	}
+
+	_, err := t.cacheHandler.GetCacheHandle(t.object, t.bucket, false, 0)
+	AssertNe(nil, err)
+	ExpectTrue(strings.Contains(err.Error(), util.CacheUnavailableErrMsg))
+	ExpectFalse(t.cacheHandler.health.admitting())
+}
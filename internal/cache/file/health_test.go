@@ -0,0 +1,252 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/data"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/file/downloader"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/lru"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/util"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/locker"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	. "github.com/jacobsa/ogletest"
+	"github.com/jacobsa/timeutil"
+)
+
+const healthTestObjectSize = util.MiB + 5
+
+var errDiskFull = fmt.Errorf("write: %w", syscall.ENOSPC)
+
+func TestHealth(t *testing.T) { RunTests(t) }
+
+type healthTest struct {
+	fakeStorage  storage.FakeStorage
+	bucket       gcs.Bucket
+	object       *gcs.MinObject
+	content      []byte
+	cache        *lru.Cache
+	cacheHandler *CacheHandler
+	cacheDir     string
+	downloadPath string
+	clock        timeutil.SimulatedClock
+	probes       int
+}
+
+func init() { RegisterTestSuite(&healthTest{}) }
+
+func (t *healthTest) SetUp(*TestInfo) {
+	var err error
+	locker.EnableInvariantsCheck()
+	t.cacheDir, err = os.MkdirTemp("", "health_test")
+	AssertEq(nil, err)
+
+	t.fakeStorage = storage.NewFakeStorage()
+	t.bucket = t.fakeStorage.CreateStorageHandle().BucketHandle(storage.TestBucketName, "")
+	t.content = make([]byte, healthTestObjectSize)
+	_, err = rand.Read(t.content)
+	AssertEq(nil, err)
+	ctx := context.Background()
+	err = storageutil.CreateObjects(ctx, t.bucket, map[string][]byte{TestObjectName: t.content})
+	AssertEq(nil, err)
+	t.object, _, err = t.bucket.StatObject(ctx, &gcs.StatObjectRequest{Name: TestObjectName, ForceFetchFromGcs: true})
+	AssertEq(nil, err)
+
+	t.cache = lru.NewCache(2 * healthTestObjectSize)
+	jobManager := downloader.NewJobManager(t.cache, util.DefaultFilePerm, util.DefaultDirPerm, t.cacheDir, DefaultSequentialReadSizeMb)
+	t.cacheHandler = NewCacheHandler(t.cache, jobManager, t.cacheDir, util.DefaultFilePerm, util.DefaultDirPerm)
+	t.downloadPath = util.GetDownloadPath(t.cacheDir, util.GetObjectPath(t.bucket.Name(), t.object.Name))
+
+	t.clock.SetTime(time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC))
+	t.cacheHandler.health.clock = &t.clock
+}
+
+func (t *healthTest) TearDown() {
+	_ = t.cacheHandler.Destroy()
+	t.fakeStorage.ShutDown()
+	_ = os.RemoveAll(t.cacheDir)
+}
+
+// probe is a health probe that fails with err, counting its calls.
+func (t *healthTest) probe(err error) func() error {
+	return func() error {
+		t.probes++
+		return err
+	}
+}
+
+// bypass records enough disk errors in a row to bypass the cache, each after
+// the cooldown of the one before.
+func (t *healthTest) bypass() {
+	for i := 0; i < bypassDiskErrors; i++ {
+		if i > 0 {
+			t.clock.AdvanceTime(diskErrorCooldown + time.Second)
+		}
+		t.cacheHandler.health.recordDiskError(errDiskFull)
+	}
+}
+
+func (t *healthTest) fileInfo() *data.FileInfo {
+	key, err := data.FileInfoKey{BucketName: t.bucket.Name(), ObjectName: t.object.Name}.Key()
+	AssertEq(nil, err)
+	val := t.cache.LookUpWithoutChangingOrder(key)
+	if val == nil {
+		return nil
+	}
+	fileInfo := val.(data.FileInfo)
+	return &fileInfo
+}
+
+// read reads the whole test object through the cache.
+func (t *healthTest) read() (dst []byte, cacheHit bool, err error) {
+	cacheHandle, err := t.cacheHandler.GetCacheHandle(t.object, t.bucket, false, 0)
+	if err != nil {
+		return
+	}
+	defer cacheHandle.Close()
+
+	dst = make([]byte, t.object.Size)
+	_, cacheHit, err = cacheHandle.Read(context.Background(), t.bucket, t.object, 0, dst)
+	return
+}
+
+////////////////////////////////////////////////////////////////////////
+// Tests
+////////////////////////////////////////////////////////////////////////
+
+func (t *healthTest) Test_IsDiskError() {
+	ExpectTrue(isDiskError(errDiskFull))
+	ExpectTrue(isDiskError(&os.PathError{Op: "read", Path: "foo", Err: syscall.EIO}))
+	ExpectFalse(isDiskError(errors.New("taco")))
+	ExpectFalse(isDiskError(fmt.Errorf("open: %w", os.ErrNotExist)))
+}
+
+func (t *healthTest) Test_DiskError_StopsAdmissionForCooldown() {
+	health := &t.cacheHandler.health
+	AssertTrue(health.admitting())
+
+	health.recordDiskError(errDiskFull)
+
+	ExpectFalse(health.admitting())
+	ExpectTrue(health.usable(t.probe(nil)))
+	t.clock.AdvanceTime(diskErrorCooldown + time.Second)
+	ExpectTrue(health.admitting())
+	ExpectEq(0, t.probes)
+}
+
+func (t *healthTest) Test_SpacedDiskErrors_DontBypass() {
+	health := &t.cacheHandler.health
+
+	for i := 0; i < 2*bypassDiskErrors; i++ {
+		health.recordDiskError(errDiskFull)
+		t.clock.AdvanceTime(diskErrorWindow + time.Second)
+	}
+
+	ExpectTrue(health.usable(t.probe(nil)))
+	ExpectTrue(health.admitting())
+}
+
+func (t *healthTest) Test_RepeatedDiskErrors_BypassUntilProbeSucceeds() {
+	health := &t.cacheHandler.health
+
+	t.bypass()
+
+	// Not probed again until the probe interval has passed.
+	ExpectFalse(health.usable(t.probe(nil)))
+	ExpectEq(0, t.probes)
+	t.clock.AdvanceTime(healthProbeInterval)
+	ExpectFalse(health.usable(t.probe(errDiskFull)))
+	ExpectEq(1, t.probes)
+	ExpectFalse(health.usable(t.probe(nil)))
+	ExpectEq(1, t.probes)
+	t.clock.AdvanceTime(healthProbeInterval)
+	ExpectTrue(health.usable(t.probe(nil)))
+	ExpectEq(2, t.probes)
+	ExpectTrue(health.admitting())
+}
+
+func (t *healthTest) Test_GetCacheHandle_NoAdmissionAfterDiskError() {
+	t.cacheHandler.health.recordDiskError(errDiskFull)
+
+	_, err := t.cacheHandler.GetCacheHandle(t.object, t.bucket, false, 0)
+
+	AssertNe(nil, err)
+	ExpectTrue(strings.Contains(err.Error(), util.CacheUnavailableErrMsg))
+	ExpectEq(nil, t.fileInfo())
+}
+
+func (t *healthTest) Test_GetCacheHandle_ServesCachedFileDuringCooldown() {
+	_, _, err := t.read()
+	AssertEq(nil, err)
+	t.cacheHandler.health.recordDiskError(errDiskFull)
+
+	buf, cacheHit, err := t.read()
+
+	AssertEq(nil, err)
+	ExpectTrue(cacheHit)
+	ExpectTrue(string(t.content) == string(buf))
+}
+
+func (t *healthTest) Test_GetCacheHandle_Bypassed() {
+	_, _, err := t.read()
+	AssertEq(nil, err)
+	t.bypass()
+
+	_, err = t.cacheHandler.GetCacheHandle(t.object, t.bucket, false, 0)
+
+	AssertNe(nil, err)
+	ExpectTrue(strings.Contains(err.Error(), util.CacheUnavailableErrMsg))
+}
+
+func (t *healthTest) Test_GetCacheHandle_UsesCacheAgainAfterProbe() {
+	t.bypass()
+	t.clock.AdvanceTime(healthProbeInterval)
+
+	buf, _, err := t.read()
+
+	AssertEq(nil, err)
+	ExpectTrue(string(t.content) == string(buf))
+	ExpectNe(nil, t.fileInfo())
+	_, err = os.Stat(path.Join(t.cacheDir, healthProbeFileName))
+	ExpectTrue(os.IsNotExist(err))
+}
+
+func (t *healthTest) Test_Read_DiskErrorEvictsEntry() {
+	buf, _, err := t.read()
+	AssertEq(nil, err)
+	AssertTrue(string(t.content) == string(buf))
+	cacheHandle, err := t.cacheHandler.GetCacheHandle(t.object, t.bucket, false, 0)
+	AssertEq(nil, err)
+	defer cacheHandle.Close()
+
+	cacheHandle.reportDiskError(errDiskFull)
+
+	ExpectEq(nil, t.fileInfo())
+	ExpectFalse(t.cacheHandler.health.admitting())
+	_, err = os.Stat(t.downloadPath)
+	ExpectTrue(os.IsNotExist(err))
+}
@@ -0,0 +1,176 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/util"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
+)
+
+// layoutsOf returns the layouts to look for files in, in the given cache
+// directory: that of new files, and util.FlatLayout until the files left in
+// it by earlier versions of gcsfuse have been migrated.
+//
+// Requires Lock(chr.mu)
+func (chr *CacheHandler) layoutsOf(d *cacheDirState) []util.PathResolver {
+	if d.flat {
+		return []util.PathResolver{chr.paths, util.FlatLayout}
+	}
+	return []util.PathResolver{chr.paths}
+}
+
+// MigrateLayout moves the files that earlier versions of gcsfuse left in the
+// cache directories in util.FlatLayout, and their data.SharedEntry, to the
+// layout of new files in the background, until Destroy is called. Until then,
+// files are looked up in both layouts. It also removes the files of superseded
+// entries left by an earlier process. In a shared cache, only its owner does
+// so, once it owns the cache.
+//
+// Acquires and releases Lock(chr.mu)
+func (chr *CacheHandler) MigrateLayout() {
+	chr.mu.Lock()
+	defer chr.mu.Unlock()
+
+	chr.migrateLayout = true
+	if chr.lockFile == nil || chr.owner {
+		chr.removeSupersededLeftovers()
+		chr.startLayoutMigration()
+	}
+}
+
+// startLayoutMigration starts moving the files in util.FlatLayout in the
+// background, unless it has already started or there are none.
+//
+// Requires Lock(chr.mu)
+func (chr *CacheHandler) startLayoutMigration() {
+	if chr.stopLayoutMigration != nil {
+		return
+	}
+
+	var dirs []*cacheDirState
+	for _, d := range chr.cacheDirs {
+		if d.flat && !d.failed {
+			dirs = append(dirs, d)
+		}
+	}
+	if len(dirs) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for _, d := range dirs {
+			chr.migrateCacheDir(ctx, d)
+		}
+	}()
+
+	chr.stopLayoutMigration = func() {
+		cancel()
+		<-done
+	}
+}
+
+// migrateCacheDir moves the files in util.FlatLayout in the given cache
+// directory to the layout of new files, returning early if ctx is cancelled.
+func (chr *CacheHandler) migrateCacheDir(ctx context.Context, d *cacheDirState) {
+	logger.Infof("Migrating the files in file cache directory %s to a sharded layout", d.Path)
+
+	// The files, along with their data.SharedEntry.
+	names, _ := util.FlatLayoutDirs(d.Path)
+	for _, name := range names {
+		walkFlatLayoutDir(ctx, path.Join(d.Path, name), func(filePath string) {
+			objectPath := strings.TrimPrefix(filePath, d.Path+"/")
+			chr.migrateFile(d.Path, objectPath)
+		})
+	}
+
+	// The data.SharedEntry left without a file.
+	entriesDir := path.Join(d.Path, util.SharedEntriesDir)
+	names, _ = util.FlatLayoutDirs(entriesDir)
+	for _, name := range names {
+		walkFlatLayoutDir(ctx, path.Join(entriesDir, name), func(entryPath string) {
+			_ = os.Remove(entryPath)
+		})
+	}
+
+	if ctx.Err() != nil {
+		return
+	}
+
+	chr.mu.Lock()
+	d.flat = false
+	chr.mu.Unlock()
+	logger.Infof("Migrated the files in file cache directory %s to a sharded layout", d.Path)
+}
+
+// walkFlatLayoutDir calls f with the path of every file under the given
+// directory, and then removes the directories emptied, unless ctx is cancelled
+// on the way.
+func walkFlatLayoutDir(ctx context.Context, root string, f func(filePath string)) {
+	var dirs []string
+	err := filepath.WalkDir(root, func(p string, dirEntry fs.DirEntry, err error) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			return nil
+		}
+		if dirEntry.IsDir() {
+			dirs = append(dirs, p)
+		} else {
+			f(p)
+		}
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	// The deepest first.
+	for i := len(dirs) - 1; i >= 0; i-- {
+		_ = os.Remove(dirs[i])
+	}
+}
+
+// migrateFile moves the file for the given object path in the given cache
+// directory, and its data.SharedEntry if any, from util.FlatLayout to the
+// layout of new files. If a file for the object has been downloaded there
+// meanwhile, the old one is removed instead.
+func (chr *CacheHandler) migrateFile(cacheDir string, objectPath string) {
+	oldPath := util.FlatLayout.DownloadPath(cacheDir, objectPath)
+	newPath := chr.paths.DownloadPath(cacheDir, objectPath)
+	oldEntryPath := util.FlatLayout.SharedEntryPath(cacheDir, objectPath)
+	newEntryPath := chr.paths.SharedEntryPath(cacheDir, objectPath)
+
+	// Linking rather than renaming leaves a file downloaded meanwhile alone, and
+	// moving the data.SharedEntry after its file lets other processes find both
+	// in one layout or the other throughout.
+	if os.MkdirAll(filepath.Dir(newPath), chr.dirPerm) == nil && os.Link(oldPath, newPath) == nil {
+		if _, err := os.Stat(oldEntryPath); err == nil && os.MkdirAll(filepath.Dir(newEntryPath), chr.dirPerm) == nil {
+			_ = os.Link(oldEntryPath, newEntryPath)
+		}
+	}
+	_ = os.Remove(oldEntryPath)
+	_ = os.Remove(oldPath)
+}
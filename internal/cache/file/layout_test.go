@@ -0,0 +1,272 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/data"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/file/downloader"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/lru"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/util"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/locker"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	. "github.com/jacobsa/ogletest"
+)
+
+const layoutTestObjectSize = util.MiB + 5
+
+func TestLayout(t *testing.T) { RunTests(t) }
+
+type layoutTest struct {
+	fakeStorage storage.FakeStorage
+	bucket      gcs.Bucket
+	objects     []*gcs.MinObject
+	contents    map[string][]byte
+	cacheDir    string
+	processes   []sharedCacheProcess
+}
+
+func init() { RegisterTestSuite(&layoutTest{}) }
+
+func (t *layoutTest) SetUp(*TestInfo) {
+	var err error
+	locker.EnableInvariantsCheck()
+	t.cacheDir, err = os.MkdirTemp("", "layout_test")
+	AssertEq(nil, err)
+
+	t.fakeStorage = storage.NewFakeStorage()
+	t.bucket = t.fakeStorage.CreateStorageHandle().BucketHandle(storage.TestBucketName, "")
+	t.contents = make(map[string][]byte)
+	for _, name := range []string{"dir/a.txt", "dir/b.txt"} {
+		content := make([]byte, layoutTestObjectSize)
+		_, err = rand.Read(content)
+		AssertEq(nil, err)
+		t.contents[name] = content
+	}
+
+	ctx := context.Background()
+	err = storageutil.CreateObjects(ctx, t.bucket, t.contents)
+	AssertEq(nil, err)
+	for _, name := range []string{"dir/a.txt", "dir/b.txt"} {
+		object, _, err := t.bucket.StatObject(ctx, &gcs.StatObjectRequest{Name: name, ForceFetchFromGcs: true})
+		AssertEq(nil, err)
+		t.objects = append(t.objects, object)
+	}
+}
+
+func (t *layoutTest) TearDown() {
+	for _, p := range t.processes {
+		_ = p.cacheHandler.Destroy()
+	}
+	t.fakeStorage.ShutDown()
+	_ = os.RemoveAll(t.cacheDir)
+}
+
+// newProcess returns a process with a cache, shared or read-only as told.
+func (t *layoutTest) newProcess(shared bool, readOnly bool) (p sharedCacheProcess) {
+	p.cache = lru.NewCache(4 * layoutTestObjectSize)
+	p.jobManager = downloader.NewJobManager(p.cache, util.DefaultFilePerm, util.DefaultDirPerm, t.cacheDir, DefaultSequentialReadSizeMb)
+	p.cacheHandler = NewCacheHandler(p.cache, p.jobManager, t.cacheDir, util.DefaultFilePerm, util.DefaultDirPerm)
+	if shared {
+		AssertEq(nil, p.cacheHandler.EnableSharing())
+	}
+	if readOnly {
+		p.cacheHandler.EnableReadOnly()
+	}
+	t.processes = append(t.processes, p)
+	return
+}
+
+func (t *layoutTest) objectPath(object *gcs.MinObject) string {
+	return util.GetObjectPath(t.bucket.Name(), object.Name)
+}
+
+// download reads the given objects through the cache of a process sharing it,
+// which then exits, leaving the files in the layout of new files.
+func (t *layoutTest) download(objects ...*gcs.MinObject) {
+	p := t.newProcess(true, false)
+	for _, object := range objects {
+		cacheHandle, err := p.cacheHandler.GetCacheHandle(object, t.bucket, false, 0)
+		AssertEq(nil, err)
+		dst := make([]byte, object.Size)
+		_, _, err = cacheHandle.Read(context.Background(), t.bucket, object, 0, dst)
+		AssertEq(nil, err)
+		cacheHandle.Close()
+		for {
+			if _, err := os.Stat(util.ShardedLayout.SharedEntryPath(t.cacheDir, t.objectPath(object))); err == nil {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	AssertEq(nil, p.cacheHandler.Destroy())
+}
+
+// flatten moves the files of the given objects, and their data.SharedEntry,
+// to util.FlatLayout, as earlier versions of gcsfuse laid them out.
+func (t *layoutTest) flatten(objects ...*gcs.MinObject) {
+	for _, object := range objects {
+		objectPath := t.objectPath(object)
+		t.move(util.ShardedLayout.DownloadPath(t.cacheDir, objectPath), util.FlatLayout.DownloadPath(t.cacheDir, objectPath))
+		t.move(util.ShardedLayout.SharedEntryPath(t.cacheDir, objectPath), util.FlatLayout.SharedEntryPath(t.cacheDir, objectPath))
+	}
+}
+
+func (t *layoutTest) move(oldPath string, newPath string) {
+	AssertEq(nil, os.MkdirAll(filepath.Dir(newPath), util.DefaultDirPerm))
+	AssertEq(nil, os.Rename(oldPath, newPath))
+}
+
+// expectCacheHit expects the given object to be read whole from the cache of
+// the given process.
+func (t *layoutTest) expectCacheHit(p sharedCacheProcess, object *gcs.MinObject) {
+	cacheHandle, err := p.cacheHandler.GetCacheHandle(object, t.bucket, false, 0)
+	AssertEq(nil, err)
+	defer cacheHandle.Close()
+
+	content := make([]byte, object.Size)
+	_, cacheHit, err := cacheHandle.Read(context.Background(), t.bucket, object, 0, content)
+	AssertEq(nil, err)
+	ExpectTrue(cacheHit, "%s", object.Name)
+	ExpectTrue(bytes.Equal(t.contents[object.Name], content), "%s", object.Name)
+}
+
+// expectSharded expects the file of the given object, with its content, only
+// in the layout of new files.
+func (t *layoutTest) expectSharded(object *gcs.MinObject) {
+	objectPath := t.objectPath(object)
+	content, err := os.ReadFile(util.ShardedLayout.DownloadPath(t.cacheDir, objectPath))
+	AssertEq(nil, err)
+	ExpectTrue(bytes.Equal(t.contents[object.Name], content), "%s", object.Name)
+	_, err = os.Stat(util.FlatLayout.DownloadPath(t.cacheDir, objectPath))
+	ExpectTrue(os.IsNotExist(err), "%s: %v", object.Name, err)
+}
+
+func (t *layoutTest) isFlat(p sharedCacheProcess) bool {
+	p.cacheHandler.mu.Lock()
+	defer p.cacheHandler.mu.Unlock()
+	return p.cacheHandler.cacheDirs[0].flat
+}
+
+func (t *layoutTest) isEntryInFileInfoCache(p sharedCacheProcess, object *gcs.MinObject) bool {
+	key, err := data.FileInfoKey{BucketName: t.bucket.Name(), ObjectName: object.Name}.Key()
+	AssertEq(nil, err)
+	return p.cache.LookUpWithoutChangingOrder(key) != nil
+}
+
+////////////////////////////////////////////////////////////////////////
+// Tests
+////////////////////////////////////////////////////////////////////////
+
+func (t *layoutTest) Test_NewCacheHandler_DetectsFlatLayout() {
+	t.download(t.objects...)
+	ExpectFalse(t.isFlat(t.newProcess(false, true)))
+
+	t.flatten(t.objects[0])
+
+	ExpectTrue(t.isFlat(t.newProcess(false, true)))
+}
+
+func (t *layoutTest) Test_ReadOnly_ReadsFilesInBothLayouts() {
+	t.download(t.objects...)
+	t.flatten(t.objects[0])
+
+	p := t.newProcess(false, true)
+
+	t.expectCacheHit(p, t.objects[0])
+	t.expectCacheHit(p, t.objects[1])
+}
+
+func (t *layoutTest) Test_ReadOnly_ReadsFilesMidMigration() {
+	t.download(t.objects...)
+	t.flatten(t.objects...)
+	p := t.newProcess(false, true)
+	migrator := t.newProcess(false, false)
+	t.expectCacheHit(p, t.objects[0])
+
+	// One file moved, the other not yet.
+	migrator.cacheHandler.migrateFile(t.cacheDir, t.objectPath(t.objects[0]))
+
+	t.expectSharded(t.objects[0])
+	t.expectCacheHit(p, t.objects[0])
+	t.expectCacheHit(p, t.objects[1])
+
+	// All moved.
+	migrator.cacheHandler.migrateCacheDir(context.Background(), migrator.cacheHandler.cacheDirs[0])
+
+	t.expectSharded(t.objects[1])
+	ExpectFalse(util.HasFlatLayout(t.cacheDir))
+	ExpectFalse(t.isFlat(migrator))
+	t.expectCacheHit(p, t.objects[0])
+	t.expectCacheHit(p, t.objects[1])
+}
+
+func (t *layoutTest) Test_MigrateFile_KeepsFileDownloadedMeanwhile() {
+	t.download(t.objects[0])
+	objectPath := t.objectPath(t.objects[0])
+	flatPath := util.FlatLayout.DownloadPath(t.cacheDir, objectPath)
+	AssertEq(nil, os.MkdirAll(filepath.Dir(flatPath), util.DefaultDirPerm))
+	AssertEq(nil, os.WriteFile(flatPath, []byte("stale"), util.DefaultFilePerm))
+	p := t.newProcess(false, false)
+
+	p.cacheHandler.migrateFile(t.cacheDir, objectPath)
+
+	t.expectSharded(t.objects[0])
+}
+
+func (t *layoutTest) Test_Owner_MigratesSharedEntriesItAdopts() {
+	t.download(t.objects...)
+	t.flatten(t.objects...)
+
+	p := t.newProcess(true, false)
+
+	AssertTrue(p.cacheHandler.owner)
+	for _, object := range t.objects {
+		t.expectSharded(object)
+		ExpectTrue(t.isEntryInFileInfoCache(p, object), "%s", object.Name)
+		t.expectCacheHit(p, object)
+	}
+}
+
+func (t *layoutTest) Test_MigrateLayout_MovesFilesInBackground() {
+	t.download(t.objects...)
+	t.flatten(t.objects...)
+	// Left without its file.
+	entryPath := util.FlatLayout.SharedEntryPath(t.cacheDir, util.GetObjectPath(t.bucket.Name(), "gone.txt"))
+	AssertEq(nil, os.WriteFile(entryPath, []byte("{}"), util.DefaultFilePerm))
+	p := t.newProcess(false, false)
+	AssertTrue(t.isFlat(p))
+
+	p.cacheHandler.MigrateLayout()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for t.isFlat(p) && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	AssertFalse(t.isFlat(p))
+	ExpectFalse(util.HasFlatLayout(t.cacheDir))
+	for _, object := range t.objects {
+		t.expectSharded(object)
+	}
+}
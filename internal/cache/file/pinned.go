@@ -0,0 +1,79 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+import (
+	"context"
+	"strings"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/data"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/lru"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/monitor"
+)
+
+// SetPinnedPrefixes makes the entries for objects whose names start with one
+// of the given prefixes pinned in fileInfoCache: they're not evicted to make
+// room for others, only when their objects change or are invalidated. Pinned
+// entries add up to at most maxPinnedSize bytes of the size of fileInfoCache;
+// others are cached like the rest.
+//
+// Acquires and releases Lock(chr.mu)
+func (chr *CacheHandler) SetPinnedPrefixes(prefixes []string, maxPinnedSize uint64) {
+	chr.mu.Lock()
+	defer chr.mu.Unlock()
+	chr.pinnedPrefixes = prefixes
+	chr.maxPinnedSize = maxPinnedSize
+}
+
+// isPinned tells whether the entry for the object with the given name is to
+// be pinned.
+//
+// Requires Lock(chr.mu)
+func (chr *CacheHandler) isPinned(objectName string) bool {
+	for _, prefix := range chr.pinnedPrefixes {
+		if strings.HasPrefix(objectName, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// insertFileInfo inserts the entry for a file about to be downloaded into
+// fileInfoCache, pinned if its object is under one of the pinned prefixes and
+// there's room left for it, returning the entries evicted to make room.
+//
+// Requires Lock(chr.mu)
+func (chr *CacheHandler) insertFileInfo(key string, fileInfo data.FileInfo) ([]lru.ValueType, error) {
+	if chr.isPinned(fileInfo.Key.ObjectName) {
+		evictedValues, err := chr.fileInfoCache.InsertPinned(key, fileInfo, chr.maxPinnedSize)
+		if err == nil || err.Error() != lru.PinnedSizeErrorMsg {
+			return evictedValues, err
+		}
+		logger.Warnf("File cache: no room left for pinning %s of %d bytes, caching it unpinned", fileInfo.Key.ObjectName, fileInfo.FileSize)
+		monitor.CaptureFileCachePinFallbackMetrics(context.Background())
+	}
+	return chr.fileInfoCache.Insert(key, fileInfo)
+}
+
+// recordPinnedSize records the size of the pinned entries, if any can be
+// pinned.
+//
+// Requires Lock(chr.mu)
+func (chr *CacheHandler) recordPinnedSize() {
+	if len(chr.pinnedPrefixes) > 0 {
+		monitor.CaptureFileCachePinnedBytesMetrics(context.Background(), int64(chr.fileInfoCache.PinnedSize()))
+	}
+}
@@ -0,0 +1,171 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"math"
+	"os"
+	"testing"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/data"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/file/downloader"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/lru"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/util"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/locker"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	. "github.com/jacobsa/ogletest"
+)
+
+const (
+	pinnedTestObjectSize = util.MiB + 7
+	pinnedTestBatchFiles = 6
+)
+
+func TestPinned(t *testing.T) { RunTests(t) }
+
+type pinnedTest struct {
+	fakeStorage  storage.FakeStorage
+	bucket       gcs.Bucket
+	cacheDir     string
+	cache        *lru.Cache
+	cacheHandler *CacheHandler
+}
+
+func init() { RegisterTestSuite(&pinnedTest{}) }
+
+func (t *pinnedTest) SetUp(*TestInfo) {
+	var err error
+	locker.EnableInvariantsCheck()
+	t.cacheDir, err = os.MkdirTemp("", "pinned_test")
+	AssertEq(nil, err)
+
+	t.fakeStorage = storage.NewFakeStorage()
+	t.bucket = t.fakeStorage.CreateStorageHandle().BucketHandle(storage.TestBucketName, "")
+	// Room for three files.
+	t.cache = lru.NewCache(3 * pinnedTestObjectSize)
+	jobManager := downloader.NewJobManager(t.cache, util.DefaultFilePerm, util.DefaultDirPerm, t.cacheDir, DefaultSequentialReadSizeMb)
+	t.cacheHandler = NewCacheHandler(t.cache, jobManager, t.cacheDir, util.DefaultFilePerm, util.DefaultDirPerm)
+	t.cacheHandler.SetPinnedPrefixes([]string{"models/"}, math.MaxUint64)
+}
+
+func (t *pinnedTest) TearDown() {
+	_ = t.cacheHandler.Destroy()
+	t.fakeStorage.ShutDown()
+	_ = os.RemoveAll(t.cacheDir)
+}
+
+// create creates the object with the given name with random content,
+// returning it.
+func (t *pinnedTest) create(name string) *gcs.MinObject {
+	ctx := context.Background()
+	content := make([]byte, pinnedTestObjectSize)
+	_, err := rand.Read(content)
+	AssertEq(nil, err)
+	err = storageutil.CreateObjects(ctx, t.bucket, map[string][]byte{name: content})
+	AssertEq(nil, err)
+	object, _, err := t.bucket.StatObject(ctx, &gcs.StatObjectRequest{Name: name, ForceFetchFromGcs: true})
+	AssertEq(nil, err)
+	return object
+}
+
+// read reads the whole object through a new CacheHandle, returning whether
+// it was all already in the cache.
+func (t *pinnedTest) read(object *gcs.MinObject) (cacheHit bool) {
+	cacheHandle, err := t.cacheHandler.GetCacheHandle(object, t.bucket, false, 0)
+	AssertEq(nil, err)
+	defer cacheHandle.Close()
+
+	dst := make([]byte, object.Size)
+	n, cacheHit, err := cacheHandle.Read(context.Background(), t.bucket, object, 0, dst)
+	AssertEq(nil, err)
+	AssertEq(object.Size, n)
+	return cacheHit
+}
+
+// readBatch reads more files than the cache has room for.
+func (t *pinnedTest) readBatch() {
+	for i := 0; i < pinnedTestBatchFiles; i++ {
+		ExpectFalse(t.read(t.create(fmt.Sprintf("batch/%d", i))))
+	}
+}
+
+func (t *pinnedTest) isCached(object *gcs.MinObject) bool {
+	key, err := data.FileInfoKey{BucketName: t.bucket.Name(), ObjectName: object.Name}.Key()
+	AssertEq(nil, err)
+	return t.cache.LookUpWithoutChangingOrder(key) != nil
+}
+
+func (t *pinnedTest) Test_PinnedFilesRemainHitsAfterBatchReads() {
+	model := t.create("models/a")
+	ExpectFalse(t.read(model))
+
+	t.readBatch()
+
+	ExpectTrue(t.isCached(model))
+	ExpectTrue(t.read(model))
+	ExpectEq(pinnedTestObjectSize, t.cache.PinnedSize())
+}
+
+func (t *pinnedTest) Test_FilesOutsidePinnedPrefixesAreEvicted() {
+	other := t.create("other/a")
+	ExpectFalse(t.read(other))
+
+	t.readBatch()
+
+	ExpectFalse(t.isCached(other))
+	ExpectFalse(t.read(other))
+	ExpectEq(0, t.cache.PinnedSize())
+}
+
+func (t *pinnedTest) Test_FilesBeyondMaxPinnedSizeAreCachedUnpinned() {
+	t.cacheHandler.SetPinnedPrefixes([]string{"models/"}, pinnedTestObjectSize)
+	first := t.create("models/a")
+	second := t.create("models/b")
+	ExpectFalse(t.read(first))
+	ExpectFalse(t.read(second))
+
+	t.readBatch()
+
+	ExpectTrue(t.read(first))
+	ExpectFalse(t.isCached(second))
+	ExpectEq(pinnedTestObjectSize, t.cache.PinnedSize())
+}
+
+func (t *pinnedTest) Test_PinnedFileIsReplacedWhenItsObjectChanges() {
+	model := t.create("models/a")
+	ExpectFalse(t.read(model))
+
+	newModel := t.create("models/a")
+	AssertNe(model.Generation, newModel.Generation)
+
+	ExpectFalse(t.read(newModel))
+	ExpectTrue(t.read(newModel))
+	ExpectEq(pinnedTestObjectSize, t.cache.PinnedSize())
+}
+
+func (t *pinnedTest) Test_InvalidatingPinnedFileRemovesIt() {
+	model := t.create("models/a")
+	ExpectFalse(t.read(model))
+
+	AssertEq(nil, t.cacheHandler.InvalidateCache(model.Name, t.bucket.Name()))
+
+	ExpectFalse(t.isCached(model))
+	ExpectEq(0, t.cache.PinnedSize())
+}
@@ -0,0 +1,231 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+import (
+	"context"
+	"hash/crc32"
+	"io"
+	"os"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/data"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/util"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/monitor"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/ratelimit"
+	"github.com/jacobsa/timeutil"
+)
+
+const (
+	// scrubChunkSize is the most the scrubber reads from a cached file at once.
+	scrubChunkSize = util.MiB
+
+	// scrubPassInterval is how long the scrubber waits after checking every
+	// file in the cache before starting over.
+	scrubPassInterval = time.Minute
+
+	// scrubPauseInterval is how long the scrubber pauses for each time it finds
+	// the cache busy.
+	scrubPauseInterval = time.Second
+)
+
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+// ScrubberConfig controls the background check of the files in the cache
+// against the CRC32C of their objects.
+type ScrubberConfig struct {
+	// BytesPerSecond bounds the rate at which cached files are read back.
+	BytesPerSecond int64
+
+	// MaxHitsPerSecond pauses the check while more reads than this per second
+	// are served from the cache.
+	MaxHitsPerSecond int64
+}
+
+// scrubber reads back the completely downloaded files in the cache of a
+// CacheHandler, and evicts those whose CRC32C doesn't match that of their
+// object, e.g. because the cache directory was modified by another process.
+type scrubber struct {
+	chr      *CacheHandler
+	cfg      ScrubberConfig
+	clock    timeutil.Clock
+	throttle ratelimit.Throttle
+
+	// pauseInterval is scrubPauseInterval, except in tests.
+	pauseInterval time.Duration
+
+	// The cache hit count and time at the last check of whether the cache is
+	// busy.
+	lastHits  uint64
+	lastCheck time.Time
+}
+
+func newScrubber(chr *CacheHandler, cfg ScrubberConfig, clock timeutil.Clock) *scrubber {
+	capacity := uint64(scrubChunkSize)
+	if uint64(cfg.BytesPerSecond) < capacity {
+		capacity = uint64(cfg.BytesPerSecond)
+	}
+
+	return &scrubber{
+		chr:           chr,
+		cfg:           cfg,
+		clock:         clock,
+		throttle:      ratelimit.NewThrottle(float64(cfg.BytesPerSecond), capacity),
+		pauseInterval: scrubPauseInterval,
+		lastHits:      chr.hits.Load(),
+		lastCheck:     clock.Now(),
+	}
+}
+
+// StartScrubber starts checking the files in the cache in the background
+// according to cfg, until Destroy is called.
+//
+// REQUIRES: cfg.BytesPerSecond > 0
+func (chr *CacheHandler) StartScrubber(cfg ScrubberConfig) {
+	s := newScrubber(chr, cfg, timeutil.RealClock())
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.Run(ctx)
+	}()
+
+	chr.stopScrubber = func() {
+		cancel()
+		<-done
+	}
+}
+
+// Run checks every file in the cache over and over until ctx is cancelled.
+func (s *scrubber) Run(ctx context.Context) {
+	for {
+		s.scrubPass(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(scrubPassInterval):
+		}
+	}
+}
+
+// scrubPass checks every file in the cache once, returning early if ctx is
+// cancelled.
+func (s *scrubber) scrubPass(ctx context.Context) {
+	for _, key := range s.chr.fileInfoCache.Keys() {
+		if ctx.Err() != nil {
+			return
+		}
+		s.scrubFile(ctx, key)
+	}
+}
+
+// scrubFile checks the file in the cache for the given file info cache key,
+// evicting it if it doesn't match its object.
+func (s *scrubber) scrubFile(ctx context.Context, key string) {
+	val := s.chr.fileInfoCache.LookUpWithoutChangingOrder(key)
+	if val == nil {
+		// Evicted since the pass started.
+		return
+	}
+
+	// Only files that are completely downloaded can be compared with their
+	// objects, and objects in CMEK buckets have no CRC32C.
+	fileInfo := val.(data.FileInfo)
+	if fileInfo.CRC32C == nil || fileInfo.Offset < fileInfo.FileSize {
+		return
+	}
+
+	filePath := s.chr.paths.DownloadPath(s.chr.cacheDirOf(&fileInfo), util.GetObjectPath(fileInfo.Key.BucketName, fileInfo.Key.ObjectName))
+	crc, n, err := s.checksum(ctx, filePath)
+	if err != nil {
+		if ctx.Err() == nil {
+			logger.Warnf("Scrubber: while reading %s: %v", filePath, err)
+		}
+		return
+	}
+
+	corrupt := crc != *fileInfo.CRC32C || uint64(n) != fileInfo.FileSize
+	monitor.CaptureFileCacheScrubMetrics(ctx, n, corrupt)
+	if !corrupt {
+		return
+	}
+
+	logger.Errorf("Scrubber: evicting %s:/%s from the file cache: the cached file has %d bytes with CRC32C %08x, the object generation %d has %d bytes with CRC32C %08x",
+		fileInfo.Key.BucketName, fileInfo.Key.ObjectName, n, crc, fileInfo.ObjectGeneration, fileInfo.FileSize, *fileInfo.CRC32C)
+	if err := s.chr.evictIfUnchanged(key, fileInfo); err != nil {
+		logger.Warnf("Scrubber: %v", err)
+	}
+}
+
+// checksum reads back the file at the given path within the byte budget,
+// pausing while the cache is busy, and returns its CRC32C and length.
+func (s *scrubber) checksum(ctx context.Context, filePath string) (crc uint32, n int64, err error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	buf := make([]byte, s.throttle.Capacity())
+	for {
+		if err = s.waitWhileBusy(ctx); err != nil {
+			return
+		}
+		if err = s.throttle.Wait(ctx, uint64(len(buf))); err != nil {
+			return
+		}
+
+		var m int
+		m, err = io.ReadFull(f, buf)
+		crc = crc32.Update(crc, crc32cTable, buf[:m])
+		n += int64(m)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return crc, n, nil
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// waitWhileBusy returns once the cache isn't busy, or with an error if ctx is
+// cancelled first.
+func (s *scrubber) waitWhileBusy(ctx context.Context) error {
+	for s.busy() {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(s.pauseInterval):
+		}
+	}
+	return ctx.Err()
+}
+
+// busy reports whether more reads per second than allowed have been served
+// from the cache since the last call.
+func (s *scrubber) busy() bool {
+	now := s.clock.Now()
+	hits := s.chr.hits.Load()
+	elapsed := now.Sub(s.lastCheck).Seconds()
+	recentHits := float64(hits - s.lastHits)
+	s.lastHits, s.lastCheck = hits, now
+
+	if elapsed <= 0 {
+		return recentHits > 0
+	}
+	return recentHits/elapsed > float64(s.cfg.MaxHitsPerSecond)
+}
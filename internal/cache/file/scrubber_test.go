@@ -0,0 +1,240 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+import (
+	"context"
+	"crypto/rand"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/data"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/file/downloader"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/lru"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/util"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/locker"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	. "github.com/jacobsa/ogletest"
+	"github.com/jacobsa/timeutil"
+)
+
+const scrubTestObjectSize = 3*util.MiB + 5
+
+func TestScrubber(t *testing.T) { RunTests(t) }
+
+type scrubberTest struct {
+	fakeStorage  storage.FakeStorage
+	bucket       gcs.Bucket
+	object       *gcs.MinObject
+	cache        *lru.Cache
+	cacheHandler *CacheHandler
+	cacheDir     string
+	downloadPath string
+	clock        timeutil.SimulatedClock
+	scrubber     *scrubber
+}
+
+func init() { RegisterTestSuite(&scrubberTest{}) }
+
+func (t *scrubberTest) SetUp(*TestInfo) {
+	var err error
+	locker.EnableInvariantsCheck()
+	t.cacheDir, err = os.MkdirTemp("", "scrubber_test")
+	AssertEq(nil, err)
+
+	t.fakeStorage = storage.NewFakeStorage()
+	t.bucket = t.fakeStorage.CreateStorageHandle().BucketHandle(storage.TestBucketName, "")
+	content := make([]byte, scrubTestObjectSize)
+	_, err = rand.Read(content)
+	AssertEq(nil, err)
+	ctx := context.Background()
+	err = storageutil.CreateObjects(ctx, t.bucket, map[string][]byte{TestObjectName: content})
+	AssertEq(nil, err)
+	t.object, _, err = t.bucket.StatObject(ctx, &gcs.StatObjectRequest{Name: TestObjectName, ForceFetchFromGcs: true})
+	AssertEq(nil, err)
+	AssertNe(nil, t.object.CRC32C)
+
+	t.cache = lru.NewCache(2 * scrubTestObjectSize)
+	jobManager := downloader.NewJobManager(t.cache, util.DefaultFilePerm, util.DefaultDirPerm, t.cacheDir, DefaultSequentialReadSizeMb)
+	t.cacheHandler = NewCacheHandler(t.cache, jobManager, t.cacheDir, util.DefaultFilePerm, util.DefaultDirPerm)
+	t.downloadPath = util.GetDownloadPath(t.cacheDir, util.GetObjectPath(t.bucket.Name(), t.object.Name))
+
+	t.clock.SetTime(time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC))
+	t.scrubber = newScrubber(t.cacheHandler, ScrubberConfig{BytesPerSecond: 1 << 30, MaxHitsPerSecond: 10}, &t.clock)
+	t.scrubber.pauseInterval = time.Millisecond
+}
+
+func (t *scrubberTest) TearDown() {
+	_ = t.cacheHandler.Destroy()
+	t.fakeStorage.ShutDown()
+	_ = os.RemoveAll(t.cacheDir)
+}
+
+// download reads the whole test object through the cache, returning once its
+// file in the cache is complete.
+func (t *scrubberTest) download() {
+	cacheHandle, err := t.cacheHandler.GetCacheHandle(t.object, t.bucket, false, 0)
+	AssertEq(nil, err)
+	defer cacheHandle.Close()
+
+	dst := make([]byte, t.object.Size)
+	_, _, err = cacheHandle.Read(context.Background(), t.bucket, t.object, 0, dst)
+	AssertEq(nil, err)
+	for t.fileInfo() == nil || t.fileInfo().Offset < t.object.Size {
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func (t *scrubberTest) fileInfo() *data.FileInfo {
+	key, err := data.FileInfoKey{BucketName: t.bucket.Name(), ObjectName: t.object.Name}.Key()
+	AssertEq(nil, err)
+	val := t.cache.LookUpWithoutChangingOrder(key)
+	if val == nil {
+		return nil
+	}
+	fileInfo := val.(data.FileInfo)
+	return &fileInfo
+}
+
+// corrupt flips a byte of the test object's file in the cache.
+func (t *scrubberTest) corrupt(offset int64) {
+	f, err := os.OpenFile(t.downloadPath, os.O_RDWR, 0)
+	AssertEq(nil, err)
+	defer f.Close()
+
+	b := make([]byte, 1)
+	_, err = f.ReadAt(b, offset)
+	AssertEq(nil, err)
+	b[0] ^= 0xff
+	_, err = f.WriteAt(b, offset)
+	AssertEq(nil, err)
+}
+
+func (t *scrubberTest) Test_ScrubPass_KeepsIntactFile() {
+	t.download()
+
+	t.scrubber.scrubPass(context.Background())
+
+	ExpectNe(nil, t.fileInfo())
+	ExpectTrue(doesFileExist(t.downloadPath))
+}
+
+func (t *scrubberTest) Test_ScrubPass_EvictsCorruptFile() {
+	t.download()
+	t.corrupt(2*util.MiB + 1)
+
+	t.scrubber.scrubPass(context.Background())
+
+	ExpectEq(nil, t.fileInfo())
+	ExpectFalse(doesFileExist(t.downloadPath))
+}
+
+func (t *scrubberTest) Test_ScrubPass_EvictsTruncatedFile() {
+	t.download()
+	AssertEq(nil, os.Truncate(t.downloadPath, util.MiB))
+
+	t.scrubber.scrubPass(context.Background())
+
+	ExpectEq(nil, t.fileInfo())
+	ExpectFalse(doesFileExist(t.downloadPath))
+}
+
+func (t *scrubberTest) Test_ScrubPass_SkipsFileWithoutCRC32C() {
+	t.object.CRC32C = nil
+	t.download()
+	t.corrupt(0)
+
+	t.scrubber.scrubPass(context.Background())
+
+	ExpectNe(nil, t.fileInfo())
+	ExpectTrue(doesFileExist(t.downloadPath))
+}
+
+func (t *scrubberTest) Test_ScrubPass_SkipsIncompleteDownload() {
+	t.download()
+	fileInfo := t.fileInfo()
+	fileInfo.Offset = util.MiB
+	key, err := fileInfo.Key.Key()
+	AssertEq(nil, err)
+	AssertEq(nil, t.cache.UpdateWithoutChangingOrder(key, *fileInfo))
+	t.corrupt(0)
+
+	t.scrubber.scrubPass(context.Background())
+
+	ExpectNe(nil, t.fileInfo())
+	ExpectTrue(doesFileExist(t.downloadPath))
+}
+
+func (t *scrubberTest) Test_Busy() {
+	t.clock.AdvanceTime(time.Second)
+	ExpectFalse(t.scrubber.busy())
+
+	// Reads served from the cache at more than MaxHitsPerSecond.
+	t.cacheHandler.hits.Add(21)
+	t.clock.AdvanceTime(2 * time.Second)
+	ExpectTrue(t.scrubber.busy())
+
+	// At no more than MaxHitsPerSecond.
+	t.cacheHandler.hits.Add(20)
+	t.clock.AdvanceTime(2 * time.Second)
+	ExpectFalse(t.scrubber.busy())
+}
+
+func (t *scrubberTest) Test_Read_CountsCacheHits() {
+	t.download()
+	hits := t.cacheHandler.hits.Load()
+	cacheHandle, err := t.cacheHandler.GetCacheHandle(t.object, t.bucket, false, 0)
+	AssertEq(nil, err)
+	defer cacheHandle.Close()
+
+	_, cacheHit, err := cacheHandle.Read(context.Background(), t.bucket, t.object, 0, make([]byte, util.MiB))
+
+	AssertEq(nil, err)
+	ExpectTrue(cacheHit)
+	ExpectEq(hits+1, t.cacheHandler.hits.Load())
+}
+
+func (t *scrubberTest) Test_ScrubPass_PausesWhileBusy() {
+	t.download()
+	t.corrupt(0)
+	// 100 reads per second served from the cache.
+	t.cacheHandler.hits.Add(100)
+	t.clock.AdvanceTime(time.Second)
+	t.scrubber.pauseInterval = time.Hour
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	t.scrubber.scrubPass(ctx)
+
+	ExpectNe(nil, t.fileInfo())
+	ExpectTrue(doesFileExist(t.downloadPath))
+
+	// Once the load is gone, the file is checked.
+	t.clock.AdvanceTime(time.Second)
+	t.scrubber.scrubPass(context.Background())
+
+	ExpectEq(nil, t.fileInfo())
+	ExpectFalse(doesFileExist(t.downloadPath))
+}
+
+func (t *scrubberTest) Test_StartScrubber_StoppedByDestroy() {
+	t.cacheHandler.StartScrubber(ScrubberConfig{BytesPerSecond: util.MiB, MaxHitsPerSecond: 10})
+
+	// Destroy waits for the scrubber to return.
+	ExpectEq(nil, t.cacheHandler.Destroy())
+}
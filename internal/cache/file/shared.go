@@ -0,0 +1,271 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"syscall"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/data"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/util"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+)
+
+// EnableSharing shares the cache with other gcsfuse processes using the same
+// cache directories. The process holding the lock file in the first directory
+// owns the cache: it downloads files into it and evicts them as usual, and
+// writes a data.SharedEntry for each file it completely downloads. The others
+// only read the files with a data.SharedEntry for the generation they want,
+// and read from GCS otherwise. Once the owner exits, the next process to look
+// up a file takes over, adopting the files it left into its own LRU.
+//
+// Acquires and releases Lock(chr.mu)
+func (chr *CacheHandler) EnableSharing() error {
+	chr.mu.Lock()
+	defer chr.mu.Unlock()
+
+	fileSpec := data.FileSpec{
+		Path:     path.Join(chr.cacheDir, util.SharedCacheLockFile),
+		FilePerm: chr.filePerm,
+		DirPerm:  chr.dirPerm,
+	}
+	lockFile, err := util.CreateFile(fileSpec, os.O_RDONLY)
+	if err != nil {
+		return fmt.Errorf("EnableSharing: while opening the lock file: %w", err)
+	}
+	chr.lockFile = lockFile
+
+	if !chr.ownsCache() {
+		logger.Infof("File cache in %s is owned by another gcsfuse process, only reading the files it has downloaded", chr.cacheDir)
+	}
+	return nil
+}
+
+// EnableReadOnly makes the cache read-only, for cache directories that can't
+// be written to, e.g. because they are on a read-only file system. Like the
+// processes not owning a shared cache, it only reads the files with a
+// data.SharedEntry for the generation they want, so that a cache warmed by a
+// process sharing it can be used, and reads from GCS otherwise. No files,
+// locks or entries are written, and nothing is evicted.
+//
+// Acquires and releases Lock(chr.mu)
+func (chr *CacheHandler) EnableReadOnly() {
+	chr.mu.Lock()
+	defer chr.mu.Unlock()
+
+	chr.readOnly = true
+	logger.Infof("File cache in %s is read-only, only reading the files downloaded into it before", chr.cacheDir)
+}
+
+// ownsCache returns true if the cache isn't shared, or if this process owns
+// it, trying to take it over if not.
+//
+// Requires Lock(chr.mu)
+func (chr *CacheHandler) ownsCache() bool {
+	if chr.lockFile == nil || chr.owner {
+		return true
+	}
+
+	err := syscall.Flock(int(chr.lockFile.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err != nil {
+		return false
+	}
+
+	chr.owner = true
+	chr.jobManager.ShareDownloads()
+	adopted := chr.adoptSharedEntries()
+	logger.Infof("Owning the file cache in %s shared with other gcsfuse processes, with %d files downloaded before", chr.cacheDir, adopted)
+	if chr.migrateLayout {
+		chr.removeSupersededLeftovers()
+		chr.startLayoutMigration()
+	}
+	return true
+}
+
+// adoptSharedEntries adds the entries for the files that the previous owner of
+// the cache completely downloaded to the file info cache, removing the
+// data.SharedEntry of those that are gone. It returns the number of entries
+// added.
+//
+// Requires Lock(chr.mu)
+func (chr *CacheHandler) adoptSharedEntries() (adopted int) {
+	for _, d := range chr.cacheDirs {
+		if d.failed {
+			continue
+		}
+
+		// Entries in util.FlatLayout are moved to the layout of new files before
+		// they are adopted, so walk first.
+		var entryPaths []string
+		walked := make(map[string]bool)
+		root := path.Join(d.Path, util.SharedEntriesDir)
+		_ = filepath.WalkDir(root, func(entryPath string, dirEntry fs.DirEntry, err error) error {
+			if err == nil && !dirEntry.IsDir() {
+				entryPaths = append(entryPaths, entryPath)
+				walked[entryPath] = true
+			}
+			return nil
+		})
+
+		for i := 0; i < len(entryPaths); i++ {
+			entryPath := entryPaths[i]
+			if newEntryPath, ok := chr.migrateSharedEntry(d, entryPath); ok {
+				if !walked[newEntryPath] {
+					entryPaths = append(entryPaths, newEntryPath)
+					walked[newEntryPath] = true
+				}
+				continue
+			}
+			if chr.adoptSharedEntry(d, entryPath) {
+				adopted++
+			} else {
+				_ = os.Remove(entryPath)
+			}
+		}
+	}
+	return
+}
+
+// adoptSharedEntry adds the entry for the data.SharedEntry at the given path
+// in the given cache directory to the file info cache, returning false if it
+// doesn't describe a file in the directory.
+//
+// Requires Lock(chr.mu)
+func (chr *CacheHandler) adoptSharedEntry(d *cacheDirState, entryPath string) bool {
+	entry, err := util.ReadSharedEntry(entryPath)
+	if err != nil {
+		return false
+	}
+	objectPath := util.GetObjectPath(entry.Key.BucketName, entry.Key.ObjectName)
+	if chr.paths.SharedEntryPath(d.Path, objectPath) != entryPath {
+		return false
+	}
+	fileInfo, err := os.Stat(chr.paths.DownloadPath(d.Path, objectPath))
+	if err != nil || uint64(fileInfo.Size()) != entry.FileSize {
+		return false
+	}
+
+	key, err := entry.Key.Key()
+	if err != nil || chr.fileInfoCache.LookUpWithoutChangingOrder(key) != nil {
+		return false
+	}
+	newFileInfo := data.FileInfo{
+		Key:              entry.Key,
+		ObjectGeneration: entry.ObjectGeneration,
+		Offset:           entry.FileSize,
+		FileSize:         entry.FileSize,
+		CRC32C:           entry.CRC32C,
+		CacheDir:         d.Path,
+	}
+	evictedValues, err := chr.insertFileInfo(key, newFileInfo)
+	if err != nil {
+		return false
+	}
+	chr.recordPinnedSize()
+	d.usage += entry.FileSize
+	for _, val := range evictedValues {
+		evictedFileInfo := val.(data.FileInfo)
+		if err := chr.cleanUpEvictedFile(&evictedFileInfo); err != nil {
+			logger.Warnf("adoptSharedEntry: while performing post eviction of %s object error: %v", evictedFileInfo.Key.ObjectName, err)
+		}
+	}
+	return true
+}
+
+// migrateSharedEntry moves the data.SharedEntry at the given path in the given
+// cache directory, and its file, to the layout of new files if they are in
+// util.FlatLayout, returning the new path of the entry.
+//
+// Requires Lock(chr.mu)
+func (chr *CacheHandler) migrateSharedEntry(d *cacheDirState, entryPath string) (string, bool) {
+	if !d.flat {
+		return "", false
+	}
+	entry, err := util.ReadSharedEntry(entryPath)
+	if err != nil {
+		return "", false
+	}
+	objectPath := util.GetObjectPath(entry.Key.BucketName, entry.Key.ObjectName)
+	if util.FlatLayout.SharedEntryPath(d.Path, objectPath) != entryPath {
+		return "", false
+	}
+
+	chr.migrateFile(d.Path, objectPath)
+	return chr.paths.SharedEntryPath(d.Path, objectPath), true
+}
+
+// removeSharedEntry removes the data.SharedEntry for the file in cache for the
+// given object path, if the cache is shared, so that other gcsfuse processes
+// stop opening the file.
+func (chr *CacheHandler) removeSharedEntry(cacheDir string, objectPath string) {
+	if chr.lockFile == nil {
+		return
+	}
+
+	err := os.Remove(chr.paths.SharedEntryPath(cacheDir, objectPath))
+	if err != nil && !os.IsNotExist(err) {
+		logger.Warnf("removeSharedEntry: %v", err)
+	}
+}
+
+// getSharedCacheHandle returns a CacheHandle for the file that the owner of the
+// cache has completely downloaded for the given generation of the object.
+//
+// Requires Lock(chr.mu)
+func (chr *CacheHandler) getSharedCacheHandle(object *gcs.MinObject, bucket gcs.Bucket, cacheForRangeRead bool, initialOffset int64) (*CacheHandle, error) {
+	objectPath := util.GetObjectPath(bucket.Name(), object.Name)
+	isForObject := func(entryPath string) bool {
+		entry, err := util.ReadSharedEntry(entryPath)
+		return err == nil &&
+			entry.Key.BucketName == bucket.Name() &&
+			entry.Key.ObjectName == object.Name &&
+			entry.ObjectGeneration == object.Generation &&
+			entry.FileSize == object.Size
+	}
+
+	for _, d := range chr.cacheDirs {
+		for _, layout := range chr.layoutsOf(d) {
+			entryPath := layout.SharedEntryPath(d.Path, objectPath)
+			if !isForObject(entryPath) {
+				continue
+			}
+
+			localFileReadHandle, err := os.Open(layout.DownloadPath(d.Path, objectPath))
+			if err != nil {
+				continue
+			}
+			// The owner removes the data.SharedEntry before evicting the file, so
+			// if it's still there, the file opened is the one it describes. Reads
+			// notice if the file is truncated after this.
+			fileInfo, err := localFileReadHandle.Stat()
+			if err != nil || uint64(fileInfo.Size()) != object.Size || !isForObject(entryPath) {
+				_ = localFileReadHandle.Close()
+				continue
+			}
+
+			cacheHandle := NewCacheHandle(localFileReadHandle, nil, chr.fileInfoCache, cacheForRangeRead, initialOffset)
+			cacheHandle.hits = &chr.hits
+			cacheHandle.shared = true
+			return cacheHandle, nil
+		}
+	}
+
+	return nil, fmt.Errorf("getSharedCacheHandle: %s", util.SharedEntryNotAvailableErrMsg)
+}
@@ -0,0 +1,337 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/data"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/file/downloader"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/lru"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/util"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/locker"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	. "github.com/jacobsa/oglematchers"
+	. "github.com/jacobsa/ogletest"
+)
+
+const sharedTestObjectSize = 2*util.MiB + 3
+
+func TestShared(t *testing.T) { RunTests(t) }
+
+// sharedCacheProcess is what a gcsfuse process sharing the cache has of it.
+type sharedCacheProcess struct {
+	cache        *lru.Cache
+	jobManager   *downloader.JobManager
+	cacheHandler *CacheHandler
+}
+
+type sharedTest struct {
+	fakeStorage storage.FakeStorage
+	bucket      gcs.Bucket
+	object      *gcs.MinObject
+	content     []byte
+	cacheDir    string
+	owner       sharedCacheProcess
+	reader      sharedCacheProcess
+}
+
+func init() { RegisterTestSuite(&sharedTest{}) }
+
+func (t *sharedTest) SetUp(*TestInfo) {
+	var err error
+	locker.EnableInvariantsCheck()
+	t.cacheDir, err = os.MkdirTemp("", "shared_test")
+	AssertEq(nil, err)
+
+	t.fakeStorage = storage.NewFakeStorage()
+	t.bucket = t.fakeStorage.CreateStorageHandle().BucketHandle(storage.TestBucketName, "")
+	t.content = make([]byte, sharedTestObjectSize)
+	_, err = rand.Read(t.content)
+	AssertEq(nil, err)
+	t.object = t.createObject(t.content)
+
+	t.owner = t.newProcess()
+	t.reader = t.newProcess()
+}
+
+func (t *sharedTest) TearDown() {
+	_ = t.owner.cacheHandler.Destroy()
+	_ = t.reader.cacheHandler.Destroy()
+	t.fakeStorage.ShutDown()
+	_ = os.RemoveAll(t.cacheDir)
+}
+
+func (t *sharedTest) newProcess() (p sharedCacheProcess) {
+	p.cache = lru.NewCache(2 * sharedTestObjectSize)
+	p.jobManager = downloader.NewJobManager(p.cache, util.DefaultFilePerm, util.DefaultDirPerm, t.cacheDir, DefaultSequentialReadSizeMb)
+	p.cacheHandler = NewCacheHandler(p.cache, p.jobManager, t.cacheDir, util.DefaultFilePerm, util.DefaultDirPerm)
+	AssertEq(nil, p.cacheHandler.EnableSharing())
+	return
+}
+
+func (t *sharedTest) createObject(content []byte) *gcs.MinObject {
+	ctx := context.Background()
+	err := storageutil.CreateObjects(ctx, t.bucket, map[string][]byte{TestObjectName: content})
+	AssertEq(nil, err)
+	object, _, err := t.bucket.StatObject(ctx, &gcs.StatObjectRequest{Name: TestObjectName, ForceFetchFromGcs: true})
+	AssertEq(nil, err)
+	return object
+}
+
+func (t *sharedTest) sharedEntryPath() string {
+	return util.GetSharedEntryPath(t.cacheDir, util.GetObjectPath(t.bucket.Name(), t.object.Name))
+}
+
+// download reads the whole test object through the cache of the owner,
+// returning once the file in cache is shared.
+func (t *sharedTest) download() {
+	cacheHandle, err := t.owner.cacheHandler.GetCacheHandle(t.object, t.bucket, false, 0)
+	AssertEq(nil, err)
+	defer cacheHandle.Close()
+
+	dst := make([]byte, t.object.Size)
+	_, _, err = cacheHandle.Read(context.Background(), t.bucket, t.object, 0, dst)
+	AssertEq(nil, err)
+	for {
+		if _, err := os.Stat(t.sharedEntryPath()); err == nil {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// newReadOnlyProcess returns a process with a read-only cache.
+func (t *sharedTest) newReadOnlyProcess() (p sharedCacheProcess) {
+	p.cache = lru.NewCache(2 * sharedTestObjectSize)
+	p.jobManager = downloader.NewJobManager(p.cache, util.DefaultFilePerm, util.DefaultDirPerm, t.cacheDir, DefaultSequentialReadSizeMb)
+	p.cacheHandler = NewCacheHandler(p.cache, p.jobManager, t.cacheDir, util.DefaultFilePerm, util.DefaultDirPerm)
+	p.cacheHandler.EnableReadOnly()
+	return
+}
+
+// chmodCacheDir sets the mode of the cache directory and the directories in
+// it.
+func (t *sharedTest) chmodCacheDir(mode os.FileMode) {
+	err := filepath.WalkDir(t.cacheDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return err
+		}
+		return os.Chmod(p, mode)
+	})
+	AssertEq(nil, err)
+}
+
+// listCacheDir returns the paths of the files in the cache directory.
+func (t *sharedTest) listCacheDir() (paths []string) {
+	err := filepath.WalkDir(t.cacheDir, func(p string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			paths = append(paths, p)
+		}
+		return err
+	})
+	AssertEq(nil, err)
+	return
+}
+
+// read reads the whole test object through the given cache handle.
+func (t *sharedTest) read(cacheHandle *CacheHandle) (content []byte, cacheHit bool, err error) {
+	content = make([]byte, t.object.Size)
+	_, cacheHit, err = cacheHandle.Read(context.Background(), t.bucket, t.object, 0, content)
+	return
+}
+
+func (t *sharedTest) isEntryInFileInfoCache(p sharedCacheProcess) bool {
+	key, err := data.FileInfoKey{BucketName: t.bucket.Name(), ObjectName: t.object.Name}.Key()
+	AssertEq(nil, err)
+	return p.cache.LookUpWithoutChangingOrder(key) != nil
+}
+
+////////////////////////////////////////////////////////////////////////
+// Tests
+////////////////////////////////////////////////////////////////////////
+
+func (t *sharedTest) Test_EnableSharing_FirstProcessOwnsCache() {
+	ExpectTrue(t.owner.cacheHandler.owner)
+	ExpectFalse(t.reader.cacheHandler.owner)
+}
+
+func (t *sharedTest) Test_Reader_FileNotDownloaded() {
+	cacheHandle, err := t.reader.cacheHandler.GetCacheHandle(t.object, t.bucket, false, 0)
+
+	AssertNe(nil, err)
+	ExpectTrue(strings.Contains(err.Error(), util.SharedEntryNotAvailableErrMsg))
+	ExpectEq(nil, cacheHandle)
+	ExpectFalse(t.isEntryInFileInfoCache(t.reader))
+	ExpectEq(nil, t.reader.jobManager.GetJob(t.object.Name, t.bucket.Name()))
+}
+
+func (t *sharedTest) Test_Reader_FileBeingDownloaded() {
+	cacheHandle, err := t.owner.cacheHandler.GetCacheHandle(t.object, t.bucket, false, 0)
+	AssertEq(nil, err)
+	defer cacheHandle.Close()
+
+	_, err = t.reader.cacheHandler.GetCacheHandle(t.object, t.bucket, false, 0)
+
+	AssertNe(nil, err)
+	ExpectTrue(strings.Contains(err.Error(), util.SharedEntryNotAvailableErrMsg))
+}
+
+func (t *sharedTest) Test_Reader_ReadsFileDownloadedByOwner() {
+	t.download()
+
+	cacheHandle, err := t.reader.cacheHandler.GetCacheHandle(t.object, t.bucket, false, 0)
+
+	AssertEq(nil, err)
+	defer cacheHandle.Close()
+	ExpectTrue(cacheHandle.shared)
+	content, cacheHit, err := t.read(cacheHandle)
+	AssertEq(nil, err)
+	ExpectTrue(cacheHit)
+	ExpectTrue(bytes.Equal(t.content, content))
+	ExpectFalse(t.isEntryInFileInfoCache(t.reader))
+	ExpectEq(nil, t.reader.jobManager.GetJob(t.object.Name, t.bucket.Name()))
+}
+
+func (t *sharedTest) Test_Reader_RandomReadOfFileDownloadedByOwner() {
+	t.download()
+
+	cacheHandle, err := t.reader.cacheHandler.GetCacheHandle(t.object, t.bucket, false, util.MiB)
+
+	AssertEq(nil, err)
+	defer cacheHandle.Close()
+	dst := make([]byte, 10)
+	n, cacheHit, err := cacheHandle.Read(context.Background(), t.bucket, t.object, util.MiB, dst)
+	AssertEq(nil, err)
+	ExpectEq(10, n)
+	ExpectTrue(cacheHit)
+	ExpectTrue(bytes.Equal(t.content[util.MiB:util.MiB+10], dst))
+}
+
+func (t *sharedTest) Test_Reader_DifferentGeneration() {
+	t.download()
+	t.object = t.createObject([]byte("new content"))
+
+	_, err := t.reader.cacheHandler.GetCacheHandle(t.object, t.bucket, false, 0)
+
+	AssertNe(nil, err)
+	ExpectTrue(strings.Contains(err.Error(), util.SharedEntryNotAvailableErrMsg))
+}
+
+func (t *sharedTest) Test_Reader_FileEvictedByOwner() {
+	t.download()
+	cacheHandle, err := t.reader.cacheHandler.GetCacheHandle(t.object, t.bucket, false, 0)
+	AssertEq(nil, err)
+	defer cacheHandle.Close()
+
+	AssertEq(nil, t.owner.cacheHandler.InvalidateCache(t.object.Name, t.bucket.Name()))
+
+	_, err = os.Stat(t.sharedEntryPath())
+	ExpectTrue(os.IsNotExist(err))
+	_, _, err = t.read(cacheHandle)
+	AssertNe(nil, err)
+	ExpectTrue(util.IsCacheHandleInvalid(err))
+	_, err = t.reader.cacheHandler.GetCacheHandle(t.object, t.bucket, false, 0)
+	AssertNe(nil, err)
+	ExpectTrue(strings.Contains(err.Error(), util.SharedEntryNotAvailableErrMsg))
+}
+
+func (t *sharedTest) Test_Reader_TakesOverOnceOwnerExits() {
+	t.download()
+	AssertEq(nil, t.owner.cacheHandler.Destroy())
+
+	cacheHandle, err := t.reader.cacheHandler.GetCacheHandle(t.object, t.bucket, false, 0)
+
+	AssertEq(nil, err)
+	defer cacheHandle.Close()
+	ExpectTrue(t.reader.cacheHandler.owner)
+	ExpectFalse(cacheHandle.shared)
+	// The file left by the owner is adopted rather than downloaded again.
+	ExpectTrue(t.isEntryInFileInfoCache(t.reader))
+	ExpectEq(nil, t.reader.jobManager.GetJob(t.object.Name, t.bucket.Name()))
+	content, cacheHit, err := t.read(cacheHandle)
+	AssertEq(nil, err)
+	ExpectTrue(cacheHit)
+	ExpectTrue(bytes.Equal(t.content, content))
+	ExpectEq(sharedTestObjectSize, t.reader.cacheHandler.cacheDirState(t.cacheDir).usage)
+}
+
+func (t *sharedTest) Test_TakeOver_DropsSharedEntryWithoutFile() {
+	t.download()
+	AssertEq(nil, t.owner.cacheHandler.Destroy())
+	AssertEq(nil, os.Remove(util.GetDownloadPath(t.cacheDir, util.GetObjectPath(t.bucket.Name(), t.object.Name))))
+
+	cacheHandle, err := t.reader.cacheHandler.GetCacheHandle(t.object, t.bucket, false, 0)
+
+	AssertEq(nil, err)
+	defer cacheHandle.Close()
+	ExpectTrue(t.reader.cacheHandler.owner)
+	// The file is downloaded again.
+	ExpectNe(nil, t.reader.jobManager.GetJob(t.object.Name, t.bucket.Name()))
+	_, err = os.Stat(t.sharedEntryPath())
+	ExpectTrue(os.IsNotExist(err))
+}
+
+func (t *sharedTest) Test_ReadOnly_ReadsFileDownloadedBefore() {
+	t.download()
+	AssertEq(nil, t.owner.cacheHandler.Destroy())
+	files := t.listCacheDir()
+	t.chmodCacheDir(0555)
+	defer t.chmodCacheDir(0755)
+	p := t.newReadOnlyProcess()
+	defer func() { _ = p.cacheHandler.Destroy() }()
+
+	cacheHandle, err := p.cacheHandler.GetCacheHandle(t.object, t.bucket, false, 0)
+
+	AssertEq(nil, err)
+	defer cacheHandle.Close()
+	ExpectTrue(cacheHandle.shared)
+	content, cacheHit, err := t.read(cacheHandle)
+	AssertEq(nil, err)
+	ExpectTrue(cacheHit)
+	ExpectTrue(bytes.Equal(t.content, content))
+	// Nothing is taken over or written.
+	ExpectFalse(p.cacheHandler.owner)
+	ExpectFalse(t.isEntryInFileInfoCache(p))
+	ExpectEq(nil, p.jobManager.GetJob(t.object.Name, t.bucket.Name()))
+	ExpectThat(t.listCacheDir(), DeepEquals(files))
+}
+
+func (t *sharedTest) Test_ReadOnly_FileNotDownloaded() {
+	files := t.listCacheDir()
+	t.chmodCacheDir(0555)
+	defer t.chmodCacheDir(0755)
+	p := t.newReadOnlyProcess()
+	defer func() { _ = p.cacheHandler.Destroy() }()
+
+	cacheHandle, err := p.cacheHandler.GetCacheHandle(t.object, t.bucket, true, 0)
+
+	AssertNe(nil, err)
+	ExpectTrue(strings.Contains(err.Error(), util.SharedEntryNotAvailableErrMsg))
+	ExpectEq(nil, cacheHandle)
+	ExpectFalse(t.isEntryInFileInfoCache(p))
+	ExpectEq(nil, p.jobManager.GetJob(t.object.Name, t.bucket.Name()))
+	ExpectEq(len(files), len(t.listCacheDir()))
+}
@@ -0,0 +1,227 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+import (
+	"os"
+	"path"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/data"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/file/downloader"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/util"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
+)
+
+// entryPin counts the CacheHandles reading a generation of an object from the
+// cache. When an entry for another generation of the object replaces that in
+// fileInfoCache while the generation is pinned, its file is kept for the
+// CacheHandles until the last of them is closed, so that each of them reads a
+// single generation throughout.
+type entryPin struct {
+	/////////////////////////
+	// Constant data
+	/////////////////////////
+
+	// key is that of the entry in fileInfoCache.
+	key        string
+	generation int64
+
+	// usage is the usage of the entry, if it was in fileInfoCache when pinned.
+	usage *data.EntryUsage
+
+	/////////////////////////
+	// Mutable state
+	/////////////////////////
+
+	// handles is the number of CacheHandles reading the generation.
+	//
+	// GUARDED_BY(chr.mu)
+	handles int
+
+	// superseded is set once the entry has been replaced in fileInfoCache, after
+	// which the CacheHandles read the file without looking the entry up.
+	superseded atomic.Bool
+
+	// fileInfo is the entry as it was when superseded, and path the path its
+	// file was moved to.
+	//
+	// GUARDED_BY(chr.mu)
+	fileInfo data.FileInfo
+	path     string
+
+	// job is the job that goes on downloading the file once superseded, if it
+	// wasn't complete.
+	//
+	// GUARDED_BY(chr.mu)
+	job *downloader.Job
+}
+
+// SetMaxSupersededSize sets the number of bytes that the files of superseded
+// entries, kept for the CacheHandles reading them, can add up to on top of the
+// size of fileInfoCache. Beyond it, entries are removed as soon as they are
+// superseded, as they are by default.
+//
+// Acquires and releases Lock(chr.mu)
+func (chr *CacheHandler) SetMaxSupersededSize(size uint64) {
+	chr.mu.Lock()
+	defer chr.mu.Unlock()
+	chr.maxSupersededSize = size
+}
+
+// pin adds a CacheHandle to the readers of the given generation of the entry
+// with the given key, and returns its pin.
+//
+// Requires Lock(chr.mu)
+func (chr *CacheHandler) pin(key string, generation int64) *entryPin {
+	p := chr.pins[key]
+	if p == nil || p.generation != generation {
+		p = &entryPin{key: key, generation: generation}
+		if val := chr.fileInfoCache.LookUpWithoutChangingOrder(key); val != nil {
+			p.usage = val.(data.FileInfo).Usage
+		}
+		chr.pins[key] = p
+	}
+	p.handles++
+	return p
+}
+
+// unpin removes a CacheHandle from the readers of the given pin, removing the
+// file of a superseded entry once it has no readers left.
+//
+// Acquires and releases Lock(chr.mu)
+func (chr *CacheHandler) unpin(p *entryPin) {
+	chr.mu.Lock()
+	defer chr.mu.Unlock()
+
+	p.handles--
+	if p.handles > 0 {
+		return
+	}
+	if !p.superseded.Load() {
+		if chr.pins[p.key] == p {
+			delete(chr.pins, p.key)
+		}
+		return
+	}
+	chr.removeSuperseded(p)
+}
+
+// dropPin forgets the pin of the given entry, which is removed from the cache
+// along with its file, so that a new entry for the same generation gets a new
+// pin.
+//
+// Requires Lock(chr.mu)
+func (chr *CacheHandler) dropPin(fileInfo *data.FileInfo) {
+	key, err := fileInfo.Key.Key()
+	if err != nil {
+		return
+	}
+	if p := chr.pins[key]; p != nil && p.generation == fileInfo.ObjectGeneration {
+		delete(chr.pins, key)
+	}
+}
+
+// supersede keeps the file of the given entry, which is about to be replaced
+// in fileInfoCache by an entry for another generation of the object, for the
+// CacheHandles reading it, by moving it out of the way of the new entry. It
+// returns false if the entry has no readers, if its file doesn't fit within
+// the size left for superseded entries, or if it can't be moved, in which case
+// the entry should be cleaned up as usual.
+//
+// Requires Lock(chr.mu)
+func (chr *CacheHandler) supersede(key string, fileInfo *data.FileInfo) bool {
+	p := chr.pins[key]
+	if p == nil || p.generation != fileInfo.ObjectGeneration || p.handles == 0 {
+		return false
+	}
+	if fileInfo.FileSize > chr.maxSupersededSize-chr.supersededSize {
+		logger.Tracef("supersede: no room left to keep generation %d of %s for its readers", fileInfo.ObjectGeneration, fileInfo.Key.ObjectName)
+		return false
+	}
+
+	cacheDir := chr.cacheDirOf(fileInfo)
+	objectPath := util.GetObjectPath(fileInfo.Key.BucketName, fileInfo.Key.ObjectName)
+	supersededPath := chr.paths.DownloadPath(supersededDir(cacheDir, fileInfo.ObjectGeneration), objectPath)
+	job, err := chr.jobManager.DetachJob(fileInfo.Key.ObjectName, fileInfo.Key.BucketName, fileInfo.ObjectGeneration, supersededPath)
+	if job == nil && err == nil {
+		err = os.MkdirAll(path.Dir(supersededPath), chr.dirPerm)
+		if err == nil {
+			err = os.Rename(chr.paths.DownloadPath(cacheDir, objectPath), supersededPath)
+		}
+	}
+	if err != nil {
+		logger.Warnf("supersede: while keeping generation %d of %s for its readers: %v", fileInfo.ObjectGeneration, fileInfo.Key.ObjectName, err)
+		if job != nil {
+			job.Invalidate()
+		}
+		return false
+	}
+
+	// Other processes sharing the cache must stop opening the moved file.
+	chr.removeSharedEntry(cacheDir, objectPath)
+
+	p.fileInfo = *fileInfo
+	p.path = supersededPath
+	p.job = job
+	p.superseded.Store(true)
+	delete(chr.pins, key)
+	chr.superseded[p] = true
+	chr.supersededSize += fileInfo.FileSize
+	return true
+}
+
+// removeSuperseded stops the download of the file of the given superseded
+// entry, if it's still going on, and removes the file.
+//
+// Requires Lock(chr.mu)
+func (chr *CacheHandler) removeSuperseded(p *entryPin) {
+	delete(chr.superseded, p)
+	chr.supersededSize -= p.fileInfo.FileSize
+	chr.releaseFile(&p.fileInfo)
+
+	fileInfo := p.fileInfo
+	if p.job != nil {
+		p.job.Invalidate()
+		fileInfo.Offset = uint64(p.job.GetStatus().Offset)
+	}
+	captureWastedBytes(&fileInfo)
+
+	err := removeFileInCache(p.path)
+	if err != nil {
+		logger.Warnf("removeSuperseded: %v", err)
+	}
+}
+
+// removeSupersededLeftovers removes the files of superseded entries left in
+// the cache directories by an earlier process, which can't be read any more.
+//
+// Requires Lock(chr.mu)
+func (chr *CacheHandler) removeSupersededLeftovers() {
+	for _, d := range chr.cacheDirs {
+		if d.failed {
+			continue
+		}
+		_ = os.RemoveAll(path.Join(d.Path, util.SupersededDir))
+	}
+}
+
+// supersededDir returns the directory that the files of superseded entries
+// for the given generation are moved to in the given cache directory, in the
+// layout of the cache.
+func supersededDir(cacheDir string, generation int64) string {
+	return path.Join(cacheDir, util.SupersededDir, strconv.FormatInt(generation, 10))
+}
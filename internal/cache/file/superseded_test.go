@@ -0,0 +1,294 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"io"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/file/downloader"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/lru"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/util"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/locker"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	. "github.com/jacobsa/ogletest"
+)
+
+const supersededTestObjectSize = 2*util.MiB + 3
+
+func TestSuperseded(t *testing.T) { RunTests(t) }
+
+type supersededTest struct {
+	fakeStorage  storage.FakeStorage
+	bucket       gcs.Bucket
+	cacheDir     string
+	cache        *lru.Cache
+	jobManager   *downloader.JobManager
+	cacheHandler *CacheHandler
+}
+
+func init() { RegisterTestSuite(&supersededTest{}) }
+
+func (t *supersededTest) SetUp(*TestInfo) {
+	var err error
+	locker.EnableInvariantsCheck()
+	t.cacheDir, err = os.MkdirTemp("", "superseded_test")
+	AssertEq(nil, err)
+
+	t.fakeStorage = storage.NewFakeStorage()
+	t.bucket = t.fakeStorage.CreateStorageHandle().BucketHandle(storage.TestBucketName, "")
+	t.cache = lru.NewCache(2 * supersededTestObjectSize)
+	t.jobManager = downloader.NewJobManager(t.cache, util.DefaultFilePerm, util.DefaultDirPerm, t.cacheDir, DefaultSequentialReadSizeMb)
+	t.cacheHandler = NewCacheHandler(t.cache, t.jobManager, t.cacheDir, util.DefaultFilePerm, util.DefaultDirPerm)
+	t.cacheHandler.SetMaxSupersededSize(2 * supersededTestObjectSize)
+}
+
+func (t *supersededTest) TearDown() {
+	_ = t.cacheHandler.Destroy()
+	t.fakeStorage.ShutDown()
+	_ = os.RemoveAll(t.cacheDir)
+}
+
+// overwrite creates a new generation of the test object with random content,
+// returning it along with the content.
+func (t *supersededTest) overwrite() (*gcs.MinObject, []byte) {
+	ctx := context.Background()
+	content := make([]byte, supersededTestObjectSize)
+	_, err := rand.Read(content)
+	AssertEq(nil, err)
+	err = storageutil.CreateObjects(ctx, t.bucket, map[string][]byte{TestObjectName: content})
+	AssertEq(nil, err)
+	object, _, err := t.bucket.StatObject(ctx, &gcs.StatObjectRequest{Name: TestObjectName, ForceFetchFromGcs: true})
+	AssertEq(nil, err)
+	return object, content
+}
+
+// read reads the given range of the object through the given handle, failing
+// the test unless it's all read from the cache.
+func (t *supersededTest) read(cacheHandle *CacheHandle, object *gcs.MinObject, offset int64, size int) []byte {
+	dst := make([]byte, size)
+	n, _, err := cacheHandle.Read(context.Background(), t.bucket, object, offset, dst)
+	AssertEq(nil, err)
+	AssertEq(size, n)
+	return dst
+}
+
+func (t *supersededTest) supersededPath(object *gcs.MinObject) string {
+	return util.GetDownloadPath(supersededDir(t.cacheDir, object.Generation), util.GetObjectPath(t.bucket.Name(), object.Name))
+}
+
+func (t *supersededTest) downloadPath() string {
+	return util.GetDownloadPath(t.cacheDir, util.GetObjectPath(t.bucket.Name(), TestObjectName))
+}
+
+func (t *supersededTest) supersededSize() uint64 {
+	t.cacheHandler.mu.Lock()
+	defer t.cacheHandler.mu.Unlock()
+	return t.cacheHandler.supersededSize
+}
+
+func (t *supersededTest) Test_OverlappingReadersAcrossOverwriteSeeOneGenerationEach() {
+	oldObject, oldContent := t.overwrite()
+	oldHandle, err := t.cacheHandler.GetCacheHandle(oldObject, t.bucket, false, 0)
+	AssertEq(nil, err)
+	half := supersededTestObjectSize / 2
+	oldRead := t.read(oldHandle, oldObject, 0, half)
+
+	// The object is overwritten while the old handle is mid-file, and read
+	// afresh through a new handle.
+	newObject, newContent := t.overwrite()
+	AssertNe(oldObject.Generation, newObject.Generation)
+	newHandle, err := t.cacheHandler.GetCacheHandle(newObject, t.bucket, false, 0)
+	AssertEq(nil, err)
+	defer newHandle.Close()
+	newRead := t.read(newHandle, newObject, 0, half)
+	oldRead = append(oldRead, t.read(oldHandle, oldObject, int64(half), supersededTestObjectSize-half)...)
+	newRead = append(newRead, t.read(newHandle, newObject, int64(half), supersededTestObjectSize-half)...)
+
+	ExpectTrue(bytes.Equal(oldContent, oldRead))
+	ExpectTrue(bytes.Equal(newContent, newRead))
+	ExpectEq(oldObject.Size, t.supersededSize())
+	ExpectTrue(doesFileExist(t.supersededPath(oldObject)))
+	// Closing the last reader of the old generation removes its file.
+	AssertEq(nil, oldHandle.Close())
+	ExpectFalse(doesFileExist(t.supersededPath(oldObject)))
+	ExpectEq(0, t.supersededSize())
+	content, err := os.ReadFile(t.downloadPath())
+	AssertEq(nil, err)
+	ExpectTrue(bytes.Equal(newContent, content))
+}
+
+// gatedBucket holds the readers it creates back until gate is closed or their
+// context is cancelled, closing opened once the first has been created.
+type gatedBucket struct {
+	gcs.Bucket
+	opened chan struct{}
+	gate   chan struct{}
+}
+
+func (b *gatedBucket) NewReader(ctx context.Context, req *gcs.ReadObjectRequest) (io.ReadCloser, error) {
+	rc, err := b.Bucket.NewReader(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case <-b.opened:
+	default:
+		close(b.opened)
+	}
+	return &gatedReader{ReadCloser: rc, ctx: ctx, gate: b.gate}, nil
+}
+
+type gatedReader struct {
+	io.ReadCloser
+	ctx  context.Context
+	gate chan struct{}
+}
+
+func (r *gatedReader) Read(p []byte) (int, error) {
+	select {
+	case <-r.gate:
+		return r.ReadCloser.Read(p)
+	case <-r.ctx.Done():
+		return 0, r.ctx.Err()
+	}
+}
+
+func (t *supersededTest) Test_DownloadInProgressGoesOnForOldReader() {
+	oldObject, oldContent := t.overwrite()
+	bucket := &gatedBucket{Bucket: t.bucket, opened: make(chan struct{}), gate: make(chan struct{})}
+	oldHandle, err := t.cacheHandler.GetCacheHandle(oldObject, bucket, false, 0)
+	AssertEq(nil, err)
+	defer oldHandle.Close()
+	_, err = oldHandle.fileDownloadJob.Download(context.Background(), 0, false)
+	AssertEq(nil, err)
+	<-bucket.opened
+	newObject, newContent := t.overwrite()
+	newHandle, err := t.cacheHandler.GetCacheHandle(newObject, t.bucket, false, 0)
+	AssertEq(nil, err)
+	defer newHandle.Close()
+
+	// The old generation is downloaded into its superseded file.
+	close(bucket.gate)
+	oldRead := t.read(oldHandle, oldObject, 0, supersededTestObjectSize)
+	newRead := t.read(newHandle, newObject, 0, supersededTestObjectSize)
+
+	ExpectTrue(bytes.Equal(oldContent, oldRead))
+	ExpectTrue(bytes.Equal(newContent, newRead))
+}
+
+func (t *supersededTest) Test_SupersededFileKeptUntilLastReaderCloses() {
+	oldObject, oldContent := t.overwrite()
+	oldHandle1, err := t.cacheHandler.GetCacheHandle(oldObject, t.bucket, false, 0)
+	AssertEq(nil, err)
+	oldHandle2, err := t.cacheHandler.GetCacheHandle(oldObject, t.bucket, false, 0)
+	AssertEq(nil, err)
+	t.read(oldHandle1, oldObject, 0, supersededTestObjectSize)
+	newObject, _ := t.overwrite()
+	newHandle, err := t.cacheHandler.GetCacheHandle(newObject, t.bucket, false, 0)
+	AssertEq(nil, err)
+	defer newHandle.Close()
+
+	AssertEq(nil, oldHandle1.Close())
+
+	ExpectTrue(doesFileExist(t.supersededPath(oldObject)))
+	ExpectTrue(bytes.Equal(oldContent, t.read(oldHandle2, oldObject, 0, supersededTestObjectSize)))
+	AssertEq(nil, oldHandle2.Close())
+	ExpectFalse(doesFileExist(t.supersededPath(oldObject)))
+	ExpectEq(0, t.supersededSize())
+}
+
+func (t *supersededTest) Test_EntryWithoutReadersIsNotSuperseded() {
+	oldObject, _ := t.overwrite()
+	oldHandle, err := t.cacheHandler.GetCacheHandle(oldObject, t.bucket, false, 0)
+	AssertEq(nil, err)
+	t.read(oldHandle, oldObject, 0, supersededTestObjectSize)
+	AssertEq(nil, oldHandle.Close())
+	newObject, _ := t.overwrite()
+
+	newHandle, err := t.cacheHandler.GetCacheHandle(newObject, t.bucket, false, 0)
+
+	AssertEq(nil, err)
+	defer newHandle.Close()
+	ExpectFalse(doesFileExist(t.supersededPath(oldObject)))
+	ExpectEq(0, t.supersededSize())
+}
+
+func (t *supersededTest) Test_NoRoomForSupersededEntry() {
+	t.cacheHandler.SetMaxSupersededSize(supersededTestObjectSize - 1)
+	oldObject, _ := t.overwrite()
+	oldHandle, err := t.cacheHandler.GetCacheHandle(oldObject, t.bucket, false, 0)
+	AssertEq(nil, err)
+	defer oldHandle.Close()
+	t.read(oldHandle, oldObject, 0, util.MiB)
+	newObject, _ := t.overwrite()
+
+	newHandle, err := t.cacheHandler.GetCacheHandle(newObject, t.bucket, false, 0)
+
+	AssertEq(nil, err)
+	defer newHandle.Close()
+	ExpectFalse(doesFileExist(t.supersededPath(oldObject)))
+	ExpectEq(0, t.supersededSize())
+	// The old reader is told to read from GCS instead.
+	_, _, err = oldHandle.Read(context.Background(), t.bucket, oldObject, util.MiB, make([]byte, util.MiB))
+	AssertNe(nil, err)
+	ExpectTrue(util.IsCacheHandleInvalid(err))
+}
+
+func (t *supersededTest) Test_SupersededEntriesHaveTheirOwnCap() {
+	// Enough for one superseded entry, while fileInfoCache holds two.
+	t.cacheHandler.SetMaxSupersededSize(supersededTestObjectSize)
+	firstObject, firstContent := t.overwrite()
+	firstHandle, err := t.cacheHandler.GetCacheHandle(firstObject, t.bucket, false, 0)
+	AssertEq(nil, err)
+	defer firstHandle.Close()
+	t.read(firstHandle, firstObject, 0, util.MiB)
+	secondObject, _ := t.overwrite()
+	secondHandle, err := t.cacheHandler.GetCacheHandle(secondObject, t.bucket, false, 0)
+	AssertEq(nil, err)
+	defer secondHandle.Close()
+	t.read(secondHandle, secondObject, 0, util.MiB)
+	thirdObject, thirdContent := t.overwrite()
+
+	thirdHandle, err := t.cacheHandler.GetCacheHandle(thirdObject, t.bucket, false, 0)
+
+	AssertEq(nil, err)
+	defer thirdHandle.Close()
+	ExpectEq(firstObject.Size, t.supersededSize())
+	ExpectTrue(doesFileExist(t.supersededPath(firstObject)))
+	ExpectFalse(doesFileExist(t.supersededPath(secondObject)))
+	ExpectTrue(bytes.Equal(firstContent, t.read(firstHandle, firstObject, 0, supersededTestObjectSize)))
+	ExpectTrue(bytes.Equal(thirdContent, t.read(thirdHandle, thirdObject, 0, supersededTestObjectSize)))
+	_, _, err = secondHandle.Read(context.Background(), t.bucket, secondObject, util.MiB, make([]byte, util.MiB))
+	AssertNe(nil, err)
+	ExpectTrue(util.IsCacheHandleInvalid(err))
+}
+
+func (t *supersededTest) Test_MigrateLayoutRemovesLeftovers() {
+	leftover := path.Join(supersededDir(t.cacheDir, 1), "leftover")
+	AssertEq(nil, os.MkdirAll(path.Dir(leftover), util.DefaultDirPerm))
+	AssertEq(nil, os.WriteFile(leftover, []byte("taco"), util.DefaultFilePerm))
+
+	t.cacheHandler.MigrateLayout()
+
+	ExpectFalse(doesFileExist(path.Join(t.cacheDir, util.SupersededDir)))
+}
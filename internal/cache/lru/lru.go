@@ -19,6 +19,7 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
+	"strings"
 
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/locker"
 )
@@ -29,6 +30,7 @@ const (
 	InvalidEntryErrorMsg           = "nil values are not supported"
 	InvalidUpdateEntrySizeErrorMsg = "size of entry to be updated is not same as existing size"
 	EntryNotExistErrMsg            = "entry with given key does not exist"
+	PinnedSizeErrorMsg             = "size of the entry is more than the room left for pinned entries"
 )
 
 // Cache is a LRU cache for any lru.ValueType indexed by string keys.
@@ -48,16 +50,29 @@ type Cache struct {
 	// Sum of entry.Value.Size() of all the entries in the cache.
 	currentSize uint64
 
-	// List of cache entries, with least recently used at the tail.
+	// Sum of entry.Value.Size() of the pinned entries, which currentSize
+	// includes.
+	//
+	// INVARIANT: pinnedSize <= currentSize
+	pinnedSize uint64
+
+	// List of cache entries that aren't pinned, with least recently used at
+	// the tail.
 	//
 	// INVARIANT: currentSize <= maxSize
-	// INVARIANT: Each element is of type entry
+	// INVARIANT: Each element is of type entry, with Pinned unset
 	entries list.List
 
+	// List of the pinned cache entries, with least recently used at the tail.
+	// They are never evicted to make room for other entries.
+	//
+	// INVARIANT: Each element is of type entry, with Pinned set
+	pinnedEntries list.List
+
 	// Index of elements by name.
 	//
 	// INVARIANT: For each k, v: v.Value.(entry).Key == k
-	// INVARIANT: Contains all and only the elements of entries
+	// INVARIANT: Contains all and only the elements of entries and pinnedEntries
 	index map[string]*list.Element
 
 	// All public methods of this Cache uses this RW mutex based locker while
@@ -70,8 +85,9 @@ type ValueType interface {
 }
 
 type entry struct {
-	Key   string
-	Value ValueType
+	Key    string
+	Value  ValueType
+	Pinned bool
 }
 
 // NewCache returns the reference of cache object by initialising the cache with
@@ -99,42 +115,81 @@ func (c *Cache) checkInvariants() {
 		panic(fmt.Sprintf("CurrentSize %v over maxSize %v", c.currentSize, c.maxSize))
 	}
 
-	// INVARIANT: Each element is of type entry
-	for e := c.entries.Front(); e != nil; e = e.Next() {
-		switch e.Value.(type) {
-		case entry:
-		default:
-			panic(fmt.Sprintf("Unexpected element type: %v", reflect.TypeOf(e.Value)))
+	// INVARIANT: pinnedSize <= currentSize
+	if !(c.pinnedSize <= c.currentSize) {
+		panic(fmt.Sprintf("PinnedSize %v over currentSize %v", c.pinnedSize, c.currentSize))
+	}
+
+	// INVARIANT: Each element is of type entry, with Pinned unset
+	// INVARIANT: Each element is of type entry, with Pinned set
+	for _, l := range []struct {
+		entries *list.List
+		pinned  bool
+	}{{&c.entries, false}, {&c.pinnedEntries, true}} {
+		for e := l.entries.Front(); e != nil; e = e.Next() {
+			switch v := e.Value.(type) {
+			case entry:
+				if v.Pinned != l.pinned {
+					panic(fmt.Sprintf("Entry %v has Pinned %v in the wrong list", v.Key, v.Pinned))
+				}
+			default:
+				panic(fmt.Sprintf("Unexpected element type: %v", reflect.TypeOf(e.Value)))
+			}
 		}
 	}
 
 	// INVARIANT: For each k, v: v.Value.(entry).Key == k
-	// INVARIANT: Contains all and only the elements of entries
-	if c.entries.Len() != len(c.index) {
+	// INVARIANT: Contains all and only the elements of entries and pinnedEntries
+	if c.entries.Len()+c.pinnedEntries.Len() != len(c.index) {
 		panic(fmt.Sprintf(
 			"Length mismatch: %v vs. %v",
-			c.entries.Len(),
+			c.entries.Len()+c.pinnedEntries.Len(),
 			len(c.index)))
 	}
 
-	for e := c.entries.Front(); e != nil; e = e.Next() {
-		if c.index[e.Value.(entry).Key] != e {
-			panic(fmt.Sprintf("Mismatch for key %v", e.Value.(entry).Key))
+	for _, l := range []*list.List{&c.entries, &c.pinnedEntries} {
+		for e := l.Front(); e != nil; e = e.Next() {
+			if c.index[e.Value.(entry).Key] != e {
+				panic(fmt.Sprintf("Mismatch for key %v", e.Value.(entry).Key))
+			}
 		}
 	}
 }
 
-func (c *Cache) evictOne() ValueType {
-	e := c.entries.Back()
-	key := e.Value.(entry).Key
+// listOf returns the list holding the given element.
+func (c *Cache) listOf(e *list.Element) *list.List {
+	if e.Value.(entry).Pinned {
+		return &c.pinnedEntries
+	}
+	return &c.entries
+}
+
+// remove removes the given element from the cache.
+func (c *Cache) remove(e *list.Element) ValueType {
+	removed := e.Value.(entry)
+	c.currentSize -= removed.Value.Size()
+	if removed.Pinned {
+		c.pinnedSize -= removed.Value.Size()
+	}
+
+	c.listOf(e).Remove(e)
+	delete(c.index, removed.Key)
 
-	evictedEntry := e.Value.(entry).Value
-	c.currentSize -= evictedEntry.Size()
+	return removed.Value
+}
 
-	c.entries.Remove(e)
-	delete(c.index, key)
+// pinnedSizeWithout returns the size of the pinned entries apart from the
+// entry for the given key.
+func (c *Cache) pinnedSizeWithout(key string) uint64 {
+	if e, ok := c.index[key]; ok && e.Value.(entry).Pinned {
+		return c.pinnedSize - e.Value.(entry).Value.Size()
+	}
+	return c.pinnedSize
+}
 
-	return evictedEntry
+// evictOne evicts the least recently used entry that isn't pinned.
+func (c *Cache) evictOne() ValueType {
+	return c.remove(c.entries.Back())
 }
 
 ////////////////////////////////////////////////////////////////////////
@@ -142,7 +197,8 @@ func (c *Cache) evictOne() ValueType {
 ////////////////////////////////////////////////////////////////////////
 
 // Insert the supplied value into the cache, overwriting any previous entry for
-// the given key. The value must be non-nil.
+// the given key. The value must be non-nil, and fit in the room left by the
+// pinned entries.
 // Also returns a slice of ValueType evicted by the new inserted entry.
 func (c *Cache) Insert(
 	key string,
@@ -159,19 +215,60 @@ func (c *Cache) Insert(
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	e, ok := c.index[key]
-	if ok {
-		// Update an entry if already exist.
-		c.currentSize -= e.Value.(entry).Value.Size()
-		c.currentSize += valueSize
-		e.Value = entry{key, value}
-		c.entries.MoveToFront(e)
-	} else {
-		// Add the entry if already doesn't exist.
-		e := c.entries.PushFront(entry{key, value})
-		c.index[key] = e
-		c.currentSize += valueSize
+	if valueSize > c.maxSize-c.pinnedSizeWithout(key) {
+		return nil, errors.New(InvalidEntrySizeErrorMsg)
+	}
+
+	return c.insert(entry{key, value, false}), nil
+}
+
+// InsertPinned is like Insert, but the entry is pinned: it isn't evicted to
+// make room for other entries, only erased. The pinned entries together can't
+// be more than maxPinnedSize, and an entry that doesn't fit in what's left of
+// it isn't inserted, with an error with PinnedSizeErrorMsg.
+func (c *Cache) InsertPinned(
+	key string,
+	value ValueType,
+	maxPinnedSize uint64) ([]ValueType, error) {
+	if value == nil {
+		return nil, errors.New(InvalidEntryErrorMsg)
+	}
+
+	valueSize := value.Size()
+	if valueSize > c.maxSize {
+		return nil, errors.New(InvalidEntrySizeErrorMsg)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	pinnedSize := c.pinnedSizeWithout(key)
+	if valueSize > c.maxSize-pinnedSize {
+		return nil, errors.New(InvalidEntrySizeErrorMsg)
+	}
+	if pinnedSize > maxPinnedSize || valueSize > maxPinnedSize-pinnedSize {
+		return nil, errors.New(PinnedSizeErrorMsg)
+	}
+
+	return c.insert(entry{key, value, true}), nil
+}
+
+// insert adds the given entry, replacing any entry for its key, and evicts
+// entries that aren't pinned until the cache is at or below maxSize.
+//
+// REQUIRES: The entry fits in the room left by the other pinned entries.
+func (c *Cache) insert(newEntry entry) []ValueType {
+	if e, ok := c.index[newEntry.Key]; ok {
+		c.remove(e)
+	}
+
+	l := &c.entries
+	if newEntry.Pinned {
+		l = &c.pinnedEntries
+		c.pinnedSize += newEntry.Value.Size()
 	}
+	c.index[newEntry.Key] = l.PushFront(newEntry)
+	c.currentSize += newEntry.Value.Size()
 
 	var evictedValues []ValueType
 	// Evict until we're at or below maxSize.
@@ -179,7 +276,7 @@ func (c *Cache) Insert(
 		evictedValues = append(evictedValues, c.evictOne())
 	}
 
-	return evictedValues, nil
+	return evictedValues
 }
 
 // Erase any entry for the supplied key, also returns the value of erased key.
@@ -192,13 +289,24 @@ func (c *Cache) Erase(key string) (value ValueType) {
 		return
 	}
 
-	deletedEntry := e.Value.(entry).Value
-	c.currentSize -= deletedEntry.Size()
+	return c.remove(e)
+}
+
+// EraseEntriesWithGivenPrefix erases all the entries whose keys start with the
+// given prefix.
+//
+// Note: This visits every entry in the cache.
+func (c *Cache) EraseEntriesWithGivenPrefix(prefix string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-	delete(c.index, key)
-	c.entries.Remove(e)
+	for key, e := range c.index {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
 
-	return deletedEntry
+		c.remove(e)
+	}
 }
 
 // LookUp a previously-inserted value for the given key. Return nil if no
@@ -213,7 +321,7 @@ func (c *Cache) LookUp(key string) (value ValueType) {
 		return
 	}
 	// This is now the most recently used entry.
-	c.entries.MoveToFront(e)
+	c.listOf(e).MoveToFront(e)
 
 	// Return the value.
 	return e.Value.(entry).Value
@@ -239,6 +347,32 @@ func (c *Cache) LookUpWithoutChangingOrder(key string) (value ValueType) {
 	return e.Value.(entry).Value
 }
 
+// Keys returns the keys of all the entries in the cache, the pinned ones
+// first, each from most to least recently used, without changing the order of
+// entries in the cache. The returned slice is a snapshot: entries may be
+// inserted or erased after it is taken.
+func (c *Cache) Keys() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	keys := make([]string, 0, len(c.index))
+	for _, l := range []*list.List{&c.pinnedEntries, &c.entries} {
+		for e := l.Front(); e != nil; e = e.Next() {
+			keys = append(keys, e.Value.(entry).Key)
+		}
+	}
+
+	return keys
+}
+
+// PinnedSize returns the sum of the sizes of the pinned entries.
+func (c *Cache) PinnedSize() uint64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.pinnedSize
+}
+
 // UpdateWithoutChangingOrder updates entry with the given key in cache with
 // given value without changing order of entries in cache, returning error if an
 // entry with given key doesn't exist. Also, the size of value for entry
@@ -262,7 +396,7 @@ func (c *Cache) UpdateWithoutChangingOrder(
 		return errors.New(InvalidUpdateEntrySizeErrorMsg)
 	}
 
-	e.Value = entry{key, value}
+	e.Value = entry{key, value, e.Value.(entry).Pinned}
 	c.index[key] = e
 
 	return nil
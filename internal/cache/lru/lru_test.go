@@ -23,6 +23,7 @@ import (
 
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/lru"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/locker"
+	. "github.com/jacobsa/oglematchers"
 	. "github.com/jacobsa/ogletest"
 )
 
@@ -178,6 +179,22 @@ func (t *CacheTest) TestEraseWhenKeyNotPresent() {
 	ExpectEq(23, t.cache.LookUp("burrito").(testData).Value)
 }
 
+func (t *CacheTest) TestEraseEntriesWithGivenPrefix() {
+	t.insertAndAssert("a/b", testData{Value: 1, DataSize: 4}, []int64{}, nil)
+	t.insertAndAssert("a/b/c", testData{Value: 2, DataSize: 4}, []int64{}, nil)
+	t.insertAndAssert("a/bc", testData{Value: 3, DataSize: 4}, []int64{}, nil)
+	t.insertAndAssert("a/c", testData{Value: 4, DataSize: 4}, []int64{}, nil)
+
+	t.cache.EraseEntriesWithGivenPrefix("a/b")
+
+	ExpectEq(nil, t.cache.LookUp("a/b"))
+	ExpectEq(nil, t.cache.LookUp("a/b/c"))
+	ExpectEq(nil, t.cache.LookUp("a/bc"))
+	ExpectEq(4, t.cache.LookUp("a/c").(testData).Value)
+	// The erased entries no longer count towards the size.
+	t.insertAndAssert("d", testData{Value: 5, DataSize: MaxSize - 4}, []int64{}, nil)
+}
+
 func (t *CacheTest) TestUpdateWhenKeyPresent() {
 	key := "burrito"
 	data := testData{Value: 23, DataSize: 4}
@@ -267,6 +284,87 @@ func (t *CacheTest) TestLookUpWithoutChangingOrder_NotChangeOrder() {
 	t.insertAndAssert(key3, data3, []int64{23}, nil)
 }
 
+func (t *CacheTest) TestKeys() {
+	ExpectEq(0, len(t.cache.Keys()))
+	t.insertAndAssert("a", testData{Value: 1, DataSize: 4}, []int64{}, nil)
+	t.insertAndAssert("b", testData{Value: 2, DataSize: 4}, []int64{}, nil)
+	t.insertAndAssert("c", testData{Value: 3, DataSize: 4}, []int64{}, nil)
+	_ = t.cache.LookUp("a")
+
+	keys := t.cache.Keys()
+
+	ExpectThat(keys, ElementsAre("a", "c", "b"))
+	// Taking the snapshot doesn't change the order.
+	ExpectThat(t.cache.Keys(), ElementsAre("a", "c", "b"))
+}
+
+func (t *CacheTest) TestPinnedEntriesAreNotEvicted() {
+	_, err := t.cache.InsertPinned("burrito", testData{Value: 23, DataSize: 20}, MaxSize)
+	AssertEq(nil, err)
+	t.insertAndAssert("taco", testData{Value: 26, DataSize: 20}, []int64{}, nil)
+
+	// The pinned entry is the least recently used, but the other one goes.
+	t.insertAndAssert("enchilada", testData{Value: 28, DataSize: 20}, []int64{26}, nil)
+
+	ExpectEq(23, t.cache.LookUp("burrito").(testData).Value)
+	ExpectEq(nil, t.cache.LookUp("taco"))
+	ExpectEq(28, t.cache.LookUp("enchilada").(testData).Value)
+	ExpectEq(20, t.cache.PinnedSize())
+	ExpectThat(t.cache.Keys(), ElementsAre("burrito", "enchilada"))
+}
+
+func (t *CacheTest) TestPinnedEntriesLeaveLessRoom() {
+	_, err := t.cache.InsertPinned("burrito", testData{Value: 23, DataSize: 40}, MaxSize)
+	AssertEq(nil, err)
+
+	t.insertAndAssert("taco", testData{Value: 26, DataSize: 11}, []int64{}, errors.New(lru.InvalidEntrySizeErrorMsg))
+	t.insertAndAssert("taco", testData{Value: 26, DataSize: 10}, []int64{}, nil)
+}
+
+func (t *CacheTest) TestInsertPinnedBeyondMaxPinnedSize() {
+	_, err := t.cache.InsertPinned("burrito", testData{Value: 23, DataSize: 20}, 30)
+	AssertEq(nil, err)
+
+	_, err = t.cache.InsertPinned("taco", testData{Value: 26, DataSize: 11}, 30)
+
+	AssertNe(nil, err)
+	ExpectEq(lru.PinnedSizeErrorMsg, err.Error())
+	ExpectEq(nil, t.cache.LookUp("taco"))
+	ExpectEq(20, t.cache.PinnedSize())
+}
+
+func (t *CacheTest) TestInsertPinnedEvictsEntriesThatAreNotPinned() {
+	t.insertAndAssert("burrito", testData{Value: 23, DataSize: 20}, []int64{}, nil)
+	t.insertAndAssert("taco", testData{Value: 26, DataSize: 20}, []int64{}, nil)
+
+	evicted, err := t.cache.InsertPinned("enchilada", testData{Value: 28, DataSize: 20}, MaxSize)
+
+	AssertEq(nil, err)
+	AssertEq(1, len(evicted))
+	ExpectEq(23, evicted[0].(testData).Value)
+}
+
+func (t *CacheTest) TestErasePinnedEntry() {
+	_, err := t.cache.InsertPinned("burrito", testData{Value: 23, DataSize: 20}, MaxSize)
+	AssertEq(nil, err)
+
+	ExpectEq(23, t.cache.Erase("burrito").(testData).Value)
+
+	ExpectEq(nil, t.cache.LookUp("burrito"))
+	ExpectEq(0, t.cache.PinnedSize())
+	t.insertAndAssert("taco", testData{Value: 26, DataSize: MaxSize}, []int64{}, nil)
+}
+
+func (t *CacheTest) TestInsertUnpinsEntry() {
+	_, err := t.cache.InsertPinned("burrito", testData{Value: 23, DataSize: 20}, MaxSize)
+	AssertEq(nil, err)
+
+	t.insertAndAssert("burrito", testData{Value: 24, DataSize: 20}, []int64{}, nil)
+	t.insertAndAssert("taco", testData{Value: 26, DataSize: 40}, []int64{24}, nil)
+
+	ExpectEq(0, t.cache.PinnedSize())
+}
+
 // This will detect race if we run the test with `-race` flag.
 // We get the race condition failure if we remove lock from Insert or Erase method.
 func (t *CacheTest) TestRaceCondition() {
@@ -0,0 +1,99 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metadata
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/config"
+)
+
+// CacheControlTTL derives the ttl for which the metadata of an object is
+// cached from its Cache-Control metadata, so that e.g. immutable objects can
+// be cached for longer than objects that change often.
+type CacheControlTTL struct {
+	// Whether Cache-Control is looked at. If not, TTL always returns the
+	// default ttl.
+	Enabled bool
+
+	// Bounds for the ttls that Cache-Control asks for.
+	Min time.Duration
+	Max time.Duration
+}
+
+// NewCacheControlTTL returns the CacheControlTTL set by the metadata-cache
+// section of the config file.
+func NewCacheControlTTL(c config.MetadataCacheConfig) CacheControlTTL {
+	return CacheControlTTL{
+		Enabled: c.RespectCacheControl,
+		Min:     config.ListCacheTtlSecsToDuration(c.CacheControlMinTtlInSeconds),
+		Max:     config.ListCacheTtlSecsToDuration(c.CacheControlMaxTtlInSeconds),
+	}
+}
+
+// TTL returns how long the metadata of an object with the given Cache-Control
+// value may be cached, clamped to [c.Min, c.Max]. It returns defaultTTL if
+// the value has no directive that applies to caching metadata.
+func (c CacheControlTTL) TTL(cacheControl string, defaultTTL time.Duration) time.Duration {
+	if !c.Enabled {
+		return defaultTTL
+	}
+
+	ttl, ok := ParseCacheControl(cacheControl)
+	if !ok {
+		return defaultTTL
+	}
+
+	return min(max(ttl, c.Min), c.Max)
+}
+
+// ParseCacheControl returns the ttl asked for by a Cache-Control value: zero
+// for no-store and no-cache, and otherwise the max-age. ok is false if the
+// value has neither. Other directives, and directives that can't be parsed,
+// are ignored.
+func ParseCacheControl(value string) (ttl time.Duration, ok bool) {
+	for _, directive := range strings.Split(value, ",") {
+		name, arg, hasArg := strings.Cut(strings.TrimSpace(directive), "=")
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "no-store":
+			return 0, true
+
+		case "no-cache":
+			// A no-cache listing header fields only restricts those fields.
+			if !hasArg {
+				return 0, true
+			}
+
+		case "max-age":
+			seconds, err := strconv.ParseInt(strings.Trim(strings.TrimSpace(arg), `"`), 10, 64)
+			if err != nil || seconds < 0 {
+				continue
+			}
+
+			// Saturate rather than overflow.
+			if seconds > math.MaxInt64/int64(time.Second) {
+				ttl = time.Duration(math.MaxInt64)
+			} else {
+				ttl = time.Duration(seconds) * time.Second
+			}
+			ok = true
+		}
+	}
+
+	return
+}
@@ -0,0 +1,76 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metadata_test
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/metadata"
+	"github.com/stretchr/testify/assert"
+)
+
+const defaultTTL = time.Minute
+
+func TestParseCacheControl(t *testing.T) {
+	testCases := []struct {
+		value string
+		ttl   time.Duration
+		ok    bool
+	}{
+		{value: "", ok: false},
+		{value: "public", ok: false},
+		{value: "no-store", ttl: 0, ok: true},
+		{value: "no-cache", ttl: 0, ok: true},
+		{value: `no-cache="Set-Cookie"`, ok: false},
+		{value: "max-age=0", ttl: 0, ok: true},
+		{value: "public, max-age=3600", ttl: time.Hour, ok: true},
+		{value: `Max-Age="60", immutable`, ttl: time.Minute, ok: true},
+		{value: "max-age=3600, no-cache", ttl: 0, ok: true},
+		{value: "max-age=-1", ok: false},
+		{value: "max-age=soon", ok: false},
+		{value: "max-age=99999999999999999", ttl: time.Duration(math.MaxInt64), ok: true},
+	}
+
+	for _, tc := range testCases {
+		ttl, ok := metadata.ParseCacheControl(tc.value)
+
+		assert.Equal(t, tc.ok, ok, tc.value)
+		assert.Equal(t, tc.ttl, ttl, tc.value)
+	}
+}
+
+func TestCacheControlTTL(t *testing.T) {
+	c := metadata.CacheControlTTL{
+		Enabled: true,
+		Min:     time.Second,
+		Max:     24 * time.Hour,
+	}
+
+	assert.Equal(t, time.Second, c.TTL("no-store", defaultTTL))
+	assert.Equal(t, time.Second, c.TTL("max-age=0", defaultTTL))
+	assert.Equal(t, time.Hour, c.TTL("max-age=3600", defaultTTL))
+	assert.Equal(t, 24*time.Hour, c.TTL("public, max-age=31536000, immutable", defaultTTL))
+	assert.Equal(t, defaultTTL, c.TTL("", defaultTTL))
+	assert.Equal(t, defaultTTL, c.TTL("private", defaultTTL))
+}
+
+func TestCacheControlTTLDisabled(t *testing.T) {
+	c := metadata.CacheControlTTL{Max: 24 * time.Hour}
+
+	assert.Equal(t, defaultTTL, c.TTL("no-store", defaultTTL))
+	assert.Equal(t, defaultTTL, c.TTL("max-age=3600", defaultTTL))
+}
@@ -0,0 +1,74 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metadata
+
+import (
+	"strings"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/config"
+)
+
+// EntryTTLs are how long the records of files and of directories are cached,
+// so that e.g. directories that rarely change can be cached for longer than
+// files that change often. Symlinks count as files.
+type EntryTTLs struct {
+	File time.Duration
+	Dir  time.Duration
+}
+
+// SameEntryTTLs returns EntryTTLs caching both kinds for ttl.
+func SameEntryTTLs(ttl time.Duration) EntryTTLs {
+	return EntryTTLs{File: ttl, Dir: ttl}
+}
+
+// ForType returns the ttl of a record of the given type. Records of names
+// that don't exist are kept for the shorter of the two, since either kind may
+// appear.
+func (t EntryTTLs) ForType(it Type) time.Duration {
+	switch it {
+	case ExplicitDirType, ImplicitDirType:
+		return t.Dir
+	case NonexistentType, UnknownType:
+		return t.Min()
+	default:
+		return t.File
+	}
+}
+
+// ForName returns the ttl of a record of the object or prefix with the given
+// name, which is a directory's if it ends in '/'.
+func (t EntryTTLs) ForName(name string) time.Duration {
+	if strings.HasSuffix(name, "/") {
+		return t.Dir
+	}
+	return t.File
+}
+
+// Min returns the shorter of the two ttls.
+func (t EntryTTLs) Min() time.Duration {
+	return min(t.File, t.Dir)
+}
+
+// Max returns the longer of the two ttls.
+func (t EntryTTLs) Max() time.Duration {
+	return max(t.File, t.Dir)
+}
+
+// Under returns the ttls under a directory with the given config, whose
+// metadata ttl, if set, overrides both.
+func (t EntryTTLs) Under(c config.DirConfig) EntryTTLs {
+	return EntryTTLs{File: c.MetadataTTL(t.File), Dir: c.MetadataTTL(t.Dir)}
+}
@@ -0,0 +1,47 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metadata
+
+import (
+	"testing"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEntryTTLs(t *testing.T) {
+	ttls := EntryTTLs{File: time.Second, Dir: time.Minute}
+
+	assert.Equal(t, time.Second, ttls.ForType(RegularFileType))
+	assert.Equal(t, time.Second, ttls.ForType(SymlinkType))
+	assert.Equal(t, time.Minute, ttls.ForType(ExplicitDirType))
+	assert.Equal(t, time.Minute, ttls.ForType(ImplicitDirType))
+	assert.Equal(t, time.Second, ttls.ForType(NonexistentType))
+	assert.Equal(t, time.Second, ttls.ForName("a/b"))
+	assert.Equal(t, time.Minute, ttls.ForName("a/b/"))
+	assert.Equal(t, time.Second, ttls.Min())
+	assert.Equal(t, time.Minute, ttls.Max())
+	assert.Equal(t, SameEntryTTLs(time.Hour), EntryTTLs{File: time.Hour, Dir: time.Hour})
+}
+
+func TestEntryTTLsUnderDirConfig(t *testing.T) {
+	ttls := EntryTTLs{File: time.Second, Dir: time.Minute}
+
+	assert.Equal(t, ttls, ttls.Under(config.DirConfig{}))
+	ttlSecs := int64(3600)
+	c := config.DirConfig{MetadataCache: config.DirMetadataCacheConfig{TtlInSeconds: &ttlSecs}}
+	assert.Equal(t, SameEntryTTLs(time.Hour), ttls.Under(c))
+}
@@ -49,6 +49,23 @@ type StatCache interface {
 	// entry. Return hit == false when there is neither a positive nor a negative
 	// entry, or the entry has expired according to the supplied current time.
 	LookUp(name string, now time.Time) (hit bool, m *gcs.MinObject)
+
+	// Record the result of probing whether any object exists under the given
+	// prefix. firstObject is the name of the first object found, or "" if the
+	// probe found nothing. The entry will expire after the supplied time.
+	InsertPrefix(prefix string, firstObject string, expiration time.Time)
+
+	// Erase the probe result for the given prefix, if any.
+	ErasePrefix(prefix string)
+
+	// Erase the entries for all the objects whose names start with the given
+	// prefix, and the probe results for all the prefixes that do.
+	EraseEntriesWithGivenPrefix(prefix string)
+
+	// Return the recorded probe result for the given prefix. Return hit ==
+	// false when there is no entry, or the entry has expired according to the
+	// supplied current time.
+	LookUpPrefix(prefix string, now time.Time) (hit bool, firstObject string)
 }
 
 // Create a new bucket-view to the passed shared-cache object.
@@ -106,6 +123,24 @@ func (e entry) Size() (size uint64) {
 	return
 }
 
+// An entry recording the result of a prefix probe. Empty firstObject means
+// that nothing exists under the prefix.
+type prefixEntry struct {
+	firstObject string
+	expiration  time.Time
+	key         string
+}
+
+// Size returns the memory-size (resident set size) of the receiver entry.
+func (e prefixEntry) Size() (size uint64) {
+	size = uint64(util.UnsafeSizeOf(&e) + len(e.key) + 2*util.UnsafeSizeOf(&e.key) + len(e.firstObject))
+
+	// Convert heap-size to RSS (resident set size).
+	size = uint64(math.Ceil(util.HeapSizeToRssConversionFactor * float64(size)))
+
+	return
+}
+
 // Should the supplied object for a new positive entry replace the given
 // existing entry?
 func shouldReplace(m *gcs.MinObject, existing entry) bool {
@@ -139,6 +174,13 @@ func (sc *statCacheBucketView) key(objectName string) string {
 	return objectName
 }
 
+// prefixKey returns the cache key for the probe result of the given prefix.
+// Object names can't contain line feeds, so the leading "\n" keeps prefix
+// entries from colliding with object entries of the same name.
+func (sc *statCacheBucketView) prefixKey(prefix string) string {
+	return sc.key("\n" + prefix)
+}
+
 func (sc *statCacheBucketView) Insert(m *gcs.MinObject, expiration time.Time) {
 	name := sc.key(m.Name)
 
@@ -203,3 +245,51 @@ func (sc *statCacheBucketView) LookUp(
 
 	return
 }
+
+func (sc *statCacheBucketView) InsertPrefix(
+	prefix string,
+	firstObject string,
+	expiration time.Time) {
+	name := sc.prefixKey(prefix)
+
+	e := prefixEntry{
+		firstObject: firstObject,
+		expiration:  expiration,
+		key:         name,
+	}
+
+	if _, err := sc.sharedCache.Insert(name, e); err != nil {
+		panic(err)
+	}
+}
+
+func (sc *statCacheBucketView) ErasePrefix(prefix string) {
+	sc.sharedCache.Erase(sc.prefixKey(prefix))
+}
+
+func (sc *statCacheBucketView) EraseEntriesWithGivenPrefix(prefix string) {
+	sc.sharedCache.EraseEntriesWithGivenPrefix(sc.key(prefix))
+	sc.sharedCache.EraseEntriesWithGivenPrefix(sc.prefixKey(prefix))
+}
+
+func (sc *statCacheBucketView) LookUpPrefix(
+	prefix string,
+	now time.Time) (hit bool, firstObject string) {
+	value := sc.sharedCache.LookUp(sc.prefixKey(prefix))
+	if value == nil {
+		return
+	}
+
+	e := value.(prefixEntry)
+
+	// Has this entry expired?
+	if e.expiration.Before(now) {
+		sc.ErasePrefix(prefix)
+		return
+	}
+
+	hit = true
+	firstObject = e.firstObject
+
+	return
+}
@@ -152,18 +152,18 @@ func (t *StatCacheTest) KeysPresentButEverythingIsExpired() {
 }
 
 func (t *StatCacheTest) FillUpToCapacity() {
-	AssertEq(3, capacity) // maxSize = 3 * 1640 = 4920 bytes
+	AssertEq(3, capacity) // maxSize = 3 * 1720 = 5160 bytes
 
 	m0 := &gcs.MinObject{Name: "burrito"}
 	m1 := &gcs.MinObject{Name: "taco"}
 	m2 := &gcs.MinObject{Name: "quesadilla"}
 
-	t.cache.Insert(m0, expiration)                    // size = 1394 bytes
-	t.cache.Insert(m1, expiration)                    // size = 1382 bytes (cumulative = 2776 bytes)
-	t.cache.AddNegativeEntry("enchilada", expiration) // size = 178 bytes (cumulative = 2954 bytes)
-	t.cache.Insert(m2, expiration)                    // size = 1406 bytes (cumulative = 4360 bytes)
-	t.cache.AddNegativeEntry("fajita", expiration)    // size = 172 bytes (cumulative = 4532 bytes)
-	t.cache.AddNegativeEntry("salsa", expiration)     // size = 170 bytes (cumulative = 4702 bytes)
+	t.cache.Insert(m0, expiration)                    // size = 1474 bytes
+	t.cache.Insert(m1, expiration)                    // size = 1462 bytes (cumulative = 2936 bytes)
+	t.cache.AddNegativeEntry("enchilada", expiration) // size = 178 bytes (cumulative = 3114 bytes)
+	t.cache.Insert(m2, expiration)                    // size = 1486 bytes (cumulative = 4600 bytes)
+	t.cache.AddNegativeEntry("fajita", expiration)    // size = 172 bytes (cumulative = 4772 bytes)
+	t.cache.AddNegativeEntry("salsa", expiration)     // size = 170 bytes (cumulative = 4942 bytes)
 
 	// Before expiration
 	justBefore := expiration.Add(-time.Nanosecond)
@@ -193,21 +193,21 @@ func (t *StatCacheTest) FillUpToCapacity() {
 }
 
 func (t *StatCacheTest) ExpiresLeastRecentlyUsed() {
-	AssertEq(3, capacity) // maxSize = 3 * 1640 = 4920 bytes
+	AssertEq(3, capacity) // maxSize = 3 * 1720 = 5160 bytes
 
 	o0 := &gcs.MinObject{Name: "burrito"}
 	o1 := &gcs.MinObject{Name: "taco"}
 	o2 := &gcs.MinObject{Name: "quesadilla"}
 
-	t.cache.Insert(o0, expiration)                         // size = 1394 bytes
-	t.cache.Insert(o1, expiration)                         // Least recent, size = 1382 bytes (cumulative = 2776 bytes)
-	t.cache.AddNegativeEntry("enchilada", expiration)      // Third most recent, size = 178 bytes (cumulative = 2954 bytes)
-	t.cache.Insert(o2, expiration)                         // Second most recent, size = 1406 bytes (cumulative = 4360 bytes)
+	t.cache.Insert(o0, expiration)                         // size = 1474 bytes
+	t.cache.Insert(o1, expiration)                         // Least recent, size = 1462 bytes (cumulative = 2936 bytes)
+	t.cache.AddNegativeEntry("enchilada", expiration)      // Third most recent, size = 178 bytes (cumulative = 3114 bytes)
+	t.cache.Insert(o2, expiration)                         // Second most recent, size = 1486 bytes (cumulative = 4600 bytes)
 	AssertEq(o0, t.cache.LookUpOrNil("burrito", someTime)) // Most recent
 
 	// Insert another.
 	o3 := &gcs.MinObject{Name: "queso"}
-	t.cache.Insert(o3, expiration) // size = 1386 bytes (cumulative = 5746 bytes)
+	t.cache.Insert(o3, expiration) // size = 1466 bytes (cumulative = 6066 bytes)
 	// This would evict the least recent entry i.e o1/"taco".
 
 	// See what's left.
@@ -317,6 +317,77 @@ func (t *StatCacheTest) Overwrite_NegativeWithNegative() {
 	ExpectTrue(t.cache.NegativeEntry(name, someTime))
 }
 
+func (t *StatCacheTest) Prefix_LookUpUnknown() {
+	hit, _ := t.cache.wrapped.LookUpPrefix("taco/", someTime)
+	ExpectFalse(hit)
+}
+
+func (t *StatCacheTest) Prefix_PositiveEntry() {
+	t.cache.wrapped.InsertPrefix("taco/", "taco/burrito", expiration)
+
+	hit, firstObject := t.cache.wrapped.LookUpPrefix("taco/", someTime)
+	ExpectTrue(hit)
+	ExpectEq("taco/burrito", firstObject)
+}
+
+func (t *StatCacheTest) Prefix_NegativeEntry() {
+	t.cache.wrapped.InsertPrefix("taco/", "", expiration)
+
+	hit, firstObject := t.cache.wrapped.LookUpPrefix("taco/", someTime)
+	ExpectTrue(hit)
+	ExpectEq("", firstObject)
+}
+
+func (t *StatCacheTest) Prefix_Expires() {
+	t.cache.wrapped.InsertPrefix("taco/", "taco/burrito", expiration)
+
+	hit, _ := t.cache.wrapped.LookUpPrefix("taco/", expiration.Add(time.Millisecond))
+	ExpectFalse(hit)
+}
+
+func (t *StatCacheTest) Prefix_Erase() {
+	t.cache.wrapped.InsertPrefix("taco/", "taco/burrito", expiration)
+	t.cache.wrapped.ErasePrefix("taco/")
+
+	hit, _ := t.cache.wrapped.LookUpPrefix("taco/", someTime)
+	ExpectFalse(hit)
+}
+
+func (t *StatCacheTest) Prefix_IndependentOfObjectEntries() {
+	const name = "taco/"
+	m := &gcs.MinObject{Name: name, Generation: 17}
+
+	t.cache.Insert(m, expiration)
+	t.cache.wrapped.InsertPrefix(name, "", expiration)
+
+	// Neither entry clobbers the other.
+	ExpectEq(m, t.cache.LookUpOrNil(name, someTime))
+	hit, firstObject := t.cache.wrapped.LookUpPrefix(name, someTime)
+	ExpectTrue(hit)
+	ExpectEq("", firstObject)
+
+	// Erasing the object leaves the prefix entry alone.
+	t.cache.Erase(name)
+	hit, _ = t.cache.wrapped.LookUpPrefix(name, someTime)
+	ExpectTrue(hit)
+}
+
+func (t *StatCacheTest) EraseEntriesWithGivenPrefix() {
+	AssertEq(3, capacity)
+	t.cache.Insert(&gcs.MinObject{Name: "taco/"}, expiration)
+	t.cache.AddNegativeEntry("taco/burrito", expiration)
+	t.cache.Insert(&gcs.MinObject{Name: "tacos"}, expiration)
+	t.cache.wrapped.InsertPrefix("taco/", "", expiration)
+
+	t.cache.wrapped.EraseEntriesWithGivenPrefix("taco/")
+
+	ExpectFalse(t.cache.Hit("taco/", someTime))
+	ExpectFalse(t.cache.Hit("taco/burrito", someTime))
+	ExpectTrue(t.cache.Hit("tacos", someTime))
+	hit, _ := t.cache.wrapped.LookUpPrefix("taco/", someTime)
+	ExpectFalse(hit)
+}
+
 // ///////////////////////////////////////////////////////////////
 // ////// Tests for multi-bucket cache scenarios /////////////////
 // ///////////////////////////////////////////////////////////////
@@ -344,18 +415,18 @@ func (t *MultiBucketStatCacheTest) CreateEntriesWithSameNameInDifferentBuckets()
 }
 
 func (t *MultiBucketStatCacheTest) FillUpToCapacity() {
-	AssertEq(3, capacity) // maxSize = 3 * 1640 = 4920 bytes
+	AssertEq(3, capacity) // maxSize = 3 * 1720 = 5160 bytes
 
 	cache := &t.multiBucketCache
 	fruits := &cache.fruits
 	spices := &cache.spices
 
-	fruits.Insert(apple, expiration)               // size = 1400 bytes
-	fruits.Insert(orange, expiration)              // size = 1404 bytes (cumulative = 2804 bytes)
-	spices.Insert(cardamom, expiration)            // size = 1412 bytes (cumulative = 4216 bytes)
-	fruits.AddNegativeEntry("papaya", expiration)  // size = 186 bytes (cumulative = 4402 bytes)
-	spices.AddNegativeEntry("saffron", expiration) // size = 188 bytes (cumulative = 4590 bytes)
-	spices.AddNegativeEntry("pepper", expiration)  // size = 186 bytes (cumulative = 4776 bytes)
+	fruits.Insert(apple, expiration)               // size = 1480 bytes
+	fruits.Insert(orange, expiration)              // size = 1484 bytes (cumulative = 2964 bytes)
+	spices.Insert(cardamom, expiration)            // size = 1492 bytes (cumulative = 4456 bytes)
+	fruits.AddNegativeEntry("papaya", expiration)  // size = 186 bytes (cumulative = 4642 bytes)
+	spices.AddNegativeEntry("saffron", expiration) // size = 188 bytes (cumulative = 4830 bytes)
+	spices.AddNegativeEntry("pepper", expiration)  // size = 186 bytes (cumulative = 5016 bytes)
 
 	// Before expiration
 	justBefore := expiration.Add(-time.Nanosecond)
@@ -385,20 +456,20 @@ func (t *MultiBucketStatCacheTest) FillUpToCapacity() {
 }
 
 func (t *MultiBucketStatCacheTest) ExpiresLeastRecentlyUsed() {
-	AssertEq(3, capacity) // maxSize = 3 * 1640 = 4920 bytes
+	AssertEq(3, capacity) // maxSize = 3 * 1720 = 5160 bytes
 
 	cache := &t.multiBucketCache
 	fruits := &cache.fruits
 	spices := &cache.spices
 
-	fruits.Insert(apple, expiration)                       // size = 1400 bytes
-	fruits.Insert(orange, expiration)                      // Least recent, size = 1404 bytes (cumulative = 2804 bytes)
-	spices.Insert(cardamom, expiration)                    // Second most recent, size = 1412 bytes (cumulative = 4216 bytes)
+	fruits.Insert(apple, expiration)                       // size = 1480 bytes
+	fruits.Insert(orange, expiration)                      // Least recent, size = 1484 bytes (cumulative = 2964 bytes)
+	spices.Insert(cardamom, expiration)                    // Second most recent, size = 1492 bytes (cumulative = 4456 bytes)
 	AssertEq(apple, fruits.LookUpOrNil("apple", someTime)) // Most recent
 
 	// Insert another.
 	saffron := &gcs.MinObject{Name: "saffron"}
-	spices.Insert(saffron, expiration) // size = 1408 bytes (cumulative = 5624 bytes)
+	spices.Insert(saffron, expiration) // size = 1488 bytes (cumulative = 5944 bytes)
 	// This will evict the least recent entry, i.e. orange.
 
 	// See what's left.
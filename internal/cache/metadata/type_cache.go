@@ -39,7 +39,7 @@ const (
 // TTL-based expiration.
 // Sample usage:
 //
-//	tc := NewTypeCache(size, ttl)
+//	tc := NewTypeCache(size, SameEntryTTLs(ttl))
 //	tc.Insert(time.Now(), "file", RegularFileType)
 //	tc.Insert(time.Now(), "dir", ExplicitDirType)
 //	tc.Get(time.Now(),"file") -> RegularFileType
@@ -49,7 +49,8 @@ const (
 //	tc.Get(time.Now(),"dir") -> UnknownType
 type TypeCache interface {
 	// Insert inserts the given entry (name -> type)
-	// with the entry-expiration at now+ttl.
+	// with the entry-expiration at now+ttl, where ttl is that of the
+	// given type.
 	Insert(now time.Time, name string, it Type)
 	// Erase removes the entry with the given name.
 	Erase(name string)
@@ -117,7 +118,7 @@ type typeCache struct {
 	// Constant data
 	/////////////////////////
 
-	ttl time.Duration
+	ttls EntryTTLs
 
 	/////////////////////////
 	// Mutable state
@@ -133,15 +134,16 @@ type typeCache struct {
 // Any entry whose TTL has expired, is removed from the cache on next access (Get).
 // When insertion of next entry would cause size of cache > maxSizeMB,
 // older entries are evicted according to the LRU-policy.
-// If either of TTL or maxSizeMB is zero, nothing is ever cached.
-func NewTypeCache(maxSizeMB int, ttl time.Duration) TypeCache {
-	if ttl > 0 && maxSizeMB != 0 {
+// If both TTLs or maxSizeMB are zero, nothing is ever cached. If only one TTL
+// is zero, entries of that kind aren't cached.
+func NewTypeCache(maxSizeMB int, ttls EntryTTLs) TypeCache {
+	if ttls.Max() > 0 && maxSizeMB != 0 {
 		var lruSizeInBytesToUse uint64 = math.MaxUint64 // default for when maxSizeMB = -1
 		if maxSizeMB > 0 {
 			lruSizeInBytesToUse = util.MiBsToBytes(uint64(maxSizeMB))
 		}
 		return &typeCache{
-			ttl:     ttl,
+			ttls:    ttls,
 			entries: lru.NewCache(lruSizeInBytesToUse),
 		}
 	}
@@ -150,8 +152,15 @@ func NewTypeCache(maxSizeMB int, ttl time.Duration) TypeCache {
 
 func (tc *typeCache) Insert(now time.Time, name string, it Type) {
 	if tc.entries != nil { // only if caching is enabled
+		ttl := tc.ttls.ForType(it)
+		if ttl <= 0 {
+			// Don't leave behind what was known of another kind.
+			tc.entries.Erase(name)
+			return
+		}
+
 		_, err := tc.entries.Insert(name, cacheEntry{
-			expiry:    now.Add(tc.ttl),
+			expiry:    now.Add(ttl),
 			inodeType: it,
 			key:       name,
 		})
@@ -83,7 +83,7 @@ func (t *ZeroTtlTypeCacheTest) SetUp(ti *TestInfo) {
 ////////////////////////////////////////////////////////////////////////
 
 func createNewTypeCache(maxSizeMB int, ttl time.Duration) *typeCache {
-	tc := NewTypeCache(maxSizeMB, ttl)
+	tc := NewTypeCache(maxSizeMB, SameEntryTTLs(ttl))
 
 	AssertNe(nil, tc)
 	AssertNe(nil, tc.(*typeCache))
@@ -220,3 +220,31 @@ func (t *ZeroTtlTypeCacheTest) TestGetInsertedEntry() {
 
 	ExpectEq(UnknownType, t.cache.Get(beforeExpiration, "abcd"))
 }
+
+////////////////////////////////////////////////////////////////////////
+// Tests for TypeCache with separate ttls for files and directories
+////////////////////////////////////////////////////////////////////////
+
+func (t *TypeCacheTest) TestEntriesExpireByKind() {
+	tc := NewTypeCache(TypeCacheMaxSizeMB, EntryTTLs{File: TTL, Dir: 2 * TTL})
+	tc.Insert(now, "file", RegularFileType)
+	tc.Insert(now, "dir", ExplicitDirType)
+	tc.Insert(now, "absent", NonexistentType)
+
+	afterFileExpiration := now.Add(TTL + time.Nanosecond)
+	ExpectEq(UnknownType, tc.Get(afterFileExpiration, "file"))
+	ExpectEq(ExplicitDirType, tc.Get(afterFileExpiration, "dir"))
+	ExpectEq(UnknownType, tc.Get(afterFileExpiration, "absent"))
+
+	ExpectEq(UnknownType, tc.Get(now.Add(2*TTL+time.Nanosecond), "dir"))
+}
+
+func (t *TypeCacheTest) TestZeroTtlKindIsntCached() {
+	tc := NewTypeCache(TypeCacheMaxSizeMB, EntryTTLs{File: 0, Dir: TTL})
+	tc.Insert(now, "abcd", ExplicitDirType)
+	tc.Insert(now, "abcd", RegularFileType)
+	tc.Insert(now, "dir", ExplicitDirType)
+
+	ExpectEq(UnknownType, tc.Get(beforeExpiration, "abcd"))
+	ExpectEq(ExplicitDirType, tc.Get(beforeExpiration, "dir"))
+}
@@ -0,0 +1,105 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path"
+	"strings"
+)
+
+// PathResolver maps the objects in a cache directory to the paths of their
+// files in cache, and of the data.SharedEntry of those files in a cache
+// shared by several gcsfuse processes, according to a layout of the
+// directory.
+type PathResolver interface {
+	DownloadPath(cacheDir string, objectPath string) string
+	SharedEntryPath(cacheDir string, objectPath string) string
+}
+
+// FlatLayout places the file of an object at its object path in the cache
+// directory, as gcsfuse did before ShardedLayout. All the files of the
+// objects in the same directory of a bucket end up in one directory.
+var FlatLayout PathResolver = flatLayout{}
+
+// ShardedLayout spreads the files of objects across 256×256 directories,
+// named after the first two bytes of a hash of the object path, e.g.
+// 3f/a0/bucket/object. Bucket names are at least 3 characters long, so these
+// can't clash with the directories of FlatLayout. It's the layout of new
+// files.
+var ShardedLayout PathResolver = shardedLayout{}
+
+type flatLayout struct{}
+
+func (flatLayout) DownloadPath(cacheDir string, objectPath string) string {
+	return path.Join(cacheDir, objectPath)
+}
+
+func (flatLayout) SharedEntryPath(cacheDir string, objectPath string) string {
+	return path.Join(cacheDir, SharedEntriesDir, objectPath)
+}
+
+type shardedLayout struct{}
+
+func (shardedLayout) DownloadPath(cacheDir string, objectPath string) string {
+	return path.Join(cacheDir, shardOf(objectPath), objectPath)
+}
+
+func (shardedLayout) SharedEntryPath(cacheDir string, objectPath string) string {
+	return path.Join(cacheDir, SharedEntriesDir, shardOf(objectPath), objectPath)
+}
+
+// shardOf returns the directories of ShardedLayout for the given object path.
+func shardOf(objectPath string) string {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(objectPath))
+	sum := h.Sum32()
+	return fmt.Sprintf("%02x/%02x", byte(sum>>24), byte(sum>>16))
+}
+
+// isShardName returns true if name could be that of a directory of
+// ShardedLayout.
+func isShardName(name string) bool {
+	return len(name) == 2 && strings.Trim(name, "0123456789abcdef") == ""
+}
+
+// FlatLayoutDirs returns the directories of FlatLayout in the given directory,
+// i.e. the cache directory or its SharedEntriesDir: those named after
+// buckets.
+func FlatLayoutDirs(dirPath string) (names []string, err error) {
+	entries, err := os.ReadDir(dirPath)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		if e.IsDir() && !strings.HasPrefix(e.Name(), ".") && !isShardName(e.Name()) {
+			names = append(names, e.Name())
+		}
+	}
+	return
+}
+
+// HasFlatLayout returns true if the given cache directory holds files or
+// shared entries in FlatLayout, as left by earlier versions of gcsfuse.
+func HasFlatLayout(cacheDir string) bool {
+	for _, dirPath := range []string{cacheDir, path.Join(cacheDir, SharedEntriesDir)} {
+		if names, _ := FlatLayoutDirs(dirPath); len(names) > 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,114 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/data"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShardedLayout_Paths(t *testing.T) {
+	downloadPath := ShardedLayout.DownloadPath("/test/dir", "bucket/a/b")
+	entryPath := ShardedLayout.SharedEntryPath("/test/dir", "bucket/a/b")
+
+	m := regexp.MustCompile(`^/test/dir/([0-9a-f]{2}/[0-9a-f]{2})/bucket/a/b$`).FindStringSubmatch(downloadPath)
+	require.NotNil(t, m, downloadPath)
+	assert.Equal(t, "/test/dir/.shared-entries/"+m[1]+"/bucket/a/b", entryPath)
+	assert.Equal(t, downloadPath, ShardedLayout.DownloadPath("/test/dir", "bucket/a/b"))
+	assert.Equal(t, downloadPath, GetDownloadPath("/test/dir", "bucket/a/b"))
+	assert.Equal(t, entryPath, GetSharedEntryPath("/test/dir", "bucket/a/b"))
+}
+
+func TestShardedLayout_SpreadsObjectsOfOneDirectory(t *testing.T) {
+	const objects = 100000
+	counts := make(map[string]int)
+	for i := 0; i < objects; i++ {
+		p := ShardedLayout.DownloadPath("", fmt.Sprintf("bucket/dir/%d", i))
+		counts[path.Dir(path.Dir(path.Dir(p)))]++
+	}
+
+	// Spread over all 256×256 directories, with none more than a few times
+	// fuller than the average.
+	assert.Greater(t, len(counts), 50000)
+	for shard, count := range counts {
+		assert.LessOrEqual(t, count, 20, shard)
+	}
+}
+
+func TestHasFlatLayout(t *testing.T) {
+	testCases := []struct {
+		name  string
+		paths []string
+		want  bool
+	}{
+		{"empty", nil, false},
+		{"lock file", []string{SharedCacheLockFile}, false},
+		{"sharded", []string{
+			ShardedLayout.DownloadPath("", "bucket/a"),
+			ShardedLayout.SharedEntryPath("", "bucket/a"),
+		}, false},
+		{"flat file", []string{FlatLayout.DownloadPath("", "bucket/a")}, true},
+		{"flat shared entry", []string{FlatLayout.SharedEntryPath("", "bucket/a")}, true},
+		{"both", []string{
+			ShardedLayout.DownloadPath("", "bucket/a"),
+			FlatLayout.DownloadPath("", "bucket/b"),
+		}, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cacheDir := t.TempDir()
+			for _, p := range tc.paths {
+				require.NoError(t, os.MkdirAll(path.Dir(path.Join(cacheDir, p)), DefaultDirPerm))
+				require.NoError(t, os.WriteFile(path.Join(cacheDir, p), nil, DefaultFilePerm))
+			}
+
+			assert.Equal(t, tc.want, HasFlatLayout(cacheDir))
+		})
+	}
+}
+
+// Create b.N files for the objects in one directory of a bucket.
+func benchmarkCreateFiles(b *testing.B, layout PathResolver) {
+	cacheDir := b.TempDir()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		fileSpec := data.FileSpec{
+			Path:     layout.DownloadPath(cacheDir, GetObjectPath("bucket", fmt.Sprintf("dir/%d", i))),
+			FilePerm: DefaultFilePerm,
+			DirPerm:  DefaultDirPerm,
+		}
+		f, err := CreateFile(fileSpec, os.O_WRONLY)
+		if err != nil {
+			b.Fatal(err)
+		}
+		_ = f.Close()
+	}
+}
+
+func BenchmarkCreateFile(b *testing.B) {
+	for _, layout := range []PathResolver{FlatLayout, ShardedLayout} {
+		name := strings.TrimPrefix(fmt.Sprintf("%T", layout), "util.")
+		b.Run(name, func(b *testing.B) { benchmarkCreateFiles(b, layout) })
+	}
+}
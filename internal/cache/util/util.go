@@ -15,6 +15,7 @@
 package util
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"path"
@@ -36,6 +37,9 @@ const (
 	FallbackToGCSErrMsg                       = "read via gcs"
 	FileNotPresentInCacheErrMsg               = "file is not present in cache"
 	CacheHandleNotRequiredForRandomReadErrMsg = "cacheFileForRangeRead is false, read type random read and fileInfo entry is absent"
+	NoUsableCacheDirErrMsg                    = "no usable cache directory left"
+	SharedEntryNotAvailableErrMsg             = "file is not available in the shared cache"
+	CacheUnavailableErrMsg                    = "file cache is unavailable after disk errors"
 )
 
 const (
@@ -44,6 +48,12 @@ const (
 	DefaultFilePerm = os.FileMode(0600)
 	DefaultDirPerm  = os.FileMode(0700)
 	FileCache       = "gcsfuse-file-cache"
+
+	// Bucket names can't start with a dot, so these can't clash with the
+	// directories of files in cache.
+	SharedCacheLockFile = ".gcsfuse.lock"
+	SharedEntriesDir    = ".shared-entries"
+	SupersededDir       = ".superseded"
 )
 
 // CreateFile creates file with given file spec i.e. permissions and returns
@@ -56,7 +66,7 @@ func CreateFile(fileSpec data.FileSpec, flag int) (file *os.File, err error) {
 	fileDir := filepath.Dir(fileSpec.Path)
 	err = os.MkdirAll(fileDir, fileSpec.DirPerm)
 	if err != nil {
-		err = fmt.Errorf(fmt.Sprintf("error in creating directory structure %s: %v", fileDir, err))
+		err = fmt.Errorf("error in creating directory structure %s: %w", fileDir, err)
 		return
 	}
 
@@ -66,13 +76,13 @@ func CreateFile(fileSpec data.FileSpec, flag int) (file *os.File, err error) {
 		if os.IsNotExist(err) {
 			flag = flag | os.O_CREATE
 		} else {
-			err = fmt.Errorf(fmt.Sprintf("error in stating file %s: %v", fileSpec.Path, err))
+			err = fmt.Errorf("error in stating file %s: %w", fileSpec.Path, err)
 			return
 		}
 	}
 	file, err = os.OpenFile(fileSpec.Path, flag, fileSpec.FilePerm)
 	if err != nil {
-		err = fmt.Errorf(fmt.Sprintf("error in creating file %s: %v", fileSpec.Path, err))
+		err = fmt.Errorf("error in creating file %s: %w", fileSpec.Path, err)
 		return
 	}
 	return
@@ -84,9 +94,71 @@ func GetObjectPath(bucketName string, objectName string) string {
 	return path.Join(bucketName, objectName)
 }
 
-// GetDownloadPath gives file path to file in cache for given object path.
+// GetDownloadPath gives file path to file in cache for given object path, in
+// the layout of new files, ShardedLayout.
 func GetDownloadPath(cacheDir string, objectPath string) string {
-	return path.Join(cacheDir, objectPath)
+	return ShardedLayout.DownloadPath(cacheDir, objectPath)
+}
+
+// GetSharedEntryPath gives the path to the data.SharedEntry for the file in
+// cache for given object path, in a cache shared by several gcsfuse processes,
+// in the layout of new files, ShardedLayout.
+func GetSharedEntryPath(cacheDir string, objectPath string) string {
+	return ShardedLayout.SharedEntryPath(cacheDir, objectPath)
+}
+
+// WriteSharedEntry writes the given entry to the file with given file spec,
+// replacing it atomically if it exists.
+func WriteSharedEntry(fileSpec data.FileSpec, entry data.SharedEntry) (err error) {
+	buf, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("error in encoding shared entry: %w", err)
+	}
+
+	fileDir := filepath.Dir(fileSpec.Path)
+	err = os.MkdirAll(fileDir, fileSpec.DirPerm)
+	if err != nil {
+		return fmt.Errorf("error in creating directory structure %s: %w", fileDir, err)
+	}
+	f, err := os.CreateTemp(fileDir, ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("error in creating temporary file in %s: %w", fileDir, err)
+	}
+	defer func() {
+		if err != nil {
+			_ = os.Remove(f.Name())
+		}
+	}()
+
+	_, err = f.Write(buf)
+	if err == nil {
+		err = f.Chmod(fileSpec.FilePerm)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("error in writing shared entry %s: %w", f.Name(), err)
+	}
+
+	err = os.Rename(f.Name(), fileSpec.Path)
+	if err != nil {
+		return fmt.Errorf("error in renaming %s to %s: %w", f.Name(), fileSpec.Path, err)
+	}
+	return nil
+}
+
+// ReadSharedEntry reads the data.SharedEntry at given path.
+func ReadSharedEntry(entryPath string) (entry data.SharedEntry, err error) {
+	buf, err := os.ReadFile(entryPath)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(buf, &entry)
+	if err != nil {
+		err = fmt.Errorf("error in decoding shared entry %s: %w", entryPath, err)
+	}
+	return
 }
 
 // IsCacheHandleInvalid says either the current cacheHandle is invalid or not, based
@@ -110,14 +182,14 @@ func CreateCacheDirectoryIfNotPresentAt(dirPath string, dirPerm os.FileMode) err
 	if os.IsNotExist(statErr) {
 		err := os.MkdirAll(dirPath, dirPerm)
 		if err != nil {
-			return fmt.Errorf("error in creating directory structure %s: %v", dirPath, err)
+			return fmt.Errorf("error in creating directory structure %s: %w", dirPath, err)
 		}
 	}
 
 	f, err := fsutil.AnonymousFile(dirPath)
 	if err != nil {
 		return fmt.Errorf(
-			"error creating file at directory (%s), error : (%v)", dirPath, err.Error())
+			"error creating file at directory (%s), error : (%w)", dirPath, err)
 	}
 
 	tempFileErr := f.Close()
@@ -201,13 +201,13 @@ func (ut *utilTest) Test_getObjectPath() {
 
 	results := [5]string{}
 	for i := 0; i < 5; i++ {
-		results[i] = GetDownloadPath(inputs[i][0], inputs[i][1])
+		results[i] = GetObjectPath(inputs[i][0], inputs[i][1])
 	}
 
 	ExpectTrue(reflect.DeepEqual(expectedOutPuts, results))
 }
 
-func (ut *utilTest) Test_getDownloadPath() {
+func (ut *utilTest) Test_FlatLayout_DownloadPath() {
 	inputs := []string{"/", "a/b", "a/b/c/d", "/a", "a/"}
 	cacheDir := "/test/dir"
 	expectedOutputs := [5]string{cacheDir, cacheDir + "/a/b",
@@ -215,12 +215,68 @@ func (ut *utilTest) Test_getDownloadPath() {
 
 	results := [5]string{}
 	for i := 0; i < 5; i++ {
-		results[i] = GetDownloadPath(cacheDir, inputs[i])
+		results[i] = FlatLayout.DownloadPath(cacheDir, inputs[i])
 	}
 
 	ExpectTrue(reflect.DeepEqual(expectedOutputs, results))
 }
 
+func (ut *utilTest) Test_FlatLayout_SharedEntryPath() {
+	ExpectEq("/test/dir/.shared-entries/a/b", FlatLayout.SharedEntryPath("/test/dir", "a/b"))
+}
+
+func (ut *utilTest) Test_WriteSharedEntry_ReadSharedEntry() {
+	crc := uint32(1234)
+	entry := data.SharedEntry{
+		Key:              data.FileInfoKey{BucketName: "bucket", ObjectName: "a/b"},
+		ObjectGeneration: 5,
+		FileSize:         10,
+		CRC32C:           &crc,
+	}
+
+	err := WriteSharedEntry(ut.fileSpec, entry)
+
+	AssertEq(nil, err)
+	fileInfo, err := os.Stat(ut.fileSpec.Path)
+	AssertEq(nil, err)
+	ExpectEq(ut.fileSpec.FilePerm, fileInfo.Mode().Perm())
+	readEntry, err := ReadSharedEntry(ut.fileSpec.Path)
+	AssertEq(nil, err)
+	ExpectEq(entry.Key.BucketName, readEntry.Key.BucketName)
+	ExpectEq(entry.Key.ObjectName, readEntry.Key.ObjectName)
+	ExpectEq(entry.ObjectGeneration, readEntry.ObjectGeneration)
+	ExpectEq(entry.FileSize, readEntry.FileSize)
+	AssertNe(nil, readEntry.CRC32C)
+	ExpectEq(crc, *readEntry.CRC32C)
+}
+
+func (ut *utilTest) Test_WriteSharedEntry_ReplacesExisting() {
+	err := WriteSharedEntry(ut.fileSpec, data.SharedEntry{ObjectGeneration: 1})
+	AssertEq(nil, err)
+
+	err = WriteSharedEntry(ut.fileSpec, data.SharedEntry{ObjectGeneration: 2})
+
+	AssertEq(nil, err)
+	entry, err := ReadSharedEntry(ut.fileSpec.Path)
+	AssertEq(nil, err)
+	ExpectEq(2, entry.ObjectGeneration)
+	dirEntries, err := os.ReadDir(path.Dir(ut.fileSpec.Path))
+	AssertEq(nil, err)
+	ExpectEq(1, len(dirEntries))
+}
+
+func (ut *utilTest) Test_ReadSharedEntry_Malformed() {
+	file, err := CreateFile(ut.fileSpec, os.O_WRONLY)
+	AssertEq(nil, err)
+	_, err = file.WriteString("{")
+	AssertEq(nil, err)
+	AssertEq(nil, file.Close())
+
+	_, err = ReadSharedEntry(ut.fileSpec.Path)
+
+	ExpectNe(nil, err)
+}
+
 func (ut *utilTest) Test_IsCacheHandleValid_True() {
 	errMessages := []string{
 		InvalidFileHandleErrMsg + "test",
@@ -297,4 +353,6 @@ func Test_CreateCacheDirectoryIfNotPresentAt_ShouldReturnErrorWhenDirectoryDoesN
 
 	AssertNe(nil, err)
 	AssertTrue(strings.Contains(err.Error(), "error creating file at directory ("+dirPath+")"))
+	// The errno is kept, for the file cache to fall back to being read-only.
+	AssertTrue(errors.Is(err, syscall.EACCES))
 }
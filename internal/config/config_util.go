@@ -21,15 +21,23 @@ import (
 )
 
 const (
-	IgnoreInterruptsFlagName   = "ignore-interrupts"
-	AnonymousAccess            = "anonymous-access"
-	KernelListCacheTtlFlagName = "kernel-list-cache-ttl-secs"
-	TtlInSecsInvalidValueError = "the value of ttl-secs can't be less than -1"
-	TtlInSecsTooHighError      = "the value of ttl-secs is too high to be supported. Max is 9223372036"
+	IgnoreInterruptsFlagName      = "ignore-interrupts"
+	AnonymousAccess               = "anonymous-access"
+	KernelListCacheTtlFlagName    = "kernel-list-cache-ttl-secs"
+	ClientProtocolFlagName        = "client-protocol"
+	MaxConnsPerHostFlagName       = "max-conns-per-host"
+	MaxIdleConnsPerHostFlagName   = "max-idle-conns-per-host"
+	MetricsDetailedErrorsFlagName = "metrics-detailed-errors"
+	TtlInSecsInvalidValueError    = "the value of ttl-secs can't be less than -1"
+	TtlInSecsTooHighError         = "the value of ttl-secs is too high to be supported. Max is 9223372036"
 
 	// MaxSupportedTtlInSeconds represents maximum multiple of seconds representable by time.Duration.
 	MaxSupportedTtlInSeconds = math.MaxInt64 / int64(time.Second)
 	MaxSupportedTtl          = time.Duration(MaxSupportedTtlInSeconds * int64(time.Second))
+
+	// MaxSequentialReadSizeMb is the max value supported for
+	// sequential-read-size-mb.
+	MaxSequentialReadSizeMb = 1024
 )
 
 // OverrideWithLoggingFlags overwrites the configs with the flag values if the
@@ -83,6 +91,32 @@ func OverrideWithKernelListCacheTtlFlag(c cliContext, mountConfig *MountConfig,
 	}
 }
 
+// OverrideWithMetricsDetailedErrorsFlag overwrites the metrics:detailed-errors
+// config with the metrics-detailed-errors cli-flag value if the cli-flag is set
+// by user.
+func OverrideWithMetricsDetailedErrorsFlag(c cliContext, mountConfig *MountConfig, detailedErrors bool) {
+	if c.IsSet(MetricsDetailedErrorsFlagName) {
+		mountConfig.MetricsConfig.DetailedErrors = detailedErrors
+	}
+}
+
+// OverrideWithGCSConnectionFlags overwrites the gcs-connection configs with
+// the corresponding cli-flag values if they are set by the user, and checks
+// the result for incompatible settings.
+func OverrideWithGCSConnectionFlags(c cliContext, mountConfig *MountConfig,
+	clientProtocol string, maxConnsPerHost int, maxIdleConnsPerHost int) error {
+	if c.IsSet(ClientProtocolFlagName) {
+		mountConfig.GCSConnectionConfig.ClientProtocol = clientProtocol
+	}
+	if c.IsSet(MaxConnsPerHostFlagName) {
+		mountConfig.GCSConnectionConfig.MaxConnsPerHost = maxConnsPerHost
+	}
+	if c.IsSet(MaxIdleConnsPerHostFlagName) {
+		mountConfig.GCSConnectionConfig.MaxIdleConnsPerHost = maxIdleConnsPerHost
+	}
+	return mountConfig.GCSConnectionConfig.validate()
+}
+
 func IsFileCacheEnabled(mountConfig *MountConfig) bool {
 	return mountConfig.FileCacheConfig.MaxSizeMB != 0 && string(mountConfig.CacheDir) != ""
 }
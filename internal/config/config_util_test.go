@@ -217,6 +217,31 @@ func Test_OverrideWithKernelListCacheTtlFlag(t *testing.T) {
 	}
 }
 
+func Test_OverrideWithMetricsDetailedErrorsFlag(t *testing.T) {
+	var testCases = []struct {
+		configValue   bool
+		flagValue     bool
+		isFlagSet     bool
+		expectedValue bool
+	}{
+		{true, false, true, false},
+		{true, false, false, true},
+		{false, true, true, true},
+		{false, false, false, false},
+	}
+
+	for index, tt := range testCases {
+		t.Run(fmt.Sprintf("Test case: %d", index), func(t *testing.T) {
+			testContext := &TestCliContext{isSet: tt.isFlagSet}
+			mountConfig := &MountConfig{MetricsConfig: MetricsConfig{DetailedErrors: tt.configValue}}
+
+			OverrideWithMetricsDetailedErrorsFlag(testContext, mountConfig, tt.flagValue)
+
+			assert.Equal(t, tt.expectedValue, mountConfig.MetricsConfig.DetailedErrors)
+		})
+	}
+}
+
 func Test_IsTtlInSecsValid(t *testing.T) {
 	var testCases = []struct {
 		testName    string
@@ -267,3 +292,53 @@ func Test_ListCacheTtlSecsToDuration_InvalidCall(t *testing.T) {
 	// Calling with invalid argument to trigger panic.
 	ListCacheTtlSecsToDuration(-3)
 }
+
+func Test_OverrideWithGCSConnectionFlags(t *testing.T) {
+	var testCases = []struct {
+		testName       string
+		configValue    GCSConnectionConfig
+		protocolFlag   string
+		isFlagSet      bool
+		expectedConfig GCSConnectionConfig
+		expectedErr    string
+	}{
+		{
+			testName:       "flags not set",
+			configValue:    GCSConnectionConfig{ClientProtocol: "http2", MaxConnsPerHost: 7, MaxIdleConnsPerHost: 8},
+			protocolFlag:   "http1",
+			isFlagSet:      false,
+			expectedConfig: GCSConnectionConfig{ClientProtocol: "http2", MaxConnsPerHost: 7, MaxIdleConnsPerHost: 8},
+		},
+		{
+			testName:       "flags set",
+			configValue:    GCSConnectionConfig{ClientProtocol: "http2", MaxConnsPerHost: 7, MaxIdleConnsPerHost: 8},
+			protocolFlag:   "http1",
+			isFlagSet:      true,
+			expectedConfig: GCSConnectionConfig{ClientProtocol: "http1", MaxConnsPerHost: 100, MaxIdleConnsPerHost: 50},
+		},
+		{
+			testName:       "flag makes config incompatible",
+			configValue:    GCSConnectionConfig{ClientProtocol: "http1", IdleConnTimeout: time.Minute},
+			protocolFlag:   "grpc",
+			isFlagSet:      true,
+			expectedConfig: GCSConnectionConfig{ClientProtocol: "grpc", MaxConnsPerHost: 100, MaxIdleConnsPerHost: 50, IdleConnTimeout: time.Minute},
+			expectedErr:    "not supported with client-protocol grpc",
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.testName, func(t *testing.T) {
+			testContext := &TestCliContext{isSet: tt.isFlagSet}
+			mountConfig := &MountConfig{GCSConnectionConfig: tt.configValue}
+
+			err := OverrideWithGCSConnectionFlags(testContext, mountConfig, tt.protocolFlag, 100, 50)
+
+			if tt.expectedErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tt.expectedErr)
+			}
+			assert.Equal(t, tt.expectedConfig, mountConfig.GCSConnectionConfig)
+		})
+	}
+}
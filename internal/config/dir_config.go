@@ -0,0 +1,189 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DirConfigFileName is the name of the object at the root of a prefix whose
+// contents override the mount's config for the objects under the prefix.
+const DirConfigFileName = ".gcsfuse.yaml"
+
+// DirConfig is the config of a prefix of a bucket, read from its
+// DirConfigFileName object. Only a few keys can be set, each of which is nil
+// if it isn't.
+type DirConfig struct {
+	MetadataCache DirMetadataCacheConfig `yaml:"metadata-cache"`
+	FileCache     DirFileCacheConfig     `yaml:"file-cache"`
+
+	// SequentialReadSizeMb overrides --sequential-read-size-mb.
+	SequentialReadSizeMb *int32 `yaml:"sequential-read-size-mb"`
+}
+
+type DirMetadataCacheConfig struct {
+	// TtlInSeconds overrides metadata-cache:ttl-secs for the stat cache, the
+	// type cache and the attributes of inodes.
+	TtlInSeconds *int64 `yaml:"ttl-secs"`
+}
+
+type DirFileCacheConfig struct {
+	// Enabled, if false, keeps files out of the file cache.
+	Enabled *bool `yaml:"enabled"`
+
+	// CacheFileForRangeRead overrides file-cache:cache-file-for-range-read.
+	CacheFileForRangeRead *bool `yaml:"cache-file-for-range-read"`
+}
+
+// ParseDirConfig parses the contents of a DirConfigFileName object. Keys
+// other than those of DirConfig are an error.
+func ParseDirConfig(buf []byte) (c *DirConfig, err error) {
+	c = &DirConfig{}
+	decoder := yaml.NewDecoder(bytes.NewReader(buf))
+	decoder.KnownFields(true)
+	if err = decoder.Decode(c); err != nil {
+		// Decode returns EOF in case of an empty file.
+		if err == io.EOF {
+			return c, nil
+		}
+		return nil, fmt.Errorf("error parsing %s: %w", DirConfigFileName, err)
+	}
+
+	if ttl := c.MetadataCache.TtlInSeconds; ttl != nil {
+		if err = IsTtlInSecsValid(*ttl); err != nil {
+			return nil, fmt.Errorf("error parsing %s: %w", DirConfigFileName, err)
+		}
+	}
+	if size := c.SequentialReadSizeMb; size != nil && (*size < 1 || *size > MaxSequentialReadSizeMb) {
+		return nil, fmt.Errorf("error parsing %s: sequential-read-size-mb should be between 1 and %d", DirConfigFileName, MaxSequentialReadSizeMb)
+	}
+	return c, nil
+}
+
+// MetadataTTL returns the ttl for cached metadata, or defaultTTL if it isn't
+// overridden.
+func (c DirConfig) MetadataTTL(defaultTTL time.Duration) time.Duration {
+	if c.MetadataCache.TtlInSeconds == nil {
+		return defaultTTL
+	}
+	return ListCacheTtlSecsToDuration(*c.MetadataCache.TtlInSeconds)
+}
+
+// FileCacheEnabled returns whether files may be added to the file cache.
+func (c DirConfig) FileCacheEnabled() bool {
+	return c.FileCache.Enabled == nil || *c.FileCache.Enabled
+}
+
+// CacheFileForRangeRead returns whether files read at random are added to
+// the file cache, or defaultValue if it isn't overridden.
+func (c DirConfig) CacheFileForRangeRead(defaultValue bool) bool {
+	if c.FileCache.CacheFileForRangeRead == nil {
+		return defaultValue
+	}
+	return *c.FileCache.CacheFileForRangeRead
+}
+
+// SequentialReadSize returns the sequential read size in MB, or defaultMb if
+// it isn't overridden.
+func (c DirConfig) SequentialReadSize(defaultMb int32) int32 {
+	if c.SequentialReadSizeMb == nil {
+		return defaultMb
+	}
+	return *c.SequentialReadSizeMb
+}
+
+// merge sets the keys of c that are unset from those of parent.
+func (c *DirConfig) merge(parent *DirConfig) {
+	if c.MetadataCache.TtlInSeconds == nil {
+		c.MetadataCache.TtlInSeconds = parent.MetadataCache.TtlInSeconds
+	}
+	if c.FileCache.Enabled == nil {
+		c.FileCache.Enabled = parent.FileCache.Enabled
+	}
+	if c.FileCache.CacheFileForRangeRead == nil {
+		c.FileCache.CacheFileForRangeRead = parent.FileCache.CacheFileForRangeRead
+	}
+	if c.SequentialReadSizeMb == nil {
+		c.SequentialReadSizeMb = parent.SequentialReadSizeMb
+	}
+}
+
+type dirConfigKey struct {
+	bucket string
+	prefix string
+}
+
+// DirConfigs holds the configs of prefixes of the mounted buckets. It is
+// safe for concurrent access, and a nil *DirConfigs holds no configs.
+type DirConfigs struct {
+	mu sync.RWMutex
+
+	// GUARDED_BY(mu)
+	configs map[dirConfigKey]*DirConfig
+}
+
+func NewDirConfigs() *DirConfigs {
+	return &DirConfigs{configs: make(map[dirConfigKey]*DirConfig)}
+}
+
+// Set sets the config of a prefix of a bucket, ending in a slash or empty for
+// the whole bucket. A nil config removes it.
+func (d *DirConfigs) Set(bucket, prefix string, c *DirConfig) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	key := dirConfigKey{bucket: bucket, prefix: prefix}
+	if c == nil {
+		delete(d.configs, key)
+		return
+	}
+	d.configs[key] = c
+}
+
+// Resolve returns the config for the object with the given name. Each key is
+// taken from the longest prefix of the name ending in a slash, or the empty
+// prefix, whose config sets it. The config of a directory therefore applies
+// to the directory itself, as well as to the objects under it.
+func (d *DirConfigs) Resolve(bucket, name string) (c DirConfig) {
+	if d == nil {
+		return
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if len(d.configs) == 0 {
+		return
+	}
+
+	// Walk up from the longest prefix to the root of the bucket.
+	for {
+		i := strings.LastIndex(name, "/")
+		if prefixConfig, ok := d.configs[dirConfigKey{bucket: bucket, prefix: name[:i+1]}]; ok {
+			c.merge(prefixConfig)
+		}
+		if i < 0 {
+			return
+		}
+		name = name[:i]
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func mustParseDirConfig(t *testing.T, contents string) *DirConfig {
+	c, err := ParseDirConfig([]byte(contents))
+	require.NoError(t, err)
+	return c
+}
+
+func TestParseDirConfig(t *testing.T) {
+	c := mustParseDirConfig(t, `
+metadata-cache:
+  ttl-secs: 5
+file-cache:
+  enabled: false
+  cache-file-for-range-read: true
+sequential-read-size-mb: 8
+`)
+
+	assert.Equal(t, 5*time.Second, c.MetadataTTL(time.Minute))
+	assert.False(t, c.FileCacheEnabled())
+	assert.True(t, c.CacheFileForRangeRead(false))
+	assert.Equal(t, int32(8), c.SequentialReadSize(200))
+}
+
+func TestParseDirConfig_Empty(t *testing.T) {
+	c := mustParseDirConfig(t, "")
+
+	assert.Equal(t, time.Minute, c.MetadataTTL(time.Minute))
+	assert.True(t, c.FileCacheEnabled())
+	assert.False(t, c.CacheFileForRangeRead(false))
+	assert.Equal(t, int32(200), c.SequentialReadSize(200))
+}
+
+func TestParseDirConfig_NoTTL(t *testing.T) {
+	c := mustParseDirConfig(t, "metadata-cache:\n  ttl-secs: -1\n")
+
+	assert.Equal(t, MaxSupportedTtl, c.MetadataTTL(time.Minute))
+}
+
+func TestParseDirConfig_Invalid(t *testing.T) {
+	for _, contents := range []string{
+		"not: [yaml",
+		"metadata-cache:\n  stat-cache-max-size-mb: 10\n",
+		"file-cache:\n  max-size-mb: 10\n",
+		"logging:\n  severity: trace\n",
+		"metadata-cache:\n  ttl-secs: -2\n",
+		"sequential-read-size-mb: 0\n",
+		"sequential-read-size-mb: 2048\n",
+	} {
+		_, err := ParseDirConfig([]byte(contents))
+
+		assert.Error(t, err, contents)
+	}
+}
+
+func TestDirConfigs_Resolve(t *testing.T) {
+	d := NewDirConfigs()
+	d.Set("bucket", "", mustParseDirConfig(t, "sequential-read-size-mb: 1\nmetadata-cache:\n  ttl-secs: 10\n"))
+	d.Set("bucket", "team/", mustParseDirConfig(t, "metadata-cache:\n  ttl-secs: 0\n"))
+	d.Set("bucket", "team/raw/", mustParseDirConfig(t, "file-cache:\n  enabled: false\n"))
+	d.Set("other", "team/", mustParseDirConfig(t, "sequential-read-size-mb: 64\n"))
+
+	testCases := []struct {
+		name    string
+		ttl     time.Duration
+		cache   bool
+		readMb  int32
+		comment string
+	}{
+		{"foo", 10 * time.Second, true, 1, "only the root applies"},
+		{"teams/foo", 10 * time.Second, true, 1, "prefixes match whole directories"},
+		{"team", 10 * time.Second, true, 1, "a file named like the directory isn't under it"},
+		{"team/", 0, true, 1, "a directory's config applies to itself"},
+		{"team/foo", 0, true, 1, "the longest prefix wins"},
+		{"team/raw/a/b", 0, false, 1, "unset keys fall back to shorter prefixes"},
+	}
+	for _, tc := range testCases {
+		c := d.Resolve("bucket", tc.name)
+
+		assert.Equal(t, tc.ttl, c.MetadataTTL(time.Hour), tc.comment)
+		assert.Equal(t, tc.cache, c.FileCacheEnabled(), tc.comment)
+		assert.Equal(t, tc.readMb, c.SequentialReadSize(200), tc.comment)
+	}
+
+	// Other buckets have their own configs.
+	c := d.Resolve("other", "team/foo")
+	assert.Equal(t, time.Hour, c.MetadataTTL(time.Hour))
+	assert.Equal(t, int32(64), c.SequentialReadSize(200))
+}
+
+func TestDirConfigs_SetNilRemoves(t *testing.T) {
+	d := NewDirConfigs()
+	d.Set("bucket", "team/", mustParseDirConfig(t, "sequential-read-size-mb: 8\n"))
+	d.Set("bucket", "team/", nil)
+
+	assert.Equal(t, int32(200), d.Resolve("bucket", "team/foo").SequentialReadSize(200))
+}
+
+func TestDirConfigs_Nil(t *testing.T) {
+	var d *DirConfigs
+
+	assert.Equal(t, time.Hour, d.Resolve("bucket", "team/foo").MetadataTTL(time.Hour))
+}
@@ -0,0 +1,153 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// EffectiveConfigFileName is the name of the file in the cache dir to which
+	// the effective config of a mount is written.
+	EffectiveConfigFileName = "effective-config.yaml"
+
+	// RedactedValue replaces the values of fields tagged `redact:"true"` in the
+	// marshalled effective config.
+	RedactedValue = "<redacted>"
+)
+
+// EffectiveConfig is the fully resolved configuration of a mount: the command
+// line flags, the config file merged with its defaults and with the flags
+// overriding it, and the fuse capabilities the kernel grants, if known.
+//
+// Fields whose values may hold secrets, in Flags or Config, must be tagged
+// `redact:"true"` so that Marshal leaves them out.
+type EffectiveConfig struct {
+	Flags            any          `yaml:"flags"`
+	Config           *MountConfig `yaml:"config"`
+	FuseCapabilities any          `yaml:"fuse-capabilities"`
+}
+
+// Marshal returns the config as yaml, with the values of redacted fields
+// replaced by RedactedValue, and user info stripped from urls. Fields are
+// named after their yaml tag if they have one, and otherwise after the field.
+func (c *EffectiveConfig) Marshal() ([]byte, error) {
+	n, err := redactedNode(reflect.ValueOf(c))
+	if err != nil {
+		return nil, fmt.Errorf("effective config: %w", err)
+	}
+
+	// Indent like the config file.
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err = encoder.Encode(n); err != nil {
+		return nil, fmt.Errorf("effective config: %w", err)
+	}
+	if err = encoder.Close(); err != nil {
+		return nil, fmt.Errorf("effective config: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+var urlType = reflect.TypeOf(url.URL{})
+
+// redactedNode converts v to a yaml node, redacting the fields that are
+// tagged for it.
+func redactedNode(v reflect.Value) (n *yaml.Node, err error) {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			n = &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Value: "null"}
+			return
+		}
+		v = v.Elem()
+	}
+
+	switch {
+	case (v.Kind() == reflect.Map || v.Kind() == reflect.Slice) && v.IsNil():
+		n = &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Value: "null"}
+		return
+
+	case v.Type() == urlType:
+		u := v.Interface().(url.URL)
+		n = &yaml.Node{Kind: yaml.ScalarNode, Value: u.Redacted()}
+		return
+
+	case v.Kind() == reflect.Struct:
+		n = &yaml.Node{Kind: yaml.MappingNode}
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if !field.IsExported() {
+				continue
+			}
+
+			name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+			if name == "-" {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+
+			var value *yaml.Node
+			if field.Tag.Get("redact") == "true" && !v.Field(i).IsZero() {
+				value = &yaml.Node{Kind: yaml.ScalarNode, Value: RedactedValue}
+			} else if value, err = redactedNode(v.Field(i)); err != nil {
+				return
+			}
+
+			n.Content = append(n.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: name}, value)
+		}
+		return
+
+	case v.Kind() == reflect.Map:
+		n = &yaml.Node{Kind: yaml.MappingNode}
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface())
+		})
+		for _, k := range keys {
+			var value *yaml.Node
+			if value, err = redactedNode(v.MapIndex(k)); err != nil {
+				return
+			}
+			n.Content = append(n.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: fmt.Sprint(k.Interface())}, value)
+		}
+		return
+
+	case v.Kind() == reflect.Slice || v.Kind() == reflect.Array:
+		n = &yaml.Node{Kind: yaml.SequenceNode}
+		for i := 0; i < v.Len(); i++ {
+			var value *yaml.Node
+			if value, err = redactedNode(v.Index(i)); err != nil {
+				return
+			}
+			n.Content = append(n.Content, value)
+		}
+		return
+	}
+
+	n = &yaml.Node{}
+	err = n.Encode(v.Interface())
+	return
+}
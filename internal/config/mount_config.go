@@ -16,6 +16,8 @@ package config
 
 import (
 	"math"
+	"path"
+	"time"
 )
 
 const (
@@ -42,6 +44,9 @@ const (
 	StatCacheMaxSizeMBUnsetSentinel int64 = math.MinInt64
 
 	DefaultFileCacheMaxSizeMB               int64 = -1
+	DefaultFileCacheScrubPauseHitsPerSec    int64 = 100
+	DefaultFileCacheMaxSupersededSizeMB     int64 = 1024
+	DefaultFileCachePinnedMaxSizeMB         int64 = -1
 	DefaultEnableEmptyManagedFoldersListing       = false
 	DefaultGrpcConnPoolSize                       = 1
 	DefaultAnonymousAccess                        = false
@@ -57,10 +62,116 @@ const (
 	DefaultExperimentalMetadataPrefetchOnMount = ExperimentalMetadataPrefetchOnMountDisabled
 
 	DefaultKernelListCacheTtlSeconds int64 = 0
+
+	// DefaultCacheControlMaxTtlInSeconds is the default value of
+	// metadata-cache:cache-control-max-ttl-secs, i.e. no bound.
+	DefaultCacheControlMaxTtlInSeconds int64 = -1
+
+	// KernelPageCacheAuto keeps the kernel page cache across opens of a file
+	// as long as the object generation hasn't changed since the last open.
+	KernelPageCacheAuto string = "auto"
+	// KernelPageCacheAlways keeps the kernel page cache across opens regardless
+	// of the object generation.
+	KernelPageCacheAlways string = "always"
+	// KernelPageCacheNever drops the kernel page cache on every open.
+	KernelPageCacheNever string = "never"
+	// DefaultKernelPageCache is the default value of --kernel-page-cache.
+	DefaultKernelPageCache = KernelPageCacheAuto
+
+	// DirTimesMount gives directories the time at which their inode was
+	// created, usually around mount time.
+	DirTimesMount string = "mount"
+	// DirTimesPlaceholder gives explicit directories the update time of their
+	// placeholder object.
+	DirTimesPlaceholder string = "placeholder"
+	// DirTimesNewestChild gives directories the latest update time of the
+	// children seen by their last listing.
+	DirTimesNewestChild string = "newest-child"
+	// DefaultDirTimes is the default value of --dir-times.
+	DefaultDirTimes = DirTimesMount
+
+	// ClobberBehaviorError fails operations on a file whose object has been
+	// replaced or deleted by another writer since it was opened with ESTALE.
+	ClobberBehaviorError string = "error"
+	// ClobberBehaviorIgnore keeps serving the generation a file was opened at
+	// for as long as it can be read.
+	ClobberBehaviorIgnore string = "ignore"
+	// ClobberBehaviorRefresh moves read-only handles of a clobbered file to
+	// the new generation, and otherwise behaves like ClobberBehaviorError.
+	ClobberBehaviorRefresh string = "refresh"
+	// DefaultClobberBehavior is the default value of write:clobber-behavior.
+	DefaultClobberBehavior = ClobberBehaviorError
+
+	// CreateExistenceCheckNone doesn't check whether the object of a newly
+	// created file exists in GCS, so a file created over an object unknown to
+	// the metadata cache is treated as clobbered when it is flushed.
+	CreateExistenceCheckNone string = "none"
+	// CreateExistenceCheckOpen fails creating a file with EEXIST if its object
+	// exists in GCS, at the cost of a stat of GCS per create.
+	CreateExistenceCheckOpen string = "open"
+	// CreateExistenceCheckFlush fails flushing a newly created file with EEXIST
+	// if its object was created in GCS in the meantime.
+	CreateExistenceCheckFlush string = "flush"
+	// DefaultCreateExistenceCheck is the default value of
+	// write:create-existence-check.
+	DefaultCreateExistenceCheck = CreateExistenceCheckNone
+
+	// CreateParentPlaceholdersNever creates no objects for the directories
+	// above a new file, so those without a placeholder object stay implicit.
+	CreateParentPlaceholdersNever string = "never"
+	// CreateParentPlaceholdersMissingOnly creates placeholder objects for the
+	// directories above a new file that the mount knows to be implicit.
+	CreateParentPlaceholdersMissingOnly string = "missing-only"
+	// CreateParentPlaceholdersAlways creates placeholder objects for all the
+	// directories above a new file that don't have one in GCS, without
+	// trusting what the mount knows of them.
+	CreateParentPlaceholdersAlways string = "always"
+	// DefaultCreateParentPlaceholders is the default value of
+	// write:create-parent-placeholders.
+	DefaultCreateParentPlaceholders = CreateParentPlaceholdersNever
+
+	// SuppressedCreateLocal lets files with a suppressed name be created, but
+	// keeps them local to the mount, never uploading them.
+	SuppressedCreateLocal string = "local"
+	// SuppressedCreateReject fails creating files with a suppressed name with
+	// EPERM.
+	SuppressedCreateReject string = "reject"
+	// DefaultSuppressedCreate is the default value of list:suppressed-create.
+	DefaultSuppressedCreate = SuppressedCreateLocal
+
+	// Defaults for gcs-connection, matching the defaults of the corresponding
+	// flags.
+	DefaultClientProtocol      = "http1"
+	DefaultMaxConnsPerHost     = 0
+	DefaultMaxIdleConnsPerHost = 100
+	DefaultOpMetadataHeader    = "x-goog-custom-audit-gcsfuse-op"
+	DefaultDrainTimeout        = 10 * time.Second
 )
 
 type WriteConfig struct {
 	CreateEmptyFile bool `yaml:"create-empty-file"`
+	// What to do when the object backing an open file is replaced or deleted
+	// by another writer: one of ClobberBehaviorError, ClobberBehaviorIgnore and
+	// ClobberBehaviorRefresh.
+	ClobberBehavior string `yaml:"clobber-behavior"`
+	// When to check that no object exists with the name of a file being
+	// created without create-empty-file: one of CreateExistenceCheckNone,
+	// CreateExistenceCheckOpen and CreateExistenceCheckFlush.
+	CreateExistenceCheck string `yaml:"create-existence-check"`
+	// Whether uploading a new file also creates placeholder objects for the
+	// directories above it: one of CreateParentPlaceholdersNever,
+	// CreateParentPlaceholdersMissingOnly and CreateParentPlaceholdersAlways.
+	CreateParentPlaceholders string `yaml:"create-parent-placeholders"`
+	// Content types to create objects with, by file extension (e.g. ".foo"),
+	// taking precedence over the types inferred from the extension.
+	ContentTypeOverrides map[string]string `yaml:"content-type-overrides"`
+	// Create objects without a content type rather than inferring one from the
+	// file extension, in which case GCS serves them as
+	// application/octet-stream.
+	DisableContentTypeInference bool `yaml:"disable-content-type-inference"`
+	// Log the object-level operations planned for multi-object mutations, such
+	// as renaming a directory or a composite upload, before executing them.
+	LogMutationPlan bool `yaml:"log-mutation-plan"`
 }
 
 type LogConfig struct {
@@ -68,6 +179,14 @@ type LogConfig struct {
 	Format          string          `yaml:"format"`
 	FilePath        string          `yaml:"file-path"`
 	LogRotateConfig LogRotateConfig `yaml:"log-rotate"`
+	// Records of the progress of uploads, written whatever the severity.
+	UploadProgress UploadProgressLogConfig `yaml:"upload-progress"`
+}
+
+type UploadProgressLogConfig struct {
+	// Log the progress of an upload each time this many more MiB have been
+	// sent, and once it is done. Zero disables the records.
+	IntervalMB int64 `yaml:"interval-mb"`
 }
 
 type ListConfig struct {
@@ -79,6 +198,42 @@ type ListConfig struct {
 	// (b) If both ImplicitDirectories and EnableEmptyManagedFolders are true, then all the managed folders are listed including the above-mentioned corner case.
 	// (c) If ImplicitDirectories is false then no managed folders are listed irrespective of EnableEmptyManagedFolders flag.
 	EnableEmptyManagedFolders bool `yaml:"enable-empty-managed-folders"`
+	// Names, or path.Match patterns of names, of files that desktop clients
+	// probe for in every directory and that aren't worth a GCS request: looking
+	// them up fails with ENOENT without asking GCS, and objects with them are
+	// left out of listings. Setting the key replaces DefaultSuppressedNames.
+	SuppressedNames []string `yaml:"suppressed-names"`
+	// What to do when a file with a suppressed name is created: one of
+	// SuppressedCreateLocal and SuppressedCreateReject.
+	SuppressedCreate string `yaml:"suppressed-create"`
+}
+
+// DefaultSuppressedNames are the names of the files that macOS, GNOME, KDE and
+// Windows clients look for, or leave behind, in the directories they browse.
+var DefaultSuppressedNames = []string{
+	".DS_Store",
+	"._*",
+	".Spotlight-V100",
+	".Trashes",
+	".Trash",
+	".Trash-*",
+	".hidden",
+	".localized",
+	".directory",
+	"autorun.inf",
+	"desktop.ini",
+}
+
+// IsSuppressedName reports whether name, the last component of a path,
+// matches one of the suppressed names.
+func (listConfig *ListConfig) IsSuppressedName(name string) bool {
+	for _, pattern := range listConfig.SuppressedNames {
+		// The patterns are checked when the config is parsed.
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
 }
 
 type GrpcClientConfig struct {
@@ -96,15 +251,102 @@ type AuthConfig struct {
 type EnableHNS bool
 type CacheDir string
 
+// CacheDirSpec is one of several directories to spread the file cache across,
+// given as a list in cache-dir in the config file.
+type CacheDirSpec struct {
+	Path CacheDir `yaml:"path"`
+
+	// Weight is the share of new files placed in the directory, relative to
+	// the others. Either every directory has a weight or none does, in which
+	// case new files go to the one with the most free space.
+	Weight int64 `yaml:"weight,omitempty"`
+}
+
 type FileSystemConfig struct {
 	IgnoreInterrupts          bool  `yaml:"ignore-interrupts"`
 	DisableParallelDirops     bool  `yaml:"disable-parallel-dirops"`
 	KernelListCacheTtlSeconds int64 `yaml:"kernel-list-cache-ttl-secs"`
+
+	// DirConfigFiles makes DirConfigFileName objects override some of the
+	// config for the objects under their prefix.
+	DirConfigFiles bool `yaml:"dir-config-files"`
+}
+
+// GCSConnectionConfig controls the connection to GCS. The timeouts apply only
+// to the http1 and http2 client protocols; zero means no timeout.
+type GCSConnectionConfig struct {
+	ClientProtocol        string        `yaml:"client-protocol"`
+	MaxConnsPerHost       int           `yaml:"max-conns-per-host"`
+	MaxIdleConnsPerHost   int           `yaml:"max-idle-conns-per-host"`
+	IdleConnTimeout       time.Duration `yaml:"idle-conn-timeout"`
+	TLSHandshakeTimeout   time.Duration `yaml:"tls-handshake-timeout"`
+	ResponseHeaderTimeout time.Duration `yaml:"response-header-timeout"`
+
+	// OpMetadataHeader is the header each request to GCS carries the file
+	// system operation it's made for in, e.g. "op=ReadFile;id=42". Headers
+	// starting with x-goog-custom-audit- show up in the Cloud Audit Logs of the
+	// bucket. Empty disables the header.
+	OpMetadataHeader string `yaml:"op-metadata-header"`
+
+	// OpMetadataUid adds the uid of the process that made the operation to
+	// that header.
+	OpMetadataUid bool `yaml:"op-metadata-uid"`
+
+	// DrainTimeout is how long unmounting waits for the requests to GCS in
+	// flight to complete before closing the connections, whatever the client
+	// protocol. Zero doesn't wait.
+	DrainTimeout time.Duration `yaml:"drain-timeout"`
+}
+
+// AdvisoryConfig controls the advisories logged on access patterns gcsfuse
+// serves poorly.
+type AdvisoryConfig struct {
+	// The patterns not to advise on: random-reads, small-writes and
+	// re-downloads.
+	DisabledAdvisories []string `yaml:"disable"`
+}
+
+// MetricsConfig controls the metrics gcsfuse exports.
+type MetricsConfig struct {
+	// If true, the op error count is also broken down by errno name. See
+	// wrappers.MonitoringOptions.DetailedErrors.
+	DetailedErrors bool `yaml:"detailed-errors"`
 }
 
 type FileCacheConfig struct {
 	MaxSizeMB             int64 `yaml:"max-size-mb"`
 	CacheFileForRangeRead bool  `yaml:"cache-file-for-range-read"`
+
+	// ScrubBytesPerSec is the rate at which cached files are read back in the
+	// background to check them against the CRC32C of their objects. 0 disables
+	// the check.
+	ScrubBytesPerSec int64 `yaml:"scrub-bytes-per-sec"`
+
+	// ScrubPauseHitsPerSec pauses that check while more reads than this per
+	// second are served from the cache.
+	ScrubPauseHitsPerSec int64 `yaml:"scrub-pause-hits-per-sec"`
+
+	// Shared lets several gcsfuse processes use the same cache directory: one
+	// of them downloads into it, and the others read what it has downloaded.
+	Shared bool `yaml:"shared"`
+
+	// ReadOnly makes the cache read-only: the files downloaded into it by a
+	// process sharing it are read, and nothing is written to it. It's also set
+	// if the cache directory can't be written to.
+	ReadOnly bool `yaml:"read-only"`
+
+	// MaxSupersededSizeMB caps the files kept in the cache for the readers of
+	// generations of objects that have since been replaced in it by newer
+	// ones, on top of MaxSizeMB. -1 means no limit, and 0 removes them at once.
+	MaxSupersededSizeMB int64 `yaml:"max-superseded-size-mb"`
+
+	// PinnedPrefixes are prefixes of object names whose files are pinned in
+	// the cache: they aren't evicted to make room for other files, only when
+	// their objects change. PinnedMaxSizeMB caps the pinned files, which count
+	// towards MaxSizeMB; beyond it, files are cached unpinned. -1 means no cap
+	// but MaxSizeMB.
+	PinnedPrefixes  []string `yaml:"pinned-prefixes"`
+	PinnedMaxSizeMB int64    `yaml:"pinned-max-size-mb"`
 }
 
 type MetadataCacheConfig struct {
@@ -125,6 +367,19 @@ type MetadataCacheConfig struct {
 	// It can also be set to -1 for no-size-limit, 0 for
 	// no cache. Values below -1 are not supported.
 	StatCacheMaxSizeMB int64 `yaml:"stat-cache-max-size-mb,omitempty"`
+
+	// RespectCacheControl makes the max-age, no-cache and no-store directives
+	// of the Cache-Control metadata of an object override TtlInSeconds for the
+	// metadata of that object, clamped to CacheControlMinTtlInSeconds and
+	// CacheControlMaxTtlInSeconds. The latter can be set to -1 for no bound.
+	RespectCacheControl         bool  `yaml:"respect-cache-control,omitempty"`
+	CacheControlMinTtlInSeconds int64 `yaml:"cache-control-min-ttl-secs,omitempty"`
+	CacheControlMaxTtlInSeconds int64 `yaml:"cache-control-max-ttl-secs,omitempty"`
+
+	// LookupBatchWindow, if non-zero, is how long stats of siblings arriving
+	// while another one is in flight are collected, to be answered together by
+	// a single listing. Zero disables batching.
+	LookupBatchWindow time.Duration `yaml:"lookup-batch-window,omitempty"`
 }
 
 type MountConfig struct {
@@ -138,6 +393,17 @@ type MountConfig struct {
 	AuthConfig          `yaml:"auth-config"`
 	EnableHNS           `yaml:"enable-hns"`
 	FileSystemConfig    `yaml:"file-system"`
+	GCSConnectionConfig `yaml:"gcs-connection"`
+	AdvisoryConfig      `yaml:"advisories"`
+	MetricsConfig       `yaml:"metrics"`
+
+	// Profile is the name of the profile applied, if any. See
+	// ParseConfigFileWithProfile.
+	Profile string `yaml:"profile"`
+
+	// CacheDirs is set if cache-dir is a list of directories in the config
+	// file, in which case CacheDir is the first of them.
+	CacheDirs []CacheDirSpec `yaml:"-"`
 }
 
 // LogRotateConfig defines the parameters for log rotation. It consists of three
@@ -165,6 +431,11 @@ func DefaultLogRotateConfig() LogRotateConfig {
 
 func NewMountConfig() *MountConfig {
 	mountConfig := &MountConfig{}
+	mountConfig.WriteConfig = WriteConfig{
+		ClobberBehavior:          DefaultClobberBehavior,
+		CreateExistenceCheck:     DefaultCreateExistenceCheck,
+		CreateParentPlaceholders: DefaultCreateParentPlaceholders,
+	}
 	mountConfig.LogConfig = LogConfig{
 		// Making the default severity as INFO.
 		Severity: INFO,
@@ -172,15 +443,22 @@ func NewMountConfig() *MountConfig {
 		LogRotateConfig: DefaultLogRotateConfig(),
 	}
 	mountConfig.FileCacheConfig = FileCacheConfig{
-		MaxSizeMB: DefaultFileCacheMaxSizeMB,
+		MaxSizeMB:            DefaultFileCacheMaxSizeMB,
+		ScrubPauseHitsPerSec: DefaultFileCacheScrubPauseHitsPerSec,
+		MaxSupersededSizeMB:  DefaultFileCacheMaxSupersededSizeMB,
+		PinnedMaxSizeMB:      DefaultFileCachePinnedMaxSizeMB,
 	}
 	mountConfig.MetadataCacheConfig = MetadataCacheConfig{
 		TtlInSeconds:       TtlInSecsUnsetSentinel,
 		TypeCacheMaxSizeMB: DefaultTypeCacheMaxSizeMB,
 		StatCacheMaxSizeMB: StatCacheMaxSizeMBUnsetSentinel,
+
+		CacheControlMaxTtlInSeconds: DefaultCacheControlMaxTtlInSeconds,
 	}
 	mountConfig.ListConfig = ListConfig{
 		EnableEmptyManagedFolders: DefaultEnableEmptyManagedFoldersListing,
+		SuppressedNames:           append([]string(nil), DefaultSuppressedNames...),
+		SuppressedCreate:          DefaultSuppressedCreate,
 	}
 	mountConfig.GrpcClientConfig = GrpcClientConfig{
 		ConnPoolSize: DefaultGrpcConnPoolSize,
@@ -193,5 +471,13 @@ func NewMountConfig() *MountConfig {
 	mountConfig.FileSystemConfig = FileSystemConfig{
 		KernelListCacheTtlSeconds: DefaultKernelListCacheTtlSeconds,
 	}
+
+	mountConfig.GCSConnectionConfig = GCSConnectionConfig{
+		ClientProtocol:      DefaultClientProtocol,
+		MaxConnsPerHost:     DefaultMaxConnsPerHost,
+		MaxIdleConnsPerHost: DefaultMaxIdleConnsPerHost,
+		OpMetadataHeader:    DefaultOpMetadataHeader,
+		DrainTimeout:        DefaultDrainTimeout,
+	}
 	return mountConfig
 }
@@ -0,0 +1,114 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	ProfileFlagName = "profile"
+
+	HighThroughputReadProfile = "high-throughput-read"
+	ManySmallFilesProfile     = "many-small-files"
+)
+
+// builtinProfiles are the profiles gcsfuse ships with, applied over the
+// defaults before the config file.
+var builtinProfiles = map[string]func(*MountConfig){
+	// Reading large objects, e.g. the shards of a training dataset, in full
+	// and repeatedly.
+	HighThroughputReadProfile: func(c *MountConfig) {
+		c.FileCacheConfig.CacheFileForRangeRead = true
+		c.GCSConnectionConfig.MaxIdleConnsPerHost = 200
+	},
+
+	// Listing and stating directories of many small objects, e.g. the outputs
+	// of a genomics pipeline.
+	ManySmallFilesProfile: func(c *MountConfig) {
+		c.MetadataCacheConfig.TypeCacheMaxSizeMB = -1
+		c.MetadataCacheConfig.LookupBatchWindow = 5 * time.Millisecond
+		c.FileSystemConfig.KernelListCacheTtlSeconds = 60
+	},
+}
+
+// BuiltinProfileNames returns the names of the built-in profiles, sorted.
+func BuiltinProfileNames() []string {
+	var names []string
+	for name := range builtinProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// extractProfiles takes the profiles out of the config file, so that the rest
+// of the file decodes into a MountConfig, and returns the name of the profile
+// it selects, if any.
+func extractProfiles(buf []byte) (rest []byte, profiles map[string]*yaml.Node, selected string, err error) {
+	var doc yaml.Node
+	if yaml.Unmarshal(buf, &doc) != nil || len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		// Leave any error to the decoding of the whole file.
+		return buf, nil, "", nil
+	}
+
+	m := doc.Content[0]
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == ProfileFlagName && m.Content[i+1].Kind == yaml.ScalarNode {
+			selected = m.Content[i+1].Value
+		}
+	}
+
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value != "profiles" {
+			continue
+		}
+
+		v := m.Content[i+1]
+		if v.Kind != yaml.MappingNode {
+			return nil, nil, "", fmt.Errorf("profiles: line %d: should map names to configs", v.Line)
+		}
+		profiles = make(map[string]*yaml.Node)
+		for j := 0; j+1 < len(v.Content); j += 2 {
+			name := v.Content[j].Value
+			if _, ok := profiles[name]; ok {
+				return nil, nil, "", fmt.Errorf("profiles: %s is defined more than once", name)
+			}
+			profiles[name] = v.Content[j+1]
+		}
+
+		m.Content = append(m.Content[:i], m.Content[i+2:]...)
+		rest, err = yaml.Marshal(&doc)
+		return
+	}
+
+	return buf, nil, selected, nil
+}
+
+// applyUserProfile overlays the profile defined in the config file on
+// mountConfig, failing on fields MountConfig doesn't have.
+func applyUserProfile(mountConfig *MountConfig, name string, profile *yaml.Node) error {
+	if err := decodeStrictly(profile, mountConfig); err != nil {
+		return fmt.Errorf("profiles: %s: %w", name, err)
+	}
+	if mountConfig.Profile != "" && mountConfig.Profile != name {
+		return fmt.Errorf("profiles: %s: can't select another profile", name)
+	}
+	return nil
+}
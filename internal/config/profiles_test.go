@@ -0,0 +1,149 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseConfigFileWithProfile_Builtin(t *testing.T) {
+	mountConfig, err := ParseConfigFileWithProfile("", HighThroughputReadProfile)
+
+	require.NoError(t, err)
+	assert.Equal(t, HighThroughputReadProfile, mountConfig.Profile)
+	assert.True(t, mountConfig.FileCacheConfig.CacheFileForRangeRead)
+	assert.Equal(t, 200, mountConfig.GCSConnectionConfig.MaxIdleConnsPerHost)
+	// The rest are the defaults.
+	assert.Equal(t, DefaultFileCacheMaxSizeMB, mountConfig.FileCacheConfig.MaxSizeMB)
+	assert.Equal(t, DefaultClientProtocol, mountConfig.GCSConnectionConfig.ClientProtocol)
+}
+
+func TestParseConfigFileWithProfile_NoProfile(t *testing.T) {
+	mountConfig, err := ParseConfigFileWithProfile("testdata/profiles/profiles_config.yaml", "")
+
+	require.NoError(t, err)
+	assert.Equal(t, "", mountConfig.Profile)
+	assert.Equal(t, int64(30), mountConfig.FileSystemConfig.KernelListCacheTtlSeconds)
+	assert.Equal(t, 20*time.Millisecond, mountConfig.MetadataCacheConfig.LookupBatchWindow)
+	assert.Equal(t, DefaultTypeCacheMaxSizeMB, mountConfig.MetadataCacheConfig.TypeCacheMaxSizeMB)
+}
+
+func TestParseConfigFileWithProfile_UserProfile(t *testing.T) {
+	mountConfig, err := ParseConfigFileWithProfile("testdata/profiles/profiles_config.yaml", "training")
+
+	require.NoError(t, err)
+	assert.Equal(t, "training", mountConfig.Profile)
+	assert.Equal(t, int64(2048), mountConfig.FileCacheConfig.MaxSizeMB)
+	assert.True(t, mountConfig.FileCacheConfig.CacheFileForRangeRead)
+	assert.Equal(t, "grpc", mountConfig.GCSConnectionConfig.ClientProtocol)
+	// The settings the profile leaves alone come from the rest of the file and
+	// the defaults.
+	assert.Equal(t, int64(30), mountConfig.FileSystemConfig.KernelListCacheTtlSeconds)
+	assert.Equal(t, DefaultMaxIdleConnsPerHost, mountConfig.GCSConnectionConfig.MaxIdleConnsPerHost)
+}
+
+func TestParseConfigFileWithProfile_Precedence(t *testing.T) {
+	// kernel-list-cache-ttl-secs is 60 in the built-in profile, 30 in the
+	// config file and 90 in the profile of the same name in the config file.
+	// The built-in profile sets type-cache-max-size-mb and lookup-batch-window,
+	// which only the config file sets too.
+	mountConfig, err := ParseConfigFileWithProfile("testdata/profiles/profiles_config.yaml", ManySmallFilesProfile)
+
+	require.NoError(t, err)
+	assert.Equal(t, ManySmallFilesProfile, mountConfig.Profile)
+	assert.Equal(t, int64(90), mountConfig.FileSystemConfig.KernelListCacheTtlSeconds)
+	assert.Equal(t, -1, mountConfig.MetadataCacheConfig.TypeCacheMaxSizeMB)
+	assert.Equal(t, 20*time.Millisecond, mountConfig.MetadataCacheConfig.LookupBatchWindow)
+
+	// And the flags win over all of them.
+	OverrideWithKernelListCacheTtlFlag(&TestCliContext{isSet: true}, mountConfig, 10)
+	assert.Equal(t, int64(10), mountConfig.FileSystemConfig.KernelListCacheTtlSeconds)
+}
+
+func TestParseConfigFileWithProfile_BuiltinWithoutOverrides(t *testing.T) {
+	mountConfig, err := ParseConfigFileWithProfile("", ManySmallFilesProfile)
+	require.NoError(t, err)
+	assert.Equal(t, int64(60), mountConfig.FileSystemConfig.KernelListCacheTtlSeconds)
+
+	// Flags that aren't set leave the profile alone.
+	OverrideWithKernelListCacheTtlFlag(&TestCliContext{isSet: false}, mountConfig, 10)
+	assert.Equal(t, int64(60), mountConfig.FileSystemConfig.KernelListCacheTtlSeconds)
+}
+
+func TestParseConfigFileWithProfile_SelectedInConfigFile(t *testing.T) {
+	mountConfig, err := ParseConfigFileWithProfile("testdata/profiles/selected_profile_config.yaml", "")
+
+	require.NoError(t, err)
+	assert.Equal(t, "training", mountConfig.Profile)
+	assert.Equal(t, int64(2048), mountConfig.FileCacheConfig.MaxSizeMB)
+}
+
+func TestParseConfigFileWithProfile_FlagOverridesSelectionInConfigFile(t *testing.T) {
+	mountConfig, err := ParseConfigFileWithProfile("testdata/profiles/selected_profile_config.yaml", HighThroughputReadProfile)
+
+	require.NoError(t, err)
+	assert.Equal(t, HighThroughputReadProfile, mountConfig.Profile)
+	assert.Equal(t, DefaultFileCacheMaxSizeMB, mountConfig.FileCacheConfig.MaxSizeMB)
+	assert.True(t, mountConfig.FileCacheConfig.CacheFileForRangeRead)
+}
+
+func TestParseConfigFileWithProfile_Errors(t *testing.T) {
+	testCases := []struct {
+		name        string
+		fileName    string
+		profile     string
+		expectedErr string
+	}{
+		{
+			name:        "unknown profile",
+			fileName:    "testdata/profiles/profiles_config.yaml",
+			profile:     "genomics",
+			expectedErr: "unknown profile \"genomics\"",
+		},
+		{
+			name:        "unknown profile without config file",
+			profile:     "training",
+			expectedErr: "unknown profile \"training\"",
+		},
+		{
+			name:        "unexpected field",
+			fileName:    "testdata/profiles/unexpected_field_profile_config.yaml",
+			profile:     "training",
+			expectedErr: "field max-size not found",
+		},
+		{
+			name:        "profile selecting another",
+			fileName:    "testdata/profiles/profile_selecting_another_config.yaml",
+			profile:     "training",
+			expectedErr: "profiles: training: can't select another profile",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ParseConfigFileWithProfile(tc.fileName, tc.profile)
+
+			assert.ErrorContains(t, err, tc.expectedErr)
+		})
+	}
+}
+
+func TestBuiltinProfileNames(t *testing.T) {
+	assert.Equal(t, []string{HighThroughputReadProfile, ManySmallFilesProfile}, BuiltinProfileNames())
+}
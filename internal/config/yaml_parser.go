@@ -18,10 +18,13 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"mime"
 	"os"
+	"path"
 	"strings"
 
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/util"
+	"golang.org/x/net/http/httpguts"
 	"gopkg.in/yaml.v3"
 )
 
@@ -70,10 +73,60 @@ func IsValidLogRotateConfig(config LogRotateConfig) error {
 	return nil
 }
 
+func (writeConfig *WriteConfig) validate() error {
+	switch writeConfig.ClobberBehavior {
+	case ClobberBehaviorError, ClobberBehaviorIgnore, ClobberBehaviorRefresh:
+	default:
+		return fmt.Errorf("clobber-behavior should be one of [error, ignore, refresh], got %q", writeConfig.ClobberBehavior)
+	}
+
+	switch writeConfig.CreateExistenceCheck {
+	case CreateExistenceCheckNone, CreateExistenceCheckOpen, CreateExistenceCheckFlush:
+	default:
+		return fmt.Errorf("create-existence-check should be one of [none, open, flush], got %q", writeConfig.CreateExistenceCheck)
+	}
+
+	switch writeConfig.CreateParentPlaceholders {
+	case CreateParentPlaceholdersNever, CreateParentPlaceholdersMissingOnly, CreateParentPlaceholdersAlways:
+	default:
+		return fmt.Errorf("create-parent-placeholders should be one of [never, missing-only, always], got %q", writeConfig.CreateParentPlaceholders)
+	}
+
+	if writeConfig.DisableContentTypeInference && len(writeConfig.ContentTypeOverrides) > 0 {
+		return fmt.Errorf("content-type-overrides can't be set with disable-content-type-inference")
+	}
+	for ext, contentType := range writeConfig.ContentTypeOverrides {
+		if !strings.HasPrefix(ext, ".") || strings.Contains(ext, "/") {
+			return fmt.Errorf("content-type-overrides: extension %q should start with a dot and not contain a slash", ext)
+		}
+		if _, _, err := mime.ParseMediaType(contentType); err != nil {
+			return fmt.Errorf("content-type-overrides: invalid content type %q for %q: %w", contentType, ext, err)
+		}
+	}
+	return nil
+}
+
 func (fileCacheConfig *FileCacheConfig) validate() error {
 	if fileCacheConfig.MaxSizeMB < -1 {
 		return fmt.Errorf("the value of max-size-mb for file-cache can't be less than -1")
 	}
+	if fileCacheConfig.ScrubBytesPerSec < 0 {
+		return fmt.Errorf("the value of scrub-bytes-per-sec for file-cache can't be negative")
+	}
+	if fileCacheConfig.ScrubPauseHitsPerSec < 0 {
+		return fmt.Errorf("the value of scrub-pause-hits-per-sec for file-cache can't be negative")
+	}
+	if fileCacheConfig.MaxSupersededSizeMB < -1 {
+		return fmt.Errorf("the value of max-superseded-size-mb for file-cache can't be less than -1")
+	}
+	for _, prefix := range fileCacheConfig.PinnedPrefixes {
+		if prefix == "" {
+			return fmt.Errorf("pinned-prefixes for file-cache can't have an empty prefix, which would pin every file")
+		}
+	}
+	if fileCacheConfig.PinnedMaxSizeMB < -1 {
+		return fmt.Errorf("the value of pinned-max-size-mb for file-cache can't be less than -1")
+	}
 	return nil
 }
 
@@ -98,6 +151,20 @@ func (metadataCacheConfig *MetadataCacheConfig) validate() error {
 			return fmt.Errorf(StatCacheMaxSizeMBTooHighError)
 		}
 	}
+
+	minTtl, maxTtl := metadataCacheConfig.CacheControlMinTtlInSeconds, metadataCacheConfig.CacheControlMaxTtlInSeconds
+	if minTtl < 0 || minTtl > MaxSupportedTtlInSeconds {
+		return fmt.Errorf("cache-control-min-ttl-secs should be between 0 and %d", MaxSupportedTtlInSeconds)
+	}
+	if err := IsTtlInSecsValid(maxTtl); err != nil {
+		return fmt.Errorf("invalid cache-control-max-ttl-secs: %w", err)
+	}
+	if maxTtl != -1 && minTtl > maxTtl {
+		return fmt.Errorf("cache-control-min-ttl-secs can't be more than cache-control-max-ttl-secs")
+	}
+	if metadataCacheConfig.LookupBatchWindow < 0 {
+		return fmt.Errorf("the value of lookup-batch-window can't be negative")
+	}
 	return nil
 }
 
@@ -116,31 +183,226 @@ func (fileSystemConfig *FileSystemConfig) validate() error {
 	return nil
 }
 
+func (gcsConnectionConfig *GCSConnectionConfig) validate() error {
+	switch gcsConnectionConfig.ClientProtocol {
+	case "http1", "http2", "grpc":
+	default:
+		return fmt.Errorf("client-protocol should be one of [http1, http2, grpc], got %q", gcsConnectionConfig.ClientProtocol)
+	}
+
+	if gcsConnectionConfig.MaxConnsPerHost < 0 {
+		return fmt.Errorf("the value of max-conns-per-host can't be negative")
+	}
+	if gcsConnectionConfig.MaxIdleConnsPerHost < 0 {
+		return fmt.Errorf("the value of max-idle-conns-per-host can't be negative")
+	}
+	if gcsConnectionConfig.IdleConnTimeout < 0 ||
+		gcsConnectionConfig.TLSHandshakeTimeout < 0 ||
+		gcsConnectionConfig.ResponseHeaderTimeout < 0 {
+		return fmt.Errorf("the values of idle-conn-timeout, tls-handshake-timeout and response-header-timeout can't be negative")
+	}
+	if gcsConnectionConfig.DrainTimeout < 0 {
+		return fmt.Errorf("the value of drain-timeout can't be negative")
+	}
+
+	switch gcsConnectionConfig.ClientProtocol {
+	case "http2":
+		// The http2 transport doesn't keep idle connections around.
+		if gcsConnectionConfig.IdleConnTimeout != 0 {
+			return fmt.Errorf("idle-conn-timeout is only supported with client-protocol http1")
+		}
+	case "grpc":
+		if gcsConnectionConfig.IdleConnTimeout != 0 ||
+			gcsConnectionConfig.TLSHandshakeTimeout != 0 ||
+			gcsConnectionConfig.ResponseHeaderTimeout != 0 {
+			return fmt.Errorf("idle-conn-timeout, tls-handshake-timeout and response-header-timeout are not supported with client-protocol grpc")
+		}
+	}
+
+	if gcsConnectionConfig.OpMetadataHeader != "" &&
+		!httpguts.ValidHeaderFieldName(gcsConnectionConfig.OpMetadataHeader) {
+		return fmt.Errorf("op-metadata-header %q isn't a valid header name", gcsConnectionConfig.OpMetadataHeader)
+	}
+	return nil
+}
+
+func (listConfig *ListConfig) validate() error {
+	for _, pattern := range listConfig.SuppressedNames {
+		if pattern == "" || strings.Contains(pattern, "/") {
+			return fmt.Errorf("suppressed-names: %q should be a non-empty name without a slash", pattern)
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("suppressed-names: invalid pattern %q: %w", pattern, err)
+		}
+	}
+
+	switch listConfig.SuppressedCreate {
+	case SuppressedCreateLocal, SuppressedCreateReject:
+	default:
+		return fmt.Errorf("suppressed-create should be one of [local, reject], got %q", listConfig.SuppressedCreate)
+	}
+	return nil
+}
+
+func (advisoryConfig *AdvisoryConfig) validate() error {
+	for _, p := range advisoryConfig.DisabledAdvisories {
+		switch p {
+		case "random-reads", "small-writes", "re-downloads":
+		default:
+			return fmt.Errorf("disable should list some of [random-reads, small-writes, re-downloads], got %q", p)
+		}
+	}
+	return nil
+}
+
+// decodeStrictly decodes n into v, failing on fields v doesn't have.
+func decodeStrictly(n *yaml.Node, v any) error {
+	buf, err := yaml.Marshal(n)
+	if err != nil {
+		return err
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(buf))
+	decoder.KnownFields(true)
+	return decoder.Decode(v)
+}
+
+// extractCacheDirs takes a list of directories given as cache-dir out of the
+// config file, leaving the first of them in its place so that the rest of the
+// file decodes into a MountConfig, whose CacheDir is a single path.
+func extractCacheDirs(buf []byte) (rest []byte, cacheDirs []CacheDirSpec, err error) {
+	var doc yaml.Node
+	if yaml.Unmarshal(buf, &doc) != nil || len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		// Leave any error to the decoding of the whole file.
+		return buf, nil, nil
+	}
+
+	m := doc.Content[0]
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value != "cache-dir" || m.Content[i+1].Kind != yaml.SequenceNode {
+			continue
+		}
+
+		for _, item := range m.Content[i+1].Content {
+			var d CacheDirSpec
+			if item.Kind == yaml.ScalarNode {
+				d.Path = CacheDir(item.Value)
+			} else if err = decodeStrictly(item, &d); err != nil {
+				return nil, nil, fmt.Errorf("cache-dir: line %d: %w", item.Line, err)
+			}
+			cacheDirs = append(cacheDirs, d)
+		}
+		if err = validateCacheDirs(cacheDirs); err != nil {
+			return nil, nil, fmt.Errorf("cache-dir: %w", err)
+		}
+
+		m.Content[i+1] = &yaml.Node{Kind: yaml.ScalarNode, Value: string(cacheDirs[0].Path)}
+		rest, err = yaml.Marshal(&doc)
+		return
+	}
+
+	return buf, nil, nil
+}
+
+func validateCacheDirs(cacheDirs []CacheDirSpec) error {
+	if len(cacheDirs) == 0 {
+		return fmt.Errorf("the list of directories is empty")
+	}
+
+	seen := make(map[CacheDir]bool)
+	weighted := 0
+	for _, d := range cacheDirs {
+		if d.Path == "" {
+			return fmt.Errorf("a directory has no path")
+		}
+		if seen[d.Path] {
+			return fmt.Errorf("%s is listed more than once", d.Path)
+		}
+		seen[d.Path] = true
+
+		if d.Weight < 0 {
+			return fmt.Errorf("the weight of %s can't be negative", d.Path)
+		}
+		if d.Weight > 0 {
+			weighted++
+		}
+	}
+	if weighted != 0 && weighted != len(cacheDirs) {
+		return fmt.Errorf("either every directory should have a weight or none")
+	}
+	return nil
+}
+
 func ParseConfigFile(fileName string) (mountConfig *MountConfig, err error) {
+	return ParseConfigFileWithProfile(fileName, "")
+}
+
+// ParseConfigFileWithProfile is like ParseConfigFile, but applies the named
+// profile, or the one the config file selects if profile is empty. Settings
+// are resolved in this order, later ones winning:
+//
+//  1. the defaults,
+//  2. the built-in profile of that name, if any,
+//  3. the config file,
+//  4. the profile of that name defined under profiles in the config file.
+//
+// The flags are applied over the result by the caller.
+func ParseConfigFileWithProfile(fileName string, profile string) (mountConfig *MountConfig, err error) {
+	var buf []byte
+	if fileName != "" {
+		buf, err = os.ReadFile(fileName)
+		if err != nil {
+			err = fmt.Errorf("error reading config file: %w", err)
+			return NewMountConfig(), err
+		}
+	}
+
+	return ParseConfigWithProfile(buf, profile)
+}
+
+// ParseConfigWithProfile is like ParseConfigFileWithProfile, but parses the
+// supplied contents of a config file.
+func ParseConfigWithProfile(buf []byte, profile string) (mountConfig *MountConfig, err error) {
 	mountConfig = NewMountConfig()
 
-	if fileName == "" {
-		return
+	if buf, mountConfig.CacheDirs, err = extractCacheDirs(buf); err != nil {
+		return mountConfig, fmt.Errorf(parseConfigFileErrMsgFormat, err)
 	}
 
-	buf, err := os.ReadFile(fileName)
+	buf, userProfiles, selected, err := extractProfiles(buf)
 	if err != nil {
-		err = fmt.Errorf("error reading config file: %w", err)
-		return
+		return mountConfig, fmt.Errorf(parseConfigFileErrMsgFormat, err)
+	}
+	if profile == "" {
+		profile = selected
+	}
+
+	builtinProfile, isBuiltin := builtinProfiles[profile]
+	userProfile, isUser := userProfiles[profile]
+	if profile != "" && !isBuiltin && !isUser {
+		return mountConfig, fmt.Errorf("unknown profile %q: it should be one of %v or defined under profiles in the config file", profile, BuiltinProfileNames())
+	}
+	if isBuiltin {
+		builtinProfile(mountConfig)
 	}
 
 	// Ensure error is thrown when unexpected configs are passed in config file.
 	// Ref: https://github.com/go-yaml/yaml/issues/602#issuecomment-623485602
 	decoder := yaml.NewDecoder(bytes.NewReader(buf))
 	decoder.KnownFields(true)
-	if err = decoder.Decode(mountConfig); err != nil {
-		// Decode returns EOF in case of empty config file.
-		if err == io.EOF {
-			return mountConfig, nil
-		}
+	// Decode returns EOF in case of empty config file.
+	if err = decoder.Decode(mountConfig); err == io.EOF {
+		err = nil
+	} else if err != nil {
 		return mountConfig, fmt.Errorf(parseConfigFileErrMsgFormat, err)
 	}
 
+	mountConfig.Profile = profile
+	if isUser {
+		if err = applyUserProfile(mountConfig, profile, userProfile); err != nil {
+			return mountConfig, fmt.Errorf(parseConfigFileErrMsgFormat, err)
+		}
+	}
+
 	// convert log severity to upper-case
 	mountConfig.LogConfig.Severity = LogSeverity(strings.ToUpper(string(mountConfig.LogConfig.Severity)))
 	if !IsValidLogSeverity(mountConfig.LogConfig.Severity) {
@@ -153,6 +415,15 @@ func ParseConfigFile(fileName string) (mountConfig *MountConfig, err error) {
 		return
 	}
 
+	if mountConfig.LogConfig.UploadProgress.IntervalMB < 0 {
+		err = fmt.Errorf(parseConfigFileErrMsgFormat, "upload-progress: interval-mb can't be negative")
+		return
+	}
+
+	if err = mountConfig.WriteConfig.validate(); err != nil {
+		return mountConfig, fmt.Errorf("error parsing write configs: %w", err)
+	}
+
 	if err = mountConfig.FileCacheConfig.validate(); err != nil {
 		return mountConfig, fmt.Errorf("error parsing file-cache configs: %w", err)
 	}
@@ -169,5 +440,17 @@ func ParseConfigFile(fileName string) (mountConfig *MountConfig, err error) {
 		return mountConfig, fmt.Errorf("error parsing file-system config: %w", err)
 	}
 
+	if err = mountConfig.GCSConnectionConfig.validate(); err != nil {
+		return mountConfig, fmt.Errorf("error parsing gcs-connection config: %w", err)
+	}
+
+	if err = mountConfig.ListConfig.validate(); err != nil {
+		return mountConfig, fmt.Errorf("error parsing list config: %w", err)
+	}
+
+	if err = mountConfig.AdvisoryConfig.validate(); err != nil {
+		return mountConfig, fmt.Errorf("error parsing advisories config: %w", err)
+	}
+
 	return
 }
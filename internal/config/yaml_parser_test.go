@@ -17,6 +17,7 @@ package config
 import (
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
@@ -32,22 +33,49 @@ func TestYamlParserSuite(t *testing.T) {
 func validateDefaultConfig(t *testing.T, mountConfig *MountConfig) {
 	assert.NotNil(t, mountConfig)
 	assert.False(t, mountConfig.CreateEmptyFile)
+	assert.Equal(t, DefaultClobberBehavior, mountConfig.WriteConfig.ClobberBehavior)
+	assert.Equal(t, DefaultCreateExistenceCheck, mountConfig.WriteConfig.CreateExistenceCheck)
+	assert.Equal(t, DefaultCreateParentPlaceholders, mountConfig.WriteConfig.CreateParentPlaceholders)
+	assert.False(t, mountConfig.WriteConfig.LogMutationPlan)
+	assert.False(t, mountConfig.MetadataCacheConfig.RespectCacheControl)
+	assert.Equal(t, DefaultCacheControlMaxTtlInSeconds, mountConfig.MetadataCacheConfig.CacheControlMaxTtlInSeconds)
+	assert.Zero(t, mountConfig.MetadataCacheConfig.LookupBatchWindow)
 	assert.False(t, mountConfig.ListConfig.EnableEmptyManagedFolders)
+	assert.Equal(t, DefaultSuppressedNames, mountConfig.ListConfig.SuppressedNames)
+	assert.Equal(t, DefaultSuppressedCreate, mountConfig.ListConfig.SuppressedCreate)
 	assert.Equal(t, "INFO", string(mountConfig.LogConfig.Severity))
 	assert.Equal(t, "", mountConfig.LogConfig.Format)
 	assert.Equal(t, "", mountConfig.LogConfig.FilePath)
 	assert.Equal(t, 512, mountConfig.LogConfig.LogRotateConfig.MaxFileSizeMB)
 	assert.Equal(t, 10, mountConfig.LogConfig.LogRotateConfig.BackupFileCount)
 	assert.True(t, bool(mountConfig.LogConfig.LogRotateConfig.Compress))
+	assert.Zero(t, mountConfig.LogConfig.UploadProgress.IntervalMB)
 	assert.Equal(t, "", string(mountConfig.CacheDir))
 	assert.Equal(t, int64(-1), mountConfig.FileCacheConfig.MaxSizeMB)
 	assert.False(t, mountConfig.FileCacheConfig.CacheFileForRangeRead)
+	assert.Zero(t, mountConfig.FileCacheConfig.ScrubBytesPerSec)
+	assert.Equal(t, DefaultFileCacheScrubPauseHitsPerSec, mountConfig.FileCacheConfig.ScrubPauseHitsPerSec)
+	assert.False(t, mountConfig.FileCacheConfig.Shared)
+	assert.False(t, mountConfig.FileCacheConfig.ReadOnly)
+	assert.Equal(t, DefaultFileCacheMaxSupersededSizeMB, mountConfig.FileCacheConfig.MaxSupersededSizeMB)
+	assert.Empty(t, mountConfig.FileCacheConfig.PinnedPrefixes)
+	assert.Equal(t, DefaultFileCachePinnedMaxSizeMB, mountConfig.FileCacheConfig.PinnedMaxSizeMB)
 	assert.Equal(t, 1, mountConfig.GrpcClientConfig.ConnPoolSize)
 	assert.False(t, mountConfig.AuthConfig.AnonymousAccess)
 	assert.False(t, bool(mountConfig.EnableHNS))
 	assert.False(t, mountConfig.FileSystemConfig.IgnoreInterrupts)
 	assert.False(t, mountConfig.FileSystemConfig.DisableParallelDirops)
+	assert.Empty(t, mountConfig.AdvisoryConfig.DisabledAdvisories)
+	assert.False(t, mountConfig.MetricsConfig.DetailedErrors)
+	assert.False(t, mountConfig.FileSystemConfig.DirConfigFiles)
 	assert.Equal(t, DefaultKernelListCacheTtlSeconds, mountConfig.KernelListCacheTtlSeconds)
+	assert.Equal(t, DefaultClientProtocol, mountConfig.GCSConnectionConfig.ClientProtocol)
+	assert.Equal(t, DefaultMaxConnsPerHost, mountConfig.GCSConnectionConfig.MaxConnsPerHost)
+	assert.Equal(t, DefaultMaxIdleConnsPerHost, mountConfig.GCSConnectionConfig.MaxIdleConnsPerHost)
+	assert.Equal(t, time.Duration(0), mountConfig.GCSConnectionConfig.IdleConnTimeout)
+	assert.Equal(t, DefaultOpMetadataHeader, mountConfig.GCSConnectionConfig.OpMetadataHeader)
+	assert.False(t, mountConfig.GCSConnectionConfig.OpMetadataUid)
+	assert.Equal(t, DefaultDrainTimeout, mountConfig.GCSConnectionConfig.DrainTimeout)
 }
 
 func (t *YamlParserTest) TestReadConfigFile_EmptyFileName() {
@@ -70,6 +98,27 @@ func (t *YamlParserTest) TestReadConfigFile_NonExistingFile() {
 	assert.ErrorContains(t.T(), err, "error reading config file: open testdata/nofile.yaml: no such file or directory")
 }
 
+func (t *YamlParserTest) TestParseConfigWithProfile() {
+	mountConfig, err := ParseConfigWithProfile([]byte("write:\n  create-empty-file: true\n"), "")
+
+	assert.NoError(t.T(), err)
+	assert.True(t.T(), mountConfig.CreateEmptyFile)
+	assert.Equal(t.T(), DefaultClobberBehavior, mountConfig.WriteConfig.ClobberBehavior)
+}
+
+func (t *YamlParserTest) TestParseConfigWithProfile_Empty() {
+	mountConfig, err := ParseConfigWithProfile(nil, "")
+
+	assert.NoError(t.T(), err)
+	validateDefaultConfig(t.T(), mountConfig)
+}
+
+func (t *YamlParserTest) TestParseConfigWithProfile_UnexpectedField() {
+	_, err := ParseConfigWithProfile([]byte("no-such-section: true\n"), "")
+
+	assert.ErrorContains(t.T(), err, "error parsing config file")
+}
+
 func (t *YamlParserTest) TestReadConfigFile_InvalidConfig() {
 	_, err := ParseConfigFile("testdata/invalid_config.yaml")
 
@@ -110,6 +159,18 @@ func (t *YamlParserTest) TestReadConfigFile_ValidConfig() {
 	assert.Equal(t.T(), 100, mountConfig.LogConfig.LogRotateConfig.MaxFileSizeMB)
 	assert.Equal(t.T(), 5, mountConfig.LogConfig.LogRotateConfig.BackupFileCount)
 	assert.False(t.T(), mountConfig.LogConfig.LogRotateConfig.Compress)
+	assert.Equal(t.T(), int64(64), mountConfig.LogConfig.UploadProgress.IntervalMB)
+
+	// file-cache config
+	assert.Equal(t.T(), int64(100), mountConfig.FileCacheConfig.MaxSizeMB)
+	assert.True(t.T(), mountConfig.FileCacheConfig.CacheFileForRangeRead)
+	assert.Equal(t.T(), int64(1048576), mountConfig.FileCacheConfig.ScrubBytesPerSec)
+	assert.Equal(t.T(), int64(20), mountConfig.FileCacheConfig.ScrubPauseHitsPerSec)
+	assert.True(t.T(), mountConfig.FileCacheConfig.Shared)
+	assert.True(t.T(), mountConfig.FileCacheConfig.ReadOnly)
+	assert.Equal(t.T(), int64(256), mountConfig.FileCacheConfig.MaxSupersededSizeMB)
+	assert.Equal(t.T(), []string{"models/", "weights/v2/"}, mountConfig.FileCacheConfig.PinnedPrefixes)
+	assert.Equal(t.T(), int64(50), mountConfig.FileCacheConfig.PinnedMaxSizeMB)
 
 	// metadata-cache config
 	assert.Equal(t.T(), int64(5), mountConfig.MetadataCacheConfig.TtlInSeconds)
@@ -128,6 +189,7 @@ func (t *YamlParserTest) TestReadConfigFile_ValidConfig() {
 	// file-system config
 	assert.True(t.T(), mountConfig.FileSystemConfig.IgnoreInterrupts)
 	assert.True(t.T(), mountConfig.FileSystemConfig.DisableParallelDirops)
+	assert.True(t.T(), mountConfig.FileSystemConfig.DirConfigFiles)
 }
 
 func (t *YamlParserTest) TestReadConfigFile_InvalidLogConfig() {
@@ -148,12 +210,80 @@ func (t *YamlParserTest) TestReadConfigFile_InvalidLogRotateConfig2() {
 	assert.ErrorContains(t.T(), err, fmt.Sprintf(parseConfigFileErrMsgFormat, "backup-file-count should be 0 (to retain all backup files) or a positive value"))
 }
 
+func (t *YamlParserTest) TestReadConfigFile_InvalidUploadProgressLogConfig() {
+	_, err := ParseConfigFile("testdata/invalid_upload_progress_log_config.yaml")
+
+	assert.ErrorContains(t.T(), err, fmt.Sprintf(parseConfigFileErrMsgFormat, "upload-progress: interval-mb can't be negative"))
+}
+
 func (t *YamlParserTest) TestReadConfigFile_InvalidFileCacheMaxSizeConfig() {
 	_, err := ParseConfigFile("testdata/invalid_filecachesize_config.yaml")
 
 	assert.ErrorContains(t.T(), err, "error parsing file-cache configs: the value of max-size-mb for file-cache can't be less than -1")
 }
 
+func (t *YamlParserTest) TestReadConfigFile_CacheDirs() {
+	mountConfig, err := ParseConfigFile("testdata/cache_dirs_config.yaml")
+
+	assert.NoError(t.T(), err)
+	assert.Equal(t.T(), []CacheDirSpec{{Path: "/mnt/nvme0", Weight: 2}, {Path: "/mnt/nvme1", Weight: 1}}, mountConfig.CacheDirs)
+	assert.Equal(t.T(), CacheDir("/mnt/nvme0"), mountConfig.CacheDir)
+	assert.Equal(t.T(), int64(100), mountConfig.FileCacheConfig.MaxSizeMB)
+}
+
+func (t *YamlParserTest) TestReadConfigFile_CacheDirsWithoutWeights() {
+	mountConfig, err := ParseConfigFile("testdata/cache_dirs_config_without_weights.yaml")
+
+	assert.NoError(t.T(), err)
+	assert.Equal(t.T(), []CacheDirSpec{{Path: "/mnt/nvme0"}, {Path: "/mnt/nvme1"}}, mountConfig.CacheDirs)
+	assert.Equal(t.T(), CacheDir("/mnt/nvme0"), mountConfig.CacheDir)
+}
+
+func (t *YamlParserTest) TestReadConfigFile_CacheDirsWithPartialWeights() {
+	_, err := ParseConfigFile("testdata/cache_dirs_config_partial_weights.yaml")
+
+	assert.ErrorContains(t.T(), err, "cache-dir: either every directory should have a weight or none")
+}
+
+func (t *YamlParserTest) TestReadConfigFile_CacheDirsWithUnexpectedField() {
+	_, err := ParseConfigFile("testdata/cache_dirs_config_unexpected_field.yaml")
+
+	assert.ErrorContains(t.T(), err, "cache-dir: line 2:")
+	assert.ErrorContains(t.T(), err, "field wieght not found in type config.CacheDirSpec")
+}
+
+func (t *YamlParserTest) TestReadConfigFile_SingleCacheDir() {
+	mountConfig, err := ParseConfigFile("testdata/valid_config.yaml")
+
+	assert.NoError(t.T(), err)
+	assert.Equal(t.T(), CacheDir("/tmp/read_cache/"), mountConfig.CacheDir)
+	assert.Nil(t.T(), mountConfig.CacheDirs)
+}
+
+func (t *YamlParserTest) TestReadConfigFile_InvalidFileCacheScrubConfig() {
+	_, err := ParseConfigFile("testdata/invalid_file_cache_scrub_config.yaml")
+
+	assert.ErrorContains(t.T(), err, "error parsing file-cache configs: the value of scrub-bytes-per-sec for file-cache can't be negative")
+}
+
+func (t *YamlParserTest) TestReadConfigFile_InvalidFileCacheSupersededConfig() {
+	_, err := ParseConfigFile("testdata/invalid_file_cache_superseded_config.yaml")
+
+	assert.ErrorContains(t.T(), err, "error parsing file-cache configs: the value of max-superseded-size-mb for file-cache can't be less than -1")
+}
+
+func (t *YamlParserTest) TestReadConfigFile_InvalidFileCachePinnedConfig() {
+	_, err := ParseConfigFile("testdata/invalid_file_cache_pinned_config.yaml")
+
+	assert.ErrorContains(t.T(), err, "error parsing file-cache configs: pinned-prefixes for file-cache can't have an empty prefix")
+}
+
+func (t *YamlParserTest) TestReadConfigFile_InvalidFileCachePinnedMaxSizeConfig() {
+	_, err := ParseConfigFile("testdata/invalid_file_cache_pinned_max_size_config.yaml")
+
+	assert.ErrorContains(t.T(), err, "error parsing file-cache configs: the value of pinned-max-size-mb for file-cache can't be less than -1")
+}
+
 func (t *YamlParserTest) TestReadConfigFile_MetatadaCacheConfig_InvalidTTL() {
 	_, err := ParseConfigFile("testdata/metadata_cache_config_invalid_ttl.yaml")
 
@@ -174,6 +304,34 @@ func (t *YamlParserTest) TestReadConfigFile_MetatadaCacheConfig_TtlTooHigh() {
 	assert.ErrorContains(t.T(), err, MetadataCacheTtlSecsTooHighError)
 }
 
+func (t *YamlParserTest) TestReadConfigFile_MetatadaCacheConfig_CacheControl() {
+	mountConfig, err := ParseConfigFile("testdata/metadata_cache_config_cache_control.yaml")
+
+	assert.NoError(t.T(), err)
+	assert.True(t.T(), mountConfig.MetadataCacheConfig.RespectCacheControl)
+	assert.Equal(t.T(), int64(10), mountConfig.MetadataCacheConfig.CacheControlMinTtlInSeconds)
+	assert.Equal(t.T(), int64(86400), mountConfig.MetadataCacheConfig.CacheControlMaxTtlInSeconds)
+}
+
+func (t *YamlParserTest) TestReadConfigFile_MetatadaCacheConfig_CacheControlMinAboveMax() {
+	_, err := ParseConfigFile("testdata/metadata_cache_config_cache_control_min_above_max.yaml")
+
+	assert.ErrorContains(t.T(), err, "cache-control-min-ttl-secs can't be more than cache-control-max-ttl-secs")
+}
+
+func (t *YamlParserTest) TestReadConfigFile_MetatadaCacheConfig_LookupBatchWindow() {
+	mountConfig, err := ParseConfigFile("testdata/metadata_cache_config_lookup_batch_window.yaml")
+
+	assert.NoError(t.T(), err)
+	assert.Equal(t.T(), 2*time.Millisecond, mountConfig.MetadataCacheConfig.LookupBatchWindow)
+}
+
+func (t *YamlParserTest) TestReadConfigFile_MetatadaCacheConfig_InvalidLookupBatchWindow() {
+	_, err := ParseConfigFile("testdata/metadata_cache_config_invalid_lookup_batch_window.yaml")
+
+	assert.ErrorContains(t.T(), err, "the value of lookup-batch-window can't be negative")
+}
+
 func (t *YamlParserTest) TestReadConfigFile_MetatadaCacheConfig_InvalidTypeCacheMaxSize() {
 	_, err := ParseConfigFile("testdata/metadata_cache_config_invalid_type-cache-max-size-mb.yaml")
 
@@ -291,3 +449,196 @@ func (t *YamlParserTest) TestReadConfigFile_FileSystemConfig_ValidKernelListCach
 	assert.NotNil(t.T(), mountConfig)
 	assert.Equal(t.T(), int64(10), mountConfig.FileSystemConfig.KernelListCacheTtlSeconds)
 }
+
+func (t *YamlParserTest) TestReadConfigFile_GCSConnectionConfig_ValidHttp1() {
+	mountConfig, err := ParseConfigFile("testdata/gcs_connection_config/valid_http1.yaml")
+
+	assert.NoError(t.T(), err)
+	assert.Equal(t.T(), "http1", mountConfig.GCSConnectionConfig.ClientProtocol)
+	assert.Equal(t.T(), 200, mountConfig.GCSConnectionConfig.MaxConnsPerHost)
+	assert.Equal(t.T(), 50, mountConfig.GCSConnectionConfig.MaxIdleConnsPerHost)
+	assert.Equal(t.T(), 90*time.Second, mountConfig.GCSConnectionConfig.IdleConnTimeout)
+	assert.Equal(t.T(), 10*time.Second, mountConfig.GCSConnectionConfig.TLSHandshakeTimeout)
+	assert.Equal(t.T(), 30*time.Second, mountConfig.GCSConnectionConfig.ResponseHeaderTimeout)
+	assert.Equal(t.T(), "x-goog-custom-audit-job", mountConfig.GCSConnectionConfig.OpMetadataHeader)
+	assert.True(t.T(), mountConfig.GCSConnectionConfig.OpMetadataUid)
+	assert.Equal(t.T(), 30*time.Second, mountConfig.GCSConnectionConfig.DrainTimeout)
+}
+
+func (t *YamlParserTest) TestReadConfigFile_WriteConfig_ValidClobberBehavior() {
+	mountConfig, err := ParseConfigFile("testdata/write_config/valid_clobber_behavior.yaml")
+
+	assert.NoError(t.T(), err)
+	assert.Equal(t.T(), ClobberBehaviorRefresh, mountConfig.WriteConfig.ClobberBehavior)
+	assert.False(t.T(), mountConfig.WriteConfig.CreateEmptyFile)
+}
+
+func (t *YamlParserTest) TestReadConfigFile_WriteConfig_LogMutationPlan() {
+	mountConfig, err := ParseConfigFile("testdata/write_config/log_mutation_plan.yaml")
+
+	assert.NoError(t.T(), err)
+	assert.True(t.T(), mountConfig.WriteConfig.LogMutationPlan)
+}
+
+func (t *YamlParserTest) TestReadConfigFile_WriteConfig_InvalidClobberBehavior() {
+	_, err := ParseConfigFile("testdata/write_config/invalid_clobber_behavior.yaml")
+
+	assert.ErrorContains(t.T(), err, "clobber-behavior should be one of")
+}
+
+func (t *YamlParserTest) TestReadConfigFile_WriteConfig_ValidCreateExistenceCheck() {
+	mountConfig, err := ParseConfigFile("testdata/write_config/valid_create_existence_check.yaml")
+
+	assert.NoError(t.T(), err)
+	assert.Equal(t.T(), CreateExistenceCheckOpen, mountConfig.WriteConfig.CreateExistenceCheck)
+	assert.Equal(t.T(), DefaultClobberBehavior, mountConfig.WriteConfig.ClobberBehavior)
+}
+
+func (t *YamlParserTest) TestReadConfigFile_WriteConfig_InvalidCreateExistenceCheck() {
+	_, err := ParseConfigFile("testdata/write_config/invalid_create_existence_check.yaml")
+
+	assert.ErrorContains(t.T(), err, "create-existence-check should be one of")
+}
+
+func (t *YamlParserTest) TestReadConfigFile_WriteConfig_ValidCreateParentPlaceholders() {
+	mountConfig, err := ParseConfigFile("testdata/write_config/valid_create_parent_placeholders.yaml")
+
+	assert.NoError(t.T(), err)
+	assert.Equal(t.T(), CreateParentPlaceholdersMissingOnly, mountConfig.WriteConfig.CreateParentPlaceholders)
+	assert.Equal(t.T(), DefaultCreateExistenceCheck, mountConfig.WriteConfig.CreateExistenceCheck)
+}
+
+func (t *YamlParserTest) TestReadConfigFile_WriteConfig_InvalidCreateParentPlaceholders() {
+	_, err := ParseConfigFile("testdata/write_config/invalid_create_parent_placeholders.yaml")
+
+	assert.ErrorContains(t.T(), err, "create-parent-placeholders should be one of")
+}
+
+func (t *YamlParserTest) TestReadConfigFile_WriteConfig_ValidContentTypeOverrides() {
+	mountConfig, err := ParseConfigFile("testdata/write_config/valid_content_type_overrides.yaml")
+
+	assert.NoError(t.T(), err)
+	assert.Equal(t.T(), map[string]string{
+		".foo": "application/x-foo",
+		".md":  "text/markdown; charset=utf-8",
+	}, mountConfig.WriteConfig.ContentTypeOverrides)
+	assert.False(t.T(), mountConfig.WriteConfig.DisableContentTypeInference)
+}
+
+func (t *YamlParserTest) TestReadConfigFile_WriteConfig_InvalidContentTypeOverrideExtension() {
+	_, err := ParseConfigFile("testdata/write_config/invalid_content_type_overrides_extension.yaml")
+
+	assert.ErrorContains(t.T(), err, "should start with a dot")
+}
+
+func (t *YamlParserTest) TestReadConfigFile_WriteConfig_InvalidContentTypeOverrideType() {
+	_, err := ParseConfigFile("testdata/write_config/invalid_content_type_overrides_type.yaml")
+
+	assert.ErrorContains(t.T(), err, "invalid content type")
+}
+
+func (t *YamlParserTest) TestReadConfigFile_WriteConfig_ContentTypeOverridesWithInferenceDisabled() {
+	_, err := ParseConfigFile("testdata/write_config/content_type_overrides_with_inference_disabled.yaml")
+
+	assert.ErrorContains(t.T(), err, "can't be set with disable-content-type-inference")
+}
+
+func (t *YamlParserTest) TestReadConfigFile_GCSConnectionConfig_InvalidClientProtocol() {
+	_, err := ParseConfigFile("testdata/gcs_connection_config/invalid_client_protocol.yaml")
+
+	assert.ErrorContains(t.T(), err, "client-protocol should be one of")
+}
+
+func (t *YamlParserTest) TestReadConfigFile_GCSConnectionConfig_NegativeMaxConnsPerHost() {
+	_, err := ParseConfigFile("testdata/gcs_connection_config/negative_max_conns_per_host.yaml")
+
+	assert.ErrorContains(t.T(), err, "max-conns-per-host can't be negative")
+}
+
+func (t *YamlParserTest) TestReadConfigFile_GCSConnectionConfig_NegativeDrainTimeout() {
+	_, err := ParseConfigFile("testdata/gcs_connection_config/negative_drain_timeout.yaml")
+
+	assert.ErrorContains(t.T(), err, "drain-timeout can't be negative")
+}
+
+func (t *YamlParserTest) TestReadConfigFile_GCSConnectionConfig_Http2WithIdleConnTimeout() {
+	_, err := ParseConfigFile("testdata/gcs_connection_config/http2_with_idle_conn_timeout.yaml")
+
+	assert.ErrorContains(t.T(), err, "idle-conn-timeout is only supported with client-protocol http1")
+}
+
+func (t *YamlParserTest) TestReadConfigFile_GCSConnectionConfig_GrpcWithResponseHeaderTimeout() {
+	_, err := ParseConfigFile("testdata/gcs_connection_config/grpc_with_response_header_timeout.yaml")
+
+	assert.ErrorContains(t.T(), err, "not supported with client-protocol grpc")
+}
+
+func (t *YamlParserTest) TestReadConfigFile_GCSConnectionConfig_InvalidOpMetadataHeader() {
+	_, err := ParseConfigFile("testdata/gcs_connection_config/invalid_op_metadata_header.yaml")
+
+	assert.ErrorContains(t.T(), err, "isn't a valid header name")
+}
+
+func (t *YamlParserTest) TestReadConfigFile_AdvisoryConfig() {
+	mountConfig, err := ParseConfigFile("testdata/advisory_config/valid.yaml")
+
+	assert.NoError(t.T(), err)
+	assert.Equal(t.T(), []string{"random-reads", "re-downloads"}, mountConfig.AdvisoryConfig.DisabledAdvisories)
+}
+
+func (t *YamlParserTest) TestReadConfigFile_AdvisoryConfig_InvalidPattern() {
+	_, err := ParseConfigFile("testdata/advisory_config/invalid_pattern.yaml")
+
+	assert.ErrorContains(t.T(), err, "disable should list some of [random-reads, small-writes, re-downloads], got \"sequential-reads\"")
+}
+
+func (t *YamlParserTest) TestReadConfigFile_MetricsConfig() {
+	mountConfig, err := ParseConfigFile("testdata/metrics_config/detailed_errors.yaml")
+
+	assert.NoError(t.T(), err)
+	assert.True(t.T(), mountConfig.MetricsConfig.DetailedErrors)
+}
+
+func (t *YamlParserTest) TestReadConfigFile_ListConfig_SuppressedNames() {
+	mountConfig, err := ParseConfigFile("testdata/list_config/suppressed_names.yaml")
+
+	assert.NoError(t.T(), err)
+	// The names set replace the default ones.
+	assert.Equal(t.T(), []string{"*.tmp", "Thumbs.db"}, mountConfig.ListConfig.SuppressedNames)
+	assert.Equal(t.T(), SuppressedCreateReject, mountConfig.ListConfig.SuppressedCreate)
+	assert.True(t.T(), mountConfig.ListConfig.IsSuppressedName("a.tmp"))
+	assert.True(t.T(), mountConfig.ListConfig.IsSuppressedName("Thumbs.db"))
+	assert.False(t.T(), mountConfig.ListConfig.IsSuppressedName(".DS_Store"))
+}
+
+func (t *YamlParserTest) TestReadConfigFile_ListConfig_SuppressedNamesEmpty() {
+	mountConfig, err := ParseConfigFile("testdata/list_config/suppressed_names_empty.yaml")
+
+	assert.NoError(t.T(), err)
+	assert.Empty(t.T(), mountConfig.ListConfig.SuppressedNames)
+	assert.False(t.T(), mountConfig.ListConfig.IsSuppressedName(".DS_Store"))
+}
+
+func (t *YamlParserTest) TestReadConfigFile_ListConfig_DefaultSuppressedNames() {
+	mountConfig, err := ParseConfigFile("")
+
+	assert.NoError(t.T(), err)
+	for _, name := range []string{".DS_Store", "._foo.txt", ".Trash-1000", ".hidden", "autorun.inf"} {
+		assert.True(t.T(), mountConfig.ListConfig.IsSuppressedName(name), name)
+	}
+	for _, name := range []string{"DS_Store", "foo._bar", ".Trashcan", "hidden", "autorun.inf.txt"} {
+		assert.False(t.T(), mountConfig.ListConfig.IsSuppressedName(name), name)
+	}
+}
+
+func (t *YamlParserTest) TestReadConfigFile_ListConfig_InvalidSuppressedNames() {
+	_, err := ParseConfigFile("testdata/list_config/invalid_suppressed_names.yaml")
+
+	assert.ErrorContains(t.T(), err, "suppressed-names: invalid pattern \"[.DS_Store\"")
+}
+
+func (t *YamlParserTest) TestReadConfigFile_ListConfig_InvalidSuppressedCreate() {
+	_, err := ParseConfigFile("testdata/list_config/invalid_suppressed_create.yaml")
+
+	assert.ErrorContains(t.T(), err, "suppressed-create should be one of [local, reject], got \"upload\"")
+}
@@ -47,6 +47,17 @@ type ContentCache struct {
 	tempDir    string
 	fileMap    map[CacheObjectKey]*CacheObject
 	mtimeClock timeutil.Clock
+
+	// Whether NewStagedFile keeps a journal of staged writes, and the directory
+	// it keeps the staged files and their journal entries in.
+	journalStagedWrites bool
+	stagedWriteDir      string
+
+	// The paths of the staged files of the StagedWrites not removed yet, which
+	// SweepStagedFiles leaves alone.
+	//
+	// GUARDED_BY(mu)
+	liveStagedFiles map[string]bool
 }
 
 // Metadata store struct
@@ -148,7 +159,7 @@ func (c *ContentCache) recoverFileFromCache(metadataFile fs.FileInfo) {
 // RecoverCache should not be called concurrently
 func (c *ContentCache) RecoverCache() error {
 	if c.tempDir == "" {
-		c.tempDir = "/tmp"
+		c.tempDir = os.TempDir()
 	}
 	logger.Infof("Recovering cache:\n")
 	dirEntries, err := os.ReadDir(c.tempDir)
@@ -187,6 +198,8 @@ func New(tempDir string, mtimeClock timeutil.Clock) *ContentCache {
 		tempDir:    tempDir,
 		fileMap:    make(map[CacheObjectKey]*CacheObject),
 		mtimeClock: mtimeClock,
+
+		liveStagedFiles: make(map[string]bool),
 	}
 }
 
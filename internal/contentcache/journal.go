@@ -0,0 +1,466 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contentcache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/gcsx"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+)
+
+// StagedFilePrefix is the prefix of the names of staged files, which hold the
+// contents of files being written until they are uploaded. A staged file is
+// named StagedFilePrefix-<pid>-<random>, and its journal entry, if any, has
+// the same name with a ".json" suffix. Journaled staged files are kept in the
+// directory StagedWriteDir returns for their mount.
+const StagedFilePrefix = "gcsfusestaged"
+
+// The amount of data written to a staged file between two updates of its
+// journal entry.
+const journalWriteMilestone = 16 * 1024 * 1024
+
+var stagedFileRegexp = regexp.MustCompile(
+	fmt.Sprintf(`^%s-([0-9]+)-[0-9]+(\.json)?$`, StagedFilePrefix))
+
+// StagedWriteEntry is the journal entry of a staged file holding writes that
+// have not been uploaded yet. It is persisted as json next to the staged file
+// so that writes left behind by a crash can be found on the next mount.
+type StagedWriteEntry struct {
+	BucketName string
+	ObjectName string
+	// The generation of the object the staged file was branched from, or zero
+	// for a new object.
+	Generation     int64
+	StagedFilePath string
+	OpenTime       time.Time
+	BytesWritten   int64
+	// Whether all handles writing to the file had been closed as of the last
+	// update of the entry.
+	Closed bool
+}
+
+// StagedWrite keeps the journal entry of a staged file up to date. The entry
+// is written on the first write and then on write milestones and closes, and
+// removed along with the staged file once the writes have been uploaded or
+// thrown away.
+//
+// Not safe for concurrent access.
+type StagedWrite struct {
+	entry       StagedWriteEntry
+	journalPath string
+
+	// The cache that created the staged file, if it was created by this
+	// process.
+	cache *ContentCache
+
+	// entry.BytesWritten as of the last update of the journal entry, or -1 if
+	// the entry hasn't been written yet.
+	journaledBytes int64
+}
+
+// StagedWriteDir returns the directory of tempDir, or of the default temporary
+// directory if empty, holding the journaled staged files of the mount of the
+// given bucket on the given mount point. Each mount has its own, so that mounts
+// sharing a temporary directory don't recover or sweep each other's files.
+func StagedWriteDir(tempDir string, bucketName string, mountPoint string) string {
+	if tempDir == "" {
+		tempDir = os.TempDir()
+	}
+
+	sum := sha256.Sum256([]byte(bucketName + "\x00" + mountPoint))
+	return path.Join(tempDir, fmt.Sprintf("%s-%x", StagedFilePrefix, sum[:8]))
+}
+
+// EnableStagedWriteJournal makes NewStagedFile create named staged files with
+// journal entries, rather than anonymous files, in the StagedWriteDir of the
+// mount of the given bucket on the given mount point, which it creates if
+// needed.
+func (c *ContentCache) EnableStagedWriteJournal(bucketName string, mountPoint string) error {
+	dir := StagedWriteDir(c.tempDir, bucketName, mountPoint)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("staged writes: %w", err)
+	}
+
+	c.stagedWriteDir = dir
+	c.journalStagedWrites = true
+	return nil
+}
+
+// RemoveStagedWriteDir removes the directory of the journaled staged files if
+// nothing is left in it, e.g. at unmount.
+func (c *ContentCache) RemoveStagedWriteDir() {
+	if c.stagedWriteDir == "" {
+		return
+	}
+
+	// Fails if staged files are left, which is fine.
+	_ = os.Remove(c.stagedWriteDir)
+}
+
+// NewStagedFile returns a temporary file holding the contents of the given
+// object, for staging writes to it. If the journal is enabled, it also returns
+// the StagedWrite tracking the file, which the caller must Remove after
+// destroying the file; otherwise the StagedWrite is nil.
+func (c *ContentCache) NewStagedFile(
+	rc io.ReadCloser,
+	bucketName string,
+	objectName string,
+	generation int64) (tf gcsx.TempFile, sw *StagedWrite, err error) {
+	if !c.journalStagedWrites {
+		tf, err = c.NewTempFile(rc)
+		return
+	}
+
+	f, err := os.CreateTemp(c.stagedWriteDir, fmt.Sprintf("%s-%d-", StagedFilePrefix, os.Getpid()))
+	if err != nil {
+		err = fmt.Errorf("CreateTemp: %w", err)
+		return
+	}
+
+	tf = gcsx.NewCacheFile(rc, f, c.tempDir, c.mtimeClock)
+	sw = &StagedWrite{
+		entry: StagedWriteEntry{
+			BucketName:     bucketName,
+			ObjectName:     objectName,
+			Generation:     generation,
+			StagedFilePath: f.Name(),
+			OpenTime:       c.mtimeClock.Now(),
+		},
+		journalPath:    f.Name() + ".json",
+		journaledBytes: -1,
+		cache:          c,
+	}
+
+	c.mu.Lock()
+	c.liveStagedFiles[f.Name()] = true
+	c.mu.Unlock()
+	return
+}
+
+// writeEntry persists the journal entry, replacing the previous one
+// atomically.
+func (sw *StagedWrite) writeEntry() (err error) {
+	contents, err := json.MarshalIndent(&sw.entry, "", " ")
+	if err != nil {
+		err = fmt.Errorf("json.MarshalIndent failed for staged write entry: %w", err)
+		return
+	}
+
+	tmpPath := sw.journalPath + ".tmp"
+	if err = os.WriteFile(tmpPath, contents, 0600); err != nil {
+		err = fmt.Errorf("WriteFile for staged write entry: %w", err)
+		return
+	}
+
+	if err = os.Rename(tmpPath, sw.journalPath); err != nil {
+		err = fmt.Errorf("Rename for staged write entry: %w", err)
+		return
+	}
+
+	sw.journaledBytes = sw.entry.BytesWritten
+	return
+}
+
+// RecordWrite records that n bytes were written to the staged file, or that
+// it was otherwise modified if n is zero.
+func (sw *StagedWrite) RecordWrite(n int) (err error) {
+	wasClosed := sw.entry.Closed
+	sw.entry.BytesWritten += int64(n)
+	sw.entry.Closed = false
+
+	if sw.journaledBytes < 0 || wasClosed ||
+		sw.entry.BytesWritten-sw.journaledBytes >= journalWriteMilestone {
+		err = sw.writeEntry()
+	}
+	return
+}
+
+// RecordClose records that all the handles writing to the staged file have
+// been closed, so its contents are complete.
+func (sw *StagedWrite) RecordClose() (err error) {
+	// Nothing to record for a file that was never written to.
+	if sw.journaledBytes < 0 || sw.entry.Closed {
+		return
+	}
+
+	sw.entry.Closed = true
+	err = sw.writeEntry()
+	return
+}
+
+// Flush brings the journal entry up to date with writes made since the last
+// milestone, so that none of them are lost if the process exits before the
+// file is uploaded.
+func (sw *StagedWrite) Flush() (err error) {
+	// Nothing to record for a file that was never written to.
+	if sw.journaledBytes < 0 || sw.journaledBytes == sw.entry.BytesWritten {
+		return
+	}
+
+	err = sw.writeEntry()
+	return
+}
+
+// StagedFilePath returns the path of the staged file.
+func (sw *StagedWrite) StagedFilePath() string {
+	return sw.entry.StagedFilePath
+}
+
+// Remove deletes the journal entry and the staged file.
+func (sw *StagedWrite) Remove() {
+	for _, p := range []string{sw.journalPath, sw.entry.StagedFilePath} {
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			logger.Warnf("Failed to remove staged write file %q: %v", p, err)
+		}
+	}
+
+	// A staged file that couldn't be removed is left to the sweeper.
+	if sw.cache != nil {
+		sw.cache.mu.Lock()
+		delete(sw.cache.liveStagedFiles, sw.entry.StagedFilePath)
+		sw.cache.mu.Unlock()
+	}
+}
+
+// processAlive reports whether the process with the given id is running, other
+// than the current process.
+func processAlive(pid int) bool {
+	if pid == os.Getpid() {
+		return false
+	}
+
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// uploadStagedWrite uploads the contents of a staged file to its object,
+// unless the object has changed since the file was staged.
+func uploadStagedWrite(ctx context.Context, bucket gcs.Bucket, entry *StagedWriteEntry) (err error) {
+	f, err := os.Open(entry.StagedFilePath)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	_, err = bucket.CreateObject(ctx, &gcs.CreateObjectRequest{
+		Name:                   entry.ObjectName,
+		Contents:               f,
+		GenerationPrecondition: &entry.Generation,
+	})
+	return
+}
+
+// recoverStagedWrite handles one journal entry left by a previous process.
+func (c *ContentCache) recoverStagedWrite(
+	ctx context.Context,
+	journalPath string,
+	bucket gcs.Bucket,
+	upload bool) {
+	contents, err := os.ReadFile(journalPath)
+	if err != nil {
+		logger.Errorf("staged writes: Skip journal entry %v due to read error: %v", journalPath, err)
+		return
+	}
+
+	var entry StagedWriteEntry
+	if err = json.Unmarshal(contents, &entry); err != nil {
+		logger.Errorf("staged writes: Skip journal entry %v due to file corruption: %v", journalPath, err)
+		return
+	}
+
+	sw := &StagedWrite{entry: entry, journalPath: journalPath}
+	if _, err = os.Stat(entry.StagedFilePath); os.IsNotExist(err) {
+		logger.Warnf("staged writes: Staged file %q for object %q is gone, removing its journal entry.",
+			entry.StagedFilePath, entry.ObjectName)
+		sw.Remove()
+		return
+	}
+
+	if upload && entry.Closed && bucket != nil && bucket.Name() == entry.BucketName {
+		err = uploadStagedWrite(ctx, bucket, &entry)
+		if err == nil {
+			logger.Infof("staged writes: Uploaded %d bytes written to %q at %v by a previous gcsfuse process.",
+				entry.BytesWritten, entry.ObjectName, entry.OpenTime.Format(time.RFC3339))
+			sw.Remove()
+			return
+		}
+		logger.Errorf("staged writes: Failed to upload staged file %q to %q: %v",
+			entry.StagedFilePath, entry.ObjectName, err)
+	}
+
+	logger.Warnf("staged writes: Writes to %q in bucket %q opened at %v by a previous gcsfuse process "+
+		"were never uploaded. Their data (%d bytes written) is kept in %q. To recover it, copy that file "+
+		"to the mount, or remount with --recover-staged-writes to upload it if the file was closed; then "+
+		"delete it along with %q.",
+		entry.ObjectName, entry.BucketName, entry.OpenTime.Format(time.RFC3339), entry.BytesWritten,
+		entry.StagedFilePath, journalPath)
+}
+
+// RecoverStagedWrites looks for staged writes left behind by gcsfuse processes
+// that are no longer running, e.g. because they crashed, in the directory of
+// the journal. Writes to the given
+// bucket whose files were closed are uploaded if upload is true, provided the
+// object hasn't changed since; for all the others a warning explaining how to
+// recover them is logged. Staged files that were never written to are
+// removed.
+//
+// RecoverStagedWrites must be called before staging any file and should not
+// be called concurrently.
+func (c *ContentCache) RecoverStagedWrites(
+	ctx context.Context,
+	bucket gcs.Bucket,
+	upload bool) error {
+	// The staged writes were written to the file system, so mustn't be lost
+	// to --max-metadata-ops-per-sec.
+	ctx = gcs.WithLimitExemption(ctx)
+
+	dir := c.stagedWriteDir
+	dirEntries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("recover staged writes: %w", err)
+	}
+
+	// Journal entries first, then staged files that have none.
+	journaled := make(map[string]bool)
+	for _, dirEntry := range dirEntries {
+		m := stagedFileRegexp.FindStringSubmatch(dirEntry.Name())
+		if m == nil || m[2] == "" {
+			continue
+		}
+
+		journalPath := path.Join(dir, dirEntry.Name())
+		journaled[journalPath[:len(journalPath)-len(m[2])]] = true
+		if pid, err := strconv.Atoi(m[1]); err == nil && processAlive(pid) {
+			continue
+		}
+
+		c.recoverStagedWrite(ctx, journalPath, bucket, upload)
+	}
+
+	for _, dirEntry := range dirEntries {
+		m := stagedFileRegexp.FindStringSubmatch(dirEntry.Name())
+		if m == nil || m[2] != "" {
+			continue
+		}
+
+		stagedPath := path.Join(dir, dirEntry.Name())
+		if journaled[stagedPath] {
+			continue
+		}
+		if pid, err := strconv.Atoi(m[1]); err == nil && processAlive(pid) {
+			continue
+		}
+
+		if err := os.Remove(stagedPath); err != nil && !os.IsNotExist(err) {
+			logger.Warnf("staged writes: Failed to remove unused staged file %q: %v", stagedPath, err)
+		}
+	}
+
+	return nil
+}
+
+// SweepStagedFiles removes the staged files in the directory of the journal
+// last modified more than minAge ago that no StagedWrite of this cache refers
+// to any longer, such as those whose removal failed or those of gcsfuse
+// processes that exited since the mount. Staged files with a journal entry are
+// kept for recovery, as are those of other running processes. It returns the
+// number of files removed.
+func (c *ContentCache) SweepStagedFiles(minAge time.Duration) (removed int, err error) {
+	dir := c.stagedWriteDir
+	dirEntries, err := os.ReadDir(dir)
+	if err != nil {
+		err = fmt.Errorf("sweep staged files: %w", err)
+		return
+	}
+
+	journaled := make(map[string]bool)
+	for _, dirEntry := range dirEntries {
+		if m := stagedFileRegexp.FindStringSubmatch(dirEntry.Name()); m != nil && m[2] != "" {
+			journaled[strings.TrimSuffix(dirEntry.Name(), m[2])] = true
+		}
+	}
+
+	for _, dirEntry := range dirEntries {
+		m := stagedFileRegexp.FindStringSubmatch(dirEntry.Name())
+		if m == nil || m[2] != "" || journaled[dirEntry.Name()] {
+			continue
+		}
+		if pid, err := strconv.Atoi(m[1]); err == nil && processAlive(pid) {
+			continue
+		}
+
+		stagedPath := path.Join(dir, dirEntry.Name())
+		c.mu.Lock()
+		live := c.liveStagedFiles[stagedPath]
+		c.mu.Unlock()
+		if live {
+			continue
+		}
+
+		info, err := dirEntry.Info()
+		if err != nil || time.Since(info.ModTime()) < minAge {
+			continue
+		}
+
+		if err := os.Remove(stagedPath); err != nil && !os.IsNotExist(err) {
+			logger.Warnf("staged writes: Failed to remove orphaned staged file %q: %v", stagedPath, err)
+			continue
+		}
+		removed++
+	}
+
+	return
+}
+
+// SweepStagedFilesPeriodically calls SweepStagedFiles every period until the
+// context is cancelled.
+func (c *ContentCache) SweepStagedFilesPeriodically(
+	ctx context.Context,
+	period time.Duration,
+	minAge time.Duration) {
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-ticker.C:
+		}
+
+		removed, err := c.SweepStagedFiles(minAge)
+		if err != nil {
+			logger.Warnf("staged writes: %v", err)
+		}
+		if removed > 0 {
+			logger.Infof("staged writes: Removed %d orphaned staged files.", removed)
+		}
+	}
+}
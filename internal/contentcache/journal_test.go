@@ -0,0 +1,306 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contentcache_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/contentcache"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	. "github.com/jacobsa/ogletest"
+	"github.com/jacobsa/timeutil"
+)
+
+const testBucketName = "some_bucket"
+
+func newJournalingCache(dir string) *contentcache.ContentCache {
+	contentCache := contentcache.New(dir, timeutil.RealClock())
+	AssertEq(nil, contentCache.EnableStagedWriteJournal(testBucketName, "/mnt"))
+	return contentCache
+}
+
+// Stage a write of contents to the named object, branched from the given
+// generation, and simulate a crash by never cleaning up. Returns the path of
+// the staged file.
+func stageWrite(dir string, objectName string, generation int64, contents string, close bool) (stagedPath string) {
+	tf, sw, err := newJournalingCache(dir).NewStagedFile(
+		io.NopCloser(strings.NewReader("")), testBucketName, objectName, generation)
+	AssertEq(nil, err)
+	AssertNe(nil, sw)
+	stagedPath = tf.Name()
+	// The crashed process closes the file, but doesn't remove it.
+	defer tf.Destroy()
+
+	_, err = tf.WriteAt([]byte(contents), 0)
+	AssertEq(nil, err)
+	AssertEq(nil, sw.RecordWrite(len(contents)))
+	if close {
+		AssertEq(nil, sw.RecordClose())
+	}
+
+	return
+}
+
+func readEntry(journalPath string) (entry contentcache.StagedWriteEntry) {
+	contents, err := os.ReadFile(journalPath)
+	AssertEq(nil, err)
+	AssertEq(nil, json.Unmarshal(contents, &entry))
+	return
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func TestStagedWriteJournal(t *testing.T) {
+	dir := t.TempDir()
+	tf, sw, err := newJournalingCache(dir).NewStagedFile(
+		io.NopCloser(strings.NewReader("")), testBucketName, "foo", 0)
+	AssertEq(nil, err)
+	defer tf.Destroy()
+	journalPath := tf.Name() + ".json"
+
+	// Nothing is journaled until the file is written to.
+	ExpectEq(contentcache.StagedWriteDir(dir, testBucketName, "/mnt"), path.Dir(tf.Name()))
+	ExpectFalse(fileExists(journalPath))
+
+	_, err = tf.WriteAt([]byte("taco"), 0)
+	AssertEq(nil, err)
+	AssertEq(nil, sw.RecordWrite(4))
+	entry := readEntry(journalPath)
+	ExpectEq(testBucketName, entry.BucketName)
+	ExpectEq("foo", entry.ObjectName)
+	ExpectEq(tf.Name(), entry.StagedFilePath)
+	ExpectEq(4, entry.BytesWritten)
+	ExpectFalse(entry.Closed)
+
+	AssertEq(nil, sw.RecordClose())
+	ExpectTrue(readEntry(journalPath).Closed)
+
+	// Writing again reopens the entry.
+	AssertEq(nil, sw.RecordWrite(2))
+	entry = readEntry(journalPath)
+	ExpectEq(6, entry.BytesWritten)
+	ExpectFalse(entry.Closed)
+
+	sw.Remove()
+	ExpectFalse(fileExists(journalPath))
+	ExpectFalse(fileExists(tf.Name()))
+}
+
+func TestStagedWriteFlush(t *testing.T) {
+	dir := t.TempDir()
+	tf, sw, err := newJournalingCache(dir).NewStagedFile(
+		io.NopCloser(strings.NewReader("")), testBucketName, "foo", 0)
+	AssertEq(nil, err)
+	defer tf.Destroy()
+	journalPath := tf.Name() + ".json"
+
+	// Nothing is journaled for a file that was never written to.
+	AssertEq(nil, sw.Flush())
+	ExpectFalse(fileExists(journalPath))
+
+	// Writes short of a milestone are journaled on flush.
+	AssertEq(nil, sw.RecordWrite(4))
+	AssertEq(nil, sw.RecordWrite(2))
+	ExpectEq(4, readEntry(journalPath).BytesWritten)
+
+	AssertEq(nil, sw.Flush())
+	entry := readEntry(journalPath)
+	ExpectEq(6, entry.BytesWritten)
+	ExpectFalse(entry.Closed)
+}
+
+func TestNewStagedFileWithoutJournal(t *testing.T) {
+	dir := t.TempDir()
+	tf, sw, err := contentcache.New(dir, timeutil.RealClock()).NewStagedFile(
+		io.NopCloser(strings.NewReader("")), testBucketName, "foo", 0)
+	AssertEq(nil, err)
+	defer tf.Destroy()
+
+	ExpectEq(nil, sw)
+	entries, err := os.ReadDir(dir)
+	AssertEq(nil, err)
+	ExpectEq(0, len(entries))
+}
+
+func TestRecoverStagedWritesUploadsClosedFiles(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	bucket := fake.NewFakeBucket(timeutil.RealClock(), testBucketName)
+	stageWrite(dir, "foo", 0, "taco", true)
+
+	err := newJournalingCache(dir).RecoverStagedWrites(ctx, bucket, true)
+
+	AssertEq(nil, err)
+	contents, err := storageutil.ReadObject(ctx, bucket, "foo")
+	AssertEq(nil, err)
+	ExpectEq("taco", string(contents))
+	entries, err := os.ReadDir(contentcache.StagedWriteDir(dir, testBucketName, "/mnt"))
+	AssertEq(nil, err)
+	ExpectEq(0, len(entries))
+}
+
+func TestRecoverStagedWritesIgnoresOtherMounts(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	bucket := fake.NewFakeBucket(timeutil.RealClock(), testBucketName)
+	stagedPath := stageWrite(dir, "foo", 0, "taco", true)
+	other := contentcache.New(dir, timeutil.RealClock())
+	AssertEq(nil, other.EnableStagedWriteJournal(testBucketName, "/other"))
+
+	err := other.RecoverStagedWrites(ctx, bucket, true)
+
+	AssertEq(nil, err)
+	_, err = storageutil.ReadObject(ctx, bucket, "foo")
+	ExpectNe(nil, err)
+	ExpectTrue(fileExists(stagedPath))
+	ExpectNe(path.Dir(stagedPath), contentcache.StagedWriteDir(dir, testBucketName, "/other"))
+}
+
+func TestRemoveStagedWriteDir(t *testing.T) {
+	dir := t.TempDir()
+	stagedPath := stageWrite(dir, "foo", 0, "taco", true)
+	contentCache := newJournalingCache(dir)
+
+	// Staged files are kept for recovery, and their directory with them.
+	contentCache.RemoveStagedWriteDir()
+	ExpectTrue(fileExists(stagedPath))
+
+	AssertEq(nil, os.Remove(stagedPath))
+	AssertEq(nil, os.Remove(stagedPath+".json"))
+	contentCache.RemoveStagedWriteDir()
+	ExpectFalse(fileExists(path.Dir(stagedPath)))
+}
+
+func TestRecoverStagedWritesKeepsUnclosedFiles(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	bucket := fake.NewFakeBucket(timeutil.RealClock(), testBucketName)
+	stagedPath := stageWrite(dir, "foo", 0, "taco", false)
+
+	err := newJournalingCache(dir).RecoverStagedWrites(ctx, bucket, true)
+
+	AssertEq(nil, err)
+	_, err = storageutil.ReadObject(ctx, bucket, "foo")
+	var notFoundErr *gcs.NotFoundError
+	ExpectTrue(errors.As(err, &notFoundErr))
+	ExpectTrue(fileExists(stagedPath))
+	ExpectTrue(fileExists(stagedPath + ".json"))
+}
+
+func TestRecoverStagedWritesWithoutUploadKeepsFiles(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	bucket := fake.NewFakeBucket(timeutil.RealClock(), testBucketName)
+	stagedPath := stageWrite(dir, "foo", 0, "taco", true)
+
+	err := newJournalingCache(dir).RecoverStagedWrites(ctx, bucket, false)
+
+	AssertEq(nil, err)
+	_, err = storageutil.ReadObject(ctx, bucket, "foo")
+	ExpectNe(nil, err)
+	ExpectTrue(fileExists(stagedPath))
+	ExpectTrue(fileExists(stagedPath + ".json"))
+}
+
+func TestRecoverStagedWritesDoesNotClobberNewerObject(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	bucket := fake.NewFakeBucket(timeutil.RealClock(), testBucketName)
+	o, err := storageutil.CreateObject(ctx, bucket, "foo", []byte("burrito"))
+	AssertEq(nil, err)
+	stagedPath := stageWrite(dir, "foo", o.Generation, "taco", true)
+	// Someone else updates the object after the crash.
+	_, err = storageutil.CreateObject(ctx, bucket, "foo", []byte("enchilada"))
+	AssertEq(nil, err)
+
+	err = newJournalingCache(dir).RecoverStagedWrites(ctx, bucket, true)
+
+	AssertEq(nil, err)
+	contents, err := storageutil.ReadObject(ctx, bucket, "foo")
+	AssertEq(nil, err)
+	ExpectEq("enchilada", string(contents))
+	ExpectTrue(fileExists(stagedPath))
+}
+
+func TestRecoverStagedWritesRemovesUnwrittenFiles(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	tf, _, err := newJournalingCache(dir).NewStagedFile(
+		io.NopCloser(strings.NewReader("taco")), testBucketName, "foo", 1)
+	AssertEq(nil, err)
+	stagedPath := tf.Name()
+	tf.Destroy()
+
+	err = newJournalingCache(dir).RecoverStagedWrites(ctx, nil, true)
+
+	AssertEq(nil, err)
+	ExpectFalse(fileExists(stagedPath))
+}
+
+// Stage a file with the given cache and age it, returning its path.
+func stageOldFile(contentCache *contentcache.ContentCache) (stagedPath string) {
+	tf, _, err := contentCache.NewStagedFile(
+		io.NopCloser(strings.NewReader("")), testBucketName, "foo", 0)
+	AssertEq(nil, err)
+	stagedPath = tf.Name()
+	tf.Destroy()
+
+	old := time.Now().Add(-2 * time.Hour)
+	AssertEq(nil, os.Chtimes(stagedPath, old, old))
+	return
+}
+
+func TestSweepStagedFilesRemovesOrphanedFiles(t *testing.T) {
+	dir := t.TempDir()
+	contentCache := newJournalingCache(dir)
+
+	// A staged file of a StagedWrite that is still in use.
+	live := stageOldFile(contentCache)
+	// A staged file that no StagedWrite of the cache refers to.
+	orphaned := stageOldFile(newJournalingCache(dir))
+	// A staged file that is too recent.
+	tf, _, err := newJournalingCache(dir).NewStagedFile(
+		io.NopCloser(strings.NewReader("")), testBucketName, "bar", 0)
+	AssertEq(nil, err)
+	recent := tf.Name()
+	tf.Destroy()
+	// Journaled writes, kept for recovery.
+	journaled := stageWrite(dir, "baz", 0, "taco", true)
+	old := time.Now().Add(-2 * time.Hour)
+	AssertEq(nil, os.Chtimes(journaled, old, old))
+
+	removed, err := contentCache.SweepStagedFiles(time.Hour)
+
+	AssertEq(nil, err)
+	ExpectEq(1, removed)
+	ExpectTrue(fileExists(live))
+	ExpectFalse(fileExists(orphaned))
+	ExpectTrue(fileExists(recent))
+	ExpectTrue(fileExists(journaled))
+	ExpectTrue(fileExists(journaled + ".json"))
+}
@@ -0,0 +1,417 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package doctor implements the environment checks run by "gcsfuse doctor".
+// Each check inspects one aspect of the host (fuse device, fusermount,
+// fuse.conf, network, credentials, bucket access) through a Prober so that it
+// can be unit tested without touching the real environment.
+package doctor
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+)
+
+const (
+	FuseDevicePath = "/dev/fuse"
+	FuseConfPath   = "/etc/fuse.conf"
+	DefaultHost    = "storage.googleapis.com"
+	DefaultPort    = "443"
+
+	// Tokens are rejected by the auth server once the local clock drifts by
+	// more than a few minutes; warn well before that point.
+	MaxClockSkew  = 5 * time.Minute
+	WarnClockSkew = 30 * time.Second
+)
+
+// fusermountBinaries is the list of fusermount helpers in order of preference.
+var fusermountBinaries = []string{"fusermount3", "fusermount"}
+
+// macFuseMountHelpers is the list of programs the fuse library mounts with on
+// macOS, for macFUSE, its predecessor osxfuse and fuse-t, in the library's
+// order of preference.
+var macFuseMountHelpers = []string{
+	"/Library/Filesystems/macfuse.fs/Contents/Resources/mount_macfuse",
+	"/Library/Filesystems/osxfuse.fs/Contents/Resources/mount_osxfuse",
+	"/usr/local/bin/go-nfsv4",
+}
+
+type Status string
+
+const (
+	StatusPass Status = "pass"
+	StatusWarn Status = "warn"
+	StatusFail Status = "fail"
+	StatusSkip Status = "skip"
+)
+
+// Result is the outcome of a single check.
+type Result struct {
+	Name        string `json:"name"`
+	Status      Status `json:"status"`
+	Message     string `json:"message"`
+	Remediation string `json:"remediation,omitempty"`
+}
+
+// Prober abstracts every interaction with the environment that the checks
+// need.
+type Prober interface {
+	// Getuid returns the effective user id of the current process.
+	Getuid() int
+
+	// OpenFile opens and immediately closes the named file with the given flag.
+	OpenFile(name string, flag int) error
+
+	LookPath(file string) (string, error)
+	Stat(name string) (fs.FileInfo, error)
+	ReadFile(name string) ([]byte, error)
+
+	LookupHost(ctx context.Context, host string) ([]string, error)
+
+	// DialTCP opens and immediately closes a TCP connection to addr.
+	DialTCP(ctx context.Context, addr string) error
+
+	// ServerTime returns the time reported by the Date header of host.
+	ServerTime(ctx context.Context, host string) (time.Time, error)
+
+	// FetchToken resolves credentials and fetches an access token.
+	FetchToken(ctx context.Context) error
+
+	// StatBucket verifies that the bucket exists and can be listed.
+	StatBucket(ctx context.Context, bucket string) error
+
+	Now() time.Time
+}
+
+// Options controls which checks are run and how.
+type Options struct {
+	// Bucket, if non-empty, is probed at the end of the run.
+	Bucket string
+
+	// Host and Port locate the storage endpoint used by the network checks.
+	Host string
+	Port string
+
+	// AllowOther is true if the mount is going to use -o allow_other.
+	AllowOther bool
+
+	// AnonymousAccess skips the credential check.
+	AnonymousAccess bool
+}
+
+// Run runs all the checks in order and returns their results.
+func Run(ctx context.Context, p Prober, opts Options) []Result {
+	host := opts.Host
+	if host == "" {
+		host = DefaultHost
+	}
+	port := opts.Port
+	if port == "" {
+		port = DefaultPort
+	}
+
+	return append(fuseChecks(p, opts),
+		CheckDNS(ctx, p, host),
+		CheckConnectivity(ctx, p, net.JoinHostPort(host, port)),
+		CheckClockSkew(ctx, p, host),
+		CheckCredentials(ctx, p, opts.AnonymousAccess),
+		CheckBucket(ctx, p, opts.Bucket),
+	)
+}
+
+// Failed reports whether any of the results failed.
+func Failed(results []Result) bool {
+	for _, r := range results {
+		if r.Status == StatusFail {
+			return true
+		}
+	}
+	return false
+}
+
+////////////////////////////////////////////////////////////////////////
+// Checks
+////////////////////////////////////////////////////////////////////////
+
+func CheckFuseDevice(p Prober) Result {
+	r := Result{Name: "fuse-device"}
+	if err := p.OpenFile(FuseDevicePath, os.O_RDWR); err != nil {
+		r.Status = StatusFail
+		r.Message = fmt.Sprintf("cannot open %s: %v", FuseDevicePath, err)
+		if errors.Is(err, fs.ErrNotExist) {
+			r.Remediation = "Load the fuse kernel module with 'modprobe fuse'. In a container, " +
+				"pass the device through (e.g. 'docker run --device /dev/fuse') or run privileged."
+		} else {
+			r.Remediation = fmt.Sprintf("Make %s readable and writable by the mounting user "+
+				"(typically mode 0666).", FuseDevicePath)
+		}
+		return r
+	}
+
+	r.Status = StatusPass
+	r.Message = fmt.Sprintf("%s is accessible", FuseDevicePath)
+	return r
+}
+
+func CheckFusermount(p Prober) Result {
+	r := Result{Name: "fusermount"}
+
+	var path string
+	for _, bin := range fusermountBinaries {
+		var err error
+		if path, err = p.LookPath(bin); err == nil {
+			break
+		}
+	}
+
+	if path == "" {
+		r.Status = StatusFail
+		r.Message = fmt.Sprintf("none of %v found in PATH", fusermountBinaries)
+		r.Remediation = "Install the fuse3 (or fuse) package and make sure its binaries are in PATH."
+		return r
+	}
+
+	fi, err := p.Stat(path)
+	if err != nil {
+		r.Status = StatusFail
+		r.Message = fmt.Sprintf("stat %s: %v", path, err)
+		r.Remediation = "Reinstall the fuse3 (or fuse) package."
+		return r
+	}
+
+	// Root doesn't need the setuid bit to mount.
+	if p.Getuid() != 0 && fi.Mode()&fs.ModeSetuid == 0 {
+		r.Status = StatusFail
+		r.Message = fmt.Sprintf("%s is not setuid (mode %v)", path, fi.Mode())
+		r.Remediation = fmt.Sprintf("Run 'chown root %s && chmod u+s %s', or mount as root.", path, path)
+		return r
+	}
+
+	r.Status = StatusPass
+	r.Message = fmt.Sprintf("found %s", path)
+	return r
+}
+
+// hasUserAllowOther reports whether the fuse.conf contents enable
+// user_allow_other.
+func hasUserAllowOther(contents []byte) bool {
+	s := bufio.NewScanner(bytes.NewReader(contents))
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = strings.TrimSpace(line[:i])
+		}
+		if line == "user_allow_other" {
+			return true
+		}
+	}
+	return false
+}
+
+func CheckFuseConf(p Prober, allowOther bool) Result {
+	r := Result{Name: "fuse-conf"}
+
+	if p.Getuid() == 0 {
+		r.Status = StatusPass
+		r.Message = "running as root; user_allow_other is not required"
+		return r
+	}
+
+	contents, err := p.ReadFile(FuseConfPath)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		r.Status = StatusWarn
+		r.Message = fmt.Sprintf("cannot read %s: %v", FuseConfPath, err)
+		return r
+	}
+
+	if hasUserAllowOther(contents) {
+		r.Status = StatusPass
+		r.Message = fmt.Sprintf("user_allow_other is enabled in %s", FuseConfPath)
+		return r
+	}
+
+	r.Message = fmt.Sprintf("user_allow_other is not enabled in %s", FuseConfPath)
+	r.Remediation = fmt.Sprintf("Add a line 'user_allow_other' to %s to use -o allow_other as a non-root user.", FuseConfPath)
+	if allowOther {
+		r.Status = StatusFail
+	} else {
+		r.Status = StatusWarn
+	}
+	return r
+}
+
+func CheckMacFuse(p Prober) Result {
+	r := Result{Name: "macfuse"}
+	for _, path := range macFuseMountHelpers {
+		if _, err := p.Stat(path); err == nil {
+			r.Status = StatusPass
+			r.Message = fmt.Sprintf("found %s", path)
+			return r
+		}
+	}
+
+	r.Status = StatusFail
+	r.Message = fmt.Sprintf("none of %v found", macFuseMountHelpers)
+	r.Remediation = "Install macFUSE or fuse-t. On Apple Silicon, also allow the macFUSE system extension " +
+		"in System Settings."
+	return r
+}
+
+func CheckDNS(ctx context.Context, p Prober, host string) Result {
+	r := Result{Name: "dns"}
+	addrs, err := p.LookupHost(ctx, host)
+	if err != nil || len(addrs) == 0 {
+		r.Status = StatusFail
+		r.Message = fmt.Sprintf("cannot resolve %s: %v", host, err)
+		r.Remediation = "Check /etc/resolv.conf and that the node's network is up."
+		return r
+	}
+
+	r.Status = StatusPass
+	r.Message = fmt.Sprintf("%s resolves to %s", host, strings.Join(addrs, ", "))
+	return r
+}
+
+func CheckConnectivity(ctx context.Context, p Prober, addr string) Result {
+	r := Result{Name: "connectivity"}
+	if err := p.DialTCP(ctx, addr); err != nil {
+		r.Status = StatusFail
+		r.Message = fmt.Sprintf("cannot connect to %s: %v", addr, err)
+		r.Remediation = "Check firewall rules and proxy settings (https_proxy, no_proxy)."
+		return r
+	}
+
+	r.Status = StatusPass
+	r.Message = fmt.Sprintf("connected to %s", addr)
+	return r
+}
+
+func CheckClockSkew(ctx context.Context, p Prober, host string) Result {
+	r := Result{Name: "clock-skew"}
+	serverTime, err := p.ServerTime(ctx, host)
+	if err != nil {
+		r.Status = StatusSkip
+		r.Message = fmt.Sprintf("cannot fetch server time from %s: %v", host, err)
+		return r
+	}
+
+	skew := p.Now().Sub(serverTime)
+	if skew < 0 {
+		skew = -skew
+	}
+
+	// The Date header only has second granularity.
+	skew = skew.Truncate(time.Second)
+	switch {
+	case skew > MaxClockSkew:
+		r.Status = StatusFail
+	case skew > WarnClockSkew:
+		r.Status = StatusWarn
+	default:
+		r.Status = StatusPass
+	}
+	r.Message = fmt.Sprintf("local clock differs from %s by %v", host, skew)
+	if r.Status != StatusPass {
+		r.Remediation = "Synchronize the system clock (e.g. enable chronyd or systemd-timesyncd); " +
+			"a skewed clock makes token fetches fail."
+	}
+	return r
+}
+
+func CheckCredentials(ctx context.Context, p Prober, anonymousAccess bool) Result {
+	r := Result{Name: "credentials"}
+	if anonymousAccess {
+		r.Status = StatusSkip
+		r.Message = "anonymous access is enabled"
+		return r
+	}
+
+	if err := p.FetchToken(ctx); err != nil {
+		r.Status = StatusFail
+		r.Message = fmt.Sprintf("cannot fetch an access token: %v", err)
+		r.Remediation = "Pass --key-file, set GOOGLE_APPLICATION_CREDENTIALS, or run " +
+			"'gcloud auth application-default login'."
+
+		// The credentials may well be fine, and the clock at fault.
+		var skewErr *storageutil.ClockSkewError
+		if errors.As(err, &skewErr) {
+			r.Remediation = "Synchronize the system clock (e.g. enable chronyd or systemd-timesyncd); " +
+				"the auth server rejects tokens from a skewed clock."
+		}
+		return r
+	}
+
+	r.Status = StatusPass
+	r.Message = "fetched an access token"
+	return r
+}
+
+func CheckBucket(ctx context.Context, p Prober, bucket string) Result {
+	r := Result{Name: "bucket"}
+	if bucket == "" {
+		r.Status = StatusSkip
+		r.Message = "no bucket given; pass --bucket to check access"
+		return r
+	}
+
+	if err := p.StatBucket(ctx, bucket); err != nil {
+		r.Status = StatusFail
+		r.Message = fmt.Sprintf("cannot list bucket %q: %v", bucket, err)
+		r.Remediation = "Check the bucket name and that the credentials have the " +
+			"storage.objects.list permission on it."
+		return r
+	}
+
+	r.Status = StatusPass
+	r.Message = fmt.Sprintf("bucket %q is accessible", bucket)
+	return r
+}
+
+////////////////////////////////////////////////////////////////////////
+// Output
+////////////////////////////////////////////////////////////////////////
+
+// WriteText writes one line per result, followed by its remediation if any.
+func WriteText(w io.Writer, results []Result) error {
+	for _, r := range results {
+		if _, err := fmt.Fprintf(w, "[%s] %s: %s\n", strings.ToUpper(string(r.Status)), r.Name, r.Message); err != nil {
+			return err
+		}
+		if r.Remediation != "" {
+			if _, err := fmt.Fprintf(w, "       fix: %s\n", r.Remediation); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// WriteJSON writes the results as a JSON array.
+func WriteJSON(w io.Writer, results []Result) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(results)
+}
@@ -0,0 +1,418 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package doctor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"testing"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+////////////////////////////////////////////////////////////////////////
+// Fake prober
+////////////////////////////////////////////////////////////////////////
+
+type fakeFileInfo struct {
+	fs.FileInfo
+	mode fs.FileMode
+}
+
+func (fi fakeFileInfo) Mode() fs.FileMode { return fi.mode }
+
+type fakeProber struct {
+	uid        int
+	openErr    error
+	paths      map[string]string
+	modes      map[string]fs.FileMode
+	files      map[string][]byte
+	addrs      []string
+	lookupErr  error
+	dialErr    error
+	serverTime time.Time
+	timeErr    error
+	tokenErr   error
+	bucketErr  error
+	now        time.Time
+}
+
+func newFakeProber() *fakeProber {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	return &fakeProber{
+		uid:        1000,
+		paths:      map[string]string{"fusermount3": "/usr/bin/fusermount3"},
+		modes:      map[string]fs.FileMode{"/usr/bin/fusermount3": 0755 | fs.ModeSetuid, macFuseMountHelpers[0]: 0755},
+		files:      map[string][]byte{FuseConfPath: []byte("user_allow_other\n")},
+		addrs:      []string{"142.250.1.1"},
+		serverTime: now,
+		now:        now,
+	}
+}
+
+func (p *fakeProber) Getuid() int { return p.uid }
+
+func (p *fakeProber) OpenFile(name string, flag int) error { return p.openErr }
+
+func (p *fakeProber) LookPath(file string) (string, error) {
+	if path, ok := p.paths[file]; ok {
+		return path, nil
+	}
+	return "", errors.New("executable file not found in $PATH")
+}
+
+func (p *fakeProber) Stat(name string) (fs.FileInfo, error) {
+	if mode, ok := p.modes[name]; ok {
+		return fakeFileInfo{mode: mode}, nil
+	}
+	return nil, fs.ErrNotExist
+}
+
+func (p *fakeProber) ReadFile(name string) ([]byte, error) {
+	if contents, ok := p.files[name]; ok {
+		return contents, nil
+	}
+	return nil, fs.ErrNotExist
+}
+
+func (p *fakeProber) LookupHost(ctx context.Context, host string) ([]string, error) {
+	return p.addrs, p.lookupErr
+}
+
+func (p *fakeProber) DialTCP(ctx context.Context, addr string) error { return p.dialErr }
+
+func (p *fakeProber) ServerTime(ctx context.Context, host string) (time.Time, error) {
+	return p.serverTime, p.timeErr
+}
+
+func (p *fakeProber) FetchToken(ctx context.Context) error { return p.tokenErr }
+
+func (p *fakeProber) StatBucket(ctx context.Context, bucket string) error { return p.bucketErr }
+
+func (p *fakeProber) Now() time.Time { return p.now }
+
+////////////////////////////////////////////////////////////////////////
+// Tests
+////////////////////////////////////////////////////////////////////////
+
+type DoctorTest struct {
+	suite.Suite
+	ctx context.Context
+	p   *fakeProber
+}
+
+func TestDoctorSuite(t *testing.T) {
+	suite.Run(t, new(DoctorTest))
+}
+
+func (t *DoctorTest) SetupTest() {
+	t.ctx = context.Background()
+	t.p = newFakeProber()
+}
+
+func (t *DoctorTest) TestCheckFuseDevice_Accessible() {
+	r := CheckFuseDevice(t.p)
+
+	assert.Equal(t.T(), StatusPass, r.Status)
+}
+
+func (t *DoctorTest) TestCheckFuseDevice_Missing() {
+	t.p.openErr = &fs.PathError{Op: "open", Path: FuseDevicePath, Err: fs.ErrNotExist}
+
+	r := CheckFuseDevice(t.p)
+
+	assert.Equal(t.T(), StatusFail, r.Status)
+	assert.Contains(t.T(), r.Remediation, "modprobe fuse")
+}
+
+func (t *DoctorTest) TestCheckFuseDevice_PermissionDenied() {
+	t.p.openErr = &fs.PathError{Op: "open", Path: FuseDevicePath, Err: fs.ErrPermission}
+
+	r := CheckFuseDevice(t.p)
+
+	assert.Equal(t.T(), StatusFail, r.Status)
+	assert.Contains(t.T(), r.Remediation, "0666")
+}
+
+func (t *DoctorTest) TestCheckFusermount_Setuid() {
+	r := CheckFusermount(t.p)
+
+	assert.Equal(t.T(), StatusPass, r.Status)
+	assert.Contains(t.T(), r.Message, "/usr/bin/fusermount3")
+}
+
+func (t *DoctorTest) TestCheckFusermount_FallsBackToFusermount() {
+	t.p.paths = map[string]string{"fusermount": "/bin/fusermount"}
+	t.p.modes = map[string]fs.FileMode{"/bin/fusermount": 0755 | fs.ModeSetuid}
+
+	r := CheckFusermount(t.p)
+
+	assert.Equal(t.T(), StatusPass, r.Status)
+	assert.Contains(t.T(), r.Message, "/bin/fusermount")
+}
+
+func (t *DoctorTest) TestCheckFusermount_NotFound() {
+	t.p.paths = map[string]string{}
+
+	r := CheckFusermount(t.p)
+
+	assert.Equal(t.T(), StatusFail, r.Status)
+	assert.NotEmpty(t.T(), r.Remediation)
+}
+
+func (t *DoctorTest) TestCheckFusermount_NotSetuid() {
+	t.p.modes["/usr/bin/fusermount3"] = 0755
+
+	r := CheckFusermount(t.p)
+
+	assert.Equal(t.T(), StatusFail, r.Status)
+	assert.Contains(t.T(), r.Remediation, "chmod u+s")
+}
+
+func (t *DoctorTest) TestCheckFusermount_NotSetuidAsRoot() {
+	t.p.uid = 0
+	t.p.modes["/usr/bin/fusermount3"] = 0755
+
+	r := CheckFusermount(t.p)
+
+	assert.Equal(t.T(), StatusPass, r.Status)
+}
+
+func (t *DoctorTest) TestCheckFuseConf_UserAllowOther() {
+	r := CheckFuseConf(t.p, true)
+
+	assert.Equal(t.T(), StatusPass, r.Status)
+}
+
+func (t *DoctorTest) TestCheckFuseConf_CommentedOut() {
+	t.p.files[FuseConfPath] = []byte("# user_allow_other\nmount_max = 1000\n")
+
+	r := CheckFuseConf(t.p, false)
+
+	assert.Equal(t.T(), StatusWarn, r.Status)
+}
+
+func (t *DoctorTest) TestCheckFuseConf_MissingWithAllowOther() {
+	delete(t.p.files, FuseConfPath)
+
+	r := CheckFuseConf(t.p, true)
+
+	assert.Equal(t.T(), StatusFail, r.Status)
+	assert.Contains(t.T(), r.Remediation, "user_allow_other")
+}
+
+func (t *DoctorTest) TestCheckFuseConf_Root() {
+	t.p.uid = 0
+	delete(t.p.files, FuseConfPath)
+
+	r := CheckFuseConf(t.p, true)
+
+	assert.Equal(t.T(), StatusPass, r.Status)
+}
+
+func (t *DoctorTest) TestCheckMacFuse() {
+	r := CheckMacFuse(t.p)
+
+	assert.Equal(t.T(), StatusPass, r.Status)
+	assert.Contains(t.T(), r.Message, "mount_macfuse")
+}
+
+func (t *DoctorTest) TestCheckMacFuse_FuseT() {
+	t.p.modes = map[string]fs.FileMode{"/usr/local/bin/go-nfsv4": 0755}
+
+	r := CheckMacFuse(t.p)
+
+	assert.Equal(t.T(), StatusPass, r.Status)
+	assert.Contains(t.T(), r.Message, "go-nfsv4")
+}
+
+func (t *DoctorTest) TestCheckMacFuse_NotFound() {
+	t.p.modes = nil
+
+	r := CheckMacFuse(t.p)
+
+	assert.Equal(t.T(), StatusFail, r.Status)
+	assert.NotEmpty(t.T(), r.Remediation)
+}
+
+func (t *DoctorTest) TestCheckDNS() {
+	r := CheckDNS(t.ctx, t.p, DefaultHost)
+
+	assert.Equal(t.T(), StatusPass, r.Status)
+	assert.Contains(t.T(), r.Message, "142.250.1.1")
+}
+
+func (t *DoctorTest) TestCheckDNS_Failure() {
+	t.p.addrs = nil
+	t.p.lookupErr = errors.New("no such host")
+
+	r := CheckDNS(t.ctx, t.p, DefaultHost)
+
+	assert.Equal(t.T(), StatusFail, r.Status)
+	assert.Contains(t.T(), r.Message, "no such host")
+}
+
+func (t *DoctorTest) TestCheckConnectivity() {
+	r := CheckConnectivity(t.ctx, t.p, "storage.googleapis.com:443")
+
+	assert.Equal(t.T(), StatusPass, r.Status)
+}
+
+func (t *DoctorTest) TestCheckConnectivity_Failure() {
+	t.p.dialErr = errors.New("connection refused")
+
+	r := CheckConnectivity(t.ctx, t.p, "storage.googleapis.com:443")
+
+	assert.Equal(t.T(), StatusFail, r.Status)
+	assert.Contains(t.T(), r.Message, "storage.googleapis.com:443")
+}
+
+func (t *DoctorTest) TestCheckClockSkew() {
+	testCases := []struct {
+		skew     time.Duration
+		expected Status
+	}{
+		{skew: 0, expected: StatusPass},
+		{skew: WarnClockSkew, expected: StatusPass},
+		{skew: -2 * time.Minute, expected: StatusWarn},
+		{skew: 10 * time.Minute, expected: StatusFail},
+		{skew: -10 * time.Minute, expected: StatusFail},
+	}
+
+	for _, tc := range testCases {
+		t.p.serverTime = t.p.now.Add(tc.skew)
+
+		r := CheckClockSkew(t.ctx, t.p, DefaultHost)
+
+		assert.Equal(t.T(), tc.expected, r.Status, "skew: %v", tc.skew)
+	}
+}
+
+func (t *DoctorTest) TestCheckClockSkew_ServerTimeUnavailable() {
+	t.p.timeErr = errors.New("timeout")
+
+	r := CheckClockSkew(t.ctx, t.p, DefaultHost)
+
+	assert.Equal(t.T(), StatusSkip, r.Status)
+}
+
+func (t *DoctorTest) TestCheckCredentials() {
+	r := CheckCredentials(t.ctx, t.p, false)
+
+	assert.Equal(t.T(), StatusPass, r.Status)
+}
+
+func (t *DoctorTest) TestCheckCredentials_Failure() {
+	t.p.tokenErr = errors.New("could not find default credentials")
+
+	r := CheckCredentials(t.ctx, t.p, false)
+
+	assert.Equal(t.T(), StatusFail, r.Status)
+	assert.Contains(t.T(), r.Remediation, "--key-file")
+}
+
+func (t *DoctorTest) TestCheckCredentials_ClockSkew() {
+	t.p.tokenErr = fmt.Errorf("fetching token: %w", &storageutil.ClockSkewError{
+		Skew: 7 * time.Minute,
+		Err:  errors.New(`oauth2: "invalid_grant"`),
+	})
+
+	r := CheckCredentials(t.ctx, t.p, false)
+
+	assert.Equal(t.T(), StatusFail, r.Status)
+	assert.Contains(t.T(), r.Message, "local clock is 7m0s ahead of the server's")
+	assert.Contains(t.T(), r.Remediation, "Synchronize the system clock")
+}
+
+func (t *DoctorTest) TestCheckCredentials_AnonymousAccess() {
+	t.p.tokenErr = errors.New("unused")
+
+	r := CheckCredentials(t.ctx, t.p, true)
+
+	assert.Equal(t.T(), StatusSkip, r.Status)
+}
+
+func (t *DoctorTest) TestCheckBucket() {
+	r := CheckBucket(t.ctx, t.p, "bucket")
+
+	assert.Equal(t.T(), StatusPass, r.Status)
+}
+
+func (t *DoctorTest) TestCheckBucket_NoBucket() {
+	r := CheckBucket(t.ctx, t.p, "")
+
+	assert.Equal(t.T(), StatusSkip, r.Status)
+}
+
+func (t *DoctorTest) TestCheckBucket_Failure() {
+	t.p.bucketErr = errors.New("storage: bucket doesn't exist")
+
+	r := CheckBucket(t.ctx, t.p, "bucket")
+
+	assert.Equal(t.T(), StatusFail, r.Status)
+}
+
+func (t *DoctorTest) TestRun_AllPass() {
+	results := Run(t.ctx, t.p, Options{Bucket: "bucket"})
+
+	assert.Len(t.T(), results, len(fuseChecks(t.p, Options{}))+5)
+	for _, r := range results {
+		assert.Equal(t.T(), StatusPass, r.Status, r.Name)
+	}
+	assert.False(t.T(), Failed(results))
+}
+
+func (t *DoctorTest) TestRun_Failure() {
+	t.p.dialErr = errors.New("connection refused")
+
+	results := Run(t.ctx, t.p, Options{})
+
+	assert.True(t.T(), Failed(results))
+}
+
+func (t *DoctorTest) TestWriteText() {
+	results := []Result{
+		{Name: "dns", Status: StatusPass, Message: "ok"},
+		{Name: "fuse-device", Status: StatusFail, Message: "missing", Remediation: "modprobe fuse"},
+	}
+	var buf bytes.Buffer
+
+	err := WriteText(&buf, results)
+
+	assert.NoError(t.T(), err)
+	assert.Equal(t.T(), "[PASS] dns: ok\n[FAIL] fuse-device: missing\n       fix: modprobe fuse\n", buf.String())
+}
+
+func (t *DoctorTest) TestWriteJSON() {
+	results := []Result{
+		{Name: "dns", Status: StatusPass, Message: "ok"},
+		{Name: "fuse-device", Status: StatusFail, Message: "missing", Remediation: "modprobe fuse"},
+	}
+	var buf bytes.Buffer
+
+	err := WriteJSON(&buf, results)
+
+	assert.NoError(t.T(), err)
+	var decoded []Result
+	assert.NoError(t.T(), json.Unmarshal(buf.Bytes(), &decoded))
+	assert.Equal(t.T(), results, decoded)
+}
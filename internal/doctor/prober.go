@@ -0,0 +1,134 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package doctor
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+)
+
+const probeTimeout = 10 * time.Second
+
+type osProber struct {
+	clientConfig   storageutil.StorageClientConfig
+	billingProject string
+}
+
+// NewProber returns a Prober backed by the real environment. The storage
+// client config is used for the credential and bucket checks.
+func NewProber(clientConfig storageutil.StorageClientConfig, billingProject string) Prober {
+	return &osProber{
+		clientConfig:   clientConfig,
+		billingProject: billingProject,
+	}
+}
+
+func (p *osProber) Getuid() int {
+	return os.Geteuid()
+}
+
+func (p *osProber) OpenFile(name string, flag int) error {
+	f, err := os.OpenFile(name, flag, 0)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func (p *osProber) LookPath(file string) (string, error) {
+	return exec.LookPath(file)
+}
+
+func (p *osProber) Stat(name string) (fs.FileInfo, error) {
+	return os.Stat(name)
+}
+
+func (p *osProber) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(name)
+}
+
+func (p *osProber) LookupHost(ctx context.Context, host string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+	return net.DefaultResolver.LookupHost(ctx, host)
+}
+
+func (p *osProber) DialTCP(ctx context.Context, addr string) error {
+	d := net.Dialer{Timeout: probeTimeout}
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+func (p *osProber) ServerTime(ctx context.Context, host string) (time.Time, error) {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, "https://"+host+"/", nil)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyFromEnvironment}}
+	resp, err := client.Do(req)
+	if err != nil {
+		return time.Time{}, err
+	}
+	resp.Body.Close()
+
+	date := resp.Header.Get("Date")
+	if date == "" {
+		return time.Time{}, fmt.Errorf("response has no Date header")
+	}
+	return http.ParseTime(date)
+}
+
+func (p *osProber) FetchToken(ctx context.Context) error {
+	ts, err := storageutil.CreateTokenSource(&p.clientConfig)
+	if err != nil {
+		return err
+	}
+	_, err = ts.Token()
+	return err
+}
+
+func (p *osProber) StatBucket(ctx context.Context, bucket string) error {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	sh, err := storage.NewStorageHandle(ctx, p.clientConfig)
+	if err != nil {
+		return fmt.Errorf("NewStorageHandle: %w", err)
+	}
+
+	_, err = sh.BucketHandle(bucket, p.billingProject).ListObjects(ctx, &gcs.ListObjectsRequest{MaxResults: 1})
+	return err
+}
+
+func (p *osProber) Now() time.Time {
+	return time.Now()
+}
@@ -0,0 +1,156 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Tests for setting access times, with and without --preserve-atime.
+
+package fs_test
+
+import (
+	"os"
+	"os/exec"
+	"path"
+	"syscall"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/fs/inode"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	. "github.com/jacobsa/ogletest"
+	"github.com/jacobsa/timeutil"
+)
+
+////////////////////////////////////////////////////////////////////////
+// Common
+////////////////////////////////////////////////////////////////////////
+
+var (
+	someAtime = time.Date(2012, 8, 15, 22, 56, 0, 0, time.Local)
+	someMtime = time.Date(2013, 9, 16, 23, 57, 0, 0, time.Local)
+)
+
+func touch(args ...string) {
+	out, err := exec.Command("touch", args...).CombinedOutput()
+	AssertEq(nil, err, "touch %v: %s", args, out)
+}
+
+func statTimes(p string) (atime time.Time, mtime time.Time) {
+	fi, err := os.Stat(p)
+	AssertEq(nil, err)
+
+	atime = statAtime(fi.Sys().(*syscall.Stat_t))
+	mtime = fi.ModTime()
+	return
+}
+
+func objectMetadata(name string) map[string]string {
+	m, _, err := bucket.StatObject(ctx, &gcs.StatObjectRequest{Name: name})
+	AssertEq(nil, err)
+	return m.Metadata
+}
+
+////////////////////////////////////////////////////////////////////////
+// Without --preserve-atime
+////////////////////////////////////////////////////////////////////////
+
+type NoAtimeTest struct {
+	fsTest
+}
+
+func init() { RegisterTestSuite(&NoAtimeTest{}) }
+
+func (t *NoAtimeTest) TouchA() {
+	AssertEq(nil, t.createWithContents("foo", "taco"))
+	p := path.Join(mntDir, "foo")
+	_, mtimeBefore := statTimes(p)
+
+	// Accepted, but ignored.
+	touch("-a", "-d", someAtime.Format(time.RFC3339), p)
+
+	atime, mtime := statTimes(p)
+	ExpectThat(mtime, timeutil.TimeEq(mtimeBefore))
+	ExpectThat(atime, timeutil.TimeEq(mtime))
+	_, ok := objectMetadata("foo")[inode.FileAtimeMetadataKey]
+	ExpectFalse(ok)
+}
+
+func (t *NoAtimeTest) TouchM() {
+	AssertEq(nil, t.createWithContents("foo", "taco"))
+	p := path.Join(mntDir, "foo")
+
+	touch("-m", "-d", someMtime.Format(time.RFC3339), p)
+
+	atime, mtime := statTimes(p)
+	ExpectThat(mtime, timeutil.TimeEq(someMtime))
+	ExpectThat(atime, timeutil.TimeEq(someMtime))
+}
+
+////////////////////////////////////////////////////////////////////////
+// With --preserve-atime
+////////////////////////////////////////////////////////////////////////
+
+type PreserveAtimeTest struct {
+	fsTest
+}
+
+func init() { RegisterTestSuite(&PreserveAtimeTest{}) }
+
+func (t *PreserveAtimeTest) SetUpTestSuite() {
+	t.serverCfg.PreserveAtime = true
+	t.fsTest.SetUpTestSuite()
+}
+
+func (t *PreserveAtimeTest) TouchA() {
+	AssertEq(nil, t.createWithContents("foo", "taco"))
+	p := path.Join(mntDir, "foo")
+	_, mtimeBefore := statTimes(p)
+
+	touch("-a", "-d", someAtime.Format(time.RFC3339), p)
+
+	atime, mtime := statTimes(p)
+	ExpectThat(atime, timeutil.TimeEq(someAtime))
+	ExpectThat(mtime, timeutil.TimeEq(mtimeBefore))
+	ExpectEq(someAtime.UTC().Format(time.RFC3339Nano), objectMetadata("foo")[inode.FileAtimeMetadataKey])
+}
+
+func (t *PreserveAtimeTest) TouchM() {
+	AssertEq(nil, t.createWithContents("foo", "taco"))
+	p := path.Join(mntDir, "foo")
+	touch("-a", "-d", someAtime.Format(time.RFC3339), p)
+
+	// The atime is left alone.
+	touch("-m", "-d", someMtime.Format(time.RFC3339), p)
+
+	atime, mtime := statTimes(p)
+	ExpectThat(atime, timeutil.TimeEq(someAtime))
+	ExpectThat(mtime, timeutil.TimeEq(someMtime))
+}
+
+func (t *PreserveAtimeTest) CpP() {
+	dir, err := os.MkdirTemp("", "atime_test")
+	AssertEq(nil, err)
+	defer os.RemoveAll(dir)
+	src := path.Join(dir, "src")
+	AssertEq(nil, os.WriteFile(src, []byte("taco"), 0600))
+	AssertEq(nil, os.Chtimes(src, someAtime, someMtime))
+	dst := path.Join(mntDir, "dst")
+
+	out, err := exec.Command("cp", "-p", src, dst).CombinedOutput()
+	AssertEq(nil, err, "cp: %s", out)
+
+	atime, mtime := statTimes(dst)
+	ExpectThat(atime, timeutil.TimeEq(someAtime))
+	ExpectThat(mtime, timeutil.TimeEq(someMtime))
+	metadata := objectMetadata("dst")
+	ExpectEq(someAtime.UTC().Format(time.RFC3339Nano), metadata[inode.FileAtimeMetadataKey])
+	ExpectEq(someMtime.UTC().Format(time.RFC3339Nano), metadata[inode.FileMtimeMetadataKey])
+}
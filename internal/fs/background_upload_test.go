@@ -0,0 +1,181 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fs_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	. "github.com/jacobsa/ogletest"
+	"github.com/jacobsa/timeutil"
+)
+
+////////////////////////////////////////////////////////////////////////
+// Boilerplate
+////////////////////////////////////////////////////////////////////////
+
+const maxParallelUploads = 8
+
+// slowCreateBucket makes each object creation take a while and records how
+// many were in flight at once.
+type slowCreateBucket struct {
+	gcs.Bucket
+
+	mu sync.Mutex
+
+	// GUARDED_BY(mu)
+	inFlight    int
+	maxInFlight int
+}
+
+func (b *slowCreateBucket) CreateObject(
+	ctx context.Context,
+	req *gcs.CreateObjectRequest) (*gcs.Object, error) {
+	b.mu.Lock()
+	b.inFlight++
+	if b.inFlight > b.maxInFlight {
+		b.maxInFlight = b.inFlight
+	}
+	b.mu.Unlock()
+
+	defer func() {
+		b.mu.Lock()
+		b.inFlight--
+		b.mu.Unlock()
+	}()
+
+	time.Sleep(2 * time.Millisecond)
+	return b.Bucket.CreateObject(ctx, req)
+}
+
+func (b *slowCreateBucket) maxParallelCreates() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.maxInFlight
+}
+
+var slowBucket *slowCreateBucket
+
+type BackgroundUploadTest struct {
+	fsTest
+}
+
+func init() { RegisterTestSuite(&BackgroundUploadTest{}) }
+
+func (t *BackgroundUploadTest) SetUpTestSuite() {
+	slowBucket = &slowCreateBucket{
+		Bucket: fake.NewFakeBucket(timeutil.RealClock(), "some_bucket"),
+	}
+	bucket = slowBucket
+	t.serverCfg.MaxParallelUploads = maxParallelUploads
+
+	t.fsTest.SetUpTestSuite()
+}
+
+// Build a tar archive holding n small files.
+func makeArchive(n int) []byte {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for i := 0; i < n; i++ {
+		contents := []byte(fmt.Sprintf("contents of file %d", i))
+		AssertEq(nil, tw.WriteHeader(&tar.Header{
+			Name: fmt.Sprintf("file%04d", i),
+			Mode: 0644,
+			Size: int64(len(contents)),
+		}))
+		_, err := tw.Write(contents)
+		AssertEq(nil, err)
+	}
+	AssertEq(nil, tw.Close())
+
+	return buf.Bytes()
+}
+
+// Extract the archive into dir the way tar(1) does, one file at a time.
+func extractArchive(archive []byte, dir string) {
+	tr := tar.NewReader(bytes.NewReader(archive))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return
+		}
+		AssertEq(nil, err)
+
+		f, err := os.OpenFile(path.Join(dir, hdr.Name), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+		AssertEq(nil, err)
+		_, err = io.Copy(f, tr)
+		AssertEq(nil, err)
+		AssertEq(nil, f.Close())
+	}
+}
+
+////////////////////////////////////////////////////////////////////////
+// Tests
+////////////////////////////////////////////////////////////////////////
+
+func (t *BackgroundUploadTest) ExtractArchive() {
+	const n = 1000
+	extractArchive(makeArchive(n), mntDir)
+
+	// Every file eventually shows up in the bucket with the right contents.
+	deadline := time.Now().Add(time.Minute)
+	for i := 0; i < n; i++ {
+		name := fmt.Sprintf("file%04d", i)
+		for {
+			contents, err := storageutil.ReadObject(ctx, slowBucket.Bucket, name)
+			if err == nil {
+				ExpectEq(fmt.Sprintf("contents of file %d", i), string(contents))
+				break
+			}
+
+			if time.Now().After(deadline) {
+				AddFailure("%q not uploaded: %v", name, err)
+				AbortTest()
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	// The uploads overlapped, but no more than allowed.
+	ExpectGt(slowBucket.maxParallelCreates(), 1)
+	ExpectLe(slowBucket.maxParallelCreates(), maxParallelUploads)
+}
+
+func (t *BackgroundUploadTest) OSyncWaitsForUpload() {
+	const name = "foo"
+	AssertEq(nil, t.createWithContents(name, "burrito"))
+
+	f, err := os.OpenFile(path.Join(mntDir, name), os.O_WRONLY|os.O_TRUNC|os.O_SYNC, 0)
+	AssertEq(nil, err)
+	_, err = f.WriteString("taco")
+	AssertEq(nil, err)
+	AssertEq(nil, f.Close())
+
+	// No waiting: the close returned after the upload.
+	contents, err := storageutil.ReadObject(ctx, slowBucket.Bucket, name)
+
+	AssertEq(nil, err)
+	ExpectEq("taco", string(contents))
+}
@@ -0,0 +1,157 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Tests for the block counts reported for files, which du and ls -s use to
+// compute the space they take up.
+
+package fs_test
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"syscall"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	. "github.com/jacobsa/ogletest"
+)
+
+////////////////////////////////////////////////////////////////////////
+// Helpers
+////////////////////////////////////////////////////////////////////////
+
+// The number of 512-byte blocks that a file of the given size should report.
+func expectedBlocks(size int64) int64 {
+	return (size + 511) / 512
+}
+
+// Return the size and block count of the supplied stat result.
+func sizeAndBlocks(fi os.FileInfo) (int64, int64) {
+	st := fi.Sys().(*syscall.Stat_t)
+	return st.Size, int64(st.Blocks)
+}
+
+////////////////////////////////////////////////////////////////////////
+// Boilerplate
+////////////////////////////////////////////////////////////////////////
+
+type BlocksTest struct {
+	fsTest
+}
+
+func init() {
+	RegisterTestSuite(&BlocksTest{})
+}
+
+////////////////////////////////////////////////////////////////////////
+// Tests
+////////////////////////////////////////////////////////////////////////
+
+func (t *BlocksTest) SizesAroundBlockBoundaries() {
+	sizes := []int64{0, 1, 511, 512, 513, 1023, 1024, 4095, 4096, 4097, 1<<20 + 1}
+	contents := make(map[string][]byte)
+	for _, size := range sizes {
+		contents[fmt.Sprintf("foo_%d", size)] = make([]byte, size)
+	}
+	AssertEq(nil, storageutil.CreateObjects(ctx, bucket, contents))
+
+	// Stat each file, which looks it up.
+	for _, size := range sizes {
+		fi, err := os.Stat(path.Join(mntDir, fmt.Sprintf("foo_%d", size)))
+		AssertEq(nil, err)
+
+		actualSize, blocks := sizeAndBlocks(fi)
+		ExpectEq(size, actualSize)
+		ExpectEq(expectedBlocks(size), blocks, "size %d", size)
+	}
+
+	// Open each file and stat it again, which gets its attributes from the
+	// inode. The answers must agree.
+	for _, size := range sizes {
+		f, err := os.Open(path.Join(mntDir, fmt.Sprintf("foo_%d", size)))
+		AssertEq(nil, err)
+
+		fi, err := f.Stat()
+		AssertEq(nil, f.Close())
+		AssertEq(nil, err)
+
+		_, blocks := sizeAndBlocks(fi)
+		ExpectEq(expectedBlocks(size), blocks, "size %d", size)
+	}
+
+	// The same goes for the entries of a directory listing.
+	entries, err := os.ReadDir(mntDir)
+	AssertEq(nil, err)
+	AssertEq(len(sizes), len(entries))
+	for _, e := range entries {
+		fi, err := e.Info()
+		AssertEq(nil, err)
+
+		size, blocks := sizeAndBlocks(fi)
+		ExpectEq(expectedBlocks(size), blocks, "%s", e.Name())
+	}
+}
+
+func (t *BlocksTest) DirtyLocalFile() {
+	// Resize a new file without closing it, so that its contents are only
+	// staged locally. Data written through the kernel's writeback cache isn't
+	// seen by the file system until it's flushed, but truncation is.
+	f, err := os.Create(path.Join(mntDir, "foo"))
+	AssertEq(nil, err)
+	defer func() { AssertEq(nil, f.Close()) }()
+
+	for _, size := range []int64{1, 512, 513, 5000, 511} {
+		AssertEq(nil, f.Truncate(size))
+
+		fi, err := f.Stat()
+		AssertEq(nil, err)
+		actualSize, blocks := sizeAndBlocks(fi)
+		ExpectEq(size, actualSize)
+		ExpectEq(expectedBlocks(size), blocks, "size %d", size)
+
+		fi, err = os.Stat(path.Join(mntDir, "foo"))
+		AssertEq(nil, err)
+		_, blocks = sizeAndBlocks(fi)
+		ExpectEq(expectedBlocks(size), blocks, "size %d", size)
+	}
+
+	// Once written data is flushed, its blocks count as well.
+	_, err = f.WriteAt(make([]byte, 1), 9999)
+	AssertEq(nil, err)
+	AssertEq(nil, f.Sync())
+
+	fi, err := f.Stat()
+	AssertEq(nil, err)
+	_, blocks := sizeAndBlocks(fi)
+	ExpectEq(expectedBlocks(10000), blocks)
+}
+
+func (t *BlocksTest) SparseAndTruncatedFiles() {
+	AssertEq(nil, storageutil.CreateObjects(ctx, bucket, map[string][]byte{
+		"foo": make([]byte, 1000),
+	}))
+	p := path.Join(mntDir, "foo")
+
+	// Extending a file by truncating it leaves a hole, but the file is stored
+	// in full, so the hole counts as well.
+	for _, size := range []int64{10000, 100, 0, 513} {
+		AssertEq(nil, os.Truncate(p, size))
+
+		fi, err := os.Stat(p)
+		AssertEq(nil, err)
+		actualSize, blocks := sizeAndBlocks(fi)
+		ExpectEq(size, actualSize)
+		ExpectEq(expectedBlocks(size), blocks, "size %d", size)
+	}
+}
@@ -0,0 +1,324 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Tests for deleting many objects at once, with rm -r and by renaming
+// directories.
+
+package fs_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/metadata"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	. "github.com/jacobsa/oglematchers"
+	. "github.com/jacobsa/ogletest"
+	"github.com/jacobsa/timeutil"
+	"google.golang.org/api/googleapi"
+)
+
+////////////////////////////////////////////////////////////////////////
+// Boilerplate
+////////////////////////////////////////////////////////////////////////
+
+const (
+	deleteParallelism = 4
+	deleteLatency     = 3 * time.Millisecond
+)
+
+// slowDeleteBucket adds latency to deletions, tracking how many deletions of
+// files run at once, and forbids those of forbiddenName. Directories are
+// deleted outside of ServerConfig.DeleteParallelism.
+type slowDeleteBucket struct {
+	gcs.Bucket
+
+	mu sync.Mutex
+
+	// GUARDED_BY(mu)
+	forbiddenName string
+	running       int
+	maxRunning    int
+}
+
+func (b *slowDeleteBucket) DeleteObject(
+	ctx context.Context,
+	req *gcs.DeleteObjectRequest) error {
+	isFile := !strings.HasSuffix(req.Name, "/")
+	b.mu.Lock()
+	if isFile {
+		b.running++
+		b.maxRunning = max(b.maxRunning, b.running)
+	}
+	forbidden := req.Name == b.forbiddenName
+	b.mu.Unlock()
+
+	time.Sleep(deleteLatency)
+
+	b.mu.Lock()
+	if isFile {
+		b.running--
+	}
+	b.mu.Unlock()
+
+	if forbidden {
+		return &googleapi.Error{Code: http.StatusForbidden}
+	}
+	return b.Bucket.DeleteObject(ctx, req)
+}
+
+func (b *slowDeleteBucket) reset(forbiddenName string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.forbiddenName = forbiddenName
+	b.maxRunning = 0
+}
+
+func (b *slowDeleteBucket) maxRunningDeletes() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.maxRunning
+}
+
+var deleteBucket *slowDeleteBucket
+
+type BulkDeleteTest struct {
+	fsTest
+}
+
+func init() { RegisterTestSuite(&BulkDeleteTest{}) }
+
+func (t *BulkDeleteTest) SetUpTestSuite() {
+	deleteBucket = &slowDeleteBucket{
+		Bucket: fake.NewFakeBucket(timeutil.RealClock(), "some_bucket"),
+	}
+	bucket = deleteBucket
+	t.serverCfg.DeleteParallelism = deleteParallelism
+	t.fsTest.SetUpTestSuite()
+}
+
+func (t *BulkDeleteTest) SetUp(ti *TestInfo) {
+	deleteBucket.reset("")
+}
+
+func (t *BulkDeleteTest) TearDown() {
+	deleteBucket.reset("")
+	t.fsTest.TearDown()
+}
+
+// The names of the objects in the bucket under the given prefix.
+func objectsUnder(prefix string) (names []string) {
+	objects, _, err := storageutil.ListAll(ctx, bucket, &gcs.ListObjectsRequest{Prefix: prefix})
+	AssertEq(nil, err)
+	for _, o := range objects {
+		names = append(names, o.Name)
+	}
+	return
+}
+
+////////////////////////////////////////////////////////////////////////
+// Tests
+////////////////////////////////////////////////////////////////////////
+
+func (t *BulkDeleteTest) RemoveAll_DeletesTenThousandObjects() {
+	const (
+		dirs        = 100
+		filesPerDir = 100
+		workers     = 16
+	)
+	names := []string{"big/"}
+	for i := 0; i < dirs; i++ {
+		names = append(names, fmt.Sprintf("big/%d/", i))
+		for j := 0; j < filesPerDir; j++ {
+			names = append(names, fmt.Sprintf("big/%d/%d", i, j))
+		}
+	}
+	AssertEq(nil, t.createEmptyObjects(names))
+
+	// The kernel unlinks the entries of a directory one at a time, so rm -r is
+	// run on the directories by several workers at once, as with xargs -P.
+	start := time.Now()
+	dirsToRemove := make(chan int, dirs)
+	for i := 0; i < dirs; i++ {
+		dirsToRemove <- i
+	}
+	close(dirsToRemove)
+	errs := make(chan error, dirs)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range dirsToRemove {
+				errs <- os.RemoveAll(path.Join(mntDir, "big", fmt.Sprint(i)))
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		ExpectEq(nil, err)
+	}
+	AssertEq(nil, os.RemoveAll(path.Join(mntDir, "big")))
+	elapsed := time.Since(start)
+
+	ExpectThat(objectsUnder("big/"), ElementsAre())
+	ExpectGt(deleteBucket.maxRunningDeletes(), 1)
+	ExpectLe(deleteBucket.maxRunningDeletes(), deleteParallelism)
+	// Deleting the objects one at a time would take at least this long.
+	ExpectLt(elapsed, time.Duration(len(names))*deleteLatency)
+}
+
+func (t *BulkDeleteTest) Unlink_FailedDeleteSurfacesOnItsOwnUnlink() {
+	AssertEq(nil, t.createEmptyObjects([]string{"dir/", "dir/a", "dir/b", "dir/c"}))
+	deleteBucket.reset("dir/b")
+
+	ExpectEq(nil, os.Remove(path.Join(mntDir, "dir/a")))
+	err := os.Remove(path.Join(mntDir, "dir/b"))
+	ExpectTrue(errors.Is(err, syscall.EACCES), "%v", err)
+	ExpectEq(nil, os.Remove(path.Join(mntDir, "dir/c")))
+
+	ExpectThat(objectsUnder("dir/"), ElementsAre("dir/", "dir/b"))
+	_, err = os.Stat(path.Join(mntDir, "dir/b"))
+	ExpectEq(nil, err)
+	_, err = os.Stat(path.Join(mntDir, "dir/a"))
+	ExpectTrue(os.IsNotExist(err), "%v", err)
+}
+
+func (t *BulkDeleteTest) RenameDir_DeletesOldObjectsInParallel() {
+	AssertEq(nil, t.createEmptyObjects([]string{"old/", "old/a", "old/b", "old/c", "old/d"}))
+
+	AssertEq(nil, os.Rename(path.Join(mntDir, "old"), path.Join(mntDir, "new")))
+
+	ExpectThat(objectsUnder("old/"), ElementsAre())
+	ExpectThat(objectsUnder("new/"), ElementsAre("new/", "new/a", "new/b", "new/c", "new/d"))
+	ExpectGt(deleteBucket.maxRunningDeletes(), 1)
+	ExpectLe(deleteBucket.maxRunningDeletes(), deleteParallelism)
+}
+
+func (t *BulkDeleteTest) RenameDir_FailedDeleteFailsRename() {
+	AssertEq(nil, t.createEmptyObjects([]string{"old/", "old/a", "old/b", "old/c"}))
+	deleteBucket.reset("old/b")
+
+	err := os.Rename(path.Join(mntDir, "old"), path.Join(mntDir, "new"))
+
+	ExpectTrue(errors.Is(err, syscall.EACCES), "%v", err)
+	// The other objects are deleted all the same, and the old directory shows
+	// what's left of it.
+	ExpectThat(objectsUnder("old/"), ElementsAre("old/", "old/b"))
+	ExpectThat(objectsUnder("new/"), ElementsAre("new/", "new/a", "new/b", "new/c"))
+	entries, err := os.ReadDir(path.Join(mntDir, "old"))
+	AssertEq(nil, err)
+	AssertEq(1, len(entries))
+	ExpectEq("b", entries[0].Name())
+}
+
+////////////////////////////////////////////////////////////////////////
+// Asynchronous unlinks
+////////////////////////////////////////////////////////////////////////
+
+type AsyncUnlinkTest struct {
+	fsTest
+}
+
+func init() { RegisterTestSuite(&AsyncUnlinkTest{}) }
+
+func (t *AsyncUnlinkTest) SetUpTestSuite() {
+	deleteBucket = &slowDeleteBucket{
+		Bucket: fake.NewFakeBucket(timeutil.RealClock(), "some_bucket"),
+	}
+	bucket = deleteBucket
+	t.serverCfg.DeleteParallelism = deleteParallelism
+	t.serverCfg.AsyncUnlink = true
+	// Unlinks only return before the deletion of names known to be files.
+	t.serverCfg.DirTypeCacheTTLs = metadata.SameEntryTTLs(time.Minute)
+	t.fsTest.SetUpTestSuite()
+}
+
+func (t *AsyncUnlinkTest) SetUp(ti *TestInfo) {
+	deleteBucket.reset("")
+}
+
+func (t *AsyncUnlinkTest) TearDown() {
+	deleteBucket.reset("")
+	t.fsTest.TearDown()
+}
+
+func (t *AsyncUnlinkTest) RemoveAll_DeletesLargeTreeInParallel() {
+	const (
+		dirs        = 20
+		filesPerDir = 100
+	)
+	names := []string{"big/"}
+	for i := 0; i < dirs; i++ {
+		names = append(names, fmt.Sprintf("big/%d/", i))
+		for j := 0; j < filesPerDir; j++ {
+			names = append(names, fmt.Sprintf("big/%d/%d", i, j))
+		}
+	}
+	AssertEq(nil, t.createEmptyObjects(names))
+
+	// A single rm -r, whose unlinks the kernel sends one at a time.
+	start := time.Now()
+	AssertEq(nil, os.RemoveAll(path.Join(mntDir, "big")))
+	elapsed := time.Since(start)
+
+	ExpectThat(objectsUnder("big/"), ElementsAre())
+	ExpectGt(deleteBucket.maxRunningDeletes(), 1)
+	ExpectLe(deleteBucket.maxRunningDeletes(), deleteParallelism)
+	// Deleting the objects one at a time would take at least this long.
+	ExpectLt(elapsed, time.Duration(len(names))*deleteLatency)
+}
+
+func (t *AsyncUnlinkTest) Unlink_FailedDeleteIsOnlyLogged() {
+	AssertEq(nil, t.createEmptyObjects([]string{"dir/", "dir/a", "dir/b", "dir/c"}))
+	deleteBucket.reset("dir/b")
+
+	// The unlinks return before the deletions.
+	ExpectEq(nil, os.Remove(path.Join(mntDir, "dir/a")))
+	ExpectEq(nil, os.Remove(path.Join(mntDir, "dir/b")))
+	ExpectEq(nil, os.Remove(path.Join(mntDir, "dir/c")))
+
+	// Removing the directory waits for them, and finds the file whose
+	// deletion failed.
+	err := os.Remove(path.Join(mntDir, "dir"))
+	ExpectTrue(errors.Is(err, syscall.ENOTEMPTY), "%v", err)
+	ExpectThat(objectsUnder("dir/"), ElementsAre("dir/", "dir/b"))
+	_, err = os.Stat(path.Join(mntDir, "dir/b"))
+	ExpectEq(nil, err)
+	_, err = os.Stat(path.Join(mntDir, "dir/a"))
+	ExpectTrue(os.IsNotExist(err), "%v", err)
+}
+
+func (t *AsyncUnlinkTest) Unlink_RecreatedFileSurvivesDeletion() {
+	AssertEq(nil, t.createEmptyObjects([]string{"dir/", "dir/a"}))
+
+	AssertEq(nil, os.Remove(path.Join(mntDir, "dir/a")))
+	AssertEq(nil, os.WriteFile(path.Join(mntDir, "dir/a"), []byte("taco"), filePerms))
+
+	contents, err := os.ReadFile(path.Join(mntDir, "dir/a"))
+	AssertEq(nil, err)
+	ExpectEq("taco", string(contents))
+	ExpectThat(objectsUnder("dir/"), ElementsAre("dir/", "dir/a"))
+}
@@ -60,13 +60,15 @@ func (t *cachingTestCommon) SetUpTestSuite() {
 	lruCache := newLruCache(uint64(1000 * mount.AverageSizeOfPositiveStatCacheEntry))
 	statCache := metadata.NewStatCacheBucketView(lruCache, "")
 	bucket = caching.NewFastStatBucket(
-		ttl,
+		metadata.SameEntryTTLs(ttl),
+		metadata.CacheControlTTL{},
+		nil,
 		statCache,
 		&cacheClock,
 		uncachedBucket)
 
 	// Enable directory type caching.
-	t.serverCfg.DirTypeCacheTTL = ttl
+	t.serverCfg.DirTypeCacheTTLs = metadata.SameEntryTTLs(ttl)
 
 	// Call through.
 	t.fsTest.SetUpTestSuite()
@@ -353,6 +355,10 @@ func (t *CachingWithImplicitDirsTest) ImplicitDirectory_DefinedByDirectory() {
 
 	AssertEq(nil, err)
 
+	// Cleaning up after an earlier test may have cached that nothing exists
+	// under "foo/". Wait for that to expire.
+	cacheClock.AdvanceTime(ttl + time.Millisecond)
+
 	// The directory should appear to exist.
 	fi, err = os.Stat(path.Join(mntDir, "foo"))
 	AssertEq(nil, err)
@@ -466,14 +472,16 @@ func (t *MultiBucketMountCachingTest) SetUpTestSuite() {
 		uncachedBuckets[bucketName] = fake.NewFakeBucket(timeutil.RealClock(), bucketName)
 		statCache := metadata.NewStatCacheBucketView(sharedCache, bucketName)
 		buckets[bucketName] = caching.NewFastStatBucket(
-			ttl,
+			metadata.SameEntryTTLs(ttl),
+			metadata.CacheControlTTL{},
+			nil,
 			statCache,
 			&cacheClock,
 			uncachedBuckets[bucketName])
 	}
 
 	// Enable directory type caching.
-	t.serverCfg.DirTypeCacheTTL = ttl
+	t.serverCfg.DirTypeCacheTTLs = metadata.SameEntryTTLs(ttl)
 
 	// Call through.
 	t.fsTest.SetUpTestSuite()
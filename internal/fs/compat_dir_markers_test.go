@@ -0,0 +1,130 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Tests for the empty objects that S3-compatible tools create to mark
+// directories, with --compat-dir-markers.
+
+package fs_test
+
+import (
+	"errors"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/fs/inode"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/jacobsa/fuse/fusetesting"
+	. "github.com/jacobsa/ogletest"
+)
+
+////////////////////////////////////////////////////////////////////////
+// Boilerplate
+////////////////////////////////////////////////////////////////////////
+
+type CompatDirMarkersTest struct {
+	fsTest
+}
+
+func init() { RegisterTestSuite(&CompatDirMarkersTest{}) }
+
+func (t *CompatDirMarkersTest) SetUpTestSuite() {
+	t.serverCfg.CompatDirMarkerTypes = []string{inode.DefaultCompatDirMarkerType}
+	t.fsTest.SetUpTestSuite()
+}
+
+func createCompatDirMarker(name string) {
+	_, err := bucket.CreateObject(ctx, &gcs.CreateObjectRequest{
+		Name:        name,
+		ContentType: inode.DefaultCompatDirMarkerType,
+		Contents:    strings.NewReader(""),
+	})
+	AssertEq(nil, err)
+}
+
+func objectExists(name string) bool {
+	_, _, err := bucket.StatObject(ctx, &gcs.StatObjectRequest{Name: name})
+	var notFoundErr *gcs.NotFoundError
+	if errors.As(err, &notFoundErr) {
+		return false
+	}
+	AssertEq(nil, err)
+	return true
+}
+
+////////////////////////////////////////////////////////////////////////
+// Tests
+////////////////////////////////////////////////////////////////////////
+
+func (t *CompatDirMarkersTest) MarkerIsADirectory() {
+	createCompatDirMarker("dir")
+	AssertEq(nil, t.createObjects(map[string]string{"dir/foo": "taco"}))
+
+	fi, err := os.Stat(path.Join(mntDir, "dir"))
+	AssertEq(nil, err)
+	ExpectTrue(fi.IsDir())
+
+	entries, err := fusetesting.ReadDirPicky(mntDir)
+	AssertEq(nil, err)
+	AssertEq(1, len(entries))
+	ExpectEq("dir", entries[0].Name())
+	ExpectTrue(entries[0].IsDir())
+
+	entries, err = fusetesting.ReadDirPicky(path.Join(mntDir, "dir"))
+	AssertEq(nil, err)
+	AssertEq(1, len(entries))
+	ExpectEq("foo", entries[0].Name())
+}
+
+func (t *CompatDirMarkersTest) MarkerAndPlaceholder() {
+	createCompatDirMarker("dir")
+	AssertEq(nil, t.createObjects(map[string]string{"dir/": ""}))
+
+	// A single directory, without a conflicting file.
+	entries, err := fusetesting.ReadDirPicky(mntDir)
+	AssertEq(nil, err)
+	AssertEq(1, len(entries))
+	ExpectEq("dir", entries[0].Name())
+	ExpectTrue(entries[0].IsDir())
+}
+
+func (t *CompatDirMarkersTest) RmDirDeletesMarker() {
+	createCompatDirMarker("dir")
+
+	AssertEq(nil, os.Remove(path.Join(mntDir, "dir")))
+
+	ExpectFalse(objectExists("dir"))
+	_, err := os.Stat(path.Join(mntDir, "dir"))
+	ExpectTrue(os.IsNotExist(err), "err: %v", err)
+}
+
+func (t *CompatDirMarkersTest) RmDirDeletesMarkerAndPlaceholder() {
+	createCompatDirMarker("dir")
+	AssertEq(nil, t.createObjects(map[string]string{"dir/": ""}))
+
+	AssertEq(nil, os.Remove(path.Join(mntDir, "dir")))
+
+	ExpectFalse(objectExists("dir"))
+	ExpectFalse(objectExists("dir/"))
+}
+
+func (t *CompatDirMarkersTest) RmDirOfNonEmptyDirectory() {
+	createCompatDirMarker("dir")
+	AssertEq(nil, t.createObjects(map[string]string{"dir/foo": "taco"}))
+
+	err := os.Remove(path.Join(mntDir, "dir"))
+
+	ExpectNe(nil, err)
+	ExpectTrue(objectExists("dir"))
+}
@@ -0,0 +1,389 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Tests for the control directory and the files in it.
+
+package fs_test
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/fs/inode"
+	. "github.com/jacobsa/oglematchers"
+	. "github.com/jacobsa/ogletest"
+)
+
+////////////////////////////////////////////////////////////////////////
+// Boilerplate
+////////////////////////////////////////////////////////////////////////
+
+type ControlFileTest struct {
+	fsTest
+}
+
+func init() { RegisterTestSuite(&ControlFileTest{}) }
+
+type QueryFileTest struct {
+	fsTest
+}
+
+func init() { RegisterTestSuite(&QueryFileTest{}) }
+
+func (t *QueryFileTest) SetUpTestSuite() {
+	t.serverCfg.MetadataQueryMaxObjects = 4
+	t.fsTest.SetUpTestSuite()
+}
+
+// Return the path of the control directory.
+func controlDir() string {
+	return path.Join(mntDir, inode.ControlDirName)
+}
+
+// Return the path of the objectinfo control file for the supplied path.
+func objectInfoPath(p string) string {
+	return path.Join(controlDir(), inode.ObjectInfoFile+"?"+url.Values{"path": {p}}.Encode())
+}
+
+// Return what the objectinfo control file reports for the supplied path.
+func objectInfo(p string) (string, error) {
+	contents, err := os.ReadFile(objectInfoPath(p))
+	return string(contents), err
+}
+
+// Open the query control file for writing queries and reading their answers.
+func openQueryFile() (*os.File, error) {
+	return os.OpenFile(path.Join(controlDir(), inode.QueryFile), os.O_RDWR, 0)
+}
+
+// Write the metadata query to the open query control file and return the
+// answer read back after it, reading chunk bytes at a time.
+func query(f *os.File, q string, chunk int) (string, error) {
+	if _, err := f.WriteString(q + "\n"); err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	buf := make([]byte, chunk)
+	for {
+		n, err := f.Read(buf)
+		b.Write(buf[:n])
+		if err == io.EOF {
+			return b.String(), nil
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+}
+
+////////////////////////////////////////////////////////////////////////
+// Tests
+////////////////////////////////////////////////////////////////////////
+
+func (t *ControlFileTest) ObjectInfo() {
+	AssertEq(nil, t.createObjects(map[string]string{"dir/": "", "dir/foo": "taco"}))
+	m := statObject("dir/foo")
+
+	info, err := objectInfo("dir/foo")
+
+	AssertEq(nil, err)
+	ExpectEq(
+		fmt.Sprintf("name=dir/foo\ngeneration=%d\nmetageneration=%d\nversion=%d.%d\n",
+			m.Generation, m.MetaGeneration, m.Generation, m.MetaGeneration),
+		info)
+}
+
+func (t *ControlFileTest) OverwriteChangesGeneration() {
+	AssertEq(nil, t.createWithContents("foo", "taco"))
+	before, err := objectInfo("foo")
+	AssertEq(nil, err)
+
+	AssertEq(nil, os.WriteFile(path.Join(mntDir, "foo"), []byte("burrito"), 0600))
+
+	after, err := objectInfo("foo")
+	AssertEq(nil, err)
+	ExpectNe(before, after)
+	ExpectThat(after, HasSubstr(fmt.Sprintf("\ngeneration=%d\n", statObject("foo").Generation)))
+}
+
+func (t *ControlFileTest) DirtyFileHasNoGeneration() {
+	f, err := os.Create(path.Join(mntDir, "foo"))
+	AssertEq(nil, err)
+	defer f.Close()
+
+	info, err := objectInfo("foo")
+
+	AssertEq(nil, err)
+	ExpectEq("name=foo\n", info)
+}
+
+func (t *ControlFileTest) Directory() {
+	AssertEq(nil, t.createObjects(map[string]string{"dir/": "", "dir/foo": "taco"}))
+
+	info, err := objectInfo("/dir/")
+
+	AssertEq(nil, err)
+	ExpectEq("name=dir/\n", info)
+}
+
+func (t *ControlFileTest) MissingObject() {
+	_, err := objectInfo("dir/foo")
+
+	ExpectTrue(errors.Is(err, syscall.ENOENT), "%v", err)
+}
+
+func (t *ControlFileTest) PathThroughFile() {
+	AssertEq(nil, t.createWithContents("foo", "taco"))
+
+	_, err := objectInfo("foo/bar")
+
+	ExpectTrue(errors.Is(err, syscall.ENOTDIR), "%v", err)
+}
+
+func (t *ControlFileTest) MalformedQuery() {
+	for _, name := range []string{
+		inode.ObjectInfoFile,
+		inode.ObjectInfoFile + "?name=foo",
+		inode.ObjectInfoFile + "?path=foo&path=bar",
+		inode.ObjectInfoFile + "?path=foo&taco=1",
+		inode.ObjectInfoFile + "?path=%zz",
+	} {
+		_, err := os.Stat(path.Join(controlDir(), name))
+		ExpectTrue(errors.Is(err, syscall.EINVAL), "%s: %v", name, err)
+	}
+}
+
+func (t *ControlFileTest) UnknownControlFile() {
+	_, err := os.Stat(path.Join(controlDir(), "taco?path=foo"))
+
+	ExpectTrue(errors.Is(err, syscall.ENOENT), "%v", err)
+}
+
+func (t *ControlFileTest) ControlDirIsNotListed() {
+	AssertEq(nil, t.createWithContents("foo", "taco"))
+
+	entries, err := os.ReadDir(mntDir)
+	AssertEq(nil, err)
+	AssertEq(1, len(entries))
+	ExpectEq("foo", entries[0].Name())
+
+	fi, err := os.Stat(controlDir())
+	AssertEq(nil, err)
+	ExpectTrue(fi.IsDir())
+	entries, err = os.ReadDir(controlDir())
+	AssertEq(nil, err)
+	ExpectEq(0, len(entries))
+}
+
+func (t *ControlFileTest) ControlFilesAreReadOnly() {
+	AssertEq(nil, t.createWithContents("foo", "taco"))
+
+	_, err := os.OpenFile(objectInfoPath("foo"), os.O_WRONLY, 0)
+	ExpectTrue(errors.Is(err, syscall.EACCES), "%v", err)
+
+	err = os.Remove(objectInfoPath("foo"))
+	ExpectTrue(errors.Is(err, syscall.EPERM), "%v", err)
+
+	err = os.Rename(objectInfoPath("foo"), path.Join(mntDir, "bar"))
+	ExpectTrue(errors.Is(err, syscall.EPERM), "%v", err)
+}
+
+func (t *ControlFileTest) ControlDirCannotBeModified() {
+	_, err := os.Create(path.Join(controlDir(), "foo"))
+	ExpectTrue(errors.Is(err, syscall.EPERM), "%v", err)
+
+	err = os.Mkdir(path.Join(controlDir(), "dir"), 0700)
+	ExpectTrue(errors.Is(err, syscall.EPERM), "%v", err)
+
+	err = os.Remove(controlDir())
+	ExpectTrue(errors.Is(err, syscall.EPERM), "%v", err)
+
+	err = os.Rename(controlDir(), path.Join(mntDir, "dir"))
+	ExpectTrue(errors.Is(err, syscall.EPERM), "%v", err)
+
+	// os.Rename refuses to replace a directory itself.
+	AssertEq(nil, os.Mkdir(path.Join(mntDir, "dir"), 0700))
+	err = syscall.Rename(path.Join(mntDir, "dir"), controlDir())
+	ExpectTrue(errors.Is(err, syscall.EPERM), "%v", err)
+}
+
+func (t *ControlFileTest) QueryFileDisabled() {
+	_, err := openQueryFile()
+
+	ExpectTrue(errors.Is(err, syscall.ENOENT), "%v", err)
+}
+
+func (t *QueryFileTest) QueryFileIsListed() {
+	entries, err := os.ReadDir(controlDir())
+
+	AssertEq(nil, err)
+	AssertEq(1, len(entries))
+	ExpectEq(inode.QueryFile, entries[0].Name())
+	ExpectTrue(entries[0].Type().IsRegular())
+}
+
+func (t *QueryFileTest) Matches() {
+	AssertEq(nil, createObjectsWithMetadata(map[string]map[string]string{
+		"dir/":      nil,
+		"dir/a":     {"label": "cat"},
+		"dir/sub/":  nil,
+		"dir/sub/b": {"label": "cat", "source": "cam"},
+	}))
+	f, err := openQueryFile()
+	AssertEq(nil, err)
+	defer f.Close()
+
+	answer, err := query(f, "prefix=dir&key=label&value=cat", 4096)
+	AssertEq(nil, err)
+	ExpectEq("dir/a\ndir/sub/b\n", answer)
+
+	// The handle answers query after query.
+	answer, err = query(f, "prefix=dir%2Fsub&key=source", 4096)
+	AssertEq(nil, err)
+	ExpectEq("dir/sub/b\n", answer)
+
+	answer, err = query(f, "prefix=dir&key=label&value=dog", 4096)
+	AssertEq(nil, err)
+	ExpectEq("", answer)
+}
+
+func (t *QueryFileTest) Pagination() {
+	AssertEq(nil, createObjectsWithMetadata(map[string]map[string]string{
+		"some_rather_long_name_a": {"label": "cat"},
+		"some_rather_long_name_b": {"label": "cat"},
+		"some_rather_long_name_c": {"label": "cat"},
+	}))
+	f, err := openQueryFile()
+	AssertEq(nil, err)
+	defer f.Close()
+
+	answer, err := query(f, "key=label", 5)
+
+	AssertEq(nil, err)
+	ExpectEq("some_rather_long_name_a\nsome_rather_long_name_b\nsome_rather_long_name_c\n", answer)
+}
+
+func (t *QueryFileTest) TruncatedMarker() {
+	// Only the first four objects are scanned.
+	AssertEq(nil, createObjectsWithMetadata(map[string]map[string]string{
+		"a": {"label": "cat"},
+		"b": nil,
+		"c": {"label": "cat"},
+		"d": nil,
+		"e": {"label": "cat"},
+	}))
+	f, err := openQueryFile()
+	AssertEq(nil, err)
+	defer f.Close()
+
+	answer, err := query(f, "key=label&value=cat", 4096)
+
+	AssertEq(nil, err)
+	ExpectEq("a\nc\n\n", answer)
+}
+
+func (t *QueryFileTest) ConcurrentQueries() {
+	objs := map[string]map[string]string{}
+	for _, dir := range []string{"a", "b", "c", "d"} {
+		objs[dir+"/"] = nil
+		objs[dir+"/cat"] = map[string]string{"label": "cat"}
+		objs[dir+"/dog"] = map[string]string{"label": "dog"}
+	}
+	AssertEq(nil, createObjectsWithMetadata(objs))
+
+	// Query every directory for both labels at once, each through a handle of
+	// its own.
+	type result struct {
+		answer string
+		err    error
+	}
+	results := make(map[string]*result)
+	var wg sync.WaitGroup
+	for _, dir := range []string{"a", "b", "c", "d"} {
+		for _, label := range []string{"cat", "dog"} {
+			r := &result{}
+			results[path.Join(dir, label)] = r
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				f, err := openQueryFile()
+				if err != nil {
+					r.err = err
+					return
+				}
+				defer f.Close()
+				r.answer, r.err = query(f, "prefix="+dir+"&key=label&value="+label, 4096)
+			}()
+		}
+	}
+	wg.Wait()
+
+	for name, r := range results {
+		AssertEq(nil, r.err, "%s", name)
+		ExpectEq(name+"\n", r.answer, "%s", name)
+	}
+}
+
+func (t *QueryFileTest) MalformedQuery() {
+	AssertEq(nil, createObjectsWithMetadata(map[string]map[string]string{
+		"a": {"label": "cat"},
+	}))
+	f, err := openQueryFile()
+	AssertEq(nil, err)
+	defer f.Close()
+
+	_, err = query(f, "label=cat", 4096)
+	ExpectTrue(errors.Is(err, syscall.EINVAL), "%v", err)
+
+	// The malformed query is left unanswered, and the next one is answered.
+	answer, err := query(f, "key=label", 4096)
+	AssertEq(nil, err)
+	ExpectEq("a\n", answer)
+
+	buf := make([]byte, 4096)
+	n, err := f.ReadAt(buf, 0)
+	AssertEq(io.EOF, err)
+	ExpectEq("label=cat\nkey=label\na\n", string(buf[:n]))
+}
+
+func (t *QueryFileTest) PrefixNotADirectory() {
+	AssertEq(nil, t.createWithContents("foo", "taco"))
+	f, err := openQueryFile()
+	AssertEq(nil, err)
+	defer f.Close()
+
+	_, err = query(f, "prefix=foo&key=label", 4096)
+	ExpectTrue(errors.Is(err, syscall.ENOTDIR), "%v", err)
+
+	_, err = query(f, "prefix=bar&key=label", 4096)
+	ExpectTrue(errors.Is(err, syscall.ENOENT), "%v", err)
+}
+
+func (t *QueryFileTest) QueryTooLong() {
+	f, err := openQueryFile()
+	AssertEq(nil, err)
+	defer f.Close()
+
+	_, err = f.WriteString("key=" + strings.Repeat("a", 5000))
+
+	ExpectTrue(errors.Is(err, syscall.EFBIG), "%v", err)
+}
@@ -0,0 +1,221 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Tests for copy_file_range(2), which copies whole files server-side.
+
+package fs_test
+
+import (
+	"bytes"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	. "github.com/jacobsa/ogletest"
+	"github.com/jacobsa/timeutil"
+	"golang.org/x/sys/unix"
+)
+
+////////////////////////////////////////////////////////////////////////
+// Boilerplate
+////////////////////////////////////////////////////////////////////////
+
+var copyCounter *fake.CountingBucket
+
+type CopyFileRangeTest struct {
+	fsTest
+	contents []byte
+}
+
+func init() { RegisterTestSuite(&CopyFileRangeTest{}) }
+
+func (t *CopyFileRangeTest) SetUpTestSuite() {
+	copyCounter = fake.NewCountingBucket(fake.NewFakeBucket(timeutil.RealClock(), "some_bucket"))
+	bucket = copyCounter
+	t.fsTest.SetUpTestSuite()
+}
+
+func (t *CopyFileRangeTest) SetUp(ti *TestInfo) {
+	t.contents = make([]byte, 1<<20)
+	rand.Read(t.contents)
+	AssertEq(nil, t.createWithContents("src", string(t.contents)))
+	copyCounter.Reset()
+}
+
+// Copy from the file with the given name to the other with copy_file_range(2),
+// asking for more than the source holds, and return the number of bytes
+// copied. The destination is opened with the supplied flags.
+func copyFileRange(
+	src string,
+	srcOffset int64,
+	dst string,
+	dstFlags int,
+	dstOffset int64) (n int, err error) {
+	in, err := os.Open(path.Join(mntDir, src))
+	if err != nil {
+		return
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(path.Join(mntDir, dst), dstFlags, 0600)
+	if err != nil {
+		return
+	}
+	defer func() {
+		if closeErr := out.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+
+	return unix.CopyFileRange(int(in.Fd()), &srcOffset, int(out.Fd()), &dstOffset, 1<<30, 0)
+}
+
+// Expect the object with the given name to have the same checksums as src.
+func expectCopyOfSrc(name string) {
+	stat := func(name string) (*gcs.MinObject, *gcs.ExtendedObjectAttributes) {
+		m, e, err := bucket.StatObject(ctx, &gcs.StatObjectRequest{
+			Name:                           name,
+			ForceFetchFromGcs:              true,
+			ReturnExtendedObjectAttributes: true,
+		})
+		AssertEq(nil, err)
+		return m, e
+	}
+
+	src, srcExt := stat("src")
+	dst, dstExt := stat(name)
+	ExpectEq(src.Size, dst.Size)
+	ExpectEq(*src.CRC32C, *dst.CRC32C)
+	ExpectEq(*srcExt.MD5, *dstExt.MD5)
+}
+
+////////////////////////////////////////////////////////////////////////
+// Tests
+////////////////////////////////////////////////////////////////////////
+
+func (t *CopyFileRangeTest) CopyToNewFile() {
+	n, err := copyFileRange("src", 0, "dst", os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0)
+
+	AssertEq(nil, err)
+	ExpectEq(len(t.contents), n)
+
+	// None of the contents passed through the mount.
+	ExpectEq(0, copyCounter.Count("NewReader"))
+	ExpectEq(0, copyCounter.Count("CreateObject"))
+	ExpectEq(1, copyCounter.Count("CopyObject"))
+	expectCopyOfSrc("dst")
+
+	contents, err := os.ReadFile(path.Join(mntDir, "dst"))
+	AssertEq(nil, err)
+	ExpectTrue(bytes.Equal(t.contents, contents))
+}
+
+func (t *CopyFileRangeTest) CopyOverExistingFile() {
+	AssertEq(nil, t.createWithContents("dst", "taco"))
+	copyCounter.Reset()
+
+	n, err := copyFileRange("src", 0, "dst", os.O_WRONLY|os.O_TRUNC, 0)
+
+	// Truncating dst on open reads its old contents, but src isn't read.
+	AssertEq(nil, err)
+	ExpectEq(len(t.contents), n)
+	ExpectEq(0, copyCounter.Count("CreateObject"))
+	ExpectEq(1, copyCounter.Count("CopyObject"))
+	expectCopyOfSrc("dst")
+
+	fi, err := os.Stat(path.Join(mntDir, "dst"))
+	AssertEq(nil, err)
+	ExpectEq(len(t.contents), fi.Size())
+}
+
+func (t *CopyFileRangeTest) Cp() {
+	cmd := exec.Command(
+		"cp",
+		path.Join(mntDir, "src"),
+		path.Join(mntDir, "dst"))
+	out, err := cmd.CombinedOutput()
+	AssertEq(nil, err, "%s", out)
+
+	ExpectEq(0, copyCounter.Count("NewReader"))
+	ExpectEq(0, copyCounter.Count("CreateObject"))
+	ExpectEq(0, copyCounter.Count("ComposeObjects"))
+	ExpectEq(1, copyCounter.Count("CopyObject"))
+	expectCopyOfSrc("dst")
+}
+
+func (t *CopyFileRangeTest) CpWithoutReflink() {
+	// cp treats copy_file_range(2) as a form of reflink, so this copies the
+	// contents through the mount.
+	cmd := exec.Command(
+		"cp",
+		"--reflink=never",
+		path.Join(mntDir, "src"),
+		path.Join(mntDir, "dst"))
+	out, err := cmd.CombinedOutput()
+	AssertEq(nil, err, "%s", out)
+
+	ExpectEq(0, copyCounter.Count("CopyObject"))
+	expectCopyOfSrc("dst")
+}
+
+func (t *CopyFileRangeTest) PartialRangeIsCopiedThroughTheMount() {
+	n, err := copyFileRange("src", 1, "dst", os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0)
+
+	AssertEq(nil, err)
+	ExpectEq(len(t.contents)-1, n)
+	ExpectEq(0, copyCounter.Count("CopyObject"))
+
+	contents, err := os.ReadFile(path.Join(mntDir, "dst"))
+	AssertEq(nil, err)
+	ExpectTrue(bytes.Equal(t.contents[1:], contents))
+}
+
+func (t *CopyFileRangeTest) NonEmptyDestinationIsCopiedThroughTheMount() {
+	AssertEq(nil, t.createWithContents("dst", "taco"))
+	copyCounter.Reset()
+
+	n, err := copyFileRange("src", 0, "dst", os.O_WRONLY, 0)
+
+	AssertEq(nil, err)
+	ExpectEq(len(t.contents), n)
+	ExpectEq(0, copyCounter.Count("CopyObject"))
+
+	contents, err := os.ReadFile(path.Join(mntDir, "dst"))
+	AssertEq(nil, err)
+	ExpectTrue(bytes.Equal(t.contents, contents))
+}
+
+func (t *CopyFileRangeTest) DirtySourceIsCopiedThroughTheMount() {
+	// Modify the source without syncing it.
+	f, err := os.OpenFile(path.Join(mntDir, "src"), os.O_WRONLY, 0)
+	AssertEq(nil, err)
+	defer f.Close()
+	_, err = f.WriteAt([]byte("taco"), 0)
+	AssertEq(nil, err)
+	AssertEq(nil, f.Sync())
+
+	copyCounter.Reset()
+	n, err := copyFileRange("src", 0, "dst", os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0)
+
+	AssertEq(nil, err)
+	ExpectEq(len(t.contents), n)
+
+	contents, err := os.ReadFile(path.Join(mntDir, "dst"))
+	AssertEq(nil, err)
+	ExpectEq("taco", string(contents[:4]))
+	ExpectTrue(bytes.Equal(t.contents[4:], contents[4:]))
+}
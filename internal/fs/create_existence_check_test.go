@@ -0,0 +1,154 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Tests for write:create-existence-check, racing creates of files with
+// creates of their objects by another writer.
+
+package fs_test
+
+import (
+	"errors"
+	"os"
+	"path"
+	"syscall"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/config"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	. "github.com/jacobsa/ogletest"
+)
+
+////////////////////////////////////////////////////////////////////////
+// Common
+////////////////////////////////////////////////////////////////////////
+
+const otherWriterContents = "burrito"
+
+func createExistenceCheckConfig(check string) *config.MountConfig {
+	mountConfig := config.NewMountConfig()
+	mountConfig.WriteConfig.CreateExistenceCheck = check
+	return mountConfig
+}
+
+// Create a file exclusively and have another writer create its object before
+// it is written and closed, returning the error from closing it.
+func createRacingOtherWriter() (err error) {
+	f, err := os.OpenFile(path.Join(mntDir, "foo"), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	AssertEq(nil, err)
+
+	_, err = storageutil.CreateObject(ctx, bucket, "foo", []byte(otherWriterContents))
+	AssertEq(nil, err)
+
+	_, err = f.Write([]byte("taco"))
+	AssertEq(nil, err)
+
+	return f.Close()
+}
+
+func expectOtherWriterContents() {
+	contents, err := storageutil.ReadObject(ctx, bucket, "foo")
+	AssertEq(nil, err)
+	ExpectEq(otherWriterContents, string(contents))
+}
+
+////////////////////////////////////////////////////////////////////////
+// write:create-existence-check: none
+////////////////////////////////////////////////////////////////////////
+
+type CreateExistenceCheckNoneTest struct {
+	fsTest
+}
+
+func init() { RegisterTestSuite(&CreateExistenceCheckNoneTest{}) }
+
+func (t *CreateExistenceCheckNoneTest) SetUpTestSuite() {
+	t.serverCfg.MountConfig = createExistenceCheckConfig(config.CreateExistenceCheckNone)
+	t.fsTest.SetUpTestSuite()
+}
+
+func (t *CreateExistenceCheckNoneTest) OtherWriterWinsSilently() {
+	ExpectEq(nil, createRacingOtherWriter())
+
+	expectOtherWriterContents()
+}
+
+////////////////////////////////////////////////////////////////////////
+// write:create-existence-check: open
+////////////////////////////////////////////////////////////////////////
+
+type CreateExistenceCheckOpenTest struct {
+	fsTest
+}
+
+func init() { RegisterTestSuite(&CreateExistenceCheckOpenTest{}) }
+
+func (t *CreateExistenceCheckOpenTest) SetUpTestSuite() {
+	t.serverCfg.MountConfig = createExistenceCheckConfig(config.CreateExistenceCheckOpen)
+	t.fsTest.SetUpTestSuite()
+}
+
+func (t *CreateExistenceCheckOpenTest) ObjectCreatedBeforeOpen() {
+	_, err := storageutil.CreateObject(ctx, bucket, "foo", []byte(otherWriterContents))
+	AssertEq(nil, err)
+
+	_, err = os.OpenFile(path.Join(mntDir, "foo"), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+
+	ExpectTrue(errors.Is(err, syscall.EEXIST), "%v", err)
+	expectOtherWriterContents()
+}
+
+func (t *CreateExistenceCheckOpenTest) NoObject() {
+	f, err := os.OpenFile(path.Join(mntDir, "foo"), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	AssertEq(nil, err)
+	_, err = f.Write([]byte("taco"))
+	AssertEq(nil, err)
+	AssertEq(nil, f.Close())
+
+	contents, err := storageutil.ReadObject(ctx, bucket, "foo")
+	AssertEq(nil, err)
+	ExpectEq("taco", string(contents))
+}
+
+////////////////////////////////////////////////////////////////////////
+// write:create-existence-check: flush
+////////////////////////////////////////////////////////////////////////
+
+type CreateExistenceCheckFlushTest struct {
+	fsTest
+}
+
+func init() { RegisterTestSuite(&CreateExistenceCheckFlushTest{}) }
+
+func (t *CreateExistenceCheckFlushTest) SetUpTestSuite() {
+	t.serverCfg.MountConfig = createExistenceCheckConfig(config.CreateExistenceCheckFlush)
+	t.fsTest.SetUpTestSuite()
+}
+
+func (t *CreateExistenceCheckFlushTest) OtherWriterWins() {
+	err := createRacingOtherWriter()
+
+	ExpectTrue(errors.Is(err, syscall.EEXIST), "%v", err)
+	expectOtherWriterContents()
+}
+
+func (t *CreateExistenceCheckFlushTest) NoOtherWriter() {
+	f, err := os.OpenFile(path.Join(mntDir, "foo"), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	AssertEq(nil, err)
+	_, err = f.Write([]byte("taco"))
+	AssertEq(nil, err)
+	AssertEq(nil, f.Close())
+
+	contents, err := storageutil.ReadObject(ctx, bucket, "foo")
+	AssertEq(nil, err)
+	ExpectEq("taco", string(contents))
+}
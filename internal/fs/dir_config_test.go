@@ -0,0 +1,152 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fs_test
+
+import (
+	"os"
+	"path"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/metadata"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/config"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/gcsx"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/mount"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/caching"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	. "github.com/jacobsa/ogletest"
+	"github.com/jacobsa/timeutil"
+)
+
+////////////////////////////////////////////////////////////////////////
+// Boilerplate
+////////////////////////////////////////////////////////////////////////
+
+type DirConfigTest struct {
+	fsTest
+}
+
+func init() {
+	RegisterTestSuite(&DirConfigTest{})
+}
+
+func (t *DirConfigTest) SetUpTestSuite() {
+	// Cache stats for ttl, except where configs say otherwise.
+	dirConfigs := config.NewDirConfigs()
+	uncachedBucket = fake.NewFakeBucket(timeutil.RealClock(), "some_bucket")
+	lruCache := newLruCache(uint64(1000 * mount.AverageSizeOfPositiveStatCacheEntry))
+	bucket = caching.NewFastStatBucket(
+		metadata.SameEntryTTLs(ttl),
+		metadata.CacheControlTTL{},
+		dirConfigs,
+		metadata.NewStatCacheBucketView(lruCache, ""),
+		&cacheClock,
+		uncachedBucket)
+
+	t.serverCfg.DirConfigs = dirConfigs
+	t.serverCfg.DirTypeCacheTTLs = metadata.SameEntryTTLs(ttl)
+	t.fsTest.SetUpTestSuite()
+}
+
+func (t *DirConfigTest) SetUp(ti *TestInfo) {
+	// Make sure configs left behind by earlier tests are checked again.
+	cacheClock.AdvanceTime(gcsx.DirConfigRefreshInterval)
+}
+
+// Create objects directly in GCS, behind the back of the stat cache.
+func (t *DirConfigTest) createRemotely(contents map[string]string) {
+	for name, c := range contents {
+		_, err := storageutil.CreateObject(ctx, uncachedBucket, name, []byte(c))
+		AssertEq(nil, err)
+	}
+}
+
+// Return the size of the file at the given path in the mount.
+func (t *DirConfigTest) size(name string) int64 {
+	fi, err := os.Stat(path.Join(mntDir, name))
+	AssertEq(nil, err)
+	return fi.Size()
+}
+
+////////////////////////////////////////////////////////////////////////
+// Tests
+////////////////////////////////////////////////////////////////////////
+
+func (t *DirConfigTest) OverrideAndFallback() {
+	t.createRemotely(map[string]string{
+		"fresh/":                            "",
+		"fresh/" + config.DirConfigFileName: "metadata-cache:\n  ttl-secs: 0\n",
+		"fresh/foo":                         "taco",
+		"fresh/sub/":                        "",
+		"fresh/sub/foo":                     "taco",
+		"cached/":                           "",
+		"cached/foo":                        "taco",
+	})
+	for _, name := range []string{"fresh/foo", "fresh/sub/foo", "cached/foo"} {
+		AssertEq(len("taco"), t.size(name))
+	}
+
+	// Overwrite the objects in GCS.
+	t.createRemotely(map[string]string{
+		"fresh/foo":     "burrito",
+		"fresh/sub/foo": "burrito",
+		"cached/foo":    "burrito",
+	})
+
+	// Stats under the config aren't cached, including in directories without
+	// a config of their own. Others still are.
+	ExpectEq(len("burrito"), t.size("fresh/foo"))
+	ExpectEq(len("burrito"), t.size("fresh/sub/foo"))
+	ExpectEq(len("taco"), t.size("cached/foo"))
+}
+
+func (t *DirConfigTest) MalformedConfigIgnored() {
+	t.createRemotely(map[string]string{
+		"malformed/":                            "",
+		"malformed/" + config.DirConfigFileName: "metadata-cache:\n  ttl-secs: 0\nunknown-key: 1\n",
+		"malformed/foo":                         "taco",
+	})
+	AssertEq(len("taco"), t.size("malformed/foo"))
+
+	t.createRemotely(map[string]string{"malformed/foo": "burrito"})
+
+	ExpectEq(len("taco"), t.size("malformed/foo"))
+}
+
+func (t *DirConfigTest) RefreshedAfterConfigChanges() {
+	t.createRemotely(map[string]string{
+		"changing/":                            "",
+		"changing/" + config.DirConfigFileName: "metadata-cache:\n  ttl-secs: 0\n",
+		"changing/foo":                         "taco",
+	})
+	AssertEq(len("taco"), t.size("changing/foo"))
+
+	// Start caching under the prefix. The change isn't seen until the config is
+	// checked again.
+	t.createRemotely(map[string]string{
+		"changing/" + config.DirConfigFileName: "metadata-cache:\n  ttl-secs: 3600\n",
+		"changing/foo":                         "burrito",
+	})
+	AssertEq(len("burrito"), t.size("changing/foo"))
+
+	cacheClock.AdvanceTime(gcsx.DirConfigRefreshInterval)
+	AssertEq(len("burrito"), t.size("changing/foo"))
+
+	// From now on, stats are cached for an hour, longer than the mount's ttl.
+	t.createRemotely(map[string]string{"changing/foo": "enchilada"})
+
+	ExpectEq(len("burrito"), t.size("changing/foo"))
+	cacheClock.AdvanceTime(ttl + gcsx.DirConfigRefreshInterval)
+	ExpectEq(len("burrito"), t.size("changing/foo"))
+}
@@ -0,0 +1,143 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Tests that directory entries carry their type, so that tools relying on
+// d_type walk the file system without statting everything.
+
+package fs_test
+
+import (
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/metadata"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/fs/wrappers"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/monitor/tags"
+	. "github.com/jacobsa/oglematchers"
+	. "github.com/jacobsa/ogletest"
+	"go.opencensus.io/stats/view"
+)
+
+////////////////////////////////////////////////////////////////////////
+// Boilerplate
+////////////////////////////////////////////////////////////////////////
+
+type DirentTypeTest struct {
+	fsTest
+}
+
+func init() {
+	RegisterTestSuite(&DirentTypeTest{})
+}
+
+func (t *DirentTypeTest) SetUpTestSuite() {
+	t.serverCfg.ImplicitDirectories = true
+	// Let the kernel keep the attributes returned by lookups, so that only
+	// stats the file system can't avoid reach it.
+	t.serverCfg.InodeAttributeCacheTTLs = metadata.SameEntryTTLs(time.Minute)
+	AssertEq(nil, wrappers.EnableMonitoringViews(wrappers.MonitoringOptions{}))
+	t.fsTest.SetUpTestSuite()
+}
+
+// The structure of the implicit_dir integration tests.
+func (t *DirentTypeTest) createImplicitAndExplicitDirs() {
+	AssertEq(
+		nil,
+		t.createObjects(
+			map[string]string{
+				"implicitDirectory/fileInImplicitDir1":                        "",
+				"implicitDirectory/implicitSubDirectory/fileInImplicitDir2":   "",
+				"explicitDirectory/":                                          "",
+				"explicitDirectory/fileInExplicitDir1":                        "",
+				"explicitDirectory/fileInExplicitDir2":                        "",
+				"explicitDirectory/explicitSubDirectory/":                     "",
+				"explicitDirectory/explicitSubDirectory/fileInExplicitSubDir": "",
+				"explicitFile": "",
+			}))
+}
+
+// Return the number of GetInodeAttributes ops processed so far, as counted by
+// the fs/ops_count view.
+func getInodeAttributesCount() (n float64) {
+	rows, err := view.RetrieveData("fs/ops_count")
+	AssertEq(nil, err)
+
+	for _, row := range rows {
+		for _, tag := range row.Tags {
+			if tag.Key == tags.FSOp && tag.Value == "GetInodeAttributes" {
+				n += row.Data.(*view.SumData).Value
+			}
+		}
+	}
+	return
+}
+
+////////////////////////////////////////////////////////////////////////
+// Tests
+////////////////////////////////////////////////////////////////////////
+
+func (t *DirentTypeTest) ReadDirReportsTypes() {
+	t.createImplicitAndExplicitDirs()
+
+	entries, err := os.ReadDir(mntDir)
+	AssertEq(nil, err)
+
+	// os.DirEntry.Type comes from d_type, without a stat.
+	AssertEq(3, len(entries))
+	ExpectEq("explicitDirectory", entries[0].Name())
+	ExpectEq(fs.ModeDir, entries[0].Type())
+	ExpectEq("explicitFile", entries[1].Name())
+	ExpectEq(fs.FileMode(0), entries[1].Type())
+	ExpectEq("implicitDirectory", entries[2].Name())
+	ExpectEq(fs.ModeDir, entries[2].Type())
+
+	entries, err = os.ReadDir(path.Join(mntDir, "implicitDirectory"))
+	AssertEq(nil, err)
+
+	AssertEq(2, len(entries))
+	ExpectEq("fileInImplicitDir1", entries[0].Name())
+	ExpectEq(fs.FileMode(0), entries[0].Type())
+	ExpectEq("implicitSubDirectory", entries[1].Name())
+	ExpectEq(fs.ModeDir, entries[1].Type())
+}
+
+func (t *DirentTypeTest) FindDirectoriesWithoutStats() {
+	t.createImplicitAndExplicitDirs()
+
+	before := getInodeAttributesCount()
+	output, err := exec.Command("find", mntDir, "-type", "d").CombinedOutput()
+	AssertEq(nil, err, "%s", output)
+	after := getInodeAttributesCount()
+
+	dirs := strings.Fields(string(output))
+	sort.Strings(dirs)
+	ExpectThat(
+		dirs,
+		ElementsAre(
+			mntDir,
+			path.Join(mntDir, "explicitDirectory"),
+			path.Join(mntDir, "explicitDirectory/explicitSubDirectory"),
+			path.Join(mntDir, "implicitDirectory"),
+			path.Join(mntDir, "implicitDirectory/implicitSubDirectory"),
+		))
+
+	// At most the starting point is statted; the types of everything else
+	// come from the listings.
+	ExpectLe(after-before, 1)
+}
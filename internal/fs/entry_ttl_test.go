@@ -0,0 +1,241 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Tests for the separate ttls of files and directories, calling the file
+// system directly to see the expiration times it gives the kernel.
+
+package fs_test
+
+import (
+	"context"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/lru"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/metadata"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/config"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/fs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/mount"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/caching"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/fuseutil"
+	. "github.com/jacobsa/ogletest"
+	"github.com/jacobsa/timeutil"
+)
+
+////////////////////////////////////////////////////////////////////////
+// Boilerplate
+////////////////////////////////////////////////////////////////////////
+
+const (
+	fileEntryTTL = 5 * time.Second
+	dirEntryTTL  = time.Hour
+)
+
+type EntryTTLTest struct {
+	ctx    context.Context
+	clock  timeutil.SimulatedClock
+	bucket *fake.CountingBucket
+	fs     fuseutil.FileSystem
+
+	// The --attr-cache-ttl of the file system set up next, if any.
+	attrCacheTTL *time.Duration
+}
+
+func init() { RegisterTestSuite(&EntryTTLTest{}) }
+
+func (t *EntryTTLTest) SetUp(ti *TestInfo) {
+	t.ctx = ti.Ctx
+	t.clock.SetTime(time.Date(2015, 4, 5, 2, 15, 0, 0, time.Local))
+	t.bucket = fake.NewCountingBucket(fake.NewFakeBucket(timeutil.RealClock(), "some_bucket"))
+	AssertEq(nil, storageutil.CreateEmptyObjects(t.ctx, t.bucket, []string{"foo", "dir/"}))
+	t.setUpFileSystem(fileEntryTTL, dirEntryTTL)
+}
+
+func (t *EntryTTLTest) TearDown() {
+	t.fs.Destroy()
+}
+
+// setUpFileSystem creates the file system as with the supplied flags, with a
+// metadata cache ttl of a minute.
+func (t *EntryTTLTest) setUpFileSystem(fileEntryTTL, dirEntryTTL time.Duration) {
+	metadataTTLs, entryTTLs := mount.ResolveEntryTTLs(fileEntryTTL, dirEntryTTL, time.Minute)
+	statCache := metadata.NewStatCacheBucketView(lru.NewCache(uint64(1000*mount.AverageSizeOfPositiveStatCacheEntry)), "")
+	cachedBucket := caching.NewFastStatBucket(
+		metadataTTLs,
+		metadata.CacheControlTTL{},
+		nil,
+		statCache,
+		&t.clock,
+		t.bucket)
+
+	var err error
+	t.fs, err = fs.NewFileSystem(t.ctx, &fs.ServerConfig{
+		CacheClock: &t.clock,
+		BucketName: cachedBucket.Name(),
+		BucketManager: &fakeBucketManager{
+			buckets:         map[string]gcs.Bucket{cachedBucket.Name(): cachedBucket},
+			tmpObjectPrefix: ".gcsfuse_tmp/",
+		},
+		InodeAttributeCacheTTLs: metadataTTLs,
+		AttrCacheTTL:            t.attrCacheTTL,
+		EntryCacheTTLs:          entryTTLs,
+		DirTypeCacheTTLs:        metadataTTLs,
+		FilePerms:               filePerms,
+		DirPerms:                dirPerms,
+		SequentialReadSizeMb:    SequentialReadSizeMb,
+		MountConfig:             config.NewMountConfig(),
+	})
+	AssertEq(nil, err)
+}
+
+func (t *EntryTTLTest) lookUp(name string) fuseops.ChildInodeEntry {
+	op := &fuseops.LookUpInodeOp{Parent: fuseops.RootInodeID, Name: name}
+	AssertEq(nil, t.fs.LookUpInode(t.ctx, op))
+	return op.Entry
+}
+
+func (t *EntryTTLTest) getAttributes(in fuseops.InodeID) *fuseops.GetInodeAttributesOp {
+	op := &fuseops.GetInodeAttributesOp{Inode: in}
+	AssertEq(nil, t.fs.GetInodeAttributes(t.ctx, op))
+	return op
+}
+
+// expectExpiresIn expects the expiration to be ttl after a time between start
+// and end.
+func expectExpiresIn(expiration time.Time, ttl time.Duration, start time.Time, end time.Time) {
+	ExpectFalse(expiration.Before(start.Add(ttl)), "%v", expiration)
+	ExpectFalse(expiration.After(end.Add(ttl)), "%v", expiration)
+}
+
+////////////////////////////////////////////////////////////////////////
+// Tests
+////////////////////////////////////////////////////////////////////////
+
+func (t *EntryTTLTest) ExpirationsDifferByKind() {
+	start := time.Now()
+	file := t.lookUp("foo")
+	dir := t.lookUp("dir")
+	end := time.Now()
+
+	for _, expiration := range []time.Time{file.EntryExpiration, file.AttributesExpiration} {
+		ExpectFalse(expiration.Before(start.Add(fileEntryTTL)), "%v", expiration)
+		ExpectFalse(expiration.After(end.Add(fileEntryTTL)), "%v", expiration)
+	}
+	for _, expiration := range []time.Time{dir.EntryExpiration, dir.AttributesExpiration} {
+		ExpectFalse(expiration.Before(start.Add(dirEntryTTL)), "%v", expiration)
+		ExpectFalse(expiration.After(end.Add(dirEntryTTL)), "%v", expiration)
+	}
+}
+
+func (t *EntryTTLTest) UnsetFlagsKeepEntriesUncached() {
+	t.fs.Destroy()
+	t.setUpFileSystem(-time.Second, -time.Second)
+
+	start := time.Now()
+	file := t.lookUp("foo")
+	dir := t.lookUp("dir")
+
+	ExpectTrue(file.EntryExpiration.IsZero())
+	ExpectTrue(dir.EntryExpiration.IsZero())
+	ExpectFalse(file.AttributesExpiration.Before(start.Add(time.Minute)))
+	ExpectFalse(dir.AttributesExpiration.Before(start.Add(time.Minute)))
+}
+
+func (t *EntryTTLTest) RevalidationFollowsTheSplit() {
+	t.lookUp("foo")
+	t.lookUp("dir")
+	AssertEq(1, t.bucket.CountOf("StatObject", "foo"))
+	AssertEq(1, t.bucket.CountOf("StatObject", "dir/"))
+
+	// Only the file's records have expired, so only it's stat'd again.
+	for i := 0; i < 10; i++ {
+		t.clock.AdvanceTime(fileEntryTTL + time.Millisecond)
+		t.lookUp("foo")
+		t.lookUp("dir")
+	}
+
+	ExpectEq(11, t.bucket.CountOf("StatObject", "foo"))
+	ExpectEq(1, t.bucket.CountOf("StatObject", "dir/"))
+
+	// And the directory once its own have.
+	t.clock.AdvanceTime(dirEntryTTL)
+	t.lookUp("dir")
+
+	ExpectEq(2, t.bucket.CountOf("StatObject", "dir/"))
+}
+
+func (t *EntryTTLTest) AttrCacheTTLDoesNotShortenEntries() {
+	attrCacheTTL := time.Second
+	t.attrCacheTTL = &attrCacheTTL
+	t.fs.Destroy()
+	t.setUpFileSystem(fileEntryTTL, dirEntryTTL)
+
+	start := time.Now()
+	file := t.lookUp("foo")
+	dir := t.lookUp("dir")
+	attrs := t.getAttributes(file.Child)
+	end := time.Now()
+
+	expectExpiresIn(file.EntryExpiration, fileEntryTTL, start, end)
+	expectExpiresIn(file.AttributesExpiration, attrCacheTTL, start, end)
+	expectExpiresIn(attrs.AttributesExpiration, attrCacheTTL, start, end)
+	expectExpiresIn(dir.EntryExpiration, dirEntryTTL, start, end)
+	expectExpiresIn(dir.AttributesExpiration, attrCacheTTL, start, end)
+}
+
+func (t *EntryTTLTest) AppendedFileAttributesAreNotCached() {
+	attrCacheTTL := time.Second
+	t.attrCacheTTL = &attrCacheTTL
+	t.fs.Destroy()
+	t.setUpFileSystem(fileEntryTTL, dirEntryTTL)
+
+	create := &fuseops.CreateFileOp{Parent: fuseops.RootInodeID, Name: "log", Mode: filePerms}
+	AssertEq(nil, t.fs.CreateFile(t.ctx, create))
+
+	// Each append is seen by the next stat, whose result isn't cached, while
+	// the entry still is.
+	for i := 1; i <= 3; i++ {
+		write := &fuseops.WriteFileOp{
+			Inode:  create.Entry.Child,
+			Handle: create.Handle,
+			Offset: int64(4 * (i - 1)),
+			Data:   []byte("taco"),
+		}
+		AssertEq(nil, t.fs.WriteFile(t.ctx, write))
+
+		attrs := t.getAttributes(create.Entry.Child)
+		ExpectEq(4*i, attrs.Attributes.Size)
+		ExpectTrue(attrs.AttributesExpiration.IsZero(), "%v", attrs.AttributesExpiration)
+
+		start := time.Now()
+		entry := t.lookUp("log")
+		end := time.Now()
+		ExpectEq(4*i, entry.Attributes.Size)
+		ExpectTrue(entry.AttributesExpiration.IsZero(), "%v", entry.AttributesExpiration)
+		expectExpiresIn(entry.EntryExpiration, fileEntryTTL, start, end)
+	}
+
+	// Once flushed, the attributes are cached again.
+	flush := &fuseops.FlushFileOp{Inode: create.Entry.Child, Handle: create.Handle}
+	AssertEq(nil, t.fs.FlushFile(t.ctx, flush))
+
+	start := time.Now()
+	attrs := t.getAttributes(create.Entry.Child)
+	end := time.Now()
+	ExpectEq(12, attrs.Attributes.Size)
+	expectExpiresIn(attrs.AttributesExpiration, attrCacheTTL, start, end)
+}
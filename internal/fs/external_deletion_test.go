@@ -0,0 +1,110 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Tests of files whose objects are deleted by another writer behind a warm
+// metadata cache.
+
+package fs_test
+
+import (
+	"os"
+	"path"
+	"syscall"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	"github.com/jacobsa/fuse/fusetesting"
+	. "github.com/jacobsa/oglematchers"
+	. "github.com/jacobsa/ogletest"
+)
+
+////////////////////////////////////////////////////////////////////////
+// Boilerplate
+////////////////////////////////////////////////////////////////////////
+
+type ExternalDeletionTest struct {
+	cachingTestCommon
+	f *os.File
+}
+
+func init() {
+	RegisterTestSuite(&ExternalDeletionTest{})
+}
+
+func (t *ExternalDeletionTest) SetUp(ti *TestInfo) {
+	// Make sure nothing cached by earlier tests is left.
+	cacheClock.AdvanceTime(ttl + time.Millisecond)
+}
+
+func (t *ExternalDeletionTest) TearDown() {
+	if t.f != nil {
+		ExpectEq(nil, t.f.Close())
+	}
+
+	t.cachingTestCommon.TearDown()
+}
+
+// Create foo in GCS, open it through the file system, which caches its
+// metadata, and then delete its object behind the caches' back.
+func (t *ExternalDeletionTest) openAndDeleteRemotely() {
+	_, err := storageutil.CreateObject(ctx, uncachedBucket, "foo", []byte("taco"))
+	AssertEq(nil, err)
+
+	t.f, err = os.Open(path.Join(mntDir, "foo"))
+	AssertEq(nil, err)
+
+	err = uncachedBucket.DeleteObject(ctx, &gcs.DeleteObjectRequest{Name: "foo"})
+	AssertEq(nil, err)
+}
+
+////////////////////////////////////////////////////////////////////////
+// Tests
+////////////////////////////////////////////////////////////////////////
+
+func (t *ExternalDeletionTest) ReadFailsWithENOENT() {
+	t.openAndDeleteRemotely()
+
+	_, err := t.f.Read(make([]byte, 4))
+
+	ExpectThat(err, Error(HasSubstr(syscall.ENOENT.Error())))
+}
+
+func (t *ExternalDeletionTest) NextOpenFailsAndListingsForgetIt() {
+	t.openAndDeleteRemotely()
+	_, err := t.f.Read(make([]byte, 4))
+	AssertNe(nil, err)
+
+	// Without the deletion being noticed, the stat cache would still have the
+	// file for ttl.
+	_, err = os.Open(path.Join(mntDir, "foo"))
+	ExpectTrue(os.IsNotExist(err), "err: %v", err)
+
+	entries, err := fusetesting.ReadDirPicky(mntDir)
+	AssertEq(nil, err)
+	ExpectEq(0, len(entries))
+}
+
+func (t *ExternalDeletionTest) FstatAfterExpiryFindsIt() {
+	t.openAndDeleteRemotely()
+	cacheClock.AdvanceTime(ttl + time.Millisecond)
+
+	fi, err := t.f.Stat()
+
+	AssertEq(nil, err)
+	ExpectEq(0, fi.Sys().(*syscall.Stat_t).Nlink)
+
+	_, err = os.Open(path.Join(mntDir, "foo"))
+	ExpectTrue(os.IsNotExist(err), "err: %v", err)
+}
@@ -0,0 +1,178 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// A file system that is unmounted by another process, the way fusermount -u
+// would, must release everything it started before Join returns.
+
+package fs_test
+
+import (
+	"os"
+	"path"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/config"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/fs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/gcsx"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/perms"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage"
+	"github.com/jacobsa/fuse"
+	. "github.com/jacobsa/ogletest"
+	"github.com/jacobsa/timeutil"
+)
+
+////////////////////////////////////////////////////////////////////////
+// Goroutine tracking
+////////////////////////////////////////////////////////////////////////
+
+// gcsfuseGoroutines returns the stacks of the goroutines that are running or
+// were started by gcsfuse code, keyed by goroutine header.
+func gcsfuseGoroutines() map[string]string {
+	buf := make([]byte, 1<<20)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+
+	goroutines := make(map[string]string)
+	for _, stack := range strings.Split(string(buf), "\n\n") {
+		if !strings.Contains(stack, "gcsfuse/v2/internal/") {
+			continue
+		}
+
+		// "goroutine 17 [running]:"
+		id := strings.Fields(stack)[1]
+		goroutines[id] = stack
+	}
+	return goroutines
+}
+
+// leakedGoroutines waits for the gcsfuse goroutines that weren't running
+// before to exit, and returns the stacks of those that don't.
+func leakedGoroutines(before map[string]string) (leaked []string) {
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		leaked = nil
+		for id, stack := range gcsfuseGoroutines() {
+			if _, ok := before[id]; !ok {
+				leaked = append(leaked, stack)
+			}
+		}
+
+		if len(leaked) == 0 || time.Now().After(deadline) {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+////////////////////////////////////////////////////////////////////////
+// Boilerplate
+////////////////////////////////////////////////////////////////////////
+
+type ExternalUnmountTest struct {
+	fakeStorage storage.FakeStorage
+	cacheDir    string
+	mntDir      string
+}
+
+var _ SetUpInterface = &ExternalUnmountTest{}
+var _ TearDownInterface = &ExternalUnmountTest{}
+
+func init() { RegisterTestSuite(&ExternalUnmountTest{}) }
+
+func (t *ExternalUnmountTest) SetUp(ti *TestInfo) {
+	var err error
+	t.fakeStorage = storage.NewFakeStorage()
+
+	t.cacheDir, err = os.MkdirTemp("", "fs_test_cache")
+	AssertEq(nil, err)
+	t.mntDir, err = os.MkdirTemp("", "fs_test")
+	AssertEq(nil, err)
+}
+
+func (t *ExternalUnmountTest) TearDown() {
+	t.fakeStorage.ShutDown()
+	os.RemoveAll(t.cacheDir)
+	os.Remove(t.mntDir)
+}
+
+// mount serves the fake storage's bucket with the file cache, its scrubber
+// and background uploads enabled, so that each of them has started its
+// goroutines.
+func (t *ExternalUnmountTest) mount() (mfs *fuse.MountedFileSystem) {
+	serverCfg := &fs.ServerConfig{
+		CacheClock: timeutil.RealClock(),
+		BucketName: storage.TestBucketName,
+		BucketManager: gcsx.NewBucketManager(gcsx.BucketConfig{
+			TmpObjectPrefix: ".gcsfuse_tmp/",
+		}, t.fakeStorage.CreateStorageHandle()),
+		FilePerms:            filePerms,
+		DirPerms:             dirPerms,
+		SequentialReadSizeMb: SequentialReadSizeMb,
+		MaxParallelUploads:   maxParallelUploads,
+		MountConfig: &config.MountConfig{
+			FileCacheConfig: config.FileCacheConfig{
+				MaxSizeMB:        FileCacheSizeInMb,
+				ScrubBytesPerSec: 1 << 20,
+			},
+			CacheDir: config.CacheDir(t.cacheDir),
+		},
+	}
+
+	var err error
+	serverCfg.Uid, serverCfg.Gid, err = perms.MyUserAndGroup()
+	AssertEq(nil, err)
+
+	server, err := fs.NewServer(ctx, serverCfg)
+	AssertEq(nil, err)
+
+	mountCfg := &fuse.MountConfig{
+		FSName:    storage.TestBucketName,
+		OpContext: ctx,
+	}
+	mfs, err = fuse.Mount(t.mntDir, server, mountCfg)
+	AssertEq(nil, err)
+	return
+}
+
+////////////////////////////////////////////////////////////////////////
+// Tests
+////////////////////////////////////////////////////////////////////////
+
+func (t *ExternalUnmountTest) ReleasesEverythingBeforeJoinReturns() {
+	before := gcsfuseGoroutines()
+	mfs := t.mount()
+
+	// Read an object through the file cache and write a new one.
+	contents, err := os.ReadFile(path.Join(t.mntDir, storage.TestObjectName))
+	AssertEq(nil, err)
+	ExpectEq(storage.ContentInTestObject, string(contents))
+	err = os.WriteFile(path.Join(t.mntDir, "taco"), []byte("burrito"), filePerms)
+	AssertEq(nil, err)
+
+	// Nothing in this process asks the file system to unmount; fuse.Unmount
+	// runs fusermount -u just as another process would.
+	AssertEq(nil, fuse.Unmount(t.mntDir))
+	AssertEq(nil, mfs.Join(ctx))
+
+	leaked := leakedGoroutines(before)
+	ExpectEq(0, len(leaked), "%s", strings.Join(leaked, "\n\n"))
+}
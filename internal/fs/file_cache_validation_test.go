@@ -0,0 +1,169 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Tests for how the file cache makes sure that objects haven't changed before
+// serving them, calling the file system directly.
+
+package fs_test
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/lru"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/metadata"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/config"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/fs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/caching"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/fuseutil"
+	. "github.com/jacobsa/oglematchers"
+	. "github.com/jacobsa/ogletest"
+	"github.com/jacobsa/timeutil"
+)
+
+const fileCacheValidationTTL = time.Minute
+
+type FileCacheValidationTest struct {
+	ctx      context.Context
+	clock    timeutil.SimulatedClock
+	bucket   *fake.CountingBucket
+	fs       fuseutil.FileSystem
+	cacheDir string
+	in       fuseops.InodeID
+}
+
+func init() { RegisterTestSuite(&FileCacheValidationTest{}) }
+
+func (t *FileCacheValidationTest) SetUp(ti *TestInfo) {
+	t.ctx = ti.Ctx
+	t.clock.SetTime(time.Date(2015, 4, 5, 2, 15, 0, 0, time.Local))
+	t.bucket = fake.NewCountingBucket(fake.NewFakeBucket(timeutil.RealClock(), "some_bucket"))
+	AssertEq(nil, storageutil.CreateObjects(t.ctx, t.bucket, map[string][]byte{"foo": []byte("taco")}))
+
+	// Requests are counted by the layer logging them, under the stat cache as
+	// in a mount.
+	statCache := metadata.NewStatCacheBucketView(lru.NewCache(1<<20), "")
+	cachedBucket := caching.NewFastStatBucket(
+		metadata.SameEntryTTLs(fileCacheValidationTTL),
+		metadata.CacheControlTTL{},
+		nil,
+		statCache,
+		&t.clock,
+		storage.NewDebugBucket(t.bucket))
+
+	var err error
+	mountConfig := config.NewMountConfig()
+	t.cacheDir, err = os.MkdirTemp("", "file_cache_validation_test")
+	AssertEq(nil, err)
+	mountConfig.CacheDir = config.CacheDir(t.cacheDir)
+	mountConfig.FileCacheConfig.MaxSizeMB = 10
+	t.fs, err = fs.NewFileSystem(t.ctx, &fs.ServerConfig{
+		CacheClock: &t.clock,
+		BucketName: cachedBucket.Name(),
+		BucketManager: &fakeBucketManager{
+			buckets:         map[string]gcs.Bucket{cachedBucket.Name(): cachedBucket},
+			tmpObjectPrefix: ".gcsfuse_tmp/",
+		},
+		InodeAttributeCacheTTLs: metadata.SameEntryTTLs(fileCacheValidationTTL),
+		FilePerms:               filePerms,
+		DirPerms:                dirPerms,
+		SequentialReadSizeMb:    SequentialReadSizeMb,
+		MountConfig:             mountConfig,
+	})
+	AssertEq(nil, err)
+
+	// Look up foo, and read it into the file cache.
+	op := &fuseops.LookUpInodeOp{Parent: fuseops.RootInodeID, Name: "foo"}
+	AssertEq(nil, t.fs.LookUpInode(t.ctx, op))
+	t.in = op.Entry.Child
+	t.openAndRead()
+	AssertEq(1, t.bucket.CountOf("StatObject", "foo"))
+}
+
+func (t *FileCacheValidationTest) TearDown() {
+	t.fs.Destroy()
+	_ = os.RemoveAll(t.cacheDir)
+}
+
+// Open foo, read it twice and close it, returning the number of GCS requests
+// made by the reads.
+func (t *FileCacheValidationTest) openAndRead() int64 {
+	open := &fuseops.OpenFileOp{Inode: t.in}
+	AssertEq(nil, t.fs.OpenFile(t.ctx, open))
+
+	ctx, counter := gcs.WithRequestCounter(t.ctx)
+	for i := 0; i < 2; i++ {
+		op := &fuseops.ReadFileOp{Inode: t.in, Handle: open.Handle, Dst: make([]byte, 4)}
+		AssertEq(nil, t.fs.ReadFile(ctx, op))
+		AssertEq("taco", string(op.Dst[:op.BytesRead]))
+	}
+
+	AssertEq(nil, t.fs.ReleaseFileHandle(t.ctx, &fuseops.ReleaseFileHandleOp{Handle: open.Handle}))
+	return counter.Count()
+}
+
+////////////////////////////////////////////////////////////////////////
+// Tests
+////////////////////////////////////////////////////////////////////////
+
+func (t *FileCacheValidationTest) SecondOpenWithinTTLDoesNotStat() {
+	t.clock.AdvanceTime(fileCacheValidationTTL / 2)
+
+	ExpectEq(0, t.openAndRead())
+	ExpectEq(1, t.bucket.CountOf("StatObject", "foo"))
+}
+
+func (t *FileCacheValidationTest) LookUpWithinTTLKeepsOpensFromStatting() {
+	// The lookup is answered by the metadata cache, which confirms the
+	// generation for another ttl.
+	t.clock.AdvanceTime(fileCacheValidationTTL / 2)
+	AssertEq(nil, t.fs.LookUpInode(t.ctx, &fuseops.LookUpInodeOp{Parent: fuseops.RootInodeID, Name: "foo"}))
+	t.clock.AdvanceTime(fileCacheValidationTTL / 2)
+
+	ExpectEq(0, t.openAndRead())
+	ExpectEq(1, t.bucket.CountOf("StatObject", "foo"))
+}
+
+func (t *FileCacheValidationTest) OpenAfterTTLStatsOnce() {
+	t.clock.AdvanceTime(fileCacheValidationTTL + time.Millisecond)
+
+	// The stat is the only request, and the reads are served from the cache.
+	ExpectEq(1, t.openAndRead())
+	ExpectEq(2, t.bucket.CountOf("StatObject", "foo"))
+
+	// The stat refreshed the metadata cache, which answers for the next open.
+	ExpectEq(0, t.openAndRead())
+	ExpectEq(2, t.bucket.CountOf("StatObject", "foo"))
+}
+
+func (t *FileCacheValidationTest) OpenAfterTTLOfReplacedObjectSkipsCache() {
+	t.clock.AdvanceTime(fileCacheValidationTTL + time.Millisecond)
+	_, err := storageutil.CreateObject(t.ctx, t.bucket, "foo", []byte("burrito"))
+	AssertEq(nil, err)
+
+	// The cached generation isn't served once the stat finds it replaced. The
+	// read of it from GCS fails, as reads of clobbered objects do by default.
+	open := &fuseops.OpenFileOp{Inode: t.in}
+	AssertEq(nil, t.fs.OpenFile(t.ctx, open))
+	op := &fuseops.ReadFileOp{Inode: t.in, Handle: open.Handle, Dst: make([]byte, 7)}
+	err = t.fs.ReadFile(t.ctx, op)
+	ExpectThat(err, Error(HasSubstr("clobbered")))
+	ExpectEq(0, op.BytesRead)
+}
@@ -0,0 +1,158 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fs_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/contentcache"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	. "github.com/jacobsa/ogletest"
+	"github.com/jacobsa/timeutil"
+)
+
+////////////////////////////////////////////////////////////////////////
+// Boilerplate
+////////////////////////////////////////////////////////////////////////
+
+const (
+	flushTimeout       = 500 * time.Millisecond
+	flushRetryInterval = 100 * time.Millisecond
+)
+
+// stuckCreateBucket makes object creations hang until their context is done
+// while stuck is set, as if every attempt failed and was retried.
+type stuckCreateBucket struct {
+	gcs.Bucket
+	stuck atomic.Bool
+}
+
+func (b *stuckCreateBucket) CreateObject(
+	ctx context.Context,
+	req *gcs.CreateObjectRequest) (*gcs.Object, error) {
+	if b.stuck.Load() {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return b.Bucket.CreateObject(ctx, req)
+}
+
+var stuckBucket *stuckCreateBucket
+
+type FlushTimeoutTest struct {
+	fsTest
+	stagingDir string
+}
+
+func init() { RegisterTestSuite(&FlushTimeoutTest{}) }
+
+func (t *FlushTimeoutTest) SetUpTestSuite() {
+	var err error
+	t.stagingDir, err = os.MkdirTemp("", "flush_timeout_test")
+	AssertEq(nil, err)
+
+	stuckBucket = &stuckCreateBucket{
+		Bucket: fake.NewFakeBucket(timeutil.RealClock(), "some_bucket"),
+	}
+	bucket = stuckBucket
+	t.serverCfg.TempDir = t.stagingDir
+	t.serverCfg.FlushTimeout = flushTimeout
+	t.serverCfg.FlushRetryInterval = flushRetryInterval
+
+	t.fsTest.SetUpTestSuite()
+}
+
+func (t *FlushTimeoutTest) TearDownTestSuite() {
+	t.fsTest.TearDownTestSuite()
+	os.RemoveAll(t.stagingDir)
+}
+
+// Return the journal entries in the staging directory.
+func (t *FlushTimeoutTest) journalEntries() (entries []contentcache.StagedWriteEntry) {
+	dir := contentcache.StagedWriteDir(t.stagingDir, stuckBucket.Name(), "")
+	dirEntries, err := os.ReadDir(dir)
+	AssertEq(nil, err)
+
+	for _, e := range dirEntries {
+		if !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+
+		contents, err := os.ReadFile(path.Join(dir, e.Name()))
+		AssertEq(nil, err)
+		var entry contentcache.StagedWriteEntry
+		AssertEq(nil, json.Unmarshal(contents, &entry))
+		entries = append(entries, entry)
+	}
+	return
+}
+
+////////////////////////////////////////////////////////////////////////
+// Tests
+////////////////////////////////////////////////////////////////////////
+
+func (t *FlushTimeoutTest) CloseGivesUpAndRetries() {
+	const name = "foo"
+	stuckBucket.stuck.Store(true)
+
+	f, err := os.Create(path.Join(mntDir, name))
+	AssertEq(nil, err)
+	_, err = f.WriteString("taco")
+	AssertEq(nil, err)
+
+	// The close returns within the timeout, failing.
+	before := time.Now()
+	err = f.Close()
+
+	ExpectTrue(errors.Is(err, syscall.EIO), "err: %v", err)
+	ExpectLt(time.Since(before), 10*flushTimeout)
+
+	// The contents can be recovered from the journal.
+	entries := t.journalEntries()
+	AssertEq(1, len(entries))
+	ExpectEq(name, entries[0].ObjectName)
+	ExpectTrue(entries[0].Closed)
+	contents, err := os.ReadFile(entries[0].StagedFilePath)
+	AssertEq(nil, err)
+	ExpectEq("taco", string(contents))
+
+	// Once uploads go through again, the retries upload the contents and the
+	// staged file goes away.
+	stuckBucket.stuck.Store(false)
+	deadline := time.Now().Add(time.Minute)
+	for {
+		contents, err := storageutil.ReadObject(ctx, stuckBucket.Bucket, name)
+		if err == nil && len(t.journalEntries()) == 0 {
+			ExpectEq("taco", string(contents))
+			break
+		}
+
+		if time.Now().After(deadline) {
+			AddFailure("%q not uploaded: %v", name, err)
+			AbortTest()
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -24,27 +24,36 @@ import (
 	"os"
 	"path"
 	"reflect"
+	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/advisor"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/file"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/file/downloader"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/lru"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/metadata"
 	cacheutil "github.com/googlecloudplatform/gcsfuse/v2/internal/cache/util"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/config"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/contentcache"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/fs/handle"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/fs/inode"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/fs/wrappers"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/gcsx"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/lifecycle"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/locker"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/monitor"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/util"
 	"github.com/jacobsa/fuse"
 	"github.com/jacobsa/fuse/fuseops"
 	"github.com/jacobsa/fuse/fuseutil"
 	"github.com/jacobsa/timeutil"
+	"golang.org/x/sync/singleflight"
 )
 
 type ServerConfig struct {
@@ -59,6 +68,11 @@ type ServerConfig struct {
 	// all accessible GCS buckets are mounted as subdirectories of the FS root.
 	BucketName string
 
+	// The directory of the buckets that is mounted, as normalized by
+	// gcsx.NormalizeOnlyDir, or empty for all of it. It counts towards the
+	// length of object names.
+	OnlyDir string
+
 	// LocalFileCache
 	LocalFileCache bool
 
@@ -69,6 +83,12 @@ type ServerConfig struct {
 	// use the system default.
 	TempDir string
 
+	// If true, the file system is read-only: the ops that would change it fail
+	// with EROFS, and nothing is set up to stage or upload writes. It is also
+	// read-only if the bucket is, e.g. because its retention policy is locked;
+	// see gcsx.SyncerBucket.ReadOnly.
+	ReadOnly bool
+
 	// By default, if a bucket contains the object "foo/bar" but no object named
 	// "foo/", it's as if the directory doesn't exist. This allows us to have
 	// non-flaky name resolution code.
@@ -90,7 +110,8 @@ type ServerConfig struct {
 	// return nil immediately.
 	EnableNonexistentTypeCache bool
 
-	// How long to allow the kernel to cache inode attributes.
+	// How long to allow the kernel to cache the attributes of file and of
+	// directory inodes.
 	//
 	// Any given object generation in GCS is immutable, and a new generation
 	// results in a new inode number. So every update from a remote system results
@@ -100,15 +121,29 @@ type ServerConfig struct {
 	// The one exception to the above logic is that objects can be _deleted_, in
 	// which case stat::st_nlink changes. So choosing this value comes down to
 	// whether you care about that field being up to date.
-	InodeAttributeCacheTTL time.Duration
+	InodeAttributeCacheTTLs metadata.EntryTTLs
+
+	// If set, how long at most to allow the kernel to cache the attributes of
+	// file and of directory inodes, shorter than InodeAttributeCacheTTLs,
+	// without shortening how long it caches their entries. This way the sizes
+	// of files written elsewhere are seen sooner without names being looked up
+	// again as often.
+	AttrCacheTTL *time.Duration
+
+	// How long to allow the kernel to cache the entries of files and of
+	// directories it looks up, no longer than InodeAttributeCacheTTLs. If zero,
+	// the kernel looks the name up again on every access, which is what notices
+	// a child replaced by one of a new generation.
+	EntryCacheTTLs metadata.EntryTTLs
 
 	// If non-zero, each directory will maintain a cache from child name to
-	// information about whether that name exists as a file and/or directory.
+	// information about whether that name exists as a file and/or directory,
+	// keeping each kind for its ttl.
 	// This may speed up calls to look up and stat inodes, especially when
 	// combined with a stat-caching GCS bucket, but comes at the cost of
 	// consistency: if the child is removed and recreated with a different type
 	// before the expiration, we may fail to find it.
-	DirTypeCacheTTL time.Duration
+	DirTypeCacheTTLs metadata.EntryTTLs
 
 	// The UID and GID that owns all inodes in the file system.
 	Uid uint32
@@ -122,13 +157,140 @@ type ServerConfig struct {
 	// Allow renaming a directory containing fewer descendants than this limit.
 	RenameDirLimit int64
 
-	// File chunk size to read from GCS in one call. Specified in MB.
+	// How far past the offset read to ask GCS for in one request, when a file
+	// is read sequentially. Specified in MB.
 	SequentialReadSizeMb int32
 
+	// When to let the kernel keep its page cache for a file from one open to
+	// the next: one of config.KernelPageCacheAuto, config.KernelPageCacheAlways
+	// or config.KernelPageCacheNever. The empty string means auto.
+	KernelPageCache string
+
+	// Which times to report for directories: one of config.DirTimesMount,
+	// config.DirTimesPlaceholder or config.DirTimesNewestChild. The empty
+	// string means mount.
+	DirTimes string
+
+	// The most objects the user.gcsfuse.recursive_size and
+	// user.gcsfuse.object_count extended attributes of a directory count
+	// before failing with E2BIG. Zero disables the attributes.
+	DirSizeXattrMaxObjects int
+
+	// The most pages of the listings made for those attributes in flight at
+	// once. Less than one means one.
+	DirSizeXattrParallelism int
+
+	// The most objects the user.gcsfuse.metadata.* extended attributes of a
+	// directory scan, and for how long, before returning the matches so far.
+	// Zero MetadataQueryMaxObjects disables the attributes, and zero
+	// MetadataQueryTimeout means no time limit.
+	MetadataQueryMaxObjects int
+	MetadataQueryTimeout    time.Duration
+
+	// The content types of the empty objects that stand for the directory of
+	// the same name, as S3-compatible tools mark directories. Empty disables
+	// such markers.
+	CompatDirMarkerTypes []string
+
+	// If non-zero, writers take an advisory lock on a file by exclusively
+	// creating a sidecar lock object before the first write and deleting it on
+	// the final flush. Lock objects older than this are considered stale and
+	// are broken by the next writer.
+	LockFileTTL time.Duration
+
+	// If positive, closing a written file queues its upload instead of waiting
+	// for it, and up to this many uploads run in the background at a time.
+	// Files opened with O_SYNC and fsync(2) still wait.
+	MaxParallelUploads int
+
+	// Up to this many file objects are deleted at a time, by unlinks and by
+	// renaming a directory, which deletes the objects under the old name in
+	// parallel. Values below 1 delete one object at a time.
+	DeleteParallelism int
+
+	// Unlinking a name that the type cache or the stat cache remembers not to
+	// exist fails with ENOENT without a request to GCS, unless this is set.
+	// The caches only say so until their entries expire, after which an
+	// object created elsewhere meanwhile is deleted as usual.
+	StrictUnlink bool
+
+	// Unlinks of names the type cache knows as files return before their
+	// objects are deleted, and a failed deletion is only logged. See
+	// pendingDeletes. Ignored with StrictUnlink.
+	AsyncUnlink bool
+
+	// If non-nil, checks the plan of each directory rename before the rename
+	// starts, logging it and refusing to execute it in a dry run.
+	MutationPlanner *gcsx.MutationPlanner
+
+	// The path the file system is mounted on. Along with BucketName, it keys
+	// the directory of TempDir writes are journaled in, see
+	// contentcache.StagedWriteDir.
+	MountPoint string
+
+	// Writes are journaled in TempDir until they are uploaded. If true, writes
+	// left behind by a previous gcsfuse process to files that were closed are
+	// uploaded at mount time; otherwise a warning is logged for each of them.
+	RecoverStagedWrites bool
+
+	// If non-zero, a flush that waits for an upload gives up after this long,
+	// failing with EIO and keeping the staged file and its journal entry for
+	// recovery.
+	FlushTimeout time.Duration
+
+	// If non-zero, the uploads of flushes that timed out are retried in the
+	// background this long apart, until one succeeds or the file is flushed
+	// again.
+	FlushRetryInterval time.Duration
+
+	// If non-zero, creating and writing files fail with ENOSPC while the file
+	// system holding TempDir has less than this many MiB free.
+	MinFreeStagingMB int
+
+	// Reads that look like page-ins, i.e. page-aligned reads of whole pages,
+	// failing with a transient error are retried up to this many times before
+	// failing, or not at all if zero. A failed page-in kills the applications that mmap
+	// the file with SIGBUS.
+	MmapReadRetries int
+
+	// If true, ranges that an object's metadata describes as holding only zeros
+	// are served without reading them from GCS. See gcsx.ZeroExtentsMetadataKey.
+	EnableZeroExtentHints bool
+
+	// If true, atimes set on files are persisted to their objects' metadata and
+	// reported. Otherwise they are ignored, as with noatime, and a file's atime
+	// is its mtime.
+	PreserveAtime bool
+
+	// How long times set on a file whose contents are in GCS are held back, so
+	// that those set meanwhile are written to the object in a single update.
+	// Zero writes each of them right away.
+	TimesUpdateDelay time.Duration
+
+	// The number of operations processed at a time, or zero for as many as the
+	// kernel sends.
+	FuseParallelism int
+
+	// The measures of file system operations recorded. Their views are only
+	// registered by wrappers.EnableMonitoringViews.
+	MonitoringOptions wrappers.MonitoringOptions
+
+	// If non-nil, config.DirConfigFileName objects are loaded into DirConfigs
+	// as their prefixes are accessed, and override the metadata ttls, file
+	// cache admission and sequential read size for the objects under them.
+	DirConfigs *config.DirConfigs
+
 	// MountConfig has all the config specified by the user using configFile flag.
 	MountConfig *config.MountConfig
 }
 
+// How often staged files that no inode refers to any longer are looked for,
+// and how old they must be to be removed.
+const (
+	stagedFileSweepPeriod = 10 * time.Minute
+	stagedFileSweepMinAge = time.Hour
+)
+
 // Create a fuse file system server according to the supplied configuration.
 func NewFileSystem(
 	ctx context.Context,
@@ -142,6 +304,22 @@ func NewFileSystem(
 		return nil, fmt.Errorf("Illegal dir perms: %v", cfg.FilePerms)
 	}
 
+	// The bucket is set up first, to know whether it is read-only. Staged
+	// writes can only be uploaded when the bucket is known up front.
+	var syncerBucket gcsx.SyncerBucket
+	allBuckets := cfg.BucketName == "" || cfg.BucketName == "_"
+	readOnly := cfg.ReadOnly
+	if !allBuckets {
+		var err error
+		syncerBucket, err = cfg.BucketManager.SetUpBucket(ctx, cfg.BucketName, false)
+		lifecycle.Publish(lifecycle.BucketProbed, err)
+		if err != nil {
+			return nil, fmt.Errorf("SetUpBucket: %w", err)
+		}
+		readOnly = readOnly || syncerBucket.ReadOnly
+	}
+	monitor.CaptureMountModeMetrics(ctx, readOnly)
+
 	mtimeClock := timeutil.RealClock()
 
 	contentCache := contentcache.New(cfg.TempDir, mtimeClock)
@@ -154,6 +332,15 @@ func NewFileSystem(
 		}
 	}
 
+	// Writes staged in the local file cache are recovered along with it, so
+	// only journal the others. Read-only file systems stage no writes.
+	stageWrites := !cfg.LocalFileCache && !readOnly
+	if stageWrites {
+		if err := contentCache.EnableStagedWriteJournal(cfg.BucketName, cfg.MountPoint); err != nil {
+			return nil, err
+		}
+	}
+
 	// Create file cache handler if cache is enabled by user. Cache is considered
 	// enabled only if cache-dir is not empty and file-cache:max-size-mb is non 0.
 	var fileCacheHandler *file.CacheHandler
@@ -170,13 +357,29 @@ func NewFileSystem(
 		mtimeClock:                 mtimeClock,
 		cacheClock:                 cfg.CacheClock,
 		bucketManager:              cfg.BucketManager,
+		objectNamePrefix:           onlyDirPrefix(cfg.OnlyDir),
 		localFileCache:             cfg.LocalFileCache,
 		contentCache:               contentCache,
 		implicitDirs:               cfg.ImplicitDirectories,
 		enableNonexistentTypeCache: cfg.EnableNonexistentTypeCache,
-		inodeAttributeCacheTTL:     cfg.InodeAttributeCacheTTL,
-		dirTypeCacheTTL:            cfg.DirTypeCacheTTL,
+		inodeAttributeCacheTTLs:    cfg.InodeAttributeCacheTTLs,
+		attrCacheTTL:               cfg.AttrCacheTTL,
+		entryCacheTTLs:             cfg.EntryCacheTTLs,
+		cacheControlTTL:            metadata.NewCacheControlTTL(cfg.MountConfig.MetadataCacheConfig),
+		dirTypeCacheTTLs:           cfg.DirTypeCacheTTLs,
 		kernelListCacheTTL:         config.ListCacheTtlSecsToDuration(cfg.MountConfig.KernelListCacheTtlSeconds),
+		kernelPageCache:            cfg.KernelPageCache,
+		dirTimes:                   cfg.DirTimes,
+		dirSizeXattrMaxObjects:     cfg.DirSizeXattrMaxObjects,
+		dirSizeXattrParallelism:    max(cfg.DirSizeXattrParallelism, 1),
+		metadataQueryMaxObjects:    cfg.MetadataQueryMaxObjects,
+		metadataQueryTimeout:       cfg.MetadataQueryTimeout,
+		compatDirMarkerTypes:       cfg.CompatDirMarkerTypes,
+		lockFileTTL:                cfg.LockFileTTL,
+		flushTimeout:               cfg.FlushTimeout,
+		flushRetryInterval:         cfg.FlushRetryInterval,
+		preserveAtime:              cfg.PreserveAtime,
+		timesUpdateDelay:           cfg.TimesUpdateDelay,
 		renameDirLimit:             cfg.RenameDirLimit,
 		sequentialReadSizeMb:       cfg.SequentialReadSizeMb,
 		uid:                        cfg.Uid,
@@ -188,24 +391,62 @@ func NewFileSystem(
 		generationBackedInodes:     make(map[inode.Name]inode.GenerationBackedInode),
 		implicitDirInodes:          make(map[inode.Name]inode.DirInode),
 		localFileInodes:            make(map[inode.Name]inode.Inode),
+		controlInodes:              make(map[inode.Name]inode.Inode),
 		handles:                    make(map[fuseops.HandleID]interface{}),
 		mountConfig:                cfg.MountConfig,
 		fileCacheHandler:           fileCacheHandler,
 		cacheFileForRangeRead:      cfg.MountConfig.FileCacheConfig.CacheFileForRangeRead,
+		zeroExtentHints:            cfg.EnableZeroExtentHints,
+		patternDetector:            newPatternDetector(cfg.MountConfig),
+	}
+
+	if cfg.DirConfigs != nil {
+		fs.dirConfigs = cfg.DirConfigs
+		fs.dirConfigLoader = gcsx.NewDirConfigLoader(cfg.DirConfigs, cfg.CacheClock)
 	}
 
 	// Set up root bucket
 	var root inode.DirInode
-	if cfg.BucketName == "" || cfg.BucketName == "_" {
+	if !readOnly {
+		fs.stagingSpace = newStagingSpace(cfg.TempDir, cfg.MinFreeStagingMB, cfg.CacheClock)
+		if cfg.MaxParallelUploads > 0 {
+			fs.uploadManager = gcsx.NewUploadManager(cfg.MaxParallelUploads)
+		}
+	}
+	fs.deleter = gcsx.NewDeleter(max(cfg.DeleteParallelism, 1))
+	fs.pendingDeletes = newPendingDeletes()
+	fs.strictUnlink = cfg.StrictUnlink
+	fs.asyncUnlink = cfg.AsyncUnlink && !cfg.StrictUnlink
+	fs.mutationPlanner = cfg.MutationPlanner
+	fs.mmapReadRetries = cfg.MmapReadRetries
+	fs.flushRetryCtx, fs.stopFlushRetries = context.WithCancel(context.Background())
+
+	if fs.kernelPageCache == "" {
+		fs.kernelPageCache = config.DefaultKernelPageCache
+	}
+
+	if fs.dirTimes == "" {
+		fs.dirTimes = config.DefaultDirTimes
+	}
+
+	var recoveryBucket gcs.Bucket
+	if allBuckets {
 		logger.Info("Set up root directory for all accessible buckets")
 		root = makeRootForAllBuckets(fs)
 	} else {
 		logger.Info("Set up root directory for bucket " + cfg.BucketName)
-		syncerBucket, err := fs.bucketManager.SetUpBucket(ctx, cfg.BucketName, false)
-		if err != nil {
-			return nil, fmt.Errorf("SetUpBucket: %w", err)
-		}
 		root = makeRootForBucket(ctx, fs, syncerBucket)
+		recoveryBucket = syncerBucket
+	}
+
+	if stageWrites {
+		if err := contentCache.RecoverStagedWrites(ctx, recoveryBucket, cfg.RecoverStagedWrites); err != nil {
+			logger.Warnf("Encountered error looking for staged writes left by a previous gcsfuse process: %v", err)
+		}
+
+		var sweepCtx context.Context
+		sweepCtx, fs.stopSweepingStagedFiles = context.WithCancel(context.Background())
+		go contentCache.SweepStagedFilesPeriodically(sweepCtx, stagedFileSweepPeriod, stagedFileSweepMinAge)
 	}
 	root.Lock()
 	root.IncrementLookupCount()
@@ -215,9 +456,29 @@ func NewFileSystem(
 
 	// Set up invariant checking.
 	fs.mu = locker.New("FS", fs.checkInvariants)
+
+	if readOnly {
+		logger.Infof("The file system is read-only")
+		return wrappers.WithReadOnly(fs), nil
+	}
 	return fs, nil
 }
 
+// newPatternDetector returns a detector of the access patterns served poorly
+// by a mount with the given config.
+func newPatternDetector(mountConfig *config.MountConfig) *advisor.Detector {
+	var disabled []advisor.Pattern
+	for _, p := range mountConfig.AdvisoryConfig.DisabledAdvisories {
+		disabled = append(disabled, advisor.Pattern(p))
+	}
+
+	return advisor.NewDetector(advisor.Config{
+		FileCacheEnabled:      config.IsFileCacheEnabled(mountConfig),
+		CacheFileForRangeRead: mountConfig.FileCacheConfig.CacheFileForRangeRead,
+		Disabled:              disabled,
+	})
+}
+
 func createFileCacheHandler(cfg *ServerConfig) (fileCacheHandler *file.CacheHandler, err error) {
 	var sizeInBytes uint64
 	// -1 means unlimited size for cache, the underlying LRU cache doesn't handle
@@ -229,24 +490,76 @@ func createFileCacheHandler(cfg *ServerConfig) (fileCacheHandler *file.CacheHand
 	}
 	fileInfoCache := lru.NewCache(sizeInBytes)
 
-	cacheDir := string(cfg.MountConfig.CacheDir)
-	// Adding a new directory inside cacheDir to keep file-cache separate from
-	// metadata cache if and when we support storing metadata cache on disk in
-	// the future.
-	cacheDir = path.Join(cacheDir, cacheutil.FileCache)
+	cacheDirSpecs := cfg.MountConfig.CacheDirs
+	if len(cacheDirSpecs) == 0 {
+		cacheDirSpecs = []config.CacheDirSpec{{Path: cfg.MountConfig.CacheDir, Weight: 1}}
+	}
 
 	filePerm := cacheutil.DefaultFilePerm
 	dirPerm := cacheutil.DefaultDirPerm
 
-	cacheDirErr := cacheutil.CreateCacheDirectoryIfNotPresentAt(cacheDir, dirPerm)
-	if cacheDirErr != nil {
-		return nil, fmt.Errorf("createFileCacheHandler: while creating file cache directory: %w", cacheDirErr)
+	readOnly := cfg.MountConfig.FileCacheConfig.ReadOnly
+	var cacheDirs []file.CacheDir
+	for _, spec := range cacheDirSpecs {
+		// Adding a new directory inside cacheDir to keep file-cache separate from
+		// metadata cache if and when we support storing metadata cache on disk in
+		// the future.
+		cacheDir := path.Join(string(spec.Path), cacheutil.FileCache)
+
+		if !readOnly {
+			cacheDirErr := cacheutil.CreateCacheDirectoryIfNotPresentAt(cacheDir, dirPerm)
+			switch {
+			case errors.Is(cacheDirErr, syscall.EROFS) || errors.Is(cacheDirErr, syscall.EACCES):
+				// Read the files already in the cache, without writing to it.
+				logger.Warnf("createFileCacheHandler: using the file cache read-only: %v", cacheDirErr)
+				readOnly = true
+			case cacheDirErr != nil:
+				return nil, fmt.Errorf("createFileCacheHandler: while creating file cache directory: %w", cacheDirErr)
+			}
+		}
+		cacheDirs = append(cacheDirs, file.CacheDir{Path: cacheDir, Weight: spec.Weight})
 	}
 
-	jobManager := downloader.NewJobManager(fileInfoCache, filePerm, dirPerm, cacheDir,
+	jobManager := downloader.NewJobManager(fileInfoCache, filePerm, dirPerm, cacheDirs[0].Path,
 		cfg.SequentialReadSizeMb)
-	fileCacheHandler = file.NewCacheHandler(fileInfoCache, jobManager,
-		cacheDir, filePerm, dirPerm)
+	fileCacheHandler = file.NewCacheHandlerWithDirs(fileInfoCache, jobManager,
+		cacheDirs, filePerm, dirPerm)
+	// Like max-size-mb, -1 means no limit.
+	if maxSupersededSizeMB := cfg.MountConfig.FileCacheConfig.MaxSupersededSizeMB; maxSupersededSizeMB == -1 {
+		fileCacheHandler.SetMaxSupersededSize(math.MaxUint64)
+	} else {
+		fileCacheHandler.SetMaxSupersededSize(uint64(maxSupersededSizeMB) * cacheutil.MiB)
+	}
+	if prefixes := cfg.MountConfig.FileCacheConfig.PinnedPrefixes; len(prefixes) > 0 {
+		// -1 leaves the pinned files capped by the size of the cache only.
+		maxPinnedSize := uint64(math.MaxUint64)
+		if pinnedMaxSizeMB := cfg.MountConfig.FileCacheConfig.PinnedMaxSizeMB; pinnedMaxSizeMB != -1 {
+			maxPinnedSize = uint64(pinnedMaxSizeMB) * cacheutil.MiB
+		}
+		fileCacheHandler.SetPinnedPrefixes(prefixes, maxPinnedSize)
+	}
+
+	if readOnly {
+		fileCacheHandler.EnableReadOnly()
+		return
+	}
+
+	if cfg.MountConfig.FileCacheConfig.Shared {
+		err = fileCacheHandler.EnableSharing()
+		if err != nil {
+			return nil, fmt.Errorf("createFileCacheHandler: while sharing the file cache: %w", err)
+		}
+	}
+
+	// Earlier versions of gcsfuse laid the files out flat.
+	fileCacheHandler.MigrateLayout()
+
+	if fileCacheConfig := cfg.MountConfig.FileCacheConfig; fileCacheConfig.ScrubBytesPerSec > 0 {
+		fileCacheHandler.StartScrubber(file.ScrubberConfig{
+			BytesPerSecond:   fileCacheConfig.ScrubBytesPerSec,
+			MaxHitsPerSecond: fileCacheConfig.ScrubPauseHitsPerSec,
+		})
+	}
 	return
 }
 
@@ -270,11 +583,13 @@ func makeRootForBucket(
 		fs.implicitDirs,
 		fs.mountConfig.ListConfig.EnableEmptyManagedFolders,
 		fs.enableNonexistentTypeCache,
-		fs.dirTypeCacheTTL,
+		fs.dirTypeCacheTTLs,
 		&syncerBucket,
 		fs.mtimeClock,
 		fs.cacheClock,
 		fs.mountConfig.MetadataCacheConfig.TypeCacheMaxSizeMB,
+		fs.dirTimes,
+		fs.compatDirMarkerTypes,
 	)
 }
 
@@ -337,18 +652,101 @@ type fileSystem struct {
 	// Constant data
 	/////////////////////////
 
+	// What the buckets prepend to the names of objects, for --only-dir.
+	objectNamePrefix string
+
 	localFileCache             bool
 	contentCache               *contentcache.ContentCache
 	implicitDirs               bool
 	enableNonexistentTypeCache bool
-	inodeAttributeCacheTTL     time.Duration
-	dirTypeCacheTTL            time.Duration
+	inodeAttributeCacheTTLs    metadata.EntryTTLs
+	attrCacheTTL               *time.Duration
+	entryCacheTTLs             metadata.EntryTTLs
+	dirTypeCacheTTLs           metadata.EntryTTLs
+
+	// Overrides inodeAttributeCacheTTLs for file inodes whose object has
+	// Cache-Control metadata. This also decides how often the kernel
+	// revalidates a cached file, since it does so when the attributes expire.
+	cacheControlTTL metadata.CacheControlTTL
 
 	// kernelListCacheTTL specifies the duration to keep the readdir response cached
 	// in kernel. After ttl, gcsfuse, (filesystem) on next opendir call (just before as part
 	// of next list call) from user, asks the kernel to evict the old cache entries.
 	kernelListCacheTTL time.Duration
 
+	// kernelPageCache is one of config.KernelPageCacheAuto,
+	// config.KernelPageCacheAlways and config.KernelPageCacheNever.
+	kernelPageCache string
+
+	// dirTimes is one of config.DirTimesMount, config.DirTimesPlaceholder and
+	// config.DirTimesNewestChild.
+	dirTimes string
+
+	// See ServerConfig.DirSizeXattrMaxObjects and DirSizeXattrParallelism.
+	dirSizeXattrMaxObjects  int
+	dirSizeXattrParallelism int
+
+	// See ServerConfig.MetadataQueryMaxObjects and MetadataQueryTimeout.
+	metadataQueryMaxObjects int
+	metadataQueryTimeout    time.Duration
+
+	// See ServerConfig.CompatDirMarkerTypes.
+	compatDirMarkerTypes []string
+
+	// lockFileTTL is the lifetime of lock objects, or zero if advisory locking
+	// via lock objects is disabled.
+	lockFileTTL time.Duration
+
+	// See ServerConfig.PreserveAtime.
+	preserveAtime bool
+
+	// See ServerConfig.TimesUpdateDelay.
+	timesUpdateDelay time.Duration
+
+	// uploadManager runs the uploads of closed files in the background. It is
+	// nil when uploads run inline.
+	uploadManager *gcsx.UploadManager
+
+	// deleter deletes the objects of unlinked files, and of renamed
+	// directories.
+	deleter *gcsx.Deleter
+
+	// pendingDeletes runs the deletions of unlinked files' objects in the
+	// background.
+	pendingDeletes *pendingDeletes
+
+	// See ServerConfig.StrictUnlink.
+	strictUnlink bool
+
+	// See ServerConfig.AsyncUnlink.
+	asyncUnlink bool
+
+	// See ServerConfig.MutationPlanner.
+	mutationPlanner *gcsx.MutationPlanner
+
+	// See ServerConfig.FlushTimeout and ServerConfig.FlushRetryInterval.
+	flushTimeout       time.Duration
+	flushRetryInterval time.Duration
+
+	// The context of the background retries of timed out flushes, cancelled
+	// on Destroy, and the retries running.
+	flushRetryCtx    context.Context
+	stopFlushRetries context.CancelFunc
+	flushRetries     sync.WaitGroup
+
+	// See ServerConfig.MinFreeStagingMB. Nil if zero.
+	stagingSpace *stagingSpace
+
+	// See ServerConfig.MmapReadRetries.
+	mmapReadRetries int
+
+	// Stops the periodic removal of orphaned staged files, if started.
+	stopSweepingStagedFiles context.CancelFunc
+
+	// Concurrent MkDir calls for the same name, which share a single attempt
+	// to create the directory.
+	mkDirs singleflight.Group
+
 	renameDirLimit       int64
 	sequentialReadSizeMb int32
 
@@ -426,8 +824,9 @@ type fileSystem struct {
 	// INVARIANT: For each k/v, v.Name() == k
 	// INVARIANT: For each value v, inodes[v.ID()] == v
 	// INVARIANT: For each value v, v is not ExplicitDirInode
-	// INVARIANT: For each in in inodes such that in is DirInode but not
-	//            ExplicitDirInode, implicitDirInodes[d.Name()] == d
+	// INVARIANT: For each in in inodes such that in is DirInode but neither
+	//            ExplicitDirInode nor *ControlDirInode,
+	//            implicitDirInodes[d.Name()] == d
 	//
 	// GUARDED_BY(mu)
 	implicitDirInodes map[inode.Name]inode.DirInode
@@ -445,9 +844,20 @@ type fileSystem struct {
 	// GUARDED_BY(mu)
 	localFileInodes map[inode.Name]inode.Inode
 
+	// A map from name to the inodes of the control directories and of the
+	// files in them, which aren't backed by objects. See inode.ControlDirName.
+	//
+	// INVARIANT: For each k/v, v.Name() == k
+	// INVARIANT: For each value v, inodes[v.ID()] == v
+	// INVARIANT: For each value v, v is *ControlDirInode or *ControlFileInode
+	//
+	// GUARDED_BY(mu)
+	controlInodes map[inode.Name]inode.Inode
+
 	// The collection of live handles, keyed by handle ID.
 	//
-	// INVARIANT: All values are of type *dirHandle or *handle.FileHandle
+	// INVARIANT: All values are of type *dirHandle, *handle.FileHandle or
+	//            *handle.ControlHandle
 	//
 	// GUARDED_BY(mu)
 	handles map[fuseops.HandleID]interface{}
@@ -469,12 +879,33 @@ type fileSystem struct {
 	// cacheFileForRangeRead when true downloads file into cache even for
 	// random file access.
 	cacheFileForRangeRead bool
+
+	// zeroExtentHints when true serves ranges known to hold only zeros from
+	// object metadata hints instead of reading them.
+	zeroExtentHints bool
+
+	// The configs of prefixes, and the loader filling them in, or nil unless
+	// enabled. See ServerConfig.DirConfigs.
+	dirConfigs      *config.DirConfigs
+	dirConfigLoader *gcsx.DirConfigLoader
+
+	// Advises on the access patterns seen through released file handles.
+	patternDetector *advisor.Detector
 }
 
 ////////////////////////////////////////////////////////////////////////
 // Helpers
 ////////////////////////////////////////////////////////////////////////
 
+// Lock fs.mu on behalf of the op with the given context, which then counts
+// as running rather than queued; see wrappers.MarkOpRunning.
+//
+// LOCK_FUNCTION(fs.mu)
+func (fs *fileSystem) lockForOp(ctx context.Context) {
+	fs.mu.Lock()
+	wrappers.MarkOpRunning(ctx)
+}
+
 func (fs *fileSystem) checkInvariantsForLocalFileInodes() {
 	// INVARIANT: For each k/v, v.Name() == k
 	for k, v := range fs.localFileInodes {
@@ -561,8 +992,9 @@ func (fs *fileSystem) checkInvariantsForImplicitDirs() {
 	for _, in := range fs.inodes {
 		_, dir := in.(inode.DirInode)
 		_, edir := in.(inode.ExplicitDirInode)
+		_, cdir := in.(*inode.ControlDirInode)
 
-		if dir && !edir {
+		if dir && !edir && !cdir {
 			if !(fs.implicitDirInodes[in.Name()] == in) {
 				panic(fmt.Sprintf(
 					"implicitDirInodes mismatch: %q %v %v",
@@ -574,6 +1006,35 @@ func (fs *fileSystem) checkInvariantsForImplicitDirs() {
 	}
 }
 
+func (fs *fileSystem) checkInvariantsForControlInodes() {
+	for k, v := range fs.controlInodes {
+		// INVARIANT: For each k/v, v.Name() == k
+		if !(v.Name() == k) {
+			panic(fmt.Sprintf(
+				"Unexpected name: \"%s\" vs. \"%s\"",
+				v.Name(),
+				k))
+		}
+
+		// INVARIANT: For each value v, inodes[v.ID()] == v
+		if fs.inodes[v.ID()] != v {
+			panic(fmt.Sprintf(
+				"Mismatch for ID %v: %v %v",
+				v.ID(),
+				fs.inodes[v.ID()],
+				v))
+		}
+
+		// INVARIANT: For each value v, v is *ControlDirInode or *ControlFileInode
+		switch v.(type) {
+		case *inode.ControlDirInode:
+		case *inode.ControlFileInode:
+		default:
+			panic(fmt.Sprintf("Unexpected control inode %d, type %T", v.ID(), v))
+		}
+	}
+}
+
 func (fs *fileSystem) checkInvariantsForGenerationBackedInodes() {
 	// INVARIANT: For each k/v, v.Name() == k
 	for k, v := range fs.generationBackedInodes {
@@ -643,16 +1104,19 @@ func (fs *fileSystem) checkInvariants() {
 	fs.checkInvariantsForGenerationBackedInodes()
 	fs.checkInvariantsForImplicitDirs()
 	fs.checkInvariantsForLocalFileInodes()
+	fs.checkInvariantsForControlInodes()
 
 	//////////////////////////////////
 	// handles
 	//////////////////////////////////
 
-	// INVARIANT: All values are of type *dirHandle or *handle.FileHandle
+	// INVARIANT: All values are of type *dirHandle, *handle.FileHandle or
+	//            *handle.ControlHandle
 	for _, h := range fs.handles {
 		switch h.(type) {
 		case *handle.DirHandle:
 		case *handle.FileHandle:
+		case *handle.ControlHandle:
 		default:
 			panic(fmt.Sprintf("Unexpected handle type: %T", h))
 		}
@@ -700,11 +1164,13 @@ func (fs *fileSystem) mintInode(ic inode.Core) (in inode.Inode) {
 			fs.implicitDirs,
 			fs.mountConfig.ListConfig.EnableEmptyManagedFolders,
 			fs.enableNonexistentTypeCache,
-			fs.dirTypeCacheTTL,
+			fs.dirTypeCacheTTLs.Under(fs.dirConfigs.Resolve(ic.Bucket.Name(), ic.FullName.GcsObjectName())),
 			ic.Bucket,
 			fs.mtimeClock,
 			fs.cacheClock,
-			fs.mountConfig.MetadataCacheConfig.TypeCacheMaxSizeMB)
+			fs.mountConfig.MetadataCacheConfig.TypeCacheMaxSizeMB,
+			fs.dirTimes,
+			fs.compatDirMarkerTypes)
 
 		// Implicit directories
 	case ic.FullName.IsDir():
@@ -724,11 +1190,13 @@ func (fs *fileSystem) mintInode(ic inode.Core) (in inode.Inode) {
 			fs.implicitDirs,
 			fs.mountConfig.ListConfig.EnableEmptyManagedFolders,
 			fs.enableNonexistentTypeCache,
-			fs.dirTypeCacheTTL,
+			fs.dirTypeCacheTTLs.Under(fs.dirConfigs.Resolve(ic.Bucket.Name(), ic.FullName.GcsObjectName())),
 			ic.Bucket,
 			fs.mtimeClock,
 			fs.cacheClock,
-			fs.mountConfig.MetadataCacheConfig.TypeCacheMaxSizeMB)
+			fs.mountConfig.MetadataCacheConfig.TypeCacheMaxSizeMB,
+			fs.dirTimes,
+			fs.compatDirMarkerTypes)
 
 	case inode.IsSymlink(ic.MinObject):
 		in = inode.NewSymlinkInode(
@@ -755,7 +1223,11 @@ func (fs *fileSystem) mintInode(ic inode.Core) (in inode.Inode) {
 			fs.localFileCache,
 			fs.contentCache,
 			fs.mtimeClock,
-			ic.Local)
+			ic.Local,
+			fs.lockFileTTL,
+			fs.mountConfig.WriteConfig.ClobberBehavior,
+			fs.preserveAtime,
+			fs.timesUpdateDelay)
 	}
 
 	// Place it in our map of IDs to inodes.
@@ -787,6 +1259,12 @@ func (fs *fileSystem) lookUpOrCreateInodeIfNotStale(ic inode.Core) (in inode.Ino
 	defer func() {
 		if in != nil {
 			in.IncrementLookupCount()
+
+			// The record is fresh from the metadata cache or GCS, so it confirms
+			// the generation of the file found.
+			if f, ok := in.(*inode.FileInode); ok && !ic.Local {
+				f.ConfirmSource(fs.cacheClock.Now())
+			}
 		}
 
 		fs.mu.Unlock()
@@ -919,12 +1397,26 @@ func (fs *fileSystem) lookUpOrCreateChildInode(
 	ctx context.Context,
 	parent inode.DirInode,
 	childName string) (child inode.Inode, err error) {
-	// First check if the requested child is a localFileInode.
+	// Control directories and files aren't objects.
+	child, err = fs.lookUpOrCreateControlInode(parent, childName)
+	if child != nil || err != nil {
+		return
+	}
+
+	// Then check if the requested child is a localFileInode.
 	child = fs.lookUpLocalFileInode(parent, childName)
 	if child != nil {
 		return
 	}
 
+	// Names that clients probe for in every directory aren't worth asking GCS
+	// about.
+	if fs.mountConfig.ListConfig.IsSuppressedName(childName) {
+		monitor.CaptureSuppressedNameMetrics(ctx, "LookUpInode")
+		err = fuse.ENOENT
+		return
+	}
+
 	// If the requested child is not a localFileInode, continue with the existing
 	// flow of checking GCS for file/directory.
 
@@ -970,6 +1462,112 @@ func (fs *fileSystem) lookUpOrCreateChildInode(
 	return
 }
 
+// Return the inode of the control directory or control file with the given
+// name in the parent, creating it if necessary, or nil if the name isn't that
+// of one. See inode.ControlDirName.
+//
+// Return the child locked, incrementing its lookup count.
+//
+// LOCKS_EXCLUDED(fs.mu)
+// LOCKS_EXCLUDED(parent)
+// LOCK_FUNCTION(child)
+func (fs *fileSystem) lookUpOrCreateControlInode(
+	parent inode.DirInode,
+	childName string) (child inode.Inode, err error) {
+	var name inode.Name
+	var mint func(id fuseops.InodeID) inode.Inode
+	switch {
+	case isControlDirName(parent, childName):
+		name = inode.NewDirName(parent.Name(), childName)
+		mint = func(id fuseops.InodeID) inode.Inode {
+			return inode.NewControlDirInode(
+				id,
+				name,
+				fuseops.InodeAttributes{
+					Uid:   fs.uid,
+					Gid:   fs.gid,
+					Mode:  fs.dirMode &^ 0222,
+					Atime: fs.mtimeClock.Now(),
+					Ctime: fs.mtimeClock.Now(),
+					Mtime: fs.mtimeClock.Now(),
+				},
+				parent,
+				fs.listedControlFiles())
+		}
+
+	default:
+		dir, ok := parent.(*inode.ControlDirInode)
+		if !ok {
+			return
+		}
+
+		file, query, err := inode.ParseControlFileName(childName)
+		if err != nil {
+			return nil, err
+		}
+
+		// Only the query file takes writes.
+		mode := fs.fileMode &^ 0222
+		if file == inode.QueryFile {
+			if fs.metadataQueryMaxObjects == 0 {
+				return nil, fuse.ENOENT
+			}
+			mode = fs.fileMode
+		}
+
+		name = inode.NewFileName(parent.Name(), childName)
+		mint = func(id fuseops.InodeID) inode.Inode {
+			return inode.NewControlFileInode(
+				id,
+				name,
+				fuseops.InodeAttributes{
+					Uid:   fs.uid,
+					Gid:   fs.gid,
+					Mode:  mode,
+					Atime: fs.mtimeClock.Now(),
+					Ctime: fs.mtimeClock.Now(),
+					Mtime: fs.mtimeClock.Now(),
+				},
+				dir,
+				file,
+				query)
+		}
+	}
+
+	fs.mu.Lock()
+	defer func() {
+		if child != nil {
+			child.IncrementLookupCount()
+		}
+		fs.mu.Unlock()
+	}()
+
+	for {
+		child = fs.controlInodes[name]
+		if child == nil {
+			id := fs.nextInodeID
+			fs.nextInodeID++
+			child = mint(id)
+			fs.inodes[id] = child
+			fs.controlInodes[name] = child
+
+			// Nothing else can hold the lock of an inode just created.
+			child.Lock()
+			return
+		}
+
+		// Follow the lock ordering rules, as for implicit directories, and go
+		// around if the inode was destroyed meanwhile.
+		fs.mu.Unlock()
+		child.Lock()
+		fs.mu.Lock()
+		if fs.controlInodes[name] == child {
+			return
+		}
+		child.Unlock()
+	}
+}
+
 // Look up the localFileInodes to check if a file with given name exists.
 // Return inode if it exists, else return nil.
 // LOCKS_EXCLUDED(fs.mu)
@@ -1057,6 +1655,57 @@ func (fs *fileSystem) lookUpOrCreateChildDirInode(
 	return child, nil
 }
 
+// Fail with EPERM if name is a suppressed name, which an object can't be
+// created with since looking it up would fail.
+//
+// LOCKS_EXCLUDED(fs.mu)
+func (fs *fileSystem) checkNotSuppressed(ctx context.Context, fsOp string, name string) error {
+	if !fs.mountConfig.ListConfig.IsSuppressedName(name) {
+		return nil
+	}
+
+	monitor.CaptureSuppressedNameMetrics(ctx, fsOp)
+	return fmt.Errorf("%q is a suppressed name: %w", name, syscall.EPERM)
+}
+
+// isControlDirName returns whether name is that of the control directory in
+// parent, which is in the root of each bucket.
+func isControlDirName(parent inode.DirInode, name string) bool {
+	_, ok := parent.(inode.BucketOwnedInode)
+	return ok && parent.Name().IsBucketRoot() && name == inode.ControlDirName
+}
+
+// Fail with EPERM for the name of the control directory and for names in it,
+// which can't be created, removed or renamed.
+func checkNotControlName(parent inode.DirInode, name string) error {
+	_, inControlDir := parent.(*inode.ControlDirInode)
+	if inControlDir || isControlDirName(parent, name) {
+		return fmt.Errorf("%q is a control name: %w", name, syscall.EPERM)
+	}
+	return nil
+}
+
+// onlyDirPrefix returns the prefix of object names for the given --only-dir.
+func onlyDirPrefix(onlyDir string) string {
+	if onlyDir == "" {
+		return ""
+	}
+	return onlyDir + "/"
+}
+
+// Fail with ENAMETOOLONG or EILSEQ if GCS wouldn't accept the name of the
+// object for the named child of parent, a directory if isDir, rather than when
+// the object is created.
+func (fs *fileSystem) checkChildName(parent inode.DirInode, name string, isDir bool) error {
+	var childName inode.Name
+	if isDir {
+		childName = inode.NewDirName(parent.Name(), name)
+	} else {
+		childName = inode.NewFileName(parent.Name(), name)
+	}
+	return inode.CheckObjectName(fs.objectNamePrefix, childName)
+}
+
 // Synchronize the supplied file inode to GCS, updating the index as
 // appropriate.
 //
@@ -1066,14 +1715,27 @@ func (fs *fileSystem) syncFile(
 	ctx context.Context,
 	f *inode.FileInode) (err error) {
 	// SyncFile can be triggered for unlinked files if the fileHandle is open by
-	// same or another user. Silently ignore the syncFile call.
-	// This is in sync with non-local file behaviour.
-	if f.IsLocal() && f.IsUnlinked() {
+	// same or another user, or by a background upload queued before the unlink.
+	// Silently ignore the syncFile call.
+	if f.IsUnlinked() {
+		return
+	}
+
+	// Files with suppressed names stay local.
+	if f.KeptLocal() {
 		return
 	}
 
-	// Sync the inode.
+	// Sync the inode. A local file that is still local afterwards wasn't
+	// written out, because an object was created with its name in the
+	// meantime. Written data mustn't be lost to --max-metadata-ops-per-sec.
+	ctx = gcs.WithLimitExemption(ctx)
+	wasLocal := f.IsLocal()
 	err = f.Sync(ctx)
+	if err == nil && wasLocal && f.IsLocal() &&
+		fs.mountConfig.CreateExistenceCheck == config.CreateExistenceCheckFlush {
+		err = fmt.Errorf("%q was created by another writer: %w", f.Name().GcsObjectName(), syscall.EEXIST)
+	}
 	if err != nil {
 		err = fmt.Errorf("FileInode.Sync: %w", err)
 		// If the inode was local file inode, treat it as unlinked.
@@ -1083,15 +1745,7 @@ func (fs *fileSystem) syncFile(
 		return
 	}
 
-	// Once the inode is synced to GCS, it is no longer an localFileInode.
-	// Delete the entry from localFileInodes map and add it to generationBackedInodes.
-	fs.mu.Lock()
-	delete(fs.localFileInodes, f.Name())
-	_, ok := fs.generationBackedInodes[f.Name()]
-	if !ok {
-		fs.generationBackedInodes[f.Name()] = f
-	}
-	fs.mu.Unlock()
+	fs.recordSynced(ctx, f, wasLocal)
 
 	// We need not update fileIndex:
 	//
@@ -1138,6 +1792,9 @@ func (fs *fileSystem) unlockAndDecrementLookupCount(in inode.Inode, N uint64) {
 		if fs.localFileInodes[name] == in {
 			delete(fs.localFileInodes, name)
 		}
+		if fs.controlInodes[name] == in {
+			delete(fs.controlInodes, name)
+		}
 		fs.mu.Unlock()
 	}
 
@@ -1152,50 +1809,204 @@ func (fs *fileSystem) unlockAndDecrementLookupCount(in inode.Inode, N uint64) {
 	in.Unlock()
 }
 
-// A helper function for use after incrementing an inode's lookup count.
-// Ensures that the lookup count is decremented again if the caller is going to
-// return in error (in which case the kernel and gcsfuse would otherwise
-// disagree about the lookup count for the inode's ID), so that the inode isn't
-// leaked.
+// Queue the upload of the supplied file inode's contents, keeping the inode
+// alive until it is done. If releaseLock is true, the upload also releases a
+// reference on the inode's lock object once it has finished.
 //
-// Typical usage:
-//
-//	func (fs *fileSystem) doFoo() (err error) {
-//	  in, err := fs.lookUpOrCreateInodeIfNotStale(...)
-//	  if err != nil {
-//	    return
-//	  }
-//
-//	  defer fs.unlockAndMaybeDisposeOfInode(in, &err)
-//
-//	  ...
-//	}
-//
-// LOCKS_REQUIRED(in)
 // LOCKS_EXCLUDED(fs.mu)
-// UNLOCK_FUNCTION(in)
-func (fs *fileSystem) unlockAndMaybeDisposeOfInode(
-	in inode.Inode,
-	err *error) {
-	// If there is no error, just unlock.
-	if *err == nil {
-		in.Unlock()
+// LOCKS_REQUIRED(f)
+func (fs *fileSystem) uploadInBackground(f *inode.FileInode, releaseLock bool) {
+	f.IncrementLookupCount()
+
+	fs.uploadManager.Enqueue(f.Name().LocalName(), func(ctx context.Context) (err error) {
+		// Wait for the object's write slot before taking the lock, so that
+		// writes made meanwhile go into this upload and the uploads queued
+		// behind it find nothing left to do.
+		waited := f.Bucket().AwaitWriteSlot(ctx, f.Name().GcsObjectName())
+
+		f.Lock()
+		defer fs.unlockAndDecrementLookupCount(f, 1)
+
+		if waited && !f.HasStagedContent() {
+			monitor.CaptureWritePacingMetrics(ctx, monitor.WriteCoalesced)
+		}
+
+		err = fs.syncFile(ctx, f)
+		if releaseLock {
+			if releaseErr := f.ReleaseLock(ctx); releaseErr != nil && err == nil {
+				err = fmt.Errorf("ReleaseLock: %w", releaseErr)
+			}
+		}
+
 		return
+	})
+}
+
+// Return, and forget, the error of the last failed background upload of the
+// file, if any.
+//
+// LOCKS_EXCLUDED(fs.mu)
+func (fs *fileSystem) takeUploadError(in inode.Inode) error {
+	if fs.uploadManager == nil {
+		return nil
 	}
 
-	// Otherwise, go through the decrement helper
-	fs.unlockAndDecrementLookupCount(in, 1)
+	if err := fs.uploadManager.TakeError(in.Name().LocalName()); err != nil {
+		return fmt.Errorf("background upload: %w", err)
+	}
+
+	return nil
 }
 
-// Fetch attributes for the supplied inode and fill in an appropriate
-// expiration time for them.
+// Synchronize the supplied file inode to GCS on a flush, giving up after
+// fs.flushTimeout if set. A flush that gives up fails with EIO and leaves the
+// staged contents for a background retry, if enabled, or for recovery.
 //
-// LOCKS_REQUIRED(in)
-func (fs *fileSystem) getAttributes(
+// LOCKS_EXCLUDED(fs.mu)
+// LOCKS_REQUIRED(f)
+func (fs *fileSystem) flushFile(
 	ctx context.Context,
-	in inode.Inode) (
-	attr fuseops.InodeAttributes,
-	expiration time.Time,
+	f *inode.FileInode) (err error) {
+	if fs.flushTimeout == 0 {
+		return fs.syncFile(ctx, f)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, fs.flushTimeout)
+	defer cancel()
+
+	err = fs.syncFile(ctx, f)
+	if err == nil || ctx.Err() != context.DeadlineExceeded {
+		return
+	}
+
+	logger.Errorf("Flush of %q timed out after %v: %v. Its contents are kept in %q.",
+		f.Name().GcsObjectName(), fs.flushTimeout, err, f.StagedFilePath())
+	if f.RecordFlushTimeout() && fs.flushRetryInterval > 0 {
+		fs.retryFlushInBackground(f)
+	}
+
+	return fmt.Errorf("%q not flushed within %v: %w", f.Name().GcsObjectName(), fs.flushTimeout, syscall.EIO)
+}
+
+// Retry syncing the supplied file inode, whose flush timed out, every
+// fs.flushRetryInterval until it succeeds, the inode is synced otherwise or
+// the file system is destroyed. The inode is kept alive meanwhile.
+//
+// LOCKS_EXCLUDED(fs.mu)
+// LOCKS_REQUIRED(f)
+func (fs *fileSystem) retryFlushInBackground(f *inode.FileInode) {
+	f.IncrementLookupCount()
+
+	fs.flushRetries.Add(1)
+	go func() {
+		defer fs.flushRetries.Done()
+
+		for attempt := 1; ; attempt++ {
+			select {
+			case <-fs.flushRetryCtx.Done():
+				f.Lock()
+				fs.unlockAndDecrementLookupCount(f, 1)
+				return
+			case <-time.After(fs.flushRetryInterval):
+			}
+
+			f.Lock()
+			if !f.FlushTimedOut() {
+				fs.unlockAndDecrementLookupCount(f, 1)
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(fs.flushRetryCtx, fs.flushTimeout)
+			err := fs.syncFile(ctx, f)
+			cancel()
+			if err == nil {
+				logger.Infof("Flushed %q on retry %d.", f.Name().GcsObjectName(), attempt)
+				fs.unlockAndDecrementLookupCount(f, 1)
+				return
+			}
+
+			logger.Warnf("Retry %d of the flush of %q failed: %v", attempt, f.Name().GcsObjectName(), err)
+			f.Unlock()
+		}
+	}()
+}
+
+// A helper function for use after incrementing an inode's lookup count.
+// Ensures that the lookup count is decremented again if the caller is going to
+// return in error (in which case the kernel and gcsfuse would otherwise
+// disagree about the lookup count for the inode's ID), so that the inode isn't
+// leaked.
+//
+// Typical usage:
+//
+//	func (fs *fileSystem) doFoo() (err error) {
+//	  in, err := fs.lookUpOrCreateInodeIfNotStale(...)
+//	  if err != nil {
+//	    return
+//	  }
+//
+//	  defer fs.unlockAndMaybeDisposeOfInode(in, &err)
+//
+//	  ...
+//	}
+//
+// LOCKS_REQUIRED(in)
+// LOCKS_EXCLUDED(fs.mu)
+// UNLOCK_FUNCTION(in)
+func (fs *fileSystem) unlockAndMaybeDisposeOfInode(
+	in inode.Inode,
+	err *error) {
+	// If there is no error, just unlock.
+	if *err == nil {
+		in.Unlock()
+		return
+	}
+
+	// Otherwise, go through the decrement helper
+	fs.unlockAndDecrementLookupCount(in, 1)
+}
+
+// dirConfig returns the config of the prefixes of the object of the supplied
+// inode, which is empty for inodes not owned by a bucket.
+func (fs *fileSystem) dirConfig(in inode.Inode) config.DirConfig {
+	b, ok := in.(inode.BucketOwnedInode)
+	if !ok {
+		return config.DirConfig{}
+	}
+	return fs.dirConfigs.Resolve(b.Bucket().Name(), in.Name().GcsObjectName())
+}
+
+// loadDirConfigs makes sure the configs of the directories containing the
+// object of the supplied inode, and of the inode itself if it's a directory,
+// are up to date.
+//
+// LOCKS_EXCLUDED(fs.mu)
+func (fs *fileSystem) loadDirConfigs(ctx context.Context, in inode.Inode) {
+	if b, ok := in.(inode.BucketOwnedInode); ok {
+		fs.dirConfigLoader.Load(ctx, b.Bucket(), in.Name().GcsObjectName())
+	}
+}
+
+// fileCacheFor returns the file cache handler, nil if the file is kept out of
+// the file cache, and whether to cache files read at random, for the supplied
+// file inode.
+func (fs *fileSystem) fileCacheFor(in inode.Inode) (*file.CacheHandler, bool) {
+	c := fs.dirConfig(in)
+	if !c.FileCacheEnabled() {
+		return nil, false
+	}
+	return fs.fileCacheHandler, c.CacheFileForRangeRead(fs.cacheFileForRangeRead)
+}
+
+// Fetch attributes for the supplied inode and fill in an appropriate
+// expiration time for them.
+//
+// LOCKS_REQUIRED(in)
+func (fs *fileSystem) getAttributes(
+	ctx context.Context,
+	in inode.Inode) (
+	attr fuseops.InodeAttributes,
+	expiration time.Time,
 	err error) {
 	// Call through.
 	attr, err = in.Attributes(ctx)
@@ -1204,8 +2015,67 @@ func (fs *fileSystem) getAttributes(
 	}
 
 	// Set up the expiration time.
-	if fs.inodeAttributeCacheTTL > 0 {
-		expiration = time.Now().Add(fs.inodeAttributeCacheTTL)
+	if ttl := fs.attributesTTL(in); ttl > 0 {
+		expiration = time.Now().Add(ttl)
+	}
+
+	return
+}
+
+// attributesTTL returns how long the kernel may cache the attributes of the
+// supplied inode: none for a file with local contents, whose size may change
+// with every write, and otherwise the ttl of its records, no longer than
+// fs.attrCacheTTL.
+//
+// LOCKS_REQUIRED(in)
+func (fs *fileSystem) attributesTTL(in inode.Inode) (ttl time.Duration) {
+	if file, ok := in.(*inode.FileInode); ok && !file.SourceGenerationIsAuthoritative() {
+		return 0
+	}
+
+	ttl = fs.recordsTTL(in)
+	if fs.attrCacheTTL != nil {
+		ttl = min(ttl, *fs.attrCacheTTL)
+	}
+	return
+}
+
+// recordsTTL returns how long the records of the supplied inode are trusted,
+// by its kind, which bounds how long the kernel may cache its attributes and
+// its entry.
+func (fs *fileSystem) recordsTTL(in inode.Inode) (ttl time.Duration) {
+	ttls := fs.inodeAttributeCacheTTLs.Under(fs.dirConfig(in))
+	if _, ok := in.(inode.DirInode); ok {
+		return ttls.Dir
+	}
+
+	ttl = ttls.File
+	if file, ok := in.(*inode.FileInode); ok && !file.IsLocal() && ttl > 0 {
+		ttl = fs.cacheControlTTL.TTL(file.Source().CacheControl, ttl)
+	}
+	return
+}
+
+// getEntry fills in the supplied entry for the child inode, with expiration
+// times for its attributes and for the entry itself.
+//
+// LOCKS_REQUIRED(child)
+func (fs *fileSystem) getEntry(
+	ctx context.Context,
+	child inode.Inode,
+	e *fuseops.ChildInodeEntry) (err error) {
+	e.Child = child.ID()
+	e.Attributes, e.AttributesExpiration, err = fs.getAttributes(ctx, child)
+	if err != nil {
+		return
+	}
+
+	entryTTL := fs.entryCacheTTLs.File
+	if _, ok := child.(inode.DirInode); ok {
+		entryTTL = fs.entryCacheTTLs.Dir
+	}
+	if entryTTL = min(entryTTL, fs.recordsTTL(child)); entryTTL > 0 {
+		e.EntryExpiration = time.Now().Add(entryTTL)
 	}
 
 	return
@@ -1267,6 +2137,38 @@ func (fs *fileSystem) symlinkInodeOrDie(
 	return
 }
 
+// deleteChildFile is parent.DeleteChildFile, with the object deleted through
+// fs.deleter so that deletions don't exceed ServerConfig.DeleteParallelism.
+//
+// LOCKS_REQUIRED(parent)
+func (fs *fileSystem) deleteChildFile(
+	ctx context.Context,
+	parent inode.DirInode,
+	name string,
+	generation int64,
+	metaGeneration *int64) error {
+	bucketOwned, ok := parent.(inode.BucketOwnedDirInode)
+	if !ok {
+		// The directory holding the buckets has no objects to delete.
+		return parent.DeleteChildFile(ctx, name, generation, metaGeneration)
+	}
+
+	parent.InvalidateChild(name)
+	err := fs.deleter.DeleteObject(ctx, bucketOwned.Bucket(), &gcs.DeleteObjectRequest{
+		Name:                       inode.NewFileName(parent.Name(), name).GcsObjectName(),
+		Generation:                 generation,
+		MetaGenerationPrecondition: metaGeneration,
+		// Deleting whatever the name refers to fails right away if the stat
+		// cache knows there is nothing. See ServerConfig.StrictUnlink.
+		TrustNegativeCache: generation == 0 && metaGeneration == nil && !fs.strictUnlink,
+	})
+	if err != nil {
+		return fmt.Errorf("DeleteObject: %w", err)
+	}
+	parent.InvalidateChild(name)
+	return nil
+}
+
 // invalidateChildFileCacheIfExist invalidates the file in read cache. This is used to
 // invalidate the file in read cache after deletion of original file.
 //
@@ -1291,20 +2193,141 @@ func (fs *fileSystem) invalidateChildFileCacheIfExist(parentInode inode.DirInode
 	return nil
 }
 
+// checkObjectDeleted returns true if the supplied inode is a file whose object
+// was found to have been deleted by another writer. The first time, it also
+// makes the caches forget the object, so that it stops being looked up and
+// listed before they expire: the stat cache already has, but the type cache
+// and the kernel list cache of the parent, and the file cache, still hold it.
+//
+// LOCKS_EXCLUDED(fs.mu)
+// LOCKS_EXCLUDED(in)
+func (fs *fileSystem) checkObjectDeleted(ctx context.Context, in inode.Inode) bool {
+	f, ok := in.(*inode.FileInode)
+	if !ok {
+		return false
+	}
+
+	f.Lock()
+	deleted := f.ObjectDeleted()
+	first := f.TakeObjectDeletion()
+	f.Unlock()
+	if !first {
+		return deleted
+	}
+
+	name := f.Name()
+	logger.Infof("Object %q was deleted by another writer, forgetting it", name.GcsObjectName())
+	monitor.CaptureExternalDeletionMetrics(ctx)
+
+	parentName := name.ParentName()
+	fs.mu.Lock()
+	parent, ok := fs.implicitDirInodes[parentName]
+	if !ok {
+		parent, _ = fs.generationBackedInodes[parentName].(inode.DirInode)
+	}
+	fs.mu.Unlock()
+
+	// The type cache lives in the parent, so there is nothing to forget if the
+	// kernel has forgotten it.
+	if parent == nil {
+		return deleted
+	}
+
+	parent.Lock()
+	defer parent.Unlock()
+	parent.InvalidateChild(strings.TrimPrefix(name.GcsObjectName(), parentName.GcsObjectName()))
+	if err := fs.invalidateChildFileCacheIfExist(parent, name.GcsObjectName()); err != nil {
+		logger.Warnf("checkObjectDeleted: %v", err)
+	}
+
+	return deleted
+}
+
 ////////////////////////////////////////////////////////////////////////
 // fuse.FileSystem methods
 ////////////////////////////////////////////////////////////////////////
 
 func (fs *fileSystem) Destroy() {
+	// Finish the uploads of closed files while the buckets are still usable.
+	if fs.uploadManager != nil {
+		fs.uploadManager.Drain()
+	}
+	fs.stopFlushRetries()
+	fs.flushRetries.Wait()
+	fs.pendingDeletes.waitAll()
+	fs.flushStagedWrites()
+	if fs.stopSweepingStagedFiles != nil {
+		fs.stopSweepingStagedFiles()
+		fs.contentCache.RemoveStagedWriteDir()
+	}
+	if fs.timesUpdateDelay > 0 {
+		if err := fs.flushPendingTimes(context.Background(), func(inode.Name) bool { return true }); err != nil {
+			logger.Warnf("Updating file times at unmount: %v", err)
+		}
+	}
 	fs.bucketManager.ShutDown()
 	if fs.fileCacheHandler != nil {
 		_ = fs.fileCacheHandler.Destroy()
 	}
 }
 
+// flushStagedWrites journals the writes to files that are still dirty, so
+// that the next mount can recover them.
+//
+// LOCKS_EXCLUDED(fs.mu)
+func (fs *fileSystem) flushStagedWrites() {
+	var files []*inode.FileInode
+	fs.mu.Lock()
+	for _, in := range fs.inodes {
+		if f, ok := in.(*inode.FileInode); ok {
+			files = append(files, f)
+		}
+	}
+	fs.mu.Unlock()
+
+	for _, f := range files {
+		f.Lock()
+		f.FlushStagedWrite()
+		f.Unlock()
+	}
+}
+
+// flushPendingTimes writes the times held back for the files whose names
+// match; see ServerConfig.TimesUpdateDelay. It returns the first error.
+//
+// LOCKS_EXCLUDED(fs.mu)
+func (fs *fileSystem) flushPendingTimes(
+	ctx context.Context,
+	match func(inode.Name) bool) (err error) {
+	var files []*inode.FileInode
+	fs.mu.Lock()
+	for _, in := range fs.inodes {
+		if f, ok := in.(*inode.FileInode); ok && match(f.Name()) {
+			files = append(files, f)
+		}
+	}
+	fs.mu.Unlock()
+
+	for _, f := range files {
+		f.Lock()
+		if flushErr := f.FlushPendingTimes(ctx); flushErr != nil && err == nil {
+			err = fmt.Errorf("FlushPendingTimes(%q): %w", f.Name(), flushErr)
+		}
+		f.Unlock()
+	}
+
+	return
+}
+
 func (fs *fileSystem) StatFS(
 	ctx context.Context,
 	op *fuseops.StatFSOp) (err error) {
+	statFS(op)
+	return
+}
+
+// statFS answers op, which doesn't depend on the bucket.
+func statFS(op *fuseops.StatFSOp) {
 	// Simulate a large amount of free space so that the Finder doesn't refuse to
 	// copy in files. (See issue #125.) Use 2^17 as the block size because that
 	// is the largest that OS X will pass on.
@@ -1320,8 +2343,6 @@ func (fs *fileSystem) StatFS(
 	// Prefer large transfers. This is the largest value that OS X will
 	// faithfully pass on, according to fuseops/ops.go.
 	op.IoSize = 1 << 20
-
-	return
 }
 
 // LOCKS_EXCLUDED(fs.mu)
@@ -1336,10 +2357,24 @@ func (fs *fileSystem) LookUpInode(
 		defer cancel()
 	}
 	// Find the parent directory in question.
-	fs.mu.Lock()
+	fs.lockForOp(ctx)
 	parent := fs.dirInodeOrDie(op.Parent)
 	fs.mu.Unlock()
 
+	// No object can have a name that doesn't fit, so creating it would fail.
+	childName := strings.TrimSuffix(op.Name, inode.ConflictingFileNameSuffix)
+	if err = fs.checkChildName(parent, childName, false); err != nil {
+		return err
+	}
+
+	// A file unlinked a moment ago is gone once its object is.
+	if err = fs.pendingDeletes.waitName(ctx, parent.Name(), childName); err != nil {
+		return err
+	}
+
+	// Make sure the configs of the parent and its ancestors are up to date.
+	fs.loadDirConfigs(ctx, parent)
+
 	// Find or create the child inode.
 	child, err := fs.lookUpOrCreateChildInode(ctx, parent, op.Name)
 	if err != nil {
@@ -1349,9 +2384,7 @@ func (fs *fileSystem) LookUpInode(
 	defer fs.unlockAndMaybeDisposeOfInode(child, &err)
 
 	// Fill out the response.
-	e := &op.Entry
-	e.Child = child.ID()
-	e.Attributes, e.AttributesExpiration, err = fs.getAttributes(ctx, child)
+	err = fs.getEntry(ctx, child, &op.Entry)
 
 	if err != nil {
 		return err
@@ -1372,19 +2405,21 @@ func (fs *fileSystem) GetInodeAttributes(
 		defer cancel()
 	}
 	// Find the inode.
-	fs.mu.Lock()
+	fs.lockForOp(ctx)
 	in := fs.inodeOrDie(op.Inode)
 	fs.mu.Unlock()
 
 	in.Lock()
-	defer in.Unlock()
-
 	// Grab its attributes.
 	op.Attributes, op.AttributesExpiration, err = fs.getAttributes(ctx, in)
+	in.Unlock()
 	if err != nil {
 		return err
 	}
 
+	// Checking whether a file was clobbered may find its object deleted.
+	fs.checkObjectDeleted(ctx, in)
+
 	return
 }
 
@@ -1400,7 +2435,7 @@ func (fs *fileSystem) SetInodeAttributes(
 		defer cancel()
 	}
 	// Find the inode.
-	fs.mu.Lock()
+	fs.lockForOp(ctx)
 	in := fs.inodeOrDie(op.Inode)
 	fs.mu.Unlock()
 
@@ -1408,11 +2443,12 @@ func (fs *fileSystem) SetInodeAttributes(
 	defer in.Unlock()
 	file, isFile := in.(*inode.FileInode)
 
-	// Set file mtimes.
-	if isFile && op.Mtime != nil {
-		err = file.SetMtime(ctx, *op.Mtime)
+	// Set file times. Each of them is nil if it isn't being changed, e.g. for
+	// UTIME_OMIT; the kernel resolves UTIME_NOW to the current time.
+	if isFile && (op.Atime != nil || op.Mtime != nil) {
+		err = file.SetTimes(ctx, op.Atime, op.Mtime)
 		if err != nil {
-			err = fmt.Errorf("SetMtime: %w", err)
+			err = fmt.Errorf("SetTimes: %w", err)
 			return err
 		}
 	}
@@ -1426,7 +2462,8 @@ func (fs *fileSystem) SetInodeAttributes(
 		}
 	}
 
-	// We silently ignore updates to mode and atime.
+	// We silently ignore updates to mode, and to the times of directories and
+	// symlinks.
 
 	// Fill in the response.
 	op.Attributes, op.AttributesExpiration, err = fs.getAttributes(ctx, in)
@@ -1443,7 +2480,7 @@ func (fs *fileSystem) ForgetInode(
 	ctx context.Context,
 	op *fuseops.ForgetInodeOp) (err error) {
 	// Find the inode.
-	fs.mu.Lock()
+	fs.lockForOp(ctx)
 	in := fs.inodeOrDie(op.Inode)
 	fs.mu.Unlock()
 
@@ -1454,6 +2491,24 @@ func (fs *fileSystem) ForgetInode(
 	return
 }
 
+// LOCKS_EXCLUDED(fs.mu)
+func (fs *fileSystem) BatchForget(
+	ctx context.Context,
+	op *fuseops.BatchForgetOp) (err error) {
+	// The kernel forgets inodes in batches when it drops many at once, such as
+	// after rm -r, so that without this none of them would ever be destroyed.
+	for _, entry := range op.Entries {
+		fs.lockForOp(ctx)
+		in := fs.inodeOrDie(entry.Inode)
+		fs.mu.Unlock()
+
+		in.Lock()
+		fs.unlockAndDecrementLookupCount(in, entry.N)
+	}
+
+	return
+}
+
 // LOCKS_EXCLUDED(fs.mu)
 func (fs *fileSystem) MkDir(
 	ctx context.Context,
@@ -1465,27 +2520,30 @@ func (fs *fileSystem) MkDir(
 		ctx, cancel = util.IsolateContextFromParentContext(ctx)
 		defer cancel()
 	}
+	if err = fs.checkNotSuppressed(ctx, "MkDir", op.Name); err != nil {
+		return
+	}
+
 	// Find the parent.
-	fs.mu.Lock()
+	fs.lockForOp(ctx)
 	parent := fs.dirInodeOrDie(op.Parent)
 	fs.mu.Unlock()
 
-	// Create an empty backing object for the child, failing if it already
-	// exists.
-	parent.Lock()
-	result, err := parent.CreateChildDir(ctx, op.Name)
-	parent.Unlock()
+	if err = checkNotControlName(parent, op.Name); err != nil {
+		return err
+	}
+	if err = fs.checkChildName(parent, op.Name, true); err != nil {
+		return err
+	}
 
-	// Special case: *gcs.PreconditionError means the name already exists.
-	var preconditionErr *gcs.PreconditionError
-	if errors.As(err, &preconditionErr) {
-		err = fuse.EEXIST
-		return
+	// A file unlinked a moment ago is in the way until its object is deleted.
+	if err = fs.pendingDeletes.waitName(ctx, parent.Name(), op.Name); err != nil {
+		return err
 	}
 
-	// Propagate other errors.
+	// Create the directory, or find the one a concurrent mkdir created.
+	result, err := fs.createChildDir(ctx, parent, op.Name)
 	if err != nil {
-		err = fmt.Errorf("CreateChildDir: %w", err)
 		return err
 	}
 
@@ -1501,9 +2559,7 @@ func (fs *fileSystem) MkDir(
 	defer fs.unlockAndMaybeDisposeOfInode(child, &err)
 
 	// Fill out the response.
-	e := &op.Entry
-	e.Child = child.ID()
-	e.Attributes, e.AttributesExpiration, err = fs.getAttributes(ctx, child)
+	err = fs.getEntry(ctx, child, &op.Entry)
 
 	if err != nil {
 		err = fmt.Errorf("getAttributes: %w", err)
@@ -1513,6 +2569,72 @@ func (fs *fileSystem) MkDir(
 	return
 }
 
+// Create the child directory of the given name, sharing the attempt with
+// concurrent calls for the same name. Creating a directory that already
+// exists, as parallel mkdir -p calls in this or other mounts do, succeeds with
+// the existing directory; EEXIST is returned only if a file of that name is
+// in the way.
+//
+// LOCKS_EXCLUDED(fs.mu)
+// LOCKS_EXCLUDED(parent)
+func (fs *fileSystem) createChildDir(
+	ctx context.Context,
+	parent inode.DirInode,
+	name string) (*inode.Core, error) {
+	key := inode.NewDirName(parent.Name(), name).LocalName()
+	result, err, _ := fs.mkDirs.Do(key, func() (interface{}, error) {
+		parent.Lock()
+		defer parent.Unlock()
+		return createOrFindChildDir(ctx, parent, name)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result.(*inode.Core), nil
+}
+
+// LOCKS_REQUIRED(parent)
+func createOrFindChildDir(
+	ctx context.Context,
+	parent inode.DirInode,
+	name string) (*inode.Core, error) {
+	const maxTries = 3
+	for n := 0; n < maxTries; n++ {
+		// Create an empty backing object for the child, failing if it already
+		// exists.
+		result, err := parent.CreateChildDir(ctx, name)
+
+		var preconditionErr *gcs.PreconditionError
+		if !errors.As(err, &preconditionErr) {
+			if err != nil {
+				return nil, fmt.Errorf("CreateChildDir: %w", err)
+			}
+			return result, nil
+		}
+
+		// Someone else created the placeholder first. Look at what is there now,
+		// past the cached view of the directory.
+		parent.InvalidateChild(name)
+		result, err = parent.LookUpChild(ctx, name)
+		if err != nil {
+			return nil, fmt.Errorf("LookUpChild: %w", err)
+		}
+
+		switch {
+		case result == nil:
+			// Deleted again in the meantime, so try again.
+			continue
+		case !result.FullName.IsDir():
+			return nil, fuse.EEXIST
+		default:
+			return result, nil
+		}
+	}
+
+	return nil, fuse.EEXIST
+}
+
 // LOCKS_EXCLUDED(fs.mu)
 func (fs *fileSystem) MkNode(
 	ctx context.Context,
@@ -1528,6 +2650,10 @@ func (fs *fileSystem) MkNode(
 		return syscall.ENOTSUP
 	}
 
+	if err = fs.checkNotSuppressed(ctx, "MkNode", op.Name); err != nil {
+		return
+	}
+
 	// Create the child.
 	child, err := fs.createFile(ctx, op.Parent, op.Name, op.Mode)
 	if err != nil {
@@ -1537,9 +2663,7 @@ func (fs *fileSystem) MkNode(
 	defer fs.unlockAndMaybeDisposeOfInode(child, &err)
 
 	// Fill out the response.
-	e := &op.Entry
-	e.Child = child.ID()
-	e.Attributes, e.AttributesExpiration, err = fs.getAttributes(ctx, child)
+	err = fs.getEntry(ctx, child, &op.Entry)
 
 	if err != nil {
 		err = fmt.Errorf("getAttributes: %w", err)
@@ -1560,10 +2684,23 @@ func (fs *fileSystem) createFile(
 	name string,
 	mode os.FileMode) (child inode.Inode, err error) {
 	// Find the parent.
-	fs.mu.Lock()
+	fs.lockForOp(ctx)
 	parent := fs.dirInodeOrDie(parentID)
 	fs.mu.Unlock()
 
+	if err = checkNotControlName(parent, name); err != nil {
+		return
+	}
+	if err = fs.checkChildName(parent, name, false); err != nil {
+		return
+	}
+
+	// Don't let the deletion of an unlinked file of the same name delete the
+	// new one.
+	if err = fs.pendingDeletes.waitName(ctx, parent.Name(), name); err != nil {
+		return
+	}
+
 	// Create an empty backing object for the child, failing if it already
 	// exists.
 	parent.Lock()
@@ -1592,26 +2729,130 @@ func (fs *fileSystem) createFile(
 		return
 	}
 
+	fs.createParentPlaceholders(ctx, result.Bucket, result.FullName)
+
 	return
 }
 
+// Record that the supplied file, which was local if wasLocal, has been synced
+// to an object.
+//
+// LOCKS_REQUIRED(f)
+// LOCKS_EXCLUDED(fs.mu)
+func (fs *fileSystem) recordSynced(ctx context.Context, f *inode.FileInode, wasLocal bool) {
+	// Once the inode is synced to GCS, it is no longer an localFileInode.
+	// Delete the entry from localFileInodes map and add it to generationBackedInodes.
+	fs.mu.Lock()
+	delete(fs.localFileInodes, f.Name())
+	_, ok := fs.generationBackedInodes[f.Name()]
+	if !ok {
+		fs.generationBackedInodes[f.Name()] = f
+	}
+	fs.mu.Unlock()
+
+	if wasLocal {
+		fs.createParentPlaceholders(ctx, f.Bucket(), f.Name())
+	}
+}
+
+// Create placeholder objects for the directories above the newly created
+// object of the supplied name, as set by write:create-parent-placeholders.
+// With missing-only, only the directories whose inodes are implicit are
+// considered, which costs nothing when they all have placeholders. Failures
+// are logged, leaving the directories implicit.
+//
+// LOCKS_EXCLUDED(fs.mu)
+func (fs *fileSystem) createParentPlaceholders(
+	ctx context.Context,
+	bucket gcs.Bucket,
+	name inode.Name) {
+	mode := fs.mountConfig.WriteConfig.CreateParentPlaceholders
+	if mode == "" || mode == config.CreateParentPlaceholdersNever ||
+		bucket.BucketType() == gcs.Hierarchical {
+		return
+	}
+
+	// Find the directories above the object, outermost first.
+	var dirs []inode.Name
+	for dir := name.ParentName(); !dir.IsBucketRoot(); dir = dir.ParentName() {
+		dirs = append([]inode.Name{dir}, dirs...)
+	}
+
+	if mode == config.CreateParentPlaceholdersMissingOnly {
+		fs.mu.Lock()
+		var implicit []inode.Name
+		for _, dir := range dirs {
+			if _, ok := fs.implicitDirInodes[dir]; ok {
+				implicit = append(implicit, dir)
+			}
+		}
+		fs.mu.Unlock()
+		dirs = implicit
+	}
+
+	for _, dir := range dirs {
+		var precond int64
+		_, err := bucket.CreateObject(ctx, &gcs.CreateObjectRequest{
+			Name:                   dir.GcsObjectName(),
+			Contents:               strings.NewReader(""),
+			GenerationPrecondition: &precond,
+		})
+
+		// A placeholder created by someone else is as good as ours.
+		var preconditionErr *gcs.PreconditionError
+		if err != nil && !errors.As(err, &preconditionErr) {
+			logger.Warnf("Cannot create the placeholder of directory %q: %v", dir.GcsObjectName(), err)
+		}
+	}
+}
+
 // Creates localFileInode with the given name under the parent inode.
 // LOCKS_EXCLUDED(fs.mu)
 // UNLOCK_FUNCTION(fs.mu)
 // LOCK_FUNCTION(in)
 func (fs *fileSystem) createLocalFile(
+	ctx context.Context,
 	parentID fuseops.InodeID,
 	name string) (child inode.Inode, err error) {
 	// Find the parent.
-	fs.mu.Lock()
+	fs.lockForOp(ctx)
 	parent := fs.dirInodeOrDie(parentID)
 	fs.mu.Unlock()
 
+	if err = checkNotControlName(parent, name); err != nil {
+		return
+	}
+	if err = fs.checkChildName(parent, name, false); err != nil {
+		return
+	}
+
+	// Don't let the deletion of an unlinked file of the same name delete the
+	// new one.
+	if err = fs.pendingDeletes.waitName(ctx, parent.Name(), name); err != nil {
+		return
+	}
+
+	// The kernel only creates names that it looked up and didn't find, but the
+	// metadata cache may not know of an object created by another writer.
+	// Files with suppressed names don't have objects.
+	if fs.mountConfig.CreateExistenceCheck == config.CreateExistenceCheckOpen &&
+		!fs.mountConfig.ListConfig.IsSuppressedName(name) {
+		if err = checkNoObject(ctx, parent, name); err != nil {
+			return
+		}
+	}
+
 	defer func() {
 		// We need to release the filesystem lock before acquiring the inode lock.
 		fs.mu.Unlock()
 
 		if child != nil {
+			// Listings merge in the local files, so the new one has to show up in
+			// the next listing of the parent.
+			parent.Lock()
+			parent.InvalidateChild(name)
+			parent.Unlock()
+
 			child.Lock()
 			child.IncrementLookupCount()
 			// Unlock is done by the calling method.
@@ -1638,11 +2879,41 @@ func (fs *fileSystem) createLocalFile(
 		if err != nil {
 			return
 		}
+
+		// Files with suppressed names are never uploaded.
+		if fs.mountConfig.ListConfig.IsSuppressedName(name) {
+			fileInode.KeepLocal()
+		}
 	}
 
 	return
 }
 
+// checkNoObject returns EEXIST if an object for the file with the given name
+// under the parent exists in GCS, asking GCS rather than the metadata cache.
+func checkNoObject(ctx context.Context, parent inode.DirInode, name string) error {
+	// The base directory of a multi-bucket mount holds no objects.
+	bucketOwned, ok := parent.(inode.BucketOwnedDirInode)
+	if !ok {
+		return nil
+	}
+
+	_, _, err := bucketOwned.Bucket().StatObject(ctx, &gcs.StatObjectRequest{
+		Name:              inode.NewFileName(parent.Name(), name).GcsObjectName(),
+		ForceFetchFromGcs: true,
+	})
+
+	var notFoundErr *gcs.NotFoundError
+	if errors.As(err, &notFoundErr) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("StatObject: %w", err)
+	}
+
+	return fuse.EEXIST
+}
+
 // LOCKS_EXCLUDED(fs.mu)
 func (fs *fileSystem) CreateFile(
 	ctx context.Context,
@@ -1654,12 +2925,24 @@ func (fs *fileSystem) CreateFile(
 		ctx, cancel = util.IsolateContextFromParentContext(ctx)
 		defer cancel()
 	}
-	// Create the child.
+	if err = fs.stagingSpace.check(ctx, "CreateFile"); err != nil {
+		return err
+	}
+
+	// Create the child. Files with suppressed names are rejected, or created
+	// local whatever create-empty-file says.
 	var child inode.Inode
-	if fs.mountConfig.CreateEmptyFile {
+	switch {
+	case fs.mountConfig.ListConfig.IsSuppressedName(op.Name):
+		monitor.CaptureSuppressedNameMetrics(ctx, "CreateFile")
+		if fs.mountConfig.ListConfig.SuppressedCreate == config.SuppressedCreateReject {
+			return fmt.Errorf("%q is a suppressed name: %w", op.Name, syscall.EPERM)
+		}
+		child, err = fs.createLocalFile(ctx, op.Parent, op.Name)
+	case fs.mountConfig.CreateEmptyFile:
 		child, err = fs.createFile(ctx, op.Parent, op.Name, op.Mode)
-	} else {
-		child, err = fs.createLocalFile(op.Parent, op.Name)
+	default:
+		child, err = fs.createLocalFile(ctx, op.Parent, op.Name)
 	}
 
 	if err != nil {
@@ -1668,21 +2951,27 @@ func (fs *fileSystem) CreateFile(
 
 	defer fs.unlockAndMaybeDisposeOfInode(child, &err)
 
+	fileCacheHandler, cacheFileForRangeRead := fs.fileCacheFor(child)
+	fh := handle.NewFileHandle(child.(*inode.FileInode), fileCacheHandler, cacheFileForRangeRead, fs.zeroExtentHints, false, false, false)
+	if fs.lockFileTTL > 0 && !child.(*inode.FileInode).KeptLocal() {
+		if err = fh.AcquireLock(ctx); err != nil {
+			return lockError(child, err)
+		}
+	}
+
 	// Allocate a handle.
 	fs.mu.Lock()
 
 	handleID := fs.nextHandleID
 	fs.nextHandleID++
 
-	fs.handles[handleID] = handle.NewFileHandle(child.(*inode.FileInode), fs.fileCacheHandler, fs.cacheFileForRangeRead)
+	fs.handles[handleID] = fh
 	op.Handle = handleID
 
 	fs.mu.Unlock()
 
 	// Fill out the response.
-	e := &op.Entry
-	e.Child = child.ID()
-	e.Attributes, e.AttributesExpiration, err = fs.getAttributes(ctx, child)
+	err = fs.getEntry(ctx, child, &op.Entry)
 
 	if err != nil {
 		err = fmt.Errorf("getAttributes: %w", err)
@@ -1703,11 +2992,28 @@ func (fs *fileSystem) CreateSymlink(
 		ctx, cancel = util.IsolateContextFromParentContext(ctx)
 		defer cancel()
 	}
+	if err = fs.checkNotSuppressed(ctx, "CreateSymlink", op.Name); err != nil {
+		return
+	}
+
 	// Find the parent.
-	fs.mu.Lock()
+	fs.lockForOp(ctx)
 	parent := fs.dirInodeOrDie(op.Parent)
 	fs.mu.Unlock()
 
+	if err = checkNotControlName(parent, op.Name); err != nil {
+		return
+	}
+	if err = fs.checkChildName(parent, op.Name, false); err != nil {
+		return
+	}
+
+	// Don't let the deletion of an unlinked file of the same name delete the
+	// symlink.
+	if err = fs.pendingDeletes.waitName(ctx, parent.Name(), op.Name); err != nil {
+		return
+	}
+
 	// Create the object in GCS, failing if it already exists.
 	parent.Lock()
 	result, err := parent.CreateChildSymlink(ctx, op.Name, op.Target)
@@ -1738,9 +3044,7 @@ func (fs *fileSystem) CreateSymlink(
 	defer fs.unlockAndMaybeDisposeOfInode(child, &err)
 
 	// Fill out the response.
-	e := &op.Entry
-	e.Child = child.ID()
-	e.Attributes, e.AttributesExpiration, err = fs.getAttributes(ctx, child)
+	err = fs.getEntry(ctx, child, &op.Entry)
 
 	if err != nil {
 		err = fmt.Errorf("getAttributes: %w", err)
@@ -1774,10 +3078,20 @@ func (fs *fileSystem) RmDir(
 		defer cancel()
 	}
 	// Find the parent.
-	fs.mu.Lock()
+	fs.lockForOp(ctx)
 	parent := fs.dirInodeOrDie(op.Parent)
 	fs.mu.Unlock()
 
+	if err = checkNotControlName(parent, op.Name); err != nil {
+		return
+	}
+
+	// Wait for the deletions of the files unlinked from the directory. The
+	// files of those that failed are still there.
+	if err = fs.pendingDeletes.waitDir(ctx, inode.NewDirName(parent.Name(), op.Name)); err != nil {
+		return
+	}
+
 	// Find or create the child inode, locked.
 	child, err := fs.lookUpOrCreateChildInode(ctx, parent, op.Name)
 	if err != nil {
@@ -1853,6 +3167,10 @@ func (fs *fileSystem) RmDir(
 	_, isImplicitDir := fs.implicitDirInodes[child.Name()]
 	fs.mu.Unlock()
 	parent.Lock()
+	if err = fs.checkDirDeletion(ctx, parent, op.Name, isImplicitDir); err != nil {
+		parent.Unlock()
+		return err
+	}
 	err = parent.DeleteChildDir(ctx, op.Name, isImplicitDir)
 	parent.Unlock()
 
@@ -1864,6 +3182,32 @@ func (fs *fileSystem) RmDir(
 	return
 }
 
+// checkDirDeletion checks the plan of deleting the child directory of parent
+// with the given name with the mutation planner, if any, when it deletes more
+// than one object, i.e. the directory has a compat marker too.
+//
+// LOCKS_REQUIRED(parent)
+func (fs *fileSystem) checkDirDeletion(
+	ctx context.Context,
+	parent inode.DirInode,
+	name string,
+	isImplicitDir bool) error {
+	if fs.mutationPlanner == nil {
+		return nil
+	}
+
+	marker, err := parent.CompatDirMarkerOf(ctx, name)
+	if err != nil {
+		return fmt.Errorf("CompatDirMarkerOf: %w", err)
+	}
+
+	plan := inode.PlanDirDelete(inode.NewDirName(parent.Name(), name), isImplicitDir, marker)
+	if len(plan.Steps) < 2 {
+		return nil
+	}
+	return fs.mutationPlanner.Check(ctx, plan)
+}
+
 // LOCKS_EXCLUDED(fs.mu)
 func (fs *fileSystem) Rename(
 	ctx context.Context,
@@ -1876,11 +3220,18 @@ func (fs *fileSystem) Rename(
 		defer cancel()
 	}
 	// Find the old and new parents.
-	fs.mu.Lock()
+	fs.lockForOp(ctx)
 	oldParent := fs.dirInodeOrDie(op.OldParent)
 	newParent := fs.dirInodeOrDie(op.NewParent)
 	fs.mu.Unlock()
 
+	if err = checkNotControlName(oldParent, op.OldName); err != nil {
+		return
+	}
+	if err = checkNotControlName(newParent, op.NewName); err != nil {
+		return
+	}
+
 	if oldInode, ok := oldParent.(inode.BucketOwnedInode); !ok {
 		// The old parent is not owned by any bucket, which means it's the base
 		// directory that holds all the buckets' root directories. So, this op
@@ -1894,6 +3245,32 @@ func (fs *fileSystem) Rename(
 		}
 	}
 
+	if err = fs.checkNotSuppressed(ctx, "Rename", op.NewName); err != nil {
+		return
+	}
+
+	// Files unlinked a moment ago must not be renamed, nor be replaced by the
+	// rename.
+	if err = fs.pendingDeletes.waitName(ctx, newParent.Name(), op.NewName); err != nil {
+		return
+	}
+	if err = fs.pendingDeletes.waitDir(ctx, inode.NewDirName(oldParent.Name(), op.OldName)); err != nil {
+		return
+	}
+
+	// The copies made below must carry the times held back for the files
+	// being renamed.
+	if fs.timesUpdateDelay > 0 {
+		oldFile := inode.NewFileName(oldParent.Name(), op.OldName).LocalName()
+		oldDir := inode.NewDirName(oldParent.Name(), op.OldName).LocalName()
+		err = fs.flushPendingTimes(ctx, func(n inode.Name) bool {
+			return n.LocalName() == oldFile || strings.HasPrefix(n.LocalName(), oldDir)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
 	// If object to be renamed is a local file inode (un-synced), rename operation is not supported.
 	localChild := fs.lookUpLocalFileInode(oldParent, op.OldName)
 	if localChild != nil {
@@ -1916,12 +3293,85 @@ func (fs *fileSystem) Rename(
 		return err
 	}
 
+	// Renaming a name to itself does nothing, as does renaming to another name
+	// of the same object, e.g. from the conflict marker name of a file to its
+	// own name. Copying the object onto itself and deleting the source would
+	// delete it instead.
+	newFullName := inode.NewFileName(newParent.Name(), op.NewName)
+	if child.FullName.IsDir() {
+		newFullName = inode.NewDirName(newParent.Name(), op.NewName)
+	}
+	if newFullName.GcsObjectName() == child.FullName.GcsObjectName() {
+		return nil
+	}
+
+	// Check the destination before mutating anything, so that renames that
+	// can't succeed leave both names as they were.
+	if err = fs.checkChildName(newParent, op.NewName, child.FullName.IsDir()); err != nil {
+		return err
+	}
+	if err = fs.checkRenameDestination(ctx, child, newParent, op.NewName); err != nil {
+		return err
+	}
+
 	if child.FullName.IsDir() {
+		if child.Bucket.BucketType() == gcs.Hierarchical {
+			return fs.renameHierarchicalDir(ctx, oldParent, op.OldName, newParent, op.NewName)
+		}
 		return fs.renameDir(ctx, oldParent, op.OldName, newParent, op.NewName)
 	}
 	return fs.renameFile(ctx, oldParent, op.OldName, child.MinObject, newParent, op.NewName)
 }
 
+// Return the error that POSIX requires for renaming the supplied child to
+// newName in newParent, if any: EINVAL for moving a directory into itself or
+// one of its subdirectories, ENOTDIR for a directory over a file, EISDIR for a
+// file over a directory, and ENOTEMPTY for a directory over a non-empty one.
+//
+// LOCKS_EXCLUDED(fs.mu)
+// LOCKS_EXCLUDED(newParent)
+func (fs *fileSystem) checkRenameDestination(
+	ctx context.Context,
+	child *inode.Core,
+	newParent inode.DirInode,
+	newName string) error {
+	if child.FullName.IsDir() &&
+		strings.HasPrefix(newParent.Name().GcsObjectName(), child.FullName.GcsObjectName()) {
+		return fmt.Errorf("move %q into itself: %w", child.FullName, syscall.EINVAL)
+	}
+
+	newParent.Lock()
+	dest, err := newParent.LookUpChild(ctx, newName)
+	newParent.Unlock()
+	if err != nil {
+		return fmt.Errorf("LookUpChild: %w", err)
+	}
+
+	switch {
+	case dest == nil:
+		return nil
+	case child.FullName.IsDir() && !dest.FullName.IsDir():
+		return fuse.ENOTDIR
+	case !child.FullName.IsDir() && dest.FullName.IsDir():
+		return syscall.EISDIR
+	case dest.FullName.IsDir():
+		newDir, err := fs.lookUpOrCreateChildDirInode(ctx, newParent, newName)
+		if err != nil {
+			return fmt.Errorf("lookup new directory: %w", err)
+		}
+		unexpected, err := newDir.ReadDescendants(ctx, 1)
+		fs.unlockAndDecrementLookupCount(newDir, 1)
+		if err != nil {
+			return fmt.Errorf("read descendants of the new directory %q: %w", newName, err)
+		}
+		if len(unexpected) > 0 {
+			return fuse.ENOTEMPTY
+		}
+	}
+
+	return nil
+}
+
 // LOCKS_EXCLUDED(fs.mu)
 // LOCKS_EXCLUDED(oldParent)
 // LOCKS_EXCLUDED(newParent)
@@ -1934,7 +3384,7 @@ func (fs *fileSystem) renameFile(
 	newFileName string) error {
 	// Clone into the new location.
 	newParent.Lock()
-	_, err := newParent.CloneToChildFile(ctx, newFileName, oldObject)
+	clone, err := newParent.CloneToChildFile(ctx, newFileName, oldObject)
 	newParent.Unlock()
 
 	if err != nil {
@@ -1942,11 +3392,18 @@ func (fs *fileSystem) renameFile(
 		return err
 	}
 
+	// Only delete the source once the copy is known to hold its contents, so
+	// that a rename failing part way leaves both objects rather than neither.
+	if err = checkClone(oldObject, clone.MinObject); err != nil {
+		return err
+	}
+
 	// Delete behind. Make sure to delete exactly the generation we cloned, in
 	// case the referent of the name has changed in the meantime.
 	oldParent.Lock()
-	err = oldParent.DeleteChildFile(
+	err = fs.deleteChildFile(
 		ctx,
+		oldParent,
 		oldName,
 		oldObject.Generation,
 		&oldObject.MetaGeneration)
@@ -1965,6 +3422,20 @@ func (fs *fileSystem) renameFile(
 	return nil
 }
 
+// checkClone returns EIO if clone, a copy of src, isn't distinct from it or
+// doesn't have its size and checksum.
+func checkClone(src *gcs.MinObject, clone *gcs.MinObject) error {
+	switch {
+	case clone == nil || clone.Name == src.Name:
+		return fmt.Errorf("copy of %q is not a distinct object: %w", src.Name, syscall.EIO)
+	case clone.Size != src.Size:
+		return fmt.Errorf("copy %q of %q has %d bytes instead of %d: %w", clone.Name, src.Name, clone.Size, src.Size, syscall.EIO)
+	case clone.CRC32C != nil && src.CRC32C != nil && *clone.CRC32C != *src.CRC32C:
+		return fmt.Errorf("copy %q of %q has a different checksum: %w", clone.Name, src.Name, syscall.EIO)
+	}
+	return nil
+}
+
 // Rename an old directory to a new directory. If the new directory already
 // exists and is non-empty, return ENOTEMPTY.
 //
@@ -1990,6 +3461,19 @@ func (fs *fileSystem) renameDir(
 	}
 	defer releaseInodes()
 
+	// The compat marker of the old directory, if any, goes with it. Look it up
+	// for the plan before the old directory is locked.
+	var oldMarker string
+	if fs.mutationPlanner != nil {
+		oldParent.Lock()
+		marker, err := oldParent.CompatDirMarkerOf(ctx, oldName)
+		oldParent.Unlock()
+		if err != nil {
+			return fmt.Errorf("CompatDirMarkerOf: %w", err)
+		}
+		oldMarker = marker
+	}
+
 	// Get the inode of the old directory
 	oldDir, err := fs.lookUpOrCreateChildDirInode(ctx, oldParent, oldName)
 	if err != nil {
@@ -2014,6 +3498,28 @@ func (fs *fileSystem) renameDir(
 		return fmt.Errorf("too many objects to be renamed: %w", syscall.EMFILE)
 	}
 
+	// The descendants' names grow with the name of the directory, so make sure
+	// that all of them still fit before moving any.
+	newDirName := inode.NewDirName(newParent.Name(), newName)
+	for _, descendant := range descendants {
+		nameDiff := strings.TrimPrefix(
+			descendant.FullName.GcsObjectName(), oldDir.Name().GcsObjectName())
+		newDescendantName := inode.NewDescendantName(newDirName, newDirName.GcsObjectName()+nameDiff)
+		if err := inode.CheckObjectName(fs.objectNamePrefix, newDescendantName); err != nil {
+			return err
+		}
+	}
+
+	fs.mu.Lock()
+	_, isImplicitDir := fs.implicitDirInodes[oldDir.Name()]
+	fs.mu.Unlock()
+	if fs.mutationPlanner != nil {
+		plan := inode.PlanDirRename(oldDir.Name(), newDirName, descendants, isImplicitDir, oldMarker)
+		if err := fs.mutationPlanner.Check(ctx, plan); err != nil {
+			return err
+		}
+	}
+
 	// Create the backing object of the new directory.
 	newParent.Lock()
 	_, err = newParent.CreateChildDir(ctx, newName)
@@ -2044,8 +3550,11 @@ func (fs *fileSystem) renameDir(
 		return fuse.ENOTEMPTY
 	}
 
-	// Move all the files from the old directory to the new directory, keeping
-	// both directories locked.
+	// Copy all the files from the old directory to the new directory, keeping
+	// both directories locked, and then delete them from the old directory in
+	// parallel.
+	var nameDiffs []string
+	var deletes []*gcs.DeleteObjectRequest
 	for _, descendant := range descendants {
 		nameDiff := strings.TrimPrefix(
 			descendant.FullName.GcsObjectName(), oldDir.Name().GcsObjectName())
@@ -2057,21 +3566,38 @@ func (fs *fileSystem) renameDir(
 		if _, err := newDir.CloneToChildFile(ctx, nameDiff, o); err != nil {
 			return fmt.Errorf("copy file %q: %w", o.Name, err)
 		}
-		if err := oldDir.DeleteChildFile(ctx, nameDiff, o.Generation, &o.MetaGeneration); err != nil {
-			return fmt.Errorf("delete file %q: %w", o.Name, err)
+		nameDiffs = append(nameDiffs, nameDiff)
+		deletes = append(deletes, &gcs.DeleteObjectRequest{
+			Name:                       o.Name,
+			Generation:                 o.Generation,
+			MetaGenerationPrecondition: &o.MetaGeneration,
+		})
+	}
+
+	var deleteErr error
+	for i, err := range fs.deleter.DeleteObjects(ctx, oldDir.Bucket(), deletes) {
+		oldDir.InvalidateChild(nameDiffs[i])
+		if err != nil {
+			if deleteErr == nil {
+				deleteErr = fmt.Errorf("delete file %q: DeleteObject: %w", deletes[i].Name, err)
+			}
+			continue
 		}
 
-		if err = fs.invalidateChildFileCacheIfExist(oldDir, o.Name); err != nil {
-			return fmt.Errorf("Unlink: while invalidating cache for delete file: %w", err)
+		if err = fs.invalidateChildFileCacheIfExist(oldDir, deletes[i].Name); err != nil && deleteErr == nil {
+			deleteErr = fmt.Errorf("Unlink: while invalidating cache for delete file: %w", err)
 		}
 	}
+	if deleteErr != nil {
+		return deleteErr
+	}
 
 	// We are done with both directories.
 	releaseInodes()
 
 	// Delete the backing object of the old directory.
 	fs.mu.Lock()
-	_, isImplicitDir := fs.implicitDirInodes[oldDir.Name()]
+	_, isImplicitDir = fs.implicitDirInodes[oldDir.Name()]
 	fs.mu.Unlock()
 	oldParent.Lock()
 	err = oldParent.DeleteChildDir(ctx, oldName, isImplicitDir)
@@ -2083,52 +3609,185 @@ func (fs *fileSystem) renameDir(
 	return nil
 }
 
+// Rename an old directory to a new directory in a bucket with a hierarchical
+// namespace, atomically renaming the folder backing it. The new directory, if
+// it exists, must be empty.
+//
 // LOCKS_EXCLUDED(fs.mu)
-func (fs *fileSystem) Unlink(
+// LOCKS_EXCLUDED(oldParent)
+// LOCKS_EXCLUDED(newParent)
+func (fs *fileSystem) renameHierarchicalDir(
 	ctx context.Context,
-	op *fuseops.UnlinkOp) (err error) {
-	if fs.mountConfig.FileSystemConfig.IgnoreInterrupts {
-		// When ignore interrupts config is set, we are creating a new context not
-		// cancellable by parent context.
-		var cancel context.CancelFunc
-		ctx, cancel = util.IsolateContextFromParentContext(ctx)
-		defer cancel()
+	oldParent inode.DirInode,
+	oldName string,
+	newParent inode.DirInode,
+	newName string) error {
+	// Get the inode of the old directory
+	oldDir, err := fs.lookUpOrCreateChildDirInode(ctx, oldParent, oldName)
+	if err != nil {
+		return fmt.Errorf("lookup old directory: %w", err)
 	}
-	// Find the parent.
+
+	// If old directory contains local (un-synced) files, rename operation is not supported.
 	fs.mu.Lock()
-	parent := fs.dirInodeOrDie(op.Parent)
+	entries := oldDir.LocalFileEntries(fs.localFileInodes)
 	fs.mu.Unlock()
+	fs.unlockAndDecrementLookupCount(oldDir, 1)
+	if len(entries) != 0 {
+		return fmt.Errorf("can't rename directory %s with open files: %w", oldName, syscall.ENOTSUP)
+	}
 
-	// if inode is a local file, mark it unlinked.
-	fileName := inode.NewFileName(parent.Name(), op.Name)
-	fs.mu.Lock()
-	fileInode, ok := fs.localFileInodes[fileName]
-	if ok {
-		file := fs.fileInodeOrDie(fileInode.ID())
-		fs.mu.Unlock()
-		file.Lock()
-		defer file.Unlock()
-		file.Unlink()
-		return
+	// A folder can't be renamed over another one, so an empty new directory
+	// has to be deleted first. Rename has checked that it's empty.
+	newParent.Lock()
+	newChild, err := newParent.LookUpChild(ctx, newName)
+	newParent.Unlock()
+	if err != nil {
+		return fmt.Errorf("LookUpChild: %w", err)
 	}
-	fs.mu.Unlock()
 
-	// else delete the backing object present on GCS.
-	parent.Lock()
+	if newChild != nil && newChild.FullName.IsDir() {
+		newParent.Lock()
+		err = newParent.DeleteChildDir(ctx, newName, newChild.MinObject == nil)
+		newParent.Unlock()
+		if err != nil {
+			return fmt.Errorf("DeleteChildDir: %w", err)
+		}
+	}
+
+	// Rename the folder of the old directory, and everything under it.
+	oldDirName := inode.NewDirName(oldParent.Name(), oldName)
+	newParent.Lock()
+	_, err = newParent.RenameFolder(ctx, oldDirName.GcsObjectName(), newName)
+	newParent.Unlock()
+
+	// The old directory is gone from the old parent, even if the rename failed
+	// part way.
+	oldParent.Lock()
+	oldParent.InvalidateChild(oldName)
+	oldParent.Unlock()
+
+	if err != nil {
+		return fmt.Errorf("RenameFolder: %w", err)
+	}
+
+	return nil
+}
+
+// LOCKS_EXCLUDED(fs.mu)
+func (fs *fileSystem) Unlink(
+	ctx context.Context,
+	op *fuseops.UnlinkOp) (err error) {
+	if fs.mountConfig.FileSystemConfig.IgnoreInterrupts {
+		// When ignore interrupts config is set, we are creating a new context not
+		// cancellable by parent context.
+		var cancel context.CancelFunc
+		ctx, cancel = util.IsolateContextFromParentContext(ctx)
+		defer cancel()
+	}
+	// Find the parent.
+	fs.lockForOp(ctx)
+	parent := fs.dirInodeOrDie(op.Parent)
+	fs.mu.Unlock()
+
+	if err = checkNotControlName(parent, op.Name); err != nil {
+		return
+	}
+
+	// if inode is a local file, mark it unlinked.
+	fileName := inode.NewFileName(parent.Name(), op.Name)
+	fs.mu.Lock()
+	fileInode, ok := fs.localFileInodes[fileName]
+	if ok {
+		file := fs.fileInodeOrDie(fileInode.ID())
+		fs.mu.Unlock()
+		file.Lock()
+		file.Unlink()
+		file.Unlock()
+
+		parent.Lock()
+		parent.InvalidateChild(op.Name)
+		parent.Unlock()
+		return
+	}
+	// An inode of the file that is still in use, whose contents must not be
+	// uploaded after the object is deleted.
+	file, _ := fs.generationBackedInodes[fileName].(*inode.FileInode)
+	fs.mu.Unlock()
+
+	// else delete the backing object present on GCS.
+	err = fs.unlinkObject(ctx, parent, op.Name)
+	if err != nil {
+		return
+	}
+
+	// Cancel any upload pending for the file, and let its staged contents go
+	// once it is forgotten.
+	if file != nil {
+		file.Lock()
+		file.Unlink()
+		file.Unlock()
+	}
+
+	return
+}
+
+// Delete the backing object of the named child file of the supplied parent.
+//
+// LOCKS_EXCLUDED(fs.mu)
+// LOCKS_EXCLUDED(parent)
+func (fs *fileSystem) unlinkObject(
+	ctx context.Context,
+	parent inode.DirInode,
+	name string) (err error) {
+	parent.Lock()
 	defer parent.Unlock()
 
+	// A name the type cache knows to be missing fails without asking GCS. See
+	// ServerConfig.StrictUnlink.
+	if !fs.strictUnlink && parent.ChildKnownMissing(name) {
+		return syscall.ENOENT
+	}
+
+	// The unlink of a name known to be a file may not wait for the deletion.
+	// See ServerConfig.AsyncUnlink.
+	if fs.asyncUnlink && parent.ChildKnownFile(name) {
+		// Such unlinks make up the deletion of a tree by rm -r, so they are
+		// planned.
+		if fs.mutationPlanner != nil {
+			plan := inode.PlanUnlink(inode.NewFileName(parent.Name(), name))
+			if err = fs.mutationPlanner.Check(ctx, plan); err != nil {
+				return err
+			}
+		}
+
+		parent.InvalidateChild(name)
+		ctx, cancel := util.IsolateContextFromParentContext(ctx)
+		fs.pendingDeletes.start(parent.Name(), name, func() {
+			defer cancel()
+			fs.deleteUnlinkedObject(ctx, parent, name)
+		})
+		return
+	}
+
 	// Delete the backing object.
-	err = parent.DeleteChildFile(
+	err = fs.deleteChildFile(
 		ctx,
-		op.Name,
+		parent,
+		name,
 		0,   // Latest generation
 		nil) // No meta-generation precondition
 
+	var notFoundErr *gcs.NotFoundError
+	if errors.As(err, &notFoundErr) {
+		return syscall.ENOENT
+	}
 	if err != nil {
 		err = fmt.Errorf("DeleteChildFile: %w", err)
 		return err
 	}
 
+	fileName := inode.NewFileName(parent.Name(), name)
 	if err := fs.invalidateChildFileCacheIfExist(parent, fileName.GcsObjectName()); err != nil {
 		return fmt.Errorf("Unlink: while invalidating cache for delete file: %w", err)
 	}
@@ -2136,36 +3795,84 @@ func (fs *fileSystem) Unlink(
 	return
 }
 
+// Delete the backing object of the named child file of the supplied parent,
+// which was unlinked already, logging a failure since the unlink has returned.
+// An object that is gone already isn't an error, as the name was there when
+// the kernel looked it up.
+//
+// LOCKS_EXCLUDED(fs.mu)
+// LOCKS_EXCLUDED(parent)
+func (fs *fileSystem) deleteUnlinkedObject(
+	ctx context.Context,
+	parent inode.DirInode,
+	name string) {
+	objectName := inode.NewFileName(parent.Name(), name).GcsObjectName()
+	err := fs.deleter.DeleteObject(ctx, parent.(inode.BucketOwnedDirInode).Bucket(), &gcs.DeleteObjectRequest{
+		Name:               objectName,
+		TrustNegativeCache: true,
+	})
+	var notFoundErr *gcs.NotFoundError
+	if err != nil && !errors.As(err, &notFoundErr) {
+		logger.Warnf("Unlinked %q, but deleting its object failed, so it shows up again: %v", objectName, err)
+		return
+	}
+
+	parent.Lock()
+	defer parent.Unlock()
+	parent.InvalidateChild(name)
+	if err := fs.invalidateChildFileCacheIfExist(parent, objectName); err != nil {
+		logger.Warnf("Unlink: while invalidating cache for delete file %q: %v", objectName, err)
+	}
+}
+
 // LOCKS_EXCLUDED(fs.mu)
 func (fs *fileSystem) OpenDir(
 	ctx context.Context,
 	op *fuseops.OpenDirOp) (err error) {
-	fs.mu.Lock()
-	defer fs.mu.Unlock()
+	fs.lockForOp(ctx)
 
 	// Make sure the inode still exists and is a directory. If not, something has
 	// screwed up because the VFS layer shouldn't have let us forget the inode
 	// before opening it.
 	in := fs.dirInodeOrDie(op.Inode)
+	fs.mu.Unlock()
+
+	// The listing mustn't show files unlinked before it.
+	if err = fs.pendingDeletes.waitDir(ctx, in.Name()); err != nil {
+		return
+	}
+
+	// The inode lock comes before fs.mu, so the inode is looked at before
+	// taking fs.mu again to allocate the handle.
+	in.RLock()
+
+	// A directory we were recently forbidden to list, such as a managed folder
+	// the caller has no permissions on, fails without asking GCS again.
+	denied := in.ListDenied()
+
+	// Invalidates the kernel list-cache once the last cached response is out of
+	// kernelListCacheTTL.
+	keepCache := fs.kernelListCacheTTL > 0 && !in.ShouldInvalidateKernelListCache(fs.kernelListCacheTTL)
+	in.RUnlock()
+
+	if denied {
+		err = syscall.EACCES
+		return
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
 
 	// Allocate a handle.
 	handleID := fs.nextHandleID
 	fs.nextHandleID++
 
-	fs.handles[handleID] = handle.NewDirHandle(in, fs.implicitDirs)
+	fs.handles[handleID] = handle.NewDirHandle(in, fs.implicitDirs, fs.mountConfig.ListConfig.IsSuppressedName)
 	op.Handle = handleID
 
 	// Enables kernel list-cache in case of non-zero kernelListCacheTTL.
 	if fs.kernelListCacheTTL > 0 {
-
-		// Taking RLock() since ShouldInvalidateKernelListCache only reads the DirInode
-		// properties, no modification.
-		in.RLock()
-		// Invalidates the kernel list-cache once the last cached response is out of
-		// kernelListCacheTTL.
-		op.KeepCache = !in.ShouldInvalidateKernelListCache(fs.kernelListCacheTTL)
-		in.RUnlock()
-
+		op.KeepCache = keepCache
 		op.CacheDir = true
 	}
 	return
@@ -2183,7 +3890,7 @@ func (fs *fileSystem) ReadDir(
 		defer cancel()
 	}
 	// Find the handle.
-	fs.mu.Lock()
+	fs.lockForOp(ctx)
 	dh := fs.handles[op.Handle].(*handle.DirHandle)
 	in := fs.dirInodeOrDie(op.Inode)
 	// Fetch local file entries beforehand and pass it to directory handle as
@@ -2205,7 +3912,7 @@ func (fs *fileSystem) ReadDir(
 func (fs *fileSystem) ReleaseDirHandle(
 	ctx context.Context,
 	op *fuseops.ReleaseDirHandleOp) (err error) {
-	fs.mu.Lock()
+	fs.lockForOp(ctx)
 	defer fs.mu.Unlock()
 
 	// Sanity check that this handle exists and is of the correct type.
@@ -2221,28 +3928,235 @@ func (fs *fileSystem) ReleaseDirHandle(
 func (fs *fileSystem) OpenFile(
 	ctx context.Context,
 	op *fuseops.OpenFileOp) (err error) {
-	fs.mu.Lock()
-	defer fs.mu.Unlock()
-
 	// Find the inode.
+	fs.lockForOp(ctx)
+	if c, ok := fs.inodes[op.Inode].(*inode.ControlFileInode); ok {
+		fs.mu.Unlock()
+		return fs.openControlFile(ctx, c, op)
+	}
 	in := fs.fileInodeOrDie(op.Inode)
+	fs.mu.Unlock()
+
+	if err = fs.takeUploadError(in); err != nil {
+		return
+	}
+
+	// The kernel may still hold an entry for a file whose object was found
+	// deleted, which can't be invalidated, so the open fails instead.
+	if fs.checkObjectDeleted(ctx, in) {
+		return fuse.ENOENT
+	}
+
+	fs.loadDirConfigs(ctx, in)
+
+	fileCacheHandler, cacheFileForRangeRead := fs.fileCacheFor(in)
+
+	in.Lock()
+	if in.FlushTimedOut() {
+		logger.Warnf("%q has local contents that timed out flushing and aren't in GCS yet. They are kept in %q.",
+			in.Name().GcsObjectName(), in.StagedFilePath())
+	}
+
+	// The file cache is used without asking GCS whether the object has moved on
+	// while the lookup that found the inode's generation would still be
+	// answered by the metadata cache, and only once it wouldn't be is the
+	// object stat'd first.
+	validateSource := fileCacheHandler != nil && !in.IsLocal() &&
+		fs.cacheClock.Now().Sub(in.SourceConfirmed()) >= fs.recordsTTL(in)
+	in.Unlock()
+
+	syncOnFlush := uint32(op.OpenFlags)&(syscall.O_SYNC|syscall.O_DSYNC) != 0
+	fh := handle.NewFileHandle(in, fileCacheHandler, cacheFileForRangeRead, fs.zeroExtentHints, syncOnFlush, op.OpenFlags.IsReadOnly(), validateSource)
+
+	// Writers take the lock object before the first write.
+	if fs.lockFileTTL > 0 && !op.OpenFlags.IsReadOnly() {
+		in.Lock()
+		if !in.KeptLocal() {
+			err = fh.AcquireLock(ctx)
+		}
+		in.Unlock()
+
+		if err != nil {
+			return lockError(in, err)
+		}
+	}
 
 	// Allocate a handle.
+	fs.mu.Lock()
 	handleID := fs.nextHandleID
 	fs.nextHandleID++
 
-	fs.handles[handleID] = handle.NewFileHandle(in, fs.fileCacheHandler, fs.cacheFileForRangeRead)
+	fs.handles[handleID] = fh
 	op.Handle = handleID
+	fs.mu.Unlock()
 
 	// When we observe object generations that we didn't create, we assign them
-	// new inode IDs. So for a given inode, all modifications go through the
-	// kernel. Therefore it's safe to tell the kernel to keep the page cache from
-	// open to open for a given inode.
-	op.KeepPageCache = true
+	// new inode IDs, so for a given inode all modifications normally go through
+	// the kernel and it's safe to keep the page cache from open to open. The
+	// inode tracks the generation the page cache reflects, which stops matching
+	// when e.g. a sync finds that the object was clobbered.
+	switch fs.kernelPageCache {
+	case config.KernelPageCacheAlways:
+		op.KeepPageCache = true
+	case config.KernelPageCacheNever:
+		op.KeepPageCache = false
+	default:
+		in.Lock()
+		op.KeepPageCache = in.RecordOpen()
+		in.Unlock()
+	}
+
+	return
+}
+
+// Return the names of the control files listed in the control directory: those
+// not named by the queries they answer.
+func (fs *fileSystem) listedControlFiles() []string {
+	if fs.metadataQueryMaxObjects == 0 {
+		return nil
+	}
+	return []string{inode.QueryFile}
+}
+
+// Open the supplied control file, answering its query, or, for the query file,
+// readying it to answer the queries written to it.
+//
+// LOCKS_EXCLUDED(fs.mu)
+func (fs *fileSystem) openControlFile(
+	ctx context.Context,
+	c *inode.ControlFileInode,
+	op *fuseops.OpenFileOp) (err error) {
+	var ch *handle.ControlHandle
+	switch c.File() {
+	case inode.ObjectInfoFile:
+		if !op.OpenFlags.IsReadOnly() {
+			return fmt.Errorf("%q is read-only: %w", c.Name(), syscall.EACCES)
+		}
+
+		var contents []byte
+		contents, err = fs.objectInfo(ctx, c.Root(), c.Query().Get("path"))
+		if err != nil {
+			return
+		}
+		ch = handle.NewControlHandle(contents)
+
+	case inode.QueryFile:
+		root := c.Root()
+		ch = handle.NewQueryHandle(func(ctx context.Context, query string) ([]byte, error) {
+			return fs.answerMetadataFileQuery(ctx, root, query)
+		})
+
+	default:
+		panic(fmt.Sprintf("Unexpected control file: %q", c.File()))
+	}
+
+	fs.mu.Lock()
+	handleID := fs.nextHandleID
+	fs.nextHandleID++
+
+	fs.handles[handleID] = ch
+	op.Handle = handleID
+	fs.mu.Unlock()
+
+	// The answer differs from open to open, and is longer than the file's size
+	// of zero, which mustn't cut reads short.
+	op.UseDirectIO = true
+	return
+}
+
+// Return the contents of the objectinfo control file for the supplied path
+// relative to root: the name of the object and, for a file whose contents are
+// those of a generation, its generation attributes, each on a line of its own
+// as key=value, with the keys named after the extended attributes.
+//
+// LOCKS_EXCLUDED(fs.mu)
+// LOCKS_EXCLUDED(root)
+func (fs *fileSystem) objectInfo(
+	ctx context.Context,
+	root inode.DirInode,
+	path string) ([]byte, error) {
+	in, err := fs.lookUpPath(ctx, root, path)
+	if err != nil {
+		return nil, err
+	}
+	defer fs.unlockAndDecrementLookupCount(in, 1)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "name=%s\n", in.Name().GcsObjectName())
+	if file, ok := in.(*inode.FileInode); ok {
+		xattrs := file.Xattrs()
+		for _, name := range inode.XattrNames {
+			if value, ok := xattrs[name]; ok {
+				fmt.Fprintf(&b, "%s=%s\n", strings.TrimPrefix(name, inode.XattrPrefix), value)
+			}
+		}
+	}
+	return []byte(b.String()), nil
+}
+
+// Look up the inode at the supplied slash-separated path relative to dir, one
+// name at a time as the kernel does. Return it locked, incrementing its lookup
+// count.
+//
+// LOCKS_EXCLUDED(fs.mu)
+// LOCKS_EXCLUDED(dir)
+// LOCK_FUNCTION(in)
+func (fs *fileSystem) lookUpPath(
+	ctx context.Context,
+	dir inode.DirInode,
+	path string) (in inode.Inode, err error) {
+	dir.Lock()
+	dir.IncrementLookupCount()
+	in = dir
+
+	for _, name := range strings.Split(path, "/") {
+		if name == "" || name == "." {
+			continue
+		}
+
+		parent, ok := in.(inode.DirInode)
+		switch {
+		case !ok:
+			err = fmt.Errorf("look up %q: %w", path, syscall.ENOTDIR)
+		case name == "..":
+			err = fmt.Errorf("look up %q: %w", path, syscall.EINVAL)
+		}
+		if err != nil {
+			fs.unlockAndDecrementLookupCount(in, 1)
+			return nil, err
+		}
+
+		// Hold on to the parent while its child is looked up, without holding
+		// both of their locks at once.
+		parent.Unlock()
+		var child inode.Inode
+		child, err = fs.lookUpOrCreateChildInode(ctx, parent, name)
+		if child != nil {
+			child.Unlock()
+		}
+
+		parent.Lock()
+		fs.unlockAndDecrementLookupCount(parent, 1)
+		if err != nil {
+			return nil, err
+		}
+
+		child.Lock()
+		in = child
+	}
 
 	return
 }
 
+// lockError converts an error from acquiring the lock object of the given file
+// to one that maps to EAGAIN when another writer holds the lock.
+func lockError(in inode.Inode, err error) error {
+	if errors.Is(err, inode.ErrLockHeld) {
+		return fmt.Errorf("%q: %v: %w", in.Name().GcsObjectName(), err, syscall.EAGAIN)
+	}
+	return fmt.Errorf("AcquireLock: %w", err)
+}
+
 // LOCKS_EXCLUDED(fs.mu)
 func (fs *fileSystem) ReadFile(
 	ctx context.Context,
@@ -2258,7 +4172,12 @@ func (fs *fileSystem) ReadFile(
 	ctx = context.WithValue(ctx, gcsx.ReadOp, op)
 
 	// Find the handle and lock it.
-	fs.mu.Lock()
+	fs.lockForOp(ctx)
+	if ch, ok := fs.handles[op.Handle].(*handle.ControlHandle); ok {
+		fs.mu.Unlock()
+		op.BytesRead, err = ch.Read(ctx, op.Dst, op.Offset)
+		return
+	}
 	fh := fs.handles[op.Handle].(*handle.FileHandle)
 	fs.mu.Unlock()
 
@@ -2266,22 +4185,101 @@ func (fs *fileSystem) ReadFile(
 	defer fh.Unlock()
 
 	// Serve the read.
-	op.BytesRead, err = fh.Read(ctx, op.Dst, op.Offset, fs.sequentialReadSizeMb)
+	sequentialReadSizeMb := fs.dirConfig(fh.Inode()).SequentialReadSize(fs.sequentialReadSizeMb)
+	op.BytesRead, err = fh.Read(ctx, op.Dst, op.Offset, sequentialReadSizeMb)
+	if err != nil && err != io.EOF && fs.mmapReadRetries > 0 && isPageIn(op) {
+		op.BytesRead, err = fs.retryPageIn(ctx, fh, op, sequentialReadSizeMb, err)
+	}
 
 	// As required by fuse, we don't treat EOF as an error.
 	if err == io.EOF {
 		err = nil
 	}
 
+	// The read may have failed because the object was deleted.
+	if err != nil {
+		fs.checkObjectDeleted(ctx, fh.Inode())
+	}
+
 	return
 }
 
+// How long the first retry of a failed page-in waits, each further retry
+// waiting twice as long as the previous one.
+const mmapReadRetryBackoff = 100 * time.Millisecond
+
+// isPageIn returns whether a read looks like the kernel filling its page
+// cache, e.g. for an application that mmaps the file: page-aligned, of whole
+// pages.
+func isPageIn(op *fuseops.ReadFileOp) bool {
+	pageSize := os.Getpagesize()
+	return op.Offset%int64(pageSize) == 0 && len(op.Dst) > 0 && len(op.Dst)%pageSize == 0
+}
+
+// retryPageIn retries a page-in read that failed with err, up to
+// fs.mmapReadRetries times while it fails with transient errors, backing off
+// between attempts. The handle is unlocked while backing off, so that other
+// reads of it go on.
+//
+// Interrupts don't cut the retries short: the Go runtime alone interrupts the
+// threads of Go applications many times a second to preempt goroutines, and
+// the kernel goes on waiting for the page all the same. The retries are only
+// given up once the op is cancelled and the process that asked for the page
+// is gone.
+//
+// LOCKS_REQUIRED(fh)
+func (fs *fileSystem) retryPageIn(
+	ctx context.Context,
+	fh *handle.FileHandle,
+	op *fuseops.ReadFileOp,
+	sequentialReadSizeMb int32,
+	err error) (n int, _ error) {
+	readCtx, cancel := util.IsolateContextFromParentContext(ctx)
+	defer cancel()
+
+	backoff := mmapReadRetryBackoff
+	retries := 0
+	for ; retries < fs.mmapReadRetries && storageutil.ShouldRetry(err); retries++ {
+		fh.Unlock()
+		time.Sleep(backoff)
+		fh.Lock()
+		if ctx.Err() != nil && processGone(op.OpContext.Pid) {
+			return 0, ctx.Err()
+		}
+		backoff *= 2
+
+		n, err = fh.Read(readCtx, op.Dst, op.Offset, sequentialReadSizeMb)
+		if err == nil || err == io.EOF {
+			logger.Infof("Read of %q at offset %d succeeded on retry %d.", fh.Inode().Name().GcsObjectName(), op.Offset, retries+1)
+			return n, err
+		}
+	}
+
+	logger.Warnf(
+		"Read of %q at offset %d failed after %d retries. If it was a page-in for an mmap of the file, the application gets SIGBUS: %v",
+		fh.Inode().Name().GcsObjectName(),
+		op.Offset,
+		retries,
+		err)
+
+	return n, err
+}
+
+// processGone returns whether the process with the given id has exited. An
+// unknown process, with id zero, is never gone.
+func processGone(pid uint32) bool {
+	if pid == 0 {
+		return false
+	}
+	return errors.Is(syscall.Kill(int(pid), 0), syscall.ESRCH)
+}
+
 // LOCKS_EXCLUDED(fs.mu)
 func (fs *fileSystem) ReadSymlink(
 	ctx context.Context,
 	op *fuseops.ReadSymlinkOp) (err error) {
 	// Find the inode.
-	fs.mu.Lock()
+	fs.lockForOp(ctx)
 	in := fs.symlinkInodeOrDie(op.Inode)
 	fs.mu.Unlock()
 
@@ -2305,11 +4303,25 @@ func (fs *fileSystem) WriteFile(
 		ctx, cancel = util.IsolateContextFromParentContext(ctx)
 		defer cancel()
 	}
-	// Find the inode.
-	fs.mu.Lock()
+	// Find the inode, and the handle if any: with the writeback cache, the
+	// kernel may write without one.
+	fs.lockForOp(ctx)
+	if ch, ok := fs.handles[op.Handle].(*handle.ControlHandle); ok {
+		fs.mu.Unlock()
+		return ch.Write(op.Data)
+	}
 	in := fs.fileInodeOrDie(op.Inode)
+	fh, _ := fs.handles[op.Handle].(*handle.FileHandle)
 	fs.mu.Unlock()
 
+	if err = fs.takeUploadError(in); err != nil {
+		return
+	}
+
+	if err = fs.stagingSpace.check(ctx, "WriteFile"); err != nil {
+		return
+	}
+
 	in.Lock()
 	defer in.Unlock()
 
@@ -2318,6 +4330,69 @@ func (fs *fileSystem) WriteFile(
 		return err
 	}
 
+	if fh != nil {
+		fh.RecordWrite(len(op.Data))
+	}
+
+	return
+}
+
+// Whole files are copied server-side, as long as the source is in sync with
+// its object and the destination is empty, so that none of their bytes pass
+// through gcsfuse. Anything else fails with EOPNOTSUPP, on which the kernel
+// copies through reads and writes.
+//
+// LOCKS_EXCLUDED(fs.mu)
+func (fs *fileSystem) CopyFileRange(
+	ctx context.Context,
+	op *fuseops.CopyFileRangeOp) (err error) {
+	if fs.mountConfig.FileSystemConfig.IgnoreInterrupts {
+		// When ignore interrupts config is set, we are creating a new context not
+		// cancellable by parent context.
+		var cancel context.CancelFunc
+		ctx, cancel = util.IsolateContextFromParentContext(ctx)
+		defer cancel()
+	}
+
+	// Find the inodes.
+	fs.lockForOp(ctx)
+	src, srcOk := fs.inodeOrDie(op.SrcInode).(*inode.FileInode)
+	dst, dstOk := fs.inodeOrDie(op.DstInode).(*inode.FileInode)
+	fs.mu.Unlock()
+
+	if !srcOk || !dstOk || src == dst || op.SrcOffset != 0 || op.DstOffset != 0 {
+		return syscall.EOPNOTSUPP
+	}
+	if src.Bucket().Name() != dst.Bucket().Name() {
+		return syscall.EOPNOTSUPP
+	}
+
+	// Take the object the source is in sync with. The inodes are locked one at
+	// a time, and the copy fails if the object changes meanwhile.
+	src.Lock()
+	o := src.Source()
+	inSync := !src.IsLocal() && src.SourceGenerationIsAuthoritative()
+	src.Unlock()
+
+	// The kernel takes the number of bytes copied in 32 bits.
+	if !inSync || o.Size > op.Length || o.Size > math.MaxUint32 {
+		return syscall.EOPNOTSUPP
+	}
+
+	dst.Lock()
+	defer dst.Unlock()
+
+	wasLocal := dst.IsLocal()
+	copied, err := dst.CopyFrom(ctx, o)
+	if err != nil {
+		return fmt.Errorf("CopyFrom: %w", err)
+	}
+	if !copied {
+		return syscall.EOPNOTSUPP
+	}
+	fs.recordSynced(ctx, dst, wasLocal)
+
+	op.BytesCopied = o.Size
 	return
 }
 
@@ -2333,7 +4408,7 @@ func (fs *fileSystem) SyncFile(
 		defer cancel()
 	}
 	// Find the inode.
-	fs.mu.Lock()
+	fs.lockForOp(ctx)
 	in := fs.inodeOrDie(op.Inode)
 	fs.mu.Unlock()
 
@@ -2343,6 +4418,10 @@ func (fs *fileSystem) SyncFile(
 		return
 	}
 
+	if err = fs.takeUploadError(file); err != nil {
+		return
+	}
+
 	file.Lock()
 	defer file.Unlock()
 
@@ -2365,19 +4444,41 @@ func (fs *fileSystem) FlushFile(
 		ctx, cancel = util.IsolateContextFromParentContext(ctx)
 		defer cancel()
 	}
-	// Find the inode.
-	fs.mu.Lock()
+	// Find the inode and the handle. Control files have nothing to flush.
+	fs.lockForOp(ctx)
+	if _, ok := fs.handles[op.Handle].(*handle.ControlHandle); ok {
+		fs.mu.Unlock()
+		return
+	}
 	in := fs.fileInodeOrDie(op.Inode)
+	fh := fs.handles[op.Handle].(*handle.FileHandle)
 	fs.mu.Unlock()
 
+	if err = fs.takeUploadError(in); err != nil {
+		return
+	}
+
 	in.Lock()
 	defer in.Unlock()
 
+	// Until the upload succeeds, the staged contents are all there is.
+	in.RecordClose()
+
+	if fs.uploadManager != nil && !fh.SyncOnFlush() {
+		fs.uploadInBackground(in, fh.HandOverLock())
+		return
+	}
+
 	// Sync it.
-	if err := fs.syncFile(ctx, in); err != nil {
+	if err := fs.flushFile(ctx, in); err != nil {
 		return err
 	}
 
+	// The contents are safely in GCS, so other writers may proceed.
+	if err := fh.ReleaseLock(ctx); err != nil {
+		return fmt.Errorf("ReleaseLock: %w", err)
+	}
+
 	return
 }
 
@@ -2385,26 +4486,369 @@ func (fs *fileSystem) FlushFile(
 func (fs *fileSystem) ReleaseFileHandle(
 	ctx context.Context,
 	op *fuseops.ReleaseFileHandleOp) (err error) {
-	fs.mu.Lock()
-	defer fs.mu.Unlock()
-
-	// Destroy the handle.
-	fs.handles[op.Handle].(*handle.FileHandle).Destroy()
+	fs.lockForOp(ctx)
+	h := fs.handles[op.Handle]
 
 	// Update the map.
 	delete(fs.handles, op.Handle)
+	fs.mu.Unlock()
+
+	// Control handles hold nothing to release.
+	fh, ok := h.(*handle.FileHandle)
+	if !ok {
+		_ = h.(*handle.ControlHandle)
+		return
+	}
+
+	// Drop the lock object if no flush did, e.g. because syncing failed. Most
+	// handles hold none, and needn't wait for the inode for that.
+	in := fh.Inode()
+	if fh.HoldsLock() {
+		in.Lock()
+		if err = fh.ReleaseLock(ctx); err != nil {
+			err = fmt.Errorf("ReleaseLock: %w", err)
+		}
+		in.Unlock()
+	}
+
+	// Destroy the handle.
+	fh.Destroy()
+
+	fs.patternDetector.Observe(ctx, in.Name().GcsObjectName(), fh.Stats())
 
 	return
 }
 
+// fileXattrs returns the extended attributes of the given inode, which are
+// those of inode.FileInode.Xattrs for files and none for other inodes.
+//
+// LOCKS_EXCLUDED(fs.mu)
+func (fs *fileSystem) fileXattrs(id fuseops.InodeID) map[string]string {
+	fs.mu.Lock()
+	in := fs.inodeOrDie(id)
+	fs.mu.Unlock()
+
+	file, ok := in.(*inode.FileInode)
+	if !ok {
+		return nil
+	}
+
+	file.Lock()
+	defer file.Unlock()
+	return file.Xattrs()
+}
+
+// The largest value of an extended attribute the kernel accepts.
+const maxXattrSize = 64 << 10
+
+// Return the value of the glob extended attribute of the directory with the
+// given pattern: the matching names, each followed by a newline.
+//
+// LOCKS_EXCLUDED(fs.mu)
+func (fs *fileSystem) globXattr(
+	ctx context.Context,
+	id fuseops.InodeID,
+	pattern string) (value string, err error) {
+	fs.mu.Lock()
+	in := fs.inodeOrDie(id)
+	fs.mu.Unlock()
+
+	dir, ok := in.(inode.DirInode)
+	if !ok {
+		return "", fuse.ENOATTR
+	}
+
+	if _, err = storageutil.CompileGlob(pattern); err != nil {
+		return "", fmt.Errorf("glob %q: %w", pattern, syscall.EINVAL)
+	}
+
+	dir.Lock()
+	names, err := dir.ListMatching(ctx, pattern, maxXattrSize)
+	dir.Unlock()
+	if err != nil {
+		return
+	}
+
+	var b strings.Builder
+	for _, name := range names {
+		b.WriteString(name)
+		b.WriteByte('\n')
+	}
+	return b.String(), nil
+}
+
+// The line ending the value of a metadata extended attribute whose query was
+// cut short. Object names are never empty, so an empty line can't be a match.
+const metadataQueryTruncatedMarker = "\n"
+
+// Return the value of the metadata extended attribute of the directory with
+// the given query: the matching names, each followed by a newline, and then
+// metadataQueryTruncatedMarker if the query was cut short.
+//
+// LOCKS_EXCLUDED(fs.mu)
+func (fs *fileSystem) metadataXattr(
+	ctx context.Context,
+	id fuseops.InodeID,
+	query string) (value string, err error) {
+	if fs.metadataQueryMaxObjects == 0 {
+		return "", fuse.ENOATTR
+	}
+
+	fs.mu.Lock()
+	in := fs.inodeOrDie(id)
+	fs.mu.Unlock()
+
+	dir, ok := in.(inode.DirInode)
+	if !ok {
+		return "", fuse.ENOATTR
+	}
+
+	q, err := inode.ParseMetadataQuery(query)
+	if err != nil {
+		return "", fmt.Errorf("metadata query %q: %w", query, syscall.EINVAL)
+	}
+
+	return fs.queryMetadata(ctx, dir, q, "", maxXattrSize)
+}
+
+// Return the answer to a query written to the query control file: the paths
+// relative to root of the matching objects, as for queryMetadata.
+//
+// LOCKS_EXCLUDED(fs.mu)
+// LOCKS_EXCLUDED(root)
+func (fs *fileSystem) answerMetadataFileQuery(
+	ctx context.Context,
+	root inode.DirInode,
+	query string) (answer []byte, err error) {
+	prefix, q, err := inode.ParseMetadataFileQuery(query)
+	if err != nil {
+		return
+	}
+
+	in, err := fs.lookUpPath(ctx, root, prefix)
+	if err != nil {
+		return
+	}
+	fs.unlockAndDecrementLookupCount(in, 1)
+
+	dir, ok := in.(inode.DirInode)
+	if !ok {
+		return nil, fmt.Errorf("prefix %q: %w", prefix, syscall.ENOTDIR)
+	}
+
+	value, err := fs.queryMetadata(ctx, dir, q, dir.Name().GcsObjectName(), math.MaxInt)
+	if err != nil {
+		return
+	}
+	return []byte(value), nil
+}
+
+// Return the names of the objects under the supplied directory whose metadata
+// matches the query, relative to the directory and preceded by the supplied
+// prefix, each followed by a newline, and then metadataQueryTruncatedMarker if
+// the query was cut short. The names and the marker take up at most maxBytes.
+//
+// LOCKS_EXCLUDED(fs.mu)
+// LOCKS_EXCLUDED(dir)
+func (fs *fileSystem) queryMetadata(
+	ctx context.Context,
+	dir inode.DirInode,
+	q inode.MetadataQuery,
+	prefix string,
+	maxBytes int) (value string, err error) {
+	if fs.metadataQueryTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, fs.metadataQueryTimeout)
+		defer cancel()
+	}
+
+	// The dir isn't locked, so that a long query doesn't hold it up.
+	names, truncated, err := dir.QueryMetadata(
+		ctx,
+		q,
+		fs.metadataQueryMaxObjects,
+		maxBytes-len(metadataQueryTruncatedMarker))
+	if err != nil {
+		return
+	}
+
+	var b strings.Builder
+	for _, name := range names {
+		b.WriteString(prefix)
+		b.WriteString(name)
+		b.WriteByte('\n')
+	}
+	if truncated {
+		b.WriteString(metadataQueryTruncatedMarker)
+	}
+	return b.String(), nil
+}
+
+// Return the value of the usage extended attribute of the directory with the
+// given name, in decimal.
+//
+// LOCKS_EXCLUDED(fs.mu)
+func (fs *fileSystem) dirUsageXattr(
+	ctx context.Context,
+	id fuseops.InodeID,
+	name string) (value string, err error) {
+	if fs.dirSizeXattrMaxObjects == 0 {
+		return "", fuse.ENOATTR
+	}
+
+	fs.mu.Lock()
+	in := fs.inodeOrDie(id)
+	fs.mu.Unlock()
+
+	dir, ok := in.(inode.DirInode)
+	if !ok {
+		return "", fuse.ENOATTR
+	}
+
+	// The progress of a listing is read without waiting for it, unlike the
+	// attributes it computes.
+	if name == inode.UsageProgressXattr {
+		progress := dir.UsageProgress()
+		if progress == nil {
+			return "", fuse.ENOATTR
+		}
+		return progress.String(), nil
+	}
+
+	dir.Lock()
+	usage, err := dir.Usage(ctx, fs.dirSizeXattrMaxObjects, fs.dirSizeXattrParallelism)
+	dir.Unlock()
+	if err != nil {
+		return
+	}
+
+	if name == inode.ObjectCountXattr {
+		return strconv.Itoa(usage.ObjectCount), nil
+	}
+	return strconv.FormatUint(usage.RecursiveSize, 10), nil
+}
+
+// An xattrNamespace says how the extended attributes whose names start with
+// prefix are handled.
+type xattrNamespace struct {
+	prefix string
+
+	// The error for getting an attribute, or nil if GetXattr looks it up.
+	getErr error
+
+	// The error for setting or removing an attribute.
+	setErr error
+}
+
+// The namespaces of extended attributes, most specific first. Names matching
+// none of them fail with EOPNOTSUPP, as on other file systems.
+//
+// Failing with ENODATA rather than ENOSYS tells tools there is no such
+// attribute instead of making them give up, e.g. rsync -A reading POSIX ACLs,
+// and doesn't stop the kernel from asking again, e.g. for security.capability
+// on every write, so these are answered cheaply.
+var xattrNamespaces = []xattrNamespace{
+	// Ours, which are read-only.
+	{prefix: inode.XattrPrefix, setErr: syscall.EOPNOTSUPP},
+	{prefix: "user.", getErr: fuse.ENOATTR, setErr: syscall.EOPNOTSUPP},
+	// Files have no ACLs beyond their modes, which can't be changed.
+	{prefix: "system.posix_acl_access", getErr: fuse.ENOATTR, setErr: syscall.EOPNOTSUPP},
+	{prefix: "system.posix_acl_default", getErr: fuse.ENOATTR, setErr: syscall.EOPNOTSUPP},
+	{prefix: "system.", getErr: syscall.EOPNOTSUPP, setErr: syscall.EOPNOTSUPP},
+	{prefix: "security.", getErr: fuse.ENOATTR, setErr: syscall.EOPNOTSUPP},
+	{prefix: "trusted.", getErr: fuse.ENOATTR, setErr: syscall.EOPNOTSUPP},
+}
+
+var unknownXattrNamespace = xattrNamespace{
+	getErr: syscall.EOPNOTSUPP,
+	setErr: syscall.EOPNOTSUPP,
+}
+
+// Return the namespace of the extended attribute with the given name.
+func xattrNamespaceOf(name string) xattrNamespace {
+	for _, ns := range xattrNamespaces {
+		if strings.HasPrefix(name, ns.prefix) {
+			return ns
+		}
+	}
+	return unknownXattrNamespace
+}
+
+// LOCKS_EXCLUDED(fs.mu)
 func (fs *fileSystem) GetXattr(
 	ctx context.Context,
 	op *fuseops.GetXattrOp) (err error) {
-	return syscall.ENOSYS
+	if err = xattrNamespaceOf(op.Name).getErr; err != nil {
+		return
+	}
+
+	var value string
+	if pattern, ok := strings.CutPrefix(op.Name, inode.GlobXattrPrefix); ok {
+		if value, err = fs.globXattr(ctx, op.Inode, pattern); err != nil {
+			return
+		}
+	} else if query, ok := strings.CutPrefix(op.Name, inode.MetadataXattrPrefix); ok {
+		if value, err = fs.metadataXattr(ctx, op.Inode, query); err != nil {
+			return
+		}
+	} else if op.Name == inode.RecursiveSizeXattr || op.Name == inode.ObjectCountXattr || op.Name == inode.UsageProgressXattr {
+		if value, err = fs.dirUsageXattr(ctx, op.Inode, op.Name); err != nil {
+			return
+		}
+	} else if value, ok = fs.fileXattrs(op.Inode)[op.Name]; !ok {
+		return fuse.ENOATTR
+	}
+
+	// An empty buffer asks for the size.
+	op.BytesRead = len(value)
+	if len(op.Dst) == 0 {
+		return
+	}
+	if len(op.Dst) < len(value) {
+		return syscall.ERANGE
+	}
+
+	copy(op.Dst, value)
+	return
 }
 
+// LOCKS_EXCLUDED(fs.mu)
 func (fs *fileSystem) ListXattr(
 	ctx context.Context,
-	op *fuseops.ListXattrOp) error {
-	return syscall.ENOSYS
+	op *fuseops.ListXattrOp) (err error) {
+	xattrs := fs.fileXattrs(op.Inode)
+
+	var names []byte
+	for _, name := range inode.XattrNames {
+		if _, ok := xattrs[name]; ok {
+			names = append(names, name...)
+			names = append(names, 0)
+		}
+	}
+
+	// An empty buffer asks for the size.
+	op.BytesRead = len(names)
+	if len(op.Dst) == 0 {
+		return
+	}
+	if len(op.Dst) < len(names) {
+		return syscall.ERANGE
+	}
+
+	copy(op.Dst, names)
+	return
+}
+
+// LOCKS_EXCLUDED(fs.mu)
+func (fs *fileSystem) SetXattr(
+	ctx context.Context,
+	op *fuseops.SetXattrOp) (err error) {
+	return xattrNamespaceOf(op.Name).setErr
+}
+
+// LOCKS_EXCLUDED(fs.mu)
+func (fs *fileSystem) RemoveXattr(
+	ctx context.Context,
+	op *fuseops.RemoveXattrOp) (err error) {
+	return xattrNamespaceOf(op.Name).setErr
 }
@@ -85,6 +85,10 @@ type fsTest struct {
 	// Files to close when tearing down. Nil entries are skipped.
 	f1 *os.File
 	f2 *os.File
+
+	// The temporary directory created for the suite to stage writes in, if it
+	// didn't set a TempDir of its own, removed when tearing down.
+	tempDir string
 }
 
 var (
@@ -154,6 +158,14 @@ func (t *fsTest) SetUpTestSuite() {
 	mntDir, err = ioutil.TempDir("", "fs_test")
 	AssertEq(nil, err)
 
+	// And one for staging writes, so that their journal doesn't outlive the
+	// suite.
+	if t.serverCfg.TempDir == "" {
+		t.tempDir, err = os.MkdirTemp("", "fs_test_staging")
+		AssertEq(nil, err)
+		t.serverCfg.TempDir = t.tempDir
+	}
+
 	// Create a file system server.
 	server, err := fs.NewServer(ctx, &t.serverCfg)
 	AssertEq(nil, err)
@@ -199,6 +211,12 @@ func (t *fsTest) TearDownTestSuite() {
 		AssertEq(nil, err)
 	}
 
+	if t.tempDir != "" {
+		os.RemoveAll(t.tempDir)
+		t.serverCfg.TempDir = ""
+		t.tempDir = ""
+	}
+
 	// Unlink the mount point.
 	if err = os.Remove(mntDir); err != nil {
 		err = fmt.Errorf("Unlinking mount point: %w", err)
@@ -330,11 +348,17 @@ func (bm *fakeBucketManager) SetUpBucket(
 	ctx context.Context,
 	name string, isMultibucketMount bool) (sb gcsx.SyncerBucket, err error) {
 	bucket, ok := bm.buckets[name]
+	if ok && gcsx.RetentionLocked(ctx, bucket) {
+		sb = gcsx.NewReadOnlySyncerBucket(gcsx.NewContentTypeBucket(bucket, nil))
+		return
+	}
 	if ok {
 		sb = gcsx.NewSyncerBucket(
-			bm.appendThreshold,
-			bm.tmpObjectPrefix,
-			gcsx.NewContentTypeBucket(bucket),
+			gcsx.SyncerConfig{
+				AppendThreshold: bm.appendThreshold,
+				TmpObjectPrefix: bm.tmpObjectPrefix,
+			},
+			gcsx.NewContentTypeBucket(bucket, nil),
 		)
 		return
 	}
@@ -0,0 +1,198 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Tests for the counts of the GCS requests made by file system ops, calling
+// the file system directly.
+
+package fs_test
+
+import (
+	"context"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/lru"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/metadata"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/config"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/fs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/locker"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/caching"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/fuseutil"
+	. "github.com/jacobsa/oglematchers"
+	. "github.com/jacobsa/ogletest"
+	"github.com/jacobsa/timeutil"
+)
+
+type GCSRequestCountTest struct {
+	ctx      context.Context
+	fs       fuseutil.FileSystem
+	bucket   gcs.Bucket
+	cacheDir string
+}
+
+func init() { RegisterTestSuite(&GCSRequestCountTest{}) }
+
+func (t *GCSRequestCountTest) SetUp(ti *TestInfo) {
+	locker.EnableInvariantsCheck()
+	t.ctx = ti.Ctx
+
+	t.bucket = fake.NewFakeBucket(timeutil.RealClock(), "some_bucket")
+	AssertEq(nil, storageutil.CreateObjects(t.ctx, t.bucket, map[string][]byte{"foo": []byte("tacoburrito")}))
+
+	var err error
+	t.cacheDir, err = os.MkdirTemp("", "gcs_requests_test")
+	AssertEq(nil, err)
+	t.newFileSystem(false)
+}
+
+func (t *GCSRequestCountTest) TearDown() {
+	t.fs.Destroy()
+	_ = os.RemoveAll(t.cacheDir)
+}
+
+// Set up t.fs over t.bucket, with the supplied ServerConfig.StrictUnlink.
+func (t *GCSRequestCountTest) newFileSystem(strictUnlink bool) {
+	bucket := t.bucket
+
+	// Requests are counted by the layer logging them, under the stat cache as
+	// in a mount.
+	statCache := metadata.NewStatCacheBucketView(lru.NewCache(1<<20), "")
+	cachedBucket := caching.NewFastStatBucket(
+		metadata.SameEntryTTLs(time.Minute),
+		metadata.CacheControlTTL{},
+		nil,
+		statCache,
+		timeutil.RealClock(),
+		storage.NewDebugBucket(bucket))
+
+	var err error
+	mountConfig := config.NewMountConfig()
+	mountConfig.CacheDir = config.CacheDir(t.cacheDir)
+	mountConfig.FileCacheConfig.MaxSizeMB = 10
+	t.fs, err = fs.NewFileSystem(t.ctx, &fs.ServerConfig{
+		CacheClock: timeutil.RealClock(),
+		BucketName: bucket.Name(),
+		BucketManager: &fakeBucketManager{
+			buckets:         map[string]gcs.Bucket{bucket.Name(): cachedBucket},
+			tmpObjectPrefix: ".gcsfuse_tmp/",
+		},
+		FilePerms:            filePerms,
+		DirPerms:             dirPerms,
+		SequentialReadSizeMb: SequentialReadSizeMb,
+		MountConfig:          mountConfig,
+		StrictUnlink:         strictUnlink,
+	})
+	AssertEq(nil, err)
+}
+
+// Look up foo, returning its inode and the number of GCS requests made.
+func (t *GCSRequestCountTest) lookUp() (fuseops.InodeID, int64) {
+	ctx, counter := gcs.WithRequestCounter(t.ctx)
+	op := &fuseops.LookUpInodeOp{Parent: fuseops.RootInodeID, Name: "foo"}
+	AssertEq(nil, t.fs.LookUpInode(ctx, op))
+	return op.Entry.Child, counter.Count()
+}
+
+// Unlink the given name in the root directory, returning the number of GCS
+// requests made.
+func (t *GCSRequestCountTest) unlink(name string) (int64, error) {
+	ctx, counter := gcs.WithRequestCounter(t.ctx)
+	err := t.fs.Unlink(ctx, &fuseops.UnlinkOp{Parent: fuseops.RootInodeID, Name: name})
+	return counter.Count(), err
+}
+
+// Read the given range of the file with the given handle, returning the
+// number of GCS requests made.
+func (t *GCSRequestCountTest) read(in fuseops.InodeID, handle fuseops.HandleID, offset int64, size int) int64 {
+	ctx, counter := gcs.WithRequestCounter(t.ctx)
+	op := &fuseops.ReadFileOp{Inode: in, Handle: handle, Offset: offset, Dst: make([]byte, size)}
+	AssertEq(nil, t.fs.ReadFile(ctx, op))
+	AssertEq(size, op.BytesRead)
+	return counter.Count()
+}
+
+////////////////////////////////////////////////////////////////////////
+// Tests
+////////////////////////////////////////////////////////////////////////
+
+func (t *GCSRequestCountTest) LookUp() {
+	// The file and a directory of the same name are looked for.
+	_, n := t.lookUp()
+	ExpectEq(2, n)
+
+	// Then their stats are cached.
+	_, n = t.lookUp()
+	ExpectEq(0, n)
+}
+
+func (t *GCSRequestCountTest) ReadsThroughFileCache() {
+	in, _ := t.lookUp()
+	open := &fuseops.OpenFileOp{Inode: in}
+	AssertEq(nil, t.fs.OpenFile(t.ctx, open))
+
+	// A cold read downloads the object into the file cache with a ranged read.
+	ExpectEq(1, t.read(in, open.Handle, 0, 4))
+
+	// Then reads are cache hits.
+	ExpectEq(0, t.read(in, open.Handle, 4, 7))
+	ExpectEq(0, t.read(in, open.Handle, 0, 11))
+}
+
+func (t *GCSRequestCountTest) UnlinkCachedNegative() {
+	lookUp := &fuseops.LookUpInodeOp{Parent: fuseops.RootInodeID, Name: "bar"}
+	AssertEq(syscall.ENOENT, t.fs.LookUpInode(t.ctx, lookUp))
+
+	// The name is known not to exist, so GCS isn't asked to delete it.
+	n, err := t.unlink("bar")
+	ExpectEq(syscall.ENOENT, err)
+	ExpectEq(0, n)
+}
+
+func (t *GCSRequestCountTest) UnlinkCachedPositive() {
+	t.lookUp()
+
+	n, err := t.unlink("foo")
+	AssertEq(nil, err)
+	ExpectEq(1, n)
+
+	_, _, err = t.bucket.StatObject(t.ctx, &gcs.StatObjectRequest{Name: "foo"})
+	ExpectThat(err, HasSameTypeAs(&gcs.NotFoundError{}))
+}
+
+func (t *GCSRequestCountTest) UnlinkUncached() {
+	n, err := t.unlink("foo")
+	AssertEq(nil, err)
+	ExpectEq(1, n)
+
+	_, _, err = t.bucket.StatObject(t.ctx, &gcs.StatObjectRequest{Name: "foo"})
+	ExpectThat(err, HasSameTypeAs(&gcs.NotFoundError{}))
+}
+
+func (t *GCSRequestCountTest) StrictUnlinkCachedNegative() {
+	t.fs.Destroy()
+	t.newFileSystem(true)
+
+	lookUp := &fuseops.LookUpInodeOp{Parent: fuseops.RootInodeID, Name: "bar"}
+	AssertEq(syscall.ENOENT, t.fs.LookUpInode(t.ctx, lookUp))
+
+	// GCS is asked anyway.
+	n, _ := t.unlink("bar")
+	ExpectEq(1, n)
+}
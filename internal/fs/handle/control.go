@@ -0,0 +1,125 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handle
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"syscall"
+
+	"golang.org/x/net/context"
+)
+
+// The most a query written to a control file, not yet answered, may take up.
+const MaxControlQuerySize = 4 << 10
+
+// ControlHandle is a handle of a control file. The handle of a file named by
+// its query reads as the answer to it, computed when the file was opened. The
+// handle of a file that queries are written to reads as what was written to
+// it, each query followed by its answer, computed by the first read after the
+// query was written.
+type ControlHandle struct {
+	/////////////////////////
+	// Constant data
+	/////////////////////////
+
+	// Answers the queries written to the handle; nil if it takes no queries.
+	answer func(ctx context.Context, query string) ([]byte, error)
+
+	/////////////////////////
+	// Mutable state
+	/////////////////////////
+
+	mu sync.Mutex
+
+	// The queries written and the answers to them, ending with the query not
+	// yet answered, if any.
+	//
+	// GUARDED_BY(mu)
+	transcript []byte
+
+	// The length of the start of the transcript that has been answered.
+	//
+	// GUARDED_BY(mu)
+	answered int
+}
+
+// NewControlHandle returns a handle of a control file reading as the supplied
+// contents.
+func NewControlHandle(contents []byte) *ControlHandle {
+	return &ControlHandle{transcript: contents, answered: len(contents)}
+}
+
+// NewQueryHandle returns a handle of a control file that queries are written
+// to, answered by the supplied function.
+func NewQueryHandle(
+	answer func(ctx context.Context, query string) ([]byte, error)) *ControlHandle {
+	return &ControlHandle{answer: answer}
+}
+
+// Write appends data to the query not yet answered. The offset is ignored,
+// since the file's size, as far as the kernel knows, is always zero. It fails
+// with EBADF if the handle takes no queries and with EFBIG if the query
+// would grow beyond MaxControlQuerySize.
+func (ch *ControlHandle) Write(data []byte) error {
+	if ch.answer == nil {
+		return syscall.EBADF
+	}
+
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+
+	if len(ch.transcript)-ch.answered+len(data) > MaxControlQuerySize {
+		return fmt.Errorf("query over %d bytes: %w", MaxControlQuerySize, syscall.EFBIG)
+	}
+	ch.transcript = append(ch.transcript, data...)
+	return nil
+}
+
+// Read answers the query not yet answered, if any, with surrounding white
+// space trimmed, and then copies the transcript from the given offset into
+// dst, returning the number of bytes read, zero at or past its end. If
+// answering fails, the error is returned and the query is left in the
+// transcript without an answer, so that offsets past it still line up with
+// what was written.
+func (ch *ControlHandle) Read(
+	ctx context.Context,
+	dst []byte,
+	offset int64) (n int, err error) {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+
+	if query := bytes.TrimSpace(ch.transcript[ch.answered:]); len(query) > 0 {
+		var answer []byte
+		answer, err = ch.answer(ctx, string(query))
+		if err != nil {
+			ch.answered = len(ch.transcript)
+			return
+		}
+		// The answer starts on a line of its own.
+		if ch.transcript[len(ch.transcript)-1] != '\n' {
+			ch.transcript = append(ch.transcript, '\n')
+		}
+		ch.transcript = append(ch.transcript, answer...)
+		ch.answered = len(ch.transcript)
+	}
+
+	if offset >= int64(len(ch.transcript)) {
+		return
+	}
+	n = copy(dst, ch.transcript[offset:])
+	return
+}
@@ -16,6 +16,7 @@ package handle
 
 import (
 	"fmt"
+	"slices"
 	"sort"
 
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/fs/inode"
@@ -35,6 +36,9 @@ type DirHandle struct {
 	in           inode.DirInode
 	implicitDirs bool
 
+	// Reports whether objects with the given name are left out of listings.
+	isSuppressed func(name string) bool
+
 	/////////////////////////
 	// Mutable state
 	/////////////////////////
@@ -57,13 +61,17 @@ type DirHandle struct {
 }
 
 // NewDirHandle creates a directory handle that obtains listings from the supplied inode.
+// Objects whose names isSuppressed returns true for, if not nil, are left out
+// of the listings, though local files aren't.
 func NewDirHandle(
 	in inode.DirInode,
-	implicitDirs bool) (dh *DirHandle) {
+	implicitDirs bool,
+	isSuppressed func(name string) bool) (dh *DirHandle) {
 	// Set up the basic struct.
 	dh = &DirHandle{
 		in:           in,
 		implicitDirs: implicitDirs,
+		isSuppressed: isSuppressed,
 	}
 
 	// Set up invariant checking.
@@ -101,6 +109,17 @@ func (dh *DirHandle) checkInvariants() {
 	}
 }
 
+// Drop all but one of the entries for a directory listed more than once, as
+// happens when the compat marker standing for it and its prefix come in
+// different batches.
+//
+// Input must be sorted by name.
+func dropDuplicateDirs(entries []fuseutil.Dirent) []fuseutil.Dirent {
+	return slices.CompactFunc(entries, func(a, b fuseutil.Dirent) bool {
+		return a.Name == b.Name && a.Type == fuseutil.DT_Directory && b.Type == fuseutil.DT_Directory
+	})
+}
+
 // Resolve name conflicts between file objects and directory objects (e.g. the
 // objects "foo/bar" and "foo/bar/") by appending U+000A, which is illegal in
 // GCS object names, to conflicting file names.
@@ -161,7 +180,8 @@ func fixConflictingNames(entries []fuseutil.Dirent) (err error) {
 func readAllEntries(
 	ctx context.Context,
 	in inode.DirInode,
-	localEntries []fuseutil.Dirent) (entries []fuseutil.Dirent, err error) {
+	localEntries []fuseutil.Dirent,
+	isSuppressed func(name string) bool) (entries []fuseutil.Dirent, err error) {
 	// Read entries from GCS.
 	// Read one batch at a time.
 	var tok string
@@ -175,8 +195,12 @@ func readAllEntries(
 			return
 		}
 
-		// Accumulate.
-		entries = append(entries, batch...)
+		// Accumulate, leaving out suppressed names.
+		for _, e := range batch {
+			if isSuppressed == nil || !isSuppressed(e.Name) {
+				entries = append(entries, e)
+			}
+		}
 
 		// Are we done?
 		if tok == "" {
@@ -190,6 +214,7 @@ func readAllEntries(
 	// Ensure that the entries are sorted, for use in fixConflictingNames
 	// below.
 	sort.Sort(sortedDirents(entries))
+	entries = dropDuplicateDirs(entries)
 
 	// Fix name conflicts.
 	// When a local file is synced to GCS but not removed from the local file map,
@@ -242,7 +267,7 @@ func (dh *DirHandle) ensureEntries(ctx context.Context, localFileEntries []fuseu
 
 	// Read entries.
 	var entries []fuseutil.Dirent
-	entries, err = readAllEntries(ctx, dh.in, localFileEntries)
+	entries, err = readAllEntries(ctx, dh.in, localFileEntries, dh.isSuppressed)
 	if err != nil {
 		err = fmt.Errorf("readAllEntries: %w", err)
 		return
@@ -20,6 +20,8 @@ import (
 	"testing"
 	"time"
 
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/metadata"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/config"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/contentcache"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/fs/inode"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/gcsx"
@@ -53,7 +55,7 @@ func init() { RegisterTestSuite(&DirHandleTest{}) }
 func (t *DirHandleTest) SetUp(ti *TestInfo) {
 	t.ctx = ti.Ctx
 	t.bucket = gcsx.NewSyncerBucket(
-		1, ".gcsfuse_tmp/", fake.NewFakeBucket(&t.clock, "some_bucket"))
+		gcsx.SyncerConfig{AppendThreshold: 1, TmpObjectPrefix: ".gcsfuse_tmp/"}, fake.NewFakeBucket(&t.clock, "some_bucket"))
 	t.clock.SetTime(time.Date(2022, 8, 15, 22, 56, 0, 0, time.Local))
 	t.resetDirHandle()
 }
@@ -72,18 +74,21 @@ func (t *DirHandleTest) resetDirHandle() {
 			Gid:  456,
 			Mode: 0712,
 		},
-		false, // implicitDirs,
-		true,  // enableManagedFoldersListing
-		false, // enableNonExistentTypeCache
-		0,     // typeCacheTTL
+		false,                // implicitDirs,
+		true,                 // enableManagedFoldersListing
+		false,                // enableNonExistentTypeCache
+		metadata.EntryTTLs{}, // typeCacheTTLs
 		&t.bucket,
 		&t.clock,
 		&t.clock,
-		0)
+		0,
+		config.DirTimesMount,
+		nil)
 
 	t.dh = NewDirHandle(
 		dirInode,
 		true,
+		nil,
 	)
 }
 
@@ -101,7 +106,11 @@ func (t *DirHandleTest) createLocalFileInode(name string, id fuseops.InodeID) (i
 		false, // localFileCache
 		contentcache.New("", &t.clock),
 		&t.clock,
-		true) // localFile
+		true, // localFile
+		0,    // lockTTL
+		config.DefaultClobberBehavior,
+		false,
+		0)
 	return
 }
 
@@ -224,3 +233,23 @@ func (t *DirHandleTest) EnsureEntriesWithSameNameLocalFileAndGCSDirectory() {
 	t.validateEntry(t.dh.entries[0], localFileName, fuseutil.DT_Directory)
 	t.validateEntry(t.dh.entries[1], localFileName+inode.ConflictingFileNameSuffix, fuseutil.DT_File)
 }
+
+func (t *DirHandleTest) DropDuplicateDirs() {
+	// A compat marker and the prefix of its directory, listed in different
+	// batches, and a file conflicting with a directory.
+	entries := []fuseutil.Dirent{
+		{Name: "a", Type: fuseutil.DT_Directory},
+		{Name: "a", Type: fuseutil.DT_Directory},
+		{Name: "b", Type: fuseutil.DT_Directory},
+		{Name: "b", Type: fuseutil.DT_File},
+		{Name: "c", Type: fuseutil.DT_File},
+	}
+
+	entries = dropDuplicateDirs(entries)
+
+	AssertEq(4, len(entries))
+	t.validateEntry(entries[0], "a", fuseutil.DT_Directory)
+	t.validateEntry(entries[1], "b", fuseutil.DT_Directory)
+	t.validateEntry(entries[2], "b", fuseutil.DT_File)
+	t.validateEntry(entries[3], "c", fuseutil.DT_File)
+}
@@ -15,12 +15,17 @@
 package handle
 
 import (
+	"errors"
 	"fmt"
 	"io"
+	"sync"
 
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/advisor"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/file"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/fs/inode"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/gcsx"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/monitor"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
 	"github.com/jacobsa/syncutil"
 	"golang.org/x/net/context"
 )
@@ -45,13 +50,52 @@ type FileHandle struct {
 	// cacheFileForRangeRead is also valid for cache workflow, if true, object content
 	// will be downloaded for random reads as well too.
 	cacheFileForRangeRead bool
+
+	// Whether readers serve ranges that the object's metadata describes as
+	// holding only zeros without reading them from GCS.
+	zeroExtentHints bool
+
+	// Whether the file was opened with O_SYNC or O_DSYNC, in which case closing
+	// it must wait for the contents to be uploaded.
+	syncOnFlush bool
+
+	// Whether the next reader must stat the object before reading from the file
+	// cache, as the inode's record was older than the metadata cache ttl when
+	// the file was opened. Readers for later generations needn't, as those come
+	// from GCS.
+	//
+	// GUARDED_BY(mu)
+	validateSource bool
+
+	// Whether the file was opened read-only, which lets reads move to a new
+	// generation of a clobbered object under config.ClobberBehaviorRefresh.
+	readOnly bool
+
+	// Whether the handle holds a reference on the inode's lock object. It only
+	// changes with the inode locked too, so that HoldsLock can tell without
+	// locking the inode.
+	holdsLockMu sync.Mutex
+
+	// GUARDED_BY(holdsLockMu)
+	holdsLock bool
+
+	// What the handle has been used for. Writes are counted without holding
+	// mu.
+	statsMu sync.Mutex
+
+	// GUARDED_BY(statsMu)
+	stats advisor.Stats
 }
 
-func NewFileHandle(inode *inode.FileInode, fileCacheHandler *file.CacheHandler, cacheFileForRangeRead bool) (fh *FileHandle) {
+func NewFileHandle(inode *inode.FileInode, fileCacheHandler *file.CacheHandler, cacheFileForRangeRead bool, zeroExtentHints bool, syncOnFlush bool, readOnly bool, validateSource bool) (fh *FileHandle) {
 	fh = &FileHandle{
 		inode:                 inode,
 		fileCacheHandler:      fileCacheHandler,
 		cacheFileForRangeRead: cacheFileForRangeRead,
+		zeroExtentHints:       zeroExtentHints,
+		syncOnFlush:           syncOnFlush,
+		readOnly:              readOnly,
+		validateSource:        validateSource,
 	}
 
 	fh.mu = syncutil.NewInvariantMutex(fh.checkInvariants)
@@ -67,6 +111,97 @@ func (fh *FileHandle) Destroy() {
 	}
 }
 
+// AcquireLock takes a reference on the inode's lock object on behalf of the
+// handle. See inode.FileInode.AcquireLock.
+//
+// LOCKS_REQUIRED(fh.inode)
+// LOCKS_EXCLUDED(fh.holdsLockMu)
+func (fh *FileHandle) AcquireLock(ctx context.Context) (err error) {
+	fh.holdsLockMu.Lock()
+	defer fh.holdsLockMu.Unlock()
+
+	if fh.holdsLock {
+		return
+	}
+
+	if err = fh.inode.AcquireLock(ctx); err != nil {
+		return
+	}
+
+	fh.holdsLock = true
+	return
+}
+
+// ReleaseLock drops the handle's reference on the inode's lock object, if it
+// holds one.
+//
+// LOCKS_REQUIRED(fh.inode)
+// LOCKS_EXCLUDED(fh.holdsLockMu)
+func (fh *FileHandle) ReleaseLock(ctx context.Context) (err error) {
+	fh.holdsLockMu.Lock()
+	defer fh.holdsLockMu.Unlock()
+
+	if !fh.holdsLock {
+		return
+	}
+
+	fh.holdsLock = false
+	return fh.inode.ReleaseLock(ctx)
+}
+
+// HandOverLock gives up the handle's reference on the inode's lock object
+// without releasing it, returning true if there was one. The caller becomes
+// responsible for calling ReleaseLock on the inode.
+//
+// LOCKS_REQUIRED(fh.inode)
+// LOCKS_EXCLUDED(fh.holdsLockMu)
+func (fh *FileHandle) HandOverLock() (held bool) {
+	fh.holdsLockMu.Lock()
+	defer fh.holdsLockMu.Unlock()
+
+	held = fh.holdsLock
+	fh.holdsLock = false
+	return
+}
+
+// HoldsLock returns true if the handle holds a reference on the inode's lock
+// object, which only ReleaseLock or HandOverLock, with the inode locked, can
+// then drop.
+//
+// LOCKS_EXCLUDED(fh.holdsLockMu)
+func (fh *FileHandle) HoldsLock() bool {
+	fh.holdsLockMu.Lock()
+	defer fh.holdsLockMu.Unlock()
+
+	return fh.holdsLock
+}
+
+// SyncOnFlush returns true if flushing the handle must wait for the contents
+// to be uploaded.
+func (fh *FileHandle) SyncOnFlush() bool {
+	return fh.syncOnFlush
+}
+
+// RecordWrite counts a write of n bytes through the handle.
+//
+// LOCKS_EXCLUDED(fh.statsMu)
+func (fh *FileHandle) RecordWrite(n int) {
+	fh.statsMu.Lock()
+	defer fh.statsMu.Unlock()
+
+	fh.stats.RecordWrite(n)
+}
+
+// Stats returns what the handle has been used for.
+//
+// LOCKS_EXCLUDED(fh.statsMu)
+func (fh *FileHandle) Stats() advisor.Stats {
+	fh.statsMu.Lock()
+	defer fh.statsMu.Unlock()
+
+	return fh.stats
+}
+
 // Inode returns the inode backing this handle.
 func (fh *FileHandle) Inode() *inode.FileInode {
 	return fh.inode
@@ -86,25 +221,71 @@ func (fh *FileHandle) Unlock() {
 // LOCKS_REQUIRED(fh)
 // LOCKS_EXCLUDED(fh.inode)
 func (fh *FileHandle) Read(ctx context.Context, dst []byte, offset int64, sequentialReadSizeMb int32) (n int, err error) {
-	// Lock the inode and attempt to ensure that we have a reader for its current
-	// state, or clear fh.reader if it's not possible to create one (probably
-	// because the inode is dirty).
-	fh.inode.Lock()
-	err = fh.tryEnsureReader(ctx, sequentialReadSizeMb)
-	if err != nil {
-		fh.inode.Unlock()
-		err = fmt.Errorf("tryEnsureReader: %w", err)
+	n, err = fh.read(ctx, dst, offset, sequentialReadSizeMb)
+
+	// If the generation we read is gone, the inode may move to the one that
+	// replaced it, in which case we try once more.
+	var notFoundErr *gcs.NotFoundError
+	if !errors.As(err, &notFoundErr) {
 		return
 	}
 
-	// If we have an appropriate reader, unlock the inode and use that. This
-	// allows reads to proceed concurrently with other operations; in particular,
-	// multiple reads can run concurrently. It's safe because the user can't tell
-	// if a concurrent write started during or after a read.
-	if fh.reader != nil {
+	fh.inode.Lock()
+	retry, err := fh.inode.CheckReadError(ctx, err, fh.readOnly)
+	fh.inode.Unlock()
+	if retry {
+		n, err = fh.read(ctx, dst, offset, sequentialReadSizeMb)
+	}
+
+	return
+}
+
+// LOCKS_REQUIRED(fh)
+// LOCKS_EXCLUDED(fh.inode)
+func (fh *FileHandle) read(ctx context.Context, dst []byte, offset int64, sequentialReadSizeMb int32) (n int, err error) {
+	fh.inode.Lock()
+	for {
+		// Attempt to ensure that we have a reader for the inode's current state,
+		// or clear fh.reader if it's not possible to create one (probably because
+		// the inode is dirty).
+		err = fh.tryEnsureReader(ctx, sequentialReadSizeMb)
+		if err != nil {
+			fh.inode.Unlock()
+			err = fmt.Errorf("tryEnsureReader: %w", err)
+			return
+		}
+
+		if fh.reader == nil {
+			break
+		}
+
+		// If we have an appropriate reader, unlock the inode and use that. This
+		// allows reads to proceed concurrently with other operations; in
+		// particular, multiple reads can run concurrently.
 		fh.inode.Unlock()
 
-		n, _, err = fh.reader.ReadAt(ctx, dst, offset)
+		var cacheHit bool
+		objectSize := fh.reader.Object().Size
+		n, cacheHit, err = fh.reader.ReadAt(ctx, dst, offset)
+
+		// The inode may have been written to, or synced to a new generation,
+		// while we read without its lock, in which case what we read is stale
+		// and the generation we read may even be gone. Read again from the
+		// inode's current state, through the staged content if it's dirty.
+		fh.inode.Lock()
+		if !fh.readerIsCurrent() {
+			continue
+		}
+
+		// The reader may have found the object shorter than the inode thinks.
+		if size := fh.reader.Object().Size; size < objectSize {
+			fh.inode.ShrinkSource(size)
+		}
+		fh.inode.Unlock()
+
+		if err == nil || err == io.EOF {
+			fh.recordRead(offset, n, !cacheHit, objectSize)
+		}
 		switch {
 		case err == io.EOF:
 			return
@@ -117,13 +298,28 @@ func (fh *FileHandle) Read(ctx context.Context, dst []byte, offset int64, sequen
 		return
 	}
 
-	// Otherwise we must fall through to the inode.
+	// Otherwise we must fall through to the inode, whose lock we hold so that
+	// the read doesn't interleave with writes to the staged content.
 	defer fh.inode.Unlock()
 	n, err = fh.inode.Read(ctx, dst, offset)
+	if err == nil || err == io.EOF {
+		fh.recordRead(offset, n, false, 0)
+		monitor.CaptureReadBytesMetrics(ctx, monitor.ReadBytes{monitor.ReadFromStagedFile: int64(n)})
+	}
 
 	return
 }
 
+// recordRead counts a read through the handle. See advisor.Stats.RecordRead.
+//
+// LOCKS_EXCLUDED(fh.statsMu)
+func (fh *FileHandle) recordRead(offset int64, n int, fromGCS bool, objectSize uint64) {
+	fh.statsMu.Lock()
+	defer fh.statsMu.Unlock()
+
+	fh.stats.RecordRead(offset, n, fromGCS, objectSize)
+}
+
 ////////////////////////////////////////////////////////////////////////
 // Helpers
 ////////////////////////////////////////////////////////////////////////
@@ -136,6 +332,16 @@ func (fh *FileHandle) checkInvariants() {
 	}
 }
 
+// readerIsCurrent returns true if fh.reader reads the current contents of the
+// inode, i.e. the inode is clean and still at the reader's generation.
+//
+// LOCKS_REQUIRED(fh)
+// LOCKS_REQUIRED(fh.inode)
+func (fh *FileHandle) readerIsCurrent() bool {
+	return fh.inode.SourceGenerationIsAuthoritative() &&
+		fh.reader.Object().Generation == fh.inode.SourceGeneration().Object
+}
+
 // If possible, ensure that fh.reader is set to an appropriate random reader
 // for the current state of the inode. Otherwise set it to nil.
 //
@@ -162,7 +368,7 @@ func (fh *FileHandle) tryEnsureReader(ctx context.Context, sequentialReadSizeMb
 	// If we already have a reader, and it's at the appropriate generation, we
 	// can use it. Otherwise we must throw it away.
 	if fh.reader != nil {
-		if fh.reader.Object().Generation == fh.inode.SourceGeneration().Object {
+		if fh.readerIsCurrent() {
 			return
 		}
 		fh.reader.Destroy()
@@ -170,7 +376,8 @@ func (fh *FileHandle) tryEnsureReader(ctx context.Context, sequentialReadSizeMb
 	}
 
 	// Attempt to create an appropriate reader.
-	rr := gcsx.NewRandomReader(fh.inode.Source(), fh.inode.Bucket(), sequentialReadSizeMb, fh.fileCacheHandler, fh.cacheFileForRangeRead)
+	rr := gcsx.NewRandomReader(fh.inode.Source(), fh.inode.Bucket(), sequentialReadSizeMb, fh.fileCacheHandler, fh.cacheFileForRangeRead, fh.zeroExtentHints, fh.validateSource)
+	fh.validateSource = false
 
 	fh.reader = rr
 	return
@@ -24,6 +24,7 @@ import (
 	"path"
 	"time"
 
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/metadata"
 	. "github.com/jacobsa/oglematchers"
 	. "github.com/jacobsa/ogletest"
 )
@@ -42,7 +43,7 @@ func init() {
 
 func (t *ImplicitDirsWithCacheTest) SetUpTestSuite() {
 	t.serverCfg.ImplicitDirectories = true
-	t.serverCfg.DirTypeCacheTTL = time.Minute * 3
+	t.serverCfg.DirTypeCacheTTLs = metadata.SameEntryTTLs(time.Minute * 3)
 	t.fsTest.SetUpTestSuite()
 }
 
@@ -174,6 +174,33 @@ func (d *baseDirInode) ReadDescendants(ctx context.Context, limit int) (map[Name
 	return nil, fuse.ENOSYS
 }
 
+// Not implemented
+func (d *baseDirInode) ListMatching(ctx context.Context, pattern string, maxBytes int) ([]string, error) {
+	return nil, fuse.ENOSYS
+}
+
+// Not implemented
+func (d *baseDirInode) QueryMetadata(
+	ctx context.Context,
+	q MetadataQuery,
+	maxObjects int,
+	maxBytes int) ([]string, bool, error) {
+	return nil, false, fuse.ENOSYS
+}
+
+// Not implemented
+func (d *baseDirInode) Usage(ctx context.Context, maxObjects int, maxParallel int) (DirUsage, error) {
+	return DirUsage{}, fuse.ENOSYS
+}
+
+func (d *baseDirInode) UsageProgress() *gcsx.PrefixUsageProgress {
+	return nil
+}
+
+func (d *baseDirInode) ListDenied() bool {
+	return false
+}
+
 // LOCKS_REQUIRED(d)
 func (d *baseDirInode) ReadEntries(
 	ctx context.Context,
@@ -232,6 +259,17 @@ func (d *baseDirInode) DeleteChildDir(
 	return
 }
 
+func (d *baseDirInode) CompatDirMarkerOf(ctx context.Context, name string) (string, error) {
+	return "", nil
+}
+
+func (d *baseDirInode) RenameFolder(
+	ctx context.Context,
+	folderName string,
+	name string) (*gcs.Folder, error) {
+	return nil, fuse.ENOSYS
+}
+
 func (d *baseDirInode) LocalFileEntries(localFileInodes map[Name]Inode) (localEntries []fuseutil.Dirent) {
 	// Base directory can not contain local files.
 	return nil
@@ -242,3 +280,15 @@ func (d *baseDirInode) ShouldInvalidateKernelListCache(ttl time.Duration) bool {
 	// for baseDirInode.
 	return true
 }
+
+func (d *baseDirInode) InvalidateChild(name string) {
+	// Nothing is cached about the children of the base directory.
+}
+
+func (d *baseDirInode) ChildKnownMissing(name string) bool {
+	return false
+}
+
+func (d *baseDirInode) ChildKnownFile(name string) bool {
+	return false
+}
@@ -57,13 +57,11 @@ func (t *BaseDirTest) SetUp(ti *TestInfo) {
 		buckets: make(map[string]gcsx.SyncerBucket),
 	}
 	t.bm.buckets["bucketA"] = gcsx.NewSyncerBucket(
-		1, // Append threshold
-		".gcsfuse_tmp/",
+		gcsx.SyncerConfig{AppendThreshold: 1, TmpObjectPrefix: ".gcsfuse_tmp/"},
 		fake.NewFakeBucket(&t.clock, "bucketA"),
 	)
 	t.bm.buckets["bucketB"] = gcsx.NewSyncerBucket(
-		1, // Append threshold
-		".gcsfuse_tmp/",
+		gcsx.SyncerConfig{AppendThreshold: 1, TmpObjectPrefix: ".gcsfuse_tmp/"},
 		fake.NewFakeBucket(&t.clock, "bucketB"),
 	)
 
@@ -0,0 +1,144 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package inode
+
+import (
+	"fmt"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/config"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+)
+
+// FileClobberedError is returned by operations on a file whose object has
+// been replaced or deleted by another writer since the file was opened.
+type FileClobberedError struct {
+	ObjectName string
+
+	// The generation the file was opened at.
+	OpenedGeneration int64
+
+	// The generation that replaced it, or zero if the object was deleted.
+	CurrentGeneration int64
+}
+
+func (e *FileClobberedError) Error() string {
+	if e.CurrentGeneration == 0 {
+		return fmt.Sprintf("file %q clobbered: generation %d was deleted",
+			e.ObjectName, e.OpenedGeneration)
+	}
+
+	return fmt.Sprintf("file %q clobbered: generation %d was replaced by generation %d",
+		e.ObjectName, e.OpenedGeneration, e.CurrentGeneration)
+}
+
+// A clobberStrategy decides how a file inode behaves once its object has been
+// clobbered, i.e. replaced or deleted by another writer.
+type clobberStrategy interface {
+	// Whether the inode looks for clobbering at all. If not, Attributes never
+	// reports the file as unlinked and reads of the opened generation fail the
+	// way they would for any other reason.
+	detects() bool
+
+	// Called when reading the source generation of f failed because it no
+	// longer exists. latest is the current object, or nil if it was deleted.
+	// Returns true if f moved to latest's generation and the read should be
+	// retried, and otherwise the error for the read.
+	//
+	// LOCKS_REQUIRED(f.mu)
+	readClobbered(f *FileInode, latest *gcs.MinObject, readOnly bool) (retry bool, err error)
+}
+
+// newClobberStrategy returns the strategy for one of the config.ClobberBehavior
+// values. The empty string means config.ClobberBehaviorError.
+func newClobberStrategy(behavior string) clobberStrategy {
+	switch behavior {
+	case config.ClobberBehaviorIgnore:
+		return ignoreClobberStrategy{}
+	case config.ClobberBehaviorRefresh:
+		return refreshClobberStrategy{}
+	default:
+		return errorClobberStrategy{}
+	}
+}
+
+// errorClobberStrategy fails reads of a clobbered file with a
+// FileClobberedError, logging the generations involved once per inode.
+type errorClobberStrategy struct{}
+
+func (errorClobberStrategy) detects() bool {
+	return true
+}
+
+func (errorClobberStrategy) readClobbered(
+	f *FileInode,
+	latest *gcs.MinObject,
+	readOnly bool) (retry bool, err error) {
+	clobberedErr := &FileClobberedError{
+		ObjectName:       f.src.Name,
+		OpenedGeneration: f.src.Generation,
+	}
+	if latest != nil {
+		clobberedErr.CurrentGeneration = latest.Generation
+	}
+
+	if !f.clobberLogged {
+		f.clobberLogged = true
+		logger.Warnf("File clobbered: object=%q opened_generation=%d current_generation=%d",
+			clobberedErr.ObjectName, clobberedErr.OpenedGeneration, clobberedErr.CurrentGeneration)
+	}
+
+	err = clobberedErr
+	return
+}
+
+// ignoreClobberStrategy doesn't look for clobbering, so the generation a file
+// was opened at is served for as long as it can be read.
+type ignoreClobberStrategy struct{}
+
+func (ignoreClobberStrategy) detects() bool {
+	return false
+}
+
+func (ignoreClobberStrategy) readClobbered(
+	f *FileInode,
+	latest *gcs.MinObject,
+	readOnly bool) (retry bool, err error) {
+	panic("ignoreClobberStrategy doesn't detect clobbering")
+}
+
+// refreshClobberStrategy moves a clean inode read through a read-only handle
+// to the generation that replaced its own, and otherwise behaves like
+// errorClobberStrategy.
+type refreshClobberStrategy struct{}
+
+func (refreshClobberStrategy) detects() bool {
+	return true
+}
+
+func (refreshClobberStrategy) readClobbered(
+	f *FileInode,
+	latest *gcs.MinObject,
+	readOnly bool) (retry bool, err error) {
+	if !readOnly || latest == nil || !f.SourceGenerationIsAuthoritative() {
+		return errorClobberStrategy{}.readClobbered(f, latest, readOnly)
+	}
+
+	logger.Infof("File clobbered, refreshing: object=%q opened_generation=%d current_generation=%d",
+		f.src.Name, f.src.Generation, latest.Generation)
+	f.src = *latest
+	retry = true
+	return
+}
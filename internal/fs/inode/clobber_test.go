@@ -0,0 +1,239 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package inode
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/config"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/contentcache"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/gcsx"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	"github.com/jacobsa/fuse/fuseops"
+	. "github.com/jacobsa/ogletest"
+	"github.com/jacobsa/timeutil"
+	"golang.org/x/net/context"
+)
+
+func TestClobber(t *testing.T) { RunTests(t) }
+
+////////////////////////////////////////////////////////////////////////
+// Boilerplate
+////////////////////////////////////////////////////////////////////////
+
+type ClobberTest struct {
+	ctx    context.Context
+	bucket gcs.Bucket
+	clock  timeutil.SimulatedClock
+
+	// The object the inode is opened at.
+	src *gcs.MinObject
+
+	// The error returned by reading a generation that no longer exists.
+	readErr error
+
+	in *FileInode
+}
+
+var _ SetUpInterface = &ClobberTest{}
+var _ TearDownInterface = &ClobberTest{}
+
+func init() { RegisterTestSuite(&ClobberTest{}) }
+
+func (t *ClobberTest) SetUp(ti *TestInfo) {
+	t.ctx = ti.Ctx
+	t.clock.SetTime(time.Date(2012, 8, 15, 22, 56, 0, 0, time.Local))
+	t.bucket = fake.NewFakeBucket(&t.clock, "some_bucket")
+	t.readErr = &gcs.NotFoundError{Err: errors.New("generation not found")}
+
+	o, err := storageutil.CreateObject(t.ctx, t.bucket, fileName, []byte("taco"))
+	AssertEq(nil, err)
+	t.src = storageutil.ConvertObjToMinObject(o)
+}
+
+func (t *ClobberTest) TearDown() {
+	if t.in != nil {
+		t.in.Unlock()
+	}
+}
+
+func (t *ClobberTest) createInode(clobberBehavior string) {
+	syncerBucket := gcsx.NewSyncerBucket(
+		gcsx.SyncerConfig{AppendThreshold: 1, TmpObjectPrefix: ".gcsfuse_tmp/"},
+		t.bucket)
+
+	t.in = NewFileInode(
+		fileInodeID,
+		NewFileName(NewRootName(""), fileName),
+		t.src,
+		fuseops.InodeAttributes{},
+		&syncerBucket,
+		false, // localFileCache
+		contentcache.New("", &t.clock),
+		&t.clock,
+		false, // localFile
+		0,     // lockTTL
+		clobberBehavior,
+		false,
+		0)
+	t.in.Lock()
+}
+
+// Replace the object with new contents, returning the new generation.
+func (t *ClobberTest) clobber() (generation int64) {
+	o, err := storageutil.CreateObject(t.ctx, t.bucket, fileName, []byte("burrito"))
+	AssertEq(nil, err)
+	return o.Generation
+}
+
+func (t *ClobberTest) nlink() uint32 {
+	attrs, err := t.in.Attributes(t.ctx)
+	AssertEq(nil, err)
+	return attrs.Nlink
+}
+
+////////////////////////////////////////////////////////////////////////
+// Tests
+////////////////////////////////////////////////////////////////////////
+
+func (t *ClobberTest) OtherErrorsArePassedThrough() {
+	t.createInode(config.ClobberBehaviorError)
+	t.clobber()
+	readErr := errors.New("taco")
+
+	retry, err := t.in.CheckReadError(t.ctx, readErr, true)
+
+	ExpectFalse(retry)
+	ExpectEq(readErr, err)
+}
+
+func (t *ClobberTest) NotFoundWithoutClobbering() {
+	t.createInode(config.ClobberBehaviorError)
+
+	retry, err := t.in.CheckReadError(t.ctx, t.readErr, true)
+
+	ExpectFalse(retry)
+	ExpectEq(t.readErr, err)
+	ExpectEq(1, t.nlink())
+}
+
+func (t *ClobberTest) Error_Replaced() {
+	t.createInode(config.ClobberBehaviorError)
+	newGeneration := t.clobber()
+
+	retry, err := t.in.CheckReadError(t.ctx, t.readErr, true)
+
+	ExpectFalse(retry)
+	var clobberedErr *FileClobberedError
+	AssertTrue(errors.As(err, &clobberedErr))
+	ExpectEq(fileName, clobberedErr.ObjectName)
+	ExpectEq(t.src.Generation, clobberedErr.OpenedGeneration)
+	ExpectEq(newGeneration, clobberedErr.CurrentGeneration)
+	ExpectEq(t.src.Generation, t.in.SourceGeneration().Object)
+	ExpectEq(0, t.nlink())
+	ExpectFalse(t.in.ObjectDeleted())
+}
+
+func (t *ClobberTest) Error_Deleted() {
+	t.createInode(config.ClobberBehaviorError)
+	err := t.bucket.DeleteObject(t.ctx, &gcs.DeleteObjectRequest{Name: fileName})
+	AssertEq(nil, err)
+
+	_, err = t.in.CheckReadError(t.ctx, t.readErr, true)
+
+	var clobberedErr *FileClobberedError
+	AssertTrue(errors.As(err, &clobberedErr))
+	ExpectEq(0, clobberedErr.CurrentGeneration)
+	ExpectEq(0, t.nlink())
+	ExpectTrue(t.in.ObjectDeleted())
+	ExpectTrue(t.in.TakeObjectDeletion())
+	ExpectFalse(t.in.TakeObjectDeletion())
+}
+
+func (t *ClobberTest) DefaultIsError() {
+	t.createInode("")
+	t.clobber()
+
+	_, err := t.in.CheckReadError(t.ctx, t.readErr, true)
+
+	var clobberedErr *FileClobberedError
+	ExpectTrue(errors.As(err, &clobberedErr))
+}
+
+func (t *ClobberTest) Ignore() {
+	t.createInode(config.ClobberBehaviorIgnore)
+	t.clobber()
+
+	retry, err := t.in.CheckReadError(t.ctx, t.readErr, true)
+
+	ExpectFalse(retry)
+	ExpectEq(t.readErr, err)
+	ExpectEq(t.src.Generation, t.in.SourceGeneration().Object)
+	ExpectEq(1, t.nlink())
+}
+
+func (t *ClobberTest) Refresh_ReadOnly() {
+	t.createInode(config.ClobberBehaviorRefresh)
+	newGeneration := t.clobber()
+
+	retry, err := t.in.CheckReadError(t.ctx, t.readErr, true)
+
+	AssertEq(nil, err)
+	ExpectTrue(retry)
+	ExpectEq(newGeneration, t.in.SourceGeneration().Object)
+	ExpectEq(len("burrito"), t.in.Source().Size)
+	ExpectEq(1, t.nlink())
+}
+
+func (t *ClobberTest) Refresh_Writable() {
+	t.createInode(config.ClobberBehaviorRefresh)
+	t.clobber()
+
+	retry, err := t.in.CheckReadError(t.ctx, t.readErr, false)
+
+	ExpectFalse(retry)
+	var clobberedErr *FileClobberedError
+	ExpectTrue(errors.As(err, &clobberedErr))
+	ExpectEq(t.src.Generation, t.in.SourceGeneration().Object)
+}
+
+func (t *ClobberTest) Refresh_Dirty() {
+	t.createInode(config.ClobberBehaviorRefresh)
+	err := t.in.Write(t.ctx, []byte("enchilada"), 0)
+	AssertEq(nil, err)
+	t.clobber()
+
+	retry, err := t.in.CheckReadError(t.ctx, t.readErr, true)
+
+	ExpectFalse(retry)
+	var clobberedErr *FileClobberedError
+	ExpectTrue(errors.As(err, &clobberedErr))
+}
+
+func (t *ClobberTest) Refresh_Deleted() {
+	t.createInode(config.ClobberBehaviorRefresh)
+	err := t.bucket.DeleteObject(t.ctx, &gcs.DeleteObjectRequest{Name: fileName})
+	AssertEq(nil, err)
+
+	retry, err := t.in.CheckReadError(t.ctx, t.readErr, true)
+
+	ExpectFalse(retry)
+	var clobberedErr *FileClobberedError
+	ExpectTrue(errors.As(err, &clobberedErr))
+}
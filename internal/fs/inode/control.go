@@ -0,0 +1,463 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package inode
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/gcsx"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/locker"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/jacobsa/fuse"
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/fuseutil"
+	"golang.org/x/net/context"
+)
+
+// The name of the directory at the root of each bucket holding the control
+// files, which answer queries about the objects of the bucket rather than
+// standing for objects. Objects under it are shadowed by it.
+const ControlDirName = ".gcsfuse"
+
+// The control file reporting on the object at a path, looked up as
+// "objectinfo?path=<path>", where the path is relative to the root of the
+// bucket and escaped as in a URL query, e.g. with "/" as "%2F".
+const ObjectInfoFile = "objectinfo"
+
+// The control file answering the metadata queries written to it, as parsed by
+// ParseMetadataFileQuery, with the names of the matching objects.
+const QueryFile = "query"
+
+// ParseControlFileName parses the name of a file in the control directory into
+// the control file it names and the query it carries. It fails with ENOENT for
+// names of no control file, and with EINVAL for malformed queries.
+func ParseControlFileName(name string) (file string, query url.Values, err error) {
+	file, rawQuery, _ := strings.Cut(name, "?")
+	switch file {
+	case ObjectInfoFile:
+		query, err = url.ParseQuery(rawQuery)
+		if err == nil {
+			err = checkQueryParams(query, []string{"path"}, nil)
+		}
+	case QueryFile:
+		if strings.Contains(name, "?") {
+			err = errors.New("queries are written to the file")
+		}
+	default:
+		return "", nil, fuse.ENOENT
+	}
+
+	if err != nil {
+		return "", nil, fmt.Errorf("query of %q: %v: %w", name, err, syscall.EINVAL)
+	}
+	return
+}
+
+// ParseMetadataFileQuery parses a query written to QueryFile, in the syntax of
+// a URL query: "prefix=<path>&key=<key>&value=<value>", matching the objects
+// under the directory at the path relative to the root of the bucket, the
+// root itself if there is no prefix, whose custom metadata has the key with
+// the value, or with any value if there is no value. It fails with EINVAL for
+// malformed queries.
+func ParseMetadataFileQuery(s string) (prefix string, q MetadataQuery, err error) {
+	query, err := url.ParseQuery(s)
+	if err == nil {
+		err = checkQueryParams(query, []string{"key"}, []string{"prefix", "value"})
+	}
+	if err == nil && query.Get("key") == "" {
+		err = errors.New("empty metadata key")
+	}
+	if err != nil {
+		err = fmt.Errorf("metadata query %q: %v: %w", s, err, syscall.EINVAL)
+		return
+	}
+
+	prefix = query.Get("prefix")
+	q.Key = query.Get("key")
+	q.Value = query.Get("value")
+	q.AnyValue = !query.Has("value")
+	return
+}
+
+// checkQueryParams fails unless the query has each of the required parameters
+// once, and each of the optional ones at most once, and no others.
+func checkQueryParams(query url.Values, required []string, optional []string) error {
+	for _, p := range required {
+		if len(query[p]) != 1 {
+			return fmt.Errorf("want one %q parameter", p)
+		}
+	}
+
+	n := len(required)
+	for _, p := range optional {
+		switch len(query[p]) {
+		case 0:
+		case 1:
+			n++
+		default:
+			return fmt.Errorf("more than one %q parameter", p)
+		}
+	}
+
+	if len(query) != n {
+		return errors.New("unknown parameters")
+	}
+	return nil
+}
+
+////////////////////////////////////////////////////////////////////////
+// Control directory
+////////////////////////////////////////////////////////////////////////
+
+// ControlDirInode is the control directory of a bucket. It lists the control
+// files that aren't named by the queries they answer, and can't be modified.
+type ControlDirInode struct {
+	/////////////////////////
+	// Constant data
+	/////////////////////////
+
+	id    fuseops.InodeID
+	name  Name
+	attrs fuseops.InodeAttributes
+
+	// The root of the bucket, which the paths in queries are relative to.
+	root DirInode
+
+	// The names of the files listed.
+	files []string
+
+	/////////////////////////
+	// Mutable state
+	/////////////////////////
+
+	mu locker.RWLocker
+
+	// GUARDED_BY(mu)
+	lc lookupCount
+}
+
+var _ DirInode = &ControlDirInode{}
+
+// NewControlDirInode returns the control directory with the given name in the
+// supplied root of a bucket, listing the supplied control files.
+func NewControlDirInode(
+	id fuseops.InodeID,
+	name Name,
+	attrs fuseops.InodeAttributes,
+	root DirInode,
+	files []string) (d *ControlDirInode) {
+	d = &ControlDirInode{
+		id:    id,
+		name:  name,
+		attrs: attrs,
+		root:  root,
+		files: files,
+	}
+	d.lc.Init(id)
+	d.mu = locker.NewRW("ControlDirInode"+name.GcsObjectName(), func() {})
+	return
+}
+
+// Root returns the root of the bucket the directory is in. The kernel keeps
+// it alive while it keeps the directory.
+func (d *ControlDirInode) Root() DirInode {
+	return d.root
+}
+
+func (d *ControlDirInode) Lock() {
+	d.mu.Lock()
+}
+
+func (d *ControlDirInode) Unlock() {
+	d.mu.Unlock()
+}
+
+func (d *ControlDirInode) RLock() {
+	d.mu.RLock()
+}
+
+func (d *ControlDirInode) RUnlock() {
+	d.mu.RUnlock()
+}
+
+func (d *ControlDirInode) LockForChildLookup() {
+	d.mu.RLock()
+}
+
+func (d *ControlDirInode) UnlockForChildLookup() {
+	d.mu.RUnlock()
+}
+
+func (d *ControlDirInode) ID() fuseops.InodeID {
+	return d.id
+}
+
+func (d *ControlDirInode) Name() Name {
+	return d.name
+}
+
+// LOCKS_REQUIRED(d)
+func (d *ControlDirInode) IncrementLookupCount() {
+	d.lc.Inc()
+}
+
+// LOCKS_REQUIRED(d)
+func (d *ControlDirInode) DecrementLookupCount(n uint64) (destroy bool) {
+	destroy = d.lc.Dec(n)
+	return
+}
+
+// LOCKS_REQUIRED(d)
+func (d *ControlDirInode) Destroy() (err error) {
+	// Nothing interesting to do.
+	return
+}
+
+// LOCKS_REQUIRED(d)
+func (d *ControlDirInode) Attributes(
+	ctx context.Context) (attrs fuseops.InodeAttributes, err error) {
+	attrs = d.attrs
+	attrs.Nlink = 1
+	return
+}
+
+// The control files aren't objects, so the file system looks them up itself.
+func (d *ControlDirInode) LookUpChild(ctx context.Context, name string) (*Core, error) {
+	return nil, nil
+}
+
+// LOCKS_REQUIRED(d)
+func (d *ControlDirInode) ReadEntries(
+	ctx context.Context,
+	tok string) (entries []fuseutil.Dirent, newTok string, err error) {
+	for _, file := range d.files {
+		entries = append(entries, fuseutil.Dirent{Name: file, Type: fuseutil.DT_File})
+	}
+	return
+}
+
+func (d *ControlDirInode) ReadDescendants(ctx context.Context, limit int) (map[Name]*Core, error) {
+	return nil, nil
+}
+
+// Not implemented
+func (d *ControlDirInode) ListMatching(ctx context.Context, pattern string, maxBytes int) ([]string, error) {
+	return nil, fuse.ENOATTR
+}
+
+// Not implemented
+func (d *ControlDirInode) QueryMetadata(
+	ctx context.Context,
+	q MetadataQuery,
+	maxObjects int,
+	maxBytes int) ([]string, bool, error) {
+	return nil, false, fuse.ENOATTR
+}
+
+// Not implemented
+func (d *ControlDirInode) Usage(ctx context.Context, maxObjects int, maxParallel int) (DirUsage, error) {
+	return DirUsage{}, fuse.ENOATTR
+}
+
+func (d *ControlDirInode) UsageProgress() *gcsx.PrefixUsageProgress {
+	return nil
+}
+
+func (d *ControlDirInode) ListDenied() bool {
+	return false
+}
+
+func (d *ControlDirInode) LocalFileEntries(localFileInodes map[Name]Inode) (localEntries []fuseutil.Dirent) {
+	return nil
+}
+
+func (d *ControlDirInode) ShouldInvalidateKernelListCache(ttl time.Duration) bool {
+	return false
+}
+
+func (d *ControlDirInode) InvalidateChild(name string) {
+}
+
+func (d *ControlDirInode) ChildKnownMissing(name string) bool {
+	return false
+}
+
+func (d *ControlDirInode) ChildKnownFile(name string) bool {
+	return false
+}
+
+func (d *ControlDirInode) CompatDirMarkerOf(ctx context.Context, name string) (string, error) {
+	return "", nil
+}
+
+// The control directory can't be modified. The file system refuses to before
+// getting here, so these are only a safety net.
+
+func (d *ControlDirInode) CreateChildFile(ctx context.Context, name string) (*Core, error) {
+	return nil, syscall.EPERM
+}
+
+func (d *ControlDirInode) CreateLocalChildFile(name string) (*Core, error) {
+	return nil, syscall.EPERM
+}
+
+func (d *ControlDirInode) CloneToChildFile(ctx context.Context, name string, src *gcs.MinObject) (*Core, error) {
+	return nil, syscall.EPERM
+}
+
+func (d *ControlDirInode) CreateChildSymlink(ctx context.Context, name string, target string) (*Core, error) {
+	return nil, syscall.EPERM
+}
+
+func (d *ControlDirInode) CreateChildDir(ctx context.Context, name string) (*Core, error) {
+	return nil, syscall.EPERM
+}
+
+func (d *ControlDirInode) DeleteChildFile(
+	ctx context.Context,
+	name string,
+	generation int64,
+	metaGeneration *int64) error {
+	return syscall.EPERM
+}
+
+func (d *ControlDirInode) DeleteChildDir(
+	ctx context.Context,
+	name string,
+	isImplicitDir bool) error {
+	return syscall.EPERM
+}
+
+func (d *ControlDirInode) RenameFolder(
+	ctx context.Context,
+	folderName string,
+	name string) (*gcs.Folder, error) {
+	return nil, syscall.EPERM
+}
+
+////////////////////////////////////////////////////////////////////////
+// Control files
+////////////////////////////////////////////////////////////////////////
+
+// ControlFileInode is a file in the control directory, named by the control
+// file and the query it answers. The file system computes the answer when the
+// file is opened.
+type ControlFileInode struct {
+	/////////////////////////
+	// Constant data
+	/////////////////////////
+
+	id    fuseops.InodeID
+	name  Name
+	attrs fuseops.InodeAttributes
+	root  DirInode
+	file  string
+	query url.Values
+
+	/////////////////////////
+	// Mutable state
+	/////////////////////////
+
+	mu locker.Locker
+
+	// GUARDED_BY(mu)
+	lc lookupCount
+}
+
+var _ Inode = &ControlFileInode{}
+
+// NewControlFileInode returns the control file with the given name in the
+// supplied control directory, with the control file and query parsed from the
+// name by ParseControlFileName.
+func NewControlFileInode(
+	id fuseops.InodeID,
+	name Name,
+	attrs fuseops.InodeAttributes,
+	dir *ControlDirInode,
+	file string,
+	query url.Values) (f *ControlFileInode) {
+	f = &ControlFileInode{
+		id:    id,
+		name:  name,
+		attrs: attrs,
+		root:  dir.Root(),
+		file:  file,
+		query: query,
+	}
+	f.lc.Init(id)
+	f.mu = locker.New("ControlFileInode"+name.GcsObjectName(), func() {})
+	return
+}
+
+// Root returns the root of the bucket the paths in the query are relative to.
+func (f *ControlFileInode) Root() DirInode {
+	return f.root
+}
+
+// File returns the control file, e.g. ObjectInfoFile.
+func (f *ControlFileInode) File() string {
+	return f.file
+}
+
+// Query returns the query the file answers.
+func (f *ControlFileInode) Query() url.Values {
+	return f.query
+}
+
+func (f *ControlFileInode) Lock() {
+	f.mu.Lock()
+}
+
+func (f *ControlFileInode) Unlock() {
+	f.mu.Unlock()
+}
+
+func (f *ControlFileInode) ID() fuseops.InodeID {
+	return f.id
+}
+
+func (f *ControlFileInode) Name() Name {
+	return f.name
+}
+
+// LOCKS_REQUIRED(f)
+func (f *ControlFileInode) IncrementLookupCount() {
+	f.lc.Inc()
+}
+
+// LOCKS_REQUIRED(f)
+func (f *ControlFileInode) DecrementLookupCount(n uint64) (destroy bool) {
+	destroy = f.lc.Dec(n)
+	return
+}
+
+// LOCKS_REQUIRED(f)
+func (f *ControlFileInode) Destroy() (err error) {
+	// Nothing interesting to do.
+	return
+}
+
+// LOCKS_REQUIRED(f)
+func (f *ControlFileInode) Attributes(
+	ctx context.Context) (attrs fuseops.InodeAttributes, err error) {
+	attrs = f.attrs
+	attrs.Nlink = 1
+	return
+}
@@ -0,0 +1,96 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package inode_test
+
+import (
+	"errors"
+	"net/url"
+	"syscall"
+	"testing"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/fs/inode"
+	. "github.com/jacobsa/oglematchers"
+	. "github.com/jacobsa/ogletest"
+)
+
+func TestParseControlFileName(t *testing.T) {
+	file, query, err := inode.ParseControlFileName("objectinfo?path=dir%2Ffoo%3Fbar")
+
+	AssertEq(nil, err)
+	ExpectEq(inode.ObjectInfoFile, file)
+	ExpectThat(query, DeepEquals(url.Values{"path": {"dir/foo?bar"}}))
+}
+
+func TestParseControlFileName_UnknownFile(t *testing.T) {
+	_, _, err := inode.ParseControlFileName("taco?path=foo")
+
+	ExpectTrue(errors.Is(err, syscall.ENOENT), "%v", err)
+}
+
+func TestParseControlFileName_MalformedQuery(t *testing.T) {
+	for _, name := range []string{
+		"objectinfo",
+		"objectinfo?",
+		"objectinfo?name=foo",
+		"objectinfo?path=foo&path=bar",
+		"objectinfo?path=foo&name=bar",
+		"objectinfo?path=%zz",
+	} {
+		_, _, err := inode.ParseControlFileName(name)
+		ExpectTrue(errors.Is(err, syscall.EINVAL), "%s: %v", name, err)
+	}
+}
+
+func TestParseControlFileName_QueryFile(t *testing.T) {
+	file, query, err := inode.ParseControlFileName("query")
+	AssertEq(nil, err)
+	ExpectEq(inode.QueryFile, file)
+	ExpectEq(0, len(query))
+
+	_, _, err = inode.ParseControlFileName("query?key=label")
+	ExpectTrue(errors.Is(err, syscall.EINVAL), "%v", err)
+}
+
+func TestParseMetadataFileQuery(t *testing.T) {
+	prefix, q, err := inode.ParseMetadataFileQuery("prefix=dir%2Fsub&key=label&value=cat")
+	AssertEq(nil, err)
+	ExpectEq("dir/sub", prefix)
+	ExpectThat(q, DeepEquals(inode.MetadataQuery{Key: "label", Value: "cat"}))
+
+	prefix, q, err = inode.ParseMetadataFileQuery("key=label&value=")
+	AssertEq(nil, err)
+	ExpectEq("", prefix)
+	ExpectThat(q, DeepEquals(inode.MetadataQuery{Key: "label"}))
+
+	prefix, q, err = inode.ParseMetadataFileQuery("key=label")
+	AssertEq(nil, err)
+	ExpectEq("", prefix)
+	ExpectThat(q, DeepEquals(inode.MetadataQuery{Key: "label", AnyValue: true}))
+}
+
+func TestParseMetadataFileQuery_Malformed(t *testing.T) {
+	for _, s := range []string{
+		"",
+		"prefix=dir",
+		"key=",
+		"key=label&key=source",
+		"key=label&value=cat&value=dog",
+		"key=label&taco=1",
+		"key=%zz",
+	} {
+		_, _, err := inode.ParseMetadataFileQuery(s)
+		ExpectTrue(errors.Is(err, syscall.EINVAL), "%q: %v", s, err)
+	}
+}
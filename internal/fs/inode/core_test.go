@@ -48,7 +48,7 @@ func init() { RegisterTestSuite(&CoreTest{}) }
 func (t *CoreTest) SetUp(ti *TestInfo) {
 	t.ctx = ti.Ctx
 	t.bucket = gcsx.NewSyncerBucket(
-		1, ".gcsfuse_tmp/", fake.NewFakeBucket(&t.clock, "some_bucket"))
+		gcsx.SyncerConfig{AppendThreshold: 1, TmpObjectPrefix: ".gcsfuse_tmp/"}, fake.NewFakeBucket(&t.clock, "some_bucket"))
 	t.clock.SetTime(time.Date(2012, 8, 15, 22, 56, 0, 0, time.Local))
 }
 
@@ -0,0 +1,47 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package inode
+
+import (
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/gcsx"
+)
+
+// PlanDirDelete returns the object-level operations of deleting the empty
+// directory dir in a bucket without a hierarchical namespace: deleting its
+// backing object unless it is implicit, and then its compat marker, named
+// compatMarker, if it has one.
+func PlanDirDelete(dir Name, isImplicitDir bool, compatMarker string) *gcsx.MutationPlan {
+	plan := &gcsx.MutationPlan{Operation: "rmdir", Target: dir.LocalName()}
+	addDirDeletion(plan, dir, isImplicitDir, compatMarker)
+	return plan
+}
+
+// PlanUnlink returns the object-level operation of unlinking the file name,
+// deleting its backing object.
+func PlanUnlink(name Name) *gcsx.MutationPlan {
+	plan := &gcsx.MutationPlan{Operation: "unlink", Target: name.LocalName()}
+	plan.Add(gcsx.MutationDelete, name.GcsObjectName())
+	return plan
+}
+
+// addDirDeletion adds the steps of PlanDirDelete to the plan.
+func addDirDeletion(plan *gcsx.MutationPlan, dir Name, isImplicitDir bool, compatMarker string) {
+	if !isImplicitDir {
+		plan.Add(gcsx.MutationDelete, dir.GcsObjectName())
+	}
+	if compatMarker != "" {
+		plan.Add(gcsx.MutationDelete, compatMarker)
+	}
+}
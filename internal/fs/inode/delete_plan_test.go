@@ -0,0 +1,68 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package inode_test
+
+import (
+	"testing"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/fs/inode"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/gcsx"
+	. "github.com/jacobsa/oglematchers"
+	. "github.com/jacobsa/ogletest"
+)
+
+func TestPlanDirDelete(t *testing.T) {
+	dir := inode.NewDirName(inode.NewRootName(""), "foo")
+
+	plan := inode.PlanDirDelete(dir, false, "")
+
+	ExpectEq("rmdir", plan.Operation)
+	ExpectEq("foo/", plan.Target)
+	ExpectThat(plan.Steps, DeepEquals([]gcsx.MutationStep{
+		{Op: gcsx.MutationDelete, Object: "foo/"},
+	}))
+}
+
+func TestPlanDirDelete_CompatMarkerIsDeletedToo(t *testing.T) {
+	dir := inode.NewDirName(inode.NewRootName(""), "foo")
+
+	plan := inode.PlanDirDelete(dir, false, "foo")
+
+	ExpectThat(plan.Steps, DeepEquals([]gcsx.MutationStep{
+		{Op: gcsx.MutationDelete, Object: "foo/"},
+		{Op: gcsx.MutationDelete, Object: "foo"},
+	}))
+}
+
+func TestPlanDirDelete_ImplicitDirHasNoObjectToDelete(t *testing.T) {
+	dir := inode.NewDirName(inode.NewRootName(""), "foo")
+
+	ExpectEq(0, len(inode.PlanDirDelete(dir, true, "").Steps))
+	ExpectThat(inode.PlanDirDelete(dir, true, "foo").Steps, DeepEquals([]gcsx.MutationStep{
+		{Op: gcsx.MutationDelete, Object: "foo"},
+	}))
+}
+
+func TestPlanUnlink(t *testing.T) {
+	name := inode.NewFileName(inode.NewDirName(inode.NewRootName(""), "foo"), "bar")
+
+	plan := inode.PlanUnlink(name)
+
+	ExpectEq("unlink", plan.Operation)
+	ExpectEq("foo/bar", plan.Target)
+	ExpectThat(plan.Steps, DeepEquals([]gcsx.MutationStep{
+		{Op: gcsx.MutationDelete, Object: "foo/bar"},
+	}))
+}
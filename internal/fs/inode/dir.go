@@ -17,11 +17,16 @@ package inode
 import (
 	"errors"
 	"fmt"
+	"net/http"
 	"path"
+	"slices"
 	"strings"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/metadata"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/config"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/gcsx"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/locker"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
@@ -31,6 +36,7 @@ import (
 	"github.com/jacobsa/syncutil"
 	"github.com/jacobsa/timeutil"
 	"golang.org/x/net/context"
+	"google.golang.org/api/googleapi"
 )
 
 // ListObjects call supports fetching upto 5000 results when projection is noAcl
@@ -40,6 +46,87 @@ import (
 // Defining a constant to set maxResults param.
 const MaxResultsForListObjectsCall = 5000
 
+// The prefix of the extended attributes of directories listing the objects
+// under the directory that match a glob, e.g. user.gcsfuse.glob.*.csv. The
+// glob, in the syntax of storageutil.CompileGlob, follows the prefix and is
+// relative to the directory. GCS does the matching, so a narrow glob over a
+// huge directory doesn't list all of it.
+const GlobXattrPrefix = XattrPrefix + "glob."
+
+// The prefix of the extended attributes of directories listing the objects
+// under the directory, recursively, whose custom metadata matches a query,
+// e.g. user.gcsfuse.metadata.label=cat. The query, in the syntax of
+// ParseMetadataQuery, follows the prefix. GCS can't filter listings on
+// metadata, so the matching is done here over a listing bounded in the number
+// of objects scanned and in time.
+const MetadataXattrPrefix = XattrPrefix + "metadata."
+
+// A MetadataQuery matches the objects whose custom metadata has the key Key,
+// with the value Value unless AnyValue is set.
+type MetadataQuery struct {
+	Key      string
+	Value    string
+	AnyValue bool
+}
+
+// ParseMetadataQuery parses "key=value", matching the objects with that value
+// of the key, or "key", matching those with any value of it. The key ends at
+// the first "=", so values may contain "=" but keys may not.
+func ParseMetadataQuery(s string) (q MetadataQuery, err error) {
+	var found bool
+	q.Key, q.Value, found = strings.Cut(s, "=")
+	q.AnyValue = !found
+	if q.Key == "" {
+		err = errors.New("empty metadata key")
+	}
+	return
+}
+
+func (q MetadataQuery) matches(metadata map[string]string) bool {
+	v, ok := metadata[q.Key]
+	return ok && (q.AnyValue || v == q.Value)
+}
+
+// The extended attributes of directories reporting the total size and the
+// number of the objects under the directory, recursively, as computed by
+// DirInode.Usage.
+const (
+	RecursiveSizeXattr = XattrPrefix + "recursive_size"
+	ObjectCountXattr   = XattrPrefix + "object_count"
+)
+
+// The extended attribute of directories reporting how far the listing for
+// the attributes above has got, as given by
+// gcsx.PrefixUsageProgress.String. It can be read while the listing runs.
+const UsageProgressXattr = XattrPrefix + "usage_progress"
+
+// How long the usage computed by DirInode.Usage is reused for.
+const DirUsageTTL = time.Hour
+
+// How long a directory whose listing was forbidden keeps failing with
+// syscall.EACCES without asking GCS again.
+const ListDeniedTTL = 5 * time.Second
+
+// DefaultCompatDirMarkerType is the content type S3-compatible tools give the
+// empty objects marking directories.
+const DefaultCompatDirMarkerType = "application/x-directory"
+
+// IsCompatDirMarker reports whether the object marks the directory of the same
+// name the way S3-compatible tools do, rather than with a trailing slash: it's
+// empty, and its content type is one of contentTypes.
+func IsCompatDirMarker(m *gcs.MinObject, contentTypes []string) bool {
+	return m != nil &&
+		m.Size == 0 &&
+		!strings.HasSuffix(m.Name, "/") &&
+		slices.Contains(contentTypes, m.ContentType)
+}
+
+// DirUsage is what the objects under a directory, recursively, take up.
+type DirUsage struct {
+	ObjectCount   int
+	RecursiveSize uint64
+}
+
 // An inode representing a directory, with facilities for listing entries,
 // looking up children, and creating and deleting children. Must be locked for
 // any method additional to the Inode interface.
@@ -69,6 +156,41 @@ type DirInode interface {
 	// call.
 	ReadDescendants(ctx context.Context, limit int) (map[Name]*Core, error)
 
+	// List the names, relative to this dir, of the objects under it whose
+	// relative names match the glob. Fail with syscall.E2BIG once the names,
+	// each with a separator, take more than maxBytes.
+	ListMatching(ctx context.Context, pattern string, maxBytes int) ([]string, error)
+
+	// List the names, relative to this dir, of the objects under it,
+	// recursively, whose custom metadata matches the query. Stop early,
+	// reporting that the names are truncated, once maxObjects objects have
+	// been scanned, the deadline of ctx has passed, or the names, each with a
+	// separator, would take more than maxBytes. maxObjects must be positive.
+	//
+	// Unlike the other methods, this doesn't require the lock, so that a long
+	// query doesn't hold up the dir.
+	QueryMetadata(
+		ctx context.Context,
+		q MetadataQuery,
+		maxObjects int,
+		maxBytes int) (names []string, truncated bool, err error)
+
+	// Return the number and total size of the objects under this dir,
+	// recursively, other than its own placeholder object. The result of a
+	// listing is reused for DirUsageTTL, bypassing the stat and type caches.
+	// The listing is made by gcsx.SumPrefix with up to maxParallel pages in
+	// flight. Fail with syscall.E2BIG if there are more than maxObjects.
+	Usage(ctx context.Context, maxObjects int, maxParallel int) (DirUsage, error)
+
+	// Return the progress of the listing made by the latest call to Usage that
+	// listed, running or not, or nil if none has. Unlike the other methods, it
+	// may be called without the lock, e.g. while Usage is listing.
+	UsageProgress() *gcsx.PrefixUsageProgress
+
+	// Report whether the last listing of this dir was forbidden, less than
+	// ListDeniedTTL ago. Until then, ReadEntries fails with syscall.EACCES.
+	ListDenied() bool
+
 	// Read some number of entries from the directory, returning a continuation
 	// token that can be used to pick up the read operation where it left off.
 	// Supply the empty token on the first call.
@@ -79,7 +201,7 @@ type DirInode interface {
 	// continuation token.
 	//
 	// The contents of the Offset and Inode fields for returned entries is
-	// undefined.
+	// undefined. The Type field is always filled in from the listing.
 	ReadEntries(
 		ctx context.Context,
 		tok string) (entries []fuseutil.Dirent, newTok string, err error)
@@ -106,7 +228,8 @@ type DirInode interface {
 
 	// Create a backing object for a child directory with the supplied (relative)
 	// name, failing with *gcs.PreconditionError if a backing object already
-	// exists in GCS.
+	// exists in GCS. In a bucket with a hierarchical namespace, create a folder
+	// instead.
 	// Return the full name of the child and the GCS object it backs up.
 	CreateChildDir(ctx context.Context, name string) (*Core, error)
 
@@ -123,12 +246,28 @@ type DirInode interface {
 		metaGeneration *int64) (err error)
 
 	// Delete the backing object for the child directory with the given
-	// (relative) name if it is not an Implicit Directory.
+	// (relative) name if it is not an Implicit Directory. In a bucket with a
+	// hierarchical namespace, delete the backing folder instead.
 	DeleteChildDir(
 		ctx context.Context,
 		name string,
 		isImplicitDir bool) (err error)
 
+	// Return the name of the compat marker standing for the child directory
+	// with the given (relative) name, which DeleteChildDir deletes along with
+	// it, or the empty string if there is none.
+	CompatDirMarkerOf(ctx context.Context, name string) (string, error)
+
+	// Atomically rename the folder with the given full name, and everything
+	// under it, to the child directory with the given (relative) name, in a
+	// bucket with a hierarchical namespace. Fails with *gcs.PreconditionError
+	// if the child directory already exists.
+	// Return the renamed folder.
+	RenameFolder(
+		ctx context.Context,
+		folderName string,
+		name string) (*gcs.Folder, error)
+
 	// LocalFileEntries lists the local files present in the directory.
 	// Local means that the file is not yet present on GCS.
 	LocalFileEntries(localFileInodes map[Name]Inode) (localEntries []fuseutil.Dirent)
@@ -144,6 +283,21 @@ type DirInode interface {
 	// should be invalidated or not.
 	ShouldInvalidateKernelListCache(ttl time.Duration) bool
 
+	// InvalidateChild makes a local change to the child with the given name
+	// visible to the next lookup and listing of the directory. The methods
+	// above that create, delete or rename children call it themselves; the
+	// filesystem calls it for changes that don't go through them, such as
+	// unlinking a local file.
+	InvalidateChild(name string)
+
+	// ChildKnownMissing reports whether the type cache holds a nonexistent
+	// entry for the child with the given name that hasn't expired yet.
+	ChildKnownMissing(name string) bool
+
+	// ChildKnownFile reports whether the type cache holds a file entry for the
+	// child with the given name that hasn't expired yet.
+	ChildKnownFile(name string) bool
+
 	// RLock readonly lock.
 	RLock()
 
@@ -176,6 +330,16 @@ type dirInode struct {
 
 	enableNonexistentTypeCache bool
 
+	// One of config.DirTimesMount, config.DirTimesPlaceholder and
+	// config.DirTimesNewestChild.
+	dirTimes string
+
+	// The content types of the empty objects standing for directories.
+	compatDirMarkerTypes []string
+
+	// How long the newest child time derived from a listing stays valid.
+	listingTTL time.Duration
+
 	// INVARIANT: name.IsDir()
 	name Name
 
@@ -197,11 +361,46 @@ type dirInode struct {
 	// GUARDED_BY(mu)
 	cache metadata.TypeCache
 
+	// Detects the child directories changing kind between lookups and
+	// listings.
+	typeFlaps dirTypeFlaps
+
 	// prevDirListingTimeStamp is the time stamp of previous listing when user asked
 	// (via kernel) the directory listing from the filesystem.
 	// Specially used when kernelListCacheTTL > 0 that means kernel list-cache is
 	// enabled.
 	prevDirListingTimeStamp *time.Time
+
+	// The latest update time of the children seen so far by the listing in
+	// progress. Only maintained with config.DirTimesNewestChild.
+	//
+	// GUARDED_BY(mu)
+	listingNewestChildTime time.Time
+
+	// The latest update time of the children seen by the last complete
+	// listing, zero if there were none, and when it stops being valid.
+	//
+	// GUARDED_BY(mu)
+	newestChildTime       time.Time
+	newestChildTimeExpiry time.Time
+
+	// The result of the last listing made by Usage, which is nil or wraps
+	// syscall.E2BIG, and when it stops being valid.
+	//
+	// GUARDED_BY(mu)
+	usage       DirUsage
+	usageErr    error
+	usageExpiry time.Time
+
+	// The progress of that listing, or nil. Not guarded by mu; see
+	// UsageProgress.
+	usageProgress atomic.Pointer[gcsx.PrefixUsageProgress]
+
+	// When the denial of the last listing stops being remembered, zero if it
+	// wasn't denied.
+	//
+	// GUARDED_BY(mu)
+	listDeniedUntil time.Time
 }
 
 var _ DirInode = &dirInode{}
@@ -215,13 +414,23 @@ var _ DirInode = &dirInode{}
 // descendents. For example, if there is an object named "foo/bar/baz" and this
 // is the directory "foo", a child directory named "bar" will be implied.
 //
-// If typeCacheTTL is non-zero, a cache from child name to information about
-// whether that name exists as a file/symlink and/or directory will be
-// maintained. This may speed up calls to LookUpChild, especially when combined
+// If either of typeCacheTTLs is non-zero, a cache from child name to
+// information about whether that name exists as a file/symlink and/or
+// directory will be maintained, keeping each kind of child for its ttl. This may speed up calls to LookUpChild, especially when combined
 // with a stat-caching GCS bucket, but comes at the cost of consistency: if the
 // child is removed and recreated with a different type before the expiration,
 // we may fail to find it.
 //
+// dirTimes controls the mtime and ctime reported for the directory; see
+// config.DirTimesMount and friends. With config.DirTimesNewestChild, they are
+// derived from the children seen by ReadEntries, for the shorter of
+// typeCacheTTLs. Otherwise,
+// or if there is no such listing, the times in attrs are used.
+//
+// Empty objects with one of compatDirMarkerTypes as their content type stand
+// for the directory of the same name, as S3-compatible tools mark them; see
+// IsCompatDirMarker.
+//
 // The initial lookup count is zero.
 //
 // REQUIRES: name.IsDir()
@@ -232,11 +441,13 @@ func NewDirInode(
 	implicitDirs bool,
 	enableManagedFoldersListing bool,
 	enableNonexistentTypeCache bool,
-	typeCacheTTL time.Duration,
+	typeCacheTTLs metadata.EntryTTLs,
 	bucket *gcsx.SyncerBucket,
 	mtimeClock timeutil.Clock,
 	cacheClock timeutil.Clock,
-	typeCacheMaxSizeMB int) (d DirInode) {
+	typeCacheMaxSizeMB int,
+	dirTimes string,
+	compatDirMarkerTypes []string) (d DirInode) {
 
 	if !name.IsDir() {
 		panic(fmt.Sprintf("Unexpected name: %s", name))
@@ -250,9 +461,12 @@ func NewDirInode(
 		implicitDirs:                implicitDirs,
 		enableManagedFoldersListing: enableManagedFoldersListing,
 		enableNonexistentTypeCache:  enableNonexistentTypeCache,
+		dirTimes:                    dirTimes,
+		compatDirMarkerTypes:        compatDirMarkerTypes,
+		listingTTL:                  typeCacheTTLs.Min(),
 		name:                        name,
 		attrs:                       attrs,
-		cache:                       metadata.NewTypeCache(typeCacheMaxSizeMB, typeCacheTTL),
+		cache:                       metadata.NewTypeCache(typeCacheMaxSizeMB, typeCacheTTLs),
 	}
 
 	typed.lc.Init(id)
@@ -275,6 +489,51 @@ func (d *dirInode) checkInvariants() {
 	}
 }
 
+// Compat markers stand for directories only in buckets without a hierarchical
+// namespace, where directories needn't be backed by anything.
+func (d *dirInode) isCompatDirMarker(m *gcs.MinObject) bool {
+	return !d.isHierarchical() && IsCompatDirMarker(m, d.compatDirMarkerTypes)
+}
+
+// Return the compat marker standing for the child directory with the given
+// name, or nil if there is none.
+func (d *dirInode) compatDirMarker(ctx context.Context, name string) (*Core, error) {
+	if len(d.compatDirMarkerTypes) == 0 {
+		return nil, nil
+	}
+
+	marker, err := d.lookUpChildFile(ctx, name)
+	if err != nil || marker == nil || !d.isCompatDirMarker(marker.MinObject) {
+		return nil, err
+	}
+	return marker, nil
+}
+
+// Delete the compat marker standing for the child directory with the given
+// name, if there is one.
+func (d *dirInode) deleteCompatDirMarker(ctx context.Context, name string) error {
+	marker, err := d.compatDirMarker(ctx, name)
+	if err != nil || marker == nil {
+		return err
+	}
+
+	// Leave the object alone if it has been replaced in the meantime.
+	err = d.bucket.DeleteObject(
+		ctx,
+		&gcs.DeleteObjectRequest{
+			Name:                       marker.MinObject.Name,
+			Generation:                 marker.MinObject.Generation,
+			MetaGenerationPrecondition: &marker.MinObject.MetaGeneration,
+		})
+
+	var notFoundErr *gcs.NotFoundError
+	var preconditionErr *gcs.PreconditionError
+	if errors.As(err, &notFoundErr) || errors.As(err, &preconditionErr) {
+		return nil
+	}
+	return err
+}
+
 func (d *dirInode) lookUpChildFile(ctx context.Context, name string) (*Core, error) {
 	return findExplicitInode(ctx, d.Bucket(), NewFileName(d.Name(), name))
 }
@@ -313,6 +572,11 @@ func (d *dirInode) lookUpConflicting(ctx context.Context, name string) (*Core, e
 		return nil, fmt.Errorf("lookUpChildFile for stripped name: %w", err)
 	}
 
+	// A compat marker isn't a file conflicting with the directory.
+	if result != nil && d.isCompatDirMarker(result.MinObject) {
+		return nil, nil
+	}
+
 	return result, nil
 }
 
@@ -344,6 +608,13 @@ func findExplicitInode(ctx context.Context, bucket *gcsx.SyncerBucket, name Name
 	}, nil
 }
 
+// isPermissionDenied reports whether err is GCS forbidding the request to the
+// caller.
+func isPermissionDenied(err error) bool {
+	var apiErr *googleapi.Error
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusForbidden
+}
+
 // findDirInode finds the dir inode core where the directory is either explicit
 // or implicit. Returns nil if no such directory exists.
 func findDirInode(ctx context.Context, bucket *gcsx.SyncerBucket, name Name) (*Core, error) {
@@ -351,9 +622,12 @@ func findDirInode(ctx context.Context, bucket *gcsx.SyncerBucket, name Name) (*C
 		return nil, fmt.Errorf("%q is not directory", name)
 	}
 
+	// Only existence matters here, so ask for names alone. This also lets the
+	// stat cache answer repeated probes for the same prefix.
 	req := &gcs.ListObjectsRequest{
-		Prefix:     name.GcsObjectName(),
-		MaxResults: 1,
+		Prefix:         name.GcsObjectName(),
+		MaxResults:     1,
+		FetchOnlyNames: true,
 	}
 	listing, err := bucket.ListObjects(ctx, req)
 	if err != nil {
@@ -364,13 +638,22 @@ func findDirInode(ctx context.Context, bucket *gcsx.SyncerBucket, name Name) (*C
 		return nil, nil
 	}
 
+	// The directory has a placeholder object. The listing carries only its
+	// name, so stat it for the full record.
+	if listing.Objects[0].Name == name.GcsObjectName() {
+		result, err := findExplicitInode(ctx, bucket, name)
+		if err != nil || result != nil {
+			return result, err
+		}
+
+		// The placeholder went away in the meantime. Fall through and treat the
+		// directory as implicit.
+	}
+
 	result := &Core{
 		Bucket:   bucket,
 		FullName: name,
 	}
-	if o := listing.Objects[0]; o.Name == name.GcsObjectName() {
-		result.MinObject = storageutil.ConvertObjToMinObject(o)
-	}
 	return result, nil
 }
 
@@ -397,6 +680,12 @@ func (d *dirInode) createNewObject(
 	return
 }
 
+// isHierarchical reports whether directories are backed by folders rather
+// than objects.
+func (d *dirInode) isHierarchical() bool {
+	return d.bucket.BucketType() == gcs.Hierarchical
+}
+
 ////////////////////////////////////////////////////////////////////////
 // Public interface
 ////////////////////////////////////////////////////////////////////////
@@ -462,9 +751,45 @@ func (d *dirInode) Attributes(
 	attrs = d.attrs
 	attrs.Nlink = 1
 
+	if d.dirTimes == config.DirTimesNewestChild &&
+		!d.newestChildTime.IsZero() &&
+		d.cacheClock.Now().Before(d.newestChildTimeExpiry) {
+		attrs.Mtime = d.newestChildTime
+		attrs.Ctime = d.newestChildTime
+	}
+
 	return
 }
 
+// recordNewestChildTime folds the update times of the listed objects into the
+// listing in progress, which starts at the first page (tok is empty) and ends
+// at the last one (newTok is empty).
+//
+// LOCKS_REQUIRED(d)
+func (d *dirInode) recordNewestChildTime(objects []*gcs.Object, tok string, newTok string) {
+	if d.dirTimes != config.DirTimesNewestChild {
+		return
+	}
+
+	if tok == "" {
+		d.listingNewestChildTime = time.Time{}
+	}
+
+	for _, o := range objects {
+		if o.Name == d.Name().GcsObjectName() || o.Name == "" {
+			continue
+		}
+		if o.Updated.After(d.listingNewestChildTime) {
+			d.listingNewestChildTime = o.Updated
+		}
+	}
+
+	if newTok == "" {
+		d.newestChildTime = d.listingNewestChildTime
+		d.newestChildTimeExpiry = d.cacheClock.Now().Add(d.listingTTL)
+	}
+}
+
 func (d *dirInode) Bucket() *gcsx.SyncerBucket {
 	return d.bucket
 }
@@ -477,6 +802,16 @@ func (d *dirInode) Bucket() *gcsx.SyncerBucket {
 // See also the notes on DirInode.LookUpChild.
 const ConflictingFileNameSuffix = "\n"
 
+// LOCKS_REQUIRED(d)
+func (d *dirInode) ChildKnownMissing(name string) bool {
+	return d.cache.Get(d.cacheClock.Now(), name) == metadata.NonexistentType
+}
+
+// LOCKS_REQUIRED(d)
+func (d *dirInode) ChildKnownFile(name string) bool {
+	return d.cache.Get(d.cacheClock.Now(), name) == metadata.RegularFileType
+}
+
 // LOCKS_REQUIRED(d)
 func (d *dirInode) LookUpChild(ctx context.Context, name string) (*Core, error) {
 	// Is this a conflict marker name?
@@ -484,6 +819,8 @@ func (d *dirInode) LookUpChild(ctx context.Context, name string) (*Core, error)
 		return d.lookUpConflicting(ctx, name)
 	}
 
+	cachedType := d.cache.Get(d.cacheClock.Now(), name)
+
 	var fileResult *Core
 	var dirResult *Core
 	lookUpFile := func(ctx context.Context) (err error) {
@@ -492,6 +829,16 @@ func (d *dirInode) LookUpChild(ctx context.Context, name string) (*Core, error)
 	}
 	lookUpExplicitDir := func(ctx context.Context) (err error) {
 		dirResult, err = findExplicitInode(ctx, d.Bucket(), NewDirName(d.Name(), name))
+
+		// A directory seen by our listing stays visible even if the caller may
+		// not look inside it, as with a managed folder it has no permissions
+		// on. Listing it then fails instead.
+		if isPermissionDenied(err) && cachedType == metadata.ExplicitDirType {
+			dirResult, err = &Core{
+				Bucket:   d.Bucket(),
+				FullName: NewDirName(d.Name(), name),
+			}, nil
+		}
 		return
 	}
 	lookUpImplicitOrExplicitDir := func(ctx context.Context) (err error) {
@@ -501,7 +848,6 @@ func (d *dirInode) LookUpChild(ctx context.Context, name string) (*Core, error)
 
 	b := syncutil.NewBundle(ctx)
 
-	cachedType := d.cache.Get(d.cacheClock.Now(), name)
 	switch cachedType {
 	case metadata.ImplicitDirType:
 		dirResult = &Core{
@@ -528,6 +874,18 @@ func (d *dirInode) LookUpChild(ctx context.Context, name string) (*Core, error)
 		return nil, err
 	}
 
+	// A compat marker stands for the directory, unless there is one already.
+	// Either way, it isn't a file.
+	if fileResult != nil && d.isCompatDirMarker(fileResult.MinObject) {
+		fileResult = nil
+		if dirResult == nil {
+			dirResult = &Core{
+				Bucket:   d.Bucket(),
+				FullName: NewDirName(d.Name(), name),
+			}
+		}
+	}
+
 	var result *Core
 	if dirResult != nil {
 		result = dirResult
@@ -536,6 +894,7 @@ func (d *dirInode) LookUpChild(ctx context.Context, name string) (*Core, error)
 	}
 
 	if result != nil {
+		d.typeFlaps.observe(ctx, d.Name(), name, result.Type())
 		d.cache.Insert(d.cacheClock.Now(), name, result.Type())
 	} else if d.enableNonexistentTypeCache && cachedType == metadata.UnknownType {
 		d.cache.Insert(d.cacheClock.Now(), name, metadata.NonexistentType)
@@ -583,10 +942,133 @@ func (d *dirInode) ReadDescendants(ctx context.Context, limit int) (map[Name]*Co
 
 }
 
+// LOCKS_REQUIRED(d)
+func (d *dirInode) ListMatching(ctx context.Context, pattern string, maxBytes int) (names []string, err error) {
+	prefix := d.Name().GcsObjectName()
+	req := &gcs.ListObjectsRequest{
+		Prefix:         prefix,
+		MatchGlob:      storageutil.QuoteGlob(prefix) + pattern,
+		MaxResults:     MaxResultsForListObjectsCall,
+		ProjectionVal:  gcs.NoAcl,
+		FetchOnlyNames: true,
+	}
+
+	var size int
+	for {
+		listing, err := d.bucket.ListObjects(ctx, req)
+		if err != nil {
+			return nil, fmt.Errorf("list objects: %w", err)
+		}
+
+		for _, o := range listing.Objects {
+			name := strings.TrimPrefix(o.Name, prefix)
+			if name == "" {
+				continue
+			}
+
+			size += len(name) + 1
+			if size > maxBytes {
+				return nil, syscall.E2BIG
+			}
+			names = append(names, name)
+		}
+
+		if req.ContinuationToken = listing.ContinuationToken; req.ContinuationToken == "" {
+			return names, nil
+		}
+	}
+}
+
+// LOCKS_EXCLUDED(d)
+func (d *dirInode) QueryMetadata(
+	ctx context.Context,
+	q MetadataQuery,
+	maxObjects int,
+	maxBytes int) (names []string, truncated bool, err error) {
+	prefix := d.Name().GcsObjectName()
+	req := &gcs.ListObjectsRequest{
+		Prefix:        prefix,
+		ProjectionVal: gcs.NoAcl,
+	}
+
+	var scanned, size int
+	for {
+		req.MaxResults = min(MaxResultsForListObjectsCall, maxObjects-scanned)
+		listing, err := d.bucket.ListObjects(ctx, req)
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return names, true, nil
+		}
+		if err != nil {
+			return nil, false, fmt.Errorf("list objects: %w", err)
+		}
+
+		for _, o := range listing.Objects {
+			scanned++
+			name := strings.TrimPrefix(o.Name, prefix)
+			if name == "" || !q.matches(o.Metadata) {
+				continue
+			}
+
+			size += len(name) + 1
+			if size > maxBytes {
+				return names, true, nil
+			}
+			names = append(names, name)
+		}
+
+		if req.ContinuationToken = listing.ContinuationToken; req.ContinuationToken == "" {
+			return names, false, nil
+		}
+		if scanned >= maxObjects {
+			return names, true, nil
+		}
+	}
+}
+
+// LOCKS_REQUIRED(d)
+func (d *dirInode) Usage(ctx context.Context, maxObjects int, maxParallel int) (DirUsage, error) {
+	if d.cacheClock.Now().Before(d.usageExpiry) {
+		return d.usage, d.usageErr
+	}
+
+	progress := new(gcsx.PrefixUsageProgress)
+	d.usageProgress.Store(progress)
+
+	prefix := d.Name().GcsObjectName()
+	var usage DirUsage
+	u, err := gcsx.SumPrefix(ctx, d.bucket, prefix, maxParallel, maxObjects, progress)
+	switch {
+	case errors.Is(err, gcsx.ErrTooManyObjects):
+		err = fmt.Errorf("more than %d objects under %q: %w", maxObjects, prefix, syscall.E2BIG)
+	case err != nil:
+		return DirUsage{}, err
+	default:
+		usage = DirUsage{ObjectCount: u.ObjectCount, RecursiveSize: u.TotalBytes}
+	}
+
+	d.usage, d.usageErr = usage, err
+	d.usageExpiry = d.cacheClock.Now().Add(DirUsageTTL)
+	return usage, err
+}
+
+func (d *dirInode) UsageProgress() *gcsx.PrefixUsageProgress {
+	return d.usageProgress.Load()
+}
+
+// LOCKS_REQUIRED(d)
+func (d *dirInode) ListDenied() bool {
+	return d.cacheClock.Now().Before(d.listDeniedUntil)
+}
+
 // LOCKS_REQUIRED(d)
 func (d *dirInode) readObjects(
 	ctx context.Context,
 	tok string) (cores map[Name]*Core, newTok string, err error) {
+	if d.ListDenied() {
+		err = fmt.Errorf("listing %q was denied: %w", d.Name().GcsObjectName(), syscall.EACCES)
+		return
+	}
+
 	// Ask the bucket to list some objects.
 	req := &gcs.ListObjectsRequest{
 		Delimiter:                "/",
@@ -602,15 +1084,21 @@ func (d *dirInode) readObjects(
 
 	listing, err := d.bucket.ListObjects(ctx, req)
 	if err != nil {
+		if isPermissionDenied(err) {
+			d.listDeniedUntil = d.cacheClock.Now().Add(ListDeniedTTL)
+		}
 		err = fmt.Errorf("ListObjects: %w", err)
 		return
 	}
+	d.listDeniedUntil = time.Time{}
 
 	cores = make(map[Name]*Core)
 	defer func() {
 		now := d.cacheClock.Now()
 		for fullName, c := range cores {
-			d.cache.Insert(now, path.Base(fullName.LocalName()), c.Type())
+			name := path.Base(fullName.LocalName())
+			d.typeFlaps.observe(ctx, d.Name(), name, c.Type())
+			d.cache.Insert(now, name, c.Type())
 		}
 	}()
 
@@ -633,6 +1121,16 @@ func (d *dirInode) readObjects(
 				MinObject: storageutil.ConvertObjToMinObject(o),
 			}
 			cores[dirName] = explicitDir
+		} else if d.isCompatDirMarker(storageutil.ConvertObjToMinObject(o)) {
+			// The marker stands for the directory, unless it is listed already.
+			// One listed later, as a placeholder or a prefix, replaces it.
+			dirName := NewDirName(d.Name(), nameBase)
+			if _, ok := cores[dirName]; !ok {
+				cores[dirName] = &Core{
+					Bucket:   d.Bucket(),
+					FullName: dirName,
+				}
+			}
 		} else {
 			fileName := NewFileName(d.Name(), nameBase)
 			file := &Core{
@@ -646,6 +1144,7 @@ func (d *dirInode) readObjects(
 
 	// Return an appropriate continuation token, if any.
 	newTok = listing.ContinuationToken
+	d.recordNewestChildTime(listing.Objects, tok, newTok)
 
 	if !d.implicitDirs {
 		return
@@ -682,15 +1181,7 @@ func (d *dirInode) ReadEntries(
 	for fullName, core := range cores {
 		entry := fuseutil.Dirent{
 			Name: path.Base(fullName.LocalName()),
-			Type: fuseutil.DT_Unknown,
-		}
-		switch core.Type() {
-		case metadata.SymlinkType:
-			entry.Type = fuseutil.DT_Link
-		case metadata.RegularFileType:
-			entry.Type = fuseutil.DT_File
-		case metadata.ImplicitDirType, metadata.ExplicitDirType:
-			entry.Type = fuseutil.DT_Directory
+			Type: direntType(core.Type()),
 		}
 		entries = append(entries, entry)
 	}
@@ -700,6 +1191,23 @@ func (d *dirInode) ReadEntries(
 	return
 }
 
+// direntType returns the type reported in directory entries for a child of
+// type t. Every child seen in a listing has a known type: prefixes are
+// directories, whether implicit or managed folders, and objects are files or
+// symlinks, so callers relying on d_type need not stat them.
+func direntType(t metadata.Type) fuseutil.DirentType {
+	switch t {
+	case metadata.SymlinkType:
+		return fuseutil.DT_Link
+	case metadata.RegularFileType:
+		return fuseutil.DT_File
+	case metadata.ImplicitDirType, metadata.ExplicitDirType:
+		return fuseutil.DT_Directory
+	default:
+		return fuseutil.DT_Unknown
+	}
+}
+
 // LOCKS_REQUIRED(d)
 func (d *dirInode) CreateChildFile(ctx context.Context, name string) (*Core, error) {
 	childMetadata := map[string]string{
@@ -713,6 +1221,7 @@ func (d *dirInode) CreateChildFile(ctx context.Context, name string) (*Core, err
 	}
 	m := storageutil.ConvertObjToMinObject(o)
 
+	d.InvalidateChild(name)
 	d.cache.Insert(d.cacheClock.Now(), name, metadata.RegularFileType)
 	return &Core{
 		Bucket:    d.Bucket(),
@@ -735,7 +1244,7 @@ func (d *dirInode) CreateLocalChildFile(name string) (*Core, error) {
 // LOCKS_REQUIRED(d)
 func (d *dirInode) CloneToChildFile(ctx context.Context, name string, src *gcs.MinObject) (*Core, error) {
 	// Erase any existing type information for this name.
-	d.cache.Erase(name)
+	d.InvalidateChild(name)
 	fullName := NewFileName(d.Name(), name)
 
 	// Clone over anything that might already exist for the name.
@@ -757,6 +1266,7 @@ func (d *dirInode) CloneToChildFile(ctx context.Context, name string, src *gcs.M
 		FullName:  fullName,
 		MinObject: m,
 	}
+	d.InvalidateChild(name)
 	d.cache.Insert(d.cacheClock.Now(), name, c.Type())
 	return c, nil
 }
@@ -774,6 +1284,7 @@ func (d *dirInode) CreateChildSymlink(ctx context.Context, name string, target s
 	}
 	m := storageutil.ConvertObjToMinObject(o)
 
+	d.InvalidateChild(name)
 	d.cache.Insert(d.cacheClock.Now(), name, metadata.SymlinkType)
 
 	return &Core{
@@ -786,12 +1297,27 @@ func (d *dirInode) CreateChildSymlink(ctx context.Context, name string, target s
 // LOCKS_REQUIRED(d)
 func (d *dirInode) CreateChildDir(ctx context.Context, name string) (*Core, error) {
 	fullName := NewDirName(d.Name(), name)
-	o, err := d.createNewObject(ctx, fullName, nil)
-	if err != nil {
-		return nil, err
+
+	var m *gcs.MinObject
+	if d.isHierarchical() {
+		f, err := d.bucket.CreateFolder(ctx, fullName.GcsObjectName())
+		if err != nil {
+			return nil, err
+		}
+		m = &gcs.MinObject{
+			Name:           f.Name,
+			MetaGeneration: f.MetaGeneration,
+			Updated:        f.UpdateTime,
+		}
+	} else {
+		o, err := d.createNewObject(ctx, fullName, nil)
+		if err != nil {
+			return nil, err
+		}
+		m = storageutil.ConvertObjToMinObject(o)
 	}
-	m := storageutil.ConvertObjToMinObject(o)
 
+	d.InvalidateChild(name)
 	d.cache.Insert(d.cacheClock.Now(), name, metadata.ExplicitDirType)
 
 	return &Core{
@@ -807,7 +1333,7 @@ func (d *dirInode) DeleteChildFile(
 	name string,
 	generation int64,
 	metaGeneration *int64) (err error) {
-	d.cache.Erase(name)
+	d.InvalidateChild(name)
 	childName := NewFileName(d.Name(), name)
 
 	err = d.bucket.DeleteObject(
@@ -822,7 +1348,7 @@ func (d *dirInode) DeleteChildFile(
 		err = fmt.Errorf("DeleteObject: %w", err)
 		return
 	}
-	d.cache.Erase(name)
+	d.InvalidateChild(name)
 
 	return
 }
@@ -832,33 +1358,75 @@ func (d *dirInode) DeleteChildDir(
 	ctx context.Context,
 	name string,
 	isImplicitDir bool) (err error) {
-	d.cache.Erase(name)
+	d.InvalidateChild(name)
+	childName := NewDirName(d.Name(), name)
 
-	// if the directory is an implicit directory, then no backing object
-	// exists in the gcs bucket, so returning from here.
-	if isImplicitDir {
+	// Every directory of a bucket with a hierarchical namespace is backed by a
+	// folder, which can only be deleted once it is empty.
+	if d.isHierarchical() {
+		err = d.bucket.DeleteFolder(ctx, childName.GcsObjectName())
+		if err != nil {
+			err = fmt.Errorf("DeleteFolder: %w", err)
+			return
+		}
+		d.InvalidateChild(name)
 		return
 	}
-	childName := NewDirName(d.Name(), name)
 
-	// Delete the backing object. Unfortunately we have no way to precondition
-	// this on the directory being empty.
-	err = d.bucket.DeleteObject(
-		ctx,
-		&gcs.DeleteObjectRequest{
-			Name:       childName.GcsObjectName(),
-			Generation: 0, // Delete the latest version of object named after dir.
-		})
+	// if the directory is an implicit directory, then no backing object
+	// exists in the gcs bucket, apart from a compat marker standing for it.
+	if !isImplicitDir {
+		// Delete the backing object. Unfortunately we have no way to
+		// precondition this on the directory being empty.
+		err = d.bucket.DeleteObject(
+			ctx,
+			&gcs.DeleteObjectRequest{
+				Name:       childName.GcsObjectName(),
+				Generation: 0, // Delete the latest version of object named after dir.
+			})
 
-	if err != nil {
-		err = fmt.Errorf("DeleteObject: %w", err)
+		if err != nil {
+			err = fmt.Errorf("DeleteObject: %w", err)
+			return
+		}
+	}
+
+	// The directory may also have a compat marker, which goes with it.
+	if err = d.deleteCompatDirMarker(ctx, name); err != nil {
+		err = fmt.Errorf("deleteCompatDirMarker: %w", err)
 		return
 	}
-	d.cache.Erase(name)
+	d.InvalidateChild(name)
 
 	return
 }
 
+// LOCKS_REQUIRED(d)
+func (d *dirInode) CompatDirMarkerOf(ctx context.Context, name string) (string, error) {
+	marker, err := d.compatDirMarker(ctx, name)
+	if err != nil || marker == nil {
+		return "", err
+	}
+	return marker.MinObject.Name, nil
+}
+
+// LOCKS_REQUIRED(d)
+func (d *dirInode) RenameFolder(
+	ctx context.Context,
+	folderName string,
+	name string) (*gcs.Folder, error) {
+	destinationName := NewDirName(d.Name(), name)
+	f, err := d.bucket.RenameFolder(ctx, folderName, destinationName.GcsObjectName())
+	if err != nil {
+		return nil, err
+	}
+
+	d.InvalidateChild(name)
+	d.cache.Insert(d.cacheClock.Now(), name, metadata.ExplicitDirType)
+
+	return f, nil
+}
+
 // LOCKS_REQUIRED(fs)
 func (d *dirInode) LocalFileEntries(localFileInodes map[Name]Inode) (localEntries []fuseutil.Dirent) {
 	for localInodeName, in := range localFileInodes {
@@ -890,3 +1458,17 @@ func (d *dirInode) ShouldInvalidateKernelListCache(ttl time.Duration) bool {
 	cachedDuration := d.cacheClock.Now().Sub(*d.prevDirListingTimeStamp)
 	return cachedDuration >= ttl
 }
+
+// InvalidateChild forgets the type cached for the name, including a
+// nonexistent entry, and everything derived from the last listing: the kernel
+// list cache is dropped at the next OpenDir, and with config.DirTimesNewestChild
+// the directory times are those of the inode until the next listing. The stat
+// cache is kept up to date by the bucket the change went through.
+//
+// LOCKS_REQUIRED(d)
+func (d *dirInode) InvalidateChild(name string) {
+	d.cache.Erase(name)
+	d.typeFlaps.forget(name)
+	d.prevDirListingTimeStamp = nil
+	d.newestChildTimeExpiry = time.Time{}
+}
@@ -16,9 +16,12 @@ package inode
 
 import (
 	"errors"
+	"net/http"
 	"os"
 	"path"
 	"sort"
+	"strings"
+	"syscall"
 	"testing"
 	"time"
 
@@ -38,6 +41,8 @@ import (
 	. "github.com/jacobsa/oglematchers"
 	. "github.com/jacobsa/ogletest"
 	"github.com/jacobsa/timeutil"
+	"go.opencensus.io/stats/view"
+	"google.golang.org/api/googleapi"
 )
 
 func TestDir(t *testing.T) { RunTests(t) }
@@ -58,6 +63,13 @@ type DirTest struct {
 
 	in DirInode
 	tc metadata.TypeCache
+
+	// The times the inode is created with, and the --dir-times mode.
+	mountTime time.Time
+	dirTimes  string
+
+	// The content types of compat directory markers the inode is created with.
+	compatDirMarkerTypes []string
 }
 
 var _ SetUpInterface = &DirTest{}
@@ -68,10 +80,11 @@ func init() { RegisterTestSuite(&DirTest{}) }
 func (t *DirTest) SetUp(ti *TestInfo) {
 	t.ctx = ti.Ctx
 	t.clock.SetTime(time.Date(2015, 4, 5, 2, 15, 0, 0, time.Local))
+	t.mountTime = t.clock.Now()
+	t.dirTimes = config.DirTimesMount
 	bucket := fake.NewFakeBucket(&t.clock, "some_bucket")
 	t.bucket = gcsx.NewSyncerBucket(
-		1, // Append threshold
-		".gcsfuse_tmp/",
+		gcsx.SyncerConfig{AppendThreshold: 1, TmpObjectPrefix: ".gcsfuse_tmp/"},
 		bucket)
 	// Create the inode. No implicit dirs by default.
 	t.resetInode(false, false, true)
@@ -107,18 +120,23 @@ func (t *DirTest) resetInodeWithTypeCacheConfigs(implicitDirs, enableNonexistent
 		dirInodeID,
 		NewDirName(NewRootName(""), dirInodeName),
 		fuseops.InodeAttributes{
-			Uid:  uid,
-			Gid:  gid,
-			Mode: dirMode,
+			Uid:   uid,
+			Gid:   gid,
+			Mode:  dirMode,
+			Atime: t.mountTime,
+			Ctime: t.mountTime,
+			Mtime: t.mountTime,
 		},
 		implicitDirs,
 		enableManagedFoldersListing,
 		enableNonexistentTypeCache,
-		typeCacheTTL,
+		metadata.SameEntryTTLs(typeCacheTTL),
 		&t.bucket,
 		&t.clock,
 		&t.clock,
-		typeCacheMaxSizeMB)
+		typeCacheMaxSizeMB,
+		t.dirTimes,
+		t.compatDirMarkerTypes)
 
 	d := t.in.(*dirInode)
 	AssertNe(nil, d)
@@ -132,6 +150,23 @@ func (t *DirTest) getTypeFromCache(name string) metadata.Type {
 	return t.tc.Get(t.in.(*dirInode).cacheClock.Now(), name)
 }
 
+// dirTypeFlapCount returns the number of flaps of directories from the kind
+// prev to kind recorded so far.
+func dirTypeFlapCount(prev string, kind string) float64 {
+	rows, err := view.RetrieveData("fs/dir_type_flap_count")
+	AssertEq(nil, err)
+	for _, row := range rows {
+		tags := make(map[string]string)
+		for _, tag := range row.Tags {
+			tags[tag.Key.Name()] = tag.Value
+		}
+		if tags["prev_dir_type"] == prev && tags["dir_type"] == kind {
+			return row.Data.(*view.SumData).Value
+		}
+	}
+	return 0
+}
+
 // Read all of the entries and sort them by name.
 func (t *DirTest) readAllEntries() (entries []fuseutil.Dirent, err error) {
 	tok := ""
@@ -181,7 +216,11 @@ func (t *DirTest) createLocalFileInode(parent Name, name string, id fuseops.Inod
 		false, // localFileCache
 		contentcache.New("", &t.clock),
 		&t.clock,
-		true) //localFile
+		true, //localFile
+		0,    // lockTTL
+		config.DefaultClobberBehavior,
+		false,
+		0)
 	return
 }
 
@@ -216,6 +255,112 @@ func (t *DirTest) Attributes() {
 	ExpectEq(dirMode|os.ModeDir, attrs.Mode)
 }
 
+func (t *DirTest) Attributes_DirTimesMount() {
+	t.clock.AdvanceTime(time.Minute)
+	_, err := storageutil.CreateObject(t.ctx, t.bucket, dirInodeName+"baz", []byte("taco"))
+	AssertEq(nil, err)
+	_, err = t.readAllEntries()
+	AssertEq(nil, err)
+
+	attrs, err := t.in.Attributes(t.ctx)
+
+	AssertEq(nil, err)
+	ExpectThat(attrs.Mtime, timeutil.TimeEq(t.mountTime))
+	ExpectThat(attrs.Ctime, timeutil.TimeEq(t.mountTime))
+}
+
+func (t *DirTest) Attributes_DirTimesPlaceholder() {
+	t.clock.AdvanceTime(time.Minute)
+	o, err := storageutil.CreateObject(t.ctx, t.bucket, dirInodeName, []byte(""))
+	AssertEq(nil, err)
+	t.clock.AdvanceTime(time.Minute)
+
+	in := NewExplicitDirInode(
+		dirInodeID,
+		NewDirName(NewRootName(""), dirInodeName),
+		storageutil.ConvertObjToMinObject(o),
+		fuseops.InodeAttributes{Mtime: t.clock.Now(), Ctime: t.clock.Now()},
+		false, // implicitDirs
+		false, // enableManagedFoldersListing
+		false, // enableNonexistentTypeCache
+		metadata.SameEntryTTLs(typeCacheTTL),
+		&t.bucket,
+		&t.clock,
+		&t.clock,
+		config.DefaultTypeCacheMaxSizeMB,
+		config.DirTimesPlaceholder,
+		nil)
+	in.Lock()
+	defer in.Unlock()
+	attrs, err := in.Attributes(t.ctx)
+
+	AssertEq(nil, err)
+	ExpectThat(attrs.Mtime, timeutil.TimeEq(o.Updated))
+	ExpectThat(attrs.Ctime, timeutil.TimeEq(o.Updated))
+}
+
+func (t *DirTest) Attributes_DirTimesPlaceholder_ImplicitDir() {
+	t.dirTimes = config.DirTimesPlaceholder
+	t.resetInode(true, false, true)
+	t.clock.AdvanceTime(time.Minute)
+	_, err := storageutil.CreateObject(t.ctx, t.bucket, dirInodeName+"baz", []byte("taco"))
+	AssertEq(nil, err)
+
+	attrs, err := t.in.Attributes(t.ctx)
+
+	AssertEq(nil, err)
+	ExpectThat(attrs.Mtime, timeutil.TimeEq(t.mountTime))
+}
+
+func (t *DirTest) Attributes_DirTimesNewestChild() {
+	t.dirTimes = config.DirTimesNewestChild
+	t.resetInode(true, false, true)
+	t.clock.AdvanceTime(time.Minute)
+	_, err := storageutil.CreateObject(t.ctx, t.bucket, dirInodeName+"baz", []byte("taco"))
+	AssertEq(nil, err)
+	t.clock.AdvanceTime(time.Minute)
+	newest, err := storageutil.CreateObject(t.ctx, t.bucket, dirInodeName+"qux/", []byte(""))
+	AssertEq(nil, err)
+	t.clock.AdvanceTime(time.Minute)
+	// A grandchild is not seen by the listing.
+	_, err = storageutil.CreateObject(t.ctx, t.bucket, dirInodeName+"quux/corge", []byte("burrito"))
+	AssertEq(nil, err)
+
+	// Nothing is known before listing.
+	attrs, err := t.in.Attributes(t.ctx)
+	AssertEq(nil, err)
+	ExpectThat(attrs.Mtime, timeutil.TimeEq(t.mountTime))
+
+	// The listing provides the newest child time.
+	_, err = t.readAllEntries()
+	AssertEq(nil, err)
+	attrs, err = t.in.Attributes(t.ctx)
+	AssertEq(nil, err)
+	ExpectThat(attrs.Mtime, timeutil.TimeEq(newest.Updated))
+	ExpectThat(attrs.Ctime, timeutil.TimeEq(newest.Updated))
+
+	// Until it expires along with the listing.
+	t.clock.AdvanceTime(typeCacheTTL)
+	attrs, err = t.in.Attributes(t.ctx)
+	AssertEq(nil, err)
+	ExpectThat(attrs.Mtime, timeutil.TimeEq(t.mountTime))
+}
+
+func (t *DirTest) Attributes_DirTimesNewestChild_EmptyImplicitDir() {
+	t.dirTimes = config.DirTimesNewestChild
+	t.resetInode(true, false, true)
+	t.clock.AdvanceTime(time.Minute)
+
+	entries, err := t.readAllEntries()
+	AssertEq(nil, err)
+	AssertEq(0, len(entries))
+	attrs, err := t.in.Attributes(t.ctx)
+
+	AssertEq(nil, err)
+	ExpectThat(attrs.Mtime, timeutil.TimeEq(t.mountTime))
+	ExpectThat(attrs.Ctime, timeutil.TimeEq(t.mountTime))
+}
+
 func (t *DirTest) LookUpChild_NonExistent() {
 	const name = "qux"
 
@@ -603,6 +748,42 @@ func (t *DirTest) LookUpChild_NonExistentTypeCache_ImplicitDirsDisabled() {
 	ExpectEq(createObj.Size, result.MinObject.Size)
 }
 
+func (t *DirTest) ChildKnownMissing() {
+	t.resetInode(false, true, true)
+	const name = "qux"
+
+	// Nothing is known before the first lookup.
+	ExpectFalse(t.in.ChildKnownMissing(name))
+
+	result, err := t.in.LookUpChild(t.ctx, name)
+	AssertEq(nil, err)
+	AssertEq(nil, result)
+	ExpectTrue(t.in.ChildKnownMissing(name))
+
+	// Until the type cache entry expires.
+	t.clock.AdvanceTime(typeCacheTTL + time.Millisecond)
+	ExpectFalse(t.in.ChildKnownMissing(name))
+}
+
+func (t *DirTest) ChildKnownFile() {
+	t.resetInode(false, false, false)
+	const name = "qux"
+	_, err := storageutil.CreateObject(t.ctx, t.bucket, dirInodeName+name, []byte("taco"))
+	AssertEq(nil, err)
+
+	// Nothing is known before the first lookup.
+	ExpectFalse(t.in.ChildKnownFile(name))
+
+	result, err := t.in.LookUpChild(t.ctx, name)
+	AssertEq(nil, err)
+	AssertNe(nil, result)
+	ExpectTrue(t.in.ChildKnownFile(name))
+
+	// Until the type cache entry expires.
+	t.clock.AdvanceTime(typeCacheTTL + time.Millisecond)
+	ExpectFalse(t.in.ChildKnownFile(name))
+}
+
 func (t *DirTest) LookUpChild_NonExistentTypeCache_ImplicitDirsEnabled() {
 	// Enable implicitDirs and enableNonexistentTypeCache for type cache
 	t.resetInode(true, true, true)
@@ -714,6 +895,82 @@ func (t *DirTest) LookUpChild_TypeCacheDisabled() {
 	}
 }
 
+func (t *DirTest) LookUpChild_DirTypeFlap_PlaceholderDeleted() {
+	t.resetInode(true, false, true)
+	const name = "qux"
+	dirObjName := path.Join(dirInodeName, name) + "/"
+	_, err := storageutil.CreateObject(t.ctx, t.bucket, dirObjName, []byte(""))
+	AssertEq(nil, err)
+	_, err = storageutil.CreateObject(t.ctx, t.bucket, dirObjName+"baz", []byte("taco"))
+	AssertEq(nil, err)
+	flaps := dirTypeFlapCount("explicit", "implicit")
+
+	result, err := t.in.LookUpChild(t.ctx, name)
+	AssertEq(nil, err)
+	AssertEq(metadata.ExplicitDirType, result.Type())
+
+	// The placeholder goes away behind our back, leaving its children.
+	err = t.bucket.DeleteObject(t.ctx, &gcs.DeleteObjectRequest{Name: dirObjName})
+	AssertEq(nil, err)
+	t.clock.AdvanceTime(typeCacheTTL + time.Millisecond)
+
+	result, err = t.in.LookUpChild(t.ctx, name)
+	AssertEq(nil, err)
+	AssertEq(metadata.ImplicitDirType, result.Type())
+	ExpectEq(flaps+1, dirTypeFlapCount("explicit", "implicit"))
+
+	// It stays implicit, which isn't a flap.
+	t.clock.AdvanceTime(typeCacheTTL + time.Millisecond)
+	result, err = t.in.LookUpChild(t.ctx, name)
+	AssertEq(nil, err)
+	AssertEq(metadata.ImplicitDirType, result.Type())
+	ExpectEq(flaps+1, dirTypeFlapCount("explicit", "implicit"))
+}
+
+func (t *DirTest) ReadEntries_DirTypeFlap_PlaceholderCreated() {
+	t.resetInode(true, false, true)
+	const name = "qux"
+	dirObjName := path.Join(dirInodeName, name) + "/"
+	_, err := storageutil.CreateObject(t.ctx, t.bucket, dirObjName+"baz", []byte("taco"))
+	AssertEq(nil, err)
+	flaps := dirTypeFlapCount("implicit", "explicit")
+
+	result, err := t.in.LookUpChild(t.ctx, name)
+	AssertEq(nil, err)
+	AssertEq(metadata.ImplicitDirType, result.Type())
+
+	_, err = storageutil.CreateObject(t.ctx, t.bucket, dirObjName, []byte(""))
+	AssertEq(nil, err)
+	_, err = t.readAllEntries()
+	AssertEq(nil, err)
+
+	ExpectEq(metadata.ExplicitDirType, t.getTypeFromCache(name))
+	ExpectEq(flaps+1, dirTypeFlapCount("implicit", "explicit"))
+}
+
+func (t *DirTest) LookUpChild_NoDirTypeFlapAfterLocalChange() {
+	t.resetInode(true, false, true)
+	const name = "qux"
+	dirObjName := path.Join(dirInodeName, name) + "/"
+	_, err := storageutil.CreateObject(t.ctx, t.bucket, dirObjName, []byte(""))
+	AssertEq(nil, err)
+	_, err = storageutil.CreateObject(t.ctx, t.bucket, dirObjName+"baz", []byte("taco"))
+	AssertEq(nil, err)
+	flaps := dirTypeFlapCount("explicit", "implicit")
+	result, err := t.in.LookUpChild(t.ctx, name)
+	AssertEq(nil, err)
+	AssertEq(metadata.ExplicitDirType, result.Type())
+
+	// Deleting the placeholder ourselves explains the change.
+	err = t.in.DeleteChildDir(t.ctx, name, false)
+	AssertEq(nil, err)
+
+	result, err = t.in.LookUpChild(t.ctx, name)
+	AssertEq(nil, err)
+	AssertEq(metadata.ImplicitDirType, result.Type())
+	ExpectEq(flaps, dirTypeFlapCount("explicit", "implicit"))
+}
+
 func (t *DirTest) ReadDescendants_Empty() {
 	descendants, err := t.in.ReadDescendants(t.ctx, 10)
 
@@ -747,6 +1004,281 @@ func (t *DirTest) ReadDescendants_NonEmpty() {
 	ExpectEq(2, len(descendants))
 }
 
+func (t *DirTest) ListMatching() {
+	var err error
+
+	// Set up contents, including some outside the directory that the glob
+	// would match if it weren't relative to it.
+	objs := []string{
+		dirInodeName,
+		dirInodeName + "a.csv",
+		dirInodeName + "b.csv",
+		dirInodeName + "c.txt",
+		dirInodeName + "sub/d.csv",
+		"foo/bar.csv",
+		"foo/e.csv",
+	}
+
+	err = storageutil.CreateEmptyObjects(t.ctx, t.bucket, objs)
+	AssertEq(nil, err)
+
+	names, err := t.in.ListMatching(t.ctx, "*.csv", 1<<10)
+	AssertEq(nil, err)
+	ExpectThat(names, ElementsAre("a.csv", "b.csv"))
+
+	names, err = t.in.ListMatching(t.ctx, "**.csv", 1<<10)
+	AssertEq(nil, err)
+	ExpectThat(names, ElementsAre("a.csv", "b.csv", "sub/d.csv"))
+
+	names, err = t.in.ListMatching(t.ctx, "{c.txt,nope}", 1<<10)
+	AssertEq(nil, err)
+	ExpectThat(names, ElementsAre("c.txt"))
+}
+
+func (t *DirTest) ListMatching_TooLarge() {
+	err := storageutil.CreateEmptyObjects(
+		t.ctx,
+		t.bucket,
+		[]string{dirInodeName + "a.csv", dirInodeName + "b.csv"})
+	AssertEq(nil, err)
+
+	// "a.csv\n" fits but "b.csv\n" doesn't.
+	_, err = t.in.ListMatching(t.ctx, "*", len("a.csv\nb.csv\n")-1)
+
+	ExpectTrue(errors.Is(err, syscall.E2BIG), "err: %v", err)
+}
+
+// pagingBucket returns listings of at most pageSize objects.
+type pagingBucket struct {
+	gcs.Bucket
+	pageSize int
+	lists    int
+}
+
+func (b *pagingBucket) ListObjects(
+	ctx context.Context,
+	req *gcs.ListObjectsRequest) (*gcs.Listing, error) {
+	b.lists++
+	paged := *req
+	paged.MaxResults = min(req.MaxResults, b.pageSize)
+	return b.Bucket.ListObjects(ctx, &paged)
+}
+
+// Create objects with the given custom metadata.
+func (t *DirTest) createObjectsWithMetadata(objs map[string]map[string]string) {
+	for name, m := range objs {
+		_, err := t.bucket.CreateObject(t.ctx, &gcs.CreateObjectRequest{
+			Name:     name,
+			Contents: strings.NewReader(""),
+			Metadata: m,
+		})
+		AssertEq(nil, err)
+	}
+}
+
+func (t *DirTest) ParseMetadataQuery() {
+	q, err := ParseMetadataQuery("label=cat")
+	AssertEq(nil, err)
+	ExpectThat(q, DeepEquals(MetadataQuery{Key: "label", Value: "cat"}))
+
+	q, err = ParseMetadataQuery("label=")
+	AssertEq(nil, err)
+	ExpectThat(q, DeepEquals(MetadataQuery{Key: "label"}))
+
+	q, err = ParseMetadataQuery("expr=a=b")
+	AssertEq(nil, err)
+	ExpectThat(q, DeepEquals(MetadataQuery{Key: "expr", Value: "a=b"}))
+
+	q, err = ParseMetadataQuery("label")
+	AssertEq(nil, err)
+	ExpectThat(q, DeepEquals(MetadataQuery{Key: "label", AnyValue: true}))
+
+	_, err = ParseMetadataQuery("=cat")
+	ExpectNe(nil, err)
+
+	_, err = ParseMetadataQuery("")
+	ExpectNe(nil, err)
+}
+
+func (t *DirTest) QueryMetadata() {
+	// Set up contents, including the directory's own object and a match
+	// outside the directory.
+	t.createObjectsWithMetadata(map[string]map[string]string{
+		dirInodeName:           {"label": "cat"},
+		dirInodeName + "a":     {"label": "cat"},
+		dirInodeName + "b":     {"label": "dog"},
+		dirInodeName + "c":     nil,
+		dirInodeName + "sub/d": {"label": "cat", "source": "cam"},
+		dirInodeName + "sub/e": {"source": "cam"},
+		"foo/bar":              {"label": "cat"},
+	})
+
+	names, truncated, err := t.in.QueryMetadata(t.ctx, MetadataQuery{Key: "label", Value: "cat"}, 100, 1<<10)
+	AssertEq(nil, err)
+	ExpectFalse(truncated)
+	ExpectThat(names, ElementsAre("a", "sub/d"))
+
+	names, truncated, err = t.in.QueryMetadata(t.ctx, MetadataQuery{Key: "source", AnyValue: true}, 100, 1<<10)
+	AssertEq(nil, err)
+	ExpectFalse(truncated)
+	ExpectThat(names, ElementsAre("sub/d", "sub/e"))
+
+	names, truncated, err = t.in.QueryMetadata(t.ctx, MetadataQuery{Key: "label", Value: "cow"}, 100, 1<<10)
+	AssertEq(nil, err)
+	ExpectFalse(truncated)
+	ExpectEq(0, len(names))
+}
+
+func (t *DirTest) QueryMetadata_Pagination() {
+	objs := make(map[string]map[string]string)
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		objs[dirInodeName+name] = map[string]string{"label": "cat"}
+	}
+	t.createObjectsWithMetadata(objs)
+	b := &pagingBucket{Bucket: t.bucket.Bucket, pageSize: 2}
+	t.bucket = gcsx.NewSyncerBucket(gcsx.SyncerConfig{AppendThreshold: 1, TmpObjectPrefix: ".gcsfuse_tmp/"}, b)
+	t.resetInode(false, false, true)
+
+	names, truncated, err := t.in.QueryMetadata(t.ctx, MetadataQuery{Key: "label", Value: "cat"}, 100, 1<<10)
+
+	AssertEq(nil, err)
+	ExpectFalse(truncated)
+	ExpectThat(names, ElementsAre("a", "b", "c", "d", "e"))
+	ExpectEq(3, b.lists)
+}
+
+func (t *DirTest) QueryMetadata_MaxObjects() {
+	t.createObjectsWithMetadata(map[string]map[string]string{
+		dirInodeName + "a": {"label": "cat"},
+		dirInodeName + "b": {"label": "dog"},
+		dirInodeName + "c": {"label": "cat"},
+	})
+
+	// Only "a" and "b" are scanned.
+	names, truncated, err := t.in.QueryMetadata(t.ctx, MetadataQuery{Key: "label", Value: "cat"}, 2, 1<<10)
+
+	AssertEq(nil, err)
+	ExpectTrue(truncated)
+	ExpectThat(names, ElementsAre("a"))
+}
+
+func (t *DirTest) QueryMetadata_MaxBytes() {
+	t.createObjectsWithMetadata(map[string]map[string]string{
+		dirInodeName + "a.csv": {"label": "cat"},
+		dirInodeName + "b.csv": {"label": "cat"},
+	})
+
+	// "a.csv\n" fits but "b.csv\n" doesn't.
+	names, truncated, err := t.in.QueryMetadata(
+		t.ctx, MetadataQuery{Key: "label", Value: "cat"}, 100, len("a.csv\nb.csv\n")-1)
+
+	AssertEq(nil, err)
+	ExpectTrue(truncated)
+	ExpectThat(names, ElementsAre("a.csv"))
+}
+
+func (t *DirTest) QueryMetadata_DeadlinePassed() {
+	t.createObjectsWithMetadata(map[string]map[string]string{
+		dirInodeName + "a": {"label": "cat"},
+	})
+	ctx, cancel := context.WithDeadline(t.ctx, time.Now())
+	defer cancel()
+
+	names, truncated, err := t.in.QueryMetadata(ctx, MetadataQuery{Key: "label", Value: "cat"}, 100, 1<<10)
+
+	AssertEq(nil, err)
+	ExpectTrue(truncated)
+	ExpectEq(0, len(names))
+}
+
+func (t *DirTest) Usage() {
+	// Set up contents of known sizes, including the directory's own object and
+	// some outside the directory.
+	err := storageutil.CreateObjects(t.ctx, t.bucket, map[string][]byte{
+		dirInodeName:                  []byte("ignored"),
+		dirInodeName + "a":            []byte("taco"),
+		dirInodeName + "sub/":         nil,
+		dirInodeName + "sub/b":        []byte("burrito"),
+		dirInodeName + "sub/deeper/c": []byte("enchilada"),
+		"foo/bar":                     []byte("elsewhere"),
+		"foo/barn/d":                  []byte("elsewhere"),
+		"e":                           []byte("elsewhere"),
+	})
+	AssertEq(nil, err)
+
+	usage, err := t.in.Usage(t.ctx, 100, 4)
+
+	AssertEq(nil, err)
+	ExpectEq(4, usage.ObjectCount)
+	ExpectEq(len("taco")+len("burrito")+len("enchilada"), usage.RecursiveSize)
+}
+
+func (t *DirTest) Usage_TooLarge() {
+	err := storageutil.CreateEmptyObjects(
+		t.ctx,
+		t.bucket,
+		[]string{dirInodeName + "a", dirInodeName + "b", dirInodeName + "c"})
+	AssertEq(nil, err)
+
+	_, err = t.in.Usage(t.ctx, 2, 4)
+	ExpectTrue(errors.Is(err, syscall.E2BIG), "err: %v", err)
+
+	// Exactly at the cap is fine, but the failure is reused until it expires.
+	_, err = t.in.Usage(t.ctx, 3, 4)
+	ExpectTrue(errors.Is(err, syscall.E2BIG), "err: %v", err)
+
+	t.clock.AdvanceTime(DirUsageTTL)
+	usage, err := t.in.Usage(t.ctx, 3, 4)
+	AssertEq(nil, err)
+	ExpectEq(3, usage.ObjectCount)
+}
+
+func (t *DirTest) Usage_Cached() {
+	err := storageutil.CreateObjects(t.ctx, t.bucket, map[string][]byte{
+		dirInodeName + "a": []byte("taco"),
+	})
+	AssertEq(nil, err)
+
+	usage, err := t.in.Usage(t.ctx, 100, 4)
+	AssertEq(nil, err)
+	ExpectEq(1, usage.ObjectCount)
+	ExpectEq(4, usage.RecursiveSize)
+
+	// A new object isn't counted until the result expires.
+	err = storageutil.CreateObjects(t.ctx, t.bucket, map[string][]byte{
+		dirInodeName + "b": []byte("burrito"),
+	})
+	AssertEq(nil, err)
+
+	t.clock.AdvanceTime(DirUsageTTL - time.Second)
+	usage, err = t.in.Usage(t.ctx, 100, 4)
+	AssertEq(nil, err)
+	ExpectEq(1, usage.ObjectCount)
+	ExpectEq(4, usage.RecursiveSize)
+
+	t.clock.AdvanceTime(time.Second)
+	usage, err = t.in.Usage(t.ctx, 100, 4)
+	AssertEq(nil, err)
+	ExpectEq(2, usage.ObjectCount)
+	ExpectEq(11, usage.RecursiveSize)
+}
+
+func (t *DirTest) Usage_Progress() {
+	err := storageutil.CreateObjects(t.ctx, t.bucket, map[string][]byte{
+		dirInodeName + "a":     []byte("taco"),
+		dirInodeName + "sub/b": []byte("burrito"),
+	})
+	AssertEq(nil, err)
+	ExpectEq(nil, t.in.UsageProgress())
+
+	_, err = t.in.Usage(t.ctx, 100, 4)
+	AssertEq(nil, err)
+
+	progress := t.in.UsageProgress()
+	AssertNe(nil, progress)
+	ExpectEq("objects=2 bytes=11 pages=2 pending=0 done=true", progress.String())
+}
+
 func (t *DirTest) ReadEntries_Empty() {
 	d := t.in.(*dirInode)
 	AssertNe(nil, d)
@@ -1403,6 +1935,237 @@ func (t *DirTest) DeleteChildDir_ImplicitDirTrue() {
 	ExpectEq(nil, err)
 }
 
+// Create an object with the compat directory marker content type.
+func (t *DirTest) createCompatDirMarker(objName string, contents string) *gcs.Object {
+	o, err := t.bucket.CreateObject(t.ctx, &gcs.CreateObjectRequest{
+		Name:        objName,
+		ContentType: DefaultCompatDirMarkerType,
+		Contents:    strings.NewReader(contents),
+	})
+	AssertEq(nil, err)
+	return o
+}
+
+func (t *DirTest) useCompatDirMarkers() {
+	t.compatDirMarkerTypes = []string{"text/directory", DefaultCompatDirMarkerType}
+	t.resetInode(false, false, false)
+}
+
+func (t *DirTest) CompatDirMarker_LookUpChild() {
+	t.useCompatDirMarkers()
+	const name = "qux"
+	t.createCompatDirMarker(path.Join(dirInodeName, name), "")
+
+	result, err := t.in.LookUpChild(t.ctx, name)
+
+	AssertEq(nil, err)
+	AssertNe(nil, result)
+	ExpectEq(path.Join(dirInodeName, name)+"/", result.FullName.GcsObjectName())
+	ExpectEq(nil, result.MinObject)
+	ExpectEq(metadata.ImplicitDirType, t.getTypeFromCache(name))
+
+	// The marker isn't a file conflicting with the directory.
+	result, err = t.in.LookUpChild(t.ctx, name+ConflictingFileNameSuffix)
+	AssertEq(nil, err)
+	ExpectEq(nil, result)
+}
+
+func (t *DirTest) CompatDirMarker_Disabled() {
+	const name = "qux"
+	t.createCompatDirMarker(path.Join(dirInodeName, name), "")
+
+	result, err := t.in.LookUpChild(t.ctx, name)
+
+	AssertEq(nil, err)
+	AssertNe(nil, result)
+	ExpectEq(metadata.RegularFileType, result.Type())
+}
+
+func (t *DirTest) CompatDirMarker_NonEmptyObjectIsAFile() {
+	t.useCompatDirMarkers()
+	const name = "qux"
+	t.createCompatDirMarker(path.Join(dirInodeName, name), "taco")
+
+	result, err := t.in.LookUpChild(t.ctx, name)
+
+	AssertEq(nil, err)
+	AssertNe(nil, result)
+	ExpectEq(metadata.RegularFileType, result.Type())
+}
+
+func (t *DirTest) CompatDirMarker_AndPlaceholder() {
+	t.useCompatDirMarkers()
+	const name = "qux"
+	dirObjName := path.Join(dirInodeName, name) + "/"
+	t.createCompatDirMarker(path.Join(dirInodeName, name), "")
+	_, err := storageutil.CreateObject(t.ctx, t.bucket, dirObjName, []byte(""))
+	AssertEq(nil, err)
+
+	// The placeholder backs the directory.
+	result, err := t.in.LookUpChild(t.ctx, name)
+
+	AssertEq(nil, err)
+	AssertNe(nil, result)
+	AssertNe(nil, result.MinObject)
+	ExpectEq(dirObjName, result.MinObject.Name)
+
+	// Listed, they make a single directory.
+	entries, err := t.readAllEntries()
+	AssertEq(nil, err)
+	AssertEq(1, len(entries))
+	ExpectEq(name, entries[0].Name)
+	ExpectEq(fuseutil.DT_Directory, entries[0].Type)
+}
+
+func (t *DirTest) CompatDirMarker_ReadEntries() {
+	t.useCompatDirMarkers()
+	t.createCompatDirMarker(path.Join(dirInodeName, "marker"), "")
+	t.createCompatDirMarker(path.Join(dirInodeName, "file"), "taco")
+	_, err := storageutil.CreateObject(t.ctx, t.bucket, path.Join(dirInodeName, "marker", "child"), []byte("burrito"))
+	AssertEq(nil, err)
+
+	entries, err := t.readAllEntries()
+
+	AssertEq(nil, err)
+	AssertEq(2, len(entries))
+	ExpectEq("file", entries[0].Name)
+	ExpectEq(fuseutil.DT_File, entries[0].Type)
+	ExpectEq("marker", entries[1].Name)
+	ExpectEq(fuseutil.DT_Directory, entries[1].Type)
+	ExpectEq(metadata.ImplicitDirType, t.getTypeFromCache("marker"))
+}
+
+func (t *DirTest) CompatDirMarker_DeleteChildDir() {
+	t.useCompatDirMarkers()
+	const name = "qux"
+	markerName := path.Join(dirInodeName, name)
+	t.createCompatDirMarker(markerName, "")
+
+	err := t.in.DeleteChildDir(t.ctx, name, true)
+	AssertEq(nil, err)
+
+	_, _, err = t.bucket.StatObject(t.ctx, &gcs.StatObjectRequest{Name: markerName})
+	var notFoundErr *gcs.NotFoundError
+	ExpectTrue(errors.As(err, &notFoundErr), "err: %v", err)
+}
+
+func (t *DirTest) CompatDirMarker_DeleteChildDirWithPlaceholder() {
+	t.useCompatDirMarkers()
+	const name = "qux"
+	markerName := path.Join(dirInodeName, name)
+	t.createCompatDirMarker(markerName, "")
+	_, err := storageutil.CreateObject(t.ctx, t.bucket, markerName+"/", []byte(""))
+	AssertEq(nil, err)
+
+	err = t.in.DeleteChildDir(t.ctx, name, false)
+	AssertEq(nil, err)
+
+	var notFoundErr *gcs.NotFoundError
+	for _, objName := range []string{markerName, markerName + "/"} {
+		_, _, err = t.bucket.StatObject(t.ctx, &gcs.StatObjectRequest{Name: objName})
+		ExpectTrue(errors.As(err, &notFoundErr), "%s: %v", objName, err)
+	}
+}
+
+func (t *DirTest) CompatDirMarker_DeleteChildDirKeepsFiles() {
+	t.useCompatDirMarkers()
+	const name = "qux"
+	fileName := path.Join(dirInodeName, name)
+	_, err := storageutil.CreateObject(t.ctx, t.bucket, fileName, []byte(""))
+	AssertEq(nil, err)
+	_, err = storageutil.CreateObject(t.ctx, t.bucket, fileName+"/", []byte(""))
+	AssertEq(nil, err)
+
+	err = t.in.DeleteChildDir(t.ctx, name, false)
+	AssertEq(nil, err)
+
+	// The empty file without the marker content type stays.
+	_, _, err = t.bucket.StatObject(t.ctx, &gcs.StatObjectRequest{Name: fileName})
+	ExpectEq(nil, err)
+}
+
+// Back the inode by a bucket with a hierarchical namespace, in which
+// directories are folders.
+func (t *DirTest) useHierarchicalBucket() {
+	t.bucket = gcsx.NewSyncerBucket(
+		gcsx.SyncerConfig{AppendThreshold: 1, TmpObjectPrefix: ".gcsfuse_tmp/"},
+		fake.NewFakeBucketWithType(&t.clock, "some_bucket", gcs.Hierarchical))
+	t.resetInode(false, false, true)
+}
+
+func (t *DirTest) CreateChildDir_Hierarchical() {
+	t.useHierarchicalBucket()
+	const name = "qux"
+	folderName := path.Join(dirInodeName, name) + "/"
+
+	// Call the inode.
+	result, err := t.in.CreateChildDir(t.ctx, name)
+	AssertEq(nil, err)
+	AssertNe(nil, result)
+	AssertNe(nil, result.MinObject)
+	ExpectEq(folderName, result.MinObject.Name)
+	ExpectEq(metadata.ExplicitDirType, t.getTypeFromCache(name))
+
+	// A second folder can't be created over it.
+	_, err = t.in.CreateChildDir(t.ctx, name)
+	var preconditionErr *gcs.PreconditionError
+	ExpectTrue(errors.As(err, &preconditionErr))
+}
+
+func (t *DirTest) DeleteChildDir_Hierarchical_ImplicitDir() {
+	t.useHierarchicalBucket()
+	const name = "qux"
+	folderName := path.Join(dirInodeName, name) + "/"
+	_, err := t.bucket.CreateFolder(t.ctx, folderName)
+	AssertEq(nil, err)
+
+	// The folder is deleted even though the directory looked implicit.
+	err = t.in.DeleteChildDir(t.ctx, name, true)
+	AssertEq(nil, err)
+
+	_, _, err = t.bucket.StatObject(t.ctx, &gcs.StatObjectRequest{Name: folderName})
+	var notFoundErr *gcs.NotFoundError
+	ExpectTrue(errors.As(err, &notFoundErr))
+}
+
+func (t *DirTest) DeleteChildDir_Hierarchical_NotEmpty() {
+	t.useHierarchicalBucket()
+	const name = "qux"
+	folderName := path.Join(dirInodeName, name) + "/"
+	_, err := t.bucket.CreateFolder(t.ctx, folderName)
+	AssertEq(nil, err)
+	_, err = storageutil.CreateObject(t.ctx, t.bucket, folderName+"taco", []byte("taco"))
+	AssertEq(nil, err)
+
+	err = t.in.DeleteChildDir(t.ctx, name, false)
+
+	var preconditionErr *gcs.PreconditionError
+	ExpectTrue(errors.As(err, &preconditionErr))
+}
+
+func (t *DirTest) RenameFolder() {
+	t.useHierarchicalBucket()
+	const folderName = "baz/"
+	_, err := t.bucket.CreateFolder(t.ctx, folderName)
+	AssertEq(nil, err)
+	_, err = storageutil.CreateObject(t.ctx, t.bucket, folderName+"taco", []byte("taco"))
+	AssertEq(nil, err)
+
+	// Rename it to a child of the inode.
+	f, err := t.in.RenameFolder(t.ctx, folderName, "qux")
+
+	AssertEq(nil, err)
+	ExpectEq(path.Join(dirInodeName, "qux")+"/", f.Name)
+	ExpectEq(2, f.MetaGeneration)
+	ExpectEq(metadata.ExplicitDirType, t.getTypeFromCache("qux"))
+	contents, err := storageutil.ReadObject(t.ctx, t.bucket, path.Join(dirInodeName, "qux", "taco"))
+	AssertEq(nil, err)
+	ExpectEq("taco", string(contents))
+	_, _, err = t.bucket.StatObject(t.ctx, &gcs.StatObjectRequest{Name: folderName})
+	var notFoundErr *gcs.NotFoundError
+	ExpectTrue(errors.As(err, &notFoundErr))
+}
+
 func (t *DirTest) CreateLocalChildFile_ShouldnotCreateObjectInGCS() {
 	const name = "qux"
 
@@ -1526,3 +2289,249 @@ func (t *DirTest) Test_ShouldInvalidateKernelListCache_ZeroTtl() {
 
 	AssertEq(true, shouldInvalidate)
 }
+
+// cacheListing lists the directory, which the kernel may then keep until the
+// listing is invalidated.
+func (t *DirTest) cacheListing() {
+	_, err := t.readAllEntries()
+	AssertEq(nil, err)
+	AssertFalse(t.in.ShouldInvalidateKernelListCache(util.MaxTimeDuration))
+}
+
+// cacheNonexistent looks up the given name, which must not exist, so that its
+// absence is cached.
+func (t *DirTest) cacheNonexistent(name string) {
+	result, err := t.in.LookUpChild(t.ctx, name)
+	AssertEq(nil, err)
+	AssertEq(nil, result)
+	AssertEq(metadata.NonexistentType, t.getTypeFromCache(name))
+}
+
+// expectListed checks whether a new listing of the directory has an entry of
+// the given name.
+func (t *DirTest) expectListed(name string, listed bool) {
+	entries, err := t.readAllEntries()
+	AssertEq(nil, err)
+	found := false
+	for _, e := range entries {
+		if e.Name == name {
+			found = true
+		}
+	}
+	ExpectEq(listed, found)
+}
+
+func (t *DirTest) InvalidateChild() {
+	t.resetInode(false, true, true)
+	t.cacheListing()
+	t.cacheNonexistent("qux")
+
+	t.in.InvalidateChild("qux")
+
+	ExpectEq(metadata.UnknownType, t.getTypeFromCache("qux"))
+	ExpectTrue(t.in.ShouldInvalidateKernelListCache(util.MaxTimeDuration))
+}
+
+func (t *DirTest) CreateChildFile_InvalidatesCaches() {
+	t.resetInode(false, true, true)
+	t.cacheListing()
+	t.cacheNonexistent("qux")
+
+	_, err := t.in.CreateChildFile(t.ctx, "qux")
+
+	AssertEq(nil, err)
+	ExpectEq(metadata.RegularFileType, t.getTypeFromCache("qux"))
+	ExpectTrue(t.in.ShouldInvalidateKernelListCache(util.MaxTimeDuration))
+	t.expectListed("qux", true)
+}
+
+func (t *DirTest) CreateChildSymlink_InvalidatesCaches() {
+	t.resetInode(false, true, true)
+	t.cacheListing()
+	t.cacheNonexistent("qux")
+
+	_, err := t.in.CreateChildSymlink(t.ctx, "qux", "taco")
+
+	AssertEq(nil, err)
+	ExpectEq(metadata.SymlinkType, t.getTypeFromCache("qux"))
+	ExpectTrue(t.in.ShouldInvalidateKernelListCache(util.MaxTimeDuration))
+	t.expectListed("qux", true)
+}
+
+func (t *DirTest) CreateChildDir_InvalidatesCaches() {
+	t.resetInode(false, true, true)
+	t.cacheListing()
+	t.cacheNonexistent("qux")
+
+	_, err := t.in.CreateChildDir(t.ctx, "qux")
+
+	AssertEq(nil, err)
+	ExpectEq(metadata.ExplicitDirType, t.getTypeFromCache("qux"))
+	ExpectTrue(t.in.ShouldInvalidateKernelListCache(util.MaxTimeDuration))
+	t.expectListed("qux", true)
+}
+
+func (t *DirTest) CloneToChildFile_InvalidatesCaches() {
+	src, err := storageutil.CreateObject(t.ctx, t.bucket, "taco", []byte("taco"))
+	AssertEq(nil, err)
+	t.resetInode(false, true, true)
+	t.cacheListing()
+	t.cacheNonexistent("qux")
+
+	_, err = t.in.CloneToChildFile(t.ctx, "qux", storageutil.ConvertObjToMinObject(src))
+
+	AssertEq(nil, err)
+	ExpectEq(metadata.RegularFileType, t.getTypeFromCache("qux"))
+	ExpectTrue(t.in.ShouldInvalidateKernelListCache(util.MaxTimeDuration))
+	t.expectListed("qux", true)
+}
+
+func (t *DirTest) DeleteChildFile_InvalidatesCaches() {
+	_, err := storageutil.CreateObject(t.ctx, t.bucket, path.Join(dirInodeName, "qux"), []byte("taco"))
+	AssertEq(nil, err)
+	t.resetInode(false, true, true)
+	t.cacheListing()
+	AssertEq(metadata.RegularFileType, t.getTypeFromCache("qux"))
+
+	err = t.in.DeleteChildFile(t.ctx, "qux", 0, nil)
+
+	AssertEq(nil, err)
+	ExpectEq(metadata.UnknownType, t.getTypeFromCache("qux"))
+	ExpectTrue(t.in.ShouldInvalidateKernelListCache(util.MaxTimeDuration))
+	t.expectListed("qux", false)
+}
+
+func (t *DirTest) DeleteChildDir_InvalidatesCaches() {
+	_, err := storageutil.CreateObject(t.ctx, t.bucket, path.Join(dirInodeName, "qux")+"/", []byte(""))
+	AssertEq(nil, err)
+	t.resetInode(false, true, true)
+	t.cacheListing()
+	AssertEq(metadata.ExplicitDirType, t.getTypeFromCache("qux"))
+
+	err = t.in.DeleteChildDir(t.ctx, "qux", false)
+
+	AssertEq(nil, err)
+	ExpectEq(metadata.UnknownType, t.getTypeFromCache("qux"))
+	ExpectTrue(t.in.ShouldInvalidateKernelListCache(util.MaxTimeDuration))
+	t.expectListed("qux", false)
+}
+
+func (t *DirTest) RenameFolder_InvalidatesCaches() {
+	t.useHierarchicalBucket()
+	t.resetInode(false, true, true)
+	_, err := t.bucket.CreateFolder(t.ctx, "baz/")
+	AssertEq(nil, err)
+	t.cacheListing()
+	t.cacheNonexistent("qux")
+
+	_, err = t.in.RenameFolder(t.ctx, "baz/", "qux")
+
+	AssertEq(nil, err)
+	ExpectEq(metadata.ExplicitDirType, t.getTypeFromCache("qux"))
+	ExpectTrue(t.in.ShouldInvalidateKernelListCache(util.MaxTimeDuration))
+	t.expectListed("qux", true)
+}
+
+func (t *DirTest) CreateChildFile_ExpiresNewestChildTime() {
+	t.dirTimes = config.DirTimesNewestChild
+	t.resetInode(false, false, true)
+	t.clock.AdvanceTime(time.Minute)
+	_, err := storageutil.CreateObject(t.ctx, t.bucket, path.Join(dirInodeName, "baz"), []byte("taco"))
+	AssertEq(nil, err)
+	t.cacheListing()
+	attrs, err := t.in.Attributes(t.ctx)
+	AssertEq(nil, err)
+	AssertThat(attrs.Mtime, Not(timeutil.TimeEq(t.mountTime)))
+
+	_, err = t.in.CreateChildFile(t.ctx, "qux")
+
+	// The time of the last listing no longer holds.
+	AssertEq(nil, err)
+	attrs, err = t.in.Attributes(t.ctx)
+	AssertEq(nil, err)
+	ExpectThat(attrs.Mtime, timeutil.TimeEq(t.mountTime))
+}
+
+// deniedBucket forbids the caller to stat or list objects under a prefix, as
+// GCS does for a managed folder it has no permissions on.
+type deniedBucket struct {
+	gcs.Bucket
+	prefix string
+	lists  int
+}
+
+func (b *deniedBucket) StatObject(
+	ctx context.Context,
+	req *gcs.StatObjectRequest) (*gcs.MinObject, *gcs.ExtendedObjectAttributes, error) {
+	if strings.HasPrefix(req.Name, b.prefix) {
+		return nil, nil, &googleapi.Error{Code: http.StatusForbidden}
+	}
+	return b.Bucket.StatObject(ctx, req)
+}
+
+func (b *deniedBucket) ListObjects(
+	ctx context.Context,
+	req *gcs.ListObjectsRequest) (*gcs.Listing, error) {
+	b.lists++
+	if strings.HasPrefix(req.Prefix, b.prefix) {
+		return nil, &googleapi.Error{Code: http.StatusForbidden}
+	}
+	return b.Bucket.ListObjects(ctx, req)
+}
+
+// Forbid the caller to look under the prefix from now on.
+func (t *DirTest) denyPrefix(prefix string) *deniedBucket {
+	b := &deniedBucket{Bucket: t.bucket.Bucket, prefix: prefix}
+	t.bucket = gcsx.NewSyncerBucket(
+		gcsx.SyncerConfig{AppendThreshold: 1, TmpObjectPrefix: ".gcsfuse_tmp/"},
+		b)
+	return b
+}
+
+func (t *DirTest) LookUpChild_ListedDirDenied() {
+	_, err := storageutil.CreateObject(t.ctx, t.bucket, path.Join(dirInodeName, "qux")+"/", []byte(""))
+	AssertEq(nil, err)
+	t.cacheListing()
+	t.denyPrefix(path.Join(dirInodeName, "qux") + "/")
+
+	result, err := t.in.LookUpChild(t.ctx, "qux")
+
+	// The directory stays visible, with synthesized attributes.
+	AssertEq(nil, err)
+	AssertNe(nil, result)
+	ExpectEq(path.Join(dirInodeName, "qux")+"/", result.FullName.GcsObjectName())
+	ExpectEq(nil, result.MinObject)
+	ExpectEq(metadata.ImplicitDirType, t.getTypeFromCache("qux"))
+}
+
+func (t *DirTest) LookUpChild_UnlistedDirDenied() {
+	t.resetInode(true, false, true)
+	t.denyPrefix(path.Join(dirInodeName, "qux") + "/")
+
+	_, err := t.in.LookUpChild(t.ctx, "qux")
+
+	var apiErr *googleapi.Error
+	ExpectTrue(errors.As(err, &apiErr), "%v", err)
+}
+
+func (t *DirTest) ReadEntries_Denied() {
+	b := t.denyPrefix(dirInodeName)
+	t.resetInode(true, false, true)
+
+	_, err := t.readAllEntries()
+
+	var apiErr *googleapi.Error
+	ExpectTrue(errors.As(err, &apiErr), "%v", err)
+	ExpectTrue(t.in.ListDenied())
+
+	// The denial is remembered for a while.
+	_, err = t.readAllEntries()
+	ExpectTrue(errors.Is(err, syscall.EACCES), "%v", err)
+	ExpectEq(1, b.lists)
+
+	t.clock.AdvanceTime(ListDeniedTTL)
+	ExpectFalse(t.in.ListDenied())
+	_, err = t.readAllEntries()
+	ExpectTrue(errors.As(err, &apiErr), "%v", err)
+	ExpectEq(2, b.lists)
+}
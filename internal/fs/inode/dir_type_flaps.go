@@ -0,0 +1,94 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package inode
+
+import (
+	"sync"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/metadata"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/monitor"
+	"golang.org/x/net/context"
+)
+
+// The number of child directories whose kind a directory inode remembers.
+// Past it, they are forgotten all at once.
+const maxDirTypesTracked = 10000
+
+// dirTypeFlaps detects the child directories of a directory that resolve to
+// another kind of directory than the previous time, e.g. from explicit to
+// implicit when the placeholder object of a directory is deleted while objects
+// remain under it. Lookups of such a directory behave differently depending on
+// what is cached, so the flaps are logged and counted. Managed folders resolve
+// as implicit directories, being listed as prefixes.
+type dirTypeFlaps struct {
+	mu sync.Mutex
+
+	// The kind each child directory resolved to the last time.
+	//
+	// GUARDED_BY(mu)
+	lastSeen map[string]metadata.Type
+}
+
+// dirKind names the kind of directory t is, or returns "" if it's not a
+// directory.
+func dirKind(t metadata.Type) string {
+	switch t {
+	case metadata.ExplicitDirType:
+		return "explicit"
+	case metadata.ImplicitDirType:
+		return "implicit"
+	default:
+		return ""
+	}
+}
+
+// observe records that the child with the given name of the directory dirName
+// resolved to type t, logging and counting a flap if it's a directory that
+// resolved to another kind of directory the last time. Children resolving to
+// anything but a directory are ignored, so that a directory that went missing
+// for a while and came back as another kind is still noticed.
+func (f *dirTypeFlaps) observe(ctx context.Context, dirName Name, name string, t metadata.Type) {
+	kind := dirKind(t)
+	if kind == "" {
+		return
+	}
+
+	f.mu.Lock()
+	prev, ok := f.lastSeen[name]
+	if !ok && len(f.lastSeen) >= maxDirTypesTracked {
+		f.lastSeen = nil
+	}
+	if f.lastSeen == nil {
+		f.lastSeen = make(map[string]metadata.Type)
+	}
+	f.lastSeen[name] = t
+	f.mu.Unlock()
+
+	if !ok || prev == t {
+		return
+	}
+	logger.Debugf("Directory %q resolved as %s, after resolving as %s", dirName.GcsObjectName()+name+"/", kind, dirKind(prev))
+	monitor.CaptureDirTypeFlapMetrics(ctx, dirKind(prev), kind)
+}
+
+// forget forgets the kind of the child with the given name, after a local
+// change to it that explains a change of kind.
+func (f *dirTypeFlaps) forget(name string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	delete(f.lastSeen, name)
+}
@@ -15,8 +15,8 @@
 package inode
 
 import (
-	"time"
-
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/metadata"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/config"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/gcsx"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
 	"github.com/jacobsa/fuse/fuseops"
@@ -31,7 +31,8 @@ type ExplicitDirInode interface {
 }
 
 // Create an explicit dir inode backed by the supplied object. See notes on
-// NewDirInode for more.
+// NewDirInode for more. With config.DirTimesPlaceholder, the directory's mtime
+// and ctime are the update time of the object.
 func NewExplicitDirInode(
 	id fuseops.InodeID,
 	name Name,
@@ -40,11 +41,18 @@ func NewExplicitDirInode(
 	implicitDirs bool,
 	enableManagedFoldersListing bool,
 	enableNonexistentTypeCache bool,
-	typeCacheTTL time.Duration,
+	typeCacheTTLs metadata.EntryTTLs,
 	bucket *gcsx.SyncerBucket,
 	mtimeClock timeutil.Clock,
 	cacheClock timeutil.Clock,
-	typeCacheMaxSizeMB int) (d ExplicitDirInode) {
+	typeCacheMaxSizeMB int,
+	dirTimes string,
+	compatDirMarkerTypes []string) (d ExplicitDirInode) {
+	if dirTimes == config.DirTimesPlaceholder {
+		attrs.Mtime = m.Updated
+		attrs.Ctime = m.Updated
+	}
+
 	wrapped := NewDirInode(
 		id,
 		name,
@@ -52,11 +60,13 @@ func NewExplicitDirInode(
 		implicitDirs,
 		enableManagedFoldersListing,
 		enableNonexistentTypeCache,
-		typeCacheTTL,
+		typeCacheTTLs,
 		bucket,
 		mtimeClock,
 		cacheClock,
-		typeCacheMaxSizeMB)
+		typeCacheMaxSizeMB,
+		dirTimes,
+		compatDirMarkerTypes)
 
 	d = &explicitDirInode{
 		dirInode: wrapped.(*dirInode),
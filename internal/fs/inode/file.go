@@ -24,6 +24,7 @@ import (
 
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/contentcache"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/gcsx"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
 	"github.com/jacobsa/fuse/fuseops"
@@ -36,6 +37,22 @@ import (
 // the format defined by time.RFC3339Nano.
 const FileMtimeMetadataKey = gcsx.MtimeMetadataKey
 
+// A GCS object metadata key for file atimes, which are only set if the inode
+// preserves them. They're stored like mtimes.
+const FileAtimeMetadataKey = "gcsfuse_atime"
+
+// Extended attributes of files backed by an object, from which tools can tell
+// whether the file changed without reading it. The generation changes when
+// the contents of the object are replaced, the metageneration of a generation
+// when its metadata is updated, and the version, "<generation>.<metageneration>",
+// when either does.
+const (
+	XattrPrefix         = "user.gcsfuse."
+	GenerationXattr     = XattrPrefix + "generation"
+	MetaGenerationXattr = XattrPrefix + "metageneration"
+	VersionXattr        = XattrPrefix + "version"
+)
+
 type FileInode struct {
 	/////////////////////////
 	// Dependencies
@@ -56,6 +73,21 @@ type FileInode struct {
 	// one implementation with original functionality and one with new persistent disk content cache
 	localFileCache bool
 
+	// How long a lock object taken by AcquireLock is valid for, or zero if
+	// advisory locking via lock objects is disabled.
+	lockTTL time.Duration
+
+	// What to do once the object has been clobbered by another writer.
+	clobber clobberStrategy
+
+	// Whether atimes are persisted to FileAtimeMetadataKey and reported, rather
+	// than ignored.
+	preserveAtime bool
+
+	// How long SetTimes holds back the times of a file whose content is clean,
+	// or zero to update the object right away.
+	timesUpdateDelay time.Duration
+
 	/////////////////////////
 	// Mutable state
 	/////////////////////////
@@ -74,10 +106,22 @@ type FileInode struct {
 	// GUARDED_BY(mu)
 	src gcs.MinObject
 
+	// When a lookup through the metadata cache last found the object at src's
+	// generation, or the zero time if none has. See ConfirmSource.
+	//
+	// GUARDED_BY(mu)
+	srcConfirmed time.Time
+
 	// The current content of this inode, or nil if the source object is still
 	// authoritative.
 	content gcsx.TempFile
 
+	// The journal entry tracking content, if the content cache journals staged
+	// writes. nil whenever content is nil.
+	//
+	// GUARDED_BY(mu)
+	stagedWrite *contentcache.StagedWrite
+
 	// Has Destroy been called?
 	//
 	// GUARDED_BY(mu)
@@ -88,6 +132,62 @@ type FileInode struct {
 
 	// Represents if local file has been unlinked.
 	unlinked bool
+
+	// Set by KeepLocal.
+	keptLocal bool
+
+	// Whether the object of the inode was found to have been deleted from GCS,
+	// and whether TakeObjectDeletion has returned that since.
+	//
+	// GUARDED_BY(mu)
+	objectDeleted      bool
+	objectDeletionSeen bool
+
+	// The object generation whose contents the kernel page cache holds for this
+	// inode, as of the last open or successful sync. Zero for local files that
+	// haven't been synced yet, and -1 once we know the kernel's view may not
+	// match any generation, e.g. because a sync found the object clobbered.
+	//
+	// GUARDED_BY(mu)
+	pageCacheGeneration int64
+
+	// The number of outstanding successful AcquireLock calls, and the
+	// generation of the lock object created by the first of them.
+	//
+	// GUARDED_BY(mu)
+	lockHolders    int
+	lockGeneration int64
+
+	// Whether clobbering of the object has already been logged.
+	//
+	// GUARDED_BY(mu)
+	clobberLogged bool
+
+	// An atime set while the content was dirty, to be persisted once it has
+	// been synced, or one held back along with mtime. Always nil unless
+	// preserveAtime.
+	//
+	// GUARDED_BY(mu)
+	atime *time.Time
+
+	// An mtime set while the content was clean and held back for
+	// timesUpdateDelay, or nil.
+	//
+	// GUARDED_BY(mu)
+	mtime *time.Time
+
+	// Calls FlushPendingTimes once timesUpdateDelay has passed since times were
+	// first held back, or nil if none are.
+	//
+	// GUARDED_BY(mu)
+	timesTimer *time.Timer
+
+	// Whether a flush of the content timed out, and no sync has succeeded
+	// since. While set, the staged file and its journal entry outlive the
+	// inode, so the content can be recovered.
+	//
+	// GUARDED_BY(mu)
+	flushTimedOut bool
 }
 
 var _ Inode = &FileInode{}
@@ -100,6 +200,12 @@ var _ Inode = &FileInode{}
 // REQUIRES: m.MetaGeneration > 0
 // REQUIRES: len(m.Name) > 0
 // REQUIRES: m.Name[len(m.Name)-1] != '/'
+//
+// clobberBehavior is one of the config.ClobberBehavior values, the empty
+// string meaning config.ClobberBehaviorError. If preserveAtime is false,
+// atimes are ignored and the atime of the file is its mtime. If
+// timesUpdateDelay is positive, times set while the content is clean are held
+// back for that long; see FlushPendingTimes.
 func NewFileInode(
 	id fuseops.InodeID,
 	name Name,
@@ -109,25 +215,37 @@ func NewFileInode(
 	localFileCache bool,
 	contentCache *contentcache.ContentCache,
 	mtimeClock timeutil.Clock,
-	localFile bool) (f *FileInode) {
+	localFile bool,
+	lockTTL time.Duration,
+	clobberBehavior string,
+	preserveAtime bool,
+	timesUpdateDelay time.Duration) (f *FileInode) {
 	// Set up the basic struct.
 	var minObj gcs.MinObject
 	if m != nil {
 		minObj = *m
 	}
 	f = &FileInode{
-		bucket:         bucket,
-		mtimeClock:     mtimeClock,
-		id:             id,
-		name:           name,
-		attrs:          attrs,
-		localFileCache: localFileCache,
-		contentCache:   contentCache,
-		src:            minObj,
-		local:          localFile,
-		unlinked:       false,
+		bucket:           bucket,
+		mtimeClock:       mtimeClock,
+		id:               id,
+		name:             name,
+		attrs:            attrs,
+		localFileCache:   localFileCache,
+		contentCache:     contentCache,
+		src:              minObj,
+		local:            localFile,
+		unlinked:         false,
+		lockTTL:          lockTTL,
+		clobber:          newClobberStrategy(clobberBehavior),
+		preserveAtime:    preserveAtime,
+		timesUpdateDelay: timesUpdateDelay,
 	}
 
+	// The kernel has nothing cached for a freshly minted inode ID, so whatever
+	// it caches from here on reflects the source generation.
+	f.pageCacheGeneration = f.src.Generation
+
 	f.lc.Init(id)
 
 	// Set up invariant checking.
@@ -192,6 +310,7 @@ func (f *FileInode) clobbered(ctx context.Context, forceFetchFromGcs bool, inclu
 		}
 
 		b = true
+		f.objectDeleted = true
 		return
 	}
 
@@ -208,6 +327,33 @@ func (f *FileInode) clobbered(ctx context.Context, forceFetchFromGcs bool, inclu
 	return
 }
 
+// CheckReadError is given the error from reading the source generation of the
+// inode outside of the inode, e.g. through a file handle's reader. If the
+// generation no longer exists because the object was clobbered, what happens
+// depends on the inode's clobber behavior: it returns true if the inode moved
+// to the new generation and the read should be retried, and otherwise the
+// error for the read. readOnly tells whether the read came from a read-only
+// handle.
+//
+// LOCKS_REQUIRED(f.mu)
+func (f *FileInode) CheckReadError(
+	ctx context.Context,
+	readErr error,
+	readOnly bool) (retry bool, err error) {
+	err = readErr
+	var notFoundErr *gcs.NotFoundError
+	if !errors.As(readErr, &notFoundErr) || !f.clobber.detects() || f.IsLocal() {
+		return
+	}
+
+	latest, clobbered, statErr := f.clobbered(ctx, true, false)
+	if statErr != nil || !clobbered {
+		return
+	}
+
+	return f.clobber.readClobbered(f, storageutil.ConvertObjToMinObject(latest), readOnly)
+}
+
 // Open a reader for the generation of object we care about.
 func (f *FileInode) openReader(ctx context.Context) (io.ReadCloser, error) {
 	rc, err := f.bucket.NewReader(
@@ -265,13 +411,14 @@ func (f *FileInode) ensureContent(ctx context.Context) (err error) {
 			return err
 		}
 
-		tf, err := f.contentCache.NewTempFile(rc)
+		tf, sw, err := f.contentCache.NewStagedFile(rc, f.bucket.Name(), f.name.GcsObjectName(), f.src.Generation)
 		if err != nil {
-			err = fmt.Errorf("NewTempFile: %w", err)
+			err = fmt.Errorf("NewStagedFile: %w", err)
 			return err
 		}
 		// Update state.
 		f.content = tf
+		f.stagedWrite = sw
 	}
 
 	return
@@ -307,6 +454,30 @@ func (f *FileInode) IsUnlinked() bool {
 
 func (f *FileInode) Unlink() {
 	f.unlinked = true
+	// Nobody can flush the contents of an unlinked file again.
+	f.flushTimedOut = false
+}
+
+// ObjectDeleted returns true if the object of the inode was found to have been
+// deleted by another writer, in which case the inode is as good as unlinked.
+//
+// LOCKS_REQUIRED(f.mu)
+func (f *FileInode) ObjectDeleted() bool {
+	return f.objectDeleted
+}
+
+// TakeObjectDeletion returns true the first time it's called after the object
+// of the inode was found to have been deleted by another writer, for the
+// caller to make everything else forget the object.
+//
+// LOCKS_REQUIRED(f.mu)
+func (f *FileInode) TakeObjectDeletion() bool {
+	if !f.objectDeleted || f.objectDeletionSeen {
+		return false
+	}
+
+	f.objectDeletionSeen = true
+	return true
 }
 
 // Source returns a record for the GCS object from which this inode is branched. The
@@ -319,6 +490,34 @@ func (f *FileInode) Source() *gcs.MinObject {
 	return &o
 }
 
+// ConfirmSource records that a lookup through the metadata cache found the
+// object at the inode's source generation at the given time, so that its
+// record can stand in for a stat of the object until the metadata cache ttl
+// has passed.
+//
+// LOCKS_REQUIRED(f.mu)
+func (f *FileInode) ConfirmSource(t time.Time) {
+	f.srcConfirmed = t
+}
+
+// SourceConfirmed returns the time last given to ConfirmSource, or the zero
+// time.
+//
+// LOCKS_REQUIRED(f.mu)
+func (f *FileInode) SourceConfirmed() time.Time {
+	return f.srcConfirmed
+}
+
+// ShrinkSource records that the object generation that the inode is backed by
+// turned out to be only size bytes long, as found by a reader of it.
+//
+// LOCKS_REQUIRED(f.mu)
+func (f *FileInode) ShrinkSource(size uint64) {
+	if size < f.src.Size {
+		f.src.Size = size
+	}
+}
+
 // If true, it is safe to serve reads directly from the object given by
 // f.Source(), rather than calling f.ReadAt. Doing so may be more efficient,
 // because f.ReadAt may cause the entire object to be faulted in and requires
@@ -329,6 +528,26 @@ func (f *FileInode) SourceGenerationIsAuthoritative() bool {
 	return f.content == nil
 }
 
+// Xattrs returns the extended attributes of the file, keyed by the names in
+// XattrNames. There are none for a file whose contents aren't those
+// of its object, i.e. a local file or one with unsynced changes.
+//
+// LOCKS_REQUIRED(f.mu)
+func (f *FileInode) Xattrs() map[string]string {
+	if f.local || !f.SourceGenerationIsAuthoritative() {
+		return nil
+	}
+
+	return map[string]string{
+		GenerationXattr:     strconv.FormatInt(f.src.Generation, 10),
+		MetaGenerationXattr: strconv.FormatInt(f.src.MetaGeneration, 10),
+		VersionXattr:        fmt.Sprintf("%d.%d", f.src.Generation, f.src.MetaGeneration),
+	}
+}
+
+// XattrNames are the names of the extended attributes returned by Xattrs.
+var XattrNames = []string{GenerationXattr, MetaGenerationXattr, VersionXattr}
+
 // Equivalent to the generation returned by f.Source().
 //
 // LOCKS_REQUIRED(f)
@@ -338,6 +557,18 @@ func (f *FileInode) SourceGeneration() (g Generation) {
 	return
 }
 
+// RecordOpen is called when the inode is opened. It reports whether the
+// contents the kernel page cache holds for the inode are those of the current
+// source generation, in which case it is safe to keep them, and records the
+// source generation as the one the page cache will hold from now on.
+//
+// LOCKS_REQUIRED(f.mu)
+func (f *FileInode) RecordOpen() (pageCacheValid bool) {
+	pageCacheValid = f.pageCacheGeneration == f.src.Generation
+	f.pageCacheGeneration = f.src.Generation
+	return
+}
+
 // LOCKS_REQUIRED(f.mu)
 func (f *FileInode) IncrementLookupCount() {
 	f.lc.Inc()
@@ -351,16 +582,153 @@ func (f *FileInode) DecrementLookupCount(n uint64) (destroy bool) {
 
 // LOCKS_REQUIRED(f.mu)
 func (f *FileInode) Destroy() (err error) {
+	// Times held back can't be written later.
+	if err = f.FlushPendingTimes(context.Background()); err != nil {
+		err = fmt.Errorf("FlushPendingTimes: %w", err)
+	}
+
 	f.destroyed = true
 	if f.localFileCache {
 		cacheObjectKey := &contentcache.CacheObjectKey{BucketName: f.bucket.Name(), ObjectName: f.name.objectName}
 		f.contentCache.Remove(cacheObjectKey)
+	} else if f.content != nil && f.flushTimedOut {
+		f.abandonContent()
 	} else if f.content != nil {
-		f.content.Destroy()
+		f.destroyContent()
+	}
+	return
+}
+
+// abandonContent lets go of the local content, leaving the staged file and its
+// journal entry behind for the next mount to recover.
+//
+// LOCKS_REQUIRED(f.mu)
+func (f *FileInode) abandonContent() {
+	f.content.Destroy()
+	f.content = nil
+	if f.stagedWrite != nil {
+		f.FlushStagedWrite()
+		logger.Warnf("Unflushed contents of %q are kept in %q for recovery.",
+			f.name.GcsObjectName(), f.stagedWrite.StagedFilePath())
+		f.stagedWrite = nil
+	}
+}
+
+// destroyContent throws away the local content along with its journal entry.
+//
+// LOCKS_REQUIRED(f.mu)
+func (f *FileInode) destroyContent() {
+	f.content.Destroy()
+	f.content = nil
+	if f.stagedWrite != nil {
+		f.stagedWrite.Remove()
+		f.stagedWrite = nil
+	}
+}
+
+// recordWrite journals a modification of the local content. Journaling is
+// best effort: failing to journal doesn't fail the write.
+//
+// LOCKS_REQUIRED(f.mu)
+func (f *FileInode) recordWrite(n int) {
+	if f.stagedWrite == nil {
+		return
+	}
+
+	if err := f.stagedWrite.RecordWrite(n); err != nil {
+		logger.Warnf("Failed to journal write to %q: %v", f.name.GcsObjectName(), err)
 	}
+}
+
+// HasStagedContent reports whether the inode holds local contents, which Sync
+// writes out if they were modified.
+//
+// LOCKS_REQUIRED(f.mu)
+func (f *FileInode) HasStagedContent() bool {
+	return f.content != nil
+}
+
+// RecordClose is called when a handle to the inode is flushed. It records in
+// the journal of staged writes that the local content is complete, so it can
+// be uploaded on recovery if gcsfuse crashes before the upload succeeds.
+//
+// LOCKS_REQUIRED(f.mu)
+func (f *FileInode) RecordClose() {
+	if f.stagedWrite == nil {
+		return
+	}
+
+	if err := f.stagedWrite.RecordClose(); err != nil {
+		logger.Warnf("Failed to journal close of %q: %v", f.name.GcsObjectName(), err)
+	}
+}
+
+// FlushStagedWrite brings the journal entry of the local content up to date,
+// so that writes which haven't been uploaded yet can be recovered by the next
+// mount.
+//
+// LOCKS_REQUIRED(f.mu)
+func (f *FileInode) FlushStagedWrite() {
+	if f.stagedWrite == nil {
+		return
+	}
+
+	if err := f.stagedWrite.Flush(); err != nil {
+		logger.Warnf("Failed to journal writes to %q: %v", f.name.GcsObjectName(), err)
+	}
+}
+
+// KeepLocal makes the contents of a local file stay in the mount: the object
+// with its name is never looked at, and the fs never writes them out. Neither
+// does the next mount recover them, so that their journal entry is removed.
+//
+// LOCKS_REQUIRED(f.mu)
+func (f *FileInode) KeepLocal() {
+	f.keptLocal = true
+	if f.stagedWrite != nil {
+		f.stagedWrite.Remove()
+		f.stagedWrite = nil
+	}
+}
+
+// KeptLocal returns true if KeepLocal has been called.
+//
+// LOCKS_REQUIRED(f.mu)
+func (f *FileInode) KeptLocal() bool {
+	return f.keptLocal
+}
+
+// RecordFlushTimeout is called when a flush of the inode gives up on syncing
+// it in time. Until a sync succeeds, FlushTimedOut returns true and the local
+// content is kept for recovery even if the inode is destroyed. It returns
+// false if a flush had already timed out.
+//
+// LOCKS_REQUIRED(f.mu)
+func (f *FileInode) RecordFlushTimeout() (first bool) {
+	first = !f.flushTimedOut
+	f.flushTimedOut = true
 	return
 }
 
+// FlushTimedOut returns true if the inode holds local content that a flush
+// gave up on uploading. See RecordFlushTimeout.
+//
+// LOCKS_REQUIRED(f.mu)
+func (f *FileInode) FlushTimedOut() bool {
+	return f.flushTimedOut
+}
+
+// StagedFilePath returns the path of the file holding the local content, or
+// the empty string if it has none or it's anonymous.
+//
+// LOCKS_REQUIRED(f.mu)
+func (f *FileInode) StagedFilePath() string {
+	if f.stagedWrite == nil {
+		return ""
+	}
+	return f.stagedWrite.StagedFilePath()
+}
+
 // LOCKS_REQUIRED(f.mu)
 func (f *FileInode) Attributes(
 	ctx context.Context) (attrs fuseops.InodeAttributes, err error) {
@@ -388,6 +756,11 @@ func (f *FileInode) Attributes(
 		}
 	}
 
+	// An mtime held back is the one the object is about to get.
+	if f.mtime != nil {
+		attrs.Mtime = *f.mtime
+	}
+
 	// If we've got local content, its size and (maybe) mtime take precedence.
 	if f.content != nil {
 		var sr gcsx.StatResult
@@ -403,16 +776,36 @@ func (f *FileInode) Attributes(
 		}
 	}
 
-	// We require only that atime and ctime be "reasonable".
+	// We require only that atime and ctime be "reasonable", unless atimes are
+	// preserved.
 	attrs.Atime = attrs.Mtime
 	attrs.Ctime = attrs.Mtime
+	if f.preserveAtime {
+		if f.atime != nil {
+			attrs.Atime = *f.atime
+		} else if formatted, ok := f.src.Metadata[FileAtimeMetadataKey]; ok {
+			if atime, err := time.Parse(time.RFC3339Nano, formatted); err == nil {
+				attrs.Atime = atime
+			}
+		}
+	}
+
+	// The birth time is the creation time of the generation, i.e. when the
+	// contents were last replaced. Only macOS passes it on to stat(2).
+	attrs.Crtime = f.src.Created
+	if attrs.Crtime.IsZero() {
+		attrs.Crtime = attrs.Mtime
+	}
 
 	// If the object has been clobbered, we reflect that as the inode being
 	// unlinked.
-	_, clobbered, err := f.clobbered(ctx, false, false)
-	if err != nil {
-		err = fmt.Errorf("clobbered: %w", err)
-		return
+	var clobbered bool
+	if f.clobber.detects() && !f.keptLocal {
+		_, clobbered, err = f.clobbered(ctx, false, false)
+		if err != nil {
+			err = fmt.Errorf("clobbered: %w", err)
+			return
+		}
 	}
 
 	attrs.Nlink = 1
@@ -477,6 +870,9 @@ func (f *FileInode) Write(
 	// Write to the mutable content. Note that io.WriterAt guarantees it returns
 	// an error for short writes.
 	_, err = f.content.WriteAt(data, offset)
+	if err == nil {
+		f.recordWrite(len(data))
+	}
 
 	return
 }
@@ -487,6 +883,25 @@ func (f *FileInode) Write(
 func (f *FileInode) SetMtime(
 	ctx context.Context,
 	mtime time.Time) (err error) {
+	return f.SetTimes(ctx, nil, &mtime)
+}
+
+// Set the atime and/or mtime for this file, leaving the nil ones unchanged.
+// The atime is ignored unless the inode preserves atimes. May involve a round
+// trip to GCS.
+//
+// LOCKS_REQUIRED(f.mu)
+func (f *FileInode) SetTimes(
+	ctx context.Context,
+	atime *time.Time,
+	mtime *time.Time) (err error) {
+	if !f.preserveAtime {
+		atime = nil
+	}
+	if atime == nil && mtime == nil {
+		return
+	}
+
 	// If we have a local temp file, stat it.
 	var sr gcsx.StatResult
 	if f.content != nil {
@@ -506,22 +921,136 @@ func (f *FileInode) SetMtime(
 	//
 	// 2. If the file is local, that means its not yet synced to GCS. Just update
 	// the mtime locally, it will be synced when the object is created on GCS.
+	//
+	// An atime is kept aside until the content has been synced.
 	if sr.Mtime != nil || f.IsLocal() {
-		f.content.SetMtime(mtime)
+		if mtime != nil {
+			f.content.SetMtime(*mtime)
+		}
+		if atime != nil {
+			f.atime = atime
+		}
+		return
+	}
+
+	// Otherwise, update the backing object's metadata, possibly holding the
+	// times back so that those set meanwhile share the update.
+	if f.timesUpdateDelay > 0 {
+		f.holdBackTimes(atime, mtime)
+		return
+	}
+
+	err = f.updateTimes(ctx, atime, mtime)
+	return
+}
+
+// holdBackTimes records times to be written by FlushPendingTimes, which runs
+// once timesUpdateDelay has passed unless something calls it sooner. Later
+// times replace earlier ones.
+//
+// LOCKS_REQUIRED(f.mu)
+func (f *FileInode) holdBackTimes(atime *time.Time, mtime *time.Time) {
+	if atime != nil {
+		t := *atime
+		f.atime = &t
+	}
+	if mtime != nil {
+		t := *mtime
+		f.mtime = &t
+	}
+
+	if f.timesTimer == nil {
+		f.timesTimer = time.AfterFunc(f.timesUpdateDelay, f.flushPendingTimesLater)
+	}
+}
+
+// flushPendingTimesLater is called by timesTimer.
+//
+// LOCKS_EXCLUDED(f.mu)
+func (f *FileInode) flushPendingTimesLater() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.destroyed {
+		return
+	}
+
+	if err := f.FlushPendingTimes(context.Background()); err != nil {
+		logger.Warnf("Updating the times of %q: %v", f.name.GcsObjectName(), err)
+	}
+}
+
+// FlushPendingTimes writes the times that SetTimes has held back to the
+// object's metadata. If the content has been dirtied since, the held back
+// mtime is dropped in favour of that of the content, and the atime is
+// persisted after the content has been synced, as if set while dirty.
+//
+// LOCKS_REQUIRED(f.mu)
+func (f *FileInode) FlushPendingTimes(ctx context.Context) (err error) {
+	if f.timesTimer == nil {
+		return
+	}
+	f.timesTimer.Stop()
+	f.timesTimer = nil
+
+	mtime := f.mtime
+	f.mtime = nil
+
+	if f.IsLocal() {
+		return
+	}
+	if f.content != nil {
+		var sr gcsx.StatResult
+		sr, err = f.content.Stat()
+		if err != nil {
+			err = fmt.Errorf("Stat: %w", err)
+			return
+		}
+		if sr.Mtime != nil {
+			return
+		}
+	}
+
+	atime := f.atime
+	f.atime = nil
+
+	err = f.updateTimes(ctx, atime, mtime)
+	return
+}
+
+// updateTimes writes the given times to the metadata of the source object,
+// leaving out those it already has, e.g. because tar or cp -p set them once
+// more, and skipping the round trip when none is left.
+//
+// LOCKS_REQUIRED(f.mu)
+func (f *FileInode) updateTimes(
+	ctx context.Context,
+	atime *time.Time,
+	mtime *time.Time) (err error) {
+	metadata := make(map[string]*string)
+	if mtime != nil {
+		formatted := mtime.UTC().Format(time.RFC3339Nano)
+		if f.src.Metadata[FileMtimeMetadataKey] != formatted {
+			metadata[FileMtimeMetadataKey] = &formatted
+		}
+	}
+	if atime != nil {
+		formatted := atime.UTC().Format(time.RFC3339Nano)
+		if f.src.Metadata[FileAtimeMetadataKey] != formatted {
+			metadata[FileAtimeMetadataKey] = &formatted
+		}
+	}
+	if len(metadata) == 0 {
 		return
 	}
 
-	// Otherwise, update the backing object's metadata.
-	formatted := mtime.UTC().Format(time.RFC3339Nano)
 	srcGen := f.SourceGeneration()
 
 	req := &gcs.UpdateObjectRequest{
 		Name:                       f.src.Name,
 		Generation:                 srcGen.Object,
 		MetaGenerationPrecondition: &srcGen.Metadata,
-		Metadata: map[string]*string{
-			FileMtimeMetadataKey: &formatted,
-		},
+		Metadata:                   metadata,
 	}
 
 	o, err := f.bucket.UpdateObject(ctx, req)
@@ -565,6 +1094,19 @@ func (f *FileInode) SetMtime(
 //
 // LOCKS_REQUIRED(f.mu)
 func (f *FileInode) Sync(ctx context.Context) (err error) {
+	// Whatever a timed out flush left behind has been dealt with.
+	defer func() {
+		if err == nil {
+			f.flushTimedOut = false
+		}
+	}()
+
+	// Times held back are written now.
+	if err = f.FlushPendingTimes(ctx); err != nil {
+		err = fmt.Errorf("FlushPendingTimes: %w", err)
+		return
+	}
+
 	// If we have not been dirtied, there is nothing to do.
 	if f.content == nil {
 		return
@@ -582,7 +1124,12 @@ func (f *FileInode) Sync(ctx context.Context) (err error) {
 
 	// Clobbered is treated as being unlinked. There's no reason to return an
 	// error in that case. We simply return without syncing the object.
-	if err != nil || isClobbered {
+	if err != nil {
+		return
+	}
+	if isClobbered {
+		// The kernel has our unsynced writes cached, which match no generation.
+		f.pageCacheGeneration = -1
 		return
 	}
 
@@ -595,6 +1142,7 @@ func (f *FileInode) Sync(ctx context.Context) (err error) {
 	// as being unlinked. There's no reason to return an error in that case.
 	var preconditionErr *gcs.PreconditionError
 	if errors.As(err, &preconditionErr) {
+		f.pageCacheGeneration = -1
 		err = nil
 		return
 	}
@@ -613,17 +1161,113 @@ func (f *FileInode) Sync(ctx context.Context) (err error) {
 			minObj = *minObjPtr
 		}
 		f.src = minObj
+		// Our writes went through the kernel, so its page cache holds the
+		// contents of the generation we just created.
+		f.pageCacheGeneration = f.src.Generation
 		// Convert localFile to nonLocalFile after it is synced to GCS.
 		if f.IsLocal() {
 			f.local = false
 		}
-		f.content.Destroy()
-		f.content = nil
+		f.destroyContent()
+
+		// Now that the object is up to date, persist an atime set meanwhile.
+		if atime := f.atime; atime != nil {
+			f.atime = nil
+			err = f.SetTimes(ctx, atime, nil)
+			if err != nil {
+				err = fmt.Errorf("SetTimes: %w", err)
+				return
+			}
+		}
 	}
 
 	return
 }
 
+// CopyFrom replaces the contents of the file, which must be empty, with a
+// server-side copy of the supplied object from the same bucket, so that none
+// of its bytes pass through gcsfuse, and makes the copy the file's source. It
+// returns false without an error if the file can't be replaced this way: if
+// it isn't empty, keeps its contents in the local file cache or isn't meant
+// to be written out, or if the source or the file changed in the bucket
+// meanwhile. The caller is then expected to copy through reads and writes.
+//
+// LOCKS_REQUIRED(f.mu)
+func (f *FileInode) CopyFrom(ctx context.Context, src *gcs.MinObject) (copied bool, err error) {
+	if f.localFileCache || f.unlinked || f.keptLocal {
+		return
+	}
+
+	// Only empty files are replaced.
+	size := int64(f.src.Size)
+	if f.content != nil {
+		var sr gcsx.StatResult
+		sr, err = f.content.Stat()
+		if err != nil {
+			err = fmt.Errorf("Stat: %w", err)
+			return
+		}
+		size = sr.Size
+	}
+	if size != 0 {
+		return
+	}
+
+	// Times held back would otherwise be written over the copy's.
+	if err = f.FlushPendingTimes(ctx); err != nil {
+		err = fmt.Errorf("FlushPendingTimes: %w", err)
+		return
+	}
+
+	// Copy over the generation the file knows of, which is zero for a local
+	// file, i.e. the object mustn't exist.
+	dstGen := f.src.Generation
+	o, err := f.bucket.CopyObject(
+		ctx,
+		&gcs.CopyObjectRequest{
+			SrcName:                       src.Name,
+			SrcGeneration:                 src.Generation,
+			SrcMetaGenerationPrecondition: &src.MetaGeneration,
+			DstName:                       f.Name().GcsObjectName(),
+			DstGenerationPrecondition:     &dstGen,
+		})
+
+	var preconditionErr *gcs.PreconditionError
+	var notFoundErr *gcs.NotFoundError
+	if errors.As(err, &preconditionErr) || errors.As(err, &notFoundErr) {
+		err = nil
+		return
+	}
+	if err != nil {
+		err = fmt.Errorf("CopyObject: %w", err)
+		return
+	}
+
+	var minObj gcs.MinObject
+	if minObjPtr := storageutil.ConvertObjToMinObject(o); minObjPtr != nil {
+		minObj = *minObjPtr
+	}
+	f.src = minObj
+	f.local = false
+	if f.content != nil {
+		f.destroyContent()
+	}
+	copied = true
+
+	// The copy carries the mtime of its source in its metadata, if any, while
+	// the file has just been written. The contents are in place either way, so
+	// failing to update it doesn't fail the copy.
+	_, hasMtime := f.src.Metadata[FileMtimeMetadataKey]
+	_, hasGsutilMtime := f.src.Metadata["goog-reserved-file-mtime"]
+	if hasMtime || hasGsutilMtime {
+		now := f.mtimeClock.Now()
+		if err := f.updateTimes(ctx, nil, &now); err != nil {
+			logger.Warnf("Updating the mtime of %q: %v", f.name.GcsObjectName(), err)
+		}
+	}
+	return
+}
+
 // Truncate the file to the specified size.
 //
 // LOCKS_REQUIRED(f.mu)
@@ -639,6 +1283,9 @@ func (f *FileInode) Truncate(
 
 	// Call through.
 	err = f.content.Truncate(size)
+	if err == nil {
+		f.recordWrite(0)
+	}
 
 	return
 }
@@ -655,7 +1302,8 @@ func (f *FileInode) CacheEnsureContent(ctx context.Context) (err error) {
 func (f *FileInode) CreateEmptyTempFile() (err error) {
 	// Creating a file with no contents. The contents will be updated with
 	// writeFile operations.
-	f.content, err = f.contentCache.NewTempFile(io.NopCloser(strings.NewReader("")))
+	f.content, f.stagedWrite, err = f.contentCache.NewStagedFile(
+		io.NopCloser(strings.NewReader("")), f.bucket.Name(), f.name.GcsObjectName(), 0)
 	// Setting the initial mtime to creation time.
 	f.content.SetMtime(f.mtimeClock.Now())
 	return
@@ -15,10 +15,13 @@
 package inode
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
+	"path"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -28,6 +31,7 @@ import (
 	"github.com/jacobsa/syncutil"
 	"golang.org/x/net/context"
 
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/config"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/contentcache"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/gcsx"
 	"github.com/jacobsa/fuse/fuseops"
@@ -58,6 +62,12 @@ type FileTest struct {
 	backingObj      *gcs.MinObject
 
 	in *FileInode
+
+	// Whether createInode creates an inode that preserves atimes.
+	preserveAtime bool
+
+	// The timesUpdateDelay of the inode createInode creates.
+	timesUpdateDelay time.Duration
 }
 
 var _ SetUpInterface = &FileTest{}
@@ -106,8 +116,7 @@ func (t *FileTest) createInodeWithLocalParam(fileName string, local bool) {
 		fileName,
 	)
 	syncerBucket := gcsx.NewSyncerBucket(
-		1, // Append threshold
-		".gcsfuse_tmp/",
+		gcsx.SyncerConfig{AppendThreshold: 1, TmpObjectPrefix: ".gcsfuse_tmp/"},
 		t.bucket)
 
 	if local {
@@ -126,7 +135,11 @@ func (t *FileTest) createInodeWithLocalParam(fileName string, local bool) {
 		false, // localFileCache
 		contentcache.New("", &t.clock),
 		&t.clock,
-		local)
+		local,
+		0, // lockTTL
+		config.DefaultClobberBehavior,
+		t.preserveAtime,
+		t.timesUpdateDelay)
 
 	t.in.Lock()
 }
@@ -390,6 +403,37 @@ func (t *FileTest) WriteThenSync() {
 	ExpectThat(attrs.Mtime, timeutil.TimeEq(writeTime.UTC()))
 }
 
+func (t *FileTest) WriteFarBeyondEndThenSync() {
+	const offset = 64 << 20
+
+	// Write well past the end, leaving a hole.
+	err := t.in.Write(t.ctx, []byte("burrito"), offset)
+	AssertEq(nil, err)
+
+	// Sync.
+	err = t.in.Sync(t.ctx)
+	AssertEq(nil, err)
+
+	// The hole is uploaded as zeros.
+	statReq := &gcs.StatObjectRequest{Name: t.in.Name().GcsObjectName()}
+	m, _, err := t.bucket.StatObject(t.ctx, statReq)
+
+	AssertEq(nil, err)
+	AssertNe(nil, m)
+	ExpectEq(offset+len("burrito"), m.Size)
+
+	rc, err := t.bucket.NewReader(t.ctx, &gcs.ReadObjectRequest{
+		Name:  t.in.Name().GcsObjectName(),
+		Range: &gcs.ByteRange{Start: 0, Limit: 6},
+	})
+	AssertEq(nil, err)
+	contents, err := io.ReadAll(rc)
+	rc.Close()
+
+	AssertEq(nil, err)
+	ExpectEq("taco\x00\x00", string(contents))
+}
+
 func (t *FileTest) WriteToLocalFileThenSync() {
 	var attrs fuseops.InodeAttributes
 	var err error
@@ -693,6 +737,285 @@ func (t *FileTest) Sync_Clobbered() {
 	ExpectEq(newObj.Size, m.Size)
 }
 
+func (t *FileTest) CopyFrom_LocalFile() {
+	src := t.backingObj
+	t.createInodeWithLocalParam("test", true)
+	AssertEq(nil, t.in.CreateEmptyTempFile())
+
+	copied, err := t.in.CopyFrom(t.ctx, src)
+
+	AssertEq(nil, err)
+	ExpectTrue(copied)
+	ExpectFalse(t.in.IsLocal())
+	ExpectFalse(t.in.HasStagedContent())
+
+	// The object is a copy, known by the inode.
+	m, _, err := t.bucket.StatObject(t.ctx, &gcs.StatObjectRequest{Name: "test"})
+	AssertEq(nil, err)
+	ExpectEq(m.Generation, t.in.SourceGeneration().Object)
+	ExpectEq(m.MetaGeneration, t.in.SourceGeneration().Metadata)
+	ExpectEq(*src.CRC32C, *m.CRC32C)
+
+	contents, err := storageutil.ReadObject(t.ctx, t.bucket, "test")
+	AssertEq(nil, err)
+	ExpectEq(t.initialContents, string(contents))
+
+	attrs, err := t.in.Attributes(t.ctx)
+	AssertEq(nil, err)
+	ExpectEq(len(t.initialContents), attrs.Size)
+}
+
+func (t *FileTest) CopyFrom_EmptyObject() {
+	// The source has an mtime of its own.
+	srcMtime := t.clock.Now().Add(-time.Hour).UTC().Format(time.RFC3339Nano)
+	src, err := t.bucket.CreateObject(t.ctx, &gcs.CreateObjectRequest{
+		Name:     "src",
+		Contents: strings.NewReader("burrito"),
+		Metadata: map[string]string{FileMtimeMetadataKey: srcMtime},
+	})
+	AssertEq(nil, err)
+
+	// Make an empty object the file's source.
+	empty, err := storageutil.CreateObject(t.ctx, t.bucket, fileName, nil)
+	AssertEq(nil, err)
+	t.backingObj = storageutil.ConvertObjToMinObject(empty)
+	t.createInode()
+	t.clock.AdvanceTime(time.Minute)
+
+	copied, err := t.in.CopyFrom(t.ctx, storageutil.ConvertObjToMinObject(src))
+
+	AssertEq(nil, err)
+	ExpectTrue(copied)
+	contents, err := storageutil.ReadObject(t.ctx, t.bucket, fileName)
+	AssertEq(nil, err)
+	ExpectEq("burrito", string(contents))
+
+	// The file was just written, whatever the source's mtime.
+	attrs, err := t.in.Attributes(t.ctx)
+	AssertEq(nil, err)
+	ExpectTrue(attrs.Mtime.Equal(t.clock.Now()), "%v", attrs.Mtime)
+}
+
+func (t *FileTest) CopyFrom_NotEmpty() {
+	src, err := storageutil.CreateObject(t.ctx, t.bucket, "src", []byte("burrito"))
+	AssertEq(nil, err)
+
+	copied, err := t.in.CopyFrom(t.ctx, storageutil.ConvertObjToMinObject(src))
+
+	AssertEq(nil, err)
+	ExpectFalse(copied)
+	ExpectEq(t.backingObj.Generation, t.in.SourceGeneration().Object)
+	contents, err := storageutil.ReadObject(t.ctx, t.bucket, fileName)
+	AssertEq(nil, err)
+	ExpectEq(t.initialContents, string(contents))
+}
+
+func (t *FileTest) CopyFrom_SourceChanged() {
+	src := t.backingObj
+	t.createInodeWithLocalParam("test", true)
+	AssertEq(nil, t.in.CreateEmptyTempFile())
+
+	// Update the source's metadata behind the inode's back.
+	value := "bar"
+	_, err := t.bucket.UpdateObject(t.ctx, &gcs.UpdateObjectRequest{
+		Name:     fileName,
+		Metadata: map[string]*string{"foo": &value},
+	})
+	AssertEq(nil, err)
+
+	copied, err := t.in.CopyFrom(t.ctx, src)
+
+	AssertEq(nil, err)
+	ExpectFalse(copied)
+	ExpectTrue(t.in.IsLocal())
+	_, _, err = t.bucket.StatObject(t.ctx, &gcs.StatObjectRequest{Name: "test"})
+	_, ok := err.(*gcs.NotFoundError)
+	ExpectTrue(ok, "%v", err)
+}
+
+func (t *FileTest) CopyFrom_Clobbered() {
+	src := t.backingObj
+	t.createInodeWithLocalParam("test", true)
+	AssertEq(nil, t.in.CreateEmptyTempFile())
+
+	// Create an object with the file's name behind the inode's back.
+	other, err := storageutil.CreateObject(t.ctx, t.bucket, "test", []byte("burrito"))
+	AssertEq(nil, err)
+
+	copied, err := t.in.CopyFrom(t.ctx, src)
+
+	AssertEq(nil, err)
+	ExpectFalse(copied)
+	ExpectTrue(t.in.IsLocal())
+	m, _, err := t.bucket.StatObject(t.ctx, &gcs.StatObjectRequest{Name: "test"})
+	AssertEq(nil, err)
+	ExpectEq(other.Generation, m.Generation)
+}
+
+// Make the inode journal its staged writes in a fresh temporary directory, and
+// return the directory of the journal in it.
+func (t *FileTest) journalStagedWrites() (dir string) {
+	dir, err := os.MkdirTemp("", "file_test")
+	AssertEq(nil, err)
+
+	t.in.contentCache = contentcache.New(dir, &t.clock)
+	AssertEq(nil, t.in.contentCache.EnableStagedWriteJournal(t.bucket.Name(), ""))
+	return contentcache.StagedWriteDir(dir, t.bucket.Name(), "")
+}
+
+func (t *FileTest) listDir(dir string) (names []string) {
+	entries, err := os.ReadDir(dir)
+	AssertEq(nil, err)
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	return
+}
+
+func (t *FileTest) StagedWriteJournal_RemovedOnSync() {
+	dir := t.journalStagedWrites()
+	defer os.RemoveAll(path.Dir(dir))
+
+	err := t.in.Write(t.ctx, []byte("p"), 0)
+	AssertEq(nil, err)
+	t.in.RecordClose()
+
+	// The staged file and its journal entry.
+	ExpectEq(2, len(t.listDir(dir)))
+
+	err = t.in.Sync(t.ctx)
+	AssertEq(nil, err)
+	ExpectEq(0, len(t.listDir(dir)))
+}
+
+func (t *FileTest) StagedWriteJournal_RemovedOnDestroy() {
+	dir := t.journalStagedWrites()
+	defer os.RemoveAll(path.Dir(dir))
+
+	err := t.in.Write(t.ctx, []byte("p"), 0)
+	AssertEq(nil, err)
+	AssertEq(2, len(t.listDir(dir)))
+
+	err = t.in.Destroy()
+	AssertEq(nil, err)
+	ExpectEq(0, len(t.listDir(dir)))
+}
+
+func (t *FileTest) StagedWriteJournal_FlushRecordsLatestWrites() {
+	dir := t.journalStagedWrites()
+	defer os.RemoveAll(path.Dir(dir))
+
+	err := t.in.Write(t.ctx, []byte("p"), 0)
+	AssertEq(nil, err)
+	err = t.in.Write(t.ctx, []byte("aco"), 1)
+	AssertEq(nil, err)
+
+	t.in.FlushStagedWrite()
+
+	var journalPath string
+	for _, name := range t.listDir(dir) {
+		if strings.HasSuffix(name, ".json") {
+			journalPath = path.Join(dir, name)
+		}
+	}
+	AssertNe("", journalPath)
+
+	var entry contentcache.StagedWriteEntry
+	contents, err := os.ReadFile(journalPath)
+	AssertEq(nil, err)
+	AssertEq(nil, json.Unmarshal(contents, &entry))
+	ExpectEq(4, entry.BytesWritten)
+}
+
+func (t *FileTest) RecordFlushTimeout_KeptOnDestroy() {
+	dir := t.journalStagedWrites()
+	defer os.RemoveAll(path.Dir(dir))
+
+	err := t.in.Write(t.ctx, []byte("taco"), 0)
+	AssertEq(nil, err)
+	t.in.RecordClose()
+
+	ExpectTrue(t.in.RecordFlushTimeout())
+	ExpectFalse(t.in.RecordFlushTimeout())
+	ExpectTrue(t.in.FlushTimedOut())
+	stagedFilePath := t.in.StagedFilePath()
+	AssertNe("", stagedFilePath)
+
+	err = t.in.Destroy()
+	AssertEq(nil, err)
+
+	// The staged file and its journal entry are left for recovery.
+	ExpectEq(2, len(t.listDir(dir)))
+	contents, err := os.ReadFile(stagedFilePath)
+	AssertEq(nil, err)
+	ExpectEq("taco", string(contents))
+
+	var entry contentcache.StagedWriteEntry
+	contents, err = os.ReadFile(stagedFilePath + ".json")
+	AssertEq(nil, err)
+	AssertEq(nil, json.Unmarshal(contents, &entry))
+	ExpectEq(t.in.Name().GcsObjectName(), entry.ObjectName)
+	ExpectTrue(entry.Closed)
+}
+
+func (t *FileTest) RecordFlushTimeout_ClearedBySync() {
+	dir := t.journalStagedWrites()
+	defer os.RemoveAll(path.Dir(dir))
+
+	err := t.in.Write(t.ctx, []byte("taco"), 0)
+	AssertEq(nil, err)
+	t.in.RecordFlushTimeout()
+
+	err = t.in.Sync(t.ctx)
+	AssertEq(nil, err)
+
+	ExpectFalse(t.in.FlushTimedOut())
+	ExpectEq(0, len(t.listDir(dir)))
+}
+
+func (t *FileTest) RecordOpen_Initially() {
+	// The kernel can't have anything cached for a new inode.
+	ExpectTrue(t.in.RecordOpen())
+	ExpectTrue(t.in.RecordOpen())
+}
+
+func (t *FileTest) RecordOpen_AfterSync() {
+	AssertTrue(t.in.RecordOpen())
+
+	err := t.in.Write(t.ctx, []byte("p"), 0)
+	AssertEq(nil, err)
+	err = t.in.Sync(t.ctx)
+	AssertEq(nil, err)
+	AssertLt(t.backingObj.Generation, t.in.SourceGeneration().Object)
+
+	// The write went through the kernel, so its page cache is up to date with
+	// the new generation.
+	ExpectTrue(t.in.RecordOpen())
+}
+
+func (t *FileTest) RecordOpen_AfterClobberedSync() {
+	AssertTrue(t.in.RecordOpen())
+
+	err := t.in.Write(t.ctx, []byte("p"), 0)
+	AssertEq(nil, err)
+
+	// Clobber the backing object, then sync.
+	_, err = storageutil.CreateObject(
+		t.ctx,
+		t.bucket,
+		t.in.Name().GcsObjectName(),
+		[]byte("burrito"))
+	AssertEq(nil, err)
+
+	err = t.in.Sync(t.ctx)
+	AssertEq(nil, err)
+
+	// The kernel holds the unsynced write, so the page cache must be dropped on
+	// the next open, but not on the one after that.
+	ExpectFalse(t.in.RecordOpen())
+	ExpectTrue(t.in.RecordOpen())
+}
+
 func (t *FileTest) SetMtime_ContentNotFaultedIn() {
 	var err error
 	var attrs fuseops.InodeAttributes
@@ -842,6 +1165,293 @@ func (t *FileTest) SetMtime_SourceObjectMetaGenerationChanged() {
 	ExpectEq(newObj.MetaGeneration, m.MetaGeneration)
 }
 
+func (t *FileTest) statBackingObject() *gcs.MinObject {
+	statReq := &gcs.StatObjectRequest{Name: t.in.Name().GcsObjectName()}
+	m, _, err := t.bucket.StatObject(t.ctx, statReq)
+
+	AssertEq(nil, err)
+	AssertNe(nil, m)
+	return m
+}
+
+func (t *FileTest) SetTimes_AtimeIgnoredByDefault() {
+	atime := time.Now().UTC().Add(-123 * time.Second)
+
+	err := t.in.SetTimes(t.ctx, &atime, nil)
+	AssertEq(nil, err)
+
+	// Nothing was written, and the atime is still the mtime.
+	m := t.statBackingObject()
+	ExpectEq(t.backingObj.MetaGeneration, m.MetaGeneration)
+	_, ok := m.Metadata[FileAtimeMetadataKey]
+	ExpectFalse(ok)
+
+	attrs, err := t.in.Attributes(t.ctx)
+	AssertEq(nil, err)
+	ExpectThat(attrs.Atime, timeutil.TimeEq(attrs.Mtime))
+}
+
+func (t *FileTest) SetTimes_PreserveAtime_ContentClean() {
+	t.preserveAtime = true
+	t.createInode()
+	atime := time.Now().UTC().Add(-123 * time.Second)
+
+	err := t.in.SetTimes(t.ctx, &atime, nil)
+	AssertEq(nil, err)
+
+	// The atime was persisted, and the mtime left alone.
+	m := t.statBackingObject()
+	ExpectEq(atime.Format(time.RFC3339Nano), m.Metadata[FileAtimeMetadataKey])
+	_, ok := m.Metadata[FileMtimeMetadataKey]
+	ExpectFalse(ok)
+
+	attrs, err := t.in.Attributes(t.ctx)
+	AssertEq(nil, err)
+	ExpectThat(attrs.Atime, timeutil.TimeEq(atime))
+	ExpectThat(attrs.Mtime, timeutil.TimeEq(t.backingObj.Updated))
+}
+
+func (t *FileTest) SetTimes_PreserveAtime_AtimeAndMtime() {
+	t.preserveAtime = true
+	t.createInode()
+	atime := time.Now().UTC().Add(-123 * time.Second)
+	mtime := time.Now().UTC().Add(-456 * time.Second)
+
+	err := t.in.SetTimes(t.ctx, &atime, &mtime)
+	AssertEq(nil, err)
+
+	// Both were persisted with a single update.
+	m := t.statBackingObject()
+	ExpectEq(t.backingObj.MetaGeneration+1, m.MetaGeneration)
+	ExpectEq(atime.Format(time.RFC3339Nano), m.Metadata[FileAtimeMetadataKey])
+	ExpectEq(mtime.Format(time.RFC3339Nano), m.Metadata[FileMtimeMetadataKey])
+
+	attrs, err := t.in.Attributes(t.ctx)
+	AssertEq(nil, err)
+	ExpectThat(attrs.Atime, timeutil.TimeEq(atime))
+	ExpectThat(attrs.Mtime, timeutil.TimeEq(mtime))
+}
+
+func (t *FileTest) SetTimes_PreserveAtime_ContentDirty() {
+	t.preserveAtime = true
+	t.createInode()
+	atime := time.Now().UTC().Add(-123 * time.Second)
+	mtime := time.Now().UTC().Add(-456 * time.Second)
+
+	// Dirty the content, and set the times the way cp -p does before closing.
+	err := t.in.Write(t.ctx, []byte("a"), 0)
+	AssertEq(nil, err)
+	err = t.in.SetTimes(t.ctx, &atime, &mtime)
+	AssertEq(nil, err)
+
+	attrs, err := t.in.Attributes(t.ctx)
+	AssertEq(nil, err)
+	ExpectThat(attrs.Atime, timeutil.TimeEq(atime))
+	ExpectThat(attrs.Mtime, timeutil.TimeEq(mtime))
+
+	// Sync. Both times make it to the new object.
+	err = t.in.Sync(t.ctx)
+	AssertEq(nil, err)
+
+	m := t.statBackingObject()
+	ExpectEq(atime.Format(time.RFC3339Nano), m.Metadata[FileAtimeMetadataKey])
+	ExpectEq(mtime.Format(time.RFC3339Nano), m.Metadata[FileMtimeMetadataKey])
+
+	attrs, err = t.in.Attributes(t.ctx)
+	AssertEq(nil, err)
+	ExpectThat(attrs.Atime, timeutil.TimeEq(atime))
+}
+
+func (t *FileTest) SetTimes_PreserveAtime_MtimeOnly() {
+	t.preserveAtime = true
+	t.createInode()
+	atime := time.Now().UTC().Add(-123 * time.Second)
+	mtime := time.Now().UTC().Add(-456 * time.Second)
+	err := t.in.SetTimes(t.ctx, &atime, nil)
+	AssertEq(nil, err)
+
+	// Like touch -m, which omits the atime.
+	err = t.in.SetTimes(t.ctx, nil, &mtime)
+	AssertEq(nil, err)
+
+	m := t.statBackingObject()
+	ExpectEq(atime.Format(time.RFC3339Nano), m.Metadata[FileAtimeMetadataKey])
+	ExpectEq(mtime.Format(time.RFC3339Nano), m.Metadata[FileMtimeMetadataKey])
+}
+
+func (t *FileTest) SetTimes_Unchanged() {
+	mtime := time.Now().UTC().Add(-123 * time.Second)
+	err := t.in.SetMtime(t.ctx, mtime)
+	AssertEq(nil, err)
+	metaGen := t.statBackingObject().MetaGeneration
+
+	// Setting the same mtime again, as tar and cp -p do, costs no update.
+	err = t.in.SetMtime(t.ctx, mtime)
+	AssertEq(nil, err)
+
+	ExpectEq(metaGen, t.statBackingObject().MetaGeneration)
+}
+
+func (t *FileTest) SetTimes_HeldBack() {
+	t.preserveAtime = true
+	t.timesUpdateDelay = time.Hour
+	t.createInode()
+	atime := time.Now().UTC().Add(-123 * time.Second)
+	mtime := time.Now().UTC().Add(-456 * time.Second)
+
+	// Set the times several times over.
+	for i := 0; i < 3; i++ {
+		earlier := mtime.Add(-time.Duration(3-i) * time.Second)
+		err := t.in.SetTimes(t.ctx, nil, &earlier)
+		AssertEq(nil, err)
+	}
+	err := t.in.SetTimes(t.ctx, &atime, &mtime)
+	AssertEq(nil, err)
+
+	// Nothing has been written yet, but the last times are reported.
+	ExpectEq(t.backingObj.MetaGeneration, t.statBackingObject().MetaGeneration)
+
+	attrs, err := t.in.Attributes(t.ctx)
+	AssertEq(nil, err)
+	ExpectThat(attrs.Atime, timeutil.TimeEq(atime))
+	ExpectThat(attrs.Mtime, timeutil.TimeEq(mtime))
+
+	// Flushing writes the last ones with a single update.
+	err = t.in.FlushPendingTimes(t.ctx)
+	AssertEq(nil, err)
+
+	m := t.statBackingObject()
+	ExpectEq(t.backingObj.MetaGeneration+1, m.MetaGeneration)
+	ExpectEq(atime.Format(time.RFC3339Nano), m.Metadata[FileAtimeMetadataKey])
+	ExpectEq(mtime.Format(time.RFC3339Nano), m.Metadata[FileMtimeMetadataKey])
+
+	attrs, err = t.in.Attributes(t.ctx)
+	AssertEq(nil, err)
+	ExpectThat(attrs.Atime, timeutil.TimeEq(atime))
+	ExpectThat(attrs.Mtime, timeutil.TimeEq(mtime))
+}
+
+func (t *FileTest) SetTimes_HeldBack_WrittenAfterDelay() {
+	t.timesUpdateDelay = time.Millisecond
+	t.createInode()
+	mtime := time.Now().UTC().Add(-123 * time.Second)
+
+	err := t.in.SetMtime(t.ctx, mtime)
+	AssertEq(nil, err)
+
+	// The update happens in the background, which needs the lock.
+	t.in.Unlock()
+	deadline := time.Now().Add(10 * time.Second)
+	for t.statBackingObject().MetaGeneration == t.backingObj.MetaGeneration && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	t.in.Lock()
+
+	m := t.statBackingObject()
+	ExpectEq(t.backingObj.MetaGeneration+1, m.MetaGeneration)
+	ExpectEq(mtime.Format(time.RFC3339Nano), m.Metadata[FileMtimeMetadataKey])
+}
+
+func (t *FileTest) SetTimes_HeldBack_ThenWritten() {
+	t.timesUpdateDelay = time.Hour
+	t.createInode()
+	mtime := time.Now().UTC().Add(-123 * time.Second)
+
+	err := t.in.SetMtime(t.ctx, mtime)
+	AssertEq(nil, err)
+
+	// A later write sets the mtime anew.
+	t.clock.AdvanceTime(time.Second)
+	err = t.in.Write(t.ctx, []byte("a"), 0)
+	AssertEq(nil, err)
+
+	err = t.in.Sync(t.ctx)
+	AssertEq(nil, err)
+
+	m := t.statBackingObject()
+	ExpectNe(t.backingObj.Generation, m.Generation)
+	ExpectEq(t.clock.Now().UTC().Format(time.RFC3339Nano), m.Metadata[FileMtimeMetadataKey])
+
+	attrs, err := t.in.Attributes(t.ctx)
+	AssertEq(nil, err)
+	ExpectTrue(attrs.Mtime.Equal(t.clock.Now()), "%v", attrs.Mtime)
+}
+
+func (t *FileTest) SetTimes_HeldBack_WrittenOnDestroy() {
+	t.timesUpdateDelay = time.Hour
+	t.createInode()
+	mtime := time.Now().UTC().Add(-123 * time.Second)
+
+	err := t.in.SetMtime(t.ctx, mtime)
+	AssertEq(nil, err)
+
+	err = t.in.Destroy()
+	AssertEq(nil, err)
+
+	m := t.statBackingObject()
+	ExpectEq(mtime.Format(time.RFC3339Nano), m.Metadata[FileMtimeMetadataKey])
+}
+
+func (t *FileTest) InitialAttributes_Crtime() {
+	AssertFalse(t.backingObj.Created.IsZero())
+
+	attrs, err := t.in.Attributes(t.ctx)
+
+	AssertEq(nil, err)
+	ExpectThat(attrs.Crtime, timeutil.TimeEq(t.backingObj.Created))
+}
+
+func (t *FileTest) Xattrs_ContentClean() {
+	xattrs := t.in.Xattrs()
+
+	ExpectEq(strconv.FormatInt(t.backingObj.Generation, 10), xattrs[GenerationXattr])
+	ExpectEq("1", xattrs[MetaGenerationXattr])
+	ExpectEq(strconv.FormatInt(t.backingObj.Generation, 10)+".1", xattrs[VersionXattr])
+	ExpectEq(len(XattrNames), len(xattrs))
+}
+
+func (t *FileTest) Xattrs_MetadataUpdate() {
+	before := t.in.Xattrs()
+	mtime := time.Now().UTC().Add(-123 * time.Second)
+
+	AssertEq(nil, t.in.SetMtime(t.ctx, mtime))
+
+	// Only the metageneration, and with it the version, changed.
+	after := t.in.Xattrs()
+	ExpectEq(before[GenerationXattr], after[GenerationXattr])
+	ExpectEq("2", after[MetaGenerationXattr])
+	ExpectNe(before[VersionXattr], after[VersionXattr])
+}
+
+func (t *FileTest) Xattrs_WriteThenSync() {
+	before := t.in.Xattrs()
+	AssertEq(nil, t.in.Write(t.ctx, []byte("p"), 0))
+
+	// Unsynced contents aren't those of any generation.
+	ExpectEq(0, len(t.in.Xattrs()))
+
+	t.clock.AdvanceTime(time.Second)
+	syncTime := t.clock.Now()
+	AssertEq(nil, t.in.Sync(t.ctx))
+
+	m := t.statBackingObject()
+	after := t.in.Xattrs()
+	ExpectNe(before[GenerationXattr], after[GenerationXattr])
+	ExpectEq(strconv.FormatInt(m.Generation, 10), after[GenerationXattr])
+
+	// The birth time is that of the new generation.
+	attrs, err := t.in.Attributes(t.ctx)
+	AssertEq(nil, err)
+	ExpectThat(attrs.Crtime, timeutil.TimeEq(syncTime))
+}
+
+func (t *FileTest) Xattrs_LocalFile() {
+	t.createInodeWithLocalParam("test", true)
+	AssertEq(nil, t.in.CreateEmptyTempFile())
+
+	ExpectEq(0, len(t.in.Xattrs()))
+}
+
 func (t *FileTest) TestSetMtimeForLocalFileShouldUpdateLocalFileAttributes() {
 	var err error
 	var attrs fuseops.InodeAttributes
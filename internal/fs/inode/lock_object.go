@@ -0,0 +1,207 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package inode
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"golang.org/x/net/context"
+)
+
+// LockObjectSuffix is appended to the object name of a file to get the name of
+// the sidecar object that serves as its advisory write lock.
+const LockObjectSuffix = ".gcsfuse.lock"
+
+// LockExpiryMetadataKey is the lock object metadata key holding the time,
+// formatted as time.RFC3339Nano, after which the lock is considered stale and
+// may be broken by another writer.
+const LockExpiryMetadataKey = "gcsfuse_lock_expiry"
+
+// ErrLockHeld is returned by AcquireLock when another writer holds the lock
+// object.
+var ErrLockHeld = errors.New("lock object is held by another writer")
+
+func (f *FileInode) lockObjectName() string {
+	return f.Name().GcsObjectName() + LockObjectSuffix
+}
+
+// Create the lock object, failing with *gcs.PreconditionError if it already
+// exists. The contents identify the holder for humans debugging contention.
+func (f *FileInode) createLockObject(ctx context.Context) (generation int64, err error) {
+	hostname, _ := os.Hostname()
+	var zero int64
+	o, err := f.bucket.CreateObject(ctx, &gcs.CreateObjectRequest{
+		Name:     f.lockObjectName(),
+		Contents: strings.NewReader(fmt.Sprintf("host=%s pid=%d\n", hostname, os.Getpid())),
+		Metadata: map[string]string{
+			LockExpiryMetadataKey: f.mtimeClock.Now().Add(f.lockTTL).UTC().Format(time.RFC3339Nano),
+		},
+		GenerationPrecondition: &zero,
+	})
+	if err != nil {
+		return
+	}
+
+	generation = o.Generation
+	return
+}
+
+// Delete the existing lock object if its TTL has passed, which happens when
+// the holder crashed or didn't release it in time. Return true if there is no
+// longer a lock object in the way.
+func (f *FileInode) breakStaleLock(ctx context.Context) (broken bool, err error) {
+	name := f.lockObjectName()
+	m, _, err := f.bucket.StatObject(ctx, &gcs.StatObjectRequest{
+		Name:              name,
+		ForceFetchFromGcs: true,
+	})
+
+	var notFoundErr *gcs.NotFoundError
+	if errors.As(err, &notFoundErr) {
+		err = nil
+		broken = true
+		return
+	}
+
+	if err != nil {
+		err = fmt.Errorf("StatObject: %w", err)
+		return
+	}
+
+	// Fall back to our own TTL if the expiry is missing or malformed.
+	expiry := m.Updated.Add(f.lockTTL)
+	if s, ok := m.Metadata[LockExpiryMetadataKey]; ok {
+		if t, parseErr := time.Parse(time.RFC3339Nano, s); parseErr == nil {
+			expiry = t
+		}
+	}
+
+	if f.mtimeClock.Now().Before(expiry) {
+		return
+	}
+
+	logger.Warnf("Breaking stale lock object %q (generation %d), which expired at %v",
+		name, m.Generation, expiry.Format(time.RFC3339))
+
+	// Only delete the generation we looked at, so that a lock taken by another
+	// writer in the meantime survives.
+	err = f.bucket.DeleteObject(ctx, &gcs.DeleteObjectRequest{
+		Name:       name,
+		Generation: m.Generation,
+	})
+	if errors.As(err, &notFoundErr) {
+		err = nil
+	}
+
+	if err != nil {
+		err = fmt.Errorf("DeleteObject: %w", err)
+		return
+	}
+
+	broken = true
+	return
+}
+
+// AcquireLock takes the advisory write lock on the file by exclusively
+// creating its lock object, breaking the existing one if it is stale. Lock
+// acquisitions within this inode are counted, so that only the first creates
+// the lock object and only the matching last ReleaseLock deletes it. Return
+// ErrLockHeld if another writer holds the lock. This is a no-op if lock files
+// are disabled.
+//
+// LOCKS_REQUIRED(f.mu)
+func (f *FileInode) AcquireLock(ctx context.Context) (err error) {
+	if f.lockTTL == 0 {
+		return
+	}
+
+	if f.lockHolders > 0 {
+		f.lockHolders++
+		return
+	}
+
+	generation, err := f.createLockObject(ctx)
+
+	var preconditionErr *gcs.PreconditionError
+	if errors.As(err, &preconditionErr) {
+		var broken bool
+		broken, err = f.breakStaleLock(ctx)
+		if err != nil {
+			err = fmt.Errorf("breakStaleLock: %w", err)
+			return
+		}
+
+		if !broken {
+			err = ErrLockHeld
+			return
+		}
+
+		// Another writer may beat us to it after the lock has been broken.
+		generation, err = f.createLockObject(ctx)
+		if errors.As(err, &preconditionErr) {
+			err = ErrLockHeld
+			return
+		}
+	}
+
+	if err != nil {
+		err = fmt.Errorf("createLockObject: %w", err)
+		return
+	}
+
+	f.lockGeneration = generation
+	f.lockHolders = 1
+	return
+}
+
+// ReleaseLock undoes one successful call to AcquireLock, deleting the lock
+// object once there are no holders left.
+//
+// LOCKS_REQUIRED(f.mu)
+func (f *FileInode) ReleaseLock(ctx context.Context) (err error) {
+	if f.lockHolders == 0 {
+		return
+	}
+
+	f.lockHolders--
+	if f.lockHolders > 0 {
+		return
+	}
+
+	// If our lock was broken as stale, the generation no longer exists and
+	// another writer's lock is left alone.
+	err = f.bucket.DeleteObject(ctx, &gcs.DeleteObjectRequest{
+		Name:       f.lockObjectName(),
+		Generation: f.lockGeneration,
+	})
+	f.lockGeneration = 0
+
+	var notFoundErr *gcs.NotFoundError
+	if errors.As(err, &notFoundErr) {
+		err = nil
+	}
+
+	if err != nil {
+		err = fmt.Errorf("DeleteObject: %w", err)
+	}
+
+	return
+}
@@ -0,0 +1,208 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package inode
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/config"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/contentcache"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/gcsx"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	"github.com/jacobsa/fuse/fuseops"
+	. "github.com/jacobsa/ogletest"
+	"github.com/jacobsa/timeutil"
+	"golang.org/x/net/context"
+)
+
+func TestLockObject(t *testing.T) { RunTests(t) }
+
+////////////////////////////////////////////////////////////////////////
+// Boilerplate
+////////////////////////////////////////////////////////////////////////
+
+const lockTTL = time.Minute
+
+type LockObjectTest struct {
+	ctx    context.Context
+	bucket gcs.Bucket
+	clock  timeutil.SimulatedClock
+
+	// Two inodes for the same file, standing in for two writers on different
+	// mounts.
+	in1 *FileInode
+	in2 *FileInode
+}
+
+var _ SetUpInterface = &LockObjectTest{}
+
+func init() { RegisterTestSuite(&LockObjectTest{}) }
+
+func (t *LockObjectTest) SetUp(ti *TestInfo) {
+	t.ctx = ti.Ctx
+	t.clock.SetTime(time.Date(2012, 8, 15, 22, 56, 0, 0, time.Local))
+	t.bucket = fake.NewFakeBucket(&t.clock, "some_bucket")
+
+	o, err := storageutil.CreateObject(t.ctx, t.bucket, fileName, []byte("taco"))
+	AssertEq(nil, err)
+
+	t.in1 = t.createInode(fuseops.InodeID(1), storageutil.ConvertObjToMinObject(o))
+	t.in2 = t.createInode(fuseops.InodeID(2), storageutil.ConvertObjToMinObject(o))
+}
+
+func (t *LockObjectTest) createInode(id fuseops.InodeID, m *gcs.MinObject) *FileInode {
+	syncerBucket := gcsx.NewSyncerBucket(
+		gcsx.SyncerConfig{AppendThreshold: 1, TmpObjectPrefix: ".gcsfuse_tmp/"},
+		t.bucket)
+
+	return NewFileInode(
+		id,
+		NewFileName(NewRootName(""), fileName),
+		m,
+		fuseops.InodeAttributes{},
+		&syncerBucket,
+		false, // localFileCache
+		contentcache.New("", &t.clock),
+		&t.clock,
+		false, // localFile
+		lockTTL,
+		config.DefaultClobberBehavior,
+		false,
+		0)
+}
+
+func (t *LockObjectTest) lockObjectExists() bool {
+	_, _, err := t.bucket.StatObject(t.ctx, &gcs.StatObjectRequest{Name: fileName + LockObjectSuffix})
+	var notFoundErr *gcs.NotFoundError
+	if errors.As(err, &notFoundErr) {
+		return false
+	}
+
+	AssertEq(nil, err)
+	return true
+}
+
+////////////////////////////////////////////////////////////////////////
+// Tests
+////////////////////////////////////////////////////////////////////////
+
+func (t *LockObjectTest) AcquireCreatesLockObject() {
+	err := t.in1.AcquireLock(t.ctx)
+
+	AssertEq(nil, err)
+	ExpectTrue(t.lockObjectExists())
+
+	m, _, err := t.bucket.StatObject(t.ctx, &gcs.StatObjectRequest{Name: fileName + LockObjectSuffix})
+	AssertEq(nil, err)
+	ExpectEq(
+		t.clock.Now().Add(lockTTL).UTC().Format(time.RFC3339Nano),
+		m.Metadata[LockExpiryMetadataKey])
+}
+
+func (t *LockObjectTest) ReleaseDeletesLockObject() {
+	AssertEq(nil, t.in1.AcquireLock(t.ctx))
+
+	err := t.in1.ReleaseLock(t.ctx)
+
+	AssertEq(nil, err)
+	ExpectFalse(t.lockObjectExists())
+}
+
+func (t *LockObjectTest) ReleaseWithoutAcquireIsNoOp() {
+	err := t.in1.ReleaseLock(t.ctx)
+
+	ExpectEq(nil, err)
+}
+
+func (t *LockObjectTest) Contention() {
+	AssertEq(nil, t.in1.AcquireLock(t.ctx))
+
+	err := t.in2.AcquireLock(t.ctx)
+
+	ExpectTrue(errors.Is(err, ErrLockHeld), "err: %v", err)
+}
+
+func (t *LockObjectTest) AcquireAfterRelease() {
+	AssertEq(nil, t.in1.AcquireLock(t.ctx))
+	AssertEq(nil, t.in1.ReleaseLock(t.ctx))
+
+	err := t.in2.AcquireLock(t.ctx)
+
+	ExpectEq(nil, err)
+	ExpectTrue(t.lockObjectExists())
+}
+
+func (t *LockObjectTest) AcquisitionsAreCounted() {
+	AssertEq(nil, t.in1.AcquireLock(t.ctx))
+	AssertEq(nil, t.in1.AcquireLock(t.ctx))
+
+	// The first release leaves the lock in place.
+	AssertEq(nil, t.in1.ReleaseLock(t.ctx))
+	ExpectTrue(t.lockObjectExists())
+	ExpectTrue(errors.Is(t.in2.AcquireLock(t.ctx), ErrLockHeld))
+
+	// The second one deletes it.
+	AssertEq(nil, t.in1.ReleaseLock(t.ctx))
+	ExpectFalse(t.lockObjectExists())
+}
+
+func (t *LockObjectTest) StaleLockIsBroken() {
+	AssertEq(nil, t.in1.AcquireLock(t.ctx))
+
+	// Still valid just before the TTL runs out.
+	t.clock.AdvanceTime(lockTTL - time.Second)
+	AssertTrue(errors.Is(t.in2.AcquireLock(t.ctx), ErrLockHeld))
+
+	t.clock.AdvanceTime(2 * time.Second)
+	err := t.in2.AcquireLock(t.ctx)
+
+	AssertEq(nil, err)
+	ExpectTrue(t.lockObjectExists())
+
+	// The original holder's release must not delete the new lock.
+	AssertEq(nil, t.in1.ReleaseLock(t.ctx))
+	ExpectTrue(t.lockObjectExists())
+	ExpectTrue(errors.Is(t.in1.AcquireLock(t.ctx), ErrLockHeld))
+}
+
+func (t *LockObjectTest) CrashedHolderLeavesLockBehind() {
+	// A lock object left behind by a writer that crashed. It has no expiry
+	// metadata, so its age is taken from the update time.
+	_, err := storageutil.CreateObject(t.ctx, t.bucket, fileName+LockObjectSuffix, []byte{})
+	AssertEq(nil, err)
+
+	AssertTrue(errors.Is(t.in1.AcquireLock(t.ctx), ErrLockHeld))
+
+	t.clock.AdvanceTime(lockTTL + time.Second)
+	err = t.in1.AcquireLock(t.ctx)
+
+	AssertEq(nil, err)
+	AssertEq(nil, t.in1.ReleaseLock(t.ctx))
+	ExpectFalse(t.lockObjectExists())
+}
+
+func (t *LockObjectTest) DisabledWithZeroTTL() {
+	t.in1.lockTTL = 0
+
+	AssertEq(nil, t.in1.AcquireLock(t.ctx))
+	AssertEq(nil, t.in1.AcquireLock(t.ctx))
+
+	ExpectFalse(t.lockObjectExists())
+	ExpectEq(nil, t.in2.AcquireLock(t.ctx))
+}
@@ -17,8 +17,14 @@ package inode
 import (
 	"fmt"
 	"strings"
+	"syscall"
+	"unicode/utf8"
 )
 
+// MaxObjectNameLen is the length in bytes of the longest object name that GCS
+// accepts.
+const MaxObjectNameLen = 1024
+
 // Name is the inode's name that can be interpreted in 2 ways:
 //
 //	(1) LocalName: the name of the inode in the local file system.
@@ -104,6 +110,16 @@ func (name Name) String() string {
 	return name.LocalName()
 }
 
+// ParentName returns the name of the directory containing the inode, which
+// must not be the root of a bucket.
+func (name Name) ParentName() Name {
+	if name.IsBucketRoot() {
+		panic(fmt.Sprintf("The root of bucket %q has no parent", name.bucketName))
+	}
+	o := strings.TrimSuffix(name.objectName, "/")
+	return Name{name.bucketName, o[:strings.LastIndex(o, "/")+1]}
+}
+
 // IsDirectChildOf returns true if the name is a direct child file or directory
 // of another directory.
 func (name Name) IsDirectChildOf(parent Name) bool {
@@ -123,3 +139,19 @@ func (name Name) IsDirectChildOf(parent Name) bool {
 	cleanDiff := strings.TrimSuffix(diff, "/")
 	return !strings.Contains(cleanDiff, "/")
 }
+
+// CheckObjectName fails with ENAMETOOLONG if the object backing the inode
+// would have a name longer than GCS accepts, and with EILSEQ if that name
+// isn't valid UTF-8. prefix is prepended to all object names of the bucket,
+// as with --only-dir.
+func CheckObjectName(prefix string, name Name) error {
+	objectName := prefix + name.objectName
+	if len(objectName) > MaxObjectNameLen {
+		return fmt.Errorf("the object name for %q is %d bytes long, more than %d: %w",
+			name, len(objectName), MaxObjectNameLen, syscall.ENAMETOOLONG)
+	}
+	if !utf8.ValidString(objectName) {
+		return fmt.Errorf("the object name for %q is not valid UTF-8: %w", name, syscall.EILSEQ)
+	}
+	return nil
+}
@@ -15,6 +15,9 @@
 package inode_test
 
 import (
+	"errors"
+	"strings"
+	"syscall"
 	"testing"
 
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/fs/inode"
@@ -90,6 +93,17 @@ func TestName(t *testing.T) {
 	}
 }
 
+func TestParentName(t *testing.T) {
+	root := inode.NewRootName("bucketx")
+	foo := inode.NewDirName(root, "foo")
+	bar := inode.NewDirName(foo, "bar")
+
+	ExpectTrue(root == foo.ParentName())
+	ExpectTrue(foo == bar.ParentName())
+	ExpectTrue(root == inode.NewFileName(root, "baz").ParentName())
+	ExpectTrue(bar == inode.NewFileName(bar, "qux").ParentName())
+}
+
 func TestNameAsMapKey(t *testing.T) {
 	root := inode.NewRootName("bucketx")
 	foo := inode.NewDirName(root, "foo")
@@ -106,3 +120,44 @@ func TestNameAsMapKey(t *testing.T) {
 	_, ok := count[bar]
 	ExpectFalse(ok)
 }
+
+func TestCheckObjectName(t *testing.T) {
+	root := inode.NewRootName("")
+	dir := inode.NewDirName(root, "dir")
+	a := func(n int) string { return strings.Repeat("a", n) }
+
+	testCases := []struct {
+		prefix string
+		name   inode.Name
+		want   error
+	}{
+		// At the boundary.
+		{"", inode.NewFileName(root, a(1024)), nil},
+		{"", inode.NewFileName(root, a(1025)), syscall.ENAMETOOLONG},
+		{"", inode.NewFileName(dir, a(1020)), nil},
+		{"", inode.NewFileName(dir, a(1021)), syscall.ENAMETOOLONG},
+		// Directories take a byte more.
+		{"", inode.NewDirName(root, a(1023)), nil},
+		{"", inode.NewDirName(root, a(1024)), syscall.ENAMETOOLONG},
+		// The prefix of --only-dir counts.
+		{"only/", inode.NewFileName(root, a(1019)), nil},
+		{"only/", inode.NewFileName(root, a(1020)), syscall.ENAMETOOLONG},
+		// Multi-byte runes count with all their bytes.
+		{"", inode.NewFileName(root, a(1022)+"é"), nil},
+		{"", inode.NewFileName(root, a(1023)+"é"), syscall.ENAMETOOLONG},
+		{"", inode.NewFileName(root, a(1021)+"€"), nil},
+		{"", inode.NewFileName(root, a(1022)+"€"), syscall.ENAMETOOLONG},
+		{"", inode.NewFileName(root, a(1023)+"€"), syscall.ENAMETOOLONG},
+		// Invalid UTF-8.
+		{"", inode.NewFileName(root, "foo\xff"), syscall.EILSEQ},
+		{"", inode.NewFileName(root, a(1023)+"\xc3"), syscall.EILSEQ},
+		{"", inode.NewFileName(root, "日本語"), nil},
+	}
+
+	for _, tc := range testCases {
+		err := inode.CheckObjectName(tc.prefix, tc.name)
+		if !errors.Is(err, tc.want) {
+			t.Errorf("CheckObjectName(%q, %q) = %v, want %v", tc.prefix, tc.name, err, tc.want)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package inode
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/gcsx"
+)
+
+// PlanDirRename returns the object-level operations of renaming the directory
+// oldDir, holding the given descendants, to newDir in a bucket without a
+// hierarchical namespace: creating the backing object of newDir, copying the
+// descendants to it, deleting them, and deleting oldDir as PlanDirDelete
+// does, given the name of its compat marker, if any. The descendants are
+// listed in the order of their names.
+func PlanDirRename(
+	oldDir Name,
+	newDir Name,
+	descendants map[Name]*Core,
+	isImplicitDir bool,
+	compatMarker string) *gcsx.MutationPlan {
+	plan := &gcsx.MutationPlan{Operation: "rename_dir", Target: oldDir.LocalName()}
+	plan.Add(gcsx.MutationCreate, newDir.GcsObjectName())
+
+	names := make([]string, 0, len(descendants))
+	for _, descendant := range descendants {
+		names = append(names, descendant.FullName.GcsObjectName())
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		nameDiff := strings.TrimPrefix(name, oldDir.GcsObjectName())
+		plan.Add(gcsx.MutationCopy, newDir.GcsObjectName()+nameDiff, name)
+	}
+	for _, name := range names {
+		plan.Add(gcsx.MutationDelete, name)
+	}
+	addDirDeletion(plan, oldDir, isImplicitDir, compatMarker)
+
+	return plan
+}
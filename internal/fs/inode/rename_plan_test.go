@@ -0,0 +1,85 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package inode_test
+
+import (
+	"testing"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/fs/inode"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/gcsx"
+	. "github.com/jacobsa/oglematchers"
+	. "github.com/jacobsa/ogletest"
+)
+
+func descendantsOf(dir inode.Name, objectNames ...string) map[inode.Name]*inode.Core {
+	descendants := make(map[inode.Name]*inode.Core)
+	for _, objectName := range objectNames {
+		name := inode.NewDescendantName(dir, objectName)
+		descendants[name] = &inode.Core{FullName: name}
+	}
+	return descendants
+}
+
+func TestPlanDirRename(t *testing.T) {
+	root := inode.NewRootName("")
+	oldDir := inode.NewDirName(root, "foo")
+	newDir := inode.NewDirName(root, "bar")
+	descendants := descendantsOf(oldDir, "foo/b", "foo/a/", "foo/a/c")
+
+	plan := inode.PlanDirRename(oldDir, newDir, descendants, false, "")
+
+	ExpectEq("rename_dir", plan.Operation)
+	ExpectEq("foo/", plan.Target)
+	ExpectThat(plan.Steps, DeepEquals([]gcsx.MutationStep{
+		{Op: gcsx.MutationCreate, Object: "bar/"},
+		{Op: gcsx.MutationCopy, Object: "bar/a/", Sources: []string{"foo/a/"}},
+		{Op: gcsx.MutationCopy, Object: "bar/a/c", Sources: []string{"foo/a/c"}},
+		{Op: gcsx.MutationCopy, Object: "bar/b", Sources: []string{"foo/b"}},
+		{Op: gcsx.MutationDelete, Object: "foo/a/"},
+		{Op: gcsx.MutationDelete, Object: "foo/a/c"},
+		{Op: gcsx.MutationDelete, Object: "foo/b"},
+		{Op: gcsx.MutationDelete, Object: "foo/"},
+	}))
+}
+
+func TestPlanDirRename_ImplicitDirHasNoObjectToDelete(t *testing.T) {
+	root := inode.NewRootName("")
+	oldDir := inode.NewDirName(root, "foo")
+	newDir := inode.NewDirName(inode.NewDirName(root, "baz"), "bar")
+
+	plan := inode.PlanDirRename(oldDir, newDir, descendantsOf(oldDir, "foo/a"), true, "")
+
+	ExpectThat(plan.Steps, DeepEquals([]gcsx.MutationStep{
+		{Op: gcsx.MutationCreate, Object: "baz/bar/"},
+		{Op: gcsx.MutationCopy, Object: "baz/bar/a", Sources: []string{"foo/a"}},
+		{Op: gcsx.MutationDelete, Object: "foo/a"},
+	}))
+}
+
+func TestPlanDirRename_CompatMarkerIsDeletedLast(t *testing.T) {
+	root := inode.NewRootName("")
+	oldDir := inode.NewDirName(root, "foo")
+	newDir := inode.NewDirName(root, "bar")
+
+	plan := inode.PlanDirRename(oldDir, newDir, descendantsOf(oldDir, "foo/a"), false, "foo")
+
+	ExpectThat(plan.Steps, DeepEquals([]gcsx.MutationStep{
+		{Op: gcsx.MutationCreate, Object: "bar/"},
+		{Op: gcsx.MutationCopy, Object: "bar/a", Sources: []string{"foo/a"}},
+		{Op: gcsx.MutationDelete, Object: "foo/a"},
+		{Op: gcsx.MutationDelete, Object: "foo/"},
+		{Op: gcsx.MutationDelete, Object: "foo"},
+	}))
+}
@@ -0,0 +1,103 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fs_test
+
+import (
+	"os"
+	"path"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/config"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
+	. "github.com/jacobsa/ogletest"
+	"github.com/jacobsa/timeutil"
+)
+
+////////////////////////////////////////////////////////////////////////
+// Common
+////////////////////////////////////////////////////////////////////////
+
+var readCounter *fake.CountingBucket
+
+type kernelPageCacheTestCommon struct {
+	fsTest
+}
+
+func (t *kernelPageCacheTestCommon) setUpTestSuite(mode string) {
+	readCounter = fake.NewCountingBucket(fake.NewFakeBucket(timeutil.RealClock(), "some_bucket"))
+	bucket = readCounter
+	t.serverCfg.KernelPageCache = mode
+
+	t.fsTest.SetUpTestSuite()
+}
+
+// readTwice creates an object with the given name, reads it through the file
+// system in two separate opens, and returns the number of content requests
+// made by each read.
+func (t *kernelPageCacheTestCommon) readTwice(name string) (first, second int64) {
+	const contents = "taco"
+	AssertEq(nil, t.createWithContents(name, contents))
+
+	for _, n := range []*int64{&first, &second} {
+		before := readCounter.Count("NewReader")
+		b, err := os.ReadFile(path.Join(mntDir, name))
+		AssertEq(nil, err)
+		ExpectEq(contents, string(b))
+		*n = readCounter.Count("NewReader") - before
+	}
+
+	return
+}
+
+////////////////////////////////////////////////////////////////////////
+// Auto
+////////////////////////////////////////////////////////////////////////
+
+type KernelPageCacheAutoTest struct {
+	kernelPageCacheTestCommon
+}
+
+func init() { RegisterTestSuite(&KernelPageCacheAutoTest{}) }
+
+func (t *KernelPageCacheAutoTest) SetUpTestSuite() {
+	t.setUpTestSuite(config.KernelPageCacheAuto)
+}
+
+func (t *KernelPageCacheAutoTest) SecondOpenIsServedFromPageCache() {
+	first, second := t.readTwice("foo")
+
+	ExpectEq(1, first)
+	ExpectEq(0, second)
+}
+
+////////////////////////////////////////////////////////////////////////
+// Never
+////////////////////////////////////////////////////////////////////////
+
+type KernelPageCacheNeverTest struct {
+	kernelPageCacheTestCommon
+}
+
+func init() { RegisterTestSuite(&KernelPageCacheNeverTest{}) }
+
+func (t *KernelPageCacheNeverTest) SetUpTestSuite() {
+	t.setUpTestSuite(config.KernelPageCacheNever)
+}
+
+func (t *KernelPageCacheNeverTest) SecondOpenFetchesContentsAgain() {
+	first, second := t.readTwice("foo")
+
+	ExpectEq(1, first)
+	ExpectEq(1, second)
+}
@@ -0,0 +1,435 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fs
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/gcsx"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/lifecycle"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/mount"
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/fuseutil"
+)
+
+// lazyFileSystem is a file system that is created by its first operation, so
+// that mounting doesn't wait for the storage client to be created and the
+// bucket to be probed.
+type lazyFileSystem struct {
+	/////////////////////////
+	// Constant data
+	/////////////////////////
+
+	// The config to create the file system with, but for its bucket manager.
+	cfg *ServerConfig
+
+	newBucketManager func() (gcsx.BucketManager, error)
+
+	/////////////////////////
+	// Mutable state
+	/////////////////////////
+
+	// The file system, once created.
+	wrapped atomic.Value
+
+	// Held while creating the file system, so that only one operation does.
+	mu sync.Mutex
+
+	// The error that creating the file system failed with, if retrying can't
+	// fix it.
+	//
+	// GUARDED_BY(mu)
+	err error
+}
+
+func newLazyFileSystem(
+	cfg *ServerConfig,
+	newBucketManager func() (gcsx.BucketManager, error)) *lazyFileSystem {
+	return &lazyFileSystem{
+		cfg:              cfg,
+		newBucketManager: newBucketManager,
+	}
+}
+
+// created returns the file system if an operation has created it.
+func (fs *lazyFileSystem) created() (wrapped fuseutil.FileSystem, ok bool) {
+	wrapped, ok = fs.wrapped.Load().(fuseutil.FileSystem)
+	return
+}
+
+// get returns the file system, creating it if no operation has yet. Creating
+// it is tried again by the next operation if it failed with a transient error,
+// while other errors are returned to every operation from then on.
+//
+// LOCKS_EXCLUDED(fs.mu)
+func (fs *lazyFileSystem) get(ctx context.Context) (fuseutil.FileSystem, error) {
+	if wrapped, ok := fs.created(); ok {
+		return wrapped, nil
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if wrapped, ok := fs.created(); ok {
+		return wrapped, nil
+	}
+	if fs.err != nil {
+		return nil, fs.err
+	}
+
+	// The file system outlives the operation, which may be interrupted.
+	logger.Infof("Setting up the lazily mounted file system for its first operation...")
+	wrapped, err := fs.create(context.WithoutCancel(ctx))
+	lifecycle.Publish(lifecycle.Initialized, err)
+	if err != nil {
+		err = fmt.Errorf("set up lazily mounted file system: %w", err)
+		if mount.IsTransientMountError(err) {
+			logger.Warnf("%v; retrying on the next operation", err)
+		} else {
+			logger.Errorf("%v", err)
+			fs.err = err
+		}
+		return nil, err
+	}
+
+	fs.wrapped.Store(wrapped)
+	return wrapped, nil
+}
+
+func (fs *lazyFileSystem) create(ctx context.Context) (fuseutil.FileSystem, error) {
+	bm, err := fs.newBucketManager()
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := *fs.cfg
+	cfg.BucketManager = bm
+	wrapped, err := NewFileSystem(ctx, &cfg)
+	if err != nil {
+		bm.ShutDown()
+		return nil, err
+	}
+	return wrapped, nil
+}
+
+func (fs *lazyFileSystem) Destroy() {
+	if wrapped, ok := fs.created(); ok {
+		wrapped.Destroy()
+	}
+}
+
+// StatFS doesn't depend on the bucket, so it doesn't create the file system,
+// and neither does stat -f of the mount point.
+func (fs *lazyFileSystem) StatFS(
+	ctx context.Context,
+	op *fuseops.StatFSOp) error {
+	statFS(op)
+	return nil
+}
+
+func (fs *lazyFileSystem) LookUpInode(
+	ctx context.Context,
+	op *fuseops.LookUpInodeOp) error {
+	wrapped, err := fs.get(ctx)
+	if err != nil {
+		return err
+	}
+	return wrapped.LookUpInode(ctx, op)
+}
+
+func (fs *lazyFileSystem) GetInodeAttributes(
+	ctx context.Context,
+	op *fuseops.GetInodeAttributesOp) error {
+	wrapped, err := fs.get(ctx)
+	if err != nil {
+		return err
+	}
+	return wrapped.GetInodeAttributes(ctx, op)
+}
+
+func (fs *lazyFileSystem) SetInodeAttributes(
+	ctx context.Context,
+	op *fuseops.SetInodeAttributesOp) error {
+	wrapped, err := fs.get(ctx)
+	if err != nil {
+		return err
+	}
+	return wrapped.SetInodeAttributes(ctx, op)
+}
+
+// Inodes are only looked up once the file system has been created.
+func (fs *lazyFileSystem) ForgetInode(
+	ctx context.Context,
+	op *fuseops.ForgetInodeOp) error {
+	wrapped, ok := fs.created()
+	if !ok {
+		return nil
+	}
+	return wrapped.ForgetInode(ctx, op)
+}
+
+func (fs *lazyFileSystem) BatchForget(
+	ctx context.Context,
+	op *fuseops.BatchForgetOp) error {
+	wrapped, ok := fs.created()
+	if !ok {
+		return nil
+	}
+	return wrapped.BatchForget(ctx, op)
+}
+
+func (fs *lazyFileSystem) MkDir(
+	ctx context.Context,
+	op *fuseops.MkDirOp) error {
+	wrapped, err := fs.get(ctx)
+	if err != nil {
+		return err
+	}
+	return wrapped.MkDir(ctx, op)
+}
+
+func (fs *lazyFileSystem) MkNode(
+	ctx context.Context,
+	op *fuseops.MkNodeOp) error {
+	wrapped, err := fs.get(ctx)
+	if err != nil {
+		return err
+	}
+	return wrapped.MkNode(ctx, op)
+}
+
+func (fs *lazyFileSystem) CreateFile(
+	ctx context.Context,
+	op *fuseops.CreateFileOp) error {
+	wrapped, err := fs.get(ctx)
+	if err != nil {
+		return err
+	}
+	return wrapped.CreateFile(ctx, op)
+}
+
+func (fs *lazyFileSystem) CreateLink(
+	ctx context.Context,
+	op *fuseops.CreateLinkOp) error {
+	wrapped, err := fs.get(ctx)
+	if err != nil {
+		return err
+	}
+	return wrapped.CreateLink(ctx, op)
+}
+
+func (fs *lazyFileSystem) CreateSymlink(
+	ctx context.Context,
+	op *fuseops.CreateSymlinkOp) error {
+	wrapped, err := fs.get(ctx)
+	if err != nil {
+		return err
+	}
+	return wrapped.CreateSymlink(ctx, op)
+}
+
+func (fs *lazyFileSystem) Rename(
+	ctx context.Context,
+	op *fuseops.RenameOp) error {
+	wrapped, err := fs.get(ctx)
+	if err != nil {
+		return err
+	}
+	return wrapped.Rename(ctx, op)
+}
+
+func (fs *lazyFileSystem) RmDir(
+	ctx context.Context,
+	op *fuseops.RmDirOp) error {
+	wrapped, err := fs.get(ctx)
+	if err != nil {
+		return err
+	}
+	return wrapped.RmDir(ctx, op)
+}
+
+func (fs *lazyFileSystem) Unlink(
+	ctx context.Context,
+	op *fuseops.UnlinkOp) error {
+	wrapped, err := fs.get(ctx)
+	if err != nil {
+		return err
+	}
+	return wrapped.Unlink(ctx, op)
+}
+
+func (fs *lazyFileSystem) OpenDir(
+	ctx context.Context,
+	op *fuseops.OpenDirOp) error {
+	wrapped, err := fs.get(ctx)
+	if err != nil {
+		return err
+	}
+	return wrapped.OpenDir(ctx, op)
+}
+
+func (fs *lazyFileSystem) ReadDir(
+	ctx context.Context,
+	op *fuseops.ReadDirOp) error {
+	wrapped, err := fs.get(ctx)
+	if err != nil {
+		return err
+	}
+	return wrapped.ReadDir(ctx, op)
+}
+
+func (fs *lazyFileSystem) ReleaseDirHandle(
+	ctx context.Context,
+	op *fuseops.ReleaseDirHandleOp) error {
+	wrapped, err := fs.get(ctx)
+	if err != nil {
+		return err
+	}
+	return wrapped.ReleaseDirHandle(ctx, op)
+}
+
+func (fs *lazyFileSystem) OpenFile(
+	ctx context.Context,
+	op *fuseops.OpenFileOp) error {
+	wrapped, err := fs.get(ctx)
+	if err != nil {
+		return err
+	}
+	return wrapped.OpenFile(ctx, op)
+}
+
+func (fs *lazyFileSystem) ReadFile(
+	ctx context.Context,
+	op *fuseops.ReadFileOp) error {
+	wrapped, err := fs.get(ctx)
+	if err != nil {
+		return err
+	}
+	return wrapped.ReadFile(ctx, op)
+}
+
+func (fs *lazyFileSystem) WriteFile(
+	ctx context.Context,
+	op *fuseops.WriteFileOp) error {
+	wrapped, err := fs.get(ctx)
+	if err != nil {
+		return err
+	}
+	return wrapped.WriteFile(ctx, op)
+}
+
+func (fs *lazyFileSystem) SyncFile(
+	ctx context.Context,
+	op *fuseops.SyncFileOp) error {
+	wrapped, err := fs.get(ctx)
+	if err != nil {
+		return err
+	}
+	return wrapped.SyncFile(ctx, op)
+}
+
+func (fs *lazyFileSystem) FlushFile(
+	ctx context.Context,
+	op *fuseops.FlushFileOp) error {
+	wrapped, err := fs.get(ctx)
+	if err != nil {
+		return err
+	}
+	return wrapped.FlushFile(ctx, op)
+}
+
+func (fs *lazyFileSystem) ReleaseFileHandle(
+	ctx context.Context,
+	op *fuseops.ReleaseFileHandleOp) error {
+	wrapped, err := fs.get(ctx)
+	if err != nil {
+		return err
+	}
+	return wrapped.ReleaseFileHandle(ctx, op)
+}
+
+func (fs *lazyFileSystem) ReadSymlink(
+	ctx context.Context,
+	op *fuseops.ReadSymlinkOp) error {
+	wrapped, err := fs.get(ctx)
+	if err != nil {
+		return err
+	}
+	return wrapped.ReadSymlink(ctx, op)
+}
+
+func (fs *lazyFileSystem) RemoveXattr(
+	ctx context.Context,
+	op *fuseops.RemoveXattrOp) error {
+	wrapped, err := fs.get(ctx)
+	if err != nil {
+		return err
+	}
+	return wrapped.RemoveXattr(ctx, op)
+}
+
+func (fs *lazyFileSystem) GetXattr(
+	ctx context.Context,
+	op *fuseops.GetXattrOp) error {
+	wrapped, err := fs.get(ctx)
+	if err != nil {
+		return err
+	}
+	return wrapped.GetXattr(ctx, op)
+}
+
+func (fs *lazyFileSystem) ListXattr(
+	ctx context.Context,
+	op *fuseops.ListXattrOp) error {
+	wrapped, err := fs.get(ctx)
+	if err != nil {
+		return err
+	}
+	return wrapped.ListXattr(ctx, op)
+}
+
+func (fs *lazyFileSystem) SetXattr(
+	ctx context.Context,
+	op *fuseops.SetXattrOp) error {
+	wrapped, err := fs.get(ctx)
+	if err != nil {
+		return err
+	}
+	return wrapped.SetXattr(ctx, op)
+}
+
+func (fs *lazyFileSystem) Fallocate(
+	ctx context.Context,
+	op *fuseops.FallocateOp) error {
+	wrapped, err := fs.get(ctx)
+	if err != nil {
+		return err
+	}
+	return wrapped.Fallocate(ctx, op)
+}
+
+func (fs *lazyFileSystem) CopyFileRange(
+	ctx context.Context,
+	op *fuseops.CopyFileRangeOp) error {
+	wrapped, err := fs.get(ctx)
+	if err != nil {
+		return err
+	}
+	return wrapped.CopyFileRange(ctx, op)
+}
@@ -0,0 +1,211 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// A file system mounted with --lazy-init, which only creates its storage
+// client and probes its bucket on the first operation.
+
+package fs_test
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path"
+	"sync"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/config"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/fs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/gcsx"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/lifecycle"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/perms"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage"
+	"github.com/jacobsa/fuse"
+	. "github.com/jacobsa/oglematchers"
+	. "github.com/jacobsa/ogletest"
+	"github.com/jacobsa/timeutil"
+)
+
+////////////////////////////////////////////////////////////////////////
+// Boilerplate
+////////////////////////////////////////////////////////////////////////
+
+type LazyInitTest struct {
+	fakeStorage storage.FakeStorage
+	mntDir      string
+	mfs         *fuse.MountedFileSystem
+
+	// The number of bucket managers created, i.e. of storage handles asked
+	// for.
+	bucketManagers atomic.Int32
+
+	// Returned instead of the storage handle while non-empty, first to last.
+	storageErrs []error
+
+	// The lifecycle events published.
+	eventsMu    sync.Mutex
+	events      []lifecycle.Event
+	unsubscribe func()
+}
+
+var _ SetUpInterface = &LazyInitTest{}
+var _ TearDownInterface = &LazyInitTest{}
+
+func init() { RegisterTestSuite(&LazyInitTest{}) }
+
+func (t *LazyInitTest) SetUp(ti *TestInfo) {
+	var err error
+	t.fakeStorage = storage.NewFakeStorage()
+	t.mntDir, err = os.MkdirTemp("", "fs_test")
+	AssertEq(nil, err)
+
+	t.unsubscribe = lifecycle.Subscribe(func(e lifecycle.Event) {
+		t.eventsMu.Lock()
+		defer t.eventsMu.Unlock()
+		t.events = append(t.events, e)
+	})
+}
+
+func (t *LazyInitTest) TearDown() {
+	if t.mfs != nil {
+		AssertEq(nil, fuse.Unmount(t.mntDir))
+		AssertEq(nil, t.mfs.Join(ctx))
+	}
+	t.unsubscribe()
+	t.fakeStorage.ShutDown()
+	os.Remove(t.mntDir)
+}
+
+func (t *LazyInitTest) newBucketManager() (gcsx.BucketManager, error) {
+	t.bucketManagers.Add(1)
+	if len(t.storageErrs) > 0 {
+		err := t.storageErrs[0]
+		t.storageErrs = t.storageErrs[1:]
+		return nil, err
+	}
+
+	return gcsx.NewBucketManager(gcsx.BucketConfig{
+		TmpObjectPrefix: ".gcsfuse_tmp/",
+	}, t.fakeStorage.CreateStorageHandle()), nil
+}
+
+// mount mounts bucketName of the fake storage lazily.
+func (t *LazyInitTest) mount(bucketName string) {
+	serverCfg := &fs.ServerConfig{
+		CacheClock:           timeutil.RealClock(),
+		BucketName:           bucketName,
+		FilePerms:            filePerms,
+		DirPerms:             dirPerms,
+		SequentialReadSizeMb: SequentialReadSizeMb,
+		MountConfig:          config.NewMountConfig(),
+	}
+
+	var err error
+	serverCfg.Uid, serverCfg.Gid, err = perms.MyUserAndGroup()
+	AssertEq(nil, err)
+
+	server := fs.NewLazyServer(serverCfg, t.newBucketManager)
+	t.mfs, err = fuse.Mount(t.mntDir, server, &fuse.MountConfig{
+		FSName:    bucketName,
+		OpContext: ctx,
+	})
+	AssertEq(nil, err)
+}
+
+// initializedEvents returns the errors of the Initialized events published,
+// with "" for success.
+func (t *LazyInitTest) initializedEvents() (errs []string) {
+	t.eventsMu.Lock()
+	defer t.eventsMu.Unlock()
+
+	for _, e := range t.events {
+		if e.Name == lifecycle.Initialized {
+			errs = append(errs, e.Error)
+		}
+	}
+	return
+}
+
+////////////////////////////////////////////////////////////////////////
+// Tests
+////////////////////////////////////////////////////////////////////////
+
+func (t *LazyInitTest) NothingIsSetUpBeforeTheFirstOperation() {
+	t.mount(storage.TestBucketName)
+
+	// Nor by stat -f of the mount point.
+	var st syscall.Statfs_t
+	AssertEq(nil, syscall.Statfs(t.mntDir, &st))
+
+	ExpectEq(0, t.bucketManagers.Load())
+	ExpectEq(0, len(t.initializedEvents()))
+}
+
+func (t *LazyInitTest) ConcurrentFirstOperationsSetUpOnce() {
+	t.mount(storage.TestBucketName)
+
+	var wg sync.WaitGroup
+	errs := make([]error, 8)
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var contents []byte
+			contents, errs[i] = os.ReadFile(path.Join(t.mntDir, storage.TestObjectName))
+			if errs[i] == nil && string(contents) != storage.ContentInTestObject {
+				errs[i] = errors.New("unexpected contents: " + string(contents))
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		ExpectEq(nil, err)
+	}
+	ExpectEq(1, t.bucketManagers.Load())
+	ExpectThat(t.initializedEvents(), ElementsAre(""))
+}
+
+func (t *LazyInitTest) MissingBucketFailsOperationsNotTheMount() {
+	t.mount("missing_bucket")
+
+	_, err := os.Stat(path.Join(t.mntDir, "foo"))
+	ExpectTrue(errors.Is(err, syscall.EIO), "err: %v", err)
+	_, err = os.ReadDir(t.mntDir)
+	ExpectTrue(errors.Is(err, syscall.EIO), "err: %v", err)
+
+	// Not being transient, the error is kept rather than found again.
+	ExpectEq(1, t.bucketManagers.Load())
+	events := t.initializedEvents()
+	AssertEq(1, len(events))
+	ExpectNe("", events[0])
+}
+
+func (t *LazyInitTest) TransientFailureIsRetriedByTheNextOperation() {
+	t.storageErrs = []error{&net.DNSError{Err: "no such host", Name: "storage.googleapis.com", IsTemporary: true}}
+	t.mount(storage.TestBucketName)
+
+	_, err := os.Stat(path.Join(t.mntDir, storage.TestObjectName))
+	ExpectTrue(errors.Is(err, syscall.EIO), "err: %v", err)
+
+	_, err = os.Stat(path.Join(t.mntDir, storage.TestObjectName))
+	ExpectEq(nil, err)
+
+	ExpectEq(2, t.bucketManagers.Load())
+	events := t.initializedEvents()
+	AssertEq(2, len(events))
+	ExpectNe("", events[0])
+	ExpectEq("", events[1])
+}
@@ -0,0 +1,182 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fs_test
+
+import (
+	"os"
+	"path"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/metadata"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/config"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/mount"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/caching"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
+	"github.com/jacobsa/fuse/fusetesting"
+	. "github.com/jacobsa/oglematchers"
+	. "github.com/jacobsa/ogletest"
+	"github.com/jacobsa/timeutil"
+)
+
+// ListAfterMutationTest checks that a local change to a directory shows up in
+// the next listing of it, with the stat, type and kernel list caches enabled
+// and holding on to what they knew before the change.
+type ListAfterMutationTest struct {
+	fsTest
+}
+
+func init() {
+	RegisterTestSuite(&ListAfterMutationTest{})
+}
+
+func (t *ListAfterMutationTest) SetUpTestSuite() {
+	lruCache := newLruCache(uint64(1000 * mount.AverageSizeOfPositiveStatCacheEntry))
+	bucket = caching.NewFastStatBucket(
+		metadata.SameEntryTTLs(ttl),
+		metadata.CacheControlTTL{},
+		nil,
+		metadata.NewStatCacheBucketView(lruCache, ""),
+		&cacheClock,
+		fake.NewFakeBucket(timeutil.RealClock(), "some_bucket"))
+
+	t.serverCfg.DirTypeCacheTTLs = metadata.SameEntryTTLs(ttl)
+	t.serverCfg.InodeAttributeCacheTTLs = metadata.SameEntryTTLs(ttl)
+	t.serverCfg.EnableNonexistentTypeCache = true
+	t.serverCfg.MountConfig = config.NewMountConfig()
+	t.serverCfg.MountConfig.KernelListCacheTtlSeconds = int64(ttl.Seconds())
+
+	t.fsTest.SetUpTestSuite()
+}
+
+////////////////////////////////////////////////////////////////////////
+// Helpers
+////////////////////////////////////////////////////////////////////////
+
+// cacheListingAndAbsence lists the mount and stats the given name, which must
+// not exist, so that the listing and the absence of the name are cached.
+func (t *ListAfterMutationTest) cacheListingAndAbsence(name string) {
+	_, err := fusetesting.ReadDirPicky(mntDir)
+	AssertEq(nil, err)
+
+	_, err = os.Stat(path.Join(mntDir, name))
+	AssertTrue(os.IsNotExist(err), "err: %v", err)
+}
+
+// listedNames lists the mount.
+func (t *ListAfterMutationTest) listedNames() (names []string) {
+	entries, err := fusetesting.ReadDirPicky(mntDir)
+	AssertEq(nil, err)
+
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	return
+}
+
+////////////////////////////////////////////////////////////////////////
+// Tests
+////////////////////////////////////////////////////////////////////////
+
+func (t *ListAfterMutationTest) CreateThenList() {
+	t.cacheListingAndAbsence("foo")
+
+	err := os.WriteFile(path.Join(mntDir, "foo"), []byte("taco"), 0600)
+
+	AssertEq(nil, err)
+	ExpectThat(t.listedNames(), ElementsAre("foo"))
+	fi, err := os.Stat(path.Join(mntDir, "foo"))
+	AssertEq(nil, err)
+	ExpectEq(len("taco"), fi.Size())
+}
+
+func (t *ListAfterMutationTest) CreateLocalFileThenList() {
+	t.cacheListingAndAbsence("foo")
+
+	f, err := os.Create(path.Join(mntDir, "foo"))
+	AssertEq(nil, err)
+	defer func() { AssertEq(nil, f.Close()) }()
+
+	ExpectThat(t.listedNames(), ElementsAre("foo"))
+}
+
+func (t *ListAfterMutationTest) MkdirThenList() {
+	t.cacheListingAndAbsence("foo")
+
+	err := os.Mkdir(path.Join(mntDir, "foo"), 0700)
+
+	AssertEq(nil, err)
+	ExpectThat(t.listedNames(), ElementsAre("foo"))
+}
+
+func (t *ListAfterMutationTest) SymlinkThenList() {
+	t.cacheListingAndAbsence("foo")
+
+	err := os.Symlink("bar", path.Join(mntDir, "foo"))
+
+	AssertEq(nil, err)
+	ExpectThat(t.listedNames(), ElementsAre("foo"))
+}
+
+func (t *ListAfterMutationTest) UnlinkThenList() {
+	err := os.WriteFile(path.Join(mntDir, "foo"), []byte("taco"), 0600)
+	AssertEq(nil, err)
+	AssertThat(t.listedNames(), ElementsAre("foo"))
+
+	err = os.Remove(path.Join(mntDir, "foo"))
+
+	AssertEq(nil, err)
+	ExpectThat(t.listedNames(), ElementsAre())
+	_, err = os.Stat(path.Join(mntDir, "foo"))
+	ExpectTrue(os.IsNotExist(err), "err: %v", err)
+}
+
+func (t *ListAfterMutationTest) UnlinkLocalFileThenList() {
+	f, err := os.Create(path.Join(mntDir, "foo"))
+	AssertEq(nil, err)
+	defer func() { AssertEq(nil, f.Close()) }()
+	AssertThat(t.listedNames(), ElementsAre("foo"))
+
+	err = os.Remove(path.Join(mntDir, "foo"))
+
+	AssertEq(nil, err)
+	ExpectThat(t.listedNames(), ElementsAre())
+}
+
+func (t *ListAfterMutationTest) RmdirThenList() {
+	err := os.Mkdir(path.Join(mntDir, "foo"), 0700)
+	AssertEq(nil, err)
+	AssertThat(t.listedNames(), ElementsAre("foo"))
+
+	err = os.Remove(path.Join(mntDir, "foo"))
+
+	AssertEq(nil, err)
+	ExpectThat(t.listedNames(), ElementsAre())
+	_, err = os.Stat(path.Join(mntDir, "foo"))
+	ExpectTrue(os.IsNotExist(err), "err: %v", err)
+}
+
+func (t *ListAfterMutationTest) RenameThenList() {
+	err := os.WriteFile(path.Join(mntDir, "foo"), []byte("taco"), 0600)
+	AssertEq(nil, err)
+	t.cacheListingAndAbsence("bar")
+	AssertThat(t.listedNames(), ElementsAre("foo"))
+
+	err = os.Rename(path.Join(mntDir, "foo"), path.Join(mntDir, "bar"))
+
+	AssertEq(nil, err)
+	ExpectThat(t.listedNames(), ElementsAre("bar"))
+	fi, err := os.Stat(path.Join(mntDir, "bar"))
+	AssertEq(nil, err)
+	ExpectEq(len("taco"), fi.Size())
+}
@@ -1643,6 +1643,93 @@ func (t *FileTest) ReadsPastEndOfFile() {
 	ExpectEq("", string(buf[:n]))
 }
 
+func (t *FileTest) ReadDirtyFileThroughOtherHandle() {
+	var err error
+	var n int
+	buf := make([]byte, 1024)
+
+	// Create an object, and read it through a handle.
+	AssertEq(nil, t.createWithContents("foo", "taco"))
+	t.f1, err = os.Open(path.Join(mntDir, "foo"))
+	AssertEq(nil, err)
+
+	n, err = t.f1.ReadAt(buf, 0)
+	AssertEq(io.EOF, err)
+	ExpectEq("taco", string(buf[:n]))
+
+	// Modify it through another handle, without flushing.
+	t.f2, err = os.OpenFile(path.Join(mntDir, "foo"), os.O_WRONLY, 0)
+	AssertEq(nil, err)
+
+	_, err = t.f2.WriteAt([]byte("burrito"), 2)
+	AssertEq(nil, err)
+
+	// The first handle should see the modification, and so should stat.
+	n, err = t.f1.ReadAt(buf, 0)
+	AssertEq(io.EOF, err)
+	ExpectEq("taburrito", string(buf[:n]))
+
+	fi, err := t.f1.Stat()
+	AssertEq(nil, err)
+	ExpectEq(len("taburrito"), fi.Size())
+}
+
+func (t *FileTest) TailFileWhileAppendingThroughOtherHandle() {
+	const chunks = 200
+	chunk := func(i int) string { return fmt.Sprintf("chunk %04d\n", i) }
+	var err error
+
+	// Create an object, and open it for appending and for reading.
+	AssertEq(nil, t.createWithContents("foo", ""))
+	t.f1, err = os.OpenFile(path.Join(mntDir, "foo"), os.O_WRONLY|os.O_APPEND, 0)
+	AssertEq(nil, err)
+	t.f2, err = os.Open(path.Join(mntDir, "foo"))
+	AssertEq(nil, err)
+
+	// Append from one goroutine, syncing now and then so that the object moves
+	// through generations...
+	var expected strings.Builder
+	for i := 0; i < chunks; i++ {
+		expected.WriteString(chunk(i))
+	}
+
+	writeErr := make(chan error, 1)
+	go func() {
+		for i := 0; i < chunks; i++ {
+			if _, err := t.f1.WriteString(chunk(i)); err != nil {
+				writeErr <- err
+				return
+			}
+			if i%50 == 49 {
+				if err := t.f1.Sync(); err != nil {
+					writeErr <- err
+					return
+				}
+			}
+		}
+		writeErr <- nil
+	}()
+
+	// ...while tailing it from another, which must only ever see what was
+	// appended.
+	var tailed []byte
+	buf := make([]byte, 64)
+	deadline := time.Now().Add(time.Minute)
+	for len(tailed) < expected.Len() && time.Now().Before(deadline) {
+		n, err := t.f2.ReadAt(buf, int64(len(tailed)))
+		if err != nil && err != io.EOF {
+			AddFailure("ReadAt: %v", err)
+			break
+		}
+
+		tailed = append(tailed, buf[:n]...)
+		AssertTrue(strings.HasPrefix(expected.String(), string(tailed)), "%q", tailed)
+	}
+
+	AssertEq(nil, <-writeErr)
+	ExpectEq(expected.String(), string(tailed))
+}
+
 func (t *FileTest) Truncate_Smaller() {
 	var err error
 	fileName := path.Join(mntDir, "foo")
@@ -2766,6 +2853,89 @@ func (t *RenameTest) OverExisting_WrongType() {
 	ExpectThat(err, Error(HasSubstr("not a directory")))
 }
 
+func (t *RenameTest) PosixErrors() {
+	testCases := []struct {
+		name     string
+		objects  []string
+		oldName  string
+		newName  string
+		expected syscall.Errno
+	}{
+		{
+			name:     "source missing",
+			objects:  []string{"dir/"},
+			oldName:  "foo",
+			newName:  "bar",
+			expected: syscall.ENOENT,
+		},
+		{
+			name:     "directory over non-empty directory",
+			objects:  []string{"dir/", "dir/foo", "other/", "other/bar"},
+			oldName:  "dir",
+			newName:  "other",
+			expected: syscall.ENOTEMPTY,
+		},
+		{
+			name:     "directory over file",
+			objects:  []string{"dir/", "dir/foo", "bar"},
+			oldName:  "dir",
+			newName:  "bar",
+			expected: syscall.ENOTDIR,
+		},
+		{
+			name:     "file over non-empty directory",
+			objects:  []string{"foo", "dir/", "dir/bar"},
+			oldName:  "foo",
+			newName:  "dir",
+			expected: syscall.EISDIR,
+		},
+		{
+			name:     "file over empty directory",
+			objects:  []string{"foo", "dir/"},
+			oldName:  "foo",
+			newName:  "dir",
+			expected: syscall.EISDIR,
+		},
+		{
+			name:     "directory into its own subdirectory",
+			objects:  []string{"dir/", "dir/sub/", "dir/sub/foo"},
+			oldName:  "dir",
+			newName:  "dir/sub/dir",
+			expected: syscall.EINVAL,
+		},
+	}
+
+	for i, tc := range testCases {
+		// Give each case a directory of its own.
+		prefix := fmt.Sprintf("case%d/", i)
+		objects := map[string][]byte{prefix: nil}
+		for _, name := range tc.objects {
+			objects[prefix+name] = nil
+			if !strings.HasSuffix(name, "/") {
+				objects[prefix+name] = []byte("taco")
+			}
+		}
+		AssertEq(nil, storageutil.CreateObjects(ctx, bucket, objects))
+
+		// os.Rename reports EEXIST by itself for any directory destination, so
+		// call rename(2) directly to see the errno from the file system.
+		err := syscall.Rename(
+			path.Join(mntDir, prefix, tc.oldName),
+			path.Join(mntDir, prefix, tc.newName))
+
+		ExpectTrue(errors.Is(err, tc.expected), "%s: %v", tc.name, err)
+
+		// Nothing in the bucket should have changed.
+		listing, _, err := storageutil.ListAll(ctx, bucket, &gcs.ListObjectsRequest{Prefix: prefix})
+		AssertEq(nil, err)
+		ExpectEq(len(objects), len(listing), "%s", tc.name)
+		for _, o := range listing {
+			_, ok := objects[o.Name]
+			ExpectTrue(ok, "%s: unexpected object %q", tc.name, o.Name)
+		}
+	}
+}
+
 func (t *RenameTest) NonExistentFile() {
 	var err error
 
@@ -0,0 +1,142 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// A test for the lock ordering between inodes and the file system, calling
+// the file system directly from goroutines racing each other.
+
+package fs_test
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/config"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/fs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/locker"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/fuseutil"
+	. "github.com/jacobsa/ogletest"
+	"github.com/jacobsa/timeutil"
+)
+
+type LockOrderTest struct {
+	ctx context.Context
+	fs  fuseutil.FileSystem
+
+	// Set when the file system deadlocked, and can't be destroyed.
+	deadlocked bool
+}
+
+func init() { RegisterTestSuite(&LockOrderTest{}) }
+
+func (t *LockOrderTest) SetUp(ti *TestInfo) {
+	locker.EnableInvariantsCheck()
+	t.ctx = ti.Ctx
+
+	bucket := fake.NewFakeBucket(timeutil.RealClock(), "some_bucket")
+	AssertEq(nil, storageutil.CreateEmptyObjects(t.ctx, bucket, []string{"dir/", "dir/foo"}))
+
+	mountConfig := config.NewMountConfig()
+	mountConfig.KernelListCacheTtlSeconds = 60
+
+	var err error
+	t.fs, err = fs.NewFileSystem(t.ctx, &fs.ServerConfig{
+		CacheClock: timeutil.RealClock(),
+		BucketName: bucket.Name(),
+		BucketManager: &fakeBucketManager{
+			buckets:         map[string]gcs.Bucket{bucket.Name(): bucket},
+			tmpObjectPrefix: ".gcsfuse_tmp/",
+		},
+		FilePerms:            filePerms,
+		DirPerms:             dirPerms,
+		SequentialReadSizeMb: SequentialReadSizeMb,
+		MountConfig:          mountConfig,
+	})
+	AssertEq(nil, err)
+}
+
+func (t *LockOrderTest) TearDown() {
+	if !t.deadlocked {
+		t.fs.Destroy()
+	}
+}
+
+////////////////////////////////////////////////////////////////////////
+// Tests
+////////////////////////////////////////////////////////////////////////
+
+func (t *LockOrderTest) OpenDirRacingLookUpOfTheDir() {
+	// Looking up a directory that already has an inode locks the inode before
+	// fs.mu, so opening it mustn't lock the inode while holding fs.mu.
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+
+	lookUp := &fuseops.LookUpInodeOp{Parent: fuseops.RootInodeID, Name: "dir"}
+	AssertEq(nil, t.fs.LookUpInode(t.ctx, lookUp))
+	dir := lookUp.Entry.Child
+
+	const (
+		workers    = 4
+		iterations = 2000
+	)
+	var wg sync.WaitGroup
+	errs := make(chan error, 2*workers*iterations)
+	for w := 0; w < workers; w++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < iterations; i++ {
+				op := &fuseops.OpenDirOp{Inode: dir}
+				if err := t.fs.OpenDir(t.ctx, op); err != nil {
+					errs <- err
+					continue
+				}
+				errs <- t.fs.ReleaseDirHandle(t.ctx, &fuseops.ReleaseDirHandleOp{Handle: op.Handle})
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for i := 0; i < iterations; i++ {
+				op := &fuseops.LookUpInodeOp{Parent: fuseops.RootInodeID, Name: "dir"}
+				if err := t.fs.LookUpInode(t.ctx, op); err != nil {
+					errs <- err
+					continue
+				}
+				errs <- t.fs.ForgetInode(t.ctx, &fuseops.ForgetInodeOp{Inode: op.Entry.Child, N: 1})
+			}
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(30 * time.Second):
+		t.deadlocked = true
+		AddFailure("OpenDir and LookUpInode deadlocked")
+		AbortTest()
+	}
+
+	close(errs)
+	for err := range errs {
+		ExpectEq(nil, err)
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Tests for advisory locks taken through the mount. The file system doesn't
+// ask the kernel to forward lock requests, so they are served by the kernel's
+// own lock table with local semantics.
+
+package fs_test
+
+import (
+	"os"
+	"path"
+	"syscall"
+	"time"
+
+	. "github.com/jacobsa/ogletest"
+)
+
+////////////////////////////////////////////////////////////////////////
+// Boilerplate
+////////////////////////////////////////////////////////////////////////
+
+type LockingTest struct {
+	fsTest
+}
+
+func init() { RegisterTestSuite(&LockingTest{}) }
+
+func (t *LockingTest) openTwice(name string) {
+	var err error
+	AssertEq(nil, t.createWithContents(name, "taco"))
+
+	t.f1, err = os.OpenFile(path.Join(mntDir, name), os.O_RDWR, 0)
+	AssertEq(nil, err)
+
+	t.f2, err = os.OpenFile(path.Join(mntDir, name), os.O_RDWR, 0)
+	AssertEq(nil, err)
+}
+
+////////////////////////////////////////////////////////////////////////
+// Tests
+////////////////////////////////////////////////////////////////////////
+
+func (t *LockingTest) Flock_ExclusiveNonBlocking() {
+	t.openTwice("foo")
+
+	AssertEq(nil, syscall.Flock(int(t.f1.Fd()), syscall.LOCK_EX|syscall.LOCK_NB))
+
+	err := syscall.Flock(int(t.f2.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	ExpectEq(syscall.EWOULDBLOCK, err)
+
+	err = syscall.Flock(int(t.f2.Fd()), syscall.LOCK_SH|syscall.LOCK_NB)
+	ExpectEq(syscall.EWOULDBLOCK, err)
+
+	// Unlocking lets the other descriptor in.
+	AssertEq(nil, syscall.Flock(int(t.f1.Fd()), syscall.LOCK_UN))
+	ExpectEq(nil, syscall.Flock(int(t.f2.Fd()), syscall.LOCK_EX|syscall.LOCK_NB))
+}
+
+func (t *LockingTest) Flock_SharedLocksCoexist() {
+	t.openTwice("foo")
+
+	AssertEq(nil, syscall.Flock(int(t.f1.Fd()), syscall.LOCK_SH|syscall.LOCK_NB))
+	ExpectEq(nil, syscall.Flock(int(t.f2.Fd()), syscall.LOCK_SH|syscall.LOCK_NB))
+}
+
+func (t *LockingTest) Flock_Blocking() {
+	t.openTwice("foo")
+	AssertEq(nil, syscall.Flock(int(t.f1.Fd()), syscall.LOCK_EX))
+
+	acquired := make(chan error, 1)
+	go func() {
+		acquired <- syscall.Flock(int(t.f2.Fd()), syscall.LOCK_EX)
+	}()
+
+	// The second lock must wait for the first to be released.
+	select {
+	case err := <-acquired:
+		AddFailure("Lock acquired while held elsewhere: %v", err)
+		AbortTest()
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	AssertEq(nil, syscall.Flock(int(t.f1.Fd()), syscall.LOCK_UN))
+
+	select {
+	case err := <-acquired:
+		ExpectEq(nil, err)
+	case <-time.After(5 * time.Second):
+		AddFailure("Lock not acquired after release")
+	}
+}
+
+func (t *LockingTest) Flock_ReleasedOnClose() {
+	t.openTwice("foo")
+	AssertEq(nil, syscall.Flock(int(t.f1.Fd()), syscall.LOCK_EX|syscall.LOCK_NB))
+
+	AssertEq(nil, t.f1.Close())
+	t.f1 = nil
+
+	ExpectEq(nil, syscall.Flock(int(t.f2.Fd()), syscall.LOCK_EX|syscall.LOCK_NB))
+}
+
+func (t *LockingTest) Fcntl_SetAndGetLock() {
+	t.openTwice("foo")
+
+	lk := syscall.Flock_t{Type: syscall.F_WRLCK, Whence: 0, Start: 0, Len: 0}
+	AssertEq(nil, syscall.FcntlFlock(t.f1.Fd(), syscall.F_SETLK, &lk))
+
+	// POSIX locks are owned by the process, so F_GETLK from the same process
+	// reports the range as free.
+	query := syscall.Flock_t{Type: syscall.F_WRLCK, Whence: 0, Start: 0, Len: 0}
+	AssertEq(nil, syscall.FcntlFlock(t.f2.Fd(), syscall.F_GETLK, &query))
+	ExpectEq(syscall.F_UNLCK, query.Type)
+
+	unlock := syscall.Flock_t{Type: syscall.F_UNLCK, Whence: 0, Start: 0, Len: 0}
+	ExpectEq(nil, syscall.FcntlFlock(t.f1.Fd(), syscall.F_SETLK, &unlock))
+}
@@ -0,0 +1,179 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Tests for mkdir racing with other mkdirs, in this mount and others.
+
+package fs_test
+
+import (
+	"context"
+	"os"
+	"path"
+	"sort"
+	"sync"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	. "github.com/jacobsa/oglematchers"
+	. "github.com/jacobsa/ogletest"
+	"github.com/jacobsa/timeutil"
+)
+
+////////////////////////////////////////////////////////////////////////
+// Boilerplate
+////////////////////////////////////////////////////////////////////////
+
+// mkDirRaceBucket counts the objects it creates by name. For the names in
+// otherMount, another mount creates the object just before it does.
+type mkDirRaceBucket struct {
+	gcs.Bucket
+
+	mu sync.Mutex
+
+	// GUARDED_BY(mu)
+	created    map[string]int
+	otherMount map[string]bool
+}
+
+func (b *mkDirRaceBucket) CreateObject(
+	ctx context.Context,
+	req *gcs.CreateObjectRequest) (*gcs.Object, error) {
+	b.mu.Lock()
+	race := b.otherMount[req.Name]
+	b.mu.Unlock()
+
+	if race {
+		if _, err := storageutil.CreateObject(ctx, b.Bucket, req.Name, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	o, err := b.Bucket.CreateObject(ctx, req)
+	if err == nil {
+		b.mu.Lock()
+		b.created[req.Name]++
+		b.mu.Unlock()
+	}
+
+	return o, err
+}
+
+func (b *mkDirRaceBucket) creations(name string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.created[name]
+}
+
+func (b *mkDirRaceBucket) raceWithOtherMount(name string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.otherMount[name] = true
+}
+
+var mkDirBucket *mkDirRaceBucket
+
+type MkDirRaceTest struct {
+	fsTest
+}
+
+func init() { RegisterTestSuite(&MkDirRaceTest{}) }
+
+func (t *MkDirRaceTest) SetUpTestSuite() {
+	mkDirBucket = &mkDirRaceBucket{
+		Bucket:     fake.NewFakeBucket(timeutil.RealClock(), "some_bucket"),
+		created:    make(map[string]int),
+		otherMount: make(map[string]bool),
+	}
+	bucket = mkDirBucket
+
+	t.fsTest.SetUpTestSuite()
+}
+
+// Return the names of all objects in the bucket, sorted.
+func (t *MkDirRaceTest) objectNames() []string {
+	objects, _, err := storageutil.ListAll(ctx, mkDirBucket.Bucket, &gcs.ListObjectsRequest{})
+	AssertEq(nil, err)
+
+	var names []string
+	for _, o := range objects {
+		names = append(names, o.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+////////////////////////////////////////////////////////////////////////
+// Tests
+////////////////////////////////////////////////////////////////////////
+
+func (t *MkDirRaceTest) ConcurrentMkdirP() {
+	const goroutines = 50
+	leaves := []string{"a/b/c/d", "a/b/e", "a/f"}
+
+	// Each goroutine creates the whole tree, like a job running mkdir -p.
+	var wg sync.WaitGroup
+	errs := make(chan error, goroutines*len(leaves))
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := range leaves {
+				leaf := leaves[(i+j)%len(leaves)]
+				errs <- os.MkdirAll(path.Join(mntDir, leaf), 0700)
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		ExpectEq(nil, err)
+	}
+
+	// Exactly one placeholder was created for each directory.
+	dirs := []string{"a/", "a/b/", "a/b/c/", "a/b/c/d/", "a/b/e/", "a/f/"}
+	ExpectThat(t.objectNames(), ElementsAre(dirs[0], dirs[1], dirs[2], dirs[3], dirs[4], dirs[5]))
+	for _, d := range dirs {
+		ExpectEq(1, mkDirBucket.creations(d), "%s", d)
+	}
+}
+
+func (t *MkDirRaceTest) OtherMountWins() {
+	mkDirBucket.raceWithOtherMount("foo/")
+
+	// The directory exists by the time we create it, which is just as good.
+	err := os.Mkdir(path.Join(mntDir, "foo"), 0700)
+	AssertEq(nil, err)
+
+	fi, err := os.Stat(path.Join(mntDir, "foo"))
+	AssertEq(nil, err)
+	ExpectTrue(fi.IsDir())
+	ExpectEq(0, mkDirBucket.creations("foo/"))
+	ExpectThat(t.objectNames(), ElementsAre("foo/"))
+
+	// Creating what's inside works as usual.
+	err = os.Mkdir(path.Join(mntDir, "foo/bar"), 0700)
+	AssertEq(nil, err)
+	ExpectEq(1, mkDirBucket.creations("foo/bar/"))
+}
+
+func (t *MkDirRaceTest) FileInTheWay() {
+	AssertEq(nil, t.createWithContents("foo", "taco"))
+
+	err := os.Mkdir(path.Join(mntDir, "foo"), 0700)
+
+	ExpectTrue(os.IsExist(err), "err: %v", err)
+	ExpectThat(t.objectNames(), ElementsAre("foo"))
+}
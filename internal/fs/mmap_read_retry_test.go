@@ -0,0 +1,151 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Tests for retrying page-in reads, whose failure kills applications that
+// mmap the file with SIGBUS.
+
+package fs_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path"
+	"runtime/debug"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	. "github.com/jacobsa/ogletest"
+	"github.com/jacobsa/timeutil"
+)
+
+////////////////////////////////////////////////////////////////////////
+// Boilerplate
+////////////////////////////////////////////////////////////////////////
+
+const mmapReadRetries = 3
+
+// failingReadBucket injects failures into the next reads of object contents:
+// while failures is positive, each reader it opens drops its connection
+// before delivering any data, and failures is decremented.
+type failingReadBucket struct {
+	gcs.Bucket
+	failures atomic.Int64
+}
+
+func (b *failingReadBucket) takeFailure() bool {
+	for {
+		n := b.failures.Load()
+		if n <= 0 {
+			return false
+		}
+		if b.failures.CompareAndSwap(n, n-1) {
+			return true
+		}
+	}
+}
+
+func (b *failingReadBucket) NewReader(
+	ctx context.Context,
+	req *gcs.ReadObjectRequest) (io.ReadCloser, error) {
+	rc, err := b.Bucket.NewReader(ctx, req)
+	if err == nil && b.takeFailure() {
+		rc = droppedReader{rc}
+	}
+	return rc, err
+}
+
+type droppedReader struct {
+	io.ReadCloser
+}
+
+func (droppedReader) Read(p []byte) (int, error) {
+	return 0, io.ErrUnexpectedEOF
+}
+
+var failingBucket *failingReadBucket
+
+type MmapReadRetryTest struct {
+	fsTest
+}
+
+func init() { RegisterTestSuite(&MmapReadRetryTest{}) }
+
+func (t *MmapReadRetryTest) SetUpTestSuite() {
+	failingBucket = &failingReadBucket{
+		Bucket: fake.NewFakeBucket(timeutil.RealClock(), "some_bucket"),
+	}
+	bucket = failingBucket
+	t.serverCfg.MmapReadRetries = mmapReadRetries
+
+	t.fsTest.SetUpTestSuite()
+}
+
+func (t *MmapReadRetryTest) TearDown() {
+	failingBucket.failures.Store(0)
+	t.fsTest.TearDown()
+}
+
+// Create an object of two pages with the given name, returning its contents.
+func (t *MmapReadRetryTest) createTwoPages(name string) []byte {
+	contents := bytes.Repeat([]byte("taco"), os.Getpagesize()/2)
+	AssertEq(nil, t.createWithContents(name, string(contents)))
+	return contents
+}
+
+////////////////////////////////////////////////////////////////////////
+// Tests
+////////////////////////////////////////////////////////////////////////
+
+func (t *MmapReadRetryTest) MmapReadSucceedsAfterFailures() {
+	contents := t.createTwoPages("foo")
+
+	f, err := os.Open(path.Join(mntDir, "foo"))
+	AssertEq(nil, err)
+	defer f.Close()
+
+	data, err := syscall.Mmap(int(f.Fd()), 0, len(contents), syscall.PROT_READ, syscall.MAP_SHARED)
+	AssertEq(nil, err)
+	defer syscall.Munmap(data)
+
+	// Touching the mapping pages it in. The kernel faults again itself after
+	// some failed page-ins, e.g. interrupted ones, but without gcsfuse retrying
+	// these failures would usually crash the test with SIGBUS; turn that into a
+	// panic instead.
+	defer debug.SetPanicOnFault(debug.SetPanicOnFault(true))
+	failingBucket.failures.Store(mmapReadRetries)
+	ExpectTrue(bytes.Equal(contents, data))
+	ExpectEq(0, failingBucket.failures.Load())
+}
+
+func (t *MmapReadRetryTest) ReadFailsWhileFailuresPersist() {
+	t.createTwoPages("bar")
+
+	// The kernel tries a failed read of its page cache more than once itself.
+	failingBucket.failures.Store(100)
+	_, err := os.ReadFile(path.Join(mntDir, "bar"))
+	ExpectNe(nil, err)
+}
+
+func (t *MmapReadRetryTest) ReadSucceedsWithinRetries() {
+	contents := t.createTwoPages("baz")
+
+	failingBucket.failures.Store(mmapReadRetries)
+	b, err := os.ReadFile(path.Join(mntDir, "baz"))
+	AssertEq(nil, err)
+	ExpectTrue(bytes.Equal(contents, b))
+}
@@ -0,0 +1,173 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Tests for multi-object mutations in a dry run, calling the file system
+// directly.
+
+package fs_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/metadata"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/config"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/fs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/fs/inode"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/gcsx"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/fuseutil"
+	. "github.com/jacobsa/oglematchers"
+	. "github.com/jacobsa/ogletest"
+	"github.com/jacobsa/timeutil"
+)
+
+////////////////////////////////////////////////////////////////////////
+// Boilerplate
+////////////////////////////////////////////////////////////////////////
+
+type MutationDryRunTest struct {
+	ctx    context.Context
+	bucket gcs.Bucket
+	fs     fuseutil.FileSystem
+}
+
+func init() { RegisterTestSuite(&MutationDryRunTest{}) }
+
+func (t *MutationDryRunTest) SetUp(ti *TestInfo) {
+	t.ctx = ti.Ctx
+	t.bucket = fake.NewFakeBucket(timeutil.RealClock(), "some_bucket")
+	AssertEq(nil, storageutil.CreateEmptyObjects(t.ctx, t.bucket, []string{"dir/", "dir/a", "dir/b", "foo"}))
+
+	var err error
+	t.fs, err = fs.NewFileSystem(t.ctx, &fs.ServerConfig{
+		CacheClock: timeutil.RealClock(),
+		BucketName: t.bucket.Name(),
+		BucketManager: &fakeBucketManager{
+			buckets:         map[string]gcs.Bucket{t.bucket.Name(): t.bucket},
+			tmpObjectPrefix: ".gcsfuse_tmp/",
+		},
+		FilePerms:            filePerms,
+		DirPerms:             dirPerms,
+		RenameDirLimit:       10,
+		SequentialReadSizeMb: SequentialReadSizeMb,
+		MountConfig:          config.NewMountConfig(),
+		MutationPlanner:      gcsx.NewMutationPlanner(false, true),
+		CompatDirMarkerTypes: []string{inode.DefaultCompatDirMarkerType},
+		AsyncUnlink:          true,
+		DirTypeCacheTTLs:     metadata.SameEntryTTLs(time.Minute),
+	})
+	AssertEq(nil, err)
+}
+
+func (t *MutationDryRunTest) TearDown() {
+	t.fs.Destroy()
+}
+
+func (t *MutationDryRunTest) rename(oldName, newName string) error {
+	return t.fs.Rename(t.ctx, &fuseops.RenameOp{
+		OldParent: fuseops.RootInodeID,
+		OldName:   oldName,
+		NewParent: fuseops.RootInodeID,
+		NewName:   newName,
+	})
+}
+
+func (t *MutationDryRunTest) lookUp(name string) {
+	err := t.fs.LookUpInode(t.ctx, &fuseops.LookUpInodeOp{
+		Parent: fuseops.RootInodeID,
+		Name:   name,
+	})
+	AssertEq(nil, err)
+}
+
+func (t *MutationDryRunTest) rmDir(name string) error {
+	return t.fs.RmDir(t.ctx, &fuseops.RmDirOp{
+		Parent: fuseops.RootInodeID,
+		Name:   name,
+	})
+}
+
+// Return the names of the objects in the bucket.
+func (t *MutationDryRunTest) objectNames() (names []string) {
+	objects, _, err := storageutil.ListAll(t.ctx, t.bucket, &gcs.ListObjectsRequest{})
+	AssertEq(nil, err)
+	for _, o := range objects {
+		names = append(names, o.Name)
+	}
+	return
+}
+
+////////////////////////////////////////////////////////////////////////
+// Tests
+////////////////////////////////////////////////////////////////////////
+
+func (t *MutationDryRunTest) DirRenameFailsWithoutChangingObjects() {
+	err := t.rename("dir", "renamed")
+
+	ExpectTrue(errors.Is(err, syscall.EROFS), "%v", err)
+	ExpectThat(t.objectNames(), ElementsAre("dir/", "dir/a", "dir/b", "foo"))
+}
+
+func (t *MutationDryRunTest) FileRenameIsExecuted() {
+	err := t.rename("foo", "bar")
+
+	AssertEq(nil, err)
+	ExpectThat(t.objectNames(), ElementsAre("bar", "dir/", "dir/a", "dir/b"))
+}
+
+func (t *MutationDryRunTest) AsyncUnlinkFailsWithoutDeleting() {
+	// Unlinks are only asynchronous for names known to be files.
+	t.lookUp("foo")
+
+	err := t.fs.Unlink(t.ctx, &fuseops.UnlinkOp{
+		Parent: fuseops.RootInodeID,
+		Name:   "foo",
+	})
+
+	ExpectTrue(errors.Is(err, syscall.EROFS), "%v", err)
+	ExpectThat(t.objectNames(), ElementsAre("dir/", "dir/a", "dir/b", "foo"))
+}
+
+func (t *MutationDryRunTest) RmDirWithCompatMarkerFailsWithoutDeleting() {
+	AssertEq(nil, storageutil.CreateEmptyObjects(t.ctx, t.bucket, []string{"marked/"}))
+	_, err := t.bucket.CreateObject(t.ctx, &gcs.CreateObjectRequest{
+		Name:        "marked",
+		ContentType: inode.DefaultCompatDirMarkerType,
+		Contents:    strings.NewReader(""),
+	})
+	AssertEq(nil, err)
+	t.lookUp("marked")
+
+	err = t.rmDir("marked")
+
+	ExpectTrue(errors.Is(err, syscall.EROFS), "%v", err)
+	ExpectThat(t.objectNames(), ElementsAre("dir/", "dir/a", "dir/b", "foo", "marked", "marked/"))
+}
+
+func (t *MutationDryRunTest) RmDirIsExecuted() {
+	AssertEq(nil, storageutil.CreateEmptyObjects(t.ctx, t.bucket, []string{"empty/"}))
+	t.lookUp("empty")
+
+	err := t.rmDir("empty")
+
+	AssertEq(nil, err)
+	ExpectThat(t.objectNames(), ElementsAre("dir/", "dir/a", "dir/b", "foo"))
+}
@@ -0,0 +1,168 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Tests for names whose objects would be too long for GCS.
+
+package fs_test
+
+import (
+	"errors"
+	"os"
+	"path"
+	"strings"
+	"syscall"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	. "github.com/jacobsa/oglematchers"
+	. "github.com/jacobsa/ogletest"
+)
+
+////////////////////////////////////////////////////////////////////////
+// Boilerplate
+////////////////////////////////////////////////////////////////////////
+
+// The object names of the four directories are 4*251 = 1004 bytes long, so
+// the names of their children can be 20 bytes long, or 19 for directories.
+var longDirs = strings.Repeat(strings.Repeat("d", 250)+"/", 4)
+
+type ObjectNameLengthTest struct {
+	fsTest
+}
+
+func init() { RegisterTestSuite(&ObjectNameLengthTest{}) }
+
+func (t *ObjectNameLengthTest) SetUp(ti *TestInfo) {
+	err := os.MkdirAll(path.Join(mntDir, longDirs), 0700)
+	AssertEq(nil, err)
+}
+
+// Return the names of all objects in the bucket.
+func (t *ObjectNameLengthTest) objectNames() []string {
+	objects, _, err := storageutil.ListAll(ctx, bucket, &gcs.ListObjectsRequest{})
+	AssertEq(nil, err)
+
+	var names []string
+	for _, o := range objects {
+		names = append(names, o.Name)
+	}
+	return names
+}
+
+func expectNameTooLong(err error) {
+	ExpectTrue(errors.Is(err, syscall.ENAMETOOLONG), "err: %v", err)
+}
+
+////////////////////////////////////////////////////////////////////////
+// Tests
+////////////////////////////////////////////////////////////////////////
+
+func (t *ObjectNameLengthTest) CreateFile() {
+	longest := path.Join(mntDir, longDirs, strings.Repeat("f", 20))
+	tooLong := path.Join(mntDir, longDirs, strings.Repeat("f", 21))
+
+	err := os.WriteFile(longest, []byte("taco"), 0600)
+	ExpectEq(nil, err)
+
+	err = os.WriteFile(tooLong, []byte("taco"), 0600)
+	expectNameTooLong(err)
+
+	_, err = os.Stat(tooLong)
+	expectNameTooLong(err)
+	ExpectThat(t.objectNames(), Contains(longDirs+strings.Repeat("f", 20)))
+	ExpectEq(5, len(t.objectNames()))
+}
+
+func (t *ObjectNameLengthTest) MkDir() {
+	longest := path.Join(mntDir, longDirs, strings.Repeat("e", 19))
+	tooLong := path.Join(mntDir, longDirs, strings.Repeat("e", 20))
+
+	err := os.Mkdir(longest, 0700)
+	ExpectEq(nil, err)
+
+	err = os.Mkdir(tooLong, 0700)
+	expectNameTooLong(err)
+
+	ExpectThat(t.objectNames(), Contains(longDirs+strings.Repeat("e", 19)+"/"))
+	ExpectEq(5, len(t.objectNames()))
+}
+
+func (t *ObjectNameLengthTest) Symlink() {
+	tooLong := path.Join(mntDir, longDirs, strings.Repeat("s", 21))
+
+	err := os.Symlink("target", tooLong)
+	expectNameTooLong(err)
+
+	ExpectEq(4, len(t.objectNames()))
+}
+
+func (t *ObjectNameLengthTest) RenameFile() {
+	oldPath := path.Join(mntDir, longDirs, "foo")
+	AssertEq(nil, os.WriteFile(oldPath, []byte("taco"), 0600))
+
+	err := os.Rename(oldPath, path.Join(mntDir, longDirs, strings.Repeat("f", 21)))
+	expectNameTooLong(err)
+
+	// The file is still there.
+	contents, err := os.ReadFile(oldPath)
+	AssertEq(nil, err)
+	ExpectEq("taco", string(contents))
+}
+
+func (t *ObjectNameLengthTest) RenameDir() {
+	// The file fits inside the directory now, but wouldn't once the directory
+	// had a longer name.
+	oldDir := path.Join(mntDir, longDirs, "a")
+	AssertEq(nil, os.Mkdir(oldDir, 0700))
+	AssertEq(nil, os.WriteFile(path.Join(oldDir, strings.Repeat("f", 18)), []byte("taco"), 0600))
+
+	err := os.Rename(oldDir, path.Join(mntDir, longDirs, "ab"))
+	expectNameTooLong(err)
+
+	// Nothing was moved.
+	contents, err := os.ReadFile(path.Join(oldDir, strings.Repeat("f", 18)))
+	AssertEq(nil, err)
+	ExpectEq("taco", string(contents))
+	ExpectEq(6, len(t.objectNames()))
+}
+
+func (t *ObjectNameLengthTest) InvalidUTF8() {
+	err := os.WriteFile(path.Join(mntDir, "foo\xff"), []byte("taco"), 0600)
+
+	ExpectTrue(errors.Is(err, syscall.EILSEQ), "err: %v", err)
+}
+
+// The directory given with --only-dir counts towards the length.
+type OnlyDirObjectNameLengthTest struct {
+	fsTest
+}
+
+func init() { RegisterTestSuite(&OnlyDirObjectNameLengthTest{}) }
+
+func (t *OnlyDirObjectNameLengthTest) SetUpTestSuite() {
+	t.serverCfg.OnlyDir = strings.Repeat("o", 99)
+	t.fsTest.SetUpTestSuite()
+}
+
+func (t *OnlyDirObjectNameLengthTest) CreateFile() {
+	dirs := path.Join(mntDir, strings.Repeat("d", 250), strings.Repeat("d", 250), strings.Repeat("d", 250))
+	AssertEq(nil, os.MkdirAll(dirs, 0700))
+
+	// The prefix takes 100 bytes and the directories 753, leaving 171.
+	err := os.WriteFile(path.Join(dirs, strings.Repeat("f", 171)), []byte("taco"), 0600)
+	ExpectEq(nil, err)
+
+	err = os.WriteFile(path.Join(dirs, strings.Repeat("f", 172)), []byte("taco"), 0600)
+	expectNameTooLong(err)
+}
@@ -23,6 +23,7 @@ import (
 	"sync"
 	"testing"
 
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/metadata"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/config"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
@@ -56,8 +57,8 @@ func (t *ParallelDiropsWithoutCachesTest) SetupSuite() {
 			DisableParallelDirops: false,
 		}}
 	t.serverCfg.RenameDirLimit = 10
-	t.serverCfg.DirTypeCacheTTL = 0
-	t.serverCfg.InodeAttributeCacheTTL = 0
+	t.serverCfg.DirTypeCacheTTLs = metadata.EntryTTLs{}
+	t.serverCfg.InodeAttributeCacheTTLs = metadata.EntryTTLs{}
 	t.fsTest.SetUpTestSuite()
 }
 
@@ -0,0 +1,177 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Tests for write:create-parent-placeholders, creating files under implicit
+// directories and calling the file system directly.
+
+package fs_test
+
+import (
+	"context"
+	"sort"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/config"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/fs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/locker"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/fuseutil"
+	. "github.com/jacobsa/oglematchers"
+	. "github.com/jacobsa/ogletest"
+	"github.com/jacobsa/timeutil"
+)
+
+type ParentPlaceholdersTest struct {
+	ctx    context.Context
+	bucket gcs.Bucket
+	fs     fuseutil.FileSystem
+}
+
+func init() { RegisterTestSuite(&ParentPlaceholdersTest{}) }
+
+func (t *ParentPlaceholdersTest) SetUp(ti *TestInfo) {
+	locker.EnableInvariantsCheck()
+	t.ctx = ti.Ctx
+	t.bucket = fake.NewFakeBucket(timeutil.RealClock(), "some_bucket")
+
+	// a/, a/b/ and a/b/c/ are implicit, x/ explicit.
+	AssertEq(nil, storageutil.CreateEmptyObjects(t.ctx, t.bucket, []string{"a/b/c/other", "x/"}))
+}
+
+func (t *ParentPlaceholdersTest) TearDown() {
+	if t.fs != nil {
+		t.fs.Destroy()
+	}
+}
+
+func (t *ParentPlaceholdersTest) mount(mode string) {
+	mountConfig := config.NewMountConfig()
+	mountConfig.WriteConfig.CreateParentPlaceholders = mode
+
+	var err error
+	t.fs, err = fs.NewFileSystem(t.ctx, &fs.ServerConfig{
+		CacheClock: timeutil.RealClock(),
+		BucketName: t.bucket.Name(),
+		BucketManager: &fakeBucketManager{
+			buckets:         map[string]gcs.Bucket{t.bucket.Name(): t.bucket},
+			tmpObjectPrefix: ".gcsfuse_tmp/",
+		},
+		ImplicitDirectories:  true,
+		FilePerms:            filePerms,
+		DirPerms:             dirPerms,
+		SequentialReadSizeMb: SequentialReadSizeMb,
+		MountConfig:          mountConfig,
+	})
+	AssertEq(nil, err)
+}
+
+// Look up the directory at the given path, returning its inode.
+func (t *ParentPlaceholdersTest) lookUpDir(names ...string) fuseops.InodeID {
+	dir := fuseops.InodeID(fuseops.RootInodeID)
+	for _, name := range names {
+		op := &fuseops.LookUpInodeOp{Parent: dir, Name: name}
+		AssertEq(nil, t.fs.LookUpInode(t.ctx, op))
+		dir = op.Entry.Child
+	}
+	return dir
+}
+
+// Create, write and flush a file in the supplied directory.
+func (t *ParentPlaceholdersTest) createFile(dir fuseops.InodeID, name string) {
+	create := &fuseops.CreateFileOp{Parent: dir, Name: name, Mode: filePerms}
+	AssertEq(nil, t.fs.CreateFile(t.ctx, create))
+
+	write := &fuseops.WriteFileOp{Inode: create.Entry.Child, Handle: create.Handle, Data: []byte("taco")}
+	AssertEq(nil, t.fs.WriteFile(t.ctx, write))
+
+	flush := &fuseops.FlushFileOp{Inode: create.Entry.Child, Handle: create.Handle}
+	AssertEq(nil, t.fs.FlushFile(t.ctx, flush))
+}
+
+func (t *ParentPlaceholdersTest) objectNames() []string {
+	objects, _, err := storageutil.ListAll(t.ctx, t.bucket, &gcs.ListObjectsRequest{})
+	AssertEq(nil, err)
+
+	var names []string
+	for _, o := range objects {
+		names = append(names, o.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Create a file under the implicit directory a/b/c/, and one under x/ after
+// deleting its placeholder behind the mount's back.
+func (t *ParentPlaceholdersTest) createFiles() {
+	t.createFile(t.lookUpDir("a", "b", "c"), "foo")
+
+	x := t.lookUpDir("x")
+	AssertEq(nil, t.bucket.DeleteObject(t.ctx, &gcs.DeleteObjectRequest{Name: "x/"}))
+	t.createFile(x, "bar")
+}
+
+////////////////////////////////////////////////////////////////////////
+// Tests
+////////////////////////////////////////////////////////////////////////
+
+func (t *ParentPlaceholdersTest) Never() {
+	t.mount(config.CreateParentPlaceholdersNever)
+
+	t.createFiles()
+
+	ExpectThat(t.objectNames(), ElementsAre("a/b/c/foo", "a/b/c/other", "x/bar"))
+}
+
+func (t *ParentPlaceholdersTest) MissingOnly() {
+	t.mount(config.CreateParentPlaceholdersMissingOnly)
+
+	t.createFiles()
+
+	ExpectThat(
+		t.objectNames(),
+		ElementsAre("a/", "a/b/", "a/b/c/", "a/b/c/foo", "a/b/c/other", "x/bar"))
+}
+
+func (t *ParentPlaceholdersTest) Always() {
+	t.mount(config.CreateParentPlaceholdersAlways)
+
+	t.createFiles()
+
+	ExpectThat(
+		t.objectNames(),
+		ElementsAre("a/", "a/b/", "a/b/c/", "a/b/c/foo", "a/b/c/other", "x/", "x/bar"))
+}
+
+func (t *ParentPlaceholdersTest) ExistingPlaceholdersAreKept() {
+	t.mount(config.CreateParentPlaceholdersAlways)
+	x, _, err := t.bucket.StatObject(t.ctx, &gcs.StatObjectRequest{Name: "x/"})
+	AssertEq(nil, err)
+
+	t.createFile(t.lookUpDir("x"), "bar")
+
+	after, _, err := t.bucket.StatObject(t.ctx, &gcs.StatObjectRequest{Name: "x/"})
+	AssertEq(nil, err)
+	ExpectEq(x.Generation, after.Generation)
+}
+
+func (t *ParentPlaceholdersTest) MkNodeUnderImplicitDirectories() {
+	t.mount(config.CreateParentPlaceholdersMissingOnly)
+
+	op := &fuseops.MkNodeOp{Parent: t.lookUpDir("a", "b"), Name: "foo", Mode: filePerms}
+	AssertEq(nil, t.fs.MkNode(t.ctx, op))
+
+	ExpectThat(t.objectNames(), ElementsAre("a/", "a/b/", "a/b/c/other", "a/b/foo", "x/"))
+}
@@ -0,0 +1,119 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fs
+
+import (
+	"context"
+	"sync"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/fs/inode"
+)
+
+// pendingDeletes tracks the deletions of unlinked files that run in the
+// background with ServerConfig.AsyncUnlink. The kernel sends the unlinks
+// within a directory one at a time, so unlinks return before their objects
+// are deleted, letting rm -r delete many objects at once. Ops that could see
+// a name again wait for its deletion first, and listing or removing a
+// directory waits for all of those in it.
+type pendingDeletes struct {
+	mu sync.Mutex
+
+	// The running deletions, by directory and child name. Each channel is
+	// closed once its deletion is done.
+	//
+	// GUARDED_BY(mu)
+	running map[inode.Name]map[string]chan struct{}
+
+	// Counts the running deletions.
+	wg sync.WaitGroup
+}
+
+func newPendingDeletes() *pendingDeletes {
+	return &pendingDeletes{
+		running: make(map[inode.Name]map[string]chan struct{}),
+	}
+}
+
+// start runs the deletion of the named child of dir in the background.
+func (p *pendingDeletes) start(dir inode.Name, name string, del func()) {
+	done := make(chan struct{})
+
+	p.mu.Lock()
+	if p.running[dir] == nil {
+		p.running[dir] = make(map[string]chan struct{})
+	}
+	p.running[dir][name] = done
+	p.mu.Unlock()
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		del()
+
+		p.mu.Lock()
+		if p.running[dir][name] == done {
+			delete(p.running[dir], name)
+			if len(p.running[dir]) == 0 {
+				delete(p.running, dir)
+			}
+		}
+		p.mu.Unlock()
+		close(done)
+	}()
+}
+
+// waitName waits for the deletion of the named child of dir, if one is
+// running, or returns the error of ctx if it's done first.
+func (p *pendingDeletes) waitName(ctx context.Context, dir inode.Name, name string) error {
+	p.mu.Lock()
+	done := p.running[dir][name]
+	p.mu.Unlock()
+	if done == nil {
+		return nil
+	}
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// waitDir waits for the deletions of the children of dir, or returns the
+// error of ctx if it's done first.
+func (p *pendingDeletes) waitDir(ctx context.Context, dir inode.Name) error {
+	p.mu.Lock()
+	var dones []chan struct{}
+	for _, done := range p.running[dir] {
+		dones = append(dones, done)
+	}
+	p.mu.Unlock()
+
+	for _, done := range dones {
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return nil
+}
+
+// waitAll waits for all the running deletions.
+func (p *pendingDeletes) waitAll() {
+	p.wg.Wait()
+}
@@ -0,0 +1,143 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Tests for directories listed by their parent that the caller may not look
+// inside, such as managed folders it has no permissions on.
+
+package fs_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/metadata"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/jacobsa/fuse/fusetesting"
+	. "github.com/jacobsa/ogletest"
+	"github.com/jacobsa/timeutil"
+	"google.golang.org/api/googleapi"
+)
+
+////////////////////////////////////////////////////////////////////////
+// Boilerplate
+////////////////////////////////////////////////////////////////////////
+
+// The prefix the caller is forbidden to stat or list under.
+const deniedPrefix = "denied/"
+
+// deniedPrefixBucket forbids requests under deniedPrefix, as GCS does for a
+// managed folder the caller has no permissions on.
+type deniedPrefixBucket struct {
+	gcs.Bucket
+	lists atomic.Int64
+}
+
+func (b *deniedPrefixBucket) StatObject(
+	ctx context.Context,
+	req *gcs.StatObjectRequest) (*gcs.MinObject, *gcs.ExtendedObjectAttributes, error) {
+	if strings.HasPrefix(req.Name, deniedPrefix) {
+		return nil, nil, &googleapi.Error{Code: http.StatusForbidden}
+	}
+	return b.Bucket.StatObject(ctx, req)
+}
+
+func (b *deniedPrefixBucket) ListObjects(
+	ctx context.Context,
+	req *gcs.ListObjectsRequest) (*gcs.Listing, error) {
+	if strings.HasPrefix(req.Prefix, deniedPrefix) {
+		b.lists.Add(1)
+		return nil, &googleapi.Error{Code: http.StatusForbidden}
+	}
+	return b.Bucket.ListObjects(ctx, req)
+}
+
+var deniedBucket *deniedPrefixBucket
+
+type PermissionDeniedTest struct {
+	fsTest
+}
+
+func init() { RegisterTestSuite(&PermissionDeniedTest{}) }
+
+func (t *PermissionDeniedTest) SetUpTestSuite() {
+	deniedBucket = &deniedPrefixBucket{
+		Bucket: fake.NewFakeBucket(timeutil.RealClock(), "some_bucket"),
+	}
+	bucket = deniedBucket
+	t.serverCfg.ImplicitDirectories = true
+	// Directories are known to be listed through the type cache.
+	t.serverCfg.DirTypeCacheTTLs = metadata.SameEntryTTLs(time.Minute)
+	t.fsTest.SetUpTestSuite()
+}
+
+////////////////////////////////////////////////////////////////////////
+// Tests
+////////////////////////////////////////////////////////////////////////
+
+func (t *PermissionDeniedTest) DeniedDirIsListed() {
+	AssertEq(nil, t.createObjects(map[string]string{
+		"denied/":    "",
+		"denied/foo": "taco",
+		"bar":        "",
+	}))
+
+	entries, err := fusetesting.ReadDirPicky(mntDir)
+
+	AssertEq(nil, err)
+	AssertEq(2, len(entries))
+	ExpectEq("bar", entries[0].Name())
+	ExpectEq("denied", entries[1].Name())
+	ExpectTrue(entries[1].IsDir())
+}
+
+func (t *PermissionDeniedTest) StatDeniedDir() {
+	AssertEq(nil, t.createObjects(map[string]string{
+		"denied/":    "",
+		"denied/foo": "taco",
+	}))
+	_, err := fusetesting.ReadDirPicky(mntDir)
+	AssertEq(nil, err)
+
+	fi, err := os.Stat(path.Join(mntDir, "denied"))
+
+	AssertEq(nil, err)
+	ExpectTrue(fi.IsDir())
+}
+
+func (t *PermissionDeniedTest) ReadDeniedDir() {
+	AssertEq(nil, t.createObjects(map[string]string{
+		"denied/":    "",
+		"denied/foo": "taco",
+	}))
+	_, err := fusetesting.ReadDirPicky(mntDir)
+	AssertEq(nil, err)
+
+	_, err = os.ReadDir(path.Join(mntDir, "denied"))
+	ExpectTrue(errors.Is(err, syscall.EACCES), "%v", err)
+	lists := deniedBucket.lists.Load()
+
+	// The denial is remembered, so opening the directory again fails without
+	// asking GCS.
+	_, err = os.Open(path.Join(mntDir, "denied"))
+	ExpectTrue(errors.Is(err, syscall.EACCES), "%v", err)
+	ExpectEq(lists, deniedBucket.lists.Load())
+}
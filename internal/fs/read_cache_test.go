@@ -22,7 +22,6 @@ import (
 	"reflect"
 	"strings"
 	"sync"
-	"syscall"
 	"time"
 
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/util"
@@ -97,7 +96,7 @@ func sequentialReadShouldPopulateCache(t *fsTest, cacheDir string) {
 	err := t.createObjects(objects)
 	AssertEq(nil, err)
 	filePath := path.Join(mntDir, DefaultObjectName)
-	file, err := os.OpenFile(filePath, os.O_RDWR|syscall.O_DIRECT, util.DefaultFilePerm)
+	file, err := os.OpenFile(filePath, os.O_RDWR|oDirect, util.DefaultFilePerm)
 	defer closeFile(file)
 	AssertEq(nil, err)
 
@@ -120,7 +119,7 @@ func cacheFilePermissionTest(t *fsTest, fileMode os.FileMode) {
 	err := t.createObjects(objects)
 	AssertEq(nil, err)
 	filePath := path.Join(mntDir, DefaultObjectName)
-	file, err := os.OpenFile(filePath, os.O_RDWR|syscall.O_DIRECT, util.DefaultFilePerm)
+	file, err := os.OpenFile(filePath, os.O_RDWR|oDirect, util.DefaultFilePerm)
 	defer closeFile(file)
 	AssertEq(nil, err)
 
@@ -141,7 +140,7 @@ func cacheFilePermissionTest(t *fsTest, fileMode os.FileMode) {
 func writeShouldNotPopulateCache(t *fsTest) {
 	objectContent := generateRandomString(DefaultObjectSizeInMb * util.MiB)
 	filePath := path.Join(mntDir, DefaultObjectName)
-	file, err := os.OpenFile(filePath, os.O_RDWR|syscall.O_DIRECT|os.O_CREATE, util.DefaultFilePerm)
+	file, err := os.OpenFile(filePath, os.O_RDWR|oDirect|os.O_CREATE, util.DefaultFilePerm)
 	defer closeFile(file)
 	AssertEq(nil, err)
 
@@ -164,7 +163,7 @@ func sequentialToRandomReadShouldPopulateCache(t *fsTest) {
 	err := t.createObjects(objects)
 	AssertEq(nil, err)
 	filePath := path.Join(mntDir, DefaultObjectName)
-	file, err := os.OpenFile(filePath, os.O_RDWR|syscall.O_DIRECT, util.DefaultFilePerm)
+	file, err := os.OpenFile(filePath, os.O_RDWR|oDirect, util.DefaultFilePerm)
 	defer closeFile(file)
 	AssertEq(nil, err)
 	// Sequential read
@@ -203,13 +202,13 @@ func (t *FileCacheTest) ReadShouldChangeLRU() {
 	AssertEq(nil, err)
 	// Open and read files for object 1 & 2, filet 1 should be LRU after that.
 	buf := make([]byte, 10)
-	fileHandle1, err := os.OpenFile(path.Join(mntDir, objectName1), os.O_RDONLY|syscall.O_DIRECT, 0644)
+	fileHandle1, err := os.OpenFile(path.Join(mntDir, objectName1), os.O_RDONLY|oDirect, 0644)
 	defer closeFile(fileHandle1)
 	AssertEq(nil, err)
 	_, err = fileHandle1.ReadAt(buf, 0)
 	AssertEq(nil, err)
 	AssertEq(string(buf), objectContent1[0:len(buf)])
-	fileHandle2, err := os.OpenFile(path.Join(mntDir, objectName2), os.O_RDONLY|syscall.O_DIRECT, 0644)
+	fileHandle2, err := os.OpenFile(path.Join(mntDir, objectName2), os.O_RDONLY|oDirect, 0644)
 	defer closeFile(fileHandle2)
 	AssertEq(nil, err)
 	_, err = fileHandle2.ReadAt(buf, 0)
@@ -230,7 +229,7 @@ func (t *FileCacheTest) ReadShouldChangeLRU() {
 	_, err = fileHandle1.ReadAt(buf, 0)
 	AssertEq(nil, err)
 	AssertEq(string(buf), objectContent1[0:len(buf)])
-	fileHandle3, err := os.OpenFile(path.Join(mntDir, objectName3), os.O_RDONLY|syscall.O_DIRECT, 0644)
+	fileHandle3, err := os.OpenFile(path.Join(mntDir, objectName3), os.O_RDONLY|oDirect, 0644)
 	defer closeFile(fileHandle3)
 	AssertEq(nil, err)
 	_, err = fileHandle3.ReadAt(buf, 0)
@@ -267,7 +266,7 @@ func (t *FileCacheTest) FileSizeGreaterThanCacheSize() {
 	err := t.createObjects(objects)
 	AssertEq(nil, err)
 	filePath := path.Join(mntDir, DefaultObjectName)
-	file, err := os.OpenFile(filePath, os.O_RDWR|syscall.O_DIRECT, util.DefaultFilePerm)
+	file, err := os.OpenFile(filePath, os.O_RDWR|oDirect, util.DefaultFilePerm)
 	defer closeFile(file)
 	AssertEq(nil, err)
 
@@ -321,7 +320,7 @@ func (t *FileCacheTest) RandomReadShouldNotPopulateCache() {
 	err := t.createObjects(objects)
 	AssertEq(nil, err)
 	filePath := path.Join(mntDir, DefaultObjectName)
-	file, err := os.OpenFile(filePath, os.O_RDWR|syscall.O_DIRECT, util.DefaultFilePerm)
+	file, err := os.OpenFile(filePath, os.O_RDWR|oDirect, util.DefaultFilePerm)
 	defer closeFile(file)
 	AssertEq(nil, err)
 	// randomly read object with cache enabled should not populate cache
@@ -347,7 +346,7 @@ func (t *FileCacheTest) ReadWithNewHandleAfterDeletingFileFromCacheShouldFail()
 	err := t.createObjects(objects)
 	AssertEq(nil, err)
 	filePath := path.Join(mntDir, DefaultObjectName)
-	file, err := os.OpenFile(filePath, os.O_RDWR|syscall.O_DIRECT, util.DefaultFilePerm)
+	file, err := os.OpenFile(filePath, os.O_RDWR|oDirect, util.DefaultFilePerm)
 	AssertEq(nil, err)
 	buf := make([]byte, len(objectContent))
 	_, err = file.Read(buf)
@@ -355,7 +354,7 @@ func (t *FileCacheTest) ReadWithNewHandleAfterDeletingFileFromCacheShouldFail()
 	closeFile(file)
 	objectPath := util.GetObjectPath(bucket.Name(), DefaultObjectName)
 	downloadPath := util.GetDownloadPath(FileCacheDir, objectPath)
-	file, err = os.OpenFile(filePath, os.O_RDWR|syscall.O_DIRECT, util.DefaultFilePerm)
+	file, err = os.OpenFile(filePath, os.O_RDWR|oDirect, util.DefaultFilePerm)
 	AssertEq(nil, err)
 	// delete the file in cache
 	err = os.Remove(downloadPath)
@@ -376,7 +375,7 @@ func (t *FileCacheTest) ReadWithOldHandleAfterDeletingFileFromCacheShouldNotFail
 	err := t.createObjects(objects)
 	AssertEq(nil, err)
 	filePath := path.Join(mntDir, DefaultObjectName)
-	file, err := os.OpenFile(filePath, os.O_RDWR|syscall.O_DIRECT, util.DefaultFilePerm)
+	file, err := os.OpenFile(filePath, os.O_RDWR|oDirect, util.DefaultFilePerm)
 	AssertEq(nil, err)
 	defer closeFile(file)
 	buf := make([]byte, len(objectContent))
@@ -403,7 +402,7 @@ func (t *FileCacheTest) DeletingObjectShouldInvalidateTheCorrespondingCache() {
 	err := t.createObjects(objects)
 	AssertEq(nil, err)
 	filePath := path.Join(mntDir, DefaultObjectName)
-	file, err := os.OpenFile(filePath, os.O_RDWR|syscall.O_DIRECT, util.DefaultFilePerm)
+	file, err := os.OpenFile(filePath, os.O_RDWR|oDirect, util.DefaultFilePerm)
 	AssertEq(nil, err)
 	buf := make([]byte, len(objectContent))
 	_, err = file.Read(buf)
@@ -429,7 +428,7 @@ func (t *FileCacheTest) RenamingObjectShouldInvalidateTheCorrespondingCache() {
 	err := t.createObjects(objects)
 	AssertEq(nil, err)
 	filePath := path.Join(mntDir, DefaultObjectName)
-	file, err := os.OpenFile(filePath, os.O_RDWR|syscall.O_DIRECT, util.DefaultFilePerm)
+	file, err := os.OpenFile(filePath, os.O_RDWR|oDirect, util.DefaultFilePerm)
 	AssertEq(nil, err)
 	buf := make([]byte, len(objectContent))
 	_, err = file.Read(buf)
@@ -456,7 +455,7 @@ func (t *FileCacheTest) RenamingDirShouldInvalidateTheCacheOfNestedObject() {
 	err := t.createObjects(objects)
 	AssertEq(nil, err)
 	filePath := path.Join(mntDir, NestedDefaultObjectName)
-	file, err := os.OpenFile(filePath, os.O_RDWR|syscall.O_DIRECT, util.DefaultFilePerm)
+	file, err := os.OpenFile(filePath, os.O_RDWR|oDirect, util.DefaultFilePerm)
 	AssertEq(nil, err)
 	buf := make([]byte, len(objectContent))
 	_, err = file.Read(buf)
@@ -484,7 +483,7 @@ func (t *FileCacheTest) ConcurrentReadsFromSameFileHandle() {
 	err := t.createObjects(objects)
 	AssertEq(nil, err)
 	filePath := path.Join(mntDir, DefaultObjectName)
-	file, err := os.OpenFile(filePath, os.O_RDWR|syscall.O_DIRECT, util.DefaultFilePerm)
+	file, err := os.OpenFile(filePath, os.O_RDWR|oDirect, util.DefaultFilePerm)
 	defer closeFile(file)
 	AssertEq(nil, err)
 	wg := sync.WaitGroup{}
@@ -540,7 +539,7 @@ func (t *FileCacheTest) WriteToFileCachedAndThenReadingItShouldBeCorrect() {
 	// write content to file that is cached.
 	objectContent := generateRandomString(DefaultObjectSizeInMb * util.MiB)
 	filePath := path.Join(mntDir, DefaultObjectName)
-	file, err := os.OpenFile(filePath, os.O_RDWR|syscall.O_DIRECT|os.O_CREATE, util.DefaultFilePerm)
+	file, err := os.OpenFile(filePath, os.O_RDWR|oDirect|os.O_CREATE, util.DefaultFilePerm)
 	defer closeFile(file)
 	AssertEq(nil, err)
 	// Write to file after reading
@@ -568,7 +567,7 @@ func (t *FileCacheTest) SyncToFileCachedAndThenReadingItShouldBeCorrect() {
 	// write and sync content to file that is cached.
 	objectContent := generateRandomString(DefaultObjectSizeInMb * util.MiB)
 	filePath := path.Join(mntDir, DefaultObjectName)
-	file, err := os.OpenFile(filePath, os.O_RDWR|syscall.O_DIRECT|os.O_CREATE, util.DefaultFilePerm)
+	file, err := os.OpenFile(filePath, os.O_RDWR|oDirect|os.O_CREATE, util.DefaultFilePerm)
 	defer closeFile(file)
 	AssertEq(nil, err)
 	// Write and sync to file after reading
@@ -623,7 +622,7 @@ func (t *FileCacheWithCacheForRangeRead) RandomReadShouldPopulateCache() {
 	err := t.createObjects(objects)
 	AssertEq(nil, err)
 	filePath := path.Join(mntDir, DefaultObjectName)
-	file, err := os.OpenFile(filePath, os.O_RDWR|syscall.O_DIRECT, util.DefaultFilePerm)
+	file, err := os.OpenFile(filePath, os.O_RDWR|oDirect, util.DefaultFilePerm)
 	AssertEq(nil, err)
 	defer closeFile(file)
 
@@ -639,7 +638,7 @@ func (t *FileCacheWithCacheForRangeRead) RandomReadShouldPopulateCache() {
 	downloadPath := util.GetDownloadPath(FileCacheDir, objectPath)
 	// Sleep for async job to complete download
 	time.Sleep(50 * time.Millisecond)
-	cacheFile, err := os.OpenFile(downloadPath, os.O_RDWR|syscall.O_DIRECT, 0644)
+	cacheFile, err := os.OpenFile(downloadPath, os.O_RDWR|oDirect, 0644)
 	AssertEq(nil, err)
 	defer closeFile(cacheFile)
 	cachedContent := make([]byte, hundredKiB)
@@ -715,7 +714,7 @@ func (t *FileCacheTest) ModifyFileInCacheAndThenReadShouldGiveModifiedData() {
 	AssertEq(nil, err)
 
 	// read the file again, should give modified content
-	file, err := os.OpenFile(filePath, os.O_RDWR|syscall.O_DIRECT, os.FileMode(0655))
+	file, err := os.OpenFile(filePath, os.O_RDWR|oDirect, os.FileMode(0655))
 	defer closeFile(file)
 	AssertEq(nil, err)
 	buf := make([]byte, len(objectContent))
@@ -752,7 +751,7 @@ func (t *FileCacheIsDisabledWithCacheDirAndZeroMaxSize) ReadingFileDoesNotPopula
 	err := t.createObjects(objects)
 	AssertEq(nil, err)
 	filePath := path.Join(mntDir, DefaultObjectName)
-	file, err := os.OpenFile(filePath, os.O_RDWR|syscall.O_DIRECT, util.DefaultFilePerm)
+	file, err := os.OpenFile(filePath, os.O_RDWR|oDirect, util.DefaultFilePerm)
 	defer closeFile(file)
 	AssertEq(nil, err)
 
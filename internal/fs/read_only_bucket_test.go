@@ -0,0 +1,165 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Tests for serving buckets read-only, calling the file system directly.
+
+package fs_test
+
+import (
+	"context"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/config"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/fs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/locker"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/fuseutil"
+	. "github.com/jacobsa/oglematchers"
+	. "github.com/jacobsa/ogletest"
+	"github.com/jacobsa/timeutil"
+)
+
+type ReadOnlyBucketTest struct {
+	ctx     context.Context
+	bucket  gcs.Bucket
+	tempDir string
+	fs      fuseutil.FileSystem
+}
+
+func init() { RegisterTestSuite(&ReadOnlyBucketTest{}) }
+
+func (t *ReadOnlyBucketTest) SetUp(ti *TestInfo) {
+	locker.EnableInvariantsCheck()
+	t.ctx = ti.Ctx
+
+	var err error
+	t.tempDir, err = os.MkdirTemp("", "read_only_bucket_test")
+	AssertEq(nil, err)
+}
+
+func (t *ReadOnlyBucketTest) TearDown() {
+	if t.fs != nil {
+		t.fs.Destroy()
+	}
+	os.RemoveAll(t.tempDir)
+}
+
+// Create the bucket with the given retention policy, holding the object foo,
+// and mount it.
+func (t *ReadOnlyBucketTest) mount(policy *gcs.RetentionPolicy, assumeReadOnly bool) {
+	if policy != nil {
+		t.bucket = fake.NewFakeBucketWithRetentionPolicy(timeutil.RealClock(), "some_bucket", *policy)
+	} else {
+		t.bucket = fake.NewFakeBucket(timeutil.RealClock(), "some_bucket")
+	}
+	AssertEq(nil, storageutil.CreateObjects(t.ctx, t.bucket, map[string][]byte{"foo": []byte("taco")}))
+
+	var err error
+	t.fs, err = fs.NewFileSystem(t.ctx, &fs.ServerConfig{
+		CacheClock: timeutil.RealClock(),
+		BucketName: t.bucket.Name(),
+		BucketManager: &fakeBucketManager{
+			buckets:         map[string]gcs.Bucket{t.bucket.Name(): t.bucket},
+			tmpObjectPrefix: ".gcsfuse_tmp/",
+		},
+		TempDir:              t.tempDir,
+		ReadOnly:             assumeReadOnly,
+		MaxParallelUploads:   4,
+		FilePerms:            filePerms,
+		DirPerms:             dirPerms,
+		SequentialReadSizeMb: SequentialReadSizeMb,
+		MountConfig:          config.NewMountConfig(),
+	})
+	AssertEq(nil, err)
+}
+
+func (t *ReadOnlyBucketTest) lookUpFoo() fuseops.InodeID {
+	op := &fuseops.LookUpInodeOp{Parent: fuseops.RootInodeID, Name: "foo"}
+	AssertEq(nil, t.fs.LookUpInode(t.ctx, op))
+	return op.Entry.Child
+}
+
+// Try every kind of change, expecting each to fail with EROFS and leave the
+// bucket and the temporary directory untouched, and read foo.
+func (t *ReadOnlyBucketTest) expectReadOnly() {
+	foo := t.lookUpFoo()
+
+	ExpectEq(syscall.EROFS, t.fs.CreateFile(t.ctx, &fuseops.CreateFileOp{Parent: fuseops.RootInodeID, Name: "bar", Mode: filePerms}))
+	ExpectEq(syscall.EROFS, t.fs.MkDir(t.ctx, &fuseops.MkDirOp{Parent: fuseops.RootInodeID, Name: "dir", Mode: dirPerms}))
+	ExpectEq(syscall.EROFS, t.fs.Unlink(t.ctx, &fuseops.UnlinkOp{Parent: fuseops.RootInodeID, Name: "foo"}))
+	ExpectEq(syscall.EROFS, t.fs.Rename(t.ctx, &fuseops.RenameOp{
+		OldParent: fuseops.RootInodeID,
+		OldName:   "foo",
+		NewParent: fuseops.RootInodeID,
+		NewName:   "baz",
+	}))
+	size := uint64(0)
+	ExpectEq(syscall.EROFS, t.fs.SetInodeAttributes(t.ctx, &fuseops.SetInodeAttributesOp{Inode: foo, Size: &size}))
+	ExpectEq(syscall.EROFS, t.fs.OpenFile(t.ctx, &fuseops.OpenFileOp{Inode: foo, OpenFlags: syscall.O_RDWR}))
+
+	// Reading works.
+	open := &fuseops.OpenFileOp{Inode: foo}
+	AssertEq(nil, t.fs.OpenFile(t.ctx, open))
+	read := &fuseops.ReadFileOp{Inode: foo, Handle: open.Handle, Dst: make([]byte, 4)}
+	AssertEq(nil, t.fs.ReadFile(t.ctx, read))
+	ExpectEq("taco", string(read.Dst[:read.BytesRead]))
+	AssertEq(nil, t.fs.ReleaseFileHandle(t.ctx, &fuseops.ReleaseFileHandleOp{Handle: open.Handle}))
+
+	contents, err := storageutil.ReadObject(t.ctx, t.bucket, "foo")
+	AssertEq(nil, err)
+	ExpectEq("taco", string(contents))
+	objects, _, err := storageutil.ListAll(t.ctx, t.bucket, &gcs.ListObjectsRequest{})
+	AssertEq(nil, err)
+	ExpectEq(1, len(objects))
+
+	// Nothing was staged.
+	entries, err := os.ReadDir(t.tempDir)
+	AssertEq(nil, err)
+	ExpectThat(entries, ElementsAre())
+}
+
+////////////////////////////////////////////////////////////////////////
+// Tests
+////////////////////////////////////////////////////////////////////////
+
+func (t *ReadOnlyBucketTest) LockedRetentionPolicy() {
+	t.mount(&gcs.RetentionPolicy{RetentionPeriod: 365 * 24 * time.Hour, Locked: true}, false)
+
+	t.expectReadOnly()
+}
+
+func (t *ReadOnlyBucketTest) AssumeReadOnly() {
+	t.mount(nil, true)
+
+	t.expectReadOnly()
+}
+
+func (t *ReadOnlyBucketTest) UnlockedRetentionPolicyIsWritable() {
+	t.mount(&gcs.RetentionPolicy{RetentionPeriod: time.Hour}, false)
+
+	create := &fuseops.CreateFileOp{Parent: fuseops.RootInodeID, Name: "bar", Mode: filePerms}
+	AssertEq(nil, t.fs.CreateFile(t.ctx, create))
+	write := &fuseops.WriteFileOp{Inode: create.Entry.Child, Handle: create.Handle, Data: []byte("burrito")}
+	AssertEq(nil, t.fs.WriteFile(t.ctx, write))
+	AssertEq(nil, t.fs.SyncFile(t.ctx, &fuseops.SyncFileOp{Inode: create.Entry.Child, Handle: create.Handle}))
+
+	contents, err := storageutil.ReadObject(t.ctx, t.bucket, "bar")
+	AssertEq(nil, err)
+	ExpectEq("burrito", string(contents))
+}
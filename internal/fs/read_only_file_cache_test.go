@@ -0,0 +1,150 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// A file system with a read-only file cache, warmed before it's mounted.
+
+package fs_test
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/data"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/util"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/config"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	. "github.com/jacobsa/ogletest"
+	"github.com/jacobsa/timeutil"
+)
+
+var ReadOnlyCacheDir = path.Join(os.Getenv("HOME"), "read-only-cache-dir")
+
+const warmObjectName = "warm"
+
+var warmObjectContent = generateRandomString(util.MiB)
+
+type ReadOnlyFileCacheTest struct {
+	fsTest
+}
+
+func init() { RegisterTestSuite(&ReadOnlyFileCacheTest{}) }
+
+// Set the mode of the directories of the cache.
+func chmodReadOnlyCacheDir(mode os.FileMode) {
+	err := filepath.WalkDir(ReadOnlyCacheDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return err
+		}
+		return os.Chmod(p, mode)
+	})
+	AssertEq(nil, err)
+}
+
+// Return the paths of the files in the cache.
+func listReadOnlyCacheDir() (paths []string) {
+	err := filepath.WalkDir(ReadOnlyCacheDir, func(p string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			paths = append(paths, p)
+		}
+		return err
+	})
+	AssertEq(nil, err)
+	return
+}
+
+func (t *ReadOnlyFileCacheTest) SetUpTestSuite() {
+	ctx = context.Background()
+	readCounter = fake.NewCountingBucket(fake.NewFakeBucket(timeutil.RealClock(), "some_bucket"))
+	bucket = readCounter
+
+	// Warm the cache with the object, as a process sharing it would.
+	o, err := storageutil.CreateObject(ctx, bucket, warmObjectName, []byte(warmObjectContent))
+	AssertEq(nil, err)
+	cacheDir := path.Join(ReadOnlyCacheDir, util.FileCache)
+	objectPath := util.GetObjectPath(bucket.Name(), warmObjectName)
+	downloadPath := util.GetDownloadPath(cacheDir, objectPath)
+	AssertEq(nil, os.MkdirAll(path.Dir(downloadPath), util.DefaultDirPerm))
+	AssertEq(nil, os.WriteFile(downloadPath, []byte(warmObjectContent), util.DefaultFilePerm))
+	err = util.WriteSharedEntry(
+		data.FileSpec{Path: util.GetSharedEntryPath(cacheDir, objectPath), FilePerm: util.DefaultFilePerm, DirPerm: util.DefaultDirPerm},
+		data.SharedEntry{
+			Key:              data.FileInfoKey{BucketName: bucket.Name(), ObjectName: warmObjectName},
+			ObjectGeneration: o.Generation,
+			FileSize:         o.Size,
+			CRC32C:           o.CRC32C,
+		})
+	AssertEq(nil, err)
+	chmodReadOnlyCacheDir(0555)
+
+	t.serverCfg.ImplicitDirectories = true
+	t.serverCfg.MountConfig = &config.MountConfig{
+		FileCacheConfig: config.FileCacheConfig{
+			MaxSizeMB: FileCacheSizeInMb,
+			ReadOnly:  true,
+		},
+		CacheDir: config.CacheDir(ReadOnlyCacheDir),
+	}
+	t.fsTest.SetUpTestSuite()
+}
+
+func (t *ReadOnlyFileCacheTest) TearDownTestSuite() {
+	t.fsTest.TearDownTestSuite()
+	chmodReadOnlyCacheDir(0755)
+	AssertEq(nil, os.RemoveAll(ReadOnlyCacheDir))
+}
+
+func (t *ReadOnlyFileCacheTest) SetUp(ti *TestInfo) {
+	readCounter.Reset()
+}
+
+// TearDown keeps the object in the cache, which the tests only read.
+func (t *ReadOnlyFileCacheTest) TearDown() {
+	err := os.Remove(path.Join(mntDir, DefaultObjectName))
+	if !os.IsNotExist(err) {
+		AssertEq(nil, err)
+	}
+}
+
+////////////////////////////////////////////////////////////////////////
+// Tests
+////////////////////////////////////////////////////////////////////////
+
+func (t *ReadOnlyFileCacheTest) ReadsFileInCache() {
+	files := listReadOnlyCacheDir()
+
+	buf, err := os.ReadFile(path.Join(mntDir, warmObjectName))
+
+	AssertEq(nil, err)
+	ExpectTrue(warmObjectContent == string(buf))
+	ExpectEq(0, readCounter.Count("NewReader"))
+	ExpectEq(len(files), len(listReadOnlyCacheDir()))
+}
+
+func (t *ReadOnlyFileCacheTest) ReadsFromGCSFileNotInCache() {
+	files := listReadOnlyCacheDir()
+	objectContent := generateRandomString(util.MiB)
+	AssertEq(nil, t.createWithContents(DefaultObjectName, objectContent))
+
+	buf, err := os.ReadFile(path.Join(mntDir, DefaultObjectName))
+
+	AssertEq(nil, err)
+	ExpectTrue(objectContent == string(buf))
+	ExpectLt(0, readCounter.Count("NewReader"))
+	// Nothing is added to the cache.
+	ExpectEq(len(files), len(listReadOnlyCacheDir()))
+}
@@ -0,0 +1,220 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Tests for renames of files that must not lose the object, calling the file
+// system directly.
+
+package fs_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"syscall"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/config"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/fs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/fs/inode"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/locker"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/fuseutil"
+	. "github.com/jacobsa/oglematchers"
+	. "github.com/jacobsa/ogletest"
+	"github.com/jacobsa/timeutil"
+)
+
+////////////////////////////////////////////////////////////////////////
+// Boilerplate
+////////////////////////////////////////////////////////////////////////
+
+// renameTrackingBucket counts copies and deletions, and can fail deletions
+// or shorten copies.
+type renameTrackingBucket struct {
+	gcs.Bucket
+
+	mu sync.Mutex
+
+	// GUARDED_BY(mu)
+	copies        int
+	deletes       int
+	failDeletes   bool
+	shortenCopies bool
+}
+
+func (b *renameTrackingBucket) CopyObject(
+	ctx context.Context,
+	req *gcs.CopyObjectRequest) (*gcs.Object, error) {
+	b.mu.Lock()
+	b.copies++
+	shorten := b.shortenCopies
+	b.mu.Unlock()
+
+	o, err := b.Bucket.CopyObject(ctx, req)
+	if err == nil && shorten {
+		o.Size--
+	}
+	return o, err
+}
+
+func (b *renameTrackingBucket) DeleteObject(
+	ctx context.Context,
+	req *gcs.DeleteObjectRequest) error {
+	b.mu.Lock()
+	b.deletes++
+	fail := b.failDeletes
+	b.mu.Unlock()
+
+	// Stands for gcsfuse dying between the copy and the deletion.
+	if fail {
+		return errors.New("deletion interrupted")
+	}
+	return b.Bucket.DeleteObject(ctx, req)
+}
+
+func (b *renameTrackingBucket) counts() (copies int, deletes int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.copies, b.deletes
+}
+
+type RenameSafetyTest struct {
+	ctx      context.Context
+	fs       fuseutil.FileSystem
+	bucket   *renameTrackingBucket
+	cacheDir string
+}
+
+func init() { RegisterTestSuite(&RenameSafetyTest{}) }
+
+func (t *RenameSafetyTest) SetUp(ti *TestInfo) {
+	locker.EnableInvariantsCheck()
+	t.ctx = ti.Ctx
+
+	t.bucket = &renameTrackingBucket{Bucket: fake.NewFakeBucket(timeutil.RealClock(), "some_bucket")}
+	AssertEq(nil, storageutil.CreateObjects(t.ctx, t.bucket, map[string][]byte{"foo": []byte("taco")}))
+
+	var err error
+	t.cacheDir, err = os.MkdirTemp("", "rename_safety_test")
+	AssertEq(nil, err)
+	mountConfig := config.NewMountConfig()
+	mountConfig.CacheDir = config.CacheDir(t.cacheDir)
+	t.fs, err = fs.NewFileSystem(t.ctx, &fs.ServerConfig{
+		CacheClock: timeutil.RealClock(),
+		BucketName: t.bucket.Name(),
+		BucketManager: &fakeBucketManager{
+			buckets:         map[string]gcs.Bucket{t.bucket.Name(): t.bucket},
+			tmpObjectPrefix: ".gcsfuse_tmp/",
+		},
+		FilePerms:            filePerms,
+		DirPerms:             dirPerms,
+		SequentialReadSizeMb: SequentialReadSizeMb,
+		MountConfig:          mountConfig,
+	})
+	AssertEq(nil, err)
+}
+
+func (t *RenameSafetyTest) TearDown() {
+	t.fs.Destroy()
+	_ = os.RemoveAll(t.cacheDir)
+}
+
+func (t *RenameSafetyTest) rename(oldName string, newName string) error {
+	return t.fs.Rename(t.ctx, &fuseops.RenameOp{
+		OldParent: fuseops.RootInodeID,
+		OldName:   oldName,
+		NewParent: fuseops.RootInodeID,
+		NewName:   newName,
+	})
+}
+
+// Return the contents of the named object, or an error if it doesn't exist.
+func (t *RenameSafetyTest) read(name string) (string, error) {
+	contents, err := storageutil.ReadObject(t.ctx, t.bucket.Bucket, name)
+	return string(contents), err
+}
+
+////////////////////////////////////////////////////////////////////////
+// Tests
+////////////////////////////////////////////////////////////////////////
+
+func (t *RenameSafetyTest) IdenticalName() {
+	AssertEq(nil, t.rename("foo", "foo"))
+
+	copies, deletes := t.bucket.counts()
+	ExpectEq(0, copies)
+	ExpectEq(0, deletes)
+	contents, err := t.read("foo")
+	AssertEq(nil, err)
+	ExpectEq("taco", contents)
+}
+
+func (t *RenameSafetyTest) ConflictMarkerToOwnName() {
+	// With a directory of the same name, the file is only reachable by its
+	// conflict marker name, which names the same object as its own name.
+	AssertEq(nil, storageutil.CreateObjects(t.ctx, t.bucket, map[string][]byte{"foo/": nil}))
+
+	AssertEq(nil, t.rename("foo"+inode.ConflictingFileNameSuffix, "foo"))
+
+	copies, deletes := t.bucket.counts()
+	ExpectEq(0, copies)
+	ExpectEq(0, deletes)
+	contents, err := t.read("foo")
+	AssertEq(nil, err)
+	ExpectEq("taco", contents)
+}
+
+func (t *RenameSafetyTest) CaseChange() {
+	AssertEq(nil, t.rename("foo", "FOO"))
+
+	copies, deletes := t.bucket.counts()
+	ExpectEq(1, copies)
+	ExpectEq(1, deletes)
+	contents, err := t.read("FOO")
+	AssertEq(nil, err)
+	ExpectEq("taco", contents)
+	_, err = t.read("foo")
+	ExpectThat(err, HasSameTypeAs(&gcs.NotFoundError{}))
+}
+
+func (t *RenameSafetyTest) InterruptedBetweenCopyAndDelete() {
+	t.bucket.failDeletes = true
+
+	err := t.rename("foo", "FOO")
+
+	ExpectThat(err, Error(HasSubstr("deletion interrupted")))
+	// Both objects are left, rather than neither.
+	contents, err := t.read("foo")
+	AssertEq(nil, err)
+	ExpectEq("taco", contents)
+	contents, err = t.read("FOO")
+	AssertEq(nil, err)
+	ExpectEq("taco", contents)
+}
+
+func (t *RenameSafetyTest) CopyNotVerified() {
+	t.bucket.shortenCopies = true
+
+	err := t.rename("foo", "FOO")
+
+	ExpectTrue(errors.Is(err, syscall.EIO), "err: %v", err)
+	_, deletes := t.bucket.counts()
+	ExpectEq(0, deletes)
+	contents, err := t.read("foo")
+	AssertEq(nil, err)
+	ExpectEq("taco", contents)
+}
@@ -18,6 +18,7 @@ import (
 	"fmt"
 
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/fs/wrappers"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/gcsx"
 	"github.com/jacobsa/fuse"
 	"github.com/jacobsa/fuse/fuseutil"
 	"golang.org/x/net/context"
@@ -30,7 +31,28 @@ func NewServer(ctx context.Context, cfg *ServerConfig) (fuse.Server, error) {
 		return nil, fmt.Errorf("create file system: %w", err)
 	}
 
+	return newServer(fs, cfg), nil
+}
+
+// NewLazyServer is like NewServer, but leaves creating the file system, with
+// the bucket manager that newBucketManager creates rather than
+// cfg.BucketManager, to the first operation that needs it. Operations fail with
+// the error if that fails.
+func NewLazyServer(
+	cfg *ServerConfig,
+	newBucketManager func() (gcsx.BucketManager, error)) fuse.Server {
+	return newServer(newLazyFileSystem(cfg, newBucketManager), cfg)
+}
+
+func newServer(fs fuseutil.FileSystem, cfg *ServerConfig) fuse.Server {
+	// The op metadata is sent in a header of the requests to GCS, and included
+	// in the records of upload progress.
+	if cfg.MountConfig.GCSConnectionConfig.OpMetadataHeader != "" ||
+		cfg.MountConfig.LogConfig.UploadProgress.IntervalMB > 0 {
+		fs = wrappers.WithOpMetadata(fs)
+	}
+	fs = wrappers.WithParallelism(fs, cfg.FuseParallelism)
 	fs = wrappers.WithErrorMapping(fs)
-	fs = wrappers.WithMonitoring(fs)
-	return fuseutil.NewFileSystemServer(fs), nil
+	fs = wrappers.WithMonitoring(fs, cfg.MonitoringOptions)
+	return fuseutil.NewFileSystemServer(fs)
 }
@@ -0,0 +1,72 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Tests for the summary of the session written when the file system is
+// destroyed at unmount.
+
+package fs_test
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/monitor"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
+	"github.com/jacobsa/timeutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionSummary(t *testing.T) {
+	counter := fake.NewCountingBucket(fake.NewFakeBucket(timeutil.RealClock(), "some_bucket"))
+	bucket = monitor.NewMonitoringBucket(counter)
+	summaryFile := path.Join(t.TempDir(), "summary.json")
+	var ft fsTest
+	ft.serverCfg.MonitoringOptions.SessionSummaryFile = summaryFile
+	ft.SetUpTestSuite()
+
+	// Write two files, read an object, and fail to remove a non-empty
+	// directory. The file written isn't read back, as the kernel would serve
+	// it from the page cache.
+	require.NoError(t, ft.createWithContents("baz", "enchilada"))
+	require.NoError(t, os.Mkdir(path.Join(mntDir, "dir"), 0700))
+	require.NoError(t, os.WriteFile(path.Join(mntDir, "dir", "foo"), []byte("taco"), 0600))
+	require.NoError(t, os.WriteFile(path.Join(mntDir, "bar"), []byte("burrito"), 0600))
+	contents, err := os.ReadFile(path.Join(mntDir, "baz"))
+	require.NoError(t, err)
+	require.Equal(t, "enchilada", string(contents))
+	require.Error(t, os.Remove(path.Join(mntDir, "dir")))
+	ft.TearDownTestSuite()
+
+	b, err := os.ReadFile(summaryFile)
+	require.NoError(t, err)
+	var summary monitor.SessionSummary
+	require.NoError(t, json.Unmarshal(b, &summary))
+	assert.Equal(t, int64(1), summary.OpsCount["MkDir"])
+	assert.Equal(t, int64(2), summary.OpsCount["CreateFile"])
+	assert.Equal(t, int64(1), summary.OpsCount["RmDir"])
+	assert.Equal(t, int64(1), summary.OpsErrorCount["directory not empty"])
+	assert.Equal(t, int64(len("taco")+len("burrito")), summary.WrittenBytes)
+	assert.Equal(t, int64(len("enchilada")), summary.ReadBytes)
+	// The retention policy is fetched as the file system is set up, before the
+	// session starts.
+	requests := counter.Counts()
+	delete(requests, "GetRetentionPolicy")
+	assert.Equal(t, requests, summary.GCSRequestCount)
+	assert.Zero(t, summary.FileCacheHitRatio)
+	assert.Positive(t, summary.PeakMemoryBytes)
+	assert.Positive(t, summary.DurationSeconds)
+}
@@ -0,0 +1,142 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// A file system sharing its file cache with a second one mounting the same
+// bucket, as two gcsfuse processes would.
+
+package fs_test
+
+import (
+	"os"
+	"path"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/util"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/config"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/fs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/jacobsa/fuse"
+	. "github.com/jacobsa/ogletest"
+)
+
+var SharedCacheDir = path.Join(os.Getenv("HOME"), "shared-cache-dir")
+
+// The second file system, reading the files that the first downloads into the
+// cache.
+var (
+	readerBucket *fake.CountingBucket
+	readerMfs    *fuse.MountedFileSystem
+)
+
+type SharedFileCacheTest struct {
+	fsTest
+}
+
+func init() { RegisterTestSuite(&SharedFileCacheTest{}) }
+
+func (t *SharedFileCacheTest) SetUpTestSuite() {
+	t.serverCfg.ImplicitDirectories = true
+	t.serverCfg.MountConfig = &config.MountConfig{
+		FileCacheConfig: config.FileCacheConfig{
+			MaxSizeMB: FileCacheSizeInMb,
+			Shared:    true,
+		},
+		CacheDir: config.CacheDir(SharedCacheDir),
+	}
+	// The file system mounted first owns the cache.
+	t.fsTest.SetUpTestSuite()
+
+	readerCfg := t.serverCfg
+	readerBucket = fake.NewCountingBucket(bucket)
+	readerCfg.BucketManager = &fakeBucketManager{
+		buckets:         map[string]gcs.Bucket{bucket.Name(): readerBucket},
+		appendThreshold: 0,
+		tmpObjectPrefix: ".gcsfuse_tmp/",
+	}
+	server, err := fs.NewServer(ctx, &readerCfg)
+	AssertEq(nil, err)
+
+	readerMntDir, err := os.MkdirTemp("", "fs_test")
+	AssertEq(nil, err)
+	mountCfg := t.mountCfg
+	mountCfg.OpContext = ctx
+	readerMfs, err = fuse.Mount(readerMntDir, server, &mountCfg)
+	AssertEq(nil, err)
+}
+
+func (t *SharedFileCacheTest) TearDownTestSuite() {
+	err := fuse.Unmount(readerMfs.Dir())
+	AssertEq(nil, err)
+	AssertEq(nil, readerMfs.Join(ctx))
+	AssertEq(nil, os.Remove(readerMfs.Dir()))
+
+	t.fsTest.TearDownTestSuite()
+	AssertEq(nil, os.RemoveAll(SharedCacheDir))
+}
+
+func (t *SharedFileCacheTest) SetUp(ti *TestInfo) {
+	readerBucket.Reset()
+}
+
+func (t *SharedFileCacheTest) sharedEntryPath(objectName string) string {
+	return util.GetSharedEntryPath(path.Join(SharedCacheDir, util.FileCache), util.GetObjectPath(bucket.Name(), objectName))
+}
+
+////////////////////////////////////////////////////////////////////////
+// Tests
+////////////////////////////////////////////////////////////////////////
+
+func (t *SharedFileCacheTest) SecondFileSystemReadsFileDownloadedByFirst() {
+	objectContent := generateRandomString(DefaultObjectSizeInMb * util.MiB)
+	err := t.createWithContents(DefaultObjectName, objectContent)
+	AssertEq(nil, err)
+
+	buf, err := os.ReadFile(path.Join(mntDir, DefaultObjectName))
+	AssertEq(nil, err)
+	AssertTrue(objectContent == string(buf))
+	// The download is shared once it's complete, which may be just after the
+	// read.
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		if _, err = os.Stat(t.sharedEntryPath(DefaultObjectName)); err == nil || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	AssertEq(nil, err)
+
+	buf, err = os.ReadFile(path.Join(readerMfs.Dir(), DefaultObjectName))
+
+	AssertEq(nil, err)
+	ExpectTrue(objectContent == string(buf))
+	ExpectEq(0, readerBucket.Count("NewReader"))
+}
+
+func (t *SharedFileCacheTest) SecondFileSystemReadsFromGCSFileNotDownloaded() {
+	objectContent := generateRandomString(util.MiB)
+	err := t.createWithContents(RenamedObjectName, objectContent)
+	AssertEq(nil, err)
+
+	buf, err := os.ReadFile(path.Join(readerMfs.Dir(), RenamedObjectName))
+
+	AssertEq(nil, err)
+	ExpectTrue(objectContent == string(buf))
+	ExpectLt(0, readerBucket.Count("NewReader"))
+	// Only the first file system downloads into the cache.
+	_, err = os.Stat(util.GetDownloadPath(path.Join(SharedCacheDir, util.FileCache), util.GetObjectPath(bucket.Name(), RenamedObjectName)))
+	ExpectTrue(os.IsNotExist(err))
+	_, err = os.Stat(t.sharedEntryPath(RenamedObjectName))
+	ExpectTrue(os.IsNotExist(err))
+}
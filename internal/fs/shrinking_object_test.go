@@ -0,0 +1,206 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Tests for reading objects that turn out to be shorter than their metadata
+// says, calling the file system directly.
+
+package fs_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/config"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/fs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/locker"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/fuseutil"
+	. "github.com/jacobsa/ogletest"
+	"github.com/jacobsa/timeutil"
+)
+
+const shrinkingObjectSize = 1000
+
+// A bucket whose objects can be cut short after they are statted, serving and
+// reporting only their first bytes from then on, as GCS does with a range
+// starting at or past the end of an object.
+type shrinkingBucket struct {
+	gcs.Bucket
+
+	mu sync.Mutex
+
+	// The sizes the objects were cut to, and whether reads are also cut short
+	// without the objects changing, as when a connection is cut.
+	//
+	// GUARDED_BY(mu)
+	sizes   map[string]uint64
+	cutOnly bool
+}
+
+func (b *shrinkingBucket) shrink(name string, size uint64, cutOnly bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.sizes[name] = size
+	b.cutOnly = cutOnly
+}
+
+func (b *shrinkingBucket) NewReader(
+	ctx context.Context,
+	req *gcs.ReadObjectRequest) (io.ReadCloser, error) {
+	b.mu.Lock()
+	size, ok := b.sizes[req.Name]
+	b.mu.Unlock()
+	if !ok || req.Range == nil {
+		return b.Bucket.NewReader(ctx, req)
+	}
+
+	if req.Range.Start >= size {
+		return nil, &gcs.RangeNotSatisfiableError{Err: fmt.Errorf("%q is %d bytes long", req.Name, size)}
+	}
+
+	r := *req.Range
+	r.Limit = min(r.Limit, size)
+	rc, err := b.Bucket.NewReader(ctx, &gcs.ReadObjectRequest{Name: req.Name, Generation: req.Generation, Range: &r})
+	return rc, err
+}
+
+func (b *shrinkingBucket) StatObject(
+	ctx context.Context,
+	req *gcs.StatObjectRequest) (*gcs.MinObject, *gcs.ExtendedObjectAttributes, error) {
+	m, e, err := b.Bucket.StatObject(ctx, req)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if size, ok := b.sizes[req.Name]; ok && err == nil && !b.cutOnly {
+		m.Size = size
+	}
+	return m, e, err
+}
+
+type ShrinkingObjectTest struct {
+	ctx    context.Context
+	bucket *shrinkingBucket
+	fs     fuseutil.FileSystem
+
+	in     fuseops.InodeID
+	handle fuseops.HandleID
+}
+
+func init() { RegisterTestSuite(&ShrinkingObjectTest{}) }
+
+func (t *ShrinkingObjectTest) SetUp(ti *TestInfo) {
+	var err error
+	locker.EnableInvariantsCheck()
+	t.ctx = ti.Ctx
+
+	t.bucket = &shrinkingBucket{
+		Bucket: fake.NewFakeBucket(timeutil.RealClock(), "some_bucket"),
+		sizes:  make(map[string]uint64),
+	}
+	AssertEq(nil, storageutil.CreateObjects(t.ctx, t.bucket, map[string][]byte{
+		"foo": []byte(strings.Repeat("x", shrinkingObjectSize)),
+	}))
+
+	t.fs, err = fs.NewFileSystem(t.ctx, &fs.ServerConfig{
+		CacheClock: timeutil.RealClock(),
+		BucketName: t.bucket.Name(),
+		BucketManager: &fakeBucketManager{
+			buckets:         map[string]gcs.Bucket{t.bucket.Name(): t.bucket},
+			tmpObjectPrefix: ".gcsfuse_tmp/",
+		},
+		FilePerms:            filePerms,
+		DirPerms:             dirPerms,
+		SequentialReadSizeMb: SequentialReadSizeMb,
+		MountConfig:          config.NewMountConfig(),
+	})
+	AssertEq(nil, err)
+
+	lookUp := &fuseops.LookUpInodeOp{Parent: fuseops.RootInodeID, Name: "foo"}
+	AssertEq(nil, t.fs.LookUpInode(t.ctx, lookUp))
+	AssertEq(shrinkingObjectSize, lookUp.Entry.Attributes.Size)
+	t.in = lookUp.Entry.Child
+
+	open := &fuseops.OpenFileOp{Inode: t.in}
+	AssertEq(nil, t.fs.OpenFile(t.ctx, open))
+	t.handle = open.Handle
+}
+
+func (t *ShrinkingObjectTest) TearDown() {
+	t.fs.Destroy()
+}
+
+func (t *ShrinkingObjectTest) read(offset int64, size int) (*fuseops.ReadFileOp, error) {
+	op := &fuseops.ReadFileOp{Inode: t.in, Handle: t.handle, Offset: offset, Dst: make([]byte, size)}
+	return op, t.fs.ReadFile(t.ctx, op)
+}
+
+func (t *ShrinkingObjectTest) size() uint64 {
+	op := &fuseops.GetInodeAttributesOp{Inode: t.in}
+	AssertEq(nil, t.fs.GetInodeAttributes(t.ctx, op))
+	return op.Attributes.Size
+}
+
+////////////////////////////////////////////////////////////////////////
+// Tests
+////////////////////////////////////////////////////////////////////////
+
+func (t *ShrinkingObjectTest) ReadPastNewEnd() {
+	t.bucket.shrink("foo", 100, false)
+
+	op, err := t.read(500, 100)
+
+	AssertEq(nil, err)
+	ExpectEq(0, op.BytesRead)
+	ExpectEq(100, t.size())
+}
+
+func (t *ShrinkingObjectTest) ReadStraddlingNewEnd() {
+	t.bucket.shrink("foo", 100, false)
+
+	op, err := t.read(50, 100)
+
+	AssertEq(nil, err)
+	ExpectEq(50, op.BytesRead)
+	ExpectTrue(bytes.Equal(bytes.Repeat([]byte("x"), 50), op.Dst[:op.BytesRead]))
+	ExpectEq(100, t.size())
+
+	// Reads past the new end no longer go to GCS.
+	op, err = t.read(100, 100)
+	AssertEq(nil, err)
+	ExpectEq(0, op.BytesRead)
+}
+
+func (t *ShrinkingObjectTest) ReadBeforeNewEnd() {
+	t.bucket.shrink("foo", 100, false)
+
+	op, err := t.read(0, 100)
+
+	AssertEq(nil, err)
+	ExpectEq(100, op.BytesRead)
+}
+
+func (t *ShrinkingObjectTest) ReadCutShortWithoutShrinking() {
+	t.bucket.shrink("foo", 100, true)
+
+	_, err := t.read(50, 100)
+
+	ExpectNe(nil, err)
+	ExpectEq(shrinkingObjectSize, t.size())
+}
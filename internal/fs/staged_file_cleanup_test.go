@@ -0,0 +1,147 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Tests for the removal of the staged files of unlinked files once the kernel
+// forgets them, calling the file system directly.
+
+package fs_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/config"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/contentcache"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/fs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/locker"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/jacobsa/fuse"
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/fuseutil"
+	. "github.com/jacobsa/ogletest"
+	"github.com/jacobsa/timeutil"
+)
+
+const stagedFileCleanupFiles = 50
+
+type StagedFileCleanupTest struct {
+	ctx      context.Context
+	fs       fuseutil.FileSystem
+	stageDir string
+}
+
+func init() { RegisterTestSuite(&StagedFileCleanupTest{}) }
+
+func (t *StagedFileCleanupTest) SetUp(ti *TestInfo) {
+	var err error
+	locker.EnableInvariantsCheck()
+	t.ctx = ti.Ctx
+
+	t.stageDir, err = os.MkdirTemp("", "staged_file_cleanup_test")
+	AssertEq(nil, err)
+
+	bucket := fake.NewFakeBucket(timeutil.RealClock(), "some_bucket")
+	t.fs, err = fs.NewFileSystem(t.ctx, &fs.ServerConfig{
+		CacheClock: timeutil.RealClock(),
+		BucketName: bucket.Name(),
+		BucketManager: &fakeBucketManager{
+			buckets:         map[string]gcs.Bucket{bucket.Name(): bucket},
+			tmpObjectPrefix: ".gcsfuse_tmp/",
+		},
+		TempDir:              t.stageDir,
+		FilePerms:            filePerms,
+		DirPerms:             dirPerms,
+		SequentialReadSizeMb: SequentialReadSizeMb,
+		MountConfig:          config.NewMountConfig(),
+	})
+	AssertEq(nil, err)
+}
+
+func (t *StagedFileCleanupTest) TearDown() {
+	t.fs.Destroy()
+	_ = os.RemoveAll(t.stageDir)
+}
+
+// Create and write to a file, returning its inode and handle.
+func (t *StagedFileCleanupTest) createAndWrite(name string) (fuseops.InodeID, fuseops.HandleID) {
+	create := &fuseops.CreateFileOp{Parent: fuseops.RootInodeID, Name: name, Mode: filePerms}
+	AssertEq(nil, t.fs.CreateFile(t.ctx, create))
+
+	write := &fuseops.WriteFileOp{Inode: create.Entry.Child, Handle: create.Handle, Data: []byte("taco")}
+	AssertEq(nil, t.fs.WriteFile(t.ctx, write))
+
+	return create.Entry.Child, create.Handle
+}
+
+func (t *StagedFileCleanupTest) stagedFiles() []string {
+	entries, err := os.ReadDir(contentcache.StagedWriteDir(t.stageDir, "some_bucket", ""))
+	AssertEq(nil, err)
+
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	return names
+}
+
+////////////////////////////////////////////////////////////////////////
+// Tests
+////////////////////////////////////////////////////////////////////////
+
+func (t *StagedFileCleanupTest) LocalFilesUnlinkedAndForgotten() {
+	forget := &fuseops.BatchForgetOp{}
+	for i := 0; i < stagedFileCleanupFiles; i++ {
+		name := fmt.Sprintf("foo%d", i)
+		in, handle := t.createAndWrite(name)
+
+		AssertEq(nil, t.fs.Unlink(t.ctx, &fuseops.UnlinkOp{Parent: fuseops.RootInodeID, Name: name}))
+		AssertEq(nil, t.fs.FlushFile(t.ctx, &fuseops.FlushFileOp{Inode: in, Handle: handle}))
+		AssertEq(nil, t.fs.ReleaseFileHandle(t.ctx, &fuseops.ReleaseFileHandleOp{Handle: handle}))
+		forget.Entries = append(forget.Entries, fuseops.BatchForgetEntry{Inode: in, N: 1})
+	}
+	AssertNe(0, len(t.stagedFiles()))
+
+	AssertEq(nil, t.fs.BatchForget(t.ctx, forget))
+
+	ExpectEq(0, len(t.stagedFiles()), "%v", t.stagedFiles())
+}
+
+func (t *StagedFileCleanupTest) SyncedFilesModifiedUnlinkedAndForgotten() {
+	for i := 0; i < stagedFileCleanupFiles; i++ {
+		name := fmt.Sprintf("foo%d", i)
+		in, handle := t.createAndWrite(name)
+		AssertEq(nil, t.fs.FlushFile(t.ctx, &fuseops.FlushFileOp{Inode: in, Handle: handle}))
+
+		// Modify the file again, and unlink it before the next flush.
+		write := &fuseops.WriteFileOp{Inode: in, Handle: handle, Offset: 4, Data: []byte("burrito")}
+		AssertEq(nil, t.fs.WriteFile(t.ctx, write))
+		AssertEq(nil, t.fs.Unlink(t.ctx, &fuseops.UnlinkOp{Parent: fuseops.RootInodeID, Name: name}))
+
+		AssertEq(nil, t.fs.FlushFile(t.ctx, &fuseops.FlushFileOp{Inode: in, Handle: handle}))
+		AssertEq(nil, t.fs.ReleaseFileHandle(t.ctx, &fuseops.ReleaseFileHandleOp{Handle: handle}))
+		AssertEq(nil, t.fs.ForgetInode(t.ctx, &fuseops.ForgetInodeOp{Inode: in, N: 1}))
+	}
+
+	ExpectEq(0, len(t.stagedFiles()), "%v", t.stagedFiles())
+
+	// The objects weren't created again by the flushes after the unlinks.
+	for i := 0; i < stagedFileCleanupFiles; i++ {
+		op := &fuseops.LookUpInodeOp{Parent: fuseops.RootInodeID, Name: fmt.Sprintf("foo%d", i)}
+		err := t.fs.LookUpInode(t.ctx, op)
+		ExpectTrue(errors.Is(err, fuse.ENOENT), "%v", err)
+	}
+}
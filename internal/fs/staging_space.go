@@ -0,0 +1,122 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fs
+
+import (
+	"context"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	cacheutil "github.com/googlecloudplatform/gcsfuse/v2/internal/cache/util"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/monitor"
+	"github.com/jacobsa/timeutil"
+)
+
+const (
+	// How long the free space of the staging file system is trusted before it
+	// is checked again.
+	stagingSpaceCheckInterval = time.Second
+
+	// How often running short of staging space is logged.
+	stagingSpaceWarnInterval = time.Minute
+)
+
+// stagingSpace fails the operations that would stage data with ENOSPC while
+// the file system holding the staged files has less free space than
+// required, so that they fail up front rather than midway through staging.
+type stagingSpace struct {
+	/////////////////////////
+	// Constant data
+	/////////////////////////
+
+	dir     string
+	minFree uint64
+	clock   timeutil.Clock
+
+	/////////////////////////
+	// Mutable state
+	/////////////////////////
+
+	mu sync.Mutex
+
+	// The free space of dir when it was last checked, at checkedAt.
+	//
+	// GUARDED_BY(mu)
+	free      uint64
+	checkedAt time.Time
+
+	// When running short of space was last logged.
+	//
+	// GUARDED_BY(mu)
+	warnedAt time.Time
+}
+
+// newStagingSpace returns a stagingSpace requiring minFreeMB MiB free in the
+// file system holding dir, or os.TempDir() if empty, or nil if minFreeMB is
+// zero.
+func newStagingSpace(dir string, minFreeMB int, clock timeutil.Clock) *stagingSpace {
+	if minFreeMB <= 0 {
+		return nil
+	}
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	return &stagingSpace{
+		dir:     dir,
+		minFree: uint64(minFreeMB) * cacheutil.MiB,
+		clock:   clock,
+	}
+}
+
+// check returns ENOSPC if the staging file system has less free space than
+// required, recording it for the file system operation fsOp. Errors checking
+// the free space are logged and let the operation go ahead.
+//
+// A nil stagingSpace never fails.
+func (s *stagingSpace) check(ctx context.Context, fsOp string) error {
+	if s == nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.clock.Now()
+	if s.checkedAt.IsZero() || now.Sub(s.checkedAt) >= stagingSpaceCheckInterval {
+		var st syscall.Statfs_t
+		if err := syscall.Statfs(s.dir, &st); err != nil {
+			logger.Warnf("Cannot check the free space of staging directory %s: %v", s.dir, err)
+			return nil
+		}
+		s.free = st.Bavail * uint64(st.Bsize)
+		s.checkedAt = now
+	}
+
+	if s.free >= s.minFree {
+		return nil
+	}
+
+	monitor.CaptureStagingSpaceRejectionMetrics(ctx, fsOp)
+	if s.warnedAt.IsZero() || now.Sub(s.warnedAt) >= stagingSpaceWarnInterval {
+		logger.Warnf(
+			"Failing %s with ENOSPC: staging directory %s has %d MiB free, less than --min-free-staging-mb=%d",
+			fsOp, s.dir, s.free/cacheutil.MiB, s.minFree/cacheutil.MiB)
+		s.warnedAt = now
+	}
+	return syscall.ENOSPC
+}
@@ -0,0 +1,179 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Tests for failing writes early with ENOSPC while the staging file system is
+// nearly full, staging in a small tmpfs and calling the file system directly.
+
+package fs_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path"
+	"syscall"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/config"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/fs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/locker"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/fuseutil"
+	. "github.com/jacobsa/ogletest"
+	"github.com/jacobsa/timeutil"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	stagingSpaceTmpfsMB = 8
+	stagingSpaceMinMB   = 4
+)
+
+type StagingSpaceTest struct {
+	ctx      context.Context
+	clock    timeutil.SimulatedClock
+	fs       fuseutil.FileSystem
+	stageDir string
+	mounted  bool
+}
+
+func init() { RegisterTestSuite(&StagingSpaceTest{}) }
+
+func (t *StagingSpaceTest) SetUp(ti *TestInfo) {
+	var err error
+	locker.EnableInvariantsCheck()
+	t.ctx = ti.Ctx
+	t.clock.SetTime(time.Date(2024, 5, 1, 0, 0, 0, 0, time.Local))
+
+	t.stageDir, err = os.MkdirTemp("", "staging_space_test")
+	AssertEq(nil, err)
+
+	// Mounting needs privileges that the tests may not have.
+	if err = unix.Mount("tmpfs", t.stageDir, "tmpfs", 0, "size=8m"); err != nil {
+		return
+	}
+	t.mounted = true
+
+	bucket := fake.NewFakeBucket(timeutil.RealClock(), "some_bucket")
+	t.fs, err = fs.NewFileSystem(t.ctx, &fs.ServerConfig{
+		CacheClock: &t.clock,
+		BucketName: bucket.Name(),
+		BucketManager: &fakeBucketManager{
+			buckets:         map[string]gcs.Bucket{bucket.Name(): bucket},
+			tmpObjectPrefix: ".gcsfuse_tmp/",
+		},
+		TempDir:              t.stageDir,
+		MinFreeStagingMB:     stagingSpaceMinMB,
+		FilePerms:            filePerms,
+		DirPerms:             dirPerms,
+		SequentialReadSizeMb: SequentialReadSizeMb,
+		MountConfig:          config.NewMountConfig(),
+	})
+	AssertEq(nil, err)
+}
+
+func (t *StagingSpaceTest) TearDown() {
+	if t.fs != nil {
+		t.fs.Destroy()
+	}
+	if t.mounted {
+		_ = unix.Unmount(t.stageDir, 0)
+	}
+	_ = os.Remove(t.stageDir)
+}
+
+// Fill the staging file system until less than the required space is free,
+// and let the file system see it.
+func (t *StagingSpaceTest) fill() {
+	filler := make([]byte, (stagingSpaceTmpfsMB-stagingSpaceMinMB+1)<<20)
+	AssertEq(nil, os.WriteFile(path.Join(t.stageDir, "filler"), filler, 0600))
+	t.clock.AdvanceTime(time.Second)
+}
+
+// Free the space that fill took, and let the file system see it.
+func (t *StagingSpaceTest) free() {
+	AssertEq(nil, os.Remove(path.Join(t.stageDir, "filler")))
+	t.clock.AdvanceTime(time.Second)
+}
+
+func (t *StagingSpaceTest) create(name string) (*fuseops.CreateFileOp, error) {
+	op := &fuseops.CreateFileOp{Parent: fuseops.RootInodeID, Name: name, Mode: filePerms}
+	return op, t.fs.CreateFile(t.ctx, op)
+}
+
+func (t *StagingSpaceTest) write(create *fuseops.CreateFileOp) error {
+	return t.fs.WriteFile(t.ctx, &fuseops.WriteFileOp{
+		Inode:  create.Entry.Child,
+		Handle: create.Handle,
+		Data:   []byte("taco"),
+	})
+}
+
+////////////////////////////////////////////////////////////////////////
+// Tests
+////////////////////////////////////////////////////////////////////////
+
+func (t *StagingSpaceTest) CreateFileFailsEarlyAndRecovers() {
+	if !t.mounted {
+		return
+	}
+	t.fill()
+
+	_, err := t.create("foo")
+	ExpectTrue(errors.Is(err, syscall.ENOSPC), "%v", err)
+
+	t.free()
+
+	create, err := t.create("foo")
+	AssertEq(nil, err)
+	ExpectEq(nil, t.write(create))
+}
+
+func (t *StagingSpaceTest) WriteFileFailsEarlyAndRecovers() {
+	if !t.mounted {
+		return
+	}
+	create, err := t.create("foo")
+	AssertEq(nil, err)
+	AssertEq(nil, t.write(create))
+
+	t.fill()
+
+	err = t.write(create)
+	ExpectTrue(errors.Is(err, syscall.ENOSPC), "%v", err)
+
+	t.free()
+
+	ExpectEq(nil, t.write(create))
+}
+
+func (t *StagingSpaceTest) FreeSpaceIsCachedBriefly() {
+	if !t.mounted {
+		return
+	}
+	create, err := t.create("foo")
+	AssertEq(nil, err)
+	AssertEq(nil, t.write(create))
+
+	// Filling without letting time pass isn't seen yet.
+	filler := make([]byte, (stagingSpaceTmpfsMB-stagingSpaceMinMB+1)<<20)
+	AssertEq(nil, os.WriteFile(path.Join(t.stageDir, "filler"), filler, 0600))
+	ExpectEq(nil, t.write(create))
+
+	t.clock.AdvanceTime(time.Second)
+	err = t.write(create)
+	ExpectTrue(errors.Is(err, syscall.ENOSPC), "%v", err)
+}
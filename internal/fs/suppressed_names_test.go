@@ -0,0 +1,205 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Tests for list:suppressed-names, the names of files that desktop clients
+// probe for and that aren't looked up in GCS.
+
+package fs_test
+
+import (
+	"errors"
+	"os"
+	"path"
+	"syscall"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/config"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/jacobsa/fuse/fusetesting"
+	. "github.com/jacobsa/ogletest"
+	"github.com/jacobsa/timeutil"
+)
+
+////////////////////////////////////////////////////////////////////////
+// Common
+////////////////////////////////////////////////////////////////////////
+
+var rpcCounter *fake.CountingBucket
+
+type suppressedNamesTestCommon struct {
+	fsTest
+}
+
+func (t *suppressedNamesTestCommon) setUpTestSuite(mountConfig *config.MountConfig) {
+	rpcCounter = fake.NewCountingBucket(fake.NewFakeBucket(timeutil.RealClock(), "some_bucket"))
+	bucket = rpcCounter
+	t.serverCfg.MountConfig = mountConfig
+
+	t.fsTest.SetUpTestSuite()
+}
+
+// rpcsDuring returns the number of requests to GCS made by f.
+func rpcsDuring(f func()) int64 {
+	before := rpcCounter.Count("")
+	f()
+	return rpcCounter.Count("") - before
+}
+
+////////////////////////////////////////////////////////////////////////
+// Default suppressed names, created local
+////////////////////////////////////////////////////////////////////////
+
+type SuppressedNamesTest struct {
+	suppressedNamesTestCommon
+}
+
+func init() { RegisterTestSuite(&SuppressedNamesTest{}) }
+
+func (t *SuppressedNamesTest) SetUpTestSuite() {
+	t.setUpTestSuite(config.NewMountConfig())
+}
+
+func (t *SuppressedNamesTest) LookUpSuppressedName() {
+	// Even an existing object isn't looked up.
+	AssertEq(nil, t.createWithContents(".DS_Store", "taco"))
+
+	var err error
+	n := rpcsDuring(func() {
+		_, err = os.Stat(path.Join(mntDir, ".DS_Store"))
+	})
+
+	ExpectTrue(os.IsNotExist(err), "%v", err)
+	ExpectEq(0, n)
+}
+
+func (t *SuppressedNamesTest) LookUpSuppressedPattern() {
+	var err error
+	n := rpcsDuring(func() {
+		_, err = os.Stat(path.Join(mntDir, "._foo"))
+	})
+
+	ExpectTrue(os.IsNotExist(err), "%v", err)
+	ExpectEq(0, n)
+}
+
+func (t *SuppressedNamesTest) LookUpOtherName() {
+	AssertEq(nil, t.createWithContents("DS_Store", "taco"))
+
+	var fi os.FileInfo
+	var err error
+	n := rpcsDuring(func() {
+		fi, err = os.Stat(path.Join(mntDir, "DS_Store"))
+	})
+
+	AssertEq(nil, err)
+	ExpectEq(len("taco"), fi.Size())
+	ExpectLt(0, n)
+}
+
+func (t *SuppressedNamesTest) ListingLeavesOutSuppressedObjects() {
+	AssertEq(nil, t.createObjects(map[string]string{
+		"dir/":        "",
+		"dir/.hidden": "",
+		"dir/foo":     "",
+	}))
+
+	entries, err := fusetesting.ReadDirPicky(path.Join(mntDir, "dir"))
+
+	AssertEq(nil, err)
+	AssertEq(1, len(entries))
+	ExpectEq("foo", entries[0].Name())
+}
+
+func (t *SuppressedNamesTest) CreateSuppressedNameStaysLocal() {
+	var err error
+	n := rpcsDuring(func() {
+		err = os.WriteFile(path.Join(mntDir, "autorun.inf"), []byte("taco"), 0600)
+	})
+	AssertEq(nil, err)
+	ExpectEq(0, n)
+
+	// The file can be read back from the mount, but has no object.
+	contents, err := os.ReadFile(path.Join(mntDir, "autorun.inf"))
+	AssertEq(nil, err)
+	ExpectEq("taco", string(contents))
+
+	_, _, err = bucket.StatObject(ctx, &gcs.StatObjectRequest{Name: "autorun.inf"})
+	var notFoundErr *gcs.NotFoundError
+	ExpectTrue(errors.As(err, &notFoundErr), "%v", err)
+}
+
+func (t *SuppressedNamesTest) CreateOtherName() {
+	err := os.WriteFile(path.Join(mntDir, "foo"), []byte("taco"), 0600)
+	AssertEq(nil, err)
+
+	_, _, err = bucket.StatObject(ctx, &gcs.StatObjectRequest{Name: "foo"})
+	ExpectEq(nil, err)
+}
+
+func (t *SuppressedNamesTest) MkDirSuppressedName() {
+	err := os.Mkdir(path.Join(mntDir, ".Trash-1000"), 0700)
+
+	ExpectTrue(errors.Is(err, syscall.EPERM), "%v", err)
+}
+
+////////////////////////////////////////////////////////////////////////
+// list:suppressed-create: reject
+////////////////////////////////////////////////////////////////////////
+
+type SuppressedNamesRejectTest struct {
+	suppressedNamesTestCommon
+}
+
+func init() { RegisterTestSuite(&SuppressedNamesRejectTest{}) }
+
+func (t *SuppressedNamesRejectTest) SetUpTestSuite() {
+	mountConfig := config.NewMountConfig()
+	mountConfig.ListConfig.SuppressedCreate = config.SuppressedCreateReject
+	t.setUpTestSuite(mountConfig)
+}
+
+func (t *SuppressedNamesRejectTest) CreateSuppressedName() {
+	var err error
+	n := rpcsDuring(func() {
+		err = os.WriteFile(path.Join(mntDir, ".DS_Store"), []byte("taco"), 0600)
+	})
+
+	ExpectTrue(errors.Is(err, syscall.EPERM), "%v", err)
+	ExpectEq(0, n)
+}
+
+////////////////////////////////////////////////////////////////////////
+// list:suppressed-names: []
+////////////////////////////////////////////////////////////////////////
+
+type NoSuppressedNamesTest struct {
+	suppressedNamesTestCommon
+}
+
+func init() { RegisterTestSuite(&NoSuppressedNamesTest{}) }
+
+func (t *NoSuppressedNamesTest) SetUpTestSuite() {
+	mountConfig := config.NewMountConfig()
+	mountConfig.ListConfig.SuppressedNames = nil
+	t.setUpTestSuite(mountConfig)
+}
+
+func (t *NoSuppressedNamesTest) LookUpDefaultSuppressedName() {
+	AssertEq(nil, t.createWithContents(".DS_Store", "taco"))
+
+	fi, err := os.Stat(path.Join(mntDir, ".DS_Store"))
+
+	AssertEq(nil, err)
+	ExpectEq(len("taco"), fi.Size())
+}
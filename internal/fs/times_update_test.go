@@ -0,0 +1,213 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Tests for the requests made to set the times of files the way tar -xpf and
+// cp -p do, with and without --times-update-delay.
+
+package fs_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/fs/inode"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
+	. "github.com/jacobsa/ogletest"
+	"github.com/jacobsa/timeutil"
+)
+
+////////////////////////////////////////////////////////////////////////
+// Common
+////////////////////////////////////////////////////////////////////////
+
+const timedArchiveFiles = 10
+
+var timesBucket *fake.CountingBucket
+
+func setUpCountingBucket() {
+	timesBucket = fake.NewCountingBucket(fake.NewFakeBucket(timeutil.RealClock(), "some_bucket"))
+	bucket = timesBucket
+}
+
+// The mtime the archive of makeTimedArchive records for file i.
+func archivedMtime(i int) time.Time {
+	return someMtime.Add(time.Duration(i) * time.Second)
+}
+
+// Build a tar archive holding small files with distinct mtimes.
+func makeTimedArchive() []byte {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for i := 0; i < timedArchiveFiles; i++ {
+		contents := []byte(fmt.Sprintf("contents of file %d", i))
+		AssertEq(nil, tw.WriteHeader(&tar.Header{
+			Name:    fmt.Sprintf("file%04d", i),
+			Mode:    0644,
+			Size:    int64(len(contents)),
+			ModTime: archivedMtime(i),
+		}))
+		_, err := tw.Write(contents)
+		AssertEq(nil, err)
+	}
+	AssertEq(nil, tw.Close())
+
+	return buf.Bytes()
+}
+
+// Extract the archive into dir the way tar -xpf does: write each file, close
+// it, then set its times.
+func extractTimedArchive(archive []byte, dir string) {
+	tr := tar.NewReader(bytes.NewReader(archive))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return
+		}
+		AssertEq(nil, err)
+
+		p := path.Join(dir, hdr.Name)
+		f, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+		AssertEq(nil, err)
+		_, err = io.Copy(f, tr)
+		AssertEq(nil, err)
+		AssertEq(nil, f.Close())
+
+		AssertEq(nil, os.Chtimes(p, someAtime, hdr.ModTime))
+	}
+}
+
+// Set the times of the extracted files once more.
+func setArchivedTimes(dir string, atime time.Time) {
+	for i := 0; i < timedArchiveFiles; i++ {
+		p := path.Join(dir, fmt.Sprintf("file%04d", i))
+		AssertEq(nil, os.Chtimes(p, atime, archivedMtime(i)))
+	}
+}
+
+////////////////////////////////////////////////////////////////////////
+// Without --times-update-delay
+////////////////////////////////////////////////////////////////////////
+
+type TimesUpdateTest struct {
+	fsTest
+}
+
+func init() { RegisterTestSuite(&TimesUpdateTest{}) }
+
+func (t *TimesUpdateTest) SetUpTestSuite() {
+	setUpCountingBucket()
+	t.fsTest.SetUpTestSuite()
+}
+
+func (t *TimesUpdateTest) ExtractArchive() {
+	creates := timesBucket.Count("CreateObject")
+	updates := timesBucket.Count("UpdateObject")
+
+	extractTimedArchive(makeTimedArchive(), mntDir)
+
+	// Each file costs a creation, and an update for its times.
+	ExpectEq(timedArchiveFiles, timesBucket.Count("CreateObject")-creates)
+	ExpectEq(timedArchiveFiles, timesBucket.Count("UpdateObject")-updates)
+
+	// Setting the same times once more costs nothing.
+	setArchivedTimes(mntDir, someAtime)
+
+	ExpectEq(timedArchiveFiles, timesBucket.Count("UpdateObject")-updates)
+	for i := 0; i < timedArchiveFiles; i++ {
+		name := fmt.Sprintf("file%04d", i)
+		_, mtime := statTimes(path.Join(mntDir, name))
+		ExpectThat(mtime, timeutil.TimeEq(archivedMtime(i)))
+		ExpectEq(archivedMtime(i).UTC().Format(time.RFC3339Nano), objectMetadata(name)[inode.FileMtimeMetadataKey])
+	}
+}
+
+////////////////////////////////////////////////////////////////////////
+// With --times-update-delay
+////////////////////////////////////////////////////////////////////////
+
+type HeldBackTimesTest struct {
+	fsTest
+}
+
+func init() { RegisterTestSuite(&HeldBackTimesTest{}) }
+
+func (t *HeldBackTimesTest) SetUpTestSuite() {
+	setUpCountingBucket()
+	t.serverCfg.PreserveAtime = true
+	// Long enough that only the file system's own flushes write the times.
+	t.serverCfg.TimesUpdateDelay = time.Hour
+	t.fsTest.SetUpTestSuite()
+}
+
+func (t *HeldBackTimesTest) ExtractArchive() {
+	creates := timesBucket.Count("CreateObject")
+	updates := timesBucket.Count("UpdateObject")
+
+	// Extract, then set the atimes again, as touch -a would.
+	extractTimedArchive(makeTimedArchive(), mntDir)
+	otherAtime := someAtime.Add(time.Hour)
+	setArchivedTimes(mntDir, otherAtime)
+
+	// Only the creations have gone out so far, but the final times are
+	// reported.
+	ExpectEq(timedArchiveFiles, timesBucket.Count("CreateObject")-creates)
+	ExpectEq(0, timesBucket.Count("UpdateObject")-updates)
+	for i := 0; i < timedArchiveFiles; i++ {
+		atime, mtime := statTimes(path.Join(mntDir, fmt.Sprintf("file%04d", i)))
+		ExpectThat(atime, timeutil.TimeEq(otherAtime))
+		ExpectThat(mtime, timeutil.TimeEq(archivedMtime(i)))
+	}
+
+	// Closing a file flushes its times, with a single update each.
+	for i := 0; i < timedArchiveFiles; i++ {
+		f, err := os.Open(path.Join(mntDir, fmt.Sprintf("file%04d", i)))
+		AssertEq(nil, err)
+		AssertEq(nil, f.Close())
+	}
+
+	ExpectEq(timedArchiveFiles, timesBucket.Count("UpdateObject")-updates)
+	for i := 0; i < timedArchiveFiles; i++ {
+		metadata := objectMetadata(fmt.Sprintf("file%04d", i))
+		ExpectEq(otherAtime.UTC().Format(time.RFC3339Nano), metadata[inode.FileAtimeMetadataKey])
+		ExpectEq(archivedMtime(i).UTC().Format(time.RFC3339Nano), metadata[inode.FileMtimeMetadataKey])
+	}
+}
+
+func (t *HeldBackTimesTest) Rename() {
+	AssertEq(nil, t.createWithContents("foo", "taco"))
+	AssertEq(nil, os.Chtimes(path.Join(mntDir, "foo"), someAtime, someMtime))
+
+	// The times move along with the contents.
+	AssertEq(nil, os.Rename(path.Join(mntDir, "foo"), path.Join(mntDir, "bar")))
+
+	metadata := objectMetadata("bar")
+	ExpectEq(someAtime.UTC().Format(time.RFC3339Nano), metadata[inode.FileAtimeMetadataKey])
+	ExpectEq(someMtime.UTC().Format(time.RFC3339Nano), metadata[inode.FileMtimeMetadataKey])
+}
+
+func (t *HeldBackTimesTest) RenameDir() {
+	AssertEq(nil, os.Mkdir(path.Join(mntDir, "dir"), 0700))
+	AssertEq(nil, t.createWithContents("dir/foo", "taco"))
+	AssertEq(nil, os.Chtimes(path.Join(mntDir, "dir/foo"), someAtime, someMtime))
+
+	AssertEq(nil, os.Rename(path.Join(mntDir, "dir"), path.Join(mntDir, "renamed")))
+
+	metadata := objectMetadata("renamed/foo")
+	ExpectEq(someMtime.UTC().Format(time.RFC3339Nano), metadata[inode.FileMtimeMetadataKey])
+}
@@ -86,9 +86,9 @@ func (t *typeCacheTestCommon) SetUpTestSuite() {
 
 	// Fill server-cfg from mount-config.
 	func(mountConfig *config.MountConfig, serverCfg *gcsfusefs.ServerConfig) {
-		serverCfg.DirTypeCacheTTL = mount.ResolveMetadataCacheTTL(mount.DefaultStatOrTypeCacheTTL, mount.DefaultStatOrTypeCacheTTL,
-			mountConfig.TtlInSeconds)
-		serverCfg.InodeAttributeCacheTTL = serverCfg.DirTypeCacheTTL
+		serverCfg.DirTypeCacheTTLs = metadata.SameEntryTTLs(mount.ResolveMetadataCacheTTL(mount.DefaultStatOrTypeCacheTTL, mount.DefaultStatOrTypeCacheTTL,
+			mountConfig.TtlInSeconds))
+		serverCfg.InodeAttributeCacheTTLs = serverCfg.DirTypeCacheTTLs
 		// We can add more logic here to fill other fileds in serverCfg
 		// from mountConfig here as needed.
 	}(t.serverCfg.MountConfig, &t.serverCfg)
@@ -22,7 +22,9 @@ import (
 	"syscall"
 
 	"cloud.google.com/go/storage"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/fs/inode"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
 	"github.com/jacobsa/fuse/fuseops"
 	"github.com/jacobsa/fuse/fuseutil"
 	"google.golang.org/api/googleapi"
@@ -51,6 +53,22 @@ func errno(err error) error {
 		return syscall.ENOENT
 	}
 
+	// The file was clobbered by another writer. If its object was deleted,
+	// the file is as gone as any other that doesn't exist.
+	var clobberedErr *inode.FileClobberedError
+	if errors.As(err, &clobberedErr) {
+		if clobberedErr.CurrentGeneration == 0 {
+			return syscall.ENOENT
+		}
+		return syscall.ESTALE
+	}
+
+	// A request would have gone over --max-metadata-ops-per-sec.
+	var throttledErr *gcs.ThrottledError
+	if errors.As(err, &throttledErr) {
+		return syscall.EAGAIN
+	}
+
 	// The HTTP request is canceled
 	if strings.Contains(err.Error(), "net/http: request canceled") {
 		return syscall.ECANCELED
@@ -97,6 +115,14 @@ func (em *errorMapping) handlePanic() {
 
 func (em *errorMapping) mapError(op string, err error) error {
 	fsErr := errno(err)
+
+	// Clobbering is logged once per file where it is detected, rather than
+	// for every operation that runs into it.
+	var clobberedErr *inode.FileClobberedError
+	if errors.As(err, &clobberedErr) {
+		return fsErr
+	}
+
 	if err != nil && fsErr != nil && err != fsErr {
 		logger.Errorf("%s: %v, %v", op, fsErr, err)
 	}
@@ -369,3 +395,12 @@ func (em *errorMapping) Fallocate(
 	err := em.wrapped.Fallocate(ctx, op)
 	return em.mapError("Fallocate", err)
 }
+
+func (em *errorMapping) CopyFileRange(
+	ctx context.Context,
+	op *fuseops.CopyFileRangeOp) error {
+	defer em.handlePanic()
+
+	err := em.wrapped.CopyFileRange(ctx, op)
+	return em.mapError("CopyFileRange", err)
+}
@@ -18,53 +18,189 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"reflect"
+	"slices"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/monitor"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/monitor/tags"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
 	"github.com/jacobsa/fuse/fuseops"
 	"github.com/jacobsa/fuse/fuseutil"
+	"github.com/jacobsa/timeutil"
 	"go.opencensus.io/plugin/ochttp"
 	"go.opencensus.io/stats"
 	"go.opencensus.io/stats/view"
 	"go.opencensus.io/tag"
 )
 
-var (
-	opsCount      = stats.Int64("fs/ops_count", "The number of ops processed by the file system.", stats.UnitDimensionless)
-	opsLatency    = stats.Float64("fs/ops_latency", "The latency of a file system operation.", stats.UnitMilliseconds)
-	opsErrorCount = stats.Int64("fs/ops_error_count", "The number of errors generated by file system operation.", stats.UnitDimensionless)
+// The measures recorded by WithMonitoring, named without their prefix.
+const (
+	OpsCountMeasure      = "ops_count"
+	OpsErrorCountMeasure = "ops_error_count"
+	OpsLatencyMeasure    = "ops_latency"
+
+	// The time ops spend queued, e.g. for locks, before they run.
+	OpsQueueLatencyMeasure = "ops_queue_latency"
+
+	// The number of GCS requests each op made, and the time they took.
+	OpsGCSRequestsMeasure = "ops_gcs_requests"
+	OpsGCSLatencyMeasure  = "ops_gcs_latency"
 )
 
-// Initialize the metrics.
-func init() {
+// DefaultMetricPrefix prefixes the names of the measures recorded by default,
+// whose views EnableMonitoringViews registers.
+const DefaultMetricPrefix = "fs/"
+
+// MonitoringOptions configures the measures recorded by WithMonitoring.
+type MonitoringOptions struct {
+	// MetricPrefix is prepended to the names of the measures recorded, or
+	// DefaultMetricPrefix if empty.
+	MetricPrefix string
+
+	// Measures lists the measures recorded, e.g. OpsCountMeasure, or all of
+	// them if empty.
+	Measures []string
+
+	// If non-empty, the summary of the session logged when the file system is
+	// destroyed is also written to this file as JSON.
+	SessionSummaryFile string
+
+	// If true, the number of GCS requests each op made and the time they took
+	// are logged at TRACE severity when the op completes, as with --debug_fuse.
+	LogGCSRequests bool
+
+	// If true, the errors counted are also tagged with the name of their errno,
+	// e.g. ENOENT, as fs_errno. Only the errnos in commonErrnos get their own
+	// value; see fsErrnoStr.
+	DetailedErrors bool
+}
+
+// The measures of file system operations with the given prefix, nil for those
+// not enabled.
+type opsMeasures struct {
+	count      *stats.Int64Measure
+	errorCount *stats.Int64Measure
+	latency    *stats.Float64Measure
+	queue      *stats.Float64Measure
+
+	gcsRequests *stats.Int64Measure
+	gcsLatency  *stats.Float64Measure
+}
+
+func newOpsMeasures(opts MonitoringOptions) (m opsMeasures) {
+	prefix := opts.MetricPrefix
+	if prefix == "" {
+		prefix = DefaultMetricPrefix
+	}
+
+	enabled := func(name string) bool {
+		return len(opts.Measures) == 0 || slices.Contains(opts.Measures, name)
+	}
 
-	// Register the view.
+	if enabled(OpsCountMeasure) {
+		m.count = stats.Int64(prefix+OpsCountMeasure, "The number of ops processed by the file system.", stats.UnitDimensionless)
+	}
+	if enabled(OpsErrorCountMeasure) {
+		m.errorCount = stats.Int64(prefix+OpsErrorCountMeasure, "The number of errors generated by file system operation.", stats.UnitDimensionless)
+	}
+	if enabled(OpsLatencyMeasure) {
+		m.latency = stats.Float64(prefix+OpsLatencyMeasure, "The latency of a file system operation.", stats.UnitMilliseconds)
+	}
+	if enabled(OpsQueueLatencyMeasure) {
+		m.queue = stats.Float64(prefix+OpsQueueLatencyMeasure, "The time a file system operation spends queued before it runs.", stats.UnitMilliseconds)
+	}
+	if enabled(OpsGCSRequestsMeasure) {
+		m.gcsRequests = stats.Int64(prefix+OpsGCSRequestsMeasure, "The number of GCS requests made by a file system operation.", stats.UnitDimensionless)
+	}
+	if enabled(OpsGCSLatencyMeasure) {
+		m.gcsLatency = stats.Float64(prefix+OpsGCSLatencyMeasure, "The time a file system operation spends waiting for GCS requests.", stats.UnitMilliseconds)
+	}
+
+	return
+}
+
+// EnableMonitoringViews registers the views of the measures recorded by
+// WithMonitoring and WithParallelism by default, for the exporters to export.
+// Nothing is registered unless it is called, leaving programs embedding the
+// file system free to register their own views. Only the first call has any
+// effect. The error count is broken down by fs_errno too if
+// opts.DetailedErrors is set; the other options are ignored.
+func EnableMonitoringViews(opts MonitoringOptions) error {
+	enableViewsOnce.Do(func() {
+		enableViewsErr = registerMonitoringViews(opts.DetailedErrors)
+	})
+	return enableViewsErr
+}
+
+var (
+	enableViewsOnce sync.Once
+	enableViewsErr  error
+)
+
+func registerMonitoringViews(detailedErrors bool) error {
+	m := newOpsMeasures(MonitoringOptions{})
+	errorTagKeys := []tag.Key{tags.FSOp, tags.FSError}
+	if detailedErrors {
+		errorTagKeys = append(errorTagKeys, tags.FSErrno)
+	}
 	if err := view.Register(
 		&view.View{
-			Name:        "fs/ops_count",
-			Measure:     opsCount,
+			Name:        m.count.Name(),
+			Measure:     m.count,
 			Description: "The cumulative number of ops processed by the file system.",
 			Aggregation: view.Sum(),
 			TagKeys:     []tag.Key{tags.FSOp},
 		},
 		&view.View{
-			Name:        "fs/ops_error_count",
-			Measure:     opsErrorCount,
+			Name:        m.errorCount.Name(),
+			Measure:     m.errorCount,
 			Description: "The cumulative number of errors generated by file system operations",
 			Aggregation: view.Sum(),
-			TagKeys:     []tag.Key{tags.FSOp, tags.FSError},
+			TagKeys:     errorTagKeys,
 		},
 		&view.View{
-			Name:        "fs/ops_latency",
-			Measure:     opsLatency,
+			Name:        m.latency.Name(),
+			Measure:     m.latency,
 			Description: "The cumulative distribution of file system operation latencies",
 			Aggregation: ochttp.DefaultLatencyDistribution,
 			TagKeys:     []tag.Key{tags.FSOp},
+		},
+		&view.View{
+			Name:        m.queue.Name(),
+			Measure:     m.queue,
+			Description: "The cumulative distribution of the time file system operations spend queued, e.g. for locks, before they run",
+			Aggregation: ochttp.DefaultLatencyDistribution,
+			TagKeys:     []tag.Key{tags.FSOp},
+		},
+		&view.View{
+			Name:        m.gcsRequests.Name(),
+			Measure:     m.gcsRequests,
+			Description: "The cumulative distribution of the number of GCS requests made by file system operations",
+			Aggregation: view.Distribution(1, 2, 4, 8, 16, 32, 64, 128, 256),
+			TagKeys:     []tag.Key{tags.FSOp},
+		},
+		&view.View{
+			Name:        m.gcsLatency.Name(),
+			Measure:     m.gcsLatency,
+			Description: "The cumulative distribution of the time file system operations spend waiting for GCS requests",
+			Aggregation: ochttp.DefaultLatencyDistribution,
+			TagKeys:     []tag.Key{tags.FSOp},
+		},
+		&view.View{
+			Name:        opsInFlight.Name(),
+			Measure:     opsInFlight,
+			Description: "The number of file system operations being processed. If it stays at --fuse-parallelism, operations are waiting for their turn.",
+			Aggregation: view.LastValue(),
 		}); err != nil {
-		fmt.Printf("Failed to register metrics for the file system: %v\n", err)
+		return fmt.Errorf("failed to register metrics for the file system: %w", err)
 	}
+
+	return nil
 }
 
 // fsErrStr maps an error to a error string. Uncommon errors are aggregated to
@@ -80,30 +216,175 @@ func fsErrStr(err error) string {
 	return DefaultFSError.Error()
 }
 
-// Records file system operation count, failed operation count and the operation latency.
-func recordOp(ctx context.Context, method string, start time.Time, fsErr error) {
+// OtherErrno is the fs_errno of the errors whose errno isn't in commonErrnos,
+// and of those that aren't errnos at all.
+const OtherErrno = "OTHER"
+
+// The errnos that get their own fs_errno value. Each value is a time series
+// per op in the monitoring backend, so the table is capped at the 30 errnos
+// the file system returns most; rarer ones are counted as OtherErrno. Keep it
+// at 30 when adding one, dropping the least common.
+var commonErrnos = map[syscall.Errno]string{
+	syscall.ENOENT:       "ENOENT",
+	syscall.EIO:          "EIO",
+	syscall.EACCES:       "EACCES",
+	syscall.EPERM:        "EPERM",
+	syscall.EEXIST:       "EEXIST",
+	syscall.ENOTDIR:      "ENOTDIR",
+	syscall.EISDIR:       "EISDIR",
+	syscall.EINVAL:       "EINVAL",
+	syscall.ENOTEMPTY:    "ENOTEMPTY",
+	syscall.ENOSPC:       "ENOSPC",
+	syscall.EINTR:        "EINTR",
+	syscall.ECANCELED:    "ECANCELED",
+	syscall.ESTALE:       "ESTALE",
+	syscall.ENOSYS:       "ENOSYS",
+	syscall.ENOTSUP:      "ENOTSUP",
+	syscall.ENODATA:      "ENODATA",
+	syscall.ERANGE:       "ERANGE",
+	syscall.EBADF:        "EBADF",
+	syscall.EAGAIN:       "EAGAIN",
+	syscall.EBUSY:        "EBUSY",
+	syscall.EFBIG:        "EFBIG",
+	syscall.ENAMETOOLONG: "ENAMETOOLONG",
+	syscall.EROFS:        "EROFS",
+	syscall.EXDEV:        "EXDEV",
+	syscall.ENXIO:        "ENXIO",
+	syscall.ETIMEDOUT:    "ETIMEDOUT",
+	syscall.EDQUOT:       "EDQUOT",
+	syscall.EMFILE:       "EMFILE",
+	syscall.ENOMEM:       "ENOMEM",
+	syscall.ELOOP:        "ELOOP",
+}
+
+// fsErrnoStr maps an error to the name of its errno, for the fs_errno tag.
+func fsErrnoStr(err error) string {
+	if err == nil {
+		return ""
+	}
+	var errno syscall.Errno
+	if errors.As(err, &errno) {
+		if name, ok := commonErrnos[errno]; ok {
+			return name
+		}
+	}
+	return OtherErrno
+}
+
+// The key of the *opStart in the contexts of ops.
+type opStartKey struct{}
 
-	// Recording opCount.
-	if err := stats.RecordWithTags(
-		ctx,
-		[]tag.Mutator{
-			tag.Upsert(tags.FSOp, method),
-		},
-		opsCount.M(1),
-	); err != nil {
-		// Error in recording opCount.
-		logger.Errorf("Cannot record file system op: %v", err)
+// When an op was received, and when it started running.
+type opStart struct {
+	received time.Time
+
+	// In Unix nanoseconds, or 0 if the file system didn't say.
+	running atomic.Int64
+
+	// The GCS requests made by the op, if counted.
+	gcsRequests *gcs.RequestCounter
+}
+
+// MarkOpRunning records that the op with the given context, as passed by
+// WithMonitoring, has acquired the lock it was queued for and is running.
+// Only the first call for an op counts, and calls for other contexts do
+// nothing.
+func MarkOpRunning(ctx context.Context) {
+	if start, ok := ctx.Value(opStartKey{}).(*opStart); ok {
+		start.running.CompareAndSwap(0, time.Now().UnixNano())
 	}
+}
 
-	// Recording opErrorCount.
-	if fsErr != nil {
+// Start timing an op received now, returning the context to pass on for the
+// file system to mark when it runs.
+func (fs *monitoring) startOp(ctx context.Context) (context.Context, *opStart) {
+	start := &opStart{received: time.Now()}
+	if fs.measures.queue != nil {
+		ctx = context.WithValue(ctx, opStartKey{}, start)
+	}
+	if fs.logGCSRequests || fs.measures.gcsRequests != nil || fs.measures.gcsLatency != nil {
+		ctx, start.gcsRequests = gcs.WithRequestCounter(ctx)
+	}
+	return ctx, start
+}
+
+// The id the kernel gave the op, which the fuse debug logs show, or zero.
+func opFuseID(op interface{}) uint64 {
+	v := reflect.ValueOf(op)
+	if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct {
+		return 0
+	}
+	if f := v.Elem().FieldByName("OpContext"); f.IsValid() {
+		if opContext, ok := f.Interface().(fuseops.OpContext); ok {
+			return opContext.FuseID
+		}
+	}
+	return 0
+}
+
+// Records the GCS requests the op made, and logs them if asked to.
+func (fs *monitoring) recordGCSRequests(ctx context.Context, method string, op interface{}, start *opStart) {
+	if start.gcsRequests == nil {
+		return
+	}
+
+	count := start.gcsRequests.Count()
+	duration := start.gcsRequests.Duration()
+	if fs.logGCSRequests {
+		logger.Tracef("fuse_debug: Op 0x%08x %s: %d GCS requests (%v)", opFuseID(op), method, count, duration)
+	}
+
+	m := fs.measures
+	mutators := []tag.Mutator{tag.Upsert(tags.FSOp, method)}
+	if m.gcsRequests != nil {
+		if err := stats.RecordWithTags(ctx, mutators, m.gcsRequests.M(count)); err != nil {
+			logger.Errorf("Cannot record the GCS requests of a file system operation: %v", err)
+		}
+	}
+	if m.gcsLatency != nil {
+		latencyMs := float64(duration.Microseconds()) / 1000.0
+		if err := stats.RecordWithTags(ctx, mutators, m.gcsLatency.M(latencyMs)); err != nil {
+			logger.Errorf("Cannot record the GCS latency of a file system operation: %v", err)
+		}
+	}
+}
+
+// Records file system operation count, failed operation count, the operation
+// latency, the time it was queued and the GCS requests it made, those of them
+// that are enabled.
+func (fs *monitoring) recordOp(ctx context.Context, method string, op interface{}, start *opStart, fsErr error) {
+	fs.session.RecordOp(method, fsErrStr(fsErr))
+	fs.recordGCSRequests(ctx, method, op, start)
+
+	m := fs.measures
+
+	// Recording opCount.
+	if m.count != nil {
 		if err := stats.RecordWithTags(
 			ctx,
 			[]tag.Mutator{
 				tag.Upsert(tags.FSOp, method),
-				tag.Upsert(tags.FSError, fsErrStr(fsErr)),
 			},
-			opsErrorCount.M(1),
+			m.count.M(1),
+		); err != nil {
+			// Error in recording opCount.
+			logger.Errorf("Cannot record file system op: %v", err)
+		}
+	}
+
+	// Recording opErrorCount.
+	if fsErr != nil && m.errorCount != nil {
+		mutators := []tag.Mutator{
+			tag.Upsert(tags.FSOp, method),
+			tag.Upsert(tags.FSError, fsErrStr(fsErr)),
+		}
+		if fs.detailedErrors {
+			mutators = append(mutators, tag.Upsert(tags.FSErrno, fsErrnoStr(fsErr)))
+		}
+		if err := stats.RecordWithTags(
+			ctx,
+			mutators,
+			m.errorCount.M(1),
 		); err != nil {
 			// Error in recording opErrorCount.
 			logger.Errorf("Cannot record error count of the file system failed operations: %v", err)
@@ -111,292 +392,341 @@ func recordOp(ctx context.Context, method string, start time.Time, fsErr error)
 	}
 
 	// Recording opLatency.
-	latencyMs := float64(time.Since(start).Microseconds()) / 1000.0
-	if err := stats.RecordWithTags(
-		ctx,
-		[]tag.Mutator{
-			tag.Upsert(tags.FSOp, method),
-		},
-		opsLatency.M(latencyMs),
-	); err != nil {
-		// Error in opLatency.
-		logger.Errorf("Cannot record file system operation latency: %v", err)
+	if m.latency != nil {
+		latencyMs := float64(time.Since(start.received).Microseconds()) / 1000.0
+		if err := stats.RecordWithTags(
+			ctx,
+			[]tag.Mutator{
+				tag.Upsert(tags.FSOp, method),
+			},
+			m.latency.M(latencyMs),
+		); err != nil {
+			// Error in opLatency.
+			logger.Errorf("Cannot record file system operation latency: %v", err)
+		}
+	}
+
+	// Recording opQueueLatency, for ops the file system marked as running.
+	if running := start.running.Load(); m.queue != nil && running != 0 {
+		queueMs := float64(time.Unix(0, running).Sub(start.received).Microseconds()) / 1000.0
+		if err := stats.RecordWithTags(
+			ctx,
+			[]tag.Mutator{
+				tag.Upsert(tags.FSOp, method),
+			},
+			m.queue.M(queueMs),
+		); err != nil {
+			logger.Errorf("Cannot record file system operation queue latency: %v", err)
+		}
 	}
 }
 
 // WithMonitoring takes a FileSystem, returns a FileSystem with monitoring
-// on the counts of requests per API.
-func WithMonitoring(fs fuseutil.FileSystem) fuseutil.FileSystem {
+// on the counts of requests per API, recording the measures that opts
+// selects. Their views must be registered for them to be exported; see
+// EnableMonitoringViews. The session, from now until the file system is
+// destroyed, is summed up in a record logged then.
+func WithMonitoring(fs fuseutil.FileSystem, opts MonitoringOptions) fuseutil.FileSystem {
 	return &monitoring{
-		wrapped: fs,
+		wrapped:            fs,
+		measures:           newOpsMeasures(opts),
+		session:            monitor.NewSessionRecorder(timeutil.RealClock()),
+		sessionSummaryFile: opts.SessionSummaryFile,
+		logGCSRequests:     opts.LogGCSRequests,
+		detailedErrors:     opts.DetailedErrors,
 	}
 }
 
 type monitoring struct {
-	wrapped fuseutil.FileSystem
+	wrapped            fuseutil.FileSystem
+	measures           opsMeasures
+	session            *monitor.SessionRecorder
+	sessionSummaryFile string
+	logGCSRequests     bool
+	detailedErrors     bool
 }
 
 func (fs *monitoring) Destroy() {
 	fs.wrapped.Destroy()
+
+	summary := fs.session.Finish()
+	summary.Log()
+	if fs.sessionSummaryFile != "" {
+		if err := summary.WriteFile(fs.sessionSummaryFile); err != nil {
+			logger.Errorf("Cannot write the session summary: %v", err)
+		}
+	}
 }
 
 func (fs *monitoring) StatFS(
 	ctx context.Context,
 	op *fuseops.StatFSOp) error {
-	startTime := time.Now()
+	ctx, start := fs.startOp(ctx)
 	err := fs.wrapped.StatFS(ctx, op)
-	recordOp(ctx, "StatFS", startTime, err)
+	fs.recordOp(ctx, "StatFS", op, start, err)
 	return err
 }
 
 func (fs *monitoring) LookUpInode(
 	ctx context.Context,
 	op *fuseops.LookUpInodeOp) error {
-	startTime := time.Now()
+	ctx, start := fs.startOp(ctx)
 	err := fs.wrapped.LookUpInode(ctx, op)
-	recordOp(ctx, "LookUpInode", startTime, err)
+	fs.recordOp(ctx, "LookUpInode", op, start, err)
 	return err
 }
 
 func (fs *monitoring) GetInodeAttributes(
 	ctx context.Context,
 	op *fuseops.GetInodeAttributesOp) error {
-	startTime := time.Now()
+	ctx, start := fs.startOp(ctx)
 	err := fs.wrapped.GetInodeAttributes(ctx, op)
-	recordOp(ctx, "GetInodeAttributes", startTime, err)
+	fs.recordOp(ctx, "GetInodeAttributes", op, start, err)
 	return err
 }
 
 func (fs *monitoring) SetInodeAttributes(
 	ctx context.Context,
 	op *fuseops.SetInodeAttributesOp) error {
-	startTime := time.Now()
+	ctx, start := fs.startOp(ctx)
 	err := fs.wrapped.SetInodeAttributes(ctx, op)
-	recordOp(ctx, "SetInodeAttributes", startTime, err)
+	fs.recordOp(ctx, "SetInodeAttributes", op, start, err)
 	return err
 }
 
 func (fs *monitoring) ForgetInode(
 	ctx context.Context,
 	op *fuseops.ForgetInodeOp) error {
-	startTime := time.Now()
+	ctx, start := fs.startOp(ctx)
 	err := fs.wrapped.ForgetInode(ctx, op)
-	recordOp(ctx, "ForgetInode", startTime, err)
+	fs.recordOp(ctx, "ForgetInode", op, start, err)
 	return err
 }
 
 func (fs *monitoring) BatchForget(
 	ctx context.Context,
 	op *fuseops.BatchForgetOp) error {
-	startTime := time.Now()
+	ctx, start := fs.startOp(ctx)
 	err := fs.wrapped.BatchForget(ctx, op)
-	recordOp(ctx, "BatchForget", startTime, err)
+	fs.recordOp(ctx, "BatchForget", op, start, err)
 	return err
 }
 
 func (fs *monitoring) MkDir(
 	ctx context.Context,
 	op *fuseops.MkDirOp) error {
-	startTime := time.Now()
+	ctx, start := fs.startOp(ctx)
 	err := fs.wrapped.MkDir(ctx, op)
-	recordOp(ctx, "MkDir", startTime, err)
+	fs.recordOp(ctx, "MkDir", op, start, err)
 	return err
 }
 
 func (fs *monitoring) MkNode(
 	ctx context.Context,
 	op *fuseops.MkNodeOp) error {
-	startTime := time.Now()
+	ctx, start := fs.startOp(ctx)
 	err := fs.wrapped.MkNode(ctx, op)
-	recordOp(ctx, "MkNode", startTime, err)
+	fs.recordOp(ctx, "MkNode", op, start, err)
 	return err
 }
 
 func (fs *monitoring) CreateFile(
 	ctx context.Context,
 	op *fuseops.CreateFileOp) error {
-	startTime := time.Now()
+	ctx, start := fs.startOp(ctx)
 	err := fs.wrapped.CreateFile(ctx, op)
-	recordOp(ctx, "CreateFile", startTime, err)
+	fs.recordOp(ctx, "CreateFile", op, start, err)
 	return err
 }
 
 func (fs *monitoring) CreateLink(
 	ctx context.Context,
 	op *fuseops.CreateLinkOp) error {
-	startTime := time.Now()
+	ctx, start := fs.startOp(ctx)
 	err := fs.wrapped.CreateLink(ctx, op)
-	recordOp(ctx, "CreateLink", startTime, err)
+	fs.recordOp(ctx, "CreateLink", op, start, err)
 	return err
 }
 
 func (fs *monitoring) CreateSymlink(
 	ctx context.Context,
 	op *fuseops.CreateSymlinkOp) error {
-	startTime := time.Now()
+	ctx, start := fs.startOp(ctx)
 	err := fs.wrapped.CreateSymlink(ctx, op)
-	recordOp(ctx, "CreateSymlink", startTime, err)
+	fs.recordOp(ctx, "CreateSymlink", op, start, err)
 	return err
 }
 
 func (fs *monitoring) Rename(
 	ctx context.Context,
 	op *fuseops.RenameOp) error {
-	startTime := time.Now()
+	ctx, start := fs.startOp(ctx)
 	err := fs.wrapped.Rename(ctx, op)
-	recordOp(ctx, "Rename", startTime, err)
+	fs.recordOp(ctx, "Rename", op, start, err)
 	return err
 }
 
 func (fs *monitoring) RmDir(
 	ctx context.Context,
 	op *fuseops.RmDirOp) error {
-	startTime := time.Now()
+	ctx, start := fs.startOp(ctx)
 	err := fs.wrapped.RmDir(ctx, op)
-	recordOp(ctx, "RmDir", startTime, err)
+	fs.recordOp(ctx, "RmDir", op, start, err)
 	return err
 }
 
 func (fs *monitoring) Unlink(
 	ctx context.Context,
 	op *fuseops.UnlinkOp) error {
-	startTime := time.Now()
+	ctx, start := fs.startOp(ctx)
 	err := fs.wrapped.Unlink(ctx, op)
-	recordOp(ctx, "Unlink", startTime, err)
+	fs.recordOp(ctx, "Unlink", op, start, err)
 	return err
 }
 
 func (fs *monitoring) OpenDir(
 	ctx context.Context,
 	op *fuseops.OpenDirOp) error {
-	startTime := time.Now()
+	ctx, start := fs.startOp(ctx)
 	err := fs.wrapped.OpenDir(ctx, op)
-	recordOp(ctx, "OpenDir", startTime, err)
+	fs.recordOp(ctx, "OpenDir", op, start, err)
 	return err
 }
 
 func (fs *monitoring) ReadDir(
 	ctx context.Context,
 	op *fuseops.ReadDirOp) error {
-	startTime := time.Now()
+	ctx, start := fs.startOp(ctx)
 	err := fs.wrapped.ReadDir(ctx, op)
-	recordOp(ctx, "ReadDir", startTime, err)
+	fs.recordOp(ctx, "ReadDir", op, start, err)
 	return err
 }
 
 func (fs *monitoring) ReleaseDirHandle(
 	ctx context.Context,
 	op *fuseops.ReleaseDirHandleOp) error {
-	startTime := time.Now()
+	ctx, start := fs.startOp(ctx)
 	err := fs.wrapped.ReleaseDirHandle(ctx, op)
-	recordOp(ctx, "ReleaseDirHandle", startTime, err)
+	fs.recordOp(ctx, "ReleaseDirHandle", op, start, err)
 	return err
 }
 
 func (fs *monitoring) OpenFile(
 	ctx context.Context,
 	op *fuseops.OpenFileOp) error {
-	startTime := time.Now()
+	ctx, start := fs.startOp(ctx)
 	err := fs.wrapped.OpenFile(ctx, op)
-	recordOp(ctx, "OpenFile", startTime, err)
+	fs.recordOp(ctx, "OpenFile", op, start, err)
 	return err
 }
 
 func (fs *monitoring) ReadFile(
 	ctx context.Context,
 	op *fuseops.ReadFileOp) error {
-	startTime := time.Now()
+	ctx, start := fs.startOp(ctx)
 	err := fs.wrapped.ReadFile(ctx, op)
-	recordOp(ctx, "ReadFile", startTime, err)
+	fs.recordOp(ctx, "ReadFile", op, start, err)
 	return err
 }
 
 func (fs *monitoring) WriteFile(
 	ctx context.Context,
 	op *fuseops.WriteFileOp) error {
-	startTime := time.Now()
+	ctx, start := fs.startOp(ctx)
 	err := fs.wrapped.WriteFile(ctx, op)
-	recordOp(ctx, "WriteFile", startTime, err)
+	if err == nil {
+		fs.session.RecordWrite(len(op.Data))
+	}
+	fs.recordOp(ctx, "WriteFile", op, start, err)
 	return err
 }
 
 func (fs *monitoring) SyncFile(
 	ctx context.Context,
 	op *fuseops.SyncFileOp) error {
-	startTime := time.Now()
+	ctx, start := fs.startOp(ctx)
 	err := fs.wrapped.SyncFile(ctx, op)
-	recordOp(ctx, "SyncFile", startTime, err)
+	fs.recordOp(ctx, "SyncFile", op, start, err)
 	return err
 }
 
 func (fs *monitoring) FlushFile(
 	ctx context.Context,
 	op *fuseops.FlushFileOp) error {
-	startTime := time.Now()
+	ctx, start := fs.startOp(ctx)
 	err := fs.wrapped.FlushFile(ctx, op)
-	recordOp(ctx, "FlushFile", startTime, err)
+	fs.recordOp(ctx, "FlushFile", op, start, err)
 	return err
 }
 
 func (fs *monitoring) ReleaseFileHandle(
 	ctx context.Context,
 	op *fuseops.ReleaseFileHandleOp) error {
-	startTime := time.Now()
+	ctx, start := fs.startOp(ctx)
 	err := fs.wrapped.ReleaseFileHandle(ctx, op)
-	recordOp(ctx, "ReleaseFileHandle", startTime, err)
+	fs.recordOp(ctx, "ReleaseFileHandle", op, start, err)
 	return err
 }
 
 func (fs *monitoring) ReadSymlink(
 	ctx context.Context,
 	op *fuseops.ReadSymlinkOp) error {
-	startTime := time.Now()
+	ctx, start := fs.startOp(ctx)
 	err := fs.wrapped.ReadSymlink(ctx, op)
-	recordOp(ctx, "ReadSymlink", startTime, err)
+	fs.recordOp(ctx, "ReadSymlink", op, start, err)
 	return err
 }
 
 func (fs *monitoring) RemoveXattr(
 	ctx context.Context,
 	op *fuseops.RemoveXattrOp) error {
-	startTime := time.Now()
+	ctx, start := fs.startOp(ctx)
 	err := fs.wrapped.RemoveXattr(ctx, op)
-	recordOp(ctx, "RemoveXattr", startTime, err)
+	fs.recordOp(ctx, "RemoveXattr", op, start, err)
 	return err
 }
 
 func (fs *monitoring) GetXattr(
 	ctx context.Context,
 	op *fuseops.GetXattrOp) error {
-	startTime := time.Now()
+	ctx, start := fs.startOp(ctx)
 	err := fs.wrapped.GetXattr(ctx, op)
-	recordOp(ctx, "GetXattr", startTime, err)
+	fs.recordOp(ctx, "GetXattr", op, start, err)
 	return err
 }
 
 func (fs *monitoring) ListXattr(
 	ctx context.Context,
 	op *fuseops.ListXattrOp) error {
-	startTime := time.Now()
+	ctx, start := fs.startOp(ctx)
 	err := fs.wrapped.ListXattr(ctx, op)
-	recordOp(ctx, "ListXattr", startTime, err)
+	fs.recordOp(ctx, "ListXattr", op, start, err)
 	return err
 }
 
 func (fs *monitoring) SetXattr(
 	ctx context.Context,
 	op *fuseops.SetXattrOp) error {
-	startTime := time.Now()
+	ctx, start := fs.startOp(ctx)
 	err := fs.wrapped.SetXattr(ctx, op)
-	recordOp(ctx, "SetXattr", startTime, err)
+	fs.recordOp(ctx, "SetXattr", op, start, err)
 	return err
 }
 
 func (fs *monitoring) Fallocate(
 	ctx context.Context,
 	op *fuseops.FallocateOp) error {
-	startTime := time.Now()
+	ctx, start := fs.startOp(ctx)
 	err := fs.wrapped.Fallocate(ctx, op)
-	recordOp(ctx, "Fallocate", startTime, err)
+	fs.recordOp(ctx, "Fallocate", op, start, err)
+	return err
+}
+
+func (fs *monitoring) CopyFileRange(
+	ctx context.Context,
+	op *fuseops.CopyFileRangeOp) error {
+	ctx, start := fs.startOp(ctx)
+	err := fs.wrapped.CopyFileRange(ctx, op)
+	fs.recordOp(ctx, "CopyFileRange", op, start, err)
 	return err
 }
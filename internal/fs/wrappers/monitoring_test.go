@@ -0,0 +1,321 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrappers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/monitor/tags"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/fuseutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+	"golang.org/x/sys/unix"
+)
+
+// The names of the views registered by EnableMonitoringViews.
+var defaultViewNames = []string{
+	"fs/ops_count",
+	"fs/ops_error_count",
+	"fs/ops_latency",
+	"fs/ops_queue_latency",
+	"fs/ops_gcs_requests",
+	"fs/ops_gcs_latency",
+	"fs/ops_in_flight",
+}
+
+// Return the sum of the rows of the named view.
+func viewSum(t *testing.T, name string) (sum float64) {
+	t.Helper()
+	rows, err := view.RetrieveData(name)
+	require.NoError(t, err)
+	for _, row := range rows {
+		switch data := row.Data.(type) {
+		case *view.SumData:
+			sum += data.Value
+		case *view.CountData:
+			sum += float64(data.Value)
+		}
+	}
+	return
+}
+
+func TestWithMonitoring_RegistersNoViews(t *testing.T) {
+	fs := WithMonitoring(WithParallelism(&fuseutil.NotImplementedFileSystem{}, 0), MonitoringOptions{})
+
+	_ = fs.StatFS(context.Background(), &fuseops.StatFSOp{})
+
+	for _, name := range defaultViewNames {
+		assert.Nil(t, view.Find(name), name)
+	}
+}
+
+func TestWithMonitoring_PrefixAndMeasures(t *testing.T) {
+	fs := WithMonitoring(&fuseutil.NotImplementedFileSystem{}, MonitoringOptions{
+		MetricPrefix: "embedder/",
+		Measures:     []string{OpsCountMeasure},
+	})
+	countView := &view.View{
+		Name:        "embedder/ops_count",
+		Measure:     newOpsMeasures(MonitoringOptions{MetricPrefix: "embedder/"}).count,
+		Aggregation: view.Sum(),
+	}
+	errorCountView := &view.View{
+		Name:        "embedder/ops_error_count",
+		Measure:     newOpsMeasures(MonitoringOptions{MetricPrefix: "embedder/"}).errorCount,
+		Aggregation: view.Count(),
+	}
+	require.NoError(t, view.Register(countView, errorCountView))
+	defer view.Unregister(countView, errorCountView)
+
+	// The op fails, as it isn't implemented, but only its count is recorded.
+	_ = fs.StatFS(context.Background(), &fuseops.StatFSOp{})
+	_ = fs.StatFS(context.Background(), &fuseops.StatFSOp{})
+
+	assert.Equal(t, float64(2), viewSum(t, "embedder/ops_count"))
+	assert.Equal(t, float64(0), viewSum(t, "embedder/ops_error_count"))
+	assert.Nil(t, view.Find("fs/ops_count"))
+}
+
+func TestEnableMonitoringViews(t *testing.T) {
+	require.NoError(t, EnableMonitoringViews(MonitoringOptions{}))
+	// Enabling them again does nothing.
+	require.NoError(t, EnableMonitoringViews(MonitoringOptions{}))
+	defer func() {
+		for _, name := range defaultViewNames {
+			view.Unregister(view.Find(name))
+		}
+	}()
+	fs := WithMonitoring(&fuseutil.NotImplementedFileSystem{}, MonitoringOptions{})
+
+	_ = fs.StatFS(context.Background(), &fuseops.StatFSOp{})
+
+	for _, name := range defaultViewNames {
+		assert.NotNil(t, view.Find(name), name)
+	}
+	assert.Equal(t, float64(1), viewSum(t, "fs/ops_count"))
+	assert.Equal(t, float64(1), viewSum(t, "fs/ops_error_count"))
+}
+
+func TestRegisterMonitoringViews_DetailedErrors(t *testing.T) {
+	require.NoError(t, registerMonitoringViews(true))
+	defer func() {
+		for _, name := range defaultViewNames {
+			view.Unregister(view.Find(name))
+		}
+	}()
+	fs := WithMonitoring(&fuseutil.NotImplementedFileSystem{}, MonitoringOptions{DetailedErrors: true})
+
+	_ = fs.StatFS(context.Background(), &fuseops.StatFSOp{})
+
+	rows, err := view.RetrieveData("fs/ops_error_count")
+	require.NoError(t, err)
+	require.Len(t, rows, 1)
+	assert.Contains(t, rows[0].Tags, tag.Tag{Key: tags.FSErrno, Value: "ENOSYS"})
+	assert.Contains(t, rows[0].Tags, tag.Tag{Key: tags.FSError, Value: syscall.ENOSYS.Error()})
+}
+
+func TestCommonErrnos(t *testing.T) {
+	// The cardinality guard: no more than 30 errnos get their own value, and
+	// none of them is mistaken for another or for OTHER.
+	assert.Len(t, commonErrnos, 30)
+	names := make(map[string]bool)
+	for errno, name := range commonErrnos {
+		assert.False(t, names[name], name)
+		names[name] = true
+		assert.NotEqual(t, OtherErrno, name)
+		assert.Equal(t, name, unix.ErrnoName(errno))
+	}
+}
+
+func TestFSErrnoStr(t *testing.T) {
+	testCases := []struct {
+		name     string
+		err      error
+		expected string
+	}{
+		{"nil", nil, ""},
+		{"common", syscall.ENOENT, "ENOENT"},
+		{"wrapped", fmt.Errorf("StatObject: %w", syscall.ESTALE), "ESTALE"},
+		{"uncommon", syscall.EHOSTDOWN, OtherErrno},
+		{"not an errno", errors.New("boom"), OtherErrno},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, fsErrnoStr(tc.err))
+		})
+	}
+}
+
+// lockingFS runs its ops under a lock, like the file system does, taking
+// slowOpDuration for LookUpInode.
+type lockingFS struct {
+	fuseutil.NotImplementedFileSystem
+	mu     sync.Mutex
+	locked chan struct{}
+}
+
+const slowOpDuration = 100 * time.Millisecond
+
+func (fs *lockingFS) LookUpInode(
+	ctx context.Context,
+	op *fuseops.LookUpInodeOp) error {
+	fs.mu.Lock()
+	MarkOpRunning(ctx)
+	defer fs.mu.Unlock()
+
+	close(fs.locked)
+	time.Sleep(slowOpDuration)
+	return nil
+}
+
+func (fs *lockingFS) GetInodeAttributes(
+	ctx context.Context,
+	op *fuseops.GetInodeAttributesOp) error {
+	fs.mu.Lock()
+	MarkOpRunning(ctx)
+	defer fs.mu.Unlock()
+
+	return nil
+}
+
+func TestWithMonitoring_QueueLatency(t *testing.T) {
+	inner := &lockingFS{locked: make(chan struct{})}
+	fs := WithMonitoring(inner, MonitoringOptions{
+		MetricPrefix: "contention/",
+		Measures:     []string{OpsQueueLatencyMeasure},
+	})
+	queueView := &view.View{
+		Name:        "contention/ops_queue_latency",
+		Measure:     newOpsMeasures(MonitoringOptions{MetricPrefix: "contention/"}).queue,
+		Aggregation: view.Distribution(),
+		TagKeys:     []tag.Key{tags.FSOp},
+	}
+	require.NoError(t, view.Register(queueView))
+	defer view.Unregister(queueView)
+
+	// The slow op holds the lock while the other waits for it.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = fs.LookUpInode(context.Background(), &fuseops.LookUpInodeOp{})
+	}()
+	<-inner.locked
+	require.NoError(t, fs.GetInodeAttributes(context.Background(), &fuseops.GetInodeAttributesOp{}))
+	<-done
+
+	rows, err := view.RetrieveData(queueView.Name)
+	require.NoError(t, err)
+	queued := make(map[string]*view.DistributionData)
+	for _, row := range rows {
+		require.Len(t, row.Tags, 1)
+		queued[row.Tags[0].Value] = row.Data.(*view.DistributionData)
+	}
+	require.Contains(t, queued, "LookUpInode")
+	require.Contains(t, queued, "GetInodeAttributes")
+	assert.Equal(t, int64(1), queued["LookUpInode"].Count)
+	assert.Less(t, queued["LookUpInode"].Max, float64(slowOpDuration.Milliseconds())/2)
+	assert.Equal(t, int64(1), queued["GetInodeAttributes"].Count)
+	assert.GreaterOrEqual(t, queued["GetInodeAttributes"].Max, float64(slowOpDuration.Milliseconds())/2)
+}
+
+func TestWithMonitoring_NoQueueLatencyUnlessMarked(t *testing.T) {
+	fs := WithMonitoring(&fuseutil.NotImplementedFileSystem{}, MonitoringOptions{
+		MetricPrefix: "unmarked/",
+	})
+	queueView := &view.View{
+		Name:        "unmarked/ops_queue_latency",
+		Measure:     newOpsMeasures(MonitoringOptions{MetricPrefix: "unmarked/"}).queue,
+		Aggregation: view.Count(),
+	}
+	require.NoError(t, view.Register(queueView))
+	defer view.Unregister(queueView)
+
+	_ = fs.StatFS(context.Background(), &fuseops.StatFSOp{})
+
+	assert.Equal(t, float64(0), viewSum(t, queueView.Name))
+}
+
+// gcsFS makes gcsRequests GCS requests of gcsRequestDuration for each
+// LookUpInode.
+type gcsFS struct {
+	fuseutil.NotImplementedFileSystem
+}
+
+const (
+	gcsRequests        = 3
+	gcsRequestDuration = 5 * time.Millisecond
+)
+
+func (fs *gcsFS) LookUpInode(
+	ctx context.Context,
+	op *fuseops.LookUpInodeOp) error {
+	for i := 0; i < gcsRequests; i++ {
+		gcs.CountRequest(ctx, gcsRequestDuration)
+	}
+	return nil
+}
+
+func TestWithMonitoring_GCSRequests(t *testing.T) {
+	fs := WithMonitoring(&gcsFS{}, MonitoringOptions{
+		MetricPrefix: "gcs/",
+		Measures:     []string{OpsGCSRequestsMeasure, OpsGCSLatencyMeasure},
+	})
+	measures := newOpsMeasures(MonitoringOptions{MetricPrefix: "gcs/"})
+	requestsView := &view.View{
+		Name:        "gcs/ops_gcs_requests",
+		Measure:     measures.gcsRequests,
+		Aggregation: view.Distribution(),
+		TagKeys:     []tag.Key{tags.FSOp},
+	}
+	latencyView := &view.View{
+		Name:        "gcs/ops_gcs_latency",
+		Measure:     measures.gcsLatency,
+		Aggregation: view.Sum(),
+	}
+	require.NoError(t, view.Register(requestsView, latencyView))
+	defer view.Unregister(requestsView, latencyView)
+
+	require.NoError(t, fs.LookUpInode(context.Background(), &fuseops.LookUpInodeOp{}))
+	_ = fs.StatFS(context.Background(), &fuseops.StatFSOp{})
+
+	rows, err := view.RetrieveData(requestsView.Name)
+	require.NoError(t, err)
+	requests := make(map[string]*view.DistributionData)
+	for _, row := range rows {
+		require.Len(t, row.Tags, 1)
+		requests[row.Tags[0].Value] = row.Data.(*view.DistributionData)
+	}
+	require.Contains(t, requests, "LookUpInode")
+	require.Contains(t, requests, "StatFS")
+	assert.Equal(t, float64(gcsRequests), requests["LookUpInode"].Mean)
+	assert.Equal(t, float64(0), requests["StatFS"].Mean)
+	assert.Equal(t, float64(gcsRequests*gcsRequestDuration.Milliseconds()), viewSum(t, latencyView.Name))
+}
+
+func TestOpFuseID(t *testing.T) {
+	assert.Equal(t, uint64(17), opFuseID(&fuseops.LookUpInodeOp{OpContext: fuseops.OpContext{FuseID: 17}}))
+	assert.Equal(t, uint64(0), opFuseID(&fuseops.BatchForgetOp{}))
+}
@@ -0,0 +1,229 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrappers
+
+import (
+	"context"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/fuseutil"
+)
+
+// WithOpMetadata takes a FileSystem, returns a FileSystem that makes the
+// contexts of operations carry their storageutil.OpMetadata, for the requests
+// to GCS made for them to send.
+func WithOpMetadata(fs fuseutil.FileSystem) fuseutil.FileSystem {
+	return &opMetadata{
+		wrapped: fs,
+	}
+}
+
+type opMetadata struct {
+	wrapped fuseutil.FileSystem
+}
+
+func withOp(ctx context.Context, op string, opCtx fuseops.OpContext) context.Context {
+	return storageutil.WithOpMetadata(ctx, storageutil.OpMetadata{
+		Op:  op,
+		ID:  opCtx.FuseID,
+		Uid: opCtx.Uid,
+	})
+}
+
+func (fs *opMetadata) Destroy() {
+	fs.wrapped.Destroy()
+}
+
+// StatFS is answered without GCS, and its op doesn't have a context.
+func (fs *opMetadata) StatFS(
+	ctx context.Context,
+	op *fuseops.StatFSOp) error {
+	return fs.wrapped.StatFS(ctx, op)
+}
+
+func (fs *opMetadata) LookUpInode(
+	ctx context.Context,
+	op *fuseops.LookUpInodeOp) error {
+	return fs.wrapped.LookUpInode(withOp(ctx, "LookUpInode", op.OpContext), op)
+}
+
+func (fs *opMetadata) GetInodeAttributes(
+	ctx context.Context,
+	op *fuseops.GetInodeAttributesOp) error {
+	return fs.wrapped.GetInodeAttributes(withOp(ctx, "GetInodeAttributes", op.OpContext), op)
+}
+
+func (fs *opMetadata) SetInodeAttributes(
+	ctx context.Context,
+	op *fuseops.SetInodeAttributesOp) error {
+	return fs.wrapped.SetInodeAttributes(withOp(ctx, "SetInodeAttributes", op.OpContext), op)
+}
+
+func (fs *opMetadata) ForgetInode(
+	ctx context.Context,
+	op *fuseops.ForgetInodeOp) error {
+	return fs.wrapped.ForgetInode(withOp(ctx, "ForgetInode", op.OpContext), op)
+}
+
+func (fs *opMetadata) BatchForget(
+	ctx context.Context,
+	op *fuseops.BatchForgetOp) error {
+	return fs.wrapped.BatchForget(withOp(ctx, "BatchForget", op.OpContext), op)
+}
+
+func (fs *opMetadata) MkDir(
+	ctx context.Context,
+	op *fuseops.MkDirOp) error {
+	return fs.wrapped.MkDir(withOp(ctx, "MkDir", op.OpContext), op)
+}
+
+func (fs *opMetadata) MkNode(
+	ctx context.Context,
+	op *fuseops.MkNodeOp) error {
+	return fs.wrapped.MkNode(withOp(ctx, "MkNode", op.OpContext), op)
+}
+
+func (fs *opMetadata) CreateFile(
+	ctx context.Context,
+	op *fuseops.CreateFileOp) error {
+	return fs.wrapped.CreateFile(withOp(ctx, "CreateFile", op.OpContext), op)
+}
+
+func (fs *opMetadata) CreateLink(
+	ctx context.Context,
+	op *fuseops.CreateLinkOp) error {
+	return fs.wrapped.CreateLink(withOp(ctx, "CreateLink", op.OpContext), op)
+}
+
+func (fs *opMetadata) CreateSymlink(
+	ctx context.Context,
+	op *fuseops.CreateSymlinkOp) error {
+	return fs.wrapped.CreateSymlink(withOp(ctx, "CreateSymlink", op.OpContext), op)
+}
+
+func (fs *opMetadata) Rename(
+	ctx context.Context,
+	op *fuseops.RenameOp) error {
+	return fs.wrapped.Rename(withOp(ctx, "Rename", op.OpContext), op)
+}
+
+func (fs *opMetadata) RmDir(
+	ctx context.Context,
+	op *fuseops.RmDirOp) error {
+	return fs.wrapped.RmDir(withOp(ctx, "RmDir", op.OpContext), op)
+}
+
+func (fs *opMetadata) Unlink(
+	ctx context.Context,
+	op *fuseops.UnlinkOp) error {
+	return fs.wrapped.Unlink(withOp(ctx, "Unlink", op.OpContext), op)
+}
+
+func (fs *opMetadata) OpenDir(
+	ctx context.Context,
+	op *fuseops.OpenDirOp) error {
+	return fs.wrapped.OpenDir(withOp(ctx, "OpenDir", op.OpContext), op)
+}
+
+func (fs *opMetadata) ReadDir(
+	ctx context.Context,
+	op *fuseops.ReadDirOp) error {
+	return fs.wrapped.ReadDir(withOp(ctx, "ReadDir", op.OpContext), op)
+}
+
+func (fs *opMetadata) ReleaseDirHandle(
+	ctx context.Context,
+	op *fuseops.ReleaseDirHandleOp) error {
+	return fs.wrapped.ReleaseDirHandle(withOp(ctx, "ReleaseDirHandle", op.OpContext), op)
+}
+
+func (fs *opMetadata) OpenFile(
+	ctx context.Context,
+	op *fuseops.OpenFileOp) error {
+	return fs.wrapped.OpenFile(withOp(ctx, "OpenFile", op.OpContext), op)
+}
+
+func (fs *opMetadata) ReadFile(
+	ctx context.Context,
+	op *fuseops.ReadFileOp) error {
+	return fs.wrapped.ReadFile(withOp(ctx, "ReadFile", op.OpContext), op)
+}
+
+func (fs *opMetadata) WriteFile(
+	ctx context.Context,
+	op *fuseops.WriteFileOp) error {
+	return fs.wrapped.WriteFile(withOp(ctx, "WriteFile", op.OpContext), op)
+}
+
+func (fs *opMetadata) SyncFile(
+	ctx context.Context,
+	op *fuseops.SyncFileOp) error {
+	return fs.wrapped.SyncFile(withOp(ctx, "SyncFile", op.OpContext), op)
+}
+
+func (fs *opMetadata) FlushFile(
+	ctx context.Context,
+	op *fuseops.FlushFileOp) error {
+	return fs.wrapped.FlushFile(withOp(ctx, "FlushFile", op.OpContext), op)
+}
+
+func (fs *opMetadata) ReleaseFileHandle(
+	ctx context.Context,
+	op *fuseops.ReleaseFileHandleOp) error {
+	return fs.wrapped.ReleaseFileHandle(withOp(ctx, "ReleaseFileHandle", op.OpContext), op)
+}
+
+func (fs *opMetadata) ReadSymlink(
+	ctx context.Context,
+	op *fuseops.ReadSymlinkOp) error {
+	return fs.wrapped.ReadSymlink(withOp(ctx, "ReadSymlink", op.OpContext), op)
+}
+
+func (fs *opMetadata) RemoveXattr(
+	ctx context.Context,
+	op *fuseops.RemoveXattrOp) error {
+	return fs.wrapped.RemoveXattr(withOp(ctx, "RemoveXattr", op.OpContext), op)
+}
+
+func (fs *opMetadata) GetXattr(
+	ctx context.Context,
+	op *fuseops.GetXattrOp) error {
+	return fs.wrapped.GetXattr(withOp(ctx, "GetXattr", op.OpContext), op)
+}
+
+func (fs *opMetadata) ListXattr(
+	ctx context.Context,
+	op *fuseops.ListXattrOp) error {
+	return fs.wrapped.ListXattr(withOp(ctx, "ListXattr", op.OpContext), op)
+}
+
+func (fs *opMetadata) SetXattr(
+	ctx context.Context,
+	op *fuseops.SetXattrOp) error {
+	return fs.wrapped.SetXattr(withOp(ctx, "SetXattr", op.OpContext), op)
+}
+
+func (fs *opMetadata) Fallocate(
+	ctx context.Context,
+	op *fuseops.FallocateOp) error {
+	return fs.wrapped.Fallocate(withOp(ctx, "Fallocate", op.OpContext), op)
+}
+
+func (fs *opMetadata) CopyFileRange(
+	ctx context.Context,
+	op *fuseops.CopyFileRangeOp) error {
+	return fs.wrapped.CopyFileRange(withOp(ctx, "CopyFileRange", op.OpContext), op)
+}
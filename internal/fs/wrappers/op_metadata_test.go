@@ -0,0 +1,77 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrappers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/fuseutil"
+	"github.com/stretchr/testify/assert"
+)
+
+// recordingFileSystem records the OpMetadata of the contexts of the operations
+// it serves.
+type recordingFileSystem struct {
+	fuseutil.NotImplementedFileSystem
+	recorded []storageutil.OpMetadata
+}
+
+func (fs *recordingFileSystem) record(ctx context.Context) {
+	if m, ok := storageutil.OpMetadataFrom(ctx); ok {
+		fs.recorded = append(fs.recorded, m)
+	}
+}
+
+func (fs *recordingFileSystem) ReadFile(
+	ctx context.Context,
+	op *fuseops.ReadFileOp) error {
+	fs.record(ctx)
+	return nil
+}
+
+func (fs *recordingFileSystem) WriteFile(
+	ctx context.Context,
+	op *fuseops.WriteFileOp) error {
+	fs.record(ctx)
+	return nil
+}
+
+func (fs *recordingFileSystem) ReadDir(
+	ctx context.Context,
+	op *fuseops.ReadDirOp) error {
+	fs.record(ctx)
+	return nil
+}
+
+func TestOpMetadata(t *testing.T) {
+	recording := &recordingFileSystem{}
+	fs := WithOpMetadata(recording)
+	opCtx := func(id uint64) fuseops.OpContext {
+		return fuseops.OpContext{FuseID: id, Pid: 7, Uid: 1000}
+	}
+
+	assert.NoError(t, fs.ReadFile(context.Background(), &fuseops.ReadFileOp{OpContext: opCtx(1)}))
+	assert.NoError(t, fs.WriteFile(context.Background(), &fuseops.WriteFileOp{OpContext: opCtx(2)}))
+	assert.NoError(t, fs.ReadDir(context.Background(), &fuseops.ReadDirOp{OpContext: opCtx(3)}))
+
+	assert.Equal(t, []storageutil.OpMetadata{
+		{Op: "ReadFile", ID: 1, Uid: 1000},
+		{Op: "WriteFile", ID: 2, Uid: 1000},
+		{Op: "ReadDir", ID: 3, Uid: 1000},
+	}, recording.recorded)
+}
@@ -0,0 +1,379 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrappers
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/fuseutil"
+	"go.opencensus.io/stats"
+)
+
+var opsInFlight = stats.Int64("fs/ops_in_flight", "The number of file system operations being processed.", stats.UnitDimensionless)
+
+// WithParallelism takes a FileSystem, returns a FileSystem that processes at
+// most limit operations at a time, or any number if limit is zero, and
+// records how many it is processing. Operations waiting for their turn fail
+// if their context is cancelled.
+//
+// Forgetting inodes isn't limited: the fuse server does it on the goroutine
+// that reads operations from the kernel, which mustn't block.
+func WithParallelism(fs fuseutil.FileSystem, limit int) fuseutil.FileSystem {
+	p := &parallelism{
+		wrapped: fs,
+	}
+	if limit > 0 {
+		p.slots = make(chan struct{}, limit)
+	}
+
+	return p
+}
+
+type parallelism struct {
+	wrapped fuseutil.FileSystem
+
+	// Holds a value for each operation being processed, or nil for no limit.
+	slots chan struct{}
+
+	inFlight atomic.Int64
+}
+
+// begin waits for the turn of an operation, which must call end once done
+// unless begin fails.
+func (fs *parallelism) begin(ctx context.Context) error {
+	if fs.slots != nil {
+		select {
+		case fs.slots <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	fs.recordInFlight(ctx, fs.inFlight.Add(1))
+	return nil
+}
+
+func (fs *parallelism) end(ctx context.Context) {
+	fs.recordInFlight(ctx, fs.inFlight.Add(-1))
+
+	if fs.slots != nil {
+		<-fs.slots
+	}
+}
+
+func (fs *parallelism) recordInFlight(ctx context.Context, n int64) {
+	if err := stats.RecordWithTags(ctx, nil, opsInFlight.M(n)); err != nil {
+		logger.Errorf("Cannot record file system operations in flight: %v", err)
+	}
+}
+
+func (fs *parallelism) Destroy() {
+	fs.wrapped.Destroy()
+}
+
+func (fs *parallelism) StatFS(
+	ctx context.Context,
+	op *fuseops.StatFSOp) error {
+	if err := fs.begin(ctx); err != nil {
+		return err
+	}
+	defer fs.end(ctx)
+	return fs.wrapped.StatFS(ctx, op)
+}
+
+func (fs *parallelism) LookUpInode(
+	ctx context.Context,
+	op *fuseops.LookUpInodeOp) error {
+	if err := fs.begin(ctx); err != nil {
+		return err
+	}
+	defer fs.end(ctx)
+	return fs.wrapped.LookUpInode(ctx, op)
+}
+
+func (fs *parallelism) GetInodeAttributes(
+	ctx context.Context,
+	op *fuseops.GetInodeAttributesOp) error {
+	if err := fs.begin(ctx); err != nil {
+		return err
+	}
+	defer fs.end(ctx)
+	return fs.wrapped.GetInodeAttributes(ctx, op)
+}
+
+func (fs *parallelism) SetInodeAttributes(
+	ctx context.Context,
+	op *fuseops.SetInodeAttributesOp) error {
+	if err := fs.begin(ctx); err != nil {
+		return err
+	}
+	defer fs.end(ctx)
+	return fs.wrapped.SetInodeAttributes(ctx, op)
+}
+
+func (fs *parallelism) ForgetInode(
+	ctx context.Context,
+	op *fuseops.ForgetInodeOp) error {
+	return fs.wrapped.ForgetInode(ctx, op)
+}
+
+func (fs *parallelism) BatchForget(
+	ctx context.Context,
+	op *fuseops.BatchForgetOp) error {
+	return fs.wrapped.BatchForget(ctx, op)
+}
+
+func (fs *parallelism) MkDir(
+	ctx context.Context,
+	op *fuseops.MkDirOp) error {
+	if err := fs.begin(ctx); err != nil {
+		return err
+	}
+	defer fs.end(ctx)
+	return fs.wrapped.MkDir(ctx, op)
+}
+
+func (fs *parallelism) MkNode(
+	ctx context.Context,
+	op *fuseops.MkNodeOp) error {
+	if err := fs.begin(ctx); err != nil {
+		return err
+	}
+	defer fs.end(ctx)
+	return fs.wrapped.MkNode(ctx, op)
+}
+
+func (fs *parallelism) CreateFile(
+	ctx context.Context,
+	op *fuseops.CreateFileOp) error {
+	if err := fs.begin(ctx); err != nil {
+		return err
+	}
+	defer fs.end(ctx)
+	return fs.wrapped.CreateFile(ctx, op)
+}
+
+func (fs *parallelism) CreateLink(
+	ctx context.Context,
+	op *fuseops.CreateLinkOp) error {
+	if err := fs.begin(ctx); err != nil {
+		return err
+	}
+	defer fs.end(ctx)
+	return fs.wrapped.CreateLink(ctx, op)
+}
+
+func (fs *parallelism) CreateSymlink(
+	ctx context.Context,
+	op *fuseops.CreateSymlinkOp) error {
+	if err := fs.begin(ctx); err != nil {
+		return err
+	}
+	defer fs.end(ctx)
+	return fs.wrapped.CreateSymlink(ctx, op)
+}
+
+func (fs *parallelism) Rename(
+	ctx context.Context,
+	op *fuseops.RenameOp) error {
+	if err := fs.begin(ctx); err != nil {
+		return err
+	}
+	defer fs.end(ctx)
+	return fs.wrapped.Rename(ctx, op)
+}
+
+func (fs *parallelism) RmDir(
+	ctx context.Context,
+	op *fuseops.RmDirOp) error {
+	if err := fs.begin(ctx); err != nil {
+		return err
+	}
+	defer fs.end(ctx)
+	return fs.wrapped.RmDir(ctx, op)
+}
+
+func (fs *parallelism) Unlink(
+	ctx context.Context,
+	op *fuseops.UnlinkOp) error {
+	if err := fs.begin(ctx); err != nil {
+		return err
+	}
+	defer fs.end(ctx)
+	return fs.wrapped.Unlink(ctx, op)
+}
+
+func (fs *parallelism) OpenDir(
+	ctx context.Context,
+	op *fuseops.OpenDirOp) error {
+	if err := fs.begin(ctx); err != nil {
+		return err
+	}
+	defer fs.end(ctx)
+	return fs.wrapped.OpenDir(ctx, op)
+}
+
+func (fs *parallelism) ReadDir(
+	ctx context.Context,
+	op *fuseops.ReadDirOp) error {
+	if err := fs.begin(ctx); err != nil {
+		return err
+	}
+	defer fs.end(ctx)
+	return fs.wrapped.ReadDir(ctx, op)
+}
+
+func (fs *parallelism) ReleaseDirHandle(
+	ctx context.Context,
+	op *fuseops.ReleaseDirHandleOp) error {
+	if err := fs.begin(ctx); err != nil {
+		return err
+	}
+	defer fs.end(ctx)
+	return fs.wrapped.ReleaseDirHandle(ctx, op)
+}
+
+func (fs *parallelism) OpenFile(
+	ctx context.Context,
+	op *fuseops.OpenFileOp) error {
+	if err := fs.begin(ctx); err != nil {
+		return err
+	}
+	defer fs.end(ctx)
+	return fs.wrapped.OpenFile(ctx, op)
+}
+
+func (fs *parallelism) ReadFile(
+	ctx context.Context,
+	op *fuseops.ReadFileOp) error {
+	if err := fs.begin(ctx); err != nil {
+		return err
+	}
+	defer fs.end(ctx)
+	return fs.wrapped.ReadFile(ctx, op)
+}
+
+func (fs *parallelism) WriteFile(
+	ctx context.Context,
+	op *fuseops.WriteFileOp) error {
+	if err := fs.begin(ctx); err != nil {
+		return err
+	}
+	defer fs.end(ctx)
+	return fs.wrapped.WriteFile(ctx, op)
+}
+
+func (fs *parallelism) SyncFile(
+	ctx context.Context,
+	op *fuseops.SyncFileOp) error {
+	if err := fs.begin(ctx); err != nil {
+		return err
+	}
+	defer fs.end(ctx)
+	return fs.wrapped.SyncFile(ctx, op)
+}
+
+func (fs *parallelism) FlushFile(
+	ctx context.Context,
+	op *fuseops.FlushFileOp) error {
+	if err := fs.begin(ctx); err != nil {
+		return err
+	}
+	defer fs.end(ctx)
+	return fs.wrapped.FlushFile(ctx, op)
+}
+
+func (fs *parallelism) ReleaseFileHandle(
+	ctx context.Context,
+	op *fuseops.ReleaseFileHandleOp) error {
+	if err := fs.begin(ctx); err != nil {
+		return err
+	}
+	defer fs.end(ctx)
+	return fs.wrapped.ReleaseFileHandle(ctx, op)
+}
+
+func (fs *parallelism) ReadSymlink(
+	ctx context.Context,
+	op *fuseops.ReadSymlinkOp) error {
+	if err := fs.begin(ctx); err != nil {
+		return err
+	}
+	defer fs.end(ctx)
+	return fs.wrapped.ReadSymlink(ctx, op)
+}
+
+func (fs *parallelism) RemoveXattr(
+	ctx context.Context,
+	op *fuseops.RemoveXattrOp) error {
+	if err := fs.begin(ctx); err != nil {
+		return err
+	}
+	defer fs.end(ctx)
+	return fs.wrapped.RemoveXattr(ctx, op)
+}
+
+func (fs *parallelism) GetXattr(
+	ctx context.Context,
+	op *fuseops.GetXattrOp) error {
+	if err := fs.begin(ctx); err != nil {
+		return err
+	}
+	defer fs.end(ctx)
+	return fs.wrapped.GetXattr(ctx, op)
+}
+
+func (fs *parallelism) ListXattr(
+	ctx context.Context,
+	op *fuseops.ListXattrOp) error {
+	if err := fs.begin(ctx); err != nil {
+		return err
+	}
+	defer fs.end(ctx)
+	return fs.wrapped.ListXattr(ctx, op)
+}
+
+func (fs *parallelism) SetXattr(
+	ctx context.Context,
+	op *fuseops.SetXattrOp) error {
+	if err := fs.begin(ctx); err != nil {
+		return err
+	}
+	defer fs.end(ctx)
+	return fs.wrapped.SetXattr(ctx, op)
+}
+
+func (fs *parallelism) Fallocate(
+	ctx context.Context,
+	op *fuseops.FallocateOp) error {
+	if err := fs.begin(ctx); err != nil {
+		return err
+	}
+	defer fs.end(ctx)
+	return fs.wrapped.Fallocate(ctx, op)
+}
+
+func (fs *parallelism) CopyFileRange(
+	ctx context.Context,
+	op *fuseops.CopyFileRangeOp) error {
+	if err := fs.begin(ctx); err != nil {
+		return err
+	}
+	defer fs.end(ctx)
+	return fs.wrapped.CopyFileRange(ctx, op)
+}
@@ -0,0 +1,135 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrappers
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/fuseutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// slowFileSystem takes delay to read, like a file system waiting on GCS, and
+// records how many reads it served at most at a time.
+type slowFileSystem struct {
+	fuseutil.NotImplementedFileSystem
+	delay time.Duration
+
+	reading    atomic.Int64
+	maxReading atomic.Int64
+}
+
+func (fs *slowFileSystem) ReadFile(
+	ctx context.Context,
+	op *fuseops.ReadFileOp) error {
+	n := fs.reading.Add(1)
+	defer fs.reading.Add(-1)
+	for {
+		m := fs.maxReading.Load()
+		if n <= m || fs.maxReading.CompareAndSwap(m, n) {
+			break
+		}
+	}
+
+	time.Sleep(fs.delay)
+	return nil
+}
+
+func (fs *slowFileSystem) ForgetInode(
+	ctx context.Context,
+	op *fuseops.ForgetInodeOp) error {
+	return nil
+}
+
+// Read with the given number of concurrent readers.
+func readConcurrently(fs fuseutil.FileSystem, readers int) {
+	var wg sync.WaitGroup
+	for i := 0; i < readers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = fs.ReadFile(context.Background(), &fuseops.ReadFileOp{})
+		}()
+	}
+	wg.Wait()
+}
+
+func TestParallelism_Limited(t *testing.T) {
+	slow := &slowFileSystem{delay: 10 * time.Millisecond}
+	fs := WithParallelism(slow, 4)
+
+	readConcurrently(fs, 32)
+
+	assert.Equal(t, int64(4), slow.maxReading.Load())
+	assert.Equal(t, int64(0), fs.(*parallelism).inFlight.Load())
+}
+
+func TestParallelism_Unlimited(t *testing.T) {
+	slow := &slowFileSystem{delay: 10 * time.Millisecond}
+	fs := WithParallelism(slow, 0)
+
+	readConcurrently(fs, 32)
+
+	assert.Equal(t, int64(32), slow.maxReading.Load())
+}
+
+func TestParallelism_CancelledWhileWaiting(t *testing.T) {
+	slow := &slowFileSystem{delay: time.Second}
+	fs := WithParallelism(slow, 1)
+	go func() { _ = fs.ReadFile(context.Background(), &fuseops.ReadFileOp{}) }()
+	require.Eventually(t, func() bool { return slow.reading.Load() == 1 }, time.Second, time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := fs.ReadFile(ctx, &fuseops.ReadFileOp{})
+
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestParallelism_ForgetIsNotLimited(t *testing.T) {
+	slow := &slowFileSystem{delay: time.Second}
+	fs := WithParallelism(slow, 1)
+	go func() { _ = fs.ReadFile(context.Background(), &fuseops.ReadFileOp{}) }()
+	require.Eventually(t, func() bool { return slow.reading.Load() == 1 }, time.Second, time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := fs.ForgetInode(ctx, &fuseops.ForgetInodeOp{})
+
+	assert.NoError(t, err)
+}
+
+// Concurrent readers of a file system whose reads wait on GCS scale with the
+// parallelism, up to the number of readers.
+func BenchmarkParallelism(b *testing.B) {
+	for _, limit := range []int{12, 96, 0} {
+		b.Run(fmt.Sprintf("limit=%d", limit), func(b *testing.B) {
+			fs := WithParallelism(&slowFileSystem{delay: time.Millisecond}, limit)
+			b.SetParallelism(96)
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					_ = fs.ReadFile(context.Background(), &fuseops.ReadFileOp{})
+				}
+			})
+		})
+	}
+}
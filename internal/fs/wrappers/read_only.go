@@ -0,0 +1,128 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrappers
+
+import (
+	"context"
+	"syscall"
+
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/fuseutil"
+)
+
+// WithReadOnly takes a FileSystem, returns a FileSystem that fails the ops
+// that would change it with EROFS, before they reach it, and opening files
+// for writing too. Ops that only read, and flushing and releasing handles,
+// pass through.
+func WithReadOnly(fs fuseutil.FileSystem) fuseutil.FileSystem {
+	return &readOnly{FileSystem: fs}
+}
+
+type readOnly struct {
+	fuseutil.FileSystem
+}
+
+func (fs *readOnly) SetInodeAttributes(
+	ctx context.Context,
+	op *fuseops.SetInodeAttributesOp) error {
+	return syscall.EROFS
+}
+
+func (fs *readOnly) MkDir(
+	ctx context.Context,
+	op *fuseops.MkDirOp) error {
+	return syscall.EROFS
+}
+
+func (fs *readOnly) MkNode(
+	ctx context.Context,
+	op *fuseops.MkNodeOp) error {
+	return syscall.EROFS
+}
+
+func (fs *readOnly) CreateFile(
+	ctx context.Context,
+	op *fuseops.CreateFileOp) error {
+	return syscall.EROFS
+}
+
+func (fs *readOnly) CreateLink(
+	ctx context.Context,
+	op *fuseops.CreateLinkOp) error {
+	return syscall.EROFS
+}
+
+func (fs *readOnly) CreateSymlink(
+	ctx context.Context,
+	op *fuseops.CreateSymlinkOp) error {
+	return syscall.EROFS
+}
+
+func (fs *readOnly) Rename(
+	ctx context.Context,
+	op *fuseops.RenameOp) error {
+	return syscall.EROFS
+}
+
+func (fs *readOnly) RmDir(
+	ctx context.Context,
+	op *fuseops.RmDirOp) error {
+	return syscall.EROFS
+}
+
+func (fs *readOnly) Unlink(
+	ctx context.Context,
+	op *fuseops.UnlinkOp) error {
+	return syscall.EROFS
+}
+
+func (fs *readOnly) OpenFile(
+	ctx context.Context,
+	op *fuseops.OpenFileOp) error {
+	if !op.OpenFlags.IsReadOnly() {
+		return syscall.EROFS
+	}
+	return fs.FileSystem.OpenFile(ctx, op)
+}
+
+func (fs *readOnly) WriteFile(
+	ctx context.Context,
+	op *fuseops.WriteFileOp) error {
+	return syscall.EROFS
+}
+
+func (fs *readOnly) RemoveXattr(
+	ctx context.Context,
+	op *fuseops.RemoveXattrOp) error {
+	return syscall.EROFS
+}
+
+func (fs *readOnly) SetXattr(
+	ctx context.Context,
+	op *fuseops.SetXattrOp) error {
+	return syscall.EROFS
+}
+
+func (fs *readOnly) Fallocate(
+	ctx context.Context,
+	op *fuseops.FallocateOp) error {
+	return syscall.EROFS
+}
+
+func (fs *readOnly) CopyFileRange(
+	ctx context.Context,
+	op *fuseops.CopyFileRangeOp) error {
+	return syscall.EROFS
+}
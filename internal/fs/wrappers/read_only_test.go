@@ -0,0 +1,90 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrappers
+
+import (
+	"context"
+	"syscall"
+	"testing"
+
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/fuseutil"
+	"github.com/stretchr/testify/assert"
+)
+
+// countingFS succeeds at every op it implements, counting them.
+type countingFS struct {
+	fuseutil.NotImplementedFileSystem
+	ops int
+}
+
+func (fs *countingFS) OpenFile(ctx context.Context, op *fuseops.OpenFileOp) error {
+	fs.ops++
+	return nil
+}
+
+func (fs *countingFS) ReadFile(ctx context.Context, op *fuseops.ReadFileOp) error {
+	fs.ops++
+	return nil
+}
+
+func (fs *countingFS) FlushFile(ctx context.Context, op *fuseops.FlushFileOp) error {
+	fs.ops++
+	return nil
+}
+
+func TestReadOnly_RefusesChanges(t *testing.T) {
+	inner := &countingFS{}
+	fs := WithReadOnly(inner)
+	ctx := context.Background()
+
+	ops := map[string]func() error{
+		"SetInodeAttributes": func() error { return fs.SetInodeAttributes(ctx, &fuseops.SetInodeAttributesOp{}) },
+		"MkDir":              func() error { return fs.MkDir(ctx, &fuseops.MkDirOp{}) },
+		"MkNode":             func() error { return fs.MkNode(ctx, &fuseops.MkNodeOp{}) },
+		"CreateFile":         func() error { return fs.CreateFile(ctx, &fuseops.CreateFileOp{}) },
+		"CreateLink":         func() error { return fs.CreateLink(ctx, &fuseops.CreateLinkOp{}) },
+		"CreateSymlink":      func() error { return fs.CreateSymlink(ctx, &fuseops.CreateSymlinkOp{}) },
+		"Rename":             func() error { return fs.Rename(ctx, &fuseops.RenameOp{}) },
+		"RmDir":              func() error { return fs.RmDir(ctx, &fuseops.RmDirOp{}) },
+		"Unlink":             func() error { return fs.Unlink(ctx, &fuseops.UnlinkOp{}) },
+		"OpenFile for writing": func() error {
+			return fs.OpenFile(ctx, &fuseops.OpenFileOp{OpenFlags: syscall.O_WRONLY})
+		},
+		"WriteFile":   func() error { return fs.WriteFile(ctx, &fuseops.WriteFileOp{}) },
+		"RemoveXattr": func() error { return fs.RemoveXattr(ctx, &fuseops.RemoveXattrOp{}) },
+		"SetXattr":    func() error { return fs.SetXattr(ctx, &fuseops.SetXattrOp{}) },
+		"Fallocate":   func() error { return fs.Fallocate(ctx, &fuseops.FallocateOp{}) },
+		"CopyFileRange": func() error {
+			return fs.CopyFileRange(ctx, &fuseops.CopyFileRangeOp{})
+		},
+	}
+
+	for name, op := range ops {
+		assert.Equal(t, syscall.EROFS, op(), name)
+	}
+	assert.Equal(t, 0, inner.ops)
+}
+
+func TestReadOnly_PassesReads(t *testing.T) {
+	inner := &countingFS{}
+	fs := WithReadOnly(inner)
+	ctx := context.Background()
+
+	assert.NoError(t, fs.OpenFile(ctx, &fuseops.OpenFileOp{}))
+	assert.NoError(t, fs.ReadFile(ctx, &fuseops.ReadFileOp{}))
+	assert.NoError(t, fs.FlushFile(ctx, &fuseops.FlushFileOp{}))
+	assert.Equal(t, 3, inner.ops)
+}
@@ -0,0 +1,559 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Tests for the extended attributes exposing the generation and
+// metageneration of objects, and the glob queries and usage of directories.
+
+package fs_test
+
+import (
+	"bytes"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/fs/inode"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	. "github.com/jacobsa/oglematchers"
+	. "github.com/jacobsa/ogletest"
+	"golang.org/x/sys/unix"
+)
+
+////////////////////////////////////////////////////////////////////////
+// Boilerplate
+////////////////////////////////////////////////////////////////////////
+
+type XattrTest struct {
+	fsTest
+}
+
+func init() { RegisterTestSuite(&XattrTest{}) }
+
+type DirUsageXattrTest struct {
+	fsTest
+}
+
+func init() { RegisterTestSuite(&DirUsageXattrTest{}) }
+
+func (t *DirUsageXattrTest) SetUpTestSuite() {
+	t.serverCfg.DirSizeXattrMaxObjects = 3
+	t.fsTest.SetUpTestSuite()
+}
+
+type MetadataQueryXattrTest struct {
+	fsTest
+}
+
+func init() { RegisterTestSuite(&MetadataQueryXattrTest{}) }
+
+func (t *MetadataQueryXattrTest) SetUpTestSuite() {
+	t.serverCfg.MetadataQueryMaxObjects = 4
+	t.fsTest.SetUpTestSuite()
+}
+
+func getxattr(p string, name string) (value string, err error) {
+	buf := make([]byte, 64)
+	n, err := unix.Getxattr(p, name, buf)
+	if err != nil {
+		return
+	}
+
+	value = string(buf[:n])
+	return
+}
+
+// Return the names under the directory matching the glob, as reported by the
+// glob extended attribute.
+func globxattr(dir string, pattern string) (names []string, err error) {
+	name := inode.GlobXattrPrefix + pattern
+	n, err := unix.Getxattr(dir, name, nil)
+	if err != nil {
+		return
+	}
+
+	buf := make([]byte, n)
+	n, err = unix.Getxattr(dir, name, buf)
+	if err != nil {
+		return
+	}
+
+	names = strings.Split(strings.TrimSuffix(string(buf[:n]), "\n"), "\n")
+	if len(names) == 1 && names[0] == "" {
+		names = nil
+	}
+	return
+}
+
+// Return the names under the directory matching the metadata query, as
+// reported by the metadata extended attribute, and whether they were cut
+// short.
+func metadataxattr(dir string, query string) (names []string, truncated bool, err error) {
+	name := inode.MetadataXattrPrefix + query
+	n, err := unix.Getxattr(dir, name, nil)
+	if err != nil {
+		return
+	}
+
+	buf := make([]byte, n)
+	n, err = unix.Getxattr(dir, name, buf)
+	if err != nil {
+		return
+	}
+
+	if n == 0 {
+		return
+	}
+
+	// An empty line marks the names as truncated.
+	for _, line := range strings.Split(strings.TrimSuffix(string(buf[:n]), "\n"), "\n") {
+		if line == "" {
+			truncated = true
+			continue
+		}
+		names = append(names, line)
+	}
+	return
+}
+
+// Create objects with the given custom metadata.
+func createObjectsWithMetadata(objs map[string]map[string]string) error {
+	for name, m := range objs {
+		_, err := bucket.CreateObject(ctx, &gcs.CreateObjectRequest{
+			Name:     name,
+			Contents: strings.NewReader(""),
+			Metadata: m,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func statObject(name string) *gcs.MinObject {
+	m, _, err := bucket.StatObject(ctx, &gcs.StatObjectRequest{Name: name})
+	AssertEq(nil, err)
+	return m
+}
+
+////////////////////////////////////////////////////////////////////////
+// Tests
+////////////////////////////////////////////////////////////////////////
+
+func (t *XattrTest) Generation() {
+	AssertEq(nil, t.createWithContents("foo", "taco"))
+	p := path.Join(mntDir, "foo")
+	m := statObject("foo")
+
+	value, err := getxattr(p, inode.GenerationXattr)
+	AssertEq(nil, err)
+	ExpectEq(strconv.FormatInt(m.Generation, 10), value)
+
+	value, err = getxattr(p, inode.MetaGenerationXattr)
+	AssertEq(nil, err)
+	ExpectEq(strconv.FormatInt(m.MetaGeneration, 10), value)
+}
+
+func (t *XattrTest) OverwriteChangesGeneration() {
+	AssertEq(nil, t.createWithContents("foo", "taco"))
+	p := path.Join(mntDir, "foo")
+	before, err := getxattr(p, inode.GenerationXattr)
+	AssertEq(nil, err)
+
+	AssertEq(nil, os.WriteFile(p, []byte("burrito"), 0600))
+
+	after, err := getxattr(p, inode.GenerationXattr)
+	AssertEq(nil, err)
+	ExpectNe(before, after)
+	ExpectEq(strconv.FormatInt(statObject("foo").Generation, 10), after)
+}
+
+func (t *XattrTest) SetMtimeChangesOnlyMetaGeneration() {
+	AssertEq(nil, t.createWithContents("foo", "taco"))
+	p := path.Join(mntDir, "foo")
+	generation, err := getxattr(p, inode.GenerationXattr)
+	AssertEq(nil, err)
+	version, err := getxattr(p, inode.VersionXattr)
+	AssertEq(nil, err)
+
+	AssertEq(nil, os.Chtimes(p, time.Now(), time.Now().Add(-time.Hour)))
+
+	value, err := getxattr(p, inode.GenerationXattr)
+	AssertEq(nil, err)
+	ExpectEq(generation, value)
+	value, err = getxattr(p, inode.VersionXattr)
+	AssertEq(nil, err)
+	ExpectNe(version, value)
+}
+
+func (t *XattrTest) DirtyFileHasNone() {
+	f, err := os.Create(path.Join(mntDir, "foo"))
+	AssertEq(nil, err)
+	defer f.Close()
+
+	_, err = getxattr(f.Name(), inode.GenerationXattr)
+	ExpectEq(unix.ENODATA, err)
+}
+
+func (t *XattrTest) UnknownName() {
+	AssertEq(nil, t.createWithContents("foo", "taco"))
+
+	_, err := getxattr(path.Join(mntDir, "foo"), "user.taco")
+	ExpectEq(unix.ENODATA, err)
+}
+
+func (t *XattrTest) List() {
+	AssertEq(nil, t.createWithContents("foo", "taco"))
+
+	buf := make([]byte, 256)
+	n, err := unix.Listxattr(path.Join(mntDir, "foo"), buf)
+	AssertEq(nil, err)
+
+	names := bytes.Split(bytes.TrimSuffix(buf[:n], []byte{0}), []byte{0})
+	AssertEq(len(inode.XattrNames), len(names))
+	for i, name := range inode.XattrNames {
+		ExpectEq(name, string(names[i]))
+	}
+}
+
+func (t *XattrTest) SetAndRemoveUserNamespace() {
+	AssertEq(nil, t.createWithContents("foo", "taco"))
+	p := path.Join(mntDir, "foo")
+
+	for _, name := range []string{"user.taco", inode.GenerationXattr} {
+		err := unix.Setxattr(p, name, []byte("burrito"), 0)
+		ExpectEq(unix.EOPNOTSUPP, err, "%s", name)
+
+		err = unix.Removexattr(p, name)
+		ExpectEq(unix.EOPNOTSUPP, err, "%s", name)
+	}
+}
+
+func (t *XattrTest) PosixACLs() {
+	AssertEq(nil, os.Mkdir(path.Join(mntDir, "dir"), 0700))
+	p := path.Join(mntDir, "dir")
+
+	// There are none beyond the mode, as for rsync -A.
+	for _, name := range []string{"system.posix_acl_access", "system.posix_acl_default"} {
+		_, err := getxattr(p, name)
+		ExpectEq(unix.ENODATA, err, "%s", name)
+	}
+
+	// user::rwx, group::---, other::---
+	acl := []byte{
+		2, 0, 0, 0,
+		0x01, 0, 7, 0, 0xff, 0xff, 0xff, 0xff,
+		0x04, 0, 0, 0, 0xff, 0xff, 0xff, 0xff,
+		0x20, 0, 0, 0, 0xff, 0xff, 0xff, 0xff,
+	}
+	err := unix.Setxattr(p, "system.posix_acl_access", acl, 0)
+	ExpectEq(unix.EOPNOTSUPP, err)
+
+	err = unix.Removexattr(p, "system.posix_acl_default")
+	ExpectEq(unix.EOPNOTSUPP, err)
+}
+
+func (t *XattrTest) OtherSystemNamespace() {
+	AssertEq(nil, t.createWithContents("foo", "taco"))
+
+	_, err := getxattr(path.Join(mntDir, "foo"), "system.nfs4_acl")
+	ExpectEq(unix.EOPNOTSUPP, err)
+}
+
+func (t *XattrTest) SecurityNamespace() {
+	AssertEq(nil, t.createWithContents("foo", "taco"))
+	p := path.Join(mntDir, "foo")
+
+	for _, name := range []string{"security.capability", "security.selinux"} {
+		_, err := getxattr(p, name)
+		ExpectEq(unix.ENODATA, err, "%s", name)
+	}
+
+	err := unix.Setxattr(p, "security.taco", []byte("burrito"), 0)
+	ExpectEq(unix.EOPNOTSUPP, err)
+}
+
+func (t *XattrTest) TrustedNamespace() {
+	AssertEq(nil, t.createWithContents("foo", "taco"))
+	p := path.Join(mntDir, "foo")
+
+	_, err := getxattr(p, "trusted.taco")
+	ExpectEq(unix.ENODATA, err)
+
+	err = unix.Setxattr(p, "trusted.taco", []byte("burrito"), 0)
+	ExpectEq(unix.EOPNOTSUPP, err)
+}
+
+func (t *XattrTest) GlobAgreesWithClientSideFiltering() {
+	AssertEq(
+		nil,
+		t.createObjects(
+			map[string]string{
+				"dir/":          "",
+				"dir/a.csv":     "",
+				"dir/b.csv":     "",
+				"dir/c.txt":     "",
+				"dir/ab.txt":    "",
+				"dir/sub/":      "",
+				"dir/sub/d.csv": "",
+				"e.csv":         "",
+			}))
+	dir := path.Join(mntDir, "dir")
+
+	for _, pattern := range []string{"*.csv", "?.txt", "[ab]*", "*/*.csv", "x*"} {
+		matches, err := filepath.Glob(path.Join(dir, pattern))
+		AssertEq(nil, err)
+		var expected []string
+		for _, m := range matches {
+			rel, err := filepath.Rel(dir, m)
+			AssertEq(nil, err)
+			expected = append(expected, rel)
+		}
+
+		names, err := globxattr(dir, pattern)
+		AssertEq(nil, err)
+		ExpectThat(names, DeepEquals(expected), "pattern: %q", pattern)
+	}
+}
+
+func (t *XattrTest) GlobRecursive() {
+	AssertEq(
+		nil,
+		t.createObjects(
+			map[string]string{
+				"dir/a.csv":         "",
+				"dir/sub/b.csv":     "",
+				"dir/sub/sub/c.csv": "",
+				"dir/sub/d.txt":     "",
+			}))
+
+	names, err := globxattr(path.Join(mntDir, "dir"), "**.csv")
+	AssertEq(nil, err)
+	ExpectThat(names, ElementsAre("a.csv", "sub/b.csv", "sub/sub/c.csv"))
+
+	names, err = globxattr(mntDir, "dir/sub/{b.csv,d.txt}")
+	AssertEq(nil, err)
+	ExpectThat(names, ElementsAre("dir/sub/b.csv", "dir/sub/d.txt"))
+}
+
+func (t *XattrTest) GlobInvalid() {
+	_, err := globxattr(mntDir, "{a,b")
+	ExpectEq(unix.EINVAL, err)
+}
+
+func (t *XattrTest) GlobOnFile() {
+	AssertEq(nil, t.createWithContents("foo", "taco"))
+
+	_, err := globxattr(path.Join(mntDir, "foo"), "*")
+	ExpectEq(unix.ENODATA, err)
+}
+
+func (t *XattrTest) DirUsageDisabled() {
+	AssertEq(nil, t.createWithContents("foo", "taco"))
+
+	_, err := getxattr(mntDir, inode.ObjectCountXattr)
+	ExpectEq(unix.ENODATA, err)
+}
+
+func (t *DirUsageXattrTest) CountsObjectsRecursively() {
+	AssertEq(
+		nil,
+		t.createObjects(
+			map[string]string{
+				"dir/":          "",
+				"dir/a":         "taco",
+				"dir/sub/b":     "burrito",
+				"dir/sub/sub/c": "enchilada",
+				"e":             "elsewhere",
+			}))
+	dir := path.Join(mntDir, "dir")
+
+	size, err := getxattr(dir, inode.RecursiveSizeXattr)
+	AssertEq(nil, err)
+	ExpectEq(strconv.Itoa(len("taco")+len("burrito")+len("enchilada")), size)
+
+	count, err := getxattr(dir, inode.ObjectCountXattr)
+	AssertEq(nil, err)
+	ExpectEq("3", count)
+}
+
+func (t *DirUsageXattrTest) Progress() {
+	AssertEq(
+		nil,
+		t.createObjects(
+			map[string]string{
+				"dir/a":     "taco",
+				"dir/sub/b": "burrito",
+			}))
+	dir := path.Join(mntDir, "dir")
+
+	_, err := getxattr(dir, inode.UsageProgressXattr)
+	ExpectEq(unix.ENODATA, err)
+
+	_, err = getxattr(dir, inode.ObjectCountXattr)
+	AssertEq(nil, err)
+
+	progress, err := getxattr(dir, inode.UsageProgressXattr)
+	AssertEq(nil, err)
+	ExpectEq("objects=2 bytes=11 pages=2 pending=0 done=true", progress)
+}
+
+func (t *DirUsageXattrTest) TooManyObjects() {
+	AssertEq(
+		nil,
+		t.createObjects(
+			map[string]string{
+				"a":     "",
+				"b":     "",
+				"dir/c": "",
+				"dir/d": "",
+			}))
+
+	_, err := getxattr(mntDir, inode.ObjectCountXattr)
+	ExpectEq(unix.E2BIG, err)
+
+	_, err = getxattr(mntDir, inode.RecursiveSizeXattr)
+	ExpectEq(unix.E2BIG, err)
+}
+
+func (t *DirUsageXattrTest) NotOnFiles() {
+	AssertEq(nil, t.createWithContents("foo", "taco"))
+
+	_, err := getxattr(path.Join(mntDir, "foo"), inode.RecursiveSizeXattr)
+	ExpectEq(unix.ENODATA, err)
+}
+
+func (t *DirUsageXattrTest) NotListed() {
+	AssertEq(nil, t.createWithContents("foo", "taco"))
+
+	n, err := unix.Listxattr(mntDir, make([]byte, 256))
+	AssertEq(nil, err)
+	ExpectEq(0, n)
+}
+
+func (t *XattrTest) MetadataQueryDisabled() {
+	_, _, err := metadataxattr(mntDir, "label=cat")
+	ExpectEq(unix.ENODATA, err)
+}
+
+func (t *MetadataQueryXattrTest) MatchesRecursively() {
+	AssertEq(nil, createObjectsWithMetadata(map[string]map[string]string{
+		"dir/":      nil,
+		"dir/a":     {"label": "cat"},
+		"dir/sub/b": {"label": "cat", "source": "cam"},
+		"dir/c":     {"label": "dog", "source": "cam"},
+		"e":         {"label": "cat"},
+	}))
+	dir := path.Join(mntDir, "dir")
+
+	names, truncated, err := metadataxattr(dir, "label=cat")
+	AssertEq(nil, err)
+	ExpectFalse(truncated)
+	ExpectThat(names, ElementsAre("a", "sub/b"))
+
+	names, truncated, err = metadataxattr(dir, "source")
+	AssertEq(nil, err)
+	ExpectFalse(truncated)
+	ExpectThat(names, ElementsAre("c", "sub/b"))
+
+	names, truncated, err = metadataxattr(dir, "label=cow")
+	AssertEq(nil, err)
+	ExpectFalse(truncated)
+	ExpectEq(0, len(names))
+}
+
+func (t *MetadataQueryXattrTest) TruncatedMarker() {
+	// Only the first four objects are scanned.
+	AssertEq(nil, createObjectsWithMetadata(map[string]map[string]string{
+		"a": {"label": "cat"},
+		"b": nil,
+		"c": {"label": "cat"},
+		"d": nil,
+		"e": {"label": "cat"},
+	}))
+
+	names, truncated, err := metadataxattr(mntDir, "label=cat")
+
+	AssertEq(nil, err)
+	ExpectTrue(truncated)
+	ExpectThat(names, ElementsAre("a", "c"))
+}
+
+func (t *MetadataQueryXattrTest) TruncatedWithoutMatches() {
+	AssertEq(nil, createObjectsWithMetadata(map[string]map[string]string{
+		"a": nil,
+		"b": nil,
+		"c": nil,
+		"d": nil,
+		"e": {"label": "cat"},
+	}))
+
+	value, err := getxattr(mntDir, inode.MetadataXattrPrefix+"label=cat")
+
+	AssertEq(nil, err)
+	ExpectEq("\n", value)
+}
+
+func (t *MetadataQueryXattrTest) ConcurrentQueries() {
+	objs := map[string]map[string]string{}
+	for _, dir := range []string{"a", "b", "c", "d"} {
+		objs[dir+"/"] = nil
+		objs[dir+"/cat"] = map[string]string{"label": "cat"}
+		objs[dir+"/dog"] = map[string]string{"label": "dog"}
+	}
+	AssertEq(nil, createObjectsWithMetadata(objs))
+
+	// Query every directory for both labels at once.
+	type result struct {
+		names     []string
+		truncated bool
+		err       error
+	}
+	results := make(map[string]*result)
+	var wg sync.WaitGroup
+	for _, dir := range []string{"a", "b", "c", "d"} {
+		for _, label := range []string{"cat", "dog"} {
+			r := &result{}
+			results[path.Join(dir, label)] = r
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				r.names, r.truncated, r.err = metadataxattr(path.Join(mntDir, dir), "label="+label)
+			}()
+		}
+	}
+	wg.Wait()
+
+	for name, r := range results {
+		AssertEq(nil, r.err, "%s", name)
+		ExpectFalse(r.truncated, "%s", name)
+		ExpectThat(r.names, ElementsAre(path.Base(name)), "%s", name)
+	}
+}
+
+func (t *MetadataQueryXattrTest) InvalidQuery() {
+	_, _, err := metadataxattr(mntDir, "=cat")
+	ExpectEq(unix.EINVAL, err)
+}
+
+func (t *MetadataQueryXattrTest) NotOnFiles() {
+	AssertEq(nil, t.createWithContents("foo", "taco"))
+
+	_, _, err := metadataxattr(path.Join(mntDir, "foo"), "label=cat")
+	ExpectEq(unix.ENODATA, err)
+}
@@ -55,6 +55,11 @@ type appendObjectCreator struct {
 }
 
 func (oc *appendObjectCreator) chooseName() (name string, err error) {
+	return chooseTmpName(oc.prefix)
+}
+
+// Choose a random name for a temporary object beginning with the prefix.
+func chooseTmpName(prefix string) (name string, err error) {
 	// Generate a good 64-bit random number.
 	var buf [8]byte
 	_, err = io.ReadFull(rand.Reader, buf[:])
@@ -73,7 +78,7 @@ func (oc *appendObjectCreator) chooseName() (name string, err error) {
 		uint64(buf[7])<<56
 
 	// Turn it into a name.
-	name = fmt.Sprintf("%s%016x", oc.prefix, x)
+	name = fmt.Sprintf("%s%016x", prefix, x)
 
 	return
 }
@@ -18,12 +18,14 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"path"
+	"sync"
 	"time"
 
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/lru"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/metadata"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/canned"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/config"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/monitor"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/ratelimit"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage"
@@ -39,10 +41,24 @@ type BucketConfig struct {
 	EgressBandwidthLimitBytesPerSecond float64
 	OpRateLimitHz                      float64
 	StatCacheMaxSizeMB                 uint64
-	StatCacheTTL                       time.Duration
+	StatCacheTTLs                      metadata.EntryTTLs
+	CacheControlTTL                    metadata.CacheControlTTL
 	EnableMonitoring                   bool
 	DebugGCS                           bool
 
+	// If non-nil, the configs of prefixes, which may override StatCacheTTLs.
+	DirConfigs *config.DirConfigs
+
+	// If non-zero, concurrent stats of siblings are coalesced into listings
+	// for up to this long. See NewLookupBatchingBucket.
+	LookupBatchWindow time.Duration
+
+	// Content types of new objects are inferred from their file extension,
+	// looked up in ContentTypeOverrides first, unless
+	// DisableContentTypeInference is set.
+	ContentTypeOverrides        map[string]string
+	DisableContentTypeInference bool
+
 	// Files backed by on object of length at least AppendThreshold that have
 	// only been appended to (i.e. none of the object's contents have been
 	// dirtied) will be written out by "appending" to the object in GCS with this
@@ -61,6 +77,35 @@ type BucketConfig struct {
 	// periodically garbage collected.
 	AppendThreshold int64
 	TmpObjectPrefix string
+
+	// If positive, files of at least CompositeUploadThreshold bytes are
+	// uploaded in parts in parallel, composed into the object. See NewSyncer.
+	CompositeUploadThreshold int64
+
+	// If positive, the progress of uploads is logged every
+	// UploadProgressInterval bytes. See NewSyncer.
+	UploadProgressInterval int64
+
+	// If positive, writes of the same object name are spaced out to the rate
+	// GCS sustains, each being delayed at most this long. See NewSyncer.
+	PerObjectWriteDelayMax time.Duration
+
+	// If non-nil, checks the plans of composite uploads. See NewSyncer.
+	MutationPlanner *MutationPlanner
+
+	// If positive, a request is sent to GCS whenever no request has been made
+	// for this long, keeping connections and tokens warm.
+	KeepaliveInterval time.Duration
+
+	// If true, buckets are served read-only. Otherwise those whose retention
+	// policy is locked are; see RetentionLocked.
+	AssumeReadOnly bool
+
+	// If positive, at most this many metadata requests are sent per second on
+	// average, and up to MetadataOpsBurst at once. See
+	// storage.NewMetadataLimitBucket.
+	MaxMetadataOpsPerSec float64
+	MetadataOpsBurst     int
 }
 
 // BucketManager manages the lifecycle of buckets.
@@ -69,7 +114,9 @@ type BucketManager interface {
 		ctx context.Context,
 		name string, isMultibucketMount bool) (b SyncerBucket, err error)
 
-	// Shuts down the bucket manager and its buckets
+	// Shuts down the bucket manager and its buckets, waiting for background
+	// garbage collection and keepalives to stop and then closing the storage
+	// client.
 	ShutDown()
 }
 
@@ -78,9 +125,10 @@ type bucketManager struct {
 	storageHandle   storage.StorageHandle
 	sharedStatCache *lru.Cache
 
-	// Garbage collector
+	// Garbage collector and keepalives
 	gcCtx                 context.Context
 	stopGarbageCollecting func()
+	gcRunning             sync.WaitGroup
 }
 
 func NewBucketManager(config BucketConfig, storageHandle storage.StorageHandle) BucketManager {
@@ -174,14 +222,31 @@ func (bm *bucketManager) SetUpBucket(
 	b = storage.NewDebugBucket(b)
 
 	// Limit to a requested prefix of the bucket, if any.
-	if bm.config.OnlyDir != "" {
-		b, err = NewPrefixBucket(path.Clean(bm.config.OnlyDir)+"/", b)
+	onlyDir, err := NormalizeOnlyDir(bm.config.OnlyDir)
+	if err != nil {
+		err = fmt.Errorf("only-dir: %w", err)
+		return
+	}
+	if onlyDir != "" {
+		b, err = NewPrefixBucket(onlyDir+"/", b)
 		if err != nil {
 			err = fmt.Errorf("NewPrefixBucket: %w", err)
 			return
 		}
 	}
 
+	// Note the requests made, to keep connections warm while there are none,
+	// if requested.
+	var kb *keepaliveBucket
+	if bm.config.KeepaliveInterval > 0 {
+		kb = newKeepaliveBucket(
+			bm.config.KeepaliveInterval,
+			bm.config.TmpObjectPrefix+"keepalive",
+			timeutil.RealClock(),
+			b)
+		b = kb
+	}
+
 	// Enable rate limiting, if requested.
 	b, err = setUpRateLimiting(
 		b,
@@ -193,8 +258,23 @@ func (bm *bucketManager) SetUpBucket(
 		return
 	}
 
+	// Cap the metadata requests billed per operation, if requested. Requests
+	// answered by the caches above don't count.
+	if bm.config.MaxMetadataOpsPerSec > 0 {
+		b = storage.NewMetadataLimitBucket(
+			bm.config.MaxMetadataOpsPerSec,
+			bm.config.MetadataOpsBurst,
+			timeutil.RealClock(),
+			b)
+	}
+
+	// Batch bursts of stats of siblings, if requested.
+	if bm.config.LookupBatchWindow > 0 {
+		b = NewLookupBatchingBucket(bm.config.LookupBatchWindow, b)
+	}
+
 	// Enable cached StatObject results, if appropriate.
-	if bm.config.StatCacheTTL != 0 && bm.sharedStatCache != nil {
+	if bm.config.StatCacheTTLs.Max() != 0 && bm.sharedStatCache != nil {
 		var statCache metadata.StatCache
 		if isMultibucketMount {
 			statCache = metadata.NewStatCacheBucketView(bm.sharedStatCache, name)
@@ -203,24 +283,42 @@ func (bm *bucketManager) SetUpBucket(
 		}
 
 		b = caching.NewFastStatBucket(
-			bm.config.StatCacheTTL,
+			bm.config.StatCacheTTLs,
+			bm.config.CacheControlTTL,
+			bm.config.DirConfigs,
 			statCache,
 			timeutil.RealClock(),
 			b)
 	}
 
 	// Enable content type awareness
-	b = NewContentTypeBucket(b)
+	if !bm.config.DisableContentTypeInference {
+		b = NewContentTypeBucket(b, bm.config.ContentTypeOverrides)
+	}
 
-	// Enable Syncer
 	if bm.config.TmpObjectPrefix == "" {
 		err = errors.New("You must set TmpObjectPrefix.")
 		return
 	}
-	sb = NewSyncerBucket(
-		bm.config.AppendThreshold,
-		bm.config.TmpObjectPrefix,
-		b)
+
+	// Serve the bucket read-only, with nothing to write temporary objects or
+	// collect them, if requested or if it can't be written anyway. Otherwise
+	// enable Syncer.
+	if bm.config.AssumeReadOnly || RetentionLocked(ctx, b) {
+		logger.Infof("Serving bucket %s read-only", name)
+		sb = NewReadOnlySyncerBucket(b)
+	} else {
+		sb = NewSyncerBucket(
+			SyncerConfig{
+				AppendThreshold:          bm.config.AppendThreshold,
+				CompositeUploadThreshold: bm.config.CompositeUploadThreshold,
+				UploadProgressInterval:   bm.config.UploadProgressInterval,
+				PerObjectWriteDelayMax:   bm.config.PerObjectWriteDelayMax,
+				MutationPlanner:          bm.config.MutationPlanner,
+				TmpObjectPrefix:          bm.config.TmpObjectPrefix,
+			},
+			b)
+	}
 
 	// Fetch bucket type from storage layout api and set bucket type.
 	b.BucketType()
@@ -235,11 +333,35 @@ func (bm *bucketManager) SetUpBucket(
 	}
 
 	// Periodically garbage collect temporary objects
-	go garbageCollect(bm.gcCtx, bm.config.TmpObjectPrefix, sb)
+	if !sb.ReadOnly {
+		bm.gcRunning.Add(1)
+		go func() {
+			defer bm.gcRunning.Done()
+			garbageCollect(bm.gcCtx, bm.config.TmpObjectPrefix, sb)
+		}()
+	}
+
+	// Send keepalives while the bucket is idle, until shut down.
+	if kb != nil {
+		bm.gcRunning.Add(1)
+		go func() {
+			defer bm.gcRunning.Done()
+			kb.keepAlive(bm.gcCtx)
+		}()
+	}
 
 	return
 }
 
 func (bm *bucketManager) ShutDown() {
 	bm.stopGarbageCollecting()
+	bm.gcRunning.Wait()
+
+	// The canned fake bucket is served without a storage client.
+	if bm.storageHandle == nil {
+		return
+	}
+	if err := bm.storageHandle.Close(); err != nil {
+		logger.Warnf("Shutting down the bucket manager: %v", err)
+	}
 }
@@ -2,12 +2,17 @@ package gcsx
 
 import (
 	"context"
+	"errors"
+	"syscall"
 	"testing"
 	"time"
 
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/metadata"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
 	. "github.com/jacobsa/ogletest"
+	"github.com/jacobsa/timeutil"
 )
 
 func TestBucketManager(t *testing.T) { RunTests(t) }
@@ -49,7 +54,7 @@ func (t *BucketManagerTest) TestNewBucketManagerMethod() {
 		EgressBandwidthLimitBytesPerSecond: 7,
 		OpRateLimitHz:                      11,
 		StatCacheMaxSizeMB:                 1,
-		StatCacheTTL:                       20 * time.Second,
+		StatCacheTTLs:                      metadata.SameEntryTTLs(20 * time.Second),
 		EnableMonitoring:                   true,
 		DebugGCS:                           true,
 		AppendThreshold:                    2,
@@ -69,7 +74,7 @@ func (t *BucketManagerTest) TestSetUpBucketMethod() {
 		EgressBandwidthLimitBytesPerSecond: 7,
 		OpRateLimitHz:                      11,
 		StatCacheMaxSizeMB:                 1,
-		StatCacheTTL:                       20 * time.Second,
+		StatCacheTTLs:                      metadata.SameEntryTTLs(20 * time.Second),
 		EnableMonitoring:                   true,
 		DebugGCS:                           true,
 		AppendThreshold:                    2,
@@ -94,7 +99,7 @@ func (t *BucketManagerTest) TestSetUpBucketMethod_IsMultiBucketMountTrue() {
 		EgressBandwidthLimitBytesPerSecond: 7,
 		OpRateLimitHz:                      11,
 		StatCacheMaxSizeMB:                 1,
-		StatCacheTTL:                       20 * time.Second,
+		StatCacheTTLs:                      metadata.SameEntryTTLs(20 * time.Second),
 		EnableMonitoring:                   true,
 		DebugGCS:                           true,
 		AppendThreshold:                    2,
@@ -119,7 +124,7 @@ func (t *BucketManagerTest) TestSetUpBucketMethodWhenBucketDoesNotExist() {
 		EgressBandwidthLimitBytesPerSecond: 7,
 		OpRateLimitHz:                      11,
 		StatCacheMaxSizeMB:                 1,
-		StatCacheTTL:                       20 * time.Second,
+		StatCacheTTLs:                      metadata.SameEntryTTLs(20 * time.Second),
 		EnableMonitoring:                   true,
 		DebugGCS:                           true,
 		AppendThreshold:                    2,
@@ -144,7 +149,7 @@ func (t *BucketManagerTest) TestSetUpBucketMethodWhenBucketDoesNotExist_IsMultiB
 		EgressBandwidthLimitBytesPerSecond: 7,
 		OpRateLimitHz:                      11,
 		StatCacheMaxSizeMB:                 1,
-		StatCacheTTL:                       20 * time.Second,
+		StatCacheTTLs:                      metadata.SameEntryTTLs(20 * time.Second),
 		EnableMonitoring:                   true,
 		DebugGCS:                           true,
 		AppendThreshold:                    2,
@@ -160,3 +165,68 @@ func (t *BucketManagerTest) TestSetUpBucketMethodWhenBucketDoesNotExist_IsMultiB
 	ExpectEq("Error in iterating through objects: storage: bucket doesn't exist", err.Error())
 	ExpectNe(nil, bucket.Syncer)
 }
+
+func (t *BucketManagerTest) TestShutDownStopsGarbageCollection() {
+	bucketConfig := BucketConfig{
+		AppendThreshold: 2,
+		TmpObjectPrefix: "TmpObjectPrefix",
+	}
+	bm := NewBucketManager(bucketConfig, t.storageHandle).(*bucketManager)
+	_, err := bm.SetUpBucket(context.Background(), TestBucketName, false)
+	AssertEq(nil, err)
+
+	bm.ShutDown()
+
+	// The collector has returned, so nothing is left waiting on it.
+	ExpectNe(nil, bm.gcCtx.Err())
+	bm.gcRunning.Wait()
+}
+
+func (t *BucketManagerTest) TestSetUpBucketMethod_AssumeReadOnly() {
+	bucketConfig := BucketConfig{
+		AppendThreshold: 2,
+		TmpObjectPrefix: "TmpObjectPrefix",
+		AssumeReadOnly:  true,
+	}
+	bm := NewBucketManager(bucketConfig, t.storageHandle).(*bucketManager)
+	defer bm.ShutDown()
+
+	bucket, err := bm.SetUpBucket(context.Background(), TestBucketName, false)
+
+	AssertEq(nil, err)
+	ExpectTrue(bucket.ReadOnly)
+	_, err = bucket.SyncObject(context.Background(), "foo", &gcs.Object{Name: "foo"}, nil)
+	ExpectEq(syscall.EROFS, err)
+}
+
+func (t *BucketManagerTest) TestRetentionLocked() {
+	clock := timeutil.RealClock()
+	ExpectFalse(RetentionLocked(context.Background(), fake.NewFakeBucket(clock, "none")))
+	ExpectFalse(RetentionLocked(context.Background(),
+		fake.NewFakeBucketWithRetentionPolicy(clock, "unlocked", gcs.RetentionPolicy{RetentionPeriod: time.Hour})))
+	ExpectTrue(RetentionLocked(context.Background(),
+		fake.NewFakeBucketWithRetentionPolicy(clock, "locked", gcs.RetentionPolicy{RetentionPeriod: time.Hour, Locked: true})))
+}
+
+// unreadablePolicyBucket fails to get its retention policy, as for lack of
+// the storage.buckets.get permission.
+type unreadablePolicyBucket struct {
+	gcs.Bucket
+}
+
+func (b unreadablePolicyBucket) GetRetentionPolicy(ctx context.Context) (*gcs.RetentionPolicy, error) {
+	return nil, errors.New("403 Forbidden")
+}
+
+func (t *BucketManagerTest) TestRetentionLocked_PolicyUnreadable() {
+	bucket := unreadablePolicyBucket{fake.NewFakeBucketWithRetentionPolicy(
+		timeutil.RealClock(), "locked", gcs.RetentionPolicy{RetentionPeriod: time.Hour, Locked: true})}
+
+	ExpectFalse(RetentionLocked(context.Background(), bucket))
+}
+
+func (t *BucketManagerTest) TestShutDownWithoutStorageHandle() {
+	bm := NewBucketManager(BucketConfig{}, nil)
+
+	bm.ShutDown()
+}
@@ -0,0 +1,439 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcsx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	"github.com/jacobsa/syncutil"
+	"google.golang.org/api/googleapi"
+)
+
+const (
+	// The parts of composite uploads are named
+	//
+	//     <tmp object prefix>composite/<upload>/part-<index>
+	//
+	// and the intermediate objects of cascading composes
+	//
+	//     <tmp object prefix>composite/<upload>/compose-<level>-<index>
+	//
+	// Uploads of very large files can take hours, so the garbage collector
+	// leaves these alone for longer than other temporary objects.
+	compositePartsDir = "composite/"
+
+	// The smallest part a composite upload is split into. Files of more than
+	// gcs.MaxComponentCount times this are split into that many larger parts.
+	minCompositePartSize = 32 << 20
+
+	// The number of parts of a composite upload uploaded concurrently.
+	compositeUploadParallelism = 16
+
+	// How long deleting the parts of a composite upload may take, even after
+	// the upload itself has been cancelled.
+	compositeCleanupTimeout = time.Minute
+)
+
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+// errComposeRestricted is wrapped by errors from composite uploads to buckets
+// that refuse to compose objects, which should be written in a single stream
+// instead.
+var errComposeRestricted = errors.New("composing objects is restricted")
+
+// Return err, wrapping errComposeRestricted if it is the refusal of a compose
+// by the bucket rather than a transient failure.
+func composeError(err error) error {
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		switch apiErr.Code {
+		case http.StatusBadRequest, http.StatusForbidden, http.StatusNotImplemented:
+			return fmt.Errorf("%w: %w", errComposeRestricted, err)
+		}
+	}
+
+	return err
+}
+
+// compositeObjectCreator writes objects by uploading their contents in parts,
+// in parallel, as temporary objects beginning with prefix, which it then
+// composes into the object and deletes.
+//
+// Parts left behind by an upload that could not clean up after itself are
+// deleted by garbage collection of the prefix.
+type compositeObjectCreator struct {
+	prefix string
+	bucket gcs.Bucket
+
+	// The smallest part size, and how many parts are uploaded at once.
+	minPartSize int64
+	parallelism int
+
+	// Checks the plan of each upload before it starts. May be nil.
+	planner *MutationPlanner
+}
+
+func newCompositeObjectCreator(
+	tmpObjectPrefix string,
+	bucket gcs.Bucket,
+	planner *MutationPlanner) *compositeObjectCreator {
+	return &compositeObjectCreator{
+		prefix:      tmpObjectPrefix + compositePartsDir,
+		bucket:      bucket,
+		minPartSize: minCompositePartSize,
+		parallelism: compositeUploadParallelism,
+		planner:     planner,
+	}
+}
+
+// Return the size of the parts that size bytes are uploaded in, and how many
+// there are.
+func (oc *compositeObjectCreator) partLayout(size int64) (partSize int64, numParts int) {
+	partSize = max(oc.minPartSize, (size+gcs.MaxComponentCount-1)/gcs.MaxComponentCount)
+	numParts = max(1, int((size+partSize-1)/partSize))
+	return
+}
+
+// Return the name of the part with the given index of the upload within dir.
+func compositePartName(dir string, i int) string {
+	return fmt.Sprintf("%spart-%05d", dir, i)
+}
+
+// Return the name of the intermediate object with the given index at the given
+// level of the cascading compose of the upload within dir.
+func compositeIntermediateName(dir string, level int, i int) string {
+	return fmt.Sprintf("%scompose-%d-%05d", dir, level, i)
+}
+
+// plan returns the object-level operations of uploading size bytes to the
+// named object in parts named within dir: the uploads of the parts, the
+// composes of each level and into the object, and the deletion of the
+// temporary objects.
+func (oc *compositeObjectCreator) plan(dir string, objectName string, size int64) *MutationPlan {
+	plan := &MutationPlan{Operation: "composite_upload", Target: objectName}
+	var tmpNames []string
+
+	_, numParts := oc.partLayout(size)
+	sources := make([]string, numParts)
+	for i := range sources {
+		sources[i] = compositePartName(dir, i)
+		plan.Add(MutationCreate, sources[i])
+		tmpNames = append(tmpNames, sources[i])
+	}
+
+	for level := 0; len(sources) > gcs.MaxSourcesPerComposeRequest; level++ {
+		var composed []string
+		for i := 0; i*gcs.MaxSourcesPerComposeRequest < len(sources); i++ {
+			group := sources[i*gcs.MaxSourcesPerComposeRequest : min((i+1)*gcs.MaxSourcesPerComposeRequest, len(sources))]
+			name := compositeIntermediateName(dir, level, i)
+			plan.Add(MutationCompose, name, group...)
+			composed = append(composed, name)
+			tmpNames = append(tmpNames, name)
+		}
+		sources = composed
+	}
+
+	plan.Add(MutationCompose, objectName, sources...)
+	for _, name := range tmpNames {
+		plan.Add(MutationDelete, name)
+	}
+
+	return plan
+}
+
+// Create writes the size bytes of content to the object, with the attributes
+// of srcObject if non-nil, guarding the write with its generation the way
+// fullObjectCreator does.
+//
+// Create returns an error wrapping errComposeRestricted, having written
+// nothing, if the bucket doesn't allow composing objects.
+func (oc *compositeObjectCreator) Create(
+	ctx context.Context,
+	objectName string,
+	srcObject *gcs.Object,
+	mtime *time.Time,
+	content io.ReaderAt,
+	size int64) (o *gcs.Object, err error) {
+	dir, err := chooseTmpName(oc.prefix)
+	if err != nil {
+		err = fmt.Errorf("chooseTmpName: %w", err)
+		return
+	}
+	dir += "/"
+
+	if oc.planner != nil {
+		if err = oc.planner.Check(ctx, oc.plan(dir, objectName, size)); err != nil {
+			return
+		}
+	}
+
+	// Delete all the temporary objects we attempted to create when we're done,
+	// whether or not we succeeded.
+	var mu sync.Mutex
+	var tmpNames []string
+	record := func(name string) {
+		mu.Lock()
+		tmpNames = append(tmpNames, name)
+		mu.Unlock()
+	}
+	defer func() {
+		oc.deleteTmpObjects(ctx, dir, tmpNames)
+	}()
+
+	sources, crc, err := oc.uploadParts(ctx, dir, content, size, record)
+	if err != nil {
+		err = fmt.Errorf("uploadParts: %w", err)
+		return
+	}
+
+	// Compose the parts in groups until there are few enough to compose into
+	// the object in one go.
+	for level := 0; len(sources) > gcs.MaxSourcesPerComposeRequest; level++ {
+		sources, err = oc.composeLevel(ctx, dir, level, sources, record)
+		if err != nil {
+			err = fmt.Errorf("composeLevel: %w", err)
+			return
+		}
+	}
+
+	req := &gcs.ComposeObjectsRequest{
+		DstName:  objectName,
+		Sources:  sources,
+		Metadata: make(map[string]string),
+		CRC32C:   &crc,
+	}
+	if srcObject == nil {
+		var precond int64
+		req.DstGenerationPrecondition = &precond
+	} else {
+		for key, value := range srcObject.Metadata {
+			req.Metadata[key] = value
+		}
+
+		req.DstGenerationPrecondition = &srcObject.Generation
+		req.DstMetaGenerationPrecondition = &srcObject.MetaGeneration
+		req.CacheControl = srcObject.CacheControl
+		req.ContentDisposition = srcObject.ContentDisposition
+		req.ContentEncoding = srcObject.ContentEncoding
+		req.ContentType = srcObject.ContentType
+		req.CustomTime = srcObject.CustomTime
+		req.EventBasedHold = srcObject.EventBasedHold
+		req.StorageClass = srcObject.StorageClass
+	}
+
+	if mtime != nil {
+		req.Metadata[MtimeMetadataKey] = mtime.UTC().Format(time.RFC3339Nano)
+	}
+
+	o, err = oc.bucket.ComposeObjects(ctx, req)
+	if err != nil {
+		err = fmt.Errorf("ComposeObjects: %w", composeError(err))
+		return
+	}
+
+	return
+}
+
+// Upload the size bytes of content as parts named within dir, returning them
+// in order along with the checksum of their concatenation. The name of each
+// part is passed to record before its upload starts.
+func (oc *compositeObjectCreator) uploadParts(
+	ctx context.Context,
+	dir string,
+	content io.ReaderAt,
+	size int64,
+	record func(name string)) (sources []gcs.ComposeSource, crc uint32, err error) {
+	partSize, numParts := oc.partLayout(size)
+	sources = make([]gcs.ComposeSource, numParts)
+	crcs := make([]uint32, numParts)
+
+	b := syncutil.NewBundle(ctx)
+
+	// Feed part indices to the uploaders.
+	indices := make(chan int)
+	b.Add(func(ctx context.Context) (err error) {
+		defer close(indices)
+		for i := 0; i < numParts; i++ {
+			select {
+			case <-ctx.Done():
+				err = ctx.Err()
+				return
+
+			case indices <- i:
+			}
+		}
+
+		return
+	})
+
+	// Upload them.
+	for range oc.parallelism {
+		b.Add(func(ctx context.Context) (err error) {
+			for i := range indices {
+				name := compositePartName(dir, i)
+				record(name)
+
+				offset := int64(i) * partSize
+				h := crc32.New(crc32cTable)
+				r := io.TeeReader(io.NewSectionReader(content, offset, min(partSize, size-offset)), h)
+
+				var zero int64
+				var o *gcs.Object
+				o, err = oc.bucket.CreateObject(
+					ctx,
+					&gcs.CreateObjectRequest{
+						Name:                   name,
+						GenerationPrecondition: &zero,
+						Contents:               r,
+					})
+				if err != nil {
+					err = fmt.Errorf("CreateObject(%q): %w", name, err)
+					return
+				}
+
+				crcs[i] = h.Sum32()
+				if o.CRC32C != nil && *o.CRC32C != crcs[i] {
+					err = fmt.Errorf(
+						"CRC32C mismatch for %q: got 0x%08x, uploaded 0x%08x",
+						name,
+						*o.CRC32C,
+						crcs[i])
+					return
+				}
+
+				sources[i] = gcs.ComposeSource{Name: o.Name, Generation: o.Generation}
+			}
+
+			return
+		})
+	}
+
+	if err = b.Join(); err != nil {
+		return
+	}
+
+	for i := range crcs {
+		partLen := min(partSize, size-int64(i)*partSize)
+		crc = storageutil.CombineCRC32C(crc, crcs[i], partLen)
+	}
+
+	return
+}
+
+// Compose the sources in groups of gcs.MaxSourcesPerComposeRequest into
+// intermediate objects named within dir, returning those in order. The name of
+// each intermediate object is passed to record before it is composed.
+func (oc *compositeObjectCreator) composeLevel(
+	ctx context.Context,
+	dir string,
+	level int,
+	sources []gcs.ComposeSource,
+	record func(name string)) (composed []gcs.ComposeSource, err error) {
+	composed = make([]gcs.ComposeSource, (len(sources)+gcs.MaxSourcesPerComposeRequest-1)/gcs.MaxSourcesPerComposeRequest)
+
+	b := syncutil.NewBundle(ctx)
+	for i := range composed {
+		b.Add(func(ctx context.Context) (err error) {
+			group := sources[i*gcs.MaxSourcesPerComposeRequest : min((i+1)*gcs.MaxSourcesPerComposeRequest, len(sources))]
+			name := compositeIntermediateName(dir, level, i)
+			record(name)
+
+			var zero int64
+			o, err := oc.bucket.ComposeObjects(
+				ctx,
+				&gcs.ComposeObjectsRequest{
+					DstName:                   name,
+					DstGenerationPrecondition: &zero,
+					Sources:                   group,
+				})
+			if err != nil {
+				err = fmt.Errorf("ComposeObjects(%q): %w", name, composeError(err))
+				return
+			}
+
+			composed[i] = gcs.ComposeSource{Name: o.Name, Generation: o.Generation}
+			return
+		})
+	}
+
+	err = b.Join()
+	return
+}
+
+// Delete the named temporary objects of the upload within dir, even if ctx has
+// been cancelled. Failures are logged, leaving the objects to garbage
+// collection.
+func (oc *compositeObjectCreator) deleteTmpObjects(
+	ctx context.Context,
+	dir string,
+	names []string) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), compositeCleanupTimeout)
+	defer cancel()
+
+	var mu sync.Mutex
+	var failed []string
+
+	b := syncutil.NewBundle(ctx)
+	toDelete := make(chan string, len(names))
+	for _, name := range names {
+		toDelete <- name
+	}
+	close(toDelete)
+
+	for range min(oc.parallelism, len(names)) {
+		b.Add(func(ctx context.Context) error {
+			for name := range toDelete {
+				err := oc.bucket.DeleteObject(
+					ctx,
+					&gcs.DeleteObjectRequest{
+						Name:       name,
+						Generation: 0, // Delete the latest generation of temporary object.
+					})
+
+				// An upload that failed or was cancelled may not have created the object.
+				var notFoundErr *gcs.NotFoundError
+				if err != nil && !errors.As(err, &notFoundErr) {
+					mu.Lock()
+					failed = append(failed, fmt.Sprintf("%s (%v)", name, err))
+					mu.Unlock()
+				}
+			}
+
+			return nil
+		})
+	}
+
+	_ = b.Join()
+
+	if len(failed) > 0 {
+		logger.Warnf(
+			"Failed to delete %d temporary objects of a composite upload under %q, "+
+				"leaving them to garbage collection: %s",
+			len(failed),
+			dir,
+			strings.Join(failed, ", "))
+	}
+}
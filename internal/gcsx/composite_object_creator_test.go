@@ -0,0 +1,464 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcsx
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	. "github.com/jacobsa/oglematchers"
+	. "github.com/jacobsa/ogletest"
+	"github.com/jacobsa/timeutil"
+	"golang.org/x/net/context"
+	"google.golang.org/api/googleapi"
+)
+
+func TestCompositeUpload(t *testing.T) { RunTests(t) }
+
+////////////////////////////////////////////////////////////////////////
+// Boilerplate
+////////////////////////////////////////////////////////////////////////
+
+const compositeTestTmpPrefix = ".gcsfuse_tmp/"
+
+// compositeTestBucket counts requests, tracks how many part uploads are in
+// flight at once, and injects failures.
+type compositeTestBucket struct {
+	gcs.Bucket
+
+	// If positive, uploads wait for up to a second until this many have been
+	// in flight at once.
+	awaitInFlight int
+
+	// If non-empty, the creation of objects with names ending in this fails,
+	// first calling cancel if non-nil.
+	failCreateSuffix string
+	cancel           context.CancelFunc
+
+	// If non-nil, composes fail with this error.
+	composeErr error
+
+	mu          sync.Mutex
+	inFlight    int
+	maxInFlight int
+	creates     int
+	composes    int
+}
+
+func (b *compositeTestBucket) CreateObject(
+	ctx context.Context,
+	req *gcs.CreateObjectRequest) (*gcs.Object, error) {
+	b.mu.Lock()
+	b.creates++
+	b.inFlight++
+	b.maxInFlight = max(b.maxInFlight, b.inFlight)
+	b.mu.Unlock()
+
+	defer func() {
+		b.mu.Lock()
+		b.inFlight--
+		b.mu.Unlock()
+	}()
+
+	if b.awaitInFlight > 0 {
+		deadline := time.Now().Add(time.Second)
+		for time.Now().Before(deadline) {
+			b.mu.Lock()
+			enough := b.maxInFlight >= b.awaitInFlight
+			b.mu.Unlock()
+			if enough {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	if b.failCreateSuffix != "" && strings.HasSuffix(req.Name, b.failCreateSuffix) {
+		if b.cancel != nil {
+			b.cancel()
+			return nil, context.Canceled
+		}
+		return nil, errors.New("taco")
+	}
+
+	return b.Bucket.CreateObject(ctx, req)
+}
+
+func (b *compositeTestBucket) ComposeObjects(
+	ctx context.Context,
+	req *gcs.ComposeObjectsRequest) (*gcs.Object, error) {
+	b.mu.Lock()
+	b.composes++
+	b.mu.Unlock()
+
+	if b.composeErr != nil {
+		return nil, b.composeErr
+	}
+
+	return b.Bucket.ComposeObjects(ctx, req)
+}
+
+type CompositeUploadTest struct {
+	ctx    context.Context
+	clock  timeutil.SimulatedClock
+	bucket *compositeTestBucket
+	syncer *syncer
+}
+
+func init() { RegisterTestSuite(&CompositeUploadTest{}) }
+
+func (t *CompositeUploadTest) SetUp(ti *TestInfo) {
+	t.ctx = ti.Ctx
+	t.clock.SetTime(time.Date(2024, 6, 1, 12, 0, 0, 0, time.Local))
+	t.bucket = &compositeTestBucket{
+		Bucket: fake.NewFakeBucket(&t.clock, "some_bucket"),
+	}
+
+	// Upload files of 1000 bytes or more in parts of at least 100 bytes, four
+	// at a time.
+	t.syncer = NewSyncer(SyncerConfig{AppendThreshold: 1 << 30, CompositeUploadThreshold: 1000, TmpObjectPrefix: compositeTestTmpPrefix}, t.bucket).(*syncer)
+	t.syncer.compositeCreator.minPartSize = 100
+	t.syncer.compositeCreator.parallelism = 4
+}
+
+func randomContents(n int) []byte {
+	b := make([]byte, n)
+	rand.New(rand.NewSource(int64(n))).Read(b)
+	return b
+}
+
+// Replace the contents of the object, which must be src if non-nil, the way a
+// flush would.
+func (t *CompositeUploadTest) write(name string, src *gcs.Object, contents []byte) (*gcs.Object, error) {
+	var srcContents []byte
+	if src != nil {
+		var err error
+		srcContents, err = storageutil.ReadObject(t.ctx, t.bucket, name)
+		AssertEq(nil, err)
+	}
+
+	content, err := NewTempFile(dummyReadCloser{bytes.NewReader(srcContents)}, "", &t.clock)
+	AssertEq(nil, err)
+	defer content.Destroy()
+
+	t.clock.AdvanceTime(time.Second)
+	AssertEq(nil, content.Truncate(0))
+	_, err = content.WriteAt(contents, 0)
+	AssertEq(nil, err)
+
+	return t.syncer.SyncObject(t.ctx, name, src, content)
+}
+
+// Assert that the object has the contents, and return its record.
+func (t *CompositeUploadTest) expectContents(name string, contents []byte) *gcs.Object {
+	actual, err := storageutil.ReadObject(t.ctx, t.bucket, name)
+	AssertEq(nil, err)
+	ExpectTrue(bytes.Equal(contents, actual), "contents of %q differ", name)
+
+	listing, err := t.bucket.ListObjects(t.ctx, &gcs.ListObjectsRequest{Prefix: name})
+	AssertEq(nil, err)
+	AssertEq(1, len(listing.Objects))
+
+	o := listing.Objects[0]
+	ExpectThat(o.CRC32C, Pointee(Equals(*storageutil.CRC32C(contents))))
+	return o
+}
+
+// Return the names of the temporary objects in the bucket.
+func (t *CompositeUploadTest) tmpObjects() (names []string) {
+	objects, _, err := storageutil.ListAll(t.ctx, t.bucket, &gcs.ListObjectsRequest{Prefix: compositeTestTmpPrefix})
+	AssertEq(nil, err)
+	for _, o := range objects {
+		names = append(names, o.Name)
+	}
+	return
+}
+
+////////////////////////////////////////////////////////////////////////
+// Tests
+////////////////////////////////////////////////////////////////////////
+
+func (t *CompositeUploadTest) UploadsLargeFilesInParts() {
+	contents := randomContents(1050)
+
+	o, err := t.write("foo", nil, contents)
+	AssertEq(nil, err)
+	AssertNe(nil, o)
+
+	m := t.expectContents("foo", contents)
+	ExpectEq(11, m.ComponentCount)
+	ExpectEq(t.clock.Now().UTC().Format(time.RFC3339Nano), m.Metadata[MtimeMetadataKey])
+	ExpectEq(11, t.bucket.creates)
+	ExpectEq(1, t.bucket.composes)
+	ExpectThat(t.tmpObjects(), ElementsAre())
+}
+
+func (t *CompositeUploadTest) UploadsSmallFilesInOneStream() {
+	contents := randomContents(999)
+
+	_, err := t.write("foo", nil, contents)
+	AssertEq(nil, err)
+
+	m := t.expectContents("foo", contents)
+	ExpectEq(1, m.ComponentCount)
+	ExpectEq(0, t.bucket.composes)
+}
+
+func (t *CompositeUploadTest) CascadesComposesOfManyParts() {
+	// 3000 bytes in parts of at least 1 byte take 1000 parts of 3 bytes, which
+	// are composed into 32 intermediate objects and then the object.
+	t.syncer.compositeCreator.minPartSize = 1
+	contents := randomContents(3000)
+
+	_, err := t.write("foo", nil, contents)
+	AssertEq(nil, err)
+
+	m := t.expectContents("foo", contents)
+	ExpectEq(1000, m.ComponentCount)
+	ExpectEq(1000, t.bucket.creates)
+	ExpectEq(32+1, t.bucket.composes)
+	ExpectThat(t.tmpObjects(), ElementsAre())
+}
+
+func (t *CompositeUploadTest) KeepsPartCountWithinComponentLimit() {
+	t.syncer.compositeCreator.minPartSize = 1
+	contents := randomContents(3*gcs.MaxComponentCount + 1)
+
+	_, err := t.write("foo", nil, contents)
+	AssertEq(nil, err)
+
+	m := t.expectContents("foo", contents)
+	ExpectLe(m.ComponentCount, gcs.MaxComponentCount)
+	ExpectThat(t.tmpObjects(), ElementsAre())
+}
+
+func (t *CompositeUploadTest) ReplacesExistingObject() {
+	src, err := t.bucket.CreateObject(t.ctx, &gcs.CreateObjectRequest{
+		Name:        "foo",
+		Contents:    strings.NewReader("taco"),
+		ContentType: "text/plain",
+		Metadata:    map[string]string{"burrito": "enchilada"},
+	})
+	AssertEq(nil, err)
+	contents := randomContents(2000)
+
+	o, err := t.write("foo", src, contents)
+	AssertEq(nil, err)
+	AssertNe(nil, o)
+	ExpectNe(src.Generation, o.Generation)
+
+	m := t.expectContents("foo", contents)
+	ExpectEq(20, m.ComponentCount)
+	ExpectEq("text/plain", m.ContentType)
+	ExpectEq("enchilada", m.Metadata["burrito"])
+	ExpectThat(t.tmpObjects(), ElementsAre())
+}
+
+func (t *CompositeUploadTest) CleansUpWhenObjectWasClobbered() {
+	src, err := storageutil.CreateObject(t.ctx, t.bucket, "foo", []byte("taco"))
+	AssertEq(nil, err)
+
+	// Clobber it.
+	_, err = storageutil.CreateObject(t.ctx, t.bucket, "foo", []byte("burrito"))
+	AssertEq(nil, err)
+
+	_, err = t.write("foo", src, randomContents(2000))
+
+	var preconditionErr *gcs.PreconditionError
+	ExpectTrue(errors.As(err, &preconditionErr), "%v", err)
+	ExpectThat(t.tmpObjects(), ElementsAre())
+}
+
+func (t *CompositeUploadTest) CleansUpWhenPartUploadFails() {
+	t.bucket.failCreateSuffix = "/part-00004"
+
+	_, err := t.write("foo", nil, randomContents(2000))
+
+	ExpectThat(err, Error(HasSubstr("part-00004")))
+	ExpectThat(err, Error(HasSubstr("taco")))
+	ExpectThat(t.tmpObjects(), ElementsAre())
+
+	_, _, err = t.bucket.StatObject(t.ctx, &gcs.StatObjectRequest{Name: "foo"})
+	var notFoundErr *gcs.NotFoundError
+	ExpectTrue(errors.As(err, &notFoundErr))
+}
+
+func (t *CompositeUploadTest) CleansUpWhenCancelled() {
+	// Cancel the upload, e.g. on a flush timeout, while uploading the fifth
+	// part.
+	ctx := t.ctx
+	t.ctx, t.bucket.cancel = context.WithCancel(ctx)
+	t.bucket.failCreateSuffix = "/part-00004"
+	t.syncer.compositeCreator.parallelism = 1
+
+	_, err := t.write("foo", nil, randomContents(2000))
+	ExpectTrue(errors.Is(err, context.Canceled), "%v", err)
+
+	t.ctx = ctx
+	ExpectThat(t.tmpObjects(), ElementsAre())
+}
+
+func (t *CompositeUploadTest) UploadsPartsInParallel() {
+	t.bucket.awaitInFlight = 4
+
+	contents := randomContents(1600)
+	_, err := t.write("foo", nil, contents)
+	AssertEq(nil, err)
+
+	t.expectContents("foo", contents)
+	ExpectEq(4, t.bucket.maxInFlight)
+}
+
+func (t *CompositeUploadTest) FallsBackWhenComposeIsRestricted() {
+	t.bucket.composeErr = &googleapi.Error{Code: http.StatusForbidden, Message: "compose not allowed"}
+
+	contents := randomContents(2000)
+	_, err := t.write("foo", nil, contents)
+	AssertEq(nil, err)
+
+	m := t.expectContents("foo", contents)
+	ExpectEq(1, m.ComponentCount)
+	ExpectEq(1, t.bucket.composes)
+	ExpectThat(t.tmpObjects(), ElementsAre())
+
+	// Later uploads don't try again.
+	contents = randomContents(3000)
+	_, err = t.write("bar", nil, contents)
+	AssertEq(nil, err)
+
+	t.expectContents("bar", contents)
+	ExpectEq(1, t.bucket.composes)
+}
+
+func (t *CompositeUploadTest) DoesNotFallBackOnOtherComposeErrors() {
+	t.bucket.composeErr = &googleapi.Error{Code: http.StatusServiceUnavailable}
+
+	_, err := t.write("foo", nil, randomContents(2000))
+
+	var apiErr *googleapi.Error
+	ExpectTrue(errors.As(err, &apiErr))
+	ExpectFalse(t.syncer.compositeRestricted.Load())
+	ExpectThat(t.tmpObjects(), ElementsAre())
+}
+
+func (t *CompositeUploadTest) GarbageCollectionSparesRecentParts() {
+	// Temporary objects written two hours ago.
+	t.clock.SetTime(time.Now().Add(-2 * time.Hour))
+	_, err := storageutil.CreateObject(t.ctx, t.bucket, compositeTestTmpPrefix+"0123456789abcdef", nil)
+	AssertEq(nil, err)
+	_, err = storageutil.CreateObject(t.ctx, t.bucket, compositeTestTmpPrefix+compositePartsDir+"0123456789abcdef/part-00000", nil)
+	AssertEq(nil, err)
+
+	// And a part written two days ago.
+	t.clock.SetTime(time.Now().Add(-48 * time.Hour))
+	_, err = storageutil.CreateObject(t.ctx, t.bucket, compositeTestTmpPrefix+compositePartsDir+"fedcba9876543210/part-00000", nil)
+	AssertEq(nil, err)
+
+	deleted, err := garbageCollectOnce(t.ctx, compositeTestTmpPrefix, t.bucket)
+	AssertEq(nil, err)
+
+	ExpectEq(2, deleted)
+	ExpectThat(t.tmpObjects(), ElementsAre(compositeTestTmpPrefix+compositePartsDir+"0123456789abcdef/part-00000"))
+}
+
+func (t *CompositeUploadTest) PlanListsPartsComposeAndCleanUp() {
+	plan := t.syncer.compositeCreator.plan("dir/", "foo", 250)
+
+	ExpectEq("composite_upload", plan.Operation)
+	ExpectEq("foo", plan.Target)
+	ExpectThat(plan.Steps, DeepEquals([]MutationStep{
+		{Op: MutationCreate, Object: "dir/part-00000"},
+		{Op: MutationCreate, Object: "dir/part-00001"},
+		{Op: MutationCreate, Object: "dir/part-00002"},
+		{Op: MutationCompose, Object: "foo", Sources: []string{"dir/part-00000", "dir/part-00001", "dir/part-00002"}},
+		{Op: MutationDelete, Object: "dir/part-00000"},
+		{Op: MutationDelete, Object: "dir/part-00001"},
+		{Op: MutationDelete, Object: "dir/part-00002"},
+	}))
+}
+
+func (t *CompositeUploadTest) PlanCascadesComposesOfManyParts() {
+	// As in CascadesComposesOfManyParts: 1000 parts, composed into 32
+	// intermediate objects and then the object.
+	t.syncer.compositeCreator.minPartSize = 1
+	steps := t.syncer.compositeCreator.plan("dir/", "foo", 3000).Steps
+
+	AssertEq(1000+32+1+1032, len(steps))
+	var firstGroup []string
+	for _, step := range steps[:32] {
+		firstGroup = append(firstGroup, step.Object)
+	}
+	ExpectThat(steps[1000], DeepEquals(MutationStep{
+		Op:      MutationCompose,
+		Object:  "dir/compose-0-00000",
+		Sources: firstGroup,
+	}))
+	ExpectEq("dir/compose-0-00031", steps[1031].Object)
+	ExpectThat(steps[1031].Sources, ElementsAre("dir/part-00992", Any(), Any(), Any(), Any(), Any(), Any(), "dir/part-00999"))
+
+	final := steps[1032]
+	ExpectEq(MutationCompose, final.Op)
+	ExpectEq("foo", final.Object)
+	AssertEq(32, len(final.Sources))
+	ExpectEq("dir/compose-0-00031", final.Sources[31])
+
+	for _, step := range steps[1033:] {
+		ExpectEq(MutationDelete, step.Op)
+	}
+	ExpectEq("dir/compose-0-00031", steps[len(steps)-1].Object)
+}
+
+func (t *CompositeUploadTest) DryRunLogsPlanAndUploadsNothing() {
+	var buf bytes.Buffer
+	t.syncer.compositeCreator.planner = &MutationPlanner{
+		logger: slog.New(slog.NewJSONHandler(&buf, nil)),
+		dryRun: true,
+	}
+
+	_, err := t.write("foo", nil, randomContents(1050))
+
+	ExpectTrue(errors.Is(err, ErrMutationDryRun))
+	ExpectTrue(errors.Is(err, syscall.EROFS))
+	ExpectEq(0, t.bucket.creates)
+	ExpectEq(0, t.bucket.composes)
+	ExpectThat(t.tmpObjects(), ElementsAre())
+
+	// A record for the upload, and one for each of its 23 steps.
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	AssertEq(1+23, len(lines))
+
+	var record map[string]any
+	AssertEq(nil, json.Unmarshal([]byte(lines[0]), &record))
+	ExpectEq("composite_upload", record["operation"])
+	ExpectEq("foo", record["target"])
+	ExpectEq(23, record["steps"])
+	ExpectEq(true, record["dry_run"])
+
+	AssertEq(nil, json.Unmarshal([]byte(lines[12]), &record))
+	ExpectEq(MutationCompose, record["step_op"])
+	ExpectEq("foo", record["object"])
+}
@@ -17,6 +17,7 @@ package gcsx
 import (
 	"mime"
 	"path"
+	"strings"
 
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
 	"golang.org/x/net/context"
@@ -24,12 +25,32 @@ import (
 
 // NewContentTypeBucket creates a wrapper bucket that guesses MIME types for
 // newly created or composed objects when an explicit type is not already set.
-func NewContentTypeBucket(b gcs.Bucket) gcs.Bucket {
-	return contentTypeBucket{b}
+//
+// The type is looked up by file extension (e.g. ".html") in overrides first,
+// ignoring case, and then with mime.TypeByExtension.
+func NewContentTypeBucket(b gcs.Bucket, overrides map[string]string) gcs.Bucket {
+	lowered := make(map[string]string, len(overrides))
+	for ext, contentType := range overrides {
+		lowered[strings.ToLower(ext)] = contentType
+	}
+
+	return contentTypeBucket{Bucket: b, overrides: lowered}
 }
 
 type contentTypeBucket struct {
 	gcs.Bucket
+
+	// Content types by lower-case extension.
+	overrides map[string]string
+}
+
+func (b contentTypeBucket) typeByName(name string) string {
+	ext := path.Ext(name)
+	if contentType, ok := b.overrides[strings.ToLower(ext)]; ok {
+		return contentType
+	}
+
+	return mime.TypeByExtension(ext)
 }
 
 func (b contentTypeBucket) CreateObject(
@@ -37,7 +58,7 @@ func (b contentTypeBucket) CreateObject(
 	req *gcs.CreateObjectRequest) (o *gcs.Object, err error) {
 	// Guess a content type if necessary.
 	if req.ContentType == "" {
-		req.ContentType = mime.TypeByExtension(path.Ext(req.Name))
+		req.ContentType = b.typeByName(req.Name)
 	}
 
 	// Pass on the request.
@@ -50,7 +71,7 @@ func (b contentTypeBucket) ComposeObjects(
 	req *gcs.ComposeObjectsRequest) (o *gcs.Object, err error) {
 	// Guess a content type if necessary.
 	if req.ContentType == "" {
-		req.ContentType = mime.TypeByExtension(path.Ext(req.DstName))
+		req.ContentType = b.typeByName(req.DstName)
 	}
 
 	// Pass on the request.
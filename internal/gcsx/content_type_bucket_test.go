@@ -83,7 +83,7 @@ func TestContentTypeBucket_CreateObject(t *testing.T) {
 	for i, tc := range contentTypeBucketTestCases {
 		// Set up a bucket.
 		bucket := gcsx.NewContentTypeBucket(
-			fake.NewFakeBucket(timeutil.RealClock(), ""))
+			fake.NewFakeBucket(timeutil.RealClock(), ""), nil)
 
 		// Create the object.
 		req := &gcs.CreateObjectRequest{
@@ -111,7 +111,7 @@ func TestContentTypeBucket_ComposeObjects(t *testing.T) {
 	for i, tc := range contentTypeBucketTestCases {
 		// Set up a bucket.
 		bucket := gcsx.NewContentTypeBucket(
-			fake.NewFakeBucket(timeutil.RealClock(), ""))
+			fake.NewFakeBucket(timeutil.RealClock(), ""), nil)
 
 		// Create a source object.
 		const srcName = "some_src"
@@ -142,3 +142,39 @@ func TestContentTypeBucket_ComposeObjects(t *testing.T) {
 		}
 	}
 }
+
+func TestContentTypeBucket_Overrides(t *testing.T) {
+	bucket := gcsx.NewContentTypeBucket(
+		fake.NewFakeBucket(timeutil.RealClock(), ""),
+		map[string]string{
+			".foo": "application/x-foo",
+			".JPG": "image/x-custom",
+		})
+
+	testCases := []struct {
+		name     string
+		request  string
+		expected string
+	}{
+		{name: "bar.foo", expected: "application/x-foo"},
+		{name: "bar.FOO", expected: "application/x-foo"},
+		{name: "bar.jpg", expected: "image/x-custom"},
+		{name: "bar.html", expected: "text/html; charset=utf-8"},
+		{name: "bar.foo", request: "text/plain", expected: "text/plain"},
+	}
+
+	for i, tc := range testCases {
+		o, err := bucket.CreateObject(context.Background(), &gcs.CreateObjectRequest{
+			Name:        tc.name,
+			ContentType: tc.request,
+			Contents:    strings.NewReader(""),
+		})
+		if err != nil {
+			t.Fatalf("Test case %d: CreateObject: %v", i, err)
+		}
+
+		if got, want := o.ContentType, tc.expected; got != want {
+			t.Errorf("Test case %d: o.ContentType is %q, want %q", i, got, want)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcsx
+
+import (
+	"context"
+	"sync"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+)
+
+// Deleter deletes objects, at most a fixed number at a time, so that the many
+// objects deleted by rm -r or by renaming a directory don't each wait for the
+// one before. Every deletion returns its own error, for the operation that
+// asked for it. The GCS client has no batch requests, so each object is still
+// deleted with a request of its own.
+type Deleter struct {
+	// Acquired by each running deletion; its capacity bounds the parallelism.
+	sem chan struct{}
+}
+
+// NewDeleter creates a Deleter running at most maxParallel deletions at a
+// time.
+//
+// REQUIRES: maxParallel > 0
+func NewDeleter(maxParallel int) *Deleter {
+	return &Deleter{
+		sem: make(chan struct{}, maxParallel),
+	}
+}
+
+// DeleteObject deletes an object from the given bucket once a deletion can
+// run, or returns the error of ctx if it's done first.
+func (d *Deleter) DeleteObject(ctx context.Context, bucket gcs.Bucket, req *gcs.DeleteObjectRequest) error {
+	select {
+	case d.sem <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-d.sem }()
+
+	return bucket.DeleteObject(ctx, req)
+}
+
+// DeleteObjects deletes objects from the given bucket in parallel, returning
+// the error of each deletion, nil if it succeeded, in the order of reqs.
+func (d *Deleter) DeleteObjects(ctx context.Context, bucket gcs.Bucket, reqs []*gcs.DeleteObjectRequest) []error {
+	errs := make([]error, len(reqs))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(cap(d.sem), len(reqs)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				errs[i] = d.DeleteObject(ctx, bucket, reqs[i])
+			}
+		}()
+	}
+
+	for i := range reqs {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	return errs
+}
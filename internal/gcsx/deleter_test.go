@@ -0,0 +1,152 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcsx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	. "github.com/jacobsa/oglematchers"
+	. "github.com/jacobsa/ogletest"
+	"github.com/jacobsa/timeutil"
+)
+
+func TestDeleter(t *testing.T) { RunTests(t) }
+
+////////////////////////////////////////////////////////////////////////
+// Boilerplate
+////////////////////////////////////////////////////////////////////////
+
+const maxParallelDeletes = 4
+
+type DeleterTest struct {
+	ctx     context.Context
+	bucket  *fake.CountingBucket
+	deleter *Deleter
+	reqs    []*gcs.DeleteObjectRequest
+
+	// Deletions of failName fail with failErr.
+	failName string
+	failErr  error
+
+	// If non-nil, deletions wait for it to be closed.
+	unblock chan struct{}
+}
+
+func init() { RegisterTestSuite(&DeleterTest{}) }
+
+func (t *DeleterTest) SetUp(ti *TestInfo) {
+	t.ctx = ti.Ctx
+	t.failName = "dir/3"
+	t.failErr = errors.New("taco")
+	t.bucket = fake.NewCountingBucket(fake.NewFakeBucket(timeutil.RealClock(), "some_bucket"))
+	t.bucket.Intercept = func(ctx context.Context, method string, name string) error {
+		if method != "DeleteObject" {
+			return nil
+		}
+		if t.unblock != nil {
+			<-t.unblock
+		}
+		time.Sleep(5 * time.Millisecond)
+		if name == t.failName {
+			return t.failErr
+		}
+		return nil
+	}
+	t.deleter = NewDeleter(maxParallelDeletes)
+
+	for i := 0; i < 50; i++ {
+		name := fmt.Sprintf("dir/%d", i)
+		_, err := storageutil.CreateObject(t.ctx, t.bucket, name, []byte(name))
+		AssertEq(nil, err)
+		t.reqs = append(t.reqs, &gcs.DeleteObjectRequest{Name: name})
+	}
+}
+
+// The names of the objects left in the bucket.
+func (t *DeleterTest) remaining() (names []string) {
+	objects, _, err := storageutil.ListAll(t.ctx, t.bucket, &gcs.ListObjectsRequest{})
+	AssertEq(nil, err)
+	for _, o := range objects {
+		names = append(names, o.Name)
+	}
+	return
+}
+
+////////////////////////////////////////////////////////////////////////
+// Tests
+////////////////////////////////////////////////////////////////////////
+
+func (t *DeleterTest) DeleteObjects_RunsInParallelUpToTheLimit() {
+	t.failName = ""
+
+	errs := t.deleter.DeleteObjects(t.ctx, t.bucket, t.reqs)
+
+	AssertEq(len(t.reqs), len(errs))
+	for i, err := range errs {
+		ExpectEq(nil, err, "%s", t.reqs[i].Name)
+	}
+	ExpectEq(0, t.bucket.Running("DeleteObject"))
+	ExpectGt(t.bucket.MaxRunning("DeleteObject"), 1)
+	ExpectLe(t.bucket.MaxRunning("DeleteObject"), maxParallelDeletes)
+
+	ExpectThat(t.remaining(), ElementsAre())
+}
+
+func (t *DeleterTest) DeleteObjects_ReturnsTheErrorOfEachDeletion() {
+	errs := t.deleter.DeleteObjects(t.ctx, t.bucket, t.reqs)
+
+	AssertEq(len(t.reqs), len(errs))
+	for i, err := range errs {
+		if t.reqs[i].Name == t.failName {
+			ExpectEq(t.failErr, err)
+		} else {
+			ExpectEq(nil, err, "%s", t.reqs[i].Name)
+		}
+	}
+
+	ExpectThat(t.remaining(), ElementsAre(t.failName))
+}
+
+func (t *DeleterTest) DeleteObject_GivesUpWhenContextIsDoneWhileWaiting() {
+	t.unblock = make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < maxParallelDeletes; i++ {
+		wg.Add(1)
+		go func(req *gcs.DeleteObjectRequest) {
+			defer wg.Done()
+			_ = t.deleter.DeleteObject(t.ctx, t.bucket, req)
+		}(t.reqs[i])
+	}
+	for t.bucket.Running("DeleteObject") < maxParallelDeletes {
+		time.Sleep(time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(t.ctx, 20*time.Millisecond)
+	defer cancel()
+	err := t.deleter.DeleteObject(ctx, t.bucket, t.reqs[maxParallelDeletes])
+
+	ExpectTrue(errors.Is(err, context.DeadlineExceeded), "%v", err)
+	close(t.unblock)
+	wg.Wait()
+	ExpectLe(t.bucket.MaxRunning("DeleteObject"), maxParallelDeletes)
+}
@@ -0,0 +1,172 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcsx
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/config"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/jacobsa/timeutil"
+	"golang.org/x/net/context"
+)
+
+const (
+	// DirConfigRefreshInterval is how often the config of a prefix is checked
+	// for changes, while the prefix is accessed.
+	DirConfigRefreshInterval = time.Minute
+
+	// Larger config files are ignored.
+	maxDirConfigSize = 64 * 1024
+)
+
+type dirConfigPrefix struct {
+	bucket string
+	prefix string
+}
+
+// The state of the config of a prefix.
+type dirConfigState struct {
+	// Held while the config is read, so that it's read once however many
+	// accesses find it stale.
+	mu sync.Mutex
+
+	// When the config was last checked, and the generation of its object then,
+	// or zero if there was none.
+	//
+	// GUARDED_BY(mu)
+	checked    time.Time
+	generation int64
+}
+
+// DirConfigLoader reads the config.DirConfigFileName objects at the root of
+// the prefixes accessed into a config.DirConfigs, and checks them for changes
+// every DirConfigRefreshInterval. A nil *DirConfigLoader loads nothing.
+type DirConfigLoader struct {
+	configs *config.DirConfigs
+	clock   timeutil.Clock
+
+	mu sync.Mutex
+
+	// GUARDED_BY(mu)
+	states map[dirConfigPrefix]*dirConfigState
+}
+
+func NewDirConfigLoader(configs *config.DirConfigs, clock timeutil.Clock) *DirConfigLoader {
+	return &DirConfigLoader{
+		configs: configs,
+		clock:   clock,
+		states:  make(map[dirConfigPrefix]*dirConfigState),
+	}
+}
+
+// Load loads the configs of the directories containing the object with the
+// given name, and of the name itself if it's a directory, unless they were
+// checked within DirConfigRefreshInterval.
+//
+// LOCKS_EXCLUDED(l.mu)
+func (l *DirConfigLoader) Load(ctx context.Context, bucket gcs.Bucket, name string) {
+	if l == nil {
+		return
+	}
+
+	for i := 0; i <= len(name); i++ {
+		if i == 0 || name[i-1] == '/' {
+			l.loadPrefix(ctx, bucket, name[:i])
+		}
+	}
+}
+
+// LOCKS_EXCLUDED(l.mu)
+func (l *DirConfigLoader) state(bucket, prefix string) *dirConfigState {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	key := dirConfigPrefix{bucket: bucket, prefix: prefix}
+	s, ok := l.states[key]
+	if !ok {
+		s = &dirConfigState{}
+		l.states[key] = s
+	}
+	return s
+}
+
+// LOCKS_EXCLUDED(l.mu)
+func (l *DirConfigLoader) loadPrefix(ctx context.Context, bucket gcs.Bucket, prefix string) {
+	s := l.state(bucket.Name(), prefix)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := l.clock.Now()
+	if !s.checked.IsZero() && now.Sub(s.checked) < DirConfigRefreshInterval {
+		return
+	}
+
+	name := prefix + config.DirConfigFileName
+	m, _, err := bucket.StatObject(ctx, &gcs.StatObjectRequest{Name: name, ForceFetchFromGcs: true})
+	var notFoundErr *gcs.NotFoundError
+	switch {
+	case errors.As(err, &notFoundErr):
+		if s.generation != 0 {
+			logger.Infof("Config gs://%s/%s was deleted", bucket.Name(), name)
+		}
+		l.configs.Set(bucket.Name(), prefix, nil)
+		s.generation = 0
+
+	case err != nil:
+		// Keep the config as it was, and try again at the next interval.
+		logger.Warnf("Checking config gs://%s/%s: %v", bucket.Name(), name, err)
+
+	case m.Generation != s.generation:
+		c, err := readDirConfig(ctx, bucket, m)
+		if err != nil {
+			logger.Warnf("Ignoring config gs://%s/%s: %v", bucket.Name(), name, err)
+		} else {
+			logger.Infof("Applying config gs://%s/%s to the objects under it", bucket.Name(), name)
+		}
+		l.configs.Set(bucket.Name(), prefix, c)
+		s.generation = m.Generation
+	}
+
+	s.checked = now
+}
+
+// readDirConfig reads and parses the given generation of a config object.
+func readDirConfig(ctx context.Context, bucket gcs.Bucket, m *gcs.MinObject) (c *config.DirConfig, err error) {
+	if m.Size > maxDirConfigSize {
+		return nil, fmt.Errorf("larger than %d bytes", maxDirConfigSize)
+	}
+
+	rc, err := bucket.NewReader(ctx, &gcs.ReadObjectRequest{
+		Name:       m.Name,
+		Generation: m.Generation,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("NewReader: %w", err)
+	}
+	defer rc.Close()
+
+	buf, err := io.ReadAll(io.LimitReader(rc, maxDirConfigSize))
+	if err != nil {
+		return nil, fmt.Errorf("ReadAll: %w", err)
+	}
+
+	return config.ParseDirConfig(buf)
+}
@@ -0,0 +1,171 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcsx
+
+import (
+	"testing"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/config"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	. "github.com/jacobsa/ogletest"
+	"github.com/jacobsa/timeutil"
+	"golang.org/x/net/context"
+)
+
+func TestDirConfigLoader(t *testing.T) { RunTests(t) }
+
+////////////////////////////////////////////////////////////////////////
+// Boilerplate
+////////////////////////////////////////////////////////////////////////
+
+type DirConfigLoaderTest struct {
+	ctx     context.Context
+	clock   timeutil.SimulatedClock
+	bucket  *fake.CountingBucket
+	configs *config.DirConfigs
+	loader  *DirConfigLoader
+}
+
+func init() { RegisterTestSuite(&DirConfigLoaderTest{}) }
+
+func (t *DirConfigLoaderTest) SetUp(ti *TestInfo) {
+	t.ctx = ti.Ctx
+	t.clock.SetTime(time.Date(2024, 6, 1, 12, 0, 0, 0, time.Local))
+	t.bucket = fake.NewCountingBucket(fake.NewFakeBucket(&t.clock, "some_bucket"))
+	t.configs = config.NewDirConfigs()
+	t.loader = NewDirConfigLoader(t.configs, &t.clock)
+}
+
+func (t *DirConfigLoaderTest) writeConfig(prefix string, contents string) {
+	_, err := storageutil.CreateObject(t.ctx, t.bucket, prefix+config.DirConfigFileName, []byte(contents))
+	AssertEq(nil, err)
+}
+
+// Return the sequential read size for the given name, as a stand-in for its
+// config.
+func (t *DirConfigLoaderTest) readSize(name string) int32 {
+	return t.configs.Resolve("some_bucket", name).SequentialReadSize(200)
+}
+
+////////////////////////////////////////////////////////////////////////
+// Tests
+////////////////////////////////////////////////////////////////////////
+
+func (t *DirConfigLoaderTest) LoadsEveryAncestor() {
+	t.writeConfig("", "sequential-read-size-mb: 1\n")
+	t.writeConfig("a/", "sequential-read-size-mb: 2\n")
+	t.writeConfig("a/b/", "sequential-read-size-mb: 3\n")
+
+	t.loader.Load(t.ctx, t.bucket, "a/b/")
+
+	ExpectEq(3, t.bucket.Count("StatObject"))
+	ExpectEq(1, t.readSize("foo"))
+	ExpectEq(2, t.readSize("a/foo"))
+	ExpectEq(3, t.readSize("a/b/foo"))
+}
+
+func (t *DirConfigLoaderTest) LoadsDirectoriesOfFile() {
+	t.writeConfig("a/", "sequential-read-size-mb: 2\n")
+
+	t.loader.Load(t.ctx, t.bucket, "a/foo")
+
+	ExpectEq(2, t.bucket.Count("StatObject"))
+	ExpectEq(2, t.readSize("a/foo"))
+}
+
+func (t *DirConfigLoaderTest) NotLoadedUntilAccessed() {
+	t.writeConfig("a/b/", "sequential-read-size-mb: 3\n")
+
+	t.loader.Load(t.ctx, t.bucket, "a/")
+
+	ExpectEq(200, t.readSize("a/b/foo"))
+}
+
+func (t *DirConfigLoaderTest) MalformedConfigIgnored() {
+	t.writeConfig("a/", "sequential-read-size-mb: 2\n")
+	t.writeConfig("a/b/", "sequential-read-size-mb: [8]\n")
+
+	t.loader.Load(t.ctx, t.bucket, "a/b/")
+
+	ExpectEq(2, t.readSize("a/b/foo"))
+}
+
+func (t *DirConfigLoaderTest) OversizedConfigIgnored() {
+	padding := make([]byte, maxDirConfigSize)
+	for i := range padding {
+		padding[i] = '#'
+	}
+	t.writeConfig("a/", "sequential-read-size-mb: 2\n"+string(padding))
+
+	t.loader.Load(t.ctx, t.bucket, "a/")
+
+	ExpectEq(200, t.readSize("a/foo"))
+}
+
+func (t *DirConfigLoaderTest) RefreshedAfterInterval() {
+	t.writeConfig("a/", "sequential-read-size-mb: 2\n")
+	t.loader.Load(t.ctx, t.bucket, "a/")
+	AssertEq(2, t.readSize("a/foo"))
+
+	// Changes aren't noticed within the interval.
+	t.writeConfig("a/", "sequential-read-size-mb: 4\n")
+	t.clock.AdvanceTime(DirConfigRefreshInterval - time.Second)
+	t.loader.Load(t.ctx, t.bucket, "a/")
+
+	ExpectEq(2, t.bucket.Count("StatObject"))
+	ExpectEq(2, t.readSize("a/foo"))
+
+	// But they are after it.
+	t.clock.AdvanceTime(time.Second)
+	t.loader.Load(t.ctx, t.bucket, "a/")
+
+	ExpectEq(4, t.bucket.Count("StatObject"))
+	ExpectEq(4, t.readSize("a/foo"))
+}
+
+func (t *DirConfigLoaderTest) ConfigDeleted() {
+	t.writeConfig("a/", "sequential-read-size-mb: 2\n")
+	t.loader.Load(t.ctx, t.bucket, "a/")
+	AssertEq(2, t.readSize("a/foo"))
+
+	err := t.bucket.DeleteObject(t.ctx, &gcs.DeleteObjectRequest{Name: "a/" + config.DirConfigFileName})
+	AssertEq(nil, err)
+	t.clock.AdvanceTime(DirConfigRefreshInterval)
+	t.loader.Load(t.ctx, t.bucket, "a/")
+
+	ExpectEq(200, t.readSize("a/foo"))
+}
+
+func (t *DirConfigLoaderTest) ConfigCreatedLater() {
+	t.loader.Load(t.ctx, t.bucket, "a/")
+	AssertEq(200, t.readSize("a/foo"))
+
+	t.writeConfig("a/", "sequential-read-size-mb: 2\n")
+	t.clock.AdvanceTime(DirConfigRefreshInterval)
+	t.loader.Load(t.ctx, t.bucket, "a/")
+
+	ExpectEq(2, t.readSize("a/foo"))
+}
+
+func (t *DirConfigLoaderTest) NilLoader() {
+	var loader *DirConfigLoader
+
+	loader.Load(t.ctx, t.bucket, "a/")
+
+	ExpectEq(0, t.bucket.Count("StatObject"))
+}
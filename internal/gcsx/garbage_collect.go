@@ -16,6 +16,7 @@ package gcsx
 
 import (
 	"fmt"
+	"strings"
 	"sync/atomic"
 	"time"
 
@@ -32,6 +33,11 @@ func garbageCollectOnce(
 	tmpObjectPrefix string,
 	bucket gcs.Bucket) (objectsDeleted uint64, err error) {
 	const stalenessThreshold = 30 * time.Minute
+
+	// The parts of a composite upload are composed once all of them are up,
+	// which for a very large file can take hours.
+	const compositeStalenessThreshold = 24 * time.Hour
+	compositePrefix := tmpObjectPrefix + compositePartsDir
 	b := syncutil.NewBundle(ctx)
 
 	// List all objects with the temporary prefix.
@@ -53,7 +59,12 @@ func garbageCollectOnce(
 	b.Add(func(ctx context.Context) (err error) {
 		defer close(staleNames)
 		for o := range objects {
-			if now.Sub(o.Updated) < stalenessThreshold {
+			threshold := stalenessThreshold
+			if strings.HasPrefix(o.Name, compositePrefix) {
+				threshold = compositeStalenessThreshold
+			}
+
+			if now.Sub(o.Updated) < threshold {
 				continue
 			}
 
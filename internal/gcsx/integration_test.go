@@ -89,8 +89,10 @@ func (t *IntegrationTest) SetUp(ti *TestInfo) {
 	const tmpObjectPrefix = ".gcsfuse_tmp/"
 
 	t.syncer = gcsx.NewSyncer(
-		appendThreshold,
-		tmpObjectPrefix,
+		gcsx.SyncerConfig{
+			AppendThreshold: appendThreshold,
+			TmpObjectPrefix: tmpObjectPrefix,
+		},
 		t.bucket)
 }
 
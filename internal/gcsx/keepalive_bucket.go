@@ -0,0 +1,245 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcsx
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/monitor"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/jacobsa/timeutil"
+	"golang.org/x/net/context"
+)
+
+// How many times per interval a keepalive bucket checks whether it has been
+// idle, so that keepalives come at most 1.25 intervals apart.
+const keepaliveChecksPerInterval = 4
+
+// newKeepaliveBucket creates a wrapper bucket that notes when requests are
+// made through it, so that keepAlive sends keepalives only while no request
+// has been in flight for the given interval. Keepalives stat the object
+// keepaliveName, which needn't exist.
+func newKeepaliveBucket(
+	interval time.Duration,
+	keepaliveName string,
+	clock timeutil.Clock,
+	b gcs.Bucket) *keepaliveBucket {
+	return &keepaliveBucket{
+		Bucket:        b,
+		interval:      interval,
+		keepaliveName: keepaliveName,
+		clock:         clock,
+		lastActive:    clock.Now(),
+	}
+}
+
+type keepaliveBucket struct {
+	gcs.Bucket
+	interval      time.Duration
+	keepaliveName string
+	clock         timeutil.Clock
+
+	mu sync.Mutex
+
+	// The number of requests in flight, readers counting until closed.
+	//
+	// GUARDED_BY(mu)
+	inFlight int
+
+	// When the last request completed, or the last keepalive was sent.
+	//
+	// GUARDED_BY(mu)
+	lastActive time.Time
+}
+
+// begin notes the start of a request, returning the function to call once it
+// completes.
+//
+// LOCKS_EXCLUDED(b.mu)
+func (b *keepaliveBucket) begin() (end func()) {
+	b.mu.Lock()
+	b.inFlight++
+	b.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+
+			b.inFlight--
+			b.lastActive = b.clock.Now()
+		})
+	}
+}
+
+// keepAliveIfIdle sends a keepalive if no request has been in flight for the
+// interval, or since the last keepalive, returning whether it did.
+//
+// LOCKS_EXCLUDED(b.mu)
+func (b *keepaliveBucket) keepAliveIfIdle(ctx context.Context) bool {
+	b.mu.Lock()
+	now := b.clock.Now()
+	idle := b.inFlight == 0 && now.Sub(b.lastActive) >= b.interval
+	if idle {
+		b.lastActive = now
+	}
+	b.mu.Unlock()
+
+	if !idle {
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, b.interval)
+	defer cancel()
+
+	// Any answer, including that the object doesn't exist, means the
+	// connection and the token are warm.
+	_, _, err := b.Bucket.StatObject(ctx, &gcs.StatObjectRequest{Name: b.keepaliveName})
+	var notFoundErr *gcs.NotFoundError
+	if err != nil && !errors.As(err, &notFoundErr) && ctx.Err() == nil {
+		logger.Warnf("Keepalive of bucket %q failed: %v", b.Name(), err)
+	}
+
+	monitor.CaptureKeepaliveMetrics(ctx)
+	return true
+}
+
+// keepAlive checks whether the bucket is idle a few times per interval,
+// sending keepalives while it is, until the context is cancelled.
+func (b *keepaliveBucket) keepAlive(ctx context.Context) {
+	ticker := time.NewTicker(b.interval / keepaliveChecksPerInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-ticker.C:
+		}
+
+		b.keepAliveIfIdle(ctx)
+	}
+}
+
+////////////////////////////////////////////////////////////////////////
+// Reader
+////////////////////////////////////////////////////////////////////////
+
+// keepaliveReader keeps its request in flight until closed, so that long
+// downloads hold off keepalives.
+type keepaliveReader struct {
+	io.ReadCloser
+	end func()
+}
+
+func (r *keepaliveReader) Close() error {
+	defer r.end()
+	return r.ReadCloser.Close()
+}
+
+////////////////////////////////////////////////////////////////////////
+// Bucket interface
+////////////////////////////////////////////////////////////////////////
+
+func (b *keepaliveBucket) NewReader(
+	ctx context.Context,
+	req *gcs.ReadObjectRequest) (rc io.ReadCloser, err error) {
+	end := b.begin()
+	rc, err = b.Bucket.NewReader(ctx, req)
+	if err != nil {
+		end()
+		return
+	}
+
+	rc = &keepaliveReader{ReadCloser: rc, end: end}
+	return
+}
+
+func (b *keepaliveBucket) CreateObject(
+	ctx context.Context,
+	req *gcs.CreateObjectRequest) (*gcs.Object, error) {
+	defer b.begin()()
+	return b.Bucket.CreateObject(ctx, req)
+}
+
+func (b *keepaliveBucket) CopyObject(
+	ctx context.Context,
+	req *gcs.CopyObjectRequest) (*gcs.Object, error) {
+	defer b.begin()()
+	return b.Bucket.CopyObject(ctx, req)
+}
+
+func (b *keepaliveBucket) ComposeObjects(
+	ctx context.Context,
+	req *gcs.ComposeObjectsRequest) (*gcs.Object, error) {
+	defer b.begin()()
+	return b.Bucket.ComposeObjects(ctx, req)
+}
+
+func (b *keepaliveBucket) StatObject(
+	ctx context.Context,
+	req *gcs.StatObjectRequest) (*gcs.MinObject, *gcs.ExtendedObjectAttributes, error) {
+	defer b.begin()()
+	return b.Bucket.StatObject(ctx, req)
+}
+
+func (b *keepaliveBucket) ListObjects(
+	ctx context.Context,
+	req *gcs.ListObjectsRequest) (*gcs.Listing, error) {
+	defer b.begin()()
+	return b.Bucket.ListObjects(ctx, req)
+}
+
+func (b *keepaliveBucket) UpdateObject(
+	ctx context.Context,
+	req *gcs.UpdateObjectRequest) (*gcs.Object, error) {
+	defer b.begin()()
+	return b.Bucket.UpdateObject(ctx, req)
+}
+
+func (b *keepaliveBucket) DeleteObject(
+	ctx context.Context,
+	req *gcs.DeleteObjectRequest) error {
+	defer b.begin()()
+	return b.Bucket.DeleteObject(ctx, req)
+}
+
+func (b *keepaliveBucket) CreateFolder(
+	ctx context.Context,
+	folderName string) (*gcs.Folder, error) {
+	defer b.begin()()
+	return b.Bucket.CreateFolder(ctx, folderName)
+}
+
+func (b *keepaliveBucket) DeleteFolder(
+	ctx context.Context,
+	folderName string) error {
+	defer b.begin()()
+	return b.Bucket.DeleteFolder(ctx, folderName)
+}
+
+func (b *keepaliveBucket) RenameFolder(
+	ctx context.Context,
+	folderName string,
+	destinationFolderName string) (*gcs.Folder, error) {
+	defer b.begin()()
+	return b.Bucket.RenameFolder(ctx, folderName, destinationFolderName)
+}
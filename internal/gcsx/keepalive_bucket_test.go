@@ -0,0 +1,157 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcsx
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	. "github.com/jacobsa/ogletest"
+	"github.com/jacobsa/timeutil"
+	"go.opencensus.io/stats/view"
+	"golang.org/x/net/context"
+)
+
+func TestKeepaliveBucket(t *testing.T) { RunTests(t) }
+
+////////////////////////////////////////////////////////////////////////
+// Boilerplate
+////////////////////////////////////////////////////////////////////////
+
+const (
+	keepaliveInterval = time.Minute
+	keepaliveName     = ".gcsfuse_tmp/keepalive"
+)
+
+type KeepaliveBucketTest struct {
+	ctx     context.Context
+	clock   timeutil.SimulatedClock
+	wrapped *fake.CountingBucket
+	bucket  *keepaliveBucket
+}
+
+func init() { RegisterTestSuite(&KeepaliveBucketTest{}) }
+
+func (t *KeepaliveBucketTest) SetUp(ti *TestInfo) {
+	t.ctx = ti.Ctx
+	t.clock.SetTime(time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC))
+	t.wrapped = fake.NewCountingBucket(fake.NewFakeBucket(&t.clock, "some_bucket"))
+	t.bucket = newKeepaliveBucket(keepaliveInterval, keepaliveName, &t.clock, t.wrapped)
+
+	_, err := storageutil.CreateObject(t.ctx, t.wrapped, "foo", []byte("taco"))
+	AssertEq(nil, err)
+}
+
+// Return the count of the gcs/keepalive_count view so far.
+func keepaliveCount() int64 {
+	rows, err := view.RetrieveData("gcs/keepalive_count")
+	AssertEq(nil, err)
+
+	var n int64
+	for _, row := range rows {
+		n += int64(row.Data.(*view.SumData).Value)
+	}
+	return n
+}
+
+////////////////////////////////////////////////////////////////////////
+// Tests
+////////////////////////////////////////////////////////////////////////
+
+func (t *KeepaliveBucketTest) NoKeepaliveBeforeIdleForInterval() {
+	t.clock.AdvanceTime(keepaliveInterval - time.Second)
+
+	ExpectFalse(t.bucket.keepAliveIfIdle(t.ctx))
+	ExpectEq(0, t.wrapped.CountOf("StatObject", keepaliveName))
+}
+
+func (t *KeepaliveBucketTest) KeepalivesFireOncePerIdleInterval() {
+	before := keepaliveCount()
+
+	t.clock.AdvanceTime(keepaliveInterval)
+	ExpectTrue(t.bucket.keepAliveIfIdle(t.ctx))
+	ExpectEq(1, t.wrapped.CountOf("StatObject", keepaliveName))
+
+	// The keepalive itself restarts the idle window.
+	t.clock.AdvanceTime(keepaliveInterval / 2)
+	ExpectFalse(t.bucket.keepAliveIfIdle(t.ctx))
+	ExpectEq(1, t.wrapped.CountOf("StatObject", keepaliveName))
+
+	t.clock.AdvanceTime(keepaliveInterval / 2)
+	ExpectTrue(t.bucket.keepAliveIfIdle(t.ctx))
+	ExpectEq(2, t.wrapped.CountOf("StatObject", keepaliveName))
+
+	ExpectEq(2, keepaliveCount()-before)
+}
+
+func (t *KeepaliveBucketTest) RequestsPostponeKeepalives() {
+	for i := 0; i < 5; i++ {
+		t.clock.AdvanceTime(keepaliveInterval / 2)
+		_, _, err := t.bucket.StatObject(t.ctx, &gcs.StatObjectRequest{Name: "foo"})
+		AssertEq(nil, err)
+
+		ExpectFalse(t.bucket.keepAliveIfIdle(t.ctx))
+	}
+
+	t.clock.AdvanceTime(keepaliveInterval)
+	ExpectTrue(t.bucket.keepAliveIfIdle(t.ctx))
+	ExpectEq(1, t.wrapped.CountOf("StatObject", keepaliveName))
+}
+
+func (t *KeepaliveBucketTest) FailedRequestsPostponeKeepalives() {
+	t.clock.AdvanceTime(keepaliveInterval / 2)
+	_, _, err := t.bucket.StatObject(t.ctx, &gcs.StatObjectRequest{Name: "missing"})
+	AssertNe(nil, err)
+
+	t.clock.AdvanceTime(keepaliveInterval / 2)
+	ExpectFalse(t.bucket.keepAliveIfIdle(t.ctx))
+	ExpectEq(0, t.wrapped.CountOf("StatObject", keepaliveName))
+}
+
+func (t *KeepaliveBucketTest) OpenReadersHoldOffKeepalives() {
+	rc, err := t.bucket.NewReader(t.ctx, &gcs.ReadObjectRequest{Name: "foo"})
+	AssertEq(nil, err)
+
+	// A long download is traffic flowing.
+	t.clock.AdvanceTime(3 * keepaliveInterval)
+	ExpectFalse(t.bucket.keepAliveIfIdle(t.ctx))
+
+	_, err = io.ReadAll(rc)
+	AssertEq(nil, err)
+	AssertEq(nil, rc.Close())
+
+	t.clock.AdvanceTime(keepaliveInterval - time.Second)
+	ExpectFalse(t.bucket.keepAliveIfIdle(t.ctx))
+
+	t.clock.AdvanceTime(time.Second)
+	ExpectTrue(t.bucket.keepAliveIfIdle(t.ctx))
+	ExpectEq(1, t.wrapped.CountOf("StatObject", keepaliveName))
+}
+
+func (t *KeepaliveBucketTest) KeepaliveLoopStopsWithContext() {
+	ctx, cancel := context.WithCancel(t.ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		t.bucket.keepAlive(ctx)
+	}()
+
+	cancel()
+	<-done
+}
@@ -0,0 +1,323 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcsx
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+)
+
+const (
+	// The most names resolved by a single batch; a full batch is sent without
+	// waiting for the rest of its window.
+	lookupBatchMaxSize = 100
+
+	// The size of the listing page fetched for a batch. Names sorting after
+	// the end of the page are stat'ed one by one.
+	lookupBatchListMaxResults = 1000
+
+	// The longest match glob naming the objects of a batch; the listings of
+	// batches needing a longer one are not filtered.
+	lookupBatchMaxGlobLen = 1024
+)
+
+// NewLookupBatchingBucket creates a wrapper bucket that coalesces bursts of
+// StatObject calls for siblings, e.g. the lookups made by "cp -r" or rsync,
+// into single ListObjects calls.
+//
+// A stat of an object whose parent directory has no stat in flight is passed
+// on right away. Stats of its siblings arriving while one is in flight are
+// collected for the given window, or until lookupBatchMaxSize of them are,
+// and then answered by listing the longest prefix they share, filtered by a
+// match glob naming them unless that would be too long. Stats that
+// force fetching from GCS or ask for extended attributes are never batched.
+//
+// It is meant to sit under the stat cache, which then caches the results,
+// found or not, like those of any other stat.
+func NewLookupBatchingBucket(window time.Duration, b gcs.Bucket) gcs.Bucket {
+	return &lookupBatchingBucket{
+		Bucket: b,
+		window: window,
+		dirs:   make(map[string]*lookupBatchingDir),
+	}
+}
+
+type lookupBatchingBucket struct {
+	gcs.Bucket
+	window time.Duration
+
+	mu sync.Mutex
+
+	// The directories with stats in flight or waiting, by the name of the
+	// directory including its trailing slash.
+	//
+	// GUARDED_BY(mu)
+	dirs map[string]*lookupBatchingDir
+}
+
+type lookupBatchingDir struct {
+	// The number of single stats and batches in flight.
+	inFlight int
+
+	// The batch collecting stats, if any.
+	pending *lookupBatch
+}
+
+type lookupBatch struct {
+	// The names to be stat'ed, without duplicates.
+	names []string
+
+	// Closed once results is filled in.
+	done    chan struct{}
+	results map[string]lookupResult
+
+	// The context of the first stat of the batch, without its cancellation,
+	// since the other stats of the batch depend on it too.
+	ctx context.Context
+}
+
+type lookupResult struct {
+	m   *gcs.MinObject
+	err error
+}
+
+// parentDir returns the name of the directory holding the named object,
+// including its trailing slash, or "" for the root.
+func parentDir(name string) string {
+	i := strings.LastIndex(strings.TrimSuffix(name, "/"), "/")
+	return name[:i+1]
+}
+
+func (b *lookupBatchingBucket) StatObject(
+	ctx context.Context,
+	req *gcs.StatObjectRequest) (m *gcs.MinObject, e *gcs.ExtendedObjectAttributes, err error) {
+	if req.ForceFetchFromGcs || req.ReturnExtendedObjectAttributes {
+		return b.Bucket.StatObject(ctx, req)
+	}
+
+	dirName := parentDir(req.Name)
+
+	b.mu.Lock()
+	dir, ok := b.dirs[dirName]
+	if !ok {
+		dir = &lookupBatchingDir{}
+		b.dirs[dirName] = dir
+	}
+
+	// Nothing else in flight for the directory: don't make the stat wait.
+	if dir.inFlight == 0 && dir.pending == nil {
+		dir.inFlight++
+		b.mu.Unlock()
+
+		m, e, err = b.Bucket.StatObject(ctx, req)
+		b.finish(dirName)
+		return
+	}
+
+	batch := dir.pending
+	if batch == nil {
+		batch = &lookupBatch{
+			done: make(chan struct{}),
+			ctx:  context.WithoutCancel(ctx),
+		}
+		dir.pending = batch
+		time.AfterFunc(b.window, func() { b.send(dirName, batch) })
+	}
+
+	if !containsName(batch.names, req.Name) {
+		batch.names = append(batch.names, req.Name)
+	}
+	if len(batch.names) == lookupBatchMaxSize {
+		go b.send(dirName, batch)
+	}
+	b.mu.Unlock()
+
+	select {
+	case <-batch.done:
+		r := batch.results[req.Name]
+		m, err = r.m, r.err
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	return
+}
+
+func containsName(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// send resolves the names of the batch, if it hasn't been sent already.
+//
+// LOCKS_EXCLUDED(b.mu)
+func (b *lookupBatchingBucket) send(dirName string, batch *lookupBatch) {
+	b.mu.Lock()
+	dir := b.dirs[dirName]
+	if dir == nil || dir.pending != batch {
+		b.mu.Unlock()
+		return
+	}
+	dir.pending = nil
+	dir.inFlight++
+	b.mu.Unlock()
+
+	batch.results = b.resolve(batch.ctx, batch.names)
+	close(batch.done)
+	b.finish(dirName)
+}
+
+// finish records the end of a single stat or batch for the directory.
+//
+// LOCKS_EXCLUDED(b.mu)
+func (b *lookupBatchingBucket) finish(dirName string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	dir := b.dirs[dirName]
+	dir.inFlight--
+	if dir.inFlight == 0 && dir.pending == nil {
+		delete(b.dirs, dirName)
+	}
+}
+
+// resolve stats the given names, all in the same directory, with a single
+// listing where it can.
+func (b *lookupBatchingBucket) resolve(ctx context.Context, names []string) map[string]lookupResult {
+	results := make(map[string]lookupResult, len(names))
+	if len(names) > 1 {
+		b.resolveByListing(ctx, names, results)
+	}
+
+	// Stat whatever the listing didn't answer.
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	for _, name := range names {
+		if _, ok := results[name]; ok {
+			continue
+		}
+
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			m, _, err := b.Bucket.StatObject(ctx, &gcs.StatObjectRequest{Name: name})
+
+			mu.Lock()
+			defer mu.Unlock()
+			results[name] = lookupResult{m: m, err: err}
+		}(name)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// resolveByListing fills in results for the names that a single page of the
+// listing of their longest common prefix shows to exist or not. On failure,
+// it leaves results alone.
+func (b *lookupBatchingBucket) resolveByListing(
+	ctx context.Context,
+	names []string,
+	results map[string]lookupResult) {
+	sorted := append([]string(nil), names...)
+	sort.Strings(sorted)
+	prefix := commonPrefix(sorted[0], sorted[len(sorted)-1])
+
+	// Directory placeholder objects are listed along with the collapsed runs
+	// of their contents, as StatObject would find them.
+	req := &gcs.ListObjectsRequest{
+		Prefix:                   prefix,
+		Delimiter:                "/",
+		IncludeTrailingDelimiter: true,
+		MaxResults:               lookupBatchListMaxResults,
+		ProjectionVal:            gcs.NoAcl,
+	}
+
+	// Better, have GCS return just the names asked for, so that the page covers
+	// them all however large the directory. As nothing else matches, there is
+	// then nothing to collapse.
+	if glob := namesGlob(prefix, sorted); len(glob) <= lookupBatchMaxGlobLen {
+		req.Delimiter = ""
+		req.IncludeTrailingDelimiter = false
+		req.MatchGlob = glob
+	}
+
+	listing, err := b.Bucket.ListObjects(ctx, req)
+	if err != nil {
+		return
+	}
+
+	found := make(map[string]*gcs.Object, len(listing.Objects))
+	var last string
+	for _, o := range listing.Objects {
+		found[o.Name] = o
+		last = max(last, o.Name)
+	}
+	if n := len(listing.CollapsedRuns); n > 0 {
+		last = max(last, listing.CollapsedRuns[n-1])
+	}
+
+	for _, name := range names {
+		if o, ok := found[name]; ok {
+			results[name] = lookupResult{m: storageutil.ConvertObjToMinObject(o)}
+			continue
+		}
+
+		// Past the end of a partial listing, the name may still exist.
+		if listing.ContinuationToken != "" && name > last {
+			continue
+		}
+
+		results[name] = lookupResult{
+			err: &gcs.NotFoundError{Err: fmt.Errorf("object %q not found in listing", name)},
+		}
+	}
+}
+
+// namesGlob returns a match glob for exactly the given names, which all start
+// with prefix.
+func namesGlob(prefix string, names []string) string {
+	var b strings.Builder
+	b.WriteString(storageutil.QuoteGlob(prefix))
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(storageutil.QuoteGlob(name[len(prefix):]))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func commonPrefix(a, b string) string {
+	n := min(len(a), len(b))
+	i := 0
+	for i < n && a[i] == b[i] {
+		i++
+	}
+	return a[:i]
+}
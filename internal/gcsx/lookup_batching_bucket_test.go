@@ -0,0 +1,431 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcsx
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	. "github.com/jacobsa/ogletest"
+	"github.com/jacobsa/timeutil"
+	"golang.org/x/net/context"
+)
+
+func TestLookupBatchingBucket(t *testing.T) { RunTests(t) }
+
+////////////////////////////////////////////////////////////////////////
+// Boilerplate
+////////////////////////////////////////////////////////////////////////
+
+const lookupBatchWindow = 200 * time.Millisecond
+
+// pagingBucket cuts listings short or fails them, and records their match
+// globs.
+type pagingBucket struct {
+	gcs.Bucket
+
+	// If non-zero, listings are cut to this many objects.
+	pageSize int
+
+	// If non-nil, listings fail with it.
+	listErr error
+
+	// The match glob of the last listing.
+	lastGlob atomic.Value
+}
+
+func (b *pagingBucket) ListObjects(
+	ctx context.Context,
+	req *gcs.ListObjectsRequest) (*gcs.Listing, error) {
+	b.lastGlob.Store(req.MatchGlob)
+	if b.listErr != nil {
+		return nil, b.listErr
+	}
+
+	listing, err := b.Bucket.ListObjects(ctx, req)
+	if err == nil && b.pageSize > 0 && len(listing.Objects) > b.pageSize {
+		listing.Objects = listing.Objects[:b.pageSize]
+		listing.CollapsedRuns = nil
+		listing.ContinuationToken = "more"
+	}
+	return listing, err
+}
+
+// newLookupCountingBucket returns a bucket counting the requests made of the
+// wrapped one, adding latency to every stat and listing, and holding up the
+// stats of blockedName until unblock is closed, to keep its directory busy.
+func newLookupCountingBucket(
+	wrapped gcs.Bucket,
+	latency time.Duration,
+	blockedName string,
+	unblock chan struct{}) *fake.CountingBucket {
+	b := fake.NewCountingBucket(wrapped)
+	b.Intercept = func(ctx context.Context, method string, name string) error {
+		if method == "StatObject" && name == blockedName && unblock != nil {
+			<-unblock
+		}
+		if method == "StatObject" || method == "ListObjects" {
+			time.Sleep(latency)
+		}
+		return nil
+	}
+	return b
+}
+
+type LookupBatchingBucketTest struct {
+	ctx     context.Context
+	paging  *pagingBucket
+	wrapped *fake.CountingBucket
+	bucket  gcs.Bucket
+
+	// Stats of dir/blocked wait for it to be closed.
+	unblock chan struct{}
+}
+
+func init() { RegisterTestSuite(&LookupBatchingBucketTest{}) }
+
+func (t *LookupBatchingBucketTest) SetUp(ti *TestInfo) {
+	t.ctx = ti.Ctx
+	t.paging = &pagingBucket{Bucket: fake.NewFakeBucket(timeutil.RealClock(), "some_bucket")}
+	t.unblock = make(chan struct{})
+	t.wrapped = newLookupCountingBucket(t.paging, 0, "dir/blocked", t.unblock)
+	t.bucket = NewLookupBatchingBucket(lookupBatchWindow, t.wrapped)
+
+	for _, name := range []string{"dir/blocked", "dir/a", "dir/b", "dir/sub/", "dir/sub/c", "other/d"} {
+		_, err := storageutil.CreateObject(t.ctx, t.wrapped, name, []byte(name))
+		AssertEq(nil, err)
+	}
+}
+
+func (t *LookupBatchingBucketTest) TearDown() {
+	select {
+	case <-t.unblock:
+	default:
+		close(t.unblock)
+	}
+}
+
+// Keep dir/ busy with a stat of dir/blocked until unblock is closed.
+func (t *LookupBatchingBucketTest) keepDirBusy() (done chan struct{}) {
+	done = make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _, err := t.bucket.StatObject(t.ctx, &gcs.StatObjectRequest{Name: "dir/blocked"})
+		AssertEq(nil, err)
+	}()
+
+	// Wait for the stat to reach the wrapped bucket.
+	for t.wrapped.Count("StatObject") == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	t.wrapped.Reset()
+	return
+}
+
+// Stat the given names concurrently.
+func (t *LookupBatchingBucketTest) statAll(names ...string) (results []lookupResult) {
+	results = make([]lookupResult, len(names))
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			m, _, err := t.bucket.StatObject(t.ctx, &gcs.StatObjectRequest{Name: name})
+			results[i] = lookupResult{m: m, err: err}
+		}(i, name)
+	}
+	wg.Wait()
+	return
+}
+
+func (t *LookupBatchingBucketTest) expectFound(name string, r lookupResult) {
+	AssertEq(nil, r.err, "%s", name)
+	AssertNe(nil, r.m, "%s", name)
+	ExpectEq(name, r.m.Name)
+	ExpectEq(len(name), r.m.Size)
+}
+
+func expectNotFound(name string, r lookupResult) {
+	var notFoundErr *gcs.NotFoundError
+	ExpectTrue(errors.As(r.err, &notFoundErr), "%s: %v", name, r.err)
+}
+
+////////////////////////////////////////////////////////////////////////
+// Tests
+////////////////////////////////////////////////////////////////////////
+
+func (t *LookupBatchingBucketTest) ParentDir() {
+	ExpectEq("", parentDir("foo"))
+	ExpectEq("", parentDir("foo/"))
+	ExpectEq("foo/", parentDir("foo/bar"))
+	ExpectEq("foo/", parentDir("foo/bar/"))
+	ExpectEq("foo/bar/", parentDir("foo/bar/baz"))
+}
+
+func (t *LookupBatchingBucketTest) SingleStatIsNotDelayed() {
+	before := time.Now()
+	m, _, err := t.bucket.StatObject(t.ctx, &gcs.StatObjectRequest{Name: "dir/a"})
+
+	AssertEq(nil, err)
+	ExpectEq("dir/a", m.Name)
+	ExpectLt(time.Since(before), lookupBatchWindow)
+	ExpectEq(1, t.wrapped.Count("StatObject"))
+	ExpectEq(0, t.wrapped.Count("ListObjects"))
+}
+
+func (t *LookupBatchingBucketTest) SequentialStatsAreNotBatched() {
+	for _, name := range []string{"dir/a", "dir/b", "dir/missing"} {
+		_, _, _ = t.bucket.StatObject(t.ctx, &gcs.StatObjectRequest{Name: name})
+	}
+
+	ExpectEq(3, t.wrapped.Count("StatObject"))
+	ExpectEq(0, t.wrapped.Count("ListObjects"))
+}
+
+func (t *LookupBatchingBucketTest) BurstOfMixedHitsAndMisses() {
+	done := t.keepDirBusy()
+
+	names := []string{"dir/a", "dir/b", "dir/missing", "dir/sub/", "dir/nosub/", "dir/a"}
+	results := t.statAll(names...)
+
+	t.expectFound("dir/a", results[0])
+	t.expectFound("dir/b", results[1])
+	expectNotFound("dir/missing", results[2])
+	t.expectFound("dir/sub/", results[3])
+	expectNotFound("dir/nosub/", results[4])
+	t.expectFound("dir/a", results[5])
+	ExpectEq(0, t.wrapped.Count("StatObject"))
+	ExpectEq(1, t.wrapped.Count("ListObjects"))
+
+	close(t.unblock)
+	<-done
+}
+
+func (t *LookupBatchingBucketTest) BatchInLargeDirectory() {
+	// Fill dir/ with more objects than fit in a page, all sorting before
+	// dir/zz.
+	for i := 0; i < lookupBatchListMaxResults; i++ {
+		_, err := storageutil.CreateObject(t.ctx, t.wrapped, fmt.Sprintf("dir/f%04d", i), nil)
+		AssertEq(nil, err)
+	}
+	_, err := storageutil.CreateObject(t.ctx, t.wrapped, "dir/zz", []byte("dir/zz"))
+	AssertEq(nil, err)
+	done := t.keepDirBusy()
+
+	// The glob naming the batch gets everything in one page.
+	results := t.statAll("dir/a", "dir/zz", "dir/zzz")
+
+	t.expectFound("dir/a", results[0])
+	t.expectFound("dir/zz", results[1])
+	expectNotFound("dir/zzz", results[2])
+	ExpectEq(0, t.wrapped.Count("StatObject"))
+	ExpectEq(1, t.wrapped.Count("ListObjects"))
+	ExpectEq("dir/{a,zz,zzz}", t.paging.lastGlob.Load())
+
+	close(t.unblock)
+	<-done
+}
+
+func (t *LookupBatchingBucketTest) NamesWithGlobMetacharacters() {
+	for _, name := range []string{"dir/x{1,2}", "dir/x1", "dir/[ab]*"} {
+		_, err := storageutil.CreateObject(t.ctx, t.wrapped, name, []byte(name))
+		AssertEq(nil, err)
+	}
+	done := t.keepDirBusy()
+
+	results := t.statAll("dir/x{1,2}", "dir/[ab]*", "dir/x2")
+
+	t.expectFound("dir/x{1,2}", results[0])
+	t.expectFound("dir/[ab]*", results[1])
+	expectNotFound("dir/x2", results[2])
+	ExpectEq(0, t.wrapped.Count("StatObject"))
+	ExpectEq(1, t.wrapped.Count("ListObjects"))
+
+	close(t.unblock)
+	<-done
+}
+
+func (t *LookupBatchingBucketTest) LongBatchListsUnfiltered() {
+	done := t.keepDirBusy()
+
+	names := []string{"dir/a", "dir/b"}
+	for len(namesGlob("dir/", names)) <= lookupBatchMaxGlobLen {
+		names = append(names, fmt.Sprintf("dir/missing_with_a_long_name_%03d", len(names)))
+	}
+	results := t.statAll(names...)
+
+	t.expectFound("dir/a", results[0])
+	t.expectFound("dir/b", results[1])
+	for i := 2; i < len(names); i++ {
+		expectNotFound(names[i], results[i])
+	}
+	ExpectEq(0, t.wrapped.Count("StatObject"))
+	ExpectEq(1, t.wrapped.Count("ListObjects"))
+	ExpectEq("", t.paging.lastGlob.Load())
+
+	close(t.unblock)
+	<-done
+}
+
+func (t *LookupBatchingBucketTest) BatchOfOneIsStated() {
+	done := t.keepDirBusy()
+
+	results := t.statAll("dir/a")
+
+	t.expectFound("dir/a", results[0])
+	ExpectEq(1, t.wrapped.Count("StatObject"))
+	ExpectEq(0, t.wrapped.Count("ListObjects"))
+
+	close(t.unblock)
+	<-done
+}
+
+func (t *LookupBatchingBucketTest) OtherDirectoriesAreNotBatched() {
+	done := t.keepDirBusy()
+
+	before := time.Now()
+	results := t.statAll("other/d")
+
+	t.expectFound("other/d", results[0])
+	ExpectLt(time.Since(before), lookupBatchWindow)
+
+	close(t.unblock)
+	<-done
+}
+
+func (t *LookupBatchingBucketTest) ForcedFetchesAreNotBatched() {
+	done := t.keepDirBusy()
+
+	before := time.Now()
+	m, _, err := t.bucket.StatObject(t.ctx, &gcs.StatObjectRequest{Name: "dir/a", ForceFetchFromGcs: true})
+
+	AssertEq(nil, err)
+	ExpectEq("dir/a", m.Name)
+	ExpectLt(time.Since(before), lookupBatchWindow)
+
+	close(t.unblock)
+	<-done
+}
+
+func (t *LookupBatchingBucketTest) PartialListing() {
+	t.paging.pageSize = 2
+	done := t.keepDirBusy()
+
+	// The page ends at dir/b, so dir/aa is known to be missing and only
+	// dir/missing and dir/sub/ are stated.
+	results := t.statAll("dir/a", "dir/aa", "dir/b", "dir/missing", "dir/sub/")
+
+	t.expectFound("dir/a", results[0])
+	expectNotFound("dir/aa", results[1])
+	t.expectFound("dir/b", results[2])
+	expectNotFound("dir/missing", results[3])
+	t.expectFound("dir/sub/", results[4])
+	ExpectEq(2, t.wrapped.Count("StatObject"))
+	ExpectEq(1, t.wrapped.Count("ListObjects"))
+
+	close(t.unblock)
+	<-done
+}
+
+func (t *LookupBatchingBucketTest) ListingFails() {
+	t.paging.listErr = errors.New("taco")
+	done := t.keepDirBusy()
+
+	results := t.statAll("dir/a", "dir/missing")
+
+	t.expectFound("dir/a", results[0])
+	expectNotFound("dir/missing", results[1])
+	ExpectEq(2, t.wrapped.Count("StatObject"))
+	ExpectEq(1, t.wrapped.Count("ListObjects"))
+
+	close(t.unblock)
+	<-done
+}
+
+func (t *LookupBatchingBucketTest) CancelledWaiter() {
+	done := t.keepDirBusy()
+	ctx, cancel := context.WithCancel(t.ctx)
+	cancel()
+
+	_, _, err := t.bucket.StatObject(ctx, &gcs.StatObjectRequest{Name: "dir/a"})
+
+	ExpectEq(context.Canceled, err)
+	close(t.unblock)
+	<-done
+}
+
+////////////////////////////////////////////////////////////////////////
+// Benchmarks
+////////////////////////////////////////////////////////////////////////
+
+// Look up 1000 files of a directory from a handful of workers, as rsync or
+// "cp -r" do, and report the RPCs made.
+func BenchmarkLookupBatching(b *testing.B) {
+	const numFiles = 1000
+	const numWorkers = 16
+	ctx := context.Background()
+
+	for _, window := range []time.Duration{0, 2 * time.Millisecond} {
+		b.Run(fmt.Sprintf("window=%v", window), func(b *testing.B) {
+			wrapped := newLookupCountingBucket(
+				fake.NewFakeBucket(timeutil.RealClock(), "some_bucket"), time.Millisecond, "", nil)
+			var names []string
+			for i := 0; i < numFiles; i++ {
+				name := fmt.Sprintf("dir/file%04d", i)
+				names = append(names, name)
+				if _, err := storageutil.CreateObject(ctx, wrapped.Bucket, name, nil); err != nil {
+					b.Fatal(err)
+				}
+			}
+
+			var bucket gcs.Bucket = wrapped
+			if window > 0 {
+				bucket = NewLookupBatchingBucket(window, wrapped)
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				work := make(chan string)
+				var wg sync.WaitGroup
+				for w := 0; w < numWorkers; w++ {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						for name := range work {
+							if _, _, err := bucket.StatObject(ctx, &gcs.StatObjectRequest{Name: name}); err != nil {
+								b.Error(err)
+							}
+						}
+					}()
+				}
+				for _, name := range names {
+					work <- name
+				}
+				close(work)
+				wg.Wait()
+			}
+
+			b.ReportMetric(float64(wrapped.Count("StatObject"))/float64(b.N), "stats/op")
+			b.ReportMetric(float64(wrapped.Count("ListObjects"))/float64(b.N), "lists/op")
+		})
+	}
+}
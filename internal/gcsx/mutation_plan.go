@@ -0,0 +1,119 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcsx
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"syscall"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+)
+
+// MutationPlanComponent is the component name carried by the records of the
+// plans of multi-object mutations.
+const MutationPlanComponent = "mutation_plan"
+
+// The object-level operations of a MutationPlan.
+const (
+	MutationCreate  = "create"
+	MutationCopy    = "copy"
+	MutationCompose = "compose"
+	MutationDelete  = "delete"
+)
+
+// ErrMutationDryRun is returned, wrapping EROFS, in place of executing a
+// multi-object mutation in a dry run.
+var ErrMutationDryRun = fmt.Errorf("mutation dry run: %w", syscall.EROFS)
+
+// MutationStep is an object-level operation of a multi-object mutation.
+type MutationStep struct {
+	// One of MutationCreate, MutationCopy, MutationCompose and MutationDelete.
+	Op string
+
+	// The object created, copied to, composed into or deleted.
+	Object string
+
+	// The objects copied or composed into Object, in order.
+	Sources []string
+}
+
+// MutationPlan lists the object-level operations of a multi-object mutation,
+// such as renaming a directory, in the order they are executed. Steps that
+// run in parallel are listed in the order they are started.
+type MutationPlan struct {
+	// What the mutation does, e.g. "rename_dir", and the file or directory it
+	// applies to.
+	Operation string
+	Target    string
+
+	Steps []MutationStep
+}
+
+// Add appends a step to the plan.
+func (p *MutationPlan) Add(op string, object string, sources ...string) {
+	p.Steps = append(p.Steps, MutationStep{Op: op, Object: object, Sources: sources})
+}
+
+// MutationPlanner logs the plans of multi-object mutations before they are
+// executed and, in a dry run, refuses to execute them. A nil
+// *MutationPlanner does neither.
+type MutationPlanner struct {
+	logger *slog.Logger
+	dryRun bool
+}
+
+// NewMutationPlanner returns a planner logging plans under the mutation_plan
+// component if logPlans or dryRun is set, and nil otherwise.
+func NewMutationPlanner(logPlans bool, dryRun bool) *MutationPlanner {
+	if !logPlans && !dryRun {
+		return nil
+	}
+
+	return &MutationPlanner{
+		logger: logger.NewComponentLogger(MutationPlanComponent),
+		dryRun: dryRun,
+	}
+}
+
+// Check logs the plan, one record for the mutation and one for each of its
+// steps, and returns ErrMutationDryRun if the mutation must not be executed.
+func (mp *MutationPlanner) Check(ctx context.Context, plan *MutationPlan) error {
+	if mp == nil {
+		return nil
+	}
+
+	attrs := []any{"operation", plan.Operation, "target", plan.Target}
+	if md, ok := storageutil.OpMetadataFrom(ctx); ok {
+		attrs = append(attrs, "op", md.Op, "op_id", md.ID)
+	}
+
+	mp.logger.Info("Mutation planned", append(attrs, "steps", len(plan.Steps), "dry_run", mp.dryRun)...)
+	for i, step := range plan.Steps {
+		stepAttrs := append(append([]any{}, attrs...), "step", i, "step_op", step.Op, "object", step.Object)
+		if len(step.Sources) > 0 {
+			stepAttrs = append(stepAttrs, "sources", step.Sources)
+		}
+		mp.logger.Info("Mutation step planned", stepAttrs...)
+	}
+
+	if mp.dryRun {
+		return ErrMutationDryRun
+	}
+
+	return nil
+}
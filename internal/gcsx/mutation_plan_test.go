@@ -0,0 +1,114 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcsx
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	. "github.com/jacobsa/oglematchers"
+	. "github.com/jacobsa/ogletest"
+	"golang.org/x/net/context"
+)
+
+func TestMutationPlan(t *testing.T) { RunTests(t) }
+
+////////////////////////////////////////////////////////////////////////
+// Boilerplate
+////////////////////////////////////////////////////////////////////////
+
+type MutationPlanTest struct {
+	ctx  context.Context
+	buf  bytes.Buffer
+	plan *MutationPlan
+}
+
+func init() { RegisterTestSuite(&MutationPlanTest{}) }
+
+func (t *MutationPlanTest) SetUp(ti *TestInfo) {
+	t.ctx = ti.Ctx
+	t.plan = &MutationPlan{Operation: "rename_dir", Target: "foo"}
+	t.plan.Add(MutationCopy, "bar/baz", "foo/baz")
+	t.plan.Add(MutationDelete, "foo/baz")
+}
+
+func (t *MutationPlanTest) newPlanner(dryRun bool) *MutationPlanner {
+	return &MutationPlanner{
+		logger: slog.New(slog.NewJSONHandler(&t.buf, nil)),
+		dryRun: dryRun,
+	}
+}
+
+// Return the records logged so far.
+func (t *MutationPlanTest) records() (records []map[string]any) {
+	for _, line := range strings.Split(strings.TrimSpace(t.buf.String()), "\n") {
+		var record map[string]any
+		AssertEq(nil, json.Unmarshal([]byte(line), &record))
+		records = append(records, record)
+	}
+	return
+}
+
+////////////////////////////////////////////////////////////////////////
+// Tests
+////////////////////////////////////////////////////////////////////////
+
+func (t *MutationPlanTest) NoPlannerUnlessLoggingOrDryRun() {
+	ExpectEq(nil, NewMutationPlanner(false, false))
+	ExpectNe(nil, NewMutationPlanner(true, false))
+	ExpectNe(nil, NewMutationPlanner(false, true))
+
+	var mp *MutationPlanner
+	ExpectEq(nil, mp.Check(t.ctx, t.plan))
+}
+
+func (t *MutationPlanTest) LogsOneRecordPerStep() {
+	ctx := storageutil.WithOpMetadata(t.ctx, storageutil.OpMetadata{Op: "Rename", ID: 7})
+
+	err := t.newPlanner(false).Check(ctx, t.plan)
+
+	AssertEq(nil, err)
+	records := t.records()
+	AssertEq(3, len(records))
+
+	ExpectEq("Mutation planned", records[0]["msg"])
+	ExpectEq("rename_dir", records[0]["operation"])
+	ExpectEq("foo", records[0]["target"])
+	ExpectEq(2, records[0]["steps"])
+	ExpectEq(false, records[0]["dry_run"])
+	ExpectEq("Rename", records[0]["op"])
+
+	ExpectEq(0, records[1]["step"])
+	ExpectEq(MutationCopy, records[1]["step_op"])
+	ExpectEq("bar/baz", records[1]["object"])
+	ExpectThat(records[1]["sources"], DeepEquals([]any{"foo/baz"}))
+
+	ExpectEq(1, records[2]["step"])
+	ExpectEq(MutationDelete, records[2]["step_op"])
+	ExpectEq("foo/baz", records[2]["object"])
+	_, ok := records[2]["sources"]
+	ExpectFalse(ok)
+}
+
+func (t *MutationPlanTest) DryRunRefusesExecution() {
+	err := t.newPlanner(true).Check(t.ctx, t.plan)
+
+	ExpectEq(ErrMutationDryRun, err)
+	ExpectEq(true, t.records()[0]["dry_run"])
+}
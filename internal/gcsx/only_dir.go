@@ -0,0 +1,53 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcsx
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// NormalizeOnlyDir returns the directory to which a mount is limited, as given
+// to --only-dir, in the form of the object names under it: without leading,
+// trailing or repeated slashes. The result is empty if dir names the root of
+// the bucket.
+//
+// Directories containing "." or ".." components, or ending in whitespace, are
+// rejected rather than guessed at, as GCS object names are taken literally
+// and the mount would show nothing.
+func NormalizeOnlyDir(dir string) (string, error) {
+	if strings.TrimRightFunc(dir, unicode.IsSpace) != dir {
+		return "", fmt.Errorf("%q ends in whitespace", dir)
+	}
+
+	var components []string
+	for _, c := range strings.Split(dir, "/") {
+		switch c {
+		case "":
+			// Leading, trailing or repeated slash.
+			continue
+
+		case ".", "..":
+			return "", fmt.Errorf(
+				"%q contains a %q component; give the directory's path from the root of the bucket, without %q or %q",
+				dir, c, ".", "..")
+		}
+
+		components = append(components, c)
+	}
+
+	return strings.Join(components, "/"), nil
+}
@@ -0,0 +1,97 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcsx_test
+
+import (
+	"testing"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/gcsx"
+	. "github.com/jacobsa/oglematchers"
+	. "github.com/jacobsa/ogletest"
+)
+
+func TestNormalizeOnlyDir(t *testing.T) { RunTests(t) }
+
+////////////////////////////////////////////////////////////////////////
+// Boilerplate
+////////////////////////////////////////////////////////////////////////
+
+type NormalizeOnlyDirTest struct {
+}
+
+func init() { RegisterTestSuite(&NormalizeOnlyDirTest{}) }
+
+////////////////////////////////////////////////////////////////////////
+// Tests
+////////////////////////////////////////////////////////////////////////
+
+func (t *NormalizeOnlyDirTest) Normalized() {
+	testCases := []struct {
+		dir      string
+		expected string
+	}{
+		0:  {"", ""},
+		1:  {"/", ""},
+		2:  {"//", ""},
+		3:  {"data", "data"},
+		4:  {"data/", "data"},
+		5:  {"/data", "data"},
+		6:  {"//data", "data"},
+		7:  {"data//", "data"},
+		8:  {"data/raw", "data/raw"},
+		9:  {"/data//raw/", "data/raw"},
+		10: {"///data///raw///", "data/raw"},
+		11: {"data/raw.csv.d", "data/raw.csv.d"},
+		12: {".data/..raw/...", ".data/..raw/..."},
+		13: {" data/ raw", " data/ raw"},
+		14: {"dätä/râw", "dätä/râw"},
+	}
+
+	for i, tc := range testCases {
+		dir, err := gcsx.NormalizeOnlyDir(tc.dir)
+
+		AssertEq(nil, err, "case %d", i)
+		ExpectEq(tc.expected, dir, "case %d", i)
+	}
+}
+
+func (t *NormalizeOnlyDirTest) Rejected() {
+	testCases := []struct {
+		dir           string
+		expectedError string
+	}{
+		0:  {".", `"\." component`},
+		1:  {"./", `"\." component`},
+		2:  {"./data", `"\." component`},
+		3:  {"data/.", `"\." component`},
+		4:  {"data/./raw", `"\." component`},
+		5:  {"..", `"\.\." component`},
+		6:  {"../data", `"\.\." component`},
+		7:  {"data/..", `"\.\." component`},
+		8:  {"data/../raw", `"\.\." component`},
+		9:  {"/data//../", `"\.\." component`},
+		10: {"data ", "ends in whitespace"},
+		11: {"data\t", "ends in whitespace"},
+		12: {"data\n", "ends in whitespace"},
+		13: {"data/ ", "ends in whitespace"},
+		14: {" ", "ends in whitespace"},
+	}
+
+	for i, tc := range testCases {
+		_, err := gcsx.NormalizeOnlyDir(tc.dir)
+
+		ExpectThat(err, Error(MatchesRegexp(tc.expectedError)), "case %d", i)
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"unicode/utf8"
 
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
 	"golang.org/x/net/context"
 )
 
@@ -67,6 +68,10 @@ func (b *prefixBucket) BucketType() gcs.BucketType {
 	return b.wrapped.BucketType()
 }
 
+func (b *prefixBucket) GetRetentionPolicy(ctx context.Context) (*gcs.RetentionPolicy, error) {
+	return b.wrapped.GetRetentionPolicy(ctx)
+}
+
 func (b *prefixBucket) NewReader(
 	ctx context.Context,
 	req *gcs.ReadObjectRequest) (rc io.ReadCloser, err error) {
@@ -165,6 +170,9 @@ func (b *prefixBucket) ListObjects(
 	mReq := new(gcs.ListObjectsRequest)
 	*mReq = *req
 	mReq.Prefix = b.prefix + mReq.Prefix
+	if mReq.MatchGlob != "" {
+		mReq.MatchGlob = storageutil.QuoteGlob(b.prefix) + mReq.MatchGlob
+	}
 
 	l, err = b.wrapped.ListObjects(ctx, mReq)
 
@@ -211,3 +219,42 @@ func (b *prefixBucket) DeleteObject(
 	err = b.wrapped.DeleteObject(ctx, mReq)
 	return
 }
+
+func (b *prefixBucket) CreateFolder(
+	ctx context.Context,
+	folderName string) (f *gcs.Folder, err error) {
+	f, err = b.wrapped.CreateFolder(ctx, b.wrappedName(folderName))
+
+	// Modify the returned folder.
+	if f != nil {
+		f.Name = b.localName(f.Name)
+	}
+
+	return
+}
+
+func (b *prefixBucket) DeleteFolder(
+	ctx context.Context,
+	folderName string) (err error) {
+	err = b.wrapped.DeleteFolder(ctx, b.wrappedName(folderName))
+	return
+}
+
+func (b *prefixBucket) RenameFolder(
+	ctx context.Context,
+	folderName string,
+	destinationFolderName string) (f *gcs.Folder, err error) {
+	// Both names are under the prefix, so that a rename can't move a folder in
+	// or out of the mounted part of the bucket.
+	f, err = b.wrapped.RenameFolder(
+		ctx,
+		b.wrappedName(folderName),
+		b.wrappedName(destinationFolderName))
+
+	// Modify the returned folder.
+	if f != nil {
+		f.Name = b.localName(f.Name)
+	}
+
+	return
+}
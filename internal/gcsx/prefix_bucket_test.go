@@ -53,7 +53,7 @@ func (t *PrefixBucketTest) SetUp(ti *TestInfo) {
 
 	t.ctx = ti.Ctx
 	t.prefix = "foo_"
-	t.wrapped = fake.NewFakeBucket(timeutil.RealClock(), "some_bucket")
+	t.wrapped = fake.NewFakeBucketWithType(timeutil.RealClock(), "some_bucket", gcs.Hierarchical)
 
 	t.bucket, err = gcsx.NewPrefixBucket(t.prefix, t.wrapped)
 	AssertEq(nil, err)
@@ -343,6 +343,38 @@ func (t *PrefixBucketTest) ListObjects_PrefixAndDelimeter() {
 	ExpectEq("burrito", l.Objects[0].Name)
 }
 
+func (t *PrefixBucketTest) ListObjects_MatchGlob() {
+	var err error
+
+	// Create a few objects.
+	err = storageutil.CreateObjects(
+		t.ctx,
+		t.wrapped,
+		map[string][]byte{
+			t.prefix + "burrito_0":   []byte(""),
+			t.prefix + "burrito_1":   []byte(""),
+			t.prefix + "enchilada_0": []byte(""),
+			"burrito_2":              []byte(""),
+		})
+
+	AssertEq(nil, err)
+
+	// List, with a glob relative to the prefix.
+	l, err := t.bucket.ListObjects(
+		t.ctx,
+		&gcs.ListObjectsRequest{
+			MatchGlob: "burrito_*",
+		})
+
+	AssertEq(nil, err)
+	AssertEq("", l.ContinuationToken)
+	AssertThat(l.CollapsedRuns, ElementsAre())
+
+	AssertEq(2, len(l.Objects))
+	ExpectEq("burrito_0", l.Objects[0].Name)
+	ExpectEq("burrito_1", l.Objects[1].Name)
+}
+
 func (t *PrefixBucketTest) UpdateObject() {
 	var err error
 	suffix := "taco"
@@ -396,3 +428,78 @@ func (t *PrefixBucketTest) DeleteObject() {
 	var notFoundErr *gcs.NotFoundError
 	ExpectTrue(errors.As(err, &notFoundErr))
 }
+
+func (t *PrefixBucketTest) CreateFolder() {
+	f, err := t.bucket.CreateFolder(t.ctx, "taco/")
+
+	AssertEq(nil, err)
+	ExpectEq("taco/", f.Name)
+
+	// It should be present in the wrapped bucket with the prefix.
+	_, _, err = t.wrapped.StatObject(
+		t.ctx,
+		&gcs.StatObjectRequest{
+			Name: t.prefix + "taco/",
+		})
+
+	ExpectEq(nil, err)
+}
+
+func (t *PrefixBucketTest) DeleteFolder() {
+	_, err := t.wrapped.CreateFolder(t.ctx, t.prefix+"taco/")
+	AssertEq(nil, err)
+
+	err = t.bucket.DeleteFolder(t.ctx, "taco/")
+
+	AssertEq(nil, err)
+	_, _, err = t.wrapped.StatObject(
+		t.ctx,
+		&gcs.StatObjectRequest{
+			Name: t.prefix + "taco/",
+		})
+	var notFoundErr *gcs.NotFoundError
+	ExpectTrue(errors.As(err, &notFoundErr))
+}
+
+func (t *PrefixBucketTest) RenameFolder() {
+	_, err := t.wrapped.CreateFolder(t.ctx, t.prefix+"taco/")
+	AssertEq(nil, err)
+	_, err = storageutil.CreateObject(t.ctx, t.wrapped, t.prefix+"taco/burrito", []byte("foobar"))
+	AssertEq(nil, err)
+
+	f, err := t.bucket.RenameFolder(t.ctx, "taco/", "enchilada/")
+
+	AssertEq(nil, err)
+	ExpectEq("enchilada/", f.Name)
+	ExpectEq(2, f.MetaGeneration)
+
+	// Everything moved within the prefix.
+	listing, err := t.wrapped.ListObjects(t.ctx, &gcs.ListObjectsRequest{})
+	AssertEq(nil, err)
+	AssertEq(2, len(listing.Objects))
+	ExpectEq(t.prefix+"enchilada/", listing.Objects[0].Name)
+	ExpectEq(t.prefix+"enchilada/burrito", listing.Objects[1].Name)
+}
+
+func (t *PrefixBucketTest) RenameFolder_DestinationExists() {
+	_, err := t.wrapped.CreateFolder(t.ctx, t.prefix+"taco/")
+	AssertEq(nil, err)
+	_, err = t.wrapped.CreateFolder(t.ctx, t.prefix+"enchilada/")
+	AssertEq(nil, err)
+
+	_, err = t.bucket.RenameFolder(t.ctx, "taco/", "enchilada/")
+
+	var preconditionErr *gcs.PreconditionError
+	ExpectTrue(errors.As(err, &preconditionErr))
+}
+
+func (t *PrefixBucketTest) RenameFolder_NotFound() {
+	// A folder outside of the prefix isn't visible.
+	_, err := t.wrapped.CreateFolder(t.ctx, "taco/")
+	AssertEq(nil, err)
+
+	_, err = t.bucket.RenameFolder(t.ctx, "taco/", "enchilada/")
+
+	var notFoundErr *gcs.NotFoundError
+	ExpectTrue(errors.As(err, &notFoundErr))
+}
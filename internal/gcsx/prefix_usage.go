@@ -0,0 +1,260 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcsx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+)
+
+// The most objects a page of the listings made by SumPrefix holds, which is
+// the most GCS returns.
+const prefixUsagePageSize = 5000
+
+// ErrTooManyObjects is wrapped by the error SumPrefix returns once it has
+// counted more objects than it was allowed to.
+var ErrTooManyObjects = errors.New("too many objects")
+
+// PrefixUsage is what the objects under a prefix take up.
+type PrefixUsage struct {
+	ObjectCount int
+	TotalBytes  uint64
+}
+
+// PrefixUsageProgress is how far a call to SumPrefix has got. Its methods may
+// be called while the call runs, from any goroutine.
+type PrefixUsageProgress struct {
+	objects atomic.Int64
+	bytes   atomic.Uint64
+	pages   atomic.Int64
+
+	// The prefixes found but not yet listed in full.
+	pending atomic.Int64
+
+	done atomic.Bool
+}
+
+// Objects returns the number of objects counted so far.
+func (p *PrefixUsageProgress) Objects() int64 { return p.objects.Load() }
+
+// Bytes returns the total size of the objects counted so far.
+func (p *PrefixUsageProgress) Bytes() uint64 { return p.bytes.Load() }
+
+// Pages returns the number of pages listed so far.
+func (p *PrefixUsageProgress) Pages() int64 { return p.pages.Load() }
+
+// PendingPrefixes returns the number of prefixes found that are still to be
+// listed, or being listed.
+func (p *PrefixUsageProgress) PendingPrefixes() int64 { return p.pending.Load() }
+
+// Done reports whether the call has returned, successfully or not.
+func (p *PrefixUsageProgress) Done() bool { return p.done.Load() }
+
+// String returns the progress as space-separated key=value pairs, e.g.
+// "objects=12000 bytes=3400000 pages=7 pending=3 done=false".
+func (p *PrefixUsageProgress) String() string {
+	return fmt.Sprintf(
+		"objects=%d bytes=%d pages=%d pending=%d done=%t",
+		p.Objects(),
+		p.Bytes(),
+		p.Pages(),
+		p.PendingPrefixes(),
+		p.Done())
+}
+
+// SumPrefix returns the number and total size of the objects under the given
+// prefix, other than an object named after the prefix itself, recording how
+// far it has got in progress as it goes.
+//
+// Rather than listing the objects in order, which makes one request at a
+// time, it lists the prefix a level at a time, and the prefixes it finds
+// under it in parallel, with up to maxParallel pages in flight at once. The
+// placeholder objects of those prefixes are counted like any other.
+//
+// It fails with an error wrapping ErrTooManyObjects once it has counted more
+// than maxObjects objects, and with the error of ctx if that's done first.
+//
+// REQUIRES: maxParallel > 0
+func SumPrefix(
+	ctx context.Context,
+	bucket gcs.Bucket,
+	prefix string,
+	maxParallel int,
+	maxObjects int,
+	progress *PrefixUsageProgress) (PrefixUsage, error) {
+	defer progress.done.Store(true)
+
+	// Stop the other workers as soon as one fails.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	s := &prefixSummer{
+		bucket:     bucket,
+		maxObjects: int64(maxObjects),
+		progress:   progress,
+		cancel:     cancel,
+		queue:      []string{prefix},
+	}
+	s.cond = sync.NewCond(&s.mu)
+	progress.pending.Add(1)
+
+	var wg sync.WaitGroup
+	for i := 0; i < maxParallel; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.work(ctx)
+		}()
+	}
+	wg.Wait()
+
+	if s.err != nil {
+		return PrefixUsage{}, s.err
+	}
+
+	return PrefixUsage{
+		ObjectCount: int(progress.Objects()),
+		TotalBytes:  progress.Bytes(),
+	}, nil
+}
+
+// prefixSummer hands out the prefixes to be listed by SumPrefix to its
+// workers.
+type prefixSummer struct {
+	bucket     gcs.Bucket
+	maxObjects int64
+	progress   *PrefixUsageProgress
+	cancel     context.CancelFunc
+
+	mu sync.Mutex
+
+	// Signaled when a prefix is queued, or the last one is done.
+	cond *sync.Cond
+
+	// The prefixes to be listed.
+	//
+	// GUARDED_BY(mu)
+	queue []string
+
+	// The number of prefixes being listed.
+	//
+	// GUARDED_BY(mu)
+	listing int
+
+	// The first error of a listing.
+	//
+	// GUARDED_BY(mu)
+	err error
+}
+
+// work lists prefixes until there are none left, or a listing fails.
+func (s *prefixSummer) work(ctx context.Context) {
+	for {
+		prefix, ok := s.next()
+		if !ok {
+			return
+		}
+
+		err := s.list(ctx, prefix)
+		s.finish(err)
+	}
+}
+
+// next waits for a prefix to list, and returns false if there won't be any.
+func (s *prefixSummer) next() (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for len(s.queue) == 0 && s.listing > 0 && s.err == nil {
+		s.cond.Wait()
+	}
+	if len(s.queue) == 0 || s.err != nil {
+		return "", false
+	}
+
+	prefix := s.queue[len(s.queue)-1]
+	s.queue = s.queue[:len(s.queue)-1]
+	s.listing++
+	return prefix, true
+}
+
+// finish records that a prefix has been listed, with the given error.
+func (s *prefixSummer) finish(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.listing--
+	s.progress.pending.Add(-1)
+	if err != nil && s.err == nil {
+		s.err = err
+		s.cancel()
+	}
+	s.cond.Broadcast()
+}
+
+// push queues the prefixes found by a listing.
+func (s *prefixSummer) push(prefixes []string) {
+	if len(prefixes) == 0 {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.queue = append(s.queue, prefixes...)
+	s.progress.pending.Add(int64(len(prefixes)))
+	s.cond.Broadcast()
+}
+
+// list counts the objects directly under the prefix, a page at a time, and
+// queues the prefixes under it.
+func (s *prefixSummer) list(ctx context.Context, prefix string) error {
+	req := &gcs.ListObjectsRequest{
+		Prefix:                   prefix,
+		Delimiter:                "/",
+		IncludeTrailingDelimiter: true,
+		MaxResults:               prefixUsagePageSize,
+		ProjectionVal:            gcs.NoAcl,
+	}
+
+	for {
+		listing, err := s.bucket.ListObjects(ctx, req)
+		if err != nil {
+			return fmt.Errorf("list objects under %q: %w", prefix, err)
+		}
+		s.progress.pages.Add(1)
+
+		for _, o := range listing.Objects {
+			if o.Name == prefix {
+				continue
+			}
+
+			if s.progress.objects.Add(1) > s.maxObjects {
+				return fmt.Errorf("more than %d objects: %w", s.maxObjects, ErrTooManyObjects)
+			}
+			s.progress.bytes.Add(o.Size)
+		}
+		s.push(listing.CollapsedRuns)
+
+		if req.ContinuationToken = listing.ContinuationToken; req.ContinuationToken == "" {
+			return nil
+		}
+	}
+}
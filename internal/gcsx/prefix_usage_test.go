@@ -0,0 +1,198 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcsx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	. "github.com/jacobsa/oglematchers"
+	. "github.com/jacobsa/ogletest"
+	"github.com/jacobsa/timeutil"
+)
+
+func TestPrefixUsage(t *testing.T) { RunTests(t) }
+
+////////////////////////////////////////////////////////////////////////
+// Boilerplate
+////////////////////////////////////////////////////////////////////////
+
+const (
+	prefixUsageDirs     = 50
+	prefixUsageSubdirs  = 10
+	prefixUsageFiles    = 100
+	prefixUsageObjects  = prefixUsageDirs * prefixUsageSubdirs * prefixUsageFiles
+	prefixUsageParallel = 8
+)
+
+// The bucket seeded by SetUpTestSuite, holding prefixUsageObjects objects
+// under data/, the placeholders of data/ and its directories, and an object
+// outside it, and the total size of the objects under data/.
+var (
+	prefixUsageBucket gcs.Bucket
+	prefixUsageBytes  uint64
+)
+
+type PrefixUsageTest struct {
+	ctx      context.Context
+	bucket   *fake.CountingBucket
+	progress *PrefixUsageProgress
+
+	// If non-nil, listings wait for it to be closed, or for their context to
+	// be done.
+	unblock chan struct{}
+}
+
+var _ SetUpTestSuiteInterface = &PrefixUsageTest{}
+var _ SetUpInterface = &PrefixUsageTest{}
+
+func init() { RegisterTestSuite(&PrefixUsageTest{}) }
+
+func (t *PrefixUsageTest) SetUpTestSuite() {
+	ctx := context.Background()
+	prefixUsageBucket = fake.NewFakeBucket(timeutil.RealClock(), "some_bucket")
+
+	// Create the objects in order, which the fake bucket adds to the end of its
+	// list.
+	create := func(name string, contents []byte) {
+		_, err := storageutil.CreateObject(ctx, prefixUsageBucket, name, contents)
+		AssertEq(nil, err)
+	}
+
+	create("data/", nil)
+	for d := 0; d < prefixUsageDirs; d++ {
+		create(fmt.Sprintf("data/d%02d/", d), nil)
+		for s := 0; s < prefixUsageSubdirs; s++ {
+			for f := 0; f < prefixUsageFiles; f++ {
+				contents := make([]byte, (d+s+f)%7)
+				create(fmt.Sprintf("data/d%02d/s%02d/f%03d", d, s, f), contents)
+				prefixUsageBytes += uint64(len(contents))
+			}
+		}
+	}
+	create("other/x", []byte("taco"))
+}
+
+func (t *PrefixUsageTest) SetUp(ti *TestInfo) {
+	t.ctx = ti.Ctx
+	t.bucket = fake.NewCountingBucket(prefixUsageBucket)
+	t.bucket.Intercept = func(ctx context.Context, method string, name string) error {
+		if t.unblock != nil {
+			select {
+			case <-t.unblock:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		time.Sleep(time.Millisecond)
+		return nil
+	}
+	t.progress = new(PrefixUsageProgress)
+}
+
+////////////////////////////////////////////////////////////////////////
+// Tests
+////////////////////////////////////////////////////////////////////////
+
+func (t *PrefixUsageTest) CountsEverythingUnderThePrefix() {
+	usage, err := SumPrefix(t.ctx, t.bucket, "data/", prefixUsageParallel, 2*prefixUsageObjects, t.progress)
+
+	AssertEq(nil, err)
+	// The placeholders of data/'s directories count, while its own doesn't.
+	ExpectEq(prefixUsageObjects+prefixUsageDirs, usage.ObjectCount)
+	ExpectEq(prefixUsageBytes, usage.TotalBytes)
+}
+
+func (t *PrefixUsageTest) CountsASubtree() {
+	usage, err := SumPrefix(t.ctx, t.bucket, "data/d07/s03/", prefixUsageParallel, prefixUsageObjects, t.progress)
+
+	AssertEq(nil, err)
+	ExpectEq(prefixUsageFiles, usage.ObjectCount)
+}
+
+func (t *PrefixUsageTest) CountsNothingUnderAMissingPrefix() {
+	usage, err := SumPrefix(t.ctx, t.bucket, "missing/", prefixUsageParallel, prefixUsageObjects, t.progress)
+
+	AssertEq(nil, err)
+	ExpectEq(0, usage.ObjectCount)
+	ExpectEq(0, usage.TotalBytes)
+}
+
+func (t *PrefixUsageTest) ListsInParallel() {
+	_, err := SumPrefix(t.ctx, t.bucket, "data/", prefixUsageParallel, 2*prefixUsageObjects, t.progress)
+	AssertEq(nil, err)
+
+	// The directories are listed side by side, never more than allowed.
+	ExpectGt(t.bucket.MaxRunning("ListObjects"), 1)
+	ExpectLe(t.bucket.MaxRunning("ListObjects"), prefixUsageParallel)
+}
+
+func (t *PrefixUsageTest) ReportsProgress() {
+	_, err := SumPrefix(t.ctx, t.bucket, "data/", prefixUsageParallel, 2*prefixUsageObjects, t.progress)
+	AssertEq(nil, err)
+
+	ExpectEq(prefixUsageObjects+prefixUsageDirs, t.progress.Objects())
+	ExpectEq(prefixUsageBytes, t.progress.Bytes())
+	// At least a page for data/, each directory and each subdirectory.
+	ExpectGe(t.progress.Pages(), 1+prefixUsageDirs+prefixUsageDirs*prefixUsageSubdirs)
+	ExpectEq(0, t.progress.PendingPrefixes())
+	ExpectTrue(t.progress.Done())
+	ExpectThat(t.progress.String(), HasSubstr("pending=0 done=true"))
+}
+
+func (t *PrefixUsageTest) ReportsProgressWhileRunning() {
+	t.unblock = make(chan struct{})
+	done := make(chan error)
+	go func() {
+		_, err := SumPrefix(t.ctx, t.bucket, "data/", prefixUsageParallel, 2*prefixUsageObjects, t.progress)
+		done <- err
+	}()
+
+	// Nothing has been listed yet.
+	time.Sleep(10 * time.Millisecond)
+	ExpectEq("objects=0 bytes=0 pages=0 pending=1 done=false", t.progress.String())
+
+	close(t.unblock)
+	AssertEq(nil, <-done)
+	ExpectTrue(t.progress.Done())
+}
+
+func (t *PrefixUsageTest) FailsBeyondMaxObjects() {
+	_, err := SumPrefix(t.ctx, t.bucket, "data/", prefixUsageParallel, prefixUsageObjects, t.progress)
+
+	ExpectTrue(errors.Is(err, ErrTooManyObjects), "%v", err)
+	ExpectTrue(t.progress.Done())
+}
+
+func (t *PrefixUsageTest) StopsWithTheContext() {
+	t.unblock = make(chan struct{})
+	ctx, cancel := context.WithCancel(t.ctx)
+	done := make(chan error)
+	go func() {
+		_, err := SumPrefix(ctx, t.bucket, "data/", prefixUsageParallel, 2*prefixUsageObjects, t.progress)
+		done <- err
+	}()
+
+	cancel()
+	err := <-done
+	ExpectTrue(errors.Is(err, context.Canceled), "%v", err)
+	ExpectTrue(t.progress.Done())
+}
@@ -15,6 +15,7 @@
 package gcsx
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"strings"
@@ -35,14 +36,9 @@ import (
 // MB is 1 Megabyte. (Silly comment to make the lint warning go away)
 const MB = 1 << 20
 
-// Min read size in bytes for random reads.
-// We will not send a request to GCS for less than this many bytes (unless the
-// end of the object comes first).
-const minReadSize = MB
-
 // Max read size in bytes for random reads.
 // If the average read size (between seeks) is below this number, reads will
-// optimised for random access.
+// optimised for random access, and request exactly the range asked for.
 // We will skip forwards in a GCS response at most this many bytes.
 // About 6 MB of data is buffered anyway, so 8 MB seems like a good round number.
 const maxReadSize = 8 * MB
@@ -77,9 +73,29 @@ type RandomReader interface {
 	Destroy()
 }
 
+// How a reader made sure that the object is still at its generation before
+// first reading it from the file cache, as logged with that read.
+const (
+	// The record the reader was created with came from the metadata cache
+	// within its ttl, so stands in for a stat.
+	CacheValidationMetadataCache = "metadata_cache"
+
+	// The record was older than that, so the object was stat'd.
+	CacheValidationStat = "stat"
+)
+
 // NewRandomReader create a random reader for the supplied object record that
-// reads using the given bucket.
-func NewRandomReader(o *gcs.MinObject, bucket gcs.Bucket, sequentialReadSizeMb int32, fileCacheHandler *file.CacheHandler, cacheFileForRangeRead bool) RandomReader {
+// reads using the given bucket. If zeroExtentHints is true, ranges that the
+// object's metadata describes as holding only zeros are served without
+// reading them from GCS; see ZeroExtentsMetadataKey. If validateSource is
+// true, the record is older than the metadata cache ttl, and the object is
+// stat'd before its generation is read from the file cache.
+func NewRandomReader(o *gcs.MinObject, bucket gcs.Bucket, sequentialReadSizeMb int32, fileCacheHandler *file.CacheHandler, cacheFileForRangeRead bool, zeroExtentHints bool, validateSource bool) RandomReader {
+	var ze zeroExtents
+	if zeroExtentHints {
+		ze = parseZeroExtents(o)
+	}
+
 	return &randomReader{
 		object:                o,
 		bucket:                bucket,
@@ -90,6 +106,8 @@ func NewRandomReader(o *gcs.MinObject, bucket gcs.Bucket, sequentialReadSizeMb i
 		sequentialReadSizeMb:  sequentialReadSizeMb,
 		fileCacheHandler:      fileCacheHandler,
 		cacheFileForRangeRead: cacheFileForRangeRead,
+		zeroExtents:           ze,
+		validateSource:        validateSource,
 	}
 }
 
@@ -129,6 +147,19 @@ type randomReader struct {
 	// fileCacheHandle is used to read from the cached location. It is created on the fly
 	// using fileCacheHandler for the given object and bucket.
 	fileCacheHandle *file.CacheHandle
+
+	// Ranges of the object known to hold only zeros, which are never read
+	// from GCS.
+	zeroExtents zeroExtents
+
+	// Whether the object must be stat'd before the file cache is first used;
+	// see NewRandomReader. Cleared once it has been.
+	validateSource bool
+
+	// Set if that stat found the object at a later generation, or deleted, in
+	// which case the file cache isn't used and reads go to GCS, where they
+	// find out the same.
+	sourceSuperseded bool
 }
 
 func (rr *randomReader) CheckInvariants() {
@@ -168,7 +199,7 @@ func (rr *randomReader) tryReadingFromFileCache(ctx context.Context,
 	p []byte,
 	offset int64) (n int, cacheHit bool, err error) {
 
-	if rr.fileCacheHandler == nil {
+	if rr.fileCacheHandler == nil || rr.sourceSuperseded {
 		return
 	}
 
@@ -181,6 +212,10 @@ func (rr *randomReader) tryReadingFromFileCache(ctx context.Context,
 	logger.Tracef("%.13v <- FileCache(%s:/%s, offset: %d, size: %d handle: %d)", requestId, rr.bucket.Name(), rr.object.Name, offset, len(p), readOp.Handle)
 	startTime := time.Now()
 
+	// How the object's generation was validated, if this read was the first
+	// from the file cache.
+	var validation string
+
 	// Response log
 	defer func() {
 		executionTime := time.Since(startTime)
@@ -191,7 +226,11 @@ func (rr *randomReader) tryReadingFromFileCache(ctx context.Context,
 			if rr.fileCacheHandle != nil {
 				isSeq = rr.fileCacheHandle.IsSequential(offset)
 			}
-			requestOutput = fmt.Sprintf("OK (isSeq: %t, hit: %t) (%v)", isSeq, cacheHit, executionTime)
+			if validation != "" {
+				requestOutput = fmt.Sprintf("OK (isSeq: %t, hit: %t, validation: %s) (%v)", isSeq, cacheHit, validation, executionTime)
+			} else {
+				requestOutput = fmt.Sprintf("OK (isSeq: %t, hit: %t) (%v)", isSeq, cacheHit, executionTime)
+			}
 		}
 
 		// Here rr.fileCacheHandle will not be nil since we return from the above in those cases.
@@ -207,10 +246,17 @@ func (rr *randomReader) tryReadingFromFileCache(ctx context.Context,
 
 	// Create fileCacheHandle if not already.
 	if rr.fileCacheHandle == nil {
+		validation = rr.validateSourceForFileCache(ctx)
+		if rr.sourceSuperseded {
+			return 0, false, nil
+		}
+
 		rr.fileCacheHandle, err = rr.fileCacheHandler.GetCacheHandle(rr.object, rr.bucket, rr.cacheFileForRangeRead, offset)
 		if err != nil {
-			// We fall back to GCS if file size is greater than the cache size
-			if strings.Contains(err.Error(), lru.InvalidEntrySizeErrorMsg) {
+			// We fall back to GCS if file size is greater than the cache size, or
+			// if every cache directory has failed.
+			if strings.Contains(err.Error(), lru.InvalidEntrySizeErrorMsg) ||
+				strings.Contains(err.Error(), cacheutil.NoUsableCacheDirErrMsg) {
 				logger.Warnf("tryReadingFromFileCache: while creating CacheHandle: %v", err)
 				return 0, false, nil
 			} else if strings.Contains(err.Error(), cacheutil.CacheHandleNotRequiredForRandomReadErrMsg) {
@@ -218,6 +264,14 @@ func (rr *randomReader) tryReadingFromFileCache(ctx context.Context,
 				// False and there doesn't already exist file in cache.
 				isSeq = false
 				return 0, false, nil
+			} else if strings.Contains(err.Error(), cacheutil.SharedEntryNotAvailableErrMsg) {
+				// Fall back to GCS if the cache is shared, and the gcsfuse process
+				// owning it hasn't downloaded the file.
+				return 0, false, nil
+			} else if strings.Contains(err.Error(), cacheutil.CacheUnavailableErrMsg) {
+				// Fall back to GCS while the cache recovers from disk errors, which
+				// the cache handler has already logged.
+				return 0, false, nil
 			}
 
 			return 0, false, fmt.Errorf("tryReadingFromFileCache: while creating CacheHandle instance: %w", err)
@@ -258,6 +312,15 @@ func (rr *randomReader) ReadAt(
 		return
 	}
 
+	// Attribute the bytes returned to where they were served from, all at once
+	// when the read is done.
+	served := make(monitor.ReadBytes)
+	defer func() {
+		if err == nil || err == io.EOF {
+			monitor.CaptureReadBytesMetrics(ctx, served)
+		}
+	}()
+
 	// Note: If we are reading the file for the first time and read type is sequential
 	// then the file cache behavior is write-through i.e. data is first read from
 	// GCS, cached in file and then served from that file. But the cacheHit is
@@ -267,6 +330,11 @@ func (rr *randomReader) ReadAt(
 		err = fmt.Errorf("ReadAt: while reading from cache: %w", err)
 		return
 	}
+	if cacheHit {
+		served.Add(monitor.ReadFromFileCache, n)
+	} else {
+		served.Add(monitor.ReadFromFileCacheDownload, n)
+	}
 	// Data was served from cache.
 	if cacheHit || n == len(p) || (n < len(p) && uint64(offset)+uint64(n) == rr.object.Size) {
 		return
@@ -279,17 +347,31 @@ func (rr *randomReader) ReadAt(
 			return
 		}
 
+		// Serve ranges known to hold only zeros locally.
+		if zeros := rr.zeroExtents.zerosAt(offset, len(p)); zeros > 0 {
+			clear(p[:zeros])
+			n += zeros
+			served.Add(monitor.ReadFromZeroExtents, zeros)
+			p = p[zeros:]
+			offset += int64(zeros)
+			continue
+		}
+
 		// When the offset is AFTER the reader position, try to seek forward, within reason.
 		// This happens when the kernel page cache serves some data. It's very common for
 		// concurrent reads, often by only a few 128kB fuse read requests. The aim is to
 		// re-use GCS connection and avoid throwing away already read data.
 		// For parallel sequential reads to a single file, not throwing away the connections
 		// is a 15-20x improvement in throughput: 150-200 MB/s instead of 10 MB/s.
-		if rr.reader != nil && rr.start < offset && offset-rr.start < maxReadSize {
+		// The reader's range may extend well past the last read, so only skip
+		// forward if the offset lies within it. The skipped bytes were downloaded
+		// for nothing.
+		if rr.reader != nil && rr.start < offset && offset < rr.limit && offset-rr.start < maxReadSize {
 			bytesToSkip := int64(offset - rr.start)
 			p := make([]byte, bytesToSkip)
 			n, _ := io.ReadFull(rr.reader, p)
 			rr.start += int64(n)
+			monitor.CaptureWastedBytesMetrics(ctx, monitor.WasteOverread, int64(n))
 		}
 
 		// If we have an existing reader but it's positioned at the wrong place,
@@ -304,6 +386,14 @@ func (rr *randomReader) ReadAt(
 		// If we don't have a reader, start a read operation.
 		if rr.reader == nil {
 			err = rr.startRead(ctx, offset, int64(len(p)))
+
+			// The object may end before the offset after all.
+			var rangeErr *gcs.RangeNotSatisfiableError
+			if errors.As(err, &rangeErr) && rr.objectShrunk(ctx) {
+				err = nil
+				continue
+			}
+
 			if err != nil {
 				err = fmt.Errorf("startRead: %w", err)
 				return
@@ -316,6 +406,7 @@ func (rr *randomReader) ReadAt(
 		tmp, err = rr.readFull(ctx, p)
 
 		n += tmp
+		served.Add(monitor.ReadFromGCS, tmp)
 		p = p[tmp:]
 		rr.start += int64(tmp)
 		offset += int64(tmp)
@@ -349,8 +440,19 @@ func (rr *randomReader) ReadAt(
 			// if the reader peters out early. That's fine, but it means we should
 			// have hit the limit above.
 			if rr.reader != nil {
-				err = fmt.Errorf("Reader returned %d too few bytes", rr.limit-rr.start)
-				return
+				err = fmt.Errorf("Reader returned %d too few bytes: %w", rr.limit-rr.start, io.ErrUnexpectedEOF)
+
+				// The reader's connection was most likely cut short; don't reuse it,
+				// so that the read can be retried. Otherwise the object ended early,
+				// and the read is short.
+				rr.reader.Close()
+				rr.reader = nil
+				rr.cancel = nil
+				rr.start = -1
+				rr.limit = -1
+				if !rr.objectShrunk(ctx) {
+					return
+				}
 			}
 
 			err = nil
@@ -365,6 +467,58 @@ func (rr *randomReader) ReadAt(
 	return
 }
 
+// validateSourceForFileCache makes sure, before the reader first reads from
+// the file cache, that the object is still at the generation of rr.object,
+// and returns how. Unless rr.validateSource is set, the record the reader was
+// created with is recent enough to tell. Otherwise the object is stat'd, which
+// sets rr.sourceSuperseded if it has a later generation or was deleted. A new
+// metageneration alone doesn't change the contents, so keeps the cache valid.
+func (rr *randomReader) validateSourceForFileCache(ctx context.Context) string {
+	if !rr.validateSource {
+		return CacheValidationMetadataCache
+	}
+	rr.validateSource = false
+
+	latest, _, err := rr.bucket.StatObject(ctx, &gcs.StatObjectRequest{Name: rr.object.Name})
+	var notFoundErr *gcs.NotFoundError
+	switch {
+	case errors.As(err, &notFoundErr):
+		logger.Infof("%q was deleted; not reading it from the file cache.", rr.object.Name)
+		rr.sourceSuperseded = true
+
+	case err != nil:
+		// The cache only serves the generation of rr.object, so is no worse than
+		// reading that from GCS.
+		logger.Warnf("Validating %q for the file cache: %v", rr.object.Name, err)
+
+	case latest.Generation != rr.object.Generation:
+		logger.Infof("%q is at generation %d rather than %d; not reading it from the file cache.",
+			rr.object.Name, latest.Generation, rr.object.Generation)
+		rr.sourceSuperseded = true
+	}
+
+	return CacheValidationStat
+}
+
+// objectShrunk checks, after a read came up short of what rr.object says,
+// whether the generation read is shorter than that, e.g. because it was
+// truncated since it was statted. If so, it updates rr.object, whose size
+// the reader's owner can take on, and returns true. The stat bypasses, and so
+// refreshes, the stat cache.
+func (rr *randomReader) objectShrunk(ctx context.Context) bool {
+	latest, _, err := rr.bucket.StatObject(ctx, &gcs.StatObjectRequest{
+		Name:              rr.object.Name,
+		ForceFetchFromGcs: true,
+	})
+	if err != nil || latest.Generation != rr.object.Generation || latest.Size >= rr.object.Size {
+		return false
+	}
+
+	logger.Infof("%q is %d bytes long rather than %d; reading up to its end.", rr.object.Name, latest.Size, rr.object.Size)
+	rr.object.Size = latest.Size
+	return true
+}
+
 func (rr *randomReader) Object() (o *gcs.MinObject) {
 	o = rr.object
 	return
@@ -452,22 +606,15 @@ func (rr *randomReader) startRead(
 	// GCS read requests, which are not free.
 
 	// But if we notice random read patterns after a minimum number of seeks,
-	// optimise for random reads. Random reads will read data in chunks of
-	// (average read size in bytes rounded up to the next MB).
+	// optimise for random reads. Random reads request exactly the range asked
+	// for, as data past it is unlikely to be read before the next seek.
 	end := int64(rr.object.Size)
 	readType := util.Sequential
 	if rr.seeks >= minSeeksForRandom {
 		readType = util.Random
 		averageReadBytes := rr.totalReadBytes / rr.seeks
 		if averageReadBytes < maxReadSize {
-			randomReadSize := int64(((averageReadBytes / MB) + 1) * MB)
-			if randomReadSize < minReadSize {
-				randomReadSize = minReadSize
-			}
-			if randomReadSize > maxReadSize {
-				randomReadSize = maxReadSize
-			}
-			end = start + randomReadSize
+			end = start + size
 		}
 	}
 	if end > int64(rr.object.Size) {
@@ -481,8 +628,13 @@ func (rr *randomReader) startRead(
 		end = start + maxSizeToReadFromGCS
 	}
 
-	// Begin the read.
-	ctx, cancel := context.WithCancel(context.Background())
+	// Stop short of the next range known to hold only zeros, which is served
+	// without reading it.
+	end = min(end, rr.zeroExtents.nextZeroExtent(start))
+
+	// Begin the read. The reader outlives the operation, so only the values of
+	// its context are kept.
+	ctx, cancel := util.IsolateContextFromParentContext(ctx)
 	rc, err := rr.bucket.NewReader(
 		ctx,
 		&gcs.ReadObjectRequest{
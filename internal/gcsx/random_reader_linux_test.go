@@ -0,0 +1,59 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcsx
+
+import (
+	"io"
+	"os"
+	"path"
+	"reflect"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/util"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	testutil "github.com/googlecloudplatform/gcsfuse/v2/internal/util"
+	. "github.com/jacobsa/oglematchers"
+	. "github.com/jacobsa/oglemock"
+	. "github.com/jacobsa/ogletest"
+	"golang.org/x/net/context"
+)
+
+func (t *RandomReaderTest) Test_ReadAt_CacheWriteFailureFallsBackToGCS() {
+	t.rr.wrapped.fileCacheHandler = t.cacheHandler
+	objectSize := t.object.Size
+	testContent := testutil.GenerateRandomBytes(int(objectSize))
+	ExpectCall(t.bucket, "NewReader")(Any(), Any()).
+		WillRepeatedly(Invoke(func(_ context.Context, req *gcs.ReadObjectRequest) (io.ReadCloser, error) {
+			return getReadCloser(testContent[req.Range.Start:req.Range.Limit]), nil
+		}))
+	ExpectCall(t.bucket, "Name")().WillRepeatedly(Return("test"))
+	// Writes to the file in cache fail as on a full disk.
+	filePath := util.GetDownloadPath(t.cacheDir, util.GetObjectPath("test", t.object.Name))
+	AssertEq(nil, os.MkdirAll(path.Dir(filePath), util.DefaultDirPerm))
+	_ = os.Remove(filePath)
+	AssertEq(nil, os.Symlink("/dev/full", filePath))
+	defer os.Remove(filePath)
+
+	// The first read finds the disk full, and the next one doesn't try the
+	// cache while it recovers.
+	for i := 0; i < 2; i++ {
+		buf := make([]byte, objectSize)
+		_, cacheHit, err := t.rr.ReadAt(buf, 0)
+
+		AssertEq(nil, err)
+		ExpectFalse(cacheHit)
+		ExpectTrue(reflect.DeepEqual(testContent, buf))
+		ExpectEq(nil, t.rr.wrapped.fileCacheHandle)
+	}
+}
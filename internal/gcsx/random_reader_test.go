@@ -178,7 +178,7 @@ func (t *RandomReaderTest) SetUp(ti *TestInfo) {
 	t.cacheHandler = file.NewCacheHandler(lruCache, t.jobManager, t.cacheDir, util.DefaultFilePerm, util.DefaultDirPerm)
 
 	// Set up the reader.
-	rr := NewRandomReader(t.object, t.bucket, sequentialReadSizeInMb, nil, false)
+	rr := NewRandomReader(t.object, t.bucket, sequentialReadSizeInMb, nil, false, false, false)
 	t.rr.wrapped = rr.(*randomReader)
 }
 
@@ -281,6 +281,27 @@ func (t *RandomReaderTest) ExistingReader_ReadAtOffsetAfterTheReaderPosition() {
 	ExpectEq(readerLimit, t.rr.wrapped.limit)
 }
 
+func (t *RandomReaderTest) ExistingReader_ReadAtOffsetAfterTheReaderLimit() {
+	// Simulate an existing reader, whose range ends before the offset read.
+	r := strings.NewReader("xxx")
+	t.rr.wrapped.reader = io.NopCloser(r)
+	t.rr.wrapped.cancel = func() {}
+	t.rr.wrapped.start = 2
+	t.rr.wrapped.limit = 5
+	// The bucket should be called to set up a new reader.
+	ExpectCall(t.bucket, "NewReader")(Any(), AllOf(rangeStartIs(10), rangeLimitIs(t.object.Size))).
+		WillOnce(Return(getReadCloser([]byte("yyyyyyy")), nil))
+	buf := make([]byte, 1)
+
+	_, _, err := t.rr.ReadAt(buf, 10)
+
+	AssertEq(nil, err)
+	ExpectEq("y", string(buf))
+	// The old reader should be thrown away without draining it.
+	ExpectEq(3, r.Len())
+	ExpectEq(1, t.rr.wrapped.seeks)
+}
+
 func (t *RandomReaderTest) NewReaderReturnsError() {
 	ExpectCall(t.bucket, "NewReader")(Any(), Any()).
 		WillOnce(Return(nil, errors.New("taco")))
@@ -404,6 +425,79 @@ func (t *RandomReaderTest) ReaderExhausted_ReadNotFinished() {
 	ExpectEq(4, t.rr.wrapped.limit)
 }
 
+func (t *RandomReaderTest) ReaderCutShort() {
+	// Set up a reader that gives only two of the four bytes of its range.
+	rc := &countingCloser{
+		Reader: strings.NewReader("ab"),
+	}
+
+	t.rr.wrapped.reader = rc
+	t.rr.wrapped.cancel = func() {}
+	t.rr.wrapped.start = 1
+	t.rr.wrapped.limit = 5
+
+	// The object is as long as it was.
+	latest := *t.object
+	ExpectCall(t.bucket, "StatObject")(Any(), Any()).
+		WillOnce(Return(&latest, nil, nil))
+
+	buf := make([]byte, 4)
+	n, _, err := t.rr.ReadAt(buf, 1)
+
+	// The read fails with an error that may be retried, and the reader is
+	// thrown away so that a retry starts a new one.
+	ExpectEq(2, n)
+	ExpectTrue(errors.Is(err, io.ErrUnexpectedEOF), "err: %v", err)
+	ExpectEq(1, rc.closeCount)
+	ExpectEq(nil, t.rr.wrapped.reader)
+	ExpectEq(nil, t.rr.wrapped.cancel)
+}
+
+func (t *RandomReaderTest) ReaderCutShortByShrunkObject() {
+	// Set up a reader that gives only two of the four bytes of its range,
+	// because the object now ends there.
+	rc := &countingCloser{
+		Reader: strings.NewReader("ab"),
+	}
+
+	t.rr.wrapped.reader = rc
+	t.rr.wrapped.cancel = func() {}
+	t.rr.wrapped.start = 1
+	t.rr.wrapped.limit = 5
+
+	latest := *t.object
+	latest.Size = 3
+	ExpectCall(t.bucket, "StatObject")(Any(), Any()).
+		WillOnce(Return(&latest, nil, nil))
+
+	buf := make([]byte, 4)
+	n, _, err := t.rr.ReadAt(buf, 1)
+
+	// The read is short, up to the new end of the object.
+	ExpectEq(2, n)
+	ExpectEq(io.EOF, err)
+	ExpectEq("ab", string(buf[:n]))
+	ExpectEq(3, t.rr.wrapped.object.Size)
+}
+
+func (t *RandomReaderTest) RangeNotSatisfiable() {
+	ExpectCall(t.bucket, "NewReader")(Any(), Any()).
+		WillOnce(Return(nil, &gcs.RangeNotSatisfiableError{Err: errors.New("taco")}))
+
+	latest := *t.object
+	latest.Size = 5
+	ExpectCall(t.bucket, "StatObject")(Any(), Any()).
+		WillOnce(Return(&latest, nil, nil))
+
+	buf := make([]byte, 4)
+	n, _, err := t.rr.ReadAt(buf, 10)
+
+	// The read is past the new end of the object.
+	ExpectEq(0, n)
+	ExpectEq(io.EOF, err)
+	ExpectEq(5, t.rr.wrapped.object.Size)
+}
+
 func (t *RandomReaderTest) PropagatesCancellation() {
 	// Set up a reader that will block until we tell it to return.
 	finishRead := make(chan struct{})
@@ -509,15 +603,12 @@ func (t *RandomReaderTest) UpgradesReadsToObjectSize() {
 	ExpectEq(objectSize, t.rr.wrapped.limit)
 }
 
-func (t *RandomReaderTest) UpgradeReadsToAverageSize() {
+func (t *RandomReaderTest) RandomReadsRequestExactRange() {
 	t.object.Size = 1 << 40
 	const totalReadBytes = 6 * MB
 	const numReads = 2
-	const avgReadBytes = totalReadBytes / numReads
-
-	const expectedBytesToRead = avgReadBytes
 	const start = 1
-	const readSize = 2 * minReadSize
+	const readSize = 128 * 1024
 
 	// Simulate an existing reader at a mismatched offset.
 	t.rr.wrapped.seeks = numReads
@@ -527,15 +618,15 @@ func (t *RandomReaderTest) UpgradeReadsToAverageSize() {
 	t.rr.wrapped.start = 2
 	t.rr.wrapped.limit = 5
 
-	// The bucket should be asked to read expectedBytesToRead bytes.
-	r := strings.NewReader(strings.Repeat("x", expectedBytesToRead))
+	// The bucket should be asked to read exactly readSize bytes.
+	r := strings.NewReader(strings.Repeat("x", readSize))
 	rc := io.NopCloser(r)
 
 	ExpectCall(t.bucket, "NewReader")(
 		Any(),
 		AllOf(
 			rangeStartIs(start),
-			rangeLimitIs(start+expectedBytesToRead),
+			rangeLimitIs(start+readSize),
 		)).WillOnce(Return(rc, nil))
 
 	// Call through.
@@ -545,7 +636,34 @@ func (t *RandomReaderTest) UpgradeReadsToAverageSize() {
 	// Check the state now.
 	ExpectFalse(cacheHit)
 	AssertEq(nil, err)
-	ExpectEq(start+expectedBytesToRead, t.rr.wrapped.limit)
+	ExpectEq(nil, t.rr.wrapped.reader)
+	ExpectEq(start+readSize, t.rr.wrapped.limit)
+}
+
+func (t *RandomReaderTest) RandomReadsNearEndOfObjectAreClipped() {
+	t.object.Size = 10 * MB
+	const start = 10*MB - 100
+	const readSize = 128 * 1024
+	t.rr.wrapped.seeks = minSeeksForRandom
+	t.rr.wrapped.totalReadBytes = MB
+
+	// The bucket should be asked to read up to the end of the object only.
+	r := strings.NewReader(strings.Repeat("x", 100))
+	rc := io.NopCloser(r)
+
+	ExpectCall(t.bucket, "NewReader")(
+		Any(),
+		AllOf(
+			rangeStartIs(start),
+			rangeLimitIs(10*MB),
+		)).WillOnce(Return(rc, nil))
+
+	// Call through.
+	buf := make([]byte, readSize)
+	n, _, err := t.rr.ReadAt(buf, start)
+
+	ExpectEq(io.EOF, err)
+	ExpectEq(100, n)
 }
 
 func (t *RandomReaderTest) UpgradesSequentialReads_ExistingReader() {
@@ -587,7 +705,7 @@ func (t *RandomReaderTest) UpgradesSequentialReads_NoExistingReader() {
 	t.object.Size = 1 << 40
 	const readSize = 1 * MB
 	// Set up the custom randomReader.
-	rr := NewRandomReader(t.object, t.bucket, readSize/MB, nil, false)
+	rr := NewRandomReader(t.object, t.bucket, readSize/MB, nil, false, false, false)
 	t.rr.wrapped = rr.(*randomReader)
 
 	// Simulate a previous exhausted reader that ended at the offset from which
@@ -620,7 +738,7 @@ func (t *RandomReaderTest) SequentialReads_NoExistingReader_requestedSizeGreater
 	const chunkSize = 1 * MB
 	const readSize = 3 * MB
 	// Set up the custom randomReader.
-	rr := NewRandomReader(t.object, t.bucket, chunkSize/MB, nil, false)
+	rr := NewRandomReader(t.object, t.bucket, chunkSize/MB, nil, false, false, false)
 	t.rr.wrapped = rr.(*randomReader)
 	// Create readers for each chunk.
 	chunk1Reader := strings.NewReader(strings.Repeat("x", chunkSize))
@@ -667,7 +785,7 @@ func (t *RandomReaderTest) SequentialReads_existingReader_requestedSizeGreaterTh
 	const chunkSize = 1 * MB
 	const readSize = 3 * MB
 	// Set up the custom randomReader.
-	rr := NewRandomReader(t.object, t.bucket, chunkSize/MB, nil, false)
+	rr := NewRandomReader(t.object, t.bucket, chunkSize/MB, nil, false, false, false)
 	t.rr.wrapped = rr.(*randomReader)
 	// Simulate an existing reader at the correct offset, which will be exhausted
 	// by the read below.
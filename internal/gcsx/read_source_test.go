@@ -0,0 +1,236 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcsx
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/file"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/file/downloader"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/lru"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/util"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/monitor"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/monitor/tags"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	"github.com/jacobsa/fuse/fuseops"
+	. "github.com/jacobsa/ogletest"
+	"github.com/jacobsa/timeutil"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+	"golang.org/x/net/context"
+)
+
+func TestReadSource(t *testing.T) { RunTests(t) }
+
+////////////////////////////////////////////////////////////////////////
+// Boilerplate
+////////////////////////////////////////////////////////////////////////
+
+const readSourceObjectSize = 100
+
+type ReadSourceTest struct {
+	ctx          context.Context
+	bucket       gcs.Bucket
+	cacheDir     string
+	jobManager   *downloader.JobManager
+	cacheHandler *file.CacheHandler
+
+	// Readers created by the test, destroyed in TearDown.
+	readers []RandomReader
+}
+
+func init() { RegisterTestSuite(&ReadSourceTest{}) }
+
+func (t *ReadSourceTest) SetUp(ti *TestInfo) {
+	readOp := fuseops.ReadFileOp{Handle: 1}
+	t.ctx = context.WithValue(ti.Ctx, ReadOp, &readOp)
+	t.bucket = fake.NewFakeBucket(timeutil.RealClock(), "some_bucket")
+
+	var err error
+	t.cacheDir, err = os.MkdirTemp("", "read_source_test")
+	AssertEq(nil, err)
+
+	lruCache := lru.NewCache(CacheMaxSize)
+	t.jobManager = downloader.NewJobManager(lruCache, util.DefaultFilePerm, util.DefaultDirPerm, t.cacheDir, sequentialReadSizeInMb)
+	t.cacheHandler = file.NewCacheHandler(lruCache, t.jobManager, t.cacheDir, util.DefaultFilePerm, util.DefaultDirPerm)
+}
+
+func (t *ReadSourceTest) TearDown() {
+	for _, rr := range t.readers {
+		rr.Destroy()
+	}
+	t.jobManager.Destroy()
+	os.RemoveAll(t.cacheDir)
+}
+
+// Create an object with non-zero contents, except for the given range, which
+// is hinted to be zeros if zerosLen is non-zero.
+func (t *ReadSourceTest) createObject(name string, zerosStart, zerosLen int) *gcs.MinObject {
+	contents := bytes.Repeat([]byte("x"), readSourceObjectSize)
+	clear(contents[zerosStart : zerosStart+zerosLen])
+
+	o, err := storageutil.CreateObject(t.ctx, t.bucket, name, contents)
+	AssertEq(nil, err)
+	m := storageutil.ConvertObjToMinObject(o)
+
+	if zerosLen > 0 {
+		m.Metadata = map[string]string{
+			ZeroExtentsMetadataKey: fmt.Sprintf(`{"generation": %d, "extents": [[%d, %d]]}`, m.Generation, zerosStart, zerosLen),
+		}
+	}
+
+	return m
+}
+
+func (t *ReadSourceTest) newReader(o *gcs.MinObject, cached bool) RandomReader {
+	var fileCacheHandler *file.CacheHandler
+	if cached {
+		fileCacheHandler = t.cacheHandler
+	}
+
+	rr := NewRandomReader(o, t.bucket, sequentialReadSizeInMb, fileCacheHandler, false, true, false)
+	t.readers = append(t.readers, rr)
+	return rr
+}
+
+// Read size bytes at offset, returning the number read.
+func (t *ReadSourceTest) readAt(rr RandomReader, offset int64, size int) int {
+	n, _, err := rr.ReadAt(t.ctx, make([]byte, size), offset)
+	if err != io.EOF {
+		AssertEq(nil, err)
+	}
+	return n
+}
+
+// Return the bytes counted by the named sum view so far, by the value of key.
+func bytesByTag(viewName string, key tag.Key) map[string]int64 {
+	rows, err := view.RetrieveData(viewName)
+	AssertEq(nil, err)
+
+	byValue := make(map[string]int64)
+	for _, row := range rows {
+		for _, t := range row.Tags {
+			if t.Key == key {
+				byValue[t.Value] += int64(row.Data.(*view.SumData).Value)
+			}
+		}
+	}
+	return byValue
+}
+
+// Return the bytes counted by the fs/read_bytes_count view so far, by source.
+func readBytesBySource() map[string]int64 {
+	return bytesByTag("fs/read_bytes_count", tags.ReadSource)
+}
+
+// Return the bytes counted by the gcs/wasted_bytes view so far, by cause.
+func wastedBytesByCause() map[string]int64 {
+	return bytesByTag("gcs/wasted_bytes", tags.WasteCause)
+}
+
+////////////////////////////////////////////////////////////////////////
+// Tests
+////////////////////////////////////////////////////////////////////////
+
+func (t *ReadSourceTest) EveryByteIsAttributedToExactlyOneSource() {
+	before := readBytesBySource()
+
+	cached := t.newReader(t.createObject("cached", 0, 0), true)
+	plain := t.newReader(t.createObject("plain", 0, 0), false)
+	sparse := t.newReader(t.createObject("sparse", 40, 20), false)
+
+	var total int
+
+	// The first read through the file cache waits for the download, and the
+	// second is served by the cache.
+	total += t.readAt(cached, 0, readSourceObjectSize)
+	total += t.readAt(cached, 0, readSourceObjectSize)
+
+	// Reads without the cache go to GCS, including one running off the end of
+	// the object and one past it.
+	total += t.readAt(plain, 10, 20)
+	total += t.readAt(plain, 90, 20)
+	total += t.readAt(plain, readSourceObjectSize, 20)
+
+	// Zero extents are served locally, and the rest from GCS.
+	total += t.readAt(sparse, 30, 40)
+
+	after := readBytesBySource()
+	delta := make(map[string]int64)
+	var sum int64
+	for source, n := range after {
+		if d := n - before[source]; d != 0 {
+			delta[source] = d
+			sum += d
+		}
+	}
+
+	ExpectEq(total, sum)
+	ExpectEq(readSourceObjectSize, delta[monitor.ReadFromFileCacheDownload])
+	ExpectEq(readSourceObjectSize, delta[monitor.ReadFromFileCache])
+	ExpectEq(20+10+20, delta[monitor.ReadFromGCS])
+	ExpectEq(20, delta[monitor.ReadFromZeroExtents])
+	ExpectEq(4, len(delta))
+}
+
+func (t *ReadSourceTest) FailedReadsAreNotCounted() {
+	before := readBytesBySource()
+
+	o := t.createObject("foo", 0, 0)
+	err := t.bucket.DeleteObject(t.ctx, &gcs.DeleteObjectRequest{Name: o.Name})
+	AssertEq(nil, err)
+
+	rr := t.newReader(o, false)
+	_, _, err = rr.ReadAt(t.ctx, make([]byte, 10), 0)
+	ExpectNe(nil, err)
+
+	ExpectEq(before[monitor.ReadFromGCS], readBytesBySource()[monitor.ReadFromGCS])
+}
+
+func (t *ReadSourceTest) WastedBytesAreAttributedByCause() {
+	before := wastedBytesByCause()
+
+	cached := t.newReader(t.createObject("cached", 0, 0), true)
+	plain := t.newReader(t.createObject("plain", 0, 0), false)
+
+	// Reading past a gap skips over the bytes in it, and reading on from there
+	// wastes nothing.
+	AssertEq(10, t.readAt(plain, 0, 10))
+	AssertEq(10, t.readAt(plain, 40, 10))
+	AssertEq(10, t.readAt(plain, 50, 10))
+
+	// The whole object is downloaded into the cache for the first bytes, and
+	// the rest is never read before it's evicted.
+	AssertEq(10, t.readAt(cached, 0, 10))
+	AssertEq(nil, t.cacheHandler.InvalidateCache("cached", t.bucket.Name()))
+
+	after := wastedBytesByCause()
+	delta := make(map[string]int64)
+	for cause, n := range after {
+		if d := n - before[cause]; d != 0 {
+			delta[cause] = d
+		}
+	}
+
+	ExpectEq(30, delta[monitor.WasteOverread])
+	ExpectEq(readSourceObjectSize-10, delta[monitor.WasteEvictedUnreadCache])
+	ExpectEq(2, len(delta))
+}
@@ -0,0 +1,240 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcsx
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	. "github.com/jacobsa/ogletest"
+	"github.com/jacobsa/timeutil"
+	"golang.org/x/net/context"
+)
+
+func TestSequentialRead(t *testing.T) { RunTests(t) }
+
+////////////////////////////////////////////////////////////////////////
+// Boilerplate
+////////////////////////////////////////////////////////////////////////
+
+// The size of the reads the kernel sends for sequential reads.
+const fuseReadSize = 128 * 1024
+
+type SequentialReadTest struct {
+	ctx    context.Context
+	bucket *rangeRecordingBucket
+}
+
+func init() { RegisterTestSuite(&SequentialReadTest{}) }
+
+func (t *SequentialReadTest) SetUp(ti *TestInfo) {
+	t.ctx = ti.Ctx
+	t.bucket = &rangeRecordingBucket{
+		Bucket: fake.NewFakeBucket(timeutil.RealClock(), "some_bucket"),
+	}
+}
+
+// Create an object of the given size with contents that differ at every
+// offset modulo 251, so that misplaced bytes are noticed.
+func (t *SequentialReadTest) createObject(size int) (*gcs.MinObject, []byte) {
+	contents := make([]byte, size)
+	for i := range contents {
+		contents[i] = byte(i % 251)
+	}
+
+	o, err := storageutil.CreateObject(t.ctx, t.bucket, "foo", contents)
+	AssertEq(nil, err)
+	return storageutil.ConvertObjToMinObject(o), contents
+}
+
+// Read the whole object in fuse-sized reads from the start, as the kernel
+// does, and return what was read.
+func (t *SequentialReadTest) readSequentially(rr RandomReader, size int) []byte {
+	var got []byte
+	for offset := 0; offset < size; offset += fuseReadSize {
+		p := make([]byte, fuseReadSize)
+		n, _, err := rr.ReadAt(t.ctx, p, int64(offset))
+		if offset+fuseReadSize > size {
+			AssertEq(io.EOF, err, "offset %d", offset)
+		} else {
+			AssertEq(nil, err, "offset %d", offset)
+		}
+		got = append(got, p[:n]...)
+	}
+	return got
+}
+
+////////////////////////////////////////////////////////////////////////
+// Tests
+////////////////////////////////////////////////////////////////////////
+
+func (t *SequentialReadTest) ObjectSizesAroundReadSize() {
+	for _, size := range []int{1, fuseReadSize - 1, MB - 1, MB, MB + 1, 2*MB + fuseReadSize, 3*MB - 1} {
+		t.bucket.ranges = nil
+		o, contents := t.createObject(size)
+		rr := NewRandomReader(o, t.bucket, 1, nil, false, false, false)
+
+		got := t.readSequentially(rr, size)
+		rr.Destroy()
+
+		ExpectTrue(bytes.Equal(contents, got), "size %d", size)
+
+		// One request per MiB, each starting where the last one ended and the
+		// last ending at the end of the object.
+		AssertEq((size+MB-1)/MB, len(t.bucket.ranges), "size %d", size)
+		for i, r := range t.bucket.ranges {
+			ExpectEq(uint64(i*MB), r.Start, "size %d", size)
+			ExpectEq(min(uint64((i+1)*MB), uint64(size)), r.Limit, "size %d", size)
+		}
+	}
+}
+
+func (t *SequentialReadTest) ReadSizeLargerThanObject() {
+	const size = 3*MB + 17
+	o, contents := t.createObject(size)
+	rr := NewRandomReader(o, t.bucket, 64, nil, false, false, false)
+	defer rr.Destroy()
+
+	got := t.readSequentially(rr, size)
+
+	ExpectTrue(bytes.Equal(contents, got))
+	AssertEq(1, len(t.bucket.ranges))
+	ExpectEq(0, t.bucket.ranges[0].Start)
+	ExpectEq(size, t.bucket.ranges[0].Limit)
+}
+
+func (t *SequentialReadTest) ReadStraddlingEndOfObject() {
+	const size = MB + 10
+	o, contents := t.createObject(size)
+	rr := NewRandomReader(o, t.bucket, 1, nil, false, false, false)
+	defer rr.Destroy()
+
+	// Read up to the end of the first range, then across the end of the object.
+	p := make([]byte, MB)
+	n, _, err := rr.ReadAt(t.ctx, p, 0)
+	AssertEq(nil, err)
+	AssertEq(MB, n)
+
+	p = make([]byte, fuseReadSize)
+	n, _, err = rr.ReadAt(t.ctx, p, MB)
+
+	ExpectEq(io.EOF, err)
+	AssertEq(10, n)
+	ExpectTrue(bytes.Equal(contents[MB:], p[:n]))
+	AssertEq(2, len(t.bucket.ranges))
+	ExpectEq(MB, t.bucket.ranges[1].Start)
+	ExpectEq(size, t.bucket.ranges[1].Limit)
+
+	// Reading at the end of the object doesn't go to GCS.
+	n, _, err = rr.ReadAt(t.ctx, p, size)
+
+	ExpectEq(io.EOF, err)
+	ExpectEq(0, n)
+	ExpectEq(2, len(t.bucket.ranges))
+}
+
+func (t *SequentialReadTest) RandomReadsRequestExactRanges() {
+	const size = 8 * MB
+	o, contents := t.createObject(size)
+	rr := NewRandomReader(o, t.bucket, 64, nil, false, false, false)
+	defer rr.Destroy()
+
+	// Seek backwards through the object, then read across its end.
+	offsets := []int{5 * MB, 3 * MB, 1*MB + 7, size - 100}
+	for _, offset := range offsets {
+		p := make([]byte, fuseReadSize)
+		n, _, err := rr.ReadAt(t.ctx, p, int64(offset))
+		if offset+fuseReadSize > size {
+			AssertEq(io.EOF, err)
+		} else {
+			AssertEq(nil, err)
+		}
+		ExpectTrue(bytes.Equal(contents[offset:offset+n], p[:n]), "offset %d", offset)
+	}
+
+	// The first reads assume sequential access, until enough seeks are seen.
+	AssertEq(len(offsets), len(t.bucket.ranges))
+	for i, offset := range offsets {
+		r := t.bucket.ranges[i]
+		ExpectEq(offset, r.Start)
+		if i < minSeeksForRandom {
+			ExpectEq(size, r.Limit, "offset %d", offset)
+		} else {
+			ExpectEq(min(offset+fuseReadSize, size), r.Limit, "offset %d", offset)
+		}
+	}
+}
+
+////////////////////////////////////////////////////////////////////////
+// Benchmarks
+////////////////////////////////////////////////////////////////////////
+
+// slowReaderBucket adds a fixed latency to each read request, as GCS does
+// before the first byte of a response.
+type slowReaderBucket struct {
+	rangeRecordingBucket
+	latency time.Duration
+}
+
+func (b *slowReaderBucket) NewReader(
+	ctx context.Context,
+	req *gcs.ReadObjectRequest) (io.ReadCloser, error) {
+	time.Sleep(b.latency)
+	return b.rangeRecordingBucket.NewReader(ctx, req)
+}
+
+// Read a 256 MiB object sequentially in fuse-sized reads for a range of
+// sequential read sizes, and report the requests made.
+func BenchmarkSequentialRead(b *testing.B) {
+	const size = 256 * MB
+	ctx := context.Background()
+	bucket := &slowReaderBucket{
+		rangeRecordingBucket: rangeRecordingBucket{
+			Bucket: fake.NewFakeBucket(timeutil.RealClock(), "some_bucket"),
+		},
+		latency: 20 * time.Millisecond,
+	}
+	o, err := storageutil.CreateObject(ctx, bucket, "foo", make([]byte, size))
+	if err != nil {
+		b.Fatal(err)
+	}
+	object := storageutil.ConvertObjToMinObject(o)
+
+	for _, readSizeMb := range []int32{1, 8, 64} {
+		b.Run(fmt.Sprintf("sequential-read-size-mb=%d", readSizeMb), func(b *testing.B) {
+			bucket.ranges = nil
+			p := make([]byte, fuseReadSize)
+			b.SetBytes(size)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				rr := NewRandomReader(object, bucket, readSizeMb, nil, false, false, false)
+				for offset := int64(0); offset < size; offset += fuseReadSize {
+					if _, _, err := rr.ReadAt(ctx, p, offset); err != nil && err != io.EOF {
+						b.Fatal(err)
+					}
+				}
+				rr.Destroy()
+			}
+
+			b.ReportMetric(float64(len(bucket.ranges))/float64(b.N), "requests/op")
+		})
+	}
+}
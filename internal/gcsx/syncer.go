@@ -15,10 +15,14 @@
 package gcsx
 
 import (
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
+	"sync/atomic"
 	"time"
 
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
 	"golang.org/x/net/context"
 )
@@ -42,20 +46,53 @@ type Syncer interface {
 		fileName string,
 		srcObject *gcs.Object,
 		content TempFile) (o *gcs.Object, err error)
+
+	// AwaitWriteSlot waits until SyncObject could write the named object
+	// without going over the per-object write rate of GCS, if pacing is
+	// enabled, and reports whether it waited. Callers holding up writes of
+	// the object while syncing can call it first to let them go on meanwhile.
+	AwaitWriteSlot(ctx context.Context, objectName string) (waited bool)
 }
 
-// NewSyncer creates a syncer that syncs into the supplied bucket.
-//
-// When the source object has been changed only by appending, and the source
-// object's size is at least appendThreshold, we will "append" to it by writing
-// out a temporary blob and composing it with the source object.
-//
-// Temporary blobs have names beginning with tmpObjectPrefix. We make an effort
-// to delete them, but if we are interrupted for some reason we may not be able
-// to do so. Therefore the user should arrange for garbage collection.
+// SyncerConfig configures the syncers created by NewSyncer.
+type SyncerConfig struct {
+	// When the source object has been changed only by appending, and the
+	// source object's size is at least AppendThreshold, we will "append" to it
+	// by writing out a temporary blob and composing it with the source object.
+	AppendThreshold int64
+
+	// If CompositeUploadThreshold is positive, contents of at least that many
+	// bytes that have to be written out in full are instead uploaded in parts
+	// in parallel, which are then composed into the new generation. Buckets
+	// that refuse the composes get single-stream uploads from then on.
+	CompositeUploadThreshold int64
+
+	// If UploadProgressInterval is positive, a record of the progress of each
+	// upload is logged under the upload_progress component every
+	// UploadProgressInterval bytes, along with a final record once the new
+	// generation has been created.
+	UploadProgressInterval int64
+
+	// If PerObjectWriteDelayMax is positive, writes of the same object name are
+	// spaced out by a second, the rate GCS sustains, each waiting at most
+	// PerObjectWriteDelayMax for its turn.
+	PerObjectWriteDelayMax time.Duration
+
+	// If MutationPlanner is non-nil, it checks the plan of each composite
+	// upload before the upload starts.
+	MutationPlanner *MutationPlanner
+
+	// Temporary blobs have names beginning with TmpObjectPrefix. We make an
+	// effort to delete them, but if we are interrupted for some reason we may
+	// not be able to do so. Therefore the user should arrange for garbage
+	// collection.
+	TmpObjectPrefix string
+}
+
+// NewSyncer creates a syncer that syncs into the supplied bucket, configured
+// by cfg.
 func NewSyncer(
-	appendThreshold int64,
-	tmpObjectPrefix string,
+	cfg SyncerConfig,
 	bucket gcs.Bucket) (os Syncer) {
 	// Create the object creators.
 	fullCreator := &fullObjectCreator{
@@ -63,12 +100,24 @@ func NewSyncer(
 	}
 
 	appendCreator := newAppendObjectCreator(
-		tmpObjectPrefix,
+		cfg.TmpObjectPrefix,
 		bucket)
 
 	// And the syncer.
-	os = newSyncer(appendThreshold, fullCreator, appendCreator)
+	s := newSyncer(cfg.AppendThreshold, fullCreator, appendCreator).(*syncer)
+	if cfg.UploadProgressInterval > 0 {
+		s.progressInterval = cfg.UploadProgressInterval
+		s.progressLogger = logger.NewComponentLogger(UploadProgressComponent)
+	}
+	if cfg.CompositeUploadThreshold > 0 {
+		s.compositeThreshold = cfg.CompositeUploadThreshold
+		s.compositeCreator = newCompositeObjectCreator(cfg.TmpObjectPrefix, bucket, cfg.MutationPlanner)
+	}
+	if cfg.PerObjectWriteDelayMax > 0 {
+		s.pacer = newWritePacer(cfg.PerObjectWriteDelayMax)
+	}
 
+	os = s
 	return
 }
 
@@ -176,6 +225,95 @@ type syncer struct {
 	appendThreshold int64
 	fullCreator     objectCreator
 	appendCreator   objectCreator
+
+	// If positive, the number of bytes between records of upload progress
+	// written to progressLogger.
+	progressInterval int64
+	progressLogger   *slog.Logger
+
+	// If positive, the size from which contents written out in full are
+	// uploaded by compositeCreator, unless the bucket has refused a compose.
+	compositeThreshold  int64
+	compositeCreator    *compositeObjectCreator
+	compositeRestricted atomic.Bool
+
+	// If non-nil, paces the writes of each object name.
+	pacer *writePacer
+}
+
+// create calls through to the supplied object creator, logging the progress
+// of the upload of the size bytes read from r if enabled.
+func (os *syncer) create(
+	ctx context.Context,
+	oc objectCreator,
+	objectName string,
+	srcObject *gcs.Object,
+	mtime *time.Time,
+	size int64,
+	r io.Reader) (o *gcs.Object, err error) {
+	if os.pacer != nil {
+		if _, err = os.pacer.reserve(ctx, objectName); err != nil {
+			return
+		}
+	}
+
+	if os.progressInterval <= 0 {
+		return oc.Create(ctx, objectName, srcObject, mtime, r)
+	}
+
+	pr := newUploadProgressReader(ctx, os.progressLogger, objectName, size, os.progressInterval, r)
+	o, err = oc.Create(ctx, objectName, srcObject, mtime, pr)
+	if err == nil && o != nil {
+		pr.finish(o)
+	}
+
+	return
+}
+
+// createFull writes out the size bytes of content in full, in parts composed
+// into the object if it is large enough.
+func (os *syncer) createFull(
+	ctx context.Context,
+	objectName string,
+	srcObject *gcs.Object,
+	mtime *time.Time,
+	size int64,
+	content TempFile) (o *gcs.Object, err error) {
+	if os.compositeCreator != nil && size >= os.compositeThreshold && !os.compositeRestricted.Load() {
+		if os.pacer != nil {
+			if _, err = os.pacer.reserve(ctx, objectName); err != nil {
+				return
+			}
+		}
+
+		o, err = os.compositeCreator.Create(ctx, objectName, srcObject, mtime, content, size)
+		if !errors.Is(err, errComposeRestricted) {
+			return
+		}
+
+		logger.Warnf(
+			"The bucket refused a composite upload of %q, uploading it and later "+
+				"files in a single stream instead: %v",
+			objectName,
+			err)
+		os.compositeRestricted.Store(true)
+	}
+
+	_, err = content.Seek(0, 0)
+	if err != nil {
+		err = fmt.Errorf("Seek: %w", err)
+		return
+	}
+
+	return os.create(ctx, os.fullCreator, objectName, srcObject, mtime, size, content)
+}
+
+func (os *syncer) AwaitWriteSlot(ctx context.Context, objectName string) (waited bool) {
+	if os.pacer == nil {
+		return false
+	}
+
+	return os.pacer.await(ctx, objectName)
 }
 
 func (os *syncer) SyncObject(
@@ -190,17 +328,12 @@ func (os *syncer) SyncObject(
 		return
 	}
 
-	// Local files are not present on GCS, hence only fullCreator is
-	// invoked and append flow is never triggered.
+	// Local files are not present on GCS, hence they are always written out
+	// in full and append flow is never triggered.
 	if srcObject == nil {
-		// Content.Stat() seeks the current position to end of file. Seek it back
-		// to beginning of the file.
-		_, err = content.Seek(0, 0)
-		if err != nil {
-			err = fmt.Errorf("error in seeking: %w", err)
-			return
-		}
-		return os.fullCreator.Create(ctx, objectName, srcObject, sr.Mtime, content)
+		// Content.Stat() seeks the current position to end of file; createFull
+		// seeks it back to beginning of the file.
+		return os.createFull(ctx, objectName, srcObject, sr.Mtime, sr.Size, content)
 	}
 
 	// Make sure the dirty threshold makes sense.
@@ -240,15 +373,9 @@ func (os *syncer) SyncObject(
 			return
 		}
 
-		o, err = os.appendCreator.Create(ctx, objectName, srcObject, sr.Mtime, content)
+		o, err = os.create(ctx, os.appendCreator, objectName, srcObject, sr.Mtime, sr.Size-srcSize, content)
 	} else {
-		_, err = content.Seek(0, 0)
-		if err != nil {
-			err = fmt.Errorf("Seek: %w", err)
-			return
-		}
-
-		o, err = os.fullCreator.Create(ctx, objectName, srcObject, sr.Mtime, content)
+		o, err = os.createFull(ctx, objectName, srcObject, sr.Mtime, sr.Size, content)
 	}
 
 	// Deal with errors.
@@ -15,21 +15,64 @@
 package gcsx
 
 import (
+	"context"
+	"syscall"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
 )
 
 type SyncerBucket struct {
 	gcs.Bucket
 	Syncer
+
+	// ReadOnly is set for buckets served read-only, whose Syncer refuses to
+	// write. See NewReadOnlySyncerBucket.
+	ReadOnly bool
 }
 
 // NewSyncerBucket creates a SyncerBucket, which can be used either as
-// a gcs.Bucket, or as a Syncer.
+// a gcs.Bucket, or as a Syncer whose behaviour cfg configures.
 func NewSyncerBucket(
-	appendThreshold int64,
-	tmpObjectPrefix string,
+	cfg SyncerConfig,
 	bucket gcs.Bucket,
 ) SyncerBucket {
-	syncer := NewSyncer(appendThreshold, tmpObjectPrefix, bucket)
-	return SyncerBucket{bucket, syncer}
+	syncer := NewSyncer(cfg, bucket)
+	return SyncerBucket{Bucket: bucket, Syncer: syncer}
+}
+
+// NewReadOnlySyncerBucket creates a SyncerBucket for a bucket served
+// read-only, e.g. because its retention policy is locked. Its Syncer fails
+// with EROFS rather than write.
+func NewReadOnlySyncerBucket(bucket gcs.Bucket) SyncerBucket {
+	return SyncerBucket{Bucket: bucket, Syncer: readOnlySyncer{}, ReadOnly: true}
+}
+
+type readOnlySyncer struct{}
+
+func (readOnlySyncer) SyncObject(
+	ctx context.Context,
+	fileName string,
+	srcObject *gcs.Object,
+	content TempFile) (*gcs.Object, error) {
+	return nil, syscall.EROFS
+}
+
+func (readOnlySyncer) AwaitWriteSlot(ctx context.Context, objectName string) bool {
+	return false
+}
+
+// RetentionLocked reports whether the retention policy of the bucket is
+// locked. Its objects then can't be replaced or deleted until they are old
+// enough, for years in archive buckets, so gcsfuse serves it read-only.
+// Buckets whose policy can't be read, e.g. for lack of the
+// storage.buckets.get permission, are assumed not to be locked.
+func RetentionLocked(ctx context.Context, bucket gcs.Bucket) bool {
+	policy, err := bucket.GetRetentionPolicy(ctx)
+	if err != nil {
+		logger.Debugf("Cannot get the retention policy of bucket %s, assuming it's writable: %v", bucket.Name(), err)
+		return false
+	}
+
+	return policy != nil && policy.Locked
 }
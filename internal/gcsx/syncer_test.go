@@ -15,9 +15,12 @@
 package gcsx
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
 	"io"
 	"io/ioutil"
+	"log/slog"
 	"strings"
 	"testing"
 	"time"
@@ -25,6 +28,7 @@ import (
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
 	. "github.com/jacobsa/oglematchers"
 	. "github.com/jacobsa/oglemock"
 	. "github.com/jacobsa/ogletest"
@@ -590,3 +594,83 @@ func (t *SyncerTest) AppendCreatorSucceeds() {
 	AssertEq(nil, err)
 	ExpectEq(t.appendCreator.o, o)
 }
+
+func (t *SyncerTest) LogsUploadProgress() {
+	var err error
+	t.fullCreator.o = &gcs.Object{Generation: 17}
+	t.fullCreator.err = nil
+
+	// Log the progress of the upload as json into a buffer.
+	var buf bytes.Buffer
+	s := t.syncer.(*syncer)
+	s.progressInterval = 100
+	s.progressLogger = slog.New(slog.NewJSONHandler(&buf, nil))
+
+	// Grow the content, dirtying the source object's contents.
+	const size = 2000
+	err = t.content.Truncate(size)
+	AssertEq(nil, err)
+	_, err = t.content.WriteAt([]byte("a"), 0)
+	AssertEq(nil, err)
+
+	// Call
+	ctx := storageutil.WithOpMetadata(t.ctx, storageutil.OpMetadata{Op: "FlushFile", ID: 23})
+	_, err = t.syncer.SyncObject(ctx, t.srcObject.Name, t.srcObject, t.content)
+	AssertEq(nil, err)
+
+	// There should be a record for each read that crossed another interval,
+	// followed by a final one carrying the new generation.
+	type record struct {
+		Msg        string `json:"msg"`
+		Object     string `json:"object"`
+		BytesSent  int64  `json:"bytes_sent"`
+		TotalBytes int64  `json:"total_bytes"`
+		Op         string `json:"op"`
+		OpID       uint64 `json:"op_id"`
+		Generation int64  `json:"generation"`
+	}
+
+	var records []record
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var r record
+		AssertEq(nil, dec.Decode(&r))
+		records = append(records, r)
+	}
+
+	AssertGt(len(records), 2)
+	var prev int64
+	for _, r := range records[:len(records)-1] {
+		ExpectEq("Upload progress", r.Msg)
+		ExpectEq(t.srcObject.Name, r.Object)
+		ExpectGt(r.BytesSent, prev)
+		ExpectEq(size, r.TotalBytes)
+		ExpectEq("FlushFile", r.Op)
+		ExpectEq(23, r.OpID)
+		prev = r.BytesSent
+	}
+
+	last := records[len(records)-1]
+	ExpectEq("Upload finished", last.Msg)
+	ExpectEq(size, last.BytesSent)
+	ExpectEq(17, last.Generation)
+}
+
+func (t *SyncerTest) DoesNotLogUploadProgressOnFailure() {
+	var err error
+
+	var buf bytes.Buffer
+	s := t.syncer.(*syncer)
+	s.progressInterval = 1 << 20
+	s.progressLogger = slog.New(slog.NewJSONHandler(&buf, nil))
+
+	// Truncate downward.
+	err = t.content.Truncate(2)
+	AssertEq(nil, err)
+
+	// Call
+	_, err = t.call()
+
+	ExpectNe(nil, err)
+	ExpectEq("", buf.String())
+}
@@ -18,7 +18,9 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"os"
 	"strings"
+	"syscall"
 	"testing"
 	"time"
 
@@ -151,6 +153,31 @@ func (t *TempFileTest) SetUp(ti *TestInfo) {
 	AssertEq(nil, err)
 }
 
+// newFileBackedTempFile returns a temp file with the initial content, staged
+// in the returned file, whose disk usage can then be checked.
+func (t *TempFileTest) newFileBackedTempFile() (*os.File, gcsx.TempFile) {
+	f, err := os.CreateTemp("", "temp_file_test")
+	AssertEq(nil, err)
+	AssertEq(nil, os.Remove(f.Name()))
+
+	tf := gcsx.NewCacheFile(
+		dummyReadCloser{strings.NewReader(initialContent)},
+		f,
+		"",
+		&t.clock)
+
+	return f, tf
+}
+
+// diskUsage returns the space in bytes that the content of f takes on disk.
+func diskUsage(f *os.File) int64 {
+	fi, err := f.Stat()
+	AssertEq(nil, err)
+
+	// Blocks are counted in units of 512 bytes, whatever the block size.
+	return fi.Sys().(*syscall.Stat_t).Blocks * 512
+}
+
 ////////////////////////////////////////////////////////////////////////
 // Tests
 ////////////////////////////////////////////////////////////////////////
@@ -237,6 +264,49 @@ func (t *TempFileTest) Truncate() {
 	ExpectEq(expected, string(actual))
 }
 
+func (t *TempFileTest) WriteAt_FarBeyondEnd() {
+	const offset = 10 << 30
+	f, tf := t.newFileBackedTempFile()
+	defer tf.Destroy()
+
+	// Call
+	n, err := tf.WriteAt([]byte("enchilada"), offset)
+
+	ExpectEq(9, n)
+	ExpectEq(nil, err)
+
+	// The skipped range takes no disk.
+	sr, err := tf.Stat()
+
+	AssertEq(nil, err)
+	ExpectEq(offset+9, sr.Size)
+	ExpectEq(initialContentSize, sr.DirtyThreshold)
+	ExpectLt(diskUsage(f), 1<<20)
+
+	// It reads back as zeros.
+	var buf [4]byte
+	_, err = tf.ReadAt(buf[:], offset-2)
+	AssertEq(nil, err)
+	ExpectEq("\x00\x00en", string(buf[:]))
+}
+
+func (t *TempFileTest) Truncate_Upward() {
+	const size = 10 << 30
+	f, tf := t.newFileBackedTempFile()
+	defer tf.Destroy()
+
+	// Call
+	err := tf.Truncate(size)
+	ExpectEq(nil, err)
+
+	// The added range takes no disk.
+	sr, err := tf.Stat()
+
+	AssertEq(nil, err)
+	ExpectEq(size, sr.Size)
+	ExpectLt(diskUsage(f), 1<<20)
+}
+
 func (t *TempFileTest) SetMtime() {
 	mtime := time.Date(2015, 4, 5, 2, 15, 0, 0, time.Local)
 	AssertThat(mtime, Not(timeutil.TimeEq(t.clock.Now())))
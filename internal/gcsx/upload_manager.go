@@ -0,0 +1,101 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcsx
+
+import (
+	"context"
+	"sync"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/monitor"
+)
+
+// UploadManager runs uploads in the background, at most a fixed number at a
+// time, so that closing many written files doesn't serialize their uploads.
+// Uploads are identified by a key, typically the name of the file. Errors
+// are kept per key until the caller collects them with TakeError.
+type UploadManager struct {
+	// Acquired by each running upload; its capacity bounds the parallelism.
+	sem chan struct{}
+
+	// Outstanding uploads, queued or running.
+	wg sync.WaitGroup
+
+	mu sync.Mutex
+
+	// The error of the last failed upload for each key, until taken.
+	//
+	// GUARDED_BY(mu)
+	errs map[string]error
+}
+
+// NewUploadManager creates an UploadManager running at most maxParallel
+// uploads at a time.
+//
+// REQUIRES: maxParallel > 0
+func NewUploadManager(maxParallel int) *UploadManager {
+	return &UploadManager{
+		sem:  make(chan struct{}, maxParallel),
+		errs: make(map[string]error),
+	}
+}
+
+// Enqueue schedules upload to run in the background under the given key. It
+// never blocks.
+func (um *UploadManager) Enqueue(key string, upload func(ctx context.Context) error) {
+	um.wg.Add(1)
+	go um.run(key, upload)
+}
+
+func (um *UploadManager) run(key string, upload func(ctx context.Context) error) {
+	defer um.wg.Done()
+
+	um.sem <- struct{}{}
+	defer func() { <-um.sem }()
+
+	// The operation that queued the upload has long returned, so its context
+	// can't be used.
+	ctx := context.Background()
+	err := upload(ctx)
+	monitor.CaptureBackgroundUploadMetrics(ctx, err)
+
+	um.mu.Lock()
+	defer um.mu.Unlock()
+
+	// A later successful upload supersedes an earlier failure.
+	if err == nil {
+		delete(um.errs, key)
+		return
+	}
+
+	logger.Errorf("Background upload of %q failed: %v", key, err)
+	um.errs[key] = err
+}
+
+// TakeError returns the error of the last failed background upload for the
+// given key, if any, and forgets it.
+func (um *UploadManager) TakeError(key string) (err error) {
+	um.mu.Lock()
+	defer um.mu.Unlock()
+
+	err = um.errs[key]
+	delete(um.errs, key)
+	return
+}
+
+// Drain waits until all uploads queued so far have finished.
+func (um *UploadManager) Drain() {
+	um.wg.Wait()
+}
@@ -0,0 +1,135 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcsx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/jacobsa/ogletest"
+)
+
+func TestUploadManager(t *testing.T) { RunTests(t) }
+
+////////////////////////////////////////////////////////////////////////
+// Boilerplate
+////////////////////////////////////////////////////////////////////////
+
+const maxParallelUploads = 4
+
+type UploadManagerTest struct {
+	um *UploadManager
+
+	mu sync.Mutex
+
+	// GUARDED_BY(mu)
+	running    int
+	maxRunning int
+	done       int
+}
+
+func init() { RegisterTestSuite(&UploadManagerTest{}) }
+
+func (t *UploadManagerTest) SetUp(_ *TestInfo) {
+	t.um = NewUploadManager(maxParallelUploads)
+}
+
+// An upload that tracks how many uploads run concurrently and returns err.
+func (t *UploadManagerTest) upload(err error) func(context.Context) error {
+	return func(context.Context) error {
+		t.mu.Lock()
+		t.running++
+		if t.running > t.maxRunning {
+			t.maxRunning = t.running
+		}
+		t.mu.Unlock()
+
+		time.Sleep(5 * time.Millisecond)
+
+		t.mu.Lock()
+		t.running--
+		t.done++
+		t.mu.Unlock()
+
+		return err
+	}
+}
+
+////////////////////////////////////////////////////////////////////////
+// Tests
+////////////////////////////////////////////////////////////////////////
+
+func (t *UploadManagerTest) RunsUploadsInParallelUpToTheLimit() {
+	const n = 50
+	for i := 0; i < n; i++ {
+		t.um.Enqueue(fmt.Sprintf("file%d", i), t.upload(nil))
+	}
+
+	t.um.Drain()
+
+	ExpectEq(n, t.done)
+	ExpectEq(0, t.running)
+	ExpectGt(t.maxRunning, 1)
+	ExpectLe(t.maxRunning, maxParallelUploads)
+}
+
+func (t *UploadManagerTest) DrainWaitsForQueuedUploads() {
+	release := make(chan struct{})
+	t.um.Enqueue("foo", func(context.Context) error {
+		<-release
+		return nil
+	})
+
+	drained := make(chan struct{})
+	go func() {
+		t.um.Drain()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		AddFailure("Drain returned while an upload was running")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(release)
+	<-drained
+}
+
+func (t *UploadManagerTest) ErrorIsKeptPerKeyUntilTaken() {
+	uploadErr := errors.New("taco")
+	t.um.Enqueue("foo", t.upload(uploadErr))
+	t.um.Enqueue("bar", t.upload(nil))
+	t.um.Drain()
+
+	ExpectEq(nil, t.um.TakeError("bar"))
+	ExpectEq(uploadErr, t.um.TakeError("foo"))
+
+	// The error is only reported once.
+	ExpectEq(nil, t.um.TakeError("foo"))
+}
+
+func (t *UploadManagerTest) SuccessfulUploadClearsEarlierError() {
+	t.um.Enqueue("foo", t.upload(errors.New("taco")))
+	t.um.Drain()
+	t.um.Enqueue("foo", t.upload(nil))
+	t.um.Drain()
+
+	ExpectEq(nil, t.um.TakeError("foo"))
+}
@@ -0,0 +1,93 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcsx
+
+import (
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	"golang.org/x/net/context"
+)
+
+// UploadProgressComponent is the component name carried by the records of the
+// progress of uploads.
+const UploadProgressComponent = "upload_progress"
+
+// uploadProgressReader wraps the contents of an upload, logging a record each
+// time another interval bytes have been read from it.
+type uploadProgressReader struct {
+	r        io.Reader
+	logger   *slog.Logger
+	attrs    []any
+	total    int64
+	interval int64
+	start    time.Time
+
+	// The number of bytes read so far, and the offset at which the next record
+	// is due.
+	sent int64
+	next int64
+}
+
+func newUploadProgressReader(
+	ctx context.Context,
+	logger *slog.Logger,
+	objectName string,
+	total int64,
+	interval int64,
+	r io.Reader) *uploadProgressReader {
+	attrs := []any{"object", objectName}
+	if md, ok := storageutil.OpMetadataFrom(ctx); ok {
+		attrs = append(attrs, "op", md.Op, "op_id", md.ID)
+	}
+
+	return &uploadProgressReader{
+		r:        r,
+		logger:   logger,
+		attrs:    attrs,
+		total:    total,
+		interval: interval,
+		start:    time.Now(),
+		next:     interval,
+	}
+}
+
+func (pr *uploadProgressReader) Read(p []byte) (n int, err error) {
+	n, err = pr.r.Read(p)
+	pr.sent += int64(n)
+	if pr.sent >= pr.next {
+		pr.log("Upload progress")
+		// Skip the offsets already passed by a large read.
+		pr.next = (pr.sent/pr.interval + 1) * pr.interval
+	}
+
+	return
+}
+
+// finish logs the final record of an upload that created the given object.
+func (pr *uploadProgressReader) finish(o *gcs.Object) {
+	pr.log("Upload finished", "generation", o.Generation)
+}
+
+func (pr *uploadProgressReader) log(msg string, args ...any) {
+	attrs := append(append([]any{}, pr.attrs...),
+		"bytes_sent", pr.sent,
+		"total_bytes", pr.total,
+		"elapsed", time.Since(pr.start).String())
+	pr.logger.Info(msg, append(attrs, args...)...)
+}
@@ -0,0 +1,114 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcsx
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/monitor"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/util"
+	"github.com/jacobsa/timeutil"
+)
+
+const (
+	// GCS sustains about one write per second to the same object name, and
+	// answers faster rewrites with 429s.
+	perObjectWriteInterval = time.Second
+
+	// Once this many names are tracked, those whose slot has passed are
+	// forgotten.
+	writePacerSweepSize = 1024
+)
+
+// writePacer spaces out the writes of each object name by
+// perObjectWriteInterval, delaying a write by at most maxDelay. A write that
+// would need a longer delay goes ahead after maxDelay, and takes its chances.
+type writePacer struct {
+	maxDelay time.Duration
+	clock    timeutil.Clock
+
+	// Waits for the given duration, or until the context is done.
+	sleep func(ctx context.Context, d time.Duration) error
+
+	mu sync.Mutex
+
+	// The earliest time at which each object name may be written next.
+	//
+	// GUARDED_BY(mu)
+	next map[string]time.Time
+}
+
+func newWritePacer(maxDelay time.Duration) *writePacer {
+	return &writePacer{
+		maxDelay: maxDelay,
+		clock:    timeutil.RealClock(),
+		sleep:    util.SleepContext,
+		next:     make(map[string]time.Time),
+	}
+}
+
+// Return how long a write of the name starting now would have to wait.
+//
+// LOCKS_REQUIRED(p.mu)
+func (p *writePacer) delayLocked(name string, now time.Time) time.Duration {
+	delay := p.next[name].Sub(now)
+	return max(0, min(delay, p.maxDelay))
+}
+
+// reserve waits for the next slot for writing the name and takes it, so that
+// the following write of the name waits for perObjectWriteInterval more. It
+// reports whether it had to wait.
+//
+// LOCKS_EXCLUDED(p.mu)
+func (p *writePacer) reserve(ctx context.Context, name string) (delayed bool, err error) {
+	p.mu.Lock()
+	now := p.clock.Now()
+	delay := p.delayLocked(name, now)
+	if len(p.next) >= writePacerSweepSize {
+		for n, t := range p.next {
+			if !t.After(now) {
+				delete(p.next, n)
+			}
+		}
+	}
+	p.next[name] = now.Add(delay + perObjectWriteInterval)
+	p.mu.Unlock()
+
+	return p.wait(ctx, delay)
+}
+
+// await waits for the next slot for writing the name, without taking it. It
+// reports whether it had to wait.
+//
+// LOCKS_EXCLUDED(p.mu)
+func (p *writePacer) await(ctx context.Context, name string) (delayed bool) {
+	p.mu.Lock()
+	delay := p.delayLocked(name, p.clock.Now())
+	p.mu.Unlock()
+
+	delayed, _ = p.wait(ctx, delay)
+	return
+}
+
+func (p *writePacer) wait(ctx context.Context, delay time.Duration) (delayed bool, err error) {
+	if delay <= 0 {
+		return false, nil
+	}
+
+	monitor.CaptureWritePacingMetrics(ctx, monitor.WriteDelayed)
+	return true, p.sleep(ctx, delay)
+}
@@ -0,0 +1,178 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcsx
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	. "github.com/jacobsa/ogletest"
+	"github.com/jacobsa/timeutil"
+	"golang.org/x/net/context"
+)
+
+func TestWritePacer(t *testing.T) { RunTests(t) }
+
+////////////////////////////////////////////////////////////////////////
+// Boilerplate
+////////////////////////////////////////////////////////////////////////
+
+// createTimingBucket records when each object creation happens.
+type createTimingBucket struct {
+	gcs.Bucket
+	clock   timeutil.Clock
+	creates []time.Time
+}
+
+func (b *createTimingBucket) CreateObject(
+	ctx context.Context,
+	req *gcs.CreateObjectRequest) (*gcs.Object, error) {
+	b.creates = append(b.creates, b.clock.Now())
+	return b.Bucket.CreateObject(ctx, req)
+}
+
+type WritePacerTest struct {
+	ctx    context.Context
+	clock  timeutil.SimulatedClock
+	bucket *createTimingBucket
+	syncer *syncer
+
+	// The waits of the pacer, which advance the clock instead of sleeping.
+	sleeps []time.Duration
+}
+
+func init() { RegisterTestSuite(&WritePacerTest{}) }
+
+func (t *WritePacerTest) SetUp(ti *TestInfo) {
+	t.ctx = ti.Ctx
+	t.clock.SetTime(time.Date(2024, 6, 1, 12, 0, 0, 0, time.Local))
+	t.bucket = &createTimingBucket{
+		Bucket: fake.NewFakeBucket(&t.clock, "some_bucket"),
+		clock:  &t.clock,
+	}
+	t.resetSyncer(2 * time.Second)
+}
+
+func (t *WritePacerTest) resetSyncer(maxDelay time.Duration) {
+	t.syncer = NewSyncer(SyncerConfig{AppendThreshold: 1, PerObjectWriteDelayMax: maxDelay, TmpObjectPrefix: ".gcsfuse_tmp/"}, t.bucket).(*syncer)
+	if t.syncer.pacer != nil {
+		t.syncer.pacer.clock = &t.clock
+		t.syncer.pacer.sleep = func(ctx context.Context, d time.Duration) error {
+			t.sleeps = append(t.sleeps, d)
+			t.clock.AdvanceTime(d)
+			return nil
+		}
+	}
+}
+
+// Replace the contents of the object, which must be src if non-nil, the way
+// a flush would, returning the new generation.
+func (t *WritePacerTest) write(name string, src *gcs.Object, contents string) *gcs.Object {
+	var srcContents string
+	if src != nil {
+		b, err := storageutil.ReadObject(t.ctx, t.bucket, name)
+		AssertEq(nil, err)
+		srcContents = string(b)
+	}
+
+	content, err := NewTempFile(dummyReadCloser{strings.NewReader(srcContents)}, "", &t.clock)
+	AssertEq(nil, err)
+	defer content.Destroy()
+
+	AssertEq(nil, content.Truncate(0))
+	_, err = content.WriteAt([]byte(contents), 0)
+	AssertEq(nil, err)
+
+	o, err := t.syncer.SyncObject(t.ctx, name, src, content)
+	AssertEq(nil, err)
+	AssertNe(nil, o)
+	return o
+}
+
+////////////////////////////////////////////////////////////////////////
+// Tests
+////////////////////////////////////////////////////////////////////////
+
+func (t *WritePacerTest) SpacesRewritesOfTheSameObject() {
+	// Rewrite a marker file 10 times in a second.
+	var o *gcs.Object
+	for i := 0; i < 10; i++ {
+		o = t.write("marker", o, fmt.Sprintf("v%d", i))
+		t.clock.AdvanceTime(100 * time.Millisecond)
+	}
+
+	// The creations are a second apart, and the last one won.
+	AssertEq(10, len(t.bucket.creates))
+	for i := 1; i < len(t.bucket.creates); i++ {
+		ExpectGe(t.bucket.creates[i].Sub(t.bucket.creates[i-1]), perObjectWriteInterval, "create %d", i)
+	}
+	ExpectEq(9, len(t.sleeps))
+
+	contents, err := storageutil.ReadObject(t.ctx, t.bucket, "marker")
+	AssertEq(nil, err)
+	ExpectEq("v9", string(contents))
+}
+
+func (t *WritePacerTest) DelayIsBounded() {
+	t.resetSyncer(200 * time.Millisecond)
+
+	o := t.write("marker", nil, "v0")
+	t.write("marker", o, "v1")
+
+	AssertEq(2, len(t.bucket.creates))
+	ExpectEq(200*time.Millisecond, t.bucket.creates[1].Sub(t.bucket.creates[0]))
+}
+
+func (t *WritePacerTest) OtherObjectsAreNotDelayed() {
+	t.write("foo", nil, "taco")
+	t.write("bar", nil, "burrito")
+
+	ExpectEq(0, len(t.sleeps))
+	AssertEq(2, len(t.bucket.creates))
+	ExpectThat(t.bucket.creates[1], timeutil.TimeEq(t.bucket.creates[0]))
+}
+
+func (t *WritePacerTest) AwaitWriteSlotDoesNotTakeIt() {
+	o := t.write("marker", nil, "v0")
+	t.clock.AdvanceTime(100 * time.Millisecond)
+
+	// Waiting for the slot lets flushes queued meanwhile be coalesced into the
+	// write that takes it, which then doesn't wait again.
+	ExpectTrue(t.syncer.AwaitWriteSlot(t.ctx, "marker"))
+	ExpectFalse(t.syncer.AwaitWriteSlot(t.ctx, "marker"))
+	t.write("marker", o, "v1")
+
+	AssertEq(1, len(t.sleeps))
+	ExpectEq(900*time.Millisecond, t.sleeps[0])
+	AssertEq(2, len(t.bucket.creates))
+	ExpectEq(perObjectWriteInterval, t.bucket.creates[1].Sub(t.bucket.creates[0]))
+}
+
+func (t *WritePacerTest) Disabled() {
+	t.resetSyncer(0)
+
+	o := t.write("marker", nil, "v0")
+	ExpectFalse(t.syncer.AwaitWriteSlot(t.ctx, "marker"))
+	t.write("marker", o, "v1")
+
+	ExpectEq(0, len(t.sleeps))
+	AssertEq(2, len(t.bucket.creates))
+	ExpectThat(t.bucket.creates[1], timeutil.TimeEq(t.bucket.creates[0]))
+}
@@ -0,0 +1,121 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcsx
+
+import (
+	"encoding/json"
+	"math"
+	"sort"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+)
+
+// ZeroExtentsMetadataKey is the custom metadata key under which an upload
+// tool may describe the ranges of an object known to hold only zeros, as json:
+//
+//	{"generation": 1234, "extents": [[offset, length], ...]}
+//
+// The hint is only used if generation matches the object's, so that a hint
+// carried over to different contents, e.g. by copying the object, is ignored.
+const ZeroExtentsMetadataKey = "gcsfuse_zero_extents"
+
+type zeroExtentsHint struct {
+	Generation int64      `json:"generation"`
+	Extents    [][2]int64 `json:"extents"`
+}
+
+// zeroExtent is the range [start, limit) of an object that holds only zeros.
+type zeroExtent struct {
+	start int64
+	limit int64
+}
+
+// zeroExtents is a list of disjoint, non-adjacent, non-empty extents sorted
+// by offset.
+type zeroExtents []zeroExtent
+
+// parseZeroExtents returns the zero extents described by the metadata of the
+// given object, clipped to its size. It fails open: if there is no hint, or
+// it is malformed or for another generation, it returns nil and all of the
+// object is read from GCS.
+func parseZeroExtents(o *gcs.MinObject) (ze zeroExtents) {
+	value, ok := o.Metadata[ZeroExtentsMetadataKey]
+	if !ok {
+		return
+	}
+
+	var hint zeroExtentsHint
+	if err := json.Unmarshal([]byte(value), &hint); err != nil {
+		logger.Warnf("Ignoring malformed %s metadata of %q: %v", ZeroExtentsMetadataKey, o.Name, err)
+		return
+	}
+
+	if hint.Generation != o.Generation {
+		logger.Warnf("Ignoring %s metadata of %q for generation %d, the object has generation %d",
+			ZeroExtentsMetadataKey, o.Name, hint.Generation, o.Generation)
+		return
+	}
+
+	size := int64(o.Size)
+	for _, e := range hint.Extents {
+		offset, length := e[0], e[1]
+		if offset < 0 || length < 0 || offset > math.MaxInt64-length {
+			logger.Warnf("Ignoring %s metadata of %q with invalid extent [%d, +%d)",
+				ZeroExtentsMetadataKey, o.Name, offset, length)
+			return nil
+		}
+
+		limit := min(offset+length, size)
+		if offset < limit {
+			ze = append(ze, zeroExtent{start: offset, limit: limit})
+		}
+	}
+
+	// Sort and merge overlapping or adjacent extents.
+	sort.Slice(ze, func(i, j int) bool { return ze[i].start < ze[j].start })
+	merged := ze[:0]
+	for _, e := range ze {
+		if last := len(merged) - 1; last >= 0 && e.start <= merged[last].limit {
+			merged[last].limit = max(merged[last].limit, e.limit)
+			continue
+		}
+		merged = append(merged, e)
+	}
+
+	return merged
+}
+
+// zerosAt returns how many of the n bytes starting at offset are known to be
+// zeros, counting from offset up to the first byte that may not be.
+func (ze zeroExtents) zerosAt(offset int64, n int) int {
+	i := sort.Search(len(ze), func(i int) bool { return ze[i].limit > offset })
+	if i == len(ze) || ze[i].start > offset {
+		return 0
+	}
+
+	return int(min(int64(n), ze[i].limit-offset))
+}
+
+// nextZeroExtent returns the start of the first extent beginning at or after
+// offset, or math.MaxInt64 if there is none.
+func (ze zeroExtents) nextZeroExtent(offset int64) int64 {
+	i := sort.Search(len(ze), func(i int) bool { return ze[i].start >= offset })
+	if i == len(ze) {
+		return math.MaxInt64
+	}
+
+	return ze[i].start
+}
@@ -0,0 +1,244 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcsx
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"testing"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	. "github.com/jacobsa/oglematchers"
+	. "github.com/jacobsa/ogletest"
+	"github.com/jacobsa/timeutil"
+	"golang.org/x/net/context"
+)
+
+func TestZeroExtents(t *testing.T) { RunTests(t) }
+
+////////////////////////////////////////////////////////////////////////
+// Boilerplate
+////////////////////////////////////////////////////////////////////////
+
+const zeroExtentsObjectSize = 100
+
+// rangeRecordingBucket records the ranges of the reads it serves.
+type rangeRecordingBucket struct {
+	gcs.Bucket
+	ranges []gcs.ByteRange
+}
+
+func (b *rangeRecordingBucket) NewReader(
+	ctx context.Context,
+	req *gcs.ReadObjectRequest) (io.ReadCloser, error) {
+	b.ranges = append(b.ranges, *req.Range)
+	return b.Bucket.NewReader(ctx, req)
+}
+
+type ZeroExtentsTest struct {
+	ctx      context.Context
+	bucket   *rangeRecordingBucket
+	object   *gcs.MinObject
+	contents []byte
+}
+
+func init() { RegisterTestSuite(&ZeroExtentsTest{}) }
+
+func (t *ZeroExtentsTest) SetUp(ti *TestInfo) {
+	t.ctx = ti.Ctx
+	t.bucket = &rangeRecordingBucket{
+		Bucket: fake.NewFakeBucket(timeutil.RealClock(), "some_bucket"),
+	}
+
+	// Non-zero contents, except for [10, 30) and [60, 100).
+	t.contents = bytes.Repeat([]byte("x"), zeroExtentsObjectSize)
+	copy(t.contents[10:30], make([]byte, 20))
+	copy(t.contents[60:], make([]byte, 40))
+
+	o, err := storageutil.CreateObject(t.ctx, t.bucket, "foo", t.contents)
+	AssertEq(nil, err)
+	t.object = storageutil.ConvertObjToMinObject(o)
+}
+
+// Set the hint of the object under test, for its current generation.
+func (t *ZeroExtentsTest) setHint(extents string) {
+	t.object.Metadata = map[string]string{
+		ZeroExtentsMetadataKey: fmt.Sprintf(`{"generation": %d, "extents": %s}`, t.object.Generation, extents),
+	}
+}
+
+func (t *ZeroExtentsTest) newReader(zeroExtentHints bool) RandomReader {
+	return NewRandomReader(t.object, t.bucket, 1, nil, false, zeroExtentHints, false)
+}
+
+func (t *ZeroExtentsTest) readAt(rr RandomReader, offset int64, size int) []byte {
+	p := make([]byte, size)
+	n, _, err := rr.ReadAt(t.ctx, p, offset)
+	if err != io.EOF {
+		AssertEq(nil, err)
+	}
+	return p[:n]
+}
+
+////////////////////////////////////////////////////////////////////////
+// Tests
+////////////////////////////////////////////////////////////////////////
+
+func (t *ZeroExtentsTest) Parse_NoHint() {
+	ExpectEq(0, len(parseZeroExtents(t.object)))
+}
+
+func (t *ZeroExtentsTest) Parse_MergesSortsAndClips() {
+	t.setHint(`[[60, 1000], [20, 10], [10, 15], [40, 0], [200, 5]]`)
+
+	ze := parseZeroExtents(t.object)
+
+	AssertEq(2, len(ze))
+	ExpectThat(ze[0], DeepEquals(zeroExtent{start: 10, limit: 30}))
+	ExpectThat(ze[1], DeepEquals(zeroExtent{start: 60, limit: zeroExtentsObjectSize}))
+}
+
+func (t *ZeroExtentsTest) Parse_AdjacentExtentsAreMerged() {
+	t.setHint(`[[10, 10], [20, 10]]`)
+
+	ze := parseZeroExtents(t.object)
+
+	AssertEq(1, len(ze))
+	ExpectThat(ze[0], DeepEquals(zeroExtent{start: 10, limit: 30}))
+}
+
+func (t *ZeroExtentsTest) Parse_Malformed() {
+	for _, value := range []string{
+		`not json`,
+		`{"generation": "1", "extents": []}`,
+		`{"generation": %d, "extents": [[1]]}`,
+		`{"generation": %d, "extents": [[10, -1]]}`,
+		`{"generation": %d, "extents": [[-10, 20]]}`,
+		fmt.Sprintf(`{"generation": %%d, "extents": [[1, %d]]}`, int64(math.MaxInt64)),
+	} {
+		t.object.Metadata = map[string]string{
+			ZeroExtentsMetadataKey: fmt.Sprintf(value, t.object.Generation),
+		}
+		ExpectEq(0, len(parseZeroExtents(t.object)), "%s", value)
+	}
+}
+
+func (t *ZeroExtentsTest) Parse_OtherGeneration() {
+	t.object.Metadata = map[string]string{
+		ZeroExtentsMetadataKey: fmt.Sprintf(`{"generation": %d, "extents": [[0, 10]]}`, t.object.Generation+1),
+	}
+
+	ExpectEq(0, len(parseZeroExtents(t.object)))
+}
+
+func (t *ZeroExtentsTest) ZerosAt() {
+	ze := zeroExtents{{start: 10, limit: 30}, {start: 60, limit: 100}}
+
+	ExpectEq(0, ze.zerosAt(0, 50))
+	ExpectEq(0, ze.zerosAt(9, 50))
+	ExpectEq(20, ze.zerosAt(10, 50))
+	ExpectEq(5, ze.zerosAt(10, 5))
+	ExpectEq(1, ze.zerosAt(29, 50))
+	ExpectEq(0, ze.zerosAt(30, 50))
+	ExpectEq(40, ze.zerosAt(60, 50))
+	ExpectEq(0, ze.zerosAt(100, 50))
+}
+
+func (t *ZeroExtentsTest) NextZeroExtent() {
+	ze := zeroExtents{{start: 10, limit: 30}, {start: 60, limit: 100}}
+
+	ExpectEq(10, ze.nextZeroExtent(0))
+	ExpectEq(10, ze.nextZeroExtent(10))
+	ExpectEq(60, ze.nextZeroExtent(11))
+	ExpectEq(int64(math.MaxInt64), ze.nextZeroExtent(61))
+}
+
+func (t *ZeroExtentsTest) ReadWholeObject() {
+	t.setHint(`[[10, 20], [60, 40]]`)
+	rr := t.newReader(true)
+	defer rr.Destroy()
+
+	ExpectTrue(bytes.Equal(t.contents, t.readAt(rr, 0, zeroExtentsObjectSize)))
+
+	// Only the data between the extents was read from GCS.
+	AssertEq(2, len(t.bucket.ranges))
+	ExpectThat(t.bucket.ranges[0], DeepEquals(gcs.ByteRange{Start: 0, Limit: 10}))
+	ExpectThat(t.bucket.ranges[1], DeepEquals(gcs.ByteRange{Start: 30, Limit: 60}))
+}
+
+func (t *ZeroExtentsTest) ReadOverlappingStartOfExtent() {
+	t.setHint(`[[10, 20], [60, 40]]`)
+	rr := t.newReader(true)
+	defer rr.Destroy()
+
+	ExpectTrue(bytes.Equal(t.contents[5:20], t.readAt(rr, 5, 15)))
+
+	AssertEq(1, len(t.bucket.ranges))
+	ExpectThat(t.bucket.ranges[0], DeepEquals(gcs.ByteRange{Start: 5, Limit: 10}))
+}
+
+func (t *ZeroExtentsTest) ReadOverlappingEndOfExtent() {
+	t.setHint(`[[10, 20], [60, 40]]`)
+	rr := t.newReader(true)
+	defer rr.Destroy()
+
+	ExpectTrue(bytes.Equal(t.contents[20:40], t.readAt(rr, 20, 20)))
+
+	AssertEq(1, len(t.bucket.ranges))
+	ExpectEq(30, t.bucket.ranges[0].Start)
+}
+
+func (t *ZeroExtentsTest) ReadWithinExtentToEOF() {
+	t.setHint(`[[10, 20], [60, 40]]`)
+	rr := t.newReader(true)
+	defer rr.Destroy()
+
+	p := make([]byte, 50)
+	for i := range p {
+		p[i] = 'y'
+	}
+	n, _, err := rr.ReadAt(t.ctx, p, 70)
+
+	ExpectEq(io.EOF, err)
+	AssertEq(30, n)
+	ExpectTrue(bytes.Equal(make([]byte, 30), p[:n]))
+	ExpectEq(0, len(t.bucket.ranges))
+}
+
+func (t *ZeroExtentsTest) HintsDisabled() {
+	t.setHint(`[[10, 20], [60, 40]]`)
+	rr := t.newReader(false)
+	defer rr.Destroy()
+
+	ExpectTrue(bytes.Equal(t.contents, t.readAt(rr, 0, zeroExtentsObjectSize)))
+
+	AssertEq(1, len(t.bucket.ranges))
+	ExpectThat(t.bucket.ranges[0], DeepEquals(gcs.ByteRange{Start: 0, Limit: zeroExtentsObjectSize}))
+}
+
+func (t *ZeroExtentsTest) MalformedHintFailsOpen() {
+	t.object.Metadata = map[string]string{ZeroExtentsMetadataKey: "[[10, 20]"}
+	rr := t.newReader(true)
+	defer rr.Destroy()
+
+	ExpectTrue(bytes.Equal(t.contents, t.readAt(rr, 0, zeroExtentsObjectSize)))
+
+	AssertEq(1, len(t.bucket.ranges))
+	ExpectThat(t.bucket.ranges[0], DeepEquals(gcs.ByteRange{Start: 0, Limit: zeroExtentsObjectSize}))
+}
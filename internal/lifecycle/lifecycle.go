@@ -0,0 +1,143 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package lifecycle publishes the stages of a mount as events, so that
+// whoever starts gcsfuse can tell when the mount is ready without scraping
+// the logs.
+package lifecycle
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
+	"github.com/jacobsa/timeutil"
+)
+
+// The events of a mount, in the order they're published. Creating the client
+// and probing the bucket are published again for each retried attempt, and
+// the bucket isn't probed for dynamic mounts. Ready ends every attempt to
+// mount, with the error if the mount failed. Draining is only published when
+// gcsfuse unmounts in response to SIGINT.
+//
+// A lazy mount is ready before creating the client and probing the bucket,
+// which the first operation does, and then publishes Initialized with the
+// outcome.
+const (
+	ConfigParsed  = "config-parsed"
+	ClientCreated = "client-created"
+	BucketProbed  = "bucket-probed"
+	Mounted       = "mounted"
+	Ready         = "ready"
+	Initialized   = "initialized"
+	Draining      = "draining"
+	Unmounted     = "unmounted"
+)
+
+// Event is a stage of the mount that has been reached, or has failed.
+type Event struct {
+	Name string    `json:"event"`
+	Time time.Time `json:"time"`
+
+	// Empty unless the stage failed.
+	Error string `json:"error"`
+}
+
+type subscriber struct {
+	id int
+	f  func(Event)
+}
+
+// Bus delivers published events to its subscribers, one at a time and in the
+// order they were published.
+type Bus struct {
+	clock timeutil.Clock
+
+	mu          sync.Mutex
+	nextID      int
+	subscribers []subscriber
+}
+
+// NewBus returns a bus that timestamps events with the given clock.
+func NewBus(clock timeutil.Clock) *Bus {
+	return &Bus{clock: clock}
+}
+
+// Subscribe calls f with every event published from now on, until the
+// returned function is called. f must not publish.
+//
+// LOCKS_EXCLUDED(b.mu)
+func (b *Bus) Subscribe(f func(Event)) (unsubscribe func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	id := b.nextID
+	b.nextID++
+	b.subscribers = append(b.subscribers, subscriber{id: id, f: f})
+
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		for i, s := range b.subscribers {
+			if s.id == id {
+				b.subscribers = append(b.subscribers[:i:i], b.subscribers[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// Publish notes that the stage with the given name has been reached, or has
+// failed with err.
+//
+// LOCKS_EXCLUDED(b.mu)
+func (b *Bus) Publish(name string, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	e := Event{Name: name, Time: b.clock.Now().UTC()}
+	if err != nil {
+		e.Error = err.Error()
+	}
+
+	for _, s := range b.subscribers {
+		s.f(e)
+	}
+}
+
+var defaultBus = NewBus(timeutil.RealClock())
+
+// Subscribe subscribes f to the events of this process's mount.
+func Subscribe(f func(Event)) (unsubscribe func()) {
+	return defaultBus.Subscribe(f)
+}
+
+// Publish publishes an event of this process's mount.
+func Publish(name string, err error) {
+	defaultBus.Publish(name, err)
+}
+
+// JSONLines returns a subscriber that writes each event to w as a JSON object
+// on a line of its own.
+func JSONLines(w io.Writer) func(Event) {
+	enc := json.NewEncoder(w)
+	return func(e Event) {
+		if err := enc.Encode(e); err != nil {
+			logger.Warnf("Failed to write lifecycle event %q: %v", e.Name, err)
+		}
+	}
+}
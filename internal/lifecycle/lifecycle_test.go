@@ -0,0 +1,83 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lifecycle
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jacobsa/timeutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var someTime = time.Date(2024, 6, 1, 12, 30, 0, 0, time.UTC)
+
+func newTestBus() *Bus {
+	clock := &timeutil.SimulatedClock{}
+	clock.SetTime(someTime)
+	return NewBus(clock)
+}
+
+func TestPublishDeliversInOrder(t *testing.T) {
+	b := newTestBus()
+	var got []Event
+	b.Subscribe(func(e Event) { got = append(got, e) })
+
+	b.Publish(ConfigParsed, nil)
+	b.Publish(BucketProbed, errors.New("bucket doesn't exist"))
+
+	assert.Equal(t, []Event{
+		{Name: ConfigParsed, Time: someTime},
+		{Name: BucketProbed, Time: someTime, Error: "bucket doesn't exist"},
+	}, got)
+}
+
+func TestUnsubscribe(t *testing.T) {
+	b := newTestBus()
+	var first, second []string
+	unsubscribe := b.Subscribe(func(e Event) { first = append(first, e.Name) })
+	b.Subscribe(func(e Event) { second = append(second, e.Name) })
+
+	b.Publish(Mounted, nil)
+	unsubscribe()
+	unsubscribe()
+	b.Publish(Ready, nil)
+
+	assert.Equal(t, []string{Mounted}, first)
+	assert.Equal(t, []string{Mounted, Ready}, second)
+}
+
+func TestPublishWithoutSubscribers(t *testing.T) {
+	b := newTestBus()
+
+	assert.NotPanics(t, func() { b.Publish(Unmounted, nil) })
+}
+
+func TestJSONLines(t *testing.T) {
+	b := newTestBus()
+	var buf bytes.Buffer
+	b.Subscribe(JSONLines(&buf))
+
+	b.Publish(Ready, nil)
+	b.Publish(Unmounted, errors.New("connection aborted"))
+
+	require.Equal(t,
+		`{"event":"ready","time":"2024-06-01T12:30:00Z","error":""}`+"\n"+
+			`{"event":"unmounted","time":"2024-06-01T12:30:00Z","error":"connection aborted"}`+"\n",
+		buf.String())
+}
@@ -127,6 +127,16 @@ func Close() {
 	}
 }
 
+// NewComponentLogger returns a logger writing to the same destination and in
+// the same format as the default logger, whose records carry the given
+// component name. Records at INFO and above are written whatever the
+// configured severity, so that a component can be enabled on its own.
+func NewComponentLogger(component string) *slog.Logger {
+	var programLevel = new(slog.LevelVar)
+	programLevel.Set(LevelInfo)
+	return slog.New(defaultLoggerFactory.handler(programLevel, "")).With(componentKey, component)
+}
+
 // Tracef prints the message with TRACE severity in the specified format.
 func Tracef(format string, v ...interface{}) {
 	defaultLogger.Log(context.Background(), LevelTrace, fmt.Sprintf(format, v...))
@@ -164,6 +174,10 @@ func Fatal(format string, v ...interface{}) {
 	os.Exit(1)
 }
 
+// The standard output at startup, which loggers keep writing to even if
+// os.Stdout is replaced later, as Go examples do to check their output.
+var stdout io.Writer = os.Stdout
+
 type loggerFactory struct {
 	// If nil, log to stdout or stderr. Otherwise, log to this file.
 	file            *os.File
@@ -198,5 +212,5 @@ func (f *loggerFactory) handler(levelVar *slog.LevelVar, prefix string) slog.Han
 	if f.sysWriter != nil {
 		return f.createJsonOrTextHandler(f.sysWriter, levelVar, prefix)
 	}
-	return f.createJsonOrTextHandler(os.Stdout, levelVar, prefix)
+	return f.createJsonOrTextHandler(stdout, levelVar, prefix)
 }
@@ -18,6 +18,7 @@ import (
 	"bytes"
 	"log/slog"
 	"os"
+	"path"
 	"regexp"
 	"testing"
 
@@ -338,3 +339,25 @@ func (t *LoggerTest) TestSetLogFormatToText() {
 		assert.True(t.T(), expectedRegexp.MatchString(output))
 	}
 }
+
+func (t *LoggerTest) TestNewComponentLoggerWritesWhateverTheSeverity() {
+	oldFactory, oldLogger := defaultLoggerFactory, defaultLogger
+	defer func() { defaultLoggerFactory, defaultLogger = oldFactory, oldLogger }()
+	filePath := path.Join(t.T().TempDir(), "log.txt")
+	err := InitLogFile(config.LogConfig{
+		Severity:        config.OFF,
+		Format:          "json",
+		FilePath:        filePath,
+		LogRotateConfig: config.DefaultLogRotateConfig(),
+	})
+	assert.NoError(t.T(), err)
+	defer Close()
+
+	Infof("www.infoExample.com")
+	NewComponentLogger("upload_progress").Info("progress", "bytes_sent", 10)
+
+	content, err := os.ReadFile(filePath)
+	assert.NoError(t.T(), err)
+	expectedRegexp := regexp.MustCompile("^{\"timestamp\":{\"seconds\":\\d{10},\"nanos\":\\d{0,9}},\"severity\":\"INFO\",\"message\":\"progress\",\"component\":\"upload_progress\",\"bytes_sent\":10}\n$")
+	assert.True(t.T(), expectedRegexp.MatchString(string(content)), string(content))
+}
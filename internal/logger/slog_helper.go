@@ -35,6 +35,7 @@ const (
 	timestampKey = "timestamp"
 	secondsKey   = "seconds"
 	nanosKey     = "nanos"
+	componentKey = "component"
 )
 
 func setLoggingLevel(level config.LogSeverity, programLevel *slog.LevelVar) {
@@ -0,0 +1,58 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"log"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/monitor/tags"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+	"golang.org/x/net/context"
+)
+
+var advisoryCount = stats.Int64("fs/advisory_count",
+	"The number of advisories on access patterns served poorly.",
+	stats.UnitDimensionless)
+
+// Initialize the metrics.
+func init() {
+	if err := view.Register(
+		&view.View{
+			Name:        "fs/advisory_count",
+			Measure:     advisoryCount,
+			Description: "The cumulative number of advisories on access patterns served poorly, by pattern.",
+			Aggregation: view.Sum(),
+			TagKeys:     []tag.Key{tags.Pattern},
+		},
+	); err != nil {
+		log.Fatalf("Failed to register the advisory views: %v", err)
+	}
+}
+
+// CaptureAdvisoryMetrics records an advisory on the given access pattern.
+func CaptureAdvisoryMetrics(ctx context.Context, pattern string) {
+	if err := stats.RecordWithTags(
+		ctx,
+		[]tag.Mutator{
+			tag.Upsert(tags.Pattern, pattern),
+		},
+		advisoryCount.M(1),
+	); err != nil {
+		logger.Errorf("Cannot record advisory metrics: %v", err)
+	}
+}
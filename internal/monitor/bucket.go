@@ -74,6 +74,10 @@ func init() {
 
 // recordRequest records a request and its latency.
 func recordRequest(ctx context.Context, method string, start time.Time) {
+	recordSessions(func(s *SessionSummary) {
+		s.GCSRequestCount[method]++
+	})
+
 	if err := stats.RecordWithTags(
 		ctx,
 		[]tag.Mutator{
@@ -118,6 +122,13 @@ func (mb *monitoringBucket) BucketType() gcs.BucketType {
 	return mb.wrapped.BucketType()
 }
 
+func (mb *monitoringBucket) GetRetentionPolicy(ctx context.Context) (*gcs.RetentionPolicy, error) {
+	startTime := time.Now()
+	p, err := mb.wrapped.GetRetentionPolicy(ctx)
+	recordRequest(ctx, "GetRetentionPolicy", startTime)
+	return p, err
+}
+
 func (mb *monitoringBucket) NewReader(
 	ctx context.Context,
 	req *gcs.ReadObjectRequest) (rc io.ReadCloser, err error) {
@@ -195,6 +206,34 @@ func (mb *monitoringBucket) DeleteObject(
 	return err
 }
 
+func (mb *monitoringBucket) CreateFolder(
+	ctx context.Context,
+	folderName string) (*gcs.Folder, error) {
+	startTime := time.Now()
+	f, err := mb.wrapped.CreateFolder(ctx, folderName)
+	recordRequest(ctx, "CreateFolder", startTime)
+	return f, err
+}
+
+func (mb *monitoringBucket) DeleteFolder(
+	ctx context.Context,
+	folderName string) error {
+	startTime := time.Now()
+	err := mb.wrapped.DeleteFolder(ctx, folderName)
+	recordRequest(ctx, "DeleteFolder", startTime)
+	return err
+}
+
+func (mb *monitoringBucket) RenameFolder(
+	ctx context.Context,
+	folderName string,
+	destinationFolderName string) (*gcs.Folder, error) {
+	startTime := time.Now()
+	f, err := mb.wrapped.RenameFolder(ctx, folderName, destinationFolderName)
+	recordRequest(ctx, "RenameFolder", startTime)
+	return f, err
+}
+
 // recordReader increments the reader count when it's opened or closed.
 func recordReader(ctx context.Context, ioMethod string) {
 	if err := stats.RecordWithTags(
@@ -0,0 +1,60 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"log"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/monitor/tags"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+	"golang.org/x/net/context"
+)
+
+var dirTypeFlapCount = stats.Int64("fs/dir_type_flap_count",
+	"The number of directories that resolved to another kind of directory than the previous time.",
+	stats.UnitDimensionless)
+
+// Initialize the metrics.
+func init() {
+	if err := view.Register(
+		&view.View{
+			Name:        "fs/dir_type_flap_count",
+			Measure:     dirTypeFlapCount,
+			Description: "The cumulative number of directories that resolved to another kind of directory than the previous time.",
+			Aggregation: view.Sum(),
+			TagKeys:     []tag.Key{tags.PrevDirType, tags.DirType},
+		},
+	); err != nil {
+		log.Fatalf("Failed to register the directory type flap views: %v", err)
+	}
+}
+
+// CaptureDirTypeFlapMetrics records that a directory that last resolved to
+// the kind prevDirType, e.g. "explicit", now resolved to dirType.
+func CaptureDirTypeFlapMetrics(ctx context.Context, prevDirType string, dirType string) {
+	if err := stats.RecordWithTags(
+		ctx,
+		[]tag.Mutator{
+			tag.Upsert(tags.PrevDirType, prevDirType),
+			tag.Upsert(tags.DirType, dirType),
+		},
+		dirTypeFlapCount.M(1),
+	); err != nil {
+		logger.Errorf("Cannot record directory type flap metrics: %v", err)
+	}
+}
@@ -16,24 +16,35 @@ package monitor
 
 import (
 	"fmt"
+	"os"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
 	"contrib.go.opencensus.io/exporter/ocagent"
 	"contrib.go.opencensus.io/exporter/stackdriver"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
+	"go.opencensus.io/resource"
 	"go.opencensus.io/stats/view"
+	"golang.org/x/net/context"
 )
 
 var stackdriverExporter *stackdriver.Exporter
 
 // EnableStackdriverExporter starts to collect monitoring metrics and exports
-// them to Stackdriver iff the given interval is positive.
-func EnableStackdriverExporter(interval time.Duration) error {
+// them to Stackdriver iff the given interval is positive. The metrics are
+// labeled with the attributes of res.
+func EnableStackdriverExporter(interval time.Duration, res *resource.Resource) error {
 	if interval <= 0 {
 		return nil
 	}
 
+	labels := &stackdriver.Labels{}
+	for k, v := range monitoringLabels(res) {
+		labels.Set(k, v, "")
+	}
+
 	var err error
 	if stackdriverExporter, err = stackdriver.NewExporter(stackdriver.Options{
 		ReportingInterval: interval,
@@ -52,6 +63,7 @@ func EnableStackdriverExporter(interval time.Duration) error {
 			}
 			return name
 		},
+		DefaultMonitoringLabels: labels,
 	}); err != nil {
 		return fmt.Errorf("create stackdriver exporter: %w", err)
 	}
@@ -63,6 +75,29 @@ func EnableStackdriverExporter(interval time.Duration) error {
 	return nil
 }
 
+var invalidLabelKeyChars = regexp.MustCompile("[^a-z0-9_]")
+
+// Return the labels of res as Cloud Monitoring labels, whose keys can't have
+// dots. As setting them drops the label that tells the metrics of processes
+// apart, it's kept.
+func monitoringLabels(res *resource.Resource) map[string]string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "localhost"
+	}
+	labels := map[string]string{
+		"opencensus_task": "go-" + strconv.Itoa(os.Getpid()) + "@" + hostname,
+	}
+
+	if res != nil {
+		for k, v := range res.Labels {
+			labels[invalidLabelKeyChars.ReplaceAllString(strings.ToLower(k), "_")] = v
+		}
+	}
+
+	return labels
+}
+
 // CloseStackdriverExporter ensures all collected metrics are sent to
 // Stackdriver and closes the stackdriverExporter.
 func CloseStackdriverExporter() {
@@ -76,9 +111,9 @@ func CloseStackdriverExporter() {
 var ocExporter *ocagent.Exporter
 
 // EnableOpenTelemetryCollectorExporter starts exporting monitoring metrics to
-// the OpenTelemetry Collector at the given address.
+// the OpenTelemetry Collector at the given address, as those of res.
 // Details: https://opentelemetry.io/docs/collector/
-func EnableOpenTelemetryCollectorExporter(address string) error {
+func EnableOpenTelemetryCollectorExporter(address string, res *resource.Resource) error {
 	if address == "" {
 		return nil
 	}
@@ -88,6 +123,9 @@ func EnableOpenTelemetryCollectorExporter(address string) error {
 		ocagent.WithAddress(address),
 		ocagent.WithServiceName("gcsfuse"),
 		ocagent.WithReconnectionPeriod(5*time.Second),
+		ocagent.WithResourceDetector(func(context.Context) (*resource.Resource, error) {
+			return res, nil
+		}),
 	); err != nil {
 		return fmt.Errorf("create opentelementry collector exporter: %w", err)
 	}
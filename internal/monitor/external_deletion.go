@@ -0,0 +1,50 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"log"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"golang.org/x/net/context"
+)
+
+var externalDeletionCount = stats.Int64("fs/external_deletion_count",
+	"The number of files found to have had their object deleted by another writer.",
+	stats.UnitDimensionless)
+
+// Initialize the metrics.
+func init() {
+	if err := view.Register(
+		&view.View{
+			Name:        "fs/external_deletion_count",
+			Measure:     externalDeletionCount,
+			Description: "The cumulative number of files found to have had their object deleted by another writer.",
+			Aggregation: view.Sum(),
+		},
+	); err != nil {
+		log.Fatalf("Failed to register the external deletion views: %v", err)
+	}
+}
+
+// CaptureExternalDeletionMetrics records that a file was found to have had its
+// object deleted by another writer.
+func CaptureExternalDeletionMetrics(ctx context.Context) {
+	if err := stats.RecordWithTags(ctx, nil, externalDeletionCount.M(1)); err != nil {
+		logger.Errorf("Cannot record external deletion metrics: %v", err)
+	}
+}
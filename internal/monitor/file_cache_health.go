@@ -0,0 +1,66 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"log"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"golang.org/x/net/context"
+)
+
+var (
+	fileCacheDiskErrorCount = stats.Int64("file_cache/disk_error_count",
+		"The number of disk errors of the file cache, each of which stops files being added to the cache for a while.",
+		stats.UnitDimensionless)
+	fileCacheBypassCount = stats.Int64("file_cache/bypass_count",
+		"The number of times the file cache was bypassed after repeated disk errors.",
+		stats.UnitDimensionless)
+)
+
+// Initialize the metrics.
+func init() {
+	if err := view.Register(
+		&view.View{
+			Name:        "file_cache/disk_error_count",
+			Measure:     fileCacheDiskErrorCount,
+			Description: "The cumulative number of disk errors of the file cache, each of which stops files being added to the cache for a while.",
+			Aggregation: view.Sum(),
+		},
+		&view.View{
+			Name:        "file_cache/bypass_count",
+			Measure:     fileCacheBypassCount,
+			Description: "The cumulative number of times the file cache was bypassed after repeated disk errors.",
+			Aggregation: view.Sum(),
+		},
+	); err != nil {
+		log.Fatalf("Failed to register the file cache health views: %v", err)
+	}
+}
+
+// CaptureFileCacheDiskErrorMetrics records a disk error of the file cache,
+// which made the cache be bypassed if bypassed is set.
+func CaptureFileCacheDiskErrorMetrics(ctx context.Context, bypassed bool) {
+	measurements := []stats.Measurement{fileCacheDiskErrorCount.M(1)}
+	if bypassed {
+		measurements = append(measurements, fileCacheBypassCount.M(1))
+	}
+
+	if err := stats.RecordWithTags(ctx, nil, measurements...); err != nil {
+		logger.Errorf("Cannot record file cache health metrics: %v", err)
+	}
+}
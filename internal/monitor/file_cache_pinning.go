@@ -0,0 +1,69 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"log"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"golang.org/x/net/context"
+)
+
+var (
+	fileCachePinnedBytes = stats.Int64("file_cache/pinned_bytes",
+		"The size of the files in the file cache pinned by file-cache:pinned-prefixes.",
+		stats.UnitBytes)
+	fileCachePinFallbackCount = stats.Int64("file_cache/pin_fallback_count",
+		"The number of files matching file-cache:pinned-prefixes cached without being pinned, for lack of room for pinned files.",
+		stats.UnitDimensionless)
+)
+
+// Initialize the metrics.
+func init() {
+	if err := view.Register(
+		&view.View{
+			Name:        "file_cache/pinned_bytes",
+			Measure:     fileCachePinnedBytes,
+			Description: "The size of the files in the file cache pinned by file-cache:pinned-prefixes.",
+			Aggregation: view.LastValue(),
+		},
+		&view.View{
+			Name:        "file_cache/pin_fallback_count",
+			Measure:     fileCachePinFallbackCount,
+			Description: "The cumulative number of files matching file-cache:pinned-prefixes cached without being pinned, for lack of room for pinned files.",
+			Aggregation: view.Sum(),
+		},
+	); err != nil {
+		log.Fatalf("Failed to register the file cache pinning views: %v", err)
+	}
+}
+
+// CaptureFileCachePinnedBytesMetrics records the size of the pinned files of
+// the file cache.
+func CaptureFileCachePinnedBytesMetrics(ctx context.Context, bytes int64) {
+	if err := stats.RecordWithTags(ctx, nil, fileCachePinnedBytes.M(bytes)); err != nil {
+		logger.Errorf("Cannot record file cache pinning metrics: %v", err)
+	}
+}
+
+// CaptureFileCachePinFallbackMetrics records a file matching the pinned
+// prefixes that was cached without being pinned.
+func CaptureFileCachePinFallbackMetrics(ctx context.Context) {
+	if err := stats.RecordWithTags(ctx, nil, fileCachePinFallbackCount.M(1)); err != nil {
+		logger.Errorf("Cannot record file cache pinning metrics: %v", err)
+	}
+}
@@ -0,0 +1,49 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"log"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"golang.org/x/net/context"
+)
+
+var keepaliveCount = stats.Int64("gcs/keepalive_count",
+	"The number of requests sent to GCS to keep idle connections and tokens warm.",
+	stats.UnitDimensionless)
+
+// Initialize the metrics.
+func init() {
+	if err := view.Register(
+		&view.View{
+			Name:        "gcs/keepalive_count",
+			Measure:     keepaliveCount,
+			Description: "The cumulative number of requests sent to GCS to keep idle connections and tokens warm.",
+			Aggregation: view.Sum(),
+		},
+	); err != nil {
+		log.Fatalf("Failed to register the keepalive views: %v", err)
+	}
+}
+
+// CaptureKeepaliveMetrics records that a keepalive request was sent to GCS.
+func CaptureKeepaliveMetrics(ctx context.Context) {
+	if err := stats.RecordWithTags(ctx, nil, keepaliveCount.M(1)); err != nil {
+		logger.Errorf("Cannot record keepalive metrics: %v", err)
+	}
+}
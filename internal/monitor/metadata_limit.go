@@ -0,0 +1,69 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"log"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/monitor/tags"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+	"golang.org/x/net/context"
+)
+
+// The outcomes of metadata requests over --max-metadata-ops-per-sec.
+const (
+	// The request waited for its turn.
+	LimitOutcomeDelayed = "delayed"
+
+	// The request would have waited too long, and failed without being sent.
+	LimitOutcomeRefused = "refused"
+)
+
+var metadataLimitCount = stats.Int64("gcs/metadata_limit_count",
+	"The number of GCS metadata requests delayed or refused to keep to --max-metadata-ops-per-sec.",
+	stats.UnitDimensionless)
+
+// Initialize the metrics.
+func init() {
+	if err := view.Register(
+		&view.View{
+			Name:        "gcs/metadata_limit_count",
+			Measure:     metadataLimitCount,
+			Description: "The cumulative number of GCS metadata requests delayed or refused to keep to --max-metadata-ops-per-sec, by method and outcome.",
+			Aggregation: view.Sum(),
+			TagKeys:     []tag.Key{tags.GCSMethod, tags.LimitOutcome},
+		},
+	); err != nil {
+		log.Fatalf("Failed to register the metadata limit views: %v", err)
+	}
+}
+
+// CaptureMetadataLimitMetrics records that a GCS metadata request calling
+// method, e.g. "StatObject", was delayed or refused as per outcome.
+func CaptureMetadataLimitMetrics(ctx context.Context, method string, outcome string) {
+	if err := stats.RecordWithTags(
+		ctx,
+		[]tag.Mutator{
+			tag.Upsert(tags.GCSMethod, method),
+			tag.Upsert(tags.LimitOutcome, outcome),
+		},
+		metadataLimitCount.M(1),
+	); err != nil {
+		logger.Errorf("Cannot record metadata limit metrics: %v", err)
+	}
+}
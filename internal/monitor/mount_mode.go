@@ -0,0 +1,69 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"log"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/monitor/tags"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+	"golang.org/x/net/context"
+)
+
+// The mount modes annotating fs/mount_mode.
+const (
+	MountModeReadWrite = "read-write"
+	MountModeReadOnly  = "read-only"
+)
+
+var mountMode = stats.Int64("fs/mount_mode",
+	"1 for the mode the file system is mounted in.",
+	stats.UnitDimensionless)
+
+// Initialize the metrics.
+func init() {
+	if err := view.Register(
+		&view.View{
+			Name:        "fs/mount_mode",
+			Measure:     mountMode,
+			Description: "1 for the mode the file system is mounted in: read-write, or read-only, e.g. because the retention policy of the bucket is locked.",
+			Aggregation: view.LastValue(),
+			TagKeys:     []tag.Key{tags.MountMode},
+		},
+	); err != nil {
+		log.Fatalf("Failed to register the mount mode views: %v", err)
+	}
+}
+
+// CaptureMountModeMetrics records the mode the file system is mounted in.
+func CaptureMountModeMetrics(ctx context.Context, readOnly bool) {
+	mode := MountModeReadWrite
+	if readOnly {
+		mode = MountModeReadOnly
+	}
+
+	if err := stats.RecordWithTags(
+		ctx,
+		[]tag.Mutator{
+			tag.Upsert(tags.MountMode, mode),
+		},
+		mountMode.M(1),
+	); err != nil {
+		logger.Errorf("Cannot record mount mode metrics: %v", err)
+	}
+}
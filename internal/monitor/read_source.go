@@ -0,0 +1,189 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/monitor/tags"
+	"github.com/jacobsa/timeutil"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+	"golang.org/x/net/context"
+)
+
+// The sources the bytes returned by reads are served from. Reads served by
+// the kernel's page cache never reach gcsfuse, and aren't counted at all.
+const (
+	// A range of the file cache that was already downloaded.
+	ReadFromFileCache = "file_cache"
+
+	// A range of the file cache that the read waited to be downloaded.
+	ReadFromFileCacheDownload = "file_cache_download"
+
+	// A read of the object from GCS.
+	ReadFromGCS = "gcs"
+
+	// A range that the object's zero extents hint says holds only zeros.
+	ReadFromZeroExtents = "zero_extents"
+
+	// The local file staging the contents of a file being written.
+	ReadFromStagedFile = "staged_file"
+)
+
+// How long the file cache fill throughput is averaged over.
+const fileCacheFillWindow = time.Second
+
+var (
+	servedBytesCount = stats.Int64("fs/read_bytes_count",
+		"The number of bytes returned by reads, by the source they were served from.",
+		stats.UnitBytes)
+	fileCacheFillThroughput = stats.Float64("file_cache/fill_throughput",
+		"The rate at which files are being downloaded into the file cache.",
+		"By/s")
+)
+
+// Initialize the metrics.
+func init() {
+	if err := view.Register(
+		&view.View{
+			Name:        "fs/read_bytes_count",
+			Measure:     servedBytesCount,
+			Description: "The cumulative number of bytes returned by reads, by the source they were served from.",
+			Aggregation: view.Sum(),
+			TagKeys:     []tag.Key{tags.ReadSource},
+		},
+		&view.View{
+			Name:        "file_cache/fill_throughput",
+			Measure:     fileCacheFillThroughput,
+			Description: "The rate at which files are being downloaded into the file cache, in bytes per second.",
+			Aggregation: view.LastValue(),
+		},
+	); err != nil {
+		log.Fatalf("Failed to register the read source views: %v", err)
+	}
+}
+
+// ReadBytes is the number of bytes returned by a read, split by the source
+// they were served from.
+type ReadBytes map[string]int64
+
+// Add attributes n more bytes to source.
+func (rb ReadBytes) Add(source string, n int) {
+	if n > 0 {
+		rb[source] += int64(n)
+	}
+}
+
+// CaptureReadBytesMetrics records the bytes returned by a read. It must be
+// called once for each read returning data, with all of its bytes, so that
+// none of them are counted twice.
+func CaptureReadBytesMetrics(ctx context.Context, rb ReadBytes) {
+	recordSessions(func(s *SessionSummary) {
+		for _, n := range rb {
+			s.ReadBytes += n
+		}
+	})
+
+	for source, n := range rb {
+		if err := stats.RecordWithTags(
+			ctx,
+			[]tag.Mutator{
+				tag.Upsert(tags.ReadSource, source),
+			},
+			servedBytesCount.M(n),
+		); err != nil {
+			logger.Errorf("Cannot record read bytes metrics: %v", err)
+		}
+	}
+}
+
+// FileCacheFillMeter measures the rate at which the downloads of a mount fill
+// the file cache. It records the file_cache/fill_throughput gauge once a
+// second while files are being downloaded, and zero once none are.
+//
+// Safe for concurrent access.
+type FileCacheFillMeter struct {
+	clock timeutil.Clock
+
+	mu sync.Mutex
+
+	// The number of downloads in progress.
+	//
+	// GUARDED_BY(mu)
+	downloads int
+
+	// The start of the current measurement window, and the number of bytes
+	// downloaded since.
+	//
+	// GUARDED_BY(mu)
+	windowStart time.Time
+	windowBytes int64
+}
+
+// NewFileCacheFillMeter returns a meter measuring time with the given clock.
+func NewFileCacheFillMeter(clock timeutil.Clock) *FileCacheFillMeter {
+	return &FileCacheFillMeter{clock: clock}
+}
+
+// DownloadStarted notes that a download into the file cache has started.
+func (m *FileCacheFillMeter) DownloadStarted() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.downloads == 0 {
+		m.windowStart = m.clock.Now()
+		m.windowBytes = 0
+	}
+	m.downloads++
+}
+
+// Downloaded notes that n bytes have been written to the file cache by a
+// download in progress, and records the throughput if a window has ended.
+func (m *FileCacheFillMeter) Downloaded(ctx context.Context, n int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.windowBytes += n
+	now := m.clock.Now()
+	if elapsed := now.Sub(m.windowStart); elapsed >= fileCacheFillWindow {
+		m.record(ctx, float64(m.windowBytes)/elapsed.Seconds())
+		m.windowStart = now
+		m.windowBytes = 0
+	}
+}
+
+// DownloadStopped notes that a download has completed, failed or been
+// cancelled, recording a throughput of zero if it was the last one.
+func (m *FileCacheFillMeter) DownloadStopped(ctx context.Context) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.downloads--
+	if m.downloads == 0 {
+		m.record(ctx, 0)
+	}
+}
+
+// LOCKS_REQUIRED(m.mu)
+func (m *FileCacheFillMeter) record(ctx context.Context, bytesPerSecond float64) {
+	if err := stats.RecordWithTags(ctx, nil, fileCacheFillThroughput.M(bytesPerSecond)); err != nil {
+		logger.Errorf("Cannot record file cache fill throughput: %v", err)
+	}
+}
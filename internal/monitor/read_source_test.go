@@ -0,0 +1,71 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jacobsa/timeutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opencensus.io/stats/view"
+	"golang.org/x/net/context"
+)
+
+// Return the last value of the file_cache/fill_throughput gauge.
+func fillThroughput(t *testing.T) float64 {
+	t.Helper()
+	rows, err := view.RetrieveData("file_cache/fill_throughput")
+	require.NoError(t, err)
+	require.Len(t, rows, 1)
+	return rows[0].Data.(*view.LastValueData).Value
+}
+
+func TestFileCacheFillMeter(t *testing.T) {
+	ctx := context.Background()
+	var clock timeutil.SimulatedClock
+	clock.SetTime(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	m := NewFileCacheFillMeter(&clock)
+
+	// Two downloads share a window, which is recorded once it has ended.
+	m.DownloadStarted()
+	m.DownloadStarted()
+	m.Downloaded(ctx, 1<<20)
+	clock.AdvanceTime(time.Second)
+	m.Downloaded(ctx, 1<<20)
+	assert.Equal(t, float64(2<<20), fillThroughput(t))
+
+	// The next window starts afresh.
+	clock.AdvanceTime(2 * time.Second)
+	m.Downloaded(ctx, 1<<20)
+	assert.Equal(t, float64(1<<19), fillThroughput(t))
+
+	// The gauge drops to zero only once both downloads are done.
+	m.DownloadStopped(ctx)
+	assert.Equal(t, float64(1<<19), fillThroughput(t))
+	m.DownloadStopped(ctx)
+	assert.Equal(t, float64(0), fillThroughput(t))
+}
+
+func TestReadBytesAddIgnoresEmptyReads(t *testing.T) {
+	rb := make(ReadBytes)
+
+	rb.Add(ReadFromGCS, 0)
+	rb.Add(ReadFromFileCache, 10)
+	rb.Add(ReadFromFileCache, 5)
+
+	assert.Equal(t, ReadBytes{ReadFromFileCache: 15}, rb)
+}
@@ -121,6 +121,14 @@ func CaptureGCSReadMetrics(ctx context.Context, readType string, requestedDataSi
 }
 
 func CaptureFileCacheMetrics(ctx context.Context, readType string, readDataSize int, cacheHit bool, readLatencyNs int64) {
+	recordSessions(func(s *SessionSummary) {
+		if cacheHit {
+			s.FileCacheHitCount++
+		} else {
+			s.FileCacheMissCount++
+		}
+	})
+
 	if err := stats.RecordWithTags(
 		ctx,
 		[]tag.Mutator{
@@ -0,0 +1,173 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/compute/metadata"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
+	"go.opencensus.io/resource"
+	"go.opencensus.io/resource/resourcekeys"
+	"golang.org/x/net/context"
+)
+
+// The attributes of the resource that gcsfuse reports about itself, beside
+// those of resourcekeys.
+const (
+	ServiceNameKey    = "service.name"
+	ServiceVersionKey = "service.version"
+	BucketNameKey     = "gcsfuse.bucket.name"
+	K8SKeyNodeName    = "k8s.node.name"
+)
+
+// How long detecting the resource waits for the metadata server, which isn't
+// reachable off Google Cloud, before going on without it.
+var metadataTimeout = 2 * time.Second
+
+// ParseResourceAttributes parses a comma-separated list of key=value pairs,
+// such as "service.name=ingest,team=data".
+func ParseResourceAttributes(s string) (attributes map[string]string, err error) {
+	attributes = make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+
+		key, value, ok := strings.Cut(pair, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("%q is not of the form key=value", pair)
+		}
+		attributes[key] = strings.TrimSpace(value)
+	}
+
+	return
+}
+
+// DetectResource returns the resource that the exported telemetry describes:
+// gcsfuse at the given version mounting bucketName, the Compute Engine
+// instance and GKE cluster it runs on, as told by the metadata server, and
+// the Kubernetes pod it runs in, as told by the environment variables set
+// through the downward API. The supplied attributes override those detected.
+//
+// The metadata server is only asked on Google Cloud, for at most
+// metadataTimeout; whatever it hasn't answered by then is left out.
+func DetectResource(ctx context.Context, version string, bucketName string, attributes map[string]string) *resource.Resource {
+	res := &resource.Resource{
+		Labels: map[string]string{
+			ServiceNameKey:    "gcsfuse",
+			ServiceVersionKey: version,
+		},
+	}
+	if bucketName != "" {
+		res.Labels[BucketNameKey] = bucketName
+	}
+
+	if onGCE() {
+		res.Type = resourcekeys.HostType
+		ctx, cancel := context.WithTimeout(ctx, metadataTimeout)
+		defer cancel()
+		if err := detectGCE(ctx, res.Labels); err != nil {
+			logger.Warnf("Detecting the resource of the telemetry on the metadata server: %v", err)
+		}
+	}
+
+	if os.Getenv("KUBERNETES_SERVICE_HOST") != "" {
+		res.Type = resourcekeys.K8SType
+		detectK8S(res.Labels)
+	}
+
+	for k, v := range attributes {
+		res.Labels[k] = v
+	}
+
+	return res
+}
+
+// Whether gcsfuse seems to run on Compute Engine, or to have been pointed at
+// a metadata server, without asking the network.
+func onGCE() bool {
+	if os.Getenv("GCE_METADATA_HOST") != "" {
+		return true
+	}
+
+	name, _ := os.ReadFile("/sys/class/dmi/id/product_name")
+	switch strings.TrimSpace(string(name)) {
+	case "Google", "Google Compute Engine":
+		return true
+	}
+
+	return false
+}
+
+// Set the attributes of the instance, and of the GKE cluster it belongs to if
+// any, as answered by the metadata server before ctx is done.
+func detectGCE(ctx context.Context, labels map[string]string) error {
+	c := metadata.NewClient(&http.Client{Timeout: metadataTimeout})
+
+	// The project is asked first, so that an unreachable server fails once.
+	project, err := c.GetWithContext(ctx, "project/project-id")
+	if err != nil {
+		return err
+	}
+	labels[resourcekeys.CloudKeyProvider] = resourcekeys.CloudProviderGCP
+	labels[resourcekeys.CloudKeyAccountID] = project
+
+	for key, suffix := range map[string]string{
+		resourcekeys.HostKeyID:         "instance/id",
+		resourcekeys.HostKeyName:       "instance/name",
+		resourcekeys.CloudKeyZone:      "instance/zone",
+		resourcekeys.K8SKeyClusterName: "instance/attributes/cluster-name",
+	} {
+		v, err := c.GetWithContext(ctx, suffix)
+		if _, ok := err.(metadata.NotDefinedError); ok {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		// The zone comes as "projects/<number>/zones/<zone>".
+		if key == resourcekeys.CloudKeyZone {
+			v = v[strings.LastIndex(v, "/")+1:]
+		}
+		labels[key] = strings.TrimSpace(v)
+	}
+
+	return nil
+}
+
+// Set the attributes of the pod from the environment variables that pods
+// commonly set through the downward API.
+func detectK8S(labels map[string]string) {
+	for key, envs := range map[string][]string{
+		resourcekeys.K8SKeyNamespaceName: {"POD_NAMESPACE", "NAMESPACE"},
+		resourcekeys.K8SKeyPodName:       {"POD_NAME", "HOSTNAME"},
+		K8SKeyNodeName:                   {"NODE_NAME"},
+		resourcekeys.ContainerKeyName:    {"CONTAINER_NAME"},
+	} {
+		for _, env := range envs {
+			if v := os.Getenv(env); v != "" {
+				labels[key] = v
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,182 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opencensus.io/resource"
+	"go.opencensus.io/resource/resourcekeys"
+	"golang.org/x/net/context"
+)
+
+// Serve the given metadata, by path below /computeMetadata/v1/, as the
+// metadata server does, and point the metadata client at it.
+func stubMetadataServer(t *testing.T, values map[string]string) {
+	t.Helper()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata-Flavor") != "Google" {
+			http.Error(w, "missing Metadata-Flavor", http.StatusForbidden)
+			return
+		}
+		v, ok := values[strings.TrimPrefix(r.URL.Path, "/computeMetadata/v1/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(v))
+	}))
+	t.Cleanup(s.Close)
+	t.Setenv("GCE_METADATA_HOST", strings.TrimPrefix(s.URL, "http://"))
+}
+
+func clearK8SEnv(t *testing.T) {
+	t.Helper()
+	for _, env := range []string{"KUBERNETES_SERVICE_HOST", "POD_NAMESPACE", "NAMESPACE", "POD_NAME", "HOSTNAME", "NODE_NAME", "CONTAINER_NAME"} {
+		t.Setenv(env, "")
+	}
+}
+
+func TestParseResourceAttributes(t *testing.T) {
+	attributes, err := ParseResourceAttributes(" service.name=ingest,team=,,url=http://x?a=b ")
+
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"service.name": "ingest", "team": "", "url": "http://x?a=b"}, attributes)
+}
+
+func TestParseResourceAttributes_Empty(t *testing.T) {
+	attributes, err := ParseResourceAttributes("")
+
+	require.NoError(t, err)
+	assert.Empty(t, attributes)
+}
+
+func TestParseResourceAttributes_Invalid(t *testing.T) {
+	for _, s := range []string{"team", "=data", "a=b,team"} {
+		_, err := ParseResourceAttributes(s)
+
+		assert.Error(t, err, s)
+	}
+}
+
+func TestDetectResource_GKE(t *testing.T) {
+	stubMetadataServer(t, map[string]string{
+		"project/project-id":               "my-project",
+		"instance/id":                      "1234",
+		"instance/name":                    "gke-node-1",
+		"instance/zone":                    "projects/42/zones/us-central1-a",
+		"instance/attributes/cluster-name": "my-cluster",
+	})
+	clearK8SEnv(t)
+	t.Setenv("KUBERNETES_SERVICE_HOST", "10.0.0.1")
+	t.Setenv("POD_NAMESPACE", "data")
+	t.Setenv("HOSTNAME", "ingest-7d9f")
+	t.Setenv("NODE_NAME", "gke-node-1")
+
+	res := DetectResource(context.Background(), "2.3.0", "my-bucket", map[string]string{
+		ServiceNameKey: "ingest",
+		"team":         "data",
+	})
+
+	assert.Equal(t, resourcekeys.K8SType, res.Type)
+	assert.Equal(t, map[string]string{
+		ServiceNameKey:                   "ingest",
+		ServiceVersionKey:                "2.3.0",
+		BucketNameKey:                    "my-bucket",
+		"team":                           "data",
+		resourcekeys.CloudKeyProvider:    "gcp",
+		resourcekeys.CloudKeyAccountID:   "my-project",
+		resourcekeys.CloudKeyZone:        "us-central1-a",
+		resourcekeys.HostKeyID:           "1234",
+		resourcekeys.HostKeyName:         "gke-node-1",
+		resourcekeys.K8SKeyClusterName:   "my-cluster",
+		resourcekeys.K8SKeyNamespaceName: "data",
+		resourcekeys.K8SKeyPodName:       "ingest-7d9f",
+		K8SKeyNodeName:                   "gke-node-1",
+	}, res.Labels)
+}
+
+func TestDetectResource_GCE(t *testing.T) {
+	stubMetadataServer(t, map[string]string{
+		"project/project-id": "my-project",
+		"instance/id":        "1234",
+		"instance/name":      "vm-1",
+		"instance/zone":      "projects/42/zones/europe-west1-b",
+	})
+	clearK8SEnv(t)
+
+	res := DetectResource(context.Background(), "2.3.0", "", nil)
+
+	assert.Equal(t, resourcekeys.HostType, res.Type)
+	assert.Equal(t, map[string]string{
+		ServiceNameKey:                 "gcsfuse",
+		ServiceVersionKey:              "2.3.0",
+		resourcekeys.CloudKeyProvider:  "gcp",
+		resourcekeys.CloudKeyAccountID: "my-project",
+		resourcekeys.CloudKeyZone:      "europe-west1-b",
+		resourcekeys.HostKeyID:         "1234",
+		resourcekeys.HostKeyName:       "vm-1",
+	}, res.Labels)
+}
+
+func TestDetectResource_UnreachableMetadataServer(t *testing.T) {
+	// A server that never answers.
+	unblock := make(chan struct{})
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-unblock
+	}))
+	defer s.Close()
+	defer close(unblock)
+	t.Setenv("GCE_METADATA_HOST", strings.TrimPrefix(s.URL, "http://"))
+	clearK8SEnv(t)
+	defer func(d time.Duration) { metadataTimeout = d }(metadataTimeout)
+	metadataTimeout = 100 * time.Millisecond
+
+	start := time.Now()
+	res := DetectResource(context.Background(), "2.3.0", "my-bucket", nil)
+
+	assert.Less(t, time.Since(start), 5*time.Second)
+	assert.Equal(t, map[string]string{
+		ServiceNameKey:    "gcsfuse",
+		ServiceVersionKey: "2.3.0",
+		BucketNameKey:     "my-bucket",
+	}, res.Labels)
+}
+
+func TestMonitoringLabels(t *testing.T) {
+	res := &resource.Resource{
+		Labels: map[string]string{
+			ServiceNameKey: "gcsfuse",
+			BucketNameKey:  "my-bucket",
+			"Team-Name":    "data",
+		},
+	}
+
+	labels := monitoringLabels(res)
+
+	assert.Contains(t, labels, "opencensus_task")
+	delete(labels, "opencensus_task")
+	assert.Equal(t, map[string]string{
+		"service_name":        "gcsfuse",
+		"gcsfuse_bucket_name": "my-bucket",
+		"team_name":           "data",
+	}, labels)
+}
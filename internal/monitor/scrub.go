@@ -0,0 +1,66 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"log"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"golang.org/x/net/context"
+)
+
+var (
+	fileCacheScrubBytesCount = stats.Int64("file_cache/scrub_bytes_count",
+		"The number of bytes of cached files read back to check them against their objects.",
+		stats.UnitBytes)
+	fileCacheScrubCorruptionCount = stats.Int64("file_cache/scrub_corruption_count",
+		"The number of cached files found not to match their objects.",
+		stats.UnitDimensionless)
+)
+
+// Initialize the metrics.
+func init() {
+	if err := view.Register(
+		&view.View{
+			Name:        "file_cache/scrub_bytes_count",
+			Measure:     fileCacheScrubBytesCount,
+			Description: "The cumulative number of bytes of cached files read back to check them against their objects.",
+			Aggregation: view.Sum(),
+		},
+		&view.View{
+			Name:        "file_cache/scrub_corruption_count",
+			Measure:     fileCacheScrubCorruptionCount,
+			Description: "The cumulative number of cached files found not to match their objects and evicted.",
+			Aggregation: view.Sum(),
+		},
+	); err != nil {
+		log.Fatalf("Failed to register the file cache scrub views: %v", err)
+	}
+}
+
+// CaptureFileCacheScrubMetrics records the check of one cached file, of which
+// bytesScanned bytes were read back.
+func CaptureFileCacheScrubMetrics(ctx context.Context, bytesScanned int64, corrupt bool) {
+	measurements := []stats.Measurement{fileCacheScrubBytesCount.M(bytesScanned)}
+	if corrupt {
+		measurements = append(measurements, fileCacheScrubCorruptionCount.M(1))
+	}
+
+	if err := stats.RecordWithTags(ctx, nil, measurements...); err != nil {
+		logger.Errorf("Cannot record file cache scrub metrics: %v", err)
+	}
+}
@@ -0,0 +1,206 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"runtime"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
+	"github.com/jacobsa/timeutil"
+)
+
+// SessionSummaryComponent is the component name carried by the records of
+// session summaries.
+const SessionSummaryComponent = "session_summary"
+
+// SessionSummary sums up the activity of a session, from the creation of its
+// SessionRecorder to its end. The GCS requests, bytes read and file cache
+// reads are those of the whole process, which may run more than one session.
+type SessionSummary struct {
+	DurationSeconds float64 `json:"duration_seconds"`
+
+	// The number of file system ops processed, by op, and of those that
+	// failed, by error.
+	OpsCount      map[string]int64 `json:"ops_count"`
+	OpsErrorCount map[string]int64 `json:"ops_error_count"`
+
+	// The number of bytes returned by reads and accepted by writes.
+	ReadBytes    int64 `json:"read_bytes"`
+	WrittenBytes int64 `json:"written_bytes"`
+
+	// The number of reads through the file cache that hit and missed it, and
+	// the ratio of hits, zero if there were none.
+	FileCacheHitCount  int64   `json:"file_cache_hit_count"`
+	FileCacheMissCount int64   `json:"file_cache_miss_count"`
+	FileCacheHitRatio  float64 `json:"file_cache_hit_ratio"`
+
+	// The number of GCS requests, by method.
+	GCSRequestCount map[string]int64 `json:"gcs_request_count"`
+
+	// The peak resident set size of the process.
+	PeakMemoryBytes int64 `json:"peak_memory_bytes"`
+}
+
+// A SessionRecorder keeps an in-process mirror of the measures recorded
+// during a session, from which its summary is made. The measures recorded by
+// this package are mirrored into every recorder that hasn't finished; those
+// of file system ops are recorded by the file system.
+//
+// Safe for concurrent access.
+type SessionRecorder struct {
+	clock timeutil.Clock
+	start time.Time
+
+	mu sync.Mutex
+
+	// GUARDED_BY(mu)
+	summary  SessionSummary
+	finished bool
+}
+
+// The recorders that haven't finished.
+var sessions struct {
+	mu sync.RWMutex
+
+	// GUARDED_BY(mu)
+	recorders map[*SessionRecorder]struct{}
+}
+
+// NewSessionRecorder starts a session at the current time of the clock.
+func NewSessionRecorder(clock timeutil.Clock) *SessionRecorder {
+	r := &SessionRecorder{
+		clock: clock,
+		start: clock.Now(),
+		summary: SessionSummary{
+			OpsCount:        make(map[string]int64),
+			OpsErrorCount:   make(map[string]int64),
+			GCSRequestCount: make(map[string]int64),
+		},
+	}
+
+	sessions.mu.Lock()
+	defer sessions.mu.Unlock()
+	if sessions.recorders == nil {
+		sessions.recorders = make(map[*SessionRecorder]struct{})
+	}
+	sessions.recorders[r] = struct{}{}
+	return r
+}
+
+// recordSessions applies f to the summaries of the recorders that haven't
+// finished.
+func recordSessions(f func(s *SessionSummary)) {
+	sessions.mu.RLock()
+	defer sessions.mu.RUnlock()
+	for r := range sessions.recorders {
+		r.record(f)
+	}
+}
+
+func (r *SessionRecorder) record(f func(s *SessionSummary)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.finished {
+		f(&r.summary)
+	}
+}
+
+// RecordOp records a file system op, which failed with the error named by
+// errStr unless it is empty.
+func (r *SessionRecorder) RecordOp(op string, errStr string) {
+	r.record(func(s *SessionSummary) {
+		s.OpsCount[op]++
+		if errStr != "" {
+			s.OpsErrorCount[errStr]++
+		}
+	})
+}
+
+// RecordWrite records n bytes accepted by a write.
+func (r *SessionRecorder) RecordWrite(n int) {
+	r.record(func(s *SessionSummary) {
+		s.WrittenBytes += int64(n)
+	})
+}
+
+// Finish ends the session, after which nothing more is recorded, and returns
+// its summary.
+func (r *SessionRecorder) Finish() SessionSummary {
+	sessions.mu.Lock()
+	delete(sessions.recorders, r)
+	sessions.mu.Unlock()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.finished = true
+	s := r.summary
+	s.DurationSeconds = r.clock.Now().Sub(r.start).Seconds()
+	if reads := s.FileCacheHitCount + s.FileCacheMissCount; reads > 0 {
+		s.FileCacheHitRatio = float64(s.FileCacheHitCount) / float64(reads)
+	}
+	s.PeakMemoryBytes = peakMemoryBytes()
+	return s
+}
+
+// peakMemoryBytes returns the peak resident set size of the process, or zero
+// if it isn't known.
+func peakMemoryBytes() int64 {
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage); err != nil {
+		return 0
+	}
+
+	// Linux reports it in KiB, macOS in bytes.
+	if runtime.GOOS == "darwin" {
+		return int64(usage.Maxrss)
+	}
+	return int64(usage.Maxrss) * 1024
+}
+
+// Log writes the summary as one record of the SessionSummaryComponent.
+func (s SessionSummary) Log() {
+	logger.NewComponentLogger(SessionSummaryComponent).Info("Session summary",
+		slog.Float64("duration_seconds", s.DurationSeconds),
+		slog.Any("ops_count", s.OpsCount),
+		slog.Any("ops_error_count", s.OpsErrorCount),
+		slog.Int64("read_bytes", s.ReadBytes),
+		slog.Int64("written_bytes", s.WrittenBytes),
+		slog.Int64("file_cache_hit_count", s.FileCacheHitCount),
+		slog.Int64("file_cache_miss_count", s.FileCacheMissCount),
+		slog.Float64("file_cache_hit_ratio", s.FileCacheHitRatio),
+		slog.Any("gcs_request_count", s.GCSRequestCount),
+		slog.Int64("peak_memory_bytes", s.PeakMemoryBytes))
+}
+
+// WriteFile writes the summary to the named file as a JSON object, replacing
+// the file if it exists.
+func (s SessionSummary) WriteFile(name string) error {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("marshal the session summary: %w", err)
+	}
+
+	if err := os.WriteFile(name, append(b, '\n'), 0644); err != nil {
+		return fmt.Errorf("write the session summary: %w", err)
+	}
+	return nil
+}
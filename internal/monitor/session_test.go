@@ -0,0 +1,94 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/jacobsa/timeutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+)
+
+func TestSessionRecorder_MirrorsMeasures(t *testing.T) {
+	var clock timeutil.SimulatedClock
+	clock.SetTime(time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC))
+	r := NewSessionRecorder(&clock)
+	ctx := context.Background()
+
+	r.RecordOp("LookUpInode", "")
+	r.RecordOp("LookUpInode", "no such file or directory")
+	r.RecordOp("WriteFile", "")
+	r.RecordWrite(5)
+	recordRequest(ctx, "StatObject", time.Now())
+	recordRequest(ctx, "StatObject", time.Now())
+	recordRequest(ctx, "NewReader", time.Now())
+	CaptureReadBytesMetrics(ctx, ReadBytes{ReadFromGCS: 3, ReadFromFileCache: 4})
+	CaptureFileCacheMetrics(ctx, "Sequential", 4, true, 0)
+	CaptureFileCacheMetrics(ctx, "Sequential", 4, true, 0)
+	CaptureFileCacheMetrics(ctx, "Random", 4, true, 0)
+	CaptureFileCacheMetrics(ctx, "Random", 4, false, 0)
+	clock.AdvanceTime(90 * time.Second)
+
+	s := r.Finish()
+
+	assert.Equal(t, 90.0, s.DurationSeconds)
+	assert.Equal(t, map[string]int64{"LookUpInode": 2, "WriteFile": 1}, s.OpsCount)
+	assert.Equal(t, map[string]int64{"no such file or directory": 1}, s.OpsErrorCount)
+	assert.Equal(t, int64(7), s.ReadBytes)
+	assert.Equal(t, int64(5), s.WrittenBytes)
+	assert.Equal(t, int64(3), s.FileCacheHitCount)
+	assert.Equal(t, int64(1), s.FileCacheMissCount)
+	assert.Equal(t, 0.75, s.FileCacheHitRatio)
+	assert.Equal(t, map[string]int64{"StatObject": 2, "NewReader": 1}, s.GCSRequestCount)
+	assert.Positive(t, s.PeakMemoryBytes)
+}
+
+func TestSessionRecorder_FinishedRecordsNothing(t *testing.T) {
+	r := NewSessionRecorder(timeutil.RealClock())
+	ctx := context.Background()
+	recordRequest(ctx, "ListObjects", time.Now())
+	r.Finish()
+
+	recordRequest(ctx, "ListObjects", time.Now())
+	r.RecordOp("ReadDir", "")
+	s := r.Finish()
+
+	assert.Equal(t, map[string]int64{"ListObjects": 1}, s.GCSRequestCount)
+	assert.Empty(t, s.OpsCount)
+	assert.Zero(t, s.FileCacheHitRatio)
+}
+
+func TestSessionSummary_WriteFile(t *testing.T) {
+	name := path.Join(t.TempDir(), "summary.json")
+	s := SessionSummary{
+		DurationSeconds: 1.5,
+		OpsCount:        map[string]int64{"ReadFile": 2},
+		ReadBytes:       10,
+	}
+
+	require.NoError(t, s.WriteFile(name))
+
+	b, err := os.ReadFile(name)
+	require.NoError(t, err)
+	var got SessionSummary
+	require.NoError(t, json.Unmarshal(b, &got))
+	assert.Equal(t, s, got)
+}
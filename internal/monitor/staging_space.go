@@ -0,0 +1,60 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"log"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/monitor/tags"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+	"golang.org/x/net/context"
+)
+
+var stagingSpaceRejectionCount = stats.Int64("fs/staging_space_rejection_count",
+	"The number of file system operations failed with ENOSPC because the staging file system was nearly full.",
+	stats.UnitDimensionless)
+
+// Initialize the metrics.
+func init() {
+	if err := view.Register(
+		&view.View{
+			Name:        "fs/staging_space_rejection_count",
+			Measure:     stagingSpaceRejectionCount,
+			Description: "The cumulative number of file system operations failed with ENOSPC because the staging file system was nearly full.",
+			Aggregation: view.Sum(),
+			TagKeys:     []tag.Key{tags.FSOp},
+		},
+	); err != nil {
+		log.Fatalf("Failed to register the staging space views: %v", err)
+	}
+}
+
+// CaptureStagingSpaceRejectionMetrics records that the file system operation
+// fsOp, e.g. "WriteFile", failed early because the staging file system had
+// less free space than required.
+func CaptureStagingSpaceRejectionMetrics(ctx context.Context, fsOp string) {
+	if err := stats.RecordWithTags(
+		ctx,
+		[]tag.Mutator{
+			tag.Upsert(tags.FSOp, fsOp),
+		},
+		stagingSpaceRejectionCount.M(1),
+	); err != nil {
+		logger.Errorf("Cannot record staging space metrics: %v", err)
+	}
+}
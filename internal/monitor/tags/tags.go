@@ -32,9 +32,46 @@ var (
 	// FSError annotates the file system failed operations with the error type
 	FSError = tag.MustNewKey("fs_error")
 
+	// FSErrno annotates the file system failed operations with the name of
+	// their errno, e.g. ENOENT, if --metrics-detailed-errors is set.
+	FSErrno = tag.MustNewKey("fs_errno")
+
 	// ReadType annotates the read operation with the type - Sequential/Random
 	ReadType = tag.MustNewKey("read_type")
 
 	// CacheHit annotates the read operation from file cache with true or false.
 	CacheHit = tag.MustNewKey("cache_hit")
+
+	// Pattern annotates an advisory with the access pattern it's on.
+	Pattern = tag.MustNewKey("pattern")
+
+	// WriteOutcome annotates a write paced to the per-object write rate with
+	// whether it was delayed or coalesced into another.
+	WriteOutcome = tag.MustNewKey("write_outcome")
+
+	// ReadSource annotates bytes returned by reads with where they were served
+	// from.
+	ReadSource = tag.MustNewKey("read_source")
+
+	// RequestCategory annotates GCS requests with the category they are
+	// throttled in: metadata or data.
+	RequestCategory = tag.MustNewKey("request_category")
+
+	// PrevDirType and DirType annotate a directory that resolved to another
+	// kind of directory than before with the kinds it resolved to: explicit or
+	// implicit.
+	PrevDirType = tag.MustNewKey("prev_dir_type")
+	DirType     = tag.MustNewKey("dir_type")
+
+	// WasteCause annotates bytes downloaded from GCS but never delivered to
+	// the application with why they were wasted.
+	WasteCause = tag.MustNewKey("waste_cause")
+
+	// MountMode annotates the mount with whether it is read-write or
+	// read-only.
+	MountMode = tag.MustNewKey("mount_mode")
+
+	// LimitOutcome annotates a metadata request held to
+	// --max-metadata-ops-per-sec with whether it was delayed or refused.
+	LimitOutcome = tag.MustNewKey("limit_outcome")
 )
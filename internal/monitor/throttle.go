@@ -0,0 +1,60 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"log"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/monitor/tags"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+	"golang.org/x/net/context"
+)
+
+var throttleDelay = stats.Float64("gcs/throttle_delay",
+	"The interval GCS requests are paced to while GCS throttles them.",
+	stats.UnitMilliseconds)
+
+// Initialize the metrics.
+func init() {
+	if err := view.Register(
+		&view.View{
+			Name:        "gcs/throttle_delay",
+			Measure:     throttleDelay,
+			Description: "The interval GCS requests are paced to while GCS throttles them, by request category, or zero if they aren't.",
+			Aggregation: view.LastValue(),
+			TagKeys:     []tag.Key{tags.RequestCategory},
+		},
+	); err != nil {
+		log.Fatalf("Failed to register the throttle views: %v", err)
+	}
+}
+
+// CaptureThrottleDelayMetrics records the interval the requests of the
+// category are paced to, zero if they aren't.
+func CaptureThrottleDelayMetrics(ctx context.Context, category string, delay time.Duration) {
+	if err := stats.RecordWithTags(
+		ctx,
+		[]tag.Mutator{
+			tag.Upsert(tags.RequestCategory, category),
+		},
+		throttleDelay.M(float64(delay)/float64(time.Millisecond)),
+	); err != nil {
+		logger.Errorf("Cannot record throttle metrics: %v", err)
+	}
+}
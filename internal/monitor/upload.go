@@ -0,0 +1,65 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"log"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"golang.org/x/net/context"
+)
+
+var (
+	backgroundUploadCount = stats.Int64("fs/background_upload_count",
+		"The number of file uploads run in the background after the file was closed.",
+		stats.UnitDimensionless)
+	backgroundUploadErrorCount = stats.Int64("fs/background_upload_error_count",
+		"The number of file uploads run in the background that failed.",
+		stats.UnitDimensionless)
+)
+
+// Initialize the metrics.
+func init() {
+	if err := view.Register(
+		&view.View{
+			Name:        "fs/background_upload_count",
+			Measure:     backgroundUploadCount,
+			Description: "The cumulative number of file uploads run in the background after the file was closed.",
+			Aggregation: view.Sum(),
+		},
+		&view.View{
+			Name:        "fs/background_upload_error_count",
+			Measure:     backgroundUploadErrorCount,
+			Description: "The cumulative number of file uploads run in the background that failed.",
+			Aggregation: view.Sum(),
+		},
+	); err != nil {
+		log.Fatalf("Failed to register the upload views: %v", err)
+	}
+}
+
+// CaptureBackgroundUploadMetrics records the outcome of one background upload.
+func CaptureBackgroundUploadMetrics(ctx context.Context, err error) {
+	measurements := []stats.Measurement{backgroundUploadCount.M(1)}
+	if err != nil {
+		measurements = append(measurements, backgroundUploadErrorCount.M(1))
+	}
+
+	if err := stats.RecordWithTags(ctx, nil, measurements...); err != nil {
+		logger.Errorf("Cannot record background upload metrics: %v", err)
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"log"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/monitor/tags"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+	"golang.org/x/net/context"
+)
+
+// The causes of bytes downloaded from GCS but never delivered to the
+// application.
+const (
+	// Bytes a reader fetched past what was read before it was closed or
+	// skipped over, e.g. because the application seeked elsewhere.
+	WasteOverread = "overread"
+
+	// Bytes of a file cache download that was cancelled or evicted before it
+	// completed, and were never read.
+	WasteCanceledPrefetch = "canceled_prefetch"
+
+	// Bytes of a completely downloaded file cache entry that were never read
+	// before it was evicted.
+	WasteEvictedUnreadCache = "evicted_unread_cache"
+)
+
+var wastedBytesCount = stats.Int64("gcs/wasted_bytes",
+	"The number of bytes downloaded from GCS that were never delivered to the application.",
+	stats.UnitBytes)
+
+// Initialize the metrics.
+func init() {
+	if err := view.Register(
+		&view.View{
+			Name:        "gcs/wasted_bytes",
+			Measure:     wastedBytesCount,
+			Description: "The cumulative number of bytes downloaded from GCS that were never delivered to the application, by the cause.",
+			Aggregation: view.Sum(),
+			TagKeys:     []tag.Key{tags.WasteCause},
+		},
+	); err != nil {
+		log.Fatalf("Failed to register the wasted bytes views: %v", err)
+	}
+}
+
+// CaptureWastedBytesMetrics records that n bytes downloaded from GCS were
+// wasted for the given cause, e.g. WasteOverread.
+func CaptureWastedBytesMetrics(ctx context.Context, cause string, n int64) {
+	if n <= 0 {
+		return
+	}
+
+	if err := stats.RecordWithTags(
+		ctx,
+		[]tag.Mutator{
+			tag.Upsert(tags.WasteCause, cause),
+		},
+		wastedBytesCount.M(n),
+	); err != nil {
+		logger.Errorf("Cannot record wasted bytes metrics: %v", err)
+	}
+}
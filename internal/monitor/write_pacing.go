@@ -0,0 +1,67 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"log"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/monitor/tags"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+	"golang.org/x/net/context"
+)
+
+// The outcomes of writes paced to the per-object write rate of GCS.
+const (
+	// The write waited for the slot of its object.
+	WriteDelayed = "delayed"
+
+	// The flush waited, and meanwhile its contents were written by another.
+	WriteCoalesced = "coalesced"
+)
+
+var pacedWriteCount = stats.Int64("gcs/paced_write_count",
+	"The number of writes paced to the per-object write rate.",
+	stats.UnitDimensionless)
+
+// Initialize the metrics.
+func init() {
+	if err := view.Register(
+		&view.View{
+			Name:        "gcs/paced_write_count",
+			Measure:     pacedWriteCount,
+			Description: "The cumulative number of writes paced to the per-object write rate, by outcome.",
+			Aggregation: view.Sum(),
+			TagKeys:     []tag.Key{tags.WriteOutcome},
+		},
+	); err != nil {
+		log.Fatalf("Failed to register the write pacing views: %v", err)
+	}
+}
+
+// CaptureWritePacingMetrics records a write paced with the given outcome.
+func CaptureWritePacingMetrics(ctx context.Context, outcome string) {
+	if err := stats.RecordWithTags(
+		ctx,
+		[]tag.Mutator{
+			tag.Upsert(tags.WriteOutcome, outcome),
+		},
+		pacedWriteCount.M(1),
+	); err != nil {
+		logger.Errorf("Cannot record write pacing metrics: %v", err)
+	}
+}
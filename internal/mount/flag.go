@@ -20,6 +20,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/metadata"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/config"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/util"
 )
@@ -45,12 +46,25 @@ const (
 	// meant for two purposes.
 	// 1. for conversion from stat-cache-capacity to stat-cache-max-size-mb.
 	// 2. internal testing.
-	AverageSizeOfPositiveStatCacheEntry uint64 = 1400
+	AverageSizeOfPositiveStatCacheEntry uint64 = 1480
 	// AverageSizeOfNegativeStatCacheEntry is the assumed size of each negative stat-cache-entry,
 	// meant for two purposes..
 	// 1. for conversion from stat-cache-capacity to stat-cache-max-size-mb.
 	// 2. internal testing.
 	AverageSizeOfNegativeStatCacheEntry uint64 = 240
+	// DefaultLockFileTTL is the default for lock-file-ttl.
+	DefaultLockFileTTL = 5 * time.Minute
+	// DefaultDirSizeXattrMaxObjects is the default for
+	// dir-size-xattr-max-objects.
+	DefaultDirSizeXattrMaxObjects = 100000
+	// DefaultDirSizeXattrParallelism is the default for
+	// dir-size-xattr-parallelism.
+	DefaultDirSizeXattrParallelism = 16
+	// DefaultMetadataQueryMaxObjects is the default for
+	// metadata-query-max-objects.
+	DefaultMetadataQueryMaxObjects = 100000
+	// DefaultMetadataQueryTimeout is the default for metadata-query-timeout.
+	DefaultMetadataQueryTimeout = 30 * time.Second
 )
 
 func (cp ClientProtocol) IsValid() bool {
@@ -117,6 +131,24 @@ func ResolveMetadataCacheTTL(statCacheTTL, typeCacheTTL time.Duration, ttlInSeco
 	return
 }
 
+// ResolveEntryTTLs returns the ttls of the metadata cache and the inode
+// attributes, and those of the entries cached by the kernel, for files and
+// for directories, from the --file-entry-ttl and --dir-entry-ttl flags. Where
+// a flag is negative, i.e. unset, that kind is cached for metadataCacheTTL,
+// and its entries aren't cached by the kernel, as before the flags.
+func ResolveEntryTTLs(fileEntryTTL, dirEntryTTL, metadataCacheTTL time.Duration) (metadataTTLs, entryTTLs metadata.EntryTTLs) {
+	resolve := func(flag time.Duration) (metadataTTL, entryTTL time.Duration) {
+		if flag < 0 {
+			return metadataCacheTTL, 0
+		}
+		return flag, flag
+	}
+
+	metadataTTLs.File, entryTTLs.File = resolve(fileEntryTTL)
+	metadataTTLs.Dir, entryTTLs.Dir = resolve(dirEntryTTL)
+	return
+}
+
 // ResolveStatCacheMaxSizeMB returns the stat-cache size in MiBs based on the user old and new flags/configs.
 func ResolveStatCacheMaxSizeMB(mountConfigStatCacheMaxSizeMB int64, flagStatCacheCapacity int) (statCacheMaxSizeMB uint64, err error) {
 	if mountConfigStatCacheMaxSizeMB != config.StatCacheMaxSizeMBUnsetSentinel {
@@ -19,6 +19,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/metadata"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/config"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
@@ -136,6 +137,40 @@ func (t *FlagTest) TestResolveMetadataCacheTTL() {
 	}
 }
 
+func (t *FlagTest) TestResolveEntryTTLs() {
+	for _, input := range []struct {
+		fileEntryTTL        time.Duration
+		dirEntryTTL         time.Duration
+		expectedMetadataTTL metadata.EntryTTLs
+		expectedEntryTTL    metadata.EntryTTLs
+	}{
+		{
+			// Neither flag set: as with only the old flags.
+			fileEntryTTL:        -time.Second,
+			dirEntryTTL:         -time.Second,
+			expectedMetadataTTL: metadata.SameEntryTTLs(time.Minute),
+			expectedEntryTTL:    metadata.EntryTTLs{},
+		},
+		{
+			fileEntryTTL:        5 * time.Second,
+			dirEntryTTL:         -time.Second,
+			expectedMetadataTTL: metadata.EntryTTLs{File: 5 * time.Second, Dir: time.Minute},
+			expectedEntryTTL:    metadata.EntryTTLs{File: 5 * time.Second},
+		},
+		{
+			fileEntryTTL:        0,
+			dirEntryTTL:         time.Hour,
+			expectedMetadataTTL: metadata.EntryTTLs{File: 0, Dir: time.Hour},
+			expectedEntryTTL:    metadata.EntryTTLs{File: 0, Dir: time.Hour},
+		},
+	} {
+		metadataTTLs, entryTTLs := ResolveEntryTTLs(input.fileEntryTTL, input.dirEntryTTL, time.Minute)
+
+		assert.Equal(t.T(), input.expectedMetadataTTL, metadataTTLs)
+		assert.Equal(t.T(), input.expectedEntryTTL, entryTTLs)
+	}
+}
+
 func (t *FlagTest) TestResolveStatCacheMaxSizeMB() {
 	for _, input := range []struct {
 		// Equivalent of user-setting of flag --stat-cache-capacity.
@@ -205,7 +240,7 @@ func (t *FlagTest) TestResolveStatCacheMaxSizeMB() {
 			// Old-scenario where user sets only stat-cache-capacity flag(s), and not metadata-cache:stat-cache-max-size-mb. Case 2: stat-cache-capacity is non-zero.
 			flagStatCacheCapacity:         10000,
 			mountConfigStatCacheMaxSizeMB: config.StatCacheMaxSizeMBUnsetSentinel,
-			expectedStatCacheMaxSizeMB:    16, // 16 MiB = MiB ceiling (10k entries * 1640 bytes (AssumedSizeOfPositiveStatCacheEntry + AssumedSizeOfNegativeStatCacheEntry))
+			expectedStatCacheMaxSizeMB:    17, // 17 MiB = MiB ceiling (10k entries * 1720 bytes (AssumedSizeOfPositiveStatCacheEntry + AssumedSizeOfNegativeStatCacheEntry))
 		},
 	} {
 		statCacheMaxSizeMB, err := ResolveStatCacheMaxSizeMB(input.mountConfigStatCacheMaxSizeMB, input.flagStatCacheCapacity)
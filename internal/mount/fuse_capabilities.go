@@ -0,0 +1,171 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mount
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
+	"github.com/jacobsa/fuse"
+)
+
+// FuseCapabilitiesComponent is the component name carried by the record of
+// the fuse capabilities of a mount.
+const FuseCapabilitiesComponent = "fuse_capabilities"
+
+// The capabilities of the fuse protocol that gcsfuse may ask the kernel for
+// in the INIT exchange at mount time, named as in the kernel's fuse.h.
+const (
+	FuseCapBigWrites      = "big_writes"
+	FuseCapAsyncRead      = "async_read"
+	FuseCapMaxPages       = "max_pages"
+	FuseCapWritebackCache = "writeback_cache"
+	FuseCapParallelDirOps = "parallel_dirops"
+)
+
+// fuseCapabilityKernels is the first Linux release whose fuse driver offers
+// each capability. The kernel ignores the flags of capabilities it doesn't
+// offer, and the fuse library doesn't report those it offered, so its release
+// is what tells which were granted.
+var fuseCapabilityKernels = map[string][3]int{
+	FuseCapBigWrites:      {2, 6, 26},
+	FuseCapAsyncRead:      {2, 6, 14},
+	FuseCapMaxPages:       {4, 20, 0},
+	FuseCapWritebackCache: {3, 15, 0},
+	FuseCapParallelDirOps: {4, 7, 0},
+}
+
+// fuseCapabilityLosses describes what changes when a capability isn't
+// granted.
+var fuseCapabilityLosses = map[string]string{
+	FuseCapBigWrites:      "writes arrive one page at a time",
+	FuseCapAsyncRead:      "reads of a file arrive one at a time",
+	FuseCapMaxPages:       "reads and writes arrive in requests of at most 128 KiB",
+	FuseCapWritebackCache: "writes arrive as they are made instead of being gathered by the kernel",
+	FuseCapParallelDirOps: "lookups and listings in a directory arrive one at a time",
+}
+
+// FuseCapabilities records the fuse capabilities asked of the kernel at mount
+// time, and which of them it grants.
+type FuseCapabilities struct {
+	// The release of the running kernel, as reported by uname(2).
+	Kernel string `yaml:"kernel"`
+
+	Requested []string `yaml:"requested"`
+	Granted   []string `yaml:"granted"`
+	Missing   []string `yaml:"missing"`
+}
+
+// RequestedFuseCapabilities returns the capabilities the fuse library asks
+// the kernel for when mounting with the given config.
+func RequestedFuseCapabilities(cfg *fuse.MountConfig) (caps []string) {
+	caps = append(caps, FuseCapBigWrites)
+	if cfg.EnableAsyncReads {
+		caps = append(caps, FuseCapAsyncRead)
+	}
+	caps = append(caps, FuseCapMaxPages)
+	if !cfg.DisableWritebackCaching {
+		caps = append(caps, FuseCapWritebackCache)
+	}
+	if cfg.EnableParallelDirOps {
+		caps = append(caps, FuseCapParallelDirOps)
+	}
+	return
+}
+
+// parseKernelRelease returns the version at the start of a release such as
+// "5.15.0-1057-gcp".
+func parseKernelRelease(release string) (v [3]int, err error) {
+	parts := strings.SplitN(release, ".", 3)
+	if len(parts) < 2 {
+		err = fmt.Errorf("kernel release %q: no version", release)
+		return
+	}
+	for i, p := range parts {
+		// Stop at the first character that isn't a digit, e.g. the "-1057-gcp"
+		// above.
+		digits := p
+		if j := strings.IndexFunc(p, func(r rune) bool { return r < '0' || r > '9' }); j >= 0 {
+			digits = p[:j]
+		}
+		if v[i], err = strconv.Atoi(digits); err != nil {
+			err = fmt.Errorf("kernel release %q: %w", release, err)
+			return
+		}
+	}
+	return
+}
+
+// NegotiateFuseCapabilities returns which of the requested capabilities the
+// kernel of the given release grants.
+func NegotiateFuseCapabilities(kernelRelease string, requested []string) (*FuseCapabilities, error) {
+	v, err := parseKernelRelease(kernelRelease)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &FuseCapabilities{
+		Kernel:    kernelRelease,
+		Requested: requested,
+		Granted:   []string{},
+		Missing:   []string{},
+	}
+	for _, name := range requested {
+		if first, ok := fuseCapabilityKernels[name]; ok && slices.Compare(v[:], first[:]) < 0 {
+			c.Missing = append(c.Missing, name)
+		} else {
+			c.Granted = append(c.Granted, name)
+		}
+	}
+	return c, nil
+}
+
+// Degrade stops cfg from asking for the capabilities that the kernel won't
+// grant, so that what the file system assumes agrees with what it gets, and
+// returns what changes because of each of them.
+func (c *FuseCapabilities) Degrade(cfg *fuse.MountConfig) (losses []string) {
+	for _, name := range c.Missing {
+		switch name {
+		case FuseCapAsyncRead:
+			cfg.EnableAsyncReads = false
+		case FuseCapWritebackCache:
+			cfg.DisableWritebackCaching = true
+		case FuseCapParallelDirOps:
+			cfg.EnableParallelDirOps = false
+		}
+		losses = append(losses, fmt.Sprintf("%s: %s", name, fuseCapabilityLosses[name]))
+	}
+	return
+}
+
+// Log writes the capabilities as one record of the FuseCapabilitiesComponent,
+// at WARNING if some of them are missing, along with the given losses.
+func (c *FuseCapabilities) Log(losses []string) {
+	level := logger.LevelInfo
+	if len(c.Missing) > 0 {
+		level = logger.LevelWarn
+	}
+	logger.NewComponentLogger(FuseCapabilitiesComponent).Log(context.Background(), level, "Fuse capabilities",
+		slog.String("kernel", c.Kernel),
+		slog.Any("requested", c.Requested),
+		slog.Any("granted", c.Granted),
+		slog.Any("missing", c.Missing),
+		slog.Any("degraded", losses))
+}
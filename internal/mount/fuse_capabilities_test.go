@@ -0,0 +1,111 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mount
+
+import (
+	"testing"
+
+	"github.com/jacobsa/fuse"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestedFuseCapabilities(t *testing.T) {
+	assert.Equal(t,
+		[]string{FuseCapBigWrites, FuseCapMaxPages, FuseCapWritebackCache, FuseCapParallelDirOps},
+		RequestedFuseCapabilities(&fuse.MountConfig{EnableParallelDirOps: true}))
+	assert.Equal(t,
+		[]string{FuseCapBigWrites, FuseCapAsyncRead, FuseCapMaxPages},
+		RequestedFuseCapabilities(&fuse.MountConfig{EnableAsyncReads: true, DisableWritebackCaching: true}))
+}
+
+func TestParseKernelRelease(t *testing.T) {
+	for release, expected := range map[string][3]int{
+		"5.15.0-1057-gcp":   {5, 15, 0},
+		"6.1.90+":           {6, 1, 90},
+		"4.20-rc1":          {4, 20, 0},
+		"3.10.0-1160.el7":   {3, 10, 0},
+		"6.8.0-45-generic":  {6, 8, 0},
+		"4.19.112+rpt-rpi4": {4, 19, 112},
+	} {
+		v, err := parseKernelRelease(release)
+		require.NoError(t, err, release)
+		assert.Equal(t, expected, v, release)
+	}
+}
+
+func TestParseKernelRelease_Invalid(t *testing.T) {
+	for _, release := range []string{"", "5", "x.y.z", "5.x"} {
+		_, err := parseKernelRelease(release)
+		assert.ErrorContains(t, err, "kernel release", release)
+	}
+}
+
+func TestNegotiateFuseCapabilities_AllGranted(t *testing.T) {
+	requested := RequestedFuseCapabilities(&fuse.MountConfig{EnableParallelDirOps: true})
+
+	c, err := NegotiateFuseCapabilities("6.1.0-18-amd64", requested)
+
+	require.NoError(t, err)
+	assert.Equal(t, "6.1.0-18-amd64", c.Kernel)
+	assert.Equal(t, requested, c.Granted)
+	assert.Empty(t, c.Missing)
+}
+
+func TestNegotiateFuseCapabilities_OldKernel(t *testing.T) {
+	requested := RequestedFuseCapabilities(&fuse.MountConfig{EnableParallelDirOps: true})
+
+	c, err := NegotiateFuseCapabilities("4.19.0-26-cloud-amd64", requested)
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{FuseCapBigWrites, FuseCapWritebackCache, FuseCapParallelDirOps}, c.Granted)
+	assert.Equal(t, []string{FuseCapMaxPages}, c.Missing)
+}
+
+func TestNegotiateFuseCapabilities_InvalidRelease(t *testing.T) {
+	_, err := NegotiateFuseCapabilities("unknown", []string{FuseCapMaxPages})
+
+	assert.Error(t, err)
+}
+
+func TestDegrade(t *testing.T) {
+	cfg := &fuse.MountConfig{EnableParallelDirOps: true, EnableAsyncReads: true}
+	c, err := NegotiateFuseCapabilities("2.6.32-754.el6", RequestedFuseCapabilities(cfg))
+	require.NoError(t, err)
+	require.Equal(t, []string{FuseCapMaxPages, FuseCapWritebackCache, FuseCapParallelDirOps}, c.Missing)
+
+	losses := c.Degrade(cfg)
+
+	// What the kernel doesn't offer is no longer asked for, and so no longer
+	// missing.
+	assert.True(t, cfg.DisableWritebackCaching)
+	assert.False(t, cfg.EnableParallelDirOps)
+	assert.True(t, cfg.EnableAsyncReads)
+	assert.Equal(t, []string{FuseCapBigWrites, FuseCapAsyncRead, FuseCapMaxPages}, RequestedFuseCapabilities(cfg))
+	require.Len(t, losses, 3)
+	assert.Contains(t, losses[0], "max_pages: reads and writes arrive in requests of at most 128 KiB")
+}
+
+func TestDegrade_NothingMissing(t *testing.T) {
+	cfg := &fuse.MountConfig{EnableParallelDirOps: true}
+	c, err := NegotiateFuseCapabilities("5.10.0", RequestedFuseCapabilities(cfg))
+	require.NoError(t, err)
+
+	losses := c.Degrade(cfg)
+
+	assert.Empty(t, losses)
+	assert.False(t, cfg.DisableWritebackCaching)
+	assert.True(t, cfg.EnableParallelDirOps)
+}
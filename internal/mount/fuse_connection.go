@@ -0,0 +1,53 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mount
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"golang.org/x/sys/unix"
+)
+
+// FuseConnectionsDir is where the fusectl file system exposes the settings of
+// fuse connections, on Linux.
+const FuseConnectionsDir = "/sys/fs/fuse/connections"
+
+func setMaxBackground(connectionsDir string, dir string, n int) error {
+	// Connections are named after the device number of their file system,
+	// which has major number zero.
+	var st unix.Stat_t
+	if err := unix.Stat(dir, &st); err != nil {
+		return fmt.Errorf("stat %q: %w", dir, err)
+	}
+	connectionDir := filepath.Join(connectionsDir, strconv.FormatUint(uint64(unix.Minor(uint64(st.Dev))), 10))
+
+	for _, setting := range []struct {
+		name  string
+		value int
+	}{
+		{"max_background", n},
+		{"congestion_threshold", max(1, n*3/4)},
+	} {
+		p := filepath.Join(connectionDir, setting.name)
+		if err := os.WriteFile(p, []byte(strconv.Itoa(setting.value)+"\n"), 0); err != nil {
+			return fmt.Errorf("write %q: %w", p, err)
+		}
+	}
+
+	return nil
+}
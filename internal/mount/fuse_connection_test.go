@@ -0,0 +1,73 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mount
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+// Make a fake connections directory with an entry for the file system of dir.
+func fakeConnectionDir(t *testing.T, dir string) (connectionsDir string, connectionDir string) {
+	var st unix.Stat_t
+	require.NoError(t, unix.Stat(dir, &st))
+
+	connectionsDir = t.TempDir()
+	connectionDir = filepath.Join(connectionsDir, strconv.FormatUint(uint64(unix.Minor(uint64(st.Dev))), 10))
+	require.NoError(t, os.Mkdir(connectionDir, 0700))
+	for _, name := range []string{"max_background", "congestion_threshold"} {
+		require.NoError(t, os.WriteFile(filepath.Join(connectionDir, name), []byte("12\n"), 0600))
+	}
+	return
+}
+
+func readSetting(t *testing.T, connectionDir string, name string) string {
+	contents, err := os.ReadFile(filepath.Join(connectionDir, name))
+	require.NoError(t, err)
+	return string(contents)
+}
+
+func TestSetMaxBackground(t *testing.T) {
+	dir := t.TempDir()
+	connectionsDir, connectionDir := fakeConnectionDir(t, dir)
+
+	err := setMaxBackground(connectionsDir, dir, 96)
+
+	require.NoError(t, err)
+	assert.Equal(t, "96\n", readSetting(t, connectionDir, "max_background"))
+	assert.Equal(t, "72\n", readSetting(t, connectionDir, "congestion_threshold"))
+}
+
+func TestSetMaxBackground_One(t *testing.T) {
+	dir := t.TempDir()
+	connectionsDir, connectionDir := fakeConnectionDir(t, dir)
+
+	err := setMaxBackground(connectionsDir, dir, 1)
+
+	require.NoError(t, err)
+	assert.Equal(t, "1\n", readSetting(t, connectionDir, "congestion_threshold"))
+}
+
+func TestSetMaxBackground_NoConnection(t *testing.T) {
+	err := setMaxBackground(t.TempDir(), t.TempDir(), 96)
+
+	assert.ErrorContains(t, err, "max_background")
+}
@@ -0,0 +1,78 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mount
+
+import (
+	"fmt"
+	"net"
+
+	"golang.org/x/sys/unix"
+)
+
+// FuseFdPath returns the mount point under which the fuse library serves a
+// file system on fd, an open /dev/fuse that someone else has mounted, rather
+// than mounting one itself.
+func FuseFdPath(fd int) (string, error) {
+	var st unix.Stat_t
+	if err := unix.Fstat(fd, &st); err != nil {
+		return "", fmt.Errorf("fstat %d: %w", fd, err)
+	}
+	if st.Mode&unix.S_IFMT != unix.S_IFCHR {
+		return "", fmt.Errorf("file descriptor %d isn't a character device", fd)
+	}
+
+	return fuseFdPath(fd)
+}
+
+// ReceiveFuseFd connects to the unix socket at path and returns the file
+// descriptor, e.g. of /dev/fuse, that the listener sends over it as
+// SCM_RIGHTS ancillary data.
+func ReceiveFuseFd(path string) (fd int, err error) {
+	conn, err := net.DialUnix("unix", nil, &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		return -1, fmt.Errorf("dial %q: %w", path, err)
+	}
+	defer conn.Close()
+
+	// The descriptor must come with at least one byte of data.
+	buf := make([]byte, 1)
+	oob := make([]byte, unix.CmsgSpace(4))
+	_, oobn, _, _, err := conn.ReadMsgUnix(buf, oob)
+	if err != nil {
+		return -1, fmt.Errorf("receive from %q: %w", path, err)
+	}
+
+	msgs, err := unix.ParseSocketControlMessage(oob[:oobn])
+	if err != nil {
+		return -1, fmt.Errorf("parse control message from %q: %w", path, err)
+	}
+
+	var fds []int
+	for i := range msgs {
+		rights, err := unix.ParseUnixRights(&msgs[i])
+		if err != nil {
+			continue
+		}
+		fds = append(fds, rights...)
+	}
+	if len(fds) != 1 {
+		for _, fd := range fds {
+			unix.Close(fd)
+		}
+		return -1, fmt.Errorf("received %d file descriptors from %q, want 1", len(fds), path)
+	}
+
+	return fds[0], nil
+}
@@ -0,0 +1,103 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mount
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+// Listen on a unix socket and send the given files to the first client in one
+// message.
+func serveFds(t *testing.T, files ...*os.File) (path string) {
+	path = filepath.Join(t.TempDir(), "fuse.sock")
+	l, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		conn, err := l.AcceptUnix()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		var fds []int
+		for _, f := range files {
+			fds = append(fds, int(f.Fd()))
+		}
+		conn.WriteMsgUnix([]byte{0}, unix.UnixRights(fds...), nil)
+	}()
+
+	return
+}
+
+func TestFuseFdPath_NotACharacterDevice(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), "foo"))
+	require.NoError(t, err)
+	defer f.Close()
+
+	_, err = FuseFdPath(int(f.Fd()))
+
+	assert.ErrorContains(t, err, "isn't a character device")
+}
+
+func TestFuseFdPath_Closed(t *testing.T) {
+	f, err := os.Open("/dev/null")
+	require.NoError(t, err)
+	fd := int(f.Fd())
+	f.Close()
+
+	_, err = FuseFdPath(fd)
+
+	assert.ErrorContains(t, err, "fstat")
+}
+
+func TestReceiveFuseFd(t *testing.T) {
+	f, err := os.Open("/dev/null")
+	require.NoError(t, err)
+	defer f.Close()
+	path := serveFds(t, f)
+
+	fd, err := ReceiveFuseFd(path)
+
+	require.NoError(t, err)
+	defer unix.Close(fd)
+	assert.NotEqual(t, int(f.Fd()), fd)
+	var want, got unix.Stat_t
+	require.NoError(t, unix.Fstat(int(f.Fd()), &want))
+	require.NoError(t, unix.Fstat(fd, &got))
+	assert.Equal(t, want.Rdev, got.Rdev)
+}
+
+func TestReceiveFuseFd_None(t *testing.T) {
+	path := serveFds(t)
+
+	_, err := ReceiveFuseFd(path)
+
+	assert.ErrorContains(t, err, "received 0 file descriptors")
+}
+
+func TestReceiveFuseFd_NoListener(t *testing.T) {
+	_, err := ReceiveFuseFd(filepath.Join(t.TempDir(), "fuse.sock"))
+
+	assert.ErrorContains(t, err, "dial")
+}
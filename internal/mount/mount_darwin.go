@@ -0,0 +1,64 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mount
+
+import (
+	"errors"
+	"fmt"
+)
+
+// darwinUnsupportedMountOptions are understood by Linux's fusermount but
+// rejected by the mount helpers of macFUSE and fuse-t. Mounting over a
+// non-empty directory is checked by gcsfuse itself.
+var darwinUnsupportedMountOptions = []string{"nonempty"}
+
+// SetPlatformMountOptions adds to the given mount options the defaults of
+// this platform, without overriding any given. On macOS the volume is shown as
+// a local disk, and options only Linux understands are dropped. The fuse
+// library already sets volname and noappledouble.
+func SetPlatformMountOptions(opts map[string]string) {
+	if _, ok := opts["local"]; !ok {
+		opts["local"] = ""
+	}
+
+	for _, o := range darwinUnsupportedMountOptions {
+		delete(opts, o)
+	}
+}
+
+// SetMaxBackground is not supported on macOS, which has no fusectl file
+// system.
+func SetMaxBackground(dir string, n int) error {
+	return fmt.Errorf("setting the fuse connection's max_background: %w on macOS", errors.ErrUnsupported)
+}
+
+// The fuse library can't serve a file system mounted by someone else on macOS.
+func fuseFdPath(fd int) (string, error) {
+	return "", fmt.Errorf("serving file descriptor %d: %w on macOS", fd, errors.ErrUnsupported)
+}
+
+// macOS has no lazy unmount; force the unmount instead.
+func lazyUnmountCommands(dir string) [][]string {
+	return [][]string{
+		{"umount", "-f", dir},
+		{"diskutil", "unmount", "force", dir},
+	}
+}
+
+// KernelRelease is not supported on macOS, where the fuse capabilities depend
+// on the version of macFUSE or fuse-t instead.
+func KernelRelease() (string, error) {
+	return "", fmt.Errorf("reading the fuse capabilities of the kernel: %w on macOS", errors.ErrUnsupported)
+}
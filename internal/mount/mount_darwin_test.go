@@ -0,0 +1,56 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mount
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFuseFdPath(t *testing.T) {
+	f, err := os.Open("/dev/null")
+	require.NoError(t, err)
+	defer f.Close()
+
+	_, err = FuseFdPath(int(f.Fd()))
+
+	assert.True(t, errors.Is(err, errors.ErrUnsupported), "err: %v", err)
+}
+
+func TestSetPlatformMountOptions(t *testing.T) {
+	opts := map[string]string{"allow_other": "", "nonempty": ""}
+
+	SetPlatformMountOptions(opts)
+
+	assert.Equal(t, map[string]string{"allow_other": "", "local": ""}, opts)
+}
+
+func TestSetPlatformMountOptions_KeepsLocal(t *testing.T) {
+	opts := map[string]string{"local": "x"}
+
+	SetPlatformMountOptions(opts)
+
+	assert.Equal(t, map[string]string{"local": "x"}, opts)
+}
+
+func TestSetMaxBackground_Unsupported(t *testing.T) {
+	err := SetMaxBackground(t.TempDir(), 96)
+
+	assert.True(t, errors.Is(err, errors.ErrUnsupported), "err: %v", err)
+}
@@ -0,0 +1,59 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mount
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// SetPlatformMountOptions adds to the given mount options the defaults of
+// this platform, without overriding any given. Linux needs none.
+func SetPlatformMountOptions(opts map[string]string) {
+}
+
+// SetMaxBackground sets how many background requests, e.g. readahead and
+// asynchronous reads, the kernel lets be outstanding for the fuse file system
+// mounted on dir, and the number from which it considers the connection
+// congested to 3/4 of that, like the kernel's default. Writing the settings
+// requires root.
+func SetMaxBackground(dir string, n int) error {
+	return setMaxBackground(FuseConnectionsDir, dir, n)
+}
+
+// The fuse library serves the file system on an already open /dev/fuse when
+// given a mount point of this form.
+func fuseFdPath(fd int) (string, error) {
+	return fmt.Sprintf("/dev/fd/%d", fd), nil
+}
+
+func lazyUnmountCommands(dir string) [][]string {
+	return [][]string{
+		{"fusermount3", "-u", "-z", dir},
+		{"fusermount", "-u", "-z", dir},
+		{"umount", "-l", dir},
+	}
+}
+
+// KernelRelease returns the release of the running kernel, which decides the
+// fuse capabilities it grants.
+func KernelRelease() (string, error) {
+	var u unix.Utsname
+	if err := unix.Uname(&u); err != nil {
+		return "", fmt.Errorf("uname: %w", err)
+	}
+	return unix.ByteSliceToString(u.Release[:]), nil
+}
@@ -0,0 +1,42 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mount
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFuseFdPath(t *testing.T) {
+	f, err := os.Open("/dev/null")
+	require.NoError(t, err)
+	defer f.Close()
+
+	path, err := FuseFdPath(int(f.Fd()))
+
+	require.NoError(t, err)
+	assert.Regexp(t, `^/dev/fd/[0-9]+$`, path)
+}
+
+func TestSetPlatformMountOptions(t *testing.T) {
+	opts := map[string]string{"allow_other": "", "nonempty": ""}
+
+	SetPlatformMountOptions(opts)
+
+	assert.Equal(t, map[string]string{"allow_other": "", "nonempty": ""}, opts)
+}
@@ -0,0 +1,181 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mount
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// MountInfoPath is the file listing the mounts seen by this process, on
+// Linux.
+const MountInfoPath = "/proc/self/mountinfo"
+
+// MountInfo is an entry of a mountinfo file, as described in proc(5).
+type MountInfo struct {
+	ID       int
+	ParentID int
+
+	// The root of the mount within its file system, and where it is mounted.
+	Root       string
+	MountPoint string
+
+	// The per-mount options, e.g. "rw,nosuid,nodev".
+	Options string
+
+	// The file system type, e.g. "fuse.gcsfuse", and its source, e.g. the
+	// name of the mounted bucket.
+	FSType string
+	Source string
+}
+
+// IsFuse reports whether the mount is of a FUSE file system, such as another
+// gcsfuse mount.
+func (m *MountInfo) IsFuse() bool {
+	return m.FSType == "fuse" || strings.HasPrefix(m.FSType, "fuse.")
+}
+
+// ParseMountInfo parses the contents of a mountinfo file.
+func ParseMountInfo(r io.Reader) (mounts []MountInfo, err error) {
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		var m MountInfo
+		if m, err = parseMountInfoLine(scanner.Text()); err != nil {
+			err = fmt.Errorf("line %d: %w", line, err)
+			return
+		}
+		mounts = append(mounts, m)
+	}
+
+	err = scanner.Err()
+	return
+}
+
+// A line looks like this, with zero or more optional fields before the
+// separator:
+//
+//	36 35 98:0 /mnt1 /mnt2 rw,noatime master:1 - ext3 /dev/root rw,errors=continue
+func parseMountInfoLine(line string) (m MountInfo, err error) {
+	fields := strings.Fields(line)
+
+	sep := -1
+	for i := 6; i < len(fields); i++ {
+		if fields[i] == "-" {
+			sep = i
+			break
+		}
+	}
+	if sep == -1 || len(fields) < sep+3 {
+		err = fmt.Errorf("malformed mountinfo entry %q", line)
+		return
+	}
+
+	if m.ID, err = strconv.Atoi(fields[0]); err != nil {
+		err = fmt.Errorf("malformed mount ID %q", fields[0])
+		return
+	}
+	if m.ParentID, err = strconv.Atoi(fields[1]); err != nil {
+		err = fmt.Errorf("malformed parent ID %q", fields[1])
+		return
+	}
+
+	m.Root = unescapeMountInfo(fields[3])
+	m.MountPoint = unescapeMountInfo(fields[4])
+	m.Options = fields[5]
+	m.FSType = fields[sep+1]
+	m.Source = unescapeMountInfo(fields[sep+2])
+	return
+}
+
+// unescapeMountInfo undoes the octal escaping of spaces, tabs, newlines and
+// backslashes in mountinfo paths, e.g. "\040" for a space.
+func unescapeMountInfo(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) && isOctal(s[i+1:i+4]) {
+			n, _ := strconv.ParseUint(s[i+1:i+4], 8, 8)
+			b.WriteByte(byte(n))
+			i += 3
+			continue
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+func isOctal(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '7' {
+			return false
+		}
+	}
+	return true
+}
+
+// ReadMountInfo returns the mounts seen by this process, or nil where
+// MountInfoPath doesn't exist, e.g. on macOS.
+func ReadMountInfo() ([]MountInfo, error) {
+	f, err := os.Open(MountInfoPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ParseMountInfo(f)
+}
+
+// FindMount returns the topmost of the mounts on the given directory, which
+// must be an absolute path, or nil if there is none.
+func FindMount(mounts []MountInfo, dir string) *MountInfo {
+	dir = filepath.Clean(dir)
+
+	// Later entries are mounted on top of earlier ones.
+	for i := len(mounts) - 1; i >= 0; i-- {
+		if mounts[i].MountPoint == dir {
+			return &mounts[i]
+		}
+	}
+	return nil
+}
+
+// LazyUnmount detaches the FUSE file system mounted on dir, even if it's busy
+// or its server is gone; it is cleaned up once no longer in use. On macOS,
+// which can't detach a file system lazily, the unmount is forced.
+func LazyUnmount(dir string) error {
+	var errs []error
+	for _, args := range lazyUnmountCommands(dir) {
+		out, err := exec.Command(args[0], args[1:]...).CombinedOutput()
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w: %s", args[0], err, strings.TrimSpace(string(out))))
+	}
+
+	return fmt.Errorf("lazy unmount of %s: %w", dir, errors.Join(errs...))
+}
@@ -0,0 +1,109 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mount
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func parseMountInfoFile(t *testing.T, name string) []MountInfo {
+	f, err := os.Open(name)
+	require.NoError(t, err)
+	defer f.Close()
+
+	mounts, err := ParseMountInfo(f)
+	require.NoError(t, err)
+	return mounts
+}
+
+func TestParseMountInfo_Stacked(t *testing.T) {
+	mounts := parseMountInfoFile(t, "testdata/mountinfo_stacked")
+
+	require.Len(t, mounts, 6)
+	assert.Equal(t, MountInfo{
+		ID:         41,
+		ParentID:   28,
+		Root:       "/",
+		MountPoint: "/home/user/bucket",
+		Options:    "rw,nosuid,nodev,relatime",
+		FSType:     "fuse.gcsfuse",
+		Source:     "my-bucket",
+	}, mounts[3])
+}
+
+func TestParseMountInfo_EscapedPathsAndOptionalFields(t *testing.T) {
+	mounts := parseMountInfoFile(t, "testdata/mountinfo_escaped")
+
+	require.Len(t, mounts, 3)
+	assert.Equal(t, "/mnt/my bucket\ttab\\slash", mounts[1].MountPoint)
+	assert.Equal(t, "fuse", mounts[1].FSType)
+	assert.Equal(t, "/dev/fuse", mounts[1].Source)
+	assert.Equal(t, "/sub", mounts[2].Root)
+	assert.Equal(t, "ext4", mounts[2].FSType)
+}
+
+func TestParseMountInfo_Malformed(t *testing.T) {
+	f, err := os.Open("testdata/mountinfo_malformed")
+	require.NoError(t, err)
+	defer f.Close()
+
+	_, err = ParseMountInfo(f)
+
+	assert.ErrorContains(t, err, "line 1: malformed mountinfo entry")
+}
+
+func TestParseMountInfo_MalformedID(t *testing.T) {
+	_, err := ParseMountInfo(strings.NewReader("x 1 8:1 / / rw - ext4 /dev/sda1 rw\n"))
+
+	assert.ErrorContains(t, err, `malformed mount ID "x"`)
+}
+
+func TestUnescapeMountInfo(t *testing.T) {
+	assert.Equal(t, "/a b", unescapeMountInfo(`/a\040b`))
+	assert.Equal(t, `/a\b`, unescapeMountInfo(`/a\b`))
+	assert.Equal(t, `/a\04`, unescapeMountInfo(`/a\04`))
+	assert.Equal(t, `/a\089`, unescapeMountInfo(`/a\089`))
+}
+
+func TestFindMount(t *testing.T) {
+	mounts := parseMountInfoFile(t, "testdata/mountinfo_stacked")
+
+	// The topmost of the stacked mounts.
+	m := FindMount(mounts, "/home/user/bucket/")
+	require.NotNil(t, m)
+	assert.Equal(t, 52, m.ID)
+	assert.Equal(t, "other-bucket", m.Source)
+	assert.True(t, m.IsFuse())
+
+	m = FindMount(mounts, "/mnt/data")
+	require.NotNil(t, m)
+	assert.False(t, m.IsFuse())
+
+	assert.Nil(t, FindMount(mounts, "/home/user"))
+}
+
+func TestReadMountInfo(t *testing.T) {
+	mounts, err := ReadMountInfo()
+
+	require.NoError(t, err)
+	if _, err := os.Stat(MountInfoPath); err == nil {
+		assert.NotNil(t, FindMount(mounts, "/"))
+	}
+}
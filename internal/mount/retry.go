@@ -0,0 +1,142 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mount
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"golang.org/x/oauth2"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// DefaultMountRetryAttempts is the default for --mount-retry-attempts. Zero
+	// means that the first failure is final.
+	DefaultMountRetryAttempts = 0
+
+	// DefaultMountRetryBackoff is the default for --mount-retry-backoff.
+	DefaultMountRetryBackoff = time.Second
+)
+
+// IsTransientMountError reports whether err, returned while setting up the
+// storage client or probing the bucket at mount time, is likely to go away on
+// its own: name resolution failures, refused or reset connections, timeouts
+// and server-side errors. Errors that retrying can't fix, such as a missing
+// bucket or denied permission, are not transient.
+func IsTransientMountError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	// Hard errors first, so that a transient-looking wrapper can't hide them.
+	var notFoundErr *gcs.NotFoundError
+	if errors.As(err, &notFoundErr) {
+		return false
+	}
+
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		return isTransientHTTPStatus(apiErr.Code)
+	}
+
+	var retrieveErr *oauth2.RetrieveError
+	if errors.As(err, &retrieveErr) && retrieveErr.Response != nil {
+		return isTransientHTTPStatus(retrieveErr.Response.StatusCode)
+	}
+
+	if s, ok := status.FromError(err); ok {
+		switch s.Code() {
+		case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Internal:
+			return true
+		case codes.NotFound, codes.PermissionDenied, codes.Unauthenticated, codes.InvalidArgument:
+			return false
+		}
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return true
+	}
+
+	if errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ENETUNREACH) ||
+		errors.Is(err, syscall.EHOSTUNREACH) ||
+		errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	return false
+}
+
+func isTransientHTTPStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code >= http.StatusInternalServerError
+}
+
+// MountRetryConfig controls how mount-time setup is retried.
+type MountRetryConfig struct {
+	// Attempts is the number of retries after the first failure.
+	Attempts int
+
+	// Backoff is the wait before the first retry. It doubles after every retry,
+	// up to MaxBackoff if that is positive.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+// RetryTransient calls f until it succeeds, fails with an error that isn't
+// transient according to IsTransientMountError, or has been retried
+// c.Attempts times. It returns the last error from f. Before each retry it
+// calls notify, if non-nil, with the retry number, the error and the wait.
+func (c MountRetryConfig) RetryTransient(
+	ctx context.Context,
+	f func() error,
+	notify func(retry int, err error, wait time.Duration)) (err error) {
+	wait := c.Backoff
+	for retry := 1; ; retry++ {
+		err = f()
+		if err == nil || retry > c.Attempts || !IsTransientMountError(err) {
+			return
+		}
+
+		if notify != nil {
+			notify(retry, err, wait)
+		}
+
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return
+		}
+
+		wait *= 2
+		if c.MaxBackoff > 0 && wait > c.MaxBackoff {
+			wait = c.MaxBackoff
+		}
+	}
+}
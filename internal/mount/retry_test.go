@@ -0,0 +1,180 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mount
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/oauth2"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+////////////////////////////////////////////////////////////////////////
+// Boilerplate
+////////////////////////////////////////////////////////////////////////
+
+type RetryTest struct {
+	suite.Suite
+}
+
+func TestRetrySuite(t *testing.T) {
+	suite.Run(t, new(RetryTest))
+}
+
+// flakySetup fails with err for the first failures calls and succeeds after.
+type flakySetup struct {
+	failures int
+	err      error
+	calls    int
+}
+
+func (f *flakySetup) run() error {
+	f.calls++
+	if f.calls <= f.failures {
+		return f.err
+	}
+	return nil
+}
+
+var dnsErr = &url.Error{
+	Op:  "Get",
+	URL: "https://storage.googleapis.com/storage/v1/b/bucket/o",
+	Err: &net.OpError{Op: "dial", Net: "tcp", Err: &net.DNSError{Err: "no such host", Name: "storage.googleapis.com"}},
+}
+
+////////////////////////////////////////////////////////////////////////
+// Tests
+////////////////////////////////////////////////////////////////////////
+
+func (t *RetryTest) TestIsTransientMountError() {
+	testCases := []struct {
+		name      string
+		err       error
+		transient bool
+	}{
+		{"nil", nil, false},
+		{"dns", fmt.Errorf("SetUpBucket: %w", dnsErr), true},
+		{"connection refused", &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}, true},
+		{"deadline exceeded", fmt.Errorf("token: %w", context.DeadlineExceeded), true},
+		{"http 503", &googleapi.Error{Code: http.StatusServiceUnavailable}, true},
+		{"http 429", &googleapi.Error{Code: http.StatusTooManyRequests}, true},
+		{"http 403", &googleapi.Error{Code: http.StatusForbidden}, false},
+		{"http 404", &googleapi.Error{Code: http.StatusNotFound}, false},
+		{"token 500", &oauth2.RetrieveError{Response: &http.Response{StatusCode: http.StatusInternalServerError}}, true},
+		{"token 400", &oauth2.RetrieveError{Response: &http.Response{StatusCode: http.StatusBadRequest}}, false},
+		{"grpc unavailable", status.Error(codes.Unavailable, "unavailable"), true},
+		{"grpc permission denied", status.Error(codes.PermissionDenied, "denied"), false},
+		{"gcs not found", &gcs.NotFoundError{Err: errors.New("bucket")}, false},
+		{"other", errors.New("bad flag"), false},
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(t.T(), tc.transient, IsTransientMountError(tc.err), tc.name)
+	}
+}
+
+func (t *RetryTest) TestRetryTransient_SucceedsFirstTime() {
+	setup := &flakySetup{}
+	c := MountRetryConfig{Attempts: 3, Backoff: time.Millisecond}
+
+	err := c.RetryTransient(context.Background(), setup.run, nil)
+
+	assert.NoError(t.T(), err)
+	assert.Equal(t.T(), 1, setup.calls)
+}
+
+func (t *RetryTest) TestRetryTransient_SucceedsAfterTransientFailures() {
+	setup := &flakySetup{failures: 2, err: dnsErr}
+	c := MountRetryConfig{Attempts: 3, Backoff: time.Millisecond}
+	var retries []int
+
+	err := c.RetryTransient(context.Background(), setup.run, func(retry int, err error, wait time.Duration) {
+		retries = append(retries, retry)
+	})
+
+	assert.NoError(t.T(), err)
+	assert.Equal(t.T(), 3, setup.calls)
+	assert.Equal(t.T(), []int{1, 2}, retries)
+}
+
+func (t *RetryTest) TestRetryTransient_GivesUpAfterAttempts() {
+	setup := &flakySetup{failures: 10, err: dnsErr}
+	c := MountRetryConfig{Attempts: 2, Backoff: time.Millisecond}
+
+	err := c.RetryTransient(context.Background(), setup.run, nil)
+
+	assert.ErrorIs(t.T(), err, dnsErr)
+	assert.Equal(t.T(), 3, setup.calls)
+}
+
+func (t *RetryTest) TestRetryTransient_ZeroAttemptsDisablesRetries() {
+	setup := &flakySetup{failures: 1, err: dnsErr}
+	c := MountRetryConfig{Backoff: time.Millisecond}
+
+	err := c.RetryTransient(context.Background(), setup.run, nil)
+
+	assert.ErrorIs(t.T(), err, dnsErr)
+	assert.Equal(t.T(), 1, setup.calls)
+}
+
+func (t *RetryTest) TestRetryTransient_HardErrorFailsImmediately() {
+	hardErr := &googleapi.Error{Code: http.StatusForbidden}
+	setup := &flakySetup{failures: 1, err: hardErr}
+	c := MountRetryConfig{Attempts: 5, Backoff: time.Millisecond}
+
+	err := c.RetryTransient(context.Background(), setup.run, nil)
+
+	assert.ErrorIs(t.T(), err, hardErr)
+	assert.Equal(t.T(), 1, setup.calls)
+}
+
+func (t *RetryTest) TestRetryTransient_BackoffDoublesUpToMax() {
+	setup := &flakySetup{failures: 4, err: dnsErr}
+	c := MountRetryConfig{Attempts: 4, Backoff: time.Millisecond, MaxBackoff: 3 * time.Millisecond}
+	var waits []time.Duration
+
+	err := c.RetryTransient(context.Background(), setup.run, func(retry int, err error, wait time.Duration) {
+		waits = append(waits, wait)
+	})
+
+	assert.NoError(t.T(), err)
+	assert.Equal(t.T(), []time.Duration{time.Millisecond, 2 * time.Millisecond, 3 * time.Millisecond, 3 * time.Millisecond}, waits)
+}
+
+func (t *RetryTest) TestRetryTransient_StopsWhenContextCancelled() {
+	setup := &flakySetup{failures: 10, err: dnsErr}
+	c := MountRetryConfig{Attempts: 10, Backoff: time.Hour}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := c.RetryTransient(ctx, setup.run, nil)
+
+	assert.ErrorIs(t.T(), err, dnsErr)
+	assert.Equal(t.T(), 1, setup.calls)
+}
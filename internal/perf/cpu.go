@@ -18,6 +18,7 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"runtime/pprof"
 	"syscall"
 	"time"
@@ -56,7 +57,7 @@ func HandleCPUProfileSignals() {
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, syscall.SIGUSR1)
 	for range c {
-		path := fmt.Sprintf("/tmp/cpu-%d.pprof", time.Now().UnixNano())
+		path := filepath.Join(os.TempDir(), fmt.Sprintf("cpu-%d.pprof", time.Now().UnixNano()))
 		const duration = 10 * time.Second
 
 		logger.Infof("Writing %v CPU profile to %s...", duration, path)
@@ -18,6 +18,7 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"runtime"
 	"runtime/pprof"
 	"syscall"
@@ -65,7 +66,7 @@ func HandleMemoryProfileSignals() {
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, syscall.SIGUSR2)
 	for range c {
-		path := fmt.Sprintf("/tmp/mem-%d.pprof", time.Now().UnixNano())
+		path := filepath.Join(os.TempDir(), fmt.Sprintf("mem-%d.pprof", time.Now().UnixNano()))
 
 		var m runtime.MemStats
 		runtime.ReadMemStats(&m)
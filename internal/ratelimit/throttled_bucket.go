@@ -54,6 +54,20 @@ func (b *throttledBucket) BucketType() gcs.BucketType {
 	return b.wrapped.BucketType()
 }
 
+func (b *throttledBucket) GetRetentionPolicy(
+	ctx context.Context) (p *gcs.RetentionPolicy, err error) {
+	// Wait for permission to call through.
+	err = b.opThrottle.Wait(ctx, 1)
+	if err != nil {
+		return
+	}
+
+	// Call through.
+	p, err = b.wrapped.GetRetentionPolicy(ctx)
+
+	return
+}
+
 func (b *throttledBucket) NewReader(
 	ctx context.Context,
 	req *gcs.ReadObjectRequest) (rc io.ReadCloser, err error) {
@@ -184,6 +198,52 @@ func (b *throttledBucket) DeleteObject(
 	return
 }
 
+func (b *throttledBucket) CreateFolder(
+	ctx context.Context,
+	folderName string) (f *gcs.Folder, err error) {
+	// Wait for permission to call through.
+	err = b.opThrottle.Wait(ctx, 1)
+	if err != nil {
+		return
+	}
+
+	// Call through.
+	f, err = b.wrapped.CreateFolder(ctx, folderName)
+
+	return
+}
+
+func (b *throttledBucket) DeleteFolder(
+	ctx context.Context,
+	folderName string) (err error) {
+	// Wait for permission to call through.
+	err = b.opThrottle.Wait(ctx, 1)
+	if err != nil {
+		return
+	}
+
+	// Call through.
+	err = b.wrapped.DeleteFolder(ctx, folderName)
+
+	return
+}
+
+func (b *throttledBucket) RenameFolder(
+	ctx context.Context,
+	folderName string,
+	destinationFolderName string) (f *gcs.Folder, err error) {
+	// Wait for permission to call through.
+	err = b.opThrottle.Wait(ctx, 1)
+	if err != nil {
+		return
+	}
+
+	// Call through.
+	f, err = b.wrapped.RenameFolder(ctx, folderName, destinationFolderName)
+
+	return
+}
+
 ////////////////////////////////////////////////////////////////////////
 // readerCloser
 ////////////////////////////////////////////////////////////////////////
@@ -25,9 +25,9 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 
 	"cloud.google.com/go/storage"
-	control "cloud.google.com/go/storage/control/apiv2"
 	"cloud.google.com/go/storage/control/apiv2/controlpb"
 	"github.com/googleapis/gax-go/v2"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
@@ -36,6 +36,8 @@ import (
 
 	"google.golang.org/api/googleapi"
 	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 type bucketHandle struct {
@@ -51,13 +53,12 @@ func (bh *bucketHandle) Name() string {
 }
 
 func (bh *bucketHandle) BucketType() gcs.BucketType {
-	var nilControlClient *control.StorageControlClient = nil
 	// Note: The first invocation of this method will be slower due to a required Google Cloud Storage (GCS) fetch.
 	// Subsequent calls will be significantly faster as the results are cached in memory.
 	// While this operation is thread-safe, parallel calls during the initial fetch can result in redundant GCS requests.
 	// To avoid this, it's advisable to call this initially while mounting.
 	if bh.bucketType == gcs.Nil {
-		if bh.controlClient == nilControlClient {
+		if bh.controlClient == nil {
 			bh.bucketType = gcs.NonHierarchical
 			return bh.bucketType
 		}
@@ -83,6 +84,21 @@ func (bh *bucketHandle) BucketType() gcs.BucketType {
 	return bh.bucketType
 }
 
+func (bh *bucketHandle) GetRetentionPolicy(ctx context.Context) (*gcs.RetentionPolicy, error) {
+	attrs, err := bh.bucket.Attrs(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error in fetching the attributes of the bucket: %w", err)
+	}
+	if attrs.RetentionPolicy == nil {
+		return nil, nil
+	}
+
+	return &gcs.RetentionPolicy{
+		RetentionPeriod: attrs.RetentionPolicy.RetentionPeriod,
+		Locked:          attrs.RetentionPolicy.IsLocked,
+	}, nil
+}
+
 func (bh *bucketHandle) NewReader(
 	ctx context.Context,
 	req *gcs.ReadObjectRequest) (io.ReadCloser, error) {
@@ -109,7 +125,16 @@ func (bh *bucketHandle) NewReader(
 	}
 
 	// NewRangeReader creates a "storage.Reader" object which is also io.ReadCloser since it contains both Read() and Close() methods present in io.ReadCloser interface.
-	return obj.NewRangeReader(ctx, start, length)
+	rc, err := obj.NewRangeReader(ctx, start, length)
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) && apiErr.Code == http.StatusRequestedRangeNotSatisfiable {
+		err = &gcs.RangeNotSatisfiableError{Err: err}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return rc, nil
 }
 func (b *bucketHandle) DeleteObject(ctx context.Context, req *gcs.DeleteObjectRequest) error {
 	obj := b.bucket.Object(req.Name)
@@ -249,6 +274,16 @@ func (b *bucketHandle) CopyObject(ctx context.Context, req *gcs.CopyObjectReques
 		srcObj = srcObj.If(storage.Conditions{MetagenerationMatch: *req.SrcMetaGenerationPrecondition})
 	}
 
+	// Putting a condition that the generation of the destination should match
+	// *req.DstGenerationPrecondition, zero meaning it must not exist.
+	if req.DstGenerationPrecondition != nil {
+		if *req.DstGenerationPrecondition == 0 {
+			dstObj = dstObj.If(storage.Conditions{DoesNotExist: true})
+		} else {
+			dstObj = dstObj.If(storage.Conditions{GenerationMatch: *req.DstGenerationPrecondition})
+		}
+	}
+
 	objAttrs, err := dstObj.CopierFrom(srcObj).Run(ctx)
 
 	if err != nil {
@@ -295,8 +330,15 @@ func (b *bucketHandle) ListObjects(ctx context.Context, req *gcs.ListObjectsRequ
 		Projection:               getProjectionValue(req.ProjectionVal),
 		IncludeTrailingDelimiter: req.IncludeTrailingDelimiter,
 		IncludeFoldersAsPrefixes: req.IncludeFoldersAsPrefixes,
+		MatchGlob:                req.MatchGlob,
 		//MaxResults: , (Field not present in storage.Query of Go Storage Library but present in ListObjectsQuery in Jacobsa code.)
 	}
+	if req.FetchOnlyNames {
+		if err = query.SetAttrSelection([]string{"Name"}); err != nil {
+			err = fmt.Errorf("SetAttrSelection: %w", err)
+			return
+		}
+	}
 	itr := b.bucket.Objects(ctx, query) // Returning iterator to the list of objects.
 	pi := itr.PageInfo()
 	pi.MaxSize = req.MaxResults
@@ -446,7 +488,8 @@ func (b *bucketHandle) ComposeObjects(ctx context.Context, req *gcs.ComposeObjec
 	}
 
 	// Composing Source Objects to Destination Object using Composer created through Go Storage Client.
-	attrs, err := dstObj.ComposerFrom(srcObjList...).Run(ctx)
+	composer := storageutil.SetAttrsInComposer(dstObj.ComposerFrom(srcObjList...), req)
+	attrs, err := composer.Run(ctx)
 	if err != nil {
 		switch ee := err.(type) {
 		case *googleapi.Error:
@@ -468,6 +511,92 @@ func (b *bucketHandle) ComposeObjects(ctx context.Context, req *gcs.ComposeObjec
 	return
 }
 
+// The resource name of the bucket in the control API.
+func (b *bucketHandle) controlBucketName() string {
+	return "projects/_/buckets/" + b.bucketName
+}
+
+// The resource name of the given folder in the control API.
+func (b *bucketHandle) controlFolderName(folderName string) string {
+	return b.controlBucketName() + "/folders/" + folderName
+}
+
+func (b *bucketHandle) controlFolderToFolder(f *controlpb.Folder) *gcs.Folder {
+	name := strings.TrimPrefix(f.GetName(), b.controlBucketName()+"/folders/")
+	if !strings.HasSuffix(name, "/") {
+		name += "/"
+	}
+
+	return &gcs.Folder{
+		Name:           name,
+		MetaGeneration: f.GetMetageneration(),
+		UpdateTime:     f.GetUpdateTime().AsTime(),
+	}
+}
+
+// Convert an error returned by the control client to the error types of the
+// gcs package, where there is one.
+func convertControlError(err error) error {
+	switch status.Code(err) {
+	case codes.NotFound:
+		return &gcs.NotFoundError{Err: err}
+	case codes.AlreadyExists, codes.FailedPrecondition:
+		return &gcs.PreconditionError{Err: err}
+	default:
+		return err
+	}
+}
+
+func (b *bucketHandle) CreateFolder(ctx context.Context, folderName string) (*gcs.Folder, error) {
+	if b.controlClient == nil {
+		return nil, errors.New("creating a folder requires a control client (enable-hns)")
+	}
+
+	f, err := b.controlClient.CreateFolder(ctx, &controlpb.CreateFolderRequest{
+		Parent:   b.controlBucketName(),
+		FolderId: folderName,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error in creating folder: %w", convertControlError(err))
+	}
+
+	return b.controlFolderToFolder(f), nil
+}
+
+func (b *bucketHandle) DeleteFolder(ctx context.Context, folderName string) error {
+	if b.controlClient == nil {
+		return errors.New("deleting a folder requires a control client (enable-hns)")
+	}
+
+	err := b.controlClient.DeleteFolder(ctx, &controlpb.DeleteFolderRequest{
+		Name: b.controlFolderName(folderName),
+	})
+	if status.Code(err) == codes.NotFound {
+		err = nil
+	}
+	if err != nil {
+		return fmt.Errorf("error in deleting folder: %w", convertControlError(err))
+	}
+
+	return nil
+}
+
+func (b *bucketHandle) RenameFolder(ctx context.Context, folderName string, destinationFolderName string) (*gcs.Folder, error) {
+	if b.controlClient == nil {
+		return nil, errors.New("renaming a folder requires a control client (enable-hns)")
+	}
+
+	f, err := b.controlClient.RenameFolder(ctx, &controlpb.RenameFolderRequest{
+		Name:                b.controlFolderName(folderName),
+		DestinationFolderId: destinationFolderName,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error in renaming folder: %w", convertControlError(err))
+	}
+
+	return b.controlFolderToFolder(f), nil
+}
+
 // TODO: Consider adding this method to the bucket interface if additional
 // layout options are needed in the future.
 func (b *bucketHandle) getStorageLayout() (*controlpb.StorageLayout, error) {
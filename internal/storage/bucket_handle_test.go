@@ -22,12 +22,13 @@ import (
 	"time"
 
 	"cloud.google.com/go/storage"
-	control "cloud.google.com/go/storage/control/apiv2"
 	"cloud.google.com/go/storage/control/apiv2/controlpb"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/suite"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 const missingObjectName string = "test/foo"
@@ -1242,10 +1243,106 @@ func (testSuite *BucketHandleTest) TestBucketTypeWithHierarchicalNamespaceIsNil(
 }
 
 func (testSuite *BucketHandleTest) TestDefaultBucketTypeWithControlClientNil() {
-	var nilControlClient *control.StorageControlClient = nil
-	testSuite.bucketHandle.controlClient = nilControlClient
+	testSuite.bucketHandle.controlClient = nil
 
 	testSuite.bucketHandle.BucketType()
 
 	assert.Equal(testSuite.T(), gcs.NonHierarchical, testSuite.bucketHandle.bucketType, "Expected Hierarchical bucket type")
 }
+
+func (testSuite *BucketHandleTest) TestCreateFolder() {
+	mockClient := new(MockStorageControlClient)
+	mockClient.On("CreateFolder", mock.Anything, &controlpb.CreateFolderRequest{
+		Parent:   "projects/_/buckets/" + TestBucketName,
+		FolderId: "foo/bar/",
+	}, mock.Anything).
+		Return(&controlpb.Folder{
+			Name:           "projects/_/buckets/" + TestBucketName + "/folders/foo/bar/",
+			Metageneration: 1,
+		}, nil)
+	testSuite.bucketHandle.controlClient = mockClient
+
+	f, err := testSuite.bucketHandle.CreateFolder(context.Background(), "foo/bar/")
+
+	assert.NoError(testSuite.T(), err)
+	assert.Equal(testSuite.T(), "foo/bar/", f.Name)
+	assert.Equal(testSuite.T(), int64(1), f.MetaGeneration)
+}
+
+func (testSuite *BucketHandleTest) TestCreateFolderWhenFolderExists() {
+	var nilFolder *controlpb.Folder
+	mockClient := new(MockStorageControlClient)
+	mockClient.On("CreateFolder", mock.Anything, mock.Anything, mock.Anything).
+		Return(nilFolder, status.Error(codes.AlreadyExists, "folder exists"))
+	testSuite.bucketHandle.controlClient = mockClient
+
+	_, err := testSuite.bucketHandle.CreateFolder(context.Background(), "foo/")
+
+	var preconditionErr *gcs.PreconditionError
+	assert.True(testSuite.T(), errors.As(err, &preconditionErr))
+}
+
+func (testSuite *BucketHandleTest) TestDeleteFolder() {
+	mockClient := new(MockStorageControlClient)
+	mockClient.On("DeleteFolder", mock.Anything, &controlpb.DeleteFolderRequest{
+		Name: "projects/_/buckets/" + TestBucketName + "/folders/foo/",
+	}, mock.Anything).
+		Return(nil)
+	testSuite.bucketHandle.controlClient = mockClient
+
+	err := testSuite.bucketHandle.DeleteFolder(context.Background(), "foo/")
+
+	assert.NoError(testSuite.T(), err)
+	mockClient.AssertExpectations(testSuite.T())
+}
+
+func (testSuite *BucketHandleTest) TestDeleteFolderWhenFolderDoesNotExist() {
+	mockClient := new(MockStorageControlClient)
+	mockClient.On("DeleteFolder", mock.Anything, mock.Anything, mock.Anything).
+		Return(status.Error(codes.NotFound, "no such folder"))
+	testSuite.bucketHandle.controlClient = mockClient
+
+	err := testSuite.bucketHandle.DeleteFolder(context.Background(), "foo/")
+
+	assert.NoError(testSuite.T(), err)
+}
+
+func (testSuite *BucketHandleTest) TestRenameFolder() {
+	mockClient := new(MockStorageControlClient)
+	mockClient.On("RenameFolder", mock.Anything, &controlpb.RenameFolderRequest{
+		Name:                "projects/_/buckets/" + TestBucketName + "/folders/only/dir/foo/",
+		DestinationFolderId: "only/dir/bar/",
+	}, mock.Anything).
+		Return(&controlpb.Folder{
+			Name:           "projects/_/buckets/" + TestBucketName + "/folders/only/dir/bar/",
+			Metageneration: 2,
+		}, nil)
+	testSuite.bucketHandle.controlClient = mockClient
+
+	f, err := testSuite.bucketHandle.RenameFolder(context.Background(), "only/dir/foo/", "only/dir/bar/")
+
+	assert.NoError(testSuite.T(), err)
+	assert.Equal(testSuite.T(), "only/dir/bar/", f.Name)
+	assert.Equal(testSuite.T(), int64(2), f.MetaGeneration)
+}
+
+func (testSuite *BucketHandleTest) TestRenameFolderWhenFolderDoesNotExist() {
+	var nilFolder *controlpb.Folder
+	mockClient := new(MockStorageControlClient)
+	mockClient.On("RenameFolder", mock.Anything, mock.Anything, mock.Anything).
+		Return(nilFolder, status.Error(codes.NotFound, "no such folder"))
+	testSuite.bucketHandle.controlClient = mockClient
+
+	_, err := testSuite.bucketHandle.RenameFolder(context.Background(), "foo/", "bar/")
+
+	var notFoundErr *gcs.NotFoundError
+	assert.True(testSuite.T(), errors.As(err, &notFoundErr))
+}
+
+func (testSuite *BucketHandleTest) TestFolderMethodsWithControlClientNil() {
+	testSuite.bucketHandle.controlClient = nil
+
+	_, err := testSuite.bucketHandle.RenameFolder(context.Background(), "foo/", "bar/")
+
+	assert.Error(testSuite.T(), err)
+}
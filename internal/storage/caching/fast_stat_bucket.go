@@ -21,6 +21,7 @@ import (
 	"time"
 
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/metadata"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/config"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
 	"golang.org/x/net/context"
@@ -30,17 +31,24 @@ import (
 
 // Create a bucket that caches object records returned by the supplied wrapped
 // bucket. Records are invalidated when modifications are made through this
-// bucket, and after the supplied TTL.
+// bucket, and after the supplied TTL of their kind, or the one cacheControlTTL
+// derives from the Cache-Control metadata of the object. Names ending in '/'
+// are those of directories. The config of a prefix in dirConfigs, which may be
+// nil, overrides the supplied TTLs under it.
 func NewFastStatBucket(
-	ttl time.Duration,
+	ttls metadata.EntryTTLs,
+	cacheControlTTL metadata.CacheControlTTL,
+	dirConfigs *config.DirConfigs,
 	cache metadata.StatCache,
 	clock timeutil.Clock,
 	wrapped gcs.Bucket) (b gcs.Bucket) {
 	fsb := &fastStatBucket{
-		cache:   cache,
-		clock:   clock,
-		wrapped: wrapped,
-		ttl:     ttl,
+		cache:           cache,
+		clock:           clock,
+		wrapped:         wrapped,
+		ttls:            ttls,
+		cacheControlTTL: cacheControlTTL,
+		dirConfigs:      dirConfigs,
 	}
 
 	b = fsb
@@ -64,22 +72,39 @@ type fastStatBucket struct {
 	// Constant data
 	/////////////////////////
 
-	ttl time.Duration
+	ttls            metadata.EntryTTLs
+	cacheControlTTL metadata.CacheControlTTL
+	dirConfigs      *config.DirConfigs
 }
 
 ////////////////////////////////////////////////////////////////////////
 // Helpers
 ////////////////////////////////////////////////////////////////////////
 
+// ttlFor returns the ttl of cached records for the given name, unless
+// Cache-Control overrides it.
+func (b *fastStatBucket) ttlFor(name string) time.Duration {
+	if b.dirConfigs == nil {
+		return b.ttls.ForName(name)
+	}
+	return b.ttls.Under(b.dirConfigs.Resolve(b.wrapped.Name(), name)).ForName(name)
+}
+
 // LOCKS_EXCLUDED(b.mu)
 func (b *fastStatBucket) insertMultiple(objs []*gcs.Object) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
-	expiration := b.clock.Now().Add(b.ttl)
+	now := b.clock.Now()
 	for _, o := range objs {
+		// Objects whose Cache-Control forbids caching aren't cached at all.
+		ttl := b.cacheControlTTL.TTL(o.CacheControl, b.ttlFor(o.Name))
+		if ttl <= 0 {
+			continue
+		}
+
 		m := storageutil.ConvertObjToMinObject(o)
-		b.cache.Insert(m, expiration)
+		b.cache.Insert(m, now.Add(ttl))
 	}
 }
 
@@ -93,8 +118,11 @@ func (b *fastStatBucket) addNegativeEntry(name string) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
-	expiration := b.clock.Now().Add(b.ttl)
-	b.cache.AddNegativeEntry(name, expiration)
+	ttl := b.ttlFor(name)
+	if ttl <= 0 {
+		return
+	}
+	b.cache.AddNegativeEntry(name, b.clock.Now().Add(ttl))
 }
 
 // LOCKS_EXCLUDED(b.mu)
@@ -103,6 +131,162 @@ func (b *fastStatBucket) invalidate(name string) {
 	defer b.mu.Unlock()
 
 	b.cache.Erase(name)
+
+	// Creating or deleting the object may change whether anything exists
+	// under each of its ancestor prefixes.
+	for i := 0; i < len(name); i++ {
+		if name[i] == '/' {
+			b.cache.ErasePrefix(name[:i+1])
+		}
+	}
+}
+
+// LOCKS_EXCLUDED(b.mu)
+func (b *fastStatBucket) invalidateFolder(folderName string) {
+	b.invalidate(folderName)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.cache.EraseEntriesWithGivenPrefix(folderName)
+}
+
+// LOCKS_EXCLUDED(b.mu)
+func (b *fastStatBucket) insertFolder(f *gcs.Folder) {
+	b.insert(&gcs.Object{
+		Name:           f.Name,
+		MetaGeneration: f.MetaGeneration,
+		Updated:        f.UpdateTime,
+	})
+}
+
+// LOCKS_EXCLUDED(b.mu)
+func (b *fastStatBucket) insertPrefix(prefix string, firstObject string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ttl := b.ttlFor(prefix)
+	if ttl <= 0 {
+		return
+	}
+	b.cache.InsertPrefix(prefix, firstObject, b.clock.Now().Add(ttl))
+}
+
+// LOCKS_EXCLUDED(b.mu)
+func (b *fastStatBucket) lookUpPrefix(prefix string) (hit bool, firstObject string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	hit, firstObject = b.cache.LookUpPrefix(prefix, b.clock.Now())
+	return
+}
+
+// LOCKS_EXCLUDED(b.mu)
+func (b *fastStatBucket) insertProbeResult(prefix string, firstObject string) {
+	b.insertPrefix(prefix, firstObject)
+	if firstObject == "" || b.wrapped.BucketType() == gcs.Hierarchical {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// Listings are sorted by name, so no object between the prefix and the
+	// first object exists: neither the placeholder of any directory on the way
+	// down to it, nor a file of the same name as one of them. The first object
+	// is also the first under each of those directories. This lets a cold
+	// lookup of a deep path resolve every component below the prefix from the
+	// cache, rather than with a stat and a probe per component. Folders of
+	// hierarchical buckets aren't objects, so nothing is learned about them.
+	now := b.clock.Now()
+	if ttl := b.ttlFor(prefix); prefix != "" && firstObject != prefix && ttl > 0 {
+		b.cache.AddNegativeEntry(prefix, now.Add(ttl))
+	}
+
+	for i := len(prefix); i < len(firstObject); i++ {
+		if firstObject[i] != '/' {
+			continue
+		}
+
+		dir := firstObject[:i+1]
+		if ttl := b.ttlFor(dir[:i]); ttl > 0 {
+			b.cache.AddNegativeEntry(dir[:i], now.Add(ttl))
+		}
+		ttl := b.ttlFor(dir)
+		if ttl <= 0 {
+			continue
+		}
+		expiration := now.Add(ttl)
+		b.cache.InsertPrefix(dir, firstObject, expiration)
+		if dir != firstObject {
+			b.cache.AddNegativeEntry(dir, expiration)
+		}
+	}
+}
+
+// noteMissing drops the recorded probe results of the prefixes above the name
+// that found it as their first object. Having been deleted, e.g. by another
+// client, it no longer shows those prefixes to be non-empty, so jobs probing
+// for a directory just deleted don't find it for the rest of the TTL.
+//
+// LOCKS_EXCLUDED(b.mu)
+func (b *fastStatBucket) noteMissing(name string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.clock.Now()
+	for i := 0; i < len(name); i++ {
+		if name[i] != '/' {
+			continue
+		}
+
+		prefix := name[:i+1]
+		if hit, firstObject := b.cache.LookUpPrefix(prefix, now); hit && firstObject == name {
+			b.cache.ErasePrefix(prefix)
+		}
+	}
+}
+
+// noteExisting drops the recorded probe results finding nothing under the
+// prefixes above the names, which exist and so show them to be non-empty. A
+// name ending in '/' is a prefix of itself. This lets a directory created by
+// another client be found once something under it has been seen, e.g. by
+// listing its parent, rather than after the TTL.
+//
+// LOCKS_EXCLUDED(b.mu)
+func (b *fastStatBucket) noteExisting(names []string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.clock.Now()
+	checked := make(map[string]struct{})
+	for _, name := range names {
+		for i := 0; i < len(name); i++ {
+			if name[i] != '/' {
+				continue
+			}
+
+			prefix := name[:i+1]
+			if _, ok := checked[prefix]; ok {
+				continue
+			}
+			checked[prefix] = struct{}{}
+
+			if hit, firstObject := b.cache.LookUpPrefix(prefix, now); hit && firstObject == "" {
+				b.cache.ErasePrefix(prefix)
+			}
+		}
+	}
+}
+
+// isPrefixProbe reports whether the request only asks whether anything exists
+// under its prefix, in which case the answer can be served from the cache.
+func isPrefixProbe(req *gcs.ListObjectsRequest) bool {
+	return req.FetchOnlyNames &&
+		req.MaxResults == 1 &&
+		req.Delimiter == "" &&
+		req.MatchGlob == "" &&
+		req.ContinuationToken == ""
 }
 
 // LOCKS_EXCLUDED(b.mu)
@@ -126,10 +310,21 @@ func (b *fastStatBucket) BucketType() gcs.BucketType {
 	return b.wrapped.BucketType()
 }
 
+func (b *fastStatBucket) GetRetentionPolicy(ctx context.Context) (*gcs.RetentionPolicy, error) {
+	return b.wrapped.GetRetentionPolicy(ctx)
+}
+
 func (b *fastStatBucket) NewReader(
 	ctx context.Context,
 	req *gcs.ReadObjectRequest) (rc io.ReadCloser, err error) {
 	rc, err = b.wrapped.NewReader(ctx, req)
+
+	// The object may have been deleted or replaced by another writer, so
+	// whatever is cached for it is stale.
+	if _, ok := err.(*gcs.NotFoundError); ok {
+		b.invalidate(req.Name)
+	}
+
 	return
 }
 
@@ -230,14 +425,43 @@ func (b *fastStatBucket) StatObject(
 func (b *fastStatBucket) ListObjects(
 	ctx context.Context,
 	req *gcs.ListObjectsRequest) (listing *gcs.Listing, err error) {
+	probe := isPrefixProbe(req)
+	if probe {
+		if hit, firstObject := b.lookUpPrefix(req.Prefix); hit {
+			listing = &gcs.Listing{}
+			if firstObject != "" {
+				listing.Objects = []*gcs.Object{{Name: firstObject}}
+			}
+			return
+		}
+	}
+
 	// Fetch the listing.
 	listing, err = b.wrapped.ListObjects(ctx, req)
 	if err != nil {
 		return
 	}
 
-	// Note anything we found.
-	b.insertMultiple(listing.Objects)
+	if probe {
+		var firstObject string
+		if len(listing.Objects) > 0 {
+			firstObject = listing.Objects[0].Name
+		}
+		b.insertProbeResult(req.Prefix, firstObject)
+	} else {
+		names := make([]string, 0, len(listing.CollapsedRuns)+len(listing.Objects))
+		names = append(names, listing.CollapsedRuns...)
+		for _, o := range listing.Objects {
+			names = append(names, o.Name)
+		}
+		b.noteExisting(names)
+	}
+
+	// Note anything we found. Records holding only names are useless as stat
+	// results.
+	if !req.FetchOnlyNames {
+		b.insertMultiple(listing.Objects)
+	}
 
 	return
 }
@@ -265,11 +489,62 @@ func (b *fastStatBucket) UpdateObject(
 func (b *fastStatBucket) DeleteObject(
 	ctx context.Context,
 	req *gcs.DeleteObjectRequest) (err error) {
+	if req.TrustNegativeCache {
+		if hit, entry := b.lookUp(req.Name); hit && entry == nil {
+			err = &gcs.NotFoundError{
+				Err: fmt.Errorf("Negative cache entry for %v", req.Name),
+			}
+			return
+		}
+	}
+
 	b.invalidate(req.Name)
 	err = b.wrapped.DeleteObject(ctx, req)
 	return
 }
 
+func (b *fastStatBucket) CreateFolder(
+	ctx context.Context,
+	folderName string) (f *gcs.Folder, err error) {
+	b.invalidate(folderName)
+
+	f, err = b.wrapped.CreateFolder(ctx, folderName)
+	if err != nil {
+		return
+	}
+
+	b.insertFolder(f)
+	return
+}
+
+func (b *fastStatBucket) DeleteFolder(
+	ctx context.Context,
+	folderName string) (err error) {
+	b.invalidate(folderName)
+	err = b.wrapped.DeleteFolder(ctx, folderName)
+	return
+}
+
+func (b *fastStatBucket) RenameFolder(
+	ctx context.Context,
+	folderName string,
+	destinationFolderName string) (f *gcs.Folder, err error) {
+	f, err = b.wrapped.RenameFolder(ctx, folderName, destinationFolderName)
+
+	// Everything cached under either name may be stale now, even if the rename
+	// failed part way.
+	b.invalidateFolder(folderName)
+	b.invalidateFolder(destinationFolderName)
+
+	if err != nil {
+		return
+	}
+
+	// Record the metageneration the rename left the folder at.
+	b.insertFolder(f)
+	return
+}
+
 func (b *fastStatBucket) StatObjectFromGcs(ctx context.Context,
 	req *gcs.StatObjectRequest) (m *gcs.MinObject, e *gcs.ExtendedObjectAttributes, err error) {
 	m, e, err = b.wrapped.StatObject(ctx, req)
@@ -277,6 +552,7 @@ func (b *fastStatBucket) StatObjectFromGcs(ctx context.Context,
 		// Special case: NotFoundError -> negative entry.
 		if _, ok := err.(*gcs.NotFoundError); ok {
 			b.addNegativeEntry(req.Name)
+			b.noteMissing(req.Name)
 		}
 
 		return
@@ -285,6 +561,7 @@ func (b *fastStatBucket) StatObjectFromGcs(ctx context.Context,
 	// Put the object in cache.
 	o := storageutil.ConvertMinObjectToObject(m)
 	b.insert(o)
+	b.noteExisting([]string{o.Name})
 
 	return
 }
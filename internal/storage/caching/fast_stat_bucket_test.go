@@ -19,6 +19,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/metadata"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/caching"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/caching/mock_gcscaching"
@@ -54,8 +55,15 @@ func (t *fastStatBucketTest) SetUp(ti *TestInfo) {
 	t.cache = mock_gcscaching.NewMockStatCache(ti.MockController, "cache")
 	t.wrapped = storage.NewMockBucket(ti.MockController, "wrapped")
 
+	// Prefix probe results are erased on every mutation; individual tests
+	// don't care about that.
+	ExpectCall(t.cache, "ErasePrefix")(Any()).WillRepeatedly(Return())
+	ExpectCall(t.wrapped, "BucketType")().WillRepeatedly(Return(gcs.NonHierarchical))
+
 	t.bucket = caching.NewFastStatBucket(
-		ttl,
+		metadata.SameEntryTTLs(ttl),
+		metadata.CacheControlTTL{},
+		nil,
 		t.cache,
 		&t.clock,
 		t.wrapped)
@@ -586,6 +594,217 @@ func (t *ListObjectsTest) NonEmptyListing() {
 	ExpectEq(expected, listing)
 }
 
+func (t *ListObjectsTest) NamesOnlyListingIsNotInserted() {
+	// Wrapped
+	expected := &gcs.Listing{
+		Objects: []*gcs.Object{{Name: "taco"}, {Name: "burrito"}},
+	}
+
+	ExpectCall(t.wrapped, "ListObjects")(Any(), Any()).
+		WillOnce(Return(expected, nil))
+
+	// Call
+	listing, err := t.bucket.ListObjects(context.TODO(), &gcs.ListObjectsRequest{FetchOnlyNames: true})
+
+	AssertEq(nil, err)
+	ExpectEq(expected, listing)
+}
+
+func (t *ListObjectsTest) Probe_CallsLookUpPrefix() {
+	const prefix = "taco/"
+
+	// LookUpPrefix
+	ExpectCall(t.cache, "LookUpPrefix")(prefix, timeutil.TimeEq(t.clock.Now())).
+		WillOnce(Return(false, ""))
+
+	// Wrapped
+	ExpectCall(t.wrapped, "ListObjects")(Any(), Any()).
+		WillOnce(Return(nil, errors.New("taco")))
+
+	// Call
+	req := &gcs.ListObjectsRequest{Prefix: prefix, MaxResults: 1, FetchOnlyNames: true}
+	_, err := t.bucket.ListObjects(context.TODO(), req)
+
+	ExpectThat(err, Error(HasSubstr("taco")))
+}
+
+func (t *ListObjectsTest) Probe_PositiveHit() {
+	const prefix = "taco/"
+
+	// LookUpPrefix
+	ExpectCall(t.cache, "LookUpPrefix")(Any(), Any()).
+		WillOnce(Return(true, "taco/burrito"))
+
+	// Call
+	req := &gcs.ListObjectsRequest{Prefix: prefix, MaxResults: 1, FetchOnlyNames: true}
+	listing, err := t.bucket.ListObjects(context.TODO(), req)
+
+	AssertEq(nil, err)
+	AssertEq(1, len(listing.Objects))
+	ExpectEq("taco/burrito", listing.Objects[0].Name)
+}
+
+func (t *ListObjectsTest) Probe_NegativeHit() {
+	const prefix = "taco/"
+
+	// LookUpPrefix
+	ExpectCall(t.cache, "LookUpPrefix")(Any(), Any()).
+		WillOnce(Return(true, ""))
+
+	// Call
+	req := &gcs.ListObjectsRequest{Prefix: prefix, MaxResults: 1, FetchOnlyNames: true}
+	listing, err := t.bucket.ListObjects(context.TODO(), req)
+
+	AssertEq(nil, err)
+	ExpectEq(0, len(listing.Objects))
+}
+
+func (t *ListObjectsTest) Probe_MissInsertsPositive() {
+	const prefix = "taco/"
+
+	// LookUpPrefix
+	ExpectCall(t.cache, "LookUpPrefix")(Any(), Any()).
+		WillOnce(Return(false, ""))
+
+	// Wrapped
+	expected := &gcs.Listing{
+		Objects: []*gcs.Object{{Name: "taco/burrito"}},
+	}
+
+	ExpectCall(t.wrapped, "ListObjects")(Any(), Any()).
+		WillOnce(Return(expected, nil))
+
+	// InsertPrefix
+	ExpectCall(t.cache, "InsertPrefix")(prefix, "taco/burrito", timeutil.TimeEq(t.clock.Now().Add(ttl)))
+
+	// AddNegativeEntry
+	ExpectCall(t.cache, "AddNegativeEntry")(prefix, timeutil.TimeEq(t.clock.Now().Add(ttl)))
+
+	// Call
+	req := &gcs.ListObjectsRequest{Prefix: prefix, MaxResults: 1, FetchOnlyNames: true}
+	listing, err := t.bucket.ListObjects(context.TODO(), req)
+
+	AssertEq(nil, err)
+	ExpectEq(expected, listing)
+}
+
+func (t *ListObjectsTest) Probe_MissSeedsIntermediateDirectories() {
+	const prefix = "taco/"
+
+	// LookUpPrefix
+	ExpectCall(t.cache, "LookUpPrefix")(Any(), Any()).
+		WillOnce(Return(false, ""))
+
+	// Wrapped
+	expected := &gcs.Listing{
+		Objects: []*gcs.Object{{Name: "taco/burrito/enchilada/"}},
+	}
+
+	ExpectCall(t.wrapped, "ListObjects")(Any(), Any()).
+		WillOnce(Return(expected, nil))
+
+	// InsertPrefix
+	expiration := timeutil.TimeEq(t.clock.Now().Add(ttl))
+	for _, p := range []string{"taco/", "taco/burrito/", "taco/burrito/enchilada/"} {
+		ExpectCall(t.cache, "InsertPrefix")(p, "taco/burrito/enchilada/", expiration)
+	}
+
+	// AddNegativeEntry, for everything but the placeholder that was listed.
+	for _, name := range []string{"taco/", "taco/burrito", "taco/burrito/", "taco/burrito/enchilada"} {
+		ExpectCall(t.cache, "AddNegativeEntry")(name, expiration)
+	}
+
+	// Call
+	req := &gcs.ListObjectsRequest{Prefix: prefix, MaxResults: 1, FetchOnlyNames: true}
+	listing, err := t.bucket.ListObjects(context.TODO(), req)
+
+	AssertEq(nil, err)
+	ExpectEq(expected, listing)
+}
+
+func (t *ListObjectsTest) Probe_MissInsertsNegative() {
+	const prefix = "taco/"
+
+	// LookUpPrefix
+	ExpectCall(t.cache, "LookUpPrefix")(Any(), Any()).
+		WillOnce(Return(false, ""))
+
+	// Wrapped
+	ExpectCall(t.wrapped, "ListObjects")(Any(), Any()).
+		WillOnce(Return(&gcs.Listing{}, nil))
+
+	// InsertPrefix
+	ExpectCall(t.cache, "InsertPrefix")(prefix, "", timeutil.TimeEq(t.clock.Now().Add(ttl)))
+
+	// Call
+	req := &gcs.ListObjectsRequest{Prefix: prefix, MaxResults: 1, FetchOnlyNames: true}
+	listing, err := t.bucket.ListObjects(context.TODO(), req)
+
+	AssertEq(nil, err)
+	ExpectEq(0, len(listing.Objects))
+}
+
+////////////////////////////////////////////////////////////////////////
+// Separate ttls for files and directories
+////////////////////////////////////////////////////////////////////////
+
+type EntryTTLsTest struct {
+	fastStatBucketTest
+}
+
+func init() { RegisterTestSuite(&EntryTTLsTest{}) }
+
+func (t *EntryTTLsTest) SetUp(ti *TestInfo) {
+	t.fastStatBucketTest.SetUp(ti)
+	t.bucket = caching.NewFastStatBucket(
+		metadata.EntryTTLs{File: ttl, Dir: 2 * ttl},
+		metadata.CacheControlTTL{},
+		nil,
+		t.cache,
+		&t.clock,
+		t.wrapped)
+}
+
+func (t *EntryTTLsTest) StatObject_InsertsByKind() {
+	ExpectCall(t.cache, "LookUp")(Any(), Any()).
+		WillRepeatedly(Return(false, nil))
+	ExpectCall(t.cache, "LookUpPrefix")(Any(), Any()).
+		WillRepeatedly(Return(false, ""))
+	ExpectCall(t.wrapped, "StatObject")(Any(), Any()).
+		WillOnce(Return(&gcs.MinObject{Name: "taco"}, nil, nil)).
+		WillOnce(Return(&gcs.MinObject{Name: "burrito/"}, nil, nil))
+
+	ExpectCall(t.cache, "Insert")(Any(), timeutil.TimeEq(t.clock.Now().Add(ttl)))
+	ExpectCall(t.cache, "Insert")(Any(), timeutil.TimeEq(t.clock.Now().Add(2*ttl)))
+
+	_, _, err := t.bucket.StatObject(context.TODO(), &gcs.StatObjectRequest{Name: "taco"})
+	AssertEq(nil, err)
+	_, _, err = t.bucket.StatObject(context.TODO(), &gcs.StatObjectRequest{Name: "burrito/"})
+	AssertEq(nil, err)
+}
+
+func (t *EntryTTLsTest) Probe_SeedsNamesByKind() {
+	ExpectCall(t.cache, "LookUpPrefix")(Any(), Any()).
+		WillOnce(Return(false, ""))
+	ExpectCall(t.wrapped, "ListObjects")(Any(), Any()).
+		WillOnce(Return(&gcs.Listing{Objects: []*gcs.Object{{Name: "taco/burrito/enchilada"}}}, nil))
+
+	fileExpiration := timeutil.TimeEq(t.clock.Now().Add(ttl))
+	dirExpiration := timeutil.TimeEq(t.clock.Now().Add(2 * ttl))
+	for _, p := range []string{"taco/", "taco/burrito/"} {
+		ExpectCall(t.cache, "InsertPrefix")(p, "taco/burrito/enchilada", dirExpiration)
+	}
+	for _, name := range []string{"taco/", "taco/burrito/"} {
+		ExpectCall(t.cache, "AddNegativeEntry")(name, dirExpiration)
+	}
+	ExpectCall(t.cache, "AddNegativeEntry")("taco/burrito", fileExpiration)
+
+	req := &gcs.ListObjectsRequest{Prefix: "taco/", MaxResults: 1, FetchOnlyNames: true}
+	_, err := t.bucket.ListObjects(context.TODO(), req)
+
+	AssertEq(nil, err)
+}
+
 ////////////////////////////////////////////////////////////////////////
 // UpdateObject
 ////////////////////////////////////////////////////////////////////////
@@ -660,6 +879,44 @@ func (t *UpdateObjectTest) WrappedSucceeds() {
 	ExpectEq(obj, o)
 }
 
+////////////////////////////////////////////////////////////////////////
+// NewReader
+////////////////////////////////////////////////////////////////////////
+
+type NewReaderTest struct {
+	fastStatBucketTest
+}
+
+func init() { RegisterTestSuite(&NewReaderTest{}) }
+
+func (t *NewReaderTest) WrappedFails() {
+	// Wrapped
+	ExpectCall(t.wrapped, "NewReader")(Any(), Any()).
+		WillOnce(Return(nil, errors.New("taco")))
+
+	// Call
+	_, err := t.bucket.NewReader(context.TODO(), &gcs.ReadObjectRequest{Name: "taco"})
+
+	ExpectThat(err, Error(HasSubstr("taco")))
+}
+
+func (t *NewReaderTest) NotFoundErasesEntry() {
+	const name = "taco/burrito"
+
+	// Wrapped
+	ExpectCall(t.wrapped, "NewReader")(Any(), Any()).
+		WillOnce(Return(nil, &gcs.NotFoundError{Err: errors.New("deleted")}))
+
+	// Erase
+	ExpectCall(t.cache, "Erase")(name)
+
+	// Call
+	_, err := t.bucket.NewReader(context.TODO(), &gcs.ReadObjectRequest{Name: name, Generation: 17})
+
+	var notFoundErr *gcs.NotFoundError
+	ExpectTrue(errors.As(err, &notFoundErr))
+}
+
 ////////////////////////////////////////////////////////////////////////
 // DeleteObject
 ////////////////////////////////////////////////////////////////////////
@@ -725,3 +982,119 @@ func (t *DeleteObjectTest) WrappedSucceeds() {
 	err = t.deleteObject(name)
 	AssertEq(nil, err)
 }
+
+func (t *DeleteObjectTest) TrustNegativeCache_NegativeEntry() {
+	const name = "taco"
+
+	// LookUp
+	ExpectCall(t.cache, "LookUp")(name, Any()).
+		WillOnce(Return(true, nil))
+
+	// Call
+	err := t.bucket.DeleteObject(
+		context.TODO(),
+		&gcs.DeleteObjectRequest{Name: name, TrustNegativeCache: true})
+
+	ExpectThat(err, HasSameTypeAs(&gcs.NotFoundError{}))
+}
+
+func (t *DeleteObjectTest) TrustNegativeCache_PositiveEntry() {
+	const name = "taco"
+
+	// LookUp
+	ExpectCall(t.cache, "LookUp")(name, Any()).
+		WillOnce(Return(true, &gcs.MinObject{Name: name}))
+
+	// Erase
+	ExpectCall(t.cache, "Erase")(name)
+
+	// Wrapped
+	ExpectCall(t.wrapped, "DeleteObject")(Any(), Any()).
+		WillOnce(Return(nil))
+
+	// Call
+	err := t.bucket.DeleteObject(
+		context.TODO(),
+		&gcs.DeleteObjectRequest{Name: name, TrustNegativeCache: true})
+
+	ExpectEq(nil, err)
+}
+
+func (t *DeleteObjectTest) TrustNegativeCache_Miss() {
+	const name = "taco"
+
+	// LookUp
+	ExpectCall(t.cache, "LookUp")(name, Any()).
+		WillOnce(Return(false, nil))
+
+	// Erase
+	ExpectCall(t.cache, "Erase")(name)
+
+	// Wrapped
+	ExpectCall(t.wrapped, "DeleteObject")(Any(), Any()).
+		WillOnce(Return(nil))
+
+	// Call
+	err := t.bucket.DeleteObject(
+		context.TODO(),
+		&gcs.DeleteObjectRequest{Name: name, TrustNegativeCache: true})
+
+	ExpectEq(nil, err)
+}
+
+////////////////////////////////////////////////////////////////////////
+// RenameFolder
+////////////////////////////////////////////////////////////////////////
+
+type RenameFolderTest struct {
+	fastStatBucketTest
+}
+
+func init() { RegisterTestSuite(&RenameFolderTest{}) }
+
+func (t *RenameFolderTest) WrappedFails() {
+	// Wrapped
+	ExpectCall(t.wrapped, "RenameFolder")(Any(), "taco/", "burrito/").
+		WillOnce(Return(nil, errors.New("taco")))
+
+	// Erase, even though the rename failed.
+	ExpectCall(t.cache, "Erase")("taco/")
+	ExpectCall(t.cache, "Erase")("burrito/")
+	ExpectCall(t.cache, "EraseEntriesWithGivenPrefix")("taco/")
+	ExpectCall(t.cache, "EraseEntriesWithGivenPrefix")("burrito/")
+
+	// Call
+	_, err := t.bucket.RenameFolder(context.TODO(), "taco/", "burrito/")
+
+	ExpectThat(err, Error(HasSubstr("taco")))
+}
+
+func (t *RenameFolderTest) WrappedSucceeds() {
+	// Wrapped
+	folder := &gcs.Folder{
+		Name:           "burrito/",
+		MetaGeneration: 7,
+	}
+	ExpectCall(t.wrapped, "RenameFolder")(Any(), "taco/", "burrito/").
+		WillOnce(Return(folder, nil))
+
+	// Erase
+	ExpectCall(t.cache, "Erase")("taco/")
+	ExpectCall(t.cache, "Erase")("burrito/")
+	ExpectCall(t.cache, "EraseEntriesWithGivenPrefix")("taco/")
+	ExpectCall(t.cache, "EraseEntriesWithGivenPrefix")("burrito/")
+
+	// Insert
+	var inserted *gcs.MinObject
+	ExpectCall(t.cache, "Insert")(Any(), timeutil.TimeEq(t.clock.Now().Add(ttl))).
+		WillOnce(SaveArg(0, &inserted))
+
+	// Call
+	f, err := t.bucket.RenameFolder(context.TODO(), "taco/", "burrito/")
+
+	AssertEq(nil, err)
+	ExpectEq(folder, f)
+	AssertNe(nil, inserted)
+	ExpectEq("burrito/", inserted.Name)
+	ExpectEq(7, inserted.MetaGeneration)
+}
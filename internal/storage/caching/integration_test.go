@@ -15,6 +15,8 @@
 package caching_test
 
 import (
+	"errors"
+	"strings"
 	"testing"
 	"time"
 
@@ -37,11 +39,34 @@ func TestIntegration(t *testing.T) { RunTests(t) }
 // Boilerplate
 ////////////////////////////////////////////////////////////////////////
 
+// A bucket that counts calls to ListObjects and StatObject.
+type countingBucket struct {
+	gcs.Bucket
+	listCount int
+	statCount int
+}
+
+func (b *countingBucket) StatObject(
+	ctx context.Context,
+	req *gcs.StatObjectRequest) (*gcs.MinObject, *gcs.ExtendedObjectAttributes, error) {
+	b.statCount++
+	return b.Bucket.StatObject(ctx, req)
+}
+
+func (b *countingBucket) ListObjects(
+	ctx context.Context,
+	req *gcs.ListObjectsRequest) (*gcs.Listing, error) {
+	b.listCount++
+	return b.Bucket.ListObjects(ctx, req)
+}
+
 type IntegrationTest struct {
 	ctx context.Context
 
 	clock   timeutil.SimulatedClock
+	cache   metadata.StatCache
 	wrapped gcs.Bucket
+	counter *countingBucket
 
 	bucket gcs.Bucket
 }
@@ -58,14 +83,49 @@ func (t *IntegrationTest) SetUp(ti *TestInfo) {
 	// Set up dependencies.
 	const cacheCapacity = 100
 	lruCache := lru.NewCache(mount.AverageSizeOfPositiveStatCacheEntry * cacheCapacity)
-	cache := metadata.NewStatCacheBucketView(lruCache, "")
+	t.cache = metadata.NewStatCacheBucketView(lruCache, "")
 	t.wrapped = fake.NewFakeBucket(&t.clock, bucketName)
+	t.counter = &countingBucket{Bucket: t.wrapped}
+
+	t.useCacheControlTTL(metadata.CacheControlTTL{})
+}
 
+func (t *IntegrationTest) useCacheControlTTL(c metadata.CacheControlTTL) {
 	t.bucket = caching.NewFastStatBucket(
-		ttl,
-		cache,
+		metadata.SameEntryTTLs(ttl),
+		c,
+		nil,
+		t.cache,
 		&t.clock,
-		t.wrapped)
+		t.counter)
+}
+
+// Create an object with the given Cache-Control through the back door, stat it
+// through the caching bucket, and then delete it through the back door again.
+func (t *IntegrationTest) statAndDeleteBehindCache(name string, cacheControl string) {
+	_, err := t.wrapped.CreateObject(t.ctx, &gcs.CreateObjectRequest{
+		Name:         name,
+		CacheControl: cacheControl,
+		Contents:     strings.NewReader(""),
+	})
+	AssertEq(nil, err)
+
+	_, err = t.stat(name)
+	AssertEq(nil, err)
+
+	err = t.wrapped.DeleteObject(t.ctx, &gcs.DeleteObjectRequest{Name: name})
+	AssertEq(nil, err)
+}
+
+func (t *IntegrationTest) isCached(name string) bool {
+	_, err := t.stat(name)
+	if err == nil {
+		return true
+	}
+
+	var notFoundErr *gcs.NotFoundError
+	AssertTrue(errors.As(err, &notFoundErr), "%v", err)
+	return false
 }
 
 func (t *IntegrationTest) stat(name string) (o *gcs.Object, err error) {
@@ -78,6 +138,51 @@ func (t *IntegrationTest) stat(name string) (o *gcs.Object, err error) {
 	return
 }
 
+// Probe the given prefixes the way an implicit directory lookup does, returning
+// the names of the first objects found.
+func (t *IntegrationTest) probe(fetchOnlyNames bool, prefixes ...string) (found []string) {
+	for _, p := range prefixes {
+		req := &gcs.ListObjectsRequest{
+			Prefix:         p,
+			MaxResults:     1,
+			FetchOnlyNames: fetchOnlyNames,
+		}
+
+		listing, err := t.bucket.ListObjects(t.ctx, req)
+		AssertEq(nil, err)
+
+		name := ""
+		if len(listing.Objects) > 0 {
+			name = listing.Objects[0].Name
+		}
+		found = append(found, name)
+	}
+
+	return
+}
+
+// A path 15 components deep.
+const deepPath = "c0/c1/c2/c3/c4/c5/c6/c7/c8/c9/c10/c11/c12/c13/file"
+
+// Look up each component of deepPath the way the file system does, with a
+// stat of the file and a probe of the directory it may be.
+func (t *IntegrationTest) lookUpDeepPath() {
+	components := strings.Split(deepPath, "/")
+	for i := range components {
+		name := strings.Join(components[:i+1], "/")
+
+		_, err := t.stat(name)
+		if i < len(components)-1 {
+			var notFoundErr *gcs.NotFoundError
+			AssertTrue(errors.As(err, &notFoundErr), "%v", err)
+		} else {
+			AssertEq(nil, err)
+		}
+
+		ExpectThat(t.probe(true, name+"/"), ElementsAre(Any()))
+	}
+}
+
 ////////////////////////////////////////////////////////////////////////
 // Test functions
 ////////////////////////////////////////////////////////////////////////
@@ -293,3 +398,249 @@ func (t *IntegrationTest) NegativeCacheExpiration() {
 	AssertEq(nil, err)
 	ExpectNe(nil, o)
 }
+
+func (t *IntegrationTest) RepeatedDeepProbes_WithoutNamesOnly() {
+	_, err := storageutil.CreateObject(t.ctx, t.wrapped, "a/b/c/d/file", []byte{})
+	AssertEq(nil, err)
+	prefixes := []string{"a/", "a/b/", "a/b/c/", "a/b/c/d/"}
+
+	// Ordinary listings always go to the wrapped bucket.
+	for i := 0; i < 3; i++ {
+		t.probe(false, prefixes...)
+	}
+
+	ExpectEq(3*len(prefixes), t.counter.listCount)
+}
+
+func (t *IntegrationTest) RepeatedDeepProbes_NamesOnly() {
+	_, err := storageutil.CreateObject(t.ctx, t.wrapped, "a/b/c/d/file", []byte{})
+	AssertEq(nil, err)
+	prefixes := []string{"a/", "a/b/", "a/b/c/", "a/b/c/d/"}
+
+	for i := 0; i < 3; i++ {
+		found := t.probe(true, prefixes...)
+		ExpectThat(found, ElementsAre("a/b/c/d/file", "a/b/c/d/file", "a/b/c/d/file", "a/b/c/d/file"))
+	}
+
+	// Only the first probe reaches the wrapped bucket; it reveals the
+	// directories below it.
+	ExpectEq(1, t.counter.listCount)
+
+	// After the TTL, the probes go out again.
+	t.clock.AdvanceTime(ttl + time.Millisecond)
+	t.probe(true, prefixes...)
+
+	ExpectEq(2, t.counter.listCount)
+}
+
+func (t *IntegrationTest) NegativeProbeIsCached() {
+	found := t.probe(true, "a/", "a/")
+
+	ExpectThat(found, ElementsAre("", ""))
+	ExpectEq(1, t.counter.listCount)
+}
+
+func (t *IntegrationTest) CreateInvalidatesAncestorProbes() {
+	// Cache negative results for a deep path and an unrelated one.
+	t.probe(true, "a/", "a/b/", "z/")
+	AssertEq(3, t.counter.listCount)
+
+	// Create an object under the deep path.
+	_, err := storageutil.CreateObject(t.ctx, t.bucket, "a/b/file", []byte{})
+	AssertEq(nil, err)
+
+	// Its ancestors must be probed again and now see it; probing the outermost
+	// one reveals the other, and the unrelated prefix is still cached.
+	found := t.probe(true, "a/", "a/b/", "z/")
+
+	ExpectThat(found, ElementsAre("a/b/file", "a/b/file", ""))
+	ExpectEq(4, t.counter.listCount)
+}
+
+func (t *IntegrationTest) DeleteInvalidatesAncestorProbes() {
+	_, err := storageutil.CreateObject(t.ctx, t.bucket, "a/b/file", []byte{})
+	AssertEq(nil, err)
+
+	// Cache positive results.
+	t.probe(true, "a/", "a/b/")
+	AssertEq(1, t.counter.listCount)
+
+	// Delete the object.
+	err = t.bucket.DeleteObject(t.ctx, &gcs.DeleteObjectRequest{Name: "a/b/file"})
+	AssertEq(nil, err)
+
+	found := t.probe(true, "a/", "a/b/")
+
+	ExpectThat(found, ElementsAre("", ""))
+	ExpectEq(3, t.counter.listCount)
+}
+
+func (t *IntegrationTest) StatOfDeletedObjectInvalidatesAncestorProbes() {
+	_, err := storageutil.CreateObject(t.ctx, t.wrapped, "a/b/file", []byte{})
+	AssertEq(nil, err)
+
+	// Cache positive results, then delete the object behind the cache's back.
+	t.probe(true, "a/", "a/b/", "z/")
+	AssertEq(2, t.counter.listCount)
+
+	err = t.wrapped.DeleteObject(t.ctx, &gcs.DeleteObjectRequest{Name: "a/b/file"})
+	AssertEq(nil, err)
+
+	// Finding it gone drops the probes it was found by, but not the others.
+	AssertFalse(t.isCached("a/b/file"))
+	found := t.probe(true, "a/", "a/b/", "z/")
+
+	ExpectThat(found, ElementsAre("", "", ""))
+	ExpectEq(4, t.counter.listCount)
+}
+
+func (t *IntegrationTest) StatOfDeletedObjectKeepsOtherWitnesses() {
+	_, err := storageutil.CreateObject(t.ctx, t.wrapped, "a/b/file", []byte{})
+	AssertEq(nil, err)
+
+	t.probe(true, "a/")
+	AssertEq(1, t.counter.listCount)
+
+	// A stat of another missing name under the prefix says nothing about it.
+	AssertFalse(t.isCached("a/other"))
+	found := t.probe(true, "a/")
+
+	ExpectThat(found, ElementsAre("a/b/file"))
+	ExpectEq(1, t.counter.listCount)
+}
+
+func (t *IntegrationTest) StatOfCreatedObjectInvalidatesNegativeProbes() {
+	// Cache negative results, then create an object behind the cache's back.
+	t.probe(true, "a/", "a/b/", "z/")
+	AssertEq(3, t.counter.listCount)
+
+	_, err := storageutil.CreateObject(t.ctx, t.wrapped, "a/b/file", []byte{})
+	AssertEq(nil, err)
+
+	// Finding it drops the probes of its ancestors, but not the others.
+	AssertTrue(t.isCached("a/b/file"))
+	found := t.probe(true, "a/", "a/b/", "z/")
+
+	ExpectThat(found, ElementsAre("a/b/file", "a/b/file", ""))
+	ExpectEq(4, t.counter.listCount)
+}
+
+func (t *IntegrationTest) ListingInvalidatesNegativeProbes() {
+	t.probe(true, "a/b/", "z/")
+	AssertEq(2, t.counter.listCount)
+
+	_, err := storageutil.CreateObject(t.ctx, t.wrapped, "a/b/file", []byte{})
+	AssertEq(nil, err)
+
+	// Listing the parent shows the directory, which then probes non-empty.
+	listing, err := t.bucket.ListObjects(t.ctx, &gcs.ListObjectsRequest{
+		Prefix:    "a/",
+		Delimiter: "/",
+	})
+	AssertEq(nil, err)
+	AssertThat(listing.CollapsedRuns, ElementsAre("a/b/"))
+
+	found := t.probe(true, "a/b/", "z/")
+
+	ExpectThat(found, ElementsAre("a/b/file", ""))
+	ExpectEq(4, t.counter.listCount)
+}
+
+func (t *IntegrationTest) DeepLookUp() {
+	_, err := storageutil.CreateObject(t.ctx, t.wrapped, deepPath, []byte{})
+	AssertEq(nil, err)
+
+	t.lookUpDeepPath()
+
+	// The first component takes a stat and a probe, which reveals everything
+	// down to the file, and the file itself takes a stat and a probe. Without
+	// that, every one of the 15 components took a stat and a probe.
+	ExpectEq(2, t.counter.statCount)
+	ExpectEq(2, t.counter.listCount)
+}
+
+func (t *IntegrationTest) DeepLookUp_HierarchicalBucket() {
+	t.wrapped = fake.NewFakeBucketWithType(&t.clock, "some_bucket", gcs.Hierarchical)
+	t.counter = &countingBucket{Bucket: t.wrapped}
+	t.useCacheControlTTL(metadata.CacheControlTTL{})
+
+	_, err := storageutil.CreateObject(t.ctx, t.wrapped, deepPath, []byte{})
+	AssertEq(nil, err)
+
+	t.lookUpDeepPath()
+
+	// Folders aren't objects, so the probes don't reveal anything about them.
+	ExpectEq(15, t.counter.statCount)
+	ExpectEq(15, t.counter.listCount)
+}
+
+func (t *IntegrationTest) DeepLookUp_CreateInvalidatesSeededEntries() {
+	_, err := storageutil.CreateObject(t.ctx, t.wrapped, deepPath, []byte{})
+	AssertEq(nil, err)
+	t.probe(true, "c0/")
+
+	// Create a file with the name of an intermediate directory.
+	_, err = storageutil.CreateObject(t.ctx, t.bucket, "c0/c1/c2", []byte{})
+	AssertEq(nil, err)
+
+	ExpectTrue(t.isCached("c0/c1/c2"))
+	ExpectThat(t.probe(true, "c0/c1/"), ElementsAre("c0/c1/c2"))
+}
+
+func (t *IntegrationTest) CacheControlIgnoredByDefault() {
+	t.statAndDeleteBehindCache("taco", "max-age=3600")
+
+	t.clock.AdvanceTime(ttl + time.Millisecond)
+	ExpectFalse(t.isCached("taco"))
+}
+
+func (t *IntegrationTest) CacheControlMaxAgeOverridesTTL() {
+	t.useCacheControlTTL(metadata.CacheControlTTL{Enabled: true, Max: time.Hour})
+	t.statAndDeleteBehindCache("taco", "public, max-age=600")
+
+	t.clock.AdvanceTime(10*time.Minute - time.Millisecond)
+	ExpectTrue(t.isCached("taco"))
+
+	t.clock.AdvanceTime(2 * time.Millisecond)
+	ExpectFalse(t.isCached("taco"))
+}
+
+func (t *IntegrationTest) CacheControlHugeMaxAgeIsClamped() {
+	t.useCacheControlTTL(metadata.CacheControlTTL{Enabled: true, Max: time.Hour})
+	t.statAndDeleteBehindCache("taco", "max-age=9223372036854775807, immutable")
+
+	t.clock.AdvanceTime(time.Hour - time.Millisecond)
+	ExpectTrue(t.isCached("taco"))
+
+	t.clock.AdvanceTime(2 * time.Millisecond)
+	ExpectFalse(t.isCached("taco"))
+}
+
+func (t *IntegrationTest) CacheControlMaxAgeZeroIsNotCached() {
+	t.useCacheControlTTL(metadata.CacheControlTTL{Enabled: true, Max: time.Hour})
+	t.statAndDeleteBehindCache("taco", "max-age=0")
+
+	ExpectFalse(t.isCached("taco"))
+}
+
+func (t *IntegrationTest) CacheControlNoStoreIsClampedToMin() {
+	t.useCacheControlTTL(metadata.CacheControlTTL{Enabled: true, Min: time.Minute, Max: time.Hour})
+	t.statAndDeleteBehindCache("taco", "no-store")
+
+	t.clock.AdvanceTime(time.Minute - time.Millisecond)
+	ExpectTrue(t.isCached("taco"))
+
+	t.clock.AdvanceTime(2 * time.Millisecond)
+	ExpectFalse(t.isCached("taco"))
+}
+
+func (t *IntegrationTest) CacheControlAbsentFallsBackToTTL() {
+	t.useCacheControlTTL(metadata.CacheControlTTL{Enabled: true, Max: time.Hour})
+	t.statAndDeleteBehindCache("taco", "")
+
+	t.clock.AdvanceTime(ttl - time.Millisecond)
+	ExpectTrue(t.isCached("taco"))
+
+	t.clock.AdvanceTime(2 * time.Millisecond)
+	ExpectFalse(t.isCached("taco"))
+}
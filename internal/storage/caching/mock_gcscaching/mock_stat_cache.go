@@ -78,6 +78,40 @@ func (m *mockStatCache) Erase(p0 string) {
 	}
 }
 
+func (m *mockStatCache) EraseEntriesWithGivenPrefix(p0 string) {
+	// Get a file name and line number for the caller.
+	_, file, line, _ := runtime.Caller(1)
+
+	// Hand the call off to the controller, which does most of the work.
+	retVals := m.controller.HandleMethodCall(
+		m,
+		"EraseEntriesWithGivenPrefix",
+		file,
+		line,
+		[]interface{}{p0})
+
+	if len(retVals) != 0 {
+		panic(fmt.Sprintf("mockStatCache.EraseEntriesWithGivenPrefix: invalid return values: %v", retVals))
+	}
+}
+
+func (m *mockStatCache) ErasePrefix(p0 string) {
+	// Get a file name and line number for the caller.
+	_, file, line, _ := runtime.Caller(1)
+
+	// Hand the call off to the controller, which does most of the work.
+	retVals := m.controller.HandleMethodCall(
+		m,
+		"ErasePrefix",
+		file,
+		line,
+		[]interface{}{p0})
+
+	if len(retVals) != 0 {
+		panic(fmt.Sprintf("mockStatCache.ErasePrefix: invalid return values: %v", retVals))
+	}
+}
+
 func (m *mockStatCache) Insert(p0 *gcs.MinObject, p1 time.Time) {
 	// Get a file name and line number for the caller.
 	_, file, line, _ := runtime.Caller(1)
@@ -123,3 +157,49 @@ func (m *mockStatCache) LookUp(p0 string, p1 time.Time) (o0 bool, o1 *gcs.MinObj
 
 	return
 }
+
+func (m *mockStatCache) InsertPrefix(p0 string, p1 string, p2 time.Time) {
+	// Get a file name and line number for the caller.
+	_, file, line, _ := runtime.Caller(1)
+
+	// Hand the call off to the controller, which does most of the work.
+	retVals := m.controller.HandleMethodCall(
+		m,
+		"InsertPrefix",
+		file,
+		line,
+		[]interface{}{p0, p1, p2})
+
+	if len(retVals) != 0 {
+		panic(fmt.Sprintf("mockStatCache.InsertPrefix: invalid return values: %v", retVals))
+	}
+}
+
+func (m *mockStatCache) LookUpPrefix(p0 string, p1 time.Time) (o0 bool, o1 string) {
+	// Get a file name and line number for the caller.
+	_, file, line, _ := runtime.Caller(1)
+
+	// Hand the call off to the controller, which does most of the work.
+	retVals := m.controller.HandleMethodCall(
+		m,
+		"LookUpPrefix",
+		file,
+		line,
+		[]interface{}{p0, p1})
+
+	if len(retVals) != 2 {
+		panic(fmt.Sprintf("mockStatCache.LookUpPrefix: invalid return values: %v", retVals))
+	}
+
+	// o0 bool
+	if retVals[0] != nil {
+		o0 = retVals[0].(bool)
+	}
+
+	// o1 string
+	if retVals[1] != nil {
+		o1 = retVals[1].(string)
+	}
+
+	return
+}
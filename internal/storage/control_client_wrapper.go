@@ -17,6 +17,7 @@ package storage
 import (
 	"context"
 
+	control "cloud.google.com/go/storage/control/apiv2"
 	"cloud.google.com/go/storage/control/apiv2/controlpb"
 	"github.com/googleapis/gax-go/v2"
 )
@@ -25,4 +26,35 @@ type StorageControlClient interface {
 	GetStorageLayout(ctx context.Context,
 		req *controlpb.GetStorageLayoutRequest,
 		opts ...gax.CallOption) (*controlpb.StorageLayout, error)
+
+	CreateFolder(ctx context.Context,
+		req *controlpb.CreateFolderRequest,
+		opts ...gax.CallOption) (*controlpb.Folder, error)
+
+	DeleteFolder(ctx context.Context,
+		req *controlpb.DeleteFolderRequest,
+		opts ...gax.CallOption) error
+
+	// Unlike the one of control.StorageControlClient, waits for the long-running
+	// rename operation to complete.
+	RenameFolder(ctx context.Context,
+		req *controlpb.RenameFolderRequest,
+		opts ...gax.CallOption) (*controlpb.Folder, error)
+}
+
+// storageControlClientWrapper adapts control.StorageControlClient to the
+// StorageControlClient interface.
+type storageControlClientWrapper struct {
+	*control.StorageControlClient
+}
+
+func (c *storageControlClientWrapper) RenameFolder(ctx context.Context,
+	req *controlpb.RenameFolderRequest,
+	opts ...gax.CallOption) (*controlpb.Folder, error) {
+	op, err := c.StorageControlClient.RenameFolder(ctx, req, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return op.Wait(ctx, opts...)
 }
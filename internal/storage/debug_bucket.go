@@ -69,11 +69,13 @@ func (b *debugBucket) startRequest(
 }
 
 func (b *debugBucket) finishRequest(
+	ctx context.Context,
 	id uint64,
 	desc string,
 	start time.Time,
 	err *error) {
 	duration := time.Since(start)
+	gcs.CountRequest(ctx, duration)
 
 	errDesc := "OK"
 	if *err != nil {
@@ -108,6 +110,7 @@ func (dr *debugReader) Read(p []byte) (n int, err error) {
 
 func (dr *debugReader) Close() (err error) {
 	defer dr.bucket.finishRequest(
+		context.Background(),
 		dr.requestID,
 		dr.desc,
 		dr.startTime,
@@ -129,6 +132,15 @@ func (b *debugBucket) BucketType() gcs.BucketType {
 	return b.wrapped.BucketType()
 }
 
+func (b *debugBucket) GetRetentionPolicy(
+	ctx context.Context) (p *gcs.RetentionPolicy, err error) {
+	id, desc, start := b.startRequest("GetRetentionPolicy()")
+	defer b.finishRequest(ctx, id, desc, start, &err)
+
+	p, err = b.wrapped.GetRetentionPolicy(ctx)
+	return
+}
+
 func (b *debugBucket) NewReader(
 	ctx context.Context,
 	req *gcs.ReadObjectRequest) (rc io.ReadCloser, err error) {
@@ -137,10 +149,14 @@ func (b *debugBucket) NewReader(
 	// Call through.
 	rc, err = b.wrapped.NewReader(ctx, req)
 	if err != nil {
-		b.finishRequest(id, desc, start, &err)
+		b.finishRequest(ctx, id, desc, start, &err)
 		return
 	}
 
+	// The read counts for the operation opening the reader, up to its first
+	// byte. The reader may be closed by a later operation, or none at all.
+	gcs.CountRequest(ctx, time.Since(start))
+
 	// Return a special reader that prings debug info.
 	rc = &debugReader{
 		bucket:    b,
@@ -157,7 +173,7 @@ func (b *debugBucket) CreateObject(
 	ctx context.Context,
 	req *gcs.CreateObjectRequest) (o *gcs.Object, err error) {
 	id, desc, start := b.startRequest("CreateObject(%q)", req.Name)
-	defer b.finishRequest(id, desc, start, &err)
+	defer b.finishRequest(ctx, id, desc, start, &err)
 
 	o, err = b.wrapped.CreateObject(context.WithValue(ctx, gcs.ReqIdField, id), req)
 	return
@@ -171,7 +187,7 @@ func (b *debugBucket) CopyObject(
 		req.SrcName,
 		req.DstName)
 
-	defer b.finishRequest(id, desc, start, &err)
+	defer b.finishRequest(ctx, id, desc, start, &err)
 
 	o, err = b.wrapped.CopyObject(ctx, req)
 	return
@@ -184,7 +200,7 @@ func (b *debugBucket) ComposeObjects(
 		"ComposeObjects(%q)",
 		req.DstName)
 
-	defer b.finishRequest(id, desc, start, &err)
+	defer b.finishRequest(ctx, id, desc, start, &err)
 
 	o, err = b.wrapped.ComposeObjects(ctx, req)
 	return
@@ -194,7 +210,7 @@ func (b *debugBucket) StatObject(
 	ctx context.Context,
 	req *gcs.StatObjectRequest) (m *gcs.MinObject, e *gcs.ExtendedObjectAttributes, err error) {
 	id, desc, start := b.startRequest("StatObject(%q)", req.Name)
-	defer b.finishRequest(id, desc, start, &err)
+	defer b.finishRequest(ctx, id, desc, start, &err)
 
 	m, e, err = b.wrapped.StatObject(ctx, req)
 	return
@@ -204,7 +220,7 @@ func (b *debugBucket) ListObjects(
 	ctx context.Context,
 	req *gcs.ListObjectsRequest) (listing *gcs.Listing, err error) {
 	id, desc, start := b.startRequest("ListObjects(%q)", req.Prefix)
-	defer b.finishRequest(id, desc, start, &err)
+	defer b.finishRequest(ctx, id, desc, start, &err)
 
 	listing, err = b.wrapped.ListObjects(ctx, req)
 	return
@@ -214,7 +230,7 @@ func (b *debugBucket) UpdateObject(
 	ctx context.Context,
 	req *gcs.UpdateObjectRequest) (o *gcs.Object, err error) {
 	id, desc, start := b.startRequest("UpdateObject(%q)", req.Name)
-	defer b.finishRequest(id, desc, start, &err)
+	defer b.finishRequest(ctx, id, desc, start, &err)
 
 	o, err = b.wrapped.UpdateObject(ctx, req)
 	return
@@ -224,8 +240,39 @@ func (b *debugBucket) DeleteObject(
 	ctx context.Context,
 	req *gcs.DeleteObjectRequest) (err error) {
 	id, desc, start := b.startRequest("DeleteObject(%q)", req.Name)
-	defer b.finishRequest(id, desc, start, &err)
+	defer b.finishRequest(ctx, id, desc, start, &err)
 
 	err = b.wrapped.DeleteObject(ctx, req)
 	return
 }
+
+func (b *debugBucket) CreateFolder(
+	ctx context.Context,
+	folderName string) (f *gcs.Folder, err error) {
+	id, desc, start := b.startRequest("CreateFolder(%q)", folderName)
+	defer b.finishRequest(ctx, id, desc, start, &err)
+
+	f, err = b.wrapped.CreateFolder(ctx, folderName)
+	return
+}
+
+func (b *debugBucket) DeleteFolder(
+	ctx context.Context,
+	folderName string) (err error) {
+	id, desc, start := b.startRequest("DeleteFolder(%q)", folderName)
+	defer b.finishRequest(ctx, id, desc, start, &err)
+
+	err = b.wrapped.DeleteFolder(ctx, folderName)
+	return
+}
+
+func (b *debugBucket) RenameFolder(
+	ctx context.Context,
+	folderName string,
+	destinationFolderName string) (f *gcs.Folder, err error) {
+	id, desc, start := b.startRequest("RenameFolder(%q, %q)", folderName, destinationFolderName)
+	defer b.finishRequest(ctx, id, desc, start, &err)
+
+	f, err = b.wrapped.RenameFolder(ctx, folderName, destinationFolderName)
+	return
+}
@@ -23,6 +23,8 @@ import (
 	"fmt"
 	"hash/crc32"
 	"io"
+	"regexp"
+	"slices"
 	"sort"
 	"strings"
 	"unicode/utf8"
@@ -42,6 +44,23 @@ func NewFakeBucket(clock timeutil.Clock, name string) gcs.Bucket {
 	return b
 }
 
+// NewFakeBucketWithRetentionPolicy is like NewFakeBucket, but the bucket
+// reports the given retention policy. The policy isn't enforced.
+func NewFakeBucketWithRetentionPolicy(clock timeutil.Clock, name string, policy gcs.RetentionPolicy) gcs.Bucket {
+	b := &bucket{clock: clock, name: name, retentionPolicy: &policy}
+	b.mu = syncutil.NewInvariantMutex(b.checkInvariants)
+	return b
+}
+
+// NewFakeBucketWithType is like NewFakeBucket, but the bucket reports the given
+// type. The folder methods are only supported by gcs.Hierarchical buckets, in
+// which folders are represented by directory objects.
+func NewFakeBucketWithType(clock timeutil.Clock, name string, bucketType gcs.BucketType) gcs.Bucket {
+	b := &bucket{clock: clock, name: name, bucketType: bucketType}
+	b.mu = syncutil.NewInvariantMutex(b.checkInvariants)
+	return b
+}
+
 ////////////////////////////////////////////////////////////////////////
 // Helper types
 ////////////////////////////////////////////////////////////////////////
@@ -129,6 +148,9 @@ type bucket struct {
 	bucketType gcs.BucketType
 	mu         syncutil.InvariantMutex
 
+	// The retention policy reported, or nil for none.
+	retentionPolicy *gcs.RetentionPolicy
+
 	// The set of extant objects.
 	//
 	// INVARIANT: Strictly increasing.
@@ -217,6 +239,7 @@ func (b *bucket) mintObject(
 		MetaGeneration:  1,
 		StorageClass:    "STANDARD",
 		Updated:         b.clock.Now(),
+		Created:         b.clock.Now(),
 	}
 
 	// Set up data.
@@ -336,8 +359,9 @@ func (b *bucket) createObjectLocked(
 	if existingIndex < len(b.objects) {
 		b.objects[existingIndex] = fo
 	} else {
-		b.objects = append(b.objects, fo)
-		sort.Sort(b.objects)
+		// Insert it in order, rather than sorting again, which buckets seeded
+		// with many objects would spend most of their time on.
+		b.objects = slices.Insert(b.objects, b.objects.lowerBound(req.Name), fo)
 	}
 
 	return
@@ -401,14 +425,6 @@ func (b *bucket) newReaderLocked(
 	return
 }
 
-func minInt(a, b int) int {
-	if a < b {
-		return a
-	}
-
-	return b
-}
-
 func copyMetadata(in map[string]string) (out map[string]string) {
 	if in == nil {
 		return
@@ -440,6 +456,10 @@ func (b *bucket) BucketType() gcs.BucketType {
 	return b.bucketType
 }
 
+func (b *bucket) GetRetentionPolicy(ctx context.Context) (*gcs.RetentionPolicy, error) {
+	return b.retentionPolicy, nil
+}
+
 // LOCKS_EXCLUDED(b.mu)
 func (b *bucket) ListObjects(
 	ctx context.Context,
@@ -450,6 +470,15 @@ func (b *bucket) ListObjects(
 	// Set up the result object.
 	listing = new(gcs.Listing)
 
+	var glob *regexp.Regexp
+	if req.MatchGlob != "" {
+		glob, err = storageutil.CompileGlob(req.MatchGlob)
+		if err != nil {
+			err = fmt.Errorf("Invalid matchGlob: %w", err)
+			return
+		}
+	}
+
 	// Handle defaults.
 	maxResults := req.MaxResults
 	if maxResults == 0 {
@@ -462,17 +491,25 @@ func (b *bucket) ListObjects(
 		nameStart = req.ContinuationToken
 	}
 
-	// Find the range of indexes within the array to scan.
+	// Find the range of indexes within the array to scan. Objects not matching
+	// the glob don't count towards maxResults.
 	indexStart := b.objects.lowerBound(nameStart)
 	prefixLimit := b.objects.prefixUpperBound(req.Prefix)
-	indexLimit := minInt(indexStart+maxResults, prefixLimit)
 
 	// Scan the array.
 	var lastResultWasPrefix bool
-	for i := indexStart; i < indexLimit; i++ {
-		var o fakeObject = b.objects[i]
+	var scanned int
+	indexLimit := indexStart
+	for ; indexLimit < prefixLimit && scanned < maxResults; indexLimit++ {
+		var o fakeObject = b.objects[indexLimit]
 		name := o.metadata.Name
 
+		// Objects not matching the glob are neither returned nor collapsed.
+		if glob != nil && !glob.MatchString(name) {
+			continue
+		}
+		scanned++
+
 		// Search for a delimiter if necessary.
 		if req.Delimiter != "" {
 			// Search only in the part after the prefix.
@@ -614,6 +651,26 @@ func (b *bucket) CopyObject(
 		}
 	}
 
+	// Does the destination have the correct generation?
+	existingIndex := b.objects.find(req.DstName)
+	if req.DstGenerationPrecondition != nil {
+		var gen int64
+		if existingIndex < len(b.objects) {
+			gen = b.objects[existingIndex].metadata.Generation
+		}
+
+		if gen != *req.DstGenerationPrecondition {
+			err = &gcs.PreconditionError{
+				Err: fmt.Errorf(
+					"Object %q has generation %d",
+					req.DstName,
+					gen),
+			}
+
+			return
+		}
+	}
+
 	// Copy it and assign a new generation number, to ensure that the generation
 	// number for the destination name is strictly increasing.
 	dst := b.objects[srcIndex]
@@ -624,7 +681,6 @@ func (b *bucket) CopyObject(
 	dst.metadata.Generation = b.prevGeneration
 
 	// Insert into our array.
-	existingIndex := b.objects.find(req.DstName)
 	if existingIndex < len(b.objects) {
 		b.objects[existingIndex] = dst
 	} else {
@@ -690,6 +746,7 @@ func (b *bucket) ComposeObjects(
 		Contents:                   io.MultiReader(srcReaders...),
 		ContentType:                req.ContentType,
 		Metadata:                   req.Metadata,
+		CRC32C:                     req.CRC32C,
 	}
 
 	_, err = b.createObjectLocked(createReq)
@@ -866,3 +923,139 @@ func (b *bucket) DeleteObject(
 
 	return
 }
+
+// LOCKS_REQUIRED(b.mu)
+func (b *bucket) checkFolderName(folderName string) (err error) {
+	if b.bucketType != gcs.Hierarchical {
+		err = errors.New("Folders are only supported by buckets with a hierarchical namespace")
+		return
+	}
+
+	if !strings.HasSuffix(folderName, "/") {
+		err = fmt.Errorf("Invalid folder name %q: must end with a slash", folderName)
+		return
+	}
+
+	err = checkName(folderName)
+	return
+}
+
+// LOCKS_EXCLUDED(b.mu)
+func (b *bucket) CreateFolder(
+	ctx context.Context,
+	folderName string) (f *gcs.Folder, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err = b.checkFolderName(folderName); err != nil {
+		return
+	}
+
+	var precondition int64 = 0
+	o, err := b.createObjectLocked(&gcs.CreateObjectRequest{
+		Name:                   folderName,
+		Contents:               strings.NewReader(""),
+		GenerationPrecondition: &precondition,
+	})
+	if err != nil {
+		return
+	}
+
+	f = &gcs.Folder{
+		Name:           o.Name,
+		MetaGeneration: o.MetaGeneration,
+		UpdateTime:     o.Updated,
+	}
+
+	return
+}
+
+// LOCKS_EXCLUDED(b.mu)
+func (b *bucket) DeleteFolder(
+	ctx context.Context,
+	folderName string) (err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err = b.checkFolderName(folderName); err != nil {
+		return
+	}
+
+	index := b.objects.find(folderName)
+	if index == len(b.objects) {
+		return
+	}
+
+	if b.objects.prefixUpperBound(folderName) > index+1 {
+		err = &gcs.PreconditionError{
+			Err: fmt.Errorf("Folder %q is not empty", folderName),
+		}
+
+		return
+	}
+
+	b.objects = append(b.objects[:index], b.objects[index+1:]...)
+
+	return
+}
+
+// LOCKS_EXCLUDED(b.mu)
+func (b *bucket) RenameFolder(
+	ctx context.Context,
+	folderName string,
+	destinationFolderName string) (f *gcs.Folder, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err = b.checkFolderName(folderName); err != nil {
+		return
+	}
+
+	if err = b.checkFolderName(destinationFolderName); err != nil {
+		return
+	}
+
+	if strings.HasPrefix(destinationFolderName, folderName) {
+		err = fmt.Errorf("Can't rename folder %q into itself", folderName)
+		return
+	}
+
+	index := b.objects.find(folderName)
+	if index == len(b.objects) {
+		err = &gcs.NotFoundError{
+			Err: fmt.Errorf("Folder %q not found", folderName),
+		}
+
+		return
+	}
+
+	destinationIndex := b.objects.lowerBound(destinationFolderName)
+	if destinationIndex < b.objects.prefixUpperBound(destinationFolderName) {
+		err = &gcs.PreconditionError{
+			Err: fmt.Errorf("Folder %q already exists", destinationFolderName),
+		}
+
+		return
+	}
+
+	// Move the folder and everything under it, keeping the generations of the
+	// objects.
+	limit := b.objects.prefixUpperBound(folderName)
+	for i := index; i < limit; i++ {
+		o := &b.objects[i].metadata
+		o.Name = destinationFolderName + strings.TrimPrefix(o.Name, folderName)
+	}
+	sort.Sort(b.objects)
+
+	folder := &b.objects[b.objects.find(destinationFolderName)].metadata
+	folder.MetaGeneration++
+	folder.Updated = b.clock.Now()
+
+	f = &gcs.Folder{
+		Name:           folder.Name,
+		MetaGeneration: folder.MetaGeneration,
+		UpdateTime:     folder.Updated,
+	}
+
+	return
+}
@@ -0,0 +1,281 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fake
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+)
+
+// CountingBucket wraps a bucket for tests, counting the requests made of it
+// by method, e.g. "StatObject", and by object name, and how many requests of
+// each method run at once. It is safe for concurrent use.
+type CountingBucket struct {
+	gcs.Bucket
+
+	// If non-nil, called with the method and object name of each request, the
+	// prefix for listings, before it is forwarded to the wrapped bucket, while
+	// it counts as running. It may block, e.g. to hold up requests, and a
+	// non-nil error fails the request with it.
+	Intercept func(ctx context.Context, method string, name string) error
+
+	mu sync.Mutex
+
+	// GUARDED_BY(mu)
+	counts     map[string]int64
+	nameCounts map[methodName]int64
+	running    map[string]int
+	maxRunning map[string]int
+}
+
+type methodName struct {
+	method string
+	name   string
+}
+
+// NewCountingBucket returns a CountingBucket wrapping the given bucket.
+func NewCountingBucket(wrapped gcs.Bucket) *CountingBucket {
+	b := &CountingBucket{
+		Bucket:  wrapped,
+		running: make(map[string]int),
+	}
+	b.Reset()
+	return b
+}
+
+// Reset forgets the requests counted so far, other than those still running.
+func (b *CountingBucket) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.counts = make(map[string]int64)
+	b.nameCounts = make(map[methodName]int64)
+	b.maxRunning = make(map[string]int)
+}
+
+// Count returns the number of requests of the method made so far, or of all
+// methods if empty.
+func (b *CountingBucket) Count(method string) int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if method != "" {
+		return b.counts[method]
+	}
+
+	var n int64
+	for _, c := range b.counts {
+		n += c
+	}
+	return n
+}
+
+// CountOf returns the number of requests of the method for the object name
+// made so far.
+func (b *CountingBucket) CountOf(method string, name string) int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.nameCounts[methodName{method, name}]
+}
+
+// Counts returns the number of requests made so far of each method that has
+// been requested.
+func (b *CountingBucket) Counts() map[string]int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	counts := make(map[string]int64, len(b.counts))
+	for method, n := range b.counts {
+		counts[method] = n
+	}
+	return counts
+}
+
+// Running returns the number of requests of the method running now.
+func (b *CountingBucket) Running(method string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.running[method]
+}
+
+// MaxRunning returns the largest number of requests of the method that have
+// run at once so far.
+func (b *CountingBucket) MaxRunning(method string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.maxRunning[method]
+}
+
+// start counts a request, calling Intercept for it. The returned function
+// must be called once the request is done, unless an error is returned.
+func (b *CountingBucket) start(ctx context.Context, method string, name string) (done func(), err error) {
+	b.mu.Lock()
+	b.counts[method]++
+	b.nameCounts[methodName{method, name}]++
+	b.running[method]++
+	b.maxRunning[method] = max(b.maxRunning[method], b.running[method])
+	b.mu.Unlock()
+
+	done = func() {
+		b.mu.Lock()
+		b.running[method]--
+		b.mu.Unlock()
+	}
+
+	if b.Intercept != nil {
+		if err = b.Intercept(ctx, method, name); err != nil {
+			done()
+			return nil, err
+		}
+	}
+	return done, nil
+}
+
+func (b *CountingBucket) GetRetentionPolicy(ctx context.Context) (*gcs.RetentionPolicy, error) {
+	done, err := b.start(ctx, "GetRetentionPolicy", "")
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+	return b.Bucket.GetRetentionPolicy(ctx)
+}
+
+func (b *CountingBucket) NewReader(
+	ctx context.Context,
+	req *gcs.ReadObjectRequest) (io.ReadCloser, error) {
+	done, err := b.start(ctx, "NewReader", req.Name)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+	return b.Bucket.NewReader(ctx, req)
+}
+
+func (b *CountingBucket) CreateObject(
+	ctx context.Context,
+	req *gcs.CreateObjectRequest) (*gcs.Object, error) {
+	done, err := b.start(ctx, "CreateObject", req.Name)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+	return b.Bucket.CreateObject(ctx, req)
+}
+
+func (b *CountingBucket) CopyObject(
+	ctx context.Context,
+	req *gcs.CopyObjectRequest) (*gcs.Object, error) {
+	done, err := b.start(ctx, "CopyObject", req.DstName)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+	return b.Bucket.CopyObject(ctx, req)
+}
+
+func (b *CountingBucket) ComposeObjects(
+	ctx context.Context,
+	req *gcs.ComposeObjectsRequest) (*gcs.Object, error) {
+	done, err := b.start(ctx, "ComposeObjects", req.DstName)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+	return b.Bucket.ComposeObjects(ctx, req)
+}
+
+func (b *CountingBucket) StatObject(
+	ctx context.Context,
+	req *gcs.StatObjectRequest) (*gcs.MinObject, *gcs.ExtendedObjectAttributes, error) {
+	done, err := b.start(ctx, "StatObject", req.Name)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer done()
+	return b.Bucket.StatObject(ctx, req)
+}
+
+func (b *CountingBucket) ListObjects(
+	ctx context.Context,
+	req *gcs.ListObjectsRequest) (*gcs.Listing, error) {
+	done, err := b.start(ctx, "ListObjects", req.Prefix)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+	return b.Bucket.ListObjects(ctx, req)
+}
+
+func (b *CountingBucket) UpdateObject(
+	ctx context.Context,
+	req *gcs.UpdateObjectRequest) (*gcs.Object, error) {
+	done, err := b.start(ctx, "UpdateObject", req.Name)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+	return b.Bucket.UpdateObject(ctx, req)
+}
+
+func (b *CountingBucket) DeleteObject(
+	ctx context.Context,
+	req *gcs.DeleteObjectRequest) error {
+	done, err := b.start(ctx, "DeleteObject", req.Name)
+	if err != nil {
+		return err
+	}
+	defer done()
+	return b.Bucket.DeleteObject(ctx, req)
+}
+
+func (b *CountingBucket) CreateFolder(
+	ctx context.Context,
+	folderName string) (*gcs.Folder, error) {
+	done, err := b.start(ctx, "CreateFolder", folderName)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+	return b.Bucket.CreateFolder(ctx, folderName)
+}
+
+func (b *CountingBucket) DeleteFolder(
+	ctx context.Context,
+	folderName string) error {
+	done, err := b.start(ctx, "DeleteFolder", folderName)
+	if err != nil {
+		return err
+	}
+	defer done()
+	return b.Bucket.DeleteFolder(ctx, folderName)
+}
+
+func (b *CountingBucket) RenameFolder(
+	ctx context.Context,
+	folderName string,
+	destinationFolderName string) (*gcs.Folder, error) {
+	done, err := b.start(ctx, "RenameFolder", folderName)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+	return b.Bucket.RenameFolder(ctx, folderName, destinationFolderName)
+}
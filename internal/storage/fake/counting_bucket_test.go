@@ -0,0 +1,82 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fake
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	"github.com/jacobsa/timeutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCountingBucketCountsByMethodAndName(t *testing.T) {
+	ctx := context.Background()
+	b := NewCountingBucket(NewFakeBucket(timeutil.RealClock(), "some_bucket"))
+	_, err := storageutil.CreateObject(ctx, b, "foo", []byte("taco"))
+	require.NoError(t, err)
+
+	for _, name := range []string{"foo", "foo", "bar"} {
+		_, _, _ = b.StatObject(ctx, &gcs.StatObjectRequest{Name: name})
+	}
+
+	assert.Equal(t, int64(3), b.Count("StatObject"))
+	assert.Equal(t, int64(2), b.CountOf("StatObject", "foo"))
+	assert.Equal(t, int64(4), b.Count(""))
+	assert.Equal(t, map[string]int64{"CreateObject": 1, "StatObject": 3}, b.Counts())
+
+	b.Reset()
+	assert.Zero(t, b.Count(""))
+}
+
+func TestCountingBucketIntercept(t *testing.T) {
+	ctx := context.Background()
+	b := NewCountingBucket(NewFakeBucket(timeutil.RealClock(), "some_bucket"))
+	unblock := make(chan struct{})
+	b.Intercept = func(ctx context.Context, method string, name string) error {
+		<-unblock
+		if name == "fail" {
+			return errors.New("taco")
+		}
+		return nil
+	}
+
+	// Requests held up by Intercept count as running.
+	var wg sync.WaitGroup
+	for _, name := range []string{"foo", "bar", "fail"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = b.DeleteObject(ctx, &gcs.DeleteObjectRequest{Name: name})
+		}()
+	}
+	for b.Count("DeleteObject") < 3 {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, 3, b.Running("DeleteObject"))
+	close(unblock)
+	wg.Wait()
+
+	assert.Zero(t, b.Running("DeleteObject"))
+	assert.Equal(t, 3, b.MaxRunning("DeleteObject"))
+	err := b.DeleteObject(ctx, &gcs.DeleteObjectRequest{Name: "fail"})
+	assert.EqualError(t, err, "taco")
+}
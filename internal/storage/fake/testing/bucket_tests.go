@@ -26,6 +26,7 @@ import (
 	"io"
 	"log"
 	"math"
+	"path"
 	"sort"
 	"strings"
 	"testing/iotest"
@@ -1639,6 +1640,95 @@ func (t *copyTest) SrcMetaGenerationPrecondition_Satisfied() {
 	ExpectEq(nil, err)
 }
 
+func (t *copyTest) DstGenerationPrecondition_Unsatisfied() {
+	var err error
+
+	// Create a source object and an existing destination.
+	_, err = t.bucket.CreateObject(
+		t.ctx,
+		&gcs.CreateObjectRequest{
+			Name:     "foo",
+			Contents: strings.NewReader("taco"),
+		})
+
+	AssertEq(nil, err)
+
+	dst, err := t.bucket.CreateObject(
+		t.ctx,
+		&gcs.CreateObjectRequest{
+			Name:     "bar",
+			Contents: strings.NewReader("burrito"),
+		})
+
+	AssertEq(nil, err)
+
+	// Attempt to copy, with preconditions that don't hold.
+	for _, precond := range []int64{0, dst.Generation + 1} {
+		req := &gcs.CopyObjectRequest{
+			SrcName:                   "foo",
+			DstName:                   "bar",
+			DstGenerationPrecondition: &precond,
+		}
+
+		_, err = t.bucket.CopyObject(t.ctx, req)
+		AssertThat(err, HasSameTypeAs(&gcs.PreconditionError{}))
+	}
+
+	// The destination should be unchanged.
+	m, _, err := t.bucket.StatObject(
+		t.ctx,
+		&gcs.StatObjectRequest{Name: "bar"})
+
+	AssertEq(nil, err)
+	ExpectEq(dst.Generation, m.Generation)
+}
+
+func (t *copyTest) DstGenerationPrecondition_Satisfied() {
+	var err error
+
+	// Create a source object and an existing destination.
+	_, err = t.bucket.CreateObject(
+		t.ctx,
+		&gcs.CreateObjectRequest{
+			Name:     "foo",
+			Contents: strings.NewReader("taco"),
+		})
+
+	AssertEq(nil, err)
+
+	dst, err := t.bucket.CreateObject(
+		t.ctx,
+		&gcs.CreateObjectRequest{
+			Name:     "bar",
+			Contents: strings.NewReader("burrito"),
+		})
+
+	AssertEq(nil, err)
+
+	// Copy over it, with a precondition.
+	req := &gcs.CopyObjectRequest{
+		SrcName:                   "foo",
+		DstName:                   "bar",
+		DstGenerationPrecondition: &dst.Generation,
+	}
+
+	o, err := t.bucket.CopyObject(t.ctx, req)
+	AssertEq(nil, err)
+	ExpectNe(dst.Generation, o.Generation)
+	ExpectEq(len("taco"), o.Size)
+
+	// Copy to a new name, requiring that it doesn't exist.
+	var zero int64
+	req = &gcs.CopyObjectRequest{
+		SrcName:                   "foo",
+		DstName:                   "baz",
+		DstGenerationPrecondition: &zero,
+	}
+
+	_, err = t.bucket.CopyObject(t.ctx, req)
+	ExpectEq(nil, err)
+}
+
 ////////////////////////////////////////////////////////////////////////
 // Compose
 ////////////////////////////////////////////////////////////////////////
@@ -4300,6 +4390,143 @@ func (t *listTest) Cursor_BucketEndsWithRunOfObjectsGroupedByDelimiter() {
 		))
 }
 
+// List everything under the prefix matching the glob, a page of the given size
+// at a time.
+func (t *listTest) listMatching(prefix, glob string, maxResults int) (names []string) {
+	req := &gcs.ListObjectsRequest{
+		Prefix:     prefix,
+		MatchGlob:  glob,
+		MaxResults: maxResults,
+	}
+
+	for {
+		listing, err := t.bucket.ListObjects(t.ctx, req)
+		AssertEq(nil, err)
+
+		for _, o := range listing.Objects {
+			names = append(names, o.Name)
+		}
+
+		if listing.ContinuationToken == "" {
+			return
+		}
+
+		req.ContinuationToken = listing.ContinuationToken
+	}
+}
+
+func (t *listTest) MatchGlob_AgreesWithClientSideFiltering() {
+	names := []string{
+		"a.txt",
+		"b.txt",
+		"b.log",
+		"dir/",
+		"dir/a.txt",
+		"dir/b.txt",
+		"dir/c.log",
+		"dir/sub/a.txt",
+		"dir/sub/d.log",
+		"other/a.txt",
+	}
+	AssertEq(nil, createEmpty(t.ctx, t.bucket, names))
+
+	// Patterns whose meaning path.Match shares, so that it can serve as the
+	// reference.
+	patterns := []string{
+		"*.txt",
+		"dir/*",
+		"dir/?.txt",
+		"dir/[ab].txt",
+		"dir/[^ab].*",
+		"*/a.txt",
+		"*/*/*.log",
+		"nothing*",
+	}
+
+	for _, pattern := range patterns {
+		var expected []string
+		for _, name := range names {
+			matched, err := path.Match(pattern, name)
+			AssertEq(nil, err)
+			if matched {
+				expected = append(expected, name)
+			}
+		}
+
+		for _, maxResults := range []int{0, 1, 3} {
+			ExpectThat(
+				t.listMatching("", pattern, maxResults),
+				DeepEquals(expected),
+				"pattern: %q, maxResults: %d", pattern, maxResults)
+		}
+	}
+}
+
+func (t *listTest) MatchGlob_Extended() {
+	AssertEq(
+		nil,
+		createEmpty(
+			t.ctx,
+			t.bucket,
+			[]string{
+				"dir/a.txt",
+				"dir/b.txt",
+				"dir/c.log",
+				"dir/sub/a.txt",
+				"dir/sub/d.log",
+				"dirt",
+			}))
+
+	ExpectThat(
+		t.listMatching("dir/", "dir/**.log", 0),
+		ElementsAre("dir/c.log", "dir/sub/d.log"))
+
+	ExpectThat(
+		t.listMatching("dir/", "dir/{a.txt,c.log,sub/d.log}", 2),
+		ElementsAre("dir/a.txt", "dir/c.log", "dir/sub/d.log"))
+
+	ExpectThat(
+		t.listMatching("", "dir{,/sub}/a.txt", 0),
+		ElementsAre("dir/a.txt", "dir/sub/a.txt"))
+}
+
+func (t *listTest) MatchGlob_WithDelimiter() {
+	AssertEq(
+		nil,
+		createEmpty(
+			t.ctx,
+			t.bucket,
+			[]string{
+				"a.txt",
+				"b.log",
+				"dir/a.txt",
+				"logs/b.log",
+			}))
+
+	// Only runs containing a matching object are returned.
+	listing, err := t.bucket.ListObjects(
+		t.ctx,
+		&gcs.ListObjectsRequest{
+			Delimiter: "/",
+			MatchGlob: "**.txt",
+		})
+
+	AssertEq(nil, err)
+	ExpectThat(listing.CollapsedRuns, ElementsAre("dir/"))
+	AssertEq(1, len(listing.Objects))
+	ExpectEq("a.txt", listing.Objects[0].Name)
+}
+
+func (t *listTest) MatchGlob_Invalid() {
+	_, err := t.bucket.ListObjects(
+		t.ctx,
+		&gcs.ListObjectsRequest{
+			MatchGlob: "{a,b",
+		})
+
+	ExpectNe(nil, err)
+}
+
 ////////////////////////////////////////////////////////////////////////
 // Cancellation
 ////////////////////////////////////////////////////////////////////////
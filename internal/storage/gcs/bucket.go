@@ -16,6 +16,7 @@ package gcs
 
 import (
 	"io"
+	"time"
 
 	"golang.org/x/net/context"
 )
@@ -43,6 +44,14 @@ const (
 	ReqIdField string = "GcsReqId"
 )
 
+// RetentionPolicy is the retention policy of a bucket: its objects can't be
+// deleted or replaced until they are RetentionPeriod old. A locked policy
+// can't be removed or shortened.
+type RetentionPolicy struct {
+	RetentionPeriod time.Duration
+	Locked          bool
+}
+
 // Bucket represents a GCS bucket, pre-bound with a bucket name and necessary
 // authorization information.
 //
@@ -57,6 +66,12 @@ type Bucket interface {
 	// Return Type of bucket e.g. Hierarchical or NonHierarchical
 	BucketType() BucketType
 
+	// Return the retention policy of the bucket, or nil if it has none.
+	//
+	// Official documentation:
+	//     https://cloud.google.com/storage/docs/json_api/v1/buckets/get
+	GetRetentionPolicy(ctx context.Context) (*RetentionPolicy, error)
+
 	// Create a reader for the contents of a particular generation of an object.
 	// On a nil error, the caller must arrange for the reader to be closed when
 	// it is no longer needed.
@@ -140,4 +155,35 @@ type Bucket interface {
 	DeleteObject(
 		ctx context.Context,
 		req *DeleteObjectRequest) error
+
+	// Create a folder, in a bucket with a hierarchical namespace. Fails with
+	// *PreconditionError if the folder already exists.
+	//
+	// Official documentation:
+	//     https://cloud.google.com/storage/docs/json_api/v1/folders/insert
+	CreateFolder(
+		ctx context.Context,
+		folderName string) (*Folder, error)
+
+	// Delete an empty folder, in a bucket with a hierarchical namespace.
+	// Non-existence of the folder is not treated as an error.
+	//
+	// Official documentation:
+	//     https://cloud.google.com/storage/docs/json_api/v1/folders/delete
+	DeleteFolder(
+		ctx context.Context,
+		folderName string) error
+
+	// Atomically rename a folder and everything under it, in a bucket with a
+	// hierarchical namespace. Fails with *NotFoundError if the folder doesn't
+	// exist, and with *PreconditionError if the destination already does.
+	//
+	// Returns a record for the renamed folder.
+	//
+	// Official documentation:
+	//     https://cloud.google.com/storage/docs/json_api/v1/folders/rename
+	RenameFolder(
+		ctx context.Context,
+		folderName string,
+		destinationFolderName string) (*Folder, error)
 }
@@ -35,3 +35,23 @@ type PreconditionError struct {
 func (pe *PreconditionError) Error() string {
 	return fmt.Sprintf("gcs.PreconditionError: %v", pe.Err)
 }
+
+// A *RangeNotSatisfiableError value is an error that indicates a read of an
+// object started at or past its end.
+type RangeNotSatisfiableError struct {
+	Err error
+}
+
+func (rnse *RangeNotSatisfiableError) Error() string {
+	return fmt.Sprintf("gcs.RangeNotSatisfiableError: %v", rnse.Err)
+}
+
+// A *ThrottledError value is an error that indicates a request wasn't sent
+// because it would have gone over a rate limit set by the user.
+type ThrottledError struct {
+	Err error
+}
+
+func (te *ThrottledError) Error() string {
+	return fmt.Sprintf("gcs.ThrottledError: %v", te.Err)
+}
@@ -0,0 +1,30 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcs
+
+import "time"
+
+// Folder is a record representing a folder of a bucket with a hierarchical
+// namespace. Like directory objects, folders are named with a trailing slash,
+// e.g. "foo/bar/".
+//
+// See here for more information about its fields:
+//
+//	https://cloud.google.com/storage/docs/json_api/v1/folders#resource
+type Folder struct {
+	Name           string
+	MetaGeneration int64
+	UpdateTime     time.Time
+}
@@ -0,0 +1,36 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcs
+
+import (
+	"context"
+)
+
+// The key of the marker of contexts exempt from rate limits.
+type limitExemptKey struct{}
+
+// WithLimitExemption returns a context whose requests aren't held to the rate
+// limits set by the user, for requests that must go through, such as those
+// writing out data that was already written to the file system.
+func WithLimitExemption(ctx context.Context) context.Context {
+	return context.WithValue(ctx, limitExemptKey{}, true)
+}
+
+// IsLimitExempt reports whether the context was returned by
+// WithLimitExemption, or derived from one.
+func IsLimitExempt(ctx context.Context) bool {
+	exempt, _ := ctx.Value(limitExemptKey{}).(bool)
+	return exempt
+}
@@ -47,6 +47,10 @@ type Object struct {
 	Deleted         time.Time
 	Updated         time.Time
 
+	// The time the generation was created, i.e. timeCreated. Updates of its
+	// metadata bump MetaGeneration and Updated, but leave it alone.
+	Created time.Time
+
 	// As of 2015-06-03, the official GCS documentation for this
 	// property (https://goo.gl/GwD5Dq) says this:
 	//
@@ -86,8 +90,12 @@ type MinObject struct {
 	Generation      int64
 	MetaGeneration  int64
 	Updated         time.Time
+	Created         time.Time
 	Metadata        map[string]string
 	ContentEncoding string
+	ContentType     string
+	CacheControl    string
+	CRC32C          *uint32 // Missing for CMEK buckets
 }
 
 // ExtendedObjectAttributes contains the missing attributes of Object which are not present in MinObject.
@@ -147,6 +147,10 @@ type ComposeObjectsRequest struct {
 	EventBasedHold     bool
 	StorageClass       string
 	Acl                []*storagev1.ObjectAccessControl
+
+	// If non-nil, the object will not be created if the checksum of the
+	// composed contents does not match the supplied value.
+	CRC32C *uint32
 }
 
 type ComposeSource struct {
@@ -282,6 +286,16 @@ type ListObjectsRequest struct {
 	// the current flow, default value will be full and callers can override it
 	// using this param.
 	ProjectionVal Projection
+
+	// If true, only the names of objects are fetched and every other field of
+	// the returned records is left unset. Useful for cheap existence probes.
+	FetchOnlyNames bool
+
+	// If non-empty, list only objects whose full names match this glob, in the
+	// syntax of the matchGlob parameter of the GCS JSON API. Matching happens
+	// on the server, so a narrow glob over a large prefix is much cheaper than
+	// listing the prefix and filtering. See storageutil.CompileGlob.
+	MatchGlob string
 }
 
 // Listing contains a set of objects and delimter-based collapsed runs returned
@@ -375,4 +389,9 @@ type DeleteObjectRequest struct {
 	// with the given name (and optionally generation), and its meta-generation
 	// is not equal to this value.
 	MetaGenerationPrecondition *int64
+
+	// Relevant only when fast_stat_bucket is used. If set, the request fails
+	// with NotFoundError without reaching GCS while the cache holds a negative
+	// entry for the name.
+	TrustNegativeCache bool
 }
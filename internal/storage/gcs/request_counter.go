@@ -0,0 +1,69 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcs
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// RequestCounter counts the GCS requests made on behalf of a file system
+// operation, and the time they took, so that the time the operation spent
+// waiting for GCS can be told from the rest. It is carried in the context of
+// the operation, and safe for concurrent use.
+type RequestCounter struct {
+	count atomic.Int64
+	nanos atomic.Int64
+}
+
+// The key of the *RequestCounter in contexts.
+type requestCounterKey struct{}
+
+// WithRequestCounter returns a context carrying a new RequestCounter, which
+// CountRequest adds the requests made with the context to.
+func WithRequestCounter(ctx context.Context) (context.Context, *RequestCounter) {
+	c := &RequestCounter{}
+	return context.WithValue(ctx, requestCounterKey{}, c), c
+}
+
+// WithRequestCounterOf returns ctx carrying the RequestCounter of from, if
+// any, so that requests made in the background on behalf of an operation
+// count for it.
+func WithRequestCounterOf(ctx context.Context, from context.Context) context.Context {
+	if c, ok := from.Value(requestCounterKey{}).(*RequestCounter); ok {
+		return context.WithValue(ctx, requestCounterKey{}, c)
+	}
+	return ctx
+}
+
+// CountRequest adds a request that took the given time to the RequestCounter
+// of the context, if any.
+func CountRequest(ctx context.Context, d time.Duration) {
+	if c, ok := ctx.Value(requestCounterKey{}).(*RequestCounter); ok {
+		c.count.Add(1)
+		c.nanos.Add(int64(d))
+	}
+}
+
+// Count returns the number of requests counted so far.
+func (c *RequestCounter) Count() int64 {
+	return c.count.Load()
+}
+
+// Duration returns the total time taken by the requests counted so far.
+func (c *RequestCounter) Duration() time.Duration {
+	return time.Duration(c.nanos.Load())
+}
@@ -0,0 +1,123 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/monitor"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/util"
+	"github.com/jacobsa/timeutil"
+	"golang.org/x/net/context"
+	"golang.org/x/time/rate"
+)
+
+// MetadataLimitMaxWait is the longest a metadata request waits for its turn
+// under NewMetadataLimitBucket. Requests that would wait longer fail at once,
+// which bounds the backlog to this many seconds of requests.
+const MetadataLimitMaxWait = 10 * time.Second
+
+// NewMetadataLimitBucket wraps the supplied bucket in a layer sending at most
+// opsPerSec of the metadata requests billed per operation, listings, stats and
+// updates of objects, per second on average, and up to burst of them at once,
+// or one second's worth if burst is zero.
+// Requests over the limit wait for their turn, up to MetadataLimitMaxWait,
+// and fail with *gcs.ThrottledError if it is further off. Requests made with
+// a context from gcs.WithLimitExemption, such as those flushing written data,
+// are neither limited nor use up the limit.
+func NewMetadataLimitBucket(
+	opsPerSec float64,
+	burst int,
+	clock timeutil.Clock,
+	wrapped gcs.Bucket) gcs.Bucket {
+	if burst == 0 {
+		burst = int(math.Ceil(opsPerSec))
+	}
+
+	return &metadataLimitBucket{
+		Bucket:  wrapped,
+		limiter: rate.NewLimiter(rate.Limit(opsPerSec), max(burst, 1)),
+		clock:   clock,
+		sleep:   util.SleepContext,
+	}
+}
+
+type metadataLimitBucket struct {
+	gcs.Bucket
+	limiter *rate.Limiter
+	clock   timeutil.Clock
+
+	// Waits for the given duration, or until the context is done.
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// Wait for the turn of a request calling method, if the context isn't exempt.
+func (b *metadataLimitBucket) wait(ctx context.Context, method string) error {
+	if gcs.IsLimitExempt(ctx) {
+		return nil
+	}
+
+	now := b.clock.Now()
+	r := b.limiter.ReserveN(now, 1)
+	delay := r.DelayFrom(now)
+	switch {
+	case delay == 0:
+		return nil
+
+	case delay > MetadataLimitMaxWait:
+		r.CancelAt(now)
+		monitor.CaptureMetadataLimitMetrics(ctx, method, monitor.LimitOutcomeRefused)
+		return &gcs.ThrottledError{
+			Err: fmt.Errorf("%s would wait %v to keep to %v metadata requests per second", method, delay.Round(time.Millisecond), b.limiter.Limit()),
+		}
+	}
+
+	monitor.CaptureMetadataLimitMetrics(ctx, method, monitor.LimitOutcomeDelayed)
+	if err := b.sleep(ctx, delay); err != nil {
+		r.CancelAt(b.clock.Now())
+		return err
+	}
+	return nil
+}
+
+func (b *metadataLimitBucket) StatObject(
+	ctx context.Context,
+	req *gcs.StatObjectRequest) (*gcs.MinObject, *gcs.ExtendedObjectAttributes, error) {
+	if err := b.wait(ctx, "StatObject"); err != nil {
+		return nil, nil, err
+	}
+	return b.Bucket.StatObject(ctx, req)
+}
+
+func (b *metadataLimitBucket) ListObjects(
+	ctx context.Context,
+	req *gcs.ListObjectsRequest) (*gcs.Listing, error) {
+	if err := b.wait(ctx, "ListObjects"); err != nil {
+		return nil, err
+	}
+	return b.Bucket.ListObjects(ctx, req)
+}
+
+func (b *metadataLimitBucket) UpdateObject(
+	ctx context.Context,
+	req *gcs.UpdateObjectRequest) (*gcs.Object, error) {
+	if err := b.wait(ctx, "UpdateObject"); err != nil {
+		return nil, err
+	}
+	return b.Bucket.UpdateObject(ctx, req)
+}
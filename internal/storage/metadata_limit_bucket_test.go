@@ -0,0 +1,129 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	"github.com/jacobsa/timeutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Return a metadata limit bucket on the simulated clock, holding the object
+// foo, whose waits advance the clock if advance is set and are recorded in
+// waits.
+func newSimulatedMetadataLimitBucket(
+	t *testing.T,
+	opsPerSec float64,
+	burst int,
+	clock *timeutil.SimulatedClock,
+	advance bool,
+	waits *[]time.Duration) gcs.Bucket {
+	t.Helper()
+	wrapped := fake.NewFakeBucket(clock, "some_bucket")
+	require.NoError(t, storageutil.CreateObjects(context.Background(), wrapped, map[string][]byte{"foo": []byte("taco")}))
+
+	b := NewMetadataLimitBucket(opsPerSec, burst, clock, wrapped).(*metadataLimitBucket)
+	b.sleep = func(_ context.Context, d time.Duration) error {
+		*waits = append(*waits, d)
+		if advance {
+			clock.AdvanceTime(d)
+		}
+		return nil
+	}
+	return b
+}
+
+func stat(ctx context.Context, b gcs.Bucket) error {
+	_, _, err := b.StatObject(ctx, &gcs.StatObjectRequest{Name: "foo"})
+	return err
+}
+
+func TestMetadataLimitBucket_CapsRate(t *testing.T) {
+	var clock timeutil.SimulatedClock
+	clock.SetTime(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	start := clock.Now()
+	var waits []time.Duration
+	b := newSimulatedMetadataLimitBucket(t, 10, 5, &clock, true, &waits)
+	ctx := context.Background()
+
+	// The burst goes through at once, and the rest at 10 per second.
+	for i := 0; i < 25; i++ {
+		require.NoError(t, stat(ctx, b))
+	}
+	_, err := b.ListObjects(ctx, &gcs.ListObjectsRequest{})
+	require.NoError(t, err)
+	_, err = b.UpdateObject(ctx, &gcs.UpdateObjectRequest{Name: "foo"})
+	require.NoError(t, err)
+
+	assert.Len(t, waits, 22)
+	assert.Equal(t, 2200*time.Millisecond, clock.Now().Sub(start))
+}
+
+func TestMetadataLimitBucket_RefusesLongWaits(t *testing.T) {
+	var clock timeutil.SimulatedClock
+	clock.SetTime(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	var waits []time.Duration
+	b := newSimulatedMetadataLimitBucket(t, 1, 1, &clock, false, &waits)
+	ctx := context.Background()
+
+	// With the clock stopped, each request waits a second longer than the
+	// last, up to MetadataLimitMaxWait.
+	for i := 0; i <= int(MetadataLimitMaxWait/time.Second); i++ {
+		require.NoError(t, stat(ctx, b))
+	}
+	require.Len(t, waits, 10)
+	assert.Equal(t, MetadataLimitMaxWait, waits[9])
+
+	// The next ones are refused, without using up the limit.
+	for i := 0; i < 2; i++ {
+		err := stat(ctx, b)
+		var throttledErr *gcs.ThrottledError
+		assert.True(t, errors.As(err, &throttledErr), "%v", err)
+	}
+	assert.Len(t, waits, 10)
+
+	clock.AdvanceTime(time.Second)
+	assert.NoError(t, stat(ctx, b))
+	assert.Equal(t, MetadataLimitMaxWait, waits[10])
+}
+
+func TestMetadataLimitBucket_ExemptsFlushes(t *testing.T) {
+	var clock timeutil.SimulatedClock
+	clock.SetTime(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	var waits []time.Duration
+	b := newSimulatedMetadataLimitBucket(t, 1, 1, &clock, false, &waits)
+	require.NoError(t, stat(context.Background(), b))
+
+	// The limit is used up, but requests flushing written data go through
+	// without waiting, and without delaying others.
+	ctx := gcs.WithLimitExemption(context.Background())
+	for i := 0; i < 20; i++ {
+		require.NoError(t, stat(ctx, b))
+		_, err := b.UpdateObject(ctx, &gcs.UpdateObjectRequest{Name: "foo"})
+		require.NoError(t, err)
+	}
+	assert.Empty(t, waits)
+
+	require.NoError(t, stat(context.Background(), b))
+	assert.Equal(t, []time.Duration{time.Second}, waits)
+}
@@ -35,3 +35,24 @@ func (m *MockStorageControlClient) GetStorageLayout(ctx context.Context,
 	args := m.Called(ctx, req, opts)
 	return args.Get(0).(*controlpb.StorageLayout), args.Error(1)
 }
+
+func (m *MockStorageControlClient) CreateFolder(ctx context.Context,
+	req *controlpb.CreateFolderRequest,
+	opts ...gax.CallOption) (*controlpb.Folder, error) {
+	args := m.Called(ctx, req, opts)
+	return args.Get(0).(*controlpb.Folder), args.Error(1)
+}
+
+func (m *MockStorageControlClient) DeleteFolder(ctx context.Context,
+	req *controlpb.DeleteFolderRequest,
+	opts ...gax.CallOption) error {
+	args := m.Called(ctx, req, opts)
+	return args.Error(0)
+}
+
+func (m *MockStorageControlClient) RenameFolder(ctx context.Context,
+	req *controlpb.RenameFolderRequest,
+	opts ...gax.CallOption) (*controlpb.Folder, error) {
+	args := m.Called(ctx, req, opts)
+	return args.Get(0).(*controlpb.Folder), args.Error(1)
+}
@@ -15,16 +15,19 @@
 package storage
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
+	"time"
 
 	"cloud.google.com/go/storage"
-	control "cloud.google.com/go/storage/control/apiv2"
 	"github.com/googleapis/gax-go/v2"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
 	mountpkg "github.com/googlecloudplatform/gcsfuse/v2/internal/mount"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	"github.com/jacobsa/timeutil"
 	"golang.org/x/net/context"
 	option "google.golang.org/api/option"
 	"google.golang.org/grpc"
@@ -42,11 +45,40 @@ type StorageHandle interface {
 	//
 	// A user-project is required for all operations on Requester Pays buckets.
 	BucketHandle(bucketName string, billingProject string) (bh *bucketHandle)
+
+	// Close releases the connections of the clients. The bucket handles must
+	// not be used afterwards.
+	Close() error
 }
 
 type storageClient struct {
 	client               *storage.Client
-	storageControlClient *control.StorageControlClient
+	storageControlClient StorageControlClient
+
+	// The requests made by the clients, drained for up to drainTimeout when
+	// closing them.
+	requestTracker *storageutil.RequestTracker
+	drainTimeout   time.Duration
+}
+
+// endpointOptions returns the options reaching the APIs at the endpoints
+// resolved for the universe domain and Private Service Connect endpoint of the
+// config, if they aren't the default ones.
+func endpointOptions(clientConfig *storageutil.StorageClientConfig, useGRPC bool) (clientOpts []option.ClientOption, err error) {
+	endpoints, custom, err := clientConfig.ResolveEndpoints()
+	if err != nil || !custom {
+		return
+	}
+
+	if useGRPC {
+		clientOpts = append(clientOpts, option.WithEndpoint(endpoints.StorageGRPC))
+	} else {
+		clientOpts = append(clientOpts, option.WithEndpoint(endpoints.Storage))
+	}
+	if clientConfig.UniverseDomain != "" {
+		clientOpts = append(clientOpts, option.WithUniverseDomain(clientConfig.UniverseDomain))
+	}
+	return
 }
 
 // Return clientOpts for both gRPC client and control client.
@@ -64,6 +96,11 @@ func createClientOptionForGRPCClient(clientConfig *storageutil.StorageClientConf
 			return
 		}
 	} else {
+		clientOpts, err = endpointOptions(clientConfig, true)
+		if err != nil {
+			return
+		}
+
 		if clientConfig.AnonymousAccess {
 			clientOpts = append(clientOpts, option.WithoutAuthentication())
 		} else {
@@ -77,7 +114,16 @@ func createClientOptionForGRPCClient(clientConfig *storageutil.StorageClientConf
 	}
 
 	clientOpts = append(clientOpts, option.WithGRPCConnectionPool(clientConfig.GrpcConnPoolSize))
-	clientOpts = append(clientOpts, option.WithUserAgent(clientConfig.UserAgent))
+	clientOpts = append(clientOpts, option.WithUserAgent(storageutil.UserAgent(clientConfig)))
+	for _, opt := range storageutil.OpMetadataDialOptions(clientConfig) {
+		clientOpts = append(clientOpts, option.WithGRPCDialOption(opt))
+	}
+	for _, opt := range storageutil.RequestTrackerDialOptions(clientConfig) {
+		clientOpts = append(clientOpts, option.WithGRPCDialOption(opt))
+	}
+	for _, opt := range storageutil.ThrottleDialOptions(clientConfig) {
+		clientOpts = append(clientOpts, option.WithGRPCDialOption(opt))
+	}
 
 	return
 }
@@ -97,6 +143,7 @@ func createGRPCClientHandle(ctx context.Context, clientConfig *storageutil.Stora
 	if err != nil {
 		return nil, fmt.Errorf("error in getting clientOpts for gRPC client: %w", err)
 	}
+	logger.Infof("gRPC transport: conn-pool-size=%d", clientConfig.GrpcConnPoolSize)
 
 	sc, err = storage.NewGRPCClient(ctx, clientOpts...)
 	if err != nil {
@@ -140,6 +187,13 @@ func createHTTPClientHandle(ctx context.Context, clientConfig *storageutil.Stora
 	// Add Custom endpoint option.
 	if clientConfig.CustomEndpoint != nil {
 		clientOpts = append(clientOpts, option.WithEndpoint(clientConfig.CustomEndpoint.String()))
+	} else {
+		var endpointOpts []option.ClientOption
+		endpointOpts, err = endpointOptions(clientConfig, false)
+		if err != nil {
+			return
+		}
+		clientOpts = append(clientOpts, endpointOpts...)
 	}
 
 	return storage.NewClient(ctx, clientOpts...)
@@ -151,9 +205,12 @@ func createHTTPClientHandle(ctx context.Context, clientConfig *storageutil.Stora
 // http and gRPC client.
 func NewStorageHandle(ctx context.Context, clientConfig storageutil.StorageClientConfig) (sh StorageHandle, err error) {
 	var sc *storage.Client
+	clientConfig.RequestTracker = storageutil.NewRequestTracker()
+	clientConfig.ThrottleController = storageutil.NewThrottleController(timeutil.RealClock())
+
 	// The default protocol for the Go Storage control client's folders API is gRPC.
 	// gcsfuse will initially mirror this behavior due to the client's lack of HTTP support.
-	var controlClient *control.StorageControlClient
+	var controlClient StorageControlClient
 	if clientConfig.ClientProtocol == mountpkg.GRPC {
 		sc, err = createGRPCClientHandle(ctx, &clientConfig)
 	} else if clientConfig.ClientProtocol == mountpkg.HTTP1 || clientConfig.ClientProtocol == mountpkg.HTTP2 {
@@ -173,10 +230,11 @@ func NewStorageHandle(ctx context.Context, clientConfig storageutil.StorageClien
 		if err != nil {
 			return nil, fmt.Errorf("error in getting clientOpts for gRPC client: %w", err)
 		}
-		controlClient, err = storageutil.CreateGRPCControlClient(ctx, clientOpts, &clientConfig)
+		rawControlClient, err := storageutil.CreateGRPCControlClient(ctx, clientOpts, &clientConfig)
 		if err != nil {
 			return nil, fmt.Errorf("could not create StorageControl Client: %w", err)
 		}
+		controlClient = &storageControlClientWrapper{rawControlClient}
 	}
 
 	// ShouldRetry function checks if an operation should be retried based on the
@@ -194,7 +252,31 @@ func NewStorageHandle(ctx context.Context, clientConfig storageutil.StorageClien
 		storage.WithPolicy(storage.RetryAlways),
 		storage.WithErrorFunc(storageutil.ShouldRetry))
 
-	sh = &storageClient{client: sc, storageControlClient: controlClient}
+	sh = &storageClient{
+		client:               sc,
+		storageControlClient: controlClient,
+		requestTracker:       clientConfig.RequestTracker,
+		drainTimeout:         clientConfig.DrainTimeout,
+	}
+	return
+}
+
+// Close waits up to the drain timeout for the requests in flight to complete,
+// logging those that don't, and then closes the connections of the clients.
+func (sh *storageClient) Close() (err error) {
+	if sh.requestTracker != nil {
+		sh.requestTracker.Drain(sh.drainTimeout)
+	}
+
+	if err = sh.client.Close(); err != nil {
+		err = fmt.Errorf("closing the storage client: %w", err)
+	}
+
+	if c, ok := sh.storageControlClient.(io.Closer); ok {
+		if controlErr := c.Close(); controlErr != nil {
+			err = errors.Join(err, fmt.Errorf("closing the storage control client: %w", controlErr))
+		}
+	}
 	return
 }
 
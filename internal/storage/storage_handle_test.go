@@ -19,7 +19,9 @@ import (
 	"fmt"
 	"net/url"
 	"testing"
+	"time"
 
+	"github.com/fsouza/fake-gcs-server/fakestorage"
 	mountpkg "github.com/googlecloudplatform/gcsfuse/v2/internal/mount"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
@@ -58,6 +60,14 @@ func (testSuite *StorageHandleTest) TestBucketHandleWhenBucketExistsWithEmptyBil
 	assert.Equal(testSuite.T(), gcs.Nil, bucketHandle.bucketType)
 }
 
+func (testSuite *StorageHandleTest) TestClose() {
+	storageHandle := testSuite.fakeStorage.CreateStorageHandle()
+
+	err := storageHandle.Close()
+
+	assert.NoError(testSuite.T(), err)
+}
+
 func (testSuite *StorageHandleTest) TestBucketHandleWhenBucketDoesNotExistWithEmptyBillingProject() {
 	storageHandle := testSuite.fakeStorage.CreateStorageHandle()
 	bucketHandle := storageHandle.BucketHandle(invalidBucketName, "")
@@ -298,3 +308,34 @@ func (testSuite *StorageHandleTest) TestCreateClientOptionForGRPCClient() {
 	assert.Nil(testSuite.T(), err)
 	assert.NotNil(testSuite.T(), clientOption)
 }
+
+func (testSuite *StorageHandleTest) TestNewStorageHandleListsObjectsOverEachHttpProtocol() {
+	server, err := fakestorage.NewServerWithOptions(fakestorage.Options{
+		InitialObjects: getTestFakeStorageObject(),
+		Host:           host,
+		Scheme:         "http",
+	})
+	assert.Nil(testSuite.T(), err)
+	defer server.Stop()
+	endpoint, err := url.Parse(server.URL() + "/storage/v1/")
+	assert.Nil(testSuite.T(), err)
+
+	for _, protocol := range []mountpkg.ClientProtocol{mountpkg.HTTP1, mountpkg.HTTP2} {
+		testSuite.Run(string(protocol), func() {
+			sc := storageutil.GetDefaultStorageClientConfig()
+			sc.ClientProtocol = protocol
+			sc.CustomEndpoint = endpoint
+			sc.IdleConnTimeout = 0
+			sc.TLSHandshakeTimeout = time.Second
+			sc.ResponseHeaderTimeout = 5 * time.Second
+
+			handle, err := NewStorageHandle(context.Background(), sc)
+			assert.Nil(testSuite.T(), err)
+			listing, err := handle.BucketHandle(TestBucketName, "").ListObjects(context.Background(),
+				&gcs.ListObjectsRequest{Prefix: TestObjectRootFolderName, MaxResults: 1})
+
+			assert.Nil(testSuite.T(), err)
+			assert.NotEmpty(testSuite.T(), listing.Objects)
+		})
+	}
+}
@@ -24,6 +24,7 @@ import (
 
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/auth"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/config"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
 	mountpkg "github.com/googlecloudplatform/gcsfuse/v2/internal/mount"
 	"golang.org/x/net/context"
 	"golang.org/x/oauth2"
@@ -44,28 +45,64 @@ type StorageClientConfig struct {
 	MaxRetrySleep     time.Duration
 	RetryMultiplier   float64
 
+	// UniverseDomain, if set, is the universe domain the APIs are reached in,
+	// and credentials must be for. PSCEndpoint, if set, is the Private Service
+	// Connect endpoint they're reached through. See ResolveEndpoints.
+	UniverseDomain string
+	PSCEndpoint    string
+
+	// Features are the features of the mount that requests tell GCS about in
+	// their User-Agent, after UserAgent.
+	Features Features
+
+	// TokenEarlyExpiry, if positive, is how long before they expire cached
+	// access tokens are refreshed, e.g. by keepalives.
+	TokenEarlyExpiry time.Duration
+
 	/** HTTP client parameters. */
 	MaxConnsPerHost            int
 	MaxIdleConnsPerHost        int
+	IdleConnTimeout            time.Duration
+	TLSHandshakeTimeout        time.Duration
+	ResponseHeaderTimeout      time.Duration
 	HttpClientTimeout          time.Duration
 	ExperimentalEnableJsonRead bool
 	AnonymousAccess            bool
 
+	// OpMetadataHeader is the header or gRPC metadata key requests send the
+	// OpMetadata of their context in, if any. Empty disables it.
+	OpMetadataHeader string
+	OpMetadataUid    bool
+
 	/** Grpc client parameters. */
 	GrpcConnPoolSize int
 
+	// DrainTimeout is how long closing the client waits for the requests in
+	// flight through it to complete, before closing its connections.
+	DrainTimeout time.Duration
+
+	// RequestTracker, if set, tracks the requests made by the client, so that
+	// they can be drained.
+	RequestTracker *RequestTracker
+
+	// ThrottleController, if set, paces the requests made by the client while
+	// GCS throttles them.
+	ThrottleController *ThrottleController
+
 	// Enabling new API flow for HNS bucket.
 	EnableHNS config.EnableHNS
 }
 
-func CreateHttpClient(storageClientConfig *StorageClientConfig) (httpClient *http.Client, err error) {
-	var transport *http.Transport
+// createTransport returns the http transport for the configured client
+// protocol.
+func createTransport(storageClientConfig *StorageClientConfig) (transport *http.Transport) {
 	// Using http1 makes the client more performant.
 	if storageClientConfig.ClientProtocol == mountpkg.HTTP1 {
 		transport = &http.Transport{
 			Proxy:               http.ProxyFromEnvironment,
 			MaxConnsPerHost:     storageClientConfig.MaxConnsPerHost,
 			MaxIdleConnsPerHost: storageClientConfig.MaxIdleConnsPerHost,
+			IdleConnTimeout:     storageClientConfig.IdleConnTimeout,
 			// This disables HTTP/2 in transport.
 			TLSNextProto: make(
 				map[string]func(string, *tls.Conn) http.RoundTripper,
@@ -81,6 +118,26 @@ func CreateHttpClient(storageClientConfig *StorageClientConfig) (httpClient *htt
 		}
 	}
 
+	transport.TLSHandshakeTimeout = storageClientConfig.TLSHandshakeTimeout
+	transport.ResponseHeaderTimeout = storageClientConfig.ResponseHeaderTimeout
+	return
+}
+
+func CreateHttpClient(storageClientConfig *StorageClientConfig) (httpClient *http.Client, err error) {
+	transport := createTransport(storageClientConfig)
+	var base http.RoundTripper = transport
+	if storageClientConfig.RequestTracker != nil {
+		base = storageClientConfig.RequestTracker.wrapTransport(transport)
+	}
+	if storageClientConfig.ThrottleController != nil {
+		base = storageClientConfig.ThrottleController.wrap(base)
+	}
+	logger.Infof("HTTP transport: client-protocol=%s, max-conns-per-host=%d, max-idle-conns-per-host=%d, "+
+		"keep-alives=%t, idle-conn-timeout=%v, tls-handshake-timeout=%v, response-header-timeout=%v",
+		storageClientConfig.ClientProtocol, transport.MaxConnsPerHost, transport.MaxIdleConnsPerHost,
+		!transport.DisableKeepAlives, transport.IdleConnTimeout, transport.TLSHandshakeTimeout,
+		transport.ResponseHeaderTimeout)
+
 	if storageClientConfig.AnonymousAccess {
 		// UserAgent will not be added if authentication is disabled.
 		// Bypassing authentication prevents the creation of an HTTP transport
@@ -90,11 +147,13 @@ func CreateHttpClient(storageClientConfig *StorageClientConfig) (httpClient *htt
 		// with the "WithHTTPClient" option, preventing the direct injection of a user agent
 		// when authentication is skipped.
 		httpClient = &http.Client{
-			Timeout: storageClientConfig.HttpClientTimeout,
+			Transport: withOpMetadataHeader(base, storageClientConfig),
+			Timeout:   storageClientConfig.HttpClientTimeout,
 		}
 	} else {
 		var tokenSrc oauth2.TokenSource
-		tokenSrc, err = CreateTokenSource(storageClientConfig)
+		reporter := newClockSkewReporter()
+		tokenSrc, err = createTokenSource(storageClientConfig, reporter)
 		if err != nil {
 			err = fmt.Errorf("while fetching tokenSource: %w", err)
 			return
@@ -102,16 +161,19 @@ func CreateHttpClient(storageClientConfig *StorageClientConfig) (httpClient *htt
 
 		// Custom http client for Go Client.
 		httpClient = &http.Client{
-			Transport: &oauth2.Transport{
-				Base:   transport,
-				Source: tokenSrc,
+			Transport: &clockSkewRoundTripper{
+				wrapped: &oauth2.Transport{
+					Base:   withOpMetadataHeader(base, storageClientConfig),
+					Source: tokenSrc,
+				},
+				reporter: reporter,
 			},
 			Timeout: storageClientConfig.HttpClientTimeout,
 		}
 		// Setting UserAgent through RoundTripper middleware
 		httpClient.Transport = &userAgentRoundTripper{
 			wrapped:   httpClient.Transport,
-			UserAgent: storageClientConfig.UserAgent,
+			UserAgent: UserAgent(storageClientConfig),
 		}
 	}
 	return httpClient, err
@@ -119,8 +181,28 @@ func CreateHttpClient(storageClientConfig *StorageClientConfig) (httpClient *htt
 
 // It creates the token-source from the provided
 // key-file or using ADC search order (https://cloud.google.com/docs/authentication/application-default-credentials#order).
+// Token fetches failing because of clock skew return a ClockSkewError.
 func CreateTokenSource(storageClientConfig *StorageClientConfig) (tokenSrc oauth2.TokenSource, err error) {
-	return auth.GetTokenSource(context.Background(), storageClientConfig.KeyFile, storageClientConfig.TokenUrl, storageClientConfig.ReuseTokenFromUrl)
+	return createTokenSource(storageClientConfig, newClockSkewReporter())
+}
+
+func createTokenSource(storageClientConfig *StorageClientConfig, reporter *clockSkewReporter) (tokenSrc oauth2.TokenSource, err error) {
+	universe, err := storageClientConfig.universe()
+	if err != nil {
+		return
+	}
+	tokenSrc, err = auth.GetTokenSource(context.Background(), storageClientConfig.KeyFile, storageClientConfig.TokenUrl, storageClientConfig.ReuseTokenFromUrl, universe)
+	if err != nil {
+		return
+	}
+
+	// Tokens fetched from the token url without reusing them aren't cached.
+	noReuse := storageClientConfig.KeyFile == "" && storageClientConfig.TokenUrl != "" && !storageClientConfig.ReuseTokenFromUrl
+	if storageClientConfig.TokenEarlyExpiry > 0 && !noReuse {
+		tokenSrc = oauth2.ReuseTokenSourceWithExpiry(nil, tokenSrc, storageClientConfig.TokenEarlyExpiry)
+	}
+	tokenSrc = &clockSkewTokenSource{wrapped: tokenSrc, reporter: reporter}
+	return
 }
 
 // StripScheme strips the scheme part of given url.
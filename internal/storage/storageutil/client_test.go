@@ -15,8 +15,14 @@
 package storageutil
 
 import (
+	"fmt"
 	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	mountpkg "github.com/googlecloudplatform/gcsfuse/v2/internal/mount"
 
 	"github.com/jacobsa/oglematchers"
 	. "github.com/jacobsa/ogletest"
@@ -35,7 +41,9 @@ func init() { RegisterTestSuite(&clientTest{}) }
 func (t *clientTest) validateProxyInTransport(httpClient *http.Client) {
 	userAgentRT, ok := httpClient.Transport.(*userAgentRoundTripper)
 	AssertEq(true, ok)
-	oauthTransport, ok := userAgentRT.wrapped.(*oauth2.Transport)
+	clockSkewRT, ok := userAgentRT.wrapped.(*clockSkewRoundTripper)
+	AssertEq(true, ok)
+	oauthTransport, ok := clockSkewRT.wrapped.(*oauth2.Transport)
 	AssertEq(true, ok)
 	transport, ok := oauthTransport.Base.(*http.Transport)
 	AssertEq(true, ok)
@@ -89,6 +97,55 @@ func (t *clientTest) TestCreateHttpClientWithHttp2AndAuthEnabled() {
 	AssertEq(nil, httpClient)
 }
 
+func (t *clientTest) TestCreateTransportWithHttp1() {
+	sc := GetDefaultStorageClientConfig()
+	sc.IdleConnTimeout = 90 * time.Second
+	sc.TLSHandshakeTimeout = 10 * time.Second
+	sc.ResponseHeaderTimeout = 30 * time.Second
+
+	transport := createTransport(&sc)
+
+	ExpectEq(sc.MaxConnsPerHost, transport.MaxConnsPerHost)
+	ExpectEq(sc.MaxIdleConnsPerHost, transport.MaxIdleConnsPerHost)
+	ExpectEq(90*time.Second, transport.IdleConnTimeout)
+	ExpectEq(10*time.Second, transport.TLSHandshakeTimeout)
+	ExpectEq(30*time.Second, transport.ResponseHeaderTimeout)
+	ExpectFalse(transport.DisableKeepAlives)
+	ExpectFalse(transport.ForceAttemptHTTP2)
+	// An empty, non-nil TLSNextProto disables HTTP/2.
+	ExpectNe(nil, transport.TLSNextProto)
+	ExpectEq(0, len(transport.TLSNextProto))
+}
+
+func (t *clientTest) TestCreateTransportWithHttp2() {
+	sc := GetDefaultStorageClientConfig()
+	sc.ClientProtocol = mountpkg.HTTP2
+	sc.TLSHandshakeTimeout = 10 * time.Second
+	sc.ResponseHeaderTimeout = 30 * time.Second
+
+	transport := createTransport(&sc)
+
+	ExpectEq(sc.MaxConnsPerHost, transport.MaxConnsPerHost)
+	ExpectEq(0, transport.MaxIdleConnsPerHost)
+	ExpectEq(10*time.Second, transport.TLSHandshakeTimeout)
+	ExpectEq(30*time.Second, transport.ResponseHeaderTimeout)
+	ExpectTrue(transport.DisableKeepAlives)
+	ExpectTrue(transport.ForceAttemptHTTP2)
+	ExpectEq(nil, transport.TLSNextProto)
+}
+
+func (t *clientTest) TestCreateHttpClientWithAnonymousAccessUsesTransport() {
+	sc := GetDefaultStorageClientConfig()
+	sc.ResponseHeaderTimeout = 30 * time.Second
+
+	httpClient, err := CreateHttpClient(&sc)
+
+	AssertEq(nil, err)
+	transport, ok := httpClient.Transport.(*http.Transport)
+	AssertTrue(ok)
+	ExpectEq(30*time.Second, transport.ResponseHeaderTimeout)
+}
+
 func (t *clientTest) TestCreateTokenSrc() {
 	sc := GetDefaultStorageClientConfig()
 
@@ -99,6 +156,41 @@ func (t *clientTest) TestCreateTokenSrc() {
 	ExpectNe(nil, &tokenSrc)
 }
 
+func (t *clientTest) TestCreateTokenSrcRefreshesTokensEarly() {
+	// Tokens from the url expire in 5 minutes.
+	var fetches atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		fmt.Fprintf(w, `{"access_token":"token","token_type":"Bearer","expiry":%q}`, time.Now().Add(5*time.Minute).Format(time.RFC3339))
+	}))
+	defer server.Close()
+
+	for _, tc := range []struct {
+		earlyExpiry     time.Duration
+		expectedFetches int64
+	}{
+		{0, 1},
+		{time.Minute, 1},
+		{10 * time.Minute, 3},
+	} {
+		fetches.Store(0)
+		sc := GetDefaultStorageClientConfig()
+		sc.KeyFile = ""
+		sc.TokenUrl = server.URL
+		sc.ReuseTokenFromUrl = true
+		sc.TokenEarlyExpiry = tc.earlyExpiry
+
+		tokenSrc, err := CreateTokenSource(&sc)
+		AssertEq(nil, err)
+		for i := 0; i < 3; i++ {
+			_, err = tokenSrc.Token()
+			AssertEq(nil, err)
+		}
+
+		ExpectEq(tc.expectedFetches, fetches.Load(), "earlyExpiry: %v", tc.earlyExpiry)
+	}
+}
+
 func (t *clientTest) TestStripScheme() {
 	for _, tc := range []struct {
 		input          string
@@ -0,0 +1,126 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storageutil
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
+	"golang.org/x/oauth2"
+)
+
+// Auth failures are blamed on the local clock only if it differs from the
+// server's by at least this much. The Date header has second granularity, and
+// smaller differences are tolerated by the auth server.
+const minAuthClockSkew = time.Minute
+
+// ClockSkewError is returned in place of an authentication error when the
+// local clock differs from the server's by enough to explain the failure.
+type ClockSkewError struct {
+	// The local time minus the server's.
+	Skew time.Duration
+	Err  error
+}
+
+func (e *ClockSkewError) Error() string {
+	return fmt.Sprintf("%s, which breaks authentication: %v", describeClockSkew(e.Skew), e.Err)
+}
+
+func (e *ClockSkewError) Unwrap() error {
+	return e.Err
+}
+
+func describeClockSkew(skew time.Duration) string {
+	if skew < 0 {
+		return fmt.Sprintf("local clock is %v behind the server's", -skew)
+	}
+	return fmt.Sprintf("local clock is %v ahead of the server's", skew)
+}
+
+// clockSkew returns the local time minus the time in the Date header of resp,
+// and whether the difference is large enough to break authentication.
+func clockSkew(resp *http.Response, now time.Time) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+	serverTime, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return 0, false
+	}
+
+	skew := now.Sub(serverTime).Truncate(time.Second)
+	return skew, skew >= minAuthClockSkew || skew <= -minAuthClockSkew
+}
+
+// clockSkewReporter logs the first clock skew found to break authentication.
+// Every request fails once the clock drifts, so later ones aren't logged.
+type clockSkewReporter struct {
+	now      func() time.Time
+	reported atomic.Bool
+}
+
+func newClockSkewReporter() *clockSkewReporter {
+	return &clockSkewReporter{now: time.Now}
+}
+
+// check returns the clock skew measured from resp, the response to a request
+// that failed authentication, and whether it explains the failure. Skews that
+// do are logged once.
+func (r *clockSkewReporter) check(resp *http.Response) (time.Duration, bool) {
+	skew, ok := clockSkew(resp, r.now())
+	if ok && r.reported.CompareAndSwap(false, true) {
+		logger.Errorf("Requests to GCS are failing authentication because the %s. "+
+			"Synchronize the system clock, e.g. by enabling chronyd or systemd-timesyncd; "+
+			"until then every request fails, and reads and writes return EIO.", describeClockSkew(skew))
+	}
+	return skew, ok
+}
+
+// clockSkewTokenSource turns errors fetching tokens that are explained by
+// clock skew into ClockSkewErrors.
+type clockSkewTokenSource struct {
+	wrapped  oauth2.TokenSource
+	reporter *clockSkewReporter
+}
+
+func (ts *clockSkewTokenSource) Token() (*oauth2.Token, error) {
+	token, err := ts.wrapped.Token()
+	var retrieveErr *oauth2.RetrieveError
+	if err != nil && errors.As(err, &retrieveErr) {
+		if skew, ok := ts.reporter.check(retrieveErr.Response); ok {
+			err = &ClockSkewError{Skew: skew, Err: err}
+		}
+	}
+	return token, err
+}
+
+// clockSkewRoundTripper checks the clock skew of requests rejected as
+// unauthenticated, which happens when tokens are judged to have expired.
+type clockSkewRoundTripper struct {
+	wrapped  http.RoundTripper
+	reporter *clockSkewReporter
+}
+
+func (rt *clockSkewRoundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	resp, err := rt.wrapped.RoundTrip(r)
+	if err == nil && resp.StatusCode == http.StatusUnauthorized {
+		rt.reporter.check(resp)
+	}
+	return resp, err
+}
@@ -0,0 +1,180 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storageutil
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+var clockSkewNow = time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+// Return a response with the given status and a Date header offset from
+// clockSkewNow by the given amount.
+func skewedResponse(status int, offset time.Duration) *http.Response {
+	resp := &http.Response{StatusCode: status, Header: make(http.Header)}
+	resp.Header.Set("Date", clockSkewNow.Add(offset).Format(http.TimeFormat))
+	return resp
+}
+
+func newTestClockSkewReporter() *clockSkewReporter {
+	return &clockSkewReporter{now: func() time.Time { return clockSkewNow }}
+}
+
+type fakeTokenSource struct {
+	token *oauth2.Token
+	err   error
+}
+
+func (ts *fakeTokenSource) Token() (*oauth2.Token, error) {
+	return ts.token, ts.err
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func TestClockSkew(t *testing.T) {
+	testCases := []struct {
+		name   string
+		offset time.Duration
+		skew   time.Duration
+		ok     bool
+	}{
+		{"server behind", -7 * time.Minute, 7 * time.Minute, true},
+		{"server ahead", 2 * time.Hour, -2 * time.Hour, true},
+		{"within tolerance", 30 * time.Second, -30 * time.Second, false},
+		{"in sync", 0, 0, false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			skew, ok := clockSkew(skewedResponse(http.StatusBadRequest, tc.offset), clockSkewNow)
+
+			assert.Equal(t, tc.skew, skew)
+			assert.Equal(t, tc.ok, ok)
+		})
+	}
+}
+
+func TestClockSkew_NoDateHeader(t *testing.T) {
+	for _, resp := range []*http.Response{
+		nil,
+		{StatusCode: http.StatusUnauthorized, Header: make(http.Header)},
+		{StatusCode: http.StatusUnauthorized, Header: http.Header{"Date": {"yesterday"}}},
+	} {
+		_, ok := clockSkew(resp, clockSkewNow)
+
+		assert.False(t, ok)
+	}
+}
+
+func TestClockSkewError(t *testing.T) {
+	wrapped := errors.New(`oauth2: "invalid_grant"`)
+
+	ahead := &ClockSkewError{Skew: 7 * time.Minute, Err: wrapped}
+	behind := &ClockSkewError{Skew: -time.Hour, Err: wrapped}
+
+	assert.Equal(t, `local clock is 7m0s ahead of the server's, which breaks authentication: oauth2: "invalid_grant"`, ahead.Error())
+	assert.Equal(t, `local clock is 1h0m0s behind the server's, which breaks authentication: oauth2: "invalid_grant"`, behind.Error())
+	assert.ErrorIs(t, ahead, wrapped)
+}
+
+func TestClockSkewTokenSource_SkewedClock(t *testing.T) {
+	retrieveErr := &oauth2.RetrieveError{
+		Response:  skewedResponse(http.StatusBadRequest, -10*time.Minute),
+		ErrorCode: "invalid_grant",
+	}
+	reporter := newTestClockSkewReporter()
+	ts := &clockSkewTokenSource{wrapped: &fakeTokenSource{err: retrieveErr}, reporter: reporter}
+
+	_, err := ts.Token()
+
+	var skewErr *ClockSkewError
+	require.ErrorAs(t, err, &skewErr)
+	assert.Equal(t, 10*time.Minute, skewErr.Skew)
+	assert.ErrorIs(t, err, retrieveErr)
+	assert.True(t, reporter.reported.Load())
+}
+
+func TestClockSkewTokenSource_OtherErrors(t *testing.T) {
+	for _, wrappedErr := range []error{
+		errors.New("could not find default credentials"),
+		&oauth2.RetrieveError{ErrorCode: "invalid_grant"},
+		&oauth2.RetrieveError{
+			Response:  skewedResponse(http.StatusBadRequest, 5*time.Second),
+			ErrorCode: "invalid_grant",
+		},
+	} {
+		reporter := newTestClockSkewReporter()
+		ts := &clockSkewTokenSource{wrapped: &fakeTokenSource{err: wrappedErr}, reporter: reporter}
+
+		_, err := ts.Token()
+
+		assert.Equal(t, wrappedErr, err)
+		assert.False(t, reporter.reported.Load())
+	}
+}
+
+func TestClockSkewTokenSource_Success(t *testing.T) {
+	token := &oauth2.Token{AccessToken: "token"}
+	ts := &clockSkewTokenSource{wrapped: &fakeTokenSource{token: token}, reporter: newTestClockSkewReporter()}
+
+	got, err := ts.Token()
+
+	require.NoError(t, err)
+	assert.Equal(t, token, got)
+}
+
+func TestClockSkewRoundTripper(t *testing.T) {
+	testCases := []struct {
+		name     string
+		status   int
+		offset   time.Duration
+		reported bool
+	}{
+		{"unauthorized with skewed clock", http.StatusUnauthorized, 6 * time.Minute, true},
+		{"unauthorized with clock in sync", http.StatusUnauthorized, 0, false},
+		{"not found with skewed clock", http.StatusNotFound, 6 * time.Minute, false},
+		{"success with skewed clock", http.StatusOK, 6 * time.Minute, false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := skewedResponse(tc.status, tc.offset)
+			reporter := newTestClockSkewReporter()
+			rt := &clockSkewRoundTripper{
+				wrapped: roundTripperFunc(func(*http.Request) (*http.Response, error) {
+					return resp, nil
+				}),
+				reporter: reporter,
+			}
+			req, err := http.NewRequest(http.MethodGet, "https://storage.googleapis.com/", nil)
+			require.NoError(t, err)
+
+			got, err := rt.RoundTrip(req)
+
+			require.NoError(t, err)
+			assert.Equal(t, resp, got)
+			assert.Equal(t, tc.reported, reporter.reported.Load())
+		})
+	}
+}
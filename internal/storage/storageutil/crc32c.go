@@ -24,3 +24,63 @@ func CRC32C(contents []byte) *uint32 {
 	checksum := crc32.Checksum(contents, crc32cTable)
 	return &checksum
 }
+
+// CombineCRC32C returns the CRC32C checksum of the concatenation of two byte
+// sequences, given the checksum of each and the length of the second. This is
+// how GCS derives the checksum of a composite object from its components.
+func CombineCRC32C(crc1, crc2 uint32, len2 int64) uint32 {
+	if len2 <= 0 {
+		return crc1
+	}
+
+	// Appending len2 zero bytes to the first sequence is a linear operation on
+	// its checksum, computed by repeatedly squaring the operator appending a
+	// single zero bit. Cf. crc32_combine in zlib.
+	var even, odd [32]uint32
+	odd[0] = crc32.Castagnoli
+	row := uint32(1)
+	for n := 1; n < 32; n++ {
+		odd[n] = row
+		row <<= 1
+	}
+
+	gf2MatrixSquare(&even, &odd) // Two zero bits.
+	gf2MatrixSquare(&odd, &even) // Four zero bits.
+
+	for {
+		gf2MatrixSquare(&even, &odd)
+		if len2&1 != 0 {
+			crc1 = gf2MatrixTimes(&even, crc1)
+		}
+		len2 >>= 1
+		if len2 == 0 {
+			break
+		}
+
+		gf2MatrixSquare(&odd, &even)
+		if len2&1 != 0 {
+			crc1 = gf2MatrixTimes(&odd, crc1)
+		}
+		len2 >>= 1
+		if len2 == 0 {
+			break
+		}
+	}
+
+	return crc1 ^ crc2
+}
+
+func gf2MatrixTimes(mat *[32]uint32, vec uint32) (sum uint32) {
+	for i := 0; vec != 0; i, vec = i+1, vec>>1 {
+		if vec&1 != 0 {
+			sum ^= mat[i]
+		}
+	}
+	return
+}
+
+func gf2MatrixSquare(square, mat *[32]uint32) {
+	for n := range mat {
+		square[n] = gf2MatrixTimes(mat, mat[n])
+	}
+}
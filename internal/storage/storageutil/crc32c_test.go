@@ -0,0 +1,45 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storageutil
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCombineCRC32C(t *testing.T) {
+	contents := make([]byte, 10000)
+	rand.New(rand.NewSource(17)).Read(contents)
+
+	for _, split := range []int{0, 1, 3, 4095, 4096, 9999, 10000} {
+		a, b := contents[:split], contents[split:]
+		assert.Equal(t, *CRC32C(contents), CombineCRC32C(*CRC32C(a), *CRC32C(b), int64(len(b))), "split %d", split)
+	}
+}
+
+func TestCombineCRC32C_Many(t *testing.T) {
+	contents := make([]byte, 1<<16)
+	rand.New(rand.NewSource(23)).Read(contents)
+
+	var crc uint32
+	for off := 0; off < len(contents); off += 1000 {
+		part := contents[off:min(off+1000, len(contents))]
+		crc = CombineCRC32C(crc, *CRC32C(part), int64(len(part)))
+	}
+
+	assert.Equal(t, *CRC32C(contents), crc)
+}
@@ -0,0 +1,224 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storageutil
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
+	"google.golang.org/grpc"
+)
+
+// RequestTracker keeps track of the requests in flight through the
+// transports of a storage client, so that they can be drained before its
+// connections are closed.
+//
+// Safe for concurrent access.
+type RequestTracker struct {
+	mu sync.Mutex
+
+	// The requests in flight, with a description and their start time.
+	//
+	// GUARDED_BY(mu)
+	inFlight map[*trackedRequest]struct{}
+
+	// Closed and replaced whenever a request completes.
+	//
+	// GUARDED_BY(mu)
+	completed chan struct{}
+
+	// The transports whose idle connections are closed once drained.
+	//
+	// GUARDED_BY(mu)
+	transports []*http.Transport
+}
+
+type trackedRequest struct {
+	desc  string
+	start time.Time
+}
+
+func NewRequestTracker() *RequestTracker {
+	return &RequestTracker{
+		inFlight:  make(map[*trackedRequest]struct{}),
+		completed: make(chan struct{}),
+	}
+}
+
+// begin notes the start of a request, returning the function to call once it
+// completes, which may be called more than once.
+//
+// LOCKS_EXCLUDED(t.mu)
+func (t *RequestTracker) begin(desc string) (end func()) {
+	r := &trackedRequest{desc: desc, start: time.Now()}
+
+	t.mu.Lock()
+	t.inFlight[r] = struct{}{}
+	t.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+
+			delete(t.inFlight, r)
+			close(t.completed)
+			t.completed = make(chan struct{})
+		})
+	}
+}
+
+// Drain waits up to timeout for the requests in flight to complete, logging
+// and returning the number of those that haven't, and then closes the idle
+// connections of the tracked transports.
+//
+// LOCKS_EXCLUDED(t.mu)
+func (t *RequestTracker) Drain(timeout time.Duration) (abandoned int) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+wait:
+	for len(t.inFlight) > 0 {
+		completed := t.completed
+		t.mu.Unlock()
+		select {
+		case <-completed:
+			t.mu.Lock()
+
+		case <-timer.C:
+			t.mu.Lock()
+			break wait
+		}
+	}
+
+	abandoned = len(t.inFlight)
+	if abandoned > 0 {
+		var descs []string
+		for r := range t.inFlight {
+			descs = append(descs, fmt.Sprintf("%s (in flight for %v)", r.desc, time.Since(r.start).Round(time.Millisecond)))
+		}
+		sort.Strings(descs)
+		logger.Warnf(
+			"Abandoning %d requests to GCS still in flight after %v: %s",
+			abandoned,
+			timeout,
+			strings.Join(descs, ", "))
+	}
+
+	for _, transport := range t.transports {
+		transport.CloseIdleConnections()
+	}
+	return
+}
+
+// wrapTransport returns a round tripper sending requests through transport
+// and tracking them until their response bodies are closed. Drain closes the
+// idle connections of transport.
+//
+// LOCKS_EXCLUDED(t.mu)
+func (t *RequestTracker) wrapTransport(transport *http.Transport) http.RoundTripper {
+	t.mu.Lock()
+	t.transports = append(t.transports, transport)
+	t.mu.Unlock()
+
+	return &trackingRoundTripper{wrapped: transport, tracker: t}
+}
+
+type trackingRoundTripper struct {
+	wrapped http.RoundTripper
+	tracker *RequestTracker
+}
+
+func (rt *trackingRoundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	end := rt.tracker.begin(r.Method + " " + r.URL.Redacted())
+	resp, err := rt.wrapped.RoundTrip(r)
+	if err != nil {
+		end()
+		return resp, err
+	}
+
+	resp.Body = &trackedBody{ReadCloser: resp.Body, end: end}
+	return resp, nil
+}
+
+// trackedBody ends the tracking of its request once closed.
+type trackedBody struct {
+	io.ReadCloser
+	end func()
+}
+
+func (b *trackedBody) Close() error {
+	defer b.end()
+	return b.ReadCloser.Close()
+}
+
+func (t *RequestTracker) unary(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	defer t.begin(method)()
+	return invoker(ctx, method, req, reply, cc, opts...)
+}
+
+func (t *RequestTracker) stream(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	end := t.begin(method)
+	s, err := streamer(ctx, desc, cc, method, opts...)
+	if err != nil {
+		end()
+		return nil, err
+	}
+
+	// A stream ends when receiving from it fails, or when its context is done
+	// if it is abandoned before that.
+	stop := context.AfterFunc(ctx, end)
+	return &trackedStream{ClientStream: s, end: end, stop: stop}, nil
+}
+
+type trackedStream struct {
+	grpc.ClientStream
+	end  func()
+	stop func() bool
+}
+
+func (s *trackedStream) RecvMsg(m any) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err != nil {
+		s.stop()
+		s.end()
+	}
+	return err
+}
+
+// RequestTrackerDialOptions returns the options making gRPC calls tracked by
+// the request tracker of the config, if any.
+func RequestTrackerDialOptions(storageClientConfig *StorageClientConfig) []grpc.DialOption {
+	t := storageClientConfig.RequestTracker
+	if t == nil {
+		return nil
+	}
+
+	return []grpc.DialOption{
+		grpc.WithChainUnaryInterceptor(t.unary),
+		grpc.WithChainStreamInterceptor(t.stream),
+	}
+}
@@ -0,0 +1,177 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storageutil
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	mountpkg "github.com/googlecloudplatform/gcsfuse/v2/internal/mount"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+)
+
+// drainTestServer is a fake server whose requests to /slow block until
+// released, and whose connections report being closed.
+type drainTestServer struct {
+	*httptest.Server
+	slowStarted chan struct{}
+	release     chan struct{}
+	connClosed  chan struct{}
+}
+
+func newDrainTestServer(t *testing.T) *drainTestServer {
+	t.Helper()
+	s := &drainTestServer{
+		slowStarted: make(chan struct{}, 1),
+		release:     make(chan struct{}),
+		connClosed:  make(chan struct{}, 10),
+	}
+	s.Server = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			s.slowStarted <- struct{}{}
+			<-s.release
+		}
+		_, _ = io.WriteString(w, "taco")
+	}))
+	s.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateClosed {
+			s.connClosed <- struct{}{}
+		}
+	}
+	s.Start()
+	t.Cleanup(func() {
+		select {
+		case <-s.release:
+		default:
+			close(s.release)
+		}
+		s.Close()
+	})
+	return s
+}
+
+// Return a client of the storage client config's http client tracking its
+// requests with the returned tracker.
+func newDrainTestClient(t *testing.T) (*http.Client, *RequestTracker) {
+	t.Helper()
+	tracker := NewRequestTracker()
+	client, err := CreateHttpClient(&StorageClientConfig{
+		ClientProtocol:      mountpkg.HTTP1,
+		MaxIdleConnsPerHost: 10,
+		AnonymousAccess:     true,
+		RequestTracker:      tracker,
+	})
+	require.NoError(t, err)
+	return client, tracker
+}
+
+func get(client *http.Client, url string) error {
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, err = io.ReadAll(resp.Body)
+	return err
+}
+
+func TestDrain_AbandonsSlowRequestAfterTimeout(t *testing.T) {
+	server := newDrainTestServer(t)
+	client, tracker := newDrainTestClient(t)
+	go func() { _ = get(client, server.URL+"/slow") }()
+	<-server.slowStarted
+
+	start := time.Now()
+	abandoned := tracker.Drain(100 * time.Millisecond)
+
+	assert.Equal(t, 1, abandoned)
+	assert.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond)
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
+
+func TestDrain_WaitsForRequestsInFlight(t *testing.T) {
+	server := newDrainTestServer(t)
+	client, tracker := newDrainTestClient(t)
+	done := make(chan error, 1)
+	go func() { done <- get(client, server.URL+"/slow") }()
+	<-server.slowStarted
+	time.AfterFunc(50*time.Millisecond, func() { close(server.release) })
+
+	start := time.Now()
+	abandoned := tracker.Drain(time.Minute)
+
+	assert.Equal(t, 0, abandoned)
+	assert.Less(t, time.Since(start), 5*time.Second)
+	require.NoError(t, <-done)
+}
+
+func TestDrain_ClosesIdleConnections(t *testing.T) {
+	server := newDrainTestServer(t)
+	client, tracker := newDrainTestClient(t)
+	require.NoError(t, get(client, server.URL+"/fast"))
+
+	assert.Equal(t, 0, tracker.Drain(0))
+
+	select {
+	case <-server.connClosed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("The idle connection wasn't closed.")
+	}
+}
+
+func TestDrain_FailedRequestsAreNotInFlight(t *testing.T) {
+	client, tracker := newDrainTestClient(t)
+
+	assert.Error(t, get(client, "http://127.0.0.1:0/"))
+
+	assert.Equal(t, 0, tracker.Drain(0))
+}
+
+func TestRequestTrackerInterceptors(t *testing.T) {
+	tracker := NewRequestTracker()
+	release := make(chan struct{})
+	invoker := func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		<-release
+		return nil
+	}
+	streamer := func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return nil, nil
+	}
+	unaryDone := make(chan error)
+	go func() { unaryDone <- tracker.unary(context.Background(), "/Write", nil, nil, nil, invoker) }()
+	ctx, cancel := context.WithCancel(context.Background())
+	_, err := tracker.stream(ctx, nil, nil, "/Read", streamer)
+	require.NoError(t, err)
+
+	// Both calls are in flight, until the unary one returns and the stream's
+	// context is done.
+	assert.Equal(t, 2, tracker.Drain(10*time.Millisecond))
+	close(release)
+	require.NoError(t, <-unaryDone)
+	cancel()
+	assert.Equal(t, 0, tracker.Drain(time.Minute))
+}
+
+func TestRequestTrackerDialOptions(t *testing.T) {
+	assert.Empty(t, RequestTrackerDialOptions(&StorageClientConfig{}))
+	assert.Len(t, RequestTrackerDialOptions(&StorageClientConfig{RequestTracker: NewRequestTracker()}), 2)
+}
@@ -0,0 +1,121 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storageutil
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/auth"
+)
+
+// DefaultUniverseDomain is the domain of the Google Cloud universe the APIs
+// are served from by default.
+const DefaultUniverseDomain = "googleapis.com"
+
+// Endpoints are the endpoints of the APIs gcsfuse talks to, as resolved by
+// ResolveEndpoints.
+type Endpoints struct {
+	// Storage is the base url of the GCS JSON API.
+	Storage string
+
+	// StorageGRPC is the host:port of the GCS gRPC API.
+	StorageGRPC string
+
+	// OAuth2Token is the url service account keys are exchanged for access
+	// tokens at.
+	OAuth2Token string
+
+	// STS is the url of the security token service external account
+	// credentials exchange their tokens at.
+	STS string
+
+	// IAMCredentials is the base url of the IAM credentials API service
+	// accounts are impersonated through.
+	IAMCredentials string
+}
+
+// ResolveEndpoints returns the endpoints of the APIs in the given universe
+// domain, empty for the default one. If pscEndpoint is set, the APIs are
+// reached through the Private Service Connect endpoint of that name, e.g.
+// "restricted" for the VPC Service Controls VIP, and if mtls is set through
+// their mTLS variants. Neither exists outside the default universe.
+func ResolveEndpoints(universeDomain string, pscEndpoint string, mtls bool) (e Endpoints, err error) {
+	if universeDomain == "" {
+		universeDomain = DefaultUniverseDomain
+	}
+
+	if universeDomain != DefaultUniverseDomain && (pscEndpoint != "" || mtls) {
+		err = fmt.Errorf("universe domain %q: Private Service Connect and mTLS endpoints exist only in %q", universeDomain, DefaultUniverseDomain)
+		return
+	}
+
+	if pscEndpoint != "" && mtls {
+		err = fmt.Errorf("Private Service Connect endpoint %q has no mTLS variant", pscEndpoint)
+		return
+	}
+
+	host := func(service string) string {
+		switch {
+		case pscEndpoint != "":
+			return fmt.Sprintf("%s-%s.p.%s", service, pscEndpoint, universeDomain)
+		case mtls:
+			return fmt.Sprintf("%s.mtls.%s", service, universeDomain)
+		default:
+			return fmt.Sprintf("%s.%s", service, universeDomain)
+		}
+	}
+
+	e = Endpoints{
+		Storage:        "https://" + host("storage") + "/storage/v1/",
+		StorageGRPC:    host("storage") + ":443",
+		OAuth2Token:    "https://" + host("oauth2") + "/token",
+		STS:            "https://" + host("sts") + "/v1/token",
+		IAMCredentials: "https://" + host("iamcredentials") + "/v1/",
+	}
+	return
+}
+
+// UseClientCertificate reports whether the mTLS endpoints are to be used, as
+// the client libraries decide it from GOOGLE_API_USE_CLIENT_CERTIFICATE.
+func UseClientCertificate() bool {
+	use, err := strconv.ParseBool(strings.TrimSpace(os.Getenv("GOOGLE_API_USE_CLIENT_CERTIFICATE")))
+	return err == nil && use
+}
+
+// ResolveEndpoints returns the endpoints the client reaches the APIs at, and
+// whether they differ from the ones the client libraries pick by themselves.
+func (c *StorageClientConfig) ResolveEndpoints() (e Endpoints, custom bool, err error) {
+	e, err = ResolveEndpoints(c.UniverseDomain, c.PSCEndpoint, UseClientCertificate())
+	custom = (c.UniverseDomain != "" && c.UniverseDomain != DefaultUniverseDomain) || c.PSCEndpoint != ""
+	return
+}
+
+// universe returns the universe tokens are fetched for, from the endpoints
+// resolved for it.
+func (c *StorageClientConfig) universe() (u auth.Universe, err error) {
+	u.Domain = c.UniverseDomain
+	e, custom, err := c.ResolveEndpoints()
+	if err != nil || (!custom && !UseClientCertificate()) {
+		return
+	}
+
+	u.OAuth2Token = e.OAuth2Token
+	u.STS = e.STS
+	u.IAMCredentials = e.IAMCredentials
+	return
+}
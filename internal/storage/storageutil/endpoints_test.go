@@ -0,0 +1,150 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storageutil
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveEndpoints(t *testing.T) {
+	testCases := []struct {
+		name           string
+		universeDomain string
+		pscEndpoint    string
+		mtls           bool
+		want           Endpoints
+	}{
+		{
+			name: "default",
+			want: Endpoints{
+				Storage:        "https://storage.googleapis.com/storage/v1/",
+				StorageGRPC:    "storage.googleapis.com:443",
+				OAuth2Token:    "https://oauth2.googleapis.com/token",
+				STS:            "https://sts.googleapis.com/v1/token",
+				IAMCredentials: "https://iamcredentials.googleapis.com/v1/",
+			},
+		},
+		{
+			name: "default mTLS",
+			mtls: true,
+			want: Endpoints{
+				Storage:        "https://storage.mtls.googleapis.com/storage/v1/",
+				StorageGRPC:    "storage.mtls.googleapis.com:443",
+				OAuth2Token:    "https://oauth2.mtls.googleapis.com/token",
+				STS:            "https://sts.mtls.googleapis.com/v1/token",
+				IAMCredentials: "https://iamcredentials.mtls.googleapis.com/v1/",
+			},
+		},
+		{
+			name:           "restricted",
+			universeDomain: DefaultUniverseDomain,
+			pscEndpoint:    "restricted",
+			want: Endpoints{
+				Storage:        "https://storage-restricted.p.googleapis.com/storage/v1/",
+				StorageGRPC:    "storage-restricted.p.googleapis.com:443",
+				OAuth2Token:    "https://oauth2-restricted.p.googleapis.com/token",
+				STS:            "https://sts-restricted.p.googleapis.com/v1/token",
+				IAMCredentials: "https://iamcredentials-restricted.p.googleapis.com/v1/",
+			},
+		},
+		{
+			name:           "custom universe",
+			universeDomain: "apis-tpclp.goog",
+			want: Endpoints{
+				Storage:        "https://storage.apis-tpclp.goog/storage/v1/",
+				StorageGRPC:    "storage.apis-tpclp.goog:443",
+				OAuth2Token:    "https://oauth2.apis-tpclp.goog/token",
+				STS:            "https://sts.apis-tpclp.goog/v1/token",
+				IAMCredentials: "https://iamcredentials.apis-tpclp.goog/v1/",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		got, err := ResolveEndpoints(tc.universeDomain, tc.pscEndpoint, tc.mtls)
+
+		require.NoError(t, err, tc.name)
+		assert.Equal(t, tc.want, got, tc.name)
+	}
+}
+
+func TestResolveEndpoints_Invalid(t *testing.T) {
+	testCases := []struct {
+		name           string
+		universeDomain string
+		pscEndpoint    string
+		mtls           bool
+	}{
+		{name: "custom universe mTLS", universeDomain: "apis-tpclp.goog", mtls: true},
+		{name: "custom universe restricted", universeDomain: "apis-tpclp.goog", pscEndpoint: "restricted"},
+		{name: "restricted mTLS", pscEndpoint: "restricted", mtls: true},
+	}
+
+	for _, tc := range testCases {
+		_, err := ResolveEndpoints(tc.universeDomain, tc.pscEndpoint, tc.mtls)
+
+		assert.Error(t, err, tc.name)
+	}
+}
+
+func TestStorageClientConfigResolveEndpoints(t *testing.T) {
+	t.Setenv("GOOGLE_API_USE_CLIENT_CERTIFICATE", "")
+	testCases := []struct {
+		name           string
+		universeDomain string
+		pscEndpoint    string
+		wantStorage    string
+		wantCustom     bool
+	}{
+		{"default", "", "", "https://storage.googleapis.com/storage/v1/", false},
+		{"explicit default", DefaultUniverseDomain, "", "https://storage.googleapis.com/storage/v1/", false},
+		{"restricted", "", "restricted", "https://storage-restricted.p.googleapis.com/storage/v1/", true},
+		{"custom universe", "apis-tpclp.goog", "", "https://storage.apis-tpclp.goog/storage/v1/", true},
+	}
+
+	for _, tc := range testCases {
+		c := StorageClientConfig{UniverseDomain: tc.universeDomain, PSCEndpoint: tc.pscEndpoint}
+
+		e, custom, err := c.ResolveEndpoints()
+
+		require.NoError(t, err, tc.name)
+		assert.Equal(t, tc.wantStorage, e.Storage, tc.name)
+		assert.Equal(t, tc.wantCustom, custom, tc.name)
+	}
+}
+
+func TestStorageClientConfigUniverse(t *testing.T) {
+	t.Setenv("GOOGLE_API_USE_CLIENT_CERTIFICATE", "")
+	c := StorageClientConfig{}
+	u, err := c.universe()
+	require.NoError(t, err)
+	assert.Equal(t, "", u.OAuth2Token)
+
+	c = StorageClientConfig{PSCEndpoint: "restricted"}
+	u, err = c.universe()
+	require.NoError(t, err)
+	assert.Equal(t, "https://oauth2-restricted.p.googleapis.com/token", u.OAuth2Token)
+	assert.Equal(t, "https://sts-restricted.p.googleapis.com/v1/token", u.STS)
+	assert.Equal(t, "https://iamcredentials-restricted.p.googleapis.com/v1/", u.IAMCredentials)
+
+	t.Setenv("GOOGLE_API_USE_CLIENT_CERTIFICATE", "true")
+	c = StorageClientConfig{}
+	u, err = c.universe()
+	require.NoError(t, err)
+	assert.Equal(t, "https://oauth2.mtls.googleapis.com/token", u.OAuth2Token)
+}
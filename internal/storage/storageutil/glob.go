@@ -0,0 +1,161 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storageutil
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// The characters with a special meaning in a match glob.
+const globMetaChars = `*?[{},`
+
+// CompileGlob compiles a pattern in the syntax of the matchGlob parameter of
+// GCS object listings into a regular expression matching the whole of an
+// object name:
+//
+//	**       matches zero or more characters, including '/'
+//	*        matches zero or more characters, not including '/'
+//	?        matches a single character other than '/'
+//	[abc]    matches any of the listed characters; ranges such as [a-z] and
+//	         negation with [!abc] or [^abc] are supported
+//	{a,b}    matches any of the comma-separated alternatives, which may
+//	         themselves be globs
+//
+// There is no escape character; a literal metacharacter is matched with a
+// class holding just that character, as in [*].
+func CompileGlob(pattern string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString(`(?s)^`)
+
+	// The number of braces opened and not yet closed.
+	var depth int
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				b.WriteString(`.*`)
+				i++
+			} else {
+				b.WriteString(`[^/]*`)
+			}
+
+		case '?':
+			b.WriteString(`[^/]`)
+
+		case '[':
+			// A ']' right after the opening bracket (or its negation) is a member
+			// of the class rather than its end.
+			start := i + 1
+			if start < len(pattern) && (pattern[start] == '!' || pattern[start] == '^') {
+				start++
+			}
+			end := -1
+			if start < len(pattern) {
+				if n := strings.IndexByte(pattern[start+1:], ']'); n >= 0 {
+					end = start + 1 + n
+				}
+			}
+			if end < 0 {
+				return nil, fmt.Errorf("unclosed '[' at offset %d in %q", i, pattern)
+			}
+
+			b.WriteByte('[')
+			class := pattern[i+1 : end]
+			if class[0] == '!' || class[0] == '^' {
+				b.WriteByte('^')
+				class = class[1:]
+			}
+			for j := 0; j < len(class); j++ {
+				switch {
+				case class[j] == '-' && j > 0 && j < len(class)-1:
+					b.WriteByte('-')
+				case strings.IndexByte(`\]^-[`, class[j]) >= 0:
+					b.WriteByte('\\')
+					b.WriteByte(class[j])
+				default:
+					b.WriteByte(class[j])
+				}
+			}
+			b.WriteByte(']')
+			i = end
+
+		case '{':
+			depth++
+			b.WriteString(`(?:`)
+
+		case '}':
+			if depth == 0 {
+				return nil, fmt.Errorf("unmatched '}' at offset %d in %q", i, pattern)
+			}
+			depth--
+			b.WriteByte(')')
+
+		case ',':
+			if depth == 0 {
+				b.WriteByte(',')
+			} else {
+				b.WriteByte('|')
+			}
+
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	if depth != 0 {
+		return nil, fmt.Errorf("unclosed '{' in %q", pattern)
+	}
+
+	b.WriteByte('$')
+	return regexp.Compile(b.String())
+}
+
+// MatchGlob reports whether the object name matches the glob pattern, in the
+// syntax described by CompileGlob.
+func MatchGlob(pattern, name string) (bool, error) {
+	re, err := CompileGlob(pattern)
+	if err != nil {
+		return false, err
+	}
+
+	return re.MatchString(name), nil
+}
+
+// QuoteGlob returns a glob pattern that matches exactly the string s.
+func QuoteGlob(s string) string {
+	if !HasGlobMeta(s) {
+		return s
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if strings.IndexByte(globMetaChars, s[i]) >= 0 {
+			b.WriteByte('[')
+			b.WriteByte(s[i])
+			b.WriteByte(']')
+		} else {
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+// HasGlobMeta reports whether s contains any character with a special meaning
+// in a glob pattern.
+func HasGlobMeta(s string) bool {
+	return strings.ContainsAny(s, globMetaChars)
+}
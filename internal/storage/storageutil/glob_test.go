@@ -0,0 +1,80 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storageutil
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchGlob(t *testing.T) {
+	testCases := []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		{"foo", "foo", true},
+		{"foo", "foobar", false},
+		{"*.txt", "a.txt", true},
+		{"*.txt", "dir/a.txt", false},
+		{"**.txt", "dir/a.txt", true},
+		{"dir/**", "dir/sub/a", true},
+		{"dir/**", "other/a", false},
+		{"a?c", "abc", true},
+		{"a?c", "a/c", false},
+		{"a.c", "abc", false},
+		{"[abc]x", "bx", true},
+		{"[abc]x", "dx", false},
+		{"[a-c]x", "bx", true},
+		{"[!a-c]x", "dx", true},
+		{"[^a-c]x", "bx", false},
+		{"[]]", "]", true},
+		{"[*]", "*", true},
+		{"[*]", "a", false},
+		{"{foo,bar}.txt", "bar.txt", true},
+		{"{foo,bar}.txt", "baz.txt", false},
+		{"d/{a,b{c,d}}", "d/bd", true},
+		{"d/{a,*.log}", "d/x.log", true},
+		{"a,b", "a,b", true},
+		{"(x)+", "(x)+", true},
+	}
+
+	for _, tc := range testCases {
+		got, err := MatchGlob(tc.pattern, tc.name)
+
+		require.NoError(t, err, tc.pattern)
+		assert.Equal(t, tc.want, got, "MatchGlob(%q, %q)", tc.pattern, tc.name)
+	}
+}
+
+func TestMatchGlob_Invalid(t *testing.T) {
+	for _, pattern := range []string{"[abc", "[]", "{a,b", "a}"} {
+		_, err := MatchGlob(pattern, "a")
+
+		assert.Error(t, err, pattern)
+	}
+}
+
+func TestQuoteGlob(t *testing.T) {
+	for _, s := range []string{"plain/name", "a*b?c", "[x]{y,z}", "d/e,f"} {
+		got, err := MatchGlob(QuoteGlob(s), s)
+
+		require.NoError(t, err, s)
+		assert.True(t, got, s)
+		assert.Equal(t, HasGlobMeta(s), QuoteGlob(s) != s, s)
+	}
+}
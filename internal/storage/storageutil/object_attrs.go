@@ -93,6 +93,7 @@ func ObjectAttrsToBucketObject(attrs *storage.ObjectAttrs) *gcs.Object {
 		StorageClass:       attrs.StorageClass,
 		Deleted:            attrs.Deleted,
 		Updated:            attrs.Updated,
+		Created:            attrs.Created,
 		ComponentCount:     attrs.ComponentCount,
 		ContentDisposition: attrs.ContentDisposition,
 		CustomTime:         string(attrs.CustomTime.Format(time.RFC3339)),
@@ -134,6 +135,33 @@ func SetAttrsInWriter(wc *storage.Writer, req *gcs.CreateObjectRequest) *storage
 	return wc
 }
 
+// SetAttrsInComposer - for setting object-attributes field in storage.Composer
+// object. These attributes will be assigned to the composed object.
+func SetAttrsInComposer(c *storage.Composer, req *gcs.ComposeObjectsRequest) *storage.Composer {
+	c.ContentType = req.ContentType
+	c.ContentLanguage = req.ContentLanguage
+	c.ContentEncoding = req.ContentEncoding
+	c.CacheControl = req.CacheControl
+	c.Metadata = req.Metadata
+	c.ContentDisposition = req.ContentDisposition
+	c.CustomTime, _ = time.Parse(time.RFC3339, req.CustomTime)
+	c.EventBasedHold = req.EventBasedHold
+	c.StorageClass = req.StorageClass
+
+	var aclRules []storage.ACLRule
+	for _, element := range req.Acl {
+		aclRules = append(aclRules, convertObjectAccessControlToACLRule(element))
+	}
+	c.ACL = aclRules
+
+	if req.CRC32C != nil {
+		c.CRC32C = *req.CRC32C
+		c.SendCRC32C = true
+	}
+
+	return c
+}
+
 func ConvertObjToMinObject(o *gcs.Object) *gcs.MinObject {
 	if o == nil {
 		return nil
@@ -145,8 +173,12 @@ func ConvertObjToMinObject(o *gcs.Object) *gcs.MinObject {
 		Generation:      o.Generation,
 		MetaGeneration:  o.MetaGeneration,
 		Updated:         o.Updated,
+		Created:         o.Created,
 		Metadata:        o.Metadata,
 		ContentEncoding: o.ContentEncoding,
+		ContentType:     o.ContentType,
+		CacheControl:    o.CacheControl,
+		CRC32C:          o.CRC32C,
 	}
 }
 
@@ -185,6 +217,7 @@ func ConvertMinObjectAndExtendedObjectAttributesToObject(m *gcs.MinObject,
 		Generation:         m.Generation,
 		MetaGeneration:     m.MetaGeneration,
 		Updated:            m.Updated,
+		Created:            m.Created,
 		Metadata:           m.Metadata,
 		ContentEncoding:    m.ContentEncoding,
 		ContentType:        e.ContentType,
@@ -215,7 +248,10 @@ func ConvertMinObjectToObject(m *gcs.MinObject) *gcs.Object {
 		Generation:      m.Generation,
 		MetaGeneration:  m.MetaGeneration,
 		Updated:         m.Updated,
+		Created:         m.Created,
 		Metadata:        m.Metadata,
 		ContentEncoding: m.ContentEncoding,
+		CacheControl:    m.CacheControl,
+		CRC32C:          m.CRC32C,
 	}
 }
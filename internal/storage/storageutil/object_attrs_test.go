@@ -218,6 +218,39 @@ func (t objectAttrsTest) TestSetAttrsInWriterMethod() {
 	ExpectEq(string(writer.MD5[:]), string(createObjectRequest.MD5[:]))
 }
 
+func (t objectAttrsTest) TestSetAttrsInComposerMethod() {
+	var crc32c uint32 = 45
+	timeInRFC3339 := "2006-01-02T15:04:05Z07:00"
+	composeObjectsRequest := gcs.ComposeObjectsRequest{
+		DstName:            "test_object",
+		ContentType:        "json",
+		ContentEncoding:    "universal",
+		CacheControl:       "Medium",
+		Metadata:           map[string]string{"file_name": "test.txt"},
+		ContentDisposition: "Test content disposition",
+		CustomTime:         timeInRFC3339,
+		EventBasedHold:     true,
+		StorageClass:       "High Accessibility",
+		CRC32C:             &crc32c,
+	}
+	composer := &storage.Composer{}
+
+	composer = SetAttrsInComposer(composer, &composeObjectsRequest)
+
+	ExpectEq(composer.ContentType, composeObjectsRequest.ContentType)
+	ExpectEq(composer.ContentLanguage, composeObjectsRequest.ContentLanguage)
+	ExpectEq(composer.ContentEncoding, composeObjectsRequest.ContentEncoding)
+	ExpectEq(composer.CacheControl, composeObjectsRequest.CacheControl)
+	ExpectEq(composer.Metadata, composeObjectsRequest.Metadata)
+	ExpectEq(composer.ContentDisposition, composeObjectsRequest.ContentDisposition)
+	parsedTime, _ := time.Parse(time.RFC3339, composeObjectsRequest.CustomTime)
+	ExpectTrue(parsedTime.Equal(composer.CustomTime))
+	ExpectEq(composer.EventBasedHold, composeObjectsRequest.EventBasedHold)
+	ExpectEq(composer.StorageClass, composeObjectsRequest.StorageClass)
+	ExpectEq(composer.CRC32C, *composeObjectsRequest.CRC32C)
+	ExpectTrue(composer.SendCRC32C)
+}
+
 func (t objectAttrsTest) Test_ConvertObjToMinObject_WithNilObject() {
 	var gcsObject *gcs.Object
 
@@ -233,6 +266,8 @@ func (t objectAttrsTest) Test_ConvertObjToMinObject_WithValidObject() {
 	metaGeneration := int64(555)
 	currentTime := time.Now()
 	contentEncode := "test_encoding"
+	cacheControl := "max-age=60"
+	crc32C := uint32(777)
 	metadata := map[string]string{"test_key": "test_value"}
 	gcsObject := gcs.Object{
 		Name:            name,
@@ -242,6 +277,8 @@ func (t objectAttrsTest) Test_ConvertObjToMinObject_WithValidObject() {
 		Updated:         currentTime,
 		Metadata:        metadata,
 		ContentEncoding: contentEncode,
+		CacheControl:    cacheControl,
+		CRC32C:          &crc32C,
 	}
 
 	gcsMinObject := ConvertObjToMinObject(&gcsObject)
@@ -253,6 +290,8 @@ func (t objectAttrsTest) Test_ConvertObjToMinObject_WithValidObject() {
 	ExpectEq(metaGeneration, gcsMinObject.MetaGeneration)
 	ExpectTrue(currentTime.Equal(gcsMinObject.Updated))
 	ExpectEq(contentEncode, gcsMinObject.ContentEncoding)
+	ExpectEq(cacheControl, gcsMinObject.CacheControl)
+	ExpectEq(&crc32C, gcsMinObject.CRC32C)
 	ExpectEq(metadata, gcsMinObject.Metadata)
 }
 
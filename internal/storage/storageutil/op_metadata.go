@@ -0,0 +1,138 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storageutil
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// OpMetadata describes the file system operation requests to GCS are made
+// for, so that they can be told apart in the logs of the bucket.
+type OpMetadata struct {
+	// The name of the operation, e.g. "ReadFile".
+	Op string
+
+	// The ID the kernel gave the operation, which shows up in the fuse debug
+	// logs.
+	ID uint64
+
+	// The uid of the process that made the operation.
+	Uid uint32
+}
+
+type opMetadataKey struct{}
+
+// WithOpMetadata returns a copy of ctx carrying m, for the requests made with
+// it to send.
+func WithOpMetadata(ctx context.Context, m OpMetadata) context.Context {
+	return context.WithValue(ctx, opMetadataKey{}, m)
+}
+
+// OpMetadataFrom returns the OpMetadata ctx carries, if any.
+func OpMetadataFrom(ctx context.Context) (m OpMetadata, ok bool) {
+	m, ok = ctx.Value(opMetadataKey{}).(OpMetadata)
+	return
+}
+
+// opMetadataValue returns the value of the header the OpMetadata of ctx is
+// sent in, or "" if it carries none.
+func opMetadataValue(ctx context.Context, includeUid bool) string {
+	m, ok := OpMetadataFrom(ctx)
+	if !ok {
+		return ""
+	}
+
+	v := "op=" + m.Op + ";id=" + strconv.FormatUint(m.ID, 10)
+	if includeUid {
+		v += ";uid=" + strconv.FormatUint(uint64(m.Uid), 10)
+	}
+	return v
+}
+
+// opMetadataRoundTripper sets a header to the OpMetadata of the context of
+// requests. Requests made outside of file system operations, e.g. background
+// uploads, are sent as they are.
+type opMetadataRoundTripper struct {
+	wrapped    http.RoundTripper
+	header     string
+	includeUid bool
+}
+
+func (rt *opMetadataRoundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	if v := opMetadataValue(r.Context(), rt.includeUid); v != "" {
+		r.Header.Set(rt.header, v)
+	}
+	return rt.wrapped.RoundTrip(r)
+}
+
+// withOpMetadataHeader wraps rt to send the OpMetadata of requests in the
+// header configured, if any.
+func withOpMetadataHeader(rt http.RoundTripper, storageClientConfig *StorageClientConfig) http.RoundTripper {
+	if storageClientConfig.OpMetadataHeader == "" {
+		return rt
+	}
+
+	return &opMetadataRoundTripper{
+		wrapped:    rt,
+		header:     storageClientConfig.OpMetadataHeader,
+		includeUid: storageClientConfig.OpMetadataUid,
+	}
+}
+
+// opMetadataInterceptor sets a gRPC metadata key to the OpMetadata of the
+// context of calls.
+type opMetadataInterceptor struct {
+	key        string
+	includeUid bool
+}
+
+func (i *opMetadataInterceptor) withMetadata(ctx context.Context) context.Context {
+	if v := opMetadataValue(ctx, i.includeUid); v != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, i.key, v)
+	}
+	return ctx
+}
+
+func (i *opMetadataInterceptor) unary(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	return invoker(i.withMetadata(ctx), method, req, reply, cc, opts...)
+}
+
+func (i *opMetadataInterceptor) stream(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	return streamer(i.withMetadata(ctx), desc, cc, method, opts...)
+}
+
+// OpMetadataDialOptions returns the options making gRPC calls send their
+// OpMetadata in the metadata key configured, if any.
+func OpMetadataDialOptions(storageClientConfig *StorageClientConfig) []grpc.DialOption {
+	if storageClientConfig.OpMetadataHeader == "" {
+		return nil
+	}
+
+	i := &opMetadataInterceptor{
+		// gRPC metadata keys are lower case.
+		key:        strings.ToLower(storageClientConfig.OpMetadataHeader),
+		includeUid: storageClientConfig.OpMetadataUid,
+	}
+	return []grpc.DialOption{
+		grpc.WithChainUnaryInterceptor(i.unary),
+		grpc.WithChainStreamInterceptor(i.stream),
+	}
+}
@@ -0,0 +1,213 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storageutil
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"testing"
+
+	"cloud.google.com/go/storage"
+	"github.com/fsouza/fake-gcs-server/fakestorage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	opMetadataTestBucket = "bucket"
+	opMetadataTestHeader = "x-goog-custom-audit-gcsfuse-op"
+)
+
+// headerRecorder records a header of the requests it sends.
+type headerRecorder struct {
+	wrapped http.RoundTripper
+	header  string
+
+	mu     sync.Mutex
+	values []string
+}
+
+func (rt *headerRecorder) RoundTrip(r *http.Request) (*http.Response, error) {
+	rt.mu.Lock()
+	rt.values = append(rt.values, r.Header.Get(rt.header))
+	rt.mu.Unlock()
+	return rt.wrapped.RoundTrip(r)
+}
+
+// Take the values recorded so far.
+func (rt *headerRecorder) take() []string {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	values := rt.values
+	rt.values = nil
+	return values
+}
+
+// Return a client of a fake GCS server whose requests go through the
+// op-metadata round tripper of the given config, and the recorder of the
+// header they send.
+func newOpMetadataTestClient(t *testing.T, cfg *StorageClientConfig) (*storage.Client, *headerRecorder) {
+	t.Helper()
+	server, err := fakestorage.NewServerWithOptions(fakestorage.Options{
+		NoListener: true,
+		InitialObjects: []fakestorage.Object{{
+			ObjectAttrs: fakestorage.ObjectAttrs{BucketName: opMetadataTestBucket, Name: "foo"},
+			Content:     []byte("taco"),
+		}},
+	})
+	require.NoError(t, err)
+	t.Cleanup(server.Stop)
+
+	recorder := &headerRecorder{wrapped: server.HTTPClient().Transport, header: opMetadataTestHeader}
+	client, err := storage.NewClient(
+		context.Background(),
+		option.WithHTTPClient(&http.Client{Transport: withOpMetadataHeader(recorder, cfg)}),
+		option.WithCredentials(&google.Credentials{}))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = client.Close() })
+	return client, recorder
+}
+
+func opMetadataTestCtx(op string, id uint64) context.Context {
+	return WithOpMetadata(context.Background(), OpMetadata{Op: op, ID: id, Uid: 1000})
+}
+
+func TestOpMetadataHeader(t *testing.T) {
+	bucket := func(c *storage.Client) *storage.BucketHandle { return c.Bucket(opMetadataTestBucket) }
+	testCases := []struct {
+		name string
+		cfg  StorageClientConfig
+		ctx  context.Context
+		want string
+	}{
+		{
+			name: "op",
+			cfg:  StorageClientConfig{OpMetadataHeader: opMetadataTestHeader},
+			ctx:  opMetadataTestCtx("ReadFile", 17),
+			want: "op=ReadFile;id=17",
+		},
+		{
+			name: "op_and_uid",
+			cfg:  StorageClientConfig{OpMetadataHeader: opMetadataTestHeader, OpMetadataUid: true},
+			ctx:  opMetadataTestCtx("ReadFile", 17),
+			want: "op=ReadFile;id=17;uid=1000",
+		},
+		{
+			name: "no_op",
+			cfg:  StorageClientConfig{OpMetadataHeader: opMetadataTestHeader},
+			ctx:  context.Background(),
+			want: "",
+		},
+		{
+			name: "disabled",
+			cfg:  StorageClientConfig{},
+			ctx:  opMetadataTestCtx("ReadFile", 17),
+			want: "",
+		},
+	}
+	paths := []struct {
+		name string
+		run  func(ctx context.Context, c *storage.Client) error
+	}{
+		{
+			name: "read",
+			run: func(ctx context.Context, c *storage.Client) error {
+				r, err := bucket(c).Object("foo").NewReader(ctx)
+				if err != nil {
+					return err
+				}
+				defer r.Close()
+				_, err = io.ReadAll(r)
+				return err
+			},
+		},
+		{
+			name: "write",
+			run: func(ctx context.Context, c *storage.Client) error {
+				w := bucket(c).Object("bar").NewWriter(ctx)
+				if _, err := w.Write([]byte("burrito")); err != nil {
+					return err
+				}
+				return w.Close()
+			},
+		},
+		{
+			name: "list",
+			run: func(ctx context.Context, c *storage.Client) error {
+				it := bucket(c).Objects(ctx, nil)
+				for {
+					if _, err := it.Next(); err == iterator.Done {
+						return nil
+					} else if err != nil {
+						return err
+					}
+				}
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		for _, path := range paths {
+			t.Run(tc.name+"/"+path.name, func(t *testing.T) {
+				client, recorder := newOpMetadataTestClient(t, &tc.cfg)
+
+				require.NoError(t, path.run(tc.ctx, client))
+
+				values := recorder.take()
+				require.NotEmpty(t, values)
+				for _, v := range values {
+					assert.Equal(t, tc.want, v)
+				}
+			})
+		}
+	}
+}
+
+func TestOpMetadataDialOptions_Disabled(t *testing.T) {
+	assert.Empty(t, OpMetadataDialOptions(&StorageClientConfig{}))
+	assert.Len(t, OpMetadataDialOptions(&StorageClientConfig{OpMetadataHeader: opMetadataTestHeader}), 2)
+}
+
+func TestOpMetadataInterceptor(t *testing.T) {
+	i := &opMetadataInterceptor{key: opMetadataTestHeader, includeUid: true}
+	var got []string
+	invoker := func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		md, _ := metadata.FromOutgoingContext(ctx)
+		got = md.Get(opMetadataTestHeader)
+		return nil
+	}
+	streamer := func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		md, _ := metadata.FromOutgoingContext(ctx)
+		got = md.Get(opMetadataTestHeader)
+		return nil, nil
+	}
+
+	require.NoError(t, i.unary(opMetadataTestCtx("WriteFile", 3), "/Write", nil, nil, nil, invoker))
+	assert.Equal(t, []string{"op=WriteFile;id=3;uid=1000"}, got)
+
+	_, err := i.stream(opMetadataTestCtx("ReadDir", 4), nil, nil, "/List", streamer)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"op=ReadDir;id=4;uid=1000"}, got)
+
+	require.NoError(t, i.unary(context.Background(), "/Write", nil, nil, nil, invoker))
+	assert.Empty(t, got)
+}
@@ -0,0 +1,298 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storageutil
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/monitor"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/util"
+	"github.com/jacobsa/timeutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// The categories of requests throttled independently of each other, so that
+// GCS throttling the contents of objects doesn't slow down their metadata,
+// and vice versa.
+const (
+	// Requests for the metadata of objects and buckets, including listings.
+	MetadataRequests = "metadata"
+
+	// Requests reading or writing the contents of objects.
+	DataRequests = "data"
+)
+
+const (
+	// The rate, in requests per second, a category is paced to when first
+	// throttled is half of this, and a category recovering to it is no longer
+	// paced.
+	throttleMaxRate = 1000.0
+
+	// The lowest rate, in requests per second, a category is paced to.
+	throttleMinRate = 1.0
+
+	// How much each successful request raises the rate of its category while
+	// paced, in requests per second.
+	throttleRecoveryStep = 1.0
+)
+
+// ThrottleController paces the requests of a storage client while GCS
+// throttles them, so that all of its handles back off together rather than
+// each retrying on its own and keeping up the load. Each category of requests
+// is paced separately, AIMD-style: a throttled response halves the rate its
+// category is paced to, and each successful one raises it by
+// throttleRecoveryStep, until it's back to throttleMaxRate and the category is
+// no longer paced. The retries of individual requests are requests too, and
+// are paced on top of their own backoff.
+//
+// Safe for concurrent access.
+type ThrottleController struct {
+	clock timeutil.Clock
+
+	// Waits for the given duration, or until the context is done.
+	sleep func(ctx context.Context, d time.Duration) error
+
+	mu sync.Mutex
+
+	// GUARDED_BY(mu)
+	categories map[string]*throttleState
+}
+
+type throttleState struct {
+	// The rate the category is paced to, in requests per second, or zero if
+	// it isn't paced.
+	rate float64
+
+	// The time at which the next request of the category may be sent.
+	next time.Time
+
+	// When the rate was last cut. Throttled responses to requests sent before
+	// then reflect the load before the cut, and don't cut it again.
+	cut time.Time
+}
+
+func NewThrottleController(clock timeutil.Clock) *ThrottleController {
+	return &ThrottleController{
+		clock:      clock,
+		sleep:      util.SleepContext,
+		categories: make(map[string]*throttleState),
+	}
+}
+
+// Return the interval between requests at the rate, zero if it is.
+func throttleInterval(rate float64) time.Duration {
+	if rate == 0 {
+		return 0
+	}
+	return time.Duration(float64(time.Second) / rate)
+}
+
+// LOCKS_REQUIRED(c.mu)
+func (c *ThrottleController) stateLocked(category string) *throttleState {
+	s, ok := c.categories[category]
+	if !ok {
+		s = &throttleState{}
+		c.categories[category] = s
+	}
+	return s
+}
+
+// Delay returns the interval the requests of the category are paced to, or
+// zero if they aren't.
+//
+// LOCKS_EXCLUDED(c.mu)
+func (c *ThrottleController) Delay(category string) time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return throttleInterval(c.stateLocked(category).rate)
+}
+
+// begin waits for the slot of a request of the category, if it is paced, and
+// returns the function to call with whether the response to the request said
+// it was throttled.
+//
+// LOCKS_EXCLUDED(c.mu)
+func (c *ThrottleController) begin(ctx context.Context, category string) (end func(throttled bool), err error) {
+	c.mu.Lock()
+	s := c.stateLocked(category)
+	now := c.clock.Now()
+	sent := now
+	if s.rate > 0 {
+		sent = s.next
+		if sent.Before(now) {
+			sent = now
+		}
+		s.next = sent.Add(throttleInterval(s.rate))
+	}
+	c.mu.Unlock()
+
+	if delay := sent.Sub(now); delay > 0 {
+		if err = c.sleep(ctx, delay); err != nil {
+			return
+		}
+	}
+
+	return func(throttled bool) { c.observe(category, sent, throttled) }, nil
+}
+
+// observe adjusts the rate of the category to the response to a request sent
+// at the given time.
+//
+// LOCKS_EXCLUDED(c.mu)
+func (c *ThrottleController) observe(category string, sent time.Time, throttled bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.stateLocked(category)
+	before := s.rate
+
+	switch {
+	case throttled:
+		if sent.Before(s.cut) {
+			return
+		}
+		rate := s.rate
+		if rate == 0 {
+			rate = throttleMaxRate
+		}
+		s.rate = max(rate/2, throttleMinRate)
+		s.cut = c.clock.Now()
+
+	case s.rate > 0:
+		s.rate += throttleRecoveryStep
+		if s.rate >= throttleMaxRate {
+			s.rate = 0
+		}
+
+	default:
+		return
+	}
+
+	delay := throttleInterval(s.rate)
+	monitor.CaptureThrottleDelayMetrics(context.Background(), category, delay)
+	if before == 0 {
+		logger.Warnf("GCS is throttling %s requests; pacing them to one every %v", category, delay)
+	} else if s.rate == 0 {
+		logger.Infof("GCS is no longer throttling %s requests", category)
+	}
+}
+
+// httpRequestCategory returns the category of a request to the JSON API, or
+// to the XML API, which is only used for reads.
+func httpRequestCategory(r *http.Request) string {
+	if r.URL.Query().Get("alt") == "media" ||
+		strings.Contains(r.URL.Path, "/upload/") ||
+		!strings.Contains(r.URL.Path, "/storage/v1/") {
+		return DataRequests
+	}
+	return MetadataRequests
+}
+
+// grpcRequestCategory returns the category of a call to the gRPC method.
+func grpcRequestCategory(method string) string {
+	switch method[strings.LastIndex(method, "/")+1:] {
+	case "ReadObject", "BidiReadObject", "WriteObject", "BidiWriteObject":
+		return DataRequests
+	}
+	return MetadataRequests
+}
+
+// wrap returns a round tripper sending requests through rt, paced by the
+// controller.
+func (c *ThrottleController) wrap(rt http.RoundTripper) http.RoundTripper {
+	return &throttlingRoundTripper{wrapped: rt, controller: c}
+}
+
+type throttlingRoundTripper struct {
+	wrapped    http.RoundTripper
+	controller *ThrottleController
+}
+
+func (rt *throttlingRoundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	end, err := rt.controller.begin(r.Context(), httpRequestCategory(r))
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := rt.wrapped.RoundTrip(r)
+	if err == nil {
+		end(resp.StatusCode == http.StatusTooManyRequests)
+	}
+	return resp, err
+}
+
+func isThrottled(err error) bool {
+	return status.Code(err) == codes.ResourceExhausted
+}
+
+func (c *ThrottleController) unary(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	end, err := c.begin(ctx, grpcRequestCategory(method))
+	if err != nil {
+		return err
+	}
+
+	err = invoker(ctx, method, req, reply, cc, opts...)
+	end(isThrottled(err))
+	return err
+}
+
+func (c *ThrottleController) stream(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	end, err := c.begin(ctx, grpcRequestCategory(method))
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := streamer(ctx, desc, cc, method, opts...)
+	if err != nil {
+		end(isThrottled(err))
+		return nil, err
+	}
+	return &throttledStream{ClientStream: s, end: end}, nil
+}
+
+// throttledStream reports whether a stream was throttled by the outcome of
+// its first receive, as GCS fails streams it throttles before sending
+// anything.
+type throttledStream struct {
+	grpc.ClientStream
+	once sync.Once
+	end  func(throttled bool)
+}
+
+func (s *throttledStream) RecvMsg(m any) error {
+	err := s.ClientStream.RecvMsg(m)
+	s.once.Do(func() { s.end(isThrottled(err)) })
+	return err
+}
+
+// ThrottleDialOptions returns the options making gRPC calls paced by the
+// throttle controller of the config, if any.
+func ThrottleDialOptions(storageClientConfig *StorageClientConfig) []grpc.DialOption {
+	c := storageClientConfig.ThrottleController
+	if c == nil {
+		return nil
+	}
+
+	return []grpc.DialOption{
+		grpc.WithChainUnaryInterceptor(c.unary),
+		grpc.WithChainStreamInterceptor(c.stream),
+	}
+}
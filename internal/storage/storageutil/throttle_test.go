@@ -0,0 +1,237 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storageutil
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	mountpkg "github.com/googlecloudplatform/gcsfuse/v2/internal/mount"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/util"
+	"github.com/jacobsa/timeutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opencensus.io/stats/view"
+)
+
+// Return a controller whose waits advance the simulated clock.
+func newSimulatedThrottleController(clock *timeutil.SimulatedClock) *ThrottleController {
+	c := NewThrottleController(clock)
+	c.sleep = func(_ context.Context, d time.Duration) error {
+		clock.AdvanceTime(d)
+		return nil
+	}
+	return c
+}
+
+// throttlingServer throttles the requests beyond capacity in the last second,
+// as GCS does with 429s.
+type throttlingServer struct {
+	clock    *timeutil.SimulatedClock
+	capacity int
+	admitted []time.Time
+}
+
+func (s *throttlingServer) serve() (throttled bool) {
+	now := s.clock.Now()
+	for len(s.admitted) > 0 && !s.admitted[0].After(now.Add(-time.Second)) {
+		s.admitted = s.admitted[1:]
+	}
+	if s.capacity > 0 && len(s.admitted) >= s.capacity {
+		return true
+	}
+	s.admitted = append(s.admitted, now)
+	return false
+}
+
+// Send requests of the category back to back for the duration, each taking a
+// millisecond, and return how many were sent in the last second.
+func sendFor(t *testing.T, c *ThrottleController, s *throttlingServer, category string, d time.Duration) (lastSecond int) {
+	t.Helper()
+	ctx := context.Background()
+	end := s.clock.Now().Add(d)
+	for s.clock.Now().Before(end) {
+		done, err := c.begin(ctx, category)
+		require.NoError(t, err)
+		if !s.clock.Now().Before(end.Add(-time.Second)) {
+			lastSecond++
+		}
+		s.clock.AdvanceTime(time.Millisecond)
+		done(s.serve())
+	}
+	return
+}
+
+func TestThrottleController_RateDropsAndRecovers(t *testing.T) {
+	var clock timeutil.SimulatedClock
+	clock.SetTime(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	c := newSimulatedThrottleController(&clock)
+	s := &throttlingServer{clock: &clock}
+
+	// Unthrottled, requests go back to back.
+	assert.Equal(t, 1000, sendFor(t, c, s, DataRequests, 2*time.Second))
+	assert.Zero(t, c.Delay(DataRequests))
+
+	// Once GCS throttles them, they are paced to about what it admits.
+	s.capacity = 100
+	rate := sendFor(t, c, s, DataRequests, 20*time.Second)
+	assert.Less(t, rate, 2*s.capacity)
+	assert.Greater(t, rate, s.capacity/2)
+	assert.Positive(t, c.Delay(DataRequests))
+
+	// And they go back to back again once it stops.
+	s.capacity = 0
+	assert.Equal(t, 1000, sendFor(t, c, s, DataRequests, 20*time.Second))
+	assert.Zero(t, c.Delay(DataRequests))
+}
+
+func TestThrottleController_CategoriesAreIndependent(t *testing.T) {
+	var clock timeutil.SimulatedClock
+	clock.SetTime(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	c := newSimulatedThrottleController(&clock)
+	data := &throttlingServer{clock: &clock, capacity: 100}
+	metadata := &throttlingServer{clock: &clock}
+
+	// Requests of both categories alternate, and only data is throttled.
+	ctx := context.Background()
+	end := clock.Now().Add(10 * time.Second)
+	for clock.Now().Before(end) {
+		done, err := c.begin(ctx, DataRequests)
+		require.NoError(t, err)
+		done(data.serve())
+
+		start := clock.Now()
+		done, err = c.begin(ctx, MetadataRequests)
+		require.NoError(t, err)
+		assert.Equal(t, start, clock.Now(), "metadata request waited")
+		clock.AdvanceTime(time.Millisecond)
+		done(metadata.serve())
+	}
+
+	assert.Positive(t, c.Delay(DataRequests))
+	assert.Zero(t, c.Delay(MetadataRequests))
+}
+
+func TestThrottleController_InFlightDontCutAgain(t *testing.T) {
+	var clock timeutil.SimulatedClock
+	clock.SetTime(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	c := newSimulatedThrottleController(&clock)
+	ctx := context.Background()
+
+	// Three requests in flight are throttled: the rate is cut once.
+	var ends []func(bool)
+	for i := 0; i < 3; i++ {
+		end, err := c.begin(ctx, MetadataRequests)
+		require.NoError(t, err)
+		ends = append(ends, end)
+	}
+	clock.AdvanceTime(time.Millisecond)
+	for _, end := range ends {
+		end(true)
+	}
+	assert.Equal(t, throttleInterval(throttleMaxRate/2), c.Delay(MetadataRequests))
+
+	// A request sent after the cut that is throttled cuts it again.
+	end, err := c.begin(ctx, MetadataRequests)
+	require.NoError(t, err)
+	end(true)
+	assert.Equal(t, throttleInterval(throttleMaxRate/4), c.Delay(MetadataRequests))
+}
+
+func TestThrottleController_WaitCanceled(t *testing.T) {
+	var clock timeutil.SimulatedClock
+	clock.SetTime(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	c := newSimulatedThrottleController(&clock)
+	end, err := c.begin(context.Background(), DataRequests)
+	require.NoError(t, err)
+	end(true)
+	c.sleep = util.SleepContext
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// The first request after the cut goes right away, and the next waits for
+	// its slot.
+	_, err = c.begin(ctx, DataRequests)
+	require.NoError(t, err)
+	_, err = c.begin(ctx, DataRequests)
+
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestThrottlingRoundTripper(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/storage/v1/") && r.URL.Query().Get("alt") != "media" {
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	}))
+	defer server.Close()
+	controller := NewThrottleController(timeutil.RealClock())
+	client, err := CreateHttpClient(&StorageClientConfig{
+		ClientProtocol:     mountpkg.HTTP1,
+		AnonymousAccess:    true,
+		ThrottleController: controller,
+	})
+	require.NoError(t, err)
+
+	resp, err := client.Get(server.URL + "/storage/v1/b/some_bucket/o/foo?alt=media")
+	require.NoError(t, err)
+	resp.Body.Close()
+	resp, err = client.Get(server.URL + "/storage/v1/b/some_bucket/o/foo")
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(t, throttleInterval(throttleMaxRate/2), controller.Delay(MetadataRequests))
+	assert.Zero(t, controller.Delay(DataRequests))
+	rows, err := view.RetrieveData("gcs/throttle_delay")
+	require.NoError(t, err)
+	var found bool
+	for _, row := range rows {
+		if row.Tags[0].Value == MetadataRequests {
+			found = true
+			assert.Equal(t, 2.0, row.Data.(*view.LastValueData).Value)
+		}
+	}
+	assert.True(t, found)
+}
+
+func TestRequestCategories(t *testing.T) {
+	httpCases := map[string]string{
+		"https://storage.googleapis.com/storage/v1/b/bucket/o/foo":                     MetadataRequests,
+		"https://storage.googleapis.com/storage/v1/b/bucket/o?prefix=foo%2F":           MetadataRequests,
+		"https://storage.googleapis.com/storage/v1/b/bucket/o/foo?alt=media":           DataRequests,
+		"https://storage.googleapis.com/upload/storage/v1/b/bucket/o?uploadType=media": DataRequests,
+		"https://storage.googleapis.com/bucket/foo":                                    DataRequests,
+	}
+	for url, expected := range httpCases {
+		r, err := http.NewRequest(http.MethodGet, url, nil)
+		require.NoError(t, err)
+		assert.Equal(t, expected, httpRequestCategory(r), url)
+	}
+
+	grpcCases := map[string]string{
+		"/google.storage.v2.Storage/ReadObject":      DataRequests,
+		"/google.storage.v2.Storage/BidiWriteObject": DataRequests,
+		"/google.storage.v2.Storage/GetObject":       MetadataRequests,
+		"/google.storage.v2.Storage/ListObjects":     MetadataRequests,
+	}
+	for method, expected := range grpcCases {
+		assert.Equal(t, expected, grpcRequestCategory(method), method)
+	}
+}
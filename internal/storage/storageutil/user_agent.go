@@ -0,0 +1,84 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storageutil
+
+import (
+	"fmt"
+	"strings"
+
+	mountpkg "github.com/googlecloudplatform/gcsfuse/v2/internal/mount"
+)
+
+// MaxUserAgentLength bounds the User-Agent of requests, which holds the app
+// name given by users.
+const MaxUserAgentLength = 256
+
+// Features are the features of the mount that the User-Agent of its requests
+// tells GCS about, so that traffic can be told apart by them. Those of the
+// client itself, such as gRPC, come from its StorageClientConfig.
+type Features struct {
+	FileCache             bool
+	FileCacheForRangeRead bool
+	SharedFileCache       bool
+	BackgroundUploads     bool
+	ReadOnly              bool
+}
+
+// featureFingerprint returns the features of the mount and the client as
+// key=value pairs in a fixed order, with 1 for enabled and 0 for disabled.
+// Keys are only ever added at the end, so the format is stable:
+//
+//	rc=1,rr=0,sc=0,bu=0,grpc=1,hns=0,ro=1
+func featureFingerprint(c *StorageClientConfig) string {
+	pairs := []struct {
+		key     string
+		enabled bool
+	}{
+		{"rc", c.Features.FileCache},
+		{"rr", c.Features.FileCacheForRangeRead},
+		{"sc", c.Features.SharedFileCache},
+		{"bu", c.Features.BackgroundUploads},
+		{"grpc", c.ClientProtocol == mountpkg.GRPC},
+		{"hns", bool(c.EnableHNS)},
+		{"ro", c.Features.ReadOnly},
+	}
+	fields := make([]string, len(pairs))
+	for i, p := range pairs {
+		v := 0
+		if p.enabled {
+			v = 1
+		}
+		fields[i] = fmt.Sprintf("%s=%d", p.key, v)
+	}
+	return strings.Join(fields, ",")
+}
+
+// UserAgent returns the User-Agent of the requests of the client: its
+// UserAgent followed by the fingerprint of its features, e.g.
+// "gcsfuse/2.3.0 (GPN:gcsfuse) (Cfg:1:0) (Feat:rc=1,rr=0,...)". It's at most
+// MaxUserAgentLength bytes, the UserAgent being cut to fit so that the
+// fingerprint is whole.
+func UserAgent(c *StorageClientConfig) string {
+	feat := fmt.Sprintf("(Feat:%s)", featureFingerprint(c))
+	base := c.UserAgent
+	if max := MaxUserAgentLength - len(feat) - 1; len(base) > max {
+		base = strings.ToValidUTF8(base[:max], "")
+	}
+	base = strings.TrimSpace(base)
+	if base == "" {
+		return feat
+	}
+	return base + " " + feat
+}
@@ -0,0 +1,79 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storageutil
+
+import (
+	"strings"
+	"testing"
+
+	mountpkg "github.com/googlecloudplatform/gcsfuse/v2/internal/mount"
+	"github.com/stretchr/testify/assert"
+)
+
+const userAgentTestBase = "gcsfuse/2.3.0 (GPN:gcsfuse) (Cfg:0:0)"
+
+func TestUserAgent(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   StorageClientConfig
+		expected string
+	}{
+		{
+			name:     "Defaults",
+			config:   StorageClientConfig{UserAgent: userAgentTestBase, ClientProtocol: mountpkg.HTTP1},
+			expected: userAgentTestBase + " (Feat:rc=0,rr=0,sc=0,bu=0,grpc=0,hns=0,ro=0)",
+		},
+		{
+			name: "ReadOnlyWithFileCache",
+			config: StorageClientConfig{
+				UserAgent:      userAgentTestBase,
+				ClientProtocol: mountpkg.HTTP2,
+				Features:       Features{FileCache: true, FileCacheForRangeRead: true, ReadOnly: true},
+			},
+			expected: userAgentTestBase + " (Feat:rc=1,rr=1,sc=0,bu=0,grpc=0,hns=0,ro=1)",
+		},
+		{
+			name: "GRPCWithHNSAndBackgroundUploads",
+			config: StorageClientConfig{
+				UserAgent:      userAgentTestBase,
+				ClientProtocol: mountpkg.GRPC,
+				EnableHNS:      true,
+				Features:       Features{FileCache: true, SharedFileCache: true, BackgroundUploads: true},
+			},
+			expected: userAgentTestBase + " (Feat:rc=1,rr=0,sc=1,bu=1,grpc=1,hns=1,ro=0)",
+		},
+		{
+			name:     "NoUserAgent",
+			config:   StorageClientConfig{ClientProtocol: mountpkg.GRPC},
+			expected: "(Feat:rc=0,rr=0,sc=0,bu=0,grpc=1,hns=0,ro=0)",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, UserAgent(&tc.config))
+		})
+	}
+}
+
+func TestUserAgentIsBounded(t *testing.T) {
+	const feat = " (Feat:rc=0,rr=0,sc=0,bu=0,grpc=0,hns=0,ro=0)"
+	c := StorageClientConfig{UserAgent: "gcsfuse/2.3.0 (GPN:gcsfuse-" + strings.Repeat("é", MaxUserAgentLength) + ")"}
+
+	userAgent := UserAgent(&c)
+
+	assert.LessOrEqual(t, len(userAgent), MaxUserAgentLength)
+	assert.True(t, strings.HasPrefix(userAgent, "gcsfuse/2.3.0 (GPN:gcsfuse-é"))
+	assert.True(t, strings.HasSuffix(userAgent, "é"+feat), userAgent)
+}
@@ -0,0 +1,155 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// CgroupCPUQuota returns how many CPUs the process may use according to the
+// CPU quota of its cgroup and the cgroups above it, with cgroup v1 or v2, or
+// false if none has a quota.
+func CgroupCPUQuota() (cpus float64, ok bool, err error) {
+	return cgroupCPUQuota("/proc/self/cgroup", "/sys/fs/cgroup")
+}
+
+func cgroupCPUQuota(procSelfCgroup string, cgroupRoot string) (cpus float64, ok bool, err error) {
+	contents, err := os.ReadFile(procSelfCgroup)
+	if err != nil {
+		return
+	}
+
+	// Lines are "hierarchy-ID:controller-list:cgroup-path". The cpu controller
+	// is in a v1 hierarchy if one lists it, and otherwise in the v2 one, which
+	// has ID 0 and no controllers listed.
+	v2Path := ""
+	for _, line := range strings.Split(strings.TrimSpace(string(contents)), "\n") {
+		fields := strings.SplitN(line, ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+
+		if fields[0] == "0" && fields[1] == "" {
+			v2Path = fields[2]
+			continue
+		}
+
+		for _, controller := range strings.Split(fields[1], ",") {
+			if controller == "cpu" {
+				return minCPUQuota(path.Join(cgroupRoot, fields[1]), fields[2], readCFSQuota)
+			}
+		}
+	}
+
+	if v2Path != "" {
+		return minCPUQuota(cgroupRoot, v2Path, readCPUMax)
+	}
+
+	return
+}
+
+// minCPUQuota returns the smallest quota read by read from the directory of
+// the cgroup at cgroupPath in the hierarchy mounted at root and those of its
+// ancestors. Directories that don't exist are skipped, as in a container whose
+// cgroup is mounted as the root.
+func minCPUQuota(
+	root string,
+	cgroupPath string,
+	read func(dir string) (float64, bool, error)) (cpus float64, ok bool, err error) {
+	for p := path.Clean("/" + cgroupPath); ; p = path.Dir(p) {
+		var c float64
+		var found bool
+		c, found, err = read(path.Join(root, p))
+		if err != nil {
+			return
+		}
+		if found && (!ok || c < cpus) {
+			cpus, ok = c, true
+		}
+
+		if p == "/" {
+			return
+		}
+	}
+}
+
+// readCPUMax reads the cpu.max file of a cgroup v2, "$MAX $PERIOD" where
+// $MAX is "max" for no quota.
+func readCPUMax(dir string) (cpus float64, ok bool, err error) {
+	contents, err := readCgroupFile(dir, "cpu.max")
+	if contents == "" || err != nil {
+		return
+	}
+
+	fields := strings.Fields(contents)
+	if len(fields) != 2 {
+		err = fmt.Errorf("malformed cpu.max in %q: %q", dir, contents)
+		return
+	}
+	if fields[0] == "max" {
+		return
+	}
+
+	return cpusOfQuota(dir, fields[0], fields[1])
+}
+
+// readCFSQuota reads the cpu.cfs_quota_us and cpu.cfs_period_us files of a
+// cgroup v1, the former being -1 for no quota.
+func readCFSQuota(dir string) (cpus float64, ok bool, err error) {
+	quota, err := readCgroupFile(dir, "cpu.cfs_quota_us")
+	if quota == "" || quota == "-1" || err != nil {
+		return
+	}
+
+	period, err := readCgroupFile(dir, "cpu.cfs_period_us")
+	if err != nil {
+		return
+	}
+
+	return cpusOfQuota(dir, quota, period)
+}
+
+// readCgroupFile returns the trimmed contents of a file of a cgroup, or the
+// empty string if it doesn't exist.
+func readCgroupFile(dir string, name string) (string, error) {
+	contents, err := os.ReadFile(path.Join(dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+
+	return strings.TrimSpace(string(contents)), err
+}
+
+func cpusOfQuota(dir string, quota string, period string) (cpus float64, ok bool, err error) {
+	q, err := strconv.ParseInt(quota, 10, 64)
+	if err != nil {
+		err = fmt.Errorf("malformed CPU quota in %q: %w", dir, err)
+		return
+	}
+
+	p, err := strconv.ParseInt(period, 10, 64)
+	if err != nil || p <= 0 || q <= 0 {
+		err = fmt.Errorf("malformed CPU quota in %q: %q per %q", dir, quota, period)
+		return
+	}
+
+	cpus, ok = float64(q)/float64(p), true
+	return
+}
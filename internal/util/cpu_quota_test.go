@@ -0,0 +1,120 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Write the given files, by path relative to a new directory, returning the
+// directory.
+func writeCgroupFiles(t *testing.T, files map[string]string) string {
+	root := t.TempDir()
+	for name, contents := range files {
+		p := filepath.Join(root, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0700))
+		require.NoError(t, os.WriteFile(p, []byte(contents), 0600))
+	}
+	return root
+}
+
+func TestCgroupCPUQuota_V2(t *testing.T) {
+	root := writeCgroupFiles(t, map[string]string{
+		"proc/self/cgroup":                     "0::/kubepods/pod1/gcsfuse\n",
+		"cgroup/cpu.max":                       "max 100000\n",
+		"cgroup/kubepods/pod1/cpu.max":         "250000 100000\n",
+		"cgroup/kubepods/pod1/gcsfuse/cpu.max": "max 100000\n",
+	})
+
+	cpus, ok, err := cgroupCPUQuota(filepath.Join(root, "proc/self/cgroup"), filepath.Join(root, "cgroup"))
+
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, 2.5, cpus)
+}
+
+func TestCgroupCPUQuota_V2SmallestOfAncestors(t *testing.T) {
+	root := writeCgroupFiles(t, map[string]string{
+		"proc/self/cgroup":   "0::/a/b\n",
+		"cgroup/a/cpu.max":   "100000 100000\n",
+		"cgroup/a/b/cpu.max": "400000 100000\n",
+	})
+
+	cpus, ok, err := cgroupCPUQuota(filepath.Join(root, "proc/self/cgroup"), filepath.Join(root, "cgroup"))
+
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, 1.0, cpus)
+}
+
+func TestCgroupCPUQuota_V2Namespaced(t *testing.T) {
+	// The cgroup path isn't under the root seen from inside the container.
+	root := writeCgroupFiles(t, map[string]string{
+		"proc/self/cgroup": "0::/../../kubepods/pod1\n",
+		"cgroup/cpu.max":   "50000 100000\n",
+	})
+
+	cpus, ok, err := cgroupCPUQuota(filepath.Join(root, "proc/self/cgroup"), filepath.Join(root, "cgroup"))
+
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, 0.5, cpus)
+}
+
+func TestCgroupCPUQuota_V2NoQuota(t *testing.T) {
+	root := writeCgroupFiles(t, map[string]string{
+		"proc/self/cgroup": "0::/user.slice\n",
+		"cgroup/cpu.max":   "max 100000\n",
+	})
+
+	_, ok, err := cgroupCPUQuota(filepath.Join(root, "proc/self/cgroup"), filepath.Join(root, "cgroup"))
+
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestCgroupCPUQuota_V1(t *testing.T) {
+	root := writeCgroupFiles(t, map[string]string{
+		"proc/self/cgroup": "12:memory:/docker/abc\n" +
+			"4:cpu,cpuacct:/docker/abc\n" +
+			"0::/docker/abc\n",
+		"cgroup/cpu,cpuacct/docker/abc/cpu.cfs_quota_us":  "300000\n",
+		"cgroup/cpu,cpuacct/docker/abc/cpu.cfs_period_us": "100000\n",
+		"cgroup/cpu,cpuacct/cpu.cfs_quota_us":             "-1\n",
+		"cgroup/cpu,cpuacct/cpu.cfs_period_us":            "100000\n",
+	})
+
+	cpus, ok, err := cgroupCPUQuota(filepath.Join(root, "proc/self/cgroup"), filepath.Join(root, "cgroup"))
+
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, 3.0, cpus)
+}
+
+func TestCgroupCPUQuota_Malformed(t *testing.T) {
+	root := writeCgroupFiles(t, map[string]string{
+		"proc/self/cgroup": "0::/\n",
+		"cgroup/cpu.max":   "lots\n",
+	})
+
+	_, _, err := cgroupCPUQuota(filepath.Join(root, "proc/self/cgroup"), filepath.Join(root, "cgroup"))
+
+	assert.ErrorContains(t, err, "malformed cpu.max")
+}
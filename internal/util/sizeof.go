@@ -252,7 +252,7 @@ func NestedSizeOfGcsMinObject(m *gcs.MinObject) (size int) {
 	}
 
 	// Account for integer members - Size, Generation, MetaGeneration.
-	// Account for time members - Updated.
+	// Account for time members - Updated, Created.
 	// Nothing to be added for any built-in types - already accounted for in unsafeSizeOf(o).
 
 	// Account for map members.
@@ -115,3 +115,16 @@ func IsolateContextFromParentContext(ctx context.Context) (context.Context, cont
 	ctx = context.WithoutCancel(ctx)
 	return context.WithCancel(ctx)
 }
+
+// SleepContext waits for the given duration, or until the context is done, in
+// which case it returns the context's error.
+func SleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
@@ -278,3 +279,21 @@ func (ts *UtilTest) TestIsolateContextFromParentContext() {
 	newCtxCancel()
 	assert.ErrorIs(ts.T(), newCtx.Err(), context.Canceled)
 }
+
+func (ts *UtilTest) TestSleepContextWaits() {
+	start := time.Now()
+
+	err := SleepContext(context.Background(), 10*time.Millisecond)
+
+	assert.NoError(ts.T(), err)
+	assert.GreaterOrEqual(ts.T(), time.Since(start), 10*time.Millisecond)
+}
+
+func (ts *UtilTest) TestSleepContextReturnsWhenContextIsDone() {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := SleepContext(ctx, time.Hour)
+
+	assert.ErrorIs(ts.T(), err, context.Canceled)
+}
@@ -0,0 +1,74 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mount_test
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/pkg/mount"
+)
+
+// Mount the fake bucket, which lives in memory, use it through the OS, and
+// unmount it. Mounting needs FUSE, so the example isn't run as a test.
+func Example() {
+	dir, err := os.MkdirTemp("", "gcsfuse_example")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.Remove(dir)
+
+	cfg, err := mount.ParseConfig([]byte("write:\n  create-empty-file: true\n"), "")
+	if err != nil {
+		log.Fatal(err)
+	}
+	cfg.ImplicitDirs = true
+
+	mfs, err := mount.Mount(context.Background(), mount.FakeBucketName, dir, cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(mfs.Health().Name)
+
+	// Read an object of the bucket, and write another.
+	contents, err := os.ReadFile(filepath.Join(dir, "foo"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(string(contents))
+
+	if err := os.WriteFile(filepath.Join(dir, "baz", "quux"), []byte("tamale"), 0644); err != nil {
+		log.Fatal(err)
+	}
+
+	entries, err := os.ReadDir(filepath.Join(dir, "baz"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, e := range entries {
+		fmt.Println(e.Name())
+	}
+
+	if err := mfs.Unmount(); err != nil {
+		log.Fatal(err)
+	}
+	if err := mfs.Wait(); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(mfs.Health().Name)
+}
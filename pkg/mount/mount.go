@@ -0,0 +1,299 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package mount mounts buckets with gcsfuse from within a Go program, rather
+// than by running the gcsfuse binary. A mount is served by the process, as
+// with gcsfuse --foreground, until it's unmounted.
+//
+// Logging, exporting the metrics, whose views Mount registers, and handling
+// signals are left to the program.
+package mount
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/cmd"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/canned"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/config"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/lifecycle"
+	"github.com/jacobsa/fuse"
+	"go.opencensus.io/stats/view"
+)
+
+// FakeBucketName is the name of a bucket that lives in memory, with a few
+// canned objects, for trying out and testing mounts without GCS.
+const FakeBucketName = canned.FakeBucketName
+
+// Config is the configuration of a mount. Its sections mirror those of the
+// config file schema, and its other fields the command-line flags of gcsfuse
+// of the same names. Start from NewConfig or ParseConfig: the zero Config
+// isn't the default one.
+type Config struct {
+	// The options of the file system, as with the flags of the same names.
+	ImplicitDirs   bool
+	OnlyDir        string
+	RenameDirLimit int
+	ReadOnly       bool
+	Uid            int
+	Gid            int
+	FileMode       os.FileMode
+	DirMode        os.FileMode
+
+	// The credentials and billing of the requests to GCS, as with the flags of
+	// the same names. Application default credentials are used if KeyFile is
+	// empty.
+	KeyFile        string
+	BillingProject string
+
+	// TempDir is the directory writes are staged in until they're uploaded,
+	// the system's temporary directory if empty.
+	TempDir string
+
+	Write         WriteConfig         `yaml:"write"`
+	CacheDir      string              `yaml:"cache-dir"`
+	FileCache     FileCacheConfig     `yaml:"file-cache"`
+	MetadataCache MetadataCacheConfig `yaml:"metadata-cache"`
+	FileSystem    FileSystemConfig    `yaml:"file-system"`
+	GCSConnection GCSConnectionConfig `yaml:"gcs-connection"`
+
+	// The parsed config file the other options of the mount come from, if
+	// any.
+	base *config.MountConfig
+}
+
+// WriteConfig is the write section of the config file.
+type WriteConfig struct {
+	CreateEmptyFile bool `yaml:"create-empty-file"`
+}
+
+// FileCacheConfig is the file-cache section of the config file. Files are
+// cached in CacheDir if MaxSizeMB isn't zero, -1 meaning no limit.
+type FileCacheConfig struct {
+	MaxSizeMB             int64 `yaml:"max-size-mb"`
+	CacheFileForRangeRead bool  `yaml:"cache-file-for-range-read"`
+}
+
+// MetadataCacheConfig is the metadata-cache section of the config file.
+type MetadataCacheConfig struct {
+	// TTLSecs is how long the attributes and types of objects are cached, -1
+	// meaning forever and 0 not at all.
+	TTLSecs            int64 `yaml:"ttl-secs"`
+	StatCacheMaxSizeMB int64 `yaml:"stat-cache-max-size-mb"`
+	TypeCacheMaxSizeMB int   `yaml:"type-cache-max-size-mb"`
+}
+
+// FileSystemConfig is the file-system section of the config file.
+type FileSystemConfig struct {
+	IgnoreInterrupts       bool  `yaml:"ignore-interrupts"`
+	KernelListCacheTTLSecs int64 `yaml:"kernel-list-cache-ttl-secs"`
+	DisableParallelDirops  bool  `yaml:"disable-parallel-dirops"`
+}
+
+// GCSConnectionConfig is the gcs-connection section of the config file.
+type GCSConnectionConfig struct {
+	// ClientProtocol is one of "http1", "http2" and "grpc".
+	ClientProtocol  string `yaml:"client-protocol"`
+	MaxConnsPerHost int    `yaml:"max-conns-per-host"`
+}
+
+// NewConfig returns the default configuration, as with an empty config file
+// and no flags.
+func NewConfig() *Config {
+	return newConfig(config.NewMountConfig())
+}
+
+// ParseConfig returns the configuration of the supplied contents of a config
+// file, applying the named profile, or the one the contents select if profile
+// is empty. The options of the file that Config has no field for apply too.
+func ParseConfig(yaml []byte, profile string) (*Config, error) {
+	mountConfig, err := config.ParseConfigWithProfile(yaml, profile)
+	if err != nil {
+		return nil, err
+	}
+
+	return newConfig(mountConfig), nil
+}
+
+// newConfig returns the configuration with the supplied options of the config
+// file and the default flags.
+func newConfig(mc *config.MountConfig) *Config {
+	return &Config{
+		Uid:      -1,
+		Gid:      -1,
+		FileMode: 0644,
+		DirMode:  0755,
+
+		Write: WriteConfig{
+			CreateEmptyFile: mc.WriteConfig.CreateEmptyFile,
+		},
+		CacheDir: string(mc.CacheDir),
+		FileCache: FileCacheConfig{
+			MaxSizeMB:             mc.FileCacheConfig.MaxSizeMB,
+			CacheFileForRangeRead: mc.FileCacheConfig.CacheFileForRangeRead,
+		},
+		MetadataCache: MetadataCacheConfig{
+			TTLSecs:            mc.MetadataCacheConfig.TtlInSeconds,
+			StatCacheMaxSizeMB: mc.MetadataCacheConfig.StatCacheMaxSizeMB,
+			TypeCacheMaxSizeMB: mc.MetadataCacheConfig.TypeCacheMaxSizeMB,
+		},
+		FileSystem: FileSystemConfig{
+			IgnoreInterrupts:       mc.FileSystemConfig.IgnoreInterrupts,
+			KernelListCacheTTLSecs: mc.FileSystemConfig.KernelListCacheTtlSeconds,
+			DisableParallelDirops:  mc.FileSystemConfig.DisableParallelDirops,
+		},
+		GCSConnection: GCSConnectionConfig{
+			ClientProtocol:  mc.GCSConnectionConfig.ClientProtocol,
+			MaxConnsPerHost: mc.GCSConnectionConfig.MaxConnsPerHost,
+		},
+		base: mc,
+	}
+}
+
+// mountConfig returns the options of the config file of the mount.
+func (cfg *Config) mountConfig() *config.MountConfig {
+	mc := *config.NewMountConfig()
+	if cfg.base != nil {
+		mc = *cfg.base
+	}
+
+	mc.WriteConfig.CreateEmptyFile = cfg.Write.CreateEmptyFile
+	// A list of cache directories in the config file is replaced along with
+	// its first one.
+	if config.CacheDir(cfg.CacheDir) != mc.CacheDir {
+		mc.CacheDir = config.CacheDir(cfg.CacheDir)
+		mc.CacheDirs = nil
+	}
+	mc.FileCacheConfig.MaxSizeMB = cfg.FileCache.MaxSizeMB
+	mc.FileCacheConfig.CacheFileForRangeRead = cfg.FileCache.CacheFileForRangeRead
+	mc.MetadataCacheConfig.TtlInSeconds = cfg.MetadataCache.TTLSecs
+	mc.MetadataCacheConfig.StatCacheMaxSizeMB = cfg.MetadataCache.StatCacheMaxSizeMB
+	mc.MetadataCacheConfig.TypeCacheMaxSizeMB = cfg.MetadataCache.TypeCacheMaxSizeMB
+	mc.FileSystemConfig.IgnoreInterrupts = cfg.FileSystem.IgnoreInterrupts
+	mc.FileSystemConfig.KernelListCacheTtlSeconds = cfg.FileSystem.KernelListCacheTTLSecs
+	mc.FileSystemConfig.DisableParallelDirops = cfg.FileSystem.DisableParallelDirops
+	mc.GCSConnectionConfig.ClientProtocol = cfg.GCSConnection.ClientProtocol
+	mc.GCSConnectionConfig.MaxConnsPerHost = cfg.GCSConnection.MaxConnsPerHost
+	return &mc
+}
+
+// flags returns the values of the flags of gcsfuse the mount is configured
+// with, by flag name.
+func (cfg *Config) flags() map[string]string {
+	flags := map[string]string{
+		"implicit-dirs":    strconv.FormatBool(cfg.ImplicitDirs),
+		"only-dir":         cfg.OnlyDir,
+		"rename-dir-limit": strconv.Itoa(cfg.RenameDirLimit),
+		"uid":              strconv.Itoa(cfg.Uid),
+		"gid":              strconv.Itoa(cfg.Gid),
+		"file-mode":        strconv.FormatUint(uint64(cfg.FileMode.Perm()), 8),
+		"dir-mode":         strconv.FormatUint(uint64(cfg.DirMode.Perm()), 8),
+		"key-file":         cfg.KeyFile,
+		"billing-project":  cfg.BillingProject,
+		"temp-dir":         cfg.TempDir,
+	}
+	if cfg.ReadOnly {
+		flags["o"] = "ro"
+	}
+	return flags
+}
+
+// Event is a stage of a mount that has been reached, or has failed, e.g.
+// "ready" once the file system is mounted, or "unmounted".
+type Event = lifecycle.Event
+
+// MountedFileSystem is a bucket mounted by Mount.
+type MountedFileSystem struct {
+	mfs         *fuse.MountedFileSystem
+	unsubscribe func()
+
+	mu sync.Mutex
+
+	// GUARDED_BY(mu)
+	health Event
+
+	waitOnce sync.Once
+	waitErr  error
+}
+
+// Mount mounts bucketName, or all the buckets accessible with the
+// credentials if it's empty, on mountPoint according to cfg. Transient
+// failures to mount are retried until ctx is done.
+func Mount(ctx context.Context, bucketName string, mountPoint string, cfg *Config) (*MountedFileSystem, error) {
+	m := &MountedFileSystem{}
+	m.unsubscribe = lifecycle.Subscribe(func(e Event) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.health = e
+	})
+
+	mfs, err := cmd.MountInProcess(ctx, bucketName, mountPoint, cfg.mountConfig(), cfg.flags())
+	if err != nil {
+		m.unsubscribe()
+		return nil, err
+	}
+
+	m.mfs = mfs
+	primePoll(mfs.Dir())
+	return m, nil
+}
+
+// Dir returns the directory on which the file system is mounted.
+func (m *MountedFileSystem) Dir() string {
+	return m.mfs.Dir()
+}
+
+// Unmount unmounts the file system. It fails if the file system is busy,
+// e.g. with files open. Wait waits for the file system to be shut down.
+func (m *MountedFileSystem) Unmount() error {
+	if err := fuse.Unmount(m.mfs.Dir()); err != nil {
+		return fmt.Errorf("Unmount: %w", err)
+	}
+
+	return nil
+}
+
+// Wait waits for the file system to be unmounted, by Unmount or otherwise,
+// and shut down: by then, the uploads of the files written to have been
+// finished and the connection to GCS closed.
+func (m *MountedFileSystem) Wait() error {
+	m.waitOnce.Do(func() {
+		m.waitErr = m.mfs.Join(context.Background())
+		lifecycle.Publish(lifecycle.Unmounted, m.waitErr)
+		m.unsubscribe()
+	})
+
+	return m.waitErr
+}
+
+// Health returns the last stage of the mount that was reached, or failed,
+// e.g. "ready", or "initialized" once a lazy mount has accessed its bucket.
+// The stages are those of all the mounts of the process, so Health describes
+// the last mount to reach a stage if there are several.
+func (m *MountedFileSystem) Health() Event {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.health
+}
+
+// Metric returns the rows of the metric with the given name, e.g.
+// "fs/ops_count" or "gcs/read_bytes_count", as exported by gcsfuse. The
+// metrics are those of all the mounts of the process.
+func (m *MountedFileSystem) Metric(name string) ([]*view.Row, error) {
+	return view.RetrieveData(name)
+}
@@ -0,0 +1,46 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mount
+
+import (
+	"testing"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewConfigIsTheDefault(t *testing.T) {
+	cfg := NewConfig()
+
+	assert.Equal(t, config.NewMountConfig(), cfg.mountConfig())
+	assert.Equal(t, "-1", cfg.flags()["uid"])
+	assert.Equal(t, "644", cfg.flags()["file-mode"])
+	assert.Equal(t, "755", cfg.flags()["dir-mode"])
+	assert.NotContains(t, cfg.flags(), "o")
+}
+
+func TestParseConfigKeepsOptionsWithoutFields(t *testing.T) {
+	cfg, err := ParseConfig([]byte("metadata-cache:\n  ttl-secs: 30\nlist:\n  suppressed-names: [\"foo\"]\n"), "")
+	require.NoError(t, err)
+
+	cfg.MetadataCache.TTLSecs = 120
+	cfg.ReadOnly = true
+	mc := cfg.mountConfig()
+
+	assert.Equal(t, int64(120), mc.MetadataCacheConfig.TtlInSeconds)
+	assert.Equal(t, []string{"foo"}, mc.ListConfig.SuppressedNames)
+	assert.Equal(t, "ro", cfg.flags()["o"])
+}
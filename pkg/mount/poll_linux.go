@@ -0,0 +1,83 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mount
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+)
+
+// The number of directories of a mount primePoll looks for a file in.
+const primePollMaxDirs = 8
+
+// primePoll has the kernel learn that the file system mounted on dir doesn't
+// support poll. The kernel asks the file system the first time a file of the
+// mount is added to an epoll set, which the os package does on every open,
+// without the runtime releasing the goroutine's processor meanwhile: were the
+// first open done by the program, the mount couldn't answer while the runtime
+// waits for that goroutine to stop the world, e.g. for a garbage collection,
+// and not at all with GOMAXPROCS 1. So the first regular file found in the
+// mount is added to an epoll set here, with a system call that releases the
+// processor. A mount with no files yet can't be primed, and the request then
+// comes with the first file the program creates.
+func primePoll(dir string) {
+	name := findRegularFile(dir)
+	if name == "" {
+		return
+	}
+
+	fd, err := syscall.Open(name, syscall.O_RDONLY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return
+	}
+	defer syscall.Close(fd)
+
+	epfd, err := syscall.EpollCreate1(syscall.EPOLL_CLOEXEC)
+	if err != nil {
+		return
+	}
+	defer syscall.Close(epfd)
+
+	// Unlike syscall.EpollCtl, this releases the processor.
+	event := syscall.EpollEvent{Events: syscall.EPOLLIN, Fd: int32(fd)}
+	_, _, _ = syscall.Syscall6(syscall.SYS_EPOLL_CTL, uintptr(epfd), syscall.EPOLL_CTL_ADD, uintptr(fd), uintptr(unsafe.Pointer(&event)), 0, 0)
+}
+
+// findRegularFile returns the path of a regular file in the tree of dir,
+// looking in up to primePollMaxDirs directories breadth first, or "" if it
+// finds none. Directories of a mount don't support poll, so listing them is
+// safe.
+func findRegularFile(dir string) string {
+	dirs := []string{dir}
+	for i := 0; i < len(dirs) && i < primePollMaxDirs; i++ {
+		entries, err := os.ReadDir(dirs[i])
+		if err != nil {
+			continue
+		}
+
+		for _, e := range entries {
+			switch {
+			case e.Type().IsRegular():
+				return filepath.Join(dirs[i], e.Name())
+			case e.IsDir():
+				dirs = append(dirs, filepath.Join(dirs[i], e.Name()))
+			}
+		}
+	}
+
+	return ""
+}
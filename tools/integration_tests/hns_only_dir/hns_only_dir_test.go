@@ -0,0 +1,53 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Provides integration tests for directory operations on a hierarchical
+// bucket mounted with --only-dir. They are only run against HNS buckets.
+package hns_only_dir_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/config"
+	"github.com/googlecloudplatform/gcsfuse/v2/tools/integration_tests/util/mounting/only_dir_mounting"
+	"github.com/googlecloudplatform/gcsfuse/v2/tools/integration_tests/util/setup"
+)
+
+const (
+	testDirName    = "HNSOnlyDirTest"
+	onlyDirMounted = "OnlyDirMountHNS"
+	PrefixTempFile = "temp"
+)
+
+func TestMain(m *testing.M) {
+	setup.ExitWithFailureIfMountedDirectoryIsSetOrTestBucketIsNotSet()
+
+	setup.SetUpTestDirForTestBucketFlag()
+
+	mountConfig := config.MountConfig{
+		EnableHNS: true,
+		LogConfig: config.LogConfig{
+			Severity: config.TRACE,
+			FilePath: setup.LogFile(),
+		},
+	}
+	configFile := setup.YAMLConfigFile(mountConfig, "config.yaml")
+	// The rename-dir-limit is left at its default of zero, so renaming a
+	// non-empty directory only succeeds through the folder API.
+	flags := [][]string{{"--config-file=" + configFile}, {"--config-file=" + configFile, "--implicit-dirs"}}
+
+	successCode := only_dir_mounting.RunTests(flags, onlyDirMounted, m)
+	os.Exit(successCode)
+}
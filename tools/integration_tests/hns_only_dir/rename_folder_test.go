@@ -0,0 +1,79 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hns_only_dir_test
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/tools/integration_tests/util/operations"
+	"github.com/googlecloudplatform/gcsfuse/v2/tools/integration_tests/util/setup"
+)
+
+func TestRenameDirectoryWithFiles(t *testing.T) {
+	testDirPath := setup.SetupTestDirectory(testDirName)
+	oldDirPath := path.Join(testDirPath, "directoryWithThreeFiles")
+	newDirPath := path.Join(testDirPath, "renamedDirectory")
+	operations.CreateDirectoryWithNFiles(3, oldDirPath, PrefixTempFile, t)
+
+	err := os.Rename(oldDirPath, newDirPath)
+
+	if err != nil {
+		t.Fatalf("os.Rename(%s, %s): %v", oldDirPath, newDirPath, err)
+	}
+	if _, err = os.Stat(oldDirPath); !os.IsNotExist(err) {
+		t.Errorf("os.Stat(%s) after rename: %v", oldDirPath, err)
+	}
+	entries, err := os.ReadDir(newDirPath)
+	if err != nil {
+		t.Fatalf("os.ReadDir(%s): %v", newDirPath, err)
+	}
+	if len(entries) != 3 {
+		t.Errorf("Renamed directory has %d entries, want 3", len(entries))
+	}
+}
+
+func TestRenameDirectoryOntoNonEmptyDirectory(t *testing.T) {
+	testDirPath := setup.SetupTestDirectory(testDirName)
+	oldDirPath := path.Join(testDirPath, "directoryWithOneFile")
+	newDirPath := path.Join(testDirPath, "directoryWithTwoFiles")
+	operations.CreateDirectoryWithNFiles(1, oldDirPath, PrefixTempFile, t)
+	operations.CreateDirectoryWithNFiles(2, newDirPath, PrefixTempFile, t)
+
+	err := os.Rename(oldDirPath, newDirPath)
+
+	if err == nil {
+		t.Fatalf("os.Rename(%s, %s) succeeded, want ENOTEMPTY", oldDirPath, newDirPath)
+	}
+	if _, err = os.Stat(oldDirPath); err != nil {
+		t.Errorf("os.Stat(%s): %v", oldDirPath, err)
+	}
+}
+
+func TestMkdirAndRmdir(t *testing.T) {
+	testDirPath := setup.SetupTestDirectory(testDirName)
+	dirPath := path.Join(testDirPath, "emptyDirectory")
+
+	operations.CreateDirectory(dirPath, t)
+	err := os.Remove(dirPath)
+
+	if err != nil {
+		t.Fatalf("os.Remove(%s): %v", dirPath, err)
+	}
+	if _, err = os.Stat(dirPath); !os.IsNotExist(err) {
+		t.Errorf("os.Stat(%s) after rmdir: %v", dirPath, err)
+	}
+}
@@ -61,7 +61,19 @@ func TestMain(m *testing.M) {
 	// Close storage client and release resources.
 	storageClient.Close()
 	cancel()
-	// Clean up test directory created.
-	setup.CleanupDirectoryOnGCS(path.Join(setup.TestBucket(), testDirName))
 	os.Exit(successCode)
 }
+
+// setupTestDir runs t in parallel in a directory of the mount named
+// prefix+t.Name() that no other test uses, and removes the directory from
+// GCS once t completes.
+func setupTestDir(t *testing.T, prefix string) (env *setup.TestEnv, dirName, dirPath string) {
+	setup.Parallel(t)
+	env = setup.DefaultTestEnv(ctx, storageClient)
+	dirName = prefix + t.Name()
+	t.Cleanup(func() {
+		bucket, object := env.BucketAndObject(dirName)
+		setup.CleanupDirectoryOnGCS(path.Join(bucket, object))
+	})
+	return env, dirName, env.SetupTestDirectory(dirName)
+}
@@ -22,12 +22,11 @@ import (
 	"path/filepath"
 	"testing"
 
-	"github.com/googlecloudplatform/gcsfuse/v2/tools/integration_tests/util/setup"
 	"github.com/googlecloudplatform/gcsfuse/v2/tools/integration_tests/util/setup/implicit_and_explicit_dir_setup"
 )
 
 func TestListImplicitObjectsFromBucket(t *testing.T) {
-	testDir := setup.SetupTestDirectory(DirForImplicitDirTests)
+	env, testDirName, testDir := setupTestDir(t, DirForImplicitDirTests)
 	// Directory Structure
 	// testBucket/dirForImplicitDirTests/implicitDirectory                                                  -- Dir
 	// testBucket/dirForImplicitDirTests/implicitDirectory/fileInImplicitDir1                               -- File
@@ -38,8 +37,8 @@ func TestListImplicitObjectsFromBucket(t *testing.T) {
 	// testBucket/dirForImplicitDirTests/explicitDirectory/fileInExplicitDir1                               -- File
 	// testBucket/dirForImplicitDirTests/explicitDirectory/fileInExplicitDir2                               -- File
 
-	implicit_and_explicit_dir_setup.CreateImplicitDirectoryStructure(DirForImplicitDirTests)
-	implicit_and_explicit_dir_setup.CreateExplicitDirectoryStructure(DirForImplicitDirTests, t)
+	implicit_and_explicit_dir_setup.CreateImplicitDirectoryStructureInEnv(env, testDirName)
+	implicit_and_explicit_dir_setup.CreateExplicitDirectoryStructureInEnv(env, testDirName, t)
 
 	err := filepath.WalkDir(testDir, func(path string, dir fs.DirEntry, err error) error {
 		if err != nil {
@@ -22,16 +22,14 @@ import (
 	"cloud.google.com/go/storage"
 	. "github.com/googlecloudplatform/gcsfuse/v2/tools/integration_tests/util/client"
 	"github.com/googlecloudplatform/gcsfuse/v2/tools/integration_tests/util/operations"
-	"github.com/googlecloudplatform/gcsfuse/v2/tools/integration_tests/util/setup"
 	"golang.org/x/net/context"
 )
 
 const (
-	testDirName = "ImplicitDirTest"
+	testDirPrefix = "ImplicitDirTest"
 )
 
 var (
-	testDirPath   string
 	storageClient *storage.Client
 	ctx           context.Context
 )
@@ -41,25 +39,25 @@ var (
 // //////////////////////////////////////////////////////////////////////
 
 func TestNewFileUnderImplicitDirectoryShouldNotGetSyncedToGCSTillClose(t *testing.T) {
-	testDirPath = setup.SetupTestDirectory(testDirName)
-	CreateImplicitDir(ctx, storageClient, testDirName, t)
+	env, testDirName, testDirPath := setupTestDir(t, testDirPrefix)
+	CreateImplicitDirInEnv(env, testDirName, t)
 	fileName := path.Join(ImplicitDirName, FileName1)
 
-	_, fh := CreateLocalFileInTestDir(ctx, storageClient, testDirPath, fileName, t)
+	_, fh := CreateLocalFileInTestDirInEnv(env, testDirPath, fileName, t)
 	operations.WriteWithoutClose(fh, FileContents, t)
-	ValidateObjectNotFoundErrOnGCS(ctx, storageClient, testDirName, fileName, t)
+	ValidateObjectNotFoundErrOnGCSInEnv(env, testDirName, fileName, t)
 
 	// Validate.
-	CloseFileAndValidateContentFromGCS(ctx, storageClient, fh, testDirName, fileName, FileContents, t)
+	CloseFileAndValidateContentFromGCSInEnv(env, fh, testDirName, fileName, FileContents, t)
 }
 
 func TestReadDirForImplicitDirWithLocalFile(t *testing.T) {
-	testDirPath = setup.SetupTestDirectory(testDirName)
-	CreateImplicitDir(ctx, storageClient, testDirName, t)
+	env, testDirName, testDirPath := setupTestDir(t, testDirPrefix)
+	CreateImplicitDirInEnv(env, testDirName, t)
 	fileName1 := path.Join(ImplicitDirName, FileName1)
 	fileName2 := path.Join(ImplicitDirName, FileName2)
-	_, fh1 := CreateLocalFileInTestDir(ctx, storageClient, testDirPath, fileName1, t)
-	_, fh2 := CreateLocalFileInTestDir(ctx, storageClient, testDirPath, fileName2, t)
+	_, fh1 := CreateLocalFileInTestDirInEnv(env, testDirPath, fileName1, t)
+	_, fh2 := CreateLocalFileInTestDirInEnv(env, testDirPath, fileName2, t)
 
 	// Attempt to list implicit directory.
 	entries := operations.ReadDirectory(path.Join(testDirPath, ImplicitDirName), t)
@@ -70,8 +68,8 @@ func TestReadDirForImplicitDirWithLocalFile(t *testing.T) {
 	operations.VerifyFileEntry(entries[1], FileName2, 0, t)
 	operations.VerifyFileEntry(entries[2], ImplicitFileName1, GCSFileSize, t)
 	// Close the local files.
-	CloseFileAndValidateContentFromGCS(ctx, storageClient, fh1, testDirName, fileName1, "", t)
-	CloseFileAndValidateContentFromGCS(ctx, storageClient, fh2, testDirName, fileName2, "", t)
+	CloseFileAndValidateContentFromGCSInEnv(env, fh1, testDirName, fileName1, "", t)
+	CloseFileAndValidateContentFromGCSInEnv(env, fh2, testDirName, fileName2, "", t)
 }
 
 func TestRecursiveListingWithLocalFiles(t *testing.T) {
@@ -84,17 +82,17 @@ func TestRecursiveListingWithLocalFiles(t *testing.T) {
 	// mntDir/implicit/foo2  					--- file
 	// mntDir/implicit/implicitFile1	--- file
 
-	testDirPath = setup.SetupTestDirectory(testDirName)
+	env, testDirName, testDirPath := setupTestDir(t, testDirPrefix)
 	fileName2 := path.Join(ExplicitDirName, ExplicitFileName1)
 	fileName3 := path.Join(ImplicitDirName, FileName2)
 	// Create local file in mnt/ dir.
-	_, fh1 := CreateLocalFileInTestDir(ctx, storageClient, testDirPath, FileName1, t)
+	_, fh1 := CreateLocalFileInTestDirInEnv(env, testDirPath, FileName1, t)
 	// Create explicit dir with 1 local file.
 	operations.CreateDirectory(path.Join(testDirPath, ExplicitDirName), t)
-	_, fh2 := CreateLocalFileInTestDir(ctx, storageClient, testDirPath, fileName2, t)
+	_, fh2 := CreateLocalFileInTestDirInEnv(env, testDirPath, fileName2, t)
 	// Create implicit dir with 1 local file1 and 1 synced file.
-	CreateImplicitDir(ctx, storageClient, testDirName, t)
-	_, fh3 := CreateLocalFileInTestDir(ctx, storageClient, testDirPath, fileName3, t)
+	CreateImplicitDirInEnv(env, testDirName, t)
+	_, fh3 := CreateLocalFileInTestDirInEnv(env, testDirPath, fileName3, t)
 
 	// Recursively list mntDir/ directory.
 	err := filepath.WalkDir(testDirPath,
@@ -110,7 +108,7 @@ func TestRecursiveListingWithLocalFiles(t *testing.T) {
 			objs := operations.ReadDirectory(walkPath, t)
 
 			// Check if mntDir has correct objects.
-			if walkPath == setup.MntDir() {
+			if walkPath == env.MntDir {
 				// numberOfObjects = 3
 				operations.VerifyCountOfDirectoryEntries(3, len(objs), t)
 				operations.VerifyDirectoryEntry(objs[0], ExplicitDirName, t)
@@ -139,7 +137,7 @@ func TestRecursiveListingWithLocalFiles(t *testing.T) {
 	if err != nil {
 		t.Errorf("filepath.WalkDir() err: %v", err)
 	}
-	CloseFileAndValidateContentFromGCS(ctx, storageClient, fh1, testDirName, FileName1, "", t)
-	CloseFileAndValidateContentFromGCS(ctx, storageClient, fh2, testDirName, fileName2, "", t)
-	CloseFileAndValidateContentFromGCS(ctx, storageClient, fh3, testDirName, fileName3, "", t)
+	CloseFileAndValidateContentFromGCSInEnv(env, fh1, testDirName, FileName1, "", t)
+	CloseFileAndValidateContentFromGCSInEnv(env, fh2, testDirName, fileName2, "", t)
+	CloseFileAndValidateContentFromGCSInEnv(env, fh3, testDirName, fileName3, "", t)
 }
@@ -55,6 +55,27 @@ func (s *managedFoldersViewPermission) TestListNonEmptyManagedFolders(t *testing
 	listNonEmptyManagedFolders(t)
 }
 
+// Managed folders listed by their parent stay directories whether or not the
+// caller may look inside them.
+func (s *managedFoldersViewPermission) TestStatListedManagedFolders(t *testing.T) {
+	dirPath := path.Join(setup.MntDir(), TestDirForManagedFolderTest)
+	_, err := os.ReadDir(dirPath)
+	if err != nil {
+		t.Fatalf("Error in listing %s: %v", dirPath, err)
+	}
+
+	for _, folder := range []string{ManagedFolder1, ManagedFolder2} {
+		fi, err := os.Stat(path.Join(dirPath, folder))
+		if err != nil {
+			t.Errorf("Error in stating managed folder %s: %v", folder, err)
+			continue
+		}
+		if !fi.IsDir() {
+			t.Errorf("Managed folder %s is not a directory: mode %v", folder, fi.Mode())
+		}
+	}
+}
+
 func (s *managedFoldersViewPermission) TestCreateObjectInManagedFolder(t *testing.T) {
 	filePath := path.Join(setup.MntDir(), TestDirForManagedFolderTest, ManagedFolder2, DestFile)
 	file, err := os.Create(filePath)
@@ -0,0 +1,140 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Tests for serving a file system on a /dev/fuse that the test harness opens
+// and mounts itself, the way a container orchestrator does for an
+// unprivileged gcsfuse.
+
+package integration_test
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/canned"
+	. "github.com/jacobsa/oglematchers"
+	. "github.com/jacobsa/ogletest"
+	"golang.org/x/sys/unix"
+)
+
+////////////////////////////////////////////////////////////////////////
+// Helpers
+////////////////////////////////////////////////////////////////////////
+
+// Open /dev/fuse and mount it on t.dir, like fusermount does. This needs
+// CAP_SYS_ADMIN; ok is false if the test doesn't have it.
+func (t *GcsfuseTest) mountFuseDevice() (dev *os.File, ok bool) {
+	if os.Geteuid() != 0 {
+		return nil, false
+	}
+
+	dev, err := os.OpenFile("/dev/fuse", os.O_RDWR, 0)
+	AssertEq(nil, err)
+
+	opts := fmt.Sprintf("fd=%d,rootmode=40000,user_id=%d,group_id=%d", dev.Fd(), os.Getuid(), os.Getgid())
+	err = unix.Mount(canned.FakeBucketName, t.dir, "fuse.gcsfuse", unix.MS_NOSUID|unix.MS_NODEV, opts)
+	AssertEq(nil, err)
+
+	return dev, true
+}
+
+func (t *GcsfuseTest) expectCannedContents() {
+	contents, err := os.ReadFile(path.Join(t.dir, canned.TopLevelFile))
+	AssertEq(nil, err)
+	ExpectEq(canned.TopLevelFile_Contents, string(contents))
+}
+
+////////////////////////////////////////////////////////////////////////
+// Tests
+////////////////////////////////////////////////////////////////////////
+
+func (t *GcsfuseTest) FuseFd() {
+	dev, ok := t.mountFuseDevice()
+	if !ok {
+		return
+	}
+
+	// Hand the descriptor to gcsfuse as its fd 3, and keep no copy of it.
+	cmd := t.gcsfuseCommand([]string{
+		"--foreground",
+		"--fuse-fd=3",
+		"--log-file=/proc/self/fd/2",
+		canned.FakeBucketName,
+		t.dir,
+	},
+		nil)
+	cmd.ExtraFiles = []*os.File{dev}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	err := cmd.Start()
+	dev.Close()
+	AssertEq(nil, err)
+	defer cmd.Process.Kill()
+
+	t.expectCannedContents()
+
+	// Unmounting, which is up to the harness, should make gcsfuse exit
+	// successfully.
+	err = unix.Unmount(t.dir, 0)
+	AssertEq(nil, err)
+
+	err = cmd.Wait()
+	AssertEq(nil, err, "Output:\n%s", stderr.String())
+}
+
+func (t *GcsfuseTest) FuseSocket() {
+	dev, ok := t.mountFuseDevice()
+	if !ok {
+		return
+	}
+	defer dev.Close()
+
+	// Send the descriptor to the first client of a unix socket.
+	socketPath := filepath.Join(os.TempDir(), fmt.Sprintf("gcsfuse_test_%d.sock", os.Getpid()))
+	l, err := net.ListenUnix("unix", &net.UnixAddr{Name: socketPath, Net: "unix"})
+	AssertEq(nil, err)
+	defer l.Close()
+
+	go func() {
+		conn, err := l.AcceptUnix()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.WriteMsgUnix([]byte{0}, unix.UnixRights(int(dev.Fd())), nil)
+	}()
+
+	// The daemon receives the descriptor itself, so gcsfuse needn't stay in
+	// the foreground.
+	err = t.runGcsfuse([]string{
+		"--fuse-socket=" + socketPath,
+		canned.FakeBucketName,
+		t.dir,
+	})
+	AssertEq(nil, err)
+	defer unix.Unmount(t.dir, 0)
+
+	t.expectCannedContents()
+}
+
+func (t *GcsfuseTest) FuseFdRequiresForeground() {
+	err := t.runGcsfuse([]string{"--fuse-fd=3", canned.FakeBucketName, t.dir})
+
+	ExpectThat(err, Error(HasSubstr("fuse-fd requires foreground")))
+}
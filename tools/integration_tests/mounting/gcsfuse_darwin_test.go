@@ -23,6 +23,7 @@ import (
 	"syscall"
 
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/canned"
+	"github.com/googlecloudplatform/gcsfuse/v2/tools/util"
 	. "github.com/jacobsa/ogletest"
 )
 
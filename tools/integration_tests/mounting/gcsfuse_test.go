@@ -15,19 +15,22 @@
 package integration_test
 
 import (
+	"bufio"
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"os/exec"
 	"path"
 	"path/filepath"
-	//"runtime"
+	"runtime"
 	"syscall"
 	"testing"
 	"time"
 
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/canned"
+	mountpkg "github.com/googlecloudplatform/gcsfuse/v2/internal/mount"
 	"github.com/googlecloudplatform/gcsfuse/v2/tools/util"
 	"github.com/jacobsa/fuse/fusetesting"
 	. "github.com/jacobsa/oglematchers"
@@ -144,8 +147,6 @@ func (t *GcsfuseTest) NonExistentMountPoint() {
 	ExpectThat(err, Error(HasSubstr("blahblah")))
 }
 
-// TODO: fails
-/*
 func (t *GcsfuseTest) NonEmptyMountPoint() {
 	var err error
 
@@ -165,9 +166,65 @@ func (t *GcsfuseTest) NonEmptyMountPoint() {
 	args := []string{canned.FakeBucketName, t.dir}
 
 	err = t.runGcsfuse(args)
-	ExpectThat(err, Error(HasSubstr("exit status 1")))
+	ExpectThat(err, Error(HasSubstr("exit status 4")))
+	ExpectThat(err, Error(HasSubstr("pass --nonempty")))
+
+	// Mount over it, as asked.
+	args = []string{"--nonempty", canned.FakeBucketName, t.dir}
+
+	err = t.runGcsfuse(args)
+	AssertEq(nil, err)
+	defer util.Unmount(t.dir)
+
+	// The file is hidden by the mount.
+	_, err = os.Stat(p)
+	ExpectTrue(os.IsNotExist(err), "err: %v", err)
+}
+
+// Count the FUSE mounts on the given directory.
+func countFuseMounts(dir string) (n int) {
+	mounts, err := mountpkg.ReadMountInfo()
+	AssertEq(nil, err)
+
+	for _, m := range mounts {
+		if m.MountPoint == dir && m.IsFuse() {
+			n++
+		}
+	}
+	return
+}
+
+func (t *GcsfuseTest) StackedMount() {
+	var err error
+
+	if runtime.GOOS == "darwin" {
+		return
+	}
+
+	// Mount.
+	args := []string{canned.FakeBucketName, t.dir}
+
+	err = t.runGcsfuse(args)
+	AssertEq(nil, err)
+	defer util.Unmount(t.dir)
+
+	// Mounting again fails, rather than stacking a second mount.
+	err = t.runGcsfuse(args)
+	ExpectThat(err, Error(HasSubstr("exit status 3")))
+	ExpectThat(err, Error(HasSubstr("pass --allow-remount")))
+	ExpectEq(1, countFuseMounts(t.dir))
+
+	// Unless asked to replace the mount.
+	args = []string{"--allow-remount", canned.FakeBucketName, t.dir}
+
+	err = t.runGcsfuse(args)
+	AssertEq(nil, err)
+	ExpectEq(1, countFuseMounts(t.dir))
+
+	// The new mount works.
+	_, err = os.Stat(path.Join(t.dir, canned.TopLevelFile))
+	ExpectEq(nil, err)
 }
-*/
 
 func (t *GcsfuseTest) MountPointIsAFile() {
 	var err error
@@ -423,6 +480,44 @@ func (t *GcsfuseTest) OnlyDir_TrailingSlash() {
 	ExpectEq(len(canned.ExplicitDirFile_Contents), fi.Size())
 }
 
+func (t *GcsfuseTest) OnlyDir_MessyPrefix() {
+	var err error
+	var fi os.FileInfo
+
+	// Mount only a single directory from the bucket, with leading, trailing and
+	// repeated slashes.
+	args := []string{
+		"--only-dir",
+		"//" + path.Dir(canned.ExplicitDirFile) + "//",
+		canned.FakeBucketName,
+		t.dir,
+	}
+
+	err = t.runGcsfuse(args)
+	AssertEq(nil, err)
+	defer util.Unmount(t.dir)
+
+	// It should be as if t.dir points into the bucket's first-level directory.
+	entries, err := fusetesting.ReadDirPicky(t.dir)
+	AssertEq(nil, err)
+
+	AssertEq(1, len(entries))
+	fi = entries[0]
+	ExpectEq(path.Base(canned.ExplicitDirFile), fi.Name())
+	ExpectEq(len(canned.ExplicitDirFile_Contents), fi.Size())
+}
+
+func (t *GcsfuseTest) OnlyDir_InvalidPrefix() {
+	// Prefixes that can't be normalized fail the mount.
+	for _, dir := range []string{"./" + path.Dir(canned.ExplicitDirFile), "..", "foo "} {
+		cmd := t.gcsfuseCommand([]string{"--only-dir", dir, canned.FakeBucketName, t.dir}, nil)
+
+		output, err := cmd.CombinedOutput()
+		ExpectThat(err, Error(HasSubstr("exit status")), "%q", dir)
+		ExpectThat(string(output), HasSubstr("only-dir"), "%q", dir)
+	}
+}
+
 func (t *GcsfuseTest) OnlyDir_WithImplicitDir() {
 	var err error
 	var fi os.FileInfo
@@ -528,6 +623,76 @@ func (t *GcsfuseTest) ForegroundMode() {
 	AssertEq(nil, err)
 }
 
+func (t *GcsfuseTest) LifecycleEvents() {
+	// Have gcsfuse write its lifecycle events to a pipe it inherits as fd 3.
+	r, w, err := os.Pipe()
+	AssertEq(nil, err)
+	defer r.Close()
+
+	cmd := t.gcsfuseCommand([]string{
+		"--foreground",
+		"--lifecycle-events=/dev/fd/3",
+		canned.FakeBucketName,
+		t.dir,
+	},
+		nil)
+	cmd.ExtraFiles = []*os.File{w}
+
+	err = cmd.Start()
+	w.Close()
+	AssertEq(nil, err)
+	defer cmd.Wait()
+	defer cmd.Process.Kill()
+
+	var names []string
+	var errs []string
+	events := bufio.NewScanner(r)
+	next := func() {
+		AssertTrue(events.Scan(), "events so far: %v, error: %v", names, events.Err())
+		var e struct {
+			Event string
+			Error string
+		}
+		AssertEq(nil, json.Unmarshal(events.Bytes(), &e), "line: %s", events.Text())
+		names = append(names, e.Event)
+		errs = append(errs, e.Error)
+	}
+
+	// Wait for the mount to become ready.
+	for len(names) == 0 || names[len(names)-1] != "ready" {
+		next()
+	}
+
+	defer util.Unmount(t.dir)
+
+	// The file system should be available.
+	_, err = os.Lstat(path.Join(t.dir, canned.TopLevelFile))
+	AssertEq(nil, err)
+
+	// Interrupt it, and it should drain and unmount, then exit.
+	err = cmd.Process.Signal(os.Interrupt)
+	AssertEq(nil, err)
+	for names[len(names)-1] != "unmounted" {
+		next()
+	}
+
+	err = cmd.Wait()
+	AssertEq(nil, err)
+	AssertFalse(events.Scan(), "unexpected event: %s", events.Text())
+	ExpectThat(names, ElementsAre(
+		"config-parsed",
+		"client-created",
+		"bucket-probed",
+		"mounted",
+		"ready",
+		"draining",
+		"unmounted",
+	))
+	for i, e := range errs {
+		ExpectEq("", e, "event %q", names[i])
+	}
+}
+
 func (t *GcsfuseTest) VersionFlags() {
 	testCases := []struct {
 		args []string
@@ -0,0 +1,83 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Provides integration tests for the content type of objects written through
+// gcsfuse.
+package operations_test
+
+import (
+	"context"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/googlecloudplatform/gcsfuse/v2/tools/integration_tests/util/client"
+	"github.com/googlecloudplatform/gcsfuse/v2/tools/integration_tests/util/operations"
+	"github.com/googlecloudplatform/gcsfuse/v2/tools/integration_tests/util/setup"
+)
+
+func validateContentType(objectName string, contentType string, t *testing.T) {
+	ctx := context.Background()
+	var storageClient *storage.Client
+	closeStorageClient := client.CreateStorageClientWithTimeOut(&ctx, &storageClient, time.Minute*2)
+	defer func() {
+		err := closeStorageClient()
+		if err != nil {
+			t.Errorf("closeStorageClient failed: %v", err)
+		}
+	}()
+
+	attrs, err := client.StatObject(ctx, storageClient, objectName)
+	if err != nil {
+		t.Fatalf("Could not fetch attributes of %s: %v", objectName, err)
+	}
+	if attrs.ContentType != contentType {
+		t.Errorf("Content type of %s: expected %q, got %q", objectName, contentType, attrs.ContentType)
+	}
+}
+
+func TestContentTypeIsInferredFromExtension(t *testing.T) {
+	testDir := setup.SetupTestDirectory(DirForOperationTests)
+	testCases := []struct {
+		fileName    string
+		contentType string
+	}{
+		{fileName: "index.html", contentType: "text/html; charset=utf-8"},
+		{fileName: "data.json", contentType: "application/json"},
+		{fileName: "blob.bin", contentType: "application/octet-stream"},
+	}
+
+	for _, tc := range testCases {
+		filePath := path.Join(testDir, tc.fileName)
+		operations.CreateFileWithContent(filePath, setup.FilePermission_0600, Content, t)
+
+		validateContentType(path.Join(DirForOperationTests, tc.fileName), tc.contentType, t)
+	}
+}
+
+func TestContentTypeIsKeptOnRename(t *testing.T) {
+	testDir := setup.SetupTestDirectory(DirForOperationTests)
+	oldFilePath := path.Join(testDir, "index.html")
+	newFilePath := path.Join(testDir, "index.txt")
+	operations.CreateFileWithContent(oldFilePath, setup.FilePermission_0600, Content, t)
+
+	err := os.Rename(oldFilePath, newFilePath)
+
+	if err != nil {
+		t.Fatalf("os.Rename(%s, %s): %v", oldFilePath, newFilePath, err)
+	}
+	validateContentType(path.Join(DirForOperationTests, "index.txt"), "text/html; charset=utf-8", t)
+}
@@ -0,0 +1,60 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Provides integration tests for names too long for GCS objects.
+package operations_test
+
+import (
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/tools/integration_tests/util/setup"
+)
+
+// Touch testBucket/dirForOperationTests/aaa.../aaa.../aaa.../aaa.../aaa...,
+// over 1100 characters in all.
+func TestTouchFileWithTooLongObjectName(t *testing.T) {
+	testDir := setup.SetupTestDirectory(DirForOperationTests)
+
+	// Each component stays within the 255 bytes the kernel allows.
+	dirPath := testDir
+	component := strings.Repeat("a", 219)
+	for i := 0; i < 4; i++ {
+		dirPath = path.Join(dirPath, component)
+	}
+	err := os.MkdirAll(dirPath, setup.DirPermission_0755)
+	if err != nil {
+		t.Fatalf("Error in creating directories: %v", err)
+	}
+	filePath := path.Join(dirPath, component)
+
+	out, err := exec.Command("touch", filePath).CombinedOutput()
+
+	if err == nil {
+		t.Fatalf("touch succeeded on a name of %d characters.", len(filePath))
+	}
+	if !strings.Contains(string(out), "File name too long") {
+		t.Errorf("Unexpected output from touch: %s", out)
+	}
+	entries, err := os.ReadDir(dirPath)
+	if err != nil {
+		t.Fatalf("Error in reading directory: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("Found %d entries, expected none.", len(entries))
+	}
+}
@@ -16,8 +16,13 @@
 package operations_test
 
 import (
+	"fmt"
+	"io"
 	"os"
+	"path"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/googlecloudplatform/gcsfuse/v2/tools/integration_tests/util/operations"
 	"github.com/googlecloudplatform/gcsfuse/v2/tools/integration_tests/util/setup"
@@ -57,3 +62,73 @@ func TestReadAfterWrite(t *testing.T) {
 		}
 	}
 }
+
+func TestTailFileWhileAppendingThroughAnotherFileDescriptor(t *testing.T) {
+	const chunks = 500
+	chunk := func(i int) string { return fmt.Sprintf("line %04d\n", i) }
+	testDir := setup.SetupTestDirectory(DirForOperationTests)
+	fileName := path.Join(testDir, "tailedFile")
+	if err := os.WriteFile(fileName, nil, setup.FilePermission_0600); err != nil {
+		t.Fatalf("WriteFile at %q: %v", fileName, err)
+	}
+
+	// Open the file for appending and for reading, bypassing the kernel's page
+	// cache so that the reads reach gcsfuse.
+	writer, err := os.OpenFile(fileName, os.O_APPEND|os.O_WRONLY|operations.ODirect, setup.FilePermission_0600)
+	if err != nil {
+		t.Fatalf("Open %q for appending: %v", fileName, err)
+	}
+	defer operations.CloseFile(writer)
+	reader, err := os.OpenFile(fileName, os.O_RDONLY|operations.ODirect, 0)
+	if err != nil {
+		t.Fatalf("Open %q for reading: %v", fileName, err)
+	}
+	defer operations.CloseFile(reader)
+
+	// Append from one goroutine, syncing now and then so that the object moves
+	// through generations...
+	var expected strings.Builder
+	for i := 0; i < chunks; i++ {
+		expected.WriteString(chunk(i))
+	}
+	writeErr := make(chan error, 1)
+	go func() {
+		for i := 0; i < chunks; i++ {
+			if _, err := writer.WriteString(chunk(i)); err != nil {
+				writeErr <- fmt.Errorf("WriteString: %w", err)
+				return
+			}
+			if i%100 == 99 {
+				if err := writer.Sync(); err != nil {
+					writeErr <- fmt.Errorf("Sync: %w", err)
+					return
+				}
+			}
+		}
+		writeErr <- nil
+	}()
+
+	// ...while tailing it through the other file descriptor, which must only
+	// ever see what was appended.
+	var tailed []byte
+	buf := make([]byte, 64)
+	deadline := time.Now().Add(time.Minute)
+	for len(tailed) < expected.Len() && time.Now().Before(deadline) {
+		n, err := reader.ReadAt(buf, int64(len(tailed)))
+		if err != nil && err != io.EOF {
+			t.Fatalf("ReadAt(%d): %v", len(tailed), err)
+		}
+
+		tailed = append(tailed, buf[:n]...)
+		if !strings.HasPrefix(expected.String(), string(tailed)) {
+			t.Fatalf("Read %q, which wasn't appended.", buf[:n])
+		}
+	}
+
+	if err := <-writeErr; err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(tailed), expected.String(); got != want {
+		t.Errorf("Tailed %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Provides integration tests for copying with rsync, which reads POSIX ACLs.
+package operations_test
+
+import (
+	"os"
+	"os/exec"
+	"path"
+	"testing"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/tools/integration_tests/util/operations"
+	"github.com/googlecloudplatform/gcsfuse/v2/tools/integration_tests/util/setup"
+)
+
+const ContentInFileInRsyncTest = "This is from rsync test."
+
+func rsyncWithACLs(srcDir string, dstDir string, t *testing.T) {
+	out, err := exec.Command("rsync", "-rA", srcDir+"/", dstDir).CombinedOutput()
+	if err != nil {
+		t.Fatalf("rsync -A: %v: %s", err, out)
+	}
+}
+
+func checkRsyncedFile(filePath string, t *testing.T) {
+	content, err := operations.ReadFile(filePath)
+	if err != nil {
+		t.Fatalf("Error in reading file: %v", err)
+	}
+	if got := string(content); got != ContentInFileInRsyncTest {
+		t.Errorf("File content mismatch: got %q, want %q", got, ContentInFileInRsyncTest)
+	}
+}
+
+// Copy a local dir to testBucket/dirForOperationTests/dst and back again.
+func TestRsyncWithACLs(t *testing.T) {
+	testDir := setup.SetupTestDirectory(DirForOperationTests)
+
+	srcDir, err := os.MkdirTemp("", "rsyncSrc")
+	if err != nil {
+		t.Fatalf("Error in creating directory: %v", err)
+	}
+	defer os.RemoveAll(srcDir)
+	err = os.Mkdir(path.Join(srcDir, "dir"), setup.DirPermission_0755)
+	if err != nil {
+		t.Fatalf("Error in creating directory: %v", err)
+	}
+	operations.CreateFileWithContent(path.Join(srcDir, "dir", "file"), setup.FilePermission_0600, ContentInFileInRsyncTest, t)
+
+	// Into the mount, which has no ACLs to set.
+	mntDst := path.Join(testDir, "dst")
+	rsyncWithACLs(srcDir, mntDst, t)
+	checkRsyncedFile(path.Join(mntDst, "dir", "file"), t)
+
+	// Out of the mount, which has no ACLs to read.
+	localDst, err := os.MkdirTemp("", "rsyncDst")
+	if err != nil {
+		t.Fatalf("Error in creating directory: %v", err)
+	}
+	defer os.RemoveAll(localDst)
+	rsyncWithACLs(mntDst, localDst, t)
+	checkRsyncedFile(path.Join(localDst, "dir", "file"), t)
+}
@@ -20,7 +20,6 @@ import (
 	"os"
 	"path"
 	"reflect"
-	"syscall"
 	"testing"
 	"time"
 
@@ -152,7 +151,7 @@ func TestWriteAtRandom(t *testing.T) {
 
 	operations.CreateFileWithContent(fileName, setup.FilePermission_0600, Content, t)
 
-	f, err := os.OpenFile(fileName, os.O_WRONLY|syscall.O_DIRECT, setup.FilePermission_0600)
+	f, err := os.OpenFile(fileName, os.O_WRONLY|operations.ODirect, setup.FilePermission_0600)
 	if err != nil {
 		t.Errorf("Open file for write at random: %v", err)
 	}
@@ -212,7 +211,7 @@ func TestWriteAtFileOperationsDoesNotChangeObjectAttributes(t *testing.T) {
 	operations.CreateFileWithContent(fileName, setup.FilePermission_0600, Content, t)
 	attr1 := validateExtendedObjectAttributesNonEmpty(path.Join(DirForOperationTests, tempFileName), t)
 	// Over-write the file.
-	fh, err := os.OpenFile(fileName, os.O_WRONLY|os.O_CREATE|os.O_TRUNC|syscall.O_DIRECT, operations.FilePermission_0600)
+	fh, err := os.OpenFile(fileName, os.O_WRONLY|os.O_CREATE|os.O_TRUNC|operations.ODirect, operations.FilePermission_0600)
 	if err != nil {
 		t.Errorf("Could not open file %s after creation.", fileName)
 	}
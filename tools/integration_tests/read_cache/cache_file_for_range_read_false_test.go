@@ -15,14 +15,10 @@
 package read_cache
 
 import (
-	"context"
 	"log"
 	"sync"
 	"testing"
-	"time"
 
-	"cloud.google.com/go/storage"
-	"github.com/googlecloudplatform/gcsfuse/v2/tools/integration_tests/util/client"
 	"github.com/googlecloudplatform/gcsfuse/v2/tools/integration_tests/util/log_parser/json_parser/read_logs"
 	"github.com/googlecloudplatform/gcsfuse/v2/tools/integration_tests/util/operations"
 	"github.com/googlecloudplatform/gcsfuse/v2/tools/integration_tests/util/setup"
@@ -35,30 +31,28 @@ import (
 ////////////////////////////////////////////////////////////////////////
 
 type cacheFileForRangeReadFalseTest struct {
-	flags         []string
-	storageClient *storage.Client
-	ctx           context.Context
+	flags []string
+	env   *testEnv
 }
 
 func (s *cacheFileForRangeReadFalseTest) Setup(t *testing.T) {
-	setupForMountedDirectoryTests()
 	// Clean up the cache directory path as gcsfuse don't clean up on mounting.
-	operations.RemoveDir(cacheDirPath)
-	mountGCSFuseAndSetupTestDir(s.flags, s.ctx, s.storageClient, testDirName)
+	operations.RemoveDir(s.env.cacheDirPath)
+	s.env.mountGCSFuseAndSetupTestDir(s.flags, t)
 }
 
 func (s *cacheFileForRangeReadFalseTest) Teardown(t *testing.T) {
-	setup.UnmountGCSFuseAndDeleteLogFile(rootDir)
+	s.env.unmountGCSFuse(t)
 }
 
 ////////////////////////////////////////////////////////////////////////
 // Helpers
 ////////////////////////////////////////////////////////////////////////
 
-func readFileAsync(t *testing.T, wg *sync.WaitGroup, testFileName string, expectedOutcome **Expected) {
+func (env *testEnv) readFileAsync(t *testing.T, wg *sync.WaitGroup, testFileName string, expectedOutcome **Expected) {
 	go func() {
 		defer wg.Done()
-		*expectedOutcome = readFileAndGetExpectedOutcome(testDirPath, testFileName, true, zeroOffset, t)
+		*expectedOutcome = env.readFileAndGetExpectedOutcome(testFileName, true, zeroOffset, t)
 	}()
 }
 
@@ -67,33 +61,33 @@ func readFileAsync(t *testing.T, wg *sync.WaitGroup, testFileName string, expect
 ////////////////////////////////////////////////////////////////////////
 
 func (s *cacheFileForRangeReadFalseTest) TestRangeReadsWithCacheMiss(t *testing.T) {
-	testFileName := setupFileInTestDir(s.ctx, s.storageClient, testDirName, fileSizeForRangeRead, t)
+	testFileName := s.env.setupFileInTestDir(fileSizeForRangeRead, t)
 
 	// Do a random read on file and validate from gcs.
-	expectedOutcome1 := readChunkAndValidateObjectContentsFromGCS(s.ctx, s.storageClient, testFileName, offsetForFirstRangeRead, t)
+	expectedOutcome1 := s.env.readChunkAndValidateObjectContentsFromGCS(testFileName, offsetForFirstRangeRead, t)
 	// Read file again from offset 1000 and validate from gcs.
-	expectedOutcome2 := readChunkAndValidateObjectContentsFromGCS(s.ctx, s.storageClient, testFileName, offsetForSecondRangeRead, t)
+	expectedOutcome2 := s.env.readChunkAndValidateObjectContentsFromGCS(testFileName, offsetForSecondRangeRead, t)
 
-	structuredReadLogs := read_logs.GetStructuredLogsSortedByTimestamp(setup.LogFile(), t)
+	structuredReadLogs := read_logs.GetStructuredLogsSortedByTimestamp(s.env.LogFile, t)
 	validate(expectedOutcome1, structuredReadLogs[0], false, false, 1, t)
 	validate(expectedOutcome2, structuredReadLogs[1], false, false, 1, t)
-	validateFileIsNotCached(testFileName, t)
+	s.env.validateFileIsNotCached(testFileName, t)
 }
 
 func (s *cacheFileForRangeReadFalseTest) TestConcurrentReads_ReadIsTreatedNonSequentialAfterFileIsRemovedFromCache(t *testing.T) {
 	var testFileNames [2]string
 	var expectedOutcome [2]*Expected
-	testFileNames[0] = setupFileInTestDir(s.ctx, s.storageClient, testDirName, fileSizeForRangeRead, t)
-	testFileNames[1] = setupFileInTestDir(s.ctx, s.storageClient, testDirName, fileSizeForRangeRead, t)
+	testFileNames[0] = s.env.setupFileInTestDir(fileSizeForRangeRead, t)
+	testFileNames[1] = s.env.setupFileInTestDir(fileSizeForRangeRead, t)
 
 	var wg sync.WaitGroup
 	for i := 0; i < 2; i++ {
 		wg.Add(1)
-		readFileAsync(t, &wg, testFileNames[i], &expectedOutcome[i])
+		s.env.readFileAsync(t, &wg, testFileNames[i], &expectedOutcome[i])
 	}
 	wg.Wait()
 
-	structuredReadLogs := read_logs.GetStructuredLogsSortedByTimestamp(setup.LogFile(), t)
+	structuredReadLogs := read_logs.GetStructuredLogsSortedByTimestamp(s.env.LogFile, t)
 	// Goroutine execution order isn't guaranteed.
 	// If the object name in expected outcome doesn't align with the logs, swap
 	// the expected outcome objects and file names at positions 0 and 1.
@@ -110,8 +104,8 @@ func (s *cacheFileForRangeReadFalseTest) TestConcurrentReads_ReadIsTreatedNonSeq
 	ogletest.ExpectEq(true, structuredReadLogs[1].Chunks[randomReadChunkCount-1].IsSequential)
 	ogletest.ExpectEq(true, structuredReadLogs[1].Chunks[randomReadChunkCount-1].CacheHit)
 
-	validateFileIsNotCached(testFileNames[0], t)
-	validateFileInCacheDirectory(testFileNames[1], fileSizeForRangeRead, s.ctx, s.storageClient, t)
+	s.env.validateFileIsNotCached(testFileNames[0], t)
+	s.env.validateFileInCacheDirectory(testFileNames[1], fileSizeForRangeRead, t)
 }
 
 ////////////////////////////////////////////////////////////////////////
@@ -119,15 +113,8 @@ func (s *cacheFileForRangeReadFalseTest) TestConcurrentReads_ReadIsTreatedNonSeq
 ////////////////////////////////////////////////////////////////////////
 
 func TestCacheFileForRangeReadFalseTest(t *testing.T) {
-	ts := &cacheFileForRangeReadFalseTest{ctx: context.Background()}
-	// Create storage client before running tests.
-	closeStorageClient := client.CreateStorageClientWithTimeOut(&ts.ctx, &ts.storageClient, 15*time.Minute)
-	defer func() {
-		err := closeStorageClient()
-		if err != nil {
-			t.Errorf("closeStorageClient failed: %v", err)
-		}
-	}()
+	setup.Parallel(t)
+	ts := &cacheFileForRangeReadFalseTest{env: newTestEnv(t, "CacheFileForRangeReadFalse")}
 
 	// Run tests for mounted directory if the flag is set.
 	if setup.AreBothMountedDirectoryAndTestBucketFlagsSet() {
@@ -141,7 +128,7 @@ func TestCacheFileForRangeReadFalseTest(t *testing.T) {
 		{"--implicit-dirs=false"},
 	}
 	setup.AppendFlagsToAllFlagsInTheFlagsSet(&flagsSet,
-		"--config-file="+createConfigFile(cacheCapacityForRangeReadTestInMiB, false, configFileName))
+		"--config-file="+ts.env.createConfigFile(cacheCapacityForRangeReadTestInMiB, false, configFileName))
 	setup.AppendFlagsToAllFlagsInTheFlagsSet(&flagsSet, "--o=ro", "")
 
 	// Run tests.
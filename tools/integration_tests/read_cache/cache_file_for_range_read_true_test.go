@@ -15,13 +15,10 @@
 package read_cache
 
 import (
-	"context"
 	"log"
 	"testing"
 	"time"
 
-	"cloud.google.com/go/storage"
-	"github.com/googlecloudplatform/gcsfuse/v2/tools/integration_tests/util/client"
 	"github.com/googlecloudplatform/gcsfuse/v2/tools/integration_tests/util/log_parser/json_parser/read_logs"
 	"github.com/googlecloudplatform/gcsfuse/v2/tools/integration_tests/util/operations"
 	"github.com/googlecloudplatform/gcsfuse/v2/tools/integration_tests/util/setup"
@@ -33,20 +30,18 @@ import (
 ////////////////////////////////////////////////////////////////////////
 
 type cacheFileForRangeReadTrueTest struct {
-	flags         []string
-	storageClient *storage.Client
-	ctx           context.Context
+	flags []string
+	env   *testEnv
 }
 
 func (s *cacheFileForRangeReadTrueTest) Setup(t *testing.T) {
-	setupForMountedDirectoryTests()
 	// Clean up the cache directory path as gcsfuse don't clean up on mounting.
-	operations.RemoveDir(cacheDirPath)
-	mountGCSFuseAndSetupTestDir(s.flags, s.ctx, s.storageClient, testDirName)
+	operations.RemoveDir(s.env.cacheDirPath)
+	s.env.mountGCSFuseAndSetupTestDir(s.flags, t)
 }
 
 func (s *cacheFileForRangeReadTrueTest) Teardown(t *testing.T) {
-	setup.UnmountGCSFuseAndDeleteLogFile(rootDir)
+	s.env.unmountGCSFuse(t)
 }
 
 ////////////////////////////////////////////////////////////////////////
@@ -54,22 +49,22 @@ func (s *cacheFileForRangeReadTrueTest) Teardown(t *testing.T) {
 ////////////////////////////////////////////////////////////////////////
 
 func (s *cacheFileForRangeReadTrueTest) TestRangeReadsWithCacheHit(t *testing.T) {
-	testFileName := setupFileInTestDir(s.ctx, s.storageClient, testDirName, fileSizeForRangeRead, t)
+	testFileName := s.env.setupFileInTestDir(fileSizeForRangeRead, t)
 
 	// Do a random read on file and validate from gcs.
-	expectedOutcome1 := readChunkAndValidateObjectContentsFromGCS(s.ctx, s.storageClient, testFileName, offsetForFirstRangeRead, t)
+	expectedOutcome1 := s.env.readChunkAndValidateObjectContentsFromGCS(testFileName, offsetForFirstRangeRead, t)
 	// Wait for the cache to propagate the updates before proceeding to get cache hit.
 	time.Sleep(2 * time.Second)
 	// Read file again from zeroOffset 1000 and validate from gcs.
-	expectedOutcome2 := readChunkAndValidateObjectContentsFromGCS(s.ctx, s.storageClient, testFileName, offsetForSecondRangeRead, t)
+	expectedOutcome2 := s.env.readChunkAndValidateObjectContentsFromGCS(testFileName, offsetForSecondRangeRead, t)
 
-	structuredReadLogs := read_logs.GetStructuredLogsSortedByTimestamp(setup.LogFile(), t)
+	structuredReadLogs := read_logs.GetStructuredLogsSortedByTimestamp(s.env.LogFile, t)
 	validate(expectedOutcome1, structuredReadLogs[0], false, false, 1, t)
 	validate(expectedOutcome2, structuredReadLogs[1], false, true, 1, t)
 	// Validate cached content with gcs.
-	validateFileInCacheDirectory(testFileName, fileSizeForRangeRead, s.ctx, s.storageClient, t)
+	s.env.validateFileInCacheDirectory(testFileName, fileSizeForRangeRead, t)
 	// Validate cache size within limit.
-	validateCacheSizeWithinLimit(cacheCapacityForRangeReadTestInMiB, t)
+	s.env.validateCacheSizeWithinLimit(cacheCapacityForRangeReadTestInMiB, t)
 }
 
 ////////////////////////////////////////////////////////////////////////
@@ -77,15 +72,8 @@ func (s *cacheFileForRangeReadTrueTest) TestRangeReadsWithCacheHit(t *testing.T)
 ////////////////////////////////////////////////////////////////////////
 
 func TestCacheFileForRangeReadTrueTest(t *testing.T) {
-	ts := &cacheFileForRangeReadTrueTest{ctx: context.Background()}
-	// Create storage client before running tests.
-	closeStorageClient := client.CreateStorageClientWithTimeOut(&ts.ctx, &ts.storageClient, 15*time.Minute)
-	defer func() {
-		err := closeStorageClient()
-		if err != nil {
-			t.Errorf("closeStorageClient failed: %v", err)
-		}
-	}()
+	setup.Parallel(t)
+	ts := &cacheFileForRangeReadTrueTest{env: newTestEnv(t, "CacheFileForRangeReadTrue")}
 
 	// Run tests for mounted directory if the flag is set.
 	if setup.AreBothMountedDirectoryAndTestBucketFlagsSet() {
@@ -99,7 +87,7 @@ func TestCacheFileForRangeReadTrueTest(t *testing.T) {
 		{"--implicit-dirs=false"},
 	}
 	setup.AppendFlagsToAllFlagsInTheFlagsSet(&flagsSet,
-		"--config-file="+createConfigFile(cacheCapacityForRangeReadTestInMiB, true, configFileName))
+		"--config-file="+ts.env.createConfigFile(cacheCapacityForRangeReadTestInMiB, true, configFileName))
 	setup.AppendFlagsToAllFlagsInTheFlagsSet(&flagsSet, "--o=ro", "")
 
 	// Run tests.
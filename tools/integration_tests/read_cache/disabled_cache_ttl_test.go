@@ -15,15 +15,11 @@
 package read_cache
 
 import (
-	"context"
 	"log"
 	"testing"
-	"time"
 
-	"github.com/googlecloudplatform/gcsfuse/v2/tools/integration_tests/util/client"
 	"github.com/googlecloudplatform/gcsfuse/v2/tools/integration_tests/util/operations"
 
-	"cloud.google.com/go/storage"
 	"github.com/googlecloudplatform/gcsfuse/v2/tools/integration_tests/util/log_parser/json_parser/read_logs"
 	"github.com/googlecloudplatform/gcsfuse/v2/tools/integration_tests/util/setup"
 	"github.com/googlecloudplatform/gcsfuse/v2/tools/integration_tests/util/test_setup"
@@ -34,20 +30,18 @@ import (
 ////////////////////////////////////////////////////////////////////////
 
 type disabledCacheTTLTest struct {
-	flags         []string
-	storageClient *storage.Client
-	ctx           context.Context
+	flags []string
+	env   *testEnv
 }
 
 func (s *disabledCacheTTLTest) Setup(t *testing.T) {
-	setupForMountedDirectoryTests()
 	// Clean up the cache directory path as gcsfuse don't clean up on mounting.
-	operations.RemoveDir(cacheDirPath)
-	mountGCSFuseAndSetupTestDir(s.flags, s.ctx, s.storageClient, testDirName)
+	operations.RemoveDir(s.env.cacheDirPath)
+	s.env.mountGCSFuseAndSetupTestDir(s.flags, t)
 }
 
 func (s *disabledCacheTTLTest) Teardown(t *testing.T) {
-	setup.UnmountGCSFuseAndDeleteLogFile(rootDir)
+	s.env.unmountGCSFuse(t)
 }
 
 ////////////////////////////////////////////////////////////////////////
@@ -55,19 +49,19 @@ func (s *disabledCacheTTLTest) Teardown(t *testing.T) {
 ////////////////////////////////////////////////////////////////////////
 
 func (s *disabledCacheTTLTest) TestReadAfterObjectUpdateIsCacheMiss(t *testing.T) {
-	testFileName := setupFileInTestDir(s.ctx, s.storageClient, testDirName, fileSize, t)
+	testFileName := s.env.setupFileInTestDir(fileSize, t)
 
 	// Read file 1st time.
-	expectedOutcome1 := readFileAndValidateCacheWithGCS(s.ctx, s.storageClient, testFileName, fileSize, true, t)
+	expectedOutcome1 := s.env.readFileAndValidateCacheWithGCS(testFileName, fileSize, true, t)
 	// Modify the file.
-	modifyFile(s.ctx, s.storageClient, testFileName, t)
+	s.env.modifyFile(testFileName, t)
 	// Read same file again immediately. New content should be served as cache ttl is 0.
-	expectedOutcome2 := readFileAndValidateCacheWithGCS(s.ctx, s.storageClient, testFileName, smallContentSize, true, t)
+	expectedOutcome2 := s.env.readFileAndValidateCacheWithGCS(testFileName, smallContentSize, true, t)
 	// Read the same file again. The data should be served from cache.
-	expectedOutcome3 := readFileAndValidateCacheWithGCS(s.ctx, s.storageClient, testFileName, smallContentSize, true, t)
+	expectedOutcome3 := s.env.readFileAndValidateCacheWithGCS(testFileName, smallContentSize, true, t)
 
 	// Parse the log file and validate cache hit or miss from the structured logs.
-	structuredReadLogs := read_logs.GetStructuredLogsSortedByTimestamp(setup.LogFile(), t)
+	structuredReadLogs := read_logs.GetStructuredLogsSortedByTimestamp(s.env.LogFile, t)
 	validate(expectedOutcome1, structuredReadLogs[0], true, false, chunksRead, t)
 	validate(expectedOutcome2, structuredReadLogs[1], true, false, chunksReadAfterUpdate, t)
 	validate(expectedOutcome3, structuredReadLogs[2], true, true, chunksReadAfterUpdate, t)
@@ -78,15 +72,8 @@ func (s *disabledCacheTTLTest) TestReadAfterObjectUpdateIsCacheMiss(t *testing.T
 ////////////////////////////////////////////////////////////////////////
 
 func TestDisabledCacheTTLTest(t *testing.T) {
-	ts := &disabledCacheTTLTest{ctx: context.Background()}
-	// Create storage client before running tests.
-	closeStorageClient := client.CreateStorageClientWithTimeOut(&ts.ctx, &ts.storageClient, 15*time.Minute)
-	defer func() {
-		err := closeStorageClient()
-		if err != nil {
-			t.Errorf("closeStorageClient failed: %v", err)
-		}
-	}()
+	setup.Parallel(t)
+	ts := &disabledCacheTTLTest{env: newTestEnv(t, "DisabledCacheTTL")}
 
 	// Run tests for mounted directory if the flag is set.
 	if setup.AreBothMountedDirectoryAndTestBucketFlagsSet() {
@@ -99,7 +86,7 @@ func TestDisabledCacheTTLTest(t *testing.T) {
 		{"--implicit-dirs=true"},
 		{"--implicit-dirs=false"},
 	}
-	setup.AppendFlagsToAllFlagsInTheFlagsSet(&flagsSet, "--config-file="+createConfigFile(cacheCapacityInMB, false, configFileName))
+	setup.AppendFlagsToAllFlagsInTheFlagsSet(&flagsSet, "--config-file="+ts.env.createConfigFile(cacheCapacityInMB, false, configFileName))
 	setup.AppendFlagsToAllFlagsInTheFlagsSet(&flagsSet, "--stat-cache-ttl=0s")
 	setup.AppendFlagsToAllFlagsInTheFlagsSet(&flagsSet, "--o=ro", "")
 
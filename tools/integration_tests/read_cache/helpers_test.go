@@ -15,16 +15,15 @@
 package read_cache
 
 import (
-	"context"
 	"log"
 	"os"
 	"path"
 	"strings"
-	"syscall"
 	"testing"
 	"time"
 
 	"cloud.google.com/go/storage"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/util"
 	"github.com/googlecloudplatform/gcsfuse/v2/tools/integration_tests/util/client"
 	"github.com/googlecloudplatform/gcsfuse/v2/tools/integration_tests/util/log_parser/json_parser/read_logs"
 	"github.com/googlecloudplatform/gcsfuse/v2/tools/integration_tests/util/operations"
@@ -40,26 +39,26 @@ type Expected struct {
 	content               string
 }
 
-func readFileAndGetExpectedOutcome(testDirPath, fileName string, readFullFile bool, offset int64, t *testing.T) *Expected {
+func (env *testEnv) readFileAndGetExpectedOutcome(fileName string, readFullFile bool, offset int64, t *testing.T) *Expected {
 	expected := &Expected{
 		StartTimeStampSeconds: time.Now().Unix(),
-		BucketName:            setup.TestBucket(),
-		ObjectName:            path.Join(testDirName, fileName),
+		BucketName:            env.Bucket,
+		ObjectName:            path.Join(env.testDirName, fileName),
 	}
-	if setup.DynamicBucketMounted() != "" {
-		expected.BucketName = setup.DynamicBucketMounted()
+	if env.DynamicBucket != "" {
+		expected.BucketName = env.DynamicBucket
 	}
 
 	var content []byte
 	var err error
 
 	if readFullFile {
-		content, err = operations.ReadFileSequentially(path.Join(testDirPath, fileName), chunkSizeToRead)
+		content, err = operations.ReadFileSequentially(path.Join(env.testDirPath, fileName), chunkSizeToRead)
 		if err != nil {
 			t.Errorf("Failed to read file sequentially: %v", err)
 		}
 	} else {
-		content, err = operations.ReadChunkFromFile(path.Join(testDirPath, fileName), chunkSizeToRead, offset, os.O_RDONLY|syscall.O_DIRECT)
+		content, err = operations.ReadChunkFromFile(path.Join(env.testDirPath, fileName), chunkSizeToRead, offset, os.O_RDONLY|operations.ODirect)
 		if err != nil {
 			t.Errorf("Failed to read random file chunk: %v", err)
 		}
@@ -98,17 +97,26 @@ func validate(expected *Expected, logEntry *read_logs.StructuredReadLogEntry,
 	}
 }
 
-func getCachedFilePath(fileName string) string {
-	bucketName := setup.TestBucket()
-	if setup.DynamicBucketMounted() != "" {
-		bucketName = setup.DynamicBucketMounted()
+// validateCacheValidation checks how the first read of the handle of
+// logEntry from the file cache validated the object's generation.
+func validateCacheValidation(logEntry *read_logs.StructuredReadLogEntry, expected string, t *testing.T) {
+	if logEntry.Chunks[0].Validation != expected {
+		t.Errorf("Expected validation: %s, Got from logs: %s", expected, logEntry.Chunks[0].Validation)
 	}
-	return path.Join(cacheDirPath, cacheSubDirectoryName, bucketName, testDirName, fileName)
 }
 
-func validateFileSizeInCacheDirectory(fileName string, filesize int64, t *testing.T) {
+func (env *testEnv) getCachedFilePath(fileName string) string {
+	bucketName := env.Bucket
+	if env.DynamicBucket != "" {
+		bucketName = env.DynamicBucket
+	}
+	objectPath := util.GetObjectPath(bucketName, path.Join(env.testDirName, fileName))
+	return util.GetDownloadPath(path.Join(env.cacheDirPath, cacheSubDirectoryName), objectPath)
+}
+
+func (env *testEnv) validateFileSizeInCacheDirectory(fileName string, filesize int64, t *testing.T) {
 	// Validate that the file is present in cache location.
-	expectedPathOfCachedFile := getCachedFilePath(fileName)
+	expectedPathOfCachedFile := env.getCachedFilePath(fileName)
 	fileInfo, err := operations.StatFile(expectedPathOfCachedFile)
 	if err != nil {
 		t.Errorf("Failed to find cached file %s: %v", expectedPathOfCachedFile, err)
@@ -119,96 +127,92 @@ func validateFileSizeInCacheDirectory(fileName string, filesize int64, t *testin
 	}
 }
 
-func validateFileInCacheDirectory(fileName string, filesize int64, ctx context.Context, storageClient *storage.Client, t *testing.T) {
-	validateFileSizeInCacheDirectory(fileName, filesize, t)
+func (env *testEnv) validateFileInCacheDirectory(fileName string, filesize int64, t *testing.T) {
+	env.validateFileSizeInCacheDirectory(fileName, filesize, t)
 	// Validate CRC of cached file matches GCS CRC.
-	cachedFilePath := getCachedFilePath(fileName)
+	cachedFilePath := env.getCachedFilePath(fileName)
 	crc32ValueOfCachedFile, err := operations.CalculateFileCRC32(cachedFilePath)
 	if err != nil {
 		t.Errorf("CalculateFileCRC32 Failed: %v", err)
 	}
-	client.ValidateCRCWithGCS(crc32ValueOfCachedFile, path.Join(testDirName, fileName), ctx, storageClient, t)
+	client.ValidateCRCWithGCSInEnv(env.TestEnv, crc32ValueOfCachedFile, path.Join(env.testDirName, fileName), t)
 }
 
-func validateFileIsNotCached(fileName string, t *testing.T) {
+func (env *testEnv) validateFileIsNotCached(fileName string, t *testing.T) {
 	// Validate that the file is not present in cache location.
-	expectedPathOfCachedFile := getCachedFilePath(fileName)
+	expectedPathOfCachedFile := env.getCachedFilePath(fileName)
 	_, err := operations.StatFile(expectedPathOfCachedFile)
 	if err == nil {
 		t.Errorf("File %s found in cache directory", expectedPathOfCachedFile)
 	}
 }
 
-func remountGCSFuse(flags []string, t *testing.T) {
-	setup.SetMntDir(rootDir)
-	setup.UnmountGCSFuseAndDeleteLogFile(rootDir)
-
-	setup.MountGCSFuseWithGivenMountFunc(flags, mountFunc)
-	setup.SetMntDir(mountDir)
+func (env *testEnv) remountGCSFuse(flags []string, t *testing.T) {
+	env.unmountGCSFuse(t)
+	if err := env.MountGCSFuse(flags, mountFunc); err != nil {
+		t.Fatal(err)
+	}
 }
 
-func readFileAndValidateCacheWithGCS(ctx context.Context, storageClient *storage.Client,
-	filename string, fileSize int64, checkCacheSize bool, t *testing.T) (expectedOutcome *Expected) {
+func (env *testEnv) readFileAndValidateCacheWithGCS(filename string, fileSize int64, checkCacheSize bool, t *testing.T) (expectedOutcome *Expected) {
 	// Read file via gcsfuse mount.
-	expectedOutcome = readFileAndGetExpectedOutcome(testDirPath, filename, true, zeroOffset, t)
+	expectedOutcome = env.readFileAndGetExpectedOutcome(filename, true, zeroOffset, t)
 	// Validate cached content with gcs.
-	validateFileInCacheDirectory(filename, fileSize, ctx, storageClient, t)
+	env.validateFileInCacheDirectory(filename, fileSize, t)
 	if checkCacheSize {
 		// Validate cache size within limit.
-		validateCacheSizeWithinLimit(cacheCapacityInMB, t)
+		env.validateCacheSizeWithinLimit(cacheCapacityInMB, t)
 	}
 	// Validate CRC32 of content read via gcsfuse with CRC32 value on gcs.
 	gotCRC32Value, err := operations.CalculateCRC32(strings.NewReader(expectedOutcome.content))
 	if err != nil {
 		t.Errorf("CalculateCRC32 Failed: %v", err)
 	}
-	client.ValidateCRCWithGCS(gotCRC32Value, path.Join(testDirName, filename), ctx, storageClient, t)
+	client.ValidateCRCWithGCSInEnv(env.TestEnv, gotCRC32Value, path.Join(env.testDirName, filename), t)
 
 	return expectedOutcome
 }
 
-func readChunkAndValidateObjectContentsFromGCS(ctx context.Context, storageClient *storage.Client,
-	filename string, offset int64, t *testing.T) (expectedOutcome *Expected) {
+func (env *testEnv) readChunkAndValidateObjectContentsFromGCS(filename string, offset int64, t *testing.T) (expectedOutcome *Expected) {
 	// Read file via gcsfuse mount.
-	expectedOutcome = readFileAndGetExpectedOutcome(testDirPath, filename, false, offset, t)
+	expectedOutcome = env.readFileAndGetExpectedOutcome(filename, false, offset, t)
 	// Validate content read via gcsfuse with gcs.
-	client.ValidateObjectChunkFromGCS(ctx, storageClient, testDirName, filename, offset, chunkSizeToRead,
+	client.ValidateObjectChunkFromGCSInEnv(env.TestEnv, env.testDirName, filename, offset, chunkSizeToRead,
 		expectedOutcome.content, t)
 
 	return expectedOutcome
 }
 
-func readFileAndValidateFileIsNotCached(ctx context.Context, storageClient *storage.Client,
-	filename string, readFullFile bool, offset int64, t *testing.T) (expectedOutcome *Expected) {
+func (env *testEnv) readFileAndValidateFileIsNotCached(filename string, readFullFile bool, offset int64, t *testing.T) (expectedOutcome *Expected) {
 	// Read file via gcsfuse mount.
-	expectedOutcome = readFileAndGetExpectedOutcome(testDirPath, filename, readFullFile, offset, t)
+	expectedOutcome = env.readFileAndGetExpectedOutcome(filename, readFullFile, offset, t)
 	// Validate that the file is not cached.
-	validateFileIsNotCached(filename, t)
+	env.validateFileIsNotCached(filename, t)
 	// validate the content read matches the content on GCS.
 	if readFullFile {
-		client.ValidateObjectContentsFromGCS(ctx, storageClient, testDirName, filename,
+		client.ValidateObjectContentsFromGCSInEnv(env.TestEnv, env.testDirName, filename,
 			expectedOutcome.content, t)
 	} else {
-		client.ValidateObjectChunkFromGCS(ctx, storageClient, testDirName, filename,
+		client.ValidateObjectChunkFromGCSInEnv(env.TestEnv, env.testDirName, filename,
 			offset, chunkSizeToRead, expectedOutcome.content, t)
 	}
 	return expectedOutcome
 }
 
-func modifyFile(ctx context.Context, storageClient *storage.Client, testFileName string, t *testing.T) {
-	objectName := path.Join(testDirName, testFileName)
+func (env *testEnv) modifyFile(testFileName string, t *testing.T) {
+	objectName := path.Join(env.testDirName, testFileName)
 	smallContent, err := operations.GenerateRandomData(smallContentSize)
 	if err != nil {
 		t.Errorf("Could not generate random data to modify file: %v", err)
 	}
-	err = client.WriteToObject(ctx, storageClient, objectName, string(smallContent), storage.Conditions{})
+	err = client.WriteToObjectInEnv(env.TestEnv, objectName, string(smallContent), storage.Conditions{})
 	if err != nil {
 		t.Errorf("Could not modify object %s: %v", objectName, err)
 	}
 }
 
-func validateCacheSizeWithinLimit(cacheCapacity int64, t *testing.T) {
-	cacheSize, err := operations.DirSizeMiB(cacheDirPath)
+func (env *testEnv) validateCacheSizeWithinLimit(cacheCapacity int64, t *testing.T) {
+	cacheSize, err := operations.DirSizeMiB(env.cacheDirPath)
 	if err != nil {
 		t.Errorf("Error in getting cache size: %v", cacheSize)
 	}
@@ -217,15 +221,15 @@ func validateCacheSizeWithinLimit(cacheCapacity int64, t *testing.T) {
 	}
 }
 
-func setupFileInTestDir(ctx context.Context, storageClient *storage.Client, testDirName string, fileSize int64, t *testing.T) (fileName string) {
+func (env *testEnv) setupFileInTestDir(fileSize int64, t *testing.T) (fileName string) {
 	testFileName := testFileName + setup.GenerateRandomString(testFileNameSuffixLength)
-	client.SetupFileInTestDirectory(ctx, storageClient, testDirName, testFileName, fileSize, t)
+	client.SetupFileInTestDirectoryInEnv(env.TestEnv, env.testDirName, testFileName, fileSize, t)
 
 	return testFileName
 }
 
-func runTestsOnlyForDynamicMount(t *testing.T) {
-	if !strings.Contains(setup.MntDir(), setup.TestBucket()) {
+func (env *testEnv) runTestsOnlyForDynamicMount(t *testing.T) {
+	if env.DynamicBucket == "" {
 		log.Println("This test will run only for dynamic mounting...")
 		t.SkipNow()
 	}
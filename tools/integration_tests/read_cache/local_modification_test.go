@@ -15,14 +15,10 @@
 package read_cache
 
 import (
-	"context"
 	"log"
 	"path"
 	"testing"
-	"time"
 
-	"cloud.google.com/go/storage"
-	"github.com/googlecloudplatform/gcsfuse/v2/tools/integration_tests/util/client"
 	"github.com/googlecloudplatform/gcsfuse/v2/tools/integration_tests/util/log_parser/json_parser/read_logs"
 	"github.com/googlecloudplatform/gcsfuse/v2/tools/integration_tests/util/operations"
 	"github.com/googlecloudplatform/gcsfuse/v2/tools/integration_tests/util/setup"
@@ -33,20 +29,18 @@ import (
 // Boilerplate
 // //////////////////////////////////////////////////////////////////////
 type localModificationTest struct {
-	flags         []string
-	storageClient *storage.Client
-	ctx           context.Context
+	flags []string
+	env   *testEnv
 }
 
 func (s *localModificationTest) Setup(t *testing.T) {
-	setupForMountedDirectoryTests()
 	// Clean up the cache directory path as gcsfuse don't clean up on mounting.
-	operations.RemoveDir(cacheDirPath)
-	mountGCSFuseAndSetupTestDir(s.flags, s.ctx, s.storageClient, testDirName)
+	operations.RemoveDir(s.env.cacheDirPath)
+	s.env.mountGCSFuseAndSetupTestDir(s.flags, t)
 }
 
 func (s *localModificationTest) Teardown(t *testing.T) {
-	setup.UnmountGCSFuseAndDeleteLogFile(rootDir)
+	s.env.unmountGCSFuse(t)
 }
 
 ////////////////////////////////////////////////////////////////////////
@@ -54,25 +48,25 @@ func (s *localModificationTest) Teardown(t *testing.T) {
 ////////////////////////////////////////////////////////////////////////
 
 func (s *localModificationTest) TestReadAfterLocalGCSFuseWriteIsCacheMiss(t *testing.T) {
-	testFileName := testDirName + setup.GenerateRandomString(testFileNameSuffixLength)
-	operations.CreateFileOfSize(fileSize, path.Join(testDirPath, testFileName), t)
+	testFileName := s.env.testDirName + setup.GenerateRandomString(testFileNameSuffixLength)
+	operations.CreateFileOfSize(fileSize, path.Join(s.env.testDirPath, testFileName), t)
 
 	// Read file 1st time.
-	expectedOutcome1 := readFileAndValidateCacheWithGCS(s.ctx, s.storageClient, testFileName, fileSize, true, t)
+	expectedOutcome1 := s.env.readFileAndValidateCacheWithGCS(testFileName, fileSize, true, t)
 	// Append data in the same file to change object generation.
 	smallContent, err := operations.GenerateRandomData(smallContentSize)
 	if err != nil {
 		t.Errorf("TestReadAfterLocalGCSFuseWriteIsCacheMiss: could not generate randomm data: %v", err)
 	}
-	err = operations.WriteFileInAppendMode(path.Join(testDirPath, testFileName), string(smallContent))
+	err = operations.WriteFileInAppendMode(path.Join(s.env.testDirPath, testFileName), string(smallContent))
 	if err != nil {
 		t.Errorf("Error in appending data in file: %v", err)
 	}
 	// Read file 2nd time.
-	expectedOutcome2 := readFileAndValidateCacheWithGCS(s.ctx, s.storageClient, testFileName, fileSize+smallContentSize, true, t)
+	expectedOutcome2 := s.env.readFileAndValidateCacheWithGCS(testFileName, fileSize+smallContentSize, true, t)
 
 	// Parse the log file and validate cache hit or miss from the structured logs.
-	structuredReadLogs := read_logs.GetStructuredLogsSortedByTimestamp(setup.LogFile(), t)
+	structuredReadLogs := read_logs.GetStructuredLogsSortedByTimestamp(s.env.LogFile, t)
 	validate(expectedOutcome1, structuredReadLogs[0], true, false, chunksRead, t)
 	validate(expectedOutcome2, structuredReadLogs[1], true, false, chunksRead+1, t)
 }
@@ -82,15 +76,8 @@ func (s *localModificationTest) TestReadAfterLocalGCSFuseWriteIsCacheMiss(t *tes
 ////////////////////////////////////////////////////////////////////////
 
 func TestLocalModificationTest(t *testing.T) {
-	ts := &localModificationTest{ctx: context.Background()}
-	// Create storage client before running tests.
-	closeStorageClient := client.CreateStorageClientWithTimeOut(&ts.ctx, &ts.storageClient, 15*time.Minute)
-	defer func() {
-		err := closeStorageClient()
-		if err != nil {
-			t.Errorf("closeStorageClient failed: %v", err)
-		}
-	}()
+	setup.Parallel(t)
+	ts := &localModificationTest{env: newTestEnv(t, "LocalModification")}
 
 	// Run tests for mounted directory if the flag is set.
 	if setup.AreBothMountedDirectoryAndTestBucketFlagsSet() {
@@ -103,7 +90,7 @@ func TestLocalModificationTest(t *testing.T) {
 		{"--implicit-dirs=true"},
 		{"--implicit-dirs=false"},
 	}
-	setup.AppendFlagsToAllFlagsInTheFlagsSet(&flagsSet, "--config-file="+createConfigFile(cacheCapacityInMB, false, configFileName))
+	setup.AppendFlagsToAllFlagsInTheFlagsSet(&flagsSet, "--config-file="+ts.env.createConfigFile(cacheCapacityInMB, false, configFileName))
 
 	// Run tests.
 	for _, flags := range flagsSet {
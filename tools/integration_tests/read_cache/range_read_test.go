@@ -15,15 +15,12 @@
 package read_cache
 
 import (
-	"context"
 	"log"
 	"testing"
 	"time"
 
-	"github.com/googlecloudplatform/gcsfuse/v2/tools/integration_tests/util/client"
 	"github.com/googlecloudplatform/gcsfuse/v2/tools/integration_tests/util/operations"
 
-	"cloud.google.com/go/storage"
 	"github.com/googlecloudplatform/gcsfuse/v2/tools/integration_tests/util/log_parser/json_parser/read_logs"
 	"github.com/googlecloudplatform/gcsfuse/v2/tools/integration_tests/util/setup"
 	"github.com/googlecloudplatform/gcsfuse/v2/tools/integration_tests/util/test_setup"
@@ -34,20 +31,18 @@ import (
 ////////////////////////////////////////////////////////////////////////
 
 type rangeReadTest struct {
-	flags         []string
-	storageClient *storage.Client
-	ctx           context.Context
+	flags []string
+	env   *testEnv
 }
 
 func (s *rangeReadTest) Setup(t *testing.T) {
-	setupForMountedDirectoryTests()
 	// Clean up the cache directory path as gcsfuse don't clean up on mounting.
-	operations.RemoveDir(cacheDirPath)
-	mountGCSFuseAndSetupTestDir(s.flags, s.ctx, s.storageClient, testDirName)
+	operations.RemoveDir(s.env.cacheDirPath)
+	s.env.mountGCSFuseAndSetupTestDir(s.flags, t)
 }
 
 func (s *rangeReadTest) Teardown(t *testing.T) {
-	setup.UnmountGCSFuseAndDeleteLogFile(rootDir)
+	s.env.unmountGCSFuse(t)
 }
 
 ////////////////////////////////////////////////////////////////////////
@@ -55,27 +50,27 @@ func (s *rangeReadTest) Teardown(t *testing.T) {
 ////////////////////////////////////////////////////////////////////////
 
 func (s *rangeReadTest) TestRangeReadsWithinReadChunkSize(t *testing.T) {
-	testFileName := setupFileInTestDir(s.ctx, s.storageClient, testDirName, veryLargeFileSize, t)
+	testFileName := s.env.setupFileInTestDir(veryLargeFileSize, t)
 
-	expectedOutcome1 := readChunkAndValidateObjectContentsFromGCS(s.ctx, s.storageClient, testFileName, zeroOffset, t)
-	expectedOutcome2 := readChunkAndValidateObjectContentsFromGCS(s.ctx, s.storageClient, testFileName, offsetForRangeReadWithin8MB, t)
+	expectedOutcome1 := s.env.readChunkAndValidateObjectContentsFromGCS(testFileName, zeroOffset, t)
+	expectedOutcome2 := s.env.readChunkAndValidateObjectContentsFromGCS(testFileName, offsetForRangeReadWithin8MB, t)
 
-	structuredReadLogs := read_logs.GetStructuredLogsSortedByTimestamp(setup.LogFile(), t)
+	structuredReadLogs := read_logs.GetStructuredLogsSortedByTimestamp(s.env.LogFile, t)
 	validate(expectedOutcome1, structuredReadLogs[0], true, false, 1, t)
 	validate(expectedOutcome2, structuredReadLogs[1], false, true, 1, t)
 }
 
 func (s *rangeReadTest) TestRangeReadsBeyondReadChunkSizeWithChunkDownloaded(t *testing.T) {
-	testFileName := setupFileInTestDir(s.ctx, s.storageClient, testDirName, veryLargeFileSize, t)
+	testFileName := s.env.setupFileInTestDir(veryLargeFileSize, t)
 
-	expectedOutcome1 := readChunkAndValidateObjectContentsFromGCS(s.ctx, s.storageClient, testFileName, zeroOffset, t)
+	expectedOutcome1 := s.env.readChunkAndValidateObjectContentsFromGCS(testFileName, zeroOffset, t)
 	time.Sleep(2 * time.Second)
-	expectedOutcome2 := readChunkAndValidateObjectContentsFromGCS(s.ctx, s.storageClient, testFileName, offset10MiB, t)
+	expectedOutcome2 := s.env.readChunkAndValidateObjectContentsFromGCS(testFileName, offset10MiB, t)
 
-	structuredReadLogs := read_logs.GetStructuredLogsSortedByTimestamp(setup.LogFile(), t)
+	structuredReadLogs := read_logs.GetStructuredLogsSortedByTimestamp(s.env.LogFile, t)
 	validate(expectedOutcome1, structuredReadLogs[0], true, false, 1, t)
 	validate(expectedOutcome2, structuredReadLogs[1], false, true, 1, t)
-	validateCacheSizeWithinLimit(cacheCapacityForVeryLargeFileInMiB, t)
+	s.env.validateCacheSizeWithinLimit(cacheCapacityForVeryLargeFileInMiB, t)
 }
 
 ////////////////////////////////////////////////////////////////////////
@@ -83,15 +78,8 @@ func (s *rangeReadTest) TestRangeReadsBeyondReadChunkSizeWithChunkDownloaded(t *
 ////////////////////////////////////////////////////////////////////////
 
 func TestRangeReadTest(t *testing.T) {
-	ts := &rangeReadTest{ctx: context.Background()}
-	// Create storage client before running tests.
-	closeStorageClient := client.CreateStorageClientWithTimeOut(&ts.ctx, &ts.storageClient, 15*time.Minute)
-	defer func() {
-		err := closeStorageClient()
-		if err != nil {
-			t.Errorf("closeStorageClient failed: %v", err)
-		}
-	}()
+	setup.Parallel(t)
+	ts := &rangeReadTest{env: newTestEnv(t, "RangeRead")}
 
 	// Run tests for mounted directory if the flag is set.
 	if setup.AreBothMountedDirectoryAndTestBucketFlagsSet() {
@@ -99,15 +87,15 @@ func TestRangeReadTest(t *testing.T) {
 		return
 	}
 
-	setup.RunTestsOnlyForStaticMount(mountDir, t)
+	ts.env.RunTestsOnlyForStaticMount(t)
 	// Define flag set to run the tests.
 	flagSet := [][]string{
 		{"--implicit-dirs=true"},
 		{"--implicit-dirs=false"},
 	}
 	setup.AppendFlagsToAllFlagsInTheFlagsSet(&flagSet,
-		"--config-file="+createConfigFile(cacheCapacityForVeryLargeFileInMiB, false, configFileName+"1"),
-		"--config-file="+createConfigFile(cacheCapacityForVeryLargeFileInMiB, true, configFileName+"2"))
+		"--config-file="+ts.env.createConfigFile(cacheCapacityForVeryLargeFileInMiB, false, configFileName+"1"),
+		"--config-file="+ts.env.createConfigFile(cacheCapacityForVeryLargeFileInMiB, true, configFileName+"2"))
 	setup.AppendFlagsToAllFlagsInTheFlagsSet(&flagSet, "--o=ro", "")
 
 	// Run tests.
@@ -15,12 +15,9 @@
 package read_cache
 
 import (
-	"context"
 	"log"
 	"testing"
-	"time"
 
-	"cloud.google.com/go/storage"
 	"github.com/googlecloudplatform/gcsfuse/v2/tools/integration_tests/util/client"
 	"github.com/googlecloudplatform/gcsfuse/v2/tools/integration_tests/util/log_parser/json_parser/read_logs"
 	"github.com/googlecloudplatform/gcsfuse/v2/tools/integration_tests/util/operations"
@@ -33,29 +30,27 @@ import (
 ////////////////////////////////////////////////////////////////////////
 
 type readOnlyTest struct {
-	flags         []string
-	storageClient *storage.Client
-	ctx           context.Context
+	flags []string
+	env   *testEnv
 }
 
 func (s *readOnlyTest) Setup(t *testing.T) {
-	setupForMountedDirectoryTests()
 	// Clean up the cache directory path as gcsfuse don't clean up on mounting.
-	operations.RemoveDir(cacheDirPath)
-	mountGCSFuseAndSetupTestDir(s.flags, s.ctx, s.storageClient, testDirName)
+	operations.RemoveDir(s.env.cacheDirPath)
+	s.env.mountGCSFuseAndSetupTestDir(s.flags, t)
 }
 
 func (s *readOnlyTest) Teardown(t *testing.T) {
-	setup.UnmountGCSFuseAndDeleteLogFile(rootDir)
+	s.env.unmountGCSFuse(t)
 }
 
 ////////////////////////////////////////////////////////////////////////
 // Helper functions
 ////////////////////////////////////////////////////////////////////////
 
-func readMultipleFiles(numFiles int, ctx context.Context, storageClient *storage.Client, fileNames []string, fileSize int64, t *testing.T) (expectedOutcome []*Expected) {
+func (env *testEnv) readMultipleFiles(numFiles int, fileNames []string, fileSize int64, t *testing.T) (expectedOutcome []*Expected) {
 	for i := 0; i < numFiles; i++ {
-		expectedOutcome = append(expectedOutcome, readFileAndValidateCacheWithGCS(ctx, storageClient, fileNames[i], fileSize, true, t))
+		expectedOutcome = append(expectedOutcome, env.readFileAndValidateCacheWithGCS(fileNames[i], fileSize, true, t))
 	}
 	return expectedOutcome
 }
@@ -73,71 +68,71 @@ func validateCacheOfMultipleObjectsUsingStructuredLogs(startIndex int, numFiles
 ////////////////////////////////////////////////////////////////////////
 
 func (s *readOnlyTest) TestSecondSequentialReadIsCacheHit(t *testing.T) {
-	testFileName := setupFileInTestDir(s.ctx, s.storageClient, testDirName, fileSize, t)
+	testFileName := s.env.setupFileInTestDir(fileSize, t)
 
 	// Read file 1st time.
-	expectedOutcome1 := readFileAndValidateCacheWithGCS(s.ctx, s.storageClient, testFileName, fileSize, true, t)
+	expectedOutcome1 := s.env.readFileAndValidateCacheWithGCS(testFileName, fileSize, true, t)
 	// Read file 2nd time.
-	expectedOutcome2 := readFileAndValidateCacheWithGCS(s.ctx, s.storageClient, testFileName, fileSize, true, t)
+	expectedOutcome2 := s.env.readFileAndValidateCacheWithGCS(testFileName, fileSize, true, t)
 
 	// Parse the log file and validate cache hit or miss from the structured logs.
-	structuredReadLogs := read_logs.GetStructuredLogsSortedByTimestamp(setup.LogFile(), t)
+	structuredReadLogs := read_logs.GetStructuredLogsSortedByTimestamp(s.env.LogFile, t)
 	validate(expectedOutcome1, structuredReadLogs[0], true, false, chunksRead, t)
 	validate(expectedOutcome2, structuredReadLogs[1], true, true, chunksRead, t)
 }
 
 func (s *readOnlyTest) TestReadFileSequentiallyLargerThanCacheCapacity(t *testing.T) {
 	// Set up a file in test directory of size more than cache capacity.
-	client.SetupFileInTestDirectory(s.ctx, s.storageClient, testDirName,
+	client.SetupFileInTestDirectoryInEnv(s.env.TestEnv, s.env.testDirName,
 		largeFileName, largeFileSize, t)
 
 	// Read file 1st time.
-	expectedOutcome1 := readFileAndValidateFileIsNotCached(s.ctx, s.storageClient, largeFileName, true, zeroOffset, t)
+	expectedOutcome1 := s.env.readFileAndValidateFileIsNotCached(largeFileName, true, zeroOffset, t)
 	// Read file 2nd time.
-	expectedOutcome2 := readFileAndValidateFileIsNotCached(s.ctx, s.storageClient, largeFileName, true, zeroOffset, t)
+	expectedOutcome2 := s.env.readFileAndValidateFileIsNotCached(largeFileName, true, zeroOffset, t)
 
 	// Parse the log file and validate cache hit or miss from the structured logs.
-	structuredReadLogs := read_logs.GetStructuredLogsSortedByTimestamp(setup.LogFile(), t)
+	structuredReadLogs := read_logs.GetStructuredLogsSortedByTimestamp(s.env.LogFile, t)
 	validate(expectedOutcome1, structuredReadLogs[0], true, false, largeFileChunksRead, t)
 	validate(expectedOutcome2, structuredReadLogs[1], true, false, largeFileChunksRead, t)
 }
 
 func (s *readOnlyTest) TestReadFileRandomlyLargerThanCacheCapacity(t *testing.T) {
 	// Set up a file in test directory of size more than cache capacity.
-	client.SetupFileInTestDirectory(s.ctx, s.storageClient, testDirName,
+	client.SetupFileInTestDirectoryInEnv(s.env.TestEnv, s.env.testDirName,
 		largeFileName, largeFileSize, t)
 
 	// Do a random read on file.
-	expectedOutcome1 := readFileAndValidateFileIsNotCached(s.ctx, s.storageClient, largeFileName, false, randomReadOffset, t)
+	expectedOutcome1 := s.env.readFileAndValidateFileIsNotCached(largeFileName, false, randomReadOffset, t)
 	// Read file sequentially again.
-	expectedOutcome2 := readFileAndValidateFileIsNotCached(s.ctx, s.storageClient, largeFileName, true, zeroOffset, t)
+	expectedOutcome2 := s.env.readFileAndValidateFileIsNotCached(largeFileName, true, zeroOffset, t)
 
 	// Parse the log file and validate cache hit or miss from the structured logs.
-	structuredReadLogs := read_logs.GetStructuredLogsSortedByTimestamp(setup.LogFile(), t)
+	structuredReadLogs := read_logs.GetStructuredLogsSortedByTimestamp(s.env.LogFile, t)
 	validate(expectedOutcome1, structuredReadLogs[0], false, false, 1, t)
 	validate(expectedOutcome2, structuredReadLogs[1], true, false, largeFileChunksRead, t)
 }
 
 func (s *readOnlyTest) TestReadMultipleFilesMoreThanCacheLimit(t *testing.T) {
-	fileNames := client.CreateNFilesInDir(s.ctx, s.storageClient, NumberOfFilesMoreThanCacheLimit, testFileName, fileSize, testDirName, t)
+	fileNames := client.CreateNFilesInDirInEnv(s.env.TestEnv, NumberOfFilesMoreThanCacheLimit, testFileName, fileSize, s.env.testDirName, t)
 
-	expectedOutcome := readMultipleFiles(NumberOfFilesMoreThanCacheLimit, s.ctx, s.storageClient, fileNames, fileSize, t)
-	expectedOutcome = append(expectedOutcome, readMultipleFiles(NumberOfFilesMoreThanCacheLimit, s.ctx, s.storageClient, fileNames, fileSize, t)...)
+	expectedOutcome := s.env.readMultipleFiles(NumberOfFilesMoreThanCacheLimit, fileNames, fileSize, t)
+	expectedOutcome = append(expectedOutcome, s.env.readMultipleFiles(NumberOfFilesMoreThanCacheLimit, fileNames, fileSize, t)...)
 
 	// Parse the log file and validate cache hit or miss from the structured logs.
-	structuredReadLogs := read_logs.GetStructuredLogsSortedByTimestamp(setup.LogFile(), t)
+	structuredReadLogs := read_logs.GetStructuredLogsSortedByTimestamp(s.env.LogFile, t)
 	validateCacheOfMultipleObjectsUsingStructuredLogs(0, NumberOfFilesMoreThanCacheLimit, expectedOutcome, structuredReadLogs, false, t)
 	validateCacheOfMultipleObjectsUsingStructuredLogs(NumberOfFilesMoreThanCacheLimit, NumberOfFilesMoreThanCacheLimit, expectedOutcome, structuredReadLogs, false, t)
 }
 
 func (s *readOnlyTest) TestReadMultipleFilesWithinCacheLimit(t *testing.T) {
-	fileNames := client.CreateNFilesInDir(s.ctx, s.storageClient, NumberOfFilesWithinCacheLimit, testFileName, fileSize, testDirName, t)
+	fileNames := client.CreateNFilesInDirInEnv(s.env.TestEnv, NumberOfFilesWithinCacheLimit, testFileName, fileSize, s.env.testDirName, t)
 
-	expectedOutcome := readMultipleFiles(NumberOfFilesWithinCacheLimit, s.ctx, s.storageClient, fileNames, fileSize, t)
-	expectedOutcome = append(expectedOutcome, readMultipleFiles(NumberOfFilesWithinCacheLimit, s.ctx, s.storageClient, fileNames, fileSize, t)...)
+	expectedOutcome := s.env.readMultipleFiles(NumberOfFilesWithinCacheLimit, fileNames, fileSize, t)
+	expectedOutcome = append(expectedOutcome, s.env.readMultipleFiles(NumberOfFilesWithinCacheLimit, fileNames, fileSize, t)...)
 
 	// Parse the log file and validate cache hit or miss from the structured logs.
-	structuredReadLogs := read_logs.GetStructuredLogsSortedByTimestamp(setup.LogFile(), t)
+	structuredReadLogs := read_logs.GetStructuredLogsSortedByTimestamp(s.env.LogFile, t)
 	validateCacheOfMultipleObjectsUsingStructuredLogs(0, NumberOfFilesWithinCacheLimit, expectedOutcome, structuredReadLogs, false, t)
 	validateCacheOfMultipleObjectsUsingStructuredLogs(NumberOfFilesWithinCacheLimit, NumberOfFilesWithinCacheLimit, expectedOutcome, structuredReadLogs, true, t)
 }
@@ -147,15 +142,8 @@ func (s *readOnlyTest) TestReadMultipleFilesWithinCacheLimit(t *testing.T) {
 ////////////////////////////////////////////////////////////////////////
 
 func TestReadOnlyTest(t *testing.T) {
-	ts := &readOnlyTest{ctx: context.Background()}
-	// Create storage client before running tests.
-	closeStorageClient := client.CreateStorageClientWithTimeOut(&ts.ctx, &ts.storageClient, 15*time.Minute)
-	defer func() {
-		err := closeStorageClient()
-		if err != nil {
-			t.Errorf("closeStorageClient failed: %v", err)
-		}
-	}()
+	setup.Parallel(t)
+	ts := &readOnlyTest{env: newTestEnv(t, "ReadOnly")}
 
 	// Run tests for mounted directory if the flag is set.
 	if setup.AreBothMountedDirectoryAndTestBucketFlagsSet() {
@@ -169,8 +157,8 @@ func TestReadOnlyTest(t *testing.T) {
 		{"--implicit-dirs=false"},
 	}
 	setup.AppendFlagsToAllFlagsInTheFlagsSet(&flagsSet,
-		"--config-file="+createConfigFile(cacheCapacityInMB, false, configFileName+"1"),
-		"--config-file="+createConfigFile(cacheCapacityInMB, true, configFileName+"2"))
+		"--config-file="+ts.env.createConfigFile(cacheCapacityInMB, false, configFileName+"1"),
+		"--config-file="+ts.env.createConfigFile(cacheCapacityInMB, true, configFileName+"2"))
 	setup.AppendFlagsToAllFlagsInTheFlagsSet(&flagsSet, "--o=ro", "")
 
 	// Run tests.
@@ -15,7 +15,6 @@
 package read_cache
 
 import (
-	"context"
 	"log"
 	"path"
 	"testing"
@@ -23,7 +22,6 @@ import (
 
 	"github.com/googlecloudplatform/gcsfuse/v2/tools/integration_tests/util/operations"
 
-	"cloud.google.com/go/storage"
 	"github.com/googlecloudplatform/gcsfuse/v2/tools/integration_tests/util/client"
 	"github.com/googlecloudplatform/gcsfuse/v2/tools/integration_tests/util/log_parser/json_parser/read_logs"
 	"github.com/googlecloudplatform/gcsfuse/v2/tools/integration_tests/util/mounting/dynamic_mounting"
@@ -36,31 +34,31 @@ import (
 ////////////////////////////////////////////////////////////////////////
 
 type remountTest struct {
-	flags         []string
-	storageClient *storage.Client
-	ctx           context.Context
+	flags []string
+	env   *testEnv
 }
 
 func (s *remountTest) Setup(t *testing.T) {
-	operations.RemoveDir(cacheDirPath)
-	mountGCSFuseAndSetupTestDir(s.flags, s.ctx, s.storageClient, testDirName)
+	// Clean up the cache directory path as gcsfuse don't clean up on mounting.
+	operations.RemoveDir(s.env.cacheDirPath)
+	s.env.mountGCSFuseAndSetupTestDir(s.flags, t)
 }
 
 func (s *remountTest) Teardown(t *testing.T) {
-	setup.UnmountGCSFuseAndDeleteLogFile(rootDir)
+	s.env.unmountGCSFuse(t)
 }
 
 ////////////////////////////////////////////////////////////////////////
 // Helper functions
 ////////////////////////////////////////////////////////////////////////
 
-func readFileAndValidateCacheWithGCSForDynamicMount(bucketName string, ctx context.Context, storageClient *storage.Client, fileName string, checkCacheSize bool, t *testing.T) (expectedOutcome *Expected) {
-	setup.SetDynamicBucketMounted(bucketName)
-	defer setup.SetDynamicBucketMounted("")
-	testDirPath = path.Join(rootDir, bucketName, testDirName)
-	expectedOutcome = readFileAndValidateCacheWithGCS(ctx, storageClient, fileName, fileSize, checkCacheSize, t)
-
-	return expectedOutcome
+// forDynamicMount returns a copy of env that runs in bucket under the same
+// dynamic mount.
+func (env *testEnv) forDynamicMount(bucket string) *testEnv {
+	c := *env
+	c.TestEnv = env.ForDynamicMount(bucket)
+	c.testDirPath = path.Join(c.MntDir, c.testDirName)
+	return &c
 }
 
 ////////////////////////////////////////////////////////////////////////
@@ -68,18 +66,18 @@ func readFileAndValidateCacheWithGCSForDynamicMount(bucketName string, ctx conte
 ////////////////////////////////////////////////////////////////////////
 
 func (s *remountTest) TestCacheIsNotReusedOnRemount(t *testing.T) {
-	testFileName := setupFileInTestDir(s.ctx, s.storageClient, testDirName, fileSize, t)
+	testFileName := s.env.setupFileInTestDir(fileSize, t)
 
 	// Run read operations on GCSFuse mount.
-	expectedOutcome1 := readFileAndValidateCacheWithGCS(s.ctx, s.storageClient, testFileName, fileSize, true, t)
-	expectedOutcome2 := readFileAndValidateCacheWithGCS(s.ctx, s.storageClient, testFileName, fileSize, true, t)
-	structuredReadLogsMount1 := read_logs.GetStructuredLogsSortedByTimestamp(setup.LogFile(), t)
+	expectedOutcome1 := s.env.readFileAndValidateCacheWithGCS(testFileName, fileSize, true, t)
+	expectedOutcome2 := s.env.readFileAndValidateCacheWithGCS(testFileName, fileSize, true, t)
+	structuredReadLogsMount1 := read_logs.GetStructuredLogsSortedByTimestamp(s.env.LogFile, t)
 	// Re-mount GCSFuse.
-	remountGCSFuse(s.flags, t)
+	s.env.remountGCSFuse(s.flags, t)
 	// Run read operations again on GCSFuse mount.
-	expectedOutcome3 := readFileAndValidateCacheWithGCS(s.ctx, s.storageClient, testFileName, fileSize, false, t)
-	expectedOutcome4 := readFileAndValidateCacheWithGCS(s.ctx, s.storageClient, testFileName, fileSize, false, t)
-	structuredReadLogsMount2 := read_logs.GetStructuredLogsSortedByTimestamp(setup.LogFile(), t)
+	expectedOutcome3 := s.env.readFileAndValidateCacheWithGCS(testFileName, fileSize, false, t)
+	expectedOutcome4 := s.env.readFileAndValidateCacheWithGCS(testFileName, fileSize, false, t)
+	structuredReadLogsMount2 := read_logs.GetStructuredLogsSortedByTimestamp(s.env.LogFile, t)
 
 	validate(expectedOutcome1, structuredReadLogsMount1[0], true, false, chunksRead, t)
 	validate(expectedOutcome2, structuredReadLogsMount1[1], true, true, chunksRead, t)
@@ -88,30 +86,29 @@ func (s *remountTest) TestCacheIsNotReusedOnRemount(t *testing.T) {
 }
 
 func (s *remountTest) TestCacheIsNotReusedOnDynamicRemount(t *testing.T) {
-	runTestsOnlyForDynamicMount(t)
-	testBucket1 := setup.TestBucket()
-	testFileName1 := setupFileInTestDir(s.ctx, s.storageClient, testDirName, fileSize, t)
+	s.env.runTestsOnlyForDynamicMount(t)
+	env1 := s.env.forDynamicMount(setup.TestBucket())
+	testFileName1 := env1.setupFileInTestDir(fileSize, t)
 	testBucket2 := dynamic_mounting.CreateTestBucketForDynamicMounting()
 	defer dynamic_mounting.DeleteTestBucketForDynamicMounting(testBucket2)
-	setup.SetDynamicBucketMounted(testBucket2)
-	defer setup.SetDynamicBucketMounted("")
+	env2 := s.env.forDynamicMount(testBucket2)
 	// Introducing a sleep of 7 seconds after bucket creation to address propagation delays.
 	time.Sleep(7 * time.Second)
-	client.SetupTestDirectory(s.ctx, s.storageClient, testDirName)
-	testFileName2 := setupFileInTestDir(s.ctx, s.storageClient, testDirName, fileSize, t)
+	client.SetupTestDirectoryInEnv(env2.TestEnv, env2.testDirName)
+	testFileName2 := env2.setupFileInTestDir(fileSize, t)
 
 	// Reading files in different buckets.
-	expectedOutcome1 := readFileAndValidateCacheWithGCSForDynamicMount(testBucket1, s.ctx, s.storageClient, testFileName1, true, t)
-	expectedOutcome2 := readFileAndValidateCacheWithGCSForDynamicMount(testBucket2, s.ctx, s.storageClient, testFileName2, true, t)
-	structuredReadLogs1 := read_logs.GetStructuredLogsSortedByTimestamp(setup.LogFile(), t)
-	remountGCSFuse(s.flags, t)
+	expectedOutcome1 := env1.readFileAndValidateCacheWithGCS(testFileName1, fileSize, true, t)
+	expectedOutcome2 := env2.readFileAndValidateCacheWithGCS(testFileName2, fileSize, true, t)
+	structuredReadLogs1 := read_logs.GetStructuredLogsSortedByTimestamp(s.env.LogFile, t)
+	s.env.remountGCSFuse(s.flags, t)
 	// Reading files in different buckets again.
-	expectedOutcome3 := readFileAndValidateCacheWithGCSForDynamicMount(testBucket1, s.ctx, s.storageClient, testFileName1, false, t)
-	expectedOutcome4 := readFileAndValidateCacheWithGCSForDynamicMount(testBucket2, s.ctx, s.storageClient, testFileName2, false, t)
+	expectedOutcome3 := env1.readFileAndValidateCacheWithGCS(testFileName1, fileSize, false, t)
+	expectedOutcome4 := env2.readFileAndValidateCacheWithGCS(testFileName2, fileSize, false, t)
 	// Reading same files in different buckets again without remount.
-	expectedOutcome5 := readFileAndValidateCacheWithGCSForDynamicMount(testBucket1, s.ctx, s.storageClient, testFileName1, false, t)
-	expectedOutcome6 := readFileAndValidateCacheWithGCSForDynamicMount(testBucket2, s.ctx, s.storageClient, testFileName2, false, t)
-	structuredReadLogs2 := read_logs.GetStructuredLogsSortedByTimestamp(setup.LogFile(), t)
+	expectedOutcome5 := env1.readFileAndValidateCacheWithGCS(testFileName1, fileSize, false, t)
+	expectedOutcome6 := env2.readFileAndValidateCacheWithGCS(testFileName2, fileSize, false, t)
+	structuredReadLogs2 := read_logs.GetStructuredLogsSortedByTimestamp(s.env.LogFile, t)
 
 	validate(expectedOutcome1, structuredReadLogs1[0], true, false, chunksRead, t)
 	validate(expectedOutcome2, structuredReadLogs1[1], true, false, chunksRead, t)
@@ -130,24 +127,18 @@ func TestRemountTest(t *testing.T) {
 		t.Log("Not running remount tests for GKE environment...")
 		t.SkipNow()
 	}
+	setup.Parallel(t)
+	// Create storage client before running tests.
+	ts := &remountTest{env: newTestEnv(t, "Remount")}
+
 	// Define flag set to run the tests.
 	flagsSet := [][]string{
 		{"--implicit-dirs=true"},
 		{"--implicit-dirs=false"},
 	}
-	setup.AppendFlagsToAllFlagsInTheFlagsSet(&flagsSet, "--config-file="+createConfigFile(cacheCapacityInMB, false, configFileName))
+	setup.AppendFlagsToAllFlagsInTheFlagsSet(&flagsSet, "--config-file="+ts.env.createConfigFile(cacheCapacityInMB, false, configFileName))
 	setup.AppendFlagsToAllFlagsInTheFlagsSet(&flagsSet, "--o=ro", "")
 
-	// Create storage client before running tests.
-	ts := &remountTest{ctx: context.Background()}
-	closeStorageClient := client.CreateStorageClientWithTimeOut(&ts.ctx, &ts.storageClient, 15*time.Minute)
-	defer func() {
-		err := closeStorageClient()
-		if err != nil {
-			t.Errorf("closeStorageClient failed: %v", err)
-		}
-	}()
-
 	// Run tests.
 	for _, flags := range flagsSet {
 		ts.flags = flags
@@ -20,6 +20,7 @@ import (
 	"os"
 	"path"
 	"testing"
+	"time"
 
 	"cloud.google.com/go/storage"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/util"
@@ -66,37 +67,79 @@ const (
 	logFileNameForMountedDirectoryTests = "/tmp/gcsfuse_read_cache_test_logs/log.json"
 )
 
+// The mount TestMain is running the suites against. Suites only read these.
 var (
+	mountFunc    func(*setup.TestEnv, []string) error
+	dynamicMount bool
+	onlyDir      string
+)
+
+// testEnv is the mount, log file, cache directory and GCS test directory of
+// one test suite. Suites don't share any of them, so they run in parallel.
+type testEnv struct {
+	*setup.TestEnv
+	testDirName  string
 	testDirPath  string
 	cacheDirPath string
-	mountFunc    func([]string) error
-	// mount directory is where our tests run.
-	mountDir string
-	// root directory is the directory to be unmounted.
-	rootDir string
-)
+}
 
 ////////////////////////////////////////////////////////////////////////
 // Helpers
 ////////////////////////////////////////////////////////////////////////
 
-func setupForMountedDirectoryTests() {
+// newTestEnv creates the env of the suite called name and removes its test
+// directory from GCS once t completes.
+func newTestEnv(t *testing.T, name string) *testEnv {
+	ctx := context.Background()
+	var storageClient *storage.Client
+	closeStorageClient := client.CreateStorageClientWithTimeOut(&ctx, &storageClient, 15*time.Minute)
+	t.Cleanup(func() {
+		if err := closeStorageClient(); err != nil {
+			t.Errorf("closeStorageClient failed: %v", err)
+		}
+	})
+
+	te, err := setup.NewTestEnv(ctx, storageClient, name)
+	if err != nil {
+		t.Fatalf("NewTestEnv: %v", err)
+	}
+	env := &testEnv{
+		TestEnv:      te,
+		testDirName:  testDirName + name,
+		cacheDirPath: path.Join(te.TestDir, cacheDirName),
+	}
 	if setup.MountedDirectory() != "" {
-		cacheDirPath = path.Join(os.TempDir(), cacheDirName)
-		mountDir = setup.MountedDirectory()
-		setup.SetLogFile(logFileNameForMountedDirectoryTests)
+		env.LogFile = logFileNameForMountedDirectoryTests
+		env.cacheDirPath = path.Join(os.TempDir(), cacheDirName)
+	} else {
+		env.OnlyDir = onlyDir
+		if dynamicMount {
+			env.TestEnv = env.ForDynamicMount(setup.TestBucket())
+		}
 	}
+	env.testDirPath = path.Join(env.MntDir, env.testDirName)
+
+	t.Cleanup(func() {
+		bucket, object := env.BucketAndObject(env.testDirName)
+		setup.CleanupDirectoryOnGCS(path.Join(bucket, object))
+	})
+	return env
 }
 
-func mountGCSFuseAndSetupTestDir(flags []string, ctx context.Context, storageClient *storage.Client, testDirName string) {
-	setup.MountGCSFuseWithGivenMountFunc(flags, mountFunc)
-	setup.SetMntDir(mountDir)
-	testDirPath = client.SetupTestDirectory(ctx, storageClient, testDirName)
+func (env *testEnv) mountGCSFuseAndSetupTestDir(flags []string, t *testing.T) {
+	if err := env.MountGCSFuse(flags, mountFunc); err != nil {
+		t.Fatal(err)
+	}
+	client.SetupTestDirectoryInEnv(env.TestEnv, env.testDirName)
 }
 
-func createConfigFile(cacheSize int64, cacheFileForRangeRead bool, fileName string) string {
-	cacheDirPath = path.Join(setup.TestDir(), cacheDirName)
+func (env *testEnv) unmountGCSFuse(t *testing.T) {
+	if err := env.UnmountGCSFuseAndDeleteLogFile(); err != nil {
+		t.Fatal(err)
+	}
+}
 
+func (env *testEnv) createConfigFile(cacheSize int64, cacheFileForRangeRead bool, fileName string) string {
 	// Set up config file for file cache.
 	mountConfig := config.MountConfig{
 		FileCacheConfig: config.FileCacheConfig{
@@ -105,15 +148,15 @@ func createConfigFile(cacheSize int64, cacheFileForRangeRead bool, fileName stri
 			MaxSizeMB:             cacheSize,
 			CacheFileForRangeRead: cacheFileForRangeRead,
 		},
-		CacheDir: config.CacheDir(cacheDirPath),
+		CacheDir: config.CacheDir(env.cacheDirPath),
 		LogConfig: config.LogConfig{
 			Severity:        config.TRACE,
 			Format:          "json",
-			FilePath:        setup.LogFile(),
+			FilePath:        env.LogFile,
 			LogRotateConfig: config.DefaultLogRotateConfig(),
 		},
 	}
-	filePath := setup.YAMLConfigFile(mountConfig, fileName)
+	filePath := setup.YAMLConfigFileInEnv(env.TestEnv, mountConfig, fileName)
 	return filePath
 }
 
@@ -132,31 +175,24 @@ func TestMain(m *testing.M) {
 	// Set up test directory.
 	setup.SetUpTestDirForTestBucketFlag()
 
-	// Save mount and root directory variables.
-	mountDir, rootDir = setup.MntDir(), setup.MntDir()
-
 	log.Println("Running static mounting tests...")
-	mountFunc = static_mounting.MountGcsfuseWithStaticMounting
+	mountFunc = static_mounting.MountGcsfuseWithStaticMountingInEnv
 	successCode := m.Run()
 
 	if successCode == 0 {
 		log.Println("Running dynamic mounting tests...")
-		// Save mount directory variable to have path of bucket to run tests.
-		mountDir = path.Join(setup.MntDir(), setup.TestBucket())
-		mountFunc = dynamic_mounting.MountGcsfuseWithDynamicMounting
+		dynamicMount = true
+		mountFunc = dynamic_mounting.MountGcsfuseWithDynamicMountingInEnv
 		successCode = m.Run()
+		dynamicMount = false
 	}
 
 	if successCode == 0 {
 		log.Println("Running only dir mounting tests...")
-		setup.SetOnlyDirMounted(onlyDirMounted + "/")
-		mountDir = rootDir
-		mountFunc = only_dir_mounting.MountGcsfuseWithOnlyDir
+		onlyDir = onlyDirMounted + "/"
+		mountFunc = only_dir_mounting.MountGcsfuseWithOnlyDirInEnv
 		successCode = m.Run()
-		setup.CleanupDirectoryOnGCS(path.Join(setup.TestBucket(), setup.OnlyDirMounted(), testDirName))
 	}
 
-	// Clean up test directory created.
-	setup.CleanupDirectoryOnGCS(path.Join(setup.TestBucket(), testDirName))
 	os.Exit(successCode)
 }
@@ -15,15 +15,13 @@
 package read_cache
 
 import (
-	"context"
 	"fmt"
 	"log"
 	"strings"
 	"testing"
 	"time"
 
-	"cloud.google.com/go/storage"
-	"github.com/googlecloudplatform/gcsfuse/v2/tools/integration_tests/util/client"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/gcsx"
 	"github.com/googlecloudplatform/gcsfuse/v2/tools/integration_tests/util/log_parser/json_parser/read_logs"
 	"github.com/googlecloudplatform/gcsfuse/v2/tools/integration_tests/util/operations"
 	"github.com/googlecloudplatform/gcsfuse/v2/tools/integration_tests/util/setup"
@@ -35,20 +33,18 @@ import (
 ////////////////////////////////////////////////////////////////////////
 
 type smallCacheTTLTest struct {
-	flags         []string
-	storageClient *storage.Client
-	ctx           context.Context
+	flags []string
+	env   *testEnv
 }
 
 func (s *smallCacheTTLTest) Setup(t *testing.T) {
-	setupForMountedDirectoryTests()
 	// Clean up the cache directory path as gcsfuse don't clean up on mounting.
-	operations.RemoveDir(cacheDirPath)
-	mountGCSFuseAndSetupTestDir(s.flags, s.ctx, s.storageClient, testDirName)
+	operations.RemoveDir(s.env.cacheDirPath)
+	s.env.mountGCSFuseAndSetupTestDir(s.flags, t)
 }
 
 func (s *smallCacheTTLTest) Teardown(t *testing.T) {
-	setup.UnmountGCSFuseAndDeleteLogFile(rootDir)
+	s.env.unmountGCSFuse(t)
 }
 
 ////////////////////////////////////////////////////////////////////////
@@ -56,62 +52,71 @@ func (s *smallCacheTTLTest) Teardown(t *testing.T) {
 ////////////////////////////////////////////////////////////////////////
 
 func (s *smallCacheTTLTest) TestReadAfterUpdateAndCacheExpiryIsCacheMiss(t *testing.T) {
-	testFileName := setupFileInTestDir(s.ctx, s.storageClient, testDirName, fileSize, t)
+	testFileName := s.env.setupFileInTestDir(fileSize, t)
 
 	// Read file 1st time.
-	expectedOutcome1 := readFileAndValidateCacheWithGCS(s.ctx, s.storageClient, testFileName, fileSize, true, t)
+	expectedOutcome1 := s.env.readFileAndValidateCacheWithGCS(testFileName, fileSize, true, t)
 	// Modify the file.
-	modifyFile(s.ctx, s.storageClient, testFileName, t)
+	s.env.modifyFile(testFileName, t)
 	// Read same file again immediately.
-	expectedOutcome2 := readFileAndGetExpectedOutcome(testDirPath, testFileName, true, zeroOffset, t)
-	validateFileSizeInCacheDirectory(testFileName, fileSize, t)
+	expectedOutcome2 := s.env.readFileAndGetExpectedOutcome(testFileName, true, zeroOffset, t)
+	s.env.validateFileSizeInCacheDirectory(testFileName, fileSize, t)
 	// Validate that stale data is served from cache in this case.
 	if strings.Compare(expectedOutcome1.content, expectedOutcome2.content) != 0 {
 		t.Errorf("content mismatch. Expected old data to be served again.")
 	}
 	// Wait for metadata cache expiry and read the file again.
 	time.Sleep(metadataCacheTTlInSec * time.Second)
-	expectedOutcome3 := readFileAndValidateCacheWithGCS(s.ctx, s.storageClient, testFileName, smallContentSize, true, t)
+	expectedOutcome3 := s.env.readFileAndValidateCacheWithGCS(testFileName, smallContentSize, true, t)
 
 	// Parse the log file and validate cache hit or miss from the structured logs.
-	structuredReadLogs := read_logs.GetStructuredLogsSortedByTimestamp(setup.LogFile(), t)
+	structuredReadLogs := read_logs.GetStructuredLogsSortedByTimestamp(s.env.LogFile, t)
 	validate(expectedOutcome1, structuredReadLogs[0], true, false, chunksRead, t)
 	validate(expectedOutcome2, structuredReadLogs[1], true, true, chunksRead, t)
 	validate(expectedOutcome3, structuredReadLogs[2], true, false, chunksReadAfterUpdate, t)
 }
 
 func (s *smallCacheTTLTest) TestReadForLowMetaDataCacheTTLIsCacheHit(t *testing.T) {
-	testFileName := setupFileInTestDir(s.ctx, s.storageClient, testDirName, fileSize, t)
+	testFileName := s.env.setupFileInTestDir(fileSize, t)
 
 	// Read file 1st time.
-	expectedOutcome1 := readFileAndValidateCacheWithGCS(s.ctx, s.storageClient, testFileName, fileSize, true, t)
+	expectedOutcome1 := s.env.readFileAndValidateCacheWithGCS(testFileName, fileSize, true, t)
 	// Wait for metadata cache expiry and read the file again.
 	time.Sleep(metadataCacheTTlInSec * time.Second)
-	expectedOutcome2 := readFileAndValidateCacheWithGCS(s.ctx, s.storageClient, testFileName, fileSize, true, t)
+	expectedOutcome2 := s.env.readFileAndValidateCacheWithGCS(testFileName, fileSize, true, t)
 	// Read same file again immediately.
-	expectedOutcome3 := readFileAndValidateCacheWithGCS(s.ctx, s.storageClient, testFileName, fileSize, true, t)
+	expectedOutcome3 := s.env.readFileAndValidateCacheWithGCS(testFileName, fileSize, true, t)
 
 	// Parse the log file and validate cache hit or miss from the structured logs.
-	structuredReadLogs := read_logs.GetStructuredLogsSortedByTimestamp(setup.LogFile(), t)
+	structuredReadLogs := read_logs.GetStructuredLogsSortedByTimestamp(s.env.LogFile, t)
 	validate(expectedOutcome1, structuredReadLogs[0], true, false, chunksRead, t)
 	validate(expectedOutcome2, structuredReadLogs[1], true, true, chunksRead, t)
 	validate(expectedOutcome3, structuredReadLogs[2], true, true, chunksRead, t)
 }
 
+func (s *smallCacheTTLTest) TestSecondOpenWithinMetadataCacheTTLDoesNotStat(t *testing.T) {
+	testFileName := s.env.setupFileInTestDir(fileSize, t)
+
+	// Read file 1st time.
+	expectedOutcome1 := s.env.readFileAndValidateCacheWithGCS(testFileName, fileSize, true, t)
+	// Open and read the file again immediately.
+	expectedOutcome2 := s.env.readFileAndValidateCacheWithGCS(testFileName, fileSize, true, t)
+
+	// Parse the log file and validate that the cached file was served on the
+	// metadata cache's word, without a stat.
+	structuredReadLogs := read_logs.GetStructuredLogsSortedByTimestamp(s.env.LogFile, t)
+	validate(expectedOutcome1, structuredReadLogs[0], true, false, chunksRead, t)
+	validate(expectedOutcome2, structuredReadLogs[1], true, true, chunksRead, t)
+	validateCacheValidation(structuredReadLogs[1], gcsx.CacheValidationMetadataCache, t)
+}
+
 ////////////////////////////////////////////////////////////////////////
 // Test Function (Runs once before all tests)
 ////////////////////////////////////////////////////////////////////////
 
 func TestSmallCacheTTLTest(t *testing.T) {
-	ts := &smallCacheTTLTest{ctx: context.Background()}
-	// Create storage client before running tests.
-	closeStorageClient := client.CreateStorageClientWithTimeOut(&ts.ctx, &ts.storageClient, 15*time.Minute)
-	defer func() {
-		err := closeStorageClient()
-		if err != nil {
-			t.Errorf("closeStorageClient failed: %v", err)
-		}
-	}()
+	setup.Parallel(t)
+	ts := &smallCacheTTLTest{env: newTestEnv(t, "SmallCacheTTL")}
 
 	// Run tests for mounted directory if the flag is set.
 	if setup.AreBothMountedDirectoryAndTestBucketFlagsSet() {
@@ -124,7 +129,7 @@ func TestSmallCacheTTLTest(t *testing.T) {
 		{"--implicit-dirs=true"},
 		{"--implicit-dirs=false"},
 	}
-	setup.AppendFlagsToAllFlagsInTheFlagsSet(&flagsSet, "--config-file="+createConfigFile(cacheCapacityInMB, false, configFileName))
+	setup.AppendFlagsToAllFlagsInTheFlagsSet(&flagsSet, "--config-file="+ts.env.createConfigFile(cacheCapacityInMB, false, configFileName))
 	setup.AppendFlagsToAllFlagsInTheFlagsSet(&flagsSet, fmt.Sprintf("--stat-cache-ttl=%ds", metadataCacheTTlInSec))
 	setup.AppendFlagsToAllFlagsInTheFlagsSet(&flagsSet, "--o=ro", "")
 
@@ -18,7 +18,6 @@ package readonly_test
 import (
 	"os"
 	"path"
-	"syscall"
 	"testing"
 
 	"github.com/googlecloudplatform/gcsfuse/v2/tools/integration_tests/util/operations"
@@ -57,7 +56,7 @@ func TestReadFileFromBucketSubDirectory(t *testing.T) {
 }
 
 func checkIfNonExistentFileFailedToOpen(filePath string, t *testing.T) {
-	file, err := os.OpenFile(filePath, os.O_RDONLY|syscall.O_DIRECT, setup.FilePermission_0600)
+	file, err := os.OpenFile(filePath, os.O_RDONLY|operations.ODirect, setup.FilePermission_0600)
 
 	checkErrorForObjectNotExist(err, t)
 
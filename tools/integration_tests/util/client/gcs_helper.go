@@ -48,9 +48,12 @@ const (
 
 func CreateImplicitDir(ctx context.Context, storageClient *storage.Client,
 	testDirName string, t *testing.T) {
-	err := CreateObjectOnGCS(
-		ctx,
-		storageClient,
+	CreateImplicitDirInEnv(setup.DefaultTestEnv(ctx, storageClient), testDirName, t)
+}
+
+func CreateImplicitDirInEnv(env *setup.TestEnv, testDirName string, t *testing.T) {
+	err := CreateObjectOnGCSInEnv(
+		env,
 		path.Join(testDirName, ImplicitDirName, ImplicitFileName1),
 		GCSFileContent)
 	if err != nil {
@@ -60,7 +63,11 @@ func CreateImplicitDir(ctx context.Context, storageClient *storage.Client,
 
 func ValidateObjectNotFoundErrOnGCS(ctx context.Context, storageClient *storage.Client,
 	testDirName string, fileName string, t *testing.T) {
-	_, err := ReadObjectFromGCS(ctx, storageClient, path.Join(testDirName, fileName))
+	ValidateObjectNotFoundErrOnGCSInEnv(setup.DefaultTestEnv(ctx, storageClient), testDirName, fileName, t)
+}
+
+func ValidateObjectNotFoundErrOnGCSInEnv(env *setup.TestEnv, testDirName string, fileName string, t *testing.T) {
+	_, err := ReadObjectFromGCSInEnv(env, path.Join(testDirName, fileName))
 	if err == nil || !strings.Contains(err.Error(), "storage: object doesn't exist") {
 		t.Fatalf("Incorrect error returned from GCS for file %s: %v", fileName, err)
 	}
@@ -68,7 +75,12 @@ func ValidateObjectNotFoundErrOnGCS(ctx context.Context, storageClient *storage.
 
 func ValidateObjectContentsFromGCS(ctx context.Context, storageClient *storage.Client,
 	testDirName string, fileName string, expectedContent string, t *testing.T) {
-	gotContent, err := ReadObjectFromGCS(ctx, storageClient, path.Join(testDirName, fileName))
+	ValidateObjectContentsFromGCSInEnv(setup.DefaultTestEnv(ctx, storageClient), testDirName, fileName, expectedContent, t)
+}
+
+func ValidateObjectContentsFromGCSInEnv(env *setup.TestEnv, testDirName string,
+	fileName string, expectedContent string, t *testing.T) {
+	gotContent, err := ReadObjectFromGCSInEnv(env, path.Join(testDirName, fileName))
 	if err != nil {
 		t.Fatalf("Error while reading file from GCS, Err: %v", err)
 	}
@@ -81,8 +93,13 @@ func ValidateObjectContentsFromGCS(ctx context.Context, storageClient *storage.C
 func ValidateObjectChunkFromGCS(ctx context.Context, storageClient *storage.Client,
 	testDirName string, fileName string, offset, size int64, expectedContent string,
 	t *testing.T) {
-	gotContent, err := ReadChunkFromGCS(ctx, storageClient,
-		path.Join(testDirName, fileName), offset, size)
+	ValidateObjectChunkFromGCSInEnv(setup.DefaultTestEnv(ctx, storageClient),
+		testDirName, fileName, offset, size, expectedContent, t)
+}
+
+func ValidateObjectChunkFromGCSInEnv(env *setup.TestEnv, testDirName string,
+	fileName string, offset, size int64, expectedContent string, t *testing.T) {
+	gotContent, err := ReadChunkFromGCSInEnv(env, path.Join(testDirName, fileName), offset, size)
 	if err != nil {
 		t.Fatalf("Error while reading file from GCS, Err: %v", err)
 	}
@@ -95,16 +112,26 @@ func ValidateObjectChunkFromGCS(ctx context.Context, storageClient *storage.Clie
 
 func CloseFileAndValidateContentFromGCS(ctx context.Context, storageClient *storage.Client,
 	fh *os.File, testDirName, fileName, content string, t *testing.T) {
+	CloseFileAndValidateContentFromGCSInEnv(setup.DefaultTestEnv(ctx, storageClient), fh, testDirName, fileName, content, t)
+}
+
+func CloseFileAndValidateContentFromGCSInEnv(env *setup.TestEnv, fh *os.File,
+	testDirName, fileName, content string, t *testing.T) {
 	operations.CloseFileShouldNotThrowError(fh, t)
-	ValidateObjectContentsFromGCS(ctx, storageClient, testDirName, fileName, content, t)
+	ValidateObjectContentsFromGCSInEnv(env, testDirName, fileName, content, t)
 }
 
 func CreateLocalFileInTestDir(ctx context.Context, storageClient *storage.Client,
 	testDirPath, fileName string, t *testing.T) (string, *os.File) {
+	return CreateLocalFileInTestDirInEnv(setup.DefaultTestEnv(ctx, storageClient), testDirPath, fileName, t)
+}
+
+func CreateLocalFileInTestDirInEnv(env *setup.TestEnv, testDirPath, fileName string,
+	t *testing.T) (string, *os.File) {
 	filePath := path.Join(testDirPath, fileName)
 	fh := operations.CreateFile(filePath, FilePerms, t)
 	testDirName := GetDirName(testDirPath)
-	ValidateObjectNotFoundErrOnGCS(ctx, storageClient, testDirName, fileName, t)
+	ValidateObjectNotFoundErrOnGCSInEnv(env, testDirName, fileName, t)
 	return filePath, fh
 }
 
@@ -115,8 +142,13 @@ func GetDirName(testDirPath string) string {
 
 func CreateObjectInGCSTestDir(ctx context.Context, storageClient *storage.Client,
 	testDirName, fileName, content string, t *testing.T) {
+	CreateObjectInGCSTestDirInEnv(setup.DefaultTestEnv(ctx, storageClient), testDirName, fileName, content, t)
+}
+
+func CreateObjectInGCSTestDirInEnv(env *setup.TestEnv, testDirName, fileName,
+	content string, t *testing.T) {
 	objectName := path.Join(testDirName, fileName)
-	err := CreateObjectOnGCS(ctx, storageClient, objectName, content)
+	err := CreateObjectOnGCSInEnv(env, objectName, content)
 	if err != nil {
 		t.Fatalf("Create Object %s on GCS: %v.", objectName, err)
 	}
@@ -124,22 +156,31 @@ func CreateObjectInGCSTestDir(ctx context.Context, storageClient *storage.Client
 
 func SetupFileInTestDirectory(ctx context.Context, storageClient *storage.Client,
 	testDirName, testFileName string, size int64, t *testing.T) {
+	SetupFileInTestDirectoryInEnv(setup.DefaultTestEnv(ctx, storageClient), testDirName, testFileName, size, t)
+}
+
+func SetupFileInTestDirectoryInEnv(env *setup.TestEnv, testDirName,
+	testFileName string, size int64, t *testing.T) {
 	randomData, err := operations.GenerateRandomData(size)
 	randomDataString := string(randomData)
 	if err != nil {
 		t.Errorf("operations.GenerateRandomData: %v", err)
 	}
 	// Setup file with content in test directory.
-	CreateObjectInGCSTestDir(ctx, storageClient, testDirName, testFileName, randomDataString, t)
+	CreateObjectInGCSTestDirInEnv(env, testDirName, testFileName, randomDataString, t)
 }
 
 func SetupTestDirectory(ctx context.Context, storageClient *storage.Client, testDirName string) string {
-	testDirPath := path.Join(setup.MntDir(), testDirName)
-	err := DeleteAllObjectsWithPrefix(ctx, storageClient, path.Join(setup.OnlyDirMounted(), testDirName))
+	return SetupTestDirectoryInEnv(setup.DefaultTestEnv(ctx, storageClient), testDirName)
+}
+
+func SetupTestDirectoryInEnv(env *setup.TestEnv, testDirName string) string {
+	testDirPath := path.Join(env.MntDir, testDirName)
+	err := DeleteAllObjectsWithPrefixInEnv(env, path.Join(env.OnlyDir, testDirName))
 	if err != nil {
 		log.Printf("Failed to clean up test directory: %v", err)
 	}
-	err = CreateObjectOnGCS(ctx, storageClient, testDirName+"/", "")
+	err = CreateObjectOnGCSInEnv(env, testDirName+"/", "")
 	if err != nil {
 		log.Printf("Failed to create test directory: %v", err)
 	}
@@ -147,16 +188,24 @@ func SetupTestDirectory(ctx context.Context, storageClient *storage.Client, test
 }
 
 func CreateNFilesInDir(ctx context.Context, storageClient *storage.Client, numFiles int, fileName string, fileSize int64, dirName string, t *testing.T) (fileNames []string) {
+	return CreateNFilesInDirInEnv(setup.DefaultTestEnv(ctx, storageClient), numFiles, fileName, fileSize, dirName, t)
+}
+
+func CreateNFilesInDirInEnv(env *setup.TestEnv, numFiles int, fileName string, fileSize int64, dirName string, t *testing.T) (fileNames []string) {
 	for i := 0; i < numFiles; i++ {
 		testFileName := fileName + setup.GenerateRandomString(4)
 		fileNames = append(fileNames, testFileName)
-		SetupFileInTestDirectory(ctx, storageClient, dirName, testFileName, fileSize, t)
+		SetupFileInTestDirectoryInEnv(env, dirName, testFileName, fileSize, t)
 	}
 	return fileNames
 }
 
 func ValidateCRCWithGCS(gotCRC32Value uint32, objectPath string, ctx context.Context, storageClient *storage.Client, t *testing.T) {
-	attr, err := StatObject(ctx, storageClient, objectPath)
+	ValidateCRCWithGCSInEnv(setup.DefaultTestEnv(ctx, storageClient), gotCRC32Value, objectPath, t)
+}
+
+func ValidateCRCWithGCSInEnv(env *setup.TestEnv, gotCRC32Value uint32, objectPath string, t *testing.T) {
+	attr, err := StatObjectInEnv(env, objectPath)
 	if err != nil {
 		t.Errorf("Failed to fetch object attributes: %v", err)
 	}
@@ -40,10 +40,14 @@ func CreateStorageClient(ctx context.Context) (*storage.Client, error) {
 
 // ReadObjectFromGCS downloads the object from GCS and returns the data.
 func ReadObjectFromGCS(ctx context.Context, client *storage.Client, object string) (string, error) {
-	bucket, object := setup.GetBucketAndObjectBasedOnTypeOfMount(object)
+	return ReadObjectFromGCSInEnv(setup.DefaultTestEnv(ctx, client), object)
+}
+
+func ReadObjectFromGCSInEnv(env *setup.TestEnv, object string) (string, error) {
+	bucket, object := env.BucketAndObject(object)
 
 	// Create storage reader to read from GCS.
-	rc, err := client.Bucket(bucket).Object(object).NewReader(ctx)
+	rc, err := env.StorageClient.Bucket(bucket).Object(object).NewReader(env.Ctx)
 	if err != nil {
 		return "", fmt.Errorf("Object(%q).NewReader: %w", object, err)
 	}
@@ -60,10 +64,14 @@ func ReadObjectFromGCS(ctx context.Context, client *storage.Client, object strin
 // ReadChunkFromGCS downloads the object chunk from GCS and returns the data.
 func ReadChunkFromGCS(ctx context.Context, client *storage.Client, object string,
 	offset, size int64) (string, error) {
-	bucket, object := setup.GetBucketAndObjectBasedOnTypeOfMount(object)
+	return ReadChunkFromGCSInEnv(setup.DefaultTestEnv(ctx, client), object, offset, size)
+}
+
+func ReadChunkFromGCSInEnv(env *setup.TestEnv, object string, offset, size int64) (string, error) {
+	bucket, object := env.BucketAndObject(object)
 
 	// Create storage reader to read from GCS.
-	rc, err := client.Bucket(bucket).Object(object).NewRangeReader(ctx, offset, size)
+	rc, err := env.StorageClient.Bucket(bucket).Object(object).NewRangeReader(env.Ctx, offset, size)
 	if err != nil {
 		return "", fmt.Errorf("Object(%q).NewReader: %w", object, err)
 	}
@@ -78,15 +86,19 @@ func ReadChunkFromGCS(ctx context.Context, client *storage.Client, object string
 }
 
 func WriteToObject(ctx context.Context, client *storage.Client, object, content string, precondition storage.Conditions) error {
-	bucket, object := setup.GetBucketAndObjectBasedOnTypeOfMount(object)
+	return WriteToObjectInEnv(setup.DefaultTestEnv(ctx, client), object, content, precondition)
+}
+
+func WriteToObjectInEnv(env *setup.TestEnv, object, content string, precondition storage.Conditions) error {
+	bucket, object := env.BucketAndObject(object)
 
-	o := client.Bucket(bucket).Object(object)
+	o := env.StorageClient.Bucket(bucket).Object(object)
 	if !reflect.DeepEqual(precondition, storage.Conditions{}) {
 		o = o.If(precondition)
 	}
 
 	// Upload an object with storage.Writer.
-	wc := o.NewWriter(ctx)
+	wc := o.NewWriter(env.Ctx)
 	if _, err := io.WriteString(wc, content); err != nil {
 		return fmt.Errorf("io.WriteSTring: %w", err)
 	}
@@ -99,7 +111,11 @@ func WriteToObject(ctx context.Context, client *storage.Client, object, content
 
 // CreateObjectOnGCS creates an object with given name and content on GCS.
 func CreateObjectOnGCS(ctx context.Context, client *storage.Client, object, content string) error {
-	return WriteToObject(ctx, client, object, content, storage.Conditions{DoesNotExist: true})
+	return CreateObjectOnGCSInEnv(setup.DefaultTestEnv(ctx, client), object, content)
+}
+
+func CreateObjectOnGCSInEnv(env *setup.TestEnv, object, content string) error {
+	return WriteToObjectInEnv(env, object, content, storage.Conditions{DoesNotExist: true})
 }
 
 // CreateStorageClientWithTimeOut creates storage client with a configurable timeout and return a function to cancel the storage client
@@ -152,13 +168,17 @@ func DownloadObjectFromGCS(gcsFile string, destFileName string, t *testing.T) er
 }
 
 func DeleteObjectOnGCS(ctx context.Context, client *storage.Client, objectName string) error {
-	bucket, _ := setup.GetBucketAndObjectBasedOnTypeOfMount("")
+	return DeleteObjectOnGCSInEnv(setup.DefaultTestEnv(ctx, client), objectName)
+}
+
+func DeleteObjectOnGCSInEnv(env *setup.TestEnv, objectName string) error {
+	bucket, _ := env.BucketAndObject("")
 
 	// Get handle to the object
-	object := client.Bucket(bucket).Object(objectName)
+	object := env.StorageClient.Bucket(bucket).Object(objectName)
 
 	// Delete the object
-	err := object.Delete(ctx)
+	err := object.Delete(env.Ctx)
 	if err != nil {
 		return err
 	}
@@ -166,11 +186,15 @@ func DeleteObjectOnGCS(ctx context.Context, client *storage.Client, objectName s
 }
 
 func DeleteAllObjectsWithPrefix(ctx context.Context, client *storage.Client, prefix string) error {
-	bucket, _ := setup.GetBucketAndObjectBasedOnTypeOfMount("")
+	return DeleteAllObjectsWithPrefixInEnv(setup.DefaultTestEnv(ctx, client), prefix)
+}
+
+func DeleteAllObjectsWithPrefixInEnv(env *setup.TestEnv, prefix string) error {
+	bucket, _ := env.BucketAndObject("")
 
 	// Get an object iterator
 	query := &storage.Query{Prefix: prefix}
-	objectItr := client.Bucket(bucket).Objects(ctx, query)
+	objectItr := env.StorageClient.Bucket(bucket).Objects(env.Ctx, query)
 
 	// Iterate through objects with the specified prefix and delete them
 	for {
@@ -178,7 +202,7 @@ func DeleteAllObjectsWithPrefix(ctx context.Context, client *storage.Client, pre
 		if err == iterator.Done {
 			break
 		}
-		if err := DeleteObjectOnGCS(ctx, client, attrs.Name); err != nil {
+		if err := DeleteObjectOnGCSInEnv(env, attrs.Name); err != nil {
 			return err
 		}
 	}
@@ -186,9 +210,13 @@ func DeleteAllObjectsWithPrefix(ctx context.Context, client *storage.Client, pre
 }
 
 func StatObject(ctx context.Context, client *storage.Client, object string) (*storage.ObjectAttrs, error) {
-	bucket, object := setup.GetBucketAndObjectBasedOnTypeOfMount(object)
+	return StatObjectInEnv(setup.DefaultTestEnv(ctx, client), object)
+}
+
+func StatObjectInEnv(env *setup.TestEnv, object string) (*storage.ObjectAttrs, error) {
+	bucket, object := env.BucketAndObject(object)
 
-	attrs, err := client.Bucket(bucket).Object(object).Attrs(ctx)
+	attrs, err := env.StorageClient.Bucket(bucket).Object(object).Attrs(env.Ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -142,8 +142,8 @@ func parseFileCacheRequestLog(startTimeStampSec, startTimeStampNanos int64, logs
 // and performs the following operations:
 // 1. Fetches the structured log entry's chunk using filecache operation ID leveraging
 // opReverseMap (which stores a mapping of filecache operation id -> filehandle, chunk).
-// 2. Fetches IsSequential, CacheHit and Execution time from the log and
-// populates it in the chunk.
+// 2. Fetches IsSequential, CacheHit, Validation (if logged) and Execution time
+// from the log and populates it in the chunk.
 func parseFileCacheResponseLog(logs []string,
 	structuredLogs map[int64]*StructuredReadLogEntry,
 	opReverseMap map[string]*handleAndChunkIndex) error {
@@ -162,10 +162,15 @@ func parseFileCacheResponseLog(logs []string,
 		return fmt.Errorf("ReadFile LogEntry for handle %d not found", handle)
 	}
 
-	// Populate chunk IsSequential, CacheHit and Execution time
+	// Populate chunk IsSequential, CacheHit, Validation and Execution time
 	chunk := &logEntry.Chunks[chunkIndex]
 	chunk.IsSequential, _ = strconv.ParseBool(logs[4][:len(logs[4])-1]) //Remove trailing ","
-	chunk.CacheHit, _ = strconv.ParseBool(logs[6][:len(logs[6])-1])     //Remove trailing ","
-	chunk.ExecutionTime = logs[7][1 : len(logs[7])-1]                   //Remove prefix "(" and suffix ")"
+	chunk.CacheHit, _ = strconv.ParseBool(logs[6][:len(logs[6])-1])     //Remove trailing "," or ")"
+	executionTime := logs[7]
+	if strings.HasSuffix(logs[6], ",") {
+		chunk.Validation = logs[8][:len(logs[8])-1] //Remove trailing ")"
+		executionTime = logs[9]
+	}
+	chunk.ExecutionTime = executionTime[1 : len(executionTime)-1] //Remove prefix "(" and suffix ")"
 	return nil
 }
@@ -23,8 +23,6 @@ import (
 	"sort"
 	"strings"
 	"testing"
-
-	"github.com/googlecloudplatform/gcsfuse/v2/tools/integration_tests/util/setup"
 )
 
 func filterAndParseLogLine(logLine string,
@@ -125,7 +123,7 @@ func GetStructuredLogsSortedByTimestamp(logFilePath string, t *testing.T) []*Str
 	}
 	logsMap, err := ParseReadLogsFromLogFile(file)
 	if err != nil {
-		t.Errorf("Failed to parse logs %s correctly: %v", setup.LogFile(), err)
+		t.Errorf("Failed to parse logs %s correctly: %v", logFilePath, err)
 	}
 
 	// Create array from structured logs map.
@@ -116,6 +116,37 @@ func TestParseLogFileSuccessful(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "Test file cache logs with validation",
+			reader: bytes.NewReader([]byte(`{"timestamp": {"seconds": 1704458059, "nanos": 975956234}, "severity": "TRACE", "message": "fuse_debug: Op 0x00000182        connection.go:415] <- ReadFile (inode 6, PID 2382526, handle 29, offset 0, 4096 bytes)"}
+{"timestamp": {"seconds": 1704458060, "nanos": 976093794}, "severity": "TRACE", "message": "f41c82a2-c891 <- FileCache(redacted:/smallfile.txt, offset: 0, size: 4096 handle: 29)"}
+{"timestamp": {"seconds": 1704458061, "nanos": 270075223}, "severity": "TRACE", "message": "f41c82a2-c891 -> OK (isSeq: true, hit: false, validation: metadata_cache) (293.935998ms)"}`),
+			),
+			expected: map[int64]*read_logs.StructuredReadLogEntry{
+				handleId: {
+					Handle:           handleId,
+					StartTimeSeconds: readTimestampSeconds,
+					StartTimeNanos:   readTimestampNanos,
+					ProcessID:        pid,
+					InodeID:          inodeId,
+					BucketName:       bucketName,
+					ObjectName:       fileName,
+					Chunks: []read_logs.ReadChunkData{
+						{
+							StartTimeSeconds: chunkTimestampSeconds,
+							StartTimeNanos:   chunkTimestampNanos,
+							StartOffset:      0,
+							Size:             size,
+							CacheHit:         false,
+							IsSequential:     true,
+							Validation:       "metadata_cache",
+							OpID:             opId,
+							ExecutionTime:    executionTime,
+						},
+					},
+				},
+			},
+		},
 		{
 			name: "Test file cache logs with no parsable logs",
 			reader: bytes.NewReader([]byte(`{"timestamp": {"seconds": 1704458059, "nanos": 975956234}, "severity":"TRACE","message":"fuse_debug: Op 0x00000182        connection.go:497] -> OK ()"}
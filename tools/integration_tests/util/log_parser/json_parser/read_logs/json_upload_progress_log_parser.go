@@ -0,0 +1,105 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package read_logs
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	uploadProgressComponent = "upload_progress"
+	uploadFinishedMessage   = "Upload finished"
+)
+
+type uploadProgressRecord struct {
+	Timestamp struct {
+		Seconds int64 `json:"seconds"`
+		Nanos   int64 `json:"nanos"`
+	} `json:"timestamp"`
+	Message    string `json:"message"`
+	Component  string `json:"component"`
+	Object     string `json:"object"`
+	BytesSent  int64  `json:"bytes_sent"`
+	TotalBytes int64  `json:"total_bytes"`
+	Elapsed    string `json:"elapsed"`
+	Op         string `json:"op"`
+	OpID       uint64 `json:"op_id"`
+	Generation int64  `json:"generation"`
+}
+
+/*
+ParseUploadProgressLogsFromLogFile takes gcsfuse logs (json format) as input
+and returns the records of the upload_progress component in them, in the order
+they were logged:
+
+	[
+	  {
+	    "TimestampSeconds": 1704458059,
+	    "TimestampNanos": 975956234,
+	    "ObjectName": "dir/largefile.txt",
+	    "BytesSent": 67108864,
+	    "TotalBytes": 524288000,
+	    "Elapsed": "1.907320375s",
+	    "Op": "FlushFile",
+	    "OpID": 42,
+	    "Final": false,
+	    "Generation": 0
+	  },
+	  ...
+	]
+*/
+func ParseUploadProgressLogsFromLogFile(reader io.Reader) ([]UploadProgressLogEntry, error) {
+	lines, err := loadLogLines(reader)
+	if err != nil {
+		return nil, fmt.Errorf("loadLogLines: %v", err)
+	}
+
+	var entries []UploadProgressLogEntry
+	for _, line := range lines {
+		// Cheaply skip the lines of other components.
+		if !strings.Contains(line, uploadProgressComponent) {
+			continue
+		}
+
+		var record uploadProgressRecord
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			continue // Silently ignore the logs which are not in JSON format.
+		}
+		if record.Component != uploadProgressComponent {
+			continue
+		}
+
+		if record.Object == "" {
+			return nil, fmt.Errorf("upload progress record without object: %s", line)
+		}
+		entries = append(entries, UploadProgressLogEntry{
+			TimestampSeconds: record.Timestamp.Seconds,
+			TimestampNanos:   record.Timestamp.Nanos,
+			ObjectName:       record.Object,
+			BytesSent:        record.BytesSent,
+			TotalBytes:       record.TotalBytes,
+			Elapsed:          record.Elapsed,
+			Op:               record.Op,
+			OpID:             record.OpID,
+			Final:            record.Message == uploadFinishedMessage,
+			Generation:       record.Generation,
+		})
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,67 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package read_logs_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/tools/integration_tests/util/log_parser/json_parser/read_logs"
+	"github.com/googlecloudplatform/gcsfuse/v2/tools/integration_tests/util/setup"
+	. "github.com/jacobsa/oglematchers"
+	. "github.com/jacobsa/ogletest"
+)
+
+const uploadProgressLogs = `{"timestamp":{"seconds":1704458059,"nanos":975956234},"severity":"TRACE","message":"fuse_debug: Op 0x00000184        connection.go:415] <- FlushFile (inode 6, PID 2382526)"}
+{"timestamp":{"seconds":1704458060,"nanos":1000},"severity":"INFO","message":"Upload progress","component":"upload_progress","object":"largefile.txt","op":"FlushFile","op_id":388,"bytes_sent":67108864,"total_bytes":209715200,"elapsed":"1.2s"}
+{"timestamp":{"seconds":1704458061,"nanos":2000},"severity":"INFO","message":"Upload progress","component":"upload_progress","object":"largefile.txt","op":"FlushFile","op_id":388,"bytes_sent":134217728,"total_bytes":209715200,"elapsed":"2.3s"}
+{"timestamp":{"seconds":1704458061,"nanos":3000},"severity":"TRACE","message":"gcs: Req              0x7c: -> CreateObject(\"largefile.txt\") (2.9s): OK"}
+{"timestamp":{"seconds":1704458062,"nanos":4000},"severity":"INFO","message":"Upload progress","component":"upload_progress","object":"largefile.txt","op":"FlushFile","op_id":388,"bytes_sent":201326592,"total_bytes":209715200,"elapsed":"3.4s"}
+{"timestamp":{"seconds":1704458062,"nanos":5000},"severity":"INFO","message":"Upload finished","component":"upload_progress","object":"largefile.txt","op":"FlushFile","op_id":388,"bytes_sent":209715200,"total_bytes":209715200,"elapsed":"3.5s","generation":1704458062005000}`
+
+func TestParseUploadProgressLogsSuccessful(t *testing.T) {
+	setup.IgnoreTestIfIntegrationTestFlagIsSet(t)
+
+	entries, err := read_logs.ParseUploadProgressLogsFromLogFile(bytes.NewReader([]byte(uploadProgressLogs)))
+
+	AssertEq(nil, err)
+	AssertEq(4, len(entries))
+	// The offsets should increase monotonically up to the total size.
+	var prev int64
+	for i, entry := range entries {
+		ExpectEq("largefile.txt", entry.ObjectName)
+		ExpectEq(209715200, entry.TotalBytes)
+		ExpectEq("FlushFile", entry.Op)
+		ExpectEq(388, entry.OpID)
+		ExpectGt(entry.BytesSent, prev)
+		ExpectLe(entry.BytesSent, entry.TotalBytes)
+		ExpectEq(i == len(entries)-1, entry.Final)
+		prev = entry.BytesSent
+	}
+	last := entries[len(entries)-1]
+	ExpectEq(last.TotalBytes, last.BytesSent)
+	ExpectEq(1704458062005000, last.Generation)
+	ExpectEq(1704458060, entries[0].TimestampSeconds)
+	ExpectEq(1000, entries[0].TimestampNanos)
+	ExpectEq("1.2s", entries[0].Elapsed)
+}
+
+func TestParseUploadProgressLogsWithoutObject(t *testing.T) {
+	setup.IgnoreTestIfIntegrationTestFlagIsSet(t)
+
+	_, err := read_logs.ParseUploadProgressLogsFromLogFile(bytes.NewReader([]byte(`{"timestamp":{"seconds":1704458060,"nanos":1000},"severity":"INFO","message":"Upload progress","component":"upload_progress","bytes_sent":67108864,"total_bytes":209715200,"elapsed":"1.2s"}`)))
+
+	ExpectThat(err, Error(HasSubstr("upload progress record without object")))
+}
@@ -36,8 +36,29 @@ type ReadChunkData struct {
 	Size             int64
 	CacheHit         bool
 	IsSequential     bool
-	OpID             string
-	ExecutionTime    string
+	// How the object's generation was validated before the first read of a
+	// handle from the file cache: "metadata_cache" or "stat". Empty for later
+	// reads.
+	Validation    string
+	OpID          string
+	ExecutionTime string
+}
+
+// UploadProgressLogEntry stores a record of the progress of an upload, logged
+// by the upload_progress component.
+type UploadProgressLogEntry struct {
+	TimestampSeconds int64
+	TimestampNanos   int64
+	ObjectName       string
+	BytesSent        int64
+	TotalBytes       int64
+	Elapsed          string
+	Op               string
+	OpID             uint64
+	// Final is set for the record logged once the upload has finished, which
+	// carries the generation of the new object.
+	Final      bool
+	Generation int64
 }
 
 ////////////////////////////////////////////////////////////////////////
@@ -15,6 +15,7 @@
 package dynamic_mounting
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"path"
@@ -33,18 +34,22 @@ const PrefixBucketForDynamicMountingTest = "golang-grpc-test-gcsfuse-dynamic-mou
 var testBucketForDynamicMounting = PrefixBucketForDynamicMountingTest + setup.GenerateRandomString(5)
 
 func MountGcsfuseWithDynamicMounting(flags []string) (err error) {
+	return MountGcsfuseWithDynamicMountingInEnv(setup.DefaultTestEnv(context.Background(), nil), flags)
+}
+
+func MountGcsfuseWithDynamicMountingInEnv(env *setup.TestEnv, flags []string) (err error) {
 	defaultArg := []string{"--debug_gcs",
 		"--debug_fs",
 		"--debug_fuse",
-		"--log-file=" + setup.LogFile(),
+		"--log-file=" + env.LogFile,
 		"--log-format=text",
-		setup.MntDir()}
+		env.RootDir}
 
 	for i := 0; i < len(defaultArg); i++ {
 		flags = append(flags, defaultArg[i])
 	}
 
-	err = mounting.MountGcsfuse(setup.BinFile(), flags)
+	err = mounting.MountGcsfuseInEnv(env, setup.BinFile(), flags)
 
 	return err
 }
@@ -15,6 +15,7 @@
 package mounting
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
@@ -25,13 +26,19 @@ import (
 )
 
 func MountGcsfuse(binaryFile string, flags []string) error {
+	return MountGcsfuseInEnv(setup.DefaultTestEnv(context.Background(), nil), binaryFile, flags)
+}
+
+// MountGcsfuseInEnv runs binaryFile with flags, recording the command in
+// env.LogFile.
+func MountGcsfuseInEnv(env *setup.TestEnv, binaryFile string, flags []string) error {
 	mountCmd := exec.Command(
 		binaryFile,
 		flags...,
 	)
 
 	// Adding mount command in LogFile
-	file, err := os.OpenFile(setup.LogFile(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	file, err := os.OpenFile(env.LogFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
 		fmt.Println("Could not open logfile")
 	}
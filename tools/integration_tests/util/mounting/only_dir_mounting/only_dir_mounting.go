@@ -15,6 +15,7 @@
 package only_dir_mounting
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"path"
@@ -27,21 +28,25 @@ import (
 const DirectoryInTestBucket = "Test"
 
 func MountGcsfuseWithOnlyDir(flags []string) (err error) {
+	return MountGcsfuseWithOnlyDirInEnv(setup.DefaultTestEnv(context.Background(), nil), flags)
+}
+
+func MountGcsfuseWithOnlyDirInEnv(env *setup.TestEnv, flags []string) (err error) {
 	defaultArg := []string{"--only-dir",
-		setup.OnlyDirMounted(),
+		env.OnlyDir,
 		"--debug_gcs",
 		"--debug_fs",
 		"--debug_fuse",
-		"--log-file=" + setup.LogFile(),
+		"--log-file=" + env.LogFile,
 		"--log-format=text",
-		setup.TestBucket(),
-		setup.MntDir()}
+		env.Bucket,
+		env.RootDir}
 
 	for i := 0; i < len(defaultArg); i++ {
 		flags = append(flags, defaultArg[i])
 	}
 
-	err = mounting.MountGcsfuse(setup.BinFile(), flags)
+	err = mounting.MountGcsfuseInEnv(env, setup.BinFile(), flags)
 
 	return err
 }
@@ -15,6 +15,7 @@
 package static_mounting
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"testing"
@@ -24,19 +25,23 @@ import (
 )
 
 func MountGcsfuseWithStaticMounting(flags []string) (err error) {
+	return MountGcsfuseWithStaticMountingInEnv(setup.DefaultTestEnv(context.Background(), nil), flags)
+}
+
+func MountGcsfuseWithStaticMountingInEnv(env *setup.TestEnv, flags []string) (err error) {
 	defaultArg := []string{"--debug_gcs",
 		"--debug_fs",
 		"--debug_fuse",
-		"--log-file=" + setup.LogFile(),
+		"--log-file=" + env.LogFile,
 		"--log-format=text",
-		setup.TestBucket(),
-		setup.MntDir()}
+		env.Bucket,
+		env.RootDir}
 
 	for i := 0; i < len(defaultArg); i++ {
 		flags = append(flags, defaultArg[i])
 	}
 
-	err = mounting.MountGcsfuse(setup.BinFile(), flags)
+	err = mounting.MountGcsfuseInEnv(env, setup.BinFile(), flags)
 
 	return err
 }
@@ -27,7 +27,6 @@ import (
 	"path"
 	"strconv"
 	"strings"
-	"syscall"
 	"testing"
 	"time"
 )
@@ -52,7 +51,7 @@ func copyFile(srcFileName, dstFileName string, allowOverwrite bool) (err error)
 		}
 	}
 
-	source, err := os.OpenFile(srcFileName, syscall.O_DIRECT, FilePermission_0600)
+	source, err := os.OpenFile(srcFileName, ODirect, FilePermission_0600)
 	if err != nil {
 		err = fmt.Errorf("file %s opening error: %v", srcFileName, err)
 		return
@@ -94,7 +93,7 @@ func CopyFileAllowOverwrite(srcFileName, newFileName string) (err error) {
 }
 
 func ReadFile(filePath string) (content []byte, err error) {
-	file, err := os.OpenFile(filePath, os.O_RDONLY|syscall.O_DIRECT, FilePermission_0600)
+	file, err := os.OpenFile(filePath, os.O_RDONLY|ODirect, FilePermission_0600)
 	if err != nil {
 		err = fmt.Errorf("Error in the opening the file %v", err)
 		return
@@ -134,7 +133,7 @@ func RenameFile(fileName string, newFileName string) (err error) {
 }
 
 func WriteFileInAppendMode(fileName string, content string) (err error) {
-	f, err := os.OpenFile(fileName, os.O_APPEND|os.O_WRONLY|syscall.O_DIRECT, FilePermission_0600)
+	f, err := os.OpenFile(fileName, os.O_APPEND|os.O_WRONLY|ODirect, FilePermission_0600)
 	if err != nil {
 		err = fmt.Errorf("Open file for append: %v", err)
 		return
@@ -149,7 +148,7 @@ func WriteFileInAppendMode(fileName string, content string) (err error) {
 }
 
 func WriteFile(fileName string, content string) (err error) {
-	f, err := os.OpenFile(fileName, os.O_RDWR|syscall.O_DIRECT, FilePermission_0600)
+	f, err := os.OpenFile(fileName, os.O_RDWR|ODirect, FilePermission_0600)
 	if err != nil {
 		err = fmt.Errorf("Open file for write at start: %v", err)
 		return
@@ -180,7 +179,7 @@ func ReadFileSequentially(filePath string, chunkSize int64) (content []byte, err
 	chunk := make([]byte, chunkSize)
 	var offset int64 = 0
 
-	file, err := os.OpenFile(filePath, os.O_RDONLY|syscall.O_DIRECT, FilePermission_0600)
+	file, err := os.OpenFile(filePath, os.O_RDONLY|ODirect, FilePermission_0600)
 	if err != nil {
 		log.Printf("Error in opening file: %v", err)
 	}
@@ -248,7 +247,7 @@ func WriteChunkOfRandomBytesToFile(file *os.File, chunkSize int, offset int64) e
 }
 
 func WriteFileSequentially(filePath string, fileSize int64, chunkSize int64) (err error) {
-	file, err := os.OpenFile(filePath, os.O_RDWR|syscall.O_DIRECT|os.O_CREATE, FilePermission_0600)
+	file, err := os.OpenFile(filePath, os.O_RDWR|ODirect|os.O_CREATE, FilePermission_0600)
 	if err != nil {
 		log.Fatalf("Error in opening file: %v", err)
 	}
@@ -325,7 +324,7 @@ func StatFile(file string) (*fs.FileInfo, error) {
 }
 
 func openFileAsReadonly(filepath string) (*os.File, error) {
-	f, err := os.OpenFile(filepath, os.O_RDONLY|syscall.O_DIRECT, FilePermission_0400)
+	f, err := os.OpenFile(filepath, os.O_RDONLY|ODirect, FilePermission_0400)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open file %s as readonly: %v", filepath, err)
 	}
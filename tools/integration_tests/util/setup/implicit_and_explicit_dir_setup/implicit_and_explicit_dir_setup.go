@@ -15,6 +15,7 @@
 package implicit_and_explicit_dir_setup
 
 import (
+	"context"
 	"log"
 	"os"
 	"path"
@@ -73,6 +74,10 @@ func RemoveAndCheckIfDirIsDeleted(dirPath string, dirName string, t *testing.T)
 }
 
 func CreateImplicitDirectoryStructure(testDir string) {
+	CreateImplicitDirectoryStructureInEnv(setup.DefaultTestEnv(context.Background(), nil), testDir)
+}
+
+func CreateImplicitDirectoryStructureInEnv(env *setup.TestEnv, testDir string) {
 	// Implicit Directory Structure
 	// testBucket/testDir/implicitDirectory                                                  -- Dir
 	// testBucket/testDir/implicitDirectory/fileInImplicitDir1                               -- File
@@ -80,22 +85,26 @@ func CreateImplicitDirectoryStructure(testDir string) {
 	// testBucket/testDir/implicitDirectory/implicitSubDirectory/fileInImplicitDir2          -- File
 
 	// Create implicit directory in bucket for testing.
-	setup.RunScriptForTestData("../util/setup/implicit_and_explicit_dir_setup/testdata/create_objects.sh", path.Join(setup.TestBucket(), testDir))
+	setup.RunScriptForTestData("../util/setup/implicit_and_explicit_dir_setup/testdata/create_objects.sh", path.Join(env.Bucket, testDir))
 }
 
 func CreateExplicitDirectoryStructure(testDir string, t *testing.T) {
+	CreateExplicitDirectoryStructureInEnv(setup.DefaultTestEnv(context.Background(), nil), testDir, t)
+}
+
+func CreateExplicitDirectoryStructureInEnv(env *setup.TestEnv, testDir string, t *testing.T) {
 	// Explicit Directory structure
 	// testBucket/testDir/explicitDirectory                            -- Dir
 	// testBucket/testDir/explictFile                                  -- File
 	// testBucket/testDir/explicitDirectory/fileInExplicitDir1         -- File
 	// testBucket/testDir/explicitDirectory/fileInExplicitDir2         -- File
 
-	dirPath := path.Join(setup.MntDir(), testDir, ExplicitDirectory)
+	dirPath := path.Join(env.MntDir, testDir, ExplicitDirectory)
 	operations.CreateDirectoryWithNFiles(NumberOfFilesInExplicitDirectory, dirPath, PrefixFileInExplicitDirectory, t)
-	filePath := path.Join(setup.MntDir(), testDir, ExplicitFile)
+	filePath := path.Join(env.MntDir, testDir, ExplicitFile)
 	file, err := os.Create(filePath)
 	if err != nil {
-		t.Errorf("Create file at %q: %v", setup.MntDir(), err)
+		t.Errorf("Create file at %q: %v", env.MntDir, err)
 	}
 
 	// Closing file at the end.
@@ -103,6 +112,10 @@ func CreateExplicitDirectoryStructure(testDir string, t *testing.T) {
 }
 
 func CreateImplicitDirectoryInExplicitDirectoryStructure(testDir string, t *testing.T) {
+	CreateImplicitDirectoryInExplicitDirectoryStructureInEnv(setup.DefaultTestEnv(context.Background(), nil), testDir, t)
+}
+
+func CreateImplicitDirectoryInExplicitDirectoryStructureInEnv(env *setup.TestEnv, testDir string, t *testing.T) {
 	// testBucket/testDir/explicitDirectory                                                                   -- Dir
 	// testBucket/testDir/explictFile                                                                         -- File
 	// testBucket/testDir/explicitDirectory/fileInExplicitDir1                                                -- File
@@ -112,7 +125,7 @@ func CreateImplicitDirectoryInExplicitDirectoryStructure(testDir string, t *test
 	// testBucket/testDir/explicitDirectory/implicitDirectory/implicitSubDirectory                            -- Dir
 	// testBucket/testDir/explicitDirectory/implicitDirectory/implicitSubDirectory/fileInImplicitDir2         -- File
 
-	CreateExplicitDirectoryStructure(testDir, t)
-	dirPathInBucket := path.Join(setup.TestBucket(), testDir, ExplicitDirectory)
+	CreateExplicitDirectoryStructureInEnv(env, testDir, t)
+	dirPathInBucket := path.Join(env.Bucket, testDir, ExplicitDirectory)
 	setup.RunScriptForTestData("../util/setup/implicit_and_explicit_dir_setup/testdata/create_objects.sh", dirPathInBucket)
 }
@@ -25,6 +25,7 @@ import (
 	"path/filepath"
 	"runtime/debug"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -47,14 +48,17 @@ const (
 	PathEnvVariable     = "PATH"
 )
 
+// The mount set up by TestMain, for the helpers that don't take a TestEnv.
 var (
-	binFile              string
-	logFile              string
-	testDir              string
-	mntDir               string
-	sbinFile             string
-	onlyDirMounted       string
-	dynamicBucketMounted string
+	mu sync.RWMutex
+
+	binFile              string // GUARDED_BY(mu)
+	logFile              string // GUARDED_BY(mu)
+	testDir              string // GUARDED_BY(mu)
+	mntDir               string // GUARDED_BY(mu)
+	sbinFile             string // GUARDED_BY(mu)
+	onlyDirMounted       string // GUARDED_BY(mu)
+	dynamicBucketMounted string // GUARDED_BY(mu)
 )
 
 // Run the shell script to prepare the testData in the specified bucket.
@@ -81,58 +85,84 @@ func MountedDirectory() string {
 }
 
 func SetLogFile(logFileValue string) {
+	mu.Lock()
+	defer mu.Unlock()
 	logFile = logFileValue
 }
 
 func LogFile() string {
+	mu.RLock()
+	defer mu.RUnlock()
 	return logFile
 }
 
 func SetBinFile(binFileValue string) {
+	mu.Lock()
+	defer mu.Unlock()
 	binFile = binFileValue
 }
 
 func BinFile() string {
+	mu.RLock()
+	defer mu.RUnlock()
 	return binFile
 }
 
 func SbinFile() string {
+	mu.RLock()
+	defer mu.RUnlock()
 	return sbinFile
 }
 
 func SetTestDir(testDirValue string) {
+	mu.Lock()
+	defer mu.Unlock()
 	testDir = testDirValue
 }
 
 func TestDir() string {
+	mu.RLock()
+	defer mu.RUnlock()
 	return testDir
 }
 
 func SetMntDir(mntDirValue string) {
+	mu.Lock()
+	defer mu.Unlock()
 	mntDir = mntDirValue
 }
 
 func MntDir() string {
+	mu.RLock()
+	defer mu.RUnlock()
 	return mntDir
 }
 
 // OnlyDirMounted returns the name of the directory mounted in case of only dir mount.
 func OnlyDirMounted() string {
+	mu.RLock()
+	defer mu.RUnlock()
 	return onlyDirMounted
 }
 
 // SetOnlyDirMounted sets the name of the directory mounted in case of only dir mount.
 func SetOnlyDirMounted(onlyDirValue string) {
+	mu.Lock()
+	defer mu.Unlock()
 	onlyDirMounted = onlyDirValue
 }
 
 // DynamicBucketMounted returns the name of the bucket in case of dynamic mount.
 func DynamicBucketMounted() string {
+	mu.RLock()
+	defer mu.RUnlock()
 	return dynamicBucketMounted
 }
 
 // SetDynamicBucketMounted sets the name of the bucket in case of dynamic mount.
 func SetDynamicBucketMounted(dynamicBucketValue string) {
+	mu.Lock()
+	defer mu.Unlock()
 	dynamicBucketMounted = dynamicBucketValue
 }
 
@@ -148,49 +178,60 @@ func CompareFileContents(t *testing.T, fileName string, fileContent string) {
 }
 
 func SetUpTestDir() error {
-	var err error
-	testDir, err = os.MkdirTemp("", "gcsfuse_readwrite_test_")
+	dir, err := os.MkdirTemp("", "gcsfuse_readwrite_test_")
 	if err != nil {
 		return fmt.Errorf("TempDir: %w\n", err)
 	}
 
+	var bin, sbin string
 	if !TestInstalledPackage() {
-		err = util.BuildGcsfuse(testDir)
+		err = util.BuildGcsfuse(dir)
 		if err != nil {
-			return fmt.Errorf("BuildGcsfuse(%q): %w\n", TestDir(), err)
+			return fmt.Errorf("BuildGcsfuse(%q): %w\n", dir, err)
 		}
-		binFile = path.Join(TestDir(), "bin/gcsfuse")
-		sbinFile = path.Join(TestDir(), "sbin/mount.gcsfuse")
+		bin = path.Join(dir, "bin/gcsfuse")
+		sbin = path.Join(dir, "sbin/mount.gcsfuse")
 
 		// mount.gcsfuse will find gcsfuse executable in mentioned locations.
 		// https://github.com/GoogleCloudPlatform/gcsfuse/blob/master/tools/mount_gcsfuse/find.go#L59
 		// Setting PATH so that executable is found in test directory.
-		err := os.Setenv(PathEnvVariable, path.Join(TestDir(), "bin")+string(filepath.ListSeparator)+os.Getenv(PathEnvVariable))
+		err := os.Setenv(PathEnvVariable, path.Join(dir, "bin")+string(filepath.ListSeparator)+os.Getenv(PathEnvVariable))
 		if err != nil {
 			log.Printf("Error in setting PATH environment variable: %v", err.Error())
 		}
 	} else {
 		// when testInstalledPackage flag is set, gcsfuse is preinstalled on the
 		// machine. Hence, here we are overwriting binFile to gcsfuse.
-		binFile = "gcsfuse"
-		sbinFile = "mount.gcsfuse"
+		bin = "gcsfuse"
+		sbin = "mount.gcsfuse"
 	}
-	logFile = path.Join(TestDir(), "gcsfuse.log")
-	mntDir = path.Join(TestDir(), "mnt")
+	mnt := path.Join(dir, "mnt")
 
-	err = os.Mkdir(mntDir, 0755)
+	err = os.Mkdir(mnt, 0755)
 	if err != nil {
-		return fmt.Errorf("Mkdir(%q): %v\n", MntDir(), err)
+		return fmt.Errorf("Mkdir(%q): %v\n", mnt, err)
 	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	testDir = dir
+	binFile = bin
+	sbinFile = sbin
+	logFile = path.Join(dir, "gcsfuse.log")
+	mntDir = mnt
 	return nil
 }
 
 func UnMount() error {
+	return unmount(MntDir())
+}
+
+func unmount(dir string) error {
 	fusermount, err := exec.LookPath("fusermount")
 	if err != nil {
 		return fmt.Errorf("cannot find fusermount: %w", err)
 	}
-	cmd := exec.Command(fusermount, "-uz", mntDir)
+	cmd := exec.Command(fusermount, "-uz", dir)
 	if _, err := cmd.CombinedOutput(); err != nil {
 		return fmt.Errorf("fusermount error: %w", err)
 	}
@@ -224,7 +265,7 @@ func SaveLogFileInCaseOfFailure(successCode int) {
 		failedlogsFileName := "gcsfuse-failed-integration-test-logs-" + GenerateRandomString(5)
 		log.Printf("log file is available on kokoro artifacts with file name: %s", failedlogsFileName)
 		logFileInKokoroArtifact := path.Join(os.Getenv("KOKORO_ARTIFACTS_DIR"), failedlogsFileName)
-		err := operations.CopyFile(logFile, logFileInKokoroArtifact)
+		err := operations.CopyFile(LogFile(), logFileInKokoroArtifact)
 		if err != nil {
 			log.Fatalf("Error in coping logfile in kokoro artifact: %v", err)
 		}
@@ -292,7 +333,7 @@ func ExitWithFailureIfMountedDirectoryIsSetOrTestBucketIsNotSet() {
 func RunTestsForMountedDirectoryFlag(m *testing.M) {
 	// Execute tests for the mounted directory.
 	if *mountedDirectory != "" {
-		mntDir = *mountedDirectory
+		SetMntDir(*mountedDirectory)
 		successCode := ExecuteTest(m)
 		os.Exit(successCode)
 	}
@@ -353,20 +394,18 @@ func CleanUpDir(directoryPath string) {
 }
 
 // CleanMntDir cleans the mounted directory.
+//
+// Deprecated: use TestEnv.CleanMntDir.
 func CleanMntDir() {
-	CleanUpDir(mntDir)
+	defaultTestEnv().CleanMntDir()
 }
 
 // SetupTestDirectory creates a testDirectory in the mounted directory and cleans up
 // any content present in it.
+//
+// Deprecated: use TestEnv.SetupTestDirectory.
 func SetupTestDirectory(testDirName string) string {
-	testDirPath := path.Join(MntDir(), testDirName)
-	err := os.Mkdir(testDirPath, DirPermission_0755)
-	if err != nil && !strings.Contains(err.Error(), "file exists") {
-		log.Printf("Error while setting up directory %s for testing: %v", testDirPath, err)
-	}
-	CleanUpDir(testDirPath)
-	return testDirPath
+	return defaultTestEnv().SetupTestDirectory(testDirName)
 }
 
 // CleanupDirectoryOnGCS cleans up the object/directory path passed in parameter.
@@ -393,24 +432,9 @@ func separateBucketAndObjectName(bucket, object string) (string, string) {
 	return bucket, object
 }
 
+// Deprecated: use TestEnv.BucketAndObject.
 func GetBucketAndObjectBasedOnTypeOfMount(object string) (string, string) {
-	bucket := TestBucket()
-	if strings.Contains(TestBucket(), "/") {
-		// This case arises when we run tests on mounted directory and pass
-		// bucket/directory in testbucket flag.
-		bucket, object = separateBucketAndObjectName(bucket, object)
-	}
-	if dynamicBucketMounted != "" {
-		bucket = dynamicBucketMounted
-	}
-	if OnlyDirMounted() != "" {
-		var suffix string
-		if strings.HasSuffix(object, "/") {
-			suffix = "/"
-		}
-		object = path.Join(OnlyDirMounted(), object) + suffix
-	}
-	return bucket, object
+	return defaultTestEnv().BucketAndObject(object)
 }
 
 func MountGCSFuseWithGivenMountFunc(flags []string, mountFunc func([]string) error) {
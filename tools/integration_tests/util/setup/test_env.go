@@ -0,0 +1,195 @@
+// Copyright 2024 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package setup
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/storage"
+)
+
+// TestEnv describes one gcsfuse mount and the GCS client used to check it.
+// Helpers that take a TestEnv read nothing from the package globals, so
+// tests that each own an env can run in parallel.
+type TestEnv struct {
+	Ctx           context.Context
+	StorageClient *storage.Client
+
+	// Bucket is the value of --testbucket; on a mounted directory it may be
+	// bucket/dir.
+	Bucket string
+	// DynamicBucket is the bucket under RootDir the tests run in, or "" for a
+	// static mount.
+	DynamicBucket string
+	// OnlyDir is the --only-dir value of the mount, or "".
+	OnlyDir string
+
+	// RootDir is the mount point; MntDir is where tests create their files.
+	// They differ only for dynamic mounts.
+	RootDir string
+	MntDir  string
+	LogFile string
+	// TestDir holds the env's config and cache files.
+	TestDir string
+}
+
+// NewTestEnv creates an env with its own mount point and log file under
+// TestDir()/name. When tests run on --mountedDirectory the env shares that
+// mount instead.
+func NewTestEnv(ctx context.Context, storageClient *storage.Client, name string) (*TestEnv, error) {
+	env := &TestEnv{
+		Ctx:           ctx,
+		StorageClient: storageClient,
+		Bucket:        TestBucket(),
+	}
+	if MountedDirectory() != "" {
+		env.RootDir = MountedDirectory()
+		env.MntDir = MountedDirectory()
+		env.LogFile = LogFile()
+		env.TestDir = TestDir()
+		return env, nil
+	}
+
+	env.TestDir = path.Join(TestDir(), name)
+	env.RootDir = path.Join(env.TestDir, "mnt")
+	env.MntDir = env.RootDir
+	env.LogFile = path.Join(env.TestDir, "gcsfuse.log")
+	if err := os.MkdirAll(env.RootDir, DirPermission_0755); err != nil {
+		return nil, fmt.Errorf("MkdirAll(%q): %w", env.RootDir, err)
+	}
+	return env, nil
+}
+
+// DefaultTestEnv returns the env of the mount set up by TestMain.
+func DefaultTestEnv(ctx context.Context, storageClient *storage.Client) *TestEnv {
+	mu.RLock()
+	defer mu.RUnlock()
+	return &TestEnv{
+		Ctx:           ctx,
+		StorageClient: storageClient,
+		Bucket:        *testBucket,
+		DynamicBucket: dynamicBucketMounted,
+		OnlyDir:       onlyDirMounted,
+		RootDir:       mntDir,
+		MntDir:        mntDir,
+		LogFile:       logFile,
+		TestDir:       testDir,
+	}
+}
+
+// defaultTestEnv is DefaultTestEnv for helpers that don't talk to GCS.
+func defaultTestEnv() *TestEnv {
+	return DefaultTestEnv(context.Background(), nil)
+}
+
+// ForDynamicMount returns a copy of env whose tests run in bucket under a
+// dynamic mount at env.RootDir.
+func (env *TestEnv) ForDynamicMount(bucket string) *TestEnv {
+	c := *env
+	c.DynamicBucket = bucket
+	c.MntDir = path.Join(c.RootDir, bucket)
+	return &c
+}
+
+// BucketAndObject returns the GCS bucket and object name backing the given
+// path relative to env.MntDir.
+func (env *TestEnv) BucketAndObject(object string) (string, string) {
+	bucket := env.Bucket
+	if strings.Contains(bucket, "/") {
+		// This case arises when we run tests on mounted directory and pass
+		// bucket/directory in testbucket flag.
+		bucket, object = separateBucketAndObjectName(bucket, object)
+	}
+	if env.DynamicBucket != "" {
+		bucket = env.DynamicBucket
+	}
+	if env.OnlyDir != "" {
+		var suffix string
+		if strings.HasSuffix(object, "/") {
+			suffix = "/"
+		}
+		object = path.Join(env.OnlyDir, object) + suffix
+	}
+	return bucket, object
+}
+
+// SetupTestDirectory creates testDirName in env.MntDir and cleans up any
+// content present in it.
+func (env *TestEnv) SetupTestDirectory(testDirName string) string {
+	testDirPath := path.Join(env.MntDir, testDirName)
+	err := os.Mkdir(testDirPath, DirPermission_0755)
+	if err != nil && !strings.Contains(err.Error(), "file exists") {
+		log.Printf("Error while setting up directory %s for testing: %v", testDirPath, err)
+	}
+	CleanUpDir(testDirPath)
+	return testDirPath
+}
+
+// CleanMntDir cleans env.MntDir.
+func (env *TestEnv) CleanMntDir() {
+	CleanUpDir(env.MntDir)
+}
+
+// UnMount lazily unmounts env.RootDir.
+func (env *TestEnv) UnMount() error {
+	return unmount(env.RootDir)
+}
+
+// MountGCSFuse mounts with mountFunc unless tests run on --mountedDirectory.
+func (env *TestEnv) MountGCSFuse(flags []string, mountFunc func(*TestEnv, []string) error) error {
+	if MountedDirectory() != "" {
+		return nil
+	}
+	if err := mountFunc(env, flags); err != nil {
+		return fmt.Errorf("failed to mount GCSFuse: %w", err)
+	}
+	return nil
+}
+
+// UnmountGCSFuseAndDeleteLogFile undoes MountGCSFuse.
+func (env *TestEnv) UnmountGCSFuseAndDeleteLogFile() error {
+	if MountedDirectory() != "" {
+		return nil
+	}
+	if err := env.UnMount(); err != nil {
+		return fmt.Errorf("error in unmounting bucket: %w", err)
+	}
+	if err := os.Remove(env.LogFile); err != nil {
+		return fmt.Errorf("error in deleting log file: %w", err)
+	}
+	return nil
+}
+
+// Parallel marks t as parallel. Tests on --mountedDirectory share one mount
+// and one log file, so they keep running one at a time.
+func Parallel(t *testing.T) {
+	if MountedDirectory() == "" {
+		t.Parallel()
+	}
+}
+
+// RunTestsOnlyForStaticMount skips t for dynamic and only-dir mounts.
+func (env *TestEnv) RunTestsOnlyForStaticMount(t *testing.T) {
+	if env.DynamicBucket != "" || env.OnlyDir != "" {
+		t.Log("This test will run only for static mounting...")
+		t.SkipNow()
+	}
+}
@@ -10,12 +10,17 @@ import (
 )
 
 func YAMLConfigFile(config config.MountConfig, fileName string) (filePath string) {
+	return YAMLConfigFileInEnv(defaultTestEnv(), config, fileName)
+}
+
+// YAMLConfigFileInEnv writes config as fileName in env.TestDir.
+func YAMLConfigFileInEnv(env *TestEnv, config config.MountConfig, fileName string) (filePath string) {
 	yamlData, err := yaml.Marshal(&config)
 	if err != nil {
 		LogAndExit(fmt.Sprintf("Error while marshaling config file: %v", err))
 	}
 
-	filePath = path.Join(TestDir(), fileName)
+	filePath = path.Join(env.TestDir, fileName)
 	err = os.WriteFile(filePath, yamlData, 0644)
 	if err != nil {
 		LogAndExit("Unable to write data into config file.")
@@ -18,7 +18,6 @@ import (
 	"fmt"
 	"os"
 	"path"
-	"syscall"
 	"testing"
 
 	"github.com/googlecloudplatform/gcsfuse/v2/tools/integration_tests/util/operations"
@@ -35,7 +34,7 @@ const (
 
 func writeFile(fileName string, fileSize int64, t *testing.T) error {
 	filePath := path.Join(setup.MntDir(), DirForConcurrentWrite, fileName)
-	f, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|syscall.O_DIRECT, WritePermission_0200)
+	f, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|operations.ODirect, WritePermission_0200)
 	if err != nil {
 		return fmt.Errorf("Open file for write at start: %v", err)
 	}
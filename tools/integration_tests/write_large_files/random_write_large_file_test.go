@@ -18,7 +18,6 @@ import (
 	rand2 "math/rand"
 	"os"
 	"path"
-	"syscall"
 	"testing"
 
 	"github.com/googlecloudplatform/gcsfuse/v2/tools/integration_tests/util/operations"
@@ -43,7 +42,7 @@ func TestWriteLargeFileRandomly(t *testing.T) {
 	// Clean up.
 	defer operations.RemoveDir(randomWriteDir)
 
-	f, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|syscall.O_DIRECT, WritePermission_0200)
+	f, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|operations.ODirect, WritePermission_0200)
 	if err != nil {
 		t.Fatalf("Open file for write at start: %v", err)
 	}